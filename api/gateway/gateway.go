@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: gateway.go
+ * Project: simple-dsp
+ * Description: BidService的HTTP/JSON桥接，使合作方可通过REST调用与gRPC相同的竞价接口
+ *
+ * 主要功能:
+ * - 将 POST /v1/bid 的JSON请求转换为BidService调用
+ * - 将gRPC状态码映射为HTTP状态码
+ *
+ * 实现细节:
+ * - 使用protojson编解码，字段名与proto定义一致（snake_case），同时接受lowerCamelCase
+ * - 请求经由与gRPC服务相同的拦截器链，指标的method/status标签与gRPC调用一致
+ * - 参数校验由BidService实现统一完成
+ * - 路由与错误体格式与grpc-gateway保持一致，便于后续切换为生成代码
+ *
+ * 依赖关系:
+ * - github.com/gin-gonic/gin
+ * - google.golang.org/grpc
+ * - google.golang.org/protobuf/encoding/protojson
+ * - simple-dsp/api/proto/dsp/v1
+ *
+ * 注意事项:
+ * - 新增RPC方法时需同步注册路由
+ * - 无广告返回时响应204
+ */
+
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	dspv1 "simple-dsp/api/proto/dsp/v1"
+	"simple-dsp/pkg/logger"
+)
+
+// processBidMethod 与gRPC一致的完整方法名
+const processBidMethod = "/dsp.v1.BidService/ProcessBid"
+
+// maxBodySize 请求体最大字节数
+const maxBodySize = 1 << 20
+
+var (
+	unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+	marshalOptions   = protojson.MarshalOptions{UseProtoNames: true}
+)
+
+// errorBody 错误响应体，与grpc-gateway格式一致
+type errorBody struct {
+	Code    int32  `json:"code"`
+	Message string `json:"message"`
+}
+
+// Gateway BidService的HTTP桥接
+type Gateway struct {
+	server      dspv1.BidServiceServer
+	interceptor grpc.UnaryServerInterceptor
+	logger      *logger.Logger
+}
+
+// NewGateway 创建HTTP桥接
+// interceptors应与gRPC服务器使用的一元拦截器保持一致
+func NewGateway(server dspv1.BidServiceServer, logger *logger.Logger, interceptors ...grpc.UnaryServerInterceptor) *Gateway {
+	return &Gateway{
+		server:      server,
+		interceptor: chainInterceptors(interceptors),
+		logger:      logger,
+	}
+}
+
+// Register 注册路由
+func (g *Gateway) Register(r gin.IRouter) {
+	r.POST("/v1/bid", g.ProcessBid)
+}
+
+// ProcessBid 处理REST竞价请求
+func (g *Gateway) ProcessBid(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxBodySize))
+	if err != nil {
+		writeError(c, status.Error(codes.InvalidArgument, "读取请求体失败"))
+		return
+	}
+
+	var req dspv1.BidRequest
+	if err := unmarshalOptions.Unmarshal(data, &req); err != nil {
+		writeError(c, status.Error(codes.InvalidArgument, "无效的请求格式: "+err.Error()))
+		return
+	}
+
+	info := &grpc.UnaryServerInfo{Server: g.server, FullMethod: processBidMethod}
+	resp, err := g.interceptor(c.Request.Context(), &req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return g.server.ProcessBid(ctx, req.(*dspv1.BidRequest))
+	})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		g.logger.Warn("REST竞价请求失败",
+			"request_id", req.GetRequestId(),
+			"error", err)
+		writeError(c, err)
+		return
+	}
+
+	out, err := marshalOptions.Marshal(resp.(*dspv1.BidResponse))
+	if err != nil {
+		writeError(c, status.Error(codes.Internal, "编码响应失败"))
+		return
+	}
+	c.Data(http.StatusOK, "application/json", out)
+}
+
+// writeError 写出错误响应
+func writeError(c *gin.Context, err error) {
+	st := status.Convert(err)
+	c.JSON(HTTPStatusFromCode(st.Code()), errorBody{
+		Code:    int32(st.Code()),
+		Message: st.Message(),
+	})
+}
+
+// HTTPStatusFromCode gRPC状态码到HTTP状态码的映射，与grpc-gateway一致
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// chainInterceptors 将多个一元拦截器串联为一个
+func chainInterceptors(interceptors []grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		next := handler
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, inner := interceptors[i], next
+			next = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, inner)
+			}
+		}
+		return next(ctx, req)
+	}
+}
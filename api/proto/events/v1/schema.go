@@ -0,0 +1,12 @@
+// Package eventsv1 广告事件的Protobuf定义，注册到Schema Registry的Schema即event.proto的内容
+package eventsv1
+
+import _ "embed"
+
+// EventSchema event.proto的内容，作为Protobuf Schema注册到Schema Registry
+//
+//go:embed event.proto
+var EventSchema string
+
+// EventMessage 事件消息的完整名称
+const EventMessage = "dsp.events.v1.Event"
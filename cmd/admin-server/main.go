@@ -20,9 +20,14 @@
  * 依赖关系:
  * - github.com/gin-gonic/gin
  * - simple-dsp/internal/admin
+ * - simple-dsp/internal/auth
+ * - simple-dsp/internal/bidding
  * - simple-dsp/internal/budget
  * - simple-dsp/internal/config
+ * - simple-dsp/internal/forecast
  * - simple-dsp/internal/frequency
+ * - simple-dsp/internal/funnel
+ * - simple-dsp/internal/handlers
  * - simple-dsp/internal/stats
  * - simple-dsp/pkg/* (所有基础包)
  *
@@ -37,23 +42,45 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
 	"simple-dsp/internal/admin"
+	"simple-dsp/internal/audit"
+	"simple-dsp/internal/auth"
+	"simple-dsp/internal/automation"
+	"simple-dsp/internal/bidding"
 	"simple-dsp/internal/budget"
+	"simple-dsp/internal/campaign"
 	iconfig "simple-dsp/internal/config"
+	"simple-dsp/internal/floor"
+	"simple-dsp/internal/forecast"
 	"simple-dsp/internal/frequency"
+	"simple-dsp/internal/funnel"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/ledger"
+	"simple-dsp/internal/placement"
+	"simple-dsp/internal/skadn"
 	"simple-dsp/internal/stats"
+	"simple-dsp/internal/trash"
+	"simple-dsp/internal/velocity"
 	"simple-dsp/pkg/clients"
+	"simple-dsp/pkg/cluster"
 	pkgconfig "simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/httpserver"
+	"simple-dsp/pkg/leader"
+	"simple-dsp/pkg/lock"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func main() {
@@ -68,9 +95,13 @@ func main() {
 	defer log.Sync()
 
 	// 3. 初始化监控指标
-	metricsCollector, err := metrics.NewMetrics(cfg.Metrics)
-	if cfg.Metrics.PushGateway != "" {
-		metricsCollector.StartPushGateway(cfg.Metrics.PushGateway)
+	metricsCollector, err := metrics.Bootstrap(cfg.Metrics, "admin-server")
+	if err != nil {
+		log.Fatal("初始化监控指标失败", "error", err)
+	}
+	defer metricsCollector.Close()
+	if err := metricsCollector.RegisterLogSink(log); err != nil {
+		log.Fatal("注册日志发送指标失败", "error", err)
 	}
 
 	// 4. 初始化Redis客户端
@@ -84,6 +115,16 @@ func main() {
 	configService := iconfig.NewService(redisClient, log)
 	configHandler := admin.NewConfigHandler(configService)
 
+	// 6.1 管理接口和指标接口的IP白名单，紧急调整时通过配置中心的admin.allowlist下发，无需重启
+	allowlist, err := middleware.NewIPAllowlist(cfg.Admin.Allowlist)
+	if err != nil {
+		log.Fatal("初始化IP白名单失败", "error", err)
+	}
+	metricsCollector.SetAccessControl(allowlist.Allow)
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	go watchAllowlist(watchCtx, configService, allowlist, log, cfg.Admin.Allowlist)
+
 	// 7. 初始化各个模块
 	// 7.1 初始化预算管理器
 	budgetMgr := budget.NewManager(
@@ -100,11 +141,19 @@ func main() {
 	)
 
 	// 7.3 初始化频次控制器
-	freqCtrl := frequency.NewController(
+	freqCtrl, err := frequency.New(
+		cfg.Bidding.Frequency,
 		redisClient,
 		log,
 		metricsCollector,
 	)
+	if err != nil {
+		log.Fatal("初始化频次控制器失败", "error", err)
+	}
+	freqConfigs := frequency.NewConfigCache(cfg.Bidding.Frequency, redisClient, log)
+	freqConfigs.Start()
+	defer freqConfigs.Stop()
+	freqCtrl = frequency.WithConfigCache(freqCtrl, freqConfigs)
 
 	// 7.4 初始化管理后台服务
 	adminService := admin.NewService(
@@ -114,21 +163,170 @@ func main() {
 		metricsCollector,
 		freqCtrl,
 	)
+	adminService.SetSKAdNetworkStore(skadn.NewRedisStore(redisClient))
+	adminService.SetRateLimiter(frequency.NewRateLimiter(redisClient, cfg.Bidding.Frequency.QPSCacheTTL, log, metricsCollector))
+
+	// 后台定时任务通过分布式锁保证只有一个实例执行
+	jobLocker := lock.NewLocker(cfg.Lock, clients.InitLockNodes(cfg, redisClient, log), log)
+
+	// 清理、自动化规则评估和日终结算只在主实例上运行，主实例故障后自动切换
+	// 管理后台与竞价服务运行不同的任务，使用单独的选主组
+	leaderCfg := pkgconfig.LeaderConfig{Election: cfg.Leader.AdminElection, RetryInterval: cfg.Leader.RetryInterval}
+	if leaderCfg.Election == "" {
+		leaderCfg.Election = "admin-server"
+	}
+	elector := leader.NewElector(leaderCfg, jobLocker, log)
+	elector.SetMetrics(metricsCollector)
+
+	// 注册本实例，系统状态中展示各服务存活的实例
+	instanceRegistry := cluster.NewRegistry(cfg.Cluster, redisClient, "admin-server", log)
+	instanceRegistry.Start()
+	defer instanceRegistry.Stop()
+	adminService.SetInstanceRegistry(instanceRegistry)
+
+	// 7.5 初始化投放预估，胜率和成交价使用竞价服务汇总的底价情报
+	forecaster := forecast.NewForecaster(
+		forecast.NewRedisStore(redisClient, cfg.Stats.Forecast.RetentionDays),
+		floor.NewTracker(cfg.Bidding.Floor, redisClient, log, metricsCollector),
+		cfg.Bidding.Floor.MinSamples,
+	)
+	forecastHandler := forecast.NewHandler(forecaster, log)
+
+	// 7.6 初始化出价策略管理，修改后通知竞价服务刷新策略缓存
+	// 未配置PostgreSQL时出价策略接口返回503
+	var db *gorm.DB
+	var strategyRepo bidding.Repository
+	if cfg.Postgres.Host != "" {
+		db, err = database.Open(cfg.Postgres, log, metricsCollector)
+		if err != nil {
+			log.Fatal("初始化数据库失败", "error", err)
+		}
+		defer database.Close(db)
+		strategyRepo = bidding.NewGormRepository(db)
+	}
+	strategyHandler := handlers.NewStrategyHandler(strategyRepo, redisClient, cfg.Bidding, log)
+
+	// 7.7 初始化登录认证，用户保存在PostgreSQL，会话保存在Redis
+	// 广告主自助接口依赖认证确定租户，只在启用认证时提供
+	var authService *auth.Service
+	var authHandler *handlers.AuthHandler
+	var portalHandler *handlers.PortalHandler
+	if cfg.Admin.Auth.Enabled {
+		if db == nil {
+			log.Fatal("启用管理后台认证需要配置PostgreSQL")
+		}
+		authService = auth.NewService(cfg.Admin.Auth, auth.NewGormStore(db), redisClient, log)
+		authHandler = handlers.NewAuthHandler(authService, log)
+		portalHandler = handlers.NewPortalHandler(db, log)
+	}
+
+	// 7.8 初始化首页看板，定时汇总当天的投放数据和系统告警
+	dashboard := admin.NewDashboard(cfg.Admin.Dashboard, db, stats.NewHourlyStore(redisClient), redisClient, log)
+	dashboard.SetInstanceRegistry(instanceRegistry)
+	dashboard.Start()
+	defer dashboard.Stop()
+	// 看板的汇总结果作为预聚合指标单独暴露，运营看板不必抓取按广告统计的指标
+	if err := metricsCollector.RegisterAggregate(admin.NewDashboardCollector(dashboard)); err != nil {
+		log.Fatal("注册看板指标失败", "error", err)
+	}
+
+	// 7.9 初始化竞价漏斗，消费出价、竞价成功、展示、点击和转化事件，按请求关联后写入数据库
+	var funnelHandler *handlers.FunnelHandler
+	if cfg.Stats.Funnel.Enabled {
+		if db == nil {
+			log.Fatal("启用竞价漏斗需要配置PostgreSQL")
+		}
+		funnelStore := funnel.NewGormStore(db)
+		funnelConsumer := funnel.NewConsumer(cfg.Kafka.Brokers, cfg.Stats.Funnel, funnelStore, log)
+		funnelConsumer.Start()
+		defer funnelConsumer.Stop()
+		funnelHandler = handlers.NewFunnelHandler(funnelStore, log)
+	}
+
+	// 7.10 初始化按地域和设备拆分的报表，数据由竞价服务按天写入Redis
+	var breakdownHandler *handlers.BreakdownHandler
+	if cfg.Stats.Dimensions.Enabled {
+		breakdownHandler = handlers.NewBreakdownHandler(stats.NewDimensionStore(redisClient, cfg.Stats.Dimensions.RetentionDays), log)
+	}
+
+	// 7.11 初始化消耗速度保护管理，查看和恢复竞价服务自动暂停的出价策略
+	var velocityHandler *handlers.VelocityHandler
+	if db != nil {
+		velocityGuard := velocity.NewGuard(cfg.Budget.Velocity, nil, strategyRepo, redisClient, log, metricsCollector)
+		velocityGuard.SetAuditRecorder(audit.NewRecorder(db))
+		velocityHandler = handlers.NewVelocityHandler(velocityGuard, log)
+	}
+
+	// 7.12 初始化供应路径表现，定时从竞价漏斗汇总各供应路径的胜率、CTR和CVR，竞价服务据此调整出价
+	var placementHandler *handlers.PlacementHandler
+	if cfg.Stats.Placements.Enabled {
+		if db == nil {
+			log.Fatal("汇总供应路径表现需要配置PostgreSQL")
+		}
+		placementStore := placement.NewStore(redisClient)
+		placementRefresher := placement.NewRefresher(cfg.Stats.Placements, placement.NewGormSource(db), placementStore, log)
+		placementRefresher.SetLocker(jobLocker)
+		placementRefresher.Start()
+		defer placementRefresher.Stop()
+		placementHandler = handlers.NewPlacementHandler(placementStore, log)
+	}
+
+	// 7.13 初始化回收站，定时彻底删除超过保留天数的广告和计划
+	// 素材由素材服务管理文件存储，不在管理后台清理
+	trashStores := map[string]trash.Store{trash.ResourceAds: adminService.AdTrash()}
+	if db != nil {
+		trashStores[trash.ResourceCampaigns] = handlers.NewCampaignHandler(db, log, campaign.NewConfigManager()).Trash()
+	}
+	purger := trash.NewPurger(cfg.Trash, trashStores, log)
+	purger.SetLocker(jobLocker)
+	elector.Register(purger)
+	trashHandler := handlers.NewTrashHandler(purger, log)
+
+	// 7.14 初始化自动化规则，定时按广告统计评估规则并调整出价策略
+	var automationHandler *handlers.AutomationHandler
+	if db != nil {
+		automationEngine := automation.NewEngine(cfg.Automation, automation.NewGormStore(db), strategyRepo, stats.NewHourlyStore(redisClient), redisClient, log)
+		automationEngine.SetAuditRecorder(audit.NewRecorder(db))
+		automationEngine.SetLocker(jobLocker)
+		elector.Register(automationEngine)
+		automationHandler = handlers.NewAutomationHandler(db, automationEngine, log)
+	}
+
+	// 7.15 初始化计费账本，消费展示和竞价成功事件写入消耗流水，定时日终结算
+	var ledgerHandler *handlers.LedgerHandler
+	if cfg.Ledger.Enabled {
+		if db == nil {
+			log.Fatal("启用计费账本需要配置PostgreSQL")
+		}
+		accountLedger := ledger.New(cfg.Ledger, ledger.NewGormStore(db), log)
+		accountLedger.SetLocker(jobLocker)
+		// 各实例在同一消费组中分担分区，日终结算只在主实例上运行
+		ledgerConsumer := ledger.NewConsumer(cfg.Kafka.Brokers, cfg.Ledger, accountLedger, ledger.NewStrategyResolver(strategyRepo, db, cfg.Ledger.ResolveCacheTTL), log)
+		ledgerConsumer.Start()
+		defer ledgerConsumer.Stop()
+		elector.Register(accountLedger)
+		ledgerHandler = handlers.NewLedgerHandler(db, accountLedger, log)
+	}
+
+	// 任务注册完成后开始竞选，退出时先于依赖的数据库和Redis停止任务
+	elector.Start()
+	defer elector.Stop()
 
 	// 8. 初始化HTTP服务器
-	router := initRouter(adminService, configHandler)
-	srv := &http.Server{
-		Addr:           fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler:        router,
-		ReadTimeout:    cfg.Server.ReadTimeout,
-		WriteTimeout:   cfg.Server.WriteTimeout,
-		MaxHeaderBytes: cfg.Server.MaxHeaderBytes,
+	router := initRouter(cfg.Admin, allowlist, authService, authHandler, portalHandler, adminService, dashboard, funnelHandler, breakdownHandler, configHandler, forecastHandler, strategyHandler, velocityHandler, placementHandler, trashHandler, automationHandler, ledgerHandler)
+	srv, err := httpserver.New(cfg.Server, router)
+	if err != nil {
+		log.Fatal("创建HTTP服务器失败", "error", err)
+	}
+	ln, err := httpserver.Listen(srv.Addr, cfg.Server.TCPKeepAlive)
+	if err != nil {
+		log.Fatal("HTTP端口监听失败", "port", cfg.Server.Port, "error", err)
 	}
 
 	// 9. 启动服务器
 	go func() {
 		log.Info("启动管理后台服务器", "port", cfg.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 			log.Fatal("管理后台服务器启动失败", "error", err)
 		}
 	}()
@@ -149,19 +347,91 @@ func main() {
 }
 
 // initRouter 初始化路由
-func initRouter(adminService *admin.Service, configHandler *admin.ConfigHandler) *gin.Engine {
+func initRouter(adminCfg pkgconfig.AdminConfig, allowlist *middleware.IPAllowlist, authService *auth.Service, authHandler *handlers.AuthHandler, portalHandler *handlers.PortalHandler, adminService *admin.Service, dashboard *admin.Dashboard, funnelHandler *handlers.FunnelHandler, breakdownHandler *handlers.BreakdownHandler, configHandler *admin.ConfigHandler, forecastHandler *forecast.Handler, strategyHandler *handlers.StrategyHandler, velocityHandler *handlers.VelocityHandler, placementHandler *handlers.PlacementHandler, trashHandler *handlers.TrashHandler, automationHandler *handlers.AutomationHandler, ledgerHandler *handlers.LedgerHandler) *gin.Engine {
 	router := gin.Default()
 
+	// 先按IP白名单拒绝，再处理浏览器控制台的跨域访问
+	// 注册在引擎上以便处理没有对应路由的预检请求
+	router.Use(allowlist.Handler(), middleware.CORS(adminCfg.CORS))
+
+	// 启用认证时除登录接口外都需要会话或API令牌，预检请求已由CORS处理
+	// 广告主用户只能访问登录和自助接口
+	if authService != nil {
+		router.Use(authService.Middleware())
+		authHandler.RegisterRoutes(router)
+		portalHandler.RegisterRoutes(router)
+	}
+
 	// 注册配置管理路由
 	configHandler.RegisterRoutes(router)
 
+	// 注册出价策略路由
+	strategyHandler.RegisterRoutes(router)
+
+	// 启用竞价漏斗时注册漏斗报表路由
+	if funnelHandler != nil {
+		funnelHandler.RegisterRoutes(router)
+	}
+
+	// 启用报表维度时注册按维度拆分的报表路由
+	if breakdownHandler != nil {
+		breakdownHandler.RegisterRoutes(router)
+	}
+
+	// 配置了PostgreSQL时注册消耗速度保护路由
+	if velocityHandler != nil {
+		velocityHandler.RegisterRoutes(router)
+	}
+
+	// 汇总供应路径表现时注册查询路由
+	if placementHandler != nil {
+		placementHandler.RegisterRoutes(router)
+	}
+
+	// 配置了PostgreSQL时注册自动化规则路由
+	if automationHandler != nil {
+		automationHandler.RegisterRoutes(router)
+	}
+
+	// 启用计费账本时注册流水和账单路由
+	if ledgerHandler != nil {
+		ledgerHandler.RegisterRoutes(router)
+	}
+
+	// 注册回收站路由
+	trashHandler.RegisterRoutes(router)
+
 	// 注册管理后台路由
 	adminGroup := router.Group("/api/v1/admin")
 	{
+		adminGroup.GET("/dashboard", dashboard.Get)
 		adminGroup.GET("/stats/daily", adminService.GetDailyStats)
 		adminGroup.GET("/stats/hourly", adminService.GetHourlyStats)
 		adminGroup.GET("/system/status", adminService.GetSystemStatus)
+		adminGroup.POST("/forecast", forecastHandler.Forecast)
 	}
 
 	return router
 }
+
+// watchAllowlist 应用配置中心的IP白名单，配置被删除时恢复配置文件中的设置，无效的配置不生效
+func watchAllowlist(ctx context.Context, service *iconfig.Service, allowlist *middleware.IPAllowlist, log *logger.Logger, fallback pkgconfig.IPAllowlistConfig) {
+	err := service.Watch(ctx, middleware.AllowlistConfigKey, func(value json.RawMessage) {
+		rules := fallback
+		if value != nil {
+			rules = pkgconfig.IPAllowlistConfig{}
+			if err := json.Unmarshal(value, &rules); err != nil {
+				log.Error("解析IP白名单配置失败", "error", err)
+				return
+			}
+		}
+		if err := allowlist.Update(rules); err != nil {
+			log.Error("IP白名单配置无效", "error", err)
+			return
+		}
+		log.Info("IP白名单已更新", "enabled", rules.Enabled, "cidrs", rules.CIDRs)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error("监听IP白名单配置失败", "error", err)
+	}
+}
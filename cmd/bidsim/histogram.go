@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// subBuckets 每个2的幂区间内的分桶数，分位数的相对误差不超过1/subBuckets
+const subBuckets = 64
+
+// Histogram 对数线性分桶的延迟直方图，按微秒计数
+// 内存占用只与最大延迟的量级有关，与样本数无关，适合长时间压测
+type Histogram struct {
+	mu     sync.Mutex
+	counts []int64
+	total  int64
+	max    time.Duration
+}
+
+// Record 记录一个延迟样本
+func (h *Histogram) Record(d time.Duration) {
+	us := d.Microseconds()
+	if us < 0 {
+		us = 0
+	}
+	idx := bucketOf(us)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if idx >= len(h.counts) {
+		grown := make([]int64, idx+1)
+		copy(grown, h.counts)
+		h.counts = grown
+	}
+	h.counts[idx]++
+	h.total++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// Count 样本数
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.total
+}
+
+// Max 最大延迟
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.max
+}
+
+// Quantile 返回分位数q所在分桶的上界，不超过最大延迟
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.total == 0 {
+		return 0
+	}
+	// 与排序后取下标(n-1)*q的样本一致
+	rank := int64(float64(h.total-1)*q) + 1
+	var seen int64
+	for idx, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			if d := time.Duration(bucketValue(idx)) * time.Microsecond; d < h.max {
+				return d
+			}
+			return h.max
+		}
+	}
+	return h.max
+}
+
+// bucketOf 延迟所在的分桶，小于2*subBuckets微秒时每微秒一个分桶
+// 更大的值按最高7位分桶，每个2的幂区间分为subBuckets个分桶
+func bucketOf(us int64) int {
+	if us < 2*subBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(uint64(us)) - 7
+	return 2*subBuckets + (shift-1)*subBuckets + int(us>>shift) - subBuckets
+}
+
+// bucketValue 分桶的上界(微秒)
+func bucketValue(idx int) int64 {
+	if idx < 2*subBuckets {
+		return int64(idx)
+	}
+	idx -= 2 * subBuckets
+	shift := idx/subBuckets + 1
+	mantissa := int64(idx%subBuckets + subBuckets)
+	return (mantissa+1)<<shift - 1
+}
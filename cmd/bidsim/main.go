@@ -0,0 +1,466 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: main.go
+ * Project: simple-dsp
+ * Description: 竞价模拟器，用于压测和容量评估
+ *
+ * 主要功能:
+ * - 按配置的QPS生成模拟流量
+ * - 按权重分布生成设备、地域和广告位
+ * - 统计竞价服务的延迟分位数
+ * - 统计错误率和填充率
+ *
+ * 实现细节:
+ * - 开环发送：按QPS计算每个请求的计划发送时间，不等待之前的请求完成
+ * - 延迟从计划发送时间开始计算，包含排队时间，服务变慢时不会因少发请求而低估延迟
+ * - 所有结果(包括非200和连接错误)都计入延迟
+ * - 分布通过 "key:weight,key:weight" 形式配置
+ * - 延迟记录在对数线性分桶的直方图中，内存占用固定
+ * - 按秒输出实时进度
+ *
+ * 依赖关系:
+ * - simple-dsp/internal/traffic
+ *
+ * 注意事项:
+ * - 压测目标应为独立的测试环境
+ * - 并发请求数达到-concurrency时新请求排队，排队时间计入延迟
+ * - 压测机自身的连接数和CPU可能成为瓶颈
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"simple-dsp/internal/traffic"
+)
+
+// SlotTemplate 广告位模板
+type SlotTemplate struct {
+	Width    int
+	Height   int
+	Position string
+	AdType   string
+	MinPrice float64
+	MaxPrice float64
+}
+
+// slotTemplates 预置的广告位模板
+var slotTemplates = map[string]SlotTemplate{
+	"banner":       {Width: 320, Height: 50, Position: "top", AdType: "banner", MinPrice: 0.5, MaxPrice: 5},
+	"rectangle":    {Width: 300, Height: 250, Position: "middle", AdType: "banner", MinPrice: 1, MaxPrice: 10},
+	"interstitial": {Width: 1080, Height: 1920, Position: "fullscreen", AdType: "interstitial", MinPrice: 3, MaxPrice: 30},
+	"native":       {Width: 1200, Height: 627, Position: "feed", AdType: "native", MinPrice: 1, MaxPrice: 15},
+	"splash":       {Width: 1080, Height: 1920, Position: "splash", AdType: "splash", MinPrice: 5, MaxPrice: 50},
+}
+
+// Options 模拟参数
+type Options struct {
+	Target      string
+	QPS         float64
+	Duration    time.Duration
+	Concurrency int
+	Timeout     time.Duration
+	Users       int
+	MaxSlots    int
+	Devices     string
+	Geos        string
+	Slots       string
+	Seed        int64
+}
+
+// weighted 带权重的取值分布
+type weighted struct {
+	values  []string
+	cumsum  []float64
+	totalWt float64
+}
+
+// Generator 流量生成器
+type Generator struct {
+	opts    Options
+	devices *weighted
+	geos    *weighted
+	slots   *weighted
+	rnd     *rand.Rand
+	mu      sync.Mutex
+	seq     uint64
+}
+
+// Stats 压测统计
+type Stats struct {
+	sent      int64
+	succeeded int64
+	filled    int64
+	failed    int64
+	statuses  sync.Map
+	latencies Histogram
+}
+
+// job 待发送的请求和计划发送时间
+type job struct {
+	req      *traffic.Request
+	intended time.Time
+}
+
+func main() {
+	opts := parseFlags()
+
+	gen, err := NewGenerator(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "初始化流量生成器失败: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+	if opts.Duration > 0 {
+		var durationCancel context.CancelFunc
+		ctx, durationCancel = context.WithTimeout(ctx, opts.Duration)
+		defer durationCancel()
+	}
+
+	stats := &Stats{}
+	client := &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			MaxIdleConns:        opts.Concurrency * 2,
+			MaxIdleConnsPerHost: opts.Concurrency * 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+
+	startTime := time.Now()
+
+	go reportProgress(ctx, stats)
+
+	jobs := make(chan job, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sendOne(ctx, client, opts.Target, j.req, j.intended, stats)
+			}
+		}()
+	}
+	schedule(ctx, opts.QPS, startTime, func(intended time.Time) bool {
+		select {
+		case jobs <- job{req: gen.Next(), intended: intended}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(jobs)
+	wg.Wait()
+
+	stats.PrintSummary(os.Stdout, time.Since(startTime))
+}
+
+// parseFlags 解析命令行参数
+func parseFlags() Options {
+	var opts Options
+	flag.StringVar(&opts.Target, "target", "http://localhost:8080/api/v1/traffic", "竞价服务地址")
+	flag.Float64Var(&opts.QPS, "qps", 100, "目标QPS")
+	flag.DurationVar(&opts.Duration, "duration", 30*time.Second, "压测时长，0表示直到手动停止")
+	flag.IntVar(&opts.Concurrency, "concurrency", 256, "最大并发请求数，超出时请求排队，排队时间计入延迟")
+	flag.DurationVar(&opts.Timeout, "timeout", 300*time.Millisecond, "单次请求超时时间")
+	flag.IntVar(&opts.Users, "users", 100000, "模拟用户池大小")
+	flag.IntVar(&opts.MaxSlots, "max-slots", 3, "单次请求最多广告位数")
+	flag.StringVar(&opts.Devices, "devices", "android:60,ios:35,other:5", "设备系统分布")
+	flag.StringVar(&opts.Geos, "geos", "CN-11:20,CN-31:20,CN-44:25,CN-33:15,CN-51:10,CN-42:10", "地域分布")
+	flag.StringVar(&opts.Slots, "slots", "banner:40,rectangle:20,native:25,interstitial:10,splash:5", "广告位类型分布")
+	flag.Int64Var(&opts.Seed, "seed", time.Now().UnixNano(), "随机数种子")
+	flag.Parse()
+
+	if opts.QPS <= 0 {
+		fmt.Fprintln(os.Stderr, "-qps 必须大于0")
+		os.Exit(2)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	if opts.MaxSlots <= 0 {
+		opts.MaxSlots = 1
+	}
+	if opts.Users <= 0 {
+		opts.Users = 1
+	}
+	return opts
+}
+
+// NewGenerator 创建流量生成器
+func NewGenerator(opts Options) (*Generator, error) {
+	devices, err := parseWeighted(opts.Devices)
+	if err != nil {
+		return nil, fmt.Errorf("解析设备分布失败: %w", err)
+	}
+	geos, err := parseWeighted(opts.Geos)
+	if err != nil {
+		return nil, fmt.Errorf("解析地域分布失败: %w", err)
+	}
+	slots, err := parseWeighted(opts.Slots)
+	if err != nil {
+		return nil, fmt.Errorf("解析广告位分布失败: %w", err)
+	}
+	for _, name := range slots.values {
+		if _, ok := slotTemplates[name]; !ok {
+			return nil, fmt.Errorf("未知的广告位类型: %s", name)
+		}
+	}
+
+	return &Generator{
+		opts:    opts,
+		devices: devices,
+		geos:    geos,
+		slots:   slots,
+		rnd:     rand.New(rand.NewSource(opts.Seed)),
+	}, nil
+}
+
+// Next 生成下一个模拟请求
+func (g *Generator) Next() *traffic.Request {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.seq++
+	userNo := g.rnd.Intn(g.opts.Users)
+	osType := g.devices.pick(g.rnd)
+
+	req := &traffic.Request{
+		RequestID: fmt.Sprintf("sim-%d-%d", g.opts.Seed, g.seq),
+		UserID:    fmt.Sprintf("sim-user-%d", userNo),
+		DeviceID:  fmt.Sprintf("sim-device-%s-%d", osType, userNo),
+		IP:        fmt.Sprintf("10.%d.%d.%d", g.rnd.Intn(256), g.rnd.Intn(256), 1+g.rnd.Intn(254)),
+		UserAgent: userAgentFor(osType),
+		Timestamp: time.Now().UnixMilli(),
+		ExtraParams: map[string]string{
+			"os":  osType,
+			"geo": g.geos.pick(g.rnd),
+		},
+	}
+
+	slotCount := 1 + g.rnd.Intn(g.opts.MaxSlots)
+	req.AdSlots = make([]traffic.AdSlot, 0, slotCount)
+	for i := 0; i < slotCount; i++ {
+		name := g.slots.pick(g.rnd)
+		tpl := slotTemplates[name]
+		req.AdSlots = append(req.AdSlots, traffic.AdSlot{
+			SlotID:   fmt.Sprintf("sim-%s-%d", name, i),
+			Width:    tpl.Width,
+			Height:   tpl.Height,
+			MinPrice: tpl.MinPrice,
+			MaxPrice: tpl.MaxPrice,
+			Position: tpl.Position,
+			AdType:   tpl.AdType,
+		})
+	}
+
+	return req
+}
+
+// schedule 开环调度请求，第i个请求的计划发送时间为start+i/qps，与之前的请求是否完成无关
+// 调度落后于计划时立即补发，dispatch返回false或ctx结束时停止
+func schedule(ctx context.Context, qps float64, start time.Time, dispatch func(intended time.Time) bool) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+
+	for i := 0; ; i++ {
+		intended := start.Add(time.Duration(float64(i) * float64(time.Second) / qps))
+		if wait := time.Until(intended); wait > 0 {
+			timer.Reset(wait)
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+			}
+		}
+		if ctx.Err() != nil || !dispatch(intended) {
+			return
+		}
+	}
+}
+
+// sendOne 发送单个请求并记录结果，延迟从计划发送时间开始计算
+func sendOne(ctx context.Context, client *http.Client, target string, req *traffic.Request, intended time.Time, stats *Stats) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		stats.recordFailure("marshal")
+		return
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		stats.recordFailure("request")
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-Request-ID", req.RequestID)
+
+	atomic.AddInt64(&stats.sent, 1)
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 压测结束时被取消的请求不计入统计
+			atomic.AddInt64(&stats.sent, -1)
+			return
+		}
+		stats.latencies.Record(time.Since(intended))
+		stats.recordFailure("transport")
+		return
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	latency := time.Since(intended)
+	stats.latencies.Record(latency)
+
+	if resp.StatusCode != http.StatusOK {
+		stats.recordFailure(strconv.Itoa(resp.StatusCode))
+		return
+	}
+
+	var result traffic.Response
+	filled := json.Unmarshal(data, &result) == nil && len(result.Data) > 0
+	stats.recordSuccess(filled)
+}
+
+// recordSuccess 记录成功请求，延迟已在发送时记录
+func (s *Stats) recordSuccess(filled bool) {
+	atomic.AddInt64(&s.succeeded, 1)
+	if filled {
+		atomic.AddInt64(&s.filled, 1)
+	}
+}
+
+// recordFailure 记录失败请求
+func (s *Stats) recordFailure(reason string) {
+	atomic.AddInt64(&s.failed, 1)
+	counter, _ := s.statuses.LoadOrStore(reason, new(int64))
+	atomic.AddInt64(counter.(*int64), 1)
+}
+
+// PrintSummary 输出压测汇总
+func (s *Stats) PrintSummary(w io.Writer, elapsed time.Duration) {
+	sent := atomic.LoadInt64(&s.sent)
+	succeeded := atomic.LoadInt64(&s.succeeded)
+	failed := atomic.LoadInt64(&s.failed)
+	filled := atomic.LoadInt64(&s.filled)
+
+	fmt.Fprintf(w, "\n===== 压测结果 =====\n")
+	fmt.Fprintf(w, "耗时:       %s\n", elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "发送请求:   %d (实际QPS %.1f)\n", sent, float64(sent)/elapsed.Seconds())
+	fmt.Fprintf(w, "成功:       %d\n", succeeded)
+	fmt.Fprintf(w, "失败:       %d (错误率 %.2f%%)\n", failed, percent(failed, sent))
+	fmt.Fprintf(w, "填充:       %d (填充率 %.2f%%)\n", filled, percent(filled, succeeded))
+
+	// 延迟包含所有结果，从计划发送时间开始计算
+	if s.latencies.Count() > 0 {
+		fmt.Fprintf(w, "延迟 P50:   %s\n", s.latencies.Quantile(0.50))
+		fmt.Fprintf(w, "延迟 P90:   %s\n", s.latencies.Quantile(0.90))
+		fmt.Fprintf(w, "延迟 P99:   %s\n", s.latencies.Quantile(0.99))
+		fmt.Fprintf(w, "延迟 P999:  %s\n", s.latencies.Quantile(0.999))
+		fmt.Fprintf(w, "延迟 Max:   %s\n", s.latencies.Max())
+	}
+
+	s.statuses.Range(func(key, value interface{}) bool {
+		fmt.Fprintf(w, "失败原因 %-10s %d\n", key, atomic.LoadInt64(value.(*int64)))
+		return true
+	})
+}
+
+// reportProgress 每秒输出一次进度
+func reportProgress(ctx context.Context, s *Stats) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var lastSent int64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sent := atomic.LoadInt64(&s.sent)
+			fmt.Fprintf(os.Stderr, "qps=%d sent=%d ok=%d failed=%d\n",
+				sent-lastSent, sent, atomic.LoadInt64(&s.succeeded), atomic.LoadInt64(&s.failed))
+			lastSent = sent
+		}
+	}
+}
+
+// parseWeighted 解析 "key:weight,key:weight" 形式的分布配置
+func parseWeighted(spec string) (*weighted, error) {
+	w := &weighted{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.SplitN(item, ":", 2)
+		weight := 1.0
+		if len(parts) == 2 {
+			v, err := strconv.ParseFloat(parts[1], 64)
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("无效的权重: %s", item)
+			}
+			weight = v
+		}
+		w.totalWt += weight
+		w.values = append(w.values, parts[0])
+		w.cumsum = append(w.cumsum, w.totalWt)
+	}
+	if len(w.values) == 0 || w.totalWt == 0 {
+		return nil, fmt.Errorf("分布配置为空: %q", spec)
+	}
+	return w, nil
+}
+
+// pick 按权重随机取值
+func (w *weighted) pick(rnd *rand.Rand) string {
+	target := rnd.Float64() * w.totalWt
+	idx := sort.SearchFloat64s(w.cumsum, target)
+	if idx >= len(w.values) {
+		idx = len(w.values) - 1
+	}
+	return w.values[idx]
+}
+
+// userAgentFor 根据设备系统生成UA
+func userAgentFor(osType string) string {
+	switch osType {
+	case "ios":
+		return "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148"
+	case "android":
+		return "Mozilla/5.0 (Linux; Android 13; Pixel 7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36"
+	default:
+		return "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36"
+	}
+}
+
+// percent 计算百分比
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
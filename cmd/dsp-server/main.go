@@ -9,10 +9,11 @@
  * - 初始化系统配置和日志
  * - 初始化各类客户端连接（Redis、Kafka等）
  * - 初始化业务模块（竞价引擎、预算管理等）
- * - 启动HTTP服务器和优雅关闭
+ * - 启动HTTP/gRPC服务器和优雅关闭
  *
  * 实现细节:
  * - 使用gin框架提供HTTP服务
+ * - gRPC服务注册健康检查与反射服务，支持keepalive与流控配置
  * - 实现优雅启动和关闭
  * - 统一的错误处理和日志记录
  * - 模块化的服务初始化
@@ -33,30 +34,70 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"simple-dsp/pkg/chaos"
 	"simple-dsp/pkg/clients"
 	"syscall"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 
+	"simple-dsp/internal/audit"
 	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/billing"
 	"simple-dsp/internal/budget"
+	iconfig "simple-dsp/internal/config"
+	"simple-dsp/internal/creative/approval"
+	"simple-dsp/internal/creative/fatigue"
 	"simple-dsp/internal/event"
+	"simple-dsp/internal/exchange"
+	"simple-dsp/internal/floor"
+	"simple-dsp/internal/forecast"
 	"simple-dsp/internal/frequency"
+	"simple-dsp/internal/identity"
+	"simple-dsp/internal/pixel"
+	"simple-dsp/internal/placement"
+	"simple-dsp/internal/pricing"
+	"simple-dsp/internal/profile"
 	"simple-dsp/internal/rta"
+	"simple-dsp/internal/segment"
+	"simple-dsp/internal/skadn"
 	"simple-dsp/internal/stats"
+	"simple-dsp/internal/supplychain"
 	"simple-dsp/internal/traffic"
+	"simple-dsp/internal/velocity"
+	"simple-dsp/pkg/cluster"
 	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/httpclient"
+	"simple-dsp/pkg/httpserver"
+	"simple-dsp/pkg/leader"
+	"simple-dsp/pkg/lock"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
+	"simple-dsp/pkg/schemaregistry"
+	"simple-dsp/pkg/timezone"
+	"simple-dsp/pkg/topics"
 
 	"github.com/gin-gonic/gin"
 	"github.com/segmentio/kafka-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+
+	"simple-dsp/api/gateway"
+	dspv1 "simple-dsp/api/proto/dsp/v1"
+	"simple-dsp/pkg/middleware"
 )
 
 func main() {
@@ -81,9 +122,13 @@ func main() {
 	}()
 
 	// 初始化监控指标
-	metricsCollector, err := metrics.NewMetrics(cfg.Metrics)
-	if cfg.Metrics.PushGateway != "" {
-		metricsCollector.StartPushGateway(cfg.Metrics.PushGateway)
+	metricsCollector, err := metrics.Bootstrap(cfg.Metrics, "dsp-server")
+	if err != nil {
+		log.Fatal("初始化监控指标失败", "error", err)
+	}
+	defer metricsCollector.Close()
+	if err := metricsCollector.RegisterLogSink(log); err != nil {
+		log.Fatal("注册日志发送指标失败", "error", err)
 	}
 
 	// 初始化Redis客户端
@@ -95,6 +140,43 @@ func main() {
 		}
 	}(redisClient)
 
+	// 日志采样可通过配置中心的log.sampling在运行时调整
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	defer stopWatch()
+	configService := iconfig.NewService(redisClient, log)
+	go watchLogSampling(watchCtx, configService, log, cfg.Log.Sampling)
+
+	// 指标接口和统计查询接口的IP白名单，可通过配置中心的admin.allowlist在运行时替换
+	allowlist, err := middleware.NewIPAllowlist(cfg.Admin.Allowlist)
+	if err != nil {
+		log.Fatal("初始化IP白名单失败", "error", err)
+	}
+	metricsCollector.SetAccessControl(allowlist.Allow)
+	go watchAllowlist(watchCtx, configService, allowlist, log, cfg.Admin.Allowlist)
+
+	// 后台定时任务通过分布式锁保证只有一个实例执行
+	jobLocker := lock.NewLocker(cfg.Lock, clients.InitLockNodes(cfg, redisClient, log), log)
+
+	// 消耗速度保护和素材疲劳检测只在主实例上运行，主实例故障后自动切换
+	elector := leader.NewElector(cfg.Leader, jobLocker, log)
+	elector.SetMetrics(metricsCollector)
+
+	// 注册本实例，存活的实例按分片分担后台任务
+	instanceRegistry := cluster.NewRegistry(cfg.Cluster, redisClient, "dsp-server", log)
+	instanceRegistry.Start()
+	defer instanceRegistry.Stop()
+
+	// 按配置创建和调整事件主题，新部署不会因主题不存在而写入失败
+	if cfg.Kafka.Topics.AutoCreate {
+		kafkaCluster, err := topics.NewKafkaCluster(cfg.Kafka.Brokers)
+		if err != nil {
+			log.Fatal("初始化Kafka主题管理失败", "error", err)
+		}
+		if _, err := topics.Ensure(context.Background(), cfg.Kafka.Topics, kafkaCluster, stats.EventTopics(), log); err != nil {
+			log.Fatal("检查Kafka主题失败", "error", err)
+		}
+	}
+
 	// 初始化Kafka客户端
 	kafkaClient := clients.InitKafka(cfg.Kafka, log)
 	defer func(kafkaClient *kafka.Writer) {
@@ -103,6 +185,14 @@ func main() {
 
 		}
 	}(kafkaClient)
+	if cfg.Chaos.Enabled {
+		log.Warn("已启用故障注入，仅用于非生产环境")
+		kafkaClient.Transport = chaos.NewKafkaTransport(chaos.NewInjector(chaos.DependencyKafka, cfg.Chaos.Kafka, metricsCollector), kafkaClient.Transport)
+	}
+
+	// 出站HTTP请求按目标使用独立的连接池
+	httpClients := httpclient.NewFactory(cfg.HTTPClient, metricsCollector)
+	defer httpClients.CloseIdleConnections()
 
 	// 初始化RTA客户端
 	rtaClient := rta.NewClient(
@@ -112,30 +202,261 @@ func main() {
 		log,
 		metricsCollector,
 	)
+	rtaClient.SetLookupPolicy(cfg.RTA.Lookup)
+	rtaClient.SetRetryPolicy(retry.Policy{
+		MaxRetries:     cfg.RTA.RetryTimes,
+		InitialBackoff: cfg.RTA.RetryDelay,
+		Jitter:         0.2,
+	})
+	outbound := httpClients.Transport(httpclient.DestinationRTA)
+	rtaClient.SetTransport(outbound)
+	if cfg.Chaos.Enabled {
+		rtaClient.SetTransport(chaos.NewHTTPTransport(chaos.NewInjector(chaos.DependencyRTA, cfg.Chaos.RTA, metricsCollector), outbound))
+	}
+
+	// 初始化时区，日预算续期、按天的频次、分时投放和按天统计按推广计划的时区计算
+	zones, err := timezone.New(cfg.Timezone)
+	if err != nil {
+		log.Fatal("初始化时区失败", "error", err)
+	}
 
 	// 初始化预算管理器
 	budgetMgr := budget.NewManager(redisClient, log, metricsCollector)
+	if err := budgetMgr.SetRenewalTime(cfg.Budget.RenewalTime); err != nil {
+		log.Fatal("初始化预算管理器失败", "error", err)
+	}
+	budgetMgr.SetTimezones(zones)
+	// 预算和消耗按媒体成本加平台服务费和税费计算
+	billingRates := billing.NewRates(cfg.Billing)
+	budgetMgr.SetBillingRates(billingRates)
 
 	// 初始化频次控制器
-	freqCtrl := frequency.NewController(redisClient, log, metricsCollector)
+	freqCtrl, err := frequency.New(cfg.Bidding.Frequency, redisClient, log, metricsCollector)
+	if err != nil {
+		log.Fatal("初始化频次控制器失败", "error", err)
+	}
+	freqConfigs := frequency.NewConfigCache(cfg.Bidding.Frequency, redisClient, log)
+	freqConfigs.Start()
+	defer freqConfigs.Stop()
+	freqCtrl = frequency.WithConfigCache(freqCtrl, freqConfigs)
+	freqCtrl = frequency.WithTimezones(freqCtrl, zones)
+
+	// 初始化身份图谱，按用户跨设备控制频次
+	var identityHandler *identity.Handler
+	if cfg.Identity.Enabled {
+		identityGraph := identity.NewRedisGraph(redisClient, cfg.Identity.LinkTTL)
+		identityResolver := identity.NewResolver(identityGraph, cfg.Identity.CacheTTL, log, metricsCollector)
+		identityIngester := identity.NewIngester(identityGraph, identityResolver, log, metricsCollector)
+		freqCtrl = frequency.WithIdentity(freqCtrl, identityResolver)
+		identityHandler = identity.NewHandler(identityIngester, identityGraph, identityResolver, log)
+		if cfg.Identity.Topic != "" {
+			identityConsumer := identity.NewConsumer(cfg.Kafka.Brokers, cfg.Identity, identityIngester, log)
+			identityConsumer.Start()
+			defer identityConsumer.Stop()
+		}
+	}
 
 	// 初始化数据统计收集器
 	statsCollector := stats.NewCollector(kafkaClient, redisClient, log, metricsCollector)
+	statsCollector.SetTimezones(zones)
+	statsCollector.SetBillingRates(billingRates)
+
+	// Kafka不可用时事件先缓冲，恢复后按顺序重放；在事件管道之后停止，停止时未写出的事件写入磁盘
+	if cfg.Stats.Buffer.Enabled {
+		writeBuffer, err := stats.NewWriteBuffer(cfg.Stats.Buffer, kafkaClient, log, metricsCollector)
+		if err != nil {
+			log.Fatal("初始化事件写出缓冲失败", "error", err)
+		}
+		writeBuffer.Start()
+		defer writeBuffer.Stop()
+		statsCollector.SetBuffer(writeBuffer)
+	}
+
+	// 按Protobuf编码事件时，启动时检查兼容性并注册Schema，不兼容时拒绝启动
+	if cfg.Stats.Encoding.Format == stats.FormatProtobuf {
+		registry, err := schemaregistry.NewClient(cfg.Stats.Encoding.SchemaRegistry)
+		if err != nil {
+			log.Fatal("创建Schema Registry客户端失败", "error", err)
+		}
+		encoder, err := stats.NewEventEncoder(context.Background(), registry, stats.EventTopics(), cfg.Stats.Encoding.SchemaRegistry.Compatibility)
+		if err != nil {
+			log.Fatal("注册事件Schema失败", "error", err)
+		}
+		statsCollector.SetEncoder(encoder)
+		log.Info("事件使用Protobuf编码", "schema_registry", cfg.Stats.Encoding.SchemaRegistry.URL)
+	}
 
-	// 初始化竞价引擎
+	// 按地域和设备拆分统计，维度在出价时解析并随出价记录保存
+	var dimensionResolver *stats.DimensionResolver
+	if cfg.Stats.Dimensions.Enabled {
+		var geoDB *geo.Database
+		if path := cfg.Stats.Dimensions.GeoIPPath; path != "" {
+			loaded, err := geo.Load(path)
+			if err != nil {
+				log.Fatal("加载IP库失败", "path", path, "error", err)
+			}
+			log.Info("加载IP库", "path", path, "networks", loaded.Len())
+			geoDB = loaded
+		}
+		dimensionResolver = stats.NewDimensionResolver(geoDB)
+		statsCollector.SetDimensions(stats.NewDimensionStore(redisClient, cfg.Stats.Dimensions.RetentionDays))
+	}
+
+	// 初始化竞价引擎，配置了PostgreSQL时从数据库读取出价策略
+	var strategyRepo bidding.Repository
+	var velocityGuard *velocity.Guard
+	var fatigueDetector *fatigue.Detector
+	if cfg.Postgres.Host != "" {
+		db, err := database.Open(cfg.Postgres, log, metricsCollector)
+		if err != nil {
+			log.Fatal("初始化数据库失败", "error", err)
+		}
+		defer database.Close(db)
+		if cfg.Chaos.Enabled {
+			if err := db.Use(chaos.NewGormPlugin(chaos.NewInjector(chaos.DependencyPostgres, cfg.Chaos.Postgres, metricsCollector))); err != nil {
+				log.Fatal("注册数据库故障注入失败", "error", err)
+			}
+		}
+		strategyRepo = bidding.NewGormRepository(db)
+		budgetMgr.SetSnapshotStore(budget.NewGormSnapshotStore(db))
+		if cfg.Budget.Velocity.Enabled {
+			velocityGuard = velocity.NewGuard(cfg.Budget.Velocity, budgetMgr, strategyRepo, redisClient, log, metricsCollector)
+			velocityGuard.SetAuditRecorder(audit.NewRecorder(db))
+			velocityGuard.SetLocker(jobLocker)
+		}
+		if cfg.Automation.Fatigue.Enabled {
+			fatigueDetector = fatigue.NewDetector(cfg.Automation.Fatigue, strategyRepo, stats.NewHourlyStore(redisClient), redisClient, log)
+			fatigueDetector.SetAuditRecorder(audit.NewRecorder(db))
+			fatigueDetector.SetLocker(jobLocker)
+		}
+	}
 	biddingEngine := bidding.NewEngine(
-		nil, // TODO: 实现广告服务
+		strategyRepo,
 		budgetMgr,
 		freqCtrl,
 		log,
 		metricsCollector,
 	)
 
+	// 初始化出价策略缓存
+	strategyCache := bidding.NewStrategyCache(strategyRepo, redisClient, cfg.Bidding.StrategyRefreshInterval, log)
+	if err := strategyCache.Start(context.Background()); err != nil {
+		log.Error("加载出价策略缓存失败", "error", err)
+	}
+	defer strategyCache.Stop()
+	biddingEngine.SetTimezones(zones)
+	biddingEngine.SetStrategyCache(strategyCache)
+	biddingEngine.SetCheckReserve(cfg.Bidding.CheckReserve)
+
+	// 策略日预算同步后从Redis恢复花费，重启后预算状态立即显示正确的花费
+	if err := budgetMgr.Start(context.Background(), cfg.Budget.SnapshotInterval); err != nil {
+		log.Error("恢复预算花费失败", "error", err)
+	}
+	defer budgetMgr.Stop()
+	// 按分钟检查策略的消耗速度，远超匀速投放预期时自动暂停策略，需在恢复预算花费后启动
+	if velocityGuard != nil {
+		elector.Register(velocityGuard)
+	}
+	// 按小时统计比较素材近期与此前的CTR，素材疲劳时降低其轮换权重或暂停该素材
+	if fatigueDetector != nil {
+		elector.Register(fatigueDetector)
+	}
+	elector.Start()
+	defer elector.Stop()
+	biddingEngine.SetRateLimiter(frequency.NewRateLimiter(redisClient, cfg.Bidding.Frequency.QPSCacheTTL, log, metricsCollector))
+	biddingEngine.SetRTABidPolicy(bidding.NewRTABidPolicy(cfg.Bidding.RTA.Campaigns, cfg.Bidding.RTA.MinMultiplier, cfg.Bidding.RTA.MaxMultiplier))
+	if advertisers := cfg.Bidding.Participation.Advertisers; len(advertisers) > 0 {
+		participation := bidding.NewParticipationPolicy()
+		for _, a := range advertisers {
+			participation.SetAdvertiser(a.AdvertiserID, a.Rate, a.Campaigns)
+		}
+		biddingEngine.SetParticipationPolicy(participation)
+	}
+
+	// 请求底价的执行方式和货币汇率
+	floorPolicy := bidding.NewFloorPolicy(cfg.Bidding.FloorEnforcement.Mode, cfg.Bidding.FloorEnforcement.Currency, cfg.Bidding.FloorEnforcement.UnknownCurrency)
+	for currency, rate := range cfg.Bidding.FloorEnforcement.Rates {
+		floorPolicy.SetRate(currency, rate)
+	}
+	biddingEngine.SetFloorPolicy(floorPolicy)
+
+	// 初始化底价情报
+	floorTracker := floor.NewTracker(cfg.Bidding.Floor, redisClient, log, metricsCollector)
+	if cfg.Bidding.Floor.Enabled {
+		floorTracker.Start()
+		defer floorTracker.Stop()
+		biddingEngine.SetFloorAdvisor(floorTracker)
+	}
+
+	// 初始化供应路径表现，按管理后台汇总的各供应路径CTR调整出价
+	if cfg.Stats.Placements.Enabled && cfg.Stats.Placements.AdjustBids {
+		placementAdvisor := placement.NewAdvisor(cfg.Stats.Placements, placement.NewStore(redisClient), log)
+		placementAdvisor.Start()
+		defer placementAdvisor.Stop()
+		biddingEngine.SetPlacementAdvisor(placementAdvisor)
+	}
+
 	// 初始化事件处理器
-	eventHandler := event.NewHandler(statsCollector, log, metricsCollector)
+	priceDecrypter, err := pricing.NewDecrypterFromConfig(cfg.Event.PriceKeys)
+	if err != nil {
+		log.Fatal("初始化成交价解密器失败", "error", err)
+	}
+	eventPipeline := event.NewPipeline(cfg.Event, statsCollector, log, metricsCollector)
+
+	// 初始化用户特征，展示和点击写出后更新，竞价时用于修正CTR预估
+	if cfg.Profile.Enabled {
+		profileStore := profile.NewRedisStore(redisClient, cfg.Profile.TTL)
+		eventPipeline.SetObserver(profile.NewUpdater(profileStore, strategyCache))
+		biddingEngine.SetUserProfiles(profileStore)
+	}
+
+	eventPipeline.Start()
+	defer eventPipeline.Stop()
+	eventHandler := event.NewHandler(statsCollector, priceDecrypter, log, metricsCollector)
+	eventHandler.SetPipeline(eventPipeline)
+	bidRecords := event.NewRedisBidRecordStore(redisClient, cfg.Event.BidRecordTTL)
+	eventHandler.SetBidRecords(bidRecords, cfg.Event.PriceTolerance)
+	eventHandler.SetWinDeduper(event.NewRedisWinDeduper(redisClient, cfg.Event.WinDedupTTL))
+	if cfg.Bidding.Floor.Enabled {
+		eventHandler.SetWinObserver(floorTracker)
+	}
+	if dimensionResolver != nil {
+		eventHandler.SetDimensions(dimensionResolver)
+	}
+
+	// 初始化交易平台配置
+	exchangeRegistry, err := exchange.NewRegistryFromConfig(cfg.Exchanges)
+	if err != nil {
+		log.Fatal("初始化交易平台配置失败", "error", err)
+	}
+
+	// 初始化素材送审，要求审核的交易平台只投放有审核通过素材的策略
+	approvalSyncer := approval.NewSyncer(exchangeRegistry, redisClient, cfg.Bidding.CreativeSyncInterval, log)
+	// 按实例分片查询审核状态，未设置分片时退回分布式锁
+	approvalSyncer.SetSharder(instanceRegistry)
+	approvalSyncer.SetLocker(jobLocker)
+	approvalSyncer.Start()
+	defer approvalSyncer.Stop()
+	biddingEngine.SetCreativeApprovals(approvalSyncer)
 
 	// 初始化流量处理器
 	trafficHandler := traffic.NewHandler(
+		traffic.HandlerConfig{
+			QPS:            cfg.Traffic.QPS,
+			Burst:          cfg.Traffic.Burst,
+			RTATimeout:     cfg.Traffic.RTATimeout,
+			BidTimeout:     cfg.Traffic.BidTimeout,
+			MaxAdSlots:     cfg.Traffic.MaxAdSlots,
+			MinAdSlotSize:  cfg.Traffic.MinAdSlotSize,
+			MaxAdSlotSize:  cfg.Traffic.MaxAdSlotSize,
+			DefaultTMax:    cfg.Traffic.DefaultTMax,
+			MaxTMax:        cfg.Traffic.MaxTMax,
+			NetworkReserve: cfg.Traffic.NetworkReserve,
+			RTAShare:       cfg.Traffic.RTAShare,
+			SlowThreshold:  cfg.Traffic.SlowThreshold,
+			RecordTimeout:  cfg.Traffic.RecordTimeout,
+		},
+		exchangeRegistry,
 		rtaClient,
 		biddingEngine,
 		eventHandler,
@@ -143,23 +464,129 @@ func main() {
 		metricsCollector,
 	)
 
+	trafficHandler.SetBidRecordStore(bidRecords)
+	if cfg.Event.AdServing.Enabled {
+		// 广告地址的令牌与出价记录同时过期，广告代码随出价记录保存
+		adTokens := event.NewAdTokenSigner(cfg.Event.AdServing.Secret, cfg.Event.BidRecordTTL)
+		trafficHandler.SetAdServing(adTokens, cfg.Event.AdServing.BaseURL)
+		eventHandler.SetAdServing(adTokens, event.NewRedisImpressionDeduper(redisClient, cfg.Event.BidRecordTTL))
+	}
+	if cfg.Traffic.Adaptive.Enabled {
+		// 全局限流按Redis和RTA的健康状况自动调整，可通过配置中心的traffic.rate_limit固定
+		rateLimiter := traffic.NewAdaptiveLimiter(cfg.Traffic.QPS, cfg.Traffic.Burst, cfg.Traffic.Adaptive, log, metricsCollector)
+		redisClient.AddHook(clients.NewObserveHook(func(elapsed time.Duration, err error) {
+			rateLimiter.Observe(traffic.DependencyRedis, elapsed, err)
+		}))
+		rateLimiter.Start()
+		defer rateLimiter.Stop()
+		trafficHandler.SetRateLimiter(rateLimiter)
+		go watchRateLimit(watchCtx, configService, rateLimiter, log)
+	}
+	if cfg.Chaos.Enabled {
+		// 故障注入钩子在观测钩子之后注册，注入的延迟和错误计入Redis的健康状况
+		redisClient.AddHook(chaos.NewRedisHook(chaos.NewInjector(chaos.DependencyRedis, cfg.Chaos.Redis, metricsCollector)))
+	}
+	trafficHandler.SetBidCounter(stats.NewHourlyStore(redisClient))
+	if cfg.Stats.Funnel.Enabled {
+		// 出价事件经事件管道写入dsp.events.bid，由管理后台关联为竞价漏斗
+		trafficHandler.SetBidEvents(eventPipeline)
+	}
+	if dimensionResolver != nil {
+		trafficHandler.SetDimensions(dimensionResolver)
+	}
+	if len(cfg.RTA.Tasks) > 0 {
+		// 只有绑定了RTA任务的推广计划需要查询RTA
+		trafficHandler.SetRTATasks(rta.NewConfigManagerFromConfig(cfg.RTA.Tasks))
+	}
+	if cfg.Traffic.Enrichment.TTL > 0 {
+		trafficHandler.SetEnrichmentCache(traffic.NewEnrichmentCache(cfg.Traffic.Enrichment.TTL, cfg.Traffic.Enrichment.MaxEntries))
+	}
+	if cfg.Stats.Forecast.Enabled {
+		// 记录流量分布，管理后台按分布预估投放量
+		forecastRecorder := forecast.NewRecorder(
+			forecast.NewRedisStore(redisClient, cfg.Stats.Forecast.RetentionDays),
+			cfg.Stats.Forecast.FlushInterval,
+			log,
+		)
+		forecastRecorder.Start()
+		defer forecastRecorder.Stop()
+		trafficHandler.SetForecastRecorder(forecastRecorder)
+	}
+	if cfg.SupplyChain.Enabled {
+		// 后台抓取ads.txt、app-ads.txt和sellers.json，验证请求的供应链
+		schainValidator := supplychain.NewValidator(cfg.SupplyChain, log, metricsCollector)
+		schainValidator.SetTransport(httpClients.Transport(httpclient.DestinationSupplyChain))
+		schainValidator.Start()
+		defer schainValidator.Stop()
+		trafficHandler.SetSupplyChain(schainValidator)
+		biddingEngine.SetSupplyChainPolicy(bidding.NewSupplyChainPolicy(cfg.SupplyChain.RequireAuthorizedCampaigns))
+	}
+
+	// 初始化SKAdNetwork签名和回传处理
+	if cfg.SKAdNetwork.Enabled {
+		skadnStore := skadn.NewRedisStore(redisClient)
+		signer, verifier, err := initSKAdNetwork(cfg.SKAdNetwork)
+		if err != nil {
+			log.Fatal("初始化SKAdNetwork失败", "error", err)
+		}
+		trafficHandler.SetSKAdNetwork(signer, skadnStore)
+		eventHandler.SetSKAdNetwork(signer.NetworkID(), verifier, skadnStore)
+	}
+
+	// 初始化竞价服务，gRPC与REST桥接共用同一实现和拦截器
+	bidService := bidding.NewGRPCServer(biddingEngine, log)
+	interceptors := []grpc.UnaryServerInterceptor{middleware.GRPCMetrics(metricsCollector)}
+	bidGateway := gateway.NewGateway(bidService, log, interceptors...)
+
+	// 初始化再营销像素
+	var pixelHandler *pixel.Handler
+	if cfg.Pixel.Enabled {
+		pixelHandler = pixel.NewHandler(segment.NewRedisStore(redisClient), cfg.Pixel, log, metricsCollector)
+	}
+
+	// 初始化竞价请求的并发限制和过载保护
+	inFlightLimiter := middleware.NewInFlightLimiter(cfg.Traffic.Concurrency, metricsCollector)
+	inFlightLimiter.Start()
+	defer inFlightLimiter.Stop()
+
 	// 初始化路由
-	router := initRouter(trafficHandler, eventHandler)
+	router := initRouter(cfg.Server.Limits, metricsCollector, trafficHandler, eventHandler, bidGateway, inFlightLimiter.Handler(), allowlist.Handler(), floor.NewHandler(floorTracker, log), pixelHandler, identityHandler, approval.NewHandler(approvalSyncer, exchangeRegistry, log))
 
 	// 创建HTTP服务器
-	srv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
-		Handler: router,
+	srv, err := httpserver.New(cfg.Server, router)
+	if err != nil {
+		log.Fatal("创建HTTP服务器失败", "error", err)
+	}
+	ln, err := httpserver.Listen(srv.Addr, cfg.Server.TCPKeepAlive)
+	if err != nil {
+		log.Fatal("HTTP端口监听失败", "port", cfg.Server.Port, "error", err)
 	}
 
 	// 启动服务器
 	go func() {
-		log.Info("启动DSP服务器", "port", cfg.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Info("启动DSP服务器", "port", cfg.Server.Port, "h2c", cfg.Server.H2C)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatal("DSP服务器启动失败", "error", err)
 		}
 	}()
 
+	// 启动gRPC服务器
+	var grpcServer *grpc.Server
+	var healthServer *health.Server
+	if cfg.Server.GRPC.Port > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPC.Port))
+		if err != nil {
+			log.Fatal("gRPC端口监听失败", "port", cfg.Server.GRPC.Port, "error", err)
+		}
+		grpcServer, healthServer = initGRPCServer(cfg.Server.GRPC, bidService, interceptors)
+		go func() {
+			log.Info("启动gRPC服务器", "port", cfg.Server.GRPC.Port)
+			if err := grpcServer.Serve(lis); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+				log.Fatal("gRPC服务器启动失败", "error", err)
+			}
+		}()
+	}
+
 	// 优雅关闭
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -169,6 +596,21 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if grpcServer != nil {
+		// 先将健康状态置为NOT_SERVING，负载均衡摘除后再停止
+		healthServer.Shutdown()
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("DSP服务器关闭失败", "error", err)
 	}
@@ -176,17 +618,55 @@ func main() {
 }
 
 // initRouter 初始化路由
-func initRouter(trafficHandler *traffic.Handler, eventHandler *event.Handler) *gin.Engine {
+func initRouter(limits config.RequestLimitsConfig, m *metrics.Metrics, trafficHandler *traffic.Handler, eventHandler *event.Handler, bidGateway *gateway.Gateway, shed, ops gin.HandlerFunc, floorHandler *floor.Handler, pixelHandler *pixel.Handler, identityHandler *identity.Handler, approvalHandler *approval.Handler) *gin.Engine {
 	router := gin.Default()
+	// 请求ID、交易平台和隐私同意状态写入请求上下文
+	router.Use(middleware.RequestContext())
+
+	// 竞价请求先限制请求体大小和读取时间，再经过并发限制，过载时返回503
+	bids := router.Group("", middleware.RequestLimits(middleware.RouteGroupBid, limits, m), shed)
+	events := router.Group("", middleware.RequestLimits(middleware.RouteGroupEvent, limits, m))
+	api := router.Group("", middleware.RequestLimits(middleware.RouteGroupDefault, limits, m))
 
 	// 流量接入接口
-	router.POST("/api/v1/traffic", gin.HandlerFunc(trafficHandler.HandleRequest))
+	bids.POST("/api/v1/traffic", gin.HandlerFunc(trafficHandler.HandleRequest))
+	bids.POST("/api/v1/traffic/:exchange", gin.HandlerFunc(trafficHandler.HandleRequest))
+
+	// BidService的REST桥接
+	bidGateway.Register(bids)
 
 	// 事件处理接口
-	router.POST("/api/v1/events/impression", gin.HandlerFunc(eventHandler.HandleImpression))
-	router.POST("/api/v1/events/click", gin.HandlerFunc(eventHandler.HandleClick))
-	router.POST("/api/v1/events/conversion", gin.HandlerFunc(eventHandler.HandleConversion))
-	router.GET("/api/v1/events/stats", gin.HandlerFunc(eventHandler.GetEventStats))
+	events.POST("/api/v1/events/impression", gin.HandlerFunc(eventHandler.HandleImpression))
+	events.POST("/api/v1/events/click", gin.HandlerFunc(eventHandler.HandleClick))
+	events.POST("/api/v1/events/conversion", gin.HandlerFunc(eventHandler.HandleConversion))
+	events.POST("/api/v1/events/viewable", gin.HandlerFunc(eventHandler.HandleViewable))
+	events.POST("/api/v1/events/video/:stage", gin.HandlerFunc(eventHandler.HandleVideo))
+	events.POST("/api/v1/events/dwell", gin.HandlerFunc(eventHandler.HandleDwell))
+	events.GET("/api/v1/events/win", gin.HandlerFunc(eventHandler.HandleWin))
+	// 按竞价令牌返回广告代码，未启用广告地址时返回404
+	events.GET("/ad/:auction_token", gin.HandlerFunc(eventHandler.HandleAdRender))
+	// Apple按固定路径发送SKAdNetwork安装回传
+	events.POST("/.well-known/skadnetwork/report-attribution/", gin.HandlerFunc(eventHandler.HandleSKAdNetworkPostback))
+	events.GET("/api/v1/events/stats", ops, gin.HandlerFunc(eventHandler.GetEventStats))
+
+	// 底价情报查询接口
+	api.GET("/api/v1/floors/stats", ops, gin.HandlerFunc(floorHandler.GetStats))
+
+	// 再营销像素，未启用时不注册
+	if pixelHandler != nil {
+		api.GET("/pixel/:advertiser", gin.HandlerFunc(pixelHandler.ServePixel))
+		api.GET("/pixel/:advertiser/tag.js", gin.HandlerFunc(pixelHandler.ServeTag))
+	}
+
+	// 素材在交易平台的审核状态及交易平台审核回调
+	api.GET("/api/v1/creatives/:id/exchange-audits", gin.HandlerFunc(approvalHandler.GetStates))
+	api.POST("/api/v1/exchanges/:id/creative-audits/callback", gin.HandlerFunc(approvalHandler.Callback))
+
+	// 身份关联接口，未启用时不注册
+	if identityHandler != nil {
+		api.POST("/api/v1/identity/links", gin.HandlerFunc(identityHandler.AddLinks))
+		api.DELETE("/api/v1/identity/links/:device_id", gin.HandlerFunc(identityHandler.DeleteLink))
+	}
 
 	// 健康检查接口
 	router.GET("/health", func(c *gin.Context) {
@@ -195,3 +675,136 @@ func initRouter(trafficHandler *traffic.Handler, eventHandler *event.Handler) *g
 
 	return router
 }
+
+// initGRPCServer 初始化gRPC服务器，注册竞价服务、健康检查和反射服务
+func initGRPCServer(cfg config.GRPCConfig, bidService dspv1.BidServiceServer, interceptors []grpc.UnaryServerInterceptor) (*grpc.Server, *health.Server) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle:     cfg.MaxConnectionIdle,
+			MaxConnectionAge:      cfg.MaxConnectionAge,
+			MaxConnectionAgeGrace: cfg.MaxConnectionAgeGrace,
+			Time:                  cfg.KeepaliveTime,
+			Timeout:               cfg.KeepaliveTimeout,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.MinPingInterval,
+			PermitWithoutStream: cfg.PermitWithoutStream,
+		}),
+	}
+	if cfg.InitialWindowSize > 0 {
+		opts = append(opts, grpc.InitialWindowSize(cfg.InitialWindowSize))
+	}
+	if cfg.InitialConnWindowSize > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(cfg.InitialConnWindowSize))
+	}
+	if cfg.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(cfg.MaxConcurrentStreams))
+	}
+	if cfg.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+
+	server := grpc.NewServer(opts...)
+	dspv1.RegisterBidServiceServer(server, bidService)
+
+	// 健康检查服务
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(dspv1.BidService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	// 反射服务，便于grpcurl等工具调试
+	if cfg.EnableReflection {
+		reflection.Register(server)
+	}
+
+	return server, healthServer
+}
+
+// initSKAdNetwork 加载签名私钥和Apple公钥
+func initSKAdNetwork(cfg config.SKAdNetworkConfig) (*skadn.Signer, *skadn.Verifier, error) {
+	keyData, err := os.ReadFile(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取SKAdNetwork私钥失败: %w", err)
+	}
+	key, err := skadn.ParsePrivateKey(keyData)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, err := skadn.NewSigner(cfg.NetworkID, key, cfg.Versions)
+	if err != nil {
+		return nil, nil, err
+	}
+	verifier, err := skadn.NewVerifier(cfg.ApplePublicKeys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signer, verifier, nil
+}
+
+// watchRateLimit 应用配置中心固定的全局限流，配置被删除时恢复自动调整
+func watchRateLimit(ctx context.Context, service *iconfig.Service, limiter *traffic.AdaptiveLimiter, log *logger.Logger) {
+	err := service.Watch(ctx, traffic.RateLimitConfigKey, func(value json.RawMessage) {
+		var override traffic.RateLimitOverride
+		if value != nil {
+			if err := json.Unmarshal(value, &override); err != nil {
+				log.Error("解析全局限流配置失败", "error", err)
+				return
+			}
+		}
+		limiter.SetOverride(override.QPS)
+		log.Info("全局限流配置已更新", "override_qps", override.QPS, "effective_qps", limiter.Limit())
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error("监听全局限流配置失败", "error", err)
+	}
+}
+
+// watchAllowlist 应用配置中心的IP白名单，配置被删除时恢复配置文件中的设置，无效的配置不生效
+func watchAllowlist(ctx context.Context, service *iconfig.Service, allowlist *middleware.IPAllowlist, log *logger.Logger, fallback config.IPAllowlistConfig) {
+	err := service.Watch(ctx, middleware.AllowlistConfigKey, func(value json.RawMessage) {
+		rules := fallback
+		if value != nil {
+			rules = config.IPAllowlistConfig{}
+			if err := json.Unmarshal(value, &rules); err != nil {
+				log.Error("解析IP白名单配置失败", "error", err)
+				return
+			}
+		}
+		if err := allowlist.Update(rules); err != nil {
+			log.Error("IP白名单配置无效", "error", err)
+			return
+		}
+		log.Info("IP白名单已更新", "enabled", rules.Enabled, "cidrs", rules.CIDRs)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error("监听IP白名单配置失败", "error", err)
+	}
+}
+
+// watchLogSampling 应用配置中心的日志采样配置，配置被删除时恢复配置文件中的设置
+func watchLogSampling(ctx context.Context, service *iconfig.Service, log *logger.Logger, fallback config.LogSamplingConfig) {
+	err := service.Watch(ctx, logger.SamplingConfigKey, func(value json.RawMessage) {
+		sampling := fallback
+		if value != nil {
+			// 运行时配置整体替换配置文件中的设置，不与之合并
+			sampling = config.LogSamplingConfig{}
+			if err := json.Unmarshal(value, &sampling); err != nil {
+				log.Error("解析日志采样配置失败", "error", err)
+				return
+			}
+		}
+		log.SetSampling(sampling)
+		log.Info("日志采样配置已更新",
+			"enabled", sampling.Enabled,
+			"first", sampling.First,
+			"thereafter", sampling.Thereafter)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Error("监听日志采样配置失败", "error", err)
+	}
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: main.go
+ * Project: simple-dsp
+ * Description: 相似人群扩展任务，离线扩展种子人群包
+ *
+ * 主要功能:
+ * - 从文件或Kafka读取时间窗口内的展示和点击事件
+ * - 构建用户与广告计划的共现索引
+ * - 按种子人群包扩展相似人群并写回人群包存储
+ * - 输出每个种子人群包的扩展报告
+ *
+ * 实现细节:
+ * - 事件格式与事件管道写入Kafka的JSON一致
+ * - 种子通过 "segment:ratio,segment" 形式配置，未指定倍数时使用-ratio
+ * - Kafka数据源在空闲超过-idle后结束读取
+ *
+ * 依赖关系:
+ * - github.com/segmentio/kafka-go
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/internal/segment
+ *
+ * 注意事项:
+ * - 索引保存在内存中，时间窗口过大时注意内存占用
+ * - 扩展人群包写入{种子ID}:lookalike，不修改种子人群包
+ * - 首次运行建议使用-dry-run检查扩展规模
+ */
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/segmentio/kafka-go"
+
+	"simple-dsp/internal/segment"
+	"simple-dsp/internal/stats"
+)
+
+// Options 任务参数
+type Options struct {
+	Source        string
+	File          string
+	Brokers       string
+	Topics        string
+	GroupID       string
+	Idle          time.Duration
+	Window        time.Duration
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	Seeds         string
+	Suffix        string
+	TTL           time.Duration
+	DryRun        bool
+	Expand        segment.ExpandOptions
+}
+
+func main() {
+	opts := parseFlags()
+
+	seeds, err := parseSeeds(opts.Seeds, opts.Expand)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "解析种子人群包失败: %v\n", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	// 构建共现索引
+	startTime := time.Now()
+	idx := segment.NewIndex()
+	since := startTime.Add(-opts.Window)
+	var read int
+	add := func(e *stats.Event) {
+		if opts.Window > 0 && e.Timestamp.Before(since) {
+			return
+		}
+		if i, ok := segment.FromEvent(e); ok {
+			idx.Add(i)
+			read++
+		}
+	}
+	switch opts.Source {
+	case "file":
+		err = readFromFile(opts.File, add)
+	case "kafka":
+		err = readFromKafka(ctx, opts, add)
+	default:
+		err = fmt.Errorf("不支持的数据源: %s", opts.Source)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取事件失败: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("索引构建完成: 交互=%d 用户=%d 耗时=%s\n", read, idx.Users(), time.Since(startTime).Round(time.Millisecond))
+
+	// 扩展种子人群包
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     opts.RedisAddr,
+		Password: opts.RedisPassword,
+		DB:       opts.RedisDB,
+	})
+	defer redisClient.Close()
+
+	job := segment.NewJob(segment.NewRedisStore(redisClient), opts.TTL, opts.Suffix)
+	reports := job.Run(ctx, idx, seeds, opts.DryRun)
+
+	failed := 0
+	for _, r := range reports {
+		if r.Err != nil {
+			failed++
+			fmt.Printf("[FAIL] seed=%s error=%v\n", r.SeedID, r.Err)
+			continue
+		}
+		e := r.Expansion
+		fmt.Printf("[OK]   seed=%s target=%s 种子=%d 活跃种子=%d 关联计划=%d 候选=%d 扩展=%d 写入=%d\n",
+			r.SeedID, r.TargetID, e.Seeds, e.ActiveSeeds, e.Campaigns, e.Candidates, len(e.Users), r.Written)
+	}
+	if opts.DryRun {
+		fmt.Println("dry-run模式，未写入人群包")
+	}
+
+	if failed > 0 || len(reports) < len(seeds) {
+		os.Exit(1)
+	}
+}
+
+// parseFlags 解析命令行参数
+func parseFlags() Options {
+	opts := Options{Expand: segment.DefaultExpandOptions()}
+	flag.StringVar(&opts.Source, "source", "file", "数据源类型: file 或 kafka")
+	flag.StringVar(&opts.File, "file", "", "事件文件路径(每行一个JSON事件)")
+	flag.StringVar(&opts.Brokers, "brokers", "localhost:9092", "Kafka代理地址，逗号分隔")
+	flag.StringVar(&opts.Topics, "topics", "dsp.events.impression,dsp.events.click", "Kafka主题，逗号分隔")
+	flag.StringVar(&opts.GroupID, "group", "dsp-lookalike", "Kafka消费组")
+	flag.DurationVar(&opts.Idle, "idle", 10*time.Second, "Kafka数据源空闲超过该时间后结束读取")
+	flag.DurationVar(&opts.Window, "window", 7*24*time.Hour, "只使用该时间窗口内的事件，0表示不限制")
+	flag.StringVar(&opts.RedisAddr, "redis", "localhost:6379", "Redis地址")
+	flag.StringVar(&opts.RedisPassword, "redis-password", "", "Redis密码")
+	flag.IntVar(&opts.RedisDB, "redis-db", 0, "Redis数据库")
+	flag.StringVar(&opts.Seeds, "seeds", "", "种子人群包，格式为segment:ratio,segment")
+	flag.StringVar(&opts.Suffix, "suffix", segment.DefaultSuffix, "扩展人群包ID后缀")
+	flag.DurationVar(&opts.TTL, "ttl", 48*time.Hour, "扩展人群包的过期时间，0表示不过期")
+	flag.BoolVar(&opts.DryRun, "dry-run", false, "只计算扩展结果，不写入人群包")
+	flag.Float64Var(&opts.Expand.Ratio, "ratio", segment.DefaultRatio, "默认扩展倍数(扩展人数/种子人数)")
+	flag.IntVar(&opts.Expand.MinSupport, "min-support", segment.DefaultMinSupport, "关联计划所需的最少种子用户数")
+	flag.Float64Var(&opts.Expand.MinLift, "min-lift", segment.DefaultMinLift, "关联计划所需的最小lift，必须大于1")
+	flag.Float64Var(&opts.Expand.MinScore, "min-score", 0, "扩展用户的最低得分")
+	flag.IntVar(&opts.Expand.MaxUsers, "max-users", 0, "每个人群包最多扩展的用户数，0表示不限制")
+	flag.Float64Var(&opts.Expand.ClickWeight, "click-weight", segment.DefaultClickWeight, "点击相对于展示的权重")
+	flag.Parse()
+
+	if opts.Source == "file" && opts.File == "" {
+		fmt.Fprintln(os.Stderr, "使用文件数据源时必须指定 -file")
+		os.Exit(2)
+	}
+	if opts.Seeds == "" {
+		fmt.Fprintln(os.Stderr, "必须指定 -seeds")
+		os.Exit(2)
+	}
+	if err := opts.Expand.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "%v: 检查 -ratio/-min-support/-min-lift/-min-score/-max-users/-click-weight\n", err)
+		os.Exit(2)
+	}
+	return opts
+}
+
+// parseSeeds 解析种子人群包配置
+func parseSeeds(spec string, defaults segment.ExpandOptions) ([]segment.Seed, error) {
+	var seeds []segment.Seed
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		seed := segment.Seed{ID: item, Options: defaults}
+		if i := strings.LastIndex(item, ":"); i > 0 {
+			ratio, err := strconv.ParseFloat(item[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("无效的扩展倍数: %s", item)
+			}
+			seed.ID = item[:i]
+			seed.Options.Ratio = ratio
+		}
+		if err := seed.Options.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", item, err)
+		}
+		seeds = append(seeds, seed)
+	}
+	if len(seeds) == 0 {
+		return nil, segment.ErrEmptySeed
+	}
+	return seeds, nil
+}
+
+// readFromFile 从文件读取事件
+func readFromFile(path string, add func(*stats.Event)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 1<<20)
+	lineNo := 0
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			lineNo++
+			var e stats.Event
+			if jsonErr := json.Unmarshal(line, &e); jsonErr != nil {
+				fmt.Fprintf(os.Stderr, "跳过无效事件: line=%d error=%v\n", lineNo, jsonErr)
+			} else {
+				add(&e)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readFromKafka 从Kafka读取事件，空闲超过opts.Idle后结束
+// 不提交消费位点，每次运行都从最早的消息开始，按-window过滤
+func readFromKafka(ctx context.Context, opts Options, add func(*stats.Event)) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     strings.Split(opts.Brokers, ","),
+		GroupTopics: strings.Split(opts.Topics, ","),
+		GroupID:     opts.GroupID,
+		StartOffset: kafka.FirstOffset,
+	})
+	defer reader.Close()
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, opts.Idle)
+		msg, err := reader.FetchMessage(readCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+
+		e, err := stats.DecodeEvent(msg.Value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "跳过无效事件: topic=%s offset=%d error=%v\n", msg.Topic, msg.Offset, err)
+			continue
+		}
+		add(e)
+	}
+}
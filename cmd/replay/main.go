@@ -0,0 +1,414 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: main.go
+ * Project: simple-dsp
+ * Description: 流量回放工具，用于离线回归测试竞价引擎
+ *
+ * 主要功能:
+ * - 从文件或Kafka读取采样的请求日志
+ * - 按指定速率回放到竞价服务
+ * - 对比实际响应与录制响应
+ * - 输出差异明细和汇总报告
+ *
+ * 实现细节:
+ * - 日志格式为每行一个JSON记录(request + response)
+ * - 使用令牌桶控制回放速率
+ * - 使用固定数量的worker并发回放
+ * - 比较时忽略请求ID等易变字段
+ *
+ * 依赖关系:
+ * - github.com/segmentio/kafka-go
+ * - golang.org/x/time/rate
+ * - simple-dsp/internal/traffic
+ *
+ * 注意事项:
+ * - 回放目标应为测试环境实例
+ * - 回放会产生真实的预算扣减和频次记录
+ * - 合理设置QPS避免压垮目标服务
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/time/rate"
+
+	"simple-dsp/internal/traffic"
+)
+
+// Record 录制的请求日志记录
+type Record struct {
+	RequestID string            `json:"request_id"`
+	Request   traffic.Request   `json:"request"`
+	Response  *traffic.Response `json:"response"`
+	Status    int               `json:"status"`
+}
+
+// Options 回放参数
+type Options struct {
+	Target         string
+	Source         string
+	File           string
+	Brokers        string
+	Topic          string
+	GroupID        string
+	QPS            float64
+	Concurrency    int
+	Limit          int
+	Timeout        time.Duration
+	PriceTolerance float64
+	Verbose        bool
+}
+
+// Report 回放结果汇总
+type Report struct {
+	Total    int64
+	Matched  int64
+	Diffed   int64
+	Failed   int64
+	Duration time.Duration
+}
+
+// Replayer 流量回放器
+type Replayer struct {
+	opts       Options
+	httpClient *http.Client
+	limiter    *rate.Limiter
+	out        io.Writer
+	outMu      sync.Mutex
+	report     Report
+}
+
+func main() {
+	opts := parseFlags()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	records := make(chan *Record, opts.Concurrency*2)
+	// 读取结果通过channel返回，回放提前结束时也要等读取协程退出后再读取错误
+	readDone := make(chan error, 1)
+	go func() {
+		defer close(records)
+		switch opts.Source {
+		case "file":
+			readDone <- readFromFile(ctx, opts.File, opts.Limit, records)
+		case "kafka":
+			readDone <- readFromKafka(ctx, opts, records)
+		default:
+			readDone <- fmt.Errorf("不支持的数据源: %s", opts.Source)
+		}
+	}()
+
+	replayer := NewReplayer(opts, os.Stdout)
+	report := replayer.Run(ctx, records)
+
+	// worker因上下文取消提前退出时，读取协程在发送记录处同样会因取消而返回
+	cancel()
+	readErr := <-readDone
+	if readErr != nil {
+		fmt.Fprintf(os.Stderr, "读取请求日志失败: %v\n", readErr)
+	}
+
+	fmt.Printf("\n回放完成: 总数=%d 一致=%d 差异=%d 失败=%d 耗时=%s\n",
+		report.Total, report.Matched, report.Diffed, report.Failed, report.Duration.Round(time.Millisecond))
+
+	if report.Diffed > 0 || report.Failed > 0 || readErr != nil {
+		os.Exit(1)
+	}
+}
+
+// parseFlags 解析命令行参数
+func parseFlags() Options {
+	var opts Options
+	flag.StringVar(&opts.Target, "target", "http://localhost:8080/api/v1/traffic", "竞价服务地址")
+	flag.StringVar(&opts.Source, "source", "file", "数据源类型: file 或 kafka")
+	flag.StringVar(&opts.File, "file", "", "请求日志文件路径(每行一个JSON记录)")
+	flag.StringVar(&opts.Brokers, "brokers", "localhost:9092", "Kafka代理地址，逗号分隔")
+	flag.StringVar(&opts.Topic, "topic", "dsp.traffic.sampled", "Kafka主题")
+	flag.StringVar(&opts.GroupID, "group", "dsp-replay", "Kafka消费组")
+	flag.Float64Var(&opts.QPS, "qps", 50, "回放速率(每秒请求数)")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "并发worker数")
+	flag.IntVar(&opts.Limit, "limit", 0, "最多回放的记录数，0表示不限制")
+	flag.DurationVar(&opts.Timeout, "timeout", time.Second, "单次请求超时时间")
+	flag.Float64Var(&opts.PriceTolerance, "price-tolerance", 0.0001, "出价比较的允许误差")
+	flag.BoolVar(&opts.Verbose, "v", false, "输出每条请求的回放结果")
+	flag.Parse()
+
+	if opts.Source == "file" && opts.File == "" {
+		fmt.Fprintln(os.Stderr, "使用文件数据源时必须指定 -file")
+		os.Exit(2)
+	}
+	if opts.QPS <= 0 {
+		fmt.Fprintln(os.Stderr, "-qps 必须大于0")
+		os.Exit(2)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	return opts
+}
+
+// NewReplayer 创建流量回放器
+func NewReplayer(opts Options, out io.Writer) *Replayer {
+	return &Replayer{
+		opts: opts,
+		httpClient: &http.Client{
+			Timeout: opts.Timeout,
+		},
+		limiter: rate.NewLimiter(rate.Limit(opts.QPS), 1),
+		out:     out,
+	}
+}
+
+// Run 执行回放，直到记录读取完毕或上下文取消
+func (r *Replayer) Run(ctx context.Context, records <-chan *Record) Report {
+	startTime := time.Now()
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for record := range records {
+				if err := r.limiter.Wait(ctx); err != nil {
+					return
+				}
+				r.replayOne(ctx, record)
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.report.Duration = time.Since(startTime)
+	return r.report
+}
+
+// replayOne 回放单条记录并比较响应
+func (r *Replayer) replayOne(ctx context.Context, record *Record) {
+	atomic.AddInt64(&r.report.Total, 1)
+
+	status, actual, err := r.send(ctx, record)
+	if err != nil {
+		atomic.AddInt64(&r.report.Failed, 1)
+		r.printf("[FAIL] request_id=%s error=%v\n", record.RequestID, err)
+		return
+	}
+
+	diffs := compareResponses(record, status, actual, r.opts.PriceTolerance)
+	if len(diffs) == 0 {
+		atomic.AddInt64(&r.report.Matched, 1)
+		if r.opts.Verbose {
+			r.printf("[OK]   request_id=%s\n", record.RequestID)
+		}
+		return
+	}
+
+	atomic.AddInt64(&r.report.Diffed, 1)
+	r.printf("[DIFF] request_id=%s\n", record.RequestID)
+	for _, d := range diffs {
+		r.printf("       %s\n", d)
+	}
+}
+
+// send 发送回放请求
+func (r *Replayer) send(ctx context.Context, record *Record) (int, *traffic.Response, error) {
+	body, err := json.Marshal(record.Request)
+	if err != nil {
+		return 0, nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.opts.Target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if record.RequestID != "" {
+		req.Header.Set("X-Request-ID", record.RequestID)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	var result traffic.Response
+	if err := json.Unmarshal(data, &result); err != nil {
+		// 非标准响应(如错误响应)不视为失败，交由状态码比较
+		return resp.StatusCode, nil, nil
+	}
+	return resp.StatusCode, &result, nil
+}
+
+// printf 并发安全地输出
+func (r *Replayer) printf(format string, args ...interface{}) {
+	r.outMu.Lock()
+	defer r.outMu.Unlock()
+	fmt.Fprintf(r.out, format, args...)
+}
+
+// compareResponses 比较录制响应与实际响应，返回差异描述
+func compareResponses(record *Record, status int, actual *traffic.Response, tolerance float64) []string {
+	var diffs []string
+
+	if record.Status != 0 && record.Status != status {
+		diffs = append(diffs, fmt.Sprintf("status: 录制=%d 实际=%d", record.Status, status))
+	}
+
+	expected := record.Response
+	if expected == nil || actual == nil {
+		if (expected == nil) != (actual == nil) {
+			diffs = append(diffs, fmt.Sprintf("response: 录制为空=%t 实际为空=%t", expected == nil, actual == nil))
+		}
+		return diffs
+	}
+
+	if expected.Code != actual.Code {
+		diffs = append(diffs, fmt.Sprintf("code: 录制=%d 实际=%d", expected.Code, actual.Code))
+	}
+
+	expectedAds := indexBySlot(expected.Data)
+	actualAds := indexBySlot(actual.Data)
+
+	for slotID, exp := range expectedAds {
+		act, ok := actualAds[slotID]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("slot %s: 录制有出价(ad=%s)，实际无出价", slotID, exp.AdID))
+			continue
+		}
+		if exp.AdID != act.AdID {
+			diffs = append(diffs, fmt.Sprintf("slot %s: ad_id 录制=%s 实际=%s", slotID, exp.AdID, act.AdID))
+		}
+		if math.Abs(exp.BidPrice-act.BidPrice) > tolerance {
+			diffs = append(diffs, fmt.Sprintf("slot %s: bid_price 录制=%.4f 实际=%.4f", slotID, exp.BidPrice, act.BidPrice))
+		}
+	}
+	for slotID, act := range actualAds {
+		if _, ok := expectedAds[slotID]; !ok {
+			diffs = append(diffs, fmt.Sprintf("slot %s: 录制无出价，实际有出价(ad=%s)", slotID, act.AdID))
+		}
+	}
+
+	return diffs
+}
+
+// indexBySlot 按广告位索引广告结果
+func indexBySlot(results []traffic.AdResult) map[string]traffic.AdResult {
+	index := make(map[string]traffic.AdResult, len(results))
+	for _, result := range results {
+		index[result.SlotID] = result
+	}
+	return index
+}
+
+// readFromFile 从文件读取请求日志
+func readFromFile(ctx context.Context, path string, limit int, out chan<- *Record) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	count := 0
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		record, err := decodeRecord([]byte(line))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "跳过无效记录: %v\n", err)
+			continue
+		}
+
+		select {
+		case out <- record:
+		case <-ctx.Done():
+			return nil
+		}
+
+		count++
+		if limit > 0 && count >= limit {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// readFromKafka 从Kafka读取请求日志
+func readFromKafka(ctx context.Context, opts Options, out chan<- *Record) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: strings.Split(opts.Brokers, ","),
+		Topic:   opts.Topic,
+		GroupID: opts.GroupID,
+	})
+	defer reader.Close()
+
+	count := 0
+	for opts.Limit <= 0 || count < opts.Limit {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		record, err := decodeRecord(msg.Value)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "跳过无效记录: offset=%d error=%v\n", msg.Offset, err)
+			continue
+		}
+
+		select {
+		case out <- record:
+		case <-ctx.Done():
+			return nil
+		}
+		count++
+	}
+	return nil
+}
+
+// decodeRecord 解析单条请求日志
+func decodeRecord(data []byte) (*Record, error) {
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	if record.RequestID == "" {
+		record.RequestID = record.Request.RequestID
+	}
+	if len(record.Request.AdSlots) == 0 {
+		return nil, fmt.Errorf("记录缺少广告位: request_id=%s", record.RequestID)
+	}
+	return &record, nil
+}
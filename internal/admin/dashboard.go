@@ -0,0 +1,312 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/cluster"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultDashboardRefreshInterval = 30 * time.Second
+	defaultDashboardTopCampaigns    = 10
+	defaultDashboardMinBids         = 1000
+	// dashboardRefreshTimeout 单次汇总的超时时间
+	dashboardRefreshTimeout = 20 * time.Second
+
+	// bidderService 竞价服务在实例注册表中的服务名
+	bidderService = "dsp-server"
+)
+
+// 告警级别
+const (
+	AlertCritical = "critical"
+	AlertWarning  = "warning"
+)
+
+// 告警代码
+const (
+	AlertRedisUnavailable    = "redis_unavailable"
+	AlertDatabaseError       = "database_error"
+	AlertStatsUnavailable    = "stats_unavailable"
+	AlertRegistryUnavailable = "registry_unavailable"
+	AlertNoBidders           = "no_bidder_instances"
+	AlertLowWinRate          = "low_win_rate"
+)
+
+// DashboardStats 按时间窗口汇总的广告统计，广告ID为出价策略ID
+type DashboardStats interface {
+	LoadWindow(ctx context.Context, adID string, from, to time.Time) (*stats.WindowStats, error)
+}
+
+// Alert 系统告警
+type Alert struct {
+	Level   string `json:"level"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CampaignSummary 广告计划当天的投放数据
+type CampaignSummary struct {
+	ID          string  `json:"id"`
+	Name        string  `json:"name"`
+	Status      string  `json:"status"`
+	Spend       float64 `json:"spend"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	CTR         float64 `json:"ctr"`
+}
+
+// DashboardSummary 看板数据，统计范围为服务器时区的当天零点到汇总时间
+type DashboardSummary struct {
+	Date            string            `json:"date"`
+	Spend           float64           `json:"spend"`
+	Impressions     int64             `json:"impressions"`
+	Clicks          int64             `json:"clicks"`
+	CTR             float64           `json:"ctr"`
+	Bids            int64             `json:"bids"`
+	Wins            int64             `json:"wins"`
+	WinRate         float64           `json:"win_rate"`
+	ActiveCampaigns int               `json:"active_campaigns"`
+	TopCampaigns    []CampaignSummary `json:"top_campaigns"`
+	Alerts          []Alert           `json:"alerts"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+}
+
+// alert 添加告警
+func (s *DashboardSummary) alert(level, code, message string) {
+	s.Alerts = append(s.Alerts, Alert{Level: level, Code: code, Message: message})
+}
+
+// Dashboard 管理后台首页看板，后台定时汇总当天的投放数据和系统告警，接口只返回缓存的汇总结果
+// 广告计划和出价策略来自PostgreSQL，投放数据来自按小时统计
+type Dashboard struct {
+	cfg       config.AdminDashboardConfig
+	db        *gorm.DB
+	stats     DashboardStats
+	redis     *redis.Client
+	instances *cluster.Registry
+	logger    *logger.Logger
+
+	mu      sync.RWMutex
+	summary *DashboardSummary
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewDashboard 创建看板，未设置的配置使用默认值
+// db为nil时不汇总广告计划，只统计系统告警；redisClient为nil时不检查Redis连接
+func NewDashboard(cfg config.AdminDashboardConfig, db *gorm.DB, statsSource DashboardStats, redisClient *redis.Client, logger *logger.Logger) *Dashboard {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultDashboardRefreshInterval
+	}
+	if cfg.TopCampaigns <= 0 {
+		cfg.TopCampaigns = defaultDashboardTopCampaigns
+	}
+	if cfg.MinBids <= 0 {
+		cfg.MinBids = defaultDashboardMinBids
+	}
+	return &Dashboard{
+		cfg:    cfg,
+		db:     db,
+		stats:  statsSource,
+		redis:  redisClient,
+		logger: logger,
+	}
+}
+
+// SetInstanceRegistry 设置实例注册表，设置后没有存活的竞价服务实例时告警
+func (d *Dashboard) SetInstanceRegistry(registry *cluster.Registry) {
+	d.instances = registry
+}
+
+// Start 立即汇总一次并启动定时汇总
+func (d *Dashboard) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancelFunc = cancel
+
+	d.wg.Add(1)
+	go d.runLoop(ctx)
+}
+
+// Stop 停止定时汇总
+func (d *Dashboard) Stop() {
+	if d.cancelFunc == nil {
+		return
+	}
+	d.cancelFunc()
+	d.wg.Wait()
+}
+
+// Summary 返回最近一次的汇总结果，尚未汇总时返回nil
+func (d *Dashboard) Summary() *DashboardSummary {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.summary
+}
+
+// Get 返回最近一次的汇总结果，首次汇总完成前返回503
+func (d *Dashboard) Get(c *gin.Context) {
+	summary := d.Summary()
+	if summary == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": ErrDashboardNotReady.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// Refresh 汇总当天的投放数据和系统告警并替换缓存
+// 数据源出错时记为告警，其余数据照常汇总
+func (d *Dashboard) Refresh(ctx context.Context) *DashboardSummary {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	summary := &DashboardSummary{
+		Date:         from.Format("2006-01-02"),
+		TopCampaigns: []CampaignSummary{},
+		Alerts:       []Alert{},
+		UpdatedAt:    now,
+	}
+
+	if d.redis != nil {
+		if err := d.redis.Ping(ctx).Err(); err != nil {
+			summary.alert(AlertCritical, AlertRedisUnavailable, fmt.Sprintf("Redis连接失败: %v", err))
+		}
+	}
+	if d.db != nil {
+		if err := d.aggregate(ctx, summary, from, now); err != nil {
+			d.logger.Error("汇总看板投放数据失败", "error", err)
+			summary.alert(AlertCritical, AlertDatabaseError, fmt.Sprintf("读取广告计划失败: %v", err))
+		}
+	}
+	if d.instances != nil {
+		instances, err := d.instances.Instances(ctx, bidderService)
+		switch {
+		case err != nil:
+			summary.alert(AlertWarning, AlertRegistryUnavailable, fmt.Sprintf("读取存活实例失败: %v", err))
+		case len(instances) == 0:
+			summary.alert(AlertCritical, AlertNoBidders, "没有存活的竞价服务实例")
+		}
+	}
+	if d.cfg.MinWinRate > 0 && summary.Bids >= d.cfg.MinBids && summary.WinRate < d.cfg.MinWinRate {
+		summary.alert(AlertWarning, AlertLowWinRate,
+			fmt.Sprintf("当天胜率%.2f%%低于%.2f%%", summary.WinRate*100, d.cfg.MinWinRate*100))
+	}
+
+	d.mu.Lock()
+	d.summary = summary
+	d.mu.Unlock()
+	return summary
+}
+
+// aggregate 按出价策略读取当天统计，汇总到广告计划和全局
+// 已删除广告计划的策略当天产生的消耗计入全局，不参与广告计划排名
+func (d *Dashboard) aggregate(ctx context.Context, summary *DashboardSummary, from, to time.Time) error {
+	var campaigns []models.Campaign
+	err := d.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "admin.dashboard_campaigns"))).
+		Model(&models.Campaign{}).
+		Select("id, name, status").
+		Find(&campaigns).Error
+	if err != nil {
+		return err
+	}
+	var strategies []models.BidStrategy
+	err = d.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "admin.dashboard_strategies"))).
+		Model(&models.BidStrategy{}).
+		Select("id, campaign_id").
+		Find(&strategies).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[string]*CampaignSummary, len(campaigns))
+	for _, model := range campaigns {
+		byID[model.ID] = &CampaignSummary{ID: model.ID, Name: model.Name, Status: model.Status}
+		if model.Status == campaign.StatusActive {
+			summary.ActiveCampaigns++
+		}
+	}
+
+	var failed int
+	var lastErr error
+	for _, strategy := range strategies {
+		window, err := d.stats.LoadWindow(ctx, strconv.FormatInt(strategy.ID, 10), from, to)
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		summary.Spend += window.Cost
+		summary.Impressions += window.Impressions
+		summary.Clicks += window.Clicks
+		summary.Bids += window.Bids
+		summary.Wins += window.Wins
+		if c, ok := byID[strategy.CampaignID]; ok {
+			c.Spend += window.Cost
+			c.Impressions += window.Impressions
+			c.Clicks += window.Clicks
+		}
+	}
+	if failed > 0 {
+		d.logger.Warn("读取出价策略统计失败", "failed", failed, "error", lastErr)
+		summary.alert(AlertWarning, AlertStatsUnavailable,
+			fmt.Sprintf("%d个出价策略的统计读取失败，数据不完整: %v", failed, lastErr))
+	}
+	summary.CTR = stats.Ratio(summary.Clicks, summary.Impressions)
+	summary.WinRate = stats.Ratio(summary.Wins, summary.Bids)
+
+	for _, c := range byID {
+		if c.Spend > 0 || c.Impressions > 0 {
+			c.CTR = stats.Ratio(c.Clicks, c.Impressions)
+			summary.TopCampaigns = append(summary.TopCampaigns, *c)
+		}
+	}
+	sort.Slice(summary.TopCampaigns, func(i, j int) bool {
+		a, b := summary.TopCampaigns[i], summary.TopCampaigns[j]
+		if a.Spend != b.Spend {
+			return a.Spend > b.Spend
+		}
+		if a.Impressions != b.Impressions {
+			return a.Impressions > b.Impressions
+		}
+		return a.ID < b.ID
+	})
+	if len(summary.TopCampaigns) > d.cfg.TopCampaigns {
+		summary.TopCampaigns = summary.TopCampaigns[:d.cfg.TopCampaigns]
+	}
+	return nil
+}
+
+func (d *Dashboard) runLoop(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		refreshCtx, cancel := context.WithTimeout(ctx, dashboardRefreshTimeout)
+		d.Refresh(refreshCtx)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherCampaigns 排名之外的广告计划合并后的rank和campaign标签
+const otherCampaigns = "other"
+
+// DashboardCollector 将看板的汇总结果导出为预聚合指标，采集时读取最近一次的汇总，不查询数据源
+// 广告计划按当天消耗排名，rank为名次，campaign为计划名称，排名之外的计划和已删除计划的消耗合并为other，
+// 序列数不超过top_campaigns加1，不随广告和出价策略的数量增长
+type DashboardCollector struct {
+	dashboard *Dashboard
+
+	spend           *prometheus.Desc
+	impressions     *prometheus.Desc
+	clicks          *prometheus.Desc
+	bids            *prometheus.Desc
+	wins            *prometheus.Desc
+	activeCampaigns *prometheus.Desc
+
+	campaignSpend       *prometheus.Desc
+	campaignImpressions *prometheus.Desc
+	campaignClicks      *prometheus.Desc
+
+	alerts    *prometheus.Desc
+	updatedAt *prometheus.Desc
+}
+
+// NewDashboardCollector 创建看板的预聚合指标
+func NewDashboardCollector(dashboard *Dashboard) *DashboardCollector {
+	campaignLabels := []string{"rank", "campaign"}
+	return &DashboardCollector{
+		dashboard:       dashboard,
+		spend:           prometheus.NewDesc("dsp_dashboard_spend", "当天的消耗(元)", nil, nil),
+		impressions:     prometheus.NewDesc("dsp_dashboard_impressions", "当天的展示数", nil, nil),
+		clicks:          prometheus.NewDesc("dsp_dashboard_clicks", "当天的点击数", nil, nil),
+		bids:            prometheus.NewDesc("dsp_dashboard_bids", "当天的出价数", nil, nil),
+		wins:            prometheus.NewDesc("dsp_dashboard_wins", "当天的竞价成功数", nil, nil),
+		activeCampaigns: prometheus.NewDesc("dsp_dashboard_active_campaigns", "投放中的广告计划数", nil, nil),
+
+		campaignSpend:       prometheus.NewDesc("dsp_dashboard_campaign_spend", "当天消耗排名前N的广告计划的消耗(元)", campaignLabels, nil),
+		campaignImpressions: prometheus.NewDesc("dsp_dashboard_campaign_impressions", "当天消耗排名前N的广告计划的展示数", campaignLabels, nil),
+		campaignClicks:      prometheus.NewDesc("dsp_dashboard_campaign_clicks", "当天消耗排名前N的广告计划的点击数", campaignLabels, nil),
+
+		alerts:    prometheus.NewDesc("dsp_dashboard_alerts", "看板当前的告警，存在时为1", []string{"level", "code"}, nil),
+		updatedAt: prometheus.NewDesc("dsp_dashboard_updated_timestamp_seconds", "最近一次汇总的时间", nil, nil),
+	}
+}
+
+// Describe 实现prometheus.Collector
+func (c *DashboardCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		c.spend, c.impressions, c.clicks, c.bids, c.wins, c.activeCampaigns,
+		c.campaignSpend, c.campaignImpressions, c.campaignClicks,
+		c.alerts, c.updatedAt,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect 实现prometheus.Collector，首次汇总完成前不输出指标
+func (c *DashboardCollector) Collect(ch chan<- prometheus.Metric) {
+	summary := c.dashboard.Summary()
+	if summary == nil {
+		return
+	}
+
+	gauge := func(desc *prometheus.Desc, value float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, labels...)
+	}
+	gauge(c.spend, summary.Spend)
+	gauge(c.impressions, float64(summary.Impressions))
+	gauge(c.clicks, float64(summary.Clicks))
+	gauge(c.bids, float64(summary.Bids))
+	gauge(c.wins, float64(summary.Wins))
+	gauge(c.activeCampaigns, float64(summary.ActiveCampaigns))
+	gauge(c.updatedAt, float64(summary.UpdatedAt.Unix()))
+
+	otherSpend, otherImpressions, otherClicks := summary.Spend, summary.Impressions, summary.Clicks
+	for i, campaign := range summary.TopCampaigns {
+		rank := strconv.Itoa(i + 1)
+		name := campaign.Name
+		if name == "" {
+			name = campaign.ID
+		}
+		gauge(c.campaignSpend, campaign.Spend, rank, name)
+		gauge(c.campaignImpressions, float64(campaign.Impressions), rank, name)
+		gauge(c.campaignClicks, float64(campaign.Clicks), rank, name)
+		otherSpend -= campaign.Spend
+		otherImpressions -= campaign.Impressions
+		otherClicks -= campaign.Clicks
+	}
+	// 消耗为浮点数累加，相减后按分舍入，避免输出极小的残差
+	gauge(c.campaignSpend, math.Max(0, math.Round(otherSpend*100)/100), otherCampaigns, otherCampaigns)
+	gauge(c.campaignImpressions, float64(otherImpressions), otherCampaigns, otherCampaigns)
+	gauge(c.campaignClicks, float64(otherClicks), otherCampaigns, otherCampaigns)
+
+	for _, alert := range summary.Alerts {
+		gauge(c.alerts, 1, alert.Level, alert.Code)
+	}
+}
@@ -31,6 +31,7 @@ var (
 	ErrInvalidStatsTimeRange = errors.New("无效的统计时间范围")
 	ErrStatsNotFound         = errors.New("统计数据不存在")
 	ErrStatsCalculationFailed = errors.New("统计计算失败")
+	ErrDashboardNotReady      = errors.New("看板数据尚未汇总完成")
 
 	// 系统相关错误
 	ErrRedisConnectionFailed = errors.New("Redis连接失败")
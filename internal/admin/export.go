@@ -0,0 +1,122 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/export"
+)
+
+// maxExportDays 统计导出允许的最大天数
+const maxExportDays = 92
+
+// ErrInvalidExportFormat 表示不支持的导出格式
+var ErrInvalidExportFormat = errors.New("不支持的导出格式，可选csv或xlsx")
+
+// ExportAds 导出广告列表
+func (s *Service) ExportAds(c *gin.Context) {
+	w, ok := s.beginExport(c, "ads")
+	if !ok {
+		return
+	}
+
+	w.WriteRow("ID", "标题", "描述", "图片URL", "落地页URL", "宽", "高", "预算ID", "状态", "创建时间", "更新时间")
+	err := s.scanRecords(c.Request.Context(), "ad:*", func(data []byte) error {
+		var ad Ad
+		if err := json.Unmarshal(data, &ad); err != nil || ad.Status == adStatusDeleted {
+			return nil
+		}
+		return w.WriteRow(ad.ID, ad.Title, ad.Description, ad.ImageURL, ad.LandingURL,
+			ad.Width, ad.Height, ad.BudgetID, ad.Status, ad.CreateTime, ad.UpdateTime)
+	})
+	s.finishExport(w, "ads", err)
+}
+
+// ExportBudgets 导出预算列表
+func (s *Service) ExportBudgets(c *gin.Context) {
+	w, ok := s.beginExport(c, "budgets")
+	if !ok {
+		return
+	}
+
+	w.WriteRow("ID", "名称", "金额", "已用金额", "开始时间", "结束时间", "状态", "自动续费", "创建时间", "更新时间")
+	err := s.scanRecords(c.Request.Context(), "budget:*", func(data []byte) error {
+		var budget Budget
+		if err := json.Unmarshal(data, &budget); err != nil {
+			return nil
+		}
+		return w.WriteRow(budget.ID, budget.Name, budget.Amount, budget.UsedAmount, budget.StartTime,
+			budget.EndTime, budget.Status, budget.AutoRenewal, budget.CreateTime, budget.UpdateTime)
+	})
+	s.finishExport(w, "budgets", err)
+}
+
+// ExportStats 导出广告每日统计
+// 日期范围通过start_date、end_date指定，格式为2006-01-02，默认为当天
+func (s *Service) ExportStats(c *gin.Context) {
+	today := time.Now().Format("2006-01-02")
+	start, err := time.Parse("2006-01-02", c.DefaultQuery("start_date", today))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidStatsTimeRange.Error()})
+		return
+	}
+	end, err := time.Parse("2006-01-02", c.DefaultQuery("end_date", today))
+	if err != nil || end.Before(start) || end.Sub(start) > maxExportDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidStatsTimeRange.Error()})
+		return
+	}
+
+	w, ok := s.beginExport(c, "stats")
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	w.WriteRow("日期", "广告ID", "展示", "点击", "转化", "消耗", "CTR", "CVR",
+		"可见展示", "可见率", "视频播放", "视频完播", "完播率", "平均停留(ms)")
+	err = s.scanRecords(ctx, "ad:*", func(data []byte) error {
+		var ad Ad
+		if err := json.Unmarshal(data, &ad); err != nil {
+			return nil
+		}
+		for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+			stats, err := s.statsService.GetAdDailyStats(ctx, ad.ID, day.Format("2006-01-02"))
+			if err != nil {
+				return err
+			}
+			if err := w.WriteRow(stats.Date, stats.AdID, stats.Impressions, stats.Clicks,
+				stats.Conversions, stats.Cost, stats.CTR, stats.CVR,
+				stats.ViewableImpressions, stats.ViewabilityRate, stats.VideoStarts,
+				stats.VideoCompletes, stats.VideoCompletionRate, stats.AvgDwellMs); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	s.finishExport(w, "stats", err)
+}
+
+// beginExport 校验导出格式并写入下载响应头
+func (s *Service) beginExport(c *gin.Context, prefix string) (export.Writer, bool) {
+	w, err := export.NewResponseWriter(c.Writer, prefix, c.DefaultQuery("format", export.FormatCSV))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidExportFormat.Error()})
+		return nil, false
+	}
+	return w, true
+}
+
+// finishExport 结束导出
+// 响应头已发送，中途出错只能记录日志，客户端会收到不完整的文件
+func (s *Service) finishExport(w export.Writer, name string, err error) {
+	if err != nil {
+		s.logger.Error("导出数据失败", "export", name, "error", err)
+	}
+	if err := w.Close(); err != nil {
+		s.logger.Error("完成导出失败", "export", name, "error", err)
+	}
+}
@@ -0,0 +1,15 @@
+package admin
+
+import "context"
+
+// LandingURL 查询广告的落地页URL，供点击事件替换宏后返回
+func (s *Service) LandingURL(ctx context.Context, adID string) (string, error) {
+	ad, err := s.getAd(ctx, adID)
+	if err != nil {
+		return "", err
+	}
+	if ad.Status == adStatusDeleted {
+		return "", ErrAdNotFound
+	}
+	return ad.LandingURL, nil
+}
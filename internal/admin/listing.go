@@ -0,0 +1,67 @@
+package admin
+
+import "simple-dsp/pkg/listing"
+
+// adListSpec 广告列表允许的排序和过滤字段
+var adListSpec = listing.Spec{
+	Sortable:    []string{"title", "status", "budget_id", "create_time", "update_time"},
+	Filterable:  []string{"status", "budget_id", "width", "height"},
+	DefaultSort: "-create_time",
+}
+
+// budgetListSpec 预算列表允许的排序和过滤字段
+var budgetListSpec = listing.Spec{
+	Sortable:    []string{"name", "amount", "used_amount", "status", "start_time", "end_time", "create_time", "update_time"},
+	Filterable:  []string{"status", "auto_renewal"},
+	DefaultSort: "-create_time",
+}
+
+// adField 读取广告字段
+func adField(ad Ad, field string) interface{} {
+	switch field {
+	case "id":
+		return ad.ID
+	case "title":
+		return ad.Title
+	case "width":
+		return ad.Width
+	case "height":
+		return ad.Height
+	case "budget_id":
+		return ad.BudgetID
+	case "status":
+		return ad.Status
+	case "create_time":
+		return ad.CreateTime
+	case "update_time":
+		return ad.UpdateTime
+	}
+	return nil
+}
+
+// budgetField 读取预算字段
+func budgetField(budget Budget, field string) interface{} {
+	switch field {
+	case "id":
+		return budget.ID
+	case "name":
+		return budget.Name
+	case "amount":
+		return budget.Amount
+	case "used_amount":
+		return budget.UsedAmount
+	case "status":
+		return budget.Status
+	case "auto_renewal":
+		return budget.AutoRenewal
+	case "start_time":
+		return budget.StartTime
+	case "end_time":
+		return budget.EndTime
+	case "create_time":
+		return budget.CreateTime
+	case "update_time":
+		return budget.UpdateTime
+	}
+	return nil
+}
@@ -17,6 +17,7 @@ func (s *Service) RegisterRoutes(r *gin.Engine) {
 			ads.DELETE("/:id", s.DeleteAd)      // 删除广告
 			ads.GET("/:id", s.GetAd)            // 获取广告信息
 			ads.GET("", s.ListAds)              // 获取广告列表
+			ads.GET("/export", s.ExportAds)     // 导出广告列表
 			ads.GET("/:id/stats", s.GetAdStats) // 获取广告统计
 
 			// 频次控制配置
@@ -24,6 +25,13 @@ func (s *Service) RegisterRoutes(r *gin.Engine) {
 			ads.GET("/:id/frequency", s.GetFrequencyConfig)    // 获取频次控制配置
 		}
 
+		// 推广计划QPS限制
+		campaigns := v1.Group("/campaigns")
+		{
+			campaigns.PUT("/:id/qps", s.UpdateCampaignQPS) // 设置推广计划QPS
+			campaigns.GET("/:id/qps", s.GetCampaignQPS)    // 获取推广计划QPS
+		}
+
 		// 预算管理
 		budgets := v1.Group("/budgets")
 		{
@@ -31,6 +39,7 @@ func (s *Service) RegisterRoutes(r *gin.Engine) {
 			budgets.PUT("/:id", s.UpdateBudget)         // 更新预算
 			budgets.GET("/:id", s.GetBudget)            // 获取预算信息
 			budgets.GET("", s.ListBudgets)              // 获取预算列表
+			budgets.GET("/export", s.ExportBudgets)     // 导出预算列表
 			budgets.POST("/:id/renew", s.RenewBudget)   // 续费预算
 			budgets.GET("/:id/stats", s.GetBudgetStats) // 获取预算统计
 		}
@@ -41,6 +50,7 @@ func (s *Service) RegisterRoutes(r *gin.Engine) {
 			stats.GET("/overview", s.GetStatsOverview) // 获取统计概览
 			stats.GET("/daily", s.GetDailyStats)       // 获取每日统计
 			stats.GET("/hourly", s.GetHourlyStats)     // 获取每小时统计
+			stats.GET("/export", s.ExportStats)        // 导出广告每日统计
 		}
 
 		// 系统管理
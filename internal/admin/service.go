@@ -3,6 +3,7 @@ package admin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -11,11 +12,19 @@ import (
 
 	"simple-dsp/internal/budget"
 	"simple-dsp/internal/frequency"
+	"simple-dsp/internal/skadn"
 	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/cluster"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 )
 
+// scanBatchSize 遍历Redis键时每批的数量
+const scanBatchSize = 500
+
 // Service 管理后台服务
 type Service struct {
 	budgetMgr    *budget.Manager
@@ -23,7 +32,10 @@ type Service struct {
 	logger       *logger.Logger
 	metrics      *metrics.Metrics
 	redis        *redis.Client
-	freqCtrl     *frequency.Controller
+	freqCtrl     frequency.Controller
+	skadnStore   skadn.Store
+	rateLimiter  *frequency.RateLimiter
+	instances    *cluster.Registry
 }
 
 // NewService 创建管理后台服务
@@ -32,7 +44,7 @@ func NewService(
 	statsService *stats.Service,
 	logger *logger.Logger,
 	metrics *metrics.Metrics,
-	freqCtrl *frequency.Controller,
+	freqCtrl frequency.Controller,
 ) *Service {
 	return &Service{
 		budgetMgr:    budgetMgr,
@@ -43,6 +55,21 @@ func NewService(
 	}
 }
 
+// SetSKAdNetworkStore 设置SKAdNetwork配置存储，保存广告时同步其SKAdNetwork配置
+func (s *Service) SetSKAdNetworkStore(store skadn.Store) {
+	s.skadnStore = store
+}
+
+// SetInstanceRegistry 设置实例注册表，设置后系统状态中包含各服务存活的实例
+func (s *Service) SetInstanceRegistry(registry *cluster.Registry) {
+	s.instances = registry
+}
+
+// SetRateLimiter 设置竞价QPS限流器，用于管理推广计划的QPS
+func (s *Service) SetRateLimiter(limiter *frequency.RateLimiter) {
+	s.rateLimiter = limiter
+}
+
 // Ad 广告信息
 type Ad struct {
 	ID          string    `json:"id"`
@@ -56,6 +83,10 @@ type Ad struct {
 	Status      string    `json:"status"`
 	CreateTime  time.Time `json:"create_time"`
 	UpdateTime  time.Time `json:"update_time"`
+	// DeleteTime 删除时间，删除后保留在回收站中直到被清理
+	DeleteTime *time.Time `json:"delete_time,omitempty"`
+	// SKAdNetwork 推广iOS应用时的SKAdNetwork配置
+	SKAdNetwork *skadn.Campaign `json:"skadnetwork,omitempty"`
 }
 
 // Budget 预算信息
@@ -93,7 +124,7 @@ func (s *Service) CreateAd(c *gin.Context) {
 	}
 
 	// 生成广告ID
-	ad.ID = generateID()
+	ad.ID = id.New()
 	ad.CreateTime = time.Now()
 	ad.UpdateTime = time.Now()
 	ad.Status = "active"
@@ -121,7 +152,7 @@ func (s *Service) UpdateAd(c *gin.Context) {
 	// 获取现有广告
 	ctx := c.Request.Context()
 	existingAd, err := s.getAd(ctx, id)
-	if err != nil {
+	if err != nil || existingAd.Status == adStatusDeleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "广告不存在"})
 		return
 	}
@@ -146,16 +177,18 @@ func (s *Service) DeleteAd(c *gin.Context) {
 	id := c.Param("id")
 	ctx := c.Request.Context()
 
-	// 获取广告信息
+	// 获取广告信息，已在回收站中的广告不重复删除
 	ad, err := s.getAd(ctx, id)
-	if err != nil {
+	if err != nil || ad.Status == adStatusDeleted {
 		c.JSON(http.StatusNotFound, gin.H{"error": "广告不存在"})
 		return
 	}
 
-	// 标记广告为删除状态
-	ad.Status = "deleted"
-	ad.UpdateTime = time.Now()
+	// 标记广告为删除状态，移入回收站
+	now := time.Now()
+	ad.Status = adStatusDeleted
+	ad.UpdateTime = now
+	ad.DeleteTime = &now
 
 	// 保存更新后的广告
 	if err := s.saveAd(ctx, ad); err != nil {
@@ -181,8 +214,14 @@ func (s *Service) GetAd(c *gin.Context) {
 	c.JSON(http.StatusOK, ad)
 }
 
-// ListAds 获取广告列表
+// ListAds 获取广告列表，支持分页、排序和过滤
 func (s *Service) ListAds(c *gin.Context) {
+	query, err := listing.ParseQuery(c, adListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := c.Request.Context()
 	ads, err := s.getAllAds(ctx)
 	if err != nil {
@@ -191,7 +230,7 @@ func (s *Service) ListAds(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, ads)
+	c.JSON(http.StatusOK, listing.Apply(ads, query, adField))
 }
 
 // CreateBudget 创建预算
@@ -203,7 +242,7 @@ func (s *Service) CreateBudget(c *gin.Context) {
 	}
 
 	// 生成预算ID
-	budget.ID = generateID()
+	budget.ID = id.New()
 	budget.CreateTime = time.Now()
 	budget.UpdateTime = time.Now()
 	budget.Status = "active"
@@ -267,8 +306,14 @@ func (s *Service) GetBudget(c *gin.Context) {
 	c.JSON(http.StatusOK, budget)
 }
 
-// ListBudgets 获取预算列表
+// ListBudgets 获取预算列表，支持分页、排序和过滤
 func (s *Service) ListBudgets(c *gin.Context) {
+	query, err := listing.ParseQuery(c, budgetListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	ctx := c.Request.Context()
 	budgets, err := s.getAllBudgets(ctx)
 	if err != nil {
@@ -277,7 +322,7 @@ func (s *Service) ListBudgets(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, budgets)
+	c.JSON(http.StatusOK, listing.Apply(budgets, query, budgetField))
 }
 
 // RenewBudget 续费预算
@@ -383,6 +428,19 @@ func (s *Service) GetSystemStatus(c *gin.Context) {
 		"redis": s.checkRedisStatus(ctx),
 		"time":  time.Now().Format(time.RFC3339),
 	}
+	if s.instances != nil {
+		instances, err := s.instances.Instances(ctx, "")
+		if err != nil {
+			s.logger.Error("读取存活实例失败", "error", err)
+			status["instances"] = gin.H{"error": err.Error()}
+		} else {
+			services := make(map[string][]cluster.Instance)
+			for _, instance := range instances {
+				services[instance.Service] = append(services[instance.Service], instance)
+			}
+			status["instances"] = services
+		}
+	}
 
 	c.JSON(http.StatusOK, status)
 }
@@ -443,6 +501,54 @@ func (s *Service) GetFrequencyConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, config)
 }
 
+// campaignQPSRequest 推广计划QPS设置请求
+type campaignQPSRequest struct {
+	QPS *float64 `json:"qps" binding:"required"`
+}
+
+// UpdateCampaignQPS 设置推广计划的QPS，同一计划下的广告共用，0表示不限制
+func (s *Service) UpdateCampaignQPS(c *gin.Context) {
+	if s.rateLimiter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未启用QPS限制"})
+		return
+	}
+	var req campaignQPSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	id := c.Param("id")
+	if err := s.rateLimiter.SetCampaignQPS(c.Request.Context(), id, *req.QPS); err != nil {
+		if errors.Is(err, frequency.ErrInvalidConfig) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		s.logger.Error("设置推广计划QPS失败", "campaign_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置推广计划QPS失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "推广计划QPS已更新"})
+}
+
+// GetCampaignQPS 获取推广计划的QPS
+func (s *Service) GetCampaignQPS(c *gin.Context) {
+	if s.rateLimiter == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "未启用QPS限制"})
+		return
+	}
+	id := c.Param("id")
+	qps, err := s.rateLimiter.CampaignQPS(c.Request.Context(), id)
+	if err != nil {
+		s.logger.Error("获取推广计划QPS失败", "campaign_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取推广计划QPS失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaign_id": id, "qps": qps})
+}
+
 // 内部辅助方法
 
 func (s *Service) saveAd(ctx context.Context, ad *Ad) error {
@@ -452,7 +558,21 @@ func (s *Service) saveAd(ctx context.Context, ad *Ad) error {
 	}
 
 	key := "ad:" + ad.ID
-	return s.redis.Set(ctx, key, data, 0).Err()
+	if err := s.redis.Set(ctx, key, data, 0).Err(); err != nil {
+		return err
+	}
+	return s.syncSKAdNetwork(ctx, ad)
+}
+
+// syncSKAdNetwork 同步广告的SKAdNetwork配置，已删除的广告不再参与签名和回传归因
+func (s *Service) syncSKAdNetwork(ctx context.Context, ad *Ad) error {
+	if s.skadnStore == nil {
+		return nil
+	}
+	if ad.SKAdNetwork == nil || ad.Status == adStatusDeleted {
+		return s.skadnStore.Delete(ctx, ad.ID)
+	}
+	return s.skadnStore.Save(ctx, ad.ID, ad.SKAdNetwork)
 }
 
 func (s *Service) getAd(ctx context.Context, id string) (*Ad, error) {
@@ -471,29 +591,19 @@ func (s *Service) getAd(ctx context.Context, id string) (*Ad, error) {
 }
 
 func (s *Service) getAllAds(ctx context.Context) ([]Ad, error) {
-	keys, err := s.redis.Keys(ctx, "ad:*").Result()
-	if err != nil {
-		return nil, err
-	}
-
 	var ads []Ad
-	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			continue
-		}
-
+	err := s.scanRecords(ctx, "ad:*", func(data []byte) error {
 		var ad Ad
 		if err := json.Unmarshal(data, &ad); err != nil {
-			continue
+			return nil
 		}
 
-		if ad.Status != "deleted" {
+		if ad.Status != adStatusDeleted {
 			ads = append(ads, ad)
 		}
-	}
-
-	return ads, nil
+		return nil
+	})
+	return ads, err
 }
 
 func (s *Service) saveBudget(ctx context.Context, budget *Budget) error {
@@ -522,27 +632,46 @@ func (s *Service) getBudget(ctx context.Context, id string) (*Budget, error) {
 }
 
 func (s *Service) getAllBudgets(ctx context.Context) ([]Budget, error) {
-	keys, err := s.redis.Keys(ctx, "budget:*").Result()
-	if err != nil {
-		return nil, err
-	}
-
 	var budgets []Budget
-	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			continue
-		}
-
+	err := s.scanRecords(ctx, "budget:*", func(data []byte) error {
 		var budget Budget
 		if err := json.Unmarshal(data, &budget); err != nil {
-			continue
+			return nil
 		}
 
 		budgets = append(budgets, budget)
-	}
+		return nil
+	})
+	return budgets, err
+}
 
-	return budgets, nil
+// scanRecords 分批遍历匹配的Redis记录，避免一次性加载全部键
+func (s *Service) scanRecords(ctx context.Context, pattern string, fn func(data []byte) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.redis.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		values, err := cache.MGet(ctx, s.redis, keys)
+		if err != nil {
+			return err
+		}
+		for _, data := range values {
+			if data == nil {
+				continue
+			}
+			if err := fn(data); err != nil {
+				return err
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
 }
 
 func (s *Service) checkRedisStatus(ctx context.Context) string {
@@ -551,16 +680,3 @@ func (s *Service) checkRedisStatus(ctx context.Context) string {
 	}
 	return "connected"
 }
-
-func generateID() string {
-	return time.Now().Format("20060102150405") + randomString(6)
-}
-
-func randomString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[time.Now().UnixNano()%int64(len(letters))]
-	}
-	return string(b)
-}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/trash"
+)
+
+// 广告状态
+const (
+	adStatusInactive = "inactive"
+	adStatusDeleted  = "deleted"
+)
+
+// adTrash 广告回收站
+type adTrash struct {
+	s *Service
+}
+
+// AdTrash 返回广告回收站
+func (s *Service) AdTrash() trash.Store {
+	return &adTrash{s: s}
+}
+
+// ListDeleted 列出已删除的广告
+func (t *adTrash) ListDeleted(ctx context.Context) ([]trash.Item, error) {
+	var items []trash.Item
+	err := t.s.scanRecords(ctx, "ad:*", func(data []byte) error {
+		var ad Ad
+		if err := json.Unmarshal(data, &ad); err != nil || ad.Status != adStatusDeleted {
+			return nil
+		}
+		items = append(items, trash.Item{ID: ad.ID, Name: ad.Title, DeleteTime: deleteTimeOf(&ad)})
+		return nil
+	})
+	return items, err
+}
+
+// Restore 恢复已删除的广告，恢复后为停用状态
+func (t *adTrash) Restore(ctx context.Context, id string) error {
+	ad, err := t.s.getAd(ctx, id)
+	if err == redis.Nil || (err == nil && ad.Status != adStatusDeleted) {
+		return trash.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	ad.Status = adStatusInactive
+	ad.UpdateTime = time.Now()
+	ad.DeleteTime = nil
+	return t.s.saveAd(ctx, ad)
+}
+
+// Purge 彻底删除在before之前删除的广告
+func (t *adTrash) Purge(ctx context.Context, before time.Time) (int, error) {
+	var keys []string
+	err := t.s.scanRecords(ctx, "ad:*", func(data []byte) error {
+		var ad Ad
+		if err := json.Unmarshal(data, &ad); err != nil || ad.Status != adStatusDeleted {
+			return nil
+		}
+		if deleteTimeOf(&ad).Before(before) {
+			keys = append(keys, "ad:"+ad.ID)
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	if err := t.s.redis.Del(ctx, keys...).Err(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// deleteTimeOf 返回广告的删除时间，早期删除的广告没有记录删除时间，使用更新时间代替
+func deleteTimeOf(ad *Ad) time.Time {
+	if ad.DeleteTime != nil {
+		return *ad.DeleteTime
+	}
+	return ad.UpdateTime
+}
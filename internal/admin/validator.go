@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"regexp"
 	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/macro"
 	"strings"
 	"time"
 )
@@ -46,10 +47,17 @@ func (v *validator) ValidateAd(ad *Ad) error {
 	}
 
 	// 验证广告落地页URL
-	if ad.LandingURL != "" && !isValidURL(ad.LandingURL) {
+	if ad.LandingURL != "" && (!isValidURL(ad.LandingURL) || macro.Validate(ad.LandingURL) != nil) {
 		return ErrInvalidAdLandingURL
 	}
 
+	// 验证SKAdNetwork配置
+	if ad.SKAdNetwork != nil {
+		if err := ad.SKAdNetwork.Validate(); err != nil {
+			return err
+		}
+	}
+
 	// 验证广告尺寸
 	if ad.Width <= 0 || ad.Height <= 0 {
 		return ErrInvalidAdSize
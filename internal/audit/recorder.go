@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+)
+
+// 资源类型
+const (
+	ResourceCampaign = "campaign"
+	ResourceStrategy = "bid_strategy"
+)
+
+// Entry 审计记录
+type Entry struct {
+	Operator     string
+	Action       string
+	ResourceType string
+	ResourceID   string
+	BatchID      string
+	Before       interface{}
+	After        interface{}
+}
+
+// Recorder 审计日志记录器
+type Recorder struct {
+	db *gorm.DB
+}
+
+// NewRecorder 创建审计日志记录器
+func NewRecorder(db *gorm.DB) *Recorder {
+	return &Recorder{db: db}
+}
+
+// WithTx 返回在指定事务中写入的记录器，审计日志与业务变更一同提交或回滚
+func (r *Recorder) WithTx(tx *gorm.DB) *Recorder {
+	return &Recorder{db: tx}
+}
+
+// Record 写入审计记录
+func (r *Recorder) Record(ctx context.Context, entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	logs := make([]models.AuditLog, 0, len(entries))
+	for _, entry := range entries {
+		before, err := marshal(entry.Before)
+		if err != nil {
+			return err
+		}
+		after, err := marshal(entry.After)
+		if err != nil {
+			return err
+		}
+		logs = append(logs, models.AuditLog{
+			Operator:     entry.Operator,
+			Action:       entry.Action,
+			ResourceType: entry.ResourceType,
+			ResourceID:   entry.ResourceID,
+			BatchID:      entry.BatchID,
+			Before:       before,
+			After:        after,
+			CreateTime:   now,
+		})
+	}
+
+	if err := r.db.WithContext(ctx).Create(&logs).Error; err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// marshal 序列化变更前后的数据
+func marshal(v interface{}) (models.JSON, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("序列化审计数据失败: %w", err)
+	}
+	return data, nil
+}
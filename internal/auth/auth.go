@@ -0,0 +1,444 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: auth.go
+ * Project: simple-dsp
+ * Description: 管理后台认证，操作人员使用用户名密码登录控制台，程序使用Bearer令牌调用接口
+ *
+ * 主要功能:
+ * - 用户名密码登录，密码使用bcrypt哈希保存
+ * - 基于Redis的会话，Cookie保存会话令牌，写请求校验CSRF令牌
+ * - 可选的第二因素校验，默认实现为TOTP动态口令
+ * - 连续登录失败达到上限后按用户名锁定
+ * - 用户管理：创建、修改角色和状态、重置密码、删除
+ * - 广告主用户只能访问自助接口，且只能访问所属广告主的数据
+ *
+ * 实现细节:
+ * - 会话空闲超时后过期，且不超过从登录起的最长有效期
+ * - 修改密码、角色、停用或删除用户时注销该用户的所有会话
+ * - 已使用的动态口令在有效窗口内不能再次使用，防止重放
+ * - 动态口令错误同样计入登录失败次数
+ * - API令牌使用常量时间比较，持有令牌视为管理员
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - golang.org/x/crypto/bcrypt
+ * - simple-dsp/internal/models
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 用户不存在、已停用和密码错误返回相同的错误，避免泄露用户是否存在
+ * - 会话中保存登录时的角色，角色变更通过注销会话生效
+ * - 第一个用户需要使用API令牌创建
+ */
+
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// RoleAdmin 管理员，可以管理用户
+	RoleAdmin = "admin"
+	// RoleOperator 运营人员，可以使用除用户管理外的所有接口
+	RoleOperator = "operator"
+	// RoleAdvertiser 广告主，只能使用自助接口访问所属广告主的数据
+	RoleAdvertiser = "advertiser"
+
+	// MethodSession 通过会话Cookie认证
+	MethodSession = "session"
+	// MethodToken 通过API令牌认证
+	MethodToken = "token"
+
+	// loginFailKeyPrefix 连续登录失败次数键前缀
+	loginFailKeyPrefix = "admin:login:fail:"
+	// otpUsedKeyPrefix 已使用的动态口令键前缀
+	otpUsedKeyPrefix = "admin:otp:used:"
+	// otpUsedTTL 已使用口令的记录时间，覆盖前后各一个步长的有效窗口
+	otpUsedTTL = (2*totpSkew + 1) * totpPeriod
+
+	defaultSessionIdleTimeout = 30 * time.Minute
+	defaultSessionMaxAge      = 12 * time.Hour
+	defaultMaxLoginAttempts   = 5
+	defaultLockoutDuration    = 15 * time.Minute
+)
+
+// usernamePattern 用户名格式
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,64}$`)
+
+// Principal 已认证的调用方
+type Principal struct {
+	// UserID 用户ID，API令牌认证时为空
+	UserID   string `json:"user_id,omitempty"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// AdvertiserID 广告主用户所属的广告主
+	AdvertiserID string `json:"advertiser_id,omitempty"`
+	// Method 认证方式，session或token
+	Method string `json:"method"`
+}
+
+// Service 认证服务
+type Service struct {
+	cfg      config.AdminAuthConfig
+	users    UserStore
+	sessions *SessionStore
+	redis    redis.Cmdable
+	factor   SecondFactor
+	logger   *logger.Logger
+}
+
+// NewService 创建认证服务，未配置的参数使用默认值
+func NewService(cfg config.AdminAuthConfig, users UserStore, rdb redis.Cmdable, log *logger.Logger) *Service {
+	if cfg.SessionIdleTimeout == 0 {
+		cfg.SessionIdleTimeout = defaultSessionIdleTimeout
+	}
+	if cfg.SessionMaxAge == 0 {
+		cfg.SessionMaxAge = defaultSessionMaxAge
+	}
+	if cfg.MaxLoginAttempts == 0 {
+		cfg.MaxLoginAttempts = defaultMaxLoginAttempts
+	}
+	if cfg.LockoutDuration == 0 {
+		cfg.LockoutDuration = defaultLockoutDuration
+	}
+	return &Service{
+		cfg:      cfg,
+		users:    users,
+		sessions: NewSessionStore(rdb, cfg.SessionIdleTimeout, cfg.SessionMaxAge),
+		redis:    rdb,
+		factor:   TOTP{},
+		logger:   log,
+	}
+}
+
+// SetSecondFactor 替换第二因素校验，用户启用动态口令后登录时调用
+func (s *Service) SetSecondFactor(factor SecondFactor) {
+	s.factor = factor
+}
+
+// Login 校验用户名、密码和动态口令，成功后创建会话
+func (s *Service) Login(ctx context.Context, username, password, otp string) (*Session, error) {
+	if err := s.checkLockout(ctx, username); err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.GetByUsername(ctx, username)
+	if errors.Is(err, ErrUserNotFound) {
+		CheckPassword("", password)
+		return nil, s.recordFailure(ctx, username, ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPassword(user.PasswordHash, password) || !user.Enabled {
+		return nil, s.recordFailure(ctx, username, ErrInvalidCredentials)
+	}
+
+	if user.TOTPEnabled {
+		if otp == "" {
+			return nil, ErrOTPRequired
+		}
+		if err := s.verifyOTP(ctx, user, otp); err != nil {
+			if errors.Is(err, ErrInvalidOTP) {
+				return nil, s.recordFailure(ctx, username, err)
+			}
+			return nil, err
+		}
+	}
+
+	if err := s.redis.Del(ctx, loginFailKeyPrefix+username).Err(); err != nil {
+		s.logger.Warn("清除登录失败次数失败", "username", username, "error", err)
+	}
+	now := time.Now()
+	user.LastLoginTime = &now
+	if err := s.users.Update(ctx, user); err != nil {
+		s.logger.Warn("记录登录时间失败", "username", username, "error", err)
+	}
+
+	session, err := s.sessions.Create(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("用户登录", "username", username)
+	return session, nil
+}
+
+// Logout 注销会话
+func (s *Service) Logout(ctx context.Context, session *Session) error {
+	return s.sessions.Delete(ctx, session)
+}
+
+// CheckAPIToken 令牌是否为配置的API令牌
+func (s *Service) CheckAPIToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	matched := 0
+	for _, candidate := range s.cfg.APITokens {
+		matched |= subtle.ConstantTimeCompare([]byte(candidate), []byte(token))
+	}
+	return matched == 1
+}
+
+// ListUsers 列出所有用户
+func (s *Service) ListUsers(ctx context.Context) ([]models.AdminUser, error) {
+	return s.users.List(ctx)
+}
+
+// GetUser 查询用户
+func (s *Service) GetUser(ctx context.Context, userID string) (*models.AdminUser, error) {
+	return s.users.Get(ctx, userID)
+}
+
+// UserUpdate 修改用户的字段，为nil的字段不修改
+type UserUpdate struct {
+	Role         *string `json:"role"`
+	Enabled      *bool   `json:"enabled"`
+	AdvertiserID *string `json:"advertiser_id"`
+}
+
+// CreateUser 创建启用状态的用户，广告主用户必须指定所属的广告主
+func (s *Service) CreateUser(ctx context.Context, username, password, role, advertiserID string) (*models.AdminUser, error) {
+	if !usernamePattern.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if err := validateRole(role, advertiserID); err != nil {
+		return nil, err
+	}
+	hash, err := HashPassword(password, s.cfg.BcryptCost)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	user := &models.AdminUser{
+		ID:           id.New(),
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		AdvertiserID: advertiserID,
+		Enabled:      true,
+		UpdateTime:   now,
+		CreateTime:   now,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	s.logger.Info("创建管理后台用户", "username", username, "role", role, "advertiser_id", advertiserID)
+	return user, nil
+}
+
+// UpdateUser 修改用户的角色、所属广告主和启用状态，有变更时注销该用户的所有会话
+func (s *Service) UpdateUser(ctx context.Context, userID string, update UserUpdate) (*models.AdminUser, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	role, advertiserID := user.Role, user.AdvertiserID
+	if update.Role != nil {
+		role = *update.Role
+	}
+	if update.AdvertiserID != nil {
+		advertiserID = *update.AdvertiserID
+	}
+	changed := role != user.Role || advertiserID != user.AdvertiserID
+	if changed {
+		if err := validateRole(role, advertiserID); err != nil {
+			return nil, err
+		}
+		user.Role, user.AdvertiserID = role, advertiserID
+	}
+	if update.Enabled != nil && *update.Enabled != user.Enabled {
+		user.Enabled = *update.Enabled
+		changed = true
+	}
+	if !changed {
+		return user, nil
+	}
+	user.UpdateTime = time.Now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, s.sessions.RevokeUser(ctx, userID)
+}
+
+// SetPassword 重置用户密码并注销该用户的所有会话
+func (s *Service) SetPassword(ctx context.Context, userID, password string) error {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	hash, err := HashPassword(password, s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	user.UpdateTime = time.Now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUser(ctx, userID)
+}
+
+// ChangePassword 用户修改自己的密码，校验原密码后注销所有会话，并返回新的会话
+func (s *Service) ChangePassword(ctx context.Context, userID, current, password string) (*Session, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CheckPassword(user.PasswordHash, current) {
+		return nil, ErrInvalidCredentials
+	}
+	if err := s.SetPassword(ctx, userID, password); err != nil {
+		return nil, err
+	}
+	return s.sessions.Create(ctx, user)
+}
+
+// DeleteUser 删除用户并注销该用户的所有会话
+func (s *Service) DeleteUser(ctx context.Context, userID string) error {
+	if err := s.users.Delete(ctx, userID); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUser(ctx, userID)
+}
+
+// EnrollTOTP 为用户生成新的动态口令密钥，确认前不生效，返回密钥和供扫码的地址
+func (s *Service) EnrollTOTP(ctx context.Context, userID string) (string, string, error) {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", ErrTOTPEnabled
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	user.TOTPSecret = secret
+	user.UpdateTime = time.Now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(s.cfg.TOTPIssuer, user.Username, secret), nil
+}
+
+// ConfirmTOTP 校验新密钥生成的口令，通过后启用动态口令
+func (s *Service) ConfirmTOTP(ctx context.Context, userID, code string) error {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return ErrTOTPEnabled
+	}
+	if user.TOTPSecret == "" {
+		return ErrTOTPNotEnrolled
+	}
+	if err := s.verifyOTP(ctx, user, code); err != nil {
+		return err
+	}
+	user.TOTPEnabled = true
+	user.UpdateTime = time.Now()
+	return s.users.Update(ctx, user)
+}
+
+// DisableTOTP 停用用户的动态口令并注销该用户的所有会话，用于用户丢失设备后重新绑定
+func (s *Service) DisableTOTP(ctx context.Context, userID string) error {
+	user, err := s.users.Get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.TOTPSecret = ""
+	user.TOTPEnabled = false
+	user.UpdateTime = time.Now()
+	if err := s.users.Update(ctx, user); err != nil {
+		return err
+	}
+	return s.sessions.RevokeUser(ctx, userID)
+}
+
+// checkLockout 连续登录失败次数达到上限时返回ErrTooManyAttempts
+func (s *Service) checkLockout(ctx context.Context, username string) error {
+	failures, err := s.redis.Get(ctx, loginFailKeyPrefix+username).Int()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("读取登录失败次数失败: %w", err)
+	}
+	if failures >= s.cfg.MaxLoginAttempts {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// recordFailure 累加登录失败次数，锁定时间从第一次失败开始计算，返回原始错误
+func (s *Service) recordFailure(ctx context.Context, username string, cause error) error {
+	key := loginFailKeyPrefix + username
+	failures, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		s.logger.Warn("记录登录失败次数失败", "username", username, "error", err)
+		return cause
+	}
+	if failures == 1 {
+		if err := s.redis.PExpire(ctx, key, s.cfg.LockoutDuration).Err(); err != nil {
+			s.logger.Warn("设置登录锁定时间失败", "username", username, "error", err)
+		}
+	}
+	if failures >= int64(s.cfg.MaxLoginAttempts) {
+		s.logger.Warn("登录失败次数过多，锁定用户", "username", username, "failures", failures)
+	}
+	return cause
+}
+
+// verifyOTP 校验动态口令，同一口令在有效窗口内只能使用一次
+func (s *Service) verifyOTP(ctx context.Context, user *models.AdminUser, code string) error {
+	ok, err := s.factor.Verify(ctx, user, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidOTP
+	}
+	fresh, err := s.redis.SetNX(ctx, otpUsedKeyPrefix+user.ID+":"+code, 1, otpUsedTTL).Result()
+	if err != nil {
+		return fmt.Errorf("记录已使用的动态口令失败: %w", err)
+	}
+	if !fresh {
+		return ErrInvalidOTP
+	}
+	return nil
+}
+
+// validateRole 校验角色，广告主用户必须指定广告主，其他角色不能指定
+func validateRole(role, advertiserID string) error {
+	switch role {
+	case RoleAdmin, RoleOperator:
+		if advertiserID != "" {
+			return ErrInvalidAdvertiser
+		}
+	case RoleAdvertiser:
+		if advertiserID == "" {
+			return ErrInvalidAdvertiser
+		}
+	default:
+		return ErrInvalidRole
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import "errors"
+
+var (
+	// ErrInvalidCredentials 用户名或密码错误，用户不存在或已停用时同样返回，避免泄露用户是否存在
+	ErrInvalidCredentials = errors.New("用户名或密码错误")
+
+	// ErrTooManyAttempts 连续登录失败次数达到上限，暂时锁定
+	ErrTooManyAttempts = errors.New("登录失败次数过多，请稍后重试")
+
+	// ErrOTPRequired 用户已启用动态口令，登录时未提供
+	ErrOTPRequired = errors.New("需要动态口令")
+
+	// ErrInvalidOTP 动态口令错误或已使用过
+	ErrInvalidOTP = errors.New("动态口令错误")
+
+	// ErrTOTPNotEnrolled 确认动态口令前未生成密钥
+	ErrTOTPNotEnrolled = errors.New("未生成动态口令密钥")
+
+	// ErrTOTPEnabled 动态口令已启用，重新绑定前需要由管理员停用
+	ErrTOTPEnabled = errors.New("动态口令已启用")
+
+	// ErrUnauthenticated 未登录、会话已过期或令牌无效
+	ErrUnauthenticated = errors.New("未登录或会话已过期")
+
+	// ErrCSRFMismatch 会话认证的写请求缺少或携带了错误的CSRF令牌
+	ErrCSRFMismatch = errors.New("CSRF令牌无效")
+
+	// ErrForbidden 角色没有权限
+	ErrForbidden = errors.New("权限不足")
+
+	// ErrUserRequired 接口只能由登录的用户调用，API令牌不能调用
+	ErrUserRequired = errors.New("需要以用户身份登录")
+
+	// ErrUserNotFound 用户不存在
+	ErrUserNotFound = errors.New("用户不存在")
+
+	// ErrUsernameTaken 用户名已存在
+	ErrUsernameTaken = errors.New("用户名已存在")
+
+	// ErrInvalidUsername 用户名格式无效
+	ErrInvalidUsername = errors.New("用户名只能包含字母、数字、下划线、点和短横线，长度为3到64")
+
+	// ErrWeakPassword 密码过短或过长
+	ErrWeakPassword = errors.New("密码长度必须为12到72个字节")
+
+	// ErrInvalidRole 不支持的角色
+	ErrInvalidRole = errors.New("无效的角色，必须是admin、operator或advertiser")
+
+	// ErrInvalidAdvertiser 广告主用户未指定广告主，或其他角色指定了广告主
+	ErrInvalidAdvertiser = errors.New("广告主用户必须指定advertiser_id，其他角色不能指定")
+
+	// ErrAdvertiserRequired 管理员和运营人员访问广告主接口时未指定广告主
+	ErrAdvertiserRequired = errors.New("必须指定advertiser_id")
+)
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionCookie 会话令牌Cookie，HttpOnly，页面脚本无法读取
+	SessionCookie = "dsp_session"
+	// CSRFCookie CSRF令牌Cookie，页面脚本读取后放入CSRFHeader
+	CSRFCookie = "dsp_csrf"
+	// CSRFHeader 会话认证的写请求必须携带的CSRF令牌请求头
+	CSRFHeader = "X-CSRF-Token"
+	// LoginPath 登录接口，不需要认证
+	LoginPath = "/api/v1/auth/login"
+	// AuthPrefix 登录、注销和账号设置接口的路径前缀
+	AuthPrefix = "/api/v1/auth/"
+	// PortalPrefix 广告主自助接口的路径前缀，广告主用户只能访问该前缀和AuthPrefix下的接口
+	PortalPrefix = "/api/v1/portal/"
+	// AdvertiserParam 管理员和运营人员访问自助接口时指定广告主的查询参数
+	AdvertiserParam = "advertiser_id"
+
+	// principalKey 已认证调用方在gin上下文中的键
+	principalKey = "auth.principal"
+	// sessionKey 当前会话在gin上下文中的键
+	sessionKey = "auth.session"
+	// tenantKey 自助接口访问的广告主在gin上下文中的键
+	tenantKey = "auth.tenant"
+)
+
+// Middleware 返回认证中间件，登录接口除外的所有请求需要携带API令牌或会话Cookie
+// 会话认证的写请求还需要携带与会话一致的CSRF令牌，广告主用户访问自助接口以外的接口返回403
+func (s *Service) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == LoginPath {
+			c.Next()
+			return
+		}
+
+		if header := c.GetHeader("Authorization"); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || !s.CheckAPIToken(token) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+				return
+			}
+			c.Set(principalKey, &Principal{Username: "api-token", Role: RoleAdmin, Method: MethodToken})
+			c.Next()
+			return
+		}
+
+		cookie, err := c.Cookie(SessionCookie)
+		if err != nil || cookie == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+			return
+		}
+		session, err := s.sessions.Get(c.Request.Context(), cookie)
+		if errors.Is(err, ErrUnauthenticated) {
+			s.ClearSessionCookies(c)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			s.logger.Error("读取会话失败", "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !safeMethod(c.Request.Method) &&
+			subtle.ConstantTimeCompare([]byte(c.GetHeader(CSRFHeader)), []byte(session.CSRFToken)) != 1 {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrCSRFMismatch.Error()})
+			return
+		}
+		// 广告主用户默认拒绝，新增的管理接口无需逐个声明
+		if session.Role == RoleAdvertiser && !advertiserPath(c.FullPath()) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrForbidden.Error()})
+			return
+		}
+
+		c.Set(sessionKey, session)
+		c.Set(principalKey, &Principal{
+			UserID:       session.UserID,
+			Username:     session.Username,
+			Role:         session.Role,
+			AdvertiserID: session.AdvertiserID,
+			Method:       MethodSession,
+		})
+		c.Next()
+	}
+}
+
+// RequireRole 返回要求指定角色的中间件，需要在Middleware之后使用
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+			return
+		}
+		if principal.Role != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrForbidden.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Tenancy 返回自助接口的租户中间件，需要在Middleware之后使用
+// 广告主用户固定访问所属的广告主，指定其他广告主时返回403；管理员和运营人员必须通过advertiser_id指定广告主
+func Tenancy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := PrincipalFrom(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrUnauthenticated.Error()})
+			return
+		}
+		requested := c.Query(AdvertiserParam)
+		tenant := principal.AdvertiserID
+		switch {
+		case principal.Role == RoleAdvertiser:
+			if tenant == "" || (requested != "" && requested != tenant) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrForbidden.Error()})
+				return
+			}
+		case requested == "":
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": ErrAdvertiserRequired.Error()})
+			return
+		default:
+			tenant = requested
+		}
+		c.Set(tenantKey, tenant)
+		c.Next()
+	}
+}
+
+// TenantFrom 返回自助接口访问的广告主，未经过Tenancy时返回空字符串
+func TenantFrom(c *gin.Context) string {
+	return c.GetString(tenantKey)
+}
+
+// PrincipalFrom 返回请求的已认证调用方
+func PrincipalFrom(c *gin.Context) (*Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*Principal)
+	return principal, ok
+}
+
+// SessionFrom 返回请求的会话，API令牌认证时不存在
+func SessionFrom(c *gin.Context) (*Session, bool) {
+	value, ok := c.Get(sessionKey)
+	if !ok {
+		return nil, false
+	}
+	session, ok := value.(*Session)
+	return session, ok
+}
+
+// SetSessionCookies 写入会话和CSRF令牌Cookie
+func (s *Service) SetSessionCookies(c *gin.Context, session *Session) {
+	maxAge := int(s.cfg.SessionMaxAge.Seconds())
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    session.Token,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   s.cfg.CookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    session.CSRFToken,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   s.cfg.CookieSecure,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearSessionCookies 清除会话和CSRF令牌Cookie
+func (s *Service) ClearSessionCookies(c *gin.Context) {
+	for _, name := range []string{SessionCookie, CSRFCookie} {
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   s.cfg.CookieSecure,
+			HttpOnly: name == SessionCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// advertiserPath 广告主用户是否可以访问该路由
+func advertiserPath(route string) bool {
+	return strings.HasPrefix(route, PortalPrefix) || strings.HasPrefix(route, AuthPrefix)
+}
+
+// safeMethod 是否为不修改数据的请求方法
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// minPasswordLength 密码的最小字节数
+	minPasswordLength = 12
+	// maxPasswordLength bcrypt只使用前72个字节，更长的密码直接拒绝，避免误以为后半部分有效
+	maxPasswordLength = 72
+)
+
+// dummyHash 用户不存在时用于比较的哈希，使响应时间与用户存在时一致
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("simple-dsp-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword 使用bcrypt计算密码哈希，代价为0时使用默认值
+func HashPassword(password string, cost int) (string, error) {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return "", ErrWeakPassword
+	}
+	if cost == 0 {
+		cost = bcrypt.DefaultCost
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if err != nil {
+		return "", fmt.Errorf("计算密码哈希失败: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword 密码是否与哈希一致，哈希为空时与虚拟哈希比较并返回false
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
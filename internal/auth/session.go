@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/models"
+)
+
+const (
+	// sessionKeyPrefix 会话键前缀，键名使用令牌的SHA-256，Redis中不保存可直接使用的令牌
+	sessionKeyPrefix = "admin:session:"
+	// userSessionsKeyPrefix 用户的会话集合键前缀，用于停用用户或修改密码时注销所有会话
+	userSessionsKeyPrefix = "admin:user:sessions:"
+)
+
+// Session 登录会话
+type Session struct {
+	// Token 会话令牌，只在创建时返回，保存在HttpOnly Cookie中
+	Token    string `json:"-"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	// AdvertiserID 广告主用户所属的广告主
+	AdvertiserID string    `json:"advertiser_id,omitempty"`
+	CSRFToken    string    `json:"csrf_token"`
+	CreateTime   time.Time `json:"create_time"`
+	// ExpireTime 从登录起的最长有效期，无操作超过空闲时间时提前过期
+	ExpireTime time.Time `json:"expire_time"`
+}
+
+// SessionStore 基于Redis的会话存储
+type SessionStore struct {
+	redis       redis.Cmdable
+	idleTimeout time.Duration
+	maxAge      time.Duration
+}
+
+// NewSessionStore 创建会话存储
+func NewSessionStore(rdb redis.Cmdable, idleTimeout, maxAge time.Duration) *SessionStore {
+	return &SessionStore{redis: rdb, idleTimeout: idleTimeout, maxAge: maxAge}
+}
+
+// Create 为用户创建会话
+func (s *SessionStore) Create(ctx context.Context, user *models.AdminUser) (*Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrf, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{
+		Token:        token,
+		UserID:       user.ID,
+		Username:     user.Username,
+		Role:         user.Role,
+		AdvertiserID: user.AdvertiserID,
+		CSRFToken:    csrf,
+		CreateTime:   now,
+		ExpireTime:   now.Add(s.maxAge),
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("序列化会话失败: %w", err)
+	}
+
+	hash := hashToken(token)
+	_, err = s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, sessionKeyPrefix+hash, data, min(s.idleTimeout, s.maxAge))
+		pipe.SAdd(ctx, userSessionsKeyPrefix+user.ID, hash)
+		pipe.PExpire(ctx, userSessionsKeyPrefix+user.ID, s.maxAge)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存会话失败: %w", err)
+	}
+	return session, nil
+}
+
+// Get 读取会话并顺延空闲过期时间，会话不存在或已过期时返回ErrUnauthenticated
+func (s *SessionStore) Get(ctx context.Context, token string) (*Session, error) {
+	key := sessionKeyPrefix + hashToken(token)
+	data, err := s.redis.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrUnauthenticated
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取会话失败: %w", err)
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("解析会话失败: %w", err)
+	}
+	session.Token = token
+
+	remaining := time.Until(session.ExpireTime)
+	if remaining <= 0 {
+		return nil, ErrUnauthenticated
+	}
+	if err := s.redis.PExpire(ctx, key, min(s.idleTimeout, remaining)).Err(); err != nil {
+		return nil, fmt.Errorf("顺延会话失败: %w", err)
+	}
+	return &session, nil
+}
+
+// Delete 删除会话
+func (s *SessionStore) Delete(ctx context.Context, session *Session) error {
+	hash := hashToken(session.Token)
+	_, err := s.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKeyPrefix+hash)
+		pipe.SRem(ctx, userSessionsKeyPrefix+session.UserID, hash)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("删除会话失败: %w", err)
+	}
+	return nil
+}
+
+// RevokeUser 删除用户的所有会话
+func (s *SessionStore) RevokeUser(ctx context.Context, userID string) error {
+	hashes, err := s.redis.SMembers(ctx, userSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return fmt.Errorf("读取用户会话失败: %w", err)
+	}
+	keys := make([]string, 0, len(hashes)+1)
+	for _, hash := range hashes {
+		keys = append(keys, sessionKeyPrefix+hash)
+	}
+	keys = append(keys, userSessionsKeyPrefix+userID)
+	if err := s.redis.Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("删除用户会话失败: %w", err)
+	}
+	return nil
+}
+
+// randomToken 生成256位随机令牌
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机令牌失败: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken 返回令牌的SHA-256
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// UserStore 管理后台用户存储
+type UserStore interface {
+	// Get 按ID查询用户，不存在时返回ErrUserNotFound
+	Get(ctx context.Context, id string) (*models.AdminUser, error)
+	// GetByUsername 按用户名查询用户，不存在时返回ErrUserNotFound
+	GetByUsername(ctx context.Context, username string) (*models.AdminUser, error)
+	// List 列出所有用户
+	List(ctx context.Context) ([]models.AdminUser, error)
+	// Create 创建用户，用户名已存在时返回ErrUsernameTaken
+	Create(ctx context.Context, user *models.AdminUser) error
+	// Update 保存用户
+	Update(ctx context.Context, user *models.AdminUser) error
+	// Delete 删除用户，不存在时返回ErrUserNotFound
+	Delete(ctx context.Context, id string) error
+}
+
+// GormStore 基于数据库的用户存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于数据库的用户存储
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Get 按ID查询用户
+func (s *GormStore) Get(ctx context.Context, id string) (*models.AdminUser, error) {
+	var user models.AdminUser
+	err := s.db.WithContext(database.WithQueryName(ctx, "auth.get_user")).Where("id = ?", id).First(&user).Error
+	return s.found(&user, err)
+}
+
+// GetByUsername 按用户名查询用户
+func (s *GormStore) GetByUsername(ctx context.Context, username string) (*models.AdminUser, error) {
+	var user models.AdminUser
+	err := s.db.WithContext(database.WithQueryName(ctx, "auth.get_user_by_username")).Where("username = ?", username).First(&user).Error
+	return s.found(&user, err)
+}
+
+// List 按用户名列出所有用户
+func (s *GormStore) List(ctx context.Context) ([]models.AdminUser, error) {
+	var users []models.AdminUser
+	if err := s.db.WithContext(database.WithQueryName(ctx, "auth.list_users")).Order("username").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return users, nil
+}
+
+// Create 创建用户
+func (s *GormStore) Create(ctx context.Context, user *models.AdminUser) error {
+	err := s.db.WithContext(database.WithQueryName(ctx, "auth.create_user")).Create(user).Error
+	if err != nil {
+		// 用户名唯一索引冲突
+		if strings.Contains(err.Error(), "idx_admin_users_username") {
+			return ErrUsernameTaken
+		}
+		return fmt.Errorf("创建用户失败: %w", err)
+	}
+	return nil
+}
+
+// Update 保存用户
+func (s *GormStore) Update(ctx context.Context, user *models.AdminUser) error {
+	if err := s.db.WithContext(database.WithQueryName(ctx, "auth.update_user")).Save(user).Error; err != nil {
+		return fmt.Errorf("保存用户失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除用户
+func (s *GormStore) Delete(ctx context.Context, id string) error {
+	result := s.db.WithContext(database.WithQueryName(ctx, "auth.delete_user")).Where("id = ?", id).Delete(&models.AdminUser{})
+	if result.Error != nil {
+		return fmt.Errorf("删除用户失败: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// found 将记录不存在转换为ErrUserNotFound
+func (s *GormStore) found(user *models.AdminUser, err error) (*models.AdminUser, error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询用户失败: %w", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,404 @@
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/audit"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultInterval              = 15 * time.Minute
+	defaultCooldown              = time.Hour
+	defaultMinBidPrice           = 0.01
+	defaultMaxChangePercent      = 20
+	defaultMaxDailyChangePercent = 50
+	evaluateTimeout              = 5 * time.Minute
+
+	// evaluateLockName 定时评估的分布式锁
+	evaluateLockName = "automation:evaluate"
+
+	// changeAction 审计日志和策略变更通知中的动作
+	changeAction = "automation"
+	// operatorPrefix 审计日志的操作人前缀，后接规则ID
+	operatorPrefix = "automation:"
+)
+
+// 操作状态
+const (
+	// StatusApplied 已修改出价策略
+	StatusApplied = "applied"
+	// StatusDryRun 试运行，未修改出价策略
+	StatusDryRun = "dry_run"
+	// StatusBlocked 被护栏阻止，如出价已锁定或已达到调价上限
+	StatusBlocked = "blocked"
+	// StatusFailed 修改出价策略失败
+	StatusFailed = "failed"
+)
+
+// StatsSource 按时间窗口汇总的广告统计
+type StatsSource interface {
+	LoadWindow(ctx context.Context, adID string, from, to time.Time) (*stats.WindowStats, error)
+}
+
+// Engine 自动化规则引擎，定时评估已启用的规则并执行操作
+// 护栏：单次调价幅度不超过MaxChangePercent，出价相对当天首次自动调价前的偏离不超过MaxDailyChangePercent，
+// 出价保持在[MinBidPrice, MaxBidPrice]内，出价已锁定的策略不调价，同一规则对同一策略的操作间隔不小于冷却时间
+type Engine struct {
+	cfg        config.AutomationConfig
+	store      Store
+	strategies bidding.Repository
+	stats      StatsSource
+	redis      *redis.Client
+	recorder   *audit.Recorder
+	locker     *lock.Locker
+	logger     *logger.Logger
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewEngine 创建规则引擎，未设置的护栏使用默认值
+// redisClient为nil时不发布策略变更通知
+func NewEngine(cfg config.AutomationConfig, store Store, strategies bidding.Repository, statsSource StatsSource, redisClient *redis.Client, logger *logger.Logger) *Engine {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.DefaultCooldown <= 0 {
+		cfg.DefaultCooldown = defaultCooldown
+	}
+	if cfg.MaxChangePercent <= 0 {
+		cfg.MaxChangePercent = defaultMaxChangePercent
+	}
+	if cfg.MaxDailyChangePercent <= 0 {
+		cfg.MaxDailyChangePercent = defaultMaxDailyChangePercent
+	}
+	if cfg.MinBidPrice <= 0 {
+		cfg.MinBidPrice = defaultMinBidPrice
+	}
+	return &Engine{
+		cfg:        cfg,
+		store:      store,
+		strategies: strategies,
+		stats:      statsSource,
+		redis:      redisClient,
+		logger:     logger,
+	}
+}
+
+// SetAuditRecorder 设置审计日志，设置后修改出价策略时写入审计记录
+func (e *Engine) SetAuditRecorder(recorder *audit.Recorder) {
+	e.recorder = recorder
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时评估
+func (e *Engine) SetLocker(locker *lock.Locker) {
+	e.locker = locker
+}
+
+// MaxChangePercent 返回单次调价幅度的护栏，用于校验规则
+func (e *Engine) MaxChangePercent() float64 {
+	return e.cfg.MaxChangePercent
+}
+
+// Start 启动定时评估
+func (e *Engine) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancelFunc = cancel
+
+	e.wg.Add(1)
+	go e.runLoop(ctx)
+}
+
+// Stop 停止定时评估
+func (e *Engine) Stop() {
+	if e.cancelFunc == nil {
+		return
+	}
+	e.cancelFunc()
+	e.wg.Wait()
+}
+
+// RunOnce 评估所有已启用的规则，返回规则触发产生的操作记录
+func (e *Engine) RunOnce(ctx context.Context) ([]models.AutomationAction, error) {
+	rules, err := e.store.ListEnabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var actions []models.AutomationAction
+	for _, rule := range rules {
+		actions = append(actions, e.evaluate(ctx, rule, false)...)
+	}
+
+	// 整轮只通知一次，避免竞价节点反复全量刷新
+	if e.redis != nil && hasApplied(actions) {
+		if err := bidding.PublishStrategyChange(ctx, e.redis, "", changeAction); err != nil {
+			e.logger.Warn("发布策略变更通知失败", "error", err)
+		}
+	}
+	return actions, nil
+}
+
+// Preview 按当前数据评估规则，返回将要执行的操作，不修改出价策略也不写入记录
+// 规则未启用时同样评估，用于创建规则前确认效果
+func (e *Engine) Preview(ctx context.Context, rule *Rule) []models.AutomationAction {
+	return e.evaluate(ctx, rule, true)
+}
+
+// evaluate 对规则作用的每个出价策略评估一次
+func (e *Engine) evaluate(ctx context.Context, rule *Rule, preview bool) []models.AutomationAction {
+	var actions []models.AutomationAction
+	for _, strategyID := range rule.StrategyIDs {
+		action, err := e.evaluateStrategy(ctx, rule, strategyID, time.Now(), preview)
+		if err != nil {
+			e.logger.Error("评估自动化规则失败", "rule_id", rule.ID, "strategy_id", strategyID, "error", err)
+			continue
+		}
+		if action == nil {
+			continue
+		}
+		if !preview {
+			if err := e.store.RecordAction(ctx, action); err != nil {
+				e.logger.Error("写入自动化操作记录失败", "rule_id", rule.ID, "strategy_id", strategyID, "error", err)
+			}
+		}
+		actions = append(actions, *action)
+	}
+	return actions
+}
+
+// evaluateStrategy 评估规则对单个出价策略是否触发，未触发时返回nil
+func (e *Engine) evaluateStrategy(ctx context.Context, rule *Rule, strategyID string, now time.Time, preview bool) (*models.AutomationAction, error) {
+	id, err := strconv.ParseInt(strategyID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("无效的出价策略ID: %s", strategyID)
+	}
+	strategy, err := e.strategies.GetBidStrategy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	// 已暂停或归档的策略不再评估
+	if strategy == nil || strategy.Status != bidding.StrategyStatusEnabled {
+		return nil, nil
+	}
+
+	cooldown := e.cfg.DefaultCooldown
+	if rule.CooldownMinutes > 0 {
+		cooldown = time.Duration(rule.CooldownMinutes) * time.Minute
+	}
+	dayStart := startOfDay(now)
+	since := dayStart
+	if now.Add(-cooldown).Before(since) {
+		since = now.Add(-cooldown)
+	}
+	history, err := e.store.ListActions(ctx, strategyID, since)
+	if err != nil {
+		return nil, err
+	}
+	if inCooldown(history, rule.ID, now.Add(-cooldown)) {
+		return nil, nil
+	}
+
+	from := now.Add(-time.Duration(rule.WindowHours-1) * time.Hour)
+	window, err := e.stats.LoadWindow(ctx, strategyID, from, now)
+	if err != nil {
+		return nil, err
+	}
+	if window.Impressions < rule.MinImpressions {
+		return nil, nil
+	}
+	matched, values := rule.Evaluate(window)
+	if !matched {
+		return nil, nil
+	}
+
+	metrics, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	action := &models.AutomationAction{
+		RuleID:      rule.ID,
+		StrategyID:  strategyID,
+		Action:      rule.Action.Type,
+		Metrics:     metrics,
+		BeforePrice: strategy.Price,
+		AfterPrice:  strategy.Price,
+		CreateTime:  now,
+	}
+
+	if rule.Action.Type != ActionPause {
+		if strategy.IsPriceLocked {
+			action.Status = StatusBlocked
+			action.Reason = "出价已锁定"
+			return action, nil
+		}
+		action.AfterPrice = e.nextPrice(rule.Action, strategy.Price, dailyBase(history, dayStart))
+		if action.AfterPrice == strategy.Price {
+			action.Status = StatusBlocked
+			action.Reason = "已达到调价护栏"
+			return action, nil
+		}
+	}
+
+	if preview || rule.DryRun {
+		action.Status = StatusDryRun
+		return action, nil
+	}
+
+	if err := e.apply(ctx, rule, id, strategy, action); err != nil {
+		action.Status = StatusFailed
+		action.Reason = err.Error()
+		return action, nil
+	}
+	action.Status = StatusApplied
+	return action, nil
+}
+
+// nextPrice 计算调价后的出价，结果受单次幅度、当天偏离和出价范围限制，且不会反向调整
+// base为当天首次自动调价前的出价，当天没有自动调价时为0
+func (e *Engine) nextPrice(action Action, current, base float64) float64 {
+	percent := math.Min(action.Percent, e.cfg.MaxChangePercent) / 100
+	increase := action.Type == ActionIncreaseBid
+
+	next := current * (1 - percent)
+	if increase {
+		next = current * (1 + percent)
+	}
+
+	if base <= 0 {
+		base = current
+	}
+	daily := e.cfg.MaxDailyChangePercent / 100
+	next = math.Min(math.Max(next, base*(1-daily)), base*(1+daily))
+
+	next = math.Max(next, e.cfg.MinBidPrice)
+	if e.cfg.MaxBidPrice > 0 {
+		next = math.Min(next, e.cfg.MaxBidPrice)
+	}
+
+	// 出价与bid_strategies.price一致保留4位小数
+	next = math.Round(next*10000) / 10000
+	if increase {
+		return math.Max(next, current)
+	}
+	return math.Min(next, current)
+}
+
+// apply 修改出价策略并写入审计日志
+func (e *Engine) apply(ctx context.Context, rule *Rule, id int64, strategy *bidding.BidStrategy, action *models.AutomationAction) error {
+	before := map[string]interface{}{"status": strategy.Status, "price": strategy.Price}
+
+	switch rule.Action.Type {
+	case ActionPause:
+		if err := e.strategies.UpdateBidStrategyStatus(ctx, id, bidding.StrategyStatusDisabled); err != nil {
+			return err
+		}
+		strategy.Status = bidding.StrategyStatusDisabled
+	default:
+		strategy.Price = action.AfterPrice
+		if err := e.strategies.UpdateBidStrategy(ctx, strategy); err != nil {
+			return err
+		}
+	}
+
+	e.logger.Info("自动化规则修改出价策略",
+		"rule_id", rule.ID,
+		"strategy_id", strategy.ID,
+		"action", rule.Action.Type,
+		"before_price", action.BeforePrice,
+		"after_price", action.AfterPrice)
+
+	// 变更已生效，审计日志写入失败不影响结果
+	if e.recorder != nil {
+		err := e.recorder.Record(ctx, audit.Entry{
+			Operator:     operatorPrefix + rule.ID,
+			Action:       changeAction,
+			ResourceType: audit.ResourceStrategy,
+			ResourceID:   strategy.ID,
+			Before:       before,
+			After:        map[string]interface{}{"status": strategy.Status, "price": strategy.Price},
+		})
+		if err != nil {
+			e.logger.Error("写入审计日志失败", "rule_id", rule.ID, "strategy_id", strategy.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// runLoop 定时评估规则
+func (e *Engine) runLoop(ctx context.Context) {
+	defer e.wg.Done()
+
+	ticker := time.NewTicker(e.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, evaluateTimeout)
+			err := e.locker.Do(runCtx, evaluateLockName, func(ctx context.Context) error {
+				_, err := e.RunOnce(ctx)
+				return err
+			})
+			if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+				e.logger.Error("评估自动化规则失败", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// inCooldown 判断规则在since之后是否已对策略触发过，试运行和被护栏阻止的记录同样计入，失败的操作下次重试
+func inCooldown(history []models.AutomationAction, ruleID string, since time.Time) bool {
+	for i := range history {
+		h := &history[i]
+		if h.RuleID == ruleID && h.CreateTime.After(since) && h.Status != StatusFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// dailyBase 返回当天首次自动调价前的出价，当天没有自动调价时返回0
+func dailyBase(history []models.AutomationAction, dayStart time.Time) float64 {
+	for i := range history {
+		h := &history[i]
+		if h.Status == StatusApplied && h.Action != ActionPause && !h.CreateTime.Before(dayStart) {
+			return h.BeforePrice
+		}
+	}
+	return 0
+}
+
+// hasApplied 判断是否有已生效的操作
+func hasApplied(actions []models.AutomationAction) bool {
+	for i := range actions {
+		if actions[i].Status == StatusApplied {
+			return true
+		}
+	}
+	return false
+}
+
+// startOfDay 返回当天零点
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
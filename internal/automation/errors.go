@@ -0,0 +1,35 @@
+package automation
+
+import "errors"
+
+var (
+	// ErrNameRequired 表示规则名称为空
+	ErrNameRequired = errors.New("规则名称不能为空")
+
+	// ErrNoStrategies 表示未指定规则作用的出价策略
+	ErrNoStrategies = errors.New("至少需要指定一个出价策略")
+
+	// ErrNoConditions 表示未指定触发条件
+	ErrNoConditions = errors.New("至少需要一个触发条件")
+
+	// ErrUnknownMetric 表示不支持的指标
+	ErrUnknownMetric = errors.New("不支持的指标")
+
+	// ErrUnknownOperator 表示不支持的比较方式
+	ErrUnknownOperator = errors.New("不支持的比较方式")
+
+	// ErrInvalidThreshold 表示阈值无效
+	ErrInvalidThreshold = errors.New("无效的阈值")
+
+	// ErrInvalidWindow 表示统计窗口无效
+	ErrInvalidWindow = errors.New("统计窗口必须在1到168小时之间")
+
+	// ErrUnknownAction 表示不支持的操作
+	ErrUnknownAction = errors.New("不支持的操作")
+
+	// ErrInvalidPercent 表示调价幅度无效或超过护栏
+	ErrInvalidPercent = errors.New("无效的调价幅度")
+
+	// ErrInvalidCooldown 表示冷却时间无效
+	ErrInvalidCooldown = errors.New("无效的冷却时间")
+)
@@ -0,0 +1,289 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: rule.go
+ * Project: simple-dsp
+ * Description: 自动化优化规则，按统计指标自动调整出价策略的出价或暂停策略
+ *
+ * 主要功能:
+ * - 定义规则的触发条件和操作，如"3小时内CPA > 50时出价降低10%"
+ * - 按统计窗口内的汇总数据计算指标
+ * - 规则可以只试运行，记录将要执行的操作而不修改策略
+ *
+ * 实现细节:
+ * - 多个条件同时满足时触发，条件共用规则的统计窗口
+ * - 统计数据来自按小时的计数器，窗口按整点对齐
+ * - 调价幅度和出价范围受全局护栏限制，见Engine
+ *
+ * 注意事项:
+ * - 统计数据不足时不触发，避免按少量样本调整出价
+ */
+
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+)
+
+// maxWindowHours 统计窗口上限，与按小时统计的保留时间一致
+const maxWindowHours = 7 * 24
+
+// 指标
+const (
+	MetricCPA         = "cpa"
+	MetricCPC         = "cpc"
+	MetricCPM         = "cpm"
+	MetricCTR         = "ctr"
+	MetricCVR         = "cvr"
+	MetricWinRate     = "win_rate"
+	MetricCost        = "cost"
+	MetricImpressions = "impressions"
+	MetricClicks      = "clicks"
+	MetricConversions = "conversions"
+)
+
+// Metrics 规则可使用的指标
+var Metrics = []string{
+	MetricCPA, MetricCPC, MetricCPM, MetricCTR, MetricCVR, MetricWinRate,
+	MetricCost, MetricImpressions, MetricClicks, MetricConversions,
+}
+
+// 比较方式
+const (
+	OperatorGT  = "gt"
+	OperatorGTE = "gte"
+	OperatorLT  = "lt"
+	OperatorLTE = "lte"
+)
+
+// 操作
+const (
+	ActionIncreaseBid = "increase_bid"
+	ActionDecreaseBid = "decrease_bid"
+	ActionPause       = "pause"
+)
+
+// Condition 触发条件
+type Condition struct {
+	Metric    string  `json:"metric"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+}
+
+// Action 规则触发后的操作
+type Action struct {
+	Type string `json:"type"`
+	// Percent 调价幅度(%)，仅调价操作使用
+	Percent float64 `json:"percent,omitempty"`
+}
+
+// Rule 自动化优化规则
+type Rule struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	StrategyIDs []string    `json:"strategy_ids"`
+	Conditions  []Condition `json:"conditions"`
+	Action      Action      `json:"action"`
+	// WindowHours 统计窗口，取最近几个小时（含当前小时）的数据
+	WindowHours int `json:"window_hours"`
+	// MinImpressions 窗口内展示数低于该值时不触发
+	MinImpressions int64 `json:"min_impressions"`
+	// CooldownMinutes 同一策略两次操作的最小间隔，为0时使用全局默认值
+	CooldownMinutes int `json:"cooldown_minutes"`
+	// DryRun 试运行，只记录将要执行的操作
+	DryRun     bool      `json:"dry_run"`
+	Enabled    bool      `json:"enabled"`
+	CreateTime time.Time `json:"create_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// Validate 校验规则，maxChangePercent为单次调价幅度的护栏，为0时不限制
+func (r *Rule) Validate(maxChangePercent float64) error {
+	if r.Name == "" {
+		return ErrNameRequired
+	}
+	if len(r.StrategyIDs) == 0 {
+		return ErrNoStrategies
+	}
+	if len(r.Conditions) == 0 {
+		return ErrNoConditions
+	}
+	for _, cond := range r.Conditions {
+		if !isKnownMetric(cond.Metric) {
+			return fmt.Errorf("%w: %s", ErrUnknownMetric, cond.Metric)
+		}
+		switch cond.Operator {
+		case OperatorGT, OperatorGTE, OperatorLT, OperatorLTE:
+		default:
+			return fmt.Errorf("%w: %s", ErrUnknownOperator, cond.Operator)
+		}
+		if cond.Threshold < 0 || math.IsNaN(cond.Threshold) || math.IsInf(cond.Threshold, 0) {
+			return ErrInvalidThreshold
+		}
+	}
+	if r.WindowHours < 1 || r.WindowHours > maxWindowHours {
+		return ErrInvalidWindow
+	}
+	if r.MinImpressions < 0 {
+		return ErrInvalidThreshold
+	}
+	if r.CooldownMinutes < 0 {
+		return ErrInvalidCooldown
+	}
+
+	switch r.Action.Type {
+	case ActionIncreaseBid, ActionDecreaseBid:
+		if r.Action.Percent <= 0 || r.Action.Percent >= 100 || (maxChangePercent > 0 && r.Action.Percent > maxChangePercent) {
+			return fmt.Errorf("%w: %v", ErrInvalidPercent, r.Action.Percent)
+		}
+	case ActionPause:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownAction, r.Action.Type)
+	}
+	return nil
+}
+
+// Evaluate 计算各条件的指标，返回是否全部满足和计算出的指标值
+// 指标无法计算（如没有展示时的CTR）时视为不满足
+func (r *Rule) Evaluate(window *stats.WindowStats) (bool, map[string]float64) {
+	values := make(map[string]float64, len(r.Conditions))
+	matched := true
+	for _, cond := range r.Conditions {
+		value, ok := metricValue(cond.Metric, window)
+		if !ok {
+			matched = false
+			continue
+		}
+		values[cond.Metric] = value
+		if !compare(cond.Operator, value, cond.Threshold) {
+			matched = false
+		}
+	}
+	return matched, values
+}
+
+// metricValue 计算窗口内的指标
+// CPA和CPC在没有转化或点击时按1次计算，花费较多但没有转化的策略同样可以触发规则
+func metricValue(metric string, w *stats.WindowStats) (float64, bool) {
+	switch metric {
+	case MetricCPA:
+		return w.Cost / math.Max(float64(w.Conversions), 1), true
+	case MetricCPC:
+		return w.Cost / math.Max(float64(w.Clicks), 1), true
+	case MetricCPM:
+		return rate(w.Cost*1000, w.Impressions)
+	case MetricCTR:
+		return rate(float64(w.Clicks), w.Impressions)
+	case MetricCVR:
+		return rate(float64(w.Conversions), w.Clicks)
+	case MetricWinRate:
+		return rate(float64(w.Wins), w.Bids)
+	case MetricCost:
+		return w.Cost, true
+	case MetricImpressions:
+		return float64(w.Impressions), true
+	case MetricClicks:
+		return float64(w.Clicks), true
+	case MetricConversions:
+		return float64(w.Conversions), true
+	}
+	return 0, false
+}
+
+func rate(numerator float64, denominator int64) (float64, bool) {
+	if denominator == 0 {
+		return 0, false
+	}
+	return numerator / float64(denominator), true
+}
+
+func compare(operator string, value, threshold float64) bool {
+	switch operator {
+	case OperatorGT:
+		return value > threshold
+	case OperatorGTE:
+		return value >= threshold
+	case OperatorLT:
+		return value < threshold
+	case OperatorLTE:
+		return value <= threshold
+	}
+	return false
+}
+
+// isKnownMetric 判断是否为支持的指标
+func isKnownMetric(metric string) bool {
+	for _, m := range Metrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// ToModel 转换为数据库模型
+func (r *Rule) ToModel() (*models.AutomationRule, error) {
+	strategyIDs, err := json.Marshal(r.StrategyIDs)
+	if err != nil {
+		return nil, err
+	}
+	conditions, err := json.Marshal(r.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	action, err := json.Marshal(r.Action)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AutomationRule{
+		ID:              r.ID,
+		Name:            r.Name,
+		StrategyIDs:     strategyIDs,
+		Conditions:      conditions,
+		Action:          action,
+		WindowHours:     r.WindowHours,
+		MinImpressions:  r.MinImpressions,
+		CooldownMinutes: r.CooldownMinutes,
+		DryRun:          r.DryRun,
+		Enabled:         r.Enabled,
+		UpdateTime:      r.UpdateTime,
+		CreateTime:      r.CreateTime,
+	}, nil
+}
+
+// FromModel 从数据库模型转换
+func FromModel(m *models.AutomationRule) (*Rule, error) {
+	r := &Rule{
+		ID:              m.ID,
+		Name:            m.Name,
+		WindowHours:     m.WindowHours,
+		MinImpressions:  m.MinImpressions,
+		CooldownMinutes: m.CooldownMinutes,
+		DryRun:          m.DryRun,
+		Enabled:         m.Enabled,
+		UpdateTime:      m.UpdateTime,
+		CreateTime:      m.CreateTime,
+	}
+	for _, field := range []struct {
+		data models.JSON
+		dest interface{}
+	}{
+		{m.StrategyIDs, &r.StrategyIDs},
+		{m.Conditions, &r.Conditions},
+		{m.Action, &r.Action},
+	} {
+		if field.data.IsNull() {
+			continue
+		}
+		if err := json.Unmarshal(field.data, field.dest); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
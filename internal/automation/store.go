@@ -0,0 +1,71 @@
+package automation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// Store 规则和操作记录存储
+type Store interface {
+	// ListEnabled 列出已启用的规则
+	ListEnabled(ctx context.Context) ([]*Rule, error)
+	// RecordAction 写入操作记录
+	RecordAction(ctx context.Context, action *models.AutomationAction) error
+	// ListActions 查询出价策略在since之后的操作记录，按时间升序
+	ListActions(ctx context.Context, strategyID string, since time.Time) ([]models.AutomationAction, error)
+}
+
+// GormStore 基于数据库的存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于数据库的存储
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// ListEnabled 列出已启用的规则
+func (s *GormStore) ListEnabled(ctx context.Context) ([]*Rule, error) {
+	var records []models.AutomationRule
+	if err := s.db.WithContext(database.WithQueryName(ctx, "automation.list_enabled")).Where("enabled = ?", true).Order("id").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询自动化规则失败: %w", err)
+	}
+
+	rules := make([]*Rule, 0, len(records))
+	for i := range records {
+		rule, err := FromModel(&records[i])
+		if err != nil {
+			return nil, fmt.Errorf("解析自动化规则%s失败: %w", records[i].ID, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// RecordAction 写入操作记录
+func (s *GormStore) RecordAction(ctx context.Context, action *models.AutomationAction) error {
+	if err := s.db.WithContext(database.WithQueryName(ctx, "automation.record_action")).Create(action).Error; err != nil {
+		return fmt.Errorf("写入自动化操作记录失败: %w", err)
+	}
+	return nil
+}
+
+// ListActions 查询出价策略在since之后的操作记录
+func (s *GormStore) ListActions(ctx context.Context, strategyID string, since time.Time) ([]models.AutomationAction, error) {
+	var actions []models.AutomationAction
+	err := s.db.WithContext(database.WithQueryName(ctx, "automation.list_actions")).
+		Where("strategy_id = ? AND create_time >= ?", strategyID, since).
+		Order("create_time ASC").Order("id ASC").
+		Find(&actions).Error
+	if err != nil {
+		return nil, fmt.Errorf("查询自动化操作记录失败: %w", err)
+	}
+	return actions, nil
+}
@@ -0,0 +1,57 @@
+package bidding
+
+import (
+	"time"
+
+	"simple-dsp/pkg/timezone"
+)
+
+// DaypartingHours 分时投放的小时数，一周7天每天24小时
+// 第i个字符对应星期i/24（0为星期日）的第i%24小时，1为投放，0为不投放，为空时全天投放
+const DaypartingHours = 7 * 24
+
+// validDayparting 分时投放为空或由DaypartingHours个0/1组成
+func validDayparting(dayparting string) bool {
+	if dayparting == "" {
+		return true
+	}
+	if len(dayparting) != DaypartingHours {
+		return false
+	}
+	for i := 0; i < len(dayparting); i++ {
+		if dayparting[i] != '0' && dayparting[i] != '1' {
+			return false
+		}
+	}
+	return true
+}
+
+// inDaypart 策略在now时是否投放，按策略所属推广计划的时区计算星期和小时
+func inDaypart(strategy *BidStrategy, now time.Time, zones *timezone.Zones) bool {
+	if len(strategy.Dayparting) != DaypartingHours {
+		return true
+	}
+	local := now.In(zones.Campaign(strategy.CampaignID))
+	return strategy.Dayparting[int(local.Weekday())*24+local.Hour()] == '1'
+}
+
+// daypart 过滤不在投放时段的策略，没有策略被过滤时返回原切片
+func daypart(now time.Time, strategies []BidStrategy, zones *timezone.Zones) []BidStrategy {
+	var kept []BidStrategy
+	for i := range strategies {
+		if inDaypart(&strategies[i], now, zones) {
+			if kept != nil {
+				kept = append(kept, strategies[i])
+			}
+			continue
+		}
+		if kept == nil {
+			kept = make([]BidStrategy, i, len(strategies)-1)
+			copy(kept, strategies[:i])
+		}
+	}
+	if kept == nil {
+		return strategies
+	}
+	return kept
+}
@@ -16,12 +16,16 @@
  * - 实现eCPM排序和选择
  * - 集成预算和频次控制
  * - 支持实时竞价决策
+ * - 出价策略从内存缓存读取，不在热路径访问数据库
+ * - 每个请求读取一次用户特征，用于修正CTR预估，用户不同意个性化投放时不使用
+ * - 设置了分时投放的策略只在推广计划时区的投放时段参与竞价
  *
  * 依赖关系:
  * - simple-dsp/internal/budget
  * - simple-dsp/internal/frequency
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/timezone
  *
  * 注意事项:
  * - 注意竞价性能优化
@@ -36,13 +40,37 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"simple-dsp/internal/profile"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
-	"sort"
+	"simple-dsp/pkg/reqctx"
+	"simple-dsp/pkg/timezone"
+	"strconv"
 	"sync"
 	"time"
 )
 
+// 超时阶段标签
+const (
+	stageTargeting = "targeting"
+	stageAuction   = "auction"
+)
+
+// StageBudget 预算扣减阶段，耗时记录到上下文中的阶段耗时供慢请求日志使用
+const StageBudget = "budget"
+
+// 用户特征读取结果标签
+const (
+	profileHit   = "hit"
+	profileMiss  = "miss"
+	profileError = "error"
+	// profileNoConsent 用户不同意个性化投放，不使用用户特征
+	profileNoConsent = "no_consent"
+)
+
+// baseCTR 没有用户特征时的默认点击率
+const baseCTR = 0.01
+
 // Ad 广告信息
 type Ad struct {
 	ID          string    `json:"id"`
@@ -63,6 +91,61 @@ type BidCandidate struct {
 	Strategy BidStrategy
 	BidPrice float64
 	CTR      float64
+	rta      rtaResult
+}
+
+// maxPooledCandidates 超过该容量的候选切片不放回池中
+const maxPooledCandidates = 1024
+
+// maxWinnerAttempts 每个广告位最多尝试的候选数，胜出候选未通过最终检查时回退到下一个候选
+const maxWinnerAttempts = 3
+
+// releaseTimeout 归还曝光的超时时间
+const releaseTimeout = time.Second
+
+// DefaultCheckReserve 默认在截止时间前为QPS、频次和预算检查预留的时间
+const DefaultCheckReserve = 10 * time.Millisecond
+
+// 候选被淘汰的阶段和原因
+const (
+	rejectStagePrefilter = "prefilter"
+	rejectStageFinal     = "final"
+
+	rejectQPS         = "qps"
+	rejectBudget      = "budget"
+	rejectFrequency   = "frequency"
+	rejectSupplyChain = "schain"
+)
+
+// candidatePool 竞价候选切片池
+var candidatePool = sync.Pool{
+	New: func() interface{} {
+		candidates := make([]BidCandidate, 0, 64)
+		return &candidates
+	},
+}
+
+// acquireCandidates 从池中获取候选切片，容量不足时重新分配
+func acquireCandidates(size int) *[]BidCandidate {
+	candidates := candidatePool.Get().(*[]BidCandidate)
+	if cap(*candidates) < size {
+		*candidates = make([]BidCandidate, 0, size)
+	}
+	*candidates = (*candidates)[:0]
+	return candidates
+}
+
+// releaseCandidates 归还候选切片
+func releaseCandidates(candidates *[]BidCandidate) {
+	if cap(*candidates) > maxPooledCandidates {
+		return
+	}
+	// 清空引用，避免持有策略数据
+	for i := range *candidates {
+		(*candidates)[i] = BidCandidate{}
+	}
+	*candidates = (*candidates)[:0]
+	candidatePool.Put(candidates)
 }
 
 // Engine 竞价引擎
@@ -70,6 +153,20 @@ type Engine struct {
 	repository Repository
 	budgetMgr  BudgetManager
 	freqCtrl   FrequencyController
+	budgetChk  BudgetChecker      // budgetMgr实现的只读预算检查，未实现时为nil
+	freqRel    ImpressionReleaser // freqCtrl实现的曝光归还，未实现时为nil
+	strategies *StrategyCache
+	floors     FloorAdvisor
+	floorRules *FloorPolicy
+	placements PlacementAdvisor
+	profiles   UserProfiles
+	limiter    RateLimiter
+	approvals  CreativeApprovals
+	rtaPolicy  *RTABidPolicy
+	throttles  *ParticipationPolicy
+	schain     *SupplyChainPolicy
+	zones      *timezone.Zones
+	reserve    time.Duration // 候选生成在截止时间前为最终检查预留的时间
 	logger     *logger.Logger
 	metrics    *metrics.Metrics
 	mu         sync.RWMutex
@@ -86,10 +183,26 @@ type BudgetManager interface {
 	CheckAndDeduct(ctx context.Context, budgetID string, amount float64) (bool, error)
 }
 
-// FrequencyController 频率控制接口
+// BudgetChecker 不扣减预算的余额检查，BudgetManager实现该接口时在排序前过滤预算不足的策略
+type BudgetChecker interface {
+	HasBudget(budgetID string, amount float64) bool
+}
+
+// DailyBudgetSyncer 按策略日预算创建预算，BudgetManager实现该接口时每次刷新策略缓存后同步
+type DailyBudgetSyncer interface {
+	// SyncDailyBudgets 同步启用策略的日预算，budgets为策略ID到日预算的映射
+	SyncDailyBudgets(budgets map[string]float64)
+}
+
+// FrequencyController 频率控制接口，frequency.Controller的各实现均满足该接口
 type FrequencyController interface {
-	CheckImpression(ctx context.Context, userID, adID string) (bool, error)
-	RecordImpression(ctx context.Context, userID, adID string) error
+	// AcquireImpression 原子地检查曝光频次并计数，超过上限时ok为false
+	AcquireImpression(ctx context.Context, userID, adID string) (remaining int64, ok bool, err error)
+}
+
+// ImpressionReleaser 归还占用的曝光，FrequencyController实现该接口时预算扣减失败或超时后归还
+type ImpressionReleaser interface {
+	ReleaseImpression(ctx context.Context, userID, adID string) error
 }
 
 var (
@@ -111,6 +224,40 @@ func GetEngine() *Engine {
 	return globalEngine
 }
 
+// FloorAdvisor 底价情报接口
+type FloorAdvisor interface {
+	ObserveRequest(exchange string, slot AdSlot)
+	ObserveBid(exchange string, slot AdSlot, price float64)
+	// AdjustBid 调整出价，返回false表示不应参与该广告位的竞价
+	AdjustBid(exchange string, slot AdSlot, price float64) (float64, bool)
+}
+
+// PlacementAdvisor 供应路径表现接口，按(交易平台, 广告位, 尺寸)的历史表现调整出价
+type PlacementAdvisor interface {
+	// AdjustBid 返回调整后的出价，没有足够的历史数据时返回原出价
+	AdjustBid(exchange string, slot AdSlot, price float64) float64
+}
+
+// RateLimiter 竞价QPS限制接口
+type RateLimiter interface {
+	// Allow 为广告和其所属推广计划占用一次竞价，超过QPS时返回false
+	Allow(ctx context.Context, adID, campaignID string) (bool, error)
+}
+
+// CreativeApprovals 素材在交易平台的审核结果
+type CreativeApprovals interface {
+	// Required 交易平台是否要求素材审核通过
+	Required(exchange string) bool
+	// Approved 素材是否已通过交易平台的审核
+	Approved(exchange, creativeID string) bool
+}
+
+// UserProfiles 用户特征查询接口
+type UserProfiles interface {
+	// Profile 查询用户特征，用户没有特征时返回profile.ErrProfileNotFound
+	Profile(ctx context.Context, userID string) (*profile.Profile, error)
+}
+
 // NewEngine 创建新的竞价引擎
 func NewEngine(
 	repository Repository,
@@ -119,20 +266,165 @@ func NewEngine(
 	logger *logger.Logger,
 	metrics *metrics.Metrics,
 ) *Engine {
-	return &Engine{
+	e := &Engine{
 		repository: repository,
 		budgetMgr:  budgetMgr,
 		freqCtrl:   freqCtrl,
+		strategies: NewStrategyCache(repository, nil, 0, logger),
+		reserve:    DefaultCheckReserve,
 		logger:     logger,
 		metrics:    metrics,
 	}
+	e.budgetChk, _ = budgetMgr.(BudgetChecker)
+	e.freqRel, _ = freqCtrl.(ImpressionReleaser)
+	if syncer, ok := budgetMgr.(DailyBudgetSyncer); ok {
+		e.strategies.SetBudgetSyncer(syncer)
+	}
+	return e
 }
 
-// ProcessBid 处理竞价请求
+// SetStrategyCache 替换出价策略缓存，预算管理器实现DailyBudgetSyncer时同步缓存中策略的日预算
+func (e *Engine) SetStrategyCache(cache *StrategyCache) {
+	e.mu.RLock()
+	zones := e.zones
+	e.mu.RUnlock()
+	if zones != nil {
+		cache.SetTimezones(zones)
+	}
+	if syncer, ok := e.budgetMgr.(DailyBudgetSyncer); ok {
+		cache.SetBudgetSyncer(syncer)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.strategies = cache
+}
+
+// SetTimezones 设置推广计划的时区，分时投放按推广计划的时区计算，为nil时使用服务器时区
+// 策略缓存刷新后同步广告所属的推广计划，预算、频次和统计按广告查找时区
+func (e *Engine) SetTimezones(zones *timezone.Zones) {
+	e.mu.Lock()
+	e.zones = zones
+	cache := e.strategies
+	e.mu.Unlock()
+	cache.SetTimezones(zones)
+}
+
+// SetCheckReserve 设置候选生成在截止时间前为QPS、频次和预算检查预留的时间，不大于0时使用默认值
+func (e *Engine) SetCheckReserve(reserve time.Duration) {
+	if reserve <= 0 {
+		reserve = DefaultCheckReserve
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.reserve = reserve
+}
+
+// SetFloorAdvisor 设置底价情报，为nil时不调整出价
+func (e *Engine) SetFloorAdvisor(advisor FloorAdvisor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.floors = advisor
+}
+
+// SetPlacementAdvisor 设置供应路径表现，为nil时不按供应路径调整出价
+func (e *Engine) SetPlacementAdvisor(advisor PlacementAdvisor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.placements = advisor
+}
+
+// SetFloorPolicy 设置请求底价的执行方式和货币汇率，为nil时按系统货币执行请求底价
+func (e *Engine) SetFloorPolicy(policy *FloorPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.floorRules = policy
+}
+
+// SetUserProfiles 设置用户特征存储，为nil时CTR使用默认值
+func (e *Engine) SetUserProfiles(profiles UserProfiles) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.profiles = profiles
+}
+
+// SetRateLimiter 设置竞价QPS限制，为nil时不限制
+func (e *Engine) SetRateLimiter(limiter RateLimiter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.limiter = limiter
+}
+
+// SetCreativeApprovals 设置素材审核结果，要求审核的交易平台只投放有审核通过素材的策略，为nil时不限制
+func (e *Engine) SetCreativeApprovals(approvals CreativeApprovals) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.approvals = approvals
+}
+
+// SetRTABidPolicy 设置按RTA信号出价的推广计划和系数范围，为nil时忽略RTA出价信号
+func (e *Engine) SetRTABidPolicy(policy *RTABidPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rtaPolicy = policy
+}
+
+// SetParticipationPolicy 设置广告主参与率，为nil时只按策略的参与率抽样
+func (e *Engine) SetParticipationPolicy(policy *ParticipationPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.throttles = policy
+}
+
+// SetSupplyChainPolicy 设置要求已授权供应链的推广计划，为nil时不限制
+func (e *Engine) SetSupplyChainPolicy(policy *SupplyChainPolicy) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.schain = policy
+}
+
+// UserProfile 读取用户特征，没有特征或读取失败时返回nil
+// 调用方可将结果放入BidRequest.Profile，在多个请求间复用
+func (e *Engine) UserProfile(ctx context.Context, userID string) *profile.Profile {
+	e.mu.RLock()
+	profiles := e.profiles
+	e.mu.RUnlock()
+	return e.userProfile(ctx, profiles, userID)
+}
+
+// ActiveCampaigns 获取启用策略所属的推广计划，用于判断请求是否需要查询RTA
+func (e *Engine) ActiveCampaigns(ctx context.Context) ([]string, error) {
+	e.mu.RLock()
+	cache := e.strategies
+	e.mu.RUnlock()
+
+	if _, err := cache.ActiveStrategies(ctx); err != nil {
+		return nil, err
+	}
+	return cache.Campaigns(), nil
+}
+
+// ProcessBid 处理竞价请求，返回第一个有胜出广告的广告位的出价
 func (e *Engine) ProcessBid(ctx context.Context, req BidRequest) (*BidResponse, error) {
+	responses, err := e.auction(ctx, req, 1)
+	if err != nil {
+		return nil, err
+	}
+	return responses[0], nil
+}
+
+// ProcessBids 在一次竞价中为每个广告位选出胜出广告，返回各广告位的出价，没有胜出广告的广告位不在结果中
+// 各广告位独立扣减预算和占用曝光，同一策略在一个请求中只出现在一个广告位
+func (e *Engine) ProcessBids(ctx context.Context, req BidRequest) ([]*BidResponse, error) {
+	return e.auction(ctx, req, len(req.AdSlots))
+}
+
+// auction 依次为广告位选出胜出广告，得到maxResults个出价后停止
+// 已有广告位出价后超时时返回已得到的出价，已扣减的预算不会浪费
+func (e *Engine) auction(ctx context.Context, req BidRequest, maxResults int) ([]*BidResponse, error) {
 	startTime := time.Now()
 	defer func() {
-		e.metrics.Bid.Duration.Observe(time.Since(startTime).Seconds())
+		metrics.ObserveWithTrace(ctx, e.metrics.Bid.Duration, time.Since(startTime).Seconds())
 	}()
 
 	// 防御性编程：空请求检查
@@ -140,124 +432,455 @@ func (e *Engine) ProcessBid(ctx context.Context, req BidRequest) (*BidResponse,
 		return nil, ErrInvalidBidRequest
 	}
 
-	// 获取出价策略列表
-	strategies, _, err := e.repository.ListBidStrategies(ctx, BidStrategyFilter{
-		Page:     1,
-		PageSize: 100,
-	})
+	// 从缓存获取启用的出价策略
+	e.mu.RLock()
+	cache, floors, floorRules, placements, profiles, limiter, approvals, rtaPolicy, throttles, schain, zones, reserve := e.strategies, e.floors, e.floorRules, e.placements, e.profiles, e.limiter, e.approvals, e.rtaPolicy, e.throttles, e.schain, e.zones, e.reserve
+	e.mu.RUnlock()
+
+	// 广告位价格换算为系统货币，底价货币没有汇率的广告位不参与竞价
+	slots := e.normalizeSlots(req.Exchange, req.AdSlots, floorRules)
+	if len(slots) == 0 {
+		return nil, ErrNoAvailableAds
+	}
+
+	if floors != nil {
+		for _, slot := range slots {
+			floors.ObserveRequest(req.Exchange, slot)
+		}
+	}
+
+	log := e.logger.WithContext(ctx)
+	strategies, err := cache.ActiveStrategies(ctx)
 	if err != nil {
-		e.logger.Error("获取出价策略失败", "error", err)
+		log.Error("获取出价策略失败", "error", err)
 		return nil, fmt.Errorf("获取出价策略失败: %w", err)
 	}
 
+	// 不在投放时段的策略不参与竞价
+	strategies = daypart(startTime, strategies, zones)
+
+	// 按参与率抽样，未参与本次请求的策略不参与任何广告位的竞价
+	strategies = e.throttle(req.RequestID, strategies, throttles)
+
+	// 供应链未通过验证时，要求已授权供应链的推广计划不参与竞价
+	if !req.SupplyChainAuthorized {
+		strategies = e.requireSupplyChain(strategies, schain)
+	}
+
 	// 如果没有可用的出价策略
 	if len(strategies) == 0 {
 		return nil, ErrNoAvailableAds
 	}
 
+	// 交易平台要求素材审核时，只有关联了审核通过素材的策略参与竞价，出价也只轮换审核通过的素材
+	var approved func(strategyID string) bool
+	var rotationApprovals CreativeApprovals
+	if approvals != nil && approvals.Required(req.Exchange) {
+		rotationApprovals = approvals
+		approved = func(strategyID string) bool {
+			return creativeApproved(cache, approvals, req.Exchange, strategyID)
+		}
+	}
+
+	// 读取用户特征，所有广告位共用；用户不同意个性化投放时按默认CTR出价
+	userProfile := req.Profile
+	if !req.ProfileLoaded {
+		userProfile = e.userProfile(ctx, profiles, req.UserID)
+	} else if userProfile != nil && !personalizationAllowed(ctx) {
+		e.metrics.Bid.ProfileLookups.WithLabelValues(profileNoConsent).Inc()
+		userProfile = nil
+	}
+
 	// 对每个广告位进行竞价
-	for _, slot := range req.AdSlots {
-		// 获取候选广告
-		candidates := e.getBidCandidates(ctx, req.UserID, slot, strategies)
-		if len(candidates) == 0 {
-			continue
+	var responses []*BidResponse
+	won := make(map[string]bool, maxResults)
+	// timeoutStage 本次请求首次超时的阶段，每个请求只计一次超时
+	var timeoutStage string
+	for _, slot := range slots {
+		if len(responses) >= maxResults {
+			break
+		}
+		// 临近截止时间则停止竞价
+		if ctx.Err() != nil {
+			if timeoutStage == "" {
+				timeoutStage = stageAuction
+			}
+			e.metrics.Bid.StageTimeouts.WithLabelValues(timeoutStage).Inc()
+			if len(responses) > 0 {
+				return responses, nil
+			}
+			return nil, ErrBidTimeout
 		}
 
-		// 选择最优出价
-		winner := e.selectWinner(candidates)
-		if winner == nil {
-			continue
+		// 获取候选广告，已在其他广告位胜出的策略不再参与
+		// 候选生成提前截止，为最终检查留出时间，超时时已就绪的候选仍参与竞价
+		candidates := acquireCandidates(len(strategies))
+		var truncated bool
+		candidateCtx, cancel := candidateContext(ctx, reserve)
+		*candidates, truncated = e.getBidCandidates(candidateCtx, req, floorRules.enforced(slot), strategies, floors, placements, rtaPolicy, approved, userProfile, *candidates)
+		cancel()
+		if len(won) > 0 {
+			*candidates = excludeWinners(*candidates, won)
 		}
 
-		// 检查预算
-		ok, err := e.budgetMgr.CheckAndDeduct(ctx, winner.Strategy.ID, winner.BidPrice)
-		if err != nil {
-			e.logger.Error("检查预算失败", "error", err)
-			continue
+		// 按排序选择通过最终检查的候选，复制结果后归还候选切片
+		winner, found := e.pickWinner(ctx, req.UserID, req.Frequency, *candidates, limiter)
+		releaseCandidates(candidates)
+		if truncated && timeoutStage == "" {
+			timeoutStage = stageTargeting
 		}
-		if !ok {
-			e.logger.Warn("预算不足", "strategy_id", winner.Strategy.ID)
+		if !found {
 			continue
 		}
 
-		// 检查频次
-		ok, err = e.freqCtrl.CheckImpression(ctx, req.UserID, winner.Strategy.ID)
+		if floors != nil {
+			floors.ObserveBid(req.Exchange, slot, winner.BidPrice)
+		}
+		e.observeRTA(winner.rta)
+
+		won[winner.Strategy.ID] = true
+		responses = append(responses, &BidResponse{
+			SlotID:     slot.SlotID,
+			AdID:       winner.Strategy.ID,
+			CreativeID: selectCreative(cache.Creatives(winner.Strategy.ID), rotationApprovals, req.Exchange, req.RequestID, winner.Strategy.ID),
+			BidPrice:   winner.BidPrice,
+			BidType:    winner.Strategy.BidType,
+			AdMarkup:   "", // TODO: 生成广告物料
+			WinNotice:  "", // TODO: 生成获胜通知URL
+		})
+	}
+
+	if timeoutStage != "" {
+		e.metrics.Bid.StageTimeouts.WithLabelValues(timeoutStage).Inc()
+	}
+	if len(responses) == 0 {
+		return nil, ErrNoAvailableAds
+	}
+	return responses, nil
+}
+
+// candidateContext 返回候选生成使用的上下文，截止时间比ctx提前reserve，留给QPS、频次和预算检查
+// 剩余时间不足2倍reserve时只提前一半，ctx没有截止时间时原样返回
+func candidateContext(ctx context.Context, reserve time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ctx, func() {}
+	}
+	if half := time.Until(deadline) / 2; reserve > half {
+		reserve = half
+	}
+	return context.WithDeadline(ctx, deadline.Add(-reserve))
+}
+
+// excludeWinners 移除已在其他广告位胜出的策略
+func excludeWinners(candidates []BidCandidate, won map[string]bool) []BidCandidate {
+	kept := candidates[:0]
+	for _, c := range candidates {
+		if !won[c.Strategy.ID] {
+			kept = append(kept, c)
+		}
+	}
+	// 清空移除的候选，归还切片时只清理保留的部分
+	clear(candidates[len(kept):])
+	return kept
+}
+
+// pickWinner 按排序依次对候选进行QPS、频次和预算检查，未通过时回退到下一个候选
+// 最多尝试maxWinnerAttempts个候选，未通过的候选从candidates中移除
+func (e *Engine) pickWinner(ctx context.Context, userID string, freq FrequencySnapshot, candidates []BidCandidate, limiter RateLimiter) (BidCandidate, bool) {
+	for attempt := 0; attempt < maxWinnerAttempts && len(candidates) > 0; attempt++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		best := e.selectWinner(candidates)
+		reason := e.checkWinner(ctx, userID, freq, best, limiter)
+		if reason == "" {
+			return *best, true
+		}
+		e.metrics.Bid.Rejections.WithLabelValues(rejectStageFinal, reason).Inc()
+
+		// 与末尾候选交换后移除，selectWinner的结果与候选顺序无关
+		*best = candidates[len(candidates)-1]
+		candidates = candidates[:len(candidates)-1]
+	}
+	return BidCandidate{}, false
+}
+
+// checkWinner 检查候选能否出价并占用曝光、扣减预算，返回未通过的原因，通过时返回空字符串
+// 先占用曝光再扣减预算，频次超限的候选不会扣减预算；预算不足、扣减失败或超时时归还已占用的曝光
+// 频次超限的策略记入频次快照，后续请求在排序前跳过
+func (e *Engine) checkWinner(ctx context.Context, userID string, freq FrequencySnapshot, winner *BidCandidate, limiter RateLimiter) string {
+	log := e.logger.WithContext(ctx)
+	timings := logger.TimingsFromContext(ctx)
+
+	// 检查广告和推广计划的QPS，限流服务异常时不限制，避免影响竞价
+	if limiter != nil {
+		ok, err := limiter.Allow(ctx, winner.Strategy.ID, winner.Strategy.CampaignID)
 		if err != nil {
-			e.logger.Error("检查频次失败", "error", err)
-			continue
+			log.Error("检查QPS失败", "error", err)
+		} else if !ok {
+			log.Warn("QPS超限", "strategy_id", winner.Strategy.ID, "campaign_id", winner.Strategy.CampaignID)
+			return rejectQPS
 		}
-		if !ok {
-			e.logger.Warn("频次超限", "strategy_id", winner.Strategy.ID)
-			continue
+	}
+
+	// 检查频次并占用一次曝光，并发请求不会同时通过上限
+	_, ok, err := e.freqCtrl.AcquireImpression(ctx, userID, winner.Strategy.ID)
+	if err != nil {
+		log.Error("检查频次失败", "error", err)
+		return rejectFrequency
+	}
+	if !ok {
+		log.Warn("频次超限", "strategy_id", winner.Strategy.ID)
+		if freq != nil {
+			freq.MarkCapped(winner.Strategy.ID)
 		}
+		return rejectFrequency
+	}
 
-		// 返回竞价响应
-		return &BidResponse{
-			SlotID:    slot.SlotID,
-			AdID:      winner.Strategy.ID,
-			BidPrice:  winner.BidPrice,
-			BidType:   winner.Strategy.BidType,
-			AdMarkup:  "", // TODO: 生成广告物料
-			WinNotice: "", // TODO: 生成获胜通知URL
-		}, nil
+	// 检查预算
+	budgetStart := time.Now()
+	ok, err = e.budgetMgr.CheckAndDeduct(ctx, winner.Strategy.ID, winner.BidPrice)
+	timings.Since(StageBudget, budgetStart)
+	if err != nil {
+		log.Error("检查预算失败", "error", err)
+		e.releaseImpression(ctx, userID, winner.Strategy.ID)
+		return rejectBudget
 	}
+	if !ok {
+		log.Warn("预算不足", "strategy_id", winner.Strategy.ID)
+		e.releaseImpression(ctx, userID, winner.Strategy.ID)
+		return rejectBudget
+	}
+	return ""
+}
 
-	return nil, ErrNoAvailableAds
+// releaseImpression 在后台归还占用的曝光，不受请求截止时间影响，也不延长响应时间
+func (e *Engine) releaseImpression(ctx context.Context, userID, adID string) {
+	if e.freqRel == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), releaseTimeout)
+	go func() {
+		defer cancel()
+		if err := e.freqRel.ReleaseImpression(ctx, userID, adID); err != nil {
+			e.logger.WithContext(ctx).Error("归还曝光失败", "strategy_id", adID, "error", err)
+		}
+	}()
 }
 
-// getBidCandidates 获取竞价候选
-func (e *Engine) getBidCandidates(ctx context.Context, userID string, slot AdSlot, strategies []BidStrategy) []BidCandidate {
-	var candidates []BidCandidate
+// getBidCandidates 获取竞价候选，结果追加到candidates中返回
+// ctx的截止时间早于请求的截止时间，超时时返回已就绪的候选参与最终检查，truncated为true，超时由调用方按请求计数
+func (e *Engine) getBidCandidates(ctx context.Context, req BidRequest, slot AdSlot, strategies []BidStrategy, floors FloorAdvisor, placements PlacementAdvisor, rtaPolicy *RTABidPolicy, approved func(strategyID string) bool, userProfile *profile.Profile, candidates []BidCandidate) (result []BidCandidate, truncated bool) {
+	for i := range strategies {
+		strategy := &strategies[i]
+		// 超时则返回已就绪的候选
+		if ctx.Err() != nil {
+			return candidates, true
+		}
 
-	for _, strategy := range strategies {
 		// 检查策略状态
 		if strategy.Status != 1 {
 			continue
 		}
 
+		// 检查素材是否通过交易平台审核
+		if approved != nil && !approved(strategy.ID) {
+			continue
+		}
+
+		// 频次快照中已达上限的策略不参与排序
+		if req.Frequency != nil && req.Frequency.Capped(strategy.ID) {
+			e.metrics.Bid.Rejections.WithLabelValues(rejectStagePrefilter, rejectFrequency).Inc()
+			continue
+		}
+
+		// 绑定RTA任务的推广计划只投放定向通过的用户，并使用任务返回的出价信号
+		signal := req.RTA
+		if result, bound := req.RTACampaigns[strategy.CampaignID]; bound {
+			if !result.Targeted {
+				continue
+			}
+			signal = result.Signal
+		}
+
 		// 计算出价
-		bidPrice := e.calculateBidPrice(strategy, slot)
-		if bidPrice < slot.MinPrice || bidPrice > slot.MaxPrice {
+		bidPrice, rta := e.calculateBidPrice(*strategy, slot, signal, rtaPolicy)
+		// 按供应路径的历史CTR调整出价，锁价策略不调整，调整后仍受广告位价格范围限制
+		if placements != nil && !strategy.IsPriceLocked {
+			bidPrice = placements.AdjustBid(req.Exchange, slot, bidPrice)
+		}
+		if bidPrice > slot.MaxPrice {
+			continue
+		}
+		// 低于请求底价的候选不参与排序
+		if bidPrice < slot.MinPrice {
+			e.metrics.Bid.FloorRejections.WithLabelValues(req.Exchange, strategy.CampaignID, floorRejectBelow).Inc()
+			continue
+		}
+
+		// 根据底价情报调整出价，锁价策略不调整
+		if floors != nil && !strategy.IsPriceLocked {
+			adjusted, ok := floors.AdjustBid(req.Exchange, slot, bidPrice)
+			if !ok {
+				continue
+			}
+			bidPrice = adjusted
+		}
+
+		// 预算不足的策略不参与排序，避免胜出后才在扣减预算时被淘汰
+		if e.budgetChk != nil && !e.budgetChk.HasBudget(strategy.ID, bidPrice) {
+			e.metrics.Bid.Rejections.WithLabelValues(rejectStagePrefilter, rejectBudget).Inc()
 			continue
 		}
 
 		// 计算CTR
-		ctr := e.estimateCTR(strategy, userID, slot)
+		ctr := e.estimateCTR(*strategy, userProfile, slot)
 
 		candidates = append(candidates, BidCandidate{
-			Strategy: strategy,
+			Strategy: *strategy,
 			BidPrice: bidPrice,
 			CTR:      ctr,
+			rta:      rta,
 		})
 	}
 
-	return candidates
+	return candidates, false
+}
+
+// normalizeSlots 将广告位价格换算为系统货币，移除底价货币没有汇率的广告位
+func (e *Engine) normalizeSlots(exchange string, slots []AdSlot, rules *FloorPolicy) []AdSlot {
+	if rules == nil {
+		return slots
+	}
+	result := make([]AdSlot, 0, len(slots))
+	for _, slot := range slots {
+		normalized, ok := rules.normalize(slot)
+		if !ok {
+			e.metrics.Bid.FloorRejections.WithLabelValues(exchange, "", floorRejectCurrency).Inc()
+			e.logger.Debug("底价货币没有汇率，跳过广告位", "exchange", exchange, "slot_id", slot.SlotID, "currency", slot.Currency)
+			continue
+		}
+		result = append(result, normalized)
+	}
+	return result
+}
+
+// creativeApproved 策略是否关联了通过交易平台审核的素材
+func creativeApproved(cache *StrategyCache, approvals CreativeApprovals, exchange, strategyID string) bool {
+	for _, creative := range cache.Creatives(strategyID) {
+		if creative.Status == StrategyStatusEnabled && approvals.Approved(exchange, strconv.FormatInt(creative.CreativeID, 10)) {
+			return true
+		}
+	}
+	return false
 }
 
 // selectWinner 选择最优出价
+// 高优先级策略先于低优先级胜出，同优先级内按加权eCPM排序，相同时ID较小的策略胜出
 func (e *Engine) selectWinner(candidates []BidCandidate) *BidCandidate {
 	if len(candidates) == 0 {
 		return nil
 	}
 
-	// 按 eCPM 排序
-	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].BidPrice*candidates[i].CTR > candidates[j].BidPrice*candidates[j].CTR
-	})
+	// 线性扫描选取最优候选，避免排序带来的开销；同时记录不考虑优先级时的最优候选
+	best, bestByECPM := 0, 0
+	bestScore := weightedECPM(&candidates[0])
+	bestECPM := bestScore
+	for i := 1; i < len(candidates); i++ {
+		c := &candidates[i]
+		score := weightedECPM(c)
+		if outranks(c, score, &candidates[best], bestScore) {
+			best = i
+			bestScore = score
+		}
+		if score > bestECPM {
+			bestByECPM = i
+			bestECPM = score
+		}
+	}
 
-	return &candidates[0]
+	// 高优先级策略抢占了加权eCPM更高的候选
+	if winner := &candidates[best]; candidates[bestByECPM].Strategy.Priority < winner.Strategy.Priority && bestECPM > bestScore {
+		e.metrics.Bid.Preemptions.WithLabelValues(strconv.Itoa(winner.Strategy.Priority)).Inc()
+	}
+
+	return &candidates[best]
+}
+
+// weightedECPM 计算加权eCPM
+func weightedECPM(c *BidCandidate) float64 {
+	weight := c.Strategy.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	return c.BidPrice * c.CTR * weight
+}
+
+// outranks 判断候选a是否优于候选b
+func outranks(a *BidCandidate, aScore float64, b *BidCandidate, bScore float64) bool {
+	if a.Strategy.Priority != b.Strategy.Priority {
+		return a.Strategy.Priority > b.Strategy.Priority
+	}
+	if aScore != bScore {
+		return aScore > bScore
+	}
+	return lessID(a.Strategy.ID, b.Strategy.ID)
+}
+
+// lessID 按长度和字典序比较策略ID，对数字ID等价于按数值比较
+func lessID(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
 }
 
-// calculateBidPrice 计算出价
-func (e *Engine) calculateBidPrice(strategy BidStrategy, slot AdSlot) float64 {
-	// TODO: 实现更复杂的出价逻辑
-	return strategy.Price
+// calculateBidPrice 计算出价，开启RTA出价的推广计划按RTA信号调整，锁价策略不调整
+func (e *Engine) calculateBidPrice(strategy BidStrategy, slot AdSlot, signal *RTASignal, policy *RTABidPolicy) (float64, rtaResult) {
+	if signal == nil || policy == nil || strategy.IsPriceLocked || !policy.Enabled(strategy.CampaignID) {
+		return strategy.Price, rtaResult{}
+	}
+	return policy.apply(strategy.Price, signal)
+}
+
+// userProfile 读取用户特征，失败或没有特征时返回nil
+func (e *Engine) userProfile(ctx context.Context, profiles UserProfiles, userID string) *profile.Profile {
+	if profiles == nil {
+		return nil
+	}
+	if !personalizationAllowed(ctx) {
+		e.metrics.Bid.ProfileLookups.WithLabelValues(profileNoConsent).Inc()
+		return nil
+	}
+
+	p, err := profiles.Profile(ctx, userID)
+	switch {
+	case err == nil:
+		e.metrics.Bid.ProfileLookups.WithLabelValues(profileHit).Inc()
+		return p
+	case errors.Is(err, profile.ErrProfileNotFound):
+		e.metrics.Bid.ProfileLookups.WithLabelValues(profileMiss).Inc()
+	default:
+		e.metrics.Bid.ProfileLookups.WithLabelValues(profileError).Inc()
+		e.logger.WithContext(ctx).Warn("读取用户特征失败，使用默认CTR", "user_id", userID, "error", err)
+	}
+	return nil
 }
 
-// estimateCTR 预估点击率
-func (e *Engine) estimateCTR(strategy BidStrategy, userID string, slot AdSlot) float64 {
-	// TODO: 实现更复杂的CTR预估逻辑
-	return 0.01
+// personalizationAllowed 上下文中的隐私同意状态是否允许按用户特征出价，未携带同意状态时允许
+func personalizationAllowed(ctx context.Context) bool {
+	consent, ok := reqctx.ConsentFrom(ctx)
+	return !ok || consent.Allowed()
+}
+
+// estimateCTR 预估点击率，按用户对该策略及其类目的近期展示和点击修正默认值
+func (e *Engine) estimateCTR(strategy BidStrategy, userProfile *profile.Profile, slot AdSlot) float64 {
+	if userProfile == nil {
+		return baseCTR
+	}
+	return userProfile.Features(strategy.ID, strategy.Category).CTR(baseCTR, time.Now())
 }
 
 // ProcessBid 处理竞价请求
@@ -27,6 +27,15 @@ var (
 	// ErrCTRPredictionFailed 表示CTR预测失败
 	ErrCTRPredictionFailed = errors.New("CTR预测失败")
 
+	// ErrInvalidStrategy 表示出价策略的字段无效
+	ErrInvalidStrategy = errors.New("无效的出价策略")
+
+	// ErrRepositoryUnavailable 表示策略存储未配置
+	ErrRepositoryUnavailable = errors.New("出价策略存储不可用")
+
+	// ErrBidTimeout 表示竞价超时
+	ErrBidTimeout = errors.New("竞价超时")
+
 	// ErrECPMCalculationFailed 表示eCPM计算失败
 	ErrECPMCalculationFailed = errors.New("eCPM计算失败")
 ) 
\ No newline at end of file
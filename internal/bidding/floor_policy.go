@@ -0,0 +1,86 @@
+package bidding
+
+import "strings"
+
+// 请求底价的执行方式
+const (
+	// FloorModeHard 排序前过滤出价低于请求底价的候选
+	FloorModeHard = "hard"
+	// FloorModeOff 不按请求底价过滤候选，底价只用于底价情报
+	FloorModeOff = "off"
+)
+
+// 底价货币没有汇率时的处理
+const (
+	// FloorUnknownSkip 不参与该广告位的竞价
+	FloorUnknownSkip = "skip"
+	// FloorUnknownSystem 按系统货币处理底价
+	FloorUnknownSystem = "system"
+)
+
+// DefaultFloorCurrency 默认的系统货币
+const DefaultFloorCurrency = "USD"
+
+// 底价拒绝原因
+const (
+	floorRejectBelow    = "below_floor"
+	floorRejectCurrency = "unknown_currency"
+)
+
+// FloorPolicy 请求底价的执行方式，广告位的价格在竞价前换算为系统货币
+type FloorPolicy struct {
+	enforce     bool
+	currency    string
+	rates       map[string]float64 // 货币代码 -> 1单位折合的系统货币
+	skipUnknown bool
+}
+
+// NewFloorPolicy 创建底价执行策略，参数为空时使用hard、USD和skip
+func NewFloorPolicy(mode, currency, unknownCurrency string) *FloorPolicy {
+	if currency == "" {
+		currency = DefaultFloorCurrency
+	}
+	return &FloorPolicy{
+		enforce:     mode != FloorModeOff,
+		currency:    strings.ToUpper(currency),
+		rates:       make(map[string]float64),
+		skipUnknown: unknownCurrency != FloorUnknownSystem,
+	}
+}
+
+// SetRate 设置货币的汇率，即1单位该货币折合的系统货币，需在设置到竞价引擎之前调用
+func (p *FloorPolicy) SetRate(currency string, rate float64) {
+	p.rates[strings.ToUpper(currency)] = rate
+}
+
+// normalize 将广告位的底价和最高价换算为系统货币，货币没有汇率且配置为skip时ok为false
+func (p *FloorPolicy) normalize(slot AdSlot) (AdSlot, bool) {
+	if p == nil {
+		return slot, true
+	}
+	currency := strings.ToUpper(strings.TrimSpace(slot.Currency))
+	if currency == "" || currency == p.currency {
+		slot.Currency = p.currency
+		return slot, true
+	}
+	rate, ok := p.rates[currency]
+	if !ok {
+		if p.skipUnknown {
+			return slot, false
+		}
+		slot.Currency = p.currency
+		return slot, true
+	}
+	slot.MinPrice *= rate
+	slot.MaxPrice *= rate
+	slot.Currency = p.currency
+	return slot, true
+}
+
+// enforced 返回用于过滤候选的广告位，不执行请求底价时底价为0
+func (p *FloorPolicy) enforced(slot AdSlot) AdSlot {
+	if p != nil && !p.enforce {
+		slot.MinPrice = 0
+	}
+	return slot
+}
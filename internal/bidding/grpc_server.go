@@ -2,8 +2,14 @@ package bidding
 
 import (
 	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	pb "simple-dsp/api/proto/dsp/v1"
 	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
 )
 
 // GRPCServer 实现 gRPC 服务
@@ -46,13 +52,18 @@ func (s *GRPCServer) ProcessBid(ctx context.Context, req *pb.BidRequest) (*pb.Bi
 		})
 	}
 
+	// 参数校验
+	if err := ValidateRequest(&bidReq); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
 	// 调用竞价引擎
+	ctx = logger.ContextWithFields(metrics.WithTraceID(ctx, req.RequestId), "request_id", req.RequestId)
+	log := s.logger.WithContext(ctx)
 	resp, err := s.engine.ProcessBid(ctx, bidReq)
 	if err != nil {
-		s.logger.Error("处理竞价请求失败",
-			"error", err,
-			"request_id", req.RequestId)
-		return nil, err
+		log.Error("处理竞价请求失败", "error", err)
+		return nil, toStatusError(err)
 	}
 
 	// 转换响应格式
@@ -73,9 +84,23 @@ func (s *GRPCServer) ProcessBid(ctx context.Context, req *pb.BidRequest) (*pb.Bi
 		},
 	}
 
-	s.logger.Info("竞价请求处理成功",
-		"request_id", req.RequestId,
-		"bid_price", resp.BidPrice)
+	log.Info("竞价请求处理成功", "bid_price", resp.BidPrice)
 
 	return pbResp, nil
 }
+
+// toStatusError 将竞价错误转换为gRPC状态码
+func toStatusError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidBidRequest), errors.Is(err, ErrInvalidAdSlot):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrNoAvailableAds):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrBidTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, ErrBudgetExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
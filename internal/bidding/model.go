@@ -6,20 +6,27 @@ import (
 
 // BidStrategyCreative 出价策略素材关联
 type BidStrategyCreative struct {
-	ID         int64     `json:"id" db:"id"`
-	StrategyID int64     `json:"strategyId" db:"strategy_id"`
-	CreativeID int64     `json:"creativeId" db:"creative_id"`
-	Status     int       `json:"status" db:"status"`
-	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+	ID         int64 `json:"id" gorm:"column:id;primary_key;autoIncrement"`
+	StrategyID int64 `json:"strategyId" gorm:"column:strategy_id"`
+	CreativeID int64 `json:"creativeId" gorm:"column:creative_id"`
+	Status     int   `json:"status" gorm:"column:status"`
+	// Weight 轮换权重，同一策略的启用素材按权重分配出价，0按1处理
+	Weight    float64   `json:"weight" gorm:"column:weight"`
+	CreatedAt time.Time `json:"createdAt" gorm:"column:created_at"`
+	UpdatedAt time.Time `json:"updatedAt" gorm:"column:updated_at"`
+}
+
+// TableName 返回表名
+func (BidStrategyCreative) TableName() string {
+	return "bid_strategy_creatives"
 }
 
 // BidStrategyStats 出价策略统计数据
 type BidStrategyStats struct {
-	StrategyID  int64   `json:"strategyId" db:"strategy_id"`
-	CreativeID  int64   `json:"creativeId" db:"creative_id"`
-	Impressions int64   `json:"impressions" db:"impressions"`
-	Clicks      int64   `json:"clicks" db:"clicks"`
-	Spend       float64 `json:"spend" db:"spend"`
-	Date        string  `json:"date" db:"date"`
+	StrategyID  int64   `json:"strategyId" gorm:"column:strategy_id"`
+	CreativeID  int64   `json:"creativeId" gorm:"column:creative_id"`
+	Impressions int64   `json:"impressions" gorm:"column:impressions"`
+	Clicks      int64   `json:"clicks" gorm:"column:clicks"`
+	Spend       float64 `json:"spend" gorm:"column:spend"`
+	Date        string  `json:"date" gorm:"column:date"`
 }
@@ -0,0 +1,96 @@
+package bidding
+
+import "hash/fnv"
+
+// participationBuckets 参与率抽样的分桶数，参与率精确到万分之一
+const participationBuckets = 10000
+
+// 参与率限制的维度
+const (
+	throttleStrategy   = "strategy"
+	throttleAdvertiser = "advertiser"
+)
+
+// ParticipationPolicy 广告主参与率，按策略所属的推广计划找到广告主
+type ParticipationPolicy struct {
+	rates     map[string]float64 // 广告主ID -> 参与率
+	campaigns map[string]string  // 推广计划ID -> 广告主ID
+}
+
+// NewParticipationPolicy 创建广告主参与率，未设置的广告主参与全部请求
+func NewParticipationPolicy() *ParticipationPolicy {
+	return &ParticipationPolicy{
+		rates:     make(map[string]float64),
+		campaigns: make(map[string]string),
+	}
+}
+
+// SetAdvertiser 设置广告主的参与率和所属推广计划，需在设置到竞价引擎之前调用
+func (p *ParticipationPolicy) SetAdvertiser(advertiserID string, rate float64, campaigns []string) {
+	p.rates[advertiserID] = rate
+	for _, campaignID := range campaigns {
+		p.campaigns[campaignID] = advertiserID
+	}
+}
+
+// advertiser 返回推广计划所属广告主及其参与率，未设置时ok为false
+func (p *ParticipationPolicy) advertiser(campaignID string) (advertiserID string, rate float64, ok bool) {
+	if campaignID == "" {
+		return "", 0, false
+	}
+	advertiserID, ok = p.campaigns[campaignID]
+	if !ok {
+		return "", 0, false
+	}
+	return advertiserID, p.rates[advertiserID], true
+}
+
+// participates 按请求ID和key的哈希抽样，同一请求的结果不变，参与率不在(0,1)内时总是参与
+func participates(requestID, key string, rate float64) bool {
+	if rate <= 0 || rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h.Write([]byte{0})
+	h.Write([]byte(requestID))
+	return h.Sum64()%participationBuckets < uint64(rate*participationBuckets)
+}
+
+// throttled 返回策略未参与本次请求的维度，参与时返回空
+// 广告主未参与时其下所有策略都不参与
+func throttled(requestID string, strategy *BidStrategy, policy *ParticipationPolicy) string {
+	if policy != nil {
+		if advertiserID, rate, ok := policy.advertiser(strategy.CampaignID); ok && !participates(requestID, throttleAdvertiser+":"+advertiserID, rate) {
+			return throttleAdvertiser
+		}
+	}
+	if !participates(requestID, throttleStrategy+":"+strategy.ID, strategy.Participation) {
+		return throttleStrategy
+	}
+	return ""
+}
+
+// throttle 过滤未参与本次请求的策略，没有策略被过滤时返回原切片
+// 在各广告位竞价前调用一次，同一请求的各广告位使用相同的策略
+func (e *Engine) throttle(requestID string, strategies []BidStrategy, policy *ParticipationPolicy) []BidStrategy {
+	var kept []BidStrategy
+	for i := range strategies {
+		level := throttled(requestID, &strategies[i], policy)
+		if level == "" {
+			if kept != nil {
+				kept = append(kept, strategies[i])
+			}
+			continue
+		}
+		e.metrics.Bid.Throttled.WithLabelValues(level).Inc()
+		if kept == nil {
+			kept = make([]BidStrategy, i, len(strategies)-1)
+			copy(kept, strategies[:i])
+		}
+	}
+	if kept == nil {
+		return strategies
+	}
+	return kept
+}
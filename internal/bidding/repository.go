@@ -2,13 +2,16 @@ package bidding
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
+	"time"
 
-	"github.com/jmoiron/sqlx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
 )
 
 // Repository 出价策略存储接口
@@ -29,245 +32,215 @@ type Repository interface {
 	AddCreative(ctx context.Context, strategyID int64, creativeID int64) error
 	// RemoveCreative 移除素材
 	RemoveCreative(ctx context.Context, strategyID int64, creativeID int64) error
+	// UpdateCreative 更新策略素材关联的状态和轮换权重
+	UpdateCreative(ctx context.Context, strategyID int64, creativeID int64, status int, weight float64) error
 	// ListCreatives 获取策略关联的素材列表
 	ListCreatives(ctx context.Context, strategyID string) ([]BidStrategyCreative, error)
 	// GetStrategyStats 获取策略统计数据
 	GetStrategyStats(ctx context.Context, strategyID int64, startDate, endDate string) ([]BidStrategyStats, error)
 }
 
-// MySQLRepository MySQL实现
-type MySQLRepository struct {
-	db *sqlx.DB
+// GormRepository 基于数据库的出价策略存储
+type GormRepository struct {
+	db *gorm.DB
 }
 
-// NewMySQLRepository 创建MySQL存储实现
-func NewMySQLRepository(db *sqlx.DB) Repository {
-	return &MySQLRepository{db: db}
+// NewGormRepository 创建基于数据库的出价策略存储
+func NewGormRepository(db *gorm.DB) Repository {
+	return &GormRepository{db: db}
 }
 
-// ListBidStrategies 获取出价策略列表
-func (r *MySQLRepository) ListBidStrategies(ctx context.Context, filter BidStrategyFilter) ([]BidStrategy, int64, error) {
-	var conditions []string
-	var args []interface{}
-
+// ListBidStrategies 获取出价策略列表，配置了只读副本时从副本读取
+func (r *GormRepository) ListBidStrategies(ctx context.Context, filter BidStrategyFilter) ([]BidStrategy, int64, error) {
+	query := r.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "bidding.list_strategies"))).Model(&models.BidStrategy{})
 	if filter.BidType != "" {
-		conditions = append(conditions, "bid_type = ?")
-		args = append(args, filter.BidType)
+		query = query.Where("bid_type = ?", filter.BidType)
+	}
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+	if filter.CampaignID != "" {
+		query = query.Where("campaign_id = ?", filter.CampaignID)
 	}
-
 	if filter.MinPrice != nil {
-		conditions = append(conditions, "price >= ?")
-		args = append(
-			args,
-			*filter.MinPrice,
-		)
+		query = query.Where("price >= ?", *filter.MinPrice)
 	}
-
 	if filter.MaxPrice != nil {
-		conditions = append(conditions, "price <= ?")
-		args = append(
-			args,
-			*filter.MaxPrice,
-		)
-	}
-
-	where := ""
-	if len(conditions) > 0 {
-		where = "WHERE " + strings.Join(conditions, " AND ")
+		query = query.Where("price <= ?", *filter.MaxPrice)
 	}
 
-	// 获取总数
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM bid_strategies %s", where)
 	var total int64
-	if err := r.db.GetContext(ctx, &total, countQuery, args...); err != nil {
+	if err := query.Count(&total).Error; err != nil {
 		return nil, 0, err
 	}
 
-	// 获取列表
+	var records []models.BidStrategy
 	offset := (filter.Page - 1) * filter.PageSize
-	query := fmt.Sprintf(`
-		SELECT * FROM bid_strategies 
-		%s
-		ORDER BY id DESC 
-		LIMIT ? OFFSET ?
-	`, where)
-
-	args = append(args, filter.PageSize, offset)
-
-	var strategies []BidStrategy
-	if err := r.db.SelectContext(ctx, &strategies, query, args...); err != nil {
+	if err := query.Order("id DESC").Limit(filter.PageSize).Offset(offset).Find(&records).Error; err != nil {
 		return nil, 0, err
 	}
 
-	// 获取关联的素材
-	//for i := range strategies {
-	//	creatives, err := r.ListCreatives(ctx, strategies[i].ID)
-	//	if err != nil {
-	//		return nil, 0, err
-	//	}
-	//	//strategies[i].Creatives = creatives
-	//}
-
+	strategies := make([]BidStrategy, 0, len(records))
+	for i := range records {
+		strategies = append(strategies, strategyFromModel(&records[i]))
+	}
 	return strategies, total, nil
 }
 
-// GetBidStrategy 获取单个出价策略
-func (r *MySQLRepository) GetBidStrategy(ctx context.Context, id int64) (*BidStrategy, error) {
-	var strategy BidStrategy
-	err := r.db.GetContext(ctx, &strategy, "SELECT * FROM bid_strategies WHERE id = ?", id)
-	if errors.Is(sql.ErrNoRows, err) {
+// GetBidStrategy 获取单个出价策略，不存在时返回nil
+func (r *GormRepository) GetBidStrategy(ctx context.Context, id int64) (*BidStrategy, error) {
+	var record models.BidStrategy
+	err := r.db.WithContext(database.WithQueryName(ctx, "bidding.get_strategy")).Where("id = ?", id).Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-
-	// 获取关联的素材
-	//creatives, err := r.ListCreatives(ctx, strategy.ID)
-	//if err != nil {
-	//	return nil, err
-	//}
-	//strategy.Creatives = creatives
-
+	strategy := strategyFromModel(&record)
 	return &strategy, nil
 }
 
-// CreateBidStrategy 创建出价策略
-func (r *MySQLRepository) CreateBidStrategy(ctx context.Context, strategy *BidStrategy) error {
-	query := `
-		INSERT INTO bid_strategies (
-			name, bid_type, price, daily_budget, status, is_price_locked, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, NOW(), NOW())
-	`
-	result, err := r.db.ExecContext(ctx, query,
-		strategy.Name,
-		strategy.BidType,
-		strategy.Price,
-		strategy.DailyBudget,
-		strategy.Status,
-		strategy.IsPriceLocked,
-	)
-	if err != nil {
+// CreateBidStrategy 创建出价策略，创建后回填ID和时间
+func (r *GormRepository) CreateBidStrategy(ctx context.Context, strategy *BidStrategy) error {
+	record := strategyToModel(strategy)
+	if err := r.db.WithContext(database.WithQueryName(ctx, "bidding.create_strategy")).Create(&record).Error; err != nil {
 		return err
 	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return err
-	}
-	strategy.ID = strconv.FormatInt(id, 10)
-
-	// 关联素材
-	// for _, creative := range strategy.Creatives {
-	// 	if err := r.AddCreative(ctx, id, creative.CreativeID); err != nil {
-	// 		return err
-	// 	}
-	// }
-
+	strategy.ID = strconv.FormatInt(record.ID, 10)
+	strategy.CreateTime = record.CreatedAt
+	strategy.UpdateTime = record.UpdatedAt
 	return nil
 }
 
-// UpdateBidStrategy 更新出价策略
-func (r *MySQLRepository) UpdateBidStrategy(ctx context.Context, strategy *BidStrategy) error {
-	// 检查是否允许更新价格
-	var isPriceLocked int
-	err := r.db.GetContext(ctx, &isPriceLocked, "SELECT is_price_locked FROM bid_strategies WHERE id = ?", strategy.ID)
+// UpdateBidStrategy 更新出价策略，价格已锁定时不更新价格
+func (r *GormRepository) UpdateBidStrategy(ctx context.Context, strategy *BidStrategy) error {
+	id, err := strconv.ParseInt(strategy.ID, 10, 64)
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: 无效的ID %q", ErrInvalidStrategy, strategy.ID)
 	}
 
-	if isPriceLocked == 1 {
-		// 如果价格已锁定，则不允许更新价格
-		query := `
-			UPDATE bid_strategies SET 
-				name = ?,
-				daily_budget = ?,
-				status = ?,
-				updated_at = NOW()
-			WHERE id = ?
-		`
-		_, err = r.db.ExecContext(ctx, query,
-			strategy.Name,
-			strategy.DailyBudget,
-			strategy.Status,
-			strategy.ID,
-		)
-	} else {
-		query := `
-			UPDATE bid_strategies SET 
-				name = ?,
-				price = ?,
-				daily_budget = ?,
-				status = ?,
-				updated_at = NOW()
-			WHERE id = ?
-		`
-		_, err = r.db.ExecContext(ctx, query,
-			strategy.Name,
-			strategy.Price,
-			strategy.DailyBudget,
-			strategy.Status,
-			strategy.ID,
-		)
-	}
-	return err
+	// 行锁可能与并发的修改形成死锁，死锁时重新执行事务
+	return database.TransactionRetry(database.WithQueryName(ctx, "bidding.update_strategy"), r.db, func(tx *gorm.DB) error {
+		// 锁定行，避免与锁定价格的修改交错
+		var current models.BidStrategy
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "is_price_locked").
+			Where("id = ?", id).
+			Take(&current).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"name":               strategy.Name,
+			"daily_budget":       strategy.DailyBudget,
+			"status":             strategy.Status,
+			"priority":           strategy.Priority,
+			"weight":             strategy.Weight,
+			"category":           strategy.Category,
+			"campaign_id":        strategy.CampaignID,
+			"participation_rate": strategy.Participation,
+			"dayparting":         strategy.Dayparting,
+			"updated_at":         time.Now(),
+		}
+		if !current.IsPriceLocked {
+			updates["price"] = strategy.Price
+		}
+		return tx.Model(&models.BidStrategy{}).Where("id = ?", id).Updates(updates).Error
+	})
 }
 
 // DeleteBidStrategy 删除出价策略
-func (r *MySQLRepository) DeleteBidStrategy(ctx context.Context, id int64) error {
-	_, err := r.db.ExecContext(ctx, "DELETE FROM bid_strategies WHERE id = ?", id)
-	return err
+func (r *GormRepository) DeleteBidStrategy(ctx context.Context, id int64) error {
+	return r.db.WithContext(database.WithQueryName(ctx, "bidding.delete_strategy")).Where("id = ?", id).Delete(&models.BidStrategy{}).Error
 }
 
 // UpdateBidStrategyStatus 更新出价策略状态
-func (r *MySQLRepository) UpdateBidStrategyStatus(ctx context.Context, id int64, status int) error {
-	query := "UPDATE bid_strategies SET status = ?, updated_at = NOW() WHERE id = ?"
-	_, err := r.db.ExecContext(ctx, query, status, id)
-	return err
+func (r *GormRepository) UpdateBidStrategyStatus(ctx context.Context, id int64, status int) error {
+	return r.db.WithContext(database.WithQueryName(ctx, "bidding.update_strategy_status")).Model(&models.BidStrategy{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "updated_at": time.Now()}).Error
 }
 
 // AddCreative 关联素材
-func (r *MySQLRepository) AddCreative(ctx context.Context, strategyID int64, creativeID int64) error {
-	query := `
-		INSERT INTO bid_strategy_creatives (
-			strategy_id, creative_id, status, created_at, updated_at
-		) VALUES (?, ?, 1, NOW(), NOW())
-	`
-	_, err := r.db.ExecContext(ctx, query, strategyID, creativeID)
-	return err
+func (r *GormRepository) AddCreative(ctx context.Context, strategyID int64, creativeID int64) error {
+	return r.db.WithContext(database.WithQueryName(ctx, "bidding.add_creative")).Create(&BidStrategyCreative{
+		StrategyID: strategyID,
+		CreativeID: creativeID,
+		Status:     1,
+		Weight:     1,
+	}).Error
 }
 
 // RemoveCreative 移除素材
-func (r *MySQLRepository) RemoveCreative(ctx context.Context, strategyID int64, creativeID int64) error {
-	query := "DELETE FROM bid_strategy_creatives WHERE strategy_id = ? AND creative_id = ?"
-	_, err := r.db.ExecContext(ctx, query, strategyID, creativeID)
-	return err
+func (r *GormRepository) RemoveCreative(ctx context.Context, strategyID int64, creativeID int64) error {
+	return r.db.WithContext(database.WithQueryName(ctx, "bidding.remove_creative")).
+		Where("strategy_id = ? AND creative_id = ?", strategyID, creativeID).
+		Delete(&BidStrategyCreative{}).Error
+}
+
+// UpdateCreative 更新策略素材关联的状态和轮换权重
+func (r *GormRepository) UpdateCreative(ctx context.Context, strategyID int64, creativeID int64, status int, weight float64) error {
+	return r.db.WithContext(database.WithQueryName(ctx, "bidding.update_creative")).Model(&BidStrategyCreative{}).
+		Where("strategy_id = ? AND creative_id = ?", strategyID, creativeID).
+		Updates(map[string]interface{}{"status": status, "weight": weight, "updated_at": time.Now()}).Error
 }
 
 // ListCreatives 获取策略关联的素材列表
-func (r *MySQLRepository) ListCreatives(ctx context.Context, strategyID string) ([]BidStrategyCreative, error) {
+func (r *GormRepository) ListCreatives(ctx context.Context, strategyID string) ([]BidStrategyCreative, error) {
 	var creatives []BidStrategyCreative
-	query := "SELECT * FROM bid_strategy_creatives WHERE strategy_id = ?"
-	err := r.db.SelectContext(ctx, &creatives, query, strategyID)
+	err := r.db.WithContext(database.WithQueryName(ctx, "bidding.list_creatives")).Where("strategy_id = ?", strategyID).Find(&creatives).Error
 	return creatives, err
 }
 
-// GetStrategyStats 获取策略统计数据
-func (r *MySQLRepository) GetStrategyStats(ctx context.Context, strategyID int64, startDate, endDate string) ([]BidStrategyStats, error) {
-	query := `
-		SELECT 
-			strategy_id,
-			creative_id,
-			SUM(impressions) as impressions,
-			SUM(clicks) as clicks,
-			SUM(spend) as spend,
-			date
-		FROM bid_strategy_stats
-		WHERE strategy_id = ? AND date BETWEEN ? AND ?
-		GROUP BY strategy_id, creative_id, date
-		ORDER BY date DESC
-	`
+// GetStrategyStats 获取策略统计数据，配置了只读副本时从副本读取
+func (r *GormRepository) GetStrategyStats(ctx context.Context, strategyID int64, startDate, endDate string) ([]BidStrategyStats, error) {
 	var stats []BidStrategyStats
-	err := r.db.SelectContext(ctx, &stats, query, strategyID, startDate, endDate)
+	err := r.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "bidding.get_strategy_stats"))).
+		Table("bid_strategy_stats").
+		Select("strategy_id, creative_id, SUM(impressions) AS impressions, SUM(clicks) AS clicks, SUM(spend) AS spend, date").
+		Where("strategy_id = ? AND date BETWEEN ? AND ?", strategyID, startDate, endDate).
+		Group("strategy_id, creative_id, date").
+		Order("date DESC").
+		Find(&stats).Error
 	return stats, err
 }
+
+// strategyFromModel 数据库模型转换为出价策略
+func strategyFromModel(record *models.BidStrategy) BidStrategy {
+	return BidStrategy{
+		ID:            strconv.FormatInt(record.ID, 10),
+		Name:          record.Name,
+		BidType:       record.BidType,
+		Price:         record.Price,
+		Status:        record.Status,
+		DailyBudget:   record.DailyBudget,
+		IsPriceLocked: record.IsPriceLocked,
+		Priority:      record.Priority,
+		Weight:        record.Weight,
+		Category:      record.Category,
+		CampaignID:    record.CampaignID,
+		Participation: record.ParticipationRate,
+		Dayparting:    record.Dayparting,
+		CreateTime:    record.CreatedAt,
+		UpdateTime:    record.UpdatedAt,
+	}
+}
+
+// strategyToModel 出价策略转换为数据库模型，ID由数据库生成
+func strategyToModel(strategy *BidStrategy) models.BidStrategy {
+	return models.BidStrategy{
+		Name:              strategy.Name,
+		BidType:           strategy.BidType,
+		Price:             strategy.Price,
+		Status:            strategy.Status,
+		DailyBudget:       strategy.DailyBudget,
+		IsPriceLocked:     strategy.IsPriceLocked,
+		Priority:          strategy.Priority,
+		Weight:            strategy.Weight,
+		Category:          strategy.Category,
+		CampaignID:        strategy.CampaignID,
+		ParticipationRate: strategy.Participation,
+		Dayparting:        strategy.Dayparting,
+	}
+}
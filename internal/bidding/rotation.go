@@ -0,0 +1,58 @@
+package bidding
+
+import (
+	"hash/fnv"
+	"strconv"
+)
+
+// rotationBuckets 素材轮换的哈希分桶数
+const rotationBuckets = 10000
+
+// creativeWeight 素材的轮换权重，0按1处理
+func creativeWeight(creative *BidStrategyCreative) float64 {
+	if creative.Weight <= 0 {
+		return 1
+	}
+	return creative.Weight
+}
+
+// rotatable 素材是否参与轮换，approvals不为nil时只轮换审核通过的素材
+func rotatable(creative *BidStrategyCreative, approvals CreativeApprovals, exchange string) bool {
+	if creative.Status != StrategyStatusEnabled {
+		return false
+	}
+	return approvals == nil || approvals.Approved(exchange, strconv.FormatInt(creative.CreativeID, 10))
+}
+
+// selectCreative 在策略启用的素材中按轮换权重选择本次出价的素材，同一请求的结果不变
+// 没有可用的素材时返回空字符串
+func selectCreative(creatives []BidStrategyCreative, approvals CreativeApprovals, exchange, requestID, strategyID string) string {
+	var total float64
+	for i := range creatives {
+		if rotatable(&creatives[i], approvals, exchange) {
+			total += creativeWeight(&creatives[i])
+		}
+	}
+	if total <= 0 {
+		return ""
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(strategyID))
+	h.Write([]byte{0})
+	h.Write([]byte(requestID))
+	point := float64(h.Sum64()%rotationBuckets) / rotationBuckets * total
+
+	selected := ""
+	for i := range creatives {
+		if !rotatable(&creatives[i], approvals, exchange) {
+			continue
+		}
+		selected = strconv.FormatInt(creatives[i].CreativeID, 10)
+		point -= creativeWeight(&creatives[i])
+		if point < 0 {
+			break
+		}
+	}
+	return selected
+}
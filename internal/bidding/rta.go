@@ -0,0 +1,105 @@
+package bidding
+
+import "strconv"
+
+// RTA出价系数的默认范围
+const (
+	DefaultRTAMinMultiplier = 0.5
+	DefaultRTAMaxMultiplier = 2.0
+)
+
+// RTA调整出价的方向
+const (
+	rtaRaised    = "raised"
+	rtaLowered   = "lowered"
+	rtaUnchanged = "unchanged"
+)
+
+// RTASignal RTA返回的出价信号
+type RTASignal struct {
+	BaseBid       float64 `json:"base_bid"`       // 基础出价，大于0时替换策略出价
+	BidMultiplier float64 `json:"bid_multiplier"` // 出价系数，大于0时与出价相乘
+}
+
+// RTAResult 推广计划绑定的RTA任务的查询结果
+type RTAResult struct {
+	Targeted bool       `json:"targeted"`         // 用户是否符合任务的定向
+	Signal   *RTASignal `json:"signal,omitempty"` // 任务返回的出价信号，替代请求级的RTA信号
+}
+
+// RTABidPolicy RTA出价信号的使用范围，只有开启的推广计划按RTA信号出价
+type RTABidPolicy struct {
+	campaigns     map[string]bool
+	minMultiplier float64
+	maxMultiplier float64
+}
+
+// rtaResult RTA信号对候选出价的调整
+type rtaResult struct {
+	direction string // 未使用RTA信号时为空
+	clamped   bool   // 出价系数超出范围被截断
+}
+
+// NewRTABidPolicy 创建RTA出价策略，系数范围为0时使用默认值
+func NewRTABidPolicy(campaigns []string, minMultiplier, maxMultiplier float64) *RTABidPolicy {
+	if minMultiplier <= 0 {
+		minMultiplier = DefaultRTAMinMultiplier
+	}
+	if maxMultiplier <= 0 {
+		maxMultiplier = DefaultRTAMaxMultiplier
+	}
+	if minMultiplier > maxMultiplier {
+		minMultiplier = maxMultiplier
+	}
+
+	p := &RTABidPolicy{
+		campaigns:     make(map[string]bool, len(campaigns)),
+		minMultiplier: minMultiplier,
+		maxMultiplier: maxMultiplier,
+	}
+	for _, id := range campaigns {
+		p.campaigns[id] = true
+	}
+	return p
+}
+
+// Enabled 推广计划是否按RTA信号出价
+func (p *RTABidPolicy) Enabled(campaignID string) bool {
+	return campaignID != "" && p.campaigns[campaignID]
+}
+
+// apply 按RTA信号调整出价，基础出价替换策略出价后再乘以截断后的系数
+func (p *RTABidPolicy) apply(price float64, signal *RTASignal) (float64, rtaResult) {
+	var result rtaResult
+	adjusted := price
+	if signal.BaseBid > 0 {
+		adjusted = signal.BaseBid
+	}
+	if m := signal.BidMultiplier; m > 0 {
+		switch {
+		case m < p.minMultiplier:
+			m, result.clamped = p.minMultiplier, true
+		case m > p.maxMultiplier:
+			m, result.clamped = p.maxMultiplier, true
+		}
+		adjusted *= m
+	}
+
+	switch {
+	case adjusted > price:
+		result.direction = rtaRaised
+	case adjusted < price:
+		result.direction = rtaLowered
+	default:
+		result.direction = rtaUnchanged
+	}
+	return adjusted, result
+}
+
+// observeRTA 记录RTA对出价的调整
+func (e *Engine) observeRTA(r rtaResult) {
+	if r.direction == "" {
+		return
+	}
+	e.metrics.Bid.RTAAdjustments.WithLabelValues(r.direction, strconv.FormatBool(r.clamped)).Inc()
+}
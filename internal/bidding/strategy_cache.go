@@ -0,0 +1,437 @@
+package bidding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/timezone"
+)
+
+const (
+	// StrategyChangeChannel 出价策略变更通知频道
+	StrategyChangeChannel = "bid_strategy_changes"
+
+	// defaultStrategyRefreshInterval 默认刷新间隔
+	defaultStrategyRefreshInterval = 30 * time.Second
+
+	// strategyPageSize 全量加载时的分页大小
+	strategyPageSize = 500
+
+	// strategySnapshotCache 策略快照的两级缓存名称，快照在Redis中由所有实例共享
+	strategySnapshotCache = "strategies"
+	// strategySnapshotKey 启用策略快照的键
+	strategySnapshotKey = "active"
+
+	// strategyRefreshTimeout 竞价路径触发的后台刷新的超时时间
+	strategyRefreshTimeout = 10 * time.Second
+	// maxStrategyRetryBackoff 连续刷新失败后重试间隔的上限
+	maxStrategyRetryBackoff = 5 * time.Minute
+)
+
+// StrategyChangeEvent 出价策略变更事件
+type StrategyChangeEvent struct {
+	StrategyID string `json:"strategy_id"`
+	Action     string `json:"action"`
+}
+
+// strategySnapshot 启用的出价策略及其关联素材
+type strategySnapshot struct {
+	Strategies []BidStrategy                    `json:"strategies"`
+	Creatives  map[string][]BidStrategyCreative `json:"creatives"`
+}
+
+// StrategyCache 出价策略内存缓存
+// 缓存所有启用的出价策略及其关联素材，竞价时直接读取内存，不访问数据库
+// 全量快照同时保存在Redis中，多个实例在一个刷新间隔内只有一个从数据库加载
+type StrategyCache struct {
+	repository Repository
+	redis      *redis.Client
+	interval   time.Duration
+	logger     *logger.Logger
+	snapshots  *cache.Tiered[strategySnapshot]
+
+	mu         sync.RWMutex
+	strategies []BidStrategy
+	creatives  map[string][]BidStrategyCreative
+	categories map[string]string
+	campaigns  []string
+	// loaded 是否加载成功过，loadedAt被标记过期后仍可使用旧数据
+	loaded   bool
+	loadedAt time.Time
+	// loadStarted 最近一次成功刷新开始加载的时间
+	loadStarted time.Time
+	// failures 连续刷新失败的次数，retryAt之前竞价路径不再触发刷新
+	failures int
+	retryAt  time.Time
+	lastErr  error
+	budgets  DailyBudgetSyncer
+	zones    *timezone.Zones
+
+	refreshMu sync.Mutex
+	// refreshing 是否有竞价路径触发的后台刷新正在进行
+	refreshing atomic.Bool
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewStrategyCache 创建出价策略缓存
+// redisClient为nil时仅按间隔定时刷新
+func NewStrategyCache(repository Repository, redisClient *redis.Client, interval time.Duration, logger *logger.Logger) *StrategyCache {
+	if interval <= 0 {
+		interval = defaultStrategyRefreshInterval
+	}
+	c := &StrategyCache{
+		repository: repository,
+		redis:      redisClient,
+		interval:   interval,
+		logger:     logger,
+		creatives:  make(map[string][]BidStrategyCreative),
+		categories: make(map[string]string),
+	}
+
+	var rdb redis.UniversalClient
+	if redisClient != nil {
+		rdb = redisClient
+	}
+	c.snapshots = cache.NewTiered(cache.TieredOptions{
+		Name:      strategySnapshotCache,
+		Size:      1,
+		LocalTTL:  interval,
+		RemoteTTL: interval,
+	}, rdb, c.load, logger)
+	return c
+}
+
+// Start 加载全量策略并启动后台刷新
+func (c *StrategyCache) Start(ctx context.Context) error {
+	if err := c.Refresh(ctx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancelFunc = cancel
+
+	c.wg.Add(1)
+	go c.refreshLoop(ctx)
+
+	if c.redis != nil {
+		c.wg.Add(1)
+		go c.watchChanges(ctx)
+	}
+
+	return nil
+}
+
+// Stop 停止后台刷新
+func (c *StrategyCache) Stop() {
+	if c.cancelFunc != nil {
+		c.cancelFunc()
+	}
+	c.wg.Wait()
+}
+
+// SetBudgetSyncer 设置日预算同步，每次刷新后同步启用策略的日预算，已加载的策略立即同步
+func (c *StrategyCache) SetBudgetSyncer(syncer DailyBudgetSyncer) {
+	c.mu.Lock()
+	c.budgets = syncer
+	strategies, loaded := c.strategies, c.loaded
+	c.mu.Unlock()
+
+	if syncer != nil && loaded {
+		syncer.SyncDailyBudgets(dailyBudgets(strategies))
+	}
+}
+
+// SetTimezones 设置时区，每次刷新后先同步策略所属的推广计划再同步日预算，已加载的策略立即同步
+func (c *StrategyCache) SetTimezones(zones *timezone.Zones) {
+	c.mu.Lock()
+	c.zones = zones
+	strategies, loaded := c.strategies, c.loaded
+	c.mu.Unlock()
+
+	if loaded {
+		zones.SetAdCampaigns(adCampaigns(strategies))
+	}
+}
+
+// ActiveStrategies 获取启用的出价策略
+// 尚未加载时同步加载；缓存过期时返回旧数据并在后台刷新，连续刷新失败后按退避间隔重试
+func (c *StrategyCache) ActiveStrategies(ctx context.Context) ([]BidStrategy, error) {
+	c.mu.RLock()
+	strategies, loaded, loadedAt := c.strategies, c.loaded, c.loadedAt
+	retryAt, lastErr := c.retryAt, c.lastErr
+	c.mu.RUnlock()
+
+	if loaded && time.Since(loadedAt) < c.interval {
+		return strategies, nil
+	}
+	// 刷新失败后的退避期间不访问存储
+	backoff := time.Now().Before(retryAt)
+
+	if !loaded {
+		if backoff {
+			return nil, lastErr
+		}
+		if err := c.Refresh(ctx); err != nil {
+			return nil, err
+		}
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.strategies, nil
+	}
+
+	if !backoff {
+		c.refreshAsync()
+	}
+	return strategies, nil
+}
+
+// refreshAsync 在后台刷新缓存，同一时间只有一个后台刷新
+func (c *StrategyCache) refreshAsync() {
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.refreshing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), strategyRefreshTimeout)
+		defer cancel()
+		if err := c.Refresh(ctx); err != nil {
+			c.logger.Warn("刷新出价策略缓存失败，使用旧数据", "error", err)
+		}
+	}()
+}
+
+// Creatives 获取策略关联的素材
+func (c *StrategyCache) Creatives(strategyID string) []BidStrategyCreative {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.creatives[strategyID]
+}
+
+// Category 获取策略所属类目，策略不在缓存中或未设置类目时返回空字符串
+func (c *StrategyCache) Category(strategyID string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.categories[strategyID]
+}
+
+// Campaigns 获取启用策略所属的推广计划
+func (c *StrategyCache) Campaigns() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.campaigns
+}
+
+// Refresh 从存储全量加载启用的策略
+func (c *StrategyCache) Refresh(ctx context.Context) error {
+	requested := time.Now()
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	// 等待期间其他协程已完成一次在本次调用之后开始的刷新
+	c.mu.RLock()
+	fresh := c.loaded && !c.loadedAt.IsZero() && !c.loadStarted.Before(requested)
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	if c.repository == nil {
+		return c.fail(ErrRepositoryUnavailable)
+	}
+
+	started := time.Now()
+	snapshot, err := c.snapshots.Get(ctx, strategySnapshotKey)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	categories := make(map[string]string, len(snapshot.Strategies))
+	seen := make(map[string]bool)
+	var campaigns []string
+	for _, strategy := range snapshot.Strategies {
+		if strategy.Category != "" {
+			categories[strategy.ID] = strategy.Category
+		}
+		if strategy.CampaignID != "" && !seen[strategy.CampaignID] {
+			seen[strategy.CampaignID] = true
+			campaigns = append(campaigns, strategy.CampaignID)
+		}
+	}
+	creatives := snapshot.Creatives
+	if creatives == nil {
+		creatives = make(map[string][]BidStrategyCreative)
+	}
+
+	c.mu.Lock()
+	c.strategies = snapshot.Strategies
+	c.creatives = creatives
+	c.categories = categories
+	c.campaigns = campaigns
+	c.loaded = true
+	c.loadedAt = time.Now()
+	c.loadStarted = started
+	c.failures, c.retryAt, c.lastErr = 0, time.Time{}, nil
+	syncer, zones := c.budgets, c.zones
+	c.mu.Unlock()
+
+	// 日预算按策略所属推广计划的时区续期，先同步推广计划
+	zones.SetAdCampaigns(adCampaigns(snapshot.Strategies))
+	if syncer != nil {
+		syncer.SyncDailyBudgets(dailyBudgets(snapshot.Strategies))
+	}
+
+	c.logger.Debug("出价策略缓存已刷新", "count", len(snapshot.Strategies))
+	return nil
+}
+
+// fail 记录一次刷新失败，重试间隔从刷新间隔开始按次数翻倍，不超过maxStrategyRetryBackoff
+func (c *StrategyCache) fail(err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	backoff := c.interval << min(c.failures, 16)
+	if backoff <= 0 || backoff > maxStrategyRetryBackoff {
+		backoff = maxStrategyRetryBackoff
+	}
+	c.failures++
+	c.retryAt = time.Now().Add(backoff)
+	c.lastErr = err
+	return err
+}
+
+// dailyBudgets 策略ID到日预算的映射
+func dailyBudgets(strategies []BidStrategy) map[string]float64 {
+	budgets := make(map[string]float64, len(strategies))
+	for _, strategy := range strategies {
+		budgets[strategy.ID] = float64(strategy.DailyBudget)
+	}
+	return budgets
+}
+
+// adCampaigns 策略ID到所属推广计划的映射，不属于推广计划的策略映射为空，使用默认时区
+func adCampaigns(strategies []BidStrategy) map[string]string {
+	campaigns := make(map[string]string, len(strategies))
+	for _, strategy := range strategies {
+		campaigns[strategy.ID] = strategy.CampaignID
+	}
+	return campaigns
+}
+
+// load 从存储分页加载启用的策略及其关联素材
+func (c *StrategyCache) load(ctx context.Context, _ string) (strategySnapshot, error) {
+	snapshot := strategySnapshot{Creatives: make(map[string][]BidStrategyCreative)}
+	for page := 1; ; page++ {
+		strategies, total, err := c.repository.ListBidStrategies(ctx, BidStrategyFilter{
+			Page:     page,
+			PageSize: strategyPageSize,
+		})
+		if err != nil {
+			return strategySnapshot{}, fmt.Errorf("加载出价策略失败: %w", err)
+		}
+
+		for _, strategy := range strategies {
+			if strategy.Status == StrategyStatusEnabled {
+				snapshot.Strategies = append(snapshot.Strategies, strategy)
+			}
+		}
+
+		if len(strategies) < strategyPageSize || int64(page*strategyPageSize) >= total {
+			break
+		}
+	}
+
+	for _, strategy := range snapshot.Strategies {
+		list, err := c.repository.ListCreatives(ctx, strategy.ID)
+		if err != nil {
+			return strategySnapshot{}, fmt.Errorf("加载策略素材失败: %w", err)
+		}
+		snapshot.Creatives[strategy.ID] = list
+	}
+	return snapshot, nil
+}
+
+// invalidate 标记缓存过期
+func (c *StrategyCache) invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+	c.snapshots.Forget(strategySnapshotKey)
+}
+
+// refreshLoop 定时刷新
+func (c *StrategyCache) refreshLoop(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.invalidate()
+			if err := c.Refresh(ctx); err != nil {
+				c.logger.Error("定时刷新出价策略缓存失败", "error", err)
+			}
+		}
+	}
+}
+
+// watchChanges 监听策略变更通知
+func (c *StrategyCache) watchChanges(ctx context.Context) {
+	defer c.wg.Done()
+
+	pubsub := c.redis.Subscribe(ctx, StrategyChangeChannel)
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var event StrategyChangeEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				c.logger.Warn("解析策略变更通知失败", "error", err)
+				continue
+			}
+
+			c.invalidate()
+			if err := c.Refresh(ctx); err != nil {
+				c.logger.Error("刷新出价策略缓存失败",
+					"strategy_id", event.StrategyID,
+					"action", event.Action,
+					"error", err)
+			}
+		}
+	}
+}
+
+// PublishStrategyChange 删除Redis中的策略快照并发布策略变更通知
+func PublishStrategyChange(ctx context.Context, redisClient *redis.Client, strategyID, action string) error {
+	data, err := json.Marshal(StrategyChangeEvent{
+		StrategyID: strategyID,
+		Action:     action,
+	})
+	if err != nil {
+		return err
+	}
+	// 先删除共享快照，收到通知的实例从数据库加载新策略
+	if err := redisClient.Del(ctx, cache.RemoteKey(strategySnapshotCache, strategySnapshotKey)).Err(); err != nil {
+		return fmt.Errorf("删除出价策略快照失败: %w", err)
+	}
+	return redisClient.Publish(ctx, StrategyChangeChannel, data).Err()
+}
@@ -0,0 +1,45 @@
+package bidding
+
+// SupplyChainPolicy 要求已授权供应链的推广计划
+type SupplyChainPolicy struct {
+	campaigns map[string]bool
+}
+
+// NewSupplyChainPolicy 创建供应链策略，campaigns中的推广计划只参与供应链已授权的请求
+func NewSupplyChainPolicy(campaigns []string) *SupplyChainPolicy {
+	p := &SupplyChainPolicy{campaigns: make(map[string]bool, len(campaigns))}
+	for _, id := range campaigns {
+		p.campaigns[id] = true
+	}
+	return p
+}
+
+// requires 推广计划是否要求已授权的供应链
+func (p *SupplyChainPolicy) requires(campaignID string) bool {
+	return p != nil && campaignID != "" && p.campaigns[campaignID]
+}
+
+// requireSupplyChain 移除要求已授权供应链的推广计划的策略，没有移除时返回原切片
+func (e *Engine) requireSupplyChain(strategies []BidStrategy, policy *SupplyChainPolicy) []BidStrategy {
+	if policy == nil || len(policy.campaigns) == 0 {
+		return strategies
+	}
+	var kept []BidStrategy
+	for i := range strategies {
+		if !policy.requires(strategies[i].CampaignID) {
+			if kept != nil {
+				kept = append(kept, strategies[i])
+			}
+			continue
+		}
+		e.metrics.Bid.Rejections.WithLabelValues(rejectStagePrefilter, rejectSupplyChain).Inc()
+		if kept == nil {
+			kept = make([]BidStrategy, i, len(strategies)-1)
+			copy(kept, strategies[:i])
+		}
+	}
+	if kept == nil {
+		return strategies
+	}
+	return kept
+}
@@ -19,6 +19,7 @@
  *
  * 依赖关系:
  * - time
+ * - simple-dsp/internal/profile
  * - simple-dsp/pkg/metrics
  *
  * 注意事项:
@@ -32,6 +33,8 @@ package bidding
 
 import (
 	"time"
+
+	"simple-dsp/internal/profile"
 )
 
 // BidRequest 竞价请求
@@ -40,7 +43,30 @@ type BidRequest struct {
 	UserID    string   `json:"user_id"`
 	DeviceID  string   `json:"device_id"`
 	IP        string   `json:"ip"`
+	Exchange  string   `json:"exchange"`
 	AdSlots   []AdSlot `json:"ad_slots"`
+	// RTA RTA返回的出价信号，为nil时按策略出价
+	RTA *RTASignal `json:"rta,omitempty"`
+	// RTACampaigns 绑定了RTA任务的推广计划的查询结果，未定向的推广计划不参与竞价，不在其中的推广计划不受限制
+	RTACampaigns map[string]RTAResult `json:"rta_campaigns,omitempty"`
+	// SupplyChainAuthorized 请求的供应链已通过验证，要求已授权供应链的推广计划只在为true时参与竞价
+	SupplyChainAuthorized bool `json:"supply_chain_authorized,omitempty"`
+	// Profile 调用方已读取的用户特征，ProfileLoaded为true时使用该值，不再读取
+	Profile       *profile.Profile `json:"-"`
+	ProfileLoaded bool             `json:"-"`
+	// Segments 用户所属的人群包
+	Segments []string `json:"segments,omitempty"`
+	// Frequency 调用方缓存的频次快照，为nil时每个候选都实时检查频次
+	Frequency FrequencySnapshot `json:"-"`
+}
+
+// FrequencySnapshot 用户的频次快照，记录短时间内频次已达上限的策略
+// 快照只用于提前跳过候选，是否可以出价仍以占用曝光的结果为准
+type FrequencySnapshot interface {
+	// Capped 策略的频次是否已达上限
+	Capped(strategyID string) bool
+	// MarkCapped 记录频次已达上限的策略
+	MarkCapped(strategyID string)
 }
 
 // AdSlot 广告位信息
@@ -50,9 +76,11 @@ type AdSlot struct {
 	Height   int     `json:"height"`
 	MinPrice float64 `json:"min_price"`
 	MaxPrice float64 `json:"max_price"`
-	Position string  `json:"position"`
-	AdType   string  `json:"ad_type"`
-	BidType  string  `json:"bid_type"`
+	// Currency MinPrice和MaxPrice的货币，ISO 4217代码，为空时为系统货币
+	Currency string `json:"currency,omitempty"`
+	Position string `json:"position"`
+	AdType   string `json:"ad_type"`
+	BidType  string `json:"bid_type"`
 }
 
 // BidResponse 竞价响应
@@ -63,6 +91,8 @@ type BidResponse struct {
 	BidType   string  `json:"bid_type"`
 	AdMarkup  string  `json:"ad_markup"`
 	WinNotice string  `json:"win_notice"`
+	// CreativeID 按轮换权重选出的素材，策略没有可用素材时为空；展示和点击事件携带该ID按素材统计CTR
+	CreativeID string `json:"creative_id,omitempty"`
 }
 
 // BidStrategy 出价策略
@@ -72,19 +102,55 @@ type BidStrategy struct {
 	BidType       string    `json:"bid_type"`
 	Price         float64   `json:"price"`
 	Status        int       `json:"status"`
-	DailyBudget   int       `json:"daily_budget"`
+	DailyBudget   int       `json:"daily_budget"` // 日预算，与出价单位相同，大于0时预算管理器按续期时间每日重新计算
 	IsPriceLocked bool      `json:"is_price_locked"`
+	Priority      int       `json:"priority"`           // 优先级，高优先级策略先于低优先级参与排序
+	Weight        float64   `json:"weight"`             // 投放权重，同优先级内与eCPM相乘，0按1处理
+	Category      string    `json:"category"`           // 投放类目，用于按类目统计用户特征
+	CampaignID    string    `json:"campaign_id"`        // 所属推广计划，同一计划的策略共用计划的QPS限制
+	Participation float64   `json:"participation_rate"` // 参与竞价的请求比例，按请求ID哈希抽样，0按1处理
+	Dayparting    string    `json:"dayparting"`         // 分时投放，按推广计划时区的星期和小时，见DaypartingHours
 	CreateTime    time.Time `json:"create_time"`
 	UpdateTime    time.Time `json:"update_time"`
 }
 
+// 出价策略状态
+const (
+	// StrategyStatusDisabled 禁用
+	StrategyStatusDisabled = 0
+	// StrategyStatusEnabled 启用
+	StrategyStatusEnabled = 1
+	// StrategyStatusArchived 归档，不再参与竞价
+	StrategyStatusArchived = 2
+)
+
+// 策略优先级
+const (
+	// PriorityOpenAuction 公开竞价
+	PriorityOpenAuction = 0
+	// PriorityPreferred 优先交易
+	PriorityPreferred = 1
+	// PriorityGuaranteed 保量投放
+	PriorityGuaranteed = 2
+)
+
+// 计费类型
+const (
+	// BidTypeCPC 按点击计费，出价单位为元
+	BidTypeCPC = "CPC"
+	// BidTypeCPM 按千次曝光计费，出价单位为分
+	BidTypeCPM = "CPM"
+)
+
 // BidStrategyFilter 出价策略过滤条件
 type BidStrategyFilter struct {
-	Page     int    `json:"page"`
-	PageSize int    `json:"page_size"`
-	BidType  string `json:"bid_type"`
-	MinPrice *int   `json:"min_price"`
-	MaxPrice *int   `json:"max_type"`
+	Page       int      `json:"page"`
+	PageSize   int      `json:"page_size"`
+	BidType    string   `json:"bid_type"`
+	Status     *int     `json:"status"`
+	CampaignID string   `json:"campaign_id"`
+	MinPrice   *float64 `json:"min_price"`
+	MaxPrice   *float64 `json:"max_price"`
 }
 
 // Error BiddingError 竞价错误
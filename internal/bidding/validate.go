@@ -0,0 +1,76 @@
+package bidding
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAdSlots 单次请求允许的最大广告位数
+const maxAdSlots = 10
+
+// maxStrategyNameLength 策略名称的最大字符数，与bid_strategies.name列一致
+const maxStrategyNameLength = 50
+
+// ValidateRequest 校验竞价请求，gRPC与REST接入共用同一套规则
+func ValidateRequest(req *BidRequest) error {
+	if req.RequestID == "" {
+		return fmt.Errorf("%w: request_id不能为空", ErrInvalidBidRequest)
+	}
+	if req.UserID == "" {
+		return fmt.Errorf("%w: user_id不能为空", ErrInvalidBidRequest)
+	}
+	if len(req.AdSlots) == 0 {
+		return fmt.Errorf("%w: ad_slots不能为空", ErrInvalidBidRequest)
+	}
+	if len(req.AdSlots) > maxAdSlots {
+		return fmt.Errorf("%w: 广告位数量超过%d", ErrInvalidBidRequest, maxAdSlots)
+	}
+
+	for i := range req.AdSlots {
+		slot := &req.AdSlots[i]
+		if slot.SlotID == "" {
+			return fmt.Errorf("%w: 第%d个广告位缺少slot_id", ErrInvalidAdSlot, i)
+		}
+		if slot.Width <= 0 || slot.Height <= 0 {
+			return fmt.Errorf("%w: %s尺寸无效", ErrInvalidAdSlot, slot.SlotID)
+		}
+		if slot.MinPrice < 0 || slot.MaxPrice < 0 || slot.MinPrice > slot.MaxPrice {
+			return fmt.Errorf("%w: %s价格区间无效", ErrInvalidAdSlot, slot.SlotID)
+		}
+	}
+
+	return nil
+}
+
+// ValidateStrategy 校验出价策略
+// minPrice和maxPrice为竞价配置的出价范围，为0时不限制
+func ValidateStrategy(strategy *BidStrategy, minPrice, maxPrice float64) error {
+	switch {
+	case strings.TrimSpace(strategy.Name) == "":
+		return fmt.Errorf("%w: 名称不能为空", ErrInvalidStrategy)
+	case utf8.RuneCountInString(strategy.Name) > maxStrategyNameLength:
+		return fmt.Errorf("%w: 名称不能超过%d个字符", ErrInvalidStrategy, maxStrategyNameLength)
+	case strategy.BidType != BidTypeCPC && strategy.BidType != BidTypeCPM:
+		return fmt.Errorf("%w: 计费类型必须为%s或%s", ErrInvalidStrategy, BidTypeCPC, BidTypeCPM)
+	case strategy.Price <= 0:
+		return fmt.Errorf("%w: 出价必须大于0", ErrInvalidStrategy)
+	case minPrice > 0 && strategy.Price < minPrice:
+		return fmt.Errorf("%w: 出价不能低于%g", ErrInvalidStrategy, minPrice)
+	case maxPrice > 0 && strategy.Price > maxPrice:
+		return fmt.Errorf("%w: 出价不能高于%g", ErrInvalidStrategy, maxPrice)
+	case strategy.DailyBudget < 0:
+		return fmt.Errorf("%w: 日预算不能小于0", ErrInvalidStrategy)
+	case strategy.Status < StrategyStatusDisabled || strategy.Status > StrategyStatusArchived:
+		return fmt.Errorf("%w: 未知的状态%d", ErrInvalidStrategy, strategy.Status)
+	case strategy.Priority < PriorityOpenAuction || strategy.Priority > PriorityGuaranteed:
+		return fmt.Errorf("%w: 优先级必须在%d到%d之间", ErrInvalidStrategy, PriorityOpenAuction, PriorityGuaranteed)
+	case strategy.Weight < 0:
+		return fmt.Errorf("%w: 投放权重不能小于0", ErrInvalidStrategy)
+	case strategy.Participation < 0 || strategy.Participation > 1:
+		return fmt.Errorf("%w: 参与率必须在0到1之间", ErrInvalidStrategy)
+	case !validDayparting(strategy.Dayparting):
+		return fmt.Errorf("%w: 分时投放必须为空或%d个0/1字符", ErrInvalidStrategy, DaypartingHours)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: billing.go
+ * Project: simple-dsp
+ * Description: 消耗的费用构成，按媒体成本计算平台服务费和税费
+ *
+ * 主要功能:
+ * - 按配置的平台服务费率和税率拆分一笔消耗
+ * - 累加多笔消耗的媒体成本、服务费和税费
+ *
+ * 实现细节:
+ * - 金额以分为单位的整数计算，服务费和税费四舍五入到分
+ * - 服务费 = 媒体成本 × 服务费率，税费 = (媒体成本 + 服务费) × 税率
+ * - 广告主应付金额为三者之和，平台收入为服务费，媒体成本支付给交易平台
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/config
+ *
+ * 注意事项:
+ * - 费率变更只影响之后的消耗，已记录的事件和流水保留记录时的拆分
+ * - 费率都为0时应付金额等于媒体成本
+ */
+
+package billing
+
+import (
+	"math"
+
+	"simple-dsp/pkg/config"
+)
+
+// Rates 平台服务费率和税率
+type Rates struct {
+	// Margin 平台服务费占媒体成本的比例
+	Margin float64
+	// TaxRate 税率，按媒体成本与服务费之和计算
+	TaxRate float64
+}
+
+// NewRates 按配置创建费率
+func NewRates(cfg config.BillingConfig) Rates {
+	return Rates{Margin: cfg.PlatformMargin, TaxRate: cfg.TaxRate}
+}
+
+// IsZero 判断是否不收取服务费和税费
+func (r Rates) IsZero() bool {
+	return r.Margin == 0 && r.TaxRate == 0
+}
+
+// Split 按媒体成本（分）计算服务费和税费
+func (r Rates) Split(mediaCost int64) Breakdown {
+	fee := int64(math.Round(float64(mediaCost) * r.Margin))
+	tax := int64(math.Round(float64(mediaCost+fee) * r.TaxRate))
+	return Breakdown{MediaCost: mediaCost, Fee: fee, Tax: tax}
+}
+
+// Breakdown 一笔或多笔消耗的费用构成，单位为分
+type Breakdown struct {
+	MediaCost int64 `json:"media_cost"`
+	Fee       int64 `json:"fee"`
+	Tax       int64 `json:"tax"`
+}
+
+// Total 广告主应付金额
+func (b Breakdown) Total() int64 {
+	return b.MediaCost + b.Fee + b.Tax
+}
+
+// Add 累加另一笔消耗
+func (b *Breakdown) Add(o Breakdown) {
+	b.MediaCost += o.MediaCost
+	b.Fee += o.Fee
+	b.Tax += o.Tax
+}
@@ -16,28 +16,44 @@
  * - 实现原子预算扣减
  * - 支持多级预算控制
  * - 提供预算统计功能
+ * - 按出价策略的日预算自动创建预算，到续期时间后重新计算
+ * - 续期时间按策略所属推广计划的时区计算，未设置时区时使用服务器时区
+ * - 设置费率后按含平台服务费和税费的总额扣减，服务费和税费另行累计
+ * - 启动时从Redis读取已有预算的花费，之后定时刷新并保存快照，重启后状态接口立即显示正确的花费
  *
  * 依赖关系:
+ * - simple-dsp/internal/billing
+ * - simple-dsp/internal/webhook
  * - simple-dsp/pkg/clients
+ * - simple-dsp/pkg/clock
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/timezone
  *
  * 注意事项:
  * - 确保预算扣减的原子性
  * - 注意处理并发访问
  * - 合理设置预算预警阈值
  * - 注意数据一致性
+ * - 策略日预算的花费按续期周期保存在Redis中，多个实例共享
+ * - 策略的时区变更后，下一次同步时从新时区的当前周期开始计算
+ * - 快照只在Redis中的花费丢失时使用，Redis中的花费始终优先
  */
 
 package budget
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
+	"simple-dsp/internal/billing"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/timezone"
 
 	"github.com/go-redis/redis/v8"
 )
@@ -52,12 +68,14 @@ const (
 	TotalBudget Type = "total"
 )
 
-// Budget 预算信息
+// Budget 预算信息，Spent为含服务费和税费的总花费，Fee和Tax为其中的服务费和税费
 type Budget struct {
 	ID          string    `json:"id"`
 	Type        Type      `json:"type"`
 	Amount      float64   `json:"amount"`
 	Spent       float64   `json:"spent"`
+	Fee         float64   `json:"fee"`
+	Tax         float64   `json:"tax"`
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
 	UpdateTime  time.Time `json:"update_time"`
@@ -65,6 +83,9 @@ type Budget struct {
 	Description string    `json:"description"`
 }
 
+// strategyBudgetTTL 策略日预算花费在Redis中的保留时间，覆盖一个续期周期和跨周期的延迟扣减
+const strategyBudgetTTL = 48 * time.Hour
+
 // Manager 预算管理器
 type Manager struct {
 	budgets     map[string]*Budget
@@ -72,18 +93,135 @@ type Manager struct {
 	logger      *logger.Logger
 	metrics     *metrics.Metrics
 	redisClient *redis.Client
+	notifier    webhook.Notifier
+
+	// strategyBudgets 按出价策略日预算自动创建的预算
+	strategyBudgets map[string]bool
+	// renewalOffset 日预算续期时间距零点的偏移
+	renewalOffset time.Duration
+	// zones 策略所属推广计划的时区，为nil时使用服务器时区
+	zones *timezone.Zones
+	// rates 平台服务费率和税率，为零值时只扣减媒体成本
+	rates billing.Rates
+	// clock 判断预算周期和续期的时间来源
+	clock clock.Clock
+	// snapshots 花费快照存储，为nil时只从Redis恢复花费
+	snapshots SnapshotStore
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
 }
 
 // NewManager 创建新的预算管理器
 func NewManager(redisClient *redis.Client, logger *logger.Logger, metrics *metrics.Metrics) *Manager {
 	return &Manager{
-		budgets:     make(map[string]*Budget),
-		logger:      logger,
-		metrics:     metrics,
-		redisClient: redisClient,
+		budgets:         make(map[string]*Budget),
+		logger:          logger,
+		metrics:         metrics,
+		redisClient:     redisClient,
+		strategyBudgets: make(map[string]bool),
+		clock:           clock.Real(),
+	}
+}
+
+// SetRenewalTime 设置策略日预算的续期时间，格式为15:04:05，为空时在零点续期
+func (m *Manager) SetRenewalTime(renewalTime string) error {
+	var offset time.Duration
+	if renewalTime != "" {
+		t, err := time.Parse("15:04:05", renewalTime)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidBudgetTime, renewalTime)
+		}
+		offset = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.renewalOffset = offset
+	return nil
+}
+
+// SetTimezones 设置策略日预算续期使用的时区，为nil时使用服务器时区
+func (m *Manager) SetTimezones(zones *timezone.Zones) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.zones = zones
+}
+
+// SetBillingRates 设置平台服务费率和税率，设置后按含服务费和税费的总额扣减预算
+func (m *Manager) SetBillingRates(rates billing.Rates) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rates = rates
+}
+
+// SetClock 设置判断预算周期和续期的时间来源，为nil时使用系统时钟
+func (m *Manager) SetClock(c clock.Clock) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.clock = clock.OrReal(c)
+}
+
+// SyncDailyBudgets 按出价策略的日预算同步预算，budgets为策略ID到日预算的映射
+// 日预算为0或不在budgets中的策略不限制预算；与手动添加的预算ID相同时保留手动添加的预算
+func (m *Manager) SyncDailyBudgets(budgets map[string]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.clock.Now()
+
+	for id, amount := range budgets {
+		if amount <= 0 {
+			continue
+		}
+		budget, exists := m.budgets[id]
+		if exists && !m.strategyBudgets[id] {
+			continue
+		}
+		loc := m.zones.Ad(id)
+		if exists {
+			if budget.StartTime.Location() != loc {
+				// 时区变更，从新时区的当前周期开始计算，日期相同时沿用该日期已记录的花费
+				previous := getDailyBudgetKey(id, budget.StartTime)
+				budget.StartTime, budget.EndTime = m.period(now, loc)
+				if getDailyBudgetKey(id, budget.StartTime) != previous {
+					budget.Spent, budget.Fee, budget.Tax = 0, 0, 0
+				}
+			}
+			m.renew(budget, now)
+			budget.Amount = amount
+			budget.UpdateTime = now
+			continue
+		}
+		start, end := m.period(now, loc)
+		m.budgets[id] = &Budget{
+			ID:          id,
+			Type:        DailyBudget,
+			Amount:      amount,
+			StartTime:   start,
+			EndTime:     end,
+			UpdateTime:  now,
+			Status:      "active",
+			Description: "出价策略日预算",
+		}
+		m.strategyBudgets[id] = true
+	}
+
+	for id := range m.strategyBudgets {
+		if budgets[id] <= 0 {
+			delete(m.budgets, id)
+			delete(m.strategyBudgets, id)
+		}
 	}
 }
 
+// SetNotifier 设置事件通知，为nil时不发送通知
+func (m *Manager) SetNotifier(notifier webhook.Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifier = notifier
+}
+
 // AddBudget 添加预算
 func (m *Manager) AddBudget(budget *Budget) error {
 	m.mu.Lock()
@@ -123,44 +261,142 @@ func (m *Manager) GetBudget(id string) (*Budget, error) {
 	return budget, nil
 }
 
+// HasBudget 检查预算是否有效且余额足够，不扣减预算，用于竞价排序前过滤
+func (m *Manager) HasBudget(budgetID string, amount float64) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.rates.IsZero() {
+		amount = float64(m.rates.Split(int64(amount*100)).Total()) / 100
+	}
+
+	budget, exists := m.budgets[budgetID]
+	if !exists || budget.Status != "active" {
+		return false
+	}
+	now := m.clock.Now()
+	if m.strategyBudgets[budgetID] && !now.Before(budget.EndTime) {
+		// 已到续期时间，下一次扣减时续期
+		return amount <= budget.Amount
+	}
+	if now.Before(budget.StartTime) || now.After(budget.EndTime) {
+		return false
+	}
+	return budget.Spent+amount <= budget.Amount
+}
+
 // CheckAndDeduct 检查并扣除预算
+// 只在读写内存中的预算时持有锁，Redis扣减和预算用尽通知在锁外进行，避免Redis变慢时阻塞其他预算的检查
 func (m *Manager) CheckAndDeduct(ctx context.Context, budgetID string, amount float64) (bool, error) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	budget, exists := m.budgets[budgetID]
 	if !exists {
+		m.mu.Unlock()
 		return false, ErrBudgetNotFound
 	}
 
 	// 检查预算状态
 	if budget.Status != "active" {
+		m.mu.Unlock()
 		return false, ErrBudgetInactive
 	}
 
-	// 检查预算时间
-	now := time.Now()
+	// 检查预算时间，策略日预算到续期时间后重新计算
+	now := m.clock.Now()
+	daily := m.strategyBudgets[budgetID]
+	if daily {
+		m.renew(budget, now)
+	}
 	if now.Before(budget.StartTime) || now.After(budget.EndTime) {
+		m.mu.Unlock()
 		return false, ErrBudgetExpired
 	}
 
+	// 按媒体成本计算服务费和税费，扣减含服务费和税费的总额
+	split := m.rates.Split(int64(amount * 100)) // 转换为分
+	cents := split.Total()
+
 	// 检查预算余额
-	if budget.Spent+amount > budget.Amount {
+	if budget.Spent+float64(cents)/100 > budget.Amount {
+		m.mu.Unlock()
 		return false, ErrBudgetExceeded
 	}
 
-	// 使用Redis进行原子性扣除
 	key := getBudgetKey(budgetID)
-
-	newSpent := m.redisClient.IncrBy(ctx, key, int64(amount*100)).Val() // 转换为分
-	if err := m.redisClient.IncrBy(ctx, key, int64(amount*100)).Err(); err != nil {
+	if daily {
+		key = getDailyBudgetKey(budgetID, budget.StartTime)
+	}
+	fees := !m.rates.IsZero()
+	period, limit := budget.StartTime, budget.Amount
+	m.mu.Unlock()
+
+	// 使用Redis进行原子性扣除，其他实例的扣减使余额不足时撤销本次扣除
+	pipe := m.redisClient.Pipeline()
+	incr := pipe.IncrBy(ctx, key, cents)
+	var feeIncr, taxIncr *redis.IntCmd
+	if fees {
+		feeIncr = pipe.IncrBy(ctx, key+":fee", split.Fee)
+		taxIncr = pipe.IncrBy(ctx, key+":tax", split.Tax)
+	}
+	if daily {
+		pipe.Expire(ctx, key, strategyBudgetTTL)
+		if fees {
+			pipe.Expire(ctx, key+":fee", strategyBudgetTTL)
+			pipe.Expire(ctx, key+":tax", strategyBudgetTTL)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
 		m.logger.Error("扣除预算失败", "error", err, "budget_id", budgetID)
 		return false, err
 	}
+	newSpent := incr.Val()
+	exceeded := float64(newSpent) > limit*100
+	if exceeded {
+		pipe := m.redisClient.Pipeline()
+		pipe.DecrBy(ctx, key, cents)
+		if fees {
+			pipe.DecrBy(ctx, key+":fee", split.Fee)
+			pipe.DecrBy(ctx, key+":tax", split.Tax)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			m.logger.Error("撤销预算扣除失败", "error", err, "budget_id", budgetID)
+		}
+		newSpent -= cents
+	}
 
-	// 更新内存中的预算信息
-	budget.Spent = float64(newSpent) / 100
-	budget.UpdateTime = now
+	// 更新内存中的预算信息，扣减期间预算被替换或已续期时不更新
+	// 并发扣减的结果可能乱序到达，只保留较大的花费
+	m.mu.Lock()
+	current := m.budgets[budgetID] == budget && budget.StartTime.Equal(period)
+	available := budget.Spent < budget.Amount
+	if current && float64(newSpent)/100 > budget.Spent {
+		budget.Spent = float64(newSpent) / 100
+		if fees && !exceeded {
+			budget.Fee = float64(feeIncr.Val()) / 100
+			budget.Tax = float64(taxIncr.Val()) / 100
+		}
+		budget.UpdateTime = now
+	}
+	notifier := m.notifier
+	var exhausted map[string]interface{}
+	if current && !exceeded && available && budget.Spent >= budget.Amount {
+		exhausted = map[string]interface{}{
+			"budget_id": budget.ID,
+			"type":      budget.Type,
+			"amount":    budget.Amount,
+			"spent":     budget.Spent,
+		}
+	}
+	m.mu.Unlock()
+
+	if exceeded {
+		return false, ErrBudgetExceeded
+	}
+
+	// 本次扣减后预算用尽时通知
+	if exhausted != nil && notifier != nil {
+		notifier.Notify(ctx, webhook.EventBudgetExhausted, exhausted)
+	}
 
 	// 更新指标
 	//m.metrics.BudgetSpent.WithLabelValues(budgetID).Set(budget.Spent)
@@ -179,12 +415,15 @@ func (m *Manager) GetBudgetStatus(budgetID string) (*BudgetStatus, error) {
 		return nil, ErrBudgetNotFound
 	}
 
-	now := time.Now()
+	now := m.clock.Now()
 	status := &BudgetStatus{
 		ID:          budget.ID,
 		Type:        budget.Type,
 		Amount:      budget.Amount,
 		Spent:       budget.Spent,
+		MediaCost:   budget.Spent - budget.Fee - budget.Tax,
+		Fee:         budget.Fee,
+		Tax:         budget.Tax,
 		Remaining:   budget.Amount - budget.Spent,
 		StartTime:   budget.StartTime,
 		EndTime:     budget.EndTime,
@@ -199,12 +438,15 @@ func (m *Manager) GetBudgetStatus(budgetID string) (*BudgetStatus, error) {
 	return status, nil
 }
 
-// BudgetStatus 预算状态信息
+// BudgetStatus 预算状态信息，Spent为MediaCost、Fee和Tax之和
 type BudgetStatus struct {
 	ID          string    `json:"id"`
 	Type        Type      `json:"type"`
 	Amount      float64   `json:"amount"`
 	Spent       float64   `json:"spent"`
+	MediaCost   float64   `json:"media_cost"`
+	Fee         float64   `json:"fee"`
+	Tax         float64   `json:"tax"`
 	Remaining   float64   `json:"remaining"`
 	StartTime   time.Time `json:"start_time"`
 	EndTime     time.Time `json:"end_time"`
@@ -216,7 +458,33 @@ type BudgetStatus struct {
 	Description string    `json:"description"`
 }
 
-// getBudgetKey 获取预算Redis键
+// period 返回now在loc中所在的日预算续期周期，调用方持有锁
+// 续期时间按loc的墙上时间计算，夏令时切换当天的周期比24小时长或短
+func (m *Manager) period(now time.Time, loc *time.Location) (time.Time, time.Time) {
+	y, mo, d := now.In(loc).Date()
+	start := time.Date(y, mo, d, 0, 0, int(m.renewalOffset/time.Second), 0, loc)
+	if now.Before(start) {
+		start = start.AddDate(0, 0, -1)
+	}
+	return start, start.AddDate(0, 0, 1)
+}
+
+// renew 策略日预算到续期时间后进入新的周期并清空花费，调用方持有锁
+func (m *Manager) renew(budget *Budget, now time.Time) {
+	if now.Before(budget.EndTime) {
+		return
+	}
+	budget.StartTime, budget.EndTime = m.period(now, budget.StartTime.Location())
+	budget.Spent, budget.Fee, budget.Tax = 0, 0, 0
+	budget.UpdateTime = now
+}
+
+// getBudgetKey 获取预算Redis键，服务费和税费分别累计在{键}:fee和{键}:tax中
 func getBudgetKey(budgetID string) string {
 	return "budget:spent:" + budgetID
 }
+
+// getDailyBudgetKey 获取策略日预算在续期周期内的花费Redis键，日期为周期开始时在策略时区中的日期
+func getDailyBudgetKey(budgetID string, start time.Time) string {
+	return "budget:spent:" + budgetID + ":" + start.Format("20060102")
+}
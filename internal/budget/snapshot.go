@@ -0,0 +1,311 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+const (
+	// defaultSnapshotInterval 默认的刷新和快照间隔
+	defaultSnapshotInterval = 30 * time.Second
+	// snapshotRetention 花费快照的保留时间，超过时删除，覆盖策略日预算花费键的TTL
+	snapshotRetention = 7 * 24 * time.Hour
+)
+
+// SnapshotStore 预算花费快照存储，Redis中的花费丢失时用于恢复
+type SnapshotStore interface {
+	// Save 保存快照，同一预算同一周期的快照被覆盖
+	Save(ctx context.Context, snapshots []models.BudgetSnapshot) error
+	// Load 读取预算周期开始时间不早于since的快照
+	Load(ctx context.Context, budgetIDs []string, since time.Time) ([]models.BudgetSnapshot, error)
+	// Prune 删除更新时间早于before的快照
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// GormSnapshotStore 基于数据库的花费快照存储
+type GormSnapshotStore struct {
+	db *gorm.DB
+}
+
+// NewGormSnapshotStore 创建基于数据库的花费快照存储
+func NewGormSnapshotStore(db *gorm.DB) *GormSnapshotStore {
+	return &GormSnapshotStore{db: db}
+}
+
+// Save 按预算和周期覆盖保存快照
+func (s *GormSnapshotStore) Save(ctx context.Context, snapshots []models.BudgetSnapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+	return s.db.WithContext(database.WithQueryName(ctx, "budget.save_snapshots")).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "budget_id"}, {Name: "period_start"}},
+			DoUpdates: clause.AssignmentColumns([]string{"spent", "fee", "tax", "update_time"}),
+		}).
+		CreateInBatches(snapshots, 500).Error
+}
+
+// Load 读取预算的快照
+func (s *GormSnapshotStore) Load(ctx context.Context, budgetIDs []string, since time.Time) ([]models.BudgetSnapshot, error) {
+	var snapshots []models.BudgetSnapshot
+	err := s.db.WithContext(database.WithQueryName(ctx, "budget.load_snapshots")).
+		Where("budget_id IN ? AND period_start >= ?", budgetIDs, since).
+		Find(&snapshots).Error
+	return snapshots, err
+}
+
+// Prune 删除过期的快照
+func (s *GormSnapshotStore) Prune(ctx context.Context, before time.Time) error {
+	return s.db.WithContext(database.WithQueryName(ctx, "budget.prune_snapshots")).
+		Delete(&models.BudgetSnapshot{}, "update_time < ?", before).Error
+}
+
+// spendTarget 从Redis读取花费的预算及其花费键
+type spendTarget struct {
+	id    string
+	key   string
+	start time.Time
+	daily bool
+}
+
+// spend 以分为单位的花费
+type spend struct {
+	spent, fee, tax int64
+	ok              bool
+}
+
+// SetSnapshotStore 设置花费快照存储，为nil时只从Redis恢复花费
+func (m *Manager) SetSnapshotStore(store SnapshotStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.snapshots = store
+}
+
+// Start 从Redis恢复已有预算的花费，之后按interval刷新花费并保存快照，interval为0时使用30秒
+// 首次恢复失败时仍启动定时刷新，返回恢复的错误
+func (m *Manager) Start(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultSnapshotInterval
+	}
+	err := m.Hydrate(ctx)
+
+	loopCtx, cancel := context.WithCancel(context.Background())
+	m.cancelFunc = cancel
+	m.wg.Add(1)
+	go m.snapshotLoop(loopCtx, interval)
+
+	return err
+}
+
+// Stop 停止定时刷新，停止前保存一次快照
+func (m *Manager) Stop() {
+	if m.cancelFunc == nil {
+		return
+	}
+	m.cancelFunc()
+	m.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.Snapshot(ctx); err != nil {
+		m.logger.Warn("保存预算花费快照失败", "error", err)
+	}
+}
+
+// snapshotLoop 按间隔刷新花费并保存快照
+func (m *Manager) snapshotLoop(ctx context.Context, interval time.Duration) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tickCtx, cancel := context.WithTimeout(ctx, interval)
+			if err := m.Hydrate(tickCtx); err != nil {
+				m.logger.Warn("刷新预算花费失败", "error", err)
+			} else if err := m.Snapshot(tickCtx); err != nil {
+				m.logger.Warn("保存预算花费快照失败", "error", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Hydrate 从Redis读取所有预算当前周期的花费，更新内存中的花费
+// Redis中没有花费而快照中有同一周期的花费时，从快照恢复Redis中的花费
+// 内存中的花费只增不减，与读取期间的扣减并发时保留较大的值
+func (m *Manager) Hydrate(ctx context.Context) error {
+	m.mu.RLock()
+	targets := make([]spendTarget, 0, len(m.budgets))
+	for id, budget := range m.budgets {
+		target := spendTarget{id: id, key: getBudgetKey(id), start: budget.StartTime, daily: m.strategyBudgets[id]}
+		if target.daily {
+			target.key = getDailyBudgetKey(id, budget.StartTime)
+		}
+		targets = append(targets, target)
+	}
+	store := m.snapshots
+	m.mu.RUnlock()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	spends, err := m.readSpends(ctx, targets)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		if err := m.restore(ctx, store, targets, spends); err != nil {
+			m.logger.Warn("从快照恢复预算花费失败", "error", err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, target := range targets {
+		s := spends[i]
+		budget, exists := m.budgets[target.id]
+		if !s.ok || !exists || !budget.StartTime.Equal(target.start) {
+			continue
+		}
+		if spent := float64(s.spent) / 100; spent >= budget.Spent {
+			budget.Spent = spent
+			budget.Fee = float64(s.fee) / 100
+			budget.Tax = float64(s.tax) / 100
+		}
+	}
+	return nil
+}
+
+// Snapshot 保存所有有花费的预算在当前周期的花费
+func (m *Manager) Snapshot(ctx context.Context) error {
+	m.mu.RLock()
+	store := m.snapshots
+	if store == nil {
+		m.mu.RUnlock()
+		return nil
+	}
+	now := m.clock.Now()
+	snapshots := make([]models.BudgetSnapshot, 0, len(m.budgets))
+	for id, budget := range m.budgets {
+		if budget.Spent <= 0 {
+			continue
+		}
+		snapshots = append(snapshots, models.BudgetSnapshot{
+			BudgetID:    id,
+			PeriodStart: budget.StartTime,
+			Spent:       centsOf(budget.Spent),
+			Fee:         centsOf(budget.Fee),
+			Tax:         centsOf(budget.Tax),
+			UpdateTime:  now,
+		})
+	}
+	m.mu.RUnlock()
+
+	if err := store.Save(ctx, snapshots); err != nil {
+		return err
+	}
+	return store.Prune(ctx, now.Add(-snapshotRetention))
+}
+
+// readSpends 一次流水线读取预算的花费、服务费和税费，花费键不存在的预算ok为false
+func (m *Manager) readSpends(ctx context.Context, targets []spendTarget) ([]spend, error) {
+	pipe := m.redisClient.Pipeline()
+	cmds := make([][3]*redis.StringCmd, len(targets))
+	for i, target := range targets {
+		cmds[i] = [3]*redis.StringCmd{
+			pipe.Get(ctx, target.key),
+			pipe.Get(ctx, target.key+":fee"),
+			pipe.Get(ctx, target.key+":tax"),
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("%w: %v", ErrRedisOperation, err)
+	}
+
+	spends := make([]spend, len(targets))
+	for i := range targets {
+		var values [3]int64
+		for j, cmd := range cmds[i] {
+			v, err := cmd.Int64()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return nil, fmt.Errorf("%w: %v", ErrRedisOperation, err)
+			}
+			values[j] = v
+		}
+		spends[i] = spend{spent: values[0], fee: values[1], tax: values[2], ok: cmds[i][0].Err() == nil}
+	}
+	return spends, nil
+}
+
+// restore Redis中没有花费的预算从同一周期的快照恢复，只在花费键不存在时写入，不覆盖其他实例的扣减
+func (m *Manager) restore(ctx context.Context, store SnapshotStore, targets []spendTarget, spends []spend) error {
+	var (
+		ids   []string
+		since time.Time
+	)
+	missing := make(map[string]int)
+	for i, target := range targets {
+		if spends[i].ok {
+			continue
+		}
+		ids = append(ids, target.id)
+		missing[target.id] = i
+		if since.IsZero() || target.start.Before(since) {
+			since = target.start
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	snapshots, err := store.Load(ctx, ids, since)
+	if err != nil {
+		return err
+	}
+	pipe := m.redisClient.Pipeline()
+	restored := 0
+	for _, snapshot := range snapshots {
+		i, ok := missing[snapshot.BudgetID]
+		if !ok || !snapshot.PeriodStart.Equal(targets[i].start) || snapshot.Spent <= 0 {
+			continue
+		}
+		var ttl time.Duration
+		if targets[i].daily {
+			ttl = strategyBudgetTTL
+		}
+		key := targets[i].key
+		pipe.SetNX(ctx, key, snapshot.Spent, ttl)
+		if snapshot.Fee > 0 || snapshot.Tax > 0 {
+			pipe.SetNX(ctx, key+":fee", snapshot.Fee, ttl)
+			pipe.SetNX(ctx, key+":tax", snapshot.Tax, ttl)
+		}
+		spends[i] = spend{spent: snapshot.Spent, fee: snapshot.Fee, tax: snapshot.Tax, ok: true}
+		restored++
+	}
+	if restored == 0 {
+		return nil
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrRedisOperation, err)
+	}
+	m.logger.Info("从快照恢复预算花费", "count", restored)
+	return nil
+}
+
+// centsOf 将元转换为分
+func centsOf(amount float64) int64 {
+	return int64(amount*100 + 0.5)
+}
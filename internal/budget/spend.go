@@ -0,0 +1,52 @@
+package budget
+
+import (
+	"context"
+	"time"
+)
+
+// DailySpend 出价策略日预算在当前续期周期内的花费
+type DailySpend struct {
+	BudgetID string
+	// Amount 日预算
+	Amount float64
+	// Spent 当前周期内含服务费和税费的总花费，取自Redis，包含所有实例的扣减
+	Spent float64
+	// StartTime、EndTime 当前续期周期
+	StartTime time.Time
+	EndTime   time.Time
+}
+
+// DailySpends 从Redis读取所有出价策略日预算在当前周期的花费，不修改内存中的预算
+// 已到续期时间但尚未续期的预算按新周期读取
+func (m *Manager) DailySpends(ctx context.Context) ([]DailySpend, error) {
+	m.mu.RLock()
+	now := m.clock.Now()
+	targets := make([]spendTarget, 0, len(m.strategyBudgets))
+	results := make([]DailySpend, 0, len(m.strategyBudgets))
+	for id := range m.strategyBudgets {
+		budget, exists := m.budgets[id]
+		if !exists {
+			continue
+		}
+		start, end := budget.StartTime, budget.EndTime
+		if !now.Before(end) {
+			start, end = m.period(now, start.Location())
+		}
+		targets = append(targets, spendTarget{id: id, key: getDailyBudgetKey(id, start), start: start, daily: true})
+		results = append(results, DailySpend{BudgetID: id, Amount: budget.Amount, StartTime: start, EndTime: end})
+	}
+	m.mu.RUnlock()
+	if len(targets) == 0 {
+		return nil, nil
+	}
+
+	spends, err := m.readSpends(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	for i := range results {
+		results[i].Spent = float64(spends[i].spent) / 100
+	}
+	return results, nil
+}
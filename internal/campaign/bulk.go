@@ -0,0 +1,107 @@
+package campaign
+
+import (
+	"errors"
+	"math"
+)
+
+// 广告计划状态
+const (
+	StatusActive   = "active"
+	StatusPaused   = "paused"
+	StatusArchived = "archived"
+)
+
+// 批量状态操作
+const (
+	ActionPause   = "pause"
+	ActionResume  = "resume"
+	ActionArchive = "archive"
+)
+
+// 批量预算调整方式
+const (
+	BudgetModeSet      = "set"
+	BudgetModeIncrease = "increase"
+	BudgetModeDecrease = "decrease"
+	BudgetModeScale    = "scale"
+)
+
+var (
+	// ErrInvalidAction 表示无效的状态操作
+	ErrInvalidAction = errors.New("无效的状态操作")
+	// ErrInvalidTransition 表示当前状态不允许该操作
+	ErrInvalidTransition = errors.New("当前状态不允许该操作")
+	// ErrInvalidBudgetMode 表示无效的预算调整方式
+	ErrInvalidBudgetMode = errors.New("无效的预算调整方式")
+	// ErrInvalidBudgetValue 表示预算调整值或调整结果无效
+	ErrInvalidBudgetValue = errors.New("无效的预算调整值")
+)
+
+// NextStatus 根据状态操作计算目标状态
+// 暂停仅适用于投放中的计划，恢复适用于已暂停或草稿状态的计划，已归档的计划不可再操作
+func NextStatus(action, current string) (string, error) {
+	if current == StatusArchived {
+		return "", ErrInvalidTransition
+	}
+
+	switch action {
+	case ActionPause:
+		if current != StatusActive {
+			return "", ErrInvalidTransition
+		}
+		return StatusPaused, nil
+	case ActionResume:
+		if current != StatusPaused && current != StatusDraft {
+			return "", ErrInvalidTransition
+		}
+		return StatusActive, nil
+	case ActionArchive:
+		return StatusArchived, nil
+	default:
+		return "", ErrInvalidAction
+	}
+}
+
+// ValidateBudgetChange 校验预算调整参数
+func ValidateBudgetChange(mode string, value float64) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return ErrInvalidBudgetValue
+	}
+	switch mode {
+	case BudgetModeSet, BudgetModeIncrease, BudgetModeDecrease:
+		if value < 0 {
+			return ErrInvalidBudgetValue
+		}
+	case BudgetModeScale:
+		if value <= 0 {
+			return ErrInvalidBudgetValue
+		}
+	default:
+		return ErrInvalidBudgetMode
+	}
+	return nil
+}
+
+// ApplyBudgetChange 计算调整后的预算，结果保留两位小数
+func ApplyBudgetChange(mode string, current, value float64) (float64, error) {
+	if err := ValidateBudgetChange(mode, value); err != nil {
+		return 0, err
+	}
+
+	var next float64
+	switch mode {
+	case BudgetModeSet:
+		next = value
+	case BudgetModeIncrease:
+		next = current + value
+	case BudgetModeDecrease:
+		next = current - value
+	case BudgetModeScale:
+		next = current * value
+	}
+	if next < 0 {
+		return 0, ErrInvalidBudgetValue
+	}
+	return math.Round(next*100) / 100, nil
+}
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"simple-dsp/internal/macro"
+	"simple-dsp/internal/pixel"
+	"simple-dsp/internal/segment"
 )
 
 // TrackingType 跟踪类型
@@ -51,12 +55,32 @@ type TargetingConfig struct {
 	OSTypes      []string          `json:"os_types"`      // 操作系统定向
 	NetworkTypes []string          `json:"network_types"` // 网络类型定向
 	CustomRules  map[string]string `json:"custom_rules"`  // 自定义规则
+	Audiences    []string          `json:"audiences"`     // 再营销人群，广告主通过像素收集的人群名称
+}
+
+// AudienceSegments 返回再营销人群对应的人群包ID
+func (t *TargetingConfig) AudienceSegments(advertiserID string) []string {
+	if t == nil || len(t.Audiences) == 0 {
+		return nil
+	}
+	segments := make([]string, 0, len(t.Audiences))
+	for _, audience := range t.Audiences {
+		segments = append(segments, segment.AudienceID(advertiserID, audience))
+	}
+	return segments
+}
+
+// Notifier 接收配置变更，用于将管理后台的修改分发到竞价实例
+type Notifier interface {
+	ConfigChanged(config *Config)
+	ConfigRemoved(campaignID string)
 }
 
 // ConfigManager 配置管理器
 type ConfigManager struct {
-	configs map[string]*Config // 计划配置映射
-	mu      sync.RWMutex       // 读写锁
+	configs  map[string]*Config // 计划配置映射
+	mu       sync.RWMutex       // 读写锁
+	notifier Notifier           // 配置变更通知，为nil时不通知
 }
 
 // NewConfigManager 创建新的配置管理器
@@ -66,6 +90,11 @@ func NewConfigManager() *ConfigManager {
 	}
 }
 
+// SetNotifier 设置配置变更通知
+func (m *ConfigManager) SetNotifier(notifier Notifier) {
+	m.notifier = notifier
+}
+
 // SetConfig 设置计划配置
 func (m *ConfigManager) SetConfig(config *Config) error {
 	if err := validateConfig(config); err != nil {
@@ -73,14 +102,16 @@ func (m *ConfigManager) SetConfig(config *Config) error {
 	}
 
 	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	config.UpdateTime = time.Now()
 	if _, exists := m.configs[config.CampaignID]; !exists {
 		config.CreateTime = config.UpdateTime
 	}
-
 	m.configs[config.CampaignID] = config
+	m.mu.Unlock()
+
+	if m.notifier != nil {
+		m.notifier.ConfigChanged(config)
+	}
 	return nil
 }
 
@@ -94,6 +125,44 @@ func (m *ConfigManager) GetConfig(campaignID string) (*Config, bool) {
 
 // RemoveConfig 移除计划配置
 func (m *ConfigManager) RemoveConfig(campaignID string) {
+	m.mu.Lock()
+	delete(m.configs, campaignID)
+	m.mu.Unlock()
+
+	if m.notifier != nil {
+		m.notifier.ConfigRemoved(campaignID)
+	}
+}
+
+// Replace 用全量配置替换本地配置，不在configs中的计划被移除
+// 本地配置的更新时间晚于传入的配置时保留本地配置，不通知变更
+func (m *ConfigManager) Replace(configs []*Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	next := make(map[string]*Config, len(configs))
+	for _, config := range configs {
+		if current, ok := m.configs[config.CampaignID]; ok && current.UpdateTime.After(config.UpdateTime) {
+			next[config.CampaignID] = current
+			continue
+		}
+		next[config.CampaignID] = config
+	}
+	m.configs = next
+}
+
+// apply 写入其他实例修改的配置，保留更新时间，旧于本地的配置被忽略，不通知变更
+func (m *ConfigManager) apply(config *Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if current, ok := m.configs[config.CampaignID]; ok && current.UpdateTime.After(config.UpdateTime) {
+		return
+	}
+	m.configs[config.CampaignID] = config
+}
+
+// remove 移除其他实例删除的配置，不通知变更
+func (m *ConfigManager) remove(campaignID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.configs, campaignID)
@@ -119,6 +188,13 @@ func validateConfig(config *Config) error {
 	if config.AdvertiserID == "" {
 		return fmt.Errorf("advertiser_id is required")
 	}
+	if config.Targeting != nil {
+		for _, audience := range config.Targeting.Audiences {
+			if !pixel.ValidName(audience) {
+				return fmt.Errorf("invalid audience: %q", audience)
+			}
+		}
+	}
 
 	// 验证跟踪配置
 	for trackingType, trackingConfig := range config.TrackingConfigs {
@@ -126,6 +202,9 @@ func validateConfig(config *Config) error {
 			if trackingConfig.URL == "" {
 				return fmt.Errorf("%s tracking URL is required", trackingType)
 			}
+			if err := macro.Validate(trackingConfig.URL); err != nil {
+				return fmt.Errorf("%s tracking URL: %w", trackingType, err)
+			}
 			if trackingConfig.Timeout <= 0 {
 				trackingConfig.Timeout = time.Second * 1 // 默认1秒超时
 			}
@@ -0,0 +1,241 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// ChangesChannel 广告计划配置变更通知频道
+	ChangesChannel = "campaign_config_changes"
+	// configsKey 所有广告计划配置的哈希，字段为计划ID，值为配置JSON，用于全量同步
+	configsKey = "campaign:configs"
+
+	// ActionSet 配置新增或修改
+	ActionSet = "set"
+	// ActionRemove 配置删除
+	ActionRemove = "remove"
+
+	// defaultResyncInterval 默认的全量同步间隔
+	defaultResyncInterval = time.Minute
+	// publishTimeout 发布一次配置变更的超时时间
+	publishTimeout = 2 * time.Second
+)
+
+// ChangeEvent 广告计划配置变更事件
+type ChangeEvent struct {
+	CampaignID string  `json:"campaign_id"`
+	Action     string  `json:"action"`
+	Config     *Config `json:"config,omitempty"`
+}
+
+// Publisher 将管理后台的配置变更写入Redis并通知竞价实例
+// 实现Notifier，通过ConfigManager.SetNotifier设置后每次修改配置时发布
+type Publisher struct {
+	redis  *redis.Client
+	logger *logger.Logger
+}
+
+// NewPublisher 创建配置变更发布者
+func NewPublisher(redisClient *redis.Client, logger *logger.Logger) *Publisher {
+	return &Publisher{
+		redis:  redisClient,
+		logger: logger,
+	}
+}
+
+// ConfigChanged 保存配置并发布变更通知
+func (p *Publisher) ConfigChanged(config *Config) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := p.Publish(ctx, config); err != nil {
+		p.logger.Error("发布广告计划配置变更失败", "campaign_id", config.CampaignID, "error", err)
+	}
+}
+
+// ConfigRemoved 删除配置并发布变更通知
+func (p *Publisher) ConfigRemoved(campaignID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := p.PublishRemove(ctx, campaignID); err != nil {
+		p.logger.Error("发布广告计划配置删除失败", "campaign_id", campaignID, "error", err)
+	}
+}
+
+// Publish 保存配置并发布变更通知，先写全量哈希再通知，全量同步读到的配置不会旧于已通知的配置
+func (p *Publisher) Publish(ctx context.Context, config *Config) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("序列化广告计划配置失败: %w", err)
+	}
+	event, err := json.Marshal(ChangeEvent{CampaignID: config.CampaignID, Action: ActionSet, Config: config})
+	if err != nil {
+		return fmt.Errorf("序列化配置变更事件失败: %w", err)
+	}
+
+	pipe := p.redis.Pipeline()
+	pipe.HSet(ctx, configsKey, config.CampaignID, data)
+	pipe.Publish(ctx, ChangesChannel, event)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// PublishRemove 删除配置并发布变更通知
+func (p *Publisher) PublishRemove(ctx context.Context, campaignID string) error {
+	event, err := json.Marshal(ChangeEvent{CampaignID: campaignID, Action: ActionRemove})
+	if err != nil {
+		return fmt.Errorf("序列化配置变更事件失败: %w", err)
+	}
+
+	pipe := p.redis.Pipeline()
+	pipe.HDel(ctx, configsKey, campaignID)
+	pipe.Publish(ctx, ChangesChannel, event)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// Subscriber 竞价实例订阅配置变更并更新本地的ConfigManager
+// 变更通知在订阅断开期间会丢失，订阅恢复时和每个全量同步间隔从Redis全量同步一次
+type Subscriber struct {
+	redis    *redis.Client
+	manager  *ConfigManager
+	interval time.Duration
+	logger   *logger.Logger
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewSubscriber 创建配置变更订阅者，resyncInterval为全量同步间隔，默认1分钟
+func NewSubscriber(redisClient *redis.Client, manager *ConfigManager, resyncInterval time.Duration, logger *logger.Logger) *Subscriber {
+	if resyncInterval <= 0 {
+		resyncInterval = defaultResyncInterval
+	}
+	return &Subscriber{
+		redis:    redisClient,
+		manager:  manager,
+		interval: resyncInterval,
+		logger:   logger,
+	}
+}
+
+// Start 全量同步一次并启动订阅和定时全量同步
+// 首次同步失败时只记录日志，之后的同步成功前使用本地已有的配置
+func (s *Subscriber) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelFunc = cancel
+
+	if err := s.Resync(ctx); err != nil {
+		s.logger.Error("全量同步广告计划配置失败", "error", err)
+	}
+
+	pubsub := s.redis.Subscribe(ctx, ChangesChannel)
+	s.wg.Add(2)
+	go s.watch(ctx, pubsub)
+	go s.resyncLoop(ctx)
+}
+
+// Stop 停止订阅和定时全量同步
+func (s *Subscriber) Stop() {
+	if s.cancelFunc == nil {
+		return
+	}
+	s.cancelFunc()
+	s.wg.Wait()
+}
+
+// Resync 从Redis全量读取配置并替换本地配置
+func (s *Subscriber) Resync(ctx context.Context) error {
+	values, err := s.redis.HGetAll(ctx, configsKey).Result()
+	if err != nil {
+		return fmt.Errorf("读取广告计划配置失败: %w", err)
+	}
+
+	configs := make([]*Config, 0, len(values))
+	for campaignID, value := range values {
+		var config Config
+		if err := json.Unmarshal([]byte(value), &config); err != nil {
+			s.logger.Warn("跳过无效的广告计划配置", "campaign_id", campaignID, "error", err)
+			continue
+		}
+		configs = append(configs, &config)
+	}
+	s.manager.Replace(configs)
+	s.logger.Debug("广告计划配置已全量同步", "count", len(configs))
+	return nil
+}
+
+// watch 处理变更通知，订阅建立或断线重连后全量同步
+func (s *Subscriber) watch(ctx context.Context, pubsub *redis.PubSub) {
+	defer s.wg.Done()
+	defer pubsub.Close()
+
+	ch := pubsub.ChannelWithSubscriptions(ctx, 100)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			switch msg := msg.(type) {
+			case *redis.Subscription:
+				// 断开期间的通知已丢失
+				if err := s.Resync(ctx); err != nil && ctx.Err() == nil {
+					s.logger.Error("订阅恢复后全量同步广告计划配置失败", "error", err)
+				}
+			case *redis.Message:
+				s.handle(msg.Payload)
+			}
+		}
+	}
+}
+
+// handle 应用一条变更通知
+func (s *Subscriber) handle(payload string) {
+	var event ChangeEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		s.logger.Warn("解析广告计划配置变更通知失败", "error", err)
+		return
+	}
+
+	switch event.Action {
+	case ActionSet:
+		if event.Config == nil || event.Config.CampaignID != event.CampaignID {
+			s.logger.Warn("广告计划配置变更通知缺少配置", "campaign_id", event.CampaignID)
+			return
+		}
+		s.manager.apply(event.Config)
+	case ActionRemove:
+		s.manager.remove(event.CampaignID)
+	default:
+		s.logger.Warn("未知的广告计划配置变更", "campaign_id", event.CampaignID, "action", event.Action)
+	}
+}
+
+// resyncLoop 定时全量同步
+func (s *Subscriber) resyncLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Resync(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Error("定时全量同步广告计划配置失败", "error", err)
+			}
+		}
+	}
+}
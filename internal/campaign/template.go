@@ -0,0 +1,147 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// StatusDraft 草稿状态，复制或由模板创建的计划需确认后才能投放
+const StatusDraft = "draft"
+
+var (
+	// ErrTemplateNameRequired 表示模板名称为空
+	ErrTemplateNameRequired = errors.New("模板名称不能为空")
+)
+
+// Template 广告计划模板
+// 保存定向、跟踪、出价策略和预算设置，不包含投放时间和状态
+type Template struct {
+	ID              string                           `json:"id"`               // 模板ID
+	Name            string                           `json:"name"`             // 模板名称
+	AdvertiserID    string                           `json:"advertiser_id"`    // 所属广告主，为空表示通用模板
+	Budget          float64                          `json:"budget"`           // 预算
+	BidStrategy     string                           `json:"bid_strategy"`     // 出价策略
+	Targeting       *TargetingConfig                 `json:"targeting"`        // 定向配置
+	TrackingConfigs map[TrackingType]*TrackingConfig `json:"tracking_configs"` // 跟踪配置
+	UpdateTime      time.Time                        `json:"update_time"`      // 更新时间
+	CreateTime      time.Time                        `json:"create_time"`      // 创建时间
+}
+
+// Clone 复制计划配置，生成使用新ID的草稿计划
+// 定向和跟踪配置为深拷贝，修改副本不影响原计划
+func (c *Config) Clone(campaignID, name string) *Config {
+	clone := &Config{
+		CampaignID:      campaignID,
+		Name:            name,
+		AdvertiserID:    c.AdvertiserID,
+		Status:          StatusDraft,
+		StartTime:       c.StartTime,
+		EndTime:         c.EndTime,
+		Budget:          c.Budget,
+		BidStrategy:     c.BidStrategy,
+		Targeting:       c.Targeting.clone(),
+		TrackingConfigs: cloneTrackingConfigs(c.TrackingConfigs),
+	}
+	if clone.Name == "" {
+		clone.Name = fmt.Sprintf("%s (副本)", c.Name)
+	}
+	return clone
+}
+
+// ToTemplate 将计划配置保存为模板
+func (c *Config) ToTemplate(templateID, name string) (*Template, error) {
+	if name == "" {
+		return nil, ErrTemplateNameRequired
+	}
+	return &Template{
+		ID:              templateID,
+		Name:            name,
+		AdvertiserID:    c.AdvertiserID,
+		Budget:          c.Budget,
+		BidStrategy:     c.BidStrategy,
+		Targeting:       c.Targeting.clone(),
+		TrackingConfigs: cloneTrackingConfigs(c.TrackingConfigs),
+	}, nil
+}
+
+// NewConfig 根据模板创建草稿计划
+// advertiserID为空时使用模板的广告主
+func (t *Template) NewConfig(campaignID, name, advertiserID string, startTime, endTime time.Time) *Config {
+	if advertiserID == "" {
+		advertiserID = t.AdvertiserID
+	}
+	return &Config{
+		CampaignID:      campaignID,
+		Name:            name,
+		AdvertiserID:    advertiserID,
+		Status:          StatusDraft,
+		StartTime:       startTime,
+		EndTime:         endTime,
+		Budget:          t.Budget,
+		BidStrategy:     t.BidStrategy,
+		Targeting:       t.Targeting.clone(),
+		TrackingConfigs: cloneTrackingConfigs(t.TrackingConfigs),
+	}
+}
+
+// ValidateTemplate 验证模板
+func ValidateTemplate(t *Template) error {
+	if t.Name == "" {
+		return ErrTemplateNameRequired
+	}
+	if t.Budget < 0 {
+		return ErrInvalidBudgetValue
+	}
+	for trackingType, trackingConfig := range t.TrackingConfigs {
+		if trackingConfig.Enabled && trackingConfig.URL == "" {
+			return fmt.Errorf("%s tracking URL is required", trackingType)
+		}
+	}
+	return nil
+}
+
+// clone 深拷贝定向配置
+func (t *TargetingConfig) clone() *TargetingConfig {
+	if t == nil {
+		return nil
+	}
+	clone := &TargetingConfig{
+		Locations:    append([]string(nil), t.Locations...),
+		Ages:         append([]string(nil), t.Ages...),
+		Genders:      append([]string(nil), t.Genders...),
+		Interests:    append([]string(nil), t.Interests...),
+		OSTypes:      append([]string(nil), t.OSTypes...),
+		NetworkTypes: append([]string(nil), t.NetworkTypes...),
+		Audiences:    append([]string(nil), t.Audiences...),
+	}
+	if t.CustomRules != nil {
+		clone.CustomRules = make(map[string]string, len(t.CustomRules))
+		for k, v := range t.CustomRules {
+			clone.CustomRules[k] = v
+		}
+	}
+	return clone
+}
+
+// cloneTrackingConfigs 深拷贝跟踪配置
+func cloneTrackingConfigs(configs map[TrackingType]*TrackingConfig) map[TrackingType]*TrackingConfig {
+	if configs == nil {
+		return nil
+	}
+	clone := make(map[TrackingType]*TrackingConfig, len(configs))
+	for trackingType, config := range configs {
+		if config == nil {
+			continue
+		}
+		copied := *config
+		if config.Headers != nil {
+			copied.Headers = make(map[string]string, len(config.Headers))
+			for k, v := range config.Headers {
+				copied.Headers[k] = v
+			}
+		}
+		clone[trackingType] = &copied
+	}
+	return clone
+}
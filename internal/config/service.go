@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"simple-dsp/pkg/cache"
 	"simple-dsp/pkg/logger"
 )
 
@@ -80,7 +81,7 @@ func (s *Service) SetConfig(ctx context.Context, key string, value interface{},
 		"data": item,
 	}
 	eventData, _ := json.Marshal(event)
-	s.redis.Publish(ctx, "config_changes", eventData)
+	s.redis.Publish(ctx, ChangesChannel, eventData)
 
 	return nil
 }
@@ -154,7 +155,7 @@ func (s *Service) DeleteConfig(ctx context.Context, key string) error {
 		"data": map[string]string{"key": key},
 	}
 	eventData, _ := json.Marshal(event)
-	s.redis.Publish(ctx, "config_changes", eventData)
+	s.redis.Publish(ctx, ChangesChannel, eventData)
 
 	return nil
 }
@@ -168,22 +169,12 @@ func (s *Service) ListConfigs(ctx context.Context) ([]*ConfigItem, error) {
 		return nil, fmt.Errorf("获取配置列表失败: %w", err)
 	}
 
-	// 获取所有配置
-	var configs []*ConfigItem
-	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			s.logger.Error("获取配置失败", "key", key, "error", err)
-			continue
-		}
-
-		var item ConfigItem
-		if err := json.Unmarshal(data, &item); err != nil {
-			s.logger.Error("解析配置失败", "key", key, "error", err)
-			continue
-		}
-
-		configs = append(configs, &item)
+	// 批量获取所有配置
+	configs, err := cache.MGetJSON[*ConfigItem](ctx, s.redis, keys, func(key string, err error) {
+		s.logger.Error("解析配置失败", "key", key, "error", err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取配置失败: %w", err)
 	}
 
 	return configs, nil
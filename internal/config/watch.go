@@ -0,0 +1,62 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ChangesChannel 配置变更事件的发布频道
+const ChangesChannel = "config_changes"
+
+// changeEvent 配置变更事件
+type changeEvent struct {
+	Type string `json:"type"`
+	Data struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	} `json:"data"`
+}
+
+// Watch 监听配置项的变更，阻塞直到ctx取消
+// 先以当前值调用apply，之后每次更新时以新值调用，配置被删除或不存在时以nil调用
+func (s *Service) Watch(ctx context.Context, key string, apply func(value json.RawMessage)) error {
+	// 先订阅再读取当前值，避免错过两者之间的更新
+	pubsub := s.redis.Subscribe(ctx, ChangesChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return fmt.Errorf("订阅配置变更失败: %w", err)
+	}
+
+	if item, err := s.GetConfig(ctx, key); err == nil {
+		value, err := json.Marshal(item.Value)
+		if err != nil {
+			return fmt.Errorf("序列化配置失败: %w", err)
+		}
+		apply(value)
+	} else {
+		apply(nil)
+	}
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			var event changeEvent
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil || event.Data.Key != key {
+				continue
+			}
+			switch event.Type {
+			case "config_updated":
+				apply(event.Data.Value)
+			case "config_deleted":
+				apply(nil)
+			}
+		}
+	}
+}
@@ -0,0 +1,493 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: approval.go
+ * Project: simple-dsp
+ * Description: 素材在各交易平台的送审和审核状态同步
+ *
+ * 主要功能:
+ * - 将素材提交到启用素材送审的交易平台
+ * - 定时查询或接收回调同步各交易平台的审核状态
+ * - 为竞价引擎提供素材在交易平台的审核结果
+ *
+ * 实现细节:
+ * - 每个交易平台一个Connector，默认使用通用的JSON审核接口
+ * - 审核状态保存在Redis，审核通过的素材集合定时加载到内存，竞价时不访问Redis
+ * - 未启用素材送审的交易平台不限制素材
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/internal/exchange
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 审核结果最长在同步间隔后才对竞价生效
+ * - 素材内容变更后需重新提交
+ */
+
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/creative/types"
+	"simple-dsp/internal/exchange"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// defaultSyncInterval 审核状态的默认同步间隔
+	defaultSyncInterval = time.Minute
+	// pollLockName 查询审核状态的分布式锁
+	pollLockName = "creative:approval:poll"
+)
+
+// Status 素材在交易平台的审核状态
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusApproved Status = "approved"
+	StatusRejected Status = "rejected"
+)
+
+// ParseStatus 解析交易平台返回的审核状态，无法识别的状态按审核中处理
+func ParseStatus(s string) Status {
+	switch status := Status(strings.ToLower(s)); status {
+	case StatusApproved, StatusRejected:
+		return status
+	default:
+		return StatusPending
+	}
+}
+
+// State 素材在一个交易平台的审核状态
+type State struct {
+	Exchange   string    `json:"exchange"`
+	CreativeID string    `json:"creative_id"`
+	ExternalID string    `json:"external_id"` // 交易平台的素材ID
+	Status     Status    `json:"status"`
+	Reason     string    `json:"reason,omitempty"` // 拒绝原因
+	SubmitTime time.Time `json:"submit_time"`
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// Store 审核状态使用的Redis操作，*redis.Client和*redis.ClusterClient均满足该接口
+type Store interface {
+	HGet(ctx context.Context, key, field string) *redis.StringCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+}
+
+// Sharder 后台任务分片，cluster.Registry满足该接口
+type Sharder interface {
+	// Owns 本实例是否负责该键
+	Owns(key string) bool
+}
+
+// CreativeSource 提交时读取素材内容，storage.Storage满足该接口
+type CreativeSource interface {
+	GetCreative(ctx context.Context, creativeID string) (*types.Creative, error)
+}
+
+// Syncer 素材送审和审核状态同步
+type Syncer struct {
+	registry  *exchange.Registry
+	store     Store
+	creatives CreativeSource
+	logger    *logger.Logger
+	interval  time.Duration
+	locker    *lock.Locker
+	sharder   Sharder
+
+	mu         sync.RWMutex
+	connectors map[string]Connector
+	approved   map[string]map[string]bool
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewSyncer 为启用素材送审的交易平台创建审核接口，interval为0时使用默认同步间隔
+func NewSyncer(registry *exchange.Registry, store Store, interval time.Duration, logger *logger.Logger) *Syncer {
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	s := &Syncer{
+		registry:   registry,
+		store:      store,
+		logger:     logger,
+		interval:   interval,
+		connectors: make(map[string]Connector),
+		approved:   make(map[string]map[string]bool),
+	}
+	for _, profile := range registry.List() {
+		if profile.CreativeAudit.Enabled {
+			s.connectors[profile.ID] = NewHTTPConnector(profile.CreativeAudit)
+		}
+	}
+	return s
+}
+
+// SetConnector 为交易平台设置审核接口，设置后该平台只投放审核通过的素材
+func (s *Syncer) SetConnector(exchangeID string, connector Connector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connectors[exchangeID] = connector
+}
+
+// SetCreativeSource 设置素材来源，未设置时不能提交素材
+func (s *Syncer) SetCreativeSource(source CreativeSource) {
+	s.creatives = source
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例查询审核状态
+func (s *Syncer) SetLocker(locker *lock.Locker) {
+	s.locker = locker
+}
+
+// SetSharder 设置后台任务分片，设置后各实例只查询自己负责的素材，不再加锁
+func (s *Syncer) SetSharder(sharder Sharder) {
+	s.sharder = sharder
+}
+
+// Required 交易平台是否要求素材审核通过
+func (s *Syncer) Required(exchangeID string) bool {
+	if exchangeID == "" {
+		exchangeID = exchange.DefaultExchange
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.connectors[exchangeID]
+	return ok
+}
+
+// Approved 素材是否可以参与交易平台的竞价，交易平台未启用素材送审时返回true
+func (s *Syncer) Approved(exchangeID, creativeID string) bool {
+	if exchangeID == "" {
+		exchangeID = exchange.DefaultExchange
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.connectors[exchangeID]; !ok {
+		return true
+	}
+	return s.approved[exchangeID][creativeID]
+}
+
+// Submit 将素材提交到所有启用素材送审的交易平台，单个平台失败不影响其他平台
+func (s *Syncer) Submit(ctx context.Context, creativeID string) ([]*State, error) {
+	if s.creatives == nil {
+		return nil, ErrNoCreativeSource
+	}
+	creative, err := s.creatives.GetCreative(ctx, creativeID)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*State
+	var errs []error
+	for _, exchangeID := range s.exchanges() {
+		state, err := s.submit(ctx, exchangeID, creative)
+		if err != nil {
+			s.logger.Error("提交素材审核失败", "exchange", exchangeID, "creative_id", creativeID, "error", err)
+			errs = append(errs, fmt.Errorf("交易平台%s: %w", exchangeID, err))
+			continue
+		}
+		states = append(states, state)
+	}
+	return states, errors.Join(errs...)
+}
+
+// Apply 按交易平台的素材ID更新审核状态，用于交易平台回调
+func (s *Syncer) Apply(ctx context.Context, exchangeID, externalID string, status Status, reason string) (*State, error) {
+	switch status {
+	case StatusPending, StatusApproved, StatusRejected:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStatus, status)
+	}
+
+	creativeID, err := s.store.HGet(ctx, externalKey(exchangeID), externalID).Result()
+	if err == redis.Nil {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.state(ctx, exchangeID, creativeID)
+	if err != nil {
+		return nil, err
+	}
+
+	state.Status = status
+	state.Reason = reason
+	state.UpdateTime = time.Now()
+	if err := s.save(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// States 返回素材在各交易平台的审核状态，按交易平台ID排序
+func (s *Syncer) States(ctx context.Context, creativeID string) ([]*State, error) {
+	data, err := s.store.HGetAll(ctx, stateKey(creativeID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*State, 0, len(data))
+	for _, value := range data {
+		var state State
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			s.logger.Error("解析素材审核状态失败", "creative_id", creativeID, "error", err)
+			continue
+		}
+		states = append(states, &state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Exchange < states[j].Exchange
+	})
+	return states, nil
+}
+
+// Poll 查询定时同步的交易平台中审核中素材的状态
+func (s *Syncer) Poll(ctx context.Context) {
+	for _, exchangeID := range s.exchanges() {
+		if profile, err := s.registry.Get(exchangeID); err == nil && profile.CreativeAudit.Mode == exchange.CreativeAuditWebhook {
+			continue
+		}
+		connector := s.connector(exchangeID)
+
+		creativeIDs, err := s.store.SMembers(ctx, pendingKey(exchangeID)).Result()
+		if err != nil {
+			s.logger.Error("读取审核中素材失败", "exchange", exchangeID, "error", err)
+			continue
+		}
+		for _, creativeID := range creativeIDs {
+			if s.sharder != nil && !s.sharder.Owns(exchangeID+":"+creativeID) {
+				continue
+			}
+			if err := s.poll(ctx, exchangeID, connector, creativeID); err != nil {
+				s.logger.Error("查询素材审核状态失败", "exchange", exchangeID, "creative_id", creativeID, "error", err)
+			}
+		}
+	}
+}
+
+// Refresh 加载各交易平台审核通过的素材
+func (s *Syncer) Refresh(ctx context.Context) error {
+	approved := make(map[string]map[string]bool)
+	for _, exchangeID := range s.exchanges() {
+		creativeIDs, err := s.store.SMembers(ctx, approvedKey(exchangeID)).Result()
+		if err != nil {
+			return err
+		}
+		set := make(map[string]bool, len(creativeIDs))
+		for _, id := range creativeIDs {
+			set[id] = true
+		}
+		approved[exchangeID] = set
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.approved = approved
+	return nil
+}
+
+// Start 加载审核通过的素材并启动后台同步
+func (s *Syncer) Start() {
+	if err := s.Refresh(context.Background()); err != nil {
+		s.logger.Error("加载素材审核状态失败", "error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelFunc = cancel
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// 审核状态写入共享的存储，按分片查询或只由一个实例查询；审核通过的素材各实例都要加载
+				if s.sharder != nil {
+					s.Poll(ctx)
+				} else if err := s.locker.Do(ctx, pollLockName, func(ctx context.Context) error {
+					s.Poll(ctx)
+					return nil
+				}); err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+					s.logger.Error("查询素材审核状态加锁失败", "error", err)
+				}
+				if err := s.Refresh(ctx); err != nil {
+					s.logger.Error("加载素材审核状态失败", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop 停止后台同步
+func (s *Syncer) Stop() {
+	if s.cancelFunc != nil {
+		s.cancelFunc()
+	}
+	s.wg.Wait()
+}
+
+// submit 提交素材到一个交易平台并保存状态
+func (s *Syncer) submit(ctx context.Context, exchangeID string, creative *types.Creative) (*State, error) {
+	externalID, status, err := s.connector(exchangeID).Submit(ctx, creative)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	state := &State{
+		Exchange:   exchangeID,
+		CreativeID: creative.ID,
+		ExternalID: externalID,
+		Status:     status,
+		SubmitTime: now,
+		UpdateTime: now,
+	}
+	if err := s.save(ctx, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// poll 查询一个素材的审核状态，状态变化时保存
+func (s *Syncer) poll(ctx context.Context, exchangeID string, connector Connector, creativeID string) error {
+	state, err := s.state(ctx, exchangeID, creativeID)
+	if err != nil {
+		return err
+	}
+	status, reason, err := connector.Status(ctx, state.ExternalID)
+	if err != nil {
+		return err
+	}
+	if status == state.Status && reason == state.Reason {
+		return nil
+	}
+
+	state.Status = status
+	state.Reason = reason
+	state.UpdateTime = time.Now()
+	return s.save(ctx, state)
+}
+
+// state 读取素材在交易平台的审核状态
+func (s *Syncer) state(ctx context.Context, exchangeID, creativeID string) (*State, error) {
+	data, err := s.store.HGet(ctx, stateKey(creativeID), exchangeID).Bytes()
+	if err == redis.Nil {
+		return nil, ErrStateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// save 保存审核状态并更新审核中和审核通过的素材集合
+func (s *Syncer) save(ctx context.Context, state *State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := s.store.HSet(ctx, stateKey(state.CreativeID), state.Exchange, data).Err(); err != nil {
+		return err
+	}
+	if err := s.store.HSet(ctx, externalKey(state.Exchange), state.ExternalID, state.CreativeID).Err(); err != nil {
+		return err
+	}
+
+	if state.Status == StatusPending {
+		err = s.store.SAdd(ctx, pendingKey(state.Exchange), state.CreativeID).Err()
+	} else {
+		err = s.store.SRem(ctx, pendingKey(state.Exchange), state.CreativeID).Err()
+	}
+	if err != nil {
+		return err
+	}
+	if state.Status == StatusApproved {
+		err = s.store.SAdd(ctx, approvedKey(state.Exchange), state.CreativeID).Err()
+	} else {
+		err = s.store.SRem(ctx, approvedKey(state.Exchange), state.CreativeID).Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	// 本实例立即生效，其他实例在下次同步时生效
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.approved[state.Exchange] == nil {
+		s.approved[state.Exchange] = make(map[string]bool)
+	}
+	if state.Status == StatusApproved {
+		s.approved[state.Exchange][state.CreativeID] = true
+	} else {
+		delete(s.approved[state.Exchange], state.CreativeID)
+	}
+	return nil
+}
+
+// exchanges 按ID排序返回启用素材送审的交易平台
+func (s *Syncer) exchanges() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := make([]string, 0, len(s.connectors))
+	for id := range s.connectors {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// connector 返回交易平台的审核接口
+func (s *Syncer) connector(exchangeID string) Connector {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.connectors[exchangeID]
+}
+
+// stateKey 素材在各交易平台的审核状态
+func stateKey(creativeID string) string {
+	return "creative:exchange:" + creativeID
+}
+
+// externalKey 交易平台素材ID到素材ID的映射
+func externalKey(exchangeID string) string {
+	return "creative:exchange:external:" + exchangeID
+}
+
+// pendingKey 交易平台审核中的素材
+func pendingKey(exchangeID string) string {
+	return "creative:exchange:pending:" + exchangeID
+}
+
+// approvedKey 交易平台审核通过的素材
+func approvedKey(exchangeID string) string {
+	return "creative:exchange:approved:" + exchangeID
+}
@@ -0,0 +1,109 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"simple-dsp/internal/creative/types"
+	"simple-dsp/internal/exchange"
+)
+
+// defaultConnectorTimeout 调用交易平台审核接口的超时时间
+const defaultConnectorTimeout = 10 * time.Second
+
+// maxErrorBody 记录失败响应体的最大字节数
+const maxErrorBody = 512
+
+// Connector 交易平台素材审核接口
+type Connector interface {
+	// Submit 提交素材，返回交易平台的素材ID和当前审核状态
+	Submit(ctx context.Context, creative *types.Creative) (externalID string, status Status, err error)
+	// Status 查询素材的审核状态，rejected时reason为拒绝原因
+	Status(ctx context.Context, externalID string) (status Status, reason string, err error)
+}
+
+// HTTPConnector 通用的JSON审核接口
+// 提交: POST {url}/creatives，查询: GET {url}/creatives/{id}，响应为{"id","status","reason"}
+type HTTPConnector struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewHTTPConnector 按交易平台的素材审核配置创建接口
+func NewHTTPConnector(audit exchange.CreativeAudit) *HTTPConnector {
+	return &HTTPConnector{
+		url:    strings.TrimRight(audit.URL, "/"),
+		token:  audit.Token,
+		client: &http.Client{Timeout: defaultConnectorTimeout},
+	}
+}
+
+// auditResponse 审核接口响应
+type auditResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// Submit 提交素材
+func (h *HTTPConnector) Submit(ctx context.Context, creative *types.Creative) (string, Status, error) {
+	body, err := json.Marshal(map[string]string{
+		"id":      creative.ID,
+		"title":   creative.Title,
+		"type":    creative.Type,
+		"content": creative.Content,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	var resp auditResponse
+	if err := h.do(ctx, http.MethodPost, h.url+"/creatives", body, &resp); err != nil {
+		return "", "", err
+	}
+	if resp.ID == "" {
+		return "", "", fmt.Errorf("审核接口未返回素材ID")
+	}
+	return resp.ID, ParseStatus(resp.Status), nil
+}
+
+// Status 查询审核状态
+func (h *HTTPConnector) Status(ctx context.Context, externalID string) (Status, string, error) {
+	var resp auditResponse
+	if err := h.do(ctx, http.MethodGet, h.url+"/creatives/"+url.PathEscape(externalID), nil, &resp); err != nil {
+		return "", "", err
+	}
+	return ParseStatus(resp.Status), resp.Reason, nil
+}
+
+// do 发送请求并解析JSON响应
+func (h *HTTPConnector) do(ctx context.Context, method, target string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("审核接口返回错误: status=%d body=%s", resp.StatusCode, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,17 @@
+package approval
+
+import "errors"
+
+var (
+	// ErrNoConnector 交易平台未启用素材送审
+	ErrNoConnector = errors.New("交易平台未启用素材送审")
+
+	// ErrStateNotFound 素材未提交到该交易平台
+	ErrStateNotFound = errors.New("素材未提交到该交易平台")
+
+	// ErrNoCreativeSource 未设置素材来源，无法提交素材
+	ErrNoCreativeSource = errors.New("未设置素材来源")
+
+	// ErrInvalidStatus 无效的审核状态
+	ErrInvalidStatus = errors.New("无效的审核状态")
+)
@@ -0,0 +1,104 @@
+package approval
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/exchange"
+	"simple-dsp/pkg/logger"
+)
+
+// Handler 素材送审接口和交易平台审核回调
+type Handler struct {
+	syncer   *Syncer
+	registry *exchange.Registry
+	logger   *logger.Logger
+}
+
+// NewHandler 创建素材送审接口
+func NewHandler(syncer *Syncer, registry *exchange.Registry, logger *logger.Logger) *Handler {
+	return &Handler{syncer: syncer, registry: registry, logger: logger}
+}
+
+// RegisterRoutes 注册路由
+func (h *Handler) RegisterRoutes(r *gin.Engine) {
+	r.POST("/api/v1/creatives/:id/exchange-audits", h.Submit)
+	r.GET("/api/v1/creatives/:id/exchange-audits", h.GetStates)
+	r.POST("/api/v1/exchanges/:id/creative-audits/callback", h.Callback)
+}
+
+// callbackRequest 交易平台审核回调
+type callbackRequest struct {
+	ExternalID string `json:"external_id" binding:"required"`
+	Status     string `json:"status" binding:"required"`
+	Reason     string `json:"reason"`
+}
+
+// Submit 将素材提交到所有启用素材送审的交易平台
+func (h *Handler) Submit(c *gin.Context) {
+	states, err := h.syncer.Submit(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, ErrNoCreativeSource) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil && len(states) == 0 {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	resp := gin.H{"states": states}
+	if err != nil {
+		// 部分交易平台提交失败
+		resp["error"] = err.Error()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetStates 获取素材在各交易平台的审核状态
+func (h *Handler) GetStates(c *gin.Context) {
+	states, err := h.syncer.States(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error("获取素材审核状态失败", "creative_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取素材审核状态失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"states": states})
+}
+
+// Callback 接收交易平台的审核结果，请求需携带配置的webhook_token
+func (h *Handler) Callback(c *gin.Context) {
+	exchangeID := c.Param("id")
+	profile, err := h.registry.Get(exchangeID)
+	if err != nil || !profile.CreativeAudit.Enabled || profile.CreativeAudit.WebhookToken == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrNoConnector.Error()})
+		return
+	}
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(profile.CreativeAudit.WebhookToken)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": exchange.ErrUnauthorized.Error()})
+		return
+	}
+
+	var req callbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	state, err := h.syncer.Apply(c.Request.Context(), exchangeID, req.ExternalID, Status(strings.ToLower(req.Status)), req.Reason)
+	switch {
+	case errors.Is(err, ErrInvalidStatus):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrStateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("更新素材审核状态失败", "exchange", exchangeID, "external_id", req.ExternalID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新素材审核状态失败"})
+	default:
+		c.JSON(http.StatusOK, state)
+	}
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"time"
 
 	"simple-dsp/internal/creative/storage"
+	"simple-dsp/internal/creative/types"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/id"
 	"simple-dsp/pkg/logger"
 
 	"github.com/go-redis/redis/v8"
@@ -22,64 +26,368 @@ const (
 	AuditStatusRevision AuditStatus = "revision"
 )
 
+// 审核拒绝原因
+const (
+	ReasonMisleading   = "misleading"    // 虚假或误导性内容
+	ReasonProhibited   = "prohibited"    // 违禁品或违规行业
+	ReasonInfringement = "infringement"  // 侵犯商标、版权或肖像权
+	ReasonLowQuality   = "low_quality"   // 画质模糊、文字错误等质量问题
+	ReasonLandingPage  = "landing_page"  // 落地页无法访问或与素材不符
+	ReasonSpecMismatch = "spec_mismatch" // 尺寸、格式或时长不符合规格
+	ReasonOther        = "other"         // 其他，需填写审核意见
+)
+
+// RejectReasons 可用的拒绝原因及说明
+var RejectReasons = map[string]string{
+	ReasonMisleading:   "虚假或误导性内容",
+	ReasonProhibited:   "违禁品或违规行业",
+	ReasonInfringement: "侵犯商标、版权或肖像权",
+	ReasonLowQuality:   "画质模糊、文字错误等质量问题",
+	ReasonLandingPage:  "落地页无法访问或与素材不符",
+	ReasonSpecMismatch: "尺寸、格式或时长不符合规格",
+	ReasonOther:        "其他",
+}
+
+// 审核时限默认值
+const (
+	// DefaultReviewSLA 提交后应完成审核的时间
+	DefaultReviewSLA = 24 * time.Hour
+	// DefaultClaimTimeout 领取后未完成审核时重新排队的时间
+	DefaultClaimTimeout = 30 * time.Minute
+)
+
+// auditQueueKey 待审核队列，分值为可领取的毫秒时间戳，领取后推迟到领取超时
+const auditQueueKey = "creative:audit:queue"
+
+var (
+	// ErrAuditNotFound 审核记录不存在
+	ErrAuditNotFound = errors.New("审核记录不存在")
+	// ErrAuditNotPending 素材不在待审核状态
+	ErrAuditNotPending = errors.New("素材不在待审核状态")
+	// ErrQueueEmpty 没有可领取的待审核素材
+	ErrQueueEmpty = errors.New("没有可领取的待审核素材")
+	// ErrClaimedByOther 素材已由其他审核员领取
+	ErrClaimedByOther = errors.New("素材已由其他审核员领取")
+	// ErrReviewerRequired 未指定审核员
+	ErrReviewerRequired = errors.New("必须指定审核员")
+	// ErrInvalidAuditStatus 无效的审核结果
+	ErrInvalidAuditStatus = errors.New("无效的审核结果")
+	// ErrReasonRequired 拒绝时未填写原因
+	ErrReasonRequired = errors.New("拒绝时必须填写原因")
+	// ErrInvalidReason 未知的拒绝原因
+	ErrInvalidReason = errors.New("无效的拒绝原因")
+	// ErrCommentsRequired 原因为其他时未填写审核意见
+	ErrCommentsRequired = errors.New("原因为其他时必须填写审核意见")
+)
+
+// claimScript 领取可领取时间最早的素材，并推迟到领取超时后才能再次领取
+// KEYS[1]为待审核队列，ARGV[1]为当前毫秒时间戳，ARGV[2]为领取超时的毫秒数
+var claimScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #items == 0 then
+	return false
+end
+redis.call('ZADD', KEYS[1], tonumber(ARGV[1]) + tonumber(ARGV[2]), items[1])
+return items[1]
+`)
+
 // AuditRecord 审核记录
 type AuditRecord struct {
-	ID         string      `json:"id"`
-	CreativeID string      `json:"creative_id"`
-	Status     AuditStatus `json:"status"`
-	Reviewer   string      `json:"reviewer"`
-	Comments   string      `json:"comments"`
-	CreateTime time.Time   `json:"create_time"`
-	UpdateTime time.Time   `json:"update_time"`
+	ID          string      `json:"id"`
+	CreativeID  string      `json:"creative_id"`
+	Status      AuditStatus `json:"status"`
+	Reviewer    string      `json:"reviewer"`
+	Comments    string      `json:"comments"`
+	ReasonCodes []string    `json:"reason_codes,omitempty"` // 拒绝原因
+	ClaimTime   *time.Time  `json:"claim_time,omitempty"`   // 审核员领取或被分配的时间
+	DueTime     time.Time   `json:"due_time"`               // 应完成审核的时间
+	CreateTime  time.Time   `json:"create_time"`
+	UpdateTime  time.Time   `json:"update_time"`
+}
+
+// QueueItem 待审核队列中的素材
+type QueueItem struct {
+	*AuditRecord
+	Claimed bool `json:"claimed"` // 已领取且未超时
+	Overdue bool `json:"overdue"` // 已超过审核时限
+}
+
+// QueueStats 待审核队列统计
+type QueueStats struct {
+	Pending int64 `json:"pending"` // 待审核总数
+	Claimed int64 `json:"claimed"` // 已领取且未超时的数量
+}
+
+// BulkReviewResult 批量审核中单个素材的结果
+type BulkReviewResult struct {
+	CreativeID string `json:"creative_id"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AuditStore 审核服务使用的Redis操作，*redis.Client和*redis.ClusterClient均满足该接口
+type AuditStore interface {
+	redis.Scripter
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd
+	LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd
+	LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZAddXX(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZCard(ctx context.Context, key string) *redis.IntCmd
+	ZCount(ctx context.Context, key, min, max string) *redis.IntCmd
 }
 
 // AuditService 审核服务
+// 提交的素材进入待审核队列，审核员按提交顺序领取，领取超时未完成的素材重新排队
 type AuditService struct {
-	redis   *redis.Client
-	logger  *logger.Logger
-	storage storage.Storage
+	redis        AuditStore
+	logger       *logger.Logger
+	storage      storage.Storage
+	notifier     webhook.Notifier
+	sanitizer    *Sanitizer
+	sla          time.Duration
+	claimTimeout time.Duration
 }
 
 // NewAuditService 创建审核服务
-func NewAuditService(redis *redis.Client, logger *logger.Logger, storage storage.Storage) *AuditService {
+func NewAuditService(redis AuditStore, logger *logger.Logger, storage storage.Storage) *AuditService {
 	return &AuditService{
-		redis:   redis,
-		logger:  logger,
-		storage: storage,
+		redis:        redis,
+		logger:       logger,
+		storage:      storage,
+		sanitizer:    NewSanitizer(nil),
+		sla:          DefaultReviewSLA,
+		claimTimeout: DefaultClaimTimeout,
+	}
+}
+
+// SetNotifier 设置事件通知，为nil时不发送通知
+func (as *AuditService) SetNotifier(notifier webhook.Notifier) {
+	as.notifier = notifier
+}
+
+// SetSanitizer 设置HTML/JS素材的净化和安全扫描，默认不允许加载任何外部脚本
+func (as *AuditService) SetSanitizer(sanitizer *Sanitizer) {
+	as.sanitizer = sanitizer
+}
+
+// SetTimeouts 设置审核时限和领取超时，为0的项保持不变
+func (as *AuditService) SetTimeouts(sla, claimTimeout time.Duration) {
+	if sla > 0 {
+		as.sla = sla
+	}
+	if claimTimeout > 0 {
+		as.claimTimeout = claimTimeout
 	}
 }
 
-// SubmitForAudit 提交审核
+// SubmitForAudit 提交审核，素材进入待审核队列
 func (as *AuditService) SubmitForAudit(ctx context.Context, creativeID string) error {
+	now := time.Now()
 	record := &AuditRecord{
-		ID:         generateID(),
+		ID:         id.New(),
 		CreativeID: creativeID,
 		Status:     AuditStatusPending,
-		CreateTime: time.Now(),
-		UpdateTime: time.Now(),
+		DueTime:    now.Add(as.sla),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	if err := as.saveAuditRecord(ctx, record); err != nil {
+		return err
+	}
+	return as.redis.ZAdd(ctx, auditQueueKey, &redis.Z{Score: float64(now.UnixMilli()), Member: creativeID}).Err()
+}
+
+// ClaimNext 为审核员领取最早提交的待审核素材，没有可领取的素材时返回ErrQueueEmpty
+func (as *AuditService) ClaimNext(ctx context.Context, reviewer string) (*AuditRecord, error) {
+	if reviewer == "" {
+		return nil, ErrReviewerRequired
+	}
+
+	for {
+		now := time.Now()
+		creativeID, err := claimScript.Run(ctx, as.redis, []string{auditQueueKey}, now.UnixMilli(), as.claimTimeout.Milliseconds()).Text()
+		if err == redis.Nil {
+			return nil, ErrQueueEmpty
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record, err := as.GetLatestAuditRecord(ctx, creativeID)
+		if errors.Is(err, ErrAuditNotFound) || (err == nil && record.Status != AuditStatusPending) {
+			// 队列中残留的已审核素材，移出后继续领取
+			if err := as.redis.ZRem(ctx, auditQueueKey, creativeID).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record.Reviewer = reviewer
+		record.ClaimTime = &now
+		record.UpdateTime = now
+		if err := as.saveAuditRecord(ctx, record); err != nil {
+			return nil, err
+		}
+		return record, nil
+	}
+}
+
+// Assign 将待审核素材分配给审核员，覆盖已有的领取
+func (as *AuditService) Assign(ctx context.Context, creativeID, reviewer string) (*AuditRecord, error) {
+	if reviewer == "" {
+		return nil, ErrReviewerRequired
+	}
+	record, err := as.GetLatestAuditRecord(ctx, creativeID)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status != AuditStatusPending {
+		return nil, ErrAuditNotPending
+	}
+
+	now := time.Now()
+	claimUntil := float64(now.Add(as.claimTimeout).UnixMilli())
+	if err := as.redis.ZAddXX(ctx, auditQueueKey, &redis.Z{Score: claimUntil, Member: creativeID}).Err(); err != nil {
+		return nil, err
 	}
 
-	return as.saveAuditRecord(ctx, record)
+	record.Reviewer = reviewer
+	record.ClaimTime = &now
+	record.UpdateTime = now
+	if err := as.saveAuditRecord(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
 }
 
-// ReviewCreative 审核素材
-func (as *AuditService) ReviewCreative(ctx context.Context, creativeID string, status AuditStatus, reviewer string, comments string) error {
+// ReviewCreative 审核素材，拒绝时必须填写原因
+// 素材已由其他审核员领取且未超时时返回ErrClaimedByOther
+func (as *AuditService) ReviewCreative(ctx context.Context, creativeID string, status AuditStatus, reviewer string, reasons []string, comments string) error {
+	if reviewer == "" {
+		return ErrReviewerRequired
+	}
+	if err := validateReview(status, reasons, comments); err != nil {
+		return err
+	}
+
 	record, err := as.GetLatestAuditRecord(ctx, creativeID)
 	if err != nil {
 		return err
 	}
+	if record.Status != AuditStatusPending {
+		return ErrAuditNotPending
+	}
+	if record.Reviewer != "" && record.Reviewer != reviewer && as.claimActive(record) {
+		return ErrClaimedByOther
+	}
+
+	creative, err := as.storage.GetCreative(ctx, creativeID)
+	if err != nil {
+		return err
+	}
+	// HTML/JS素材通过审核前先净化并进行安全扫描，未通过扫描的素材不能生效
+	if status == AuditStatusApproved {
+		if err := as.sanitizeCreative(ctx, creative); err != nil {
+			return err
+		}
+	}
 
 	record.Status = status
 	record.Reviewer = reviewer
 	record.Comments = comments
+	record.ReasonCodes = nil
+	if status == AuditStatusRejected {
+		record.ReasonCodes = reasons
+	}
 	record.UpdateTime = time.Now()
 
 	if err := as.saveAuditRecord(ctx, record); err != nil {
 		return err
 	}
+	if err := as.redis.ZRem(ctx, auditQueueKey, creativeID).Err(); err != nil {
+		return err
+	}
 
 	// 更新素材状态
-	return as.updateCreativeStatus(ctx, creativeID, status)
+	if err := as.updateCreativeStatus(ctx, creative, status); err != nil {
+		return err
+	}
+
+	if status == AuditStatusRejected && as.notifier != nil {
+		as.notifier.Notify(ctx, webhook.EventCreativeRejected, map[string]interface{}{
+			"creative_id":  creativeID,
+			"reviewer":     reviewer,
+			"reason_codes": reasons,
+			"comments":     comments,
+		})
+	}
+	return nil
+}
+
+// BulkReview 批量审核素材，单个素材失败不影响其他素材
+func (as *AuditService) BulkReview(ctx context.Context, creativeIDs []string, status AuditStatus, reviewer string, reasons []string, comments string) ([]BulkReviewResult, error) {
+	if reviewer == "" {
+		return nil, ErrReviewerRequired
+	}
+	if err := validateReview(status, reasons, comments); err != nil {
+		return nil, err
+	}
+
+	results := make([]BulkReviewResult, 0, len(creativeIDs))
+	for _, id := range creativeIDs {
+		result := BulkReviewResult{CreativeID: id}
+		if err := as.ReviewCreative(ctx, id, status, reviewer, reasons, comments); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ListQueue 按可领取时间列出待审核素材，已领取的素材排在可领取的素材之后
+func (as *AuditService) ListQueue(ctx context.Context, offset, limit int) ([]*QueueItem, error) {
+	members, err := as.redis.ZRangeWithScores(ctx, auditQueueKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	items := make([]*QueueItem, 0, len(members))
+	for _, member := range members {
+		creativeID := fmt.Sprint(member.Member)
+		record, err := as.GetLatestAuditRecord(ctx, creativeID)
+		if err != nil {
+			as.logger.Error("读取审核记录失败", "creative_id", creativeID, "error", err)
+			continue
+		}
+		items = append(items, &QueueItem{
+			AuditRecord: record,
+			Claimed:     member.Score > float64(now.UnixMilli()),
+			Overdue:     !record.DueTime.IsZero() && now.After(record.DueTime),
+		})
+	}
+	return items, nil
+}
+
+// QueueStats 返回待审核队列统计
+func (as *AuditService) QueueStats(ctx context.Context) (*QueueStats, error) {
+	pending, err := as.redis.ZCard(ctx, auditQueueKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	claimed, err := as.redis.ZCount(ctx, auditQueueKey, fmt.Sprintf("(%d", time.Now().UnixMilli()), "+inf").Result()
+	if err != nil {
+		return nil, err
+	}
+	return &QueueStats{Pending: pending, Claimed: claimed}, nil
 }
 
 // GetLatestAuditRecord 获取最新审核记录
@@ -88,7 +396,7 @@ func (as *AuditService) GetLatestAuditRecord(ctx context.Context, creativeID str
 	data, err := as.redis.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, errors.New("audit record not found")
+			return nil, ErrAuditNotFound
 		}
 		return nil, err
 	}
@@ -124,31 +432,72 @@ func (as *AuditService) GetAuditHistory(ctx context.Context, creativeID string)
 
 // 内部方法
 
+// validateReview 校验审核结果，拒绝时原因必须有效，原因为其他时必须填写审核意见
+func validateReview(status AuditStatus, reasons []string, comments string) error {
+	switch status {
+	case AuditStatusApproved, AuditStatusRevision:
+		return nil
+	case AuditStatusRejected:
+	default:
+		return fmt.Errorf("%w: %s", ErrInvalidAuditStatus, status)
+	}
+
+	if len(reasons) == 0 {
+		return ErrReasonRequired
+	}
+	for _, reason := range reasons {
+		if _, ok := RejectReasons[reason]; !ok {
+			return fmt.Errorf("%w: %s", ErrInvalidReason, reason)
+		}
+		if reason == ReasonOther && comments == "" {
+			return ErrCommentsRequired
+		}
+	}
+	return nil
+}
+
+// claimActive 审核员的领取是否未超时
+func (as *AuditService) claimActive(record *AuditRecord) bool {
+	return record.ClaimTime != nil && time.Since(*record.ClaimTime) < as.claimTimeout
+}
+
+// saveAuditRecord 保存最新记录并追加到历史记录
 func (as *AuditService) saveAuditRecord(ctx context.Context, record *AuditRecord) error {
 	data, err := json.Marshal(record)
 	if err != nil {
 		return err
 	}
 
-	pipe := as.redis.Pipeline()
-
 	// 保存最新记录
-	pipe.Set(ctx, as.getAuditKey(record.CreativeID), data, 0)
-
-	// 添加到历史记录
-	pipe.LPush(ctx, as.getAuditHistoryKey(record.CreativeID), data)
-	pipe.LTrim(ctx, as.getAuditHistoryKey(record.CreativeID), 0, 99) // 保留最近100条记录
+	if err := as.redis.Set(ctx, as.getAuditKey(record.CreativeID), data, 0).Err(); err != nil {
+		return err
+	}
 
-	_, err = pipe.Exec(ctx)
-	return err
+	// 添加到历史记录，保留最近100条
+	historyKey := as.getAuditHistoryKey(record.CreativeID)
+	if err := as.redis.LPush(ctx, historyKey, data).Err(); err != nil {
+		return err
+	}
+	return as.redis.LTrim(ctx, historyKey, 0, 99).Err()
 }
 
-func (as *AuditService) updateCreativeStatus(ctx context.Context, creativeID string, status AuditStatus) error {
-	creative, err := as.storage.GetCreative(ctx, creativeID)
+// sanitizeCreative 净化HTML/JS素材的内容，其他类型的素材不处理
+func (as *AuditService) sanitizeCreative(ctx context.Context, creative *types.Creative) error {
+	if !markupCreative(creative.Type) {
+		return nil
+	}
+	result, err := as.sanitizer.Check(ctx, creative.Content)
 	if err != nil {
 		return err
 	}
+	if len(result.Removed) > 0 {
+		as.logger.Info("素材内容已净化", "creative_id", creative.ID, "removed", result.Removed)
+	}
+	creative.Content = result.Content
+	return nil
+}
 
+func (as *AuditService) updateCreativeStatus(ctx context.Context, creative *types.Creative, status AuditStatus) error {
 	switch status {
 	case AuditStatusApproved:
 		creative.Status = "active"
@@ -0,0 +1,202 @@
+package creative
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/logger"
+)
+
+// 审核接口限制
+const (
+	// MaxBulkReview 单次批量审核的素材数上限
+	MaxBulkReview = 100
+	// defaultQueuePageSize 待审核队列默认每页数量
+	defaultQueuePageSize = 20
+	// maxQueuePageSize 待审核队列每页数量上限
+	maxQueuePageSize = 100
+)
+
+// AuditHandler 素材审核接口，供审核团队领取、分配和审核素材
+type AuditHandler struct {
+	service *AuditService
+	logger  *logger.Logger
+}
+
+// NewAuditHandler 创建素材审核接口
+func NewAuditHandler(service *AuditService, logger *logger.Logger) *AuditHandler {
+	return &AuditHandler{service: service, logger: logger}
+}
+
+// RegisterRoutes 注册路由
+func (h *AuditHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/creatives/audit")
+	{
+		g.GET("/queue", h.ListQueue)
+		g.POST("/queue/claim", h.ClaimNext)
+		g.GET("/reasons", h.ListReasons)
+		g.POST("/bulk-review", h.BulkReview)
+		g.POST("/:id/assign", h.Assign)
+		g.POST("/:id/review", h.Review)
+		g.GET("/:id/history", h.GetHistory)
+	}
+}
+
+// reviewerRequest 领取和分配请求
+type reviewerRequest struct {
+	Reviewer string `json:"reviewer" binding:"required"`
+}
+
+// reviewRequest 审核请求
+type reviewRequest struct {
+	Status      AuditStatus `json:"status" binding:"required"`
+	Reviewer    string      `json:"reviewer" binding:"required"`
+	ReasonCodes []string    `json:"reason_codes"`
+	Comments    string      `json:"comments"`
+}
+
+// bulkReviewRequest 批量审核请求
+type bulkReviewRequest struct {
+	reviewRequest
+	CreativeIDs []string `json:"creative_ids" binding:"required"`
+}
+
+// ListQueue 分页列出待审核素材及队列统计
+func (h *AuditHandler) ListQueue(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultQueuePageSize)))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > maxQueuePageSize {
+		limit = defaultQueuePageSize
+	}
+
+	ctx := c.Request.Context()
+	items, err := h.service.ListQueue(ctx, offset, limit)
+	if err != nil {
+		h.logger.Error("获取待审核队列失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待审核队列失败"})
+		return
+	}
+	stats, err := h.service.QueueStats(ctx)
+	if err != nil {
+		h.logger.Error("获取待审核队列统计失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待审核队列失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items, "stats": stats})
+}
+
+// ClaimNext 领取下一个待审核素材
+func (h *AuditHandler) ClaimNext(c *gin.Context) {
+	var req reviewerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	record, err := h.service.ClaimNext(c.Request.Context(), req.Reviewer)
+	if err != nil {
+		h.writeError(c, "领取待审核素材失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// ListReasons 列出可用的拒绝原因
+func (h *AuditHandler) ListReasons(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"reasons": RejectReasons})
+}
+
+// Assign 将素材分配给审核员
+func (h *AuditHandler) Assign(c *gin.Context) {
+	var req reviewerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	record, err := h.service.Assign(c.Request.Context(), c.Param("id"), req.Reviewer)
+	if err != nil {
+		h.writeError(c, "分配审核员失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
+
+// Review 审核单个素材
+func (h *AuditHandler) Review(c *gin.Context) {
+	var req reviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.service.ReviewCreative(c.Request.Context(), id, req.Status, req.Reviewer, req.ReasonCodes, req.Comments); err != nil {
+		h.writeError(c, "审核素材失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "审核完成"})
+}
+
+// BulkReview 批量通过或拒绝素材，返回每个素材的结果
+func (h *AuditHandler) BulkReview(c *gin.Context) {
+	var req bulkReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if len(req.CreativeIDs) > MaxBulkReview {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "批量审核的素材数量超过上限"})
+		return
+	}
+
+	results, err := h.service.BulkReview(c.Request.Context(), req.CreativeIDs, req.Status, req.Reviewer, req.ReasonCodes, req.Comments)
+	if err != nil {
+		h.writeError(c, "批量审核素材失败", err)
+		return
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results, "succeeded": len(results) - failed, "failed": failed})
+}
+
+// GetHistory 获取素材的审核历史
+func (h *AuditHandler) GetHistory(c *gin.Context) {
+	records, err := h.service.GetAuditHistory(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.logger.Error("获取审核历史失败", "creative_id", c.Param("id"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取审核历史失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"records": records})
+}
+
+// writeError 按错误类型返回状态码
+func (h *AuditHandler) writeError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, ErrReviewerRequired), errors.Is(err, ErrInvalidAuditStatus),
+		errors.Is(err, ErrReasonRequired), errors.Is(err, ErrInvalidReason), errors.Is(err, ErrCommentsRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAuditNotFound), errors.Is(err, ErrQueueEmpty):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAuditNotPending), errors.Is(err, ErrClaimedByOther):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnsafeCreative):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(msg, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
@@ -0,0 +1,417 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: detector.go
+ * Project: simple-dsp
+ * Description: 素材疲劳检测，素材的CTR随投放时间持续下降时自动降低轮换权重或暂停该素材
+ *
+ * 主要功能:
+ * - 定时比较每个投放中的出价策略下各启用素材近期窗口与此前基准窗口的CTR
+ * - CTR下降比例达到阈值时按系数降低素材的轮换权重，同一策略的其他素材获得更多出价
+ * - 下降比例达到暂停阈值时暂停该素材与策略的关联，策略和其他素材继续投放
+ * - 操作写入审计日志，并通过Webhook通知广告主更换素材
+ *
+ * 实现细节:
+ * - 统计数据取自按素材的小时统计，竞价时按轮换权重选择素材，展示和点击事件携带素材ID，两个窗口都按小时取整
+ * - 两个窗口的展示数都达到下限时才检测，避免小样本的波动被误判
+ * - 操作后在冷却时间内不再检测该素材，等待调整后的数据进入近期窗口
+ * - 整轮只发布一次策略变更通知，竞价节点刷新策略缓存中的素材
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/internal/audit
+ * - simple-dsp/internal/bidding
+ * - simple-dsp/internal/stats
+ * - simple-dsp/internal/webhook
+ * - simple-dsp/pkg/clock
+ * - simple-dsp/pkg/lock
+ *
+ * 注意事项:
+ * - 权重达到下限后不再降低，只有达到暂停阈值才暂停
+ * - 被暂停的素材需手动启用，权重不会自动恢复；策略的素材全部暂停后出价不再携带素材
+ * - 多实例部署时只应在选主的主实例上运行，并设置分布式锁防止主实例切换时重叠执行
+ */
+
+package fatigue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/audit"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/stats"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultInterval        = time.Hour
+	defaultRecentWindow    = 24 * time.Hour
+	defaultBaselineWindow  = 72 * time.Hour
+	defaultMinImpressions  = 1000
+	defaultDownweightDecay = 0.3
+	defaultWeightFactor    = 0.5
+	defaultMinWeight       = 0.1
+	defaultCooldown        = 24 * time.Hour
+	detectTimeout          = 5 * time.Minute
+	strategyPageSize       = 500
+
+	// detectLockName 定时检测的分布式锁
+	detectLockName = "fatigue:detect"
+	// cooldownKeyPrefix 操作后的冷却标记，完整键为fatigue:cooldown:{strategy_id}:{creative_id}
+	cooldownKeyPrefix = "fatigue:cooldown:"
+
+	// operator 审计日志中的操作人
+	operator = "creative_fatigue"
+	// changeAction 策略变更通知中的动作
+	changeAction = "creative_fatigue"
+)
+
+// 检测后的操作
+const (
+	// ActionDownweight 降低素材的轮换权重
+	ActionDownweight = "downweight"
+	// ActionPause 暂停素材
+	ActionPause = "pause"
+)
+
+// StatsSource 按时间窗口汇总的素材统计
+type StatsSource interface {
+	LoadCreativeWindow(ctx context.Context, adID, creativeID string, from, to time.Time) (*stats.WindowStats, error)
+}
+
+// Action 一次因素材疲劳对策略素材的操作
+type Action struct {
+	StrategyID string `json:"strategy_id"`
+	CampaignID string `json:"campaign_id,omitempty"`
+	CreativeID int64  `json:"creative_id"`
+	// Action 操作类型，downweight或pause
+	Action string `json:"action"`
+	// BaselineCTR、RecentCTR 基准窗口和近期窗口的CTR
+	BaselineCTR float64 `json:"baseline_ctr"`
+	RecentCTR   float64 `json:"recent_ctr"`
+	// Decay CTR的下降比例
+	Decay float64 `json:"decay"`
+	// BeforeWeight、AfterWeight 操作前后素材的轮换权重，暂停时不变
+	BeforeWeight float64   `json:"before_weight"`
+	AfterWeight  float64   `json:"after_weight"`
+	CreateTime   time.Time `json:"create_time"`
+}
+
+// Detector 素材疲劳检测
+type Detector struct {
+	cfg        config.FatigueConfig
+	strategies bidding.Repository
+	stats      StatsSource
+	redis      *redis.Client
+	recorder   *audit.Recorder
+	notifier   webhook.Notifier
+	locker     *lock.Locker
+	logger     *logger.Logger
+	// clock 计算统计窗口的时间来源
+	clock clock.Clock
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewDetector 创建素材疲劳检测，未设置的参数使用默认值
+func NewDetector(cfg config.FatigueConfig, strategies bidding.Repository, statsSource StatsSource, redisClient *redis.Client, logger *logger.Logger) *Detector {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.RecentWindow < time.Hour {
+		cfg.RecentWindow = defaultRecentWindow
+	}
+	if cfg.BaselineWindow < time.Hour {
+		cfg.BaselineWindow = defaultBaselineWindow
+	}
+	if cfg.MinImpressions <= 0 {
+		cfg.MinImpressions = defaultMinImpressions
+	}
+	if cfg.DownweightDecay <= 0 {
+		cfg.DownweightDecay = defaultDownweightDecay
+	}
+	if cfg.WeightFactor <= 0 || cfg.WeightFactor >= 1 {
+		cfg.WeightFactor = defaultWeightFactor
+	}
+	if cfg.MinWeight <= 0 {
+		cfg.MinWeight = defaultMinWeight
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultCooldown
+	}
+	return &Detector{
+		cfg:        cfg,
+		strategies: strategies,
+		stats:      statsSource,
+		redis:      redisClient,
+		logger:     logger,
+		clock:      clock.Real(),
+	}
+}
+
+// SetAuditRecorder 设置审计日志，设置后修改出价策略时写入审计记录
+func (d *Detector) SetAuditRecorder(recorder *audit.Recorder) {
+	d.recorder = recorder
+}
+
+// SetNotifier 设置事件通知，设置后修改出价策略时发送素材疲劳通知
+func (d *Detector) SetNotifier(notifier webhook.Notifier) {
+	d.notifier = notifier
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时检测
+func (d *Detector) SetLocker(locker *lock.Locker) {
+	d.locker = locker
+}
+
+// SetClock 设置计算统计窗口的时间来源，为nil时使用系统时钟
+func (d *Detector) SetClock(c clock.Clock) {
+	d.clock = clock.OrReal(c)
+}
+
+// Start 启动定时检测
+func (d *Detector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancelFunc = cancel
+
+	d.wg.Add(1)
+	go d.runLoop(ctx)
+}
+
+// Stop 停止定时检测
+func (d *Detector) Stop() {
+	if d.cancelFunc == nil {
+		return
+	}
+	d.cancelFunc()
+	d.wg.Wait()
+}
+
+// RunOnce 检测所有投放中的出价策略的启用素材，返回本次执行的操作
+func (d *Detector) RunOnce(ctx context.Context) ([]Action, error) {
+	strategies, err := d.enabledStrategies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.clock.Now()
+	var actions []Action
+	for i := range strategies {
+		strategy := &strategies[i]
+		creatives, err := d.strategies.ListCreatives(ctx, strategy.ID)
+		if err != nil {
+			d.logger.Error("查询策略素材失败", "strategy_id", strategy.ID, "error", err)
+			continue
+		}
+		for j := range creatives {
+			if creatives[j].Status != bidding.StrategyStatusEnabled {
+				continue
+			}
+			action, err := d.detect(ctx, strategy, &creatives[j], now)
+			if err != nil {
+				d.logger.Error("检测素材疲劳失败", "strategy_id", strategy.ID, "creative_id", creatives[j].CreativeID, "error", err)
+				continue
+			}
+			if action != nil {
+				actions = append(actions, *action)
+			}
+		}
+	}
+
+	// 整轮只通知一次，避免竞价节点反复全量刷新
+	if len(actions) > 0 {
+		if err := bidding.PublishStrategyChange(ctx, d.redis, "", changeAction); err != nil {
+			d.logger.Warn("发布策略变更通知失败", "error", err)
+		}
+	}
+	return actions, nil
+}
+
+// detect 检测出价策略的单个素材，未触发或在冷却时间内时返回nil
+func (d *Detector) detect(ctx context.Context, strategy *bidding.BidStrategy, creative *bidding.BidStrategyCreative, now time.Time) (*Action, error) {
+	key := cooldownKey(strategy.ID, creative.CreativeID)
+	cooling, err := d.redis.Exists(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取冷却标记失败: %w", err)
+	}
+	if cooling > 0 {
+		return nil, nil
+	}
+
+	baselineCTR, recentCTR, ok, err := d.ctrs(ctx, strategy.ID, strconv.FormatInt(creative.CreativeID, 10), now)
+	if err != nil || !ok {
+		return nil, err
+	}
+	decay := 1 - recentCTR/baselineCTR
+
+	weight := creative.Weight
+	if weight <= 0 {
+		weight = 1
+	}
+	action := &Action{
+		StrategyID:   strategy.ID,
+		CampaignID:   strategy.CampaignID,
+		CreativeID:   creative.CreativeID,
+		BaselineCTR:  baselineCTR,
+		RecentCTR:    recentCTR,
+		Decay:        decay,
+		BeforeWeight: weight,
+		AfterWeight:  weight,
+		CreateTime:   now,
+	}
+	switch {
+	case d.cfg.PauseDecay > 0 && decay >= d.cfg.PauseDecay:
+		action.Action = ActionPause
+	case decay >= d.cfg.DownweightDecay && weight > d.cfg.MinWeight:
+		action.Action = ActionDownweight
+		// 权重与bid_strategy_creatives.weight一致保留3位小数
+		action.AfterWeight = math.Round(math.Max(weight*d.cfg.WeightFactor, d.cfg.MinWeight)*1000) / 1000
+	default:
+		return nil, nil
+	}
+
+	if err := d.apply(ctx, creative, action, key); err != nil {
+		return nil, err
+	}
+	return action, nil
+}
+
+// ctrs 返回素材基准窗口和近期窗口的CTR，展示数不足或基准CTR为0时ok为false
+// 近期窗口包含当前小时，基准窗口紧接在近期窗口之前
+func (d *Detector) ctrs(ctx context.Context, adID, creativeID string, now time.Time) (baseline, recent float64, ok bool, err error) {
+	recentFrom := now.Add(-(d.cfg.RecentWindow - time.Hour))
+	recentWindow, err := d.stats.LoadCreativeWindow(ctx, adID, creativeID, recentFrom, now)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	baselineTo := recentFrom.Add(-time.Hour)
+	baselineWindow, err := d.stats.LoadCreativeWindow(ctx, adID, creativeID, baselineTo.Add(-(d.cfg.BaselineWindow - time.Hour)), baselineTo)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if recentWindow.Impressions < d.cfg.MinImpressions || baselineWindow.Impressions < d.cfg.MinImpressions || baselineWindow.Clicks == 0 {
+		return 0, 0, false, nil
+	}
+	baseline = float64(baselineWindow.Clicks) / float64(baselineWindow.Impressions)
+	recent = float64(recentWindow.Clicks) / float64(recentWindow.Impressions)
+	return baseline, recent, true, nil
+}
+
+// apply 修改素材的状态或轮换权重并设置冷却标记，之后写入审计日志和发送通知，失败只记录日志
+func (d *Detector) apply(ctx context.Context, creative *bidding.BidStrategyCreative, action *Action, key string) error {
+	before := map[string]interface{}{"creative_id": creative.CreativeID, "status": creative.Status, "weight": creative.Weight}
+
+	status, weight := creative.Status, action.AfterWeight
+	if action.Action == ActionPause {
+		status = bidding.StrategyStatusDisabled
+	}
+	if err := d.strategies.UpdateCreative(ctx, creative.StrategyID, creative.CreativeID, status, weight); err != nil {
+		return err
+	}
+	creative.Status, creative.Weight = status, weight
+
+	log := d.logger.With("strategy_id", action.StrategyID, "creative_id", action.CreativeID)
+	log.Warn("素材CTR持续下降，已调整素材",
+		"campaign_id", action.CampaignID,
+		"action", action.Action,
+		"baseline_ctr", action.BaselineCTR,
+		"recent_ctr", action.RecentCTR,
+		"decay", action.Decay,
+		"before_weight", action.BeforeWeight,
+		"after_weight", action.AfterWeight)
+
+	// 变更已生效，以下步骤失败不影响结果
+	if err := d.redis.Set(ctx, key, action.Action, d.cfg.Cooldown).Err(); err != nil {
+		log.Error("设置冷却标记失败", "error", err)
+	}
+	if d.recorder != nil {
+		err := d.recorder.Record(ctx, audit.Entry{
+			Operator:     operator,
+			Action:       "fatigue_" + action.Action,
+			ResourceType: audit.ResourceStrategy,
+			ResourceID:   action.StrategyID,
+			Before:       before,
+			After:        map[string]interface{}{"creative_id": creative.CreativeID, "status": creative.Status, "weight": creative.Weight, "fatigue": action},
+		})
+		if err != nil {
+			log.Error("写入审计日志失败", "error", err)
+		}
+	}
+	if d.notifier != nil {
+		d.notifier.Notify(ctx, webhook.EventCreativeFatigued, map[string]interface{}{
+			"strategy_id":   action.StrategyID,
+			"campaign_id":   action.CampaignID,
+			"creative_id":   action.CreativeID,
+			"action":        action.Action,
+			"baseline_ctr":  action.BaselineCTR,
+			"recent_ctr":    action.RecentCTR,
+			"decay":         action.Decay,
+			"before_weight": action.BeforeWeight,
+			"after_weight":  action.AfterWeight,
+		})
+	}
+	return nil
+}
+
+// cooldownKey 素材的冷却标记键
+func cooldownKey(strategyID string, creativeID int64) string {
+	return cooldownKeyPrefix + strategyID + ":" + strconv.FormatInt(creativeID, 10)
+}
+
+// enabledStrategies 分页读取投放中的出价策略
+func (d *Detector) enabledStrategies(ctx context.Context) ([]bidding.BidStrategy, error) {
+	status := bidding.StrategyStatusEnabled
+	var result []bidding.BidStrategy
+	for page := 1; ; page++ {
+		strategies, total, err := d.strategies.ListBidStrategies(ctx, bidding.BidStrategyFilter{
+			Page:     page,
+			PageSize: strategyPageSize,
+			Status:   &status,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("加载出价策略失败: %w", err)
+		}
+		result = append(result, strategies...)
+		if len(strategies) < strategyPageSize || int64(page*strategyPageSize) >= total {
+			return result, nil
+		}
+	}
+}
+
+// runLoop 定时检测素材疲劳
+func (d *Detector) runLoop(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, detectTimeout)
+			err := d.locker.Do(runCtx, detectLockName, func(ctx context.Context) error {
+				_, err := d.RunOnce(ctx)
+				return err
+			})
+			if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+				d.logger.Error("检测素材疲劳失败", "error", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package creative
+
+import "simple-dsp/pkg/listing"
+
+// scanBatchSize 遍历Redis键时每批的数量
+const scanBatchSize = 500
+
+// CreativeListSpec 素材列表允许的排序和过滤字段
+var CreativeListSpec = listing.Spec{
+	Sortable:    []string{"name", "type", "size", "status", "create_time", "update_time"},
+	Filterable:  []string{"type", "format", "status", "tags", "width", "height"},
+	DefaultSort: "-create_time",
+}
+
+// GroupListSpec 素材组列表允许的排序和过滤字段
+var GroupListSpec = listing.Spec{
+	Sortable:    []string{"name", "status", "create_time", "update_time"},
+	Filterable:  []string{"status", "creatives"},
+	DefaultSort: "-create_time",
+}
+
+// creativeField 读取素材字段
+func creativeField(c *Creative, field string) interface{} {
+	switch field {
+	case "id":
+		return c.ID
+	case "name":
+		return c.Name
+	case "type":
+		return c.Type
+	case "format":
+		return c.Format
+	case "size":
+		return c.Size
+	case "width":
+		return c.Width
+	case "height":
+		return c.Height
+	case "tags":
+		return c.Tags
+	case "status":
+		return c.Status
+	case "create_time":
+		return c.CreateTime
+	case "update_time":
+		return c.UpdateTime
+	}
+	return nil
+}
+
+// groupField 读取素材组字段
+func groupField(g *CreativeGroup, field string) interface{} {
+	switch field {
+	case "id":
+		return g.ID
+	case "name":
+		return g.Name
+	case "creatives":
+		return g.Creatives
+	case "status":
+		return g.Status
+	case "create_time":
+		return g.CreateTime
+	case "update_time":
+		return g.UpdateTime
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+package creative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrUnsafeCreative 表示素材未通过安全扫描
+var ErrUnsafeCreative = errors.New("素材未通过安全扫描")
+
+// allowedTags 允许保留的标签，其余标签移除但保留其中的文本
+var allowedTags = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "style": true, "script": true, "noscript": true,
+	"div": true, "span": true, "p": true, "a": true, "img": true, "br": true, "hr": true,
+	"b": true, "strong": true, "i": true, "em": true, "u": true, "small": true, "sub": true, "sup": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "center": true, "font": true,
+	"ul": true, "ol": true, "li": true, "table": true, "thead": true, "tbody": true, "tr": true, "td": true, "th": true,
+	"section": true, "header": true, "footer": true, "article": true, "figure": true, "figcaption": true,
+	"picture": true, "video": true, "audio": true, "source": true, "canvas": true, "button": true, "label": true,
+}
+
+// blockedTags 连同内容一起移除的标签
+var blockedTags = map[string]bool{
+	"iframe": true, "frame": true, "frameset": true, "object": true, "applet": true, "embed": true,
+	"form": true, "svg": true, "math": true, "template": true, "noembed": true, "noframes": true,
+	"base": true, "meta": true, "link": true,
+}
+
+// allowedAttrs 允许保留的属性，data-*属性均允许，on*事件属性均移除
+var allowedAttrs = map[string]bool{
+	"id": true, "class": true, "style": true, "href": true, "src": true, "srcset": true, "alt": true, "title": true,
+	"width": true, "height": true, "align": true, "valign": true, "border": true, "target": true, "rel": true,
+	"type": true, "poster": true, "controls": true, "autoplay": true, "muted": true, "loop": true, "playsinline": true,
+	"colspan": true, "rowspan": true, "color": true, "size": true, "face": true, "async": true, "defer": true, "charset": true,
+}
+
+// urlAttrs 取值为URL的属性
+var urlAttrs = map[string]bool{"href": true, "src": true, "poster": true}
+
+// SanitizeResult HTML素材的净化结果
+type SanitizeResult struct {
+	Content string   `json:"content"`
+	Removed []string `json:"removed,omitempty"` // 移除的标签、属性和脚本，如tag:iframe、attr:img.onerror、script:evil.com
+	URLs    []string `json:"urls,omitempty"`    // 素材引用的外部URL，供安全扫描使用
+}
+
+// ScanVerdict 安全扫描结果
+type ScanVerdict struct {
+	Malicious bool   `json:"malicious"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Scanner 恶意代码和URL信誉扫描
+type Scanner interface {
+	Scan(ctx context.Context, content string, urls []string) (*ScanVerdict, error)
+}
+
+// ScannerFunc 函数形式的扫描器
+type ScannerFunc func(ctx context.Context, content string, urls []string) (*ScanVerdict, error)
+
+// Scan 调用函数本身
+func (f ScannerFunc) Scan(ctx context.Context, content string, urls []string) (*ScanVerdict, error) {
+	return f(ctx, content, urls)
+}
+
+// Sanitizer HTML/JS素材净化，移除不在白名单中的标签和属性，只允许从白名单域名加载外部脚本
+// JS素材为script标签形式的广告代码，同样按HTML处理
+type Sanitizer struct {
+	scriptDomains []string
+	scanner       Scanner
+}
+
+// NewSanitizer 创建素材净化，scriptDomains为允许加载外部脚本的域名，其子域名同样允许
+func NewSanitizer(scriptDomains []string) *Sanitizer {
+	domains := make([]string, 0, len(scriptDomains))
+	for _, d := range scriptDomains {
+		if d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), "."); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return &Sanitizer{scriptDomains: domains}
+}
+
+// SetScanner 设置安全扫描，为nil时只做净化
+func (s *Sanitizer) SetScanner(scanner Scanner) {
+	s.scanner = scanner
+}
+
+// Check 净化素材并进行安全扫描，扫描判定为恶意时返回ErrUnsafeCreative
+// 扫描服务异常时同样返回错误，素材不能生效
+func (s *Sanitizer) Check(ctx context.Context, content string) (*SanitizeResult, error) {
+	result := s.Sanitize(content)
+	if s.scanner == nil {
+		return result, nil
+	}
+
+	verdict, err := s.scanner.Scan(ctx, result.Content, result.URLs)
+	if err != nil {
+		return nil, fmt.Errorf("素材安全扫描失败: %w", err)
+	}
+	if verdict != nil && verdict.Malicious {
+		return nil, fmt.Errorf("%w: %s", ErrUnsafeCreative, verdict.Reason)
+	}
+	return result, nil
+}
+
+// Sanitize 净化HTML内容
+func (s *Sanitizer) Sanitize(content string) *SanitizeResult {
+	result := &SanitizeResult{}
+	seen := make(map[string]bool)
+	addURL := func(u string) {
+		if !seen[u] {
+			seen[u] = true
+			result.URLs = append(result.URLs, u)
+		}
+	}
+
+	var b strings.Builder
+	z := html.NewTokenizer(strings.NewReader(content))
+	// skip为非空时跳过直到该标签闭合，depth为嵌套层数
+	var skip string
+	depth := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// 无法解析的剩余内容直接丢弃
+				result.Removed = append(result.Removed, "invalid")
+			}
+			break
+		}
+		token := z.Token()
+
+		if skip != "" {
+			switch {
+			case tt == html.StartTagToken && token.Data == skip:
+				depth++
+			case tt == html.EndTagToken && token.Data == skip:
+				if depth--; depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.TextToken, html.DoctypeToken:
+			// 保留原文，避免转义脚本和样式中的字符
+			b.Write(z.Raw())
+		case html.CommentToken:
+			// 注释可能包含条件注释，直接移除
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name := token.Data
+			if blockedTags[name] || !allowedTags[name] {
+				if tt == html.StartTagToken || tt == html.SelfClosingTagToken {
+					result.Removed = append(result.Removed, "tag:"+name)
+					if tt == html.StartTagToken && blockedTags[name] && !voidTag(name) {
+						skip, depth = name, 1
+					}
+				}
+				continue
+			}
+			if tt == html.EndTagToken {
+				b.WriteString(token.String())
+				continue
+			}
+
+			if name == "script" {
+				if src, ok := attr(token, "src"); ok {
+					host := scriptHost(src)
+					if !s.allowScript(host) {
+						result.Removed = append(result.Removed, "script:"+host)
+						if tt == html.StartTagToken {
+							skip, depth = name, 1
+						}
+						continue
+					}
+				}
+			}
+			token.Attr = s.sanitizeAttrs(token, result, addURL)
+			b.WriteString(token.String())
+		}
+	}
+
+	result.Content = b.String()
+	return result
+}
+
+// sanitizeAttrs 移除不允许的属性和危险的URL
+func (s *Sanitizer) sanitizeAttrs(token html.Token, result *SanitizeResult, addURL func(string)) []html.Attribute {
+	attrs := token.Attr[:0:0]
+	for _, a := range token.Attr {
+		key := strings.ToLower(a.Key)
+		if a.Namespace != "" || (!allowedAttrs[key] && !strings.HasPrefix(key, "data-")) {
+			result.Removed = append(result.Removed, "attr:"+token.Data+"."+key)
+			continue
+		}
+		if urlAttrs[key] {
+			scheme := urlScheme(a.Val)
+			switch {
+			case scheme == "http" || scheme == "https" || strings.HasPrefix(strings.TrimSpace(a.Val), "//"):
+				addURL(strings.TrimSpace(a.Val))
+			case scheme == "data" && token.Data == "img" && strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "data:image/"):
+			case scheme != "":
+				result.Removed = append(result.Removed, "attr:"+token.Data+"."+key)
+				continue
+			}
+		}
+		if key == "style" || key == "srcset" {
+			lower := strings.ToLower(a.Val)
+			if strings.Contains(lower, "javascript:") || strings.Contains(lower, "expression(") {
+				result.Removed = append(result.Removed, "attr:"+token.Data+"."+key)
+				continue
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	return attrs
+}
+
+// allowScript 判断是否允许从该域名加载脚本
+func (s *Sanitizer) allowScript(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, d := range s.scriptDomains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// attr 读取标签属性
+func attr(token html.Token, key string) (string, bool) {
+	for _, a := range token.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// scriptHost 返回脚本地址的域名，相对地址返回空
+func scriptHost(src string) string {
+	u, err := url.Parse(strings.TrimSpace(src))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// urlScheme 返回URL的协议，相对地址返回空
+func urlScheme(raw string) string {
+	// 浏览器会忽略协议中的空白和控制字符
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, raw)
+	if i := strings.IndexByte(cleaned, ':'); i > 0 && !strings.ContainsAny(cleaned[:i], "/?#") {
+		return strings.ToLower(cleaned[:i])
+	}
+	return ""
+}
+
+// markupCreative 判断素材内容是否为HTML/JS代码
+func markupCreative(creativeType string) bool {
+	switch creativeType {
+	case "html", "js":
+		return true
+	}
+	return false
+}
+
+// voidTag 判断是否为没有闭合标签的元素
+func voidTag(name string) bool {
+	switch name {
+	case "base", "meta", "link", "embed", "img", "br", "hr", "source", "input":
+		return true
+	}
+	return false
+}
@@ -5,23 +5,39 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"simple-dsp/internal/creative/storage"
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// ErrCreativeNotFound 表示素材不存在或已删除
+var ErrCreativeNotFound = errors.New("素材不存在")
+
+// 素材状态
+const (
+	statusInactive = "inactive"
+	statusDeleted  = "deleted"
+)
+
 // Service 素材管理服务
 type Service struct {
 	redis   *redis.Client
 	logger  *logger.Logger
 	metrics *metrics.Metrics
 	storage storage.Storage
+	// sanitizer HTML素材的净化和安全扫描
+	sanitizer *Sanitizer
 }
 
 // Creative 素材信息
@@ -40,6 +56,8 @@ type Creative struct {
 	Status      string    `json:"status"`       // active, inactive, deleted
 	CreateTime  time.Time `json:"create_time"`
 	UpdateTime  time.Time `json:"update_time"`
+	// DeleteTime 删除时间，删除后保留在回收站中直到被清理
+	DeleteTime *time.Time `json:"delete_time,omitempty"`
 }
 
 // CreativeGroup 素材组
@@ -56,17 +74,23 @@ type CreativeGroup struct {
 // NewService 创建素材管理服务
 func NewService(redis *redis.Client, logger *logger.Logger, metrics *metrics.Metrics, storage storage.Storage) *Service {
 	return &Service{
-		redis:   redis,
-		logger:  logger,
-		metrics: metrics,
-		storage: storage,
+		redis:     redis,
+		logger:    logger,
+		metrics:   metrics,
+		storage:   storage,
+		sanitizer: NewSanitizer(nil),
 	}
 }
 
+// SetSanitizer 设置HTML素材的净化和安全扫描，默认不允许加载任何外部脚本
+func (s *Service) SetSanitizer(sanitizer *Sanitizer) {
+	s.sanitizer = sanitizer
+}
+
 // UploadCreative 上传素材
 func (s *Service) UploadCreative(ctx context.Context, file *multipart.FileHeader, tags []string) (*Creative, error) {
 	// 生成素材ID
-	id := generateID()
+	creativeID := id.New()
 
 	// 获取文件信息
 	filename := file.Filename
@@ -74,10 +98,14 @@ func (s *Service) UploadCreative(ctx context.Context, file *multipart.FileHeader
 	format := filepath.Ext(filename)
 
 	// 构建存储路径
-	storagePath := fmt.Sprintf("creatives/%s/%s", time.Now().Format("20060102"), id+format)
+	storagePath := fmt.Sprintf("creatives/%s/%s", time.Now().Format("20060102"), creativeID+format)
 
-	// 保存文件
-	if err := s.storage.Save(ctx, storagePath, file); err != nil {
+	// 保存文件，HTML素材净化并通过安全扫描后保存净化后的内容
+	if markupCreative(getCreativeType(format)) {
+		if err := s.saveMarkup(ctx, storagePath, file); err != nil {
+			return nil, err
+		}
+	} else if err := s.storage.Save(ctx, storagePath, file); err != nil {
 		return nil, fmt.Errorf("保存文件失败: %v", err)
 	}
 
@@ -89,7 +117,7 @@ func (s *Service) UploadCreative(ctx context.Context, file *multipart.FileHeader
 
 	// 创建素材信息
 	creative := &Creative{
-		ID:          id,
+		ID:          creativeID,
 		Name:        filename,
 		Type:        getCreativeType(format),
 		Format:      format,
@@ -115,27 +143,28 @@ func (s *Service) UploadCreative(ctx context.Context, file *multipart.FileHeader
 }
 
 // DeleteCreative 删除素材
+// 素材移入回收站，存储文件在回收站清理时才删除
 func (s *Service) DeleteCreative(ctx context.Context, id string) error {
 	// 获取素材信息
 	creative, err := s.GetCreative(ctx, id)
 	if err != nil {
 		return err
 	}
+	if creative.Status == statusDeleted {
+		return ErrCreativeNotFound
+	}
 
 	// 标记为删除状态
-	creative.Status = "deleted"
-	creative.UpdateTime = time.Now()
+	now := time.Now()
+	creative.Status = statusDeleted
+	creative.UpdateTime = now
+	creative.DeleteTime = &now
 
 	// 保存更新
 	if err := s.saveCreative(ctx, creative); err != nil {
 		return err
 	}
 
-	// 删除存储文件
-	if err := s.storage.Delete(ctx, creative.StoragePath); err != nil {
-		s.logger.Error("删除存储文件失败", "error", err)
-	}
-
 	// 更新指标
 	s.metrics.Creative.Deleted.Inc()
 
@@ -148,7 +177,7 @@ func (s *Service) GetCreative(ctx context.Context, id string) (*Creative, error)
 	data, err := s.redis.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, errors.New("素材不存在")
+			return nil, ErrCreativeNotFound
 		}
 		return nil, err
 	}
@@ -162,11 +191,13 @@ func (s *Service) GetCreative(ctx context.Context, id string) (*Creative, error)
 }
 
 // ListCreatives 获取素材列表
-func (s *Service) ListCreatives(ctx context.Context, tags []string) ([]*Creative, error) {
+// 指定标签时只返回带有任一标签的素材，支持按listing.Query分页、排序和过滤
+func (s *Service) ListCreatives(ctx context.Context, tags []string, q listing.Query) (listing.Page[*Creative], error) {
 	var creatives []*Creative
 
 	// 如果指定了标签，通过标签索引获取
 	if len(tags) > 0 {
+		seen := make(map[string]bool)
 		for _, tag := range tags {
 			key := fmt.Sprintf("creative:tag:%s", tag)
 			ids, err := s.redis.SMembers(ctx, key).Result()
@@ -174,43 +205,44 @@ func (s *Service) ListCreatives(ctx context.Context, tags []string) ([]*Creative
 				continue
 			}
 			for _, id := range ids {
-				if creative, err := s.GetCreative(ctx, id); err == nil && creative.Status != "deleted" {
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+				if creative, err := s.GetCreative(ctx, id); err == nil && creative.Status != statusDeleted {
 					creatives = append(creatives, creative)
 				}
 			}
 		}
-		return creatives, nil
-	}
-
-	// 获取所有素材
-	keys, err := s.redis.Keys(ctx, "creative:*").Result()
-	if err != nil {
-		return nil, err
+		return listing.Apply(creatives, q, creativeField), nil
 	}
 
-	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			continue
+	// 获取所有素材，跳过标签、素材组、版本等同前缀的键
+	err := s.scanRecords(ctx, "creative:*", func(key string, data []byte) {
+		if strings.Contains(strings.TrimPrefix(key, "creative:"), ":") {
+			return
 		}
 
 		var creative Creative
 		if err := json.Unmarshal(data, &creative); err != nil {
-			continue
+			return
 		}
 
-		if creative.Status != "deleted" {
+		if creative.Status != statusDeleted {
 			creatives = append(creatives, &creative)
 		}
+	})
+	if err != nil {
+		return listing.Page[*Creative]{}, err
 	}
 
-	return creatives, nil
+	return listing.Apply(creatives, q, creativeField), nil
 }
 
 // CreateGroup 创建素材组
 func (s *Service) CreateGroup(ctx context.Context, group *CreativeGroup) error {
 	// 生成组ID
-	group.ID = generateID()
+	group.ID = id.New()
 	group.CreateTime = time.Now()
 	group.UpdateTime = time.Now()
 	group.Status = "active"
@@ -255,7 +287,7 @@ func (s *Service) DeleteGroup(ctx context.Context, id string) error {
 	}
 
 	// 标记为删除状态
-	group.Status = "deleted"
+	group.Status = statusDeleted
 	group.UpdateTime = time.Now()
 
 	// 保存更新
@@ -288,32 +320,25 @@ func (s *Service) GetGroup(ctx context.Context, id string) (*CreativeGroup, erro
 	return &group, nil
 }
 
-// ListGroups 获取素材组列表
-func (s *Service) ListGroups(ctx context.Context) ([]*CreativeGroup, error) {
+// ListGroups 获取素材组列表，支持按listing.Query分页、排序和过滤
+func (s *Service) ListGroups(ctx context.Context, q listing.Query) (listing.Page[*CreativeGroup], error) {
 	var groups []*CreativeGroup
 
-	keys, err := s.redis.Keys(ctx, "creative:group:*").Result()
-	if err != nil {
-		return nil, err
-	}
-
-	for _, key := range keys {
-		data, err := s.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			continue
-		}
-
+	err := s.scanRecords(ctx, "creative:group:*", func(key string, data []byte) {
 		var group CreativeGroup
 		if err := json.Unmarshal(data, &group); err != nil {
-			continue
+			return
 		}
 
-		if group.Status != "deleted" {
+		if group.Status != statusDeleted {
 			groups = append(groups, &group)
 		}
+	})
+	if err != nil {
+		return listing.Page[*CreativeGroup]{}, err
 	}
 
-	return groups, nil
+	return listing.Apply(groups, q, groupField), nil
 }
 
 // 内部方法
@@ -348,6 +373,31 @@ func (s *Service) saveGroup(ctx context.Context, group *CreativeGroup) error {
 	return s.redis.Set(ctx, key, data, 0).Err()
 }
 
+// saveMarkup 净化HTML素材并保存，未通过安全扫描时返回ErrUnsafeCreative
+func (s *Service) saveMarkup(ctx context.Context, path string, file *multipart.FileHeader) error {
+	f, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("读取文件失败: %v", err)
+	}
+
+	result, err := s.sanitizer.Check(ctx, string(content))
+	if err != nil {
+		return err
+	}
+	if len(result.Removed) > 0 {
+		s.logger.Info("素材内容已净化", "path", path, "removed", result.Removed)
+	}
+	if err := s.storage.SaveStream(ctx, path, strings.NewReader(result.Content)); err != nil {
+		return fmt.Errorf("保存文件失败: %v", err)
+	}
+	return nil
+}
+
 func getCreativeType(format string) string {
 	switch format {
 	case ".jpg", ".jpeg", ".png", ".gif":
@@ -361,6 +411,28 @@ func getCreativeType(format string) string {
 	}
 }
 
-func generateID() string {
-	return fmt.Sprintf("%d%06d", time.Now().Unix(), time.Now().Nanosecond()/1000)
+// scanRecords 分批遍历匹配的字符串键，忽略集合等其他类型的键
+func (s *Service) scanRecords(ctx context.Context, pattern string, fn func(key string, data []byte)) error {
+	var cursor uint64
+	for {
+		keys, next, err := s.redis.Scan(ctx, cursor, pattern, scanBatchSize).Result()
+		if err != nil {
+			return err
+		}
+
+		values, err := cache.MGet(ctx, s.redis, keys)
+		if err != nil {
+			return err
+		}
+		for i, data := range values {
+			if data != nil {
+				fn(keys[i], data)
+			}
+		}
+
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
 }
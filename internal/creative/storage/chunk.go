@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/id"
 	"simple-dsp/pkg/logger"
 )
 
@@ -53,7 +55,7 @@ func NewChunkUploader(redis *redis.Client, logger *logger.Logger, storage Storag
 
 // InitUpload 初始化分片上传
 func (cu *ChunkUploader) InitUpload(ctx context.Context, fileName string, totalSize int64, chunkSize int64) (*ChunkUpload, error) {
-	uploadID := generateUploadID()
+	uploadID := id.New()
 	chunkCount := (totalSize + chunkSize - 1) / chunkSize
 
 	upload := &ChunkUpload{
@@ -196,22 +198,7 @@ func (cu *ChunkUploader) listChunks(ctx context.Context, uploadID string) ([]*Ch
 		return nil, err
 	}
 
-	var chunks []*ChunkInfo
-	for _, key := range keys {
-		data, err := cu.redis.Get(ctx, key).Bytes()
-		if err != nil {
-			continue
-		}
-
-		var chunk ChunkInfo
-		if err := json.Unmarshal(data, &chunk); err != nil {
-			continue
-		}
-
-		chunks = append(chunks, &chunk)
-	}
-
-	return chunks, nil
+	return cache.MGetJSON[*ChunkInfo](ctx, cu.redis, keys, nil)
 }
 
 func (cu *ChunkUploader) mergeChunks(ctx context.Context, chunks []*ChunkInfo, finalPath string) error {
@@ -249,7 +236,3 @@ func (cu *ChunkUploader) getChunkKey(uploadID string, chunkIndex int) string {
 func (cu *ChunkUploader) getChunkPattern(uploadID string) string {
 	return fmt.Sprintf("upload:%s:chunk:*", uploadID)
 }
-
-func generateUploadID() string {
-	return fmt.Sprintf("%d%06d", time.Now().Unix(), time.Now().Nanosecond()/1000)
-} 
\ No newline at end of file
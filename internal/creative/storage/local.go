@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"simple-dsp/internal/creative/types"
+)
+
+// LocalStorage 本地文件系统存储
+type LocalStorage struct {
+	root    string
+	baseURL string
+}
+
+// NewLocalStorage 创建本地文件系统存储，root为存储根目录，baseURL为对外访问文件的地址前缀
+func NewLocalStorage(root, baseURL string) (*LocalStorage, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(abs, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{root: abs, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// SaveStream 先写入同目录下的临时文件，完成后重命名为目标文件
+func (l *LocalStorage) SaveStream(ctx context.Context, path string, reader io.Reader) error {
+	target, err := l.fullPath(path)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(ctx, target, func(w io.Writer) error {
+		_, err := io.Copy(w, reader)
+		return err
+	})
+}
+
+// Open 流式读取文件
+func (l *LocalStorage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	target, err := l.fullPath(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// MergeFiles 按顺序将分片复制到目标文件
+func (l *LocalStorage) MergeFiles(ctx context.Context, finalPath string, chunks []*ChunkInfo) error {
+	target, err := l.fullPath(finalPath)
+	if err != nil {
+		return err
+	}
+	return writeAtomic(ctx, target, func(w io.Writer) error {
+		for _, chunk := range chunks {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			r, err := l.Open(ctx, chunk.ChunkPath)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(w, r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteDir 删除目录及其下的所有文件
+func (l *LocalStorage) DeleteDir(ctx context.Context, path string) error {
+	target, err := l.fullPath(path)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(target)
+}
+
+// GetCreative 获取素材信息
+func (l *LocalStorage) GetCreative(ctx context.Context, creativeID string) (*types.Creative, error) {
+	return getCreative(ctx, l, creativeID)
+}
+
+// SaveCreative 保存素材信息
+func (l *LocalStorage) SaveCreative(ctx context.Context, creative *types.Creative) error {
+	return saveCreative(ctx, l, creative)
+}
+
+// Save 保存上传的文件
+func (l *LocalStorage) Save(ctx context.Context, path string, file *multipart.FileHeader) error {
+	return saveFile(ctx, l, path, file)
+}
+
+// GetURL 获取文件URL
+func (l *LocalStorage) GetURL(ctx context.Context, path string) (string, error) {
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	return l.baseURL + "/" + cleaned, nil
+}
+
+// Delete 删除文件
+func (l *LocalStorage) Delete(ctx context.Context, path string) error {
+	target, err := l.fullPath(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// fullPath 将存储路径转换为根目录下的文件路径
+func (l *LocalStorage) fullPath(path string) (string, error) {
+	cleaned, err := cleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.root, filepath.FromSlash(cleaned)), nil
+}
+
+// writeAtomic 通过临时文件写入目标文件，失败时删除临时文件
+func writeAtomic(ctx context.Context, target string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,514 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"simple-dsp/internal/creative/types"
+)
+
+// S3分段上传限制
+const (
+	// minPartSize 除最后一段外每段的最小字节数
+	minPartSize = 5 << 20
+	// defaultPartSize 流式上传的默认分段大小
+	defaultPartSize = 8 << 20
+	// defaultS3Timeout 单个S3请求的默认超时时间
+	defaultS3Timeout = 5 * time.Minute
+)
+
+// S3Config S3存储配置，使用路径方式访问存储桶，兼容MinIO等S3兼容服务
+type S3Config struct {
+	Endpoint  string // 如https://s3.us-east-1.amazonaws.com
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// BaseURL 对外访问文件的地址前缀，为空时使用Endpoint/Bucket
+	BaseURL string
+	// PartSize 流式上传的分段大小，默认8MB，不能小于5MB
+	PartSize int64
+	// Timeout 单个请求的超时时间，默认5分钟
+	Timeout time.Duration
+}
+
+// S3Storage S3存储
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// s3Error S3返回的错误
+type s3Error struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	return fmt.Sprintf("S3请求失败: status=%d code=%s message=%s", e.StatusCode, e.Code, e.Message)
+}
+
+// NewS3Storage 创建S3存储
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.Region == "" {
+		return nil, errors.New("S3存储需要配置endpoint、region和bucket")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("无效的S3 endpoint: %w", err)
+	}
+	if cfg.PartSize == 0 {
+		cfg.PartSize = defaultPartSize
+	}
+	if cfg.PartSize < minPartSize {
+		return nil, fmt.Errorf("S3分段大小不能小于%d字节", minPartSize)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultS3Timeout
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	return &S3Storage{cfg: cfg, endpoint: endpoint, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// SaveStream 数据不超过一个分段时直接上传，否则使用分段上传
+func (s *S3Storage) SaveStream(ctx context.Context, path string, reader io.Reader) error {
+	key, err := cleanPath(path)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, s.cfg.PartSize)
+	n, err := io.ReadFull(reader, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.putObject(ctx, key, buf[:n])
+	}
+	if err != nil {
+		return err
+	}
+
+	return s.multipart(ctx, key, func(uploadID string) ([]completedPart, error) {
+		var parts []completedPart
+		for n > 0 {
+			etag, err := s.uploadPart(ctx, key, uploadID, len(parts)+1, buf[:n])
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, completedPart{PartNumber: len(parts) + 1, ETag: etag})
+
+			n, err = io.ReadFull(reader, buf)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return nil, err
+			}
+		}
+		return parts, nil
+	})
+}
+
+// Open 流式读取文件
+func (s *S3Storage) Open(ctx context.Context, path string) (io.ReadCloser, error) {
+	key, err := cleanPath(path)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// MergeFiles 分片均不小于5MB时使用分段复制在服务端合并，否则依次读取分片流式上传
+func (s *S3Storage) MergeFiles(ctx context.Context, finalPath string, chunks []*ChunkInfo) error {
+	key, err := cleanPath(finalPath)
+	if err != nil {
+		return err
+	}
+
+	compose := len(chunks) > 0
+	for _, chunk := range chunks[:max(len(chunks)-1, 0)] {
+		if chunk.ChunkSize < minPartSize {
+			compose = false
+		}
+	}
+	if !compose {
+		r := &chunkReader{ctx: ctx, storage: s, chunks: chunks}
+		defer r.Close()
+		return s.SaveStream(ctx, key, r)
+	}
+
+	return s.multipart(ctx, key, func(uploadID string) ([]completedPart, error) {
+		parts := make([]completedPart, 0, len(chunks))
+		for i, chunk := range chunks {
+			etag, err := s.uploadPartCopy(ctx, key, uploadID, i+1, chunk.ChunkPath)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, completedPart{PartNumber: i + 1, ETag: etag})
+		}
+		return parts, nil
+	})
+}
+
+// DeleteDir 删除前缀下的所有对象
+func (s *S3Storage) DeleteDir(ctx context.Context, path string) error {
+	dir, err := cleanPath(path)
+	if err != nil {
+		return err
+	}
+
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {dir + "/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		if err := s.doXML(ctx, http.MethodGet, "", query, nil, nil, &result); err != nil {
+			return err
+		}
+
+		for _, object := range result.Contents {
+			if err := s.Delete(ctx, object.Key); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// GetCreative 获取素材信息
+func (s *S3Storage) GetCreative(ctx context.Context, creativeID string) (*types.Creative, error) {
+	return getCreative(ctx, s, creativeID)
+}
+
+// SaveCreative 保存素材信息
+func (s *S3Storage) SaveCreative(ctx context.Context, creative *types.Creative) error {
+	return saveCreative(ctx, s, creative)
+}
+
+// Save 保存上传的文件
+func (s *S3Storage) Save(ctx context.Context, path string, file *multipart.FileHeader) error {
+	return saveFile(ctx, s, path, file)
+}
+
+// GetURL 获取文件URL
+func (s *S3Storage) GetURL(ctx context.Context, path string) (string, error) {
+	key, err := cleanPath(path)
+	if err != nil {
+		return "", err
+	}
+	if s.cfg.BaseURL != "" {
+		return s.cfg.BaseURL + "/" + s3Escape(key, false), nil
+	}
+	return s.endpoint.String() + "/" + s3Escape(s.cfg.Bucket, true) + "/" + s3Escape(key, false), nil
+}
+
+// Delete 删除文件
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	key, err := cleanPath(path)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// completedPart 已上传的分段
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// multipart 执行分段上传，upload返回所有分段，失败时取消上传
+func (s *S3Storage) multipart(ctx context.Context, key string, upload func(uploadID string) ([]completedPart, error)) error {
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, &initiated); err != nil {
+		return err
+	}
+
+	parts, err := upload(initiated.UploadID)
+	if err == nil {
+		err = s.completeMultipart(ctx, key, initiated.UploadID, parts)
+	}
+	if err != nil {
+		// 使用新的context，确保请求取消后仍能清理已上传的分段
+		abortCtx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+		defer cancel()
+		if resp, abortErr := s.do(abortCtx, http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil); abortErr == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	return nil
+}
+
+// completeMultipart 完成分段上传
+func (s *S3Storage) completeMultipart(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	// 完成请求可能返回200但响应体为错误
+	var result struct {
+		XMLName xml.Name
+		s3Error
+	}
+	if err := s.doXML(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body, &result); err != nil {
+		return err
+	}
+	if result.XMLName.Local == "Error" {
+		result.s3Error.StatusCode = http.StatusOK
+		return &result.s3Error
+	}
+	return nil
+}
+
+// uploadPart 上传一个分段，返回ETag
+func (s *S3Storage) uploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	resp, err := s.do(ctx, http.MethodPut, key, query, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// uploadPartCopy 将已有对象复制为一个分段，返回ETag
+func (s *S3Storage) uploadPartCopy(ctx context.Context, key, uploadID string, partNumber int, sourcePath string) (string, error) {
+	source, err := cleanPath(sourcePath)
+	if err != nil {
+		return "", err
+	}
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	header := http.Header{"X-Amz-Copy-Source": {"/" + s3Escape(s.cfg.Bucket, true) + "/" + s3Escape(source, false)}}
+
+	var result struct {
+		ETag string `xml:"ETag"`
+	}
+	if err := s.doXML(ctx, http.MethodPut, key, query, header, nil, &result); err != nil {
+		return "", err
+	}
+	return result.ETag, nil
+}
+
+// putObject 上传对象
+func (s *S3Storage) putObject(ctx context.Context, key string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// doXML 发送请求并解析XML响应
+func (s *S3Storage) doXML(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte, out interface{}) error {
+	resp, err := s.do(ctx, method, key, query, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(out)
+}
+
+// do 签名并发送请求，非2xx响应转换为错误，对象不存在时返回ErrNotFound
+func (s *S3Storage) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/" + s.cfg.Bucket
+	u.RawPath = s.endpoint.EscapedPath() + "/" + s3Escape(s.cfg.Bucket, true)
+	if key != "" {
+		u.Path += "/" + key
+		u.RawPath += "/" + s3Escape(key, false)
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	e := &s3Error{}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(e)
+	e.StatusCode = resp.StatusCode
+	if resp.StatusCode == http.StatusNotFound && (e.Code == "" || e.Code == "NoSuchKey") {
+		return nil, ErrNotFound
+	}
+	return nil, e
+}
+
+// sign 使用AWS Signature Version 4签名请求
+func (s *S3Storage) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := sha256.Sum256(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		if name := strings.ToLower(k); strings.HasPrefix(name, "x-amz-") || name == "content-type" {
+			headers[name] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := amzDate[:8] + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery 按签名规则编码并排序查询参数
+func canonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for k, values := range query {
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, true)+"="+s3Escape(v, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape 按签名规则编码，只保留非保留字符，encodeSlash为false时保留/
+func s3Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// chunkReader 依次读取各分片
+type chunkReader struct {
+	ctx     context.Context
+	storage Storage
+	chunks  []*ChunkInfo
+	current io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.chunks) == 0 {
+				return 0, io.EOF
+			}
+			current, err := r.storage.Open(r.ctx, r.chunks[0].ChunkPath)
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.chunks = current, r.chunks[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close 关闭正在读取的分片
+func (r *chunkReader) Close() error {
+	if r.current != nil {
+		return r.current.Close()
+	}
+	return nil
+}
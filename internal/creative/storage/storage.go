@@ -1,20 +1,28 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
+	"path"
+	"strings"
+
 	"simple-dsp/internal/creative/types"
 )
 
-// Storage 存储接口
+// Storage 存储接口，路径使用/分隔的相对路径，本地文件系统和S3均实现该接口
 type Storage interface {
-	// SaveStream 保存流数据
+	// SaveStream 保存流数据，写入完成前不会覆盖已有文件
 	SaveStream(ctx context.Context, path string, reader io.Reader) error
-	// MergeFiles 合并文件
+	// Open 流式读取文件，文件不存在时返回ErrNotFound
+	Open(ctx context.Context, path string) (io.ReadCloser, error)
+	// MergeFiles 按chunks的顺序合并分片到finalPath，分片文件保持不变
 	MergeFiles(ctx context.Context, finalPath string, chunks []*ChunkInfo) error
-	// DeleteDir 删除目录
+	// DeleteDir 删除目录及其下的所有文件，目录不存在时不返回错误
 	DeleteDir(ctx context.Context, path string) error
 	// GetCreative 获取素材信息
 	GetCreative(ctx context.Context, creativeID string) (*types.Creative, error)
@@ -24,7 +32,7 @@ type Storage interface {
 	Save(ctx context.Context, path string, file *multipart.FileHeader) error
 	// GetURL 获取文件URL
 	GetURL(ctx context.Context, path string) (string, error)
-	// Delete 删除文件
+	// Delete 删除文件，文件不存在时不返回错误
 	Delete(ctx context.Context, path string) error
 }
 
@@ -33,4 +41,57 @@ var (
 	ErrInvalidChunkIndex = errors.New("无效的分片索引")
 	ErrIncompleteUpload  = errors.New("上传未完成")
 	ErrUploadNotFound    = errors.New("上传记录不存在")
+	ErrNotFound          = errors.New("文件不存在")
+	ErrInvalidPath       = errors.New("无效的存储路径")
 )
+
+// creativeDir 素材信息的存储目录
+const creativeDir = "meta/creatives"
+
+// cleanPath 规范化存储路径，拒绝空路径和包含..的路径
+func cleanPath(p string) (string, error) {
+	trimmed := strings.Trim(p, "/")
+	if trimmed == "" || strings.ContainsRune(p, '\\') {
+		return "", fmt.Errorf("%w: %q", ErrInvalidPath, p)
+	}
+	for _, segment := range strings.Split(trimmed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("%w: %q", ErrInvalidPath, p)
+		}
+	}
+	return path.Clean(trimmed), nil
+}
+
+// saveFile 以流的方式保存上传的文件
+func saveFile(ctx context.Context, s Storage, path string, file *multipart.FileHeader) error {
+	f, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.SaveStream(ctx, path, f)
+}
+
+// getCreative 读取以JSON保存的素材信息
+func getCreative(ctx context.Context, s Storage, creativeID string) (*types.Creative, error) {
+	r, err := s.Open(ctx, creativeDir+"/"+creativeID+".json")
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var creative types.Creative
+	if err := json.NewDecoder(r).Decode(&creative); err != nil {
+		return nil, err
+	}
+	return &creative, nil
+}
+
+// saveCreative 以JSON保存素材信息
+func saveCreative(ctx context.Context, s Storage, creative *types.Creative) error {
+	data, err := json.Marshal(creative)
+	if err != nil {
+		return err
+	}
+	return s.SaveStream(ctx, creativeDir+"/"+creative.ID+".json", bytes.NewReader(data))
+}
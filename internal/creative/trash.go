@@ -0,0 +1,101 @@
+package creative
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"simple-dsp/internal/trash"
+)
+
+// creativeTrash 素材回收站
+type creativeTrash struct {
+	s *Service
+}
+
+// Trash 返回素材回收站
+func (s *Service) Trash() trash.Store {
+	return &creativeTrash{s: s}
+}
+
+// ListDeleted 列出已删除的素材
+func (t *creativeTrash) ListDeleted(ctx context.Context) ([]trash.Item, error) {
+	var items []trash.Item
+	err := t.s.scanDeleted(ctx, func(creative *Creative) {
+		items = append(items, trash.Item{ID: creative.ID, Name: creative.Name, DeleteTime: deleteTimeOf(creative)})
+	})
+	return items, err
+}
+
+// Restore 恢复已删除的素材，恢复后为停用状态
+func (t *creativeTrash) Restore(ctx context.Context, id string) error {
+	creative, err := t.s.GetCreative(ctx, id)
+	if err == ErrCreativeNotFound || (err == nil && creative.Status != statusDeleted) {
+		return trash.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	creative.Status = statusInactive
+	creative.UpdateTime = time.Now()
+	creative.DeleteTime = nil
+	return t.s.saveCreative(ctx, creative)
+}
+
+// Purge 彻底删除在before之前删除的素材，同时删除存储文件和标签索引
+func (t *creativeTrash) Purge(ctx context.Context, before time.Time) (int, error) {
+	var expired []*Creative
+	err := t.s.scanDeleted(ctx, func(creative *Creative) {
+		if deleteTimeOf(creative).Before(before) {
+			expired = append(expired, creative)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, creative := range expired {
+		// 早期删除的素材文件可能已不存在，删除失败只记录日志
+		if err := t.s.storage.Delete(ctx, creative.StoragePath); err != nil {
+			t.s.logger.Error("删除存储文件失败", "creative_id", creative.ID, "error", err)
+		}
+
+		pipe := t.s.redis.TxPipeline()
+		pipe.Del(ctx, fmt.Sprintf("creative:%s", creative.ID))
+		for _, tag := range creative.Tags {
+			pipe.SRem(ctx, fmt.Sprintf("creative:tag:%s", tag), creative.ID)
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// scanDeleted 遍历已删除的素材
+func (s *Service) scanDeleted(ctx context.Context, fn func(creative *Creative)) error {
+	return s.scanRecords(ctx, "creative:*", func(key string, data []byte) {
+		if strings.Contains(strings.TrimPrefix(key, "creative:"), ":") {
+			return
+		}
+
+		var creative Creative
+		if err := json.Unmarshal(data, &creative); err != nil || creative.Status != statusDeleted {
+			return
+		}
+		fn(&creative)
+	})
+}
+
+// deleteTimeOf 返回素材的删除时间，早期删除的素材没有记录删除时间，使用更新时间代替
+func deleteTimeOf(creative *Creative) time.Time {
+	if creative.DeleteTime != nil {
+		return *creative.DeleteTime
+	}
+	return creative.UpdateTime
+}
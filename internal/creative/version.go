@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"simple-dsp/internal/creative/storage"
+	"simple-dsp/pkg/id"
 	"simple-dsp/pkg/logger"
 
 	"github.com/go-redis/redis/v8"
@@ -51,7 +52,7 @@ func (vs *VersionService) CreateVersion(ctx context.Context, creative *Creative,
 
 	// 创建新版本
 	version := &Version{
-		ID:          generateID(),
+		ID:          id.New(),
 		CreativeID:  creative.ID,
 		Version:     currentVersion + 1,
 		Changes:     changes,
@@ -0,0 +1,79 @@
+package event
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// adTokenSignatureSize 竞价令牌中签名的字节数，截断的HMAC-SHA256
+const adTokenSignatureSize = 16
+
+// AdToken 广告地址中的竞价令牌，标识一次出价的广告
+type AdToken struct {
+	RequestID string `json:"r"`
+	AdID      string `json:"a"`
+	// ExpireAt 过期时间(Unix秒)，与出价记录同时过期
+	ExpireAt int64 `json:"e"`
+}
+
+// AdTokenSigner 签发和校验竞价令牌
+// 令牌为"{base64url(JSON)}.{base64url(签名)}"，不需要存储，篡改或过期的令牌被拒绝
+type AdTokenSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewAdTokenSigner 创建竞价令牌签发器，ttl为令牌有效期，为0时使用出价记录的默认保留时间
+func NewAdTokenSigner(secret string, ttl time.Duration) *AdTokenSigner {
+	if ttl <= 0 {
+		ttl = defaultBidRecordTTL
+	}
+	return &AdTokenSigner{secret: []byte(secret), ttl: ttl}
+}
+
+// Sign 签发竞价令牌
+func (s *AdTokenSigner) Sign(requestID, adID string) string {
+	payload, _ := json.Marshal(AdToken{
+		RequestID: requestID,
+		AdID:      adID,
+		ExpireAt:  time.Now().Add(s.ttl).Unix(),
+	})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.signature(encoded))
+}
+
+// Parse 校验并解析竞价令牌，签名不匹配时返回ErrInvalidAdToken，过期时返回ErrAdTokenExpired
+func (s *AdTokenSigner) Parse(token string) (*AdToken, error) {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidAdToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(signature, s.signature(encoded)) {
+		return nil, ErrInvalidAdToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidAdToken
+	}
+
+	var t AdToken
+	if err := json.Unmarshal(payload, &t); err != nil || t.RequestID == "" || t.AdID == "" {
+		return nil, ErrInvalidAdToken
+	}
+	if time.Now().Unix() >= t.ExpireAt {
+		return nil, ErrAdTokenExpired
+	}
+	return &t, nil
+}
+
+// signature 计算令牌内容的签名
+func (s *AdTokenSigner) signature(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)[:adTokenSignatureSize]
+}
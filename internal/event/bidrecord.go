@@ -0,0 +1,88 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/stats"
+)
+
+const (
+	// bidRecordKeyPrefix 出价记录键前缀，完整键为bid:record:{request_id}:{ad_id}
+	bidRecordKeyPrefix  = "bid:record:"
+	defaultBidRecordTTL = 30 * time.Minute
+)
+
+// BidRecord 竞价时保存的出价记录，用于校验展示和竞价成功通知
+type BidRecord struct {
+	RequestID string `json:"request_id"`
+	AdID      string `json:"ad_id"`
+	// CreativeID 出价时轮换选出的素材，展示事件以该值为准
+	CreativeID string    `json:"creative_id,omitempty"`
+	SlotID     string    `json:"slot_id"`
+	Exchange   string    `json:"exchange"`
+	BidPrice   float64   `json:"bid_price"`
+	BidTime    time.Time `json:"bid_time"`
+	// Dimensions 按竞价请求的IP和User-Agent解析的维度，竞价成功通知使用该维度
+	Dimensions stats.Dimensions `json:"dimensions"`
+	// AdMarkup 替换宏后的广告代码，启用广告地址时保存，由/ad/:auction_token返回
+	AdMarkup string `json:"ad_markup,omitempty"`
+}
+
+// BidRecordStore 出价记录存储
+type BidRecordStore interface {
+	// Save 保存出价记录
+	Save(ctx context.Context, record *BidRecord) error
+	// Get 查询出价记录，不存在或已过期时返回ErrBidRecordNotFound
+	Get(ctx context.Context, requestID, adID string) (*BidRecord, error)
+}
+
+// RedisBidRecordStore 基于Redis的出价记录存储，记录在TTL后自动过期
+type RedisBidRecordStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewRedisBidRecordStore 创建基于Redis的出价记录存储
+func NewRedisBidRecordStore(redisClient *redis.Client, ttl time.Duration) *RedisBidRecordStore {
+	if ttl <= 0 {
+		ttl = defaultBidRecordTTL
+	}
+	return &RedisBidRecordStore{redis: redisClient, ttl: ttl}
+}
+
+// Save 保存出价记录
+func (s *RedisBidRecordStore) Save(ctx context.Context, record *BidRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.redis.Set(ctx, bidRecordKey(record.RequestID, record.AdID), data, s.ttl).Err()
+}
+
+// Get 查询出价记录
+func (s *RedisBidRecordStore) Get(ctx context.Context, requestID, adID string) (*BidRecord, error) {
+	data, err := s.redis.Get(ctx, bidRecordKey(requestID, adID)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrBidRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询出价记录失败: %w", err)
+	}
+
+	var record BidRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("解析出价记录失败: %w", err)
+	}
+	return &record, nil
+}
+
+// bidRecordKey 出价记录的Redis键
+func bidRecordKey(requestID, adID string) string {
+	return bidRecordKeyPrefix + requestID + ":" + adID
+}
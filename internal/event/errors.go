@@ -21,9 +21,36 @@ var (
 	// ErrInvalidEventType 表示无效的事件类型
 	ErrInvalidEventType = errors.New("无效的事件类型")
 
+	// ErrInvalidDwellTime 表示停留时长无效
+	ErrInvalidDwellTime = errors.New("停留时长必须大于0")
+
 	// ErrEventProcessFailed 表示事件处理失败
 	ErrEventProcessFailed = errors.New("事件处理失败")
 
 	// ErrStatsNotFound 表示统计数据不存在
 	ErrStatsNotFound = errors.New("统计数据不存在")
+
+	// ErrQueueFull 表示事件队列已满，调用方应稍后重试
+	ErrQueueFull = errors.New("事件队列已满")
+
+	// ErrPipelineClosed 表示事件管道已停止
+	ErrPipelineClosed = errors.New("事件管道已停止")
+
+	// ErrBidRecordNotFound 表示出价记录不存在或已过期
+	ErrBidRecordNotFound = errors.New("出价记录不存在")
+
+	// ErrUnknownBid 表示事件对应的竞价不是本系统的出价
+	ErrUnknownBid = errors.New("未找到对应的出价")
+
+	// ErrWinDedupUnavailable 表示竞价成功通知去重存储不可用，交易平台应稍后重试
+	ErrWinDedupUnavailable = errors.New("竞价成功通知去重存储不可用")
+
+	// ErrInvalidAdToken 表示竞价令牌格式错误或签名不匹配
+	ErrInvalidAdToken = errors.New("无效的竞价令牌")
+
+	// ErrAdTokenExpired 表示竞价令牌已过期
+	ErrAdTokenExpired = errors.New("竞价令牌已过期")
+
+	// ErrAdMarkupNotFound 表示出价没有保存广告代码或出价记录已过期
+	ErrAdMarkupNotFound = errors.New("广告代码不存在")
 ) 
\ No newline at end of file
@@ -9,6 +9,15 @@
  * - 处理广告展示事件
  * - 处理广告点击事件
  * - 处理广告转化事件
+ * - 处理可见展示、视频播放进度和落地页停留事件
+ * - 处理竞价成功通知，解密成交价后记录消耗
+ * - 点击事件返回替换宏后的落地页URL
+ * - 通过事件管道按用户顺序批量写出，队列满时返回503
+ * - 按竞价时保存的出价记录校验展示和竞价成功通知
+ * - 按竞价ID对竞价成功通知去重，交易平台重试的通知不重复记录消耗
+ * - 校验SKAdNetwork安装回传并记录为转化事件
+ * - 按出价记录或请求的IP和User-Agent补全事件的地域和设备维度
+ * - 按广告地址中的竞价令牌返回广告代码，并自动记录展示
  * - 提供事件统计查询
  * 
  * 实现细节:
@@ -19,6 +28,7 @@
  * 
  * 依赖关系:
  * - github.com/gin-gonic/gin
+ * - simple-dsp/internal/pricing
  * - simple-dsp/internal/stats
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
@@ -33,18 +43,50 @@
 package event
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"simple-dsp/internal/macro"
+	"simple-dsp/internal/pricing"
+	"simple-dsp/internal/skadn"
 	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/codec"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/reqctx"
 )
 
+// WinObserver 竞价成功观察者，用于底价情报等按成交价学习的模块
+type WinObserver interface {
+	ObserveWin(exchange, placement, size string, price float64)
+}
+
+// LandingResolver 按广告ID查询落地页URL
+type LandingResolver interface {
+	LandingURL(ctx context.Context, adID string) (string, error)
+}
+
 // Handler 事件处理器
 type Handler struct {
 	statsCollector *stats.Collector
+	decrypter      *pricing.Decrypter
+	winObserver    WinObserver
+	landing        LandingResolver
+	pipeline       *Pipeline
+	bidRecords     BidRecordStore
+	priceTolerance float64
+	winDeduper     WinDeduper
+	adTokens       *AdTokenSigner
+	impDeduper     WinDeduper
+	macros         *macro.Expander
+	skadnNetworkID string
+	skadnVerifier  *skadn.Verifier
+	skadnStore     skadn.Store
+	dimensions     *stats.DimensionResolver
 	logger         *logger.Logger
 	metrics        *metrics.Metrics
 }
@@ -52,20 +94,75 @@ type Handler struct {
 // NewHandler 创建新的事件处理器
 func NewHandler(
 	statsCollector *stats.Collector,
+	decrypter *pricing.Decrypter,
 	logger *logger.Logger,
 	metrics *metrics.Metrics,
 ) *Handler {
+	if decrypter == nil {
+		decrypter = pricing.NewDecrypter()
+	}
 	return &Handler{
 		statsCollector: statsCollector,
+		decrypter:      decrypter,
 		logger:         logger,
 		metrics:        metrics,
 	}
 }
 
+// SetWinObserver 设置竞价成功观察者
+func (h *Handler) SetWinObserver(observer WinObserver) {
+	h.winObserver = observer
+}
+
+// SetPipeline 设置事件管道，设置后事件异步批量写出，管道满时接口返回503
+func (h *Handler) SetPipeline(pipeline *Pipeline) {
+	h.pipeline = pipeline
+}
+
+// SetBidRecords 设置出价记录存储，设置后展示和竞价成功通知须对应本系统的出价
+// priceTolerance为成交价允许高于出价的比例，超出时标记价格异常
+func (h *Handler) SetBidRecords(store BidRecordStore, priceTolerance float64) {
+	h.bidRecords = store
+	h.priceTolerance = priceTolerance
+}
+
+// SetWinDeduper 设置竞价成功通知去重存储，设置后同一竞价的重复通知返回duplicate且不再记录
+func (h *Handler) SetWinDeduper(deduper WinDeduper) {
+	h.winDeduper = deduper
+}
+
+// SetLandingResolver 设置落地页查询，设置后点击事件的响应中返回替换宏后的落地页URL
+// expander为nil时使用默认白名单
+func (h *Handler) SetLandingResolver(resolver LandingResolver, expander *macro.Expander) {
+	if expander == nil {
+		expander, _ = macro.NewExpander(nil)
+	}
+	h.landing = resolver
+	h.macros = expander
+}
+
+// SetSKAdNetwork 设置SKAdNetwork回传处理，networkID为本网络ID
+// verifier为nil时不校验回传签名，store用于查找回传归因的广告
+func (h *Handler) SetSKAdNetwork(networkID string, verifier *skadn.Verifier, store skadn.Store) {
+	h.skadnNetworkID = networkID
+	h.skadnVerifier = verifier
+	h.skadnStore = store
+}
+
+// SetDimensions 设置事件维度解析，设置后按请求的IP和User-Agent补全事件的地域和设备
+func (h *Handler) SetDimensions(resolver *stats.DimensionResolver) {
+	h.dimensions = resolver
+}
+
+// readJSON 使用统一的JSON实现解码请求体
+func readJSON(c *gin.Context, v interface{}) error {
+	return codec.NewDecoder(c.Request.Body).Decode(v)
+}
+
 // HandleImpression 处理展示事件
 func (h *Handler) HandleImpression(c *gin.Context) {
 	var event stats.Event
-	if err := c.ShouldBindJSON(&event); err != nil {
+	if err := readJSON(c, &event); err != nil {
 		h.logger.Error("解析展示事件失败", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
@@ -74,9 +171,13 @@ func (h *Handler) HandleImpression(c *gin.Context) {
 	event.EventType = stats.EventImpression
 	event.Timestamp = time.Now()
 
-	if err := h.statsCollector.CollectEvent(c.Request.Context(), &event); err != nil {
-		h.logger.Error("记录展示事件失败", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录展示事件失败"})
+	if err := h.verifyBid(c.Request.Context(), &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.collect(c, &event); err != nil {
+		h.writeCollectError(c, err, "记录展示事件失败")
 		return
 	}
 
@@ -86,7 +187,7 @@ func (h *Handler) HandleImpression(c *gin.Context) {
 // HandleClick 处理点击事件
 func (h *Handler) HandleClick(c *gin.Context) {
 	var event stats.Event
-	if err := c.ShouldBindJSON(&event); err != nil {
+	if err := readJSON(c, &event); err != nil {
 		h.logger.Error("解析点击事件失败", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
@@ -95,19 +196,51 @@ func (h *Handler) HandleClick(c *gin.Context) {
 	event.EventType = stats.EventClick
 	event.Timestamp = time.Now()
 
-	if err := h.statsCollector.CollectEvent(c.Request.Context(), &event); err != nil {
-		h.logger.Error("记录点击事件失败", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录点击事件失败"})
+	if err := h.collect(c, &event); err != nil {
+		h.writeCollectError(c, err, "记录点击事件失败")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	resp := gin.H{"status": "ok"}
+	if landingURL := h.landingURL(c, &event); landingURL != "" {
+		resp["landing_url"] = landingURL
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// landingURL 查询点击对应广告的落地页并替换宏，未设置落地页查询或查询失败时返回空
+func (h *Handler) landingURL(c *gin.Context, event *stats.Event) string {
+	if h.landing == nil || event.AdID == "" {
+		return ""
+	}
+
+	landingURL, err := h.landing.LandingURL(c.Request.Context(), event.AdID)
+	if err != nil {
+		h.logger.Warn("查询落地页失败", "ad_id", event.AdID, "error", err)
+		return ""
+	}
+
+	clickID := event.ExtraParams["click_id"]
+	if clickID == "" {
+		clickID = event.RequestID
+	}
+	ip := event.IP
+	if ip == "" {
+		ip = c.ClientIP()
+	}
+	return h.macros.Expand(landingURL, &macro.Values{
+		ClickID:    clickID,
+		DeviceID:   event.ExtraParams["device_id"],
+		CampaignID: event.ExtraParams["campaign_id"],
+		IP:         ip,
+		Time:       event.Timestamp,
+	})
 }
 
 // HandleConversion 处理转化事件
 func (h *Handler) HandleConversion(c *gin.Context) {
 	var event stats.Event
-	if err := c.ShouldBindJSON(&event); err != nil {
+	if err := readJSON(c, &event); err != nil {
 		h.logger.Error("解析转化事件失败", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
@@ -116,15 +249,329 @@ func (h *Handler) HandleConversion(c *gin.Context) {
 	event.EventType = stats.EventConversion
 	event.Timestamp = time.Now()
 
-	if err := h.statsCollector.CollectEvent(c.Request.Context(), &event); err != nil {
-		h.logger.Error("记录转化事件失败", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "记录转化事件失败"})
+	if err := h.collect(c, &event); err != nil {
+		h.writeCollectError(c, err, "记录转化事件失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// videoStages 视频播放进度路径参数对应的事件类型
+var videoStages = map[string]stats.EventType{
+	"start":          stats.EventVideoStart,
+	"first_quartile": stats.EventVideoFirstQuartile,
+	"midpoint":       stats.EventVideoMidpoint,
+	"third_quartile": stats.EventVideoThirdQuartile,
+	"complete":       stats.EventVideoComplete,
+}
+
+// maxDwellMs 停留时长上限，超过的视为异常上报
+const maxDwellMs = 24 * 60 * 60 * 1000
+
+// HandleViewable 处理可见展示事件
+func (h *Handler) HandleViewable(c *gin.Context) {
+	h.handleEngagement(c, stats.EventViewableImpression, "可见展示事件")
+}
+
+// HandleVideo 处理视频播放进度事件，stage为start、first_quartile、midpoint、third_quartile或complete
+func (h *Handler) HandleVideo(c *gin.Context) {
+	eventType, ok := videoStages[c.Param("stage")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidEventType.Error()})
+		return
+	}
+	h.handleEngagement(c, eventType, "视频播放事件")
+}
+
+// HandleDwell 处理落地页停留事件，dwell_ms为停留时长(毫秒)
+func (h *Handler) HandleDwell(c *gin.Context) {
+	h.handleEngagement(c, stats.EventDwell, "停留事件")
+}
+
+// handleEngagement 处理可见性和互动类事件，这类事件不产生消耗
+func (h *Handler) handleEngagement(c *gin.Context, eventType stats.EventType, name string) {
+	var event stats.Event
+	if err := readJSON(c, &event); err != nil {
+		h.logger.Error("解析"+name+"失败", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+	if event.AdID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAdID.Error()})
+		return
+	}
+	if eventType == stats.EventDwell && (event.DwellMs <= 0 || event.DwellMs > maxDwellMs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidDwellTime.Error()})
+		return
+	}
+
+	event.EventType = eventType
+	event.Timestamp = time.Now()
+	// 互动事件不计费，忽略上报的价格
+	event.BidPrice = 0
+	event.WinPrice = 0
+
+	if err := h.collect(c, &event); err != nil {
+		h.writeCollectError(c, err, "记录"+name+"失败")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// HandleWin 处理竞价成功通知
+// 交易平台通过GET回调，成交价由price参数携带，可能为加密的AUCTION_PRICE
+// size参数为WxH格式的广告位尺寸，用于底价情报统计
+// auction_id参数为交易平台的竞价ID，未携带时使用request_id，用于对重试的通知去重
+// 交易平台决定成交价是否必须加密，只取出价记录中的交易平台，其次取middleware.RequestContext写入上下文的交易平台
+func (h *Handler) HandleWin(c *gin.Context) {
+	event := stats.Event{
+		EventType: stats.EventWin,
+		RequestID: c.Query("request_id"),
+		UserID:    c.Query("user_id"),
+		AdID:      c.Query("ad_id"),
+		SlotID:    c.Query("slot_id"),
+		Timestamp: time.Now(),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if event.RequestID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidRequestID.Error()})
+		return
+	}
+	if event.AdID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidAdID.Error()})
+		return
+	}
+
+	record, err := h.lookupBid(c.Request.Context(), &event)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	exchange := reqctx.Exchange(c.Request.Context())
+	if record != nil && record.Exchange != "" {
+		exchange = record.Exchange
+	}
+
+	price, err := h.decrypter.Decrypt(exchange, c.Query("price"))
+	if err != nil {
+		h.metrics.Events.PriceDecryptErrors.WithLabelValues(exchange, decryptErrorReason(err)).Inc()
+		h.logger.Error("解密成交价失败",
+			"exchange", exchange,
+			"request_id", event.RequestID,
+			"error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidWinPrice.Error()})
+		return
+	}
+	event.WinPrice = price
+	if exchange != "" {
+		event.ExtraParams = map[string]string{"exchange": exchange}
+	}
+	if record != nil {
+		h.checkBid(&event, record)
+	}
+
+	auctionID := c.Query("auction_id")
+	if auctionID == "" {
+		auctionID = event.RequestID
+	}
+	claimed, err := h.claimWin(c.Request.Context(), exchange, auctionID, event.AdID)
+	if err != nil {
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": ErrWinDedupUnavailable.Error()})
+		return
+	}
+	if !claimed {
+		c.JSON(http.StatusOK, gin.H{"status": "duplicate"})
+		return
+	}
+
+	if err := h.collect(c, &event); err != nil {
+		h.releaseWin(c.Request.Context(), auctionID, event.AdID)
+		h.writeCollectError(c, err, "记录竞价成功通知失败")
 		return
 	}
 
+	if h.winObserver != nil {
+		h.winObserver.ObserveWin(exchange, event.SlotID, c.Query("size"), price)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"status": "ok"})
 }
 
+// claimWin 占用竞价的去重键，重复的通知计入指标后返回false
+// 去重存储不可用时返回错误，由交易平台稍后重试，避免重复扣费
+func (h *Handler) claimWin(ctx context.Context, exchange, auctionID, adID string) (bool, error) {
+	if h.winDeduper == nil {
+		return true, nil
+	}
+
+	claimed, err := h.winDeduper.Claim(ctx, auctionID, adID)
+	if err != nil {
+		h.logger.Error("竞价成功通知去重失败", "auction_id", auctionID, "ad_id", adID, "error", err)
+		return false, err
+	}
+	if !claimed {
+		h.metrics.Events.DuplicateWins.WithLabelValues(exchange).Inc()
+		h.logger.Info("忽略重复的竞价成功通知", "exchange", exchange, "auction_id", auctionID, "ad_id", adID)
+	}
+	return claimed, nil
+}
+
+// releaseWin 通知未能记录时释放去重键，交易平台重试时重新处理
+func (h *Handler) releaseWin(ctx context.Context, auctionID, adID string) {
+	if h.winDeduper == nil {
+		return
+	}
+	if err := h.winDeduper.Release(ctx, auctionID, adID); err != nil {
+		h.logger.Error("释放竞价成功通知去重键失败", "auction_id", auctionID, "ad_id", adID, "error", err)
+	}
+}
+
+// 出价校验结果标签
+const (
+	bidCheckOK            = "ok"
+	bidCheckUnknown       = "unknown_bid"
+	bidCheckPriceMismatch = "price_mismatch"
+	bidCheckError         = "error"
+)
+
+// verifyBid 校验事件对应的出价记录，防止伪造展示和消耗
+// 找不到出价记录时拒绝事件；成交价高于出价时仍记录事件，但在ExtraParams中标记price_mismatch；
+// 出价记录存储不可用时放行，避免Redis故障导致展示全部丢失
+func (h *Handler) verifyBid(ctx context.Context, event *stats.Event) error {
+	record, err := h.lookupBid(ctx, event)
+	if record != nil {
+		h.checkBid(event, record)
+	}
+	return err
+}
+
+// lookupBid 查询事件对应的出价记录，没有出价记录时返回ErrUnknownBid
+// 未设置出价记录存储或查询失败时返回nil，不拦截事件
+func (h *Handler) lookupBid(ctx context.Context, event *stats.Event) (*BidRecord, error) {
+	if h.bidRecords == nil {
+		return nil, nil
+	}
+
+	eventType := string(event.EventType)
+	if event.RequestID == "" || event.AdID == "" {
+		h.metrics.Events.BidValidation.WithLabelValues(eventType, bidCheckUnknown).Inc()
+		return nil, ErrUnknownBid
+	}
+
+	log := h.logger.With("event_type", eventType, "request_id", event.RequestID, "ad_id", event.AdID)
+	record, err := h.bidRecords.Get(ctx, event.RequestID, event.AdID)
+	if errors.Is(err, ErrBidRecordNotFound) {
+		h.metrics.Events.BidValidation.WithLabelValues(eventType, bidCheckUnknown).Inc()
+		log.Warn("事件没有对应的出价记录", "ip", event.IP)
+		return nil, ErrUnknownBid
+	}
+	if err != nil {
+		h.metrics.Events.BidValidation.WithLabelValues(eventType, bidCheckError).Inc()
+		log.Error("校验出价记录失败", "error", err)
+		return nil, nil
+	}
+	return record, nil
+}
+
+// checkBid 使用出价记录补全事件，成交价高于出价时标记价格不一致
+func (h *Handler) checkBid(event *stats.Event, record *BidRecord) {
+	eventType := string(event.EventType)
+	if event.Dimensions.IsZero() {
+		event.Dimensions = record.Dimensions
+	}
+	// 素材以出价记录为准，客户端带回的值可能被篡改
+	if record.CreativeID != "" {
+		event.CreativeID = record.CreativeID
+	}
+
+	if event.WinPrice > record.BidPrice*(1+h.priceTolerance) {
+		h.metrics.Events.BidValidation.WithLabelValues(eventType, bidCheckPriceMismatch).Inc()
+		h.logger.Warn("成交价高于出价",
+			"event_type", eventType,
+			"request_id", event.RequestID,
+			"ad_id", event.AdID,
+			"bid_price", record.BidPrice,
+			"win_price", event.WinPrice)
+		if event.ExtraParams == nil {
+			event.ExtraParams = make(map[string]string)
+		}
+		event.ExtraParams["price_mismatch"] = "1"
+		event.ExtraParams["bid_price"] = strconv.FormatFloat(record.BidPrice, 'f', -1, 64)
+		return
+	}
+
+	h.metrics.Events.BidValidation.WithLabelValues(eventType, bidCheckOK).Inc()
+}
+
+// pipelineHighWatermark 管道使用率超过该值时在响应头中提示上游降速
+const pipelineHighWatermark = 0.8
+
+// collect 记录事件，设置了事件管道时异步写出
+func (h *Handler) collect(c *gin.Context, event *stats.Event) error {
+	h.resolveDimensions(c, event)
+
+	if h.pipeline == nil {
+		return h.statsCollector.CollectEvent(c.Request.Context(), event)
+	}
+
+	if err := h.pipeline.Submit(event); err != nil {
+		return err
+	}
+	if h.pipeline.Load() >= pipelineHighWatermark {
+		c.Header("X-DSP-Backpressure", "1")
+	}
+	return nil
+}
+
+// resolveDimensions 补全事件的地域和设备维度，已从出价记录取得维度的事件不再解析
+// 竞价成功通知由交易平台的服务器发出，IP和User-Agent不代表用户设备，不解析；
+// 转化通常由广告主服务器回传，只解析事件中携带的IP和User-Agent
+func (h *Handler) resolveDimensions(c *gin.Context, event *stats.Event) {
+	if h.dimensions == nil || !event.Dimensions.IsZero() || event.EventType == stats.EventWin {
+		return
+	}
+	ip, userAgent := event.IP, event.UserAgent
+	if event.EventType != stats.EventConversion {
+		if ip == "" {
+			ip = c.ClientIP()
+		}
+		if userAgent == "" {
+			userAgent = c.Request.UserAgent()
+		}
+	}
+	event.Dimensions = h.dimensions.Resolve(ip, userAgent)
+}
+
+// writeCollectError 按错误类型返回响应，队列已满时返回503并要求稍后重试
+func (h *Handler) writeCollectError(c *gin.Context, err error, msg string) {
+	if errors.Is(err, ErrQueueFull) || errors.Is(err, ErrPipelineClosed) {
+		h.logger.Warn(msg, "error", err)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	h.logger.Error(msg, "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+}
+
+// decryptErrorReason 将解密错误转换为指标标签
+func decryptErrorReason(err error) string {
+	switch {
+	case errors.Is(err, pricing.ErrSignatureMismatch):
+		return "signature"
+	case errors.Is(err, pricing.ErrInvalidCiphertext):
+		return "ciphertext"
+	case errors.Is(err, pricing.ErrPlaintextPrice):
+		return "plaintext"
+	default:
+		return "invalid_price"
+	}
+}
+
 // GetEventStats 获取事件统计
 func (h *Handler) GetEventStats(c *gin.Context) {
 	adID := c.Query("ad_id")
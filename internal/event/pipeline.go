@@ -0,0 +1,233 @@
+package event
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
+)
+
+const (
+	defaultShards        = 16
+	defaultQueueSize     = 10000
+	defaultBatchSize     = 100
+	defaultFlushInterval = 100 * time.Millisecond
+	defaultRetryDelay    = 100 * time.Millisecond
+	defaultFlushTimeout  = time.Second
+
+	// flushJitter 重试间隔的随机抖动比例，避免各分片同时重试
+	flushJitter = 0.2
+)
+
+// Sink 批量写出事件
+type Sink interface {
+	CollectBatch(ctx context.Context, events []*stats.Event) error
+}
+
+// BatchObserver 观察写出成功的事件批次
+type BatchObserver interface {
+	ObserveBatch(ctx context.Context, events []*stats.Event) error
+}
+
+// Pipeline 事件处理管道
+// 事件按PartitionKey分片，同一分片由一个worker顺序处理，保证同一用户或请求的事件按提交顺序写出；
+// 每个分片攒批后写出，队列满时拒绝提交，由调用方向上游返回背压信号。
+type Pipeline struct {
+	config   config.EventConfig
+	sink     Sink
+	observer BatchObserver
+	logger   *logger.Logger
+	metrics  *metrics.Metrics
+	shards   []chan *stats.Event
+	closed   bool
+	mu       sync.RWMutex
+	wg       sync.WaitGroup
+}
+
+// NewPipeline 创建事件处理管道
+func NewPipeline(cfg config.EventConfig, sink Sink, logger *logger.Logger, metrics *metrics.Metrics) *Pipeline {
+	if cfg.Shards <= 0 {
+		cfg.Shards = defaultShards
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.ProcessTimeout <= 0 {
+		cfg.ProcessTimeout = defaultFlushTimeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+
+	// 队列容量平均分配到各分片
+	shardSize := cfg.QueueSize / cfg.Shards
+	if shardSize < 1 {
+		shardSize = 1
+	}
+	shards := make([]chan *stats.Event, cfg.Shards)
+	for i := range shards {
+		shards[i] = make(chan *stats.Event, shardSize)
+	}
+
+	return &Pipeline{
+		config:  cfg,
+		sink:    sink,
+		logger:  logger,
+		metrics: metrics,
+		shards:  shards,
+	}
+}
+
+// SetObserver 设置批次观察者，需在Start之前调用
+// 观察者在批次写出成功后由分片worker调用，同一用户的事件按提交顺序观察
+func (p *Pipeline) SetObserver(observer BatchObserver) {
+	p.observer = observer
+}
+
+// Start 启动分片worker
+func (p *Pipeline) Start() {
+	for _, shard := range p.shards {
+		p.wg.Add(1)
+		go p.worker(shard)
+	}
+}
+
+// Stop 停止接收事件，等待已提交的事件全部写出
+func (p *Pipeline) Stop() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	for _, shard := range p.shards {
+		close(shard)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Submit 提交事件，不阻塞；所在分片队列已满时返回ErrQueueFull
+func (p *Pipeline) Submit(event *stats.Event) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPipelineClosed
+	}
+
+	select {
+	case p.shards[p.shardOf(event)] <- event:
+		p.metrics.Events.PipelineDepth.Inc()
+		return nil
+	default:
+		p.metrics.Events.PipelineRejected.WithLabelValues(string(event.EventType)).Inc()
+		return ErrQueueFull
+	}
+}
+
+// Load 返回最繁忙分片的队列使用率，取值0到1
+func (p *Pipeline) Load() float64 {
+	var load float64
+	for _, shard := range p.shards {
+		if l := float64(len(shard)) / float64(cap(shard)); l > load {
+			load = l
+		}
+	}
+	return load
+}
+
+// shardOf 按顺序键计算分片
+func (p *Pipeline) shardOf(event *stats.Event) int {
+	h := fnv.New32a()
+	h.Write([]byte(event.PartitionKey()))
+	return int(h.Sum32() % uint32(len(p.shards)))
+}
+
+// worker 顺序处理一个分片，批次满或到达刷新间隔时写出
+func (p *Pipeline) worker(shard chan *stats.Event) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*stats.Event, 0, p.config.BatchSize)
+	for {
+		select {
+		case event, ok := <-shard:
+			if !ok {
+				p.flush(batch)
+				return
+			}
+			p.metrics.Events.PipelineDepth.Dec()
+			batch = append(batch, event)
+			if len(batch) >= p.config.BatchSize {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				p.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush 写出一批事件，失败时按配置重试；重试期间分片阻塞，保证顺序
+func (p *Pipeline) flush(batch []*stats.Event) {
+	if len(batch) == 0 {
+		return
+	}
+
+	policy := retry.Policy{
+		MaxRetries:     p.config.MaxRetries,
+		InitialBackoff: p.config.RetryDelay,
+		Jitter:         flushJitter,
+	}
+	err := retry.Do(context.Background(), policy, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, p.config.ProcessTimeout)
+		defer cancel()
+		return p.sink.CollectBatch(ctx, batch)
+	})
+	if err == nil {
+		p.metrics.Events.PipelineFlushSize.Observe(float64(len(batch)))
+		p.observe(batch)
+		return
+	}
+
+	p.metrics.Events.PipelineDropped.Add(float64(len(batch)))
+	p.logger.Error("写出事件批次失败，丢弃事件",
+		"count", len(batch),
+		"retries", p.config.MaxRetries,
+		"error", err)
+}
+
+// observe 通知观察者，失败只记录日志，不影响事件写出
+func (p *Pipeline) observe(batch []*stats.Event) {
+	if p.observer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.config.ProcessTimeout)
+	defer cancel()
+	if err := p.observer.ObserveBatch(ctx, batch); err != nil {
+		p.logger.Warn("事件批次观察者处理失败", "count", len(batch), "error", err)
+	}
+}
@@ -0,0 +1,112 @@
+package event
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/stats"
+)
+
+// 广告地址处理结果标签
+const (
+	renderServed       = "served"
+	renderDuplicate    = "duplicate"
+	renderInvalidToken = "invalid_token"
+	renderExpired      = "expired"
+	renderNotFound     = "not_found"
+	renderError        = "error"
+)
+
+// SetAdServing 设置广告地址，设置后/ad/:auction_token按竞价令牌返回出价时保存的广告代码
+// deduper为nil时每次获取广告代码都记录展示
+func (h *Handler) SetAdServing(signer *AdTokenSigner, deduper WinDeduper) {
+	h.adTokens = signer
+	h.impDeduper = deduper
+}
+
+// HandleAdRender 按竞价令牌返回广告代码，供按地址加载广告而不是内嵌广告代码的客户端使用
+// 令牌无效返回400，过期返回410，出价记录不存在或没有广告代码返回404；
+// 首次获取时记录展示，展示记录失败不影响返回广告代码
+func (h *Handler) HandleAdRender(c *gin.Context) {
+	// 广告代码按令牌一次性返回，不允许中间代理缓存
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate, private")
+	c.Header("Pragma", "no-cache")
+	c.Header("X-Content-Type-Options", "nosniff")
+
+	if h.adTokens == nil || h.bidRecords == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrAdMarkupNotFound.Error()})
+		return
+	}
+
+	token, err := h.adTokens.Parse(c.Param("auction_token"))
+	if errors.Is(err, ErrAdTokenExpired) {
+		h.metrics.Events.AdRenders.WithLabelValues(renderExpired).Inc()
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.metrics.Events.AdRenders.WithLabelValues(renderInvalidToken).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	log := h.logger.With("request_id", token.RequestID, "ad_id", token.AdID)
+	record, err := h.bidRecords.Get(ctx, token.RequestID, token.AdID)
+	if errors.Is(err, ErrBidRecordNotFound) || (err == nil && record.AdMarkup == "") {
+		h.metrics.Events.AdRenders.WithLabelValues(renderNotFound).Inc()
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrAdMarkupNotFound.Error()})
+		return
+	}
+	if err != nil {
+		h.metrics.Events.AdRenders.WithLabelValues(renderError).Inc()
+		log.Error("查询出价记录失败", "error", err)
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "查询广告代码失败"})
+		return
+	}
+
+	h.metrics.Events.AdRenders.WithLabelValues(h.recordRender(c, record)).Inc()
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(record.AdMarkup))
+}
+
+// recordRender 记录广告地址的展示，同一令牌只记录一次，返回处理结果标签
+func (h *Handler) recordRender(c *gin.Context, record *BidRecord) string {
+	ctx := c.Request.Context()
+	log := h.logger.With("request_id", record.RequestID, "ad_id", record.AdID)
+	if h.impDeduper != nil {
+		claimed, err := h.impDeduper.Claim(ctx, record.RequestID, record.AdID)
+		if err != nil {
+			log.Error("展示去重失败", "error", err)
+			return renderError
+		}
+		if !claimed {
+			return renderDuplicate
+		}
+	}
+
+	event := &stats.Event{
+		EventType:   stats.EventImpression,
+		RequestID:   record.RequestID,
+		AdID:        record.AdID,
+		SlotID:      record.SlotID,
+		Timestamp:   time.Now(),
+		IP:          c.ClientIP(),
+		UserAgent:   c.Request.UserAgent(),
+		ExtraParams: map[string]string{"exchange": record.Exchange, "source": "ad_url"},
+		Dimensions:  record.Dimensions,
+	}
+	if err := h.collect(c, event); err != nil {
+		log.Error("记录广告地址展示失败", "error", err)
+		if h.impDeduper != nil {
+			if err := h.impDeduper.Release(ctx, record.RequestID, record.AdID); err != nil {
+				log.Error("释放展示去重键失败", "error", err)
+			}
+		}
+		return renderError
+	}
+	return renderServed
+}
@@ -0,0 +1,142 @@
+package event
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"simple-dsp/internal/skadn"
+	"simple-dsp/internal/stats"
+)
+
+// SKAdNetwork回传处理结果标签
+const (
+	postbackConverted  = "converted"
+	postbackUnverified = "unverified"
+	postbackNotWon     = "not_won"
+	postbackUnmatched  = "unmatched"
+	postbackInvalid    = "invalid"
+	postbackSignature  = "signature"
+)
+
+// HandleSKAdNetworkPostback 处理Apple发送的SKAdNetwork安装回传
+// 获胜的回传记录为转化事件，归因信息写入ExtraParams；未获胜的回传只计数。
+// 未配置对应版本的Apple公钥时不校验签名，事件标记skan_verified=false。
+func (h *Handler) HandleSKAdNetworkPostback(c *gin.Context) {
+	var postback skadn.Postback
+	if err := readJSON(c, &postback); err != nil {
+		h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues("", postbackInvalid).Inc()
+		h.logger.Error("解析SKAdNetwork回传失败", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	if err := postback.Validate(); err != nil {
+		h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues(postback.Version, postbackInvalid).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if h.skadnNetworkID != "" && !strings.EqualFold(postback.AdNetworkID, h.skadnNetworkID) {
+		h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues(postback.Version, postbackInvalid).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": skadn.ErrInvalidPostback.Error()})
+		return
+	}
+
+	verified := false
+	if h.skadnVerifier != nil {
+		err := h.skadnVerifier.Verify(&postback)
+		switch {
+		case err == nil:
+			verified = true
+		case errors.Is(err, skadn.ErrNoVerificationKey):
+			// 未配置该版本的公钥，按未校验处理
+		default:
+			h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues(postback.Version, postbackSignature).Inc()
+			h.logger.Warn("SKAdNetwork回传签名校验失败",
+				"transaction_id", postback.TransactionID,
+				"version", postback.Version)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if !postback.Won() {
+		h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues(postback.Version, postbackNotWon).Inc()
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+		return
+	}
+
+	result := postbackConverted
+	if !verified {
+		result = postbackUnverified
+	}
+
+	var adID string
+	if h.skadnStore != nil {
+		matched, err := h.skadnStore.MatchAd(c.Request.Context(), &postback)
+		switch {
+		case err == nil:
+			adID = matched
+		case errors.Is(err, skadn.ErrCampaignNotFound):
+			result = postbackUnmatched
+			h.logger.Warn("SKAdNetwork回传没有匹配的广告",
+				"transaction_id", postback.TransactionID,
+				"app_id", postback.AppID,
+				"source", postback.Source())
+		default:
+			h.logger.Error("查询SKAdNetwork回传归因广告失败", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrEventProcessFailed.Error()})
+			return
+		}
+	}
+
+	event := postbackEvent(&postback, adID, verified)
+	if err := h.collect(c, event); err != nil {
+		h.writeCollectError(c, err, "记录SKAdNetwork转化失败")
+		return
+	}
+
+	h.metrics.Events.SKAdNetworkPostbacks.WithLabelValues(postback.Version, result).Inc()
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// postbackEvent 将回传转换为转化事件，以transaction-id作为请求ID
+func postbackEvent(p *skadn.Postback, adID string, verified bool) *stats.Event {
+	params := map[string]string{
+		"source":          "skadnetwork",
+		"skan_version":    p.Version,
+		"skan_source":     p.Source(),
+		"skan_app_id":     strconv.FormatInt(p.AppID, 10),
+		"skan_redownload": strconv.FormatBool(p.Redownload),
+		"skan_verified":   strconv.FormatBool(verified),
+	}
+	if p.SourceAppID != nil {
+		params["skan_source_app_id"] = strconv.FormatInt(*p.SourceAppID, 10)
+	}
+	if p.SourceDomain != "" {
+		params["skan_source_domain"] = p.SourceDomain
+	}
+	if p.FidelityType != nil {
+		params["skan_fidelity"] = strconv.Itoa(*p.FidelityType)
+	}
+	if p.ConversionValue != nil {
+		params["skan_conversion_value"] = strconv.Itoa(*p.ConversionValue)
+	}
+	if p.CoarseConversionValue != "" {
+		params["skan_coarse_value"] = p.CoarseConversionValue
+	}
+	if p.PostbackSequenceIndex != nil {
+		params["skan_sequence"] = strconv.Itoa(*p.PostbackSequenceIndex)
+	}
+
+	return &stats.Event{
+		EventType:   stats.EventConversion,
+		RequestID:   p.TransactionID,
+		AdID:        adID,
+		Timestamp:   time.Now(),
+		ExtraParams: params,
+	}
+}
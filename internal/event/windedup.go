@@ -0,0 +1,69 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// winDedupKeyPrefix 竞价成功通知去重键前缀，完整键为win:dedup:{auction_id}:{ad_id}
+	winDedupKeyPrefix  = "win:dedup:"
+	defaultWinDedupTTL = 24 * time.Hour
+	// impDedupKeyPrefix 广告地址展示去重键前缀，完整键为imp:dedup:{request_id}:{ad_id}
+	impDedupKeyPrefix = "imp:dedup:"
+)
+
+// WinDeduper 竞价成功通知去重存储，同一竞价的通知只记录一次
+type WinDeduper interface {
+	// Claim 占用竞价的去重键，已被占用时返回false
+	Claim(ctx context.Context, auctionID, adID string) (bool, error)
+	// Release 释放去重键，通知未能记录时调用，交易平台重试的通知可以再次处理
+	Release(ctx context.Context, auctionID, adID string) error
+}
+
+// RedisWinDeduper 基于Redis SETNX的去重存储，去重键在TTL后自动过期
+type RedisWinDeduper struct {
+	redis  *redis.Client
+	ttl    time.Duration
+	prefix string
+}
+
+// NewRedisWinDeduper 创建基于Redis的竞价成功通知去重存储
+// ttl应不小于出价记录的保留时间，超过出价记录保留时间的通知已被出价校验拒绝
+func NewRedisWinDeduper(redisClient *redis.Client, ttl time.Duration) *RedisWinDeduper {
+	if ttl <= 0 {
+		ttl = defaultWinDedupTTL
+	}
+	return &RedisWinDeduper{redis: redisClient, ttl: ttl, prefix: winDedupKeyPrefix}
+}
+
+// NewRedisImpressionDeduper 创建广告地址的展示去重存储，同一竞价令牌的广告只记录一次展示
+// ttl应不小于出价记录的保留时间
+func NewRedisImpressionDeduper(redisClient *redis.Client, ttl time.Duration) *RedisWinDeduper {
+	if ttl <= 0 {
+		ttl = defaultBidRecordTTL
+	}
+	return &RedisWinDeduper{redis: redisClient, ttl: ttl, prefix: impDedupKeyPrefix}
+}
+
+// Claim 占用去重键
+func (d *RedisWinDeduper) Claim(ctx context.Context, auctionID, adID string) (bool, error) {
+	ok, err := d.redis.SetNX(ctx, d.key(auctionID, adID), time.Now().UnixMilli(), d.ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("占用去重键失败: %w", err)
+	}
+	return ok, nil
+}
+
+// Release 释放去重键
+func (d *RedisWinDeduper) Release(ctx context.Context, auctionID, adID string) error {
+	return d.redis.Del(ctx, d.key(auctionID, adID)).Err()
+}
+
+// key 去重的Redis键
+func (d *RedisWinDeduper) key(auctionID, adID string) string {
+	return d.prefix + auctionID + ":" + adID
+}
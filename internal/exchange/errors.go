@@ -0,0 +1,17 @@
+package exchange
+
+import "errors"
+
+var (
+	// ErrUnknownExchange 表示交易平台未注册
+	ErrUnknownExchange = errors.New("未知的交易平台")
+
+	// ErrUnauthorized 表示交易平台认证失败
+	ErrUnauthorized = errors.New("交易平台认证失败")
+
+	// ErrQPSExceeded 表示超出与交易平台约定的QPS
+	ErrQPSExceeded = errors.New("超出约定QPS")
+
+	// ErrInvalidProfile 表示交易平台配置无效
+	ErrInvalidProfile = errors.New("无效的交易平台配置")
+)
@@ -0,0 +1,220 @@
+package exchange
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 认证方式
+const (
+	AuthNone  = "none"
+	AuthToken = "token"
+	AuthBasic = "basic"
+)
+
+// 成交价编码方式
+const (
+	PriceEncodingPlain     = "plain"
+	PriceEncodingEncrypted = "encrypted"
+)
+
+// 宏格式
+const (
+	DialectOpenRTB = "openrtb"
+	DialectGoogle  = "google"
+	DialectCustom  = "custom"
+)
+
+// 素材审核状态同步方式
+const (
+	// CreativeAuditPoll 定时查询交易平台的审核状态
+	CreativeAuditPoll = "poll"
+	// CreativeAuditWebhook 由交易平台回调审核结果
+	CreativeAuditWebhook = "webhook"
+)
+
+// PriceMacro 系统内部统一使用的成交价宏，响应时按交易平台的宏格式替换
+const PriceMacro = "${AUCTION_PRICE}"
+
+// defaultAuthHeader token认证的默认请求头
+const defaultAuthHeader = "Authorization"
+
+// dialectPriceMacros 各宏格式的成交价宏
+var dialectPriceMacros = map[string]string{
+	DialectOpenRTB: "${AUCTION_PRICE}",
+	DialectGoogle:  "%%WINNING_PRICE%%",
+}
+
+// Auth 交易平台接入认证
+type Auth struct {
+	Type       string
+	Header     string
+	Token      string
+	Username   string
+	Password   string
+	AllowedIPs []string
+}
+
+// CreativeAudit 交易平台素材审核接口
+type CreativeAudit struct {
+	Enabled      bool
+	URL          string
+	Token        string
+	Mode         string
+	WebhookToken string
+}
+
+// Profile 交易平台配置
+type Profile struct {
+	ID             string
+	Name           string
+	Auth           Auth
+	PriceEncoding  string
+	MacroDialect   string
+	PriceMacro     string
+	AllowedAdTypes []string
+	DefaultTMax    time.Duration
+	QPS            float64
+	Burst          int
+	// CreativeAudit 启用后素材需经该交易平台审核通过才参与其竞价
+	CreativeAudit CreativeAudit
+}
+
+// validate 校验配置并填充默认值
+func (p *Profile) validate() error {
+	if p.ID == "" {
+		return ErrInvalidProfile
+	}
+
+	if p.Auth.Type == "" {
+		p.Auth.Type = AuthNone
+	}
+	switch p.Auth.Type {
+	case AuthNone:
+	case AuthToken:
+		if p.Auth.Token == "" {
+			return ErrInvalidProfile
+		}
+		if p.Auth.Header == "" {
+			p.Auth.Header = defaultAuthHeader
+		}
+	case AuthBasic:
+		if p.Auth.Username == "" {
+			return ErrInvalidProfile
+		}
+	default:
+		return ErrInvalidProfile
+	}
+
+	if p.PriceEncoding == "" {
+		p.PriceEncoding = PriceEncodingPlain
+	}
+	if p.PriceEncoding != PriceEncodingPlain && p.PriceEncoding != PriceEncodingEncrypted {
+		return ErrInvalidProfile
+	}
+
+	if p.MacroDialect == "" {
+		p.MacroDialect = DialectOpenRTB
+	}
+	if p.MacroDialect == DialectCustom {
+		if p.PriceMacro == "" {
+			return ErrInvalidProfile
+		}
+	} else if macro, ok := dialectPriceMacros[p.MacroDialect]; ok {
+		p.PriceMacro = macro
+	} else {
+		return ErrInvalidProfile
+	}
+
+	if p.CreativeAudit.Enabled {
+		if p.CreativeAudit.Mode == "" {
+			p.CreativeAudit.Mode = CreativeAuditPoll
+		}
+		switch p.CreativeAudit.Mode {
+		case CreativeAuditPoll:
+		case CreativeAuditWebhook:
+			if p.CreativeAudit.WebhookToken == "" {
+				return ErrInvalidProfile
+			}
+		default:
+			return ErrInvalidProfile
+		}
+		if p.CreativeAudit.URL == "" {
+			return ErrInvalidProfile
+		}
+	}
+
+	return nil
+}
+
+// Authenticate 校验请求是否来自该交易平台
+func (p *Profile) Authenticate(r *http.Request) error {
+	if len(p.Auth.AllowedIPs) > 0 && !p.allowsIP(r) {
+		return ErrUnauthorized
+	}
+
+	switch p.Auth.Type {
+	case AuthToken:
+		token := strings.TrimPrefix(r.Header.Get(p.Auth.Header), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(p.Auth.Token)) != 1 {
+			return ErrUnauthorized
+		}
+	case AuthBasic:
+		username, password, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(username), []byte(p.Auth.Username)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(password), []byte(p.Auth.Password)) != 1 {
+			return ErrUnauthorized
+		}
+	}
+	return nil
+}
+
+// allowsIP 判断请求来源IP是否在白名单中
+func (p *Profile) allowsIP(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, allowed := range p.Auth.AllowedIPs {
+		if strings.Contains(allowed, "/") {
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if ip.Equal(net.ParseIP(allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsAdType 判断是否允许该广告类型，未配置时不限制
+func (p *Profile) AllowsAdType(adType string) bool {
+	if len(p.AllowedAdTypes) == 0 {
+		return true
+	}
+	for _, allowed := range p.AllowedAdTypes {
+		if strings.EqualFold(allowed, adType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandMacros 将内部成交价宏替换为交易平台的宏格式
+func (p *Profile) ExpandMacros(s string) string {
+	if s == "" || p.PriceMacro == "" || p.PriceMacro == PriceMacro {
+		return s
+	}
+	return strings.ReplaceAll(s, PriceMacro, p.PriceMacro)
+}
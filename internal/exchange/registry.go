@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: registry.go
+ * Project: simple-dsp
+ * Description: 交易平台(SSP)配置注册表
+ *
+ * 主要功能:
+ * - 管理各交易平台的接入配置
+ * - 提供接入认证、广告类型、默认tmax、宏格式等平台差异化配置
+ * - 按约定QPS对各交易平台限流
+ *
+ * 实现细节:
+ * - 配置从config.exchanges加载，运行时可通过Register更新
+ * - 未指定交易平台的请求使用默认配置，保持原有行为
+ * - 每个交易平台独立的令牌桶限流器
+ *
+ * 依赖关系:
+ * - golang.org/x/time/rate
+ * - simple-dsp/pkg/config
+ *
+ * 注意事项:
+ * - 指标以交易平台ID为标签，未注册的平台统一记为unknown，避免标签基数膨胀
+ * - 加密成交价的解密密钥在event.price_keys中配置
+ */
+
+package exchange
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"simple-dsp/pkg/config"
+)
+
+// DefaultExchange 未指定交易平台时使用的默认配置ID
+const DefaultExchange = "default"
+
+// Registry 交易平台配置注册表
+type Registry struct {
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+	limiters map[string]*rate.Limiter
+}
+
+// NewRegistry 创建仅包含默认配置的注册表
+func NewRegistry() *Registry {
+	r := &Registry{
+		profiles: make(map[string]*Profile),
+		limiters: make(map[string]*rate.Limiter),
+	}
+	_ = r.Register(Profile{ID: DefaultExchange, Name: DefaultExchange})
+	return r
+}
+
+// NewRegistryFromConfig 根据配置创建注册表
+func NewRegistryFromConfig(cfgs []config.ExchangeConfig) (*Registry, error) {
+	r := NewRegistry()
+	for _, cfg := range cfgs {
+		profile := Profile{
+			ID:   cfg.ID,
+			Name: cfg.Name,
+			Auth: Auth{
+				Type:       cfg.Auth.Type,
+				Header:     cfg.Auth.Header,
+				Token:      cfg.Auth.Token,
+				Username:   cfg.Auth.Username,
+				Password:   cfg.Auth.Password,
+				AllowedIPs: cfg.Auth.AllowedIPs,
+			},
+			PriceEncoding:  cfg.PriceEncoding,
+			MacroDialect:   cfg.MacroDialect,
+			PriceMacro:     cfg.PriceMacro,
+			AllowedAdTypes: cfg.AllowedAdTypes,
+			DefaultTMax:    cfg.DefaultTMax,
+			QPS:            cfg.QPS,
+			Burst:          cfg.Burst,
+			CreativeAudit: CreativeAudit{
+				Enabled:      cfg.CreativeAudit.Enabled,
+				URL:          cfg.CreativeAudit.URL,
+				Token:        cfg.CreativeAudit.Token,
+				Mode:         cfg.CreativeAudit.Mode,
+				WebhookToken: cfg.CreativeAudit.WebhookToken,
+			},
+		}
+		if err := r.Register(profile); err != nil {
+			return nil, fmt.Errorf("注册交易平台%s失败: %w", cfg.ID, err)
+		}
+	}
+	return r, nil
+}
+
+// Register 注册或更新交易平台配置
+func (r *Registry) Register(profile Profile) error {
+	if err := profile.validate(); err != nil {
+		return err
+	}
+
+	var limiter *rate.Limiter
+	if profile.QPS > 0 {
+		burst := profile.Burst
+		if burst <= 0 {
+			burst = int(profile.QPS)
+		}
+		if burst <= 0 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(rate.Limit(profile.QPS), burst)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.profiles[profile.ID] = &profile
+	if limiter != nil {
+		r.limiters[profile.ID] = limiter
+	} else {
+		delete(r.limiters, profile.ID)
+	}
+	return nil
+}
+
+// Get 获取交易平台配置，id为空时返回默认配置
+func (r *Registry) Get(id string) (*Profile, error) {
+	if id == "" {
+		id = DefaultExchange
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	profile, ok := r.profiles[id]
+	if !ok {
+		return nil, ErrUnknownExchange
+	}
+	return profile, nil
+}
+
+// Allow 按约定QPS判断是否放行请求
+func (r *Registry) Allow(id string) bool {
+	r.mu.RLock()
+	limiter := r.limiters[id]
+	r.mu.RUnlock()
+
+	return limiter == nil || limiter.Allow()
+}
+
+// List 按ID排序返回所有交易平台配置
+func (r *Registry) List() []Profile {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	profiles := make([]Profile, 0, len(r.profiles))
+	for _, profile := range r.profiles {
+		profiles = append(profiles, *profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].ID < profiles[j].ID
+	})
+	return profiles
+}
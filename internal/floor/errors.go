@@ -0,0 +1,8 @@
+package floor
+
+import "errors"
+
+var (
+	// ErrInvalidSize 表示尺寸格式无效
+	ErrInvalidSize = errors.New("无效的广告位尺寸")
+)
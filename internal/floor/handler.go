@@ -0,0 +1,76 @@
+package floor
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/logger"
+)
+
+// maxQueryLimit 单次查询返回的最大条数
+const maxQueryLimit = 1000
+
+// Handler 底价统计查询接口
+type Handler struct {
+	tracker *Tracker
+	logger  *logger.Logger
+}
+
+// NewHandler 创建底价统计查询接口
+func NewHandler(tracker *Tracker, logger *logger.Logger) *Handler {
+	return &Handler{
+		tracker: tracker,
+		logger:  logger,
+	}
+}
+
+// GetStats 查询底价统计
+// 支持按exchange、placement、size过滤，按请求量倒序返回
+func (h *Handler) GetStats(c *gin.Context) {
+	filter := Filter{
+		Exchange:  c.Query("exchange"),
+		Placement: c.Query("placement"),
+		Size:      c.Query("size"),
+	}
+	if filter.Size != "" {
+		if _, _, err := ParseSize(filter.Size); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		limit = n
+	}
+	if limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+
+	stats, err := h.tracker.Query(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("查询底价统计失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询底价统计失败"})
+		return
+	}
+
+	total := len(stats)
+	if total > limit {
+		stats = stats[:limit]
+	}
+	if stats == nil {
+		stats = []Stats{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"data":  stats,
+	})
+}
@@ -0,0 +1,483 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: tracker.go
+ * Project: simple-dsp
+ * Description: 底价情报，按(交易平台, 广告位, 尺寸)统计底价与胜率并调整出价
+ *
+ * 主要功能:
+ * - 记录各供应路径观测到的底价、出价和成交价
+ * - 计算平均底价、平均成交价和胜率
+ * - 提供基于底价的出价调整
+ * - 汇总统计数据供分析查询
+ *
+ * 实现细节:
+ * - 竞价路径只读写本地内存，不访问Redis
+ * - 本地增量按间隔批量写入Redis哈希，多实例数据在Redis中汇总
+ * - 交易平台未声明底价时，使用历史平均底价作为参考底价
+ * - 成交样本充足时，出价上限为参考价格的固定倍数
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/internal/bidding
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 成交价来自竞价成功通知，需保证win notice携带slot_id和size
+ * - 样本不足时不做上限调整，避免冷启动阶段误伤出价
+ */
+
+package floor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	// statsKeyPrefix 统计数据Redis键前缀
+	statsKeyPrefix = "floor:stats:"
+	// statsIndexKey 统计维度索引
+	statsIndexKey = "floor:stats:index"
+
+	defaultMinSamples      = 50
+	defaultMaxOverbidRatio = 3.0
+	defaultFlushInterval   = 10 * time.Second
+)
+
+// 出价调整动作标签
+const (
+	actionBelowFloor = "below_floor"
+	actionCapped     = "capped"
+)
+
+// Key 供应路径维度
+type Key struct {
+	Exchange  string `json:"exchange"`
+	Placement string `json:"placement"`
+	Size      string `json:"size"`
+}
+
+// Stats 供应路径底价统计
+type Stats struct {
+	Key
+	Requests    int64   `json:"requests"`
+	Bids        int64   `json:"bids"`
+	Wins        int64   `json:"wins"`
+	AvgFloor    float64 `json:"avg_floor"`
+	AvgBidPrice float64 `json:"avg_bid_price"`
+	AvgWinPrice float64 `json:"avg_win_price"`
+	WinRate     float64 `json:"win_rate"`
+}
+
+// Filter 统计查询条件，空字段表示不限制
+type Filter struct {
+	Exchange  string
+	Placement string
+	Size      string
+}
+
+// counters 累计计数
+type counters struct {
+	requests    int64
+	floored     int64 // 携带底价的请求数
+	bids        int64
+	wins        int64
+	floorSum    float64
+	bidPriceSum float64
+	winPriceSum float64
+}
+
+// add 累加计数
+func (c *counters) add(o counters) {
+	c.requests += o.requests
+	c.floored += o.floored
+	c.bids += o.bids
+	c.wins += o.wins
+	c.floorSum += o.floorSum
+	c.bidPriceSum += o.bidPriceSum
+	c.winPriceSum += o.winPriceSum
+}
+
+// stats 转换为统计结果
+func (c *counters) stats(key Key) Stats {
+	s := Stats{
+		Key:      key,
+		Requests: c.requests,
+		Bids:     c.bids,
+		Wins:     c.wins,
+	}
+	if c.floored > 0 {
+		s.AvgFloor = c.floorSum / float64(c.floored)
+	}
+	if c.bids > 0 {
+		s.AvgBidPrice = c.bidPriceSum / float64(c.bids)
+		s.WinRate = float64(c.wins) / float64(c.bids)
+	}
+	if c.wins > 0 {
+		s.AvgWinPrice = c.winPriceSum / float64(c.wins)
+	}
+	return s
+}
+
+// entry 单个供应路径的统计
+type entry struct {
+	total   counters
+	pending counters // 尚未写入Redis的增量
+}
+
+// Tracker 底价情报收集器
+type Tracker struct {
+	config  config.FloorConfig
+	redis   *redis.Client
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+
+	mu      sync.RWMutex
+	entries map[Key]*entry
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewTracker 创建底价情报收集器
+// redisClient为nil时仅保存本地统计
+func NewTracker(cfg config.FloorConfig, redisClient *redis.Client, logger *logger.Logger, metrics *metrics.Metrics) *Tracker {
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = defaultMinSamples
+	}
+	if cfg.MaxOverbidRatio < 1 {
+		cfg.MaxOverbidRatio = defaultMaxOverbidRatio
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	return &Tracker{
+		config:  cfg,
+		redis:   redisClient,
+		logger:  logger,
+		metrics: metrics,
+		entries: make(map[Key]*entry),
+	}
+}
+
+// Start 启动后台写入
+func (t *Tracker) Start() {
+	if t.redis == nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancelFunc = cancel
+
+	t.wg.Add(1)
+	go t.flushLoop(ctx)
+}
+
+// Stop 停止后台写入并写入剩余增量
+func (t *Tracker) Stop() {
+	if t.cancelFunc == nil {
+		return
+	}
+	t.cancelFunc()
+	t.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := t.Flush(ctx); err != nil {
+		t.logger.Error("写入底价统计失败", "error", err)
+	}
+}
+
+// SlotKey 根据广告位生成统计维度
+func SlotKey(exchange string, slot bidding.AdSlot) Key {
+	return Key{
+		Exchange:  exchange,
+		Placement: slot.SlotID,
+		Size:      FormatSize(slot.Width, slot.Height),
+	}
+}
+
+// FormatSize 格式化尺寸
+func FormatSize(width, height int) string {
+	return strconv.Itoa(width) + "x" + strconv.Itoa(height)
+}
+
+// ParseSize 解析WxH格式的尺寸
+func ParseSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return 0, 0, ErrInvalidSize
+	}
+	width, err := strconv.Atoi(w)
+	if err != nil || width <= 0 {
+		return 0, 0, ErrInvalidSize
+	}
+	height, err := strconv.Atoi(h)
+	if err != nil || height <= 0 {
+		return 0, 0, ErrInvalidSize
+	}
+	return width, height, nil
+}
+
+// ObserveRequest 记录广告位请求及其底价
+func (t *Tracker) ObserveRequest(exchange string, slot bidding.AdSlot) {
+	delta := counters{requests: 1}
+	if slot.MinPrice > 0 {
+		delta.floored = 1
+		delta.floorSum = slot.MinPrice
+	}
+	t.record(SlotKey(exchange, slot), delta)
+}
+
+// ObserveBid 记录出价
+func (t *Tracker) ObserveBid(exchange string, slot bidding.AdSlot, price float64) {
+	t.record(SlotKey(exchange, slot), counters{bids: 1, bidPriceSum: price})
+}
+
+// ObserveWin 记录竞价成功及成交价
+func (t *Tracker) ObserveWin(exchange, placement, size string, price float64) {
+	t.record(Key{Exchange: exchange, Placement: placement, Size: size}, counters{wins: 1, winPriceSum: price})
+}
+
+// AdjustBid 根据底价情报调整出价
+// 低于底价时返回false，不参与竞价；成交样本充足时将出价限制在参考价格的倍数以内
+func (t *Tracker) AdjustBid(exchange string, slot bidding.AdSlot, price float64) (float64, bool) {
+	key := SlotKey(exchange, slot)
+
+	t.mu.RLock()
+	var s Stats
+	if e, ok := t.entries[key]; ok {
+		s = e.total.stats(key)
+	}
+	t.mu.RUnlock()
+
+	// 交易平台未声明底价时，使用历史平均底价
+	floor := slot.MinPrice
+	if floor <= 0 {
+		floor = s.AvgFloor
+	}
+	if floor > 0 && price < floor {
+		t.metrics.Bid.FloorAdjustments.WithLabelValues(exchange, actionBelowFloor).Inc()
+		return 0, false
+	}
+
+	if s.Wins >= t.config.MinSamples {
+		reference := s.AvgWinPrice
+		if floor > reference {
+			reference = floor
+		}
+		if limit := reference * t.config.MaxOverbidRatio; price > limit {
+			t.metrics.Bid.FloorAdjustments.WithLabelValues(exchange, actionCapped).Inc()
+			return limit, true
+		}
+	}
+
+	return price, true
+}
+
+// Query 查询统计数据
+// 配置Redis时返回所有实例的汇总数据，否则返回本地数据
+func (t *Tracker) Query(ctx context.Context, filter Filter) ([]Stats, error) {
+	var result []Stats
+	if t.redis != nil {
+		stats, err := t.queryRedis(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		result = stats
+	} else {
+		t.mu.RLock()
+		for key, e := range t.entries {
+			if filter.match(key) {
+				result = append(result, e.total.stats(key))
+			}
+		}
+		t.mu.RUnlock()
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Requests > result[j].Requests
+	})
+	return result, nil
+}
+
+// Flush 将本地增量写入Redis
+func (t *Tracker) Flush(ctx context.Context) error {
+	if t.redis == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	pending := make(map[Key]counters)
+	for key, e := range t.entries {
+		if e.pending != (counters{}) {
+			pending[key] = e.pending
+			e.pending = counters{}
+		}
+	}
+	t.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	pipe := t.redis.Pipeline()
+	for key, c := range pending {
+		redisKey := statsRedisKey(key)
+		pipe.SAdd(ctx, statsIndexKey, encodeKey(key))
+		pipe.HIncrBy(ctx, redisKey, "requests", c.requests)
+		pipe.HIncrBy(ctx, redisKey, "floored", c.floored)
+		pipe.HIncrBy(ctx, redisKey, "bids", c.bids)
+		pipe.HIncrBy(ctx, redisKey, "wins", c.wins)
+		pipe.HIncrByFloat(ctx, redisKey, "floor_sum", c.floorSum)
+		pipe.HIncrByFloat(ctx, redisKey, "bid_price_sum", c.bidPriceSum)
+		pipe.HIncrByFloat(ctx, redisKey, "win_price_sum", c.winPriceSum)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// 写入失败时将增量放回，下次重试
+		t.mu.Lock()
+		for key, c := range pending {
+			t.entryLocked(key).pending.add(c)
+		}
+		t.mu.Unlock()
+		return fmt.Errorf("写入底价统计失败: %w", err)
+	}
+	return nil
+}
+
+// record 累加本地统计
+func (t *Tracker) record(key Key, delta counters) {
+	t.mu.Lock()
+	e := t.entryLocked(key)
+	e.total.add(delta)
+	if t.redis != nil {
+		e.pending.add(delta)
+	}
+	t.mu.Unlock()
+}
+
+// entryLocked 获取或创建统计项，调用方需持有写锁
+func (t *Tracker) entryLocked(key Key) *entry {
+	e, ok := t.entries[key]
+	if !ok {
+		e = &entry{}
+		t.entries[key] = e
+	}
+	return e
+}
+
+// flushLoop 定时写入Redis
+func (t *Tracker) flushLoop(ctx context.Context) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := t.Flush(ctx); err != nil {
+				t.logger.Error("定时写入底价统计失败", "error", err)
+			}
+		}
+	}
+}
+
+// queryRedis 从Redis读取汇总统计
+func (t *Tracker) queryRedis(ctx context.Context, filter Filter) ([]Stats, error) {
+	members, err := t.redis.SMembers(ctx, statsIndexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取底价统计索引失败: %w", err)
+	}
+
+	keys := make([]Key, 0, len(members))
+	for _, member := range members {
+		if key, ok := decodeKey(member); ok && filter.match(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	pipe := t.redis.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.HGetAll(ctx, statsRedisKey(key))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("读取底价统计失败: %w", err)
+	}
+
+	result := make([]Stats, 0, len(keys))
+	for i, key := range keys {
+		fields := cmds[i].Val()
+		if len(fields) == 0 {
+			continue
+		}
+		c := counters{
+			requests:    parseInt(fields["requests"]),
+			floored:     parseInt(fields["floored"]),
+			bids:        parseInt(fields["bids"]),
+			wins:        parseInt(fields["wins"]),
+			floorSum:    parseFloat(fields["floor_sum"]),
+			bidPriceSum: parseFloat(fields["bid_price_sum"]),
+			winPriceSum: parseFloat(fields["win_price_sum"]),
+		}
+		result = append(result, c.stats(key))
+	}
+	return result, nil
+}
+
+// match 判断维度是否满足查询条件
+func (f Filter) match(key Key) bool {
+	return (f.Exchange == "" || f.Exchange == key.Exchange) &&
+		(f.Placement == "" || f.Placement == key.Placement) &&
+		(f.Size == "" || f.Size == key.Size)
+}
+
+// encodeKey 编码统计维度，使用不会出现在ID中的分隔符
+func encodeKey(key Key) string {
+	return key.Exchange + "|" + key.Placement + "|" + key.Size
+}
+
+// decodeKey 解码统计维度
+func decodeKey(s string) (Key, bool) {
+	parts := strings.SplitN(s, "|", 3)
+	if len(parts) != 3 {
+		return Key{}, false
+	}
+	return Key{Exchange: parts[0], Placement: parts[1], Size: parts[2]}, true
+}
+
+// statsRedisKey 获取统计数据的Redis键
+func statsRedisKey(key Key) string {
+	return statsKeyPrefix + encodeKey(key)
+}
+
+func parseInt(s string) int64 {
+	v, _ := strconv.ParseInt(s, 10, 64)
+	return v
+}
+
+func parseFloat(s string) float64 {
+	v, _ := strconv.ParseFloat(s, 64)
+	return v
+}
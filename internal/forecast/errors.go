@@ -0,0 +1,14 @@
+package forecast
+
+import "errors"
+
+var (
+	// ErrInvalidBidPrice 表示预估使用的出价无效
+	ErrInvalidBidPrice = errors.New("无效的出价")
+
+	// ErrInvalidDays 表示统计天数无效
+	ErrInvalidDays = errors.New("无效的统计天数")
+
+	// ErrNoHistory 表示统计期内没有流量数据
+	ErrNoHistory = errors.New("统计期内没有流量数据")
+)
@@ -0,0 +1,299 @@
+package forecast
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"simple-dsp/internal/floor"
+)
+
+const (
+	defaultLookbackDays = 7
+	maxLookbackDays     = 30
+	// defaultMinWinSamples 供应路径的成交样本不足时使用所有路径汇总的胜率
+	defaultMinWinSamples = 50
+)
+
+// WinStats 供应路径的出价和成交统计，由底价情报提供
+type WinStats interface {
+	Query(ctx context.Context, filter floor.Filter) ([]floor.Stats, error)
+}
+
+// Request 预估条件，列表为空表示不限制
+type Request struct {
+	Exchanges []string `json:"exchanges"`
+	AdTypes   []string `json:"ad_types"`
+	Sizes     []string `json:"sizes"`
+	// Targeting 定向条件，只有请求中携带的地域、操作系统和网络类型参与预估
+	Targeting Targeting `json:"targeting"`
+	// BidPrice 每次展示的出价
+	BidPrice float64 `json:"bid_price"`
+	// DailyBudget 日预算，为0时不限制花费
+	DailyBudget float64 `json:"daily_budget"`
+	// Days 使用最近几天的流量分布，默认7天
+	Days int `json:"days"`
+}
+
+// Targeting 定向条件，与推广计划的定向配置字段一致
+type Targeting struct {
+	Locations    []string `json:"locations"`
+	OSTypes      []string `json:"os_types"`
+	NetworkTypes []string `json:"network_types"`
+	Ages         []string `json:"ages"`
+	Genders      []string `json:"genders"`
+	Interests    []string `json:"interests"`
+	Audiences    []string `json:"audiences"`
+}
+
+// Result 预估结果，数量均为日均值
+type Result struct {
+	// Days 有流量数据的天数
+	Days int `json:"days"`
+	// MatchedRequests 符合定向的广告位请求数
+	MatchedRequests float64 `json:"matched_requests"`
+	// AvailableImpressions 符合定向且底价不高于出价的广告位请求数
+	AvailableImpressions float64 `json:"available_impressions"`
+	// WinRate 预计胜率，相对可参与的请求
+	WinRate float64 `json:"win_rate"`
+	// Impressions 预计展示数
+	Impressions float64 `json:"impressions"`
+	// Spend 预计花费
+	Spend float64 `json:"spend"`
+	// BudgetLimited 预计花费超过日预算，展示数按预算折算
+	BudgetLimited bool `json:"budget_limited"`
+	// LowConfidence 部分供应路径的成交样本不足，胜率按汇总数据估算
+	LowConfidence bool `json:"low_confidence"`
+	// IgnoredTargeting 无法按流量分布预估的定向条件，预估结果未按这些条件缩小
+	IgnoredTargeting []string `json:"ignored_targeting,omitempty"`
+}
+
+// Forecaster 投放预估，按历史流量分布和底价情报估算可投放量、胜率和花费
+type Forecaster struct {
+	store      Store
+	wins       WinStats
+	minSamples int64
+}
+
+// NewForecaster 创建投放预估，minSamples不大于0时使用默认值
+func NewForecaster(store Store, wins WinStats, minSamples int64) *Forecaster {
+	if minSamples <= 0 {
+		minSamples = defaultMinWinSamples
+	}
+	return &Forecaster{
+		store:      store,
+		wins:       wins,
+		minSamples: minSamples,
+	}
+}
+
+// pathKey 胜率统计的供应路径，底价情报按广告位统计，预估时按尺寸汇总
+type pathKey struct {
+	exchange string
+	size     string
+}
+
+// winEstimate 供应路径的胜率和成交价估算
+type winEstimate struct {
+	winRate  float64
+	winPrice float64
+}
+
+// Forecast 按最近几天的流量分布预估日均可投放量、胜率和花费
+// 不含今天，今天的数据尚不完整
+func (f *Forecaster) Forecast(ctx context.Context, req Request) (*Result, error) {
+	if req.BidPrice <= 0 || math.IsInf(req.BidPrice, 0) || math.IsNaN(req.BidPrice) {
+		return nil, ErrInvalidBidPrice
+	}
+	days := req.Days
+	if days == 0 {
+		days = defaultLookbackDays
+	}
+	if days < 0 || days > maxLookbackDays {
+		return nil, ErrInvalidDays
+	}
+
+	filter := newMatcher(req)
+	available := make(map[pathKey]float64)
+	var matchedTotal float64
+	loaded := 0
+	today := time.Now()
+	for i := 1; i <= days; i++ {
+		counts, err := f.store.Load(ctx, today.AddDate(0, 0, -i).Format(dateLayout))
+		if err != nil {
+			return nil, err
+		}
+		if len(counts) == 0 {
+			continue
+		}
+		loaded++
+		for key, n := range counts {
+			if !filter.match(key) {
+				continue
+			}
+			path := pathKey{exchange: key.Exchange, size: key.Size}
+			matchedTotal += float64(n)
+			if FloorBucketLower(key.FloorBucket) <= req.BidPrice {
+				available[path] += float64(n)
+			}
+		}
+	}
+	if loaded == 0 {
+		return nil, ErrNoHistory
+	}
+
+	estimates, overall, err := f.winEstimates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Days:             loaded,
+		MatchedRequests:  matchedTotal / float64(loaded),
+		IgnoredTargeting: ignoredTargeting(req.Targeting),
+	}
+	for path, n := range available {
+		daily := n / float64(loaded)
+		est, ok := estimates[path]
+		if !ok {
+			est = overall
+			result.LowConfidence = true
+		}
+		rate, price := est.at(req.BidPrice)
+		result.AvailableImpressions += daily
+		result.Impressions += daily * rate
+		result.Spend += daily * rate * price
+	}
+	if result.AvailableImpressions > 0 {
+		result.WinRate = result.Impressions / result.AvailableImpressions
+	}
+	if req.DailyBudget > 0 && result.Spend > req.DailyBudget {
+		result.Impressions *= req.DailyBudget / result.Spend
+		result.Spend = req.DailyBudget
+		result.BudgetLimited = true
+	}
+	return result, nil
+}
+
+// winEstimates 按供应路径汇总底价情报，成交样本不足的路径不在结果中
+// overall为所有路径汇总的估算，没有成交样本时胜率为0
+func (f *Forecaster) winEstimates(ctx context.Context) (map[pathKey]winEstimate, winEstimate, error) {
+	stats, err := f.wins.Query(ctx, floor.Filter{})
+	if err != nil {
+		return nil, winEstimate{}, err
+	}
+
+	type sums struct {
+		bids, wins  int64
+		winPriceSum float64
+	}
+	paths := make(map[pathKey]*sums)
+	var total sums
+	for _, s := range stats {
+		path := pathKey{exchange: s.Exchange, size: s.Size}
+		p, ok := paths[path]
+		if !ok {
+			p = &sums{}
+			paths[path] = p
+		}
+		p.bids += s.Bids
+		p.wins += s.Wins
+		p.winPriceSum += s.AvgWinPrice * float64(s.Wins)
+		total.bids += s.Bids
+		total.wins += s.Wins
+		total.winPriceSum += s.AvgWinPrice * float64(s.Wins)
+	}
+
+	estimate := func(s sums) winEstimate {
+		if s.bids == 0 || s.wins == 0 {
+			return winEstimate{}
+		}
+		return winEstimate{
+			winRate:  float64(s.wins) / float64(s.bids),
+			winPrice: s.winPriceSum / float64(s.wins),
+		}
+	}
+	estimates := make(map[pathKey]winEstimate, len(paths))
+	for path, s := range paths {
+		if s.wins >= f.minSamples {
+			estimates[path] = estimate(*s)
+		}
+	}
+	return estimates, estimate(total), nil
+}
+
+// at 按出价估算胜率和成交价
+// 出价低于历史平均成交价时胜率按比例降低，成交价不超过出价
+func (e winEstimate) at(bid float64) (rate, price float64) {
+	if e.winRate == 0 {
+		return 0, 0
+	}
+	if bid < e.winPrice {
+		return e.winRate * bid / e.winPrice, bid
+	}
+	return e.winRate, e.winPrice
+}
+
+// matcher 预估条件的匹配
+type matcher struct {
+	exchanges, adTypes, sizes, locations, osTypes, networks map[string]bool
+}
+
+func newMatcher(req Request) matcher {
+	return matcher{
+		exchanges: toSet(req.Exchanges, false),
+		adTypes:   toSet(req.AdTypes, false),
+		sizes:     toSet(req.Sizes, false),
+		locations: toSet(req.Targeting.Locations, false),
+		osTypes:   toSet(req.Targeting.OSTypes, true),
+		networks:  toSet(req.Targeting.NetworkTypes, true),
+	}
+}
+
+// match 判断维度是否满足预估条件
+func (m matcher) match(k Key) bool {
+	return in(m.exchanges, k.Exchange) &&
+		in(m.adTypes, k.AdType) &&
+		in(m.sizes, k.Size) &&
+		in(m.locations, k.Location) &&
+		in(m.osTypes, k.OS) &&
+		in(m.networks, k.Network)
+}
+
+// in 集合为空表示不限制
+func in(set map[string]bool, v string) bool {
+	return len(set) == 0 || set[v]
+}
+
+func toSet(values []string, lower bool) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		if lower {
+			v = strings.ToLower(v)
+		}
+		set[v] = true
+	}
+	return set
+}
+
+// ignoredTargeting 返回请求中没有携带、无法按流量分布预估的定向条件
+func ignoredTargeting(t Targeting) []string {
+	var ignored []string
+	if len(t.Ages) > 0 {
+		ignored = append(ignored, "ages")
+	}
+	if len(t.Genders) > 0 {
+		ignored = append(ignored, "genders")
+	}
+	if len(t.Interests) > 0 {
+		ignored = append(ignored, "interests")
+	}
+	if len(t.Audiences) > 0 {
+		ignored = append(ignored, "audiences")
+	}
+	return ignored
+}
@@ -0,0 +1,46 @@
+package forecast
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/logger"
+)
+
+// Handler 投放预估接口
+type Handler struct {
+	forecaster *Forecaster
+	logger     *logger.Logger
+}
+
+// NewHandler 创建投放预估接口
+func NewHandler(forecaster *Forecaster, logger *logger.Logger) *Handler {
+	return &Handler{
+		forecaster: forecaster,
+		logger:     logger,
+	}
+}
+
+// Forecast 按定向和出价预估日均可投放量、胜率和花费
+func (h *Handler) Forecast(c *gin.Context) {
+	var req Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
+		return
+	}
+
+	result, err := h.forecaster.Forecast(c.Request.Context(), req)
+	switch {
+	case errors.Is(err, ErrInvalidBidPrice), errors.Is(err, ErrInvalidDays):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNoHistory):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		h.logger.Error("投放预估失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "投放预估失败"})
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
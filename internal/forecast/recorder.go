@@ -0,0 +1,220 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: recorder.go
+ * Project: simple-dsp
+ * Description: 流量分布记录，按天统计各维度的广告位请求数，供投放预估使用
+ *
+ * 主要功能:
+ * - 按(交易平台, 广告类型, 尺寸, 操作系统, 网络, 地域, 底价档)统计广告位请求数
+ * - 本地累计后按间隔批量写入存储
+ *
+ * 实现细节:
+ * - 竞价路径只写本地内存，不访问存储
+ * - 计数按请求到达的日期归档，跨天时分别写入两天的数据
+ * - 写入失败时保留增量，下次重试
+ *
+ * 注意事项:
+ * - 维度取值来自请求的扩展参数，取值过多时会增加存储占用
+ */
+
+package forecast
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// dateLayout 流量分布按天归档的日期格式
+	dateLayout = "2006-01-02"
+
+	defaultFlushInterval = 10 * time.Second
+)
+
+// floorBuckets 底价分档的下限，请求按底价归入不超过底价的最高一档
+var floorBuckets = []float64{0, 0.5, 1, 2, 5, 10, 20, 50}
+
+// Key 流量分布维度
+type Key struct {
+	Exchange string `json:"exchange"`
+	AdType   string `json:"ad_type"`
+	Size     string `json:"size"`
+	OS       string `json:"os"`
+	Network  string `json:"network"`
+	Location string `json:"location"`
+	// FloorBucket 底价档，对应floorBuckets的下标
+	FloorBucket int `json:"floor_bucket"`
+}
+
+// Sample 一个广告位请求
+type Sample struct {
+	Exchange string
+	AdType   string
+	Width    int
+	Height   int
+	Floor    float64
+	OS       string
+	Network  string
+	Location string
+}
+
+// key 转换为统计维度
+func (s Sample) key() Key {
+	return Key{
+		Exchange:    s.Exchange,
+		AdType:      s.AdType,
+		Size:        strconv.Itoa(s.Width) + "x" + strconv.Itoa(s.Height),
+		OS:          strings.ToLower(s.OS),
+		Network:     strings.ToLower(s.Network),
+		Location:    s.Location,
+		FloorBucket: floorBucket(s.Floor),
+	}
+}
+
+// floorBucket 返回底价所在的档
+func floorBucket(floor float64) int {
+	bucket := 0
+	for i, lower := range floorBuckets {
+		if floor >= lower {
+			bucket = i
+		}
+	}
+	return bucket
+}
+
+// FloorBucketLower 返回底价档的下限
+func FloorBucketLower(bucket int) float64 {
+	if bucket < 0 || bucket >= len(floorBuckets) {
+		return 0
+	}
+	return floorBuckets[bucket]
+}
+
+// Recorder 流量分布记录器
+type Recorder struct {
+	store         Store
+	flushInterval time.Duration
+	logger        *logger.Logger
+
+	mu      sync.Mutex
+	pending map[string]map[Key]int64 // 日期 -> 维度 -> 请求数
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewRecorder 创建流量分布记录器，flushInterval不大于0时使用默认间隔
+func NewRecorder(store Store, flushInterval time.Duration, logger *logger.Logger) *Recorder {
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	return &Recorder{
+		store:         store,
+		flushInterval: flushInterval,
+		logger:        logger,
+		pending:       make(map[string]map[Key]int64),
+	}
+}
+
+// Observe 记录一个广告位请求
+func (r *Recorder) Observe(s Sample) {
+	r.ObserveAt(s, time.Now())
+}
+
+// ObserveAt 记录一个在指定时间到达的广告位请求
+func (r *Recorder) ObserveAt(s Sample, at time.Time) {
+	date := at.Format(dateLayout)
+	key := s.key()
+
+	r.mu.Lock()
+	counts, ok := r.pending[date]
+	if !ok {
+		counts = make(map[Key]int64)
+		r.pending[date] = counts
+	}
+	counts[key]++
+	r.mu.Unlock()
+}
+
+// Start 启动后台写入
+func (r *Recorder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelFunc = cancel
+
+	r.wg.Add(1)
+	go r.flushLoop(ctx)
+}
+
+// Stop 停止后台写入并写入剩余增量
+func (r *Recorder) Stop() {
+	if r.cancelFunc == nil {
+		return
+	}
+	r.cancelFunc()
+	r.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := r.Flush(ctx); err != nil {
+		r.logger.Error("写入流量分布失败", "error", err)
+	}
+}
+
+// Flush 将本地增量写入存储
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[string]map[Key]int64)
+	r.mu.Unlock()
+
+	for date, counts := range pending {
+		if err := r.store.Add(ctx, date, counts); err != nil {
+			// 写入失败时将未写入的增量放回，下次重试
+			r.mu.Lock()
+			for d, c := range pending {
+				r.mergeLocked(d, c)
+			}
+			r.mu.Unlock()
+			return err
+		}
+		delete(pending, date)
+	}
+	return nil
+}
+
+// mergeLocked 合并增量，调用方需持有锁
+func (r *Recorder) mergeLocked(date string, counts map[Key]int64) {
+	existing, ok := r.pending[date]
+	if !ok {
+		r.pending[date] = counts
+		return
+	}
+	for key, n := range counts {
+		existing[key] += n
+	}
+}
+
+// flushLoop 定时写入存储
+func (r *Recorder) flushLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				r.logger.Error("定时写入流量分布失败", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package forecast
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// trafficKeyPrefix 按天的流量分布Redis键前缀
+	trafficKeyPrefix = "forecast:traffic:"
+
+	defaultRetentionDays = 30
+)
+
+// Store 流量分布存储
+type Store interface {
+	// Add 累加某天各维度的请求数
+	Add(ctx context.Context, date string, counts map[Key]int64) error
+	// Load 读取某天各维度的请求数，没有数据时返回空
+	Load(ctx context.Context, date string) (map[Key]int64, error)
+}
+
+// RedisStore 流量分布的Redis存储，每天一个哈希，字段为编码后的维度
+type RedisStore struct {
+	redis     *redis.Client
+	retention time.Duration
+}
+
+// NewRedisStore 创建Redis存储，retentionDays不大于0时保留30天
+func NewRedisStore(redisClient *redis.Client, retentionDays int) *RedisStore {
+	if retentionDays <= 0 {
+		retentionDays = defaultRetentionDays
+	}
+	return &RedisStore{
+		redis:     redisClient,
+		retention: time.Duration(retentionDays) * 24 * time.Hour,
+	}
+}
+
+// Add 累加某天各维度的请求数，并刷新该天数据的过期时间
+func (s *RedisStore) Add(ctx context.Context, date string, counts map[Key]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	key := trafficKeyPrefix + date
+	pipe := s.redis.Pipeline()
+	for k, n := range counts {
+		pipe.HIncrBy(ctx, key, encodeKey(k), n)
+	}
+	pipe.Expire(ctx, key, s.retention)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("写入流量分布失败: %w", err)
+	}
+	return nil
+}
+
+// Load 读取某天各维度的请求数
+func (s *RedisStore) Load(ctx context.Context, date string) (map[Key]int64, error) {
+	fields, err := s.redis.HGetAll(ctx, trafficKeyPrefix+date).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取流量分布失败: %w", err)
+	}
+	counts := make(map[Key]int64, len(fields))
+	for field, value := range fields {
+		key, ok := decodeKey(field)
+		if !ok {
+			continue
+		}
+		n, _ := strconv.ParseInt(value, 10, 64)
+		counts[key] += n
+	}
+	return counts, nil
+}
+
+// encodeKey 编码统计维度，取值中的分隔符替换为下划线
+func encodeKey(k Key) string {
+	return strings.Join([]string{
+		escape(k.Exchange),
+		escape(k.AdType),
+		escape(k.Size),
+		escape(k.OS),
+		escape(k.Network),
+		escape(k.Location),
+		strconv.Itoa(k.FloorBucket),
+	}, "|")
+}
+
+// decodeKey 解码统计维度
+func decodeKey(s string) (Key, bool) {
+	parts := strings.Split(s, "|")
+	if len(parts) != 7 {
+		return Key{}, false
+	}
+	bucket, err := strconv.Atoi(parts[6])
+	if err != nil {
+		return Key{}, false
+	}
+	return Key{
+		Exchange:    parts[0],
+		AdType:      parts[1],
+		Size:        parts[2],
+		OS:          parts[3],
+		Network:     parts[4],
+		Location:    parts[5],
+		FloorBucket: bucket,
+	}, true
+}
+
+func escape(s string) string {
+	return strings.ReplaceAll(s, "|", "_")
+}
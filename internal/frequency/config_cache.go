@@ -0,0 +1,98 @@
+package frequency
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/timezone"
+)
+
+// configCacheName 频次配置缓存的名称，失效通知频道为cache:freq:config:invalidate
+const configCacheName = "freq:config"
+
+// configCacheSetter 可以设置频次配置缓存的控制器
+type configCacheSetter interface {
+	setConfigCache(configs *cache.Tiered[Config])
+}
+
+// NewConfigCache 创建频次配置缓存
+// 频次配置本身保存在Redis中，缓存只使用本地层，更新配置时通过失效通知让所有实例重新读取
+func NewConfigCache(cfg config.FrequencyConfig, rdb redis.UniversalClient, logger *logger.Logger) *cache.Tiered[Config] {
+	return cache.NewTiered(cache.TieredOptions{
+		Name:     configCacheName,
+		Size:     cfg.ConfigCacheSize,
+		LocalTTL: cfg.ConfigCacheTTL,
+	}, rdb, func(ctx context.Context, adID string) (Config, error) {
+		config, err := loadConfig(ctx, rdb, adID)
+		if err != nil {
+			return Config{}, err
+		}
+		return *config, nil
+	}, logger)
+}
+
+// WithConfigCache 为频次控制器设置频次配置缓存，竞价时读取配置不再每次访问Redis
+func WithConfigCache(ctrl Controller, configs *cache.Tiered[Config]) Controller {
+	if setter, ok := ctrl.(configCacheSetter); ok {
+		setter.setConfigCache(configs)
+	}
+	return ctrl
+}
+
+// timezoneSetter 按自然日计数、需要时区的控制器
+type timezoneSetter interface {
+	setTimezones(zones *timezone.Zones)
+}
+
+// WithTimezones 为按自然日计数的控制器设置时区，自然日按广告所属推广计划的时区计算
+// sliding模式按时间窗口计数，与时区无关
+func WithTimezones(ctrl Controller, zones *timezone.Zones) Controller {
+	if setter, ok := ctrl.(timezoneSetter); ok {
+		setter.setTimezones(zones)
+	}
+	return ctrl
+}
+
+// clockSetter 按日期或时间窗口计数、需要时间来源的控制器
+type clockSetter interface {
+	setClock(c clock.Clock)
+}
+
+// WithClock 为控制器设置计算自然日和时间窗口的时间来源，为nil时使用系统时钟
+// 须在WithIdentity之前调用，跨设备的包装不转发设置
+func WithClock(ctrl Controller, c clock.Clock) Controller {
+	if setter, ok := ctrl.(clockSetter); ok {
+		setter.setClock(clock.OrReal(c))
+	}
+	return ctrl
+}
+
+// getConfig 读取广告的频次配置，设置了缓存时优先读取缓存
+func getConfig(ctx context.Context, store Store, configs *cache.Tiered[Config], adID string) (*Config, error) {
+	if configs == nil {
+		return loadConfig(ctx, store, adID)
+	}
+	config, err := configs.Get(ctx, adID)
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// updateConfig 保存广告的频次配置，设置了缓存时通知所有实例的缓存失效
+func updateConfig(ctx context.Context, store Store, configs *cache.Tiered[Config], logger *logger.Logger, adID string, config *Config) error {
+	if err := saveConfig(ctx, store, adID, config); err != nil {
+		return err
+	}
+	if configs != nil {
+		if err := configs.Invalidate(ctx, adID); err != nil {
+			logger.Warn("频次配置缓存失效失败，其他实例在缓存过期后读到新配置", "ad_id", adID, "error", err)
+		}
+	}
+	return nil
+}
@@ -12,19 +12,25 @@
  * - 支持多维度频次控制
  *
  * 实现细节:
- * - 使用Redis存储频次数据
- * - 实现滑动窗口计数
- * - 支持多级频次控制
+ * - 使用Redis存储频次数据，通过Store接口访问，单机和集群客户端均可使用
+ * - daily模式按自然日计数，sliding模式按配置的时间窗口滑动计数
+ * - daily模式的自然日按广告所属推广计划的时区计算，见WithTimezones
+ * - 竞价时通过Lua脚本原子地检查并计数，避免并发请求同时通过上限
+ * - 占用曝光后未能出价(如预算扣减失败)时归还该次曝光
+ * - 两种模式共用按广告保存的频次配置
+ * - 频次配置可通过WithConfigCache缓存在本地，更新配置时通知所有实例失效
+ * - 竞价时按广告和推广计划的令牌桶限制QPS，见RateLimiter
  * - 提供实时频次统计
  *
  * 依赖关系:
- * - simple-dsp/pkg/clients
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/pkg/config
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
  *
  * 注意事项:
  * - 注意频次计算的准确性
- * - 合理设置缓存过期时间
+ * - 切换模式后计数从零开始，两种模式的计数键不同
  * - 注意处理并发访问
  * - 确保数据一致性
  */
@@ -34,175 +40,108 @@ package frequency
 import (
 	"context"
 	"fmt"
-	"github.com/go-redis/redis/v8"
 	"strconv"
 	"time"
 
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/config"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 )
 
-// Controller 频次控制器
-type Controller struct {
-	redis   *redis.Client
-	logger  *logger.Logger
-	metrics *metrics.Metrics
+// 频次控制模式
+const (
+	// ModeDaily 按自然日计数
+	ModeDaily = "daily"
+	// ModeSliding 按配置的时间窗口滑动计数
+	ModeSliding = "sliding"
+)
+
+// Controller 频次控制器，竞价引擎和管理后台通过该接口使用频次控制
+type Controller interface {
+	// AcquireImpression 原子地检查曝光频次并计数，返回计数后的剩余次数，超过上限时ok为false且不计数
+	AcquireImpression(ctx context.Context, userID, adID string) (remaining int64, ok bool, err error)
+	// ReleaseImpression 归还AcquireImpression占用的一次曝光，竞价未能出价时使用
+	ReleaseImpression(ctx context.Context, userID, adID string) error
+	CheckImpression(ctx context.Context, userID, adID string) (bool, error)
+	RecordImpression(ctx context.Context, userID, adID string) error
+	CheckClick(ctx context.Context, userID, adID string) (bool, error)
+	RecordClick(ctx context.Context, userID, adID string) error
+	UpdateConfig(ctx context.Context, adID string, config *Config) error
+	GetConfig(ctx context.Context, adID string) (*Config, error)
+}
+
+// Store 频次控制使用的Redis操作，*redis.Client和*redis.ClusterClient均满足该接口
+type Store interface {
+	redis.Scripter
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Incr(ctx context.Context, key string) *redis.IntCmd
+	Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd
+	Del(ctx context.Context, keys ...string) *redis.IntCmd
+	HMSet(ctx context.Context, key string, values ...interface{}) *redis.BoolCmd
+	HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd
+	ZCount(ctx context.Context, key, min, max string) *redis.IntCmd
+	Pipeline() redis.Pipeliner
 }
 
 // Config 频次控制配置
 type Config struct {
 	ImpressionLimit int           `json:"impression_limit"` // 曝光限制
 	ClickLimit      int           `json:"click_limit"`      // 点击限制
-	TimeWindow      time.Duration `json:"time_window"`      // 时间窗口
-	QPS             float64       `json:"qps"`              // 每秒请求限制
-}
-
-// NewController 创建频次控制器
-func NewController(redis *redis.Client, logger *logger.Logger, metrics *metrics.Metrics) *Controller {
-	return &Controller{
-		redis:   redis,
-		logger:  logger,
-		metrics: metrics,
-	}
-}
-
-// CheckImpression 检查曝光频次
-func (c *Controller) CheckImpression(ctx context.Context, userID string, adID string) (bool, error) {
-	// 获取配置
-	config, err := c.getConfig(ctx, adID)
-	if err != nil {
-		return false, err
-	}
-
-	// 生成键名
-	key := fmt.Sprintf("freq:imp:%s:%s:%s", userID, adID, time.Now().Format("20060102"))
-
-	// 检查频次
-	count, err := c.redis.Get(ctx, key).Int()
-	if err != nil && err != redis.Nil {
-		return false, err
-	}
-
-	// 超过限制
-	if count >= config.ImpressionLimit {
-		c.metrics.Frequency.LimitExceeded.Inc()
-		return false, nil
-	}
-
-	return true, nil
+	TimeWindow      time.Duration `json:"time_window"`      // 时间窗口，sliding模式使用
+	QPS             float64       `json:"qps"`              // 每秒竞价限制，0表示不限制
 }
 
-// RecordImpression 记录曝光
-func (c *Controller) RecordImpression(ctx context.Context, userID string, adID string) error {
-	// 生成键名
-	key := fmt.Sprintf("freq:imp:%s:%s:%s", userID, adID, time.Now().Format("20060102"))
-
-	// 增加计数
-	_, err := c.redis.Incr(ctx, key).Result()
-	if err != nil {
-		return err
+// New 按配置的模式创建频次控制器，未配置模式时使用daily
+func New(cfg config.FrequencyConfig, store Store, logger *logger.Logger, metrics *metrics.Metrics) (Controller, error) {
+	switch cfg.Mode {
+	case "", ModeDaily:
+		return NewDailyController(store, logger, metrics), nil
+	case ModeSliding:
+		return NewDistributedController(store, logger, metrics), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMode, cfg.Mode)
 	}
-
-	// 设置过期时间
-	c.redis.Expire(ctx, key, 24*time.Hour)
-
-	return nil
 }
 
-// CheckClick 检查点击频次
-func (c *Controller) CheckClick(ctx context.Context, userID string, adID string) (bool, error) {
-	// 获取配置
-	config, err := c.getConfig(ctx, adID)
+// acquireResult 解析计数脚本返回的{是否通过, 剩余次数}
+func acquireResult(cmd *redis.Cmd) (int64, bool, error) {
+	values, err := cmd.Int64Slice()
 	if err != nil {
-		return false, err
+		return 0, false, err
 	}
-
-	// 生成键名
-	key := fmt.Sprintf("freq:click:%s:%s:%s", userID, adID, time.Now().Format("20060102"))
-
-	// 检查频次
-	count, err := c.redis.Get(ctx, key).Int()
-	if err != nil && err != redis.Nil {
-		return false, err
-	}
-
-	// 超过限制
-	if count >= config.ClickLimit {
-		c.metrics.Frequency.LimitExceeded.Inc()
-		return false, nil
-	}
-
-	return true, nil
-}
-
-// RecordClick 记录点击
-func (c *Controller) RecordClick(ctx context.Context, userID string, adID string) error {
-	// 生成键名
-	key := fmt.Sprintf("freq:click:%s:%s:%s", userID, adID, time.Now().Format("20060102"))
-
-	// 增加计数
-	_, err := c.redis.Incr(ctx, key).Result()
-	if err != nil {
-		return err
+	if len(values) != 2 {
+		return 0, false, fmt.Errorf("频次脚本返回值无效: %v", values)
 	}
-
-	// 设置过期时间
-	c.redis.Expire(ctx, key, 24*time.Hour)
-
-	return nil
+	return values[1], values[0] == 1, nil
 }
 
-// UpdateConfig 更新频次控制配置
-func (c *Controller) UpdateConfig(ctx context.Context, adID string, config *Config) error {
-	// 验证配置
-	if err := c.validateConfig(config); err != nil {
-		return err
-	}
-
-	// 生成键名
-	key := fmt.Sprintf("freq:config:%s", adID)
-
-	// 保存配置
-	data := map[string]string{
-		"impression_limit": strconv.Itoa(config.ImpressionLimit),
-		"click_limit":      strconv.Itoa(config.ClickLimit),
-		"time_window":      config.TimeWindow.String(),
-		"qps":              fmt.Sprintf("%f", config.QPS),
-	}
-
-	// 使用 HSET 保存配置
-	if err := c.redis.HMSet(ctx, key, data).Err(); err != nil {
-		return err
+// defaultConfig 广告未配置频次时的默认配置
+func defaultConfig() *Config {
+	return &Config{
+		ImpressionLimit: 10, // 默认每天最多曝光10次
+		ClickLimit:      3,  // 默认每天最多点击3次
+		TimeWindow:      24 * time.Hour,
+		QPS:             0, // 默认不限制QPS
 	}
-
-	return nil
 }
 
-// GetConfig 获取频次控制配置
-func (c *Controller) GetConfig(ctx context.Context, adID string) (*Config, error) {
-	return c.getConfig(ctx, adID)
+// configKey 广告频次配置的键名
+func configKey(adID string) string {
+	return fmt.Sprintf("freq:config:%s", adID)
 }
 
-// 内部方法
-
-func (c *Controller) getConfig(ctx context.Context, adID string) (*Config, error) {
-	// 生成键名
-	key := fmt.Sprintf("freq:config:%s", adID)
-
-	// 获取配置
-	data, err := c.redis.HGetAll(ctx, key).Result()
+// loadConfig 读取广告的频次配置，不存在时返回默认配置
+func loadConfig(ctx context.Context, store Store, adID string) (*Config, error) {
+	data, err := store.HGetAll(ctx, configKey(adID)).Result()
 	if err != nil {
 		return nil, err
 	}
 
 	// 如果配置不存在，使用默认配置
 	if len(data) == 0 {
-		return &Config{
-			ImpressionLimit: 10, // 默认每天最多曝光10次
-			ClickLimit:      3,  // 默认每天最多点击3次
-			TimeWindow:      24 * time.Hour,
-			QPS:             100, // 默认QPS 100
-		}, nil
+		return defaultConfig(), nil
 	}
 
 	// 解析配置
@@ -219,7 +158,22 @@ func (c *Controller) getConfig(ctx context.Context, adID string) (*Config, error
 	}, nil
 }
 
-func (c *Controller) validateConfig(config *Config) error {
+// saveConfig 校验并保存广告的频次配置
+func saveConfig(ctx context.Context, store Store, adID string, config *Config) error {
+	if err := validateConfig(config); err != nil {
+		return err
+	}
+
+	data := map[string]string{
+		"impression_limit": strconv.Itoa(config.ImpressionLimit),
+		"click_limit":      strconv.Itoa(config.ClickLimit),
+		"time_window":      config.TimeWindow.String(),
+		"qps":              fmt.Sprintf("%f", config.QPS),
+	}
+	return store.HMSet(ctx, configKey(adID), data).Err()
+}
+
+func validateConfig(config *Config) error {
 	if config.ImpressionLimit <= 0 {
 		return fmt.Errorf("曝光限制必须大于0")
 	}
@@ -229,8 +183,8 @@ func (c *Controller) validateConfig(config *Config) error {
 	if config.TimeWindow <= 0 {
 		return fmt.Errorf("时间窗口必须大于0")
 	}
-	if config.QPS <= 0 {
-		return fmt.Errorf("QPS必须大于0")
+	if config.QPS < 0 {
+		return fmt.Errorf("QPS不能小于0")
 	}
 	return nil
 }
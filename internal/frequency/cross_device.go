@@ -0,0 +1,59 @@
+package frequency
+
+import (
+	"context"
+
+	"simple-dsp/pkg/cache"
+)
+
+// IdentityResolver 将设备ID解析为跨设备的用户ID，没有关联时返回原ID
+type IdentityResolver interface {
+	Resolve(ctx context.Context, id string) string
+}
+
+// crossDeviceController 先将用户ID解析为跨设备的用户ID，再按该ID控制频次
+// 同一用户的多台设备共用一份频次计数
+type crossDeviceController struct {
+	Controller
+	resolver IdentityResolver
+}
+
+// WithIdentity 为频次控制器加上跨设备解析，频次配置的读写不受影响
+func WithIdentity(ctrl Controller, resolver IdentityResolver) Controller {
+	return &crossDeviceController{Controller: ctrl, resolver: resolver}
+}
+
+// AcquireImpression 按跨设备的用户ID检查曝光频次并计数
+func (c *crossDeviceController) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	return c.Controller.AcquireImpression(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// ReleaseImpression 按跨设备的用户ID归还占用的曝光
+func (c *crossDeviceController) ReleaseImpression(ctx context.Context, userID, adID string) error {
+	return c.Controller.ReleaseImpression(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// CheckImpression 按跨设备的用户ID检查曝光频次
+func (c *crossDeviceController) CheckImpression(ctx context.Context, userID, adID string) (bool, error) {
+	return c.Controller.CheckImpression(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// RecordImpression 按跨设备的用户ID记录曝光
+func (c *crossDeviceController) RecordImpression(ctx context.Context, userID, adID string) error {
+	return c.Controller.RecordImpression(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// CheckClick 按跨设备的用户ID检查点击频次
+func (c *crossDeviceController) CheckClick(ctx context.Context, userID, adID string) (bool, error) {
+	return c.Controller.CheckClick(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// RecordClick 按跨设备的用户ID记录点击
+func (c *crossDeviceController) RecordClick(ctx context.Context, userID, adID string) error {
+	return c.Controller.RecordClick(ctx, c.resolver.Resolve(ctx, userID), adID)
+}
+
+// setConfigCache 为被包装的控制器设置频次配置缓存
+func (c *crossDeviceController) setConfigCache(configs *cache.Tiered[Config]) {
+	WithConfigCache(c.Controller, configs)
+}
@@ -0,0 +1,174 @@
+package frequency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/timezone"
+)
+
+// dailyAcquireScript 当天计数未达上限时加一，首次计数时设置过期时间
+// KEYS[1]为计数键，ARGV为上限和过期秒数，返回{是否通过, 剩余次数}
+var dailyAcquireScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if count >= limit then
+	return {0, 0}
+end
+count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return {1, limit - count}
+`)
+
+// dailyReleaseScript 当天计数大于0时减一
+// KEYS[1]为计数键，返回减一后的计数
+var dailyReleaseScript = redis.NewScript(`
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if count <= 0 then
+	return 0
+end
+return redis.call('DECR', KEYS[1])
+`)
+
+// DailyController 按自然日计数的频次控制器，自然日按广告所属推广计划的时区计算
+type DailyController struct {
+	store   Store
+	configs *cache.Tiered[Config]
+	zones   *timezone.Zones
+	clock   clock.Clock
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+}
+
+// NewDailyController 创建按自然日计数的频次控制器
+func NewDailyController(store Store, logger *logger.Logger, metrics *metrics.Metrics) *DailyController {
+	return &DailyController{
+		store:   store,
+		clock:   clock.Real(),
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// AcquireImpression 原子地检查当天的曝光频次并计数
+func (c *DailyController) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	config, err := c.GetConfig(ctx, adID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	remaining, ok, err := acquireResult(dailyAcquireScript.Run(ctx, c.store,
+		[]string{c.dailyKey("imp", userID, adID)}, config.ImpressionLimit, int64((24*time.Hour)/time.Second)))
+	if err != nil {
+		return 0, false, err
+	}
+	if !ok {
+		c.metrics.Frequency.LimitExceeded.Inc()
+	}
+	return remaining, ok, nil
+}
+
+// ReleaseImpression 归还当天占用的一次曝光
+func (c *DailyController) ReleaseImpression(ctx context.Context, userID, adID string) error {
+	return dailyReleaseScript.Run(ctx, c.store, []string{c.dailyKey("imp", userID, adID)}).Err()
+}
+
+// CheckImpression 检查曝光频次
+func (c *DailyController) CheckImpression(ctx context.Context, userID string, adID string) (bool, error) {
+	// 获取配置
+	config, err := c.GetConfig(ctx, adID)
+	if err != nil {
+		return false, err
+	}
+	return c.check(ctx, c.dailyKey("imp", userID, adID), config.ImpressionLimit)
+}
+
+// RecordImpression 记录曝光
+func (c *DailyController) RecordImpression(ctx context.Context, userID string, adID string) error {
+	return c.record(ctx, c.dailyKey("imp", userID, adID))
+}
+
+// CheckClick 检查点击频次
+func (c *DailyController) CheckClick(ctx context.Context, userID string, adID string) (bool, error) {
+	// 获取配置
+	config, err := c.GetConfig(ctx, adID)
+	if err != nil {
+		return false, err
+	}
+	return c.check(ctx, c.dailyKey("click", userID, adID), config.ClickLimit)
+}
+
+// RecordClick 记录点击
+func (c *DailyController) RecordClick(ctx context.Context, userID string, adID string) error {
+	return c.record(ctx, c.dailyKey("click", userID, adID))
+}
+
+// UpdateConfig 更新频次控制配置
+func (c *DailyController) UpdateConfig(ctx context.Context, adID string, config *Config) error {
+	return updateConfig(ctx, c.store, c.configs, c.logger, adID, config)
+}
+
+// GetConfig 获取频次控制配置
+func (c *DailyController) GetConfig(ctx context.Context, adID string) (*Config, error) {
+	return getConfig(ctx, c.store, c.configs, adID)
+}
+
+// setConfigCache 设置频次配置缓存
+func (c *DailyController) setConfigCache(configs *cache.Tiered[Config]) {
+	c.configs = configs
+}
+
+// setTimezones 设置计算自然日使用的时区
+func (c *DailyController) setTimezones(zones *timezone.Zones) {
+	c.zones = zones
+}
+
+// setClock 设置计算自然日使用的时间来源
+func (c *DailyController) setClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// 内部方法
+
+// dailyKey 生成广告时区中当天的计数键名
+func (c *DailyController) dailyKey(kind, userID, adID string) string {
+	return fmt.Sprintf("freq:%s:%s:%s:%s", kind, userID, adID, c.clock.Now().In(c.zones.Ad(adID)).Format("20060102"))
+}
+
+func (c *DailyController) check(ctx context.Context, key string, limit int) (bool, error) {
+	// 检查频次
+	count, err := c.store.Get(ctx, key).Int()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+
+	// 超过限制
+	if count >= limit {
+		c.metrics.Frequency.LimitExceeded.Inc()
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (c *DailyController) record(ctx context.Context, key string) error {
+	// 增加计数
+	_, err := c.store.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+
+	// 设置过期时间
+	c.store.Expire(ctx, key, 24*time.Hour)
+
+	return nil
+}
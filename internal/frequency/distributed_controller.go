@@ -3,30 +3,164 @@ package frequency
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"time"
 
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/clock"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 
 	"github.com/go-redis/redis/v8"
 )
 
-// DistributedController 分布式频次控制器
+// slidingAcquireScript 移除窗口外的记录，窗口内记录数未达上限时加入本次记录
+// KEYS[1]为计数键，ARGV为当前时间、窗口起点(纳秒)、上限、过期毫秒数和记录成员，返回{是否通过, 剩余次数}
+var slidingAcquireScript = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', ARGV[2])
+local limit = tonumber(ARGV[3])
+local count = redis.call('ZCARD', KEYS[1])
+if count >= limit then
+	return {0, 0}
+end
+redis.call('ZADD', KEYS[1], ARGV[1], ARGV[5])
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+return {1, limit - count - 1}
+`)
+
+// slidingReleaseScript 移除窗口内最新的一条记录
+// KEYS[1]为计数键，返回移除后的记录数
+var slidingReleaseScript = redis.NewScript(`
+redis.call('ZPOPMAX', KEYS[1])
+return redis.call('ZCARD', KEYS[1])
+`)
+
+// DistributedController 分布式频次控制器，按时间窗口滑动计数
 type DistributedController struct {
-	redis   *redis.Client
+	store   Store
+	configs *cache.Tiered[Config]
+	clock   clock.Clock
 	logger  *logger.Logger
 	metrics *metrics.Metrics
 }
 
 // NewDistributedController 创建分布式频次控制器
-func NewDistributedController(redis *redis.Client, logger *logger.Logger, metrics *metrics.Metrics) *DistributedController {
+func NewDistributedController(store Store, logger *logger.Logger, metrics *metrics.Metrics) *DistributedController {
 	return &DistributedController{
-		redis:   redis,
+		store:   store,
+		clock:   clock.Real(),
 		logger:  logger,
 		metrics: metrics,
 	}
 }
 
+// AcquireImpression 原子地检查广告配置的时间窗口内的曝光频次并计数
+func (dc *DistributedController) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	start := time.Now()
+	defer func() {
+		dc.metrics.Frequency.CheckDuration.Observe(time.Since(start).Seconds())
+	}()
+
+	config, err := dc.GetConfig(ctx, adID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	w := window(config)
+	now := dc.clock.Now().UnixNano()
+	// 成员带随机后缀，同一纳秒内的多次计数不会相互覆盖
+	member := fmt.Sprintf("%d-%d", now, rand.Int63())
+	remaining, ok, err := acquireResult(slidingAcquireScript.Run(ctx, dc.store,
+		[]string{windowKey("imp", userID, adID)},
+		now, now-w.Nanoseconds(), config.ImpressionLimit, w.Milliseconds(), member))
+	if err != nil {
+		dc.logger.Error("频次检查失败", "error", err)
+		return 0, false, err
+	}
+
+	dc.metrics.Frequency.CheckTotal.Inc()
+	if ok {
+		dc.metrics.Frequency.RecordTotal.Inc()
+	} else {
+		dc.metrics.Frequency.LimitExceeded.Inc()
+	}
+	return remaining, ok, nil
+}
+
+// ReleaseImpression 归还时间窗口内占用的一次曝光，并发占用时移除的是最新的记录，计数不受影响
+func (dc *DistributedController) ReleaseImpression(ctx context.Context, userID, adID string) error {
+	return slidingReleaseScript.Run(ctx, dc.store, []string{windowKey("imp", userID, adID)}).Err()
+}
+
+// CheckImpression 检查广告配置的时间窗口内的曝光频次
+func (dc *DistributedController) CheckImpression(ctx context.Context, userID, adID string) (bool, error) {
+	config, err := dc.GetConfig(ctx, adID)
+	if err != nil {
+		return false, err
+	}
+	return dc.CheckFrequency(ctx, windowKey("imp", userID, adID), config.ImpressionLimit, window(config))
+}
+
+// RecordImpression 记录曝光
+func (dc *DistributedController) RecordImpression(ctx context.Context, userID, adID string) error {
+	config, err := dc.GetConfig(ctx, adID)
+	if err != nil {
+		return err
+	}
+	return dc.RecordFrequency(ctx, windowKey("imp", userID, adID), window(config))
+}
+
+// CheckClick 检查广告配置的时间窗口内的点击频次
+func (dc *DistributedController) CheckClick(ctx context.Context, userID, adID string) (bool, error) {
+	config, err := dc.GetConfig(ctx, adID)
+	if err != nil {
+		return false, err
+	}
+	return dc.CheckFrequency(ctx, windowKey("click", userID, adID), config.ClickLimit, window(config))
+}
+
+// RecordClick 记录点击
+func (dc *DistributedController) RecordClick(ctx context.Context, userID, adID string) error {
+	config, err := dc.GetConfig(ctx, adID)
+	if err != nil {
+		return err
+	}
+	return dc.RecordFrequency(ctx, windowKey("click", userID, adID), window(config))
+}
+
+// UpdateConfig 更新频次控制配置
+func (dc *DistributedController) UpdateConfig(ctx context.Context, adID string, config *Config) error {
+	return updateConfig(ctx, dc.store, dc.configs, dc.logger, adID, config)
+}
+
+// GetConfig 获取频次控制配置
+func (dc *DistributedController) GetConfig(ctx context.Context, adID string) (*Config, error) {
+	return getConfig(ctx, dc.store, dc.configs, adID)
+}
+
+// setConfigCache 设置频次配置缓存
+func (dc *DistributedController) setConfigCache(configs *cache.Tiered[Config]) {
+	dc.configs = configs
+}
+
+// setClock 设置计算时间窗口使用的时间来源
+func (dc *DistributedController) setClock(c clock.Clock) {
+	dc.clock = c
+}
+
+// windowKey 生成滑动窗口的计数键名
+func windowKey(kind, userID, adID string) string {
+	return fmt.Sprintf("freq:win:%s:%s:%s", kind, userID, adID)
+}
+
+// window 返回配置的时间窗口，未配置时使用默认窗口
+func window(config *Config) time.Duration {
+	if config.TimeWindow <= 0 {
+		return defaultConfig().TimeWindow
+	}
+	return config.TimeWindow
+}
+
 // CheckFrequency 检查频次限制
 func (dc *DistributedController) CheckFrequency(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
 	start := time.Now()
@@ -35,11 +169,11 @@ func (dc *DistributedController) CheckFrequency(ctx context.Context, key string,
 	}()
 
 	// 使用Redis的Sorted Set实现滑动窗口
-	now := time.Now().UnixNano()
+	now := dc.clock.Now().UnixNano()
 	windowStart := now - window.Nanoseconds()
 
 	// 使用Pipeline减少网络往返
-	pipe := dc.redis.Pipeline()
+	pipe := dc.store.Pipeline()
 
 	// 移除窗口外的记录
 	pipe.ZRemRangeByScore(ctx, key, "0", fmt.Sprintf("%d", windowStart))
@@ -73,10 +207,10 @@ func (dc *DistributedController) RecordFrequency(ctx context.Context, key string
 		dc.metrics.Frequency.RecordDuration.Observe(time.Since(start).Seconds())
 	}()
 
-	now := time.Now().UnixNano()
+	now := dc.clock.Now().UnixNano()
 
 	// 添加记录并设置过期时间
-	pipe := dc.redis.Pipeline()
+	pipe := dc.store.Pipeline()
 	pipe.ZAdd(ctx, key, &redis.Z{
 		Score:  float64(now),
 		Member: now,
@@ -97,10 +231,10 @@ func (dc *DistributedController) RecordFrequency(ctx context.Context, key string
 
 // GetFrequencyStats 获取频次统计
 func (dc *DistributedController) GetFrequencyStats(ctx context.Context, key string, window time.Duration) (int64, error) {
-	now := time.Now().UnixNano()
+	now := dc.clock.Now().UnixNano()
 	windowStart := now - window.Nanoseconds()
 
-	count, err := dc.redis.ZCount(ctx, key,
+	count, err := dc.store.ZCount(ctx, key,
 		fmt.Sprintf("%d", windowStart),
 		fmt.Sprintf("%d", now)).Result()
 	if err != nil {
@@ -112,5 +246,5 @@ func (dc *DistributedController) GetFrequencyStats(ctx context.Context, key stri
 
 // ClearFrequency 清除频次记录
 func (dc *DistributedController) ClearFrequency(ctx context.Context, key string) error {
-	return dc.redis.Del(ctx, key).Err()
+	return dc.store.Del(ctx, key).Err()
 }
@@ -26,4 +26,7 @@ var (
 
 	// ErrConfigNotFound 配置不存在
 	ErrConfigNotFound = errors.New("配置不存在")
+
+	// ErrInvalidMode 无效的频次控制模式
+	ErrInvalidMode = errors.New("无效的频次控制模式")
 ) 
\ No newline at end of file
@@ -0,0 +1,195 @@
+package frequency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/patrickmn/go-cache"
+
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// defaultQPSCacheTTL QPS配置的本地缓存时间
+const defaultQPSCacheTTL = 10 * time.Second
+
+// QPS限流的维度
+const (
+	// ScopeAd 按广告限流
+	ScopeAd = "ad"
+	// ScopeCampaign 按推广计划限流，同一计划下的广告共用
+	ScopeCampaign = "campaign"
+)
+
+// rateLimitScript 按令牌桶检查并扣减各维度的令牌
+// KEYS为各维度的令牌桶，ARGV[1]为当前毫秒时间戳，ARGV[i+1]为KEYS[i]的QPS，桶容量为1秒的令牌数
+// 全部维度都有令牌时各扣减一个并返回0，否则不扣减并返回第一个令牌不足的维度序号
+var rateLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local tokens = {}
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i + 1])
+	local burst = math.max(rate, 1)
+	local state = redis.call('HMGET', key, 'tokens', 'ts')
+	local current = tonumber(state[1]) or burst
+	local ts = tonumber(state[2]) or now
+	if now > ts then
+		current = math.min(burst, current + (now - ts) * rate / 1000)
+	end
+	if current < 1 then
+		return i
+	end
+	tokens[i] = current
+end
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i + 1])
+	redis.call('HSET', key, 'tokens', tokens[i] - 1, 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(math.max(rate, 1) / rate * 1000) + 1000)
+end
+return 0
+`)
+
+// RateLimiter 按广告和推广计划限制竞价QPS，避免单个计划占满竞价服务的吞吐
+// 广告的QPS取自频次配置，计划的QPS单独保存，QPS为0时不限制
+type RateLimiter struct {
+	store   Store
+	configs *cache.Cache
+	clock   clock.Clock
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+}
+
+// NewRateLimiter 创建QPS限流器，cacheTTL为QPS配置的本地缓存时间，为0时使用默认值
+func NewRateLimiter(store Store, cacheTTL time.Duration, logger *logger.Logger, metrics *metrics.Metrics) *RateLimiter {
+	if cacheTTL <= 0 {
+		cacheTTL = defaultQPSCacheTTL
+	}
+	return &RateLimiter{
+		store:   store,
+		configs: cache.New(cacheTTL, 2*cacheTTL),
+		clock:   clock.Real(),
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// SetClock 设置令牌桶补充令牌使用的时间来源，为nil时使用系统时钟
+func (r *RateLimiter) SetClock(c clock.Clock) {
+	r.clock = clock.OrReal(c)
+}
+
+// Allow 为广告和其所属计划各占用一个令牌，任一维度超过QPS时返回false且不占用
+// campaignID为空时只按广告限流
+func (r *RateLimiter) Allow(ctx context.Context, adID, campaignID string) (bool, error) {
+	if adID == "" {
+		return false, ErrInvalidAdID
+	}
+
+	adQPS, err := r.qps(ctx, ScopeAd, adID)
+	if err != nil {
+		return false, err
+	}
+	var campaignQPS float64
+	if campaignID != "" {
+		if campaignQPS, err = r.qps(ctx, ScopeCampaign, campaignID); err != nil {
+			return false, err
+		}
+	}
+
+	// 只为限流的维度创建令牌桶
+	adKey, campaignKey := bucketKeys(adID, campaignID)
+	var keys, scopes []string
+	args := []interface{}{r.clock.Now().UnixMilli()}
+	if adQPS > 0 {
+		keys, scopes = append(keys, adKey), append(scopes, ScopeAd)
+		args = append(args, adQPS)
+	}
+	if campaignQPS > 0 {
+		keys, scopes = append(keys, campaignKey), append(scopes, ScopeCampaign)
+		args = append(args, campaignQPS)
+	}
+	if len(keys) == 0 {
+		return true, nil
+	}
+
+	rejected, err := rateLimitScript.Run(ctx, r.store, keys, args...).Int()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrRedisOperationFailed, err)
+	}
+	if rejected > 0 {
+		r.metrics.Frequency.QPSLimited.WithLabelValues(scopes[rejected-1]).Inc()
+		return false, nil
+	}
+	return true, nil
+}
+
+// SetCampaignQPS 设置推广计划的QPS，为0时不限制
+func (r *RateLimiter) SetCampaignQPS(ctx context.Context, campaignID string, qps float64) error {
+	if qps < 0 {
+		return fmt.Errorf("%w: QPS不能小于0", ErrInvalidConfig)
+	}
+	key := campaignConfigKey(campaignID)
+	if qps == 0 {
+		if err := r.store.Del(ctx, key).Err(); err != nil {
+			return err
+		}
+	} else if err := r.store.HMSet(ctx, key, map[string]string{"qps": strconv.FormatFloat(qps, 'f', -1, 64)}).Err(); err != nil {
+		return err
+	}
+	r.configs.Delete(ScopeCampaign + ":" + campaignID)
+	return nil
+}
+
+// CampaignQPS 返回推广计划的QPS，未设置时为0
+func (r *RateLimiter) CampaignQPS(ctx context.Context, campaignID string) (float64, error) {
+	data, err := r.store.HGetAll(ctx, campaignConfigKey(campaignID)).Result()
+	if err != nil {
+		return 0, err
+	}
+	qps, _ := strconv.ParseFloat(data["qps"], 64)
+	return qps, nil
+}
+
+// qps 读取广告或推广计划的QPS，结果在本地缓存，配置变更最长在缓存时间后生效
+func (r *RateLimiter) qps(ctx context.Context, scope, id string) (float64, error) {
+	cacheKey := scope + ":" + id
+	if qps, ok := r.configs.Get(cacheKey); ok {
+		return qps.(float64), nil
+	}
+
+	var qps float64
+	if scope == ScopeCampaign {
+		value, err := r.CampaignQPS(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+		qps = value
+	} else {
+		config, err := loadConfig(ctx, r.store, id)
+		if err != nil {
+			return 0, err
+		}
+		qps = config.QPS
+	}
+	r.configs.SetDefault(cacheKey, qps)
+	return qps, nil
+}
+
+// bucketKeys 返回广告和推广计划的令牌桶键名
+// 同一计划的键使用相同的hash tag，集群模式下脚本可同时访问两个键
+func bucketKeys(adID, campaignID string) (adKey, campaignKey string) {
+	if campaignID == "" {
+		return fmt.Sprintf("freq:qps:{ad:%s}", adID), ""
+	}
+	return fmt.Sprintf("freq:qps:{campaign:%s}:ad:%s", campaignID, adID),
+		fmt.Sprintf("freq:qps:{campaign:%s}", campaignID)
+}
+
+// campaignConfigKey 推广计划QPS配置的键名
+func campaignConfigKey(campaignID string) string {
+	return fmt.Sprintf("freq:config:campaign:%s", campaignID)
+}
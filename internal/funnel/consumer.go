@@ -0,0 +1,178 @@
+package funnel
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 5 * time.Second
+	defaultRetentionDays = 7
+
+	// purgeInterval 清理过期漏斗行的间隔
+	purgeInterval = time.Hour
+)
+
+// Consumer 消费漏斗各阶段的事件，按请求关联后批量写入
+type Consumer struct {
+	reader *kafka.Reader
+	store  Store
+	logger *logger.Logger
+
+	batchSize     int
+	flushInterval time.Duration
+	retentionDays int
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConsumer 创建竞价漏斗消费者
+func NewConsumer(brokers []string, cfg config.FunnelConfig, store Store, logger *logger.Logger) *Consumer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = defaultRetentionDays
+	}
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupTopics: Topics(),
+			GroupID:     cfg.GroupID,
+		}),
+		store:         store,
+		logger:        logger,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		retentionDays: cfg.RetentionDays,
+	}
+}
+
+// Start 启动后台消费和过期数据清理
+func (c *Consumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(2)
+	go c.consume(ctx)
+	go c.purgeLoop(ctx)
+}
+
+// Stop 停止消费并关闭连接，未写入的一批不提交位点，重启后重新消费
+func (c *Consumer) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	if err := c.reader.Close(); err != nil {
+		c.logger.Error("关闭竞价漏斗消费者失败", "error", err)
+	}
+}
+
+// consume 攒够一批或等待超过flushInterval后写入，写入成功后才提交位点
+func (c *Consumer) consume(ctx context.Context) {
+	defer c.wg.Done()
+
+	var messages []kafka.Message
+	deadline := time.Now().Add(c.flushInterval)
+	for {
+		fetchCtx, cancel := context.WithDeadline(ctx, deadline)
+		msg, err := c.reader.FetchMessage(fetchCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			messages = append(messages, msg)
+		} else if !errors.Is(err, context.DeadlineExceeded) {
+			c.logger.Error("读取漏斗事件失败", "error", err)
+		}
+
+		if len(messages) < c.batchSize && time.Now().Before(deadline) {
+			continue
+		}
+		if len(messages) > 0 && !c.flush(ctx, messages) {
+			return
+		}
+		messages = messages[:0]
+		deadline = time.Now().Add(c.flushInterval)
+	}
+}
+
+// flush 关联一批消息并写入，写入失败时重试直到成功或停止
+// 合并规则与事件顺序无关，重复消费不会改变结果
+func (c *Consumer) flush(ctx context.Context, messages []kafka.Message) bool {
+	rows := Join(c.events(messages))
+	for {
+		err := c.store.Upsert(ctx, rows)
+		if err == nil {
+			c.logger.Debug("写入竞价漏斗", "messages", len(messages), "rows", len(rows))
+			break
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		c.logger.Error("写入竞价漏斗失败", "count", len(messages), "error", err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+
+	if err := c.reader.CommitMessages(ctx, messages...); err != nil && ctx.Err() == nil {
+		c.logger.Error("提交漏斗事件位点失败", "error", err)
+	}
+	return ctx.Err() == nil
+}
+
+// events 解析消息，无法解析的消息跳过
+func (c *Consumer) events(messages []kafka.Message) []*stats.Event {
+	events := make([]*stats.Event, 0, len(messages))
+	for _, msg := range messages {
+		event, err := stats.DecodeEvent(msg.Value)
+		if err != nil {
+			c.logger.Warn("跳过无效的漏斗事件", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// purgeLoop 启动时和每隔purgeInterval删除超过保留天数的漏斗行
+func (c *Consumer) purgeLoop(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		before := dayOf(time.Now()).AddDate(0, 0, -c.retentionDays)
+		if n, err := c.store.Purge(ctx, before); err != nil && ctx.Err() == nil {
+			c.logger.Error("清理过期竞价漏斗失败", "error", err)
+		} else if n > 0 {
+			c.logger.Info("清理过期竞价漏斗", "before", before.Format("2006-01-02"), "rows", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: funnel.go
+ * Project: simple-dsp
+ * Description: 竞价漏斗，按请求ID和广告ID关联出价、竞价成功、展示、点击和转化事件
+ *
+ * 主要功能:
+ * - 将各阶段独立计数的事件关联为每次竞价一行，支持按竞价计算胜率、CTR和CVR
+ * - 统计各阶段之间的差异，如没有出价的竞价成功、没有竞价成功的展示，用于对账
+ * - 按日期和广告汇总漏斗报表
+ *
+ * 实现细节:
+ * - 消费dsp.events.{bid,win,impression,click,conversion}，攒批后按(request_id, ad_id)合并写入
+ * - 各阶段保留首次到达的时间，出价和成交价保留先到的值，重复消费同一事件结果不变
+ * - 交易平台和广告位尺寸取自出价事件，点击和转化由此关联到供应路径
+ * - 漏斗行归入最早事件所在的日期，超过保留天数后删除
+ *
+ * 依赖关系:
+ * - gorm.io/gorm
+ * - github.com/segmentio/kafka-go
+ * - simple-dsp/internal/stats
+ *
+ * 注意事项:
+ * - 出价事件只在启用竞价漏斗时写出，每次出价一行，需按出价QPS评估表的大小和保留天数
+ * - 同一批写入中不能有重复的(request_id, ad_id)，写入前须先用Join合并
+ */
+
+package funnel
+
+import (
+	"time"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+)
+
+// 事件ExtraParams中的交易平台和广告位尺寸
+const (
+	exchangeParam = "exchange"
+	sizeParam     = "size"
+)
+
+// Stages 漏斗各阶段的事件类型，按发生顺序排列
+var Stages = []stats.EventType{
+	stats.EventBid,
+	stats.EventWin,
+	stats.EventImpression,
+	stats.EventClick,
+	stats.EventConversion,
+}
+
+// Topics 漏斗各阶段事件的Kafka主题，与stats.Collector写入的主题一致
+func Topics() []string {
+	topics := make([]string, 0, len(Stages))
+	for _, stage := range Stages {
+		topics = append(topics, "dsp.events."+string(stage))
+	}
+	return topics
+}
+
+// FromEvent 将事件转换为漏斗行，不属于漏斗阶段或缺少请求ID、广告ID的事件返回nil
+func FromEvent(event *stats.Event) *models.AuctionFunnel {
+	if event.RequestID == "" || event.AdID == "" {
+		return nil
+	}
+
+	at := event.Timestamp
+	row := &models.AuctionFunnel{
+		RequestID:  event.RequestID,
+		AdID:       event.AdID,
+		Date:       dayOf(at),
+		SlotID:     event.SlotID,
+		Exchange:   event.ExtraParams[exchangeParam],
+		Size:       event.ExtraParams[sizeParam],
+		UpdateTime: time.Now(),
+	}
+	switch event.EventType {
+	case stats.EventBid:
+		row.BidTime = &at
+		if event.BidPrice > 0 {
+			price := event.BidPrice
+			row.BidPrice = &price
+		}
+	case stats.EventWin, stats.EventImpression:
+		if event.EventType == stats.EventWin {
+			row.WinTime = &at
+		} else {
+			row.ImpressionTime = &at
+		}
+		// 展示和竞价成功通知都可能携带成交价
+		if event.WinPrice > 0 {
+			price := event.WinPrice
+			row.WinPrice = &price
+		}
+	case stats.EventClick:
+		row.ClickTime = &at
+	case stats.EventConversion:
+		row.ConversionTime = &at
+	default:
+		return nil
+	}
+	return row
+}
+
+// Merge 将src合并到同一请求同一广告的dst
+// 各阶段保留较早的时间，日期取较早的日期，价格、广告位、尺寸和交易平台保留dst已有的值
+func Merge(dst, src *models.AuctionFunnel) {
+	if src.Date.Before(dst.Date) {
+		dst.Date = src.Date
+	}
+	if dst.SlotID == "" {
+		dst.SlotID = src.SlotID
+	}
+	if dst.Exchange == "" {
+		dst.Exchange = src.Exchange
+	}
+	if dst.Size == "" {
+		dst.Size = src.Size
+	}
+	if dst.BidPrice == nil {
+		dst.BidPrice = src.BidPrice
+	}
+	if dst.WinPrice == nil {
+		dst.WinPrice = src.WinPrice
+	}
+	dst.BidTime = earliest(dst.BidTime, src.BidTime)
+	dst.WinTime = earliest(dst.WinTime, src.WinTime)
+	dst.ImpressionTime = earliest(dst.ImpressionTime, src.ImpressionTime)
+	dst.ClickTime = earliest(dst.ClickTime, src.ClickTime)
+	dst.ConversionTime = earliest(dst.ConversionTime, src.ConversionTime)
+	if src.UpdateTime.After(dst.UpdateTime) {
+		dst.UpdateTime = src.UpdateTime
+	}
+}
+
+// Join 按请求ID和广告ID关联一批事件，返回的行按首次出现的顺序排列且没有重复
+func Join(events []*stats.Event) []*models.AuctionFunnel {
+	type key struct{ requestID, adID string }
+
+	index := make(map[key]*models.AuctionFunnel, len(events))
+	rows := make([]*models.AuctionFunnel, 0, len(events))
+	for _, event := range events {
+		row := FromEvent(event)
+		if row == nil {
+			continue
+		}
+		k := key{row.RequestID, row.AdID}
+		if existing, ok := index[k]; ok {
+			Merge(existing, row)
+			continue
+		}
+		index[k] = row
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Report 一天中一个广告的漏斗汇总，各阶段为到达该阶段的竞价数
+type Report struct {
+	Date        string `gorm:"column:date" json:"date"`
+	AdID        string `gorm:"column:ad_id" json:"ad_id,omitempty"`
+	Auctions    int64  `gorm:"column:auctions" json:"auctions"`
+	Bids        int64  `gorm:"column:bids" json:"bids"`
+	Wins        int64  `gorm:"column:wins" json:"wins"`
+	Impressions int64  `gorm:"column:impressions" json:"impressions"`
+	Clicks      int64  `gorm:"column:clicks" json:"clicks"`
+	Conversions int64  `gorm:"column:conversions" json:"conversions"`
+
+	// 各阶段之间的差异，上一阶段缺失时通常是事件丢失、超时或伪造
+	WinsWithoutBid          int64 `gorm:"column:wins_without_bid" json:"wins_without_bid"`
+	WinsWithoutImpression   int64 `gorm:"column:wins_without_impression" json:"wins_without_impression"`
+	ImpressionsWithoutWin   int64 `gorm:"column:impressions_without_win" json:"impressions_without_win"`
+	ClicksWithoutImpression int64 `gorm:"column:clicks_without_impression" json:"clicks_without_impression"`
+
+	WinRate float64 `gorm:"-" json:"win_rate"`
+	CTR     float64 `gorm:"-" json:"ctr"`
+	CVR     float64 `gorm:"-" json:"cvr"`
+}
+
+// Add 累加另一份汇总，用于计算多天或多个广告的合计
+func (r *Report) Add(o Report) {
+	r.Auctions += o.Auctions
+	r.Bids += o.Bids
+	r.Wins += o.Wins
+	r.Impressions += o.Impressions
+	r.Clicks += o.Clicks
+	r.Conversions += o.Conversions
+	r.WinsWithoutBid += o.WinsWithoutBid
+	r.WinsWithoutImpression += o.WinsWithoutImpression
+	r.ImpressionsWithoutWin += o.ImpressionsWithoutWin
+	r.ClicksWithoutImpression += o.ClicksWithoutImpression
+}
+
+// Calculate 按各阶段的竞价数计算胜率、点击率和转化率
+func (r *Report) Calculate() {
+	r.WinRate = stats.Ratio(r.Wins, r.Bids)
+	r.CTR = stats.Ratio(r.Clicks, r.Impressions)
+	r.CVR = stats.Ratio(r.Conversions, r.Clicks)
+}
+
+// earliest 返回较早的时间，nil表示该阶段未到达
+func earliest(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.Before(*a)) {
+		return b
+	}
+	return a
+}
+
+// dayOf 返回t在本地时区所在的日期
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.Local().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,96 @@
+package funnel
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// Store 竞价漏斗存储
+type Store interface {
+	// Upsert 写入漏斗行，已存在的行按Merge的规则合并；rows中不能有重复的(request_id, ad_id)
+	Upsert(ctx context.Context, rows []*models.AuctionFunnel) error
+	// Report 按日期和广告汇总日期在[startDate, endDate]内的漏斗，adID为空时不限制广告
+	Report(ctx context.Context, startDate, endDate, adID string) ([]Report, error)
+	// Purge 删除日期早于before的漏斗行，返回删除的行数
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// GormStore 基于数据库的竞价漏斗存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于数据库的竞价漏斗存储
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// mergeAssignments 与Merge相同的合并规则，LEAST忽略NULL，已到达的阶段不会被清空
+var mergeAssignments = clause.Assignments(map[string]interface{}{
+	"date":            gorm.Expr("LEAST(auction_funnels.date, EXCLUDED.date)"),
+	"slot_id":         gorm.Expr("COALESCE(NULLIF(auction_funnels.slot_id, ''), EXCLUDED.slot_id)"),
+	"exchange":        gorm.Expr("COALESCE(NULLIF(auction_funnels.exchange, ''), EXCLUDED.exchange)"),
+	"size":            gorm.Expr("COALESCE(NULLIF(auction_funnels.size, ''), EXCLUDED.size)"),
+	"bid_price":       gorm.Expr("COALESCE(auction_funnels.bid_price, EXCLUDED.bid_price)"),
+	"win_price":       gorm.Expr("COALESCE(auction_funnels.win_price, EXCLUDED.win_price)"),
+	"bid_time":        gorm.Expr("LEAST(auction_funnels.bid_time, EXCLUDED.bid_time)"),
+	"win_time":        gorm.Expr("LEAST(auction_funnels.win_time, EXCLUDED.win_time)"),
+	"impression_time": gorm.Expr("LEAST(auction_funnels.impression_time, EXCLUDED.impression_time)"),
+	"click_time":      gorm.Expr("LEAST(auction_funnels.click_time, EXCLUDED.click_time)"),
+	"conversion_time": gorm.Expr("LEAST(auction_funnels.conversion_time, EXCLUDED.conversion_time)"),
+	"update_time":     gorm.Expr("EXCLUDED.update_time"),
+})
+
+// Upsert 写入漏斗行，依赖(request_id, ad_id)主键合并
+func (s *GormStore) Upsert(ctx context.Context, rows []*models.AuctionFunnel) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	return s.db.WithContext(database.WithQueryName(ctx, "funnel.upsert")).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "request_id"}, {Name: "ad_id"}},
+			DoUpdates: mergeAssignments,
+		}).
+		Create(&rows).Error
+}
+
+// Report 按日期和广告汇总漏斗，按日期降序、广告ID升序排列
+func (s *GormStore) Report(ctx context.Context, startDate, endDate, adID string) ([]Report, error) {
+	query := s.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "funnel.report"))).
+		Model(&models.AuctionFunnel{}).
+		Select(`TO_CHAR(date, 'YYYY-MM-DD') AS date, ad_id, COUNT(*) AS auctions,
+			COUNT(bid_time) AS bids, COUNT(win_time) AS wins, COUNT(impression_time) AS impressions,
+			COUNT(click_time) AS clicks, COUNT(conversion_time) AS conversions,
+			COUNT(*) FILTER (WHERE win_time IS NOT NULL AND bid_time IS NULL) AS wins_without_bid,
+			COUNT(*) FILTER (WHERE win_time IS NOT NULL AND impression_time IS NULL) AS wins_without_impression,
+			COUNT(*) FILTER (WHERE impression_time IS NOT NULL AND win_time IS NULL) AS impressions_without_win,
+			COUNT(*) FILTER (WHERE click_time IS NOT NULL AND impression_time IS NULL) AS clicks_without_impression`).
+		Where("date BETWEEN ? AND ?", startDate, endDate)
+	if adID != "" {
+		query = query.Where("ad_id = ?", adID)
+	}
+
+	var reports []Report
+	err := query.Group("auction_funnels.date, ad_id").Order("auction_funnels.date DESC, ad_id").Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range reports {
+		reports[i].Calculate()
+	}
+	return reports, nil
+}
+
+// Purge 删除日期早于before的漏斗行
+func (s *GormStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(database.WithQueryName(ctx, "funnel.purge")).
+		Where("date < ?", before.Format("2006-01-02")).
+		Delete(&models.AuctionFunnel{})
+	return result.RowsAffected, result.Error
+}
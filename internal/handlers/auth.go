@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/auth"
+	"simple-dsp/pkg/logger"
+)
+
+// AuthHandler 管理后台登录和用户管理处理器
+type AuthHandler struct {
+	service *auth.Service
+	logger  *logger.Logger
+}
+
+// NewAuthHandler 创建登录和用户管理处理器
+func NewAuthHandler(service *auth.Service, logger *logger.Logger) *AuthHandler {
+	return &AuthHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes 注册路由，需要在认证中间件之后注册
+func (h *AuthHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/auth")
+	{
+		g.POST("/login", h.Login)
+		g.POST("/logout", h.Logout)
+		g.GET("/me", h.Me)
+		g.PUT("/password", h.ChangePassword)
+		g.POST("/totp", h.EnrollTOTP)
+		g.POST("/totp/confirm", h.ConfirmTOTP)
+	}
+
+	users := r.Group("/api/v1/users", auth.RequireRole(auth.RoleAdmin))
+	{
+		users.GET("", h.ListUsers)
+		users.POST("", h.CreateUser)
+		users.GET("/:id", h.GetUser)
+		users.PUT("/:id", h.UpdateUser)
+		users.DELETE("/:id", h.DeleteUser)
+		users.PUT("/:id/password", h.ResetPassword)
+		users.DELETE("/:id/totp", h.DisableTOTP)
+	}
+}
+
+// loginRequest 登录请求
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	// OTP 已启用动态口令的用户必须提供
+	OTP string `json:"otp"`
+}
+
+// Login 用户名密码登录，成功后写入会话和CSRF令牌Cookie
+// 用户已启用动态口令但未提供时返回401和otp_required，客户端应提示输入后重新提交
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req loginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.service.Login(c.Request.Context(), req.Username, req.Password, req.OTP)
+	if errors.Is(err, auth.ErrOTPRequired) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "otp_required": true})
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, auth.ErrInvalidCredentials) && !errors.Is(err, auth.ErrInvalidOTP) {
+			h.logger.Warn("登录失败", "username", req.Username, "client_ip", c.ClientIP(), "error", err)
+		}
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.service.SetSessionCookies(c, session)
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":       session.UserID,
+		"username":      session.Username,
+		"role":          session.Role,
+		"advertiser_id": session.AdvertiserID,
+		"csrf_token":    session.CSRFToken,
+		"expire_time":   session.ExpireTime,
+	})
+}
+
+// Logout 注销当前会话
+func (h *AuthHandler) Logout(c *gin.Context) {
+	session, ok := auth.SessionFrom(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrUserRequired.Error()})
+		return
+	}
+	if err := h.service.Logout(c.Request.Context(), session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	h.service.ClearSessionCookies(c)
+	c.Status(http.StatusNoContent)
+}
+
+// Me 返回当前调用方
+func (h *AuthHandler) Me(c *gin.Context) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrUnauthenticated.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, principal)
+}
+
+// changePasswordRequest 修改密码请求
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 修改自己的密码，其他设备上的会话全部注销，当前设备换发新的会话
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	principal, ok := h.sessionUser(c)
+	if !ok {
+		return
+	}
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := h.service.ChangePassword(c.Request.Context(), principal.UserID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("修改密码", "username", principal.Username)
+	h.service.SetSessionCookies(c, session)
+	c.JSON(http.StatusOK, gin.H{"csrf_token": session.CSRFToken})
+}
+
+// EnrollTOTP 为自己生成动态口令密钥，确认后生效
+func (h *AuthHandler) EnrollTOTP(c *gin.Context) {
+	principal, ok := h.sessionUser(c)
+	if !ok {
+		return
+	}
+	secret, uri, err := h.service.EnrollTOTP(c.Request.Context(), principal.UserID)
+	if err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "uri": uri})
+}
+
+// confirmTOTPRequest 确认动态口令请求
+type confirmTOTPRequest struct {
+	OTP string `json:"otp" binding:"required"`
+}
+
+// ConfirmTOTP 提交新密钥生成的口令，通过后启用动态口令
+func (h *AuthHandler) ConfirmTOTP(c *gin.Context) {
+	principal, ok := h.sessionUser(c)
+	if !ok {
+		return
+	}
+	var req confirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.service.ConfirmTOTP(c.Request.Context(), principal.UserID, req.OTP); err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("启用动态口令", "username", principal.Username)
+	c.Status(http.StatusNoContent)
+}
+
+// ListUsers 列出所有用户
+func (h *AuthHandler) ListUsers(c *gin.Context) {
+	users, err := h.service.ListUsers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// createUserRequest 创建用户请求
+type createUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	// AdvertiserID 广告主用户所属的广告主
+	AdvertiserID string `json:"advertiser_id"`
+}
+
+// CreateUser 创建用户
+func (h *AuthHandler) CreateUser(c *gin.Context) {
+	var req createUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.CreateUser(c.Request.Context(), req.Username, req.Password, req.Role, req.AdvertiserID)
+	if err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("创建用户", "user_id", user.ID, "username", user.Username, "role", user.Role, "operator", operatorOf(c))
+	c.JSON(http.StatusCreated, user)
+}
+
+// GetUser 获取用户
+func (h *AuthHandler) GetUser(c *gin.Context) {
+	user, err := h.service.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUser 修改用户的角色、所属广告主和启用状态，未提供的字段不修改，该用户的所有会话会被注销
+func (h *AuthHandler) UpdateUser(c *gin.Context) {
+	var req auth.UserUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.UpdateUser(c.Request.Context(), c.Param("id"), req)
+	if err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("修改用户", "user_id", user.ID, "role", user.Role, "advertiser_id", user.AdvertiserID, "enabled", user.Enabled, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, user)
+}
+
+// DeleteUser 删除用户
+func (h *AuthHandler) DeleteUser(c *gin.Context) {
+	userID := c.Param("id")
+	if err := h.service.DeleteUser(c.Request.Context(), userID); err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("删除用户", "user_id", userID, "operator", operatorOf(c))
+	c.Status(http.StatusNoContent)
+}
+
+// resetPasswordRequest 重置密码请求
+type resetPasswordRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// ResetPassword 重置用户密码，该用户的所有会话会被注销
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.Param("id")
+	if err := h.service.SetPassword(c.Request.Context(), userID, req.Password); err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("重置用户密码", "user_id", userID, "operator", operatorOf(c))
+	c.Status(http.StatusNoContent)
+}
+
+// DisableTOTP 停用用户的动态口令，用于用户丢失设备后重新绑定，该用户的所有会话会被注销
+func (h *AuthHandler) DisableTOTP(c *gin.Context) {
+	userID := c.Param("id")
+	if err := h.service.DisableTOTP(c.Request.Context(), userID); err != nil {
+		c.JSON(authStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("停用用户动态口令", "user_id", userID, "operator", operatorOf(c))
+	c.Status(http.StatusNoContent)
+}
+
+// sessionUser 返回以会话登录的用户，API令牌调用时返回400
+func (h *AuthHandler) sessionUser(c *gin.Context) (*auth.Principal, bool) {
+	principal, ok := auth.PrincipalFrom(c)
+	if !ok || principal.Method != auth.MethodSession {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrUserRequired.Error()})
+		return nil, false
+	}
+	return principal, true
+}
+
+// authStatus 返回认证错误对应的HTTP状态码
+func authStatus(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrInvalidOTP), errors.Is(err, auth.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, auth.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrUsernameTaken), errors.Is(err, auth.ErrTOTPEnabled):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrInvalidUsername), errors.Is(err, auth.ErrWeakPassword),
+		errors.Is(err, auth.ErrInvalidRole), errors.Is(err, auth.ErrInvalidAdvertiser), errors.Is(err, auth.ErrTOTPNotEnrolled):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
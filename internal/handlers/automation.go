@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/automation"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+// automationRuleListSpec 自动化规则列表允许的排序和过滤字段
+var automationRuleListSpec = listing.Spec{
+	Sortable:    []string{"name", "create_time", "update_time"},
+	Filterable:  []string{"enabled", "dry_run"},
+	DefaultSort: "-create_time",
+}
+
+// automationActionListSpec 自动化操作记录列表允许的排序和过滤字段
+var automationActionListSpec = listing.Spec{
+	Sortable:    []string{"create_time"},
+	Filterable:  []string{"rule_id", "strategy_id", "action", "status"},
+	DefaultSort: "-create_time",
+}
+
+// AutomationHandler 自动化规则处理器
+type AutomationHandler struct {
+	db     *gorm.DB
+	engine *automation.Engine
+	logger *logger.Logger
+}
+
+// NewAutomationHandler 创建自动化规则处理器
+func NewAutomationHandler(db *gorm.DB, engine *automation.Engine, logger *logger.Logger) *AutomationHandler {
+	return &AutomationHandler{
+		db:     db,
+		engine: engine,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *AutomationHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/automation")
+	{
+		g.POST("/rules", h.CreateRule)
+		g.GET("/rules", h.ListRules)
+		g.GET("/rules/:id", h.GetRule)
+		g.PUT("/rules/:id", h.UpdateRule)
+		g.DELETE("/rules/:id", h.DeleteRule)
+		g.POST("/rules/:id/preview", h.PreviewRule)
+		g.POST("/preview", h.PreviewDraft)
+		g.GET("/actions", h.ListActions)
+	}
+}
+
+// CreateRule 创建规则
+func (h *AutomationHandler) CreateRule(c *gin.Context) {
+	var rule automation.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.ID = id.New()
+	rule.CreateTime = time.Now()
+	if !h.saveRule(c, &rule) {
+		return
+	}
+
+	h.logger.Info("创建自动化规则", "rule_id", rule.ID, "dry_run", rule.DryRun, "operator", operatorOf(c))
+	c.JSON(http.StatusCreated, rule)
+}
+
+// ListRules 列出规则，支持分页、排序和过滤
+func (h *AutomationHandler) ListRules(c *gin.Context) {
+	query, err := listing.ParseQuery(c, automationRuleListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := queryPage(h.db.Model(&models.AutomationRule{}), query, automationRuleField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	rules := make([]*automation.Rule, 0, len(page.Items))
+	for i := range page.Items {
+		rule, err := automation.FromModel(&page.Items[i])
+		if err != nil {
+			h.logger.Error("转换自动化规则失败", "rule_id", page.Items[i].ID, "error", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	c.JSON(http.StatusOK, listing.Page[*automation.Rule]{
+		Items:      rules,
+		Total:      page.Total,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// GetRule 获取规则
+func (h *AutomationHandler) GetRule(c *gin.Context) {
+	rule, ok := h.loadRule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rule)
+}
+
+// UpdateRule 更新规则
+func (h *AutomationHandler) UpdateRule(c *gin.Context) {
+	existing, ok := h.loadRule(c)
+	if !ok {
+		return
+	}
+
+	var rule automation.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule.ID = existing.ID
+	rule.CreateTime = existing.CreateTime
+	if !h.saveRule(c, &rule) {
+		return
+	}
+
+	h.logger.Info("更新自动化规则", "rule_id", rule.ID, "dry_run", rule.DryRun, "enabled", rule.Enabled, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule 删除规则及其操作记录
+func (h *AutomationHandler) DeleteRule(c *gin.Context) {
+	id := c.Param("id")
+	err := database.Transaction(c.Request.Context(), h.db, func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.AutomationAction{}, "rule_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.AutomationRule{}, "id = ?", id).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("删除自动化规则", "rule_id", id, "operator", operatorOf(c))
+	c.Status(http.StatusNoContent)
+}
+
+// PreviewRule 按当前数据评估已保存的规则，返回将要执行的操作，不修改出价策略
+func (h *AutomationHandler) PreviewRule(c *gin.Context) {
+	rule, ok := h.loadRule(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"actions": h.engine.Preview(c.Request.Context(), rule)})
+}
+
+// PreviewDraft 评估未保存的规则，用于创建规则前确认效果
+func (h *AutomationHandler) PreviewDraft(c *gin.Context) {
+	var rule automation.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := rule.Validate(h.engine.MaxChangePercent()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"actions": h.engine.Preview(c.Request.Context(), &rule)})
+}
+
+// ListActions 列出操作记录，支持按rule_id、strategy_id、action、status过滤
+func (h *AutomationHandler) ListActions(c *gin.Context) {
+	query, err := listing.ParseQuery(c, automationActionListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := queryPage(h.db.Model(&models.AutomationAction{}), query, automationActionField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// loadRule 按路径参数加载规则，失败时已写入响应
+func (h *AutomationHandler) loadRule(c *gin.Context) (*automation.Rule, bool) {
+	var record models.AutomationRule
+	if err := h.db.First(&record, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	rule, err := automation.FromModel(&record)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return rule, true
+}
+
+// saveRule 校验并保存规则，失败时已写入响应
+func (h *AutomationHandler) saveRule(c *gin.Context, rule *automation.Rule) bool {
+	if err := rule.Validate(h.engine.MaxChangePercent()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	rule.UpdateTime = time.Now()
+	record, err := rule.ToModel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := h.db.Save(record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// automationRuleField 读取规则字段
+func automationRuleField(m models.AutomationRule, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "name":
+		return m.Name
+	case "enabled":
+		return m.Enabled
+	case "dry_run":
+		return m.DryRun
+	case "create_time":
+		return m.CreateTime
+	case "update_time":
+		return m.UpdateTime
+	}
+	return nil
+}
+
+// automationActionField 读取操作记录字段
+func automationActionField(m models.AutomationAction, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "create_time":
+		return m.CreateTime
+	}
+	return nil
+}
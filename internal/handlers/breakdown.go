@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/logger"
+)
+
+// DimensionStatsLoader 按维度拆分的统计
+type DimensionStatsLoader interface {
+	Load(ctx context.Context, adID string, dim stats.Dimension, startDate, endDate string) ([]stats.DimensionStats, error)
+}
+
+// BreakdownHandler 按地域和设备拆分的报表处理器
+type BreakdownHandler struct {
+	loader DimensionStatsLoader
+	logger *logger.Logger
+}
+
+// NewBreakdownHandler 创建按维度拆分的报表处理器
+func NewBreakdownHandler(loader DimensionStatsLoader, logger *logger.Logger) *BreakdownHandler {
+	return &BreakdownHandler{
+		loader: loader,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *BreakdownHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/api/v1/admin/stats/breakdown", h.GetBreakdown)
+}
+
+// GetBreakdown 按维度拆分广告在日期范围内的统计，ad_id必填
+// dimension为country、province、city、device_type或os，默认country；没有解析出维度的事件计入unknown
+func (h *BreakdownHandler) GetBreakdown(c *gin.Context) {
+	startDate, endDate, err := parseStatsRange(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adID := c.Query("ad_id")
+	if adID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrMissingAdID.Error()})
+		return
+	}
+	dim, err := stats.ParseDimension(c.DefaultQuery("dimension", string(stats.DimensionCountry)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, err := h.loader.Load(c.Request.Context(), adID, dim, startDate, endDate)
+	if err != nil {
+		h.logger.Error("查询按维度拆分的统计失败", "ad_id", adID, "dimension", dim, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	summary := stats.DimensionStats{Value: "total"}
+	for _, item := range items {
+		summary.Wins += item.Wins
+		summary.Impressions += item.Impressions
+		summary.Clicks += item.Clicks
+		summary.Conversions += item.Conversions
+		summary.Cost += item.Cost
+	}
+	if summary.Impressions > 0 {
+		summary.CTR = float64(summary.Clicks) / float64(summary.Impressions)
+	}
+	if summary.Clicks > 0 {
+		summary.CVR = float64(summary.Conversions) / float64(summary.Clicks)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad_id":      adID,
+		"dimension":  dim,
+		"start_date": startDate,
+		"end_date":   endDate,
+		"summary":    summary,
+		"items":      items,
+	})
+}
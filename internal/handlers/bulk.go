@@ -0,0 +1,639 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/audit"
+	"simple-dsp/internal/auth"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/logger"
+)
+
+// maxBulkItems 单次批量操作允许的最大对象数
+const maxBulkItems = 500
+
+// 审计动作
+const (
+	auditActionBulkStatus = "bulk_status"
+	auditActionBulkBudget = "bulk_budget"
+)
+
+// BulkFilter 批量操作过滤条件
+type BulkFilter struct {
+	AdvertiserID string `json:"advertiser_id"` // 广告主ID，仅适用于广告计划
+	Status       string `json:"status"`        // 当前状态，仅适用于广告计划
+	BidType      string `json:"bid_type"`      // 计费类型，仅适用于出价策略
+}
+
+// BulkStatusRequest 批量状态变更请求
+type BulkStatusRequest struct {
+	IDs    []string    `json:"ids"`                       // 对象ID列表，与filter二选一
+	Filter *BulkFilter `json:"filter"`                    // 过滤条件
+	Action string      `json:"action" binding:"required"` // pause/resume/archive
+	Atomic bool        `json:"atomic"`                    // 事务模式，任一失败则全部回滚
+}
+
+// BulkBudgetRequest 批量预算调整请求
+type BulkBudgetRequest struct {
+	IDs    []string    `json:"ids"`                     // 对象ID列表，与filter二选一
+	Filter *BulkFilter `json:"filter"`                  // 过滤条件
+	Mode   string      `json:"mode" binding:"required"` // set/increase/decrease/scale
+	Value  float64     `json:"value"`                   // 调整值
+	Atomic bool        `json:"atomic"`                  // 事务模式，任一失败则全部回滚
+}
+
+// BulkItemResult 单个对象的处理结果
+type BulkItemResult struct {
+	ID      string      `json:"id"`
+	Success bool        `json:"success"`
+	Before  interface{} `json:"before,omitempty"`
+	After   interface{} `json:"after,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// BulkResponse 批量操作响应
+type BulkResponse struct {
+	BatchID   string           `json:"batch_id"`
+	Atomic    bool             `json:"atomic"`
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// BulkHandler 批量操作处理器
+// 广告计划支持事务模式；出价策略存储不支持事务，逐个处理并报告结果
+type BulkHandler struct {
+	db         *gorm.DB
+	strategies bidding.Repository
+	redis      *redis.Client
+	recorder   *audit.Recorder
+	configMgr  *campaign.ConfigManager
+	notifier   webhook.Notifier
+	logger     *logger.Logger
+}
+
+// NewBulkHandler 创建批量操作处理器
+// redisClient为nil时不发布策略变更通知
+func NewBulkHandler(
+	db *gorm.DB,
+	strategies bidding.Repository,
+	redisClient *redis.Client,
+	configMgr *campaign.ConfigManager,
+	logger *logger.Logger,
+) *BulkHandler {
+	return &BulkHandler{
+		db:         db,
+		strategies: strategies,
+		redis:      redisClient,
+		recorder:   audit.NewRecorder(db),
+		configMgr:  configMgr,
+		logger:     logger,
+	}
+}
+
+// SetNotifier 设置事件通知，为nil时不发送通知
+func (h *BulkHandler) SetNotifier(notifier webhook.Notifier) {
+	h.notifier = notifier
+}
+
+// RegisterRoutes 注册路由
+func (h *BulkHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/bulk")
+	{
+		g.POST("/campaigns/status", h.BulkCampaignStatus)
+		g.POST("/campaigns/budget", h.BulkCampaignBudget)
+		g.POST("/strategies/status", h.BulkStrategyStatus)
+		g.POST("/strategies/budget", h.BulkStrategyBudget)
+	}
+}
+
+// BulkCampaignStatus 批量暂停/恢复/归档广告计划
+func (h *BulkHandler) BulkCampaignStatus(c *gin.Context) {
+	var req BulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := campaign.NextStatus(req.Action, campaign.StatusActive); errors.Is(err, campaign.ErrInvalidAction) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyCampaigns(c, req.IDs, req.Filter, req.Atomic, auditActionBulkStatus, func(model *models.Campaign) error {
+		next, err := campaign.NextStatus(req.Action, model.Status)
+		if err != nil {
+			return err
+		}
+		model.Status = next
+		return nil
+	})
+}
+
+// BulkCampaignBudget 批量调整广告计划预算
+func (h *BulkHandler) BulkCampaignBudget(c *gin.Context) {
+	var req BulkBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := campaign.ValidateBudgetChange(req.Mode, req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyCampaigns(c, req.IDs, req.Filter, req.Atomic, auditActionBulkBudget, func(model *models.Campaign) error {
+		next, err := campaign.ApplyBudgetChange(req.Mode, model.Budget, req.Value)
+		if err != nil {
+			return err
+		}
+		model.Budget = next
+		return nil
+	})
+}
+
+// BulkStrategyStatus 批量暂停/恢复/归档出价策略
+func (h *BulkHandler) BulkStrategyStatus(c *gin.Context) {
+	var req BulkStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := nextStrategyStatus(req.Action, bidding.StrategyStatusEnabled); errors.Is(err, campaign.ErrInvalidAction) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyStrategies(c, req.IDs, req.Filter, req.Atomic, auditActionBulkStatus, func(ctx context.Context, id int64, strategy *bidding.BidStrategy) error {
+		next, err := nextStrategyStatus(req.Action, strategy.Status)
+		if err != nil {
+			return err
+		}
+		if err := h.strategies.UpdateBidStrategyStatus(ctx, id, next); err != nil {
+			return err
+		}
+		strategy.Status = next
+		return nil
+	})
+}
+
+// BulkStrategyBudget 批量调整出价策略日预算
+func (h *BulkHandler) BulkStrategyBudget(c *gin.Context) {
+	var req BulkBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := campaign.ValidateBudgetChange(req.Mode, req.Value); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.applyStrategies(c, req.IDs, req.Filter, req.Atomic, auditActionBulkBudget, func(ctx context.Context, id int64, strategy *bidding.BidStrategy) error {
+		next, err := campaign.ApplyBudgetChange(req.Mode, float64(strategy.DailyBudget), req.Value)
+		if err != nil {
+			return err
+		}
+		strategy.DailyBudget = int(math.Round(next))
+		return h.strategies.UpdateBidStrategy(ctx, strategy)
+	})
+}
+
+// applyCampaigns 对选中的广告计划逐个执行变更
+// 每个计划的变更与审计日志在同一事务中提交；事务模式下所有计划共用一个事务
+func (h *BulkHandler) applyCampaigns(c *gin.Context, ids []string, filter *BulkFilter, atomic bool, action string, mutate func(*models.Campaign) error) {
+	ctx := c.Request.Context()
+
+	campaigns, results, err := h.selectCampaigns(ctx, ids, filter)
+	if err != nil {
+		h.abortSelection(c, err)
+		return
+	}
+
+	batchID := newBatchID()
+	operator := operatorOf(c)
+	changed := make([]models.Campaign, 0, len(campaigns))
+
+	apply := func(tx *gorm.DB, model models.Campaign) (BulkItemResult, error) {
+		result := BulkItemResult{ID: model.ID, Before: campaignSnapshot(&model)}
+		if err := mutate(&model); err != nil {
+			return result, err
+		}
+		model.UpdateTime = time.Now()
+
+		err := tx.Model(&models.Campaign{}).Where("id = ?", model.ID).Updates(map[string]interface{}{
+			"status":      model.Status,
+			"budget":      model.Budget,
+			"update_time": model.UpdateTime,
+		}).Error
+		if err != nil {
+			return result, err
+		}
+
+		result.After = campaignSnapshot(&model)
+		err = h.recorder.WithTx(tx).Record(ctx, audit.Entry{
+			Operator:     operator,
+			Action:       action,
+			ResourceType: audit.ResourceCampaign,
+			ResourceID:   model.ID,
+			BatchID:      batchID,
+			Before:       result.Before,
+			After:        result.After,
+		})
+		if err != nil {
+			return result, err
+		}
+
+		result.Success = true
+		changed = append(changed, model)
+		return result, nil
+	}
+
+	if atomic {
+		var itemResults []BulkItemResult
+		txErr := database.Transaction(ctx, h.db, func(tx *gorm.DB) error {
+			for _, model := range campaigns {
+				result, err := apply(tx, model)
+				if err != nil {
+					result.Error = err.Error()
+					itemResults = append(itemResults, result)
+					return err
+				}
+				itemResults = append(itemResults, result)
+			}
+			return nil
+		})
+		if txErr != nil {
+			changed = changed[:0]
+			itemResults = rollbackResults(itemResults, campaignIDs(campaigns))
+		}
+		results = append(results, itemResults...)
+	} else {
+		for _, model := range campaigns {
+			var result BulkItemResult
+			err := database.Transaction(ctx, h.db, func(tx *gorm.DB) error {
+				var err error
+				result, err = apply(tx, model)
+				return err
+			})
+			if err != nil {
+				result.Success = false
+				result.Error = err.Error()
+				changed = removeCampaign(changed, model.ID)
+			}
+			results = append(results, result)
+		}
+	}
+
+	// 暂停操作通知订阅方，恢复和归档不会产生paused状态
+	if h.notifier != nil && action == auditActionBulkStatus {
+		for i := range changed {
+			if changed[i].Status != campaign.StatusPaused {
+				continue
+			}
+			h.notifier.Notify(ctx, webhook.EventCampaignPaused, map[string]interface{}{
+				"campaign_id":   changed[i].ID,
+				"advertiser_id": changed[i].AdvertiserID,
+				"operator":      operator,
+				"batch_id":      batchID,
+			})
+		}
+	}
+
+	// 同步内存中的计划配置
+	for i := range changed {
+		if _, ok := h.configMgr.GetConfig(changed[i].ID); !ok {
+			continue
+		}
+		config, err := changed[i].ToCampaignConfig()
+		if err != nil {
+			h.logger.Error("转换广告计划配置失败", "campaign_id", changed[i].ID, "error", err)
+			continue
+		}
+		h.configMgr.SetConfig(config)
+	}
+
+	h.respond(c, batchID, atomic, results)
+}
+
+// applyStrategies 对选中的出价策略逐个执行变更
+// 策略存储不支持事务，不接受事务模式
+func (h *BulkHandler) applyStrategies(c *gin.Context, ids []string, filter *BulkFilter, atomic bool, action string, mutate func(context.Context, int64, *bidding.BidStrategy) error) {
+	if atomic {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrAtomicUnsupported.Error()})
+		return
+	}
+	if h.strategies == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": bidding.ErrRepositoryUnavailable.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	strategies, results, err := h.selectStrategies(ctx, ids, filter)
+	if err != nil {
+		h.abortSelection(c, err)
+		return
+	}
+
+	batchID := newBatchID()
+	operator := operatorOf(c)
+	succeeded := 0
+
+	for i := range strategies {
+		strategy := strategies[i]
+		result := BulkItemResult{ID: strategy.ID, Before: strategySnapshot(&strategy)}
+
+		id, err := strconv.ParseInt(strategy.ID, 10, 64)
+		if err == nil {
+			err = mutate(ctx, id, &strategy)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		result.Success = true
+		result.After = strategySnapshot(&strategy)
+		results = append(results, result)
+		succeeded++
+
+		// 变更已生效，审计日志写入失败不影响结果
+		err = h.recorder.Record(ctx, audit.Entry{
+			Operator:     operator,
+			Action:       action,
+			ResourceType: audit.ResourceStrategy,
+			ResourceID:   strategy.ID,
+			BatchID:      batchID,
+			Before:       result.Before,
+			After:        result.After,
+		})
+		if err != nil {
+			h.logger.Error("写入审计日志失败", "strategy_id", strategy.ID, "batch_id", batchID, "error", err)
+		}
+	}
+
+	// 整批只通知一次，避免竞价节点反复全量刷新
+	if succeeded > 0 && h.redis != nil {
+		if err := bidding.PublishStrategyChange(ctx, h.redis, "", action); err != nil {
+			h.logger.Warn("发布策略变更通知失败", "batch_id", batchID, "error", err)
+		}
+	}
+
+	h.respond(c, batchID, false, results)
+}
+
+// selectCampaigns 按ID列表或过滤条件查询广告计划
+// 按ID查询时，不存在的ID直接记为失败结果
+func (h *BulkHandler) selectCampaigns(ctx context.Context, ids []string, filter *BulkFilter) ([]models.Campaign, []BulkItemResult, error) {
+	if err := checkSelection(ids, filter); err != nil {
+		return nil, nil, err
+	}
+
+	var campaigns []models.Campaign
+	query := h.db.WithContext(ctx).Order("id")
+	if len(ids) > 0 {
+		query = query.Where("id IN ?", ids)
+	} else {
+		if filter.AdvertiserID != "" {
+			query = query.Where("advertiser_id = ?", filter.AdvertiserID)
+		}
+		if filter.Status != "" {
+			query = query.Where("status = ?", filter.Status)
+		}
+		query = query.Limit(maxBulkItems + 1)
+	}
+	if err := query.Find(&campaigns).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(campaigns) > maxBulkItems {
+		return nil, nil, ErrTooManyItems
+	}
+
+	var missing []BulkItemResult
+	if len(ids) > 0 {
+		found := make(map[string]bool, len(campaigns))
+		for _, model := range campaigns {
+			found[model.ID] = true
+		}
+		for _, id := range dedupe(ids) {
+			if !found[id] {
+				missing = append(missing, BulkItemResult{ID: id, Error: "campaign not found"})
+			}
+		}
+	}
+
+	return campaigns, missing, nil
+}
+
+// selectStrategies 按ID列表或过滤条件查询出价策略
+func (h *BulkHandler) selectStrategies(ctx context.Context, ids []string, filter *BulkFilter) ([]bidding.BidStrategy, []BulkItemResult, error) {
+	if err := checkSelection(ids, filter); err != nil {
+		return nil, nil, err
+	}
+
+	var strategies []bidding.BidStrategy
+	var missing []BulkItemResult
+
+	if len(ids) > 0 {
+		for _, id := range dedupe(ids) {
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				missing = append(missing, BulkItemResult{ID: id, Error: "invalid strategy id"})
+				continue
+			}
+			strategy, err := h.strategies.GetBidStrategy(ctx, n)
+			if err != nil {
+				return nil, nil, err
+			}
+			if strategy == nil {
+				missing = append(missing, BulkItemResult{ID: id, Error: "strategy not found"})
+				continue
+			}
+			strategies = append(strategies, *strategy)
+		}
+		return strategies, missing, nil
+	}
+
+	for page := 1; ; page++ {
+		list, total, err := h.strategies.ListBidStrategies(ctx, bidding.BidStrategyFilter{
+			Page:     page,
+			PageSize: maxBulkItems,
+			BidType:  filter.BidType,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		strategies = append(strategies, list...)
+		if len(strategies) > maxBulkItems {
+			return nil, nil, ErrTooManyItems
+		}
+		if len(list) < maxBulkItems || int64(page*maxBulkItems) >= total {
+			break
+		}
+	}
+	return strategies, nil, nil
+}
+
+// abortSelection 返回查询对象失败的响应
+func (h *BulkHandler) abortSelection(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrEmptySelection), errors.Is(err, ErrTooManyItems):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error("查询批量操作对象失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// respond 汇总并返回批量操作结果
+func (h *BulkHandler) respond(c *gin.Context, batchID string, atomic bool, results []BulkItemResult) {
+	resp := BulkResponse{
+		BatchID: batchID,
+		Atomic:  atomic,
+		Total:   len(results),
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+
+	h.logger.Info("批量操作完成",
+		"batch_id", batchID,
+		"path", c.FullPath(),
+		"succeeded", resp.Succeeded,
+		"failed", resp.Failed)
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// nextStrategyStatus 根据状态操作计算出价策略的目标状态
+func nextStrategyStatus(action string, current int) (int, error) {
+	if current == bidding.StrategyStatusArchived {
+		return 0, campaign.ErrInvalidTransition
+	}
+
+	switch action {
+	case campaign.ActionPause:
+		if current != bidding.StrategyStatusEnabled {
+			return 0, campaign.ErrInvalidTransition
+		}
+		return bidding.StrategyStatusDisabled, nil
+	case campaign.ActionResume:
+		if current != bidding.StrategyStatusDisabled {
+			return 0, campaign.ErrInvalidTransition
+		}
+		return bidding.StrategyStatusEnabled, nil
+	case campaign.ActionArchive:
+		return bidding.StrategyStatusArchived, nil
+	default:
+		return 0, campaign.ErrInvalidAction
+	}
+}
+
+// checkSelection 校验批量操作对象的选择方式
+func checkSelection(ids []string, filter *BulkFilter) error {
+	if len(ids) == 0 && filter == nil {
+		return ErrEmptySelection
+	}
+	if len(ids) > maxBulkItems {
+		return ErrTooManyItems
+	}
+	return nil
+}
+
+// rollbackResults 事务回滚后，将已处理的对象标记为失败，未处理的对象补充回滚结果
+func rollbackResults(results []BulkItemResult, ids []string) []BulkItemResult {
+	seen := make(map[string]bool, len(results))
+	for i := range results {
+		seen[results[i].ID] = true
+		if results[i].Success {
+			results[i].Success = false
+			results[i].After = nil
+			results[i].Error = ErrRolledBack.Error()
+		}
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			results = append(results, BulkItemResult{ID: id, Error: ErrRolledBack.Error()})
+		}
+	}
+	return results
+}
+
+// campaignSnapshot 审计和结果中记录的广告计划字段
+func campaignSnapshot(model *models.Campaign) gin.H {
+	return gin.H{"status": model.Status, "budget": model.Budget}
+}
+
+// strategySnapshot 审计和结果中记录的出价策略字段
+func strategySnapshot(strategy *bidding.BidStrategy) gin.H {
+	return gin.H{"status": strategy.Status, "daily_budget": strategy.DailyBudget}
+}
+
+// campaignIDs 提取广告计划ID
+func campaignIDs(campaigns []models.Campaign) []string {
+	ids := make([]string, 0, len(campaigns))
+	for _, model := range campaigns {
+		ids = append(ids, model.ID)
+	}
+	return ids
+}
+
+// removeCampaign 从已变更列表中移除指定计划
+func removeCampaign(campaigns []models.Campaign, id string) []models.Campaign {
+	for i := range campaigns {
+		if campaigns[i].ID == id {
+			return append(campaigns[:i], campaigns[i+1:]...)
+		}
+	}
+	return campaigns
+}
+
+// dedupe 去除重复ID并保持原有顺序
+func dedupe(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// operatorOf 获取操作人，登录用户使用用户名，否则使用X-Operator，未携带时使用客户端IP
+func operatorOf(c *gin.Context) string {
+	if principal, ok := auth.PrincipalFrom(c); ok && principal.Method == auth.MethodSession {
+		return principal.Username
+	}
+	if operator := c.GetHeader("X-Operator"); operator != "" {
+		return operator
+	}
+	return c.ClientIP()
+}
+
+// newBatchID 生成批次ID
+func newBatchID() string {
+	return "bulk-" + id.New()
+}
@@ -2,6 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"time"
 
@@ -9,6 +11,8 @@ import (
 	"gorm.io/gorm"
 	"simple-dsp/internal/campaign"
 	"simple-dsp/internal/models"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
 	"simple-dsp/pkg/logger"
 )
 
@@ -34,10 +38,23 @@ func (h *CampaignHandler) RegisterRoutes(r *gin.Engine) {
 	{
 		g.POST("", h.CreateCampaign)
 		g.GET("", h.ListCampaigns)
+		g.GET("/export", h.ExportCampaigns)
 		g.GET("/:id", h.GetCampaign)
 		g.PUT("/:id", h.UpdateCampaign)
 		g.DELETE("/:id", h.DeleteCampaign)
 		g.PUT("/:id/tracking", h.UpdateTrackingConfig)
+		g.POST("/:id/duplicate", h.DuplicateCampaign)
+		g.POST("/:id/template", h.SaveAsTemplate)
+	}
+
+	t := r.Group("/api/v1/campaign-templates")
+	{
+		t.POST("", h.CreateTemplate)
+		t.GET("", h.ListTemplates)
+		t.GET("/:id", h.GetTemplate)
+		t.PUT("/:id", h.UpdateTemplate)
+		t.DELETE("/:id", h.DeleteTemplate)
+		t.POST("/:id/campaigns", h.CreateCampaignFromTemplate)
 	}
 }
 
@@ -73,16 +90,22 @@ func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
 	c.JSON(http.StatusCreated, config)
 }
 
-// ListCampaigns 列出广告计划
+// ListCampaigns 列出广告计划，支持分页、排序和过滤
 func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
-	var campaigns []models.Campaign
-	if err := h.db.Find(&campaigns).Error; err != nil {
+	query, err := listing.ParseQuery(c, campaignListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := queryPage(h.db.Model(&models.Campaign{}), query, campaignField)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	configs := make([]*campaign.Config, 0, len(campaigns))
-	for _, model := range campaigns {
+	configs := make([]*campaign.Config, 0, len(page.Items))
+	for _, model := range page.Items {
 		config, err := model.ToCampaignConfig()
 		if err != nil {
 			h.logger.Error("转换广告计划配置失败", "error", err)
@@ -91,7 +114,13 @@ func (h *CampaignHandler) ListCampaigns(c *gin.Context) {
 		configs = append(configs, config)
 	}
 
-	c.JSON(http.StatusOK, configs)
+	c.JSON(http.StatusOK, listing.Page[*campaign.Config]{
+		Items:      configs,
+		Total:      page.Total,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		NextCursor: page.NextCursor,
+	})
 }
 
 // GetCampaign 获取广告计划
@@ -200,3 +229,66 @@ func (h *CampaignHandler) UpdateTrackingConfig(c *gin.Context) {
 
 	c.JSON(http.StatusOK, trackingConfigs)
 }
+
+// DuplicateCampaignRequest 复制广告计划请求
+type DuplicateCampaignRequest struct {
+	CampaignID string `json:"campaign_id"` // 新计划ID，为空时自动生成
+	Name       string `json:"name"`        // 新计划名称，为空时在原名称后追加"副本"
+}
+
+// DuplicateCampaign 复制广告计划
+// 复制定向、跟踪、出价策略及预算设置，新计划为草稿状态
+func (h *CampaignHandler) DuplicateCampaign(c *gin.Context) {
+	sourceID := c.Param("id")
+	var req DuplicateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var source models.Campaign
+	if err := h.db.First(&source, "id = ?", sourceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+		return
+	}
+
+	sourceConfig, err := source.ToCampaignConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.CampaignID == "" {
+		req.CampaignID = id.New()
+	}
+	config := sourceConfig.Clone(req.CampaignID, req.Name)
+	h.createDraft(c, config)
+}
+
+// createDraft 保存草稿计划并返回
+func (h *CampaignHandler) createDraft(c *gin.Context, config *campaign.Config) {
+	if err := campaign.ValidateConfig(config); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	config.CreateTime = now
+	config.UpdateTime = now
+
+	var model models.Campaign
+	if err := model.FromCampaignConfig(config); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.Create(&model).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 更新配置管理器
+	h.configMgr.SetConfig(config)
+
+	c.JSON(http.StatusCreated, config)
+}
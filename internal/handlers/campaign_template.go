@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
+)
+
+// SaveAsTemplateRequest 将计划保存为模板的请求
+type SaveAsTemplateRequest struct {
+	Name string `json:"name" binding:"required"` // 模板名称
+}
+
+// TemplateCampaignRequest 根据模板创建计划的请求
+type TemplateCampaignRequest struct {
+	CampaignID   string    `json:"campaign_id"`                   // 新计划ID，为空时自动生成
+	Name         string    `json:"name" binding:"required"`       // 计划名称
+	AdvertiserID string    `json:"advertiser_id"`                 // 广告主ID，为空时使用模板的广告主
+	StartTime    time.Time `json:"start_time" binding:"required"` // 开始时间
+	EndTime      time.Time `json:"end_time" binding:"required"`   // 结束时间
+}
+
+// SaveAsTemplate 将广告计划保存为模板
+func (h *CampaignHandler) SaveAsTemplate(c *gin.Context) {
+	sourceID := c.Param("id")
+	var req SaveAsTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var source models.Campaign
+	if err := h.db.First(&source, "id = ?", sourceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "campaign not found"})
+		return
+	}
+
+	config, err := source.ToCampaignConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := config.ToTemplate(id.New(), req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.saveTemplate(c, template, http.StatusCreated)
+}
+
+// CreateTemplate 创建广告计划模板
+func (h *CampaignHandler) CreateTemplate(c *gin.Context) {
+	var template campaign.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template.ID = id.New()
+	h.saveTemplate(c, &template, http.StatusCreated)
+}
+
+// ListTemplates 列出广告计划模板，支持分页、排序和过滤
+// 通过advertiser_id参数指定广告主时同时返回通用模板
+func (h *CampaignHandler) ListTemplates(c *gin.Context) {
+	query, err := listing.ParseQuery(c, templateListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := h.db.Model(&models.CampaignTemplate{})
+	if advertiserID := c.Query("advertiser_id"); advertiserID != "" {
+		db = db.Where("advertiser_id = ? OR advertiser_id = ''", advertiserID)
+	}
+
+	page, err := queryPage(db, query, templateField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	templates := make([]*campaign.Template, 0, len(page.Items))
+	for _, record := range page.Items {
+		template, err := record.ToTemplate()
+		if err != nil {
+			h.logger.Error("转换广告计划模板失败", "template_id", record.ID, "error", err)
+			continue
+		}
+		templates = append(templates, template)
+	}
+
+	c.JSON(http.StatusOK, listing.Page[*campaign.Template]{
+		Items:      templates,
+		Total:      page.Total,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// GetTemplate 获取广告计划模板
+func (h *CampaignHandler) GetTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, template)
+}
+
+// UpdateTemplate 更新广告计划模板
+func (h *CampaignHandler) UpdateTemplate(c *gin.Context) {
+	existing, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+
+	var template campaign.Template
+	if err := c.ShouldBindJSON(&template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template.ID = existing.ID
+	template.CreateTime = existing.CreateTime
+	h.saveTemplate(c, &template, http.StatusOK)
+}
+
+// DeleteTemplate 删除广告计划模板
+func (h *CampaignHandler) DeleteTemplate(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.db.Delete(&models.CampaignTemplate{}, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// CreateCampaignFromTemplate 根据模板创建草稿计划
+func (h *CampaignHandler) CreateCampaignFromTemplate(c *gin.Context) {
+	template, ok := h.loadTemplate(c)
+	if !ok {
+		return
+	}
+
+	var req TemplateCampaignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !req.EndTime.After(req.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be after start_time"})
+		return
+	}
+
+	if req.CampaignID == "" {
+		req.CampaignID = id.New()
+	}
+	config := template.NewConfig(req.CampaignID, req.Name, req.AdvertiserID, req.StartTime, req.EndTime)
+	h.createDraft(c, config)
+}
+
+// loadTemplate 按路径参数加载模板，失败时已写入响应
+func (h *CampaignHandler) loadTemplate(c *gin.Context) (*campaign.Template, bool) {
+	id := c.Param("id")
+	var record models.CampaignTemplate
+	if err := h.db.First(&record, "id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "template not found"})
+		return nil, false
+	}
+
+	template, err := record.ToTemplate()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return template, true
+}
+
+// saveTemplate 校验并保存模板
+func (h *CampaignHandler) saveTemplate(c *gin.Context, template *campaign.Template, status int) {
+	if err := campaign.ValidateTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template.UpdateTime = time.Now()
+	if template.CreateTime.IsZero() {
+		template.CreateTime = template.UpdateTime
+	}
+
+	var record models.CampaignTemplate
+	if err := record.FromTemplate(template); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.Save(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(status, template)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/trash"
+	"simple-dsp/pkg/database"
+)
+
+// campaignTrash 广告计划回收站
+type campaignTrash struct {
+	db        *gorm.DB
+	configMgr *campaign.ConfigManager
+}
+
+// Trash 返回广告计划回收站
+func (h *CampaignHandler) Trash() trash.Store {
+	return &campaignTrash{db: h.db, configMgr: h.configMgr}
+}
+
+// ListDeleted 列出已删除的广告计划
+func (t *campaignTrash) ListDeleted(ctx context.Context) ([]trash.Item, error) {
+	var records []models.Campaign
+	if err := t.db.WithContext(ctx).Unscoped().
+		Select("id", "name", "deleted_at").
+		Where("deleted_at IS NOT NULL").
+		Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	items := make([]trash.Item, 0, len(records))
+	for _, record := range records {
+		items = append(items, trash.Item{ID: record.ID, Name: record.Name, DeleteTime: record.DeletedAt.Time})
+	}
+	return items, nil
+}
+
+// Restore 恢复已删除的广告计划，恢复后为暂停状态
+func (t *campaignTrash) Restore(ctx context.Context, id string) error {
+	var record models.Campaign
+	err := database.Transaction(ctx, t.db, func(tx *gorm.DB) error {
+		result := tx.Unscoped().Model(&models.Campaign{}).
+			Where("id = ? AND deleted_at IS NOT NULL", id).
+			Updates(map[string]interface{}{
+				"deleted_at":  nil,
+				"status":      campaign.StatusPaused,
+				"update_time": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return trash.ErrNotFound
+		}
+		return tx.First(&record, "id = ?", id).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	config, err := record.ToCampaignConfig()
+	if err != nil {
+		return err
+	}
+	t.configMgr.SetConfig(config)
+	return nil
+}
+
+// Purge 彻底删除在before之前删除的广告计划
+func (t *campaignTrash) Purge(ctx context.Context, before time.Time) (int, error) {
+	result := t.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Delete(&models.Campaign{})
+	return int(result.RowsAffected), result.Error
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import "errors"
+
+var (
+	// ErrEmptySelection 表示未指定批量操作的对象
+	ErrEmptySelection = errors.New("必须指定ids或filter")
+
+	// ErrTooManyItems 表示批量操作对象过多
+	ErrTooManyItems = errors.New("批量操作对象数量超过上限")
+
+	// ErrAtomicUnsupported 表示该资源不支持事务模式
+	ErrAtomicUnsupported = errors.New("该资源不支持事务模式")
+
+	// ErrRolledBack 表示事务已回滚
+	ErrRolledBack = errors.New("事务已回滚")
+
+	// ErrStrategyNotFound 表示出价策略不存在
+	ErrStrategyNotFound = errors.New("出价策略不存在")
+
+	// ErrStrategyArchived 表示出价策略已归档，不能修改
+	ErrStrategyArchived = errors.New("出价策略已归档")
+
+	// ErrPriceLocked 表示出价已锁定，修改出价前需要解锁
+	ErrPriceLocked = errors.New("出价已锁定")
+
+	// ErrCreativeAssigned 表示素材已关联到该策略
+	ErrCreativeAssigned = errors.New("素材已关联")
+
+	// ErrInvalidFilterValue 表示过滤条件的值无效
+	ErrInvalidFilterValue = errors.New("无效的过滤条件")
+
+	// ErrInvalidDateRange 表示无效的日期范围
+	ErrInvalidDateRange = errors.New("无效的日期范围")
+
+	// ErrCampaignNotFound 表示广告计划不存在，或不属于当前广告主
+	ErrCampaignNotFound = errors.New("广告计划不存在")
+
+	// ErrMissingAdID 表示未指定广告ID
+	ErrMissingAdID = errors.New("必须指定ad_id")
+
+	// ErrMissingCampaignID 表示未指定推广计划ID
+	ErrMissingCampaignID = errors.New("必须指定campaign_id")
+
+	// ErrInvalidTimeRange 表示无效的时间范围
+	ErrInvalidTimeRange = errors.New("无效的时间范围")
+)
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/export"
+)
+
+// exportBatchSize 导出时每批从数据库读取的记录数
+const exportBatchSize = 500
+
+// ExportCampaigns 导出广告计划列表，支持format=csv/xlsx及advertiser_id、status过滤
+func (h *CampaignHandler) ExportCampaigns(c *gin.Context) {
+	w, err := export.NewResponseWriter(c.Writer, "campaigns", c.DefaultQuery("format", export.FormatCSV))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.Campaign{})
+	if advertiserID := c.Query("advertiser_id"); advertiserID != "" {
+		query = query.Where("advertiser_id = ?", advertiserID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	w.WriteRow("ID", "名称", "广告主ID", "状态", "开始时间", "结束时间", "预算", "出价策略", "创建时间", "更新时间")
+
+	var batch []models.Campaign
+	err = query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		for _, model := range batch {
+			if err := w.WriteRow(model.ID, model.Name, model.AdvertiserID, model.Status, model.StartTime,
+				model.EndTime, model.Budget, model.BidStrategy, model.CreateTime, model.UpdateTime); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+
+	// 响应头已发送，中途出错只能记录日志
+	if err != nil {
+		h.logger.Error("导出广告计划失败", "error", err)
+	}
+	if err := w.Close(); err != nil {
+		h.logger.Error("完成广告计划导出失败", "error", err)
+	}
+}
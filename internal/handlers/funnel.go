@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/funnel"
+	"simple-dsp/pkg/logger"
+)
+
+// FunnelHandler 竞价漏斗报表处理器
+type FunnelHandler struct {
+	store  funnel.Store
+	logger *logger.Logger
+}
+
+// NewFunnelHandler 创建竞价漏斗报表处理器
+func NewFunnelHandler(store funnel.Store, logger *logger.Logger) *FunnelHandler {
+	return &FunnelHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *FunnelHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/api/v1/admin/stats/funnel", h.GetReport)
+}
+
+// GetReport 按天和广告汇总竞价漏斗，可用ad_id限定广告
+// 各阶段为到达该阶段的竞价数，合计中包含各阶段之间的差异，用于对账
+func (h *FunnelHandler) GetReport(c *gin.Context) {
+	startDate, endDate, err := parseStatsRange(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	adID := c.Query("ad_id")
+	reports, err := h.store.Report(c.Request.Context(), startDate, endDate, adID)
+	if err != nil {
+		h.logger.Error("查询竞价漏斗失败", "ad_id", adID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if reports == nil {
+		reports = []funnel.Report{}
+	}
+
+	var summary funnel.Report
+	for _, r := range reports {
+		summary.Add(r)
+	}
+	summary.Calculate()
+
+	c.JSON(http.StatusOK, gin.H{
+		"ad_id":      adID,
+		"start_date": startDate,
+		"end_date":   endDate,
+		"summary":    summary,
+		"items":      reports,
+	})
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/ledger"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/export"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+// ledgerEntryListSpec 账本流水列表允许的排序和过滤字段
+var ledgerEntryListSpec = listing.Spec{
+	Sortable:    []string{"create_time", "amount"},
+	Filterable:  []string{"advertiser_id", "type", "campaign_id", "ad_id"},
+	DefaultSort: "-create_time",
+}
+
+// ledgerEntryRequest 手工录入流水的请求，金额单位为元，退款金额填正数
+type ledgerEntryRequest struct {
+	AdvertiserID string  `json:"advertiser_id" binding:"required"`
+	Type         string  `json:"type" binding:"required"`
+	Amount       float64 `json:"amount"`
+	// IdempotencyKey 幂等键，也可通过Idempotency-Key请求头传入
+	IdempotencyKey string `json:"idempotency_key"`
+	CampaignID     string `json:"campaign_id"`
+	Reference      string `json:"reference"`
+	Description    string `json:"description"`
+}
+
+// LedgerHandler 计费账本处理器
+type LedgerHandler struct {
+	db     *gorm.DB
+	ledger *ledger.Ledger
+	logger *logger.Logger
+}
+
+// NewLedgerHandler 创建计费账本处理器
+func NewLedgerHandler(db *gorm.DB, ledger *ledger.Ledger, logger *logger.Logger) *LedgerHandler {
+	return &LedgerHandler{
+		db:     db,
+		ledger: ledger,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *LedgerHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/ledger")
+	{
+		g.POST("/entries", h.CreateEntry)
+		g.GET("/entries", h.ListEntries)
+		g.POST("/close", h.Close)
+		g.GET("/invoices/:advertiser_id", h.GetInvoice)
+		g.GET("/invoices/:advertiser_id/export", h.ExportInvoice)
+	}
+}
+
+// CreateEntry 手工录入退款或调整流水，相同幂等键重复提交时返回已有流水
+func (h *LedgerHandler) CreateEntry(c *gin.Context) {
+	var req ledgerEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = c.GetHeader("Idempotency-Key")
+	}
+
+	amount := int64(math.Round(req.Amount * 100))
+	switch req.Type {
+	case ledger.TypeRefund:
+		amount = -amount
+	case ledger.TypeAdjustment:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只能录入refund或adjustment流水，消耗由计费事件写入"})
+		return
+	}
+
+	entry, created, err := h.ledger.Record(c.Request.Context(), &models.LedgerEntry{
+		AdvertiserID:   req.AdvertiserID,
+		Type:           req.Type,
+		Amount:         amount,
+		IdempotencyKey: req.IdempotencyKey,
+		CampaignID:     req.CampaignID,
+		Reference:      req.Reference,
+		Description:    req.Description,
+		Operator:       operatorOf(c),
+	})
+	if err != nil {
+		c.JSON(ledgerErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if !created {
+		c.JSON(http.StatusOK, entry)
+		return
+	}
+
+	h.logger.Info("录入账本流水", "advertiser_id", entry.AdvertiserID, "type", entry.Type,
+		"amount", entry.Amount, "key", entry.IdempotencyKey, "operator", entry.Operator)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// ListEntries 列出流水，支持分页、排序和过滤
+func (h *LedgerHandler) ListEntries(c *gin.Context) {
+	query, err := listing.ParseQuery(c, ledgerEntryListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := queryPage(h.db.Model(&models.LedgerEntry{}), query, ledgerEntryField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// Close 结算到date（默认前一天）为止未结算的日期
+func (h *LedgerHandler) Close(c *gin.Context) {
+	date := time.Now().AddDate(0, 0, -1)
+	if value := c.Query("date"); value != "" {
+		parsed, err := time.ParseInLocation(ledger.DateLayout, value, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid date"})
+			return
+		}
+		date = parsed
+	}
+
+	closed, err := h.ledger.CloseThrough(c.Request.Context(), date)
+	if err != nil {
+		c.JSON(ledgerErrorStatus(err), gin.H{"error": err.Error(), "closed_days": closed})
+		return
+	}
+
+	h.logger.Info("手动结算账本", "date", date.Format(ledger.DateLayout), "closed_days", closed, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, gin.H{"closed_days": closed})
+}
+
+// GetInvoice 获取广告主在from到to（含）之间的账单，金额单位为分
+func (h *LedgerHandler) GetInvoice(c *gin.Context) {
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, invoice)
+}
+
+// ExportInvoice 导出账单明细，支持format=csv/xlsx，金额单位为元
+func (h *LedgerHandler) ExportInvoice(c *gin.Context) {
+	invoice, ok := h.loadInvoice(c)
+	if !ok {
+		return
+	}
+
+	w, err := export.NewResponseWriter(c.Writer, "invoice_"+invoice.AdvertiserID, c.DefaultQuery("format", export.FormatCSV))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rows := [][]interface{}{{"日期", "广告主ID", "期初", "消耗", "退款", "调整", "期末", "流水数"}}
+	for _, day := range invoice.Days {
+		rows = append(rows, []interface{}{day.Date.Format(ledger.DateLayout), day.AdvertiserID, yuan(day.Opening),
+			yuan(day.Spend), yuan(day.Refund), yuan(day.Adjustment), yuan(day.Closing), day.EntryCount})
+	}
+	rows = append(rows, []interface{}{"合计", invoice.AdvertiserID, yuan(invoice.Opening), yuan(invoice.Spend),
+		yuan(invoice.Refund), yuan(invoice.Adjustment), yuan(invoice.Closing), nil})
+
+	// 响应头已发送，中途出错只能记录日志
+	for _, row := range rows {
+		if err := w.WriteRow(row...); err != nil {
+			h.logger.Error("导出账单失败", "advertiser_id", invoice.AdvertiserID, "error", err)
+			break
+		}
+	}
+	if err := w.Close(); err != nil {
+		h.logger.Error("完成账单导出失败", "advertiser_id", invoice.AdvertiserID, "error", err)
+	}
+}
+
+// loadInvoice 按路径和查询参数生成账单，失败时已写入响应
+func (h *LedgerHandler) loadInvoice(c *gin.Context) (*ledger.Invoice, bool) {
+	from, errFrom := time.ParseInLocation(ledger.DateLayout, c.Query("from"), time.Local)
+	to, errTo := time.ParseInLocation(ledger.DateLayout, c.Query("to"), time.Local)
+	if errFrom != nil || errTo != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required in YYYY-MM-DD format"})
+		return nil, false
+	}
+
+	invoice, err := h.ledger.Invoice(c.Request.Context(), c.Param("advertiser_id"), from, to)
+	if err != nil {
+		c.JSON(ledgerErrorStatus(err), gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return invoice, true
+}
+
+// ledgerErrorStatus 账本错误对应的HTTP状态码
+func ledgerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ledger.ErrIdempotencyConflict), errors.Is(err, ledger.ErrPeriodNotClosed):
+		return http.StatusConflict
+	case errors.Is(err, ledger.ErrAdvertiserRequired), errors.Is(err, ledger.ErrKeyRequired),
+		errors.Is(err, ledger.ErrUnknownType), errors.Is(err, ledger.ErrInvalidAmount),
+		errors.Is(err, ledger.ErrDayNotOver), errors.Is(err, ledger.ErrInvalidPeriod):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// yuan 将分转换为元
+func yuan(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+// ledgerEntryField 读取流水字段
+func ledgerEntryField(m models.LedgerEntry, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "create_time":
+		return m.CreateTime
+	case "amount":
+		return m.Amount
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/listing"
+)
+
+// campaignListSpec 广告计划列表允许的排序和过滤字段，字段名即列名
+var campaignListSpec = listing.Spec{
+	Sortable:    []string{"name", "status", "budget", "start_time", "end_time", "create_time", "update_time"},
+	Filterable:  []string{"advertiser_id", "status", "bid_strategy"},
+	DefaultSort: "-create_time",
+}
+
+// portalCampaignListSpec 广告主自助接口的广告计划列表，广告主由租户决定，不能按广告主过滤
+var portalCampaignListSpec = listing.Spec{
+	Sortable:    []string{"name", "status", "budget", "start_time", "end_time", "create_time", "update_time"},
+	Filterable:  []string{"status", "bid_strategy"},
+	DefaultSort: "-create_time",
+}
+
+// templateListSpec 广告计划模板列表允许的排序和过滤字段
+var templateListSpec = listing.Spec{
+	Sortable:    []string{"name", "budget", "create_time", "update_time"},
+	Filterable:  []string{"advertiser_id", "bid_strategy"},
+	DefaultSort: "name",
+}
+
+// queryPage 在数据库中执行listing查询，db需已指定Model
+// 排序和过滤字段已由listing.Spec校验，可直接作为列名使用
+func queryPage[T any](db *gorm.DB, q listing.Query, field listing.Accessor[T]) (listing.Page[T], error) {
+	for column, value := range q.Filters {
+		db = db.Where(column+" = ?", value)
+	}
+
+	page := listing.Page[T]{PageSize: q.PageSize}
+	if err := db.Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	column, direction := q.SortField, "ASC"
+	if q.Desc {
+		direction = "DESC"
+	}
+	if q.Cursor != nil {
+		op := ">"
+		if q.Desc {
+			op = "<"
+		}
+		db = db.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id > ?))", column, op, column),
+			q.Cursor.Value, q.Cursor.Value, q.Cursor.ID)
+	} else {
+		db = db.Offset(q.Offset())
+		page.Page = q.Page
+	}
+
+	// 多取一条判断是否还有下一页
+	var items []T
+	err := db.Order(column + " " + direction).Order("id ASC").Limit(q.PageSize + 1).Find(&items).Error
+	if err != nil {
+		return page, err
+	}
+
+	if len(items) > q.PageSize {
+		items = items[:q.PageSize]
+		last := items[len(items)-1]
+		page.NextCursor = listing.EncodeCursor(listing.Cursor{
+			Value: listing.FormatValue(field(last, column)),
+			ID:    listing.FormatValue(field(last, "id")),
+		})
+	}
+	page.Items = items
+	return page, nil
+}
+
+// campaignField 读取广告计划字段
+func campaignField(m models.Campaign, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "name":
+		return m.Name
+	case "status":
+		return m.Status
+	case "budget":
+		return m.Budget
+	case "start_time":
+		return m.StartTime
+	case "end_time":
+		return m.EndTime
+	case "create_time":
+		return m.CreateTime
+	case "update_time":
+		return m.UpdateTime
+	}
+	return nil
+}
+
+// templateField 读取广告计划模板字段
+func templateField(t models.CampaignTemplate, field string) interface{} {
+	switch field {
+	case "id":
+		return t.ID
+	case "name":
+		return t.Name
+	case "budget":
+		return t.Budget
+	case "create_time":
+		return t.CreateTime
+	case "update_time":
+		return t.UpdateTime
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/floor"
+	"simple-dsp/internal/placement"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// defaultPlacementLimit、maxPlacementLimit 供应路径表现默认和最多返回的条数
+	defaultPlacementLimit = 100
+	maxPlacementLimit     = 1000
+)
+
+// PlacementHandler 供应路径表现查询处理器
+type PlacementHandler struct {
+	store  *placement.Store
+	logger *logger.Logger
+}
+
+// NewPlacementHandler 创建供应路径表现查询处理器
+func NewPlacementHandler(store *placement.Store, logger *logger.Logger) *PlacementHandler {
+	return &PlacementHandler{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *PlacementHandler) RegisterRoutes(r *gin.Engine) {
+	r.GET("/api/v1/admin/stats/placements", h.GetPlacements)
+}
+
+// GetPlacements 查询最近一次汇总的供应路径表现，用于决定屏蔽哪些广告位
+// 支持按exchange、placement、size和min_impressions过滤，sort为impressions、bids、win_rate、ctr或cvr，默认按展示数倒序
+// ctr_index为供应路径CTR相对整体CTR的比值，尚未汇总时返回空列表
+func (h *PlacementHandler) GetPlacements(c *gin.Context) {
+	filter := placement.Filter{
+		Exchange:  c.Query("exchange"),
+		Placement: c.Query("placement"),
+		Size:      c.Query("size"),
+		Sort:      c.Query("sort"),
+	}
+	if filter.Size != "" {
+		if _, _, err := floor.ParseSize(filter.Size); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if v := c.Query("min_impressions"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的min_impressions参数"})
+			return
+		}
+		filter.MinImpressions = n
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的order参数，可选asc、desc"})
+		return
+	}
+
+	limit := defaultPlacementLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		limit = min(n, maxPlacementLimit)
+	}
+
+	meta, items, err := h.store.Query(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, placement.ErrInvalidSort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("查询供应路径表现失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询供应路径表现失败"})
+		return
+	}
+	if meta == nil {
+		c.JSON(http.StatusOK, gin.H{"total": 0, "items": []placement.Stats{}})
+		return
+	}
+
+	total := len(items)
+	if total > limit {
+		items = items[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"update_time": meta.UpdateTime,
+		"since":       meta.Since,
+		"overall":     meta.Overall,
+		"total":       total,
+		"items":       items,
+	})
+}
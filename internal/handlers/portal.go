@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/auth"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+// PortalHandler 广告主自助接口处理器，只读，所有查询都限定在当前租户的广告主内
+// 广告计划通过advertiser_id归属广告主，出价策略通过campaign_id归属广告计划，素材和统计通过出价策略归属
+type PortalHandler struct {
+	db     *gorm.DB
+	logger *logger.Logger
+}
+
+// NewPortalHandler 创建广告主自助接口处理器
+func NewPortalHandler(db *gorm.DB, logger *logger.Logger) *PortalHandler {
+	return &PortalHandler{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由，需要在认证中间件之后注册
+func (h *PortalHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/portal", auth.Tenancy())
+	{
+		g.GET("/campaigns", h.ListCampaigns)
+		g.GET("/campaigns/:id", h.GetCampaign)
+		g.GET("/campaigns/:id/strategies", h.ListStrategies)
+		g.GET("/creatives", h.ListCreatives)
+		g.GET("/reports", h.GetReport)
+	}
+}
+
+// ListCampaigns 列出广告主的广告计划，支持分页、排序和过滤
+func (h *PortalHandler) ListCampaigns(c *gin.Context) {
+	query, err := listing.ParseQuery(c, portalCampaignListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := h.query(c, "portal.list_campaigns").Model(&models.Campaign{}).Where("advertiser_id = ?", auth.TenantFrom(c))
+	page, err := queryPage(db, query, campaignField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	configs := make([]*campaign.Config, 0, len(page.Items))
+	for _, model := range page.Items {
+		config, err := model.ToCampaignConfig()
+		if err != nil {
+			h.logger.Error("转换广告计划配置失败", "campaign_id", model.ID, "error", err)
+			continue
+		}
+		configs = append(configs, config)
+	}
+
+	c.JSON(http.StatusOK, listing.Page[*campaign.Config]{
+		Items:      configs,
+		Total:      page.Total,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// GetCampaign 获取广告主的广告计划，不属于该广告主时返回404
+func (h *PortalHandler) GetCampaign(c *gin.Context) {
+	model, ok := h.loadCampaign(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	config, err := model.ToCampaignConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+// ListStrategies 列出广告计划下的出价策略
+func (h *PortalHandler) ListStrategies(c *gin.Context) {
+	model, ok := h.loadCampaign(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var strategies []models.BidStrategy
+	err := h.query(c, "portal.list_strategies").Where("campaign_id = ?", model.ID).Order("id").Find(&strategies).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if strategies == nil {
+		strategies = []models.BidStrategy{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": strategies})
+}
+
+// ListCreatives 列出广告主的出价策略关联的素材
+func (h *PortalHandler) ListCreatives(c *gin.Context) {
+	var creatives []bidding.BidStrategyCreative
+	err := h.query(c, "portal.list_creatives").
+		Where("strategy_id IN (?)", h.tenantStrategies(c, "")).
+		Order("strategy_id, creative_id").
+		Find(&creatives).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if creatives == nil {
+		creatives = []bidding.BidStrategyCreative{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": creatives})
+}
+
+// GetReport 按天和出价策略汇总广告主的投放数据，可用campaign_id限定广告计划
+func (h *PortalHandler) GetReport(c *gin.Context) {
+	startDate, endDate, err := parseStatsRange(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	campaignID := c.Query("campaign_id")
+	if campaignID != "" {
+		if _, ok := h.loadCampaign(c, campaignID); !ok {
+			return
+		}
+	}
+
+	var stats []bidding.BidStrategyStats
+	err = h.db.WithContext(database.ReadOnly(database.WithQueryName(c.Request.Context(), "portal.get_report"))).
+		Table("bid_strategy_stats").
+		Select("strategy_id, creative_id, SUM(impressions) AS impressions, SUM(clicks) AS clicks, SUM(spend) AS spend, date").
+		Where("strategy_id IN (?) AND date BETWEEN ? AND ?", h.tenantStrategies(c, campaignID), startDate, endDate).
+		Group("strategy_id, creative_id, date").
+		Order("date DESC").
+		Find(&stats).Error
+	if err != nil {
+		h.logger.Error("查询广告主报表失败", "advertiser_id", auth.TenantFrom(c), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if stats == nil {
+		stats = []bidding.BidStrategyStats{}
+	}
+
+	var summary StrategyStatsSummary
+	for _, s := range stats {
+		summary.Impressions += s.Impressions
+		summary.Clicks += s.Clicks
+		summary.Spend += s.Spend
+	}
+	if summary.Impressions > 0 {
+		summary.CTR = float64(summary.Clicks) / float64(summary.Impressions)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"advertiser_id": auth.TenantFrom(c),
+		"campaign_id":   campaignID,
+		"start_date":    startDate,
+		"end_date":      endDate,
+		"summary":       summary,
+		"items":         stats,
+	})
+}
+
+// loadCampaign 读取属于当前广告主的广告计划，失败时写入响应并返回false
+// 其他广告主的计划与不存在的计划同样返回404，不泄露计划是否存在
+func (h *PortalHandler) loadCampaign(c *gin.Context, id string) (*models.Campaign, bool) {
+	var model models.Campaign
+	err := h.query(c, "portal.get_campaign").
+		Where("id = ? AND advertiser_id = ?", id, auth.TenantFrom(c)).
+		First(&model).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrCampaignNotFound.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &model, true
+}
+
+// tenantStrategies 返回当前广告主的出价策略ID子查询，campaignID非空时只包含该广告计划的策略
+func (h *PortalHandler) tenantStrategies(c *gin.Context, campaignID string) *gorm.DB {
+	sub := h.db.Model(&models.BidStrategy{}).
+		Select("bid_strategies.id").
+		Joins("JOIN campaigns ON campaigns.id = bid_strategies.campaign_id").
+		Where("campaigns.advertiser_id = ? AND campaigns.deleted_at IS NULL", auth.TenantFrom(c))
+	if campaignID != "" {
+		sub = sub.Where("bid_strategies.campaign_id = ?", campaignID)
+	}
+	return sub
+}
+
+// query 返回带请求上下文和语句名称的查询
+func (h *PortalHandler) query(c *gin.Context, name string) *gorm.DB {
+	return h.db.WithContext(database.WithQueryName(c.Request.Context(), name))
+}
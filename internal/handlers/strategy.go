@@ -0,0 +1,516 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/campaign"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// defaultStatsDays 未指定日期范围时统计最近的天数
+	defaultStatsDays = 7
+	// maxStatsDays 统计日期范围的最大天数
+	maxStatsDays = 92
+)
+
+// 策略变更通知的动作
+const (
+	strategyActionCreate = "create"
+	strategyActionUpdate = "update"
+	strategyActionDelete = "delete"
+	strategyActionStatus = "status"
+	strategyActionAssign = "creatives"
+)
+
+// StrategyRequest 创建或修改出价策略的请求
+type StrategyRequest struct {
+	Name          string  `json:"name"`
+	BidType       string  `json:"bid_type"`
+	Price         float64 `json:"price"`
+	DailyBudget   int     `json:"daily_budget"`
+	IsPriceLocked bool    `json:"is_price_locked"`
+	Priority      int     `json:"priority"`
+	Weight        float64 `json:"weight"`
+	Category      string  `json:"category"`
+	CampaignID    string  `json:"campaign_id"`
+	Participation float64 `json:"participation_rate"`
+	Dayparting    string  `json:"dayparting"`
+}
+
+// apply 将请求字段写入策略
+func (r *StrategyRequest) apply(strategy *bidding.BidStrategy) {
+	strategy.Name = r.Name
+	strategy.BidType = r.BidType
+	strategy.Price = r.Price
+	strategy.DailyBudget = r.DailyBudget
+	strategy.IsPriceLocked = r.IsPriceLocked
+	strategy.Priority = r.Priority
+	strategy.Weight = r.Weight
+	strategy.Category = r.Category
+	strategy.CampaignID = r.CampaignID
+	strategy.Participation = r.Participation
+	strategy.Dayparting = r.Dayparting
+}
+
+// StrategyStatusRequest 出价策略状态变更请求
+type StrategyStatusRequest struct {
+	Action string `json:"action" binding:"required"` // pause/resume/archive
+}
+
+// StrategyCreativeRequest 关联素材请求
+type StrategyCreativeRequest struct {
+	CreativeID int64 `json:"creative_id" binding:"required"`
+}
+
+// StrategyStatsSummary 出价策略在日期范围内的汇总
+type StrategyStatsSummary struct {
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	Spend       float64 `json:"spend"`
+	CTR         float64 `json:"ctr"`
+}
+
+// StrategyHandler 出价策略处理器
+// 修改策略后发布策略变更通知，竞价节点随之刷新策略缓存
+type StrategyHandler struct {
+	strategies bidding.Repository
+	redis      *redis.Client
+	minPrice   float64
+	maxPrice   float64
+	logger     *logger.Logger
+}
+
+// NewStrategyHandler 创建出价策略处理器
+// 出价按cfg的MinBidPrice和MaxBidPrice校验；redisClient为nil时不发布策略变更通知
+func NewStrategyHandler(strategies bidding.Repository, redisClient *redis.Client, cfg config.BiddingConfig, logger *logger.Logger) *StrategyHandler {
+	return &StrategyHandler{
+		strategies: strategies,
+		redis:      redisClient,
+		minPrice:   cfg.MinBidPrice,
+		maxPrice:   cfg.MaxBidPrice,
+		logger:     logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *StrategyHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/strategies")
+	g.Use(h.requireRepository)
+	{
+		g.GET("", h.ListStrategies)
+		g.POST("", h.CreateStrategy)
+		g.GET("/:id", h.GetStrategy)
+		g.PUT("/:id", h.UpdateStrategy)
+		g.DELETE("/:id", h.DeleteStrategy)
+		g.POST("/:id/status", h.UpdateStatus)
+		g.GET("/:id/creatives", h.ListCreatives)
+		g.POST("/:id/creatives", h.AddCreative)
+		g.DELETE("/:id/creatives/:creative_id", h.RemoveCreative)
+		g.GET("/:id/stats", h.GetStats)
+	}
+}
+
+// requireRepository 未配置策略存储时返回503
+func (h *StrategyHandler) requireRepository(c *gin.Context) {
+	if h.strategies == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": bidding.ErrRepositoryUnavailable.Error()})
+		return
+	}
+	c.Next()
+}
+
+// ListStrategies 分页查询出价策略
+// 支持bid_type、status、campaign_id、min_price、max_price过滤
+func (h *StrategyHandler) ListStrategies(c *gin.Context) {
+	filter, err := parseStrategyFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategies, total, err := h.strategies.ListBidStrategies(c.Request.Context(), filter)
+	if err != nil {
+		h.logger.Error("查询出价策略失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if strategies == nil {
+		strategies = []bidding.BidStrategy{}
+	}
+
+	c.JSON(http.StatusOK, listing.Page[bidding.BidStrategy]{
+		Items:    strategies,
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	})
+}
+
+// GetStrategy 获取出价策略
+func (h *StrategyHandler) GetStrategy(c *gin.Context) {
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, strategy)
+}
+
+// CreateStrategy 创建出价策略，新策略为启用状态
+func (h *StrategyHandler) CreateStrategy(c *gin.Context) {
+	var req StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy := bidding.BidStrategy{Status: bidding.StrategyStatusEnabled}
+	req.apply(&strategy)
+	if err := bidding.ValidateStrategy(&strategy, h.minPrice, h.maxPrice); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.strategies.CreateBidStrategy(ctx, &strategy); err != nil {
+		h.logger.Error("创建出价策略失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("创建出价策略", "strategy_id", strategy.ID, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionCreate)
+	c.JSON(http.StatusCreated, strategy)
+}
+
+// UpdateStrategy 修改出价策略
+// 状态通过状态接口修改；出价已锁定时不能修改出价
+func (h *StrategyHandler) UpdateStrategy(c *gin.Context) {
+	var req StrategyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+	if strategy.Status == bidding.StrategyStatusArchived {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrStrategyArchived.Error()})
+		return
+	}
+
+	// 锁定的出价只能在同一请求中解锁后修改
+	if strategy.IsPriceLocked && req.IsPriceLocked && req.Price != strategy.Price {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrPriceLocked.Error()})
+		return
+	}
+	req.apply(strategy)
+	if err := bidding.ValidateStrategy(strategy, h.minPrice, h.maxPrice); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.strategies.UpdateBidStrategy(c.Request.Context(), strategy); err != nil {
+		h.logger.Error("修改出价策略失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("修改出价策略", "strategy_id", strategy.ID, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionUpdate)
+	c.JSON(http.StatusOK, strategy)
+}
+
+// DeleteStrategy 删除出价策略及其素材关联
+func (h *StrategyHandler) DeleteStrategy(c *gin.Context) {
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	if err := h.strategies.DeleteBidStrategy(c.Request.Context(), id); err != nil {
+		h.logger.Error("删除出价策略失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("删除出价策略", "strategy_id", strategy.ID, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionDelete)
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// UpdateStatus 暂停、恢复或归档出价策略，状态流转规则与批量操作一致
+func (h *StrategyHandler) UpdateStatus(c *gin.Context) {
+	var req StrategyStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	next, err := nextStrategyStatus(req.Action, strategy.Status)
+	switch {
+	case errors.Is(err, campaign.ErrInvalidAction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	if err := h.strategies.UpdateBidStrategyStatus(c.Request.Context(), id, next); err != nil {
+		h.logger.Error("修改出价策略状态失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	strategy.Status = next
+
+	h.logger.Info("修改出价策略状态", "strategy_id", strategy.ID, "action", req.Action, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionStatus)
+	c.JSON(http.StatusOK, strategy)
+}
+
+// ListCreatives 查询策略关联的素材
+func (h *StrategyHandler) ListCreatives(c *gin.Context) {
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	creatives, err := h.strategies.ListCreatives(c.Request.Context(), strategy.ID)
+	if err != nil {
+		h.logger.Error("查询策略素材失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if creatives == nil {
+		creatives = []bidding.BidStrategyCreative{}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": creatives})
+}
+
+// AddCreative 为策略关联素材，已关联的素材返回409
+func (h *StrategyHandler) AddCreative(c *gin.Context) {
+	var req StrategyCreativeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	creatives, err := h.strategies.ListCreatives(ctx, strategy.ID)
+	if err != nil {
+		h.logger.Error("查询策略素材失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for _, creative := range creatives {
+		if creative.CreativeID == req.CreativeID {
+			c.JSON(http.StatusConflict, gin.H{"error": ErrCreativeAssigned.Error()})
+			return
+		}
+	}
+
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	if err := h.strategies.AddCreative(ctx, id, req.CreativeID); err != nil {
+		h.logger.Error("关联素材失败", "strategy_id", strategy.ID, "creative_id", req.CreativeID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("关联素材", "strategy_id", strategy.ID, "creative_id", req.CreativeID, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionAssign)
+	c.JSON(http.StatusCreated, gin.H{"strategy_id": strategy.ID, "creative_id": req.CreativeID})
+}
+
+// RemoveCreative 移除策略关联的素材
+func (h *StrategyHandler) RemoveCreative(c *gin.Context) {
+	creativeID, err := strconv.ParseInt(c.Param("creative_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid creative id"})
+		return
+	}
+
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	if err := h.strategies.RemoveCreative(c.Request.Context(), id, creativeID); err != nil {
+		h.logger.Error("移除素材失败", "strategy_id", strategy.ID, "creative_id", creativeID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("移除素材", "strategy_id", strategy.ID, "creative_id", creativeID, "operator", operatorOf(c))
+	h.publish(c, strategy.ID, strategyActionAssign)
+	c.JSON(http.StatusOK, gin.H{"message": "已移除"})
+}
+
+// GetStats 查询策略按天和素材的统计数据及汇总
+// start_date和end_date格式为2006-01-02，默认最近7天
+func (h *StrategyHandler) GetStats(c *gin.Context) {
+	startDate, endDate, err := parseStatsRange(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	strategy, ok := h.loadStrategy(c)
+	if !ok {
+		return
+	}
+
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	stats, err := h.strategies.GetStrategyStats(c.Request.Context(), id, startDate, endDate)
+	if err != nil {
+		h.logger.Error("查询策略统计失败", "strategy_id", strategy.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if stats == nil {
+		stats = []bidding.BidStrategyStats{}
+	}
+
+	var summary StrategyStatsSummary
+	for _, s := range stats {
+		summary.Impressions += s.Impressions
+		summary.Clicks += s.Clicks
+		summary.Spend += s.Spend
+	}
+	if summary.Impressions > 0 {
+		summary.CTR = float64(summary.Clicks) / float64(summary.Impressions)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"strategy_id": strategy.ID,
+		"start_date":  startDate,
+		"end_date":    endDate,
+		"summary":     summary,
+		"items":       stats,
+	})
+}
+
+// loadStrategy 按路径参数读取策略，失败时写入响应并返回false
+func (h *StrategyHandler) loadStrategy(c *gin.Context) (*bidding.BidStrategy, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid strategy id"})
+		return nil, false
+	}
+
+	strategy, err := h.strategies.GetBidStrategy(c.Request.Context(), id)
+	if err != nil {
+		h.logger.Error("查询出价策略失败", "strategy_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if strategy == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrStrategyNotFound.Error()})
+		return nil, false
+	}
+	return strategy, true
+}
+
+// publish 发布策略变更通知，失败只记录日志，竞价节点在下一次定时刷新时更新
+func (h *StrategyHandler) publish(c *gin.Context, strategyID, action string) {
+	if h.redis == nil {
+		return
+	}
+	if err := bidding.PublishStrategyChange(c.Request.Context(), h.redis, strategyID, action); err != nil {
+		h.logger.Warn("发布策略变更通知失败", "strategy_id", strategyID, "action", action, "error", err)
+	}
+}
+
+// parseStrategyFilter 解析列表查询参数
+func parseStrategyFilter(c *gin.Context) (bidding.BidStrategyFilter, error) {
+	filter := bidding.BidStrategyFilter{
+		Page:       1,
+		PageSize:   listing.DefaultPageSize,
+		BidType:    c.Query("bid_type"),
+		CampaignID: c.Query("campaign_id"),
+	}
+
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return filter, listing.ErrInvalidPage
+		}
+		filter.Page = page
+	}
+	if v := c.Query("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 || size > listing.MaxPageSize {
+			return filter, listing.ErrInvalidPage
+		}
+		filter.PageSize = size
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, ErrInvalidFilterValue
+		}
+		filter.Status = &status
+	}
+	for name, target := range map[string]**float64{"min_price": &filter.MinPrice, "max_price": &filter.MaxPrice} {
+		if v := c.Query(name); v != "" {
+			price, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return filter, ErrInvalidFilterValue
+			}
+			*target = &price
+		}
+	}
+	return filter, nil
+}
+
+// parseStatsRange 解析统计的日期范围
+func parseStatsRange(c *gin.Context, now time.Time) (string, string, error) {
+	const layout = "2006-01-02"
+
+	end := now
+	if v := c.Query("end_date"); v != "" {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return "", "", ErrInvalidDateRange
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -(defaultStatsDays - 1))
+	if v := c.Query("start_date"); v != "" {
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return "", "", ErrInvalidDateRange
+		}
+		start = t
+	}
+
+	startDate, endDate := start.Format(layout), end.Format(layout)
+	if startDate > endDate || end.Sub(start) > maxStatsDays*24*time.Hour {
+		return "", "", ErrInvalidDateRange
+	}
+	return startDate, endDate, nil
+}
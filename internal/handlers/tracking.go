@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/tracking"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// defaultReceiptRange 未指定开始时间时查询的时长
+	defaultReceiptRange = 24 * time.Hour
+	// maxReceiptRange 一次查询的最长时间范围
+	maxReceiptRange = 7 * 24 * time.Hour
+)
+
+// TrackingHandler 跟踪投递管理处理器
+type TrackingHandler struct {
+	service *tracking.Service
+	logger  *logger.Logger
+}
+
+// NewTrackingHandler 创建跟踪投递管理处理器
+func NewTrackingHandler(service *tracking.Service, logger *logger.Logger) *TrackingHandler {
+	return &TrackingHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *TrackingHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/tracking/breakers")
+	{
+		g.GET("", h.ListBreakers)
+		g.POST("/:campaign_id/:event_type/reset", h.ResetBreaker)
+	}
+	r.GET("/api/v1/tracking/receipts", h.ListReceipts)
+}
+
+// ListBreakers 列出有失败记录的熔断器
+func (h *TrackingHandler) ListBreakers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"breakers": h.service.Breakers()})
+}
+
+// ResetBreaker 手动恢复熔断器，用于广告主修复跟踪地址后立即恢复投递
+func (h *TrackingHandler) ResetBreaker(c *gin.Context) {
+	campaignID := c.Param("campaign_id")
+	eventType := campaign.TrackingType(c.Param("event_type"))
+
+	if err := h.service.ResetBreaker(campaignID, eventType); err != nil {
+		if errors.Is(err, tracking.ErrBreakerNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("手动恢复跟踪熔断器", "campaign_id", campaignID, "event_type", eventType, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复"})
+}
+
+// ListReceipts 按推广计划和时间范围查询投递回执，用于排查广告主收不到回传的原因
+// start和end为RFC3339时间，默认查询最近24小时，最长7天；可用event_type和click_id进一步过滤
+func (h *TrackingHandler) ListReceipts(c *gin.Context) {
+	campaignID := c.Query("campaign_id")
+	if campaignID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrMissingCampaignID.Error()})
+		return
+	}
+	start, end, err := parseReceiptRange(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	receipts, err := h.service.Receipts(c.Request.Context(), tracking.ReceiptQuery{
+		CampaignID: campaignID,
+		EventType:  c.Query("event_type"),
+		ClickID:    c.Query("click_id"),
+		Start:      start,
+		End:        end,
+		Limit:      limit,
+	})
+	if err != nil {
+		if errors.Is(err, tracking.ErrReceiptsDisabled) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		h.logger.Error("查询跟踪投递回执失败", "campaign_id", campaignID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if receipts == nil {
+		receipts = []*models.TrackingReceipt{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"campaign_id": campaignID,
+		"start":       start,
+		"end":         end,
+		"items":       receipts,
+	})
+}
+
+// parseReceiptRange 解析回执查询的时间范围
+func parseReceiptRange(c *gin.Context, now time.Time) (time.Time, time.Time, error) {
+	end := now
+	if v := c.Query("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidTimeRange
+		}
+		end = t
+	}
+	start := end.Add(-defaultReceiptRange)
+	if v := c.Query("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return time.Time{}, time.Time{}, ErrInvalidTimeRange
+		}
+		start = t
+	}
+	if !start.Before(end) || end.Sub(start) > maxReceiptRange {
+		return time.Time{}, time.Time{}, ErrInvalidTimeRange
+	}
+	return start, end, nil
+}
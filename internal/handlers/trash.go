@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/trash"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+// trashListSpec 回收站列表允许的排序和过滤字段
+var trashListSpec = listing.Spec{
+	Sortable:    []string{"name", "delete_time"},
+	DefaultSort: "-delete_time",
+}
+
+// TrashHandler 回收站处理器
+type TrashHandler struct {
+	purger *trash.Purger
+	logger *logger.Logger
+}
+
+// NewTrashHandler 创建回收站处理器
+func NewTrashHandler(purger *trash.Purger, logger *logger.Logger) *TrashHandler {
+	return &TrashHandler{
+		purger: purger,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+// resource为ads、creatives或campaigns
+func (h *TrashHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/trash")
+	{
+		g.GET("/:resource", h.ListDeleted)
+		g.POST("/:resource/:id/restore", h.Restore)
+		g.DELETE("/:resource", h.Purge)
+	}
+}
+
+// ListDeleted 列出回收站中的资源，支持分页和排序
+func (h *TrashHandler) ListDeleted(c *gin.Context) {
+	query, err := listing.ParseQuery(c, trashListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, err := h.purger.ListDeleted(c.Request.Context(), c.Param("resource"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, listing.Apply(items, query, trash.ItemField))
+}
+
+// Restore 恢复回收站中的资源
+func (h *TrashHandler) Restore(c *gin.Context) {
+	store, err := h.purger.Store(c.Param("resource"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	id := c.Param("id")
+	if err := store.Restore(c.Request.Context(), id); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.logger.Info("恢复已删除资源", "resource", c.Param("resource"), "id", id, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复"})
+}
+
+// Purge 彻底删除回收站中的资源
+// older_than_days指定只清理删除超过N天的资源，默认使用配置的保留天数，0表示清空回收站
+func (h *TrashHandler) Purge(c *gin.Context) {
+	store, err := h.purger.Store(c.Param("resource"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	olderThan := h.purger.Retention()
+	if v := c.Query("older_than_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "older_than_days必须为非负整数"})
+			return
+		}
+		olderThan = time.Duration(days) * 24 * time.Hour
+	}
+
+	purged, err := store.Purge(c.Request.Context(), time.Now().Add(-olderThan))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	h.logger.Info("清理回收站", "resource", c.Param("resource"), "count", purged, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// writeError 按错误类型返回响应
+func (h *TrashHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, trash.ErrUnknownResource):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, trash.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error("回收站操作失败", "resource", c.Param("resource"), "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/velocity"
+	"simple-dsp/pkg/logger"
+)
+
+// VelocityHandler 消耗速度保护管理处理器
+type VelocityHandler struct {
+	guard  *velocity.Guard
+	logger *logger.Logger
+}
+
+// NewVelocityHandler 创建消耗速度保护管理处理器
+func NewVelocityHandler(guard *velocity.Guard, logger *logger.Logger) *VelocityHandler {
+	return &VelocityHandler{
+		guard:  guard,
+		logger: logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *VelocityHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/velocity/paused")
+	{
+		g.GET("", h.ListPaused)
+		g.POST("/:strategy_id/resume", h.Resume)
+	}
+}
+
+// ListPaused 列出因消耗速度异常被自动暂停的出价策略
+func (h *VelocityHandler) ListPaused(c *gin.Context) {
+	trips, err := h.guard.Paused(c.Request.Context())
+	if err != nil {
+		h.logger.Error("查询自动暂停的出价策略失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": trips})
+}
+
+// Resume 确认出价或预算配置无误后恢复被自动暂停的出价策略，恢复后在宽限期内不再检查
+func (h *VelocityHandler) Resume(c *gin.Context) {
+	strategyID := c.Param("strategy_id")
+	operator := operatorOf(c)
+
+	trip, err := h.guard.Resume(c.Request.Context(), strategyID, operator)
+	if err != nil {
+		switch {
+		case errors.Is(err, velocity.ErrNotPaused):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, velocity.ErrInvalidStrategyID):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			h.logger.Error("恢复自动暂停的出价策略失败", "strategy_id", strategyID, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	h.logger.Info("手动恢复自动暂停的出价策略", "strategy_id", strategyID, "operator", operator)
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复", "trip": trip})
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/listing"
+	"simple-dsp/pkg/logger"
+)
+
+// webhookListSpec 订阅列表允许的排序和过滤字段
+var webhookListSpec = listing.Spec{
+	Sortable:    []string{"name", "create_time", "update_time"},
+	Filterable:  []string{"enabled"},
+	DefaultSort: "-create_time",
+}
+
+// deliveryListSpec 投递记录列表允许的排序和过滤字段
+var deliveryListSpec = listing.Spec{
+	Sortable:    []string{"create_time"},
+	Filterable:  []string{"event_id", "event_type", "success"},
+	DefaultSort: "-create_time",
+}
+
+// WebhookHandler Webhook订阅处理器
+type WebhookHandler struct {
+	db         *gorm.DB
+	dispatcher *webhook.Dispatcher
+	logger     *logger.Logger
+}
+
+// NewWebhookHandler 创建Webhook订阅处理器
+func NewWebhookHandler(db *gorm.DB, dispatcher *webhook.Dispatcher, logger *logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		db:         db,
+		dispatcher: dispatcher,
+		logger:     logger,
+	}
+}
+
+// RegisterRoutes 注册路由
+func (h *WebhookHandler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/api/v1/webhooks")
+	{
+		g.GET("/events", h.ListEventTypes)
+		g.POST("", h.CreateSubscription)
+		g.GET("", h.ListSubscriptions)
+		g.GET("/:id", h.GetSubscription)
+		g.PUT("/:id", h.UpdateSubscription)
+		g.DELETE("/:id", h.DeleteSubscription)
+		g.POST("/:id/rotate-secret", h.RotateSecret)
+		g.POST("/:id/test", h.TestSubscription)
+		g.GET("/:id/deliveries", h.ListDeliveries)
+	}
+}
+
+// ListEventTypes 列出可订阅的事件类型
+func (h *WebhookHandler) ListEventTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"events": webhook.EventTypes})
+}
+
+// CreateSubscription 创建订阅，未指定密钥时自动生成，密钥只在创建时返回
+func (h *WebhookHandler) CreateSubscription(c *gin.Context) {
+	var sub webhook.Subscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub.ID = id.New()
+	if sub.Secret == "" {
+		sub.Secret = webhook.NewSecret()
+	}
+	sub.CreateTime = time.Now()
+	if !h.saveSubscription(c, &sub) {
+		return
+	}
+
+	h.logger.Info("创建Webhook订阅", "subscription_id", sub.ID, "url", sub.URL, "operator", operatorOf(c))
+	c.JSON(http.StatusCreated, sub)
+}
+
+// ListSubscriptions 列出订阅，支持分页、排序和过滤
+func (h *WebhookHandler) ListSubscriptions(c *gin.Context) {
+	query, err := listing.ParseQuery(c, webhookListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := queryPage(h.db.Model(&models.WebhookSubscription{}), query, webhookField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	subs := make([]*webhook.Subscription, 0, len(page.Items))
+	for i := range page.Items {
+		sub, err := webhook.FromModel(&page.Items[i])
+		if err != nil {
+			h.logger.Error("转换Webhook订阅失败", "subscription_id", page.Items[i].ID, "error", err)
+			continue
+		}
+		sub.Secret = ""
+		subs = append(subs, sub)
+	}
+
+	c.JSON(http.StatusOK, listing.Page[*webhook.Subscription]{
+		Items:      subs,
+		Total:      page.Total,
+		Page:       page.Page,
+		PageSize:   page.PageSize,
+		NextCursor: page.NextCursor,
+	})
+}
+
+// GetSubscription 获取订阅
+func (h *WebhookHandler) GetSubscription(c *gin.Context) {
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+	c.JSON(http.StatusOK, sub)
+}
+
+// UpdateSubscription 更新订阅的名称、地址、事件和启用状态，密钥保持不变
+func (h *WebhookHandler) UpdateSubscription(c *gin.Context) {
+	existing, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	var sub webhook.Subscription
+	if err := c.ShouldBindJSON(&sub); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sub.ID = existing.ID
+	sub.Secret = existing.Secret
+	sub.CreateTime = existing.CreateTime
+	if !h.saveSubscription(c, &sub) {
+		return
+	}
+
+	sub.Secret = ""
+	c.JSON(http.StatusOK, sub)
+}
+
+// DeleteSubscription 删除订阅及其投递记录
+func (h *WebhookHandler) DeleteSubscription(c *gin.Context) {
+	id := c.Param("id")
+	err := database.Transaction(c.Request.Context(), h.db, func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.WebhookDelivery{}, "subscription_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.WebhookSubscription{}, "id = ?", id).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("删除Webhook订阅", "subscription_id", id, "operator", operatorOf(c))
+	c.Status(http.StatusNoContent)
+}
+
+// RotateSecret 重新生成签名密钥并返回
+func (h *WebhookHandler) RotateSecret(c *gin.Context) {
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	sub.Secret = webhook.NewSecret()
+	if !h.saveSubscription(c, sub) {
+		return
+	}
+
+	h.logger.Info("轮换Webhook签名密钥", "subscription_id", sub.ID, "operator", operatorOf(c))
+	c.JSON(http.StatusOK, gin.H{"secret": sub.Secret})
+}
+
+// TestSubscription 同步发送测试事件，返回最后一次投递尝试的结果
+func (h *WebhookHandler) TestSubscription(c *gin.Context) {
+	sub, ok := h.loadSubscription(c)
+	if !ok {
+		return
+	}
+
+	event := webhook.NewEvent(webhook.EventPing, gin.H{"subscription_id": sub.ID})
+	delivery, err := h.dispatcher.Deliver(c.Request.Context(), sub, event)
+	if delivery == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, delivery)
+}
+
+// ListDeliveries 列出订阅的投递记录，支持按event_id、event_type、success过滤
+func (h *WebhookHandler) ListDeliveries(c *gin.Context) {
+	query, err := listing.ParseQuery(c, deliveryListSpec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := h.db.Model(&models.WebhookDelivery{}).Where("subscription_id = ?", c.Param("id"))
+	page, err := queryPage(db, query, deliveryField)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// loadSubscription 按路径参数加载订阅，失败时已写入响应
+func (h *WebhookHandler) loadSubscription(c *gin.Context) (*webhook.Subscription, bool) {
+	var record models.WebhookSubscription
+	if err := h.db.First(&record, "id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "webhook not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+
+	sub, err := webhook.FromModel(&record)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return sub, true
+}
+
+// saveSubscription 校验并保存订阅，失败时已写入响应
+func (h *WebhookHandler) saveSubscription(c *gin.Context, sub *webhook.Subscription) bool {
+	if err := sub.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	sub.UpdateTime = time.Now()
+	record, err := sub.ToModel()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := h.db.Save(record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+// webhookField 读取订阅字段
+func webhookField(m models.WebhookSubscription, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "name":
+		return m.Name
+	case "enabled":
+		return m.Enabled
+	case "create_time":
+		return m.CreateTime
+	case "update_time":
+		return m.UpdateTime
+	}
+	return nil
+}
+
+// deliveryField 读取投递记录字段
+func deliveryField(m models.WebhookDelivery, field string) interface{} {
+	switch field {
+	case "id":
+		return m.ID
+	case "create_time":
+		return m.CreateTime
+	}
+	return nil
+}
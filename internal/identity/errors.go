@@ -0,0 +1,10 @@
+package identity
+
+import "errors"
+
+var (
+	// ErrInvalidLink 表示设备ID或用户ID为空
+	ErrInvalidLink = errors.New("设备ID和用户ID不能为空")
+	// ErrTooManyLinks 表示一次提交的关联超过上限
+	ErrTooManyLinks = errors.New("一次提交的关联数量超过上限")
+)
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: graph.go
+ * Project: simple-dsp
+ * Description: 身份图谱，记录设备ID与用户ID的关联，用于跨设备频次控制
+ *
+ * 主要功能:
+ * - 保存设备ID到用户ID的关联
+ * - 将竞价请求中的设备ID解析为跨设备的用户ID
+ * - 从Kafka主题或HTTP接口接收关联
+ *
+ * 实现细节:
+ * - 关联保存在identity:device:{device_id}，值为用户ID，每次关联刷新TTL
+ * - 解析结果在本地缓存，没有关联的ID同样缓存，避免每次竞价都查询Redis
+ * - 查询失败或没有关联时使用原ID，频次按设备计算
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - github.com/patrickmn/go-cache
+ * - github.com/segmentio/kafka-go
+ *
+ * 注意事项:
+ * - 新的关联在其他实例上最多延迟一个缓存有效期生效
+ * - 一个设备只关联一个用户，重复关联时以最后一次为准
+ */
+
+package identity
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// deviceKeyPrefix 设备关联键前缀，完整键为identity:device:{device_id}
+	deviceKeyPrefix = "identity:device:"
+
+	// DefaultLinkTTL 默认关联保留时间
+	DefaultLinkTTL = 90 * 24 * time.Hour
+)
+
+// Link 设备ID与用户ID的关联
+type Link struct {
+	DeviceID string `json:"device_id"`
+	UserID   string `json:"user_id"`
+}
+
+// Validate 校验关联
+func (l Link) Validate() error {
+	if l.DeviceID == "" || l.UserID == "" {
+		return ErrInvalidLink
+	}
+	return nil
+}
+
+// Graph 身份图谱存储
+type Graph interface {
+	// Link 保存关联
+	Link(ctx context.Context, links []Link) error
+	// Unlink 删除设备的关联
+	Unlink(ctx context.Context, deviceID string) error
+	// Lookup 查询设备关联的用户ID，没有关联时ok为false
+	Lookup(ctx context.Context, deviceID string) (userID string, ok bool, err error)
+}
+
+// RedisGraph 基于Redis的身份图谱
+type RedisGraph struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewRedisGraph 创建基于Redis的身份图谱，ttl不大于0时使用DefaultLinkTTL
+func NewRedisGraph(redisClient *redis.Client, ttl time.Duration) *RedisGraph {
+	if ttl <= 0 {
+		ttl = DefaultLinkTTL
+	}
+	return &RedisGraph{redis: redisClient, ttl: ttl}
+}
+
+// Link 在一个管道中保存关联并刷新TTL
+func (g *RedisGraph) Link(ctx context.Context, links []Link) error {
+	if len(links) == 0 {
+		return nil
+	}
+	pipe := g.redis.Pipeline()
+	for _, link := range links {
+		pipe.Set(ctx, deviceKeyPrefix+link.DeviceID, link.UserID, g.ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存身份关联失败: %w", err)
+	}
+	return nil
+}
+
+// Unlink 删除设备的关联
+func (g *RedisGraph) Unlink(ctx context.Context, deviceID string) error {
+	return g.redis.Del(ctx, deviceKeyPrefix+deviceID).Err()
+}
+
+// Lookup 查询设备关联的用户ID
+func (g *RedisGraph) Lookup(ctx context.Context, deviceID string) (string, bool, error) {
+	userID, err := g.redis.Get(ctx, deviceKeyPrefix+deviceID).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("查询身份关联失败: %w", err)
+	}
+	return userID, true, nil
+}
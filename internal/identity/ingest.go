@@ -0,0 +1,201 @@
+package identity
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// MaxLinksPerRequest 一次HTTP请求最多提交的关联数
+const MaxLinksPerRequest = 1000
+
+// 关联来源和结果标签
+const (
+	sourceKafka = "kafka"
+	sourceAPI   = "api"
+
+	linkOK      = "ok"
+	linkInvalid = "invalid"
+	linkError   = "error"
+)
+
+// Ingester 接收关联并写入身份图谱
+type Ingester struct {
+	graph    Graph
+	resolver *Resolver
+	logger   *logger.Logger
+	metrics  *metrics.Metrics
+}
+
+// NewIngester 创建关联接收器，resolver不为nil时写入后清除对应设备的缓存
+func NewIngester(graph Graph, resolver *Resolver, logger *logger.Logger, metrics *metrics.Metrics) *Ingester {
+	return &Ingester{graph: graph, resolver: resolver, logger: logger, metrics: metrics}
+}
+
+// Ingest 保存有效的关联，跳过无效的关联，返回保存的数量
+func (i *Ingester) Ingest(ctx context.Context, source string, links []Link) (int, error) {
+	valid := links[:0:0]
+	for _, link := range links {
+		if link.Validate() != nil {
+			i.metrics.Frequency.IdentityLinks.WithLabelValues(source, linkInvalid).Inc()
+			continue
+		}
+		valid = append(valid, link)
+	}
+
+	if err := i.graph.Link(ctx, valid); err != nil {
+		i.metrics.Frequency.IdentityLinks.WithLabelValues(source, linkError).Add(float64(len(valid)))
+		return 0, err
+	}
+	i.metrics.Frequency.IdentityLinks.WithLabelValues(source, linkOK).Add(float64(len(valid)))
+	if i.resolver != nil {
+		for _, link := range valid {
+			i.resolver.Forget(link.DeviceID)
+		}
+	}
+	return len(valid), nil
+}
+
+// Consumer 从Kafka主题消费关联，每条消息为一个Link的JSON
+type Consumer struct {
+	reader   *kafka.Reader
+	ingester *Ingester
+	logger   *logger.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConsumer 创建Kafka关联消费者
+func NewConsumer(brokers []string, cfg config.IdentityConfig, ingester *Ingester, logger *logger.Logger) *Consumer {
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: brokers,
+			Topic:   cfg.Topic,
+			GroupID: cfg.GroupID,
+		}),
+		ingester: ingester,
+		logger:   logger,
+	}
+}
+
+// Start 启动后台消费
+func (c *Consumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.consume(ctx)
+}
+
+// Stop 停止消费并关闭连接
+func (c *Consumer) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	if err := c.reader.Close(); err != nil {
+		c.logger.Error("关闭身份关联消费者失败", "error", err)
+	}
+}
+
+// consume 逐条消费，写入失败时不提交位点，稍后重试
+func (c *Consumer) consume(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		msg, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			c.logger.Error("读取身份关联失败", "error", err)
+			continue
+		}
+
+		// 无法解析的消息按无效关联计数后跳过
+		var link Link
+		if err := json.Unmarshal(msg.Value, &link); err != nil {
+			c.logger.Warn("跳过无效的身份关联", "offset", msg.Offset, "error", err)
+			link = Link{}
+		}
+		for {
+			if _, err = c.ingester.Ingest(ctx, sourceKafka, []Link{link}); err == nil || ctx.Err() != nil {
+				break
+			}
+			c.logger.Error("保存身份关联失败", "offset", msg.Offset, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err := c.reader.CommitMessages(ctx, msg); err != nil && ctx.Err() == nil {
+			c.logger.Error("提交身份关联位点失败", "error", err)
+		}
+	}
+}
+
+// Handler 身份关联HTTP接口
+type Handler struct {
+	ingester *Ingester
+	graph    Graph
+	resolver *Resolver
+	logger   *logger.Logger
+}
+
+// NewHandler 创建身份关联HTTP接口
+func NewHandler(ingester *Ingester, graph Graph, resolver *Resolver, logger *logger.Logger) *Handler {
+	return &Handler{ingester: ingester, graph: graph, resolver: resolver, logger: logger}
+}
+
+// linksRequest 提交关联的请求
+type linksRequest struct {
+	Links []Link `json:"links"`
+}
+
+// AddLinks 批量提交关联，无效的关联被跳过
+func (h *Handler) AddLinks(c *gin.Context) {
+	var req linksRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求参数"})
+		return
+	}
+	if len(req.Links) > MaxLinksPerRequest {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrTooManyLinks.Error()})
+		return
+	}
+
+	saved, err := h.ingester.Ingest(c.Request.Context(), sourceAPI, req.Links)
+	if err != nil {
+		h.logger.Error("保存身份关联失败", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存身份关联失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"saved": saved, "skipped": len(req.Links) - saved})
+}
+
+// DeleteLink 删除设备的关联
+func (h *Handler) DeleteLink(c *gin.Context) {
+	deviceID := c.Param("device_id")
+	if err := h.graph.Unlink(c.Request.Context(), deviceID); err != nil {
+		h.logger.Error("删除身份关联失败", "device_id", deviceID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除身份关联失败"})
+		return
+	}
+	if h.resolver != nil {
+		h.resolver.Forget(deviceID)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "身份关联已删除"})
+}
@@ -0,0 +1,75 @@
+package identity
+
+import (
+	"context"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// DefaultCacheTTL 默认解析结果缓存时间
+const DefaultCacheTTL = 5 * time.Minute
+
+// 解析结果标签
+const (
+	lookupLinked   = "linked"
+	lookupUnlinked = "unlinked"
+	lookupCached   = "cached"
+	lookupError    = "error"
+)
+
+// Resolver 将设备ID解析为跨设备的用户ID，带本地缓存
+type Resolver struct {
+	graph   Graph
+	cache   *cache.Cache
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+}
+
+// NewResolver 创建解析器，cacheTTL不大于0时使用DefaultCacheTTL
+func NewResolver(graph Graph, cacheTTL time.Duration, logger *logger.Logger, metrics *metrics.Metrics) *Resolver {
+	if cacheTTL <= 0 {
+		cacheTTL = DefaultCacheTTL
+	}
+	return &Resolver{
+		graph:   graph,
+		cache:   cache.New(cacheTTL, 2*cacheTTL),
+		logger:  logger,
+		metrics: metrics,
+	}
+}
+
+// Resolve 返回ID关联的用户ID，没有关联或查询失败时返回原ID
+func (r *Resolver) Resolve(ctx context.Context, id string) string {
+	if id == "" {
+		return id
+	}
+	if v, ok := r.cache.Get(id); ok {
+		r.metrics.Frequency.IdentityLookups.WithLabelValues(lookupCached).Inc()
+		return v.(string)
+	}
+
+	userID, ok, err := r.graph.Lookup(ctx, id)
+	if err != nil {
+		// 查询失败时不缓存，下次重新查询
+		r.metrics.Frequency.IdentityLookups.WithLabelValues(lookupError).Inc()
+		r.logger.Warn("查询身份关联失败，按设备控制频次", "device_id", id, "error", err)
+		return id
+	}
+	if !ok {
+		r.metrics.Frequency.IdentityLookups.WithLabelValues(lookupUnlinked).Inc()
+		userID = id
+	} else {
+		r.metrics.Frequency.IdentityLookups.WithLabelValues(lookupLinked).Inc()
+	}
+	r.cache.SetDefault(id, userID)
+	return userID
+}
+
+// Forget 清除设备的缓存，本实例上新的关联立即生效
+func (r *Resolver) Forget(deviceID string) {
+	r.cache.Delete(deviceID)
+}
@@ -0,0 +1,275 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/segmentio/kafka-go"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultBatchSize       = 500
+	defaultFlushInterval   = 5 * time.Second
+	defaultResolveCacheTTL = 10 * time.Minute
+
+	// spendOperator 消耗流水的操作人
+	spendOperator = "system"
+)
+
+// spendTopics 计费事件的Kafka主题，与stats.Collector写入的主题一致
+var spendTopics = []string{
+	"dsp.events." + string(stats.EventImpression),
+	"dsp.events." + string(stats.EventWin),
+}
+
+// SpendKey 消耗流水的幂等键，同一请求同一广告只计费一次
+// 展示和竞价成功通知可能都携带成交价，也可能被重复投递，以先到的一条为准
+func SpendKey(requestID, adID string) string {
+	return "spend:" + requestID + ":" + adID
+}
+
+// SpendEntry 将携带成交价的展示或竞价成功事件转换为消耗流水，不计费的事件返回nil
+// 成交价为媒体成本，服务费和税费取事件写出时计算的值，金额为三者之和
+// advertiserID为空时记入UnattributedAdvertiser
+func SpendEntry(event *stats.Event, campaignID, advertiserID string) *models.LedgerEntry {
+	if event.EventType != stats.EventImpression && event.EventType != stats.EventWin {
+		return nil
+	}
+	mediaCost := int64(math.Round(event.WinPrice * 100))
+	if mediaCost <= 0 || event.RequestID == "" || event.AdID == "" {
+		return nil
+	}
+	fee := int64(math.Round(event.Fee * 100))
+	tax := int64(math.Round(event.Tax * 100))
+	if advertiserID == "" {
+		advertiserID = UnattributedAdvertiser
+	}
+	return &models.LedgerEntry{
+		AdvertiserID:   advertiserID,
+		Type:           TypeSpend,
+		Amount:         mediaCost + fee + tax,
+		MediaCost:      mediaCost,
+		Fee:            fee,
+		Tax:            tax,
+		IdempotencyKey: SpendKey(event.RequestID, event.AdID),
+		CampaignID:     campaignID,
+		AdID:           event.AdID,
+		Reference:      string(event.EventType),
+		Operator:       spendOperator,
+		OccurTime:      event.Timestamp,
+	}
+}
+
+// AdvertiserResolver 查找广告（出价策略）所属的推广计划和广告主
+type AdvertiserResolver interface {
+	Resolve(ctx context.Context, adID string) (campaignID, advertiserID string, err error)
+}
+
+// attribution 广告所属的推广计划和广告主
+type attribution struct {
+	campaignID   string
+	advertiserID string
+}
+
+// StrategyResolver 通过出价策略的campaign_id和推广计划的advertiser_id查找广告主，结果在本地缓存
+type StrategyResolver struct {
+	strategies bidding.Repository
+	db         *gorm.DB
+	cache      *cache.Cache
+}
+
+// NewStrategyResolver 创建广告主解析器
+func NewStrategyResolver(strategies bidding.Repository, db *gorm.DB, ttl time.Duration) *StrategyResolver {
+	if ttl <= 0 {
+		ttl = defaultResolveCacheTTL
+	}
+	return &StrategyResolver{
+		strategies: strategies,
+		db:         db,
+		cache:      cache.New(ttl, 2*ttl),
+	}
+}
+
+// Resolve 查找广告所属的推广计划和广告主，策略不存在或未关联推广计划时返回空
+// 已删除的推广计划仍可解析，删除前产生的消耗照常计费
+func (r *StrategyResolver) Resolve(ctx context.Context, adID string) (string, string, error) {
+	if cached, ok := r.cache.Get(adID); ok {
+		a := cached.(attribution)
+		return a.campaignID, a.advertiserID, nil
+	}
+
+	var a attribution
+	id, err := strconv.ParseInt(adID, 10, 64)
+	if err != nil {
+		r.cache.SetDefault(adID, a)
+		return "", "", nil
+	}
+	strategy, err := r.strategies.GetBidStrategy(ctx, id)
+	if err != nil {
+		return "", "", err
+	}
+
+	if strategy != nil && strategy.CampaignID != "" {
+		var campaign models.Campaign
+		err := r.db.WithContext(ctx).Unscoped().Select("id", "advertiser_id").First(&campaign, "id = ?", strategy.CampaignID).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", err
+		}
+		a = attribution{campaignID: strategy.CampaignID, advertiserID: campaign.AdvertiserID}
+	}
+	r.cache.SetDefault(adID, a)
+	return a.campaignID, a.advertiserID, nil
+}
+
+// Consumer 消费展示和竞价成功事件，批量写入消耗流水
+type Consumer struct {
+	reader   *kafka.Reader
+	ledger   *Ledger
+	resolver AdvertiserResolver
+	logger   *logger.Logger
+
+	batchSize     int
+	flushInterval time.Duration
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewConsumer 创建计费事件消费者
+func NewConsumer(brokers []string, cfg config.LedgerConfig, ledger *Ledger, resolver AdvertiserResolver, logger *logger.Logger) *Consumer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	return &Consumer{
+		reader: kafka.NewReader(kafka.ReaderConfig{
+			Brokers:     brokers,
+			GroupTopics: spendTopics,
+			GroupID:     cfg.GroupID,
+		}),
+		ledger:        ledger,
+		resolver:      resolver,
+		logger:        logger,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+	}
+}
+
+// Start 启动后台消费
+func (c *Consumer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	c.wg.Add(1)
+	go c.consume(ctx)
+}
+
+// Stop 停止消费并关闭连接，未写入的一批不提交位点，重启后重新消费
+func (c *Consumer) Stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	if err := c.reader.Close(); err != nil {
+		c.logger.Error("关闭计费事件消费者失败", "error", err)
+	}
+}
+
+// consume 攒够一批或等待超过flushInterval后写入，写入成功后才提交位点
+func (c *Consumer) consume(ctx context.Context) {
+	defer c.wg.Done()
+
+	var messages []kafka.Message
+	deadline := time.Now().Add(c.flushInterval)
+	for {
+		fetchCtx, cancel := context.WithDeadline(ctx, deadline)
+		msg, err := c.reader.FetchMessage(fetchCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			messages = append(messages, msg)
+		} else if !errors.Is(err, context.DeadlineExceeded) {
+			c.logger.Error("读取计费事件失败", "error", err)
+		}
+
+		if len(messages) < c.batchSize && time.Now().Before(deadline) {
+			continue
+		}
+		if len(messages) > 0 && !c.flush(ctx, messages) {
+			return
+		}
+		messages = messages[:0]
+		deadline = time.Now().Add(c.flushInterval)
+	}
+}
+
+// flush 写入一批消息对应的流水并提交位点，写入失败时重试直到成功或停止
+func (c *Consumer) flush(ctx context.Context, messages []kafka.Message) bool {
+	for {
+		entries, err := c.entries(ctx, messages)
+		if err == nil {
+			var n int64
+			if n, err = c.ledger.RecordBatch(ctx, entries); err == nil {
+				c.logger.Debug("写入消耗流水", "messages", len(messages), "entries", len(entries), "inserted", n)
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+		c.logger.Error("写入消耗流水失败", "count", len(messages), "error", err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(time.Second):
+		}
+	}
+
+	if err := c.reader.CommitMessages(ctx, messages...); err != nil && ctx.Err() == nil {
+		c.logger.Error("提交计费事件位点失败", "error", err)
+	}
+	return ctx.Err() == nil
+}
+
+// entries 解析消息并查找广告主，无法解析的消息跳过，查找失败时整批重试
+func (c *Consumer) entries(ctx context.Context, messages []kafka.Message) ([]*models.LedgerEntry, error) {
+	entries := make([]*models.LedgerEntry, 0, len(messages))
+	for _, msg := range messages {
+		event, err := stats.DecodeEvent(msg.Value)
+		if err != nil {
+			c.logger.Warn("跳过无效的计费事件", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+			continue
+		}
+		if SpendEntry(event, "", "") == nil {
+			continue
+		}
+
+		campaignID, advertiserID, err := c.resolver.Resolve(ctx, event.AdID)
+		if err != nil {
+			return nil, fmt.Errorf("查找广告%s的广告主失败: %w", event.AdID, err)
+		}
+		if advertiserID == "" {
+			c.logger.Warn("消耗无法确定广告主", "ad_id", event.AdID, "request_id", event.RequestID)
+		}
+		entries = append(entries, SpendEntry(event, campaignID, advertiserID))
+	}
+	return entries, nil
+}
@@ -0,0 +1,29 @@
+package ledger
+
+import "errors"
+
+var (
+	// ErrAdvertiserRequired 表示流水未指定广告主
+	ErrAdvertiserRequired = errors.New("广告主ID不能为空")
+
+	// ErrKeyRequired 表示流水未指定幂等键
+	ErrKeyRequired = errors.New("幂等键不能为空")
+
+	// ErrUnknownType 表示不支持的流水类型
+	ErrUnknownType = errors.New("不支持的流水类型")
+
+	// ErrInvalidAmount 表示金额为0或与流水类型的方向不符
+	ErrInvalidAmount = errors.New("无效的流水金额")
+
+	// ErrIdempotencyConflict 表示幂等键已用于内容不同的流水
+	ErrIdempotencyConflict = errors.New("幂等键已用于其他流水")
+
+	// ErrDayNotOver 表示结算的日期尚未结束
+	ErrDayNotOver = errors.New("只能结算已结束的日期")
+
+	// ErrInvalidPeriod 表示账单区间无效
+	ErrInvalidPeriod = errors.New("无效的账单区间")
+
+	// ErrPeriodNotClosed 表示账单区间内有未结算的日期
+	ErrPeriodNotClosed = errors.New("账单区间内有未结算的日期")
+)
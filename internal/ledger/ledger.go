@@ -0,0 +1,413 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: ledger.go
+ * Project: simple-dsp
+ * Description: 计费账本，按广告主记录每一笔消耗、退款和调整，作为对账和开票的依据
+ *
+ * 主要功能:
+ * - 只追加的流水，每条流水带幂等键，重复提交不会重复记账
+ * - 按天结算广告主的期初、消耗、退款、调整和期末金额
+ * - 按结算结果生成账单，支持导出
+ *
+ * 实现细节:
+ * - 金额以分为单位的整数保存，消耗为正，退款为负，调整可正可负
+ * - 消耗流水按媒体成本、平台服务费和税费拆分，金额为三者之和，日终余额和账单分别汇总
+ * - 流水按记账时间（create_time）归入结算日，迟到的事件记入到达当天，已结算的日期不再变化
+ * - 结算按日期顺序进行，每天的期初取前一天的期末
+ *
+ * 依赖关系:
+ * - gorm.io/gorm
+ * - github.com/segmentio/kafka-go
+ *
+ * 注意事项:
+ * - 流水不可修改或删除，更正通过调整流水完成
+ * - Redis中的消耗计数器只用于预算控制和实时报表，金额以账本为准
+ */
+
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultCloseInterval = time.Hour
+	closeTimeout         = 10 * time.Minute
+
+	// closeLockName 日终结算任务的分布式锁
+	closeLockName = "ledger:close"
+
+	// DateLayout 结算日期的格式
+	DateLayout = "2006-01-02"
+)
+
+// 流水类型
+const (
+	// TypeSpend 消耗，金额为正
+	TypeSpend = "spend"
+	// TypeRefund 退款，金额为负
+	TypeRefund = "refund"
+	// TypeAdjustment 调整，金额可正可负，用于更正
+	TypeAdjustment = "adjustment"
+)
+
+// UnattributedAdvertiser 无法确定广告主的消耗记入该账户，核对后通过调整流水转到对应广告主
+const UnattributedAdvertiser = "unattributed"
+
+// Invoice 广告主在一段时间内的账单，金额单位为分
+// MediaCost、Fee、Tax为消耗的费用构成，媒体成本是平台的成本，服务费是平台的收入
+type Invoice struct {
+	AdvertiserID string                      `json:"advertiser_id"`
+	From         string                      `json:"from"`
+	To           string                      `json:"to"`
+	Opening      int64                       `json:"opening"`
+	Spend        int64                       `json:"spend"`
+	Refund       int64                       `json:"refund"`
+	Adjustment   int64                       `json:"adjustment"`
+	Closing      int64                       `json:"closing"`
+	MediaCost    int64                       `json:"media_cost"`
+	Fee          int64                       `json:"fee"`
+	Tax          int64                       `json:"tax"`
+	Days         []models.LedgerDailyBalance `json:"days"`
+}
+
+// Ledger 计费账本
+type Ledger struct {
+	cfg    config.LedgerConfig
+	store  Store
+	logger *logger.Logger
+	now    func() time.Time
+	locker *lock.Locker
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// New 创建计费账本
+func New(cfg config.LedgerConfig, store Store, logger *logger.Logger) *Ledger {
+	if cfg.CloseInterval <= 0 {
+		cfg.CloseInterval = defaultCloseInterval
+	}
+	return &Ledger{
+		cfg:    cfg,
+		store:  store,
+		logger: logger,
+		now:    time.Now,
+	}
+}
+
+// SetClock 设置时钟，用于测试
+func (l *Ledger) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时结算
+func (l *Ledger) SetLocker(locker *lock.Locker) {
+	l.locker = locker
+}
+
+// Validate 校验流水的广告主、类型、金额方向和幂等键
+// 拆分了费用构成的流水，媒体成本、服务费和税费之和须等于金额
+func Validate(entry *models.LedgerEntry) error {
+	if entry.AdvertiserID == "" {
+		return ErrAdvertiserRequired
+	}
+	if entry.IdempotencyKey == "" {
+		return ErrKeyRequired
+	}
+	switch entry.Type {
+	case TypeSpend:
+		if entry.Amount <= 0 {
+			return fmt.Errorf("%w: 消耗金额必须为正: %d", ErrInvalidAmount, entry.Amount)
+		}
+	case TypeRefund:
+		if entry.Amount >= 0 {
+			return fmt.Errorf("%w: 退款金额必须为负: %d", ErrInvalidAmount, entry.Amount)
+		}
+	case TypeAdjustment:
+		if entry.Amount == 0 {
+			return fmt.Errorf("%w: 调整金额不能为0", ErrInvalidAmount)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownType, entry.Type)
+	}
+	if entry.MediaCost != 0 || entry.Fee != 0 || entry.Tax != 0 {
+		if split := entry.MediaCost + entry.Fee + entry.Tax; split != entry.Amount {
+			return fmt.Errorf("%w: 费用构成之和%d与金额%d不符", ErrInvalidAmount, split, entry.Amount)
+		}
+	}
+	return nil
+}
+
+// Record 记录一条流水
+// 幂等键已存在且广告主、类型、金额相同时返回已有的流水，created为false；内容不同时返回ErrIdempotencyConflict
+func (l *Ledger) Record(ctx context.Context, entry *models.LedgerEntry) (*models.LedgerEntry, bool, error) {
+	if err := Validate(entry); err != nil {
+		return nil, false, err
+	}
+
+	if existing, err := l.store.FindByKey(ctx, entry.IdempotencyKey); err != nil {
+		return nil, false, err
+	} else if existing != nil {
+		return l.replay(existing, entry)
+	}
+
+	l.stamp(entry)
+	n, err := l.store.Append(ctx, []*models.LedgerEntry{entry})
+	if err != nil {
+		return nil, false, err
+	}
+	if n == 1 {
+		return entry, true, nil
+	}
+
+	// 并发提交时另一个请求先写入
+	existing, err := l.store.FindByKey(ctx, entry.IdempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing == nil {
+		return nil, false, fmt.Errorf("写入流水失败: %s", entry.IdempotencyKey)
+	}
+	return l.replay(existing, entry)
+}
+
+// RecordBatch 批量记录流水，幂等键已存在的流水被跳过，返回实际写入的条数
+// 用于消费事件时重复投递的场景，不比较已有流水的内容
+func (l *Ledger) RecordBatch(ctx context.Context, entries []*models.LedgerEntry) (int64, error) {
+	valid := make([]*models.LedgerEntry, 0, len(entries))
+	for _, entry := range entries {
+		if err := Validate(entry); err != nil {
+			l.logger.Warn("跳过无效的流水", "key", entry.IdempotencyKey, "error", err)
+			continue
+		}
+		l.stamp(entry)
+		valid = append(valid, entry)
+	}
+	if len(valid) == 0 {
+		return 0, nil
+	}
+	return l.store.Append(ctx, valid)
+}
+
+// replay 比较重复提交的流水与已有流水
+func (l *Ledger) replay(existing, entry *models.LedgerEntry) (*models.LedgerEntry, bool, error) {
+	if existing.AdvertiserID != entry.AdvertiserID || existing.Type != entry.Type || existing.Amount != entry.Amount ||
+		existing.MediaCost != entry.MediaCost || existing.Fee != entry.Fee || existing.Tax != entry.Tax {
+		return nil, false, fmt.Errorf("%w: %s", ErrIdempotencyConflict, entry.IdempotencyKey)
+	}
+	return existing, false, nil
+}
+
+// stamp 设置记账时间，未指定发生时间时与记账时间相同
+func (l *Ledger) stamp(entry *models.LedgerEntry) {
+	entry.ID = 0
+	entry.CreateTime = l.now()
+	if entry.OccurTime.IsZero() {
+		entry.OccurTime = entry.CreateTime
+	}
+}
+
+// CloseThrough 按日期顺序结算到date（含）为止所有未结算的日期，返回本次结算的天数
+// 已结算的日期不会重复结算，date不能是今天或以后
+func (l *Ledger) CloseThrough(ctx context.Context, date time.Time) (int, error) {
+	target := dayOf(date)
+	if !target.Before(dayOf(l.now())) {
+		return 0, fmt.Errorf("%w: %s", ErrDayNotOver, target.Format(DateLayout))
+	}
+
+	last, err := l.store.LastClosedDate(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var start time.Time
+	if last.IsZero() {
+		first, err := l.store.FirstEntryTime(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if first.IsZero() {
+			return 0, nil
+		}
+		start = dayOf(first)
+	} else {
+		start = dayOf(last).AddDate(0, 0, 1)
+	}
+
+	closed := 0
+	for day := start; !day.After(target); day = day.AddDate(0, 0, 1) {
+		if err := l.closeDay(ctx, day); err != nil {
+			return closed, fmt.Errorf("结算%s失败: %w", day.Format(DateLayout), err)
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+// closeDay 结算一天，期初取前一天的期末，前一天有余额或当天有流水的广告主都生成一条记录
+func (l *Ledger) closeDay(ctx context.Context, day time.Time) error {
+	previous, err := l.store.Balances(ctx, day.AddDate(0, 0, -1))
+	if err != nil {
+		return err
+	}
+	totals, err := l.store.SumEntries(ctx, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	now := l.now()
+	balances := make(map[string]*models.LedgerDailyBalance)
+	balanceOf := func(advertiserID string) *models.LedgerDailyBalance {
+		b, ok := balances[advertiserID]
+		if !ok {
+			b = &models.LedgerDailyBalance{AdvertiserID: advertiserID, Date: day, CreateTime: now}
+			balances[advertiserID] = b
+		}
+		return b
+	}
+	for _, prev := range previous {
+		balanceOf(prev.AdvertiserID).Opening = prev.Closing
+	}
+	for _, t := range totals {
+		b := balanceOf(t.AdvertiserID)
+		switch t.Type {
+		case TypeSpend:
+			b.Spend += t.Amount
+		case TypeRefund:
+			b.Refund += t.Amount
+		case TypeAdjustment:
+			b.Adjustment += t.Amount
+		}
+		b.MediaCost += t.MediaCost
+		b.Fee += t.Fee
+		b.Tax += t.Tax
+		b.EntryCount += t.Count
+	}
+
+	result := make([]models.LedgerDailyBalance, 0, len(balances))
+	for _, b := range balances {
+		b.Closing = b.Opening + b.Spend + b.Refund + b.Adjustment
+		result = append(result, *b)
+	}
+	if err := l.store.SaveBalances(ctx, day, result); err != nil {
+		return err
+	}
+
+	l.logger.Info("完成账本日终结算", "date", day.Format(DateLayout), "advertisers", len(result))
+	return nil
+}
+
+// Invoice 按日终结算结果生成广告主在[from, to]内的账单，区间内的日期必须都已结算
+func (l *Ledger) Invoice(ctx context.Context, advertiserID string, from, to time.Time) (*Invoice, error) {
+	from, to = dayOf(from), dayOf(to)
+	if advertiserID == "" {
+		return nil, ErrAdvertiserRequired
+	}
+	if to.Before(from) {
+		return nil, ErrInvalidPeriod
+	}
+
+	last, err := l.store.LastClosedDate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if last.IsZero() || dayOf(last).Before(to) {
+		return nil, fmt.Errorf("%w: %s", ErrPeriodNotClosed, to.Format(DateLayout))
+	}
+
+	days, err := l.store.ListBalances(ctx, advertiserID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice := &Invoice{
+		AdvertiserID: advertiserID,
+		From:         from.Format(DateLayout),
+		To:           to.Format(DateLayout),
+		Days:         days,
+	}
+	if len(days) == 0 {
+		// 区间内没有结算记录时，期初和期末取区间前最近一次结算的期末
+		prev, err := l.store.LatestBalance(ctx, advertiserID, from)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil {
+			invoice.Opening, invoice.Closing = prev.Closing, prev.Closing
+		}
+		invoice.Days = []models.LedgerDailyBalance{}
+		return invoice, nil
+	}
+
+	invoice.Opening = days[0].Opening
+	invoice.Closing = days[len(days)-1].Closing
+	for _, day := range days {
+		invoice.Spend += day.Spend
+		invoice.Refund += day.Refund
+		invoice.Adjustment += day.Adjustment
+		invoice.MediaCost += day.MediaCost
+		invoice.Fee += day.Fee
+		invoice.Tax += day.Tax
+	}
+	return invoice, nil
+}
+
+// Start 启动日终结算任务，每次检查时结算到前一天
+func (l *Ledger) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancelFunc = cancel
+
+	l.wg.Add(1)
+	go l.closeLoop(ctx)
+}
+
+// Stop 停止日终结算任务
+func (l *Ledger) Stop() {
+	if l.cancelFunc == nil {
+		return
+	}
+	l.cancelFunc()
+	l.wg.Wait()
+}
+
+// closeLoop 定时结算，启动时先结算一次补齐停机期间的日期
+func (l *Ledger) closeLoop(ctx context.Context) {
+	defer l.wg.Done()
+
+	ticker := time.NewTicker(l.cfg.CloseInterval)
+	defer ticker.Stop()
+
+	for {
+		runCtx, cancel := context.WithTimeout(ctx, closeTimeout)
+		err := l.locker.Do(runCtx, closeLockName, func(ctx context.Context) error {
+			_, err := l.CloseThrough(ctx, l.now().AddDate(0, 0, -1))
+			return err
+		})
+		if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+			l.logger.Error("账本日终结算失败", "error", err)
+		}
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dayOf 返回时间所在日期的零点（本地时区）
+func dayOf(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
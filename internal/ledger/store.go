@@ -0,0 +1,149 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// Totals 广告主某类流水的汇总
+type Totals struct {
+	AdvertiserID string `gorm:"column:advertiser_id"`
+	Type         string `gorm:"column:type"`
+	Amount       int64  `gorm:"column:amount"`
+	MediaCost    int64  `gorm:"column:media_cost"`
+	Fee          int64  `gorm:"column:fee"`
+	Tax          int64  `gorm:"column:tax"`
+	Count        int64  `gorm:"column:count"`
+}
+
+// Store 账本存储
+type Store interface {
+	// Append 追加流水，幂等键已存在的流水被跳过，返回实际写入的条数
+	Append(ctx context.Context, entries []*models.LedgerEntry) (int64, error)
+	// FindByKey 按幂等键查找流水，不存在时返回nil
+	FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error)
+	// SumEntries 按广告主和类型汇总记账时间在[from, to)内的流水
+	SumEntries(ctx context.Context, from, to time.Time) ([]Totals, error)
+	// FirstEntryTime 最早一条流水的记账时间，没有流水时返回零值
+	FirstEntryTime(ctx context.Context) (time.Time, error)
+	// LastClosedDate 最近一次结算的日期，没有结算时返回零值
+	LastClosedDate(ctx context.Context) (time.Time, error)
+	// Balances 所有广告主在date的日终余额
+	Balances(ctx context.Context, date time.Time) ([]models.LedgerDailyBalance, error)
+	// SaveBalances 保存date的日终余额
+	SaveBalances(ctx context.Context, date time.Time, balances []models.LedgerDailyBalance) error
+	// ListBalances 广告主在[from, to]内的日终余额，按日期升序
+	ListBalances(ctx context.Context, advertiserID string, from, to time.Time) ([]models.LedgerDailyBalance, error)
+	// LatestBalance 广告主在before之前最近一次的日终余额，没有时返回nil
+	LatestBalance(ctx context.Context, advertiserID string, before time.Time) (*models.LedgerDailyBalance, error)
+}
+
+// GormStore 基于数据库的账本存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于数据库的账本存储
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// Append 追加流水，依赖idempotency_key的唯一约束去重
+func (s *GormStore) Append(ctx context.Context, entries []*models.LedgerEntry) (int64, error) {
+	result := s.db.WithContext(database.WithQueryName(ctx, "ledger.append")).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "idempotency_key"}}, DoNothing: true}).
+		Create(&entries)
+	return result.RowsAffected, result.Error
+}
+
+// FindByKey 按幂等键查找流水
+func (s *GormStore) FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error) {
+	var entry models.LedgerEntry
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.find_by_key")).First(&entry, "idempotency_key = ?", key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// SumEntries 按广告主和类型汇总流水
+func (s *GormStore) SumEntries(ctx context.Context, from, to time.Time) ([]Totals, error) {
+	var totals []Totals
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.sum_entries")).Model(&models.LedgerEntry{}).
+		Select("advertiser_id, type, SUM(amount) AS amount, SUM(media_cost) AS media_cost, SUM(fee) AS fee, SUM(tax) AS tax, COUNT(*) AS count").
+		Where("create_time >= ? AND create_time < ?", from, to).
+		Group("advertiser_id, type").
+		Scan(&totals).Error
+	return totals, err
+}
+
+// FirstEntryTime 最早一条流水的记账时间
+func (s *GormStore) FirstEntryTime(ctx context.Context) (time.Time, error) {
+	var first sql.NullTime
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.first_entry_time")).Model(&models.LedgerEntry{}).Select("MIN(create_time)").Scan(&first).Error
+	return first.Time, err
+}
+
+// LastClosedDate 最近一次结算的日期
+func (s *GormStore) LastClosedDate(ctx context.Context) (time.Time, error) {
+	var last sql.NullTime
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.last_closed_date")).Model(&models.LedgerDailyBalance{}).Select("MAX(date)").Scan(&last).Error
+	return last.Time, err
+}
+
+// Balances 所有广告主在date的日终余额
+func (s *GormStore) Balances(ctx context.Context, date time.Time) ([]models.LedgerDailyBalance, error) {
+	var balances []models.LedgerDailyBalance
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.balances")).Where("date = ?", date).Find(&balances).Error
+	return balances, err
+}
+
+// SaveBalances 在一个事务中保存date的日终余额，重复结算时覆盖当天的记录；并发结算死锁时重新执行事务
+func (s *GormStore) SaveBalances(ctx context.Context, date time.Time, balances []models.LedgerDailyBalance) error {
+	return database.TransactionRetry(database.WithQueryName(ctx, "ledger.save_balances"), s.db, func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.LedgerDailyBalance{}, "date = ?", date).Error; err != nil {
+			return err
+		}
+		if len(balances) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(balances, 500).Error
+	})
+}
+
+// ListBalances 广告主在[from, to]内的日终余额
+func (s *GormStore) ListBalances(ctx context.Context, advertiserID string, from, to time.Time) ([]models.LedgerDailyBalance, error) {
+	var balances []models.LedgerDailyBalance
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.list_balances")).
+		Where("advertiser_id = ? AND date >= ? AND date <= ?", advertiserID, from, to).
+		Order("date ASC").
+		Find(&balances).Error
+	return balances, err
+}
+
+// LatestBalance 广告主在before之前最近一次的日终余额
+func (s *GormStore) LatestBalance(ctx context.Context, advertiserID string, before time.Time) (*models.LedgerDailyBalance, error) {
+	var balance models.LedgerDailyBalance
+	err := s.db.WithContext(database.WithQueryName(ctx, "ledger.latest_balance")).
+		Where("advertiser_id = ? AND date < ?", advertiserID, before).
+		Order("date DESC").
+		First(&balance).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
@@ -0,0 +1,8 @@
+package macro
+
+import "errors"
+
+var (
+	// ErrUnknownMacro 表示URL中包含不支持的宏
+	ErrUnknownMacro = errors.New("不支持的宏")
+)
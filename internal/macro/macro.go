@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: macro.go
+ * Project: simple-dsp
+ * Description: 跟踪URL和落地页URL的宏替换
+ *
+ * 主要功能:
+ * - 按事件替换{CLICK_ID}、{DEVICE_ID_MD5}、{CAMPAIGN_ID}、{TS}、{IP}
+ * - 按白名单限制可替换的字段
+ * - 校验URL中的宏名称
+ *
+ * 实现细节:
+ * - 宏的值按查询参数编码后替换
+ * - 未在白名单中的宏替换为空字符串，不向第三方泄露对应字段
+ * - 不认识的{...}原样保留，避免误改URL中的其他内容
+ *
+ * 注意事项:
+ * - {IP}默认不在白名单中，需显式配置
+ * - {TS}为毫秒时间戳
+ */
+
+package macro
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的宏名称
+const (
+	ClickID     = "CLICK_ID"
+	DeviceIDMD5 = "DEVICE_ID_MD5"
+	CampaignID  = "CAMPAIGN_ID"
+	Timestamp   = "TS"
+	IP          = "IP"
+)
+
+// Names 支持的全部宏名称
+var Names = []string{ClickID, DeviceIDMD5, CampaignID, Timestamp, IP}
+
+// DefaultAllowlist 未配置白名单时允许替换的宏，不包含IP
+var DefaultAllowlist = []string{ClickID, DeviceIDMD5, CampaignID, Timestamp}
+
+// pattern 匹配{NAME}形式的宏
+var pattern = regexp.MustCompile(`\{([A-Z0-9_]+)\}`)
+
+// Values 单个事件的宏取值
+type Values struct {
+	ClickID    string
+	DeviceID   string // 原始设备ID，替换时计算MD5
+	CampaignID string
+	IP         string
+	Time       time.Time
+}
+
+// lookup 返回宏的取值
+func (v *Values) lookup(name string) string {
+	switch name {
+	case ClickID:
+		return v.ClickID
+	case DeviceIDMD5:
+		if v.DeviceID == "" {
+			return ""
+		}
+		sum := md5.Sum([]byte(v.DeviceID))
+		return hex.EncodeToString(sum[:])
+	case CampaignID:
+		return v.CampaignID
+	case Timestamp:
+		if v.Time.IsZero() {
+			return strconv.FormatInt(time.Now().UnixMilli(), 10)
+		}
+		return strconv.FormatInt(v.Time.UnixMilli(), 10)
+	case IP:
+		return v.IP
+	}
+	return ""
+}
+
+// Expander 宏替换器
+type Expander struct {
+	allowed map[string]bool
+}
+
+// NewExpander 创建宏替换器，allowlist为空时使用DefaultAllowlist
+func NewExpander(allowlist []string) (*Expander, error) {
+	if len(allowlist) == 0 {
+		allowlist = DefaultAllowlist
+	}
+
+	allowed := make(map[string]bool, len(allowlist))
+	for _, name := range allowlist {
+		name = strings.Trim(strings.ToUpper(strings.TrimSpace(name)), "{}")
+		if !isKnown(name) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownMacro, name)
+		}
+		allowed[name] = true
+	}
+	return &Expander{allowed: allowed}, nil
+}
+
+// Expand 替换URL中的宏
+func (e *Expander) Expand(rawURL string, values *Values) string {
+	if !strings.Contains(rawURL, "{") {
+		return rawURL
+	}
+
+	return pattern.ReplaceAllStringFunc(rawURL, func(token string) string {
+		name := token[1 : len(token)-1]
+		if !isKnown(name) {
+			return token
+		}
+		if !e.allowed[name] {
+			return ""
+		}
+		return url.QueryEscape(values.lookup(name))
+	})
+}
+
+// Validate 检查URL中的宏是否都受支持
+func Validate(rawURL string) error {
+	for _, match := range pattern.FindAllStringSubmatch(rawURL, -1) {
+		if !isKnown(match[1]) {
+			return fmt.Errorf("%w: %s", ErrUnknownMacro, match[0])
+		}
+	}
+	return nil
+}
+
+// isKnown 判断是否为支持的宏
+func isKnown(name string) bool {
+	for _, n := range Names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AdminUser 管理后台用户数据库模型，密码哈希和动态口令密钥不输出到JSON
+type AdminUser struct {
+	ID           string `gorm:"column:id;primary_key" json:"id"`
+	Username     string `gorm:"column:username" json:"username"`
+	PasswordHash string `gorm:"column:password_hash" json:"-"`
+	Role         string `gorm:"column:role" json:"role"`
+	// AdvertiserID 广告主用户所属的广告主，只能访问该广告主的数据，其他角色为空
+	AdvertiserID  string     `gorm:"column:advertiser_id" json:"advertiser_id,omitempty"`
+	TOTPSecret    string     `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabled   bool       `gorm:"column:totp_enabled" json:"totp_enabled"`
+	Enabled       bool       `gorm:"column:enabled" json:"enabled"`
+	LastLoginTime *time.Time `gorm:"column:last_login_time" json:"last_login_time,omitempty"`
+	UpdateTime    time.Time  `gorm:"column:update_time" json:"update_time"`
+	CreateTime    time.Time  `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (AdminUser) TableName() string {
+	return "admin_users"
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// AuctionFunnel 竞价漏斗，同一请求同一广告的出价、竞价成功、展示、点击和转化关联为一行
+// 各阶段的时间为首次到达的事件时间，未到达的阶段为nil
+type AuctionFunnel struct {
+	RequestID      string     `gorm:"column:request_id;primary_key" json:"request_id"`
+	AdID           string     `gorm:"column:ad_id;primary_key" json:"ad_id"`
+	Date           time.Time  `gorm:"column:date" json:"date"`
+	SlotID         string     `gorm:"column:slot_id" json:"slot_id"`
+	Exchange       string     `gorm:"column:exchange" json:"exchange"`
+	Size           string     `gorm:"column:size" json:"size,omitempty"`
+	BidPrice       *float64   `gorm:"column:bid_price" json:"bid_price,omitempty"`
+	WinPrice       *float64   `gorm:"column:win_price" json:"win_price,omitempty"`
+	BidTime        *time.Time `gorm:"column:bid_time" json:"bid_time,omitempty"`
+	WinTime        *time.Time `gorm:"column:win_time" json:"win_time,omitempty"`
+	ImpressionTime *time.Time `gorm:"column:impression_time" json:"impression_time,omitempty"`
+	ClickTime      *time.Time `gorm:"column:click_time" json:"click_time,omitempty"`
+	ConversionTime *time.Time `gorm:"column:conversion_time" json:"conversion_time,omitempty"`
+	UpdateTime     time.Time  `gorm:"column:update_time" json:"update_time"`
+}
+
+// TableName 返回表名
+func (AuctionFunnel) TableName() string {
+	return "auction_funnels"
+}
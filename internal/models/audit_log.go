@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AuditLog 操作审计日志数据库模型
+type AuditLog struct {
+	ID           uint64    `gorm:"column:id;primary_key;autoIncrement"`
+	Operator     string    `gorm:"column:operator"`
+	Action       string    `gorm:"column:action"`
+	ResourceType string    `gorm:"column:resource_type"`
+	ResourceID   string    `gorm:"column:resource_id"`
+	BatchID      string    `gorm:"column:batch_id"`
+	Before       JSON      `gorm:"column:before_data"`
+	After        JSON      `gorm:"column:after_data"`
+	CreateTime   time.Time `gorm:"column:create_time"`
+}
+
+// TableName 返回表名
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// AutomationRule 自动化优化规则数据库模型
+type AutomationRule struct {
+	ID              string    `gorm:"column:id;primary_key"`
+	Name            string    `gorm:"column:name"`
+	StrategyIDs     JSON      `gorm:"column:strategy_ids"`
+	Conditions      JSON      `gorm:"column:conditions"`
+	Action          JSON      `gorm:"column:action"`
+	WindowHours     int       `gorm:"column:window_hours"`
+	MinImpressions  int64     `gorm:"column:min_impressions"`
+	CooldownMinutes int       `gorm:"column:cooldown_minutes"`
+	DryRun          bool      `gorm:"column:dry_run"`
+	Enabled         bool      `gorm:"column:enabled"`
+	UpdateTime      time.Time `gorm:"column:update_time"`
+	CreateTime      time.Time `gorm:"column:create_time"`
+}
+
+// TableName 返回表名
+func (AutomationRule) TableName() string {
+	return "automation_rules"
+}
+
+// AutomationAction 自动化规则的操作记录，规则触发一次记录一条
+type AutomationAction struct {
+	ID          uint64    `gorm:"column:id;primary_key;autoIncrement" json:"id"`
+	RuleID      string    `gorm:"column:rule_id" json:"rule_id"`
+	StrategyID  string    `gorm:"column:strategy_id" json:"strategy_id"`
+	Action      string    `gorm:"column:action" json:"action"`
+	Status      string    `gorm:"column:status" json:"status"`
+	Reason      string    `gorm:"column:reason" json:"reason,omitempty"`
+	Metrics     JSON      `gorm:"column:metrics" json:"metrics"`
+	BeforePrice float64   `gorm:"column:before_price" json:"before_price"`
+	AfterPrice  float64   `gorm:"column:after_price" json:"after_price"`
+	CreateTime  time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (AutomationAction) TableName() string {
+	return "automation_actions"
+}
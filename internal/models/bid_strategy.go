@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// BidStrategy 出价策略数据库模型
+type BidStrategy struct {
+	ID                int64     `gorm:"column:id;primary_key;autoIncrement" json:"id"`
+	Name              string    `gorm:"column:name" json:"name"`
+	BidType           string    `gorm:"column:bid_type" json:"bid_type"`
+	Price             float64   `gorm:"column:price" json:"price"`
+	DailyBudget       int       `gorm:"column:daily_budget" json:"daily_budget"`
+	Status            int       `gorm:"column:status" json:"status"`
+	IsPriceLocked     bool      `gorm:"column:is_price_locked" json:"is_price_locked"`
+	Priority          int       `gorm:"column:priority" json:"priority"`
+	Weight            float64   `gorm:"column:weight" json:"weight"`
+	Category          string    `gorm:"column:category" json:"category"`
+	CampaignID        string    `gorm:"column:campaign_id" json:"campaign_id"`
+	ParticipationRate float64   `gorm:"column:participation_rate" json:"participation_rate"`
+	Dayparting        string    `gorm:"column:dayparting" json:"dayparting"`
+	CreatedAt         time.Time `gorm:"column:created_at" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"column:updated_at" json:"updated_at"`
+}
+
+// TableName 返回表名
+func (BidStrategy) TableName() string {
+	return "bid_strategies"
+}
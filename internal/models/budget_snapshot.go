@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// BudgetSnapshot 预算花费快照，按预算和周期保存，金额单位为分
+// 策略日预算的周期为续期周期，其他预算的周期从预算开始时间起算
+type BudgetSnapshot struct {
+	BudgetID    string    `gorm:"column:budget_id;primary_key" json:"budget_id"`
+	PeriodStart time.Time `gorm:"column:period_start;primary_key" json:"period_start"`
+	Spent       int64     `gorm:"column:spent" json:"spent"`
+	Fee         int64     `gorm:"column:fee" json:"fee"`
+	Tax         int64     `gorm:"column:tax" json:"tax"`
+	UpdateTime  time.Time `gorm:"column:update_time" json:"update_time"`
+}
+
+// TableName 返回表名
+func (BudgetSnapshot) TableName() string {
+	return "budget_snapshots"
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"time"
 
+	"gorm.io/gorm"
+
 	"simple-dsp/internal/campaign"
 )
 
@@ -23,6 +25,8 @@ type Campaign struct {
 	TrackingConfigs JSON      `gorm:"column:tracking_configs"`
 	UpdateTime      time.Time `gorm:"column:update_time"`
 	CreateTime      time.Time `gorm:"column:create_time"`
+	// DeletedAt 软删除时间，查询默认排除已删除的计划
+	DeletedAt gorm.DeletedAt `gorm:"column:deleted_at;index"`
 }
 
 // TableName 返回表名
@@ -60,6 +64,14 @@ func (j JSON) IsNull() bool {
 	return len(j) == 0 || string(j) == "null"
 }
 
+// MarshalJSON 原样输出JSON内容，避免被编码为base64字符串
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j.IsNull() {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
 // ToCampaignConfig 转换为广告计划配置
 func (c *Campaign) ToCampaignConfig() (*campaign.Config, error) {
 	config := &campaign.Config{
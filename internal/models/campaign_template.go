@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"simple-dsp/internal/campaign"
+)
+
+// CampaignTemplate 广告计划模板数据库模型
+type CampaignTemplate struct {
+	ID              string    `gorm:"column:id;primary_key"`
+	Name            string    `gorm:"column:name"`
+	AdvertiserID    string    `gorm:"column:advertiser_id"`
+	Budget          float64   `gorm:"column:budget"`
+	BidStrategy     string    `gorm:"column:bid_strategy"`
+	Targeting       JSON      `gorm:"column:targeting"`
+	TrackingConfigs JSON      `gorm:"column:tracking_configs"`
+	UpdateTime      time.Time `gorm:"column:update_time"`
+	CreateTime      time.Time `gorm:"column:create_time"`
+}
+
+// TableName 返回表名
+func (CampaignTemplate) TableName() string {
+	return "campaign_templates"
+}
+
+// ToTemplate 转换为广告计划模板
+func (t *CampaignTemplate) ToTemplate() (*campaign.Template, error) {
+	template := &campaign.Template{
+		ID:           t.ID,
+		Name:         t.Name,
+		AdvertiserID: t.AdvertiserID,
+		Budget:       t.Budget,
+		BidStrategy:  t.BidStrategy,
+		UpdateTime:   t.UpdateTime,
+		CreateTime:   t.CreateTime,
+	}
+
+	if !t.Targeting.IsNull() {
+		var targeting campaign.TargetingConfig
+		if err := json.Unmarshal(t.Targeting, &targeting); err != nil {
+			return nil, err
+		}
+		template.Targeting = &targeting
+	}
+
+	if !t.TrackingConfigs.IsNull() {
+		var trackingConfigs map[campaign.TrackingType]*campaign.TrackingConfig
+		if err := json.Unmarshal(t.TrackingConfigs, &trackingConfigs); err != nil {
+			return nil, err
+		}
+		template.TrackingConfigs = trackingConfigs
+	}
+
+	return template, nil
+}
+
+// FromTemplate 从广告计划模板转换
+func (t *CampaignTemplate) FromTemplate(template *campaign.Template) error {
+	t.ID = template.ID
+	t.Name = template.Name
+	t.AdvertiserID = template.AdvertiserID
+	t.Budget = template.Budget
+	t.BidStrategy = template.BidStrategy
+	t.UpdateTime = template.UpdateTime
+	t.CreateTime = template.CreateTime
+
+	if template.Targeting != nil {
+		targeting, err := json.Marshal(template.Targeting)
+		if err != nil {
+			return err
+		}
+		t.Targeting = targeting
+	}
+
+	if template.TrackingConfigs != nil {
+		trackingConfigs, err := json.Marshal(template.TrackingConfigs)
+		if err != nil {
+			return err
+		}
+		t.TrackingConfigs = trackingConfigs
+	}
+
+	return nil
+}
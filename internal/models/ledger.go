@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// LedgerEntry 账本流水数据库模型，只追加不修改，金额单位为分
+// 拆分了费用构成的流水，Amount为媒体成本、平台服务费和税费之和
+type LedgerEntry struct {
+	ID             uint64    `gorm:"column:id;primary_key;autoIncrement" json:"id"`
+	AdvertiserID   string    `gorm:"column:advertiser_id" json:"advertiser_id"`
+	Type           string    `gorm:"column:type" json:"type"`
+	Amount         int64     `gorm:"column:amount" json:"amount"`
+	MediaCost      int64     `gorm:"column:media_cost" json:"media_cost"`
+	Fee            int64     `gorm:"column:fee" json:"fee"`
+	Tax            int64     `gorm:"column:tax" json:"tax"`
+	IdempotencyKey string    `gorm:"column:idempotency_key" json:"idempotency_key"`
+	CampaignID     string    `gorm:"column:campaign_id" json:"campaign_id,omitempty"`
+	AdID           string    `gorm:"column:ad_id" json:"ad_id,omitempty"`
+	Reference      string    `gorm:"column:reference" json:"reference,omitempty"`
+	Description    string    `gorm:"column:description" json:"description,omitempty"`
+	Operator       string    `gorm:"column:operator" json:"operator,omitempty"`
+	OccurTime      time.Time `gorm:"column:occur_time" json:"occur_time"`
+	CreateTime     time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (LedgerEntry) TableName() string {
+	return "ledger_entries"
+}
+
+// LedgerDailyBalance 广告主的日终余额，金额单位为分
+// MediaCost、Fee、Tax为当天各类流水费用构成的合计，未拆分的流水不计入
+type LedgerDailyBalance struct {
+	AdvertiserID string    `gorm:"column:advertiser_id;primary_key" json:"advertiser_id"`
+	Date         time.Time `gorm:"column:date;primary_key" json:"date"`
+	Opening      int64     `gorm:"column:opening" json:"opening"`
+	Spend        int64     `gorm:"column:spend" json:"spend"`
+	Refund       int64     `gorm:"column:refund" json:"refund"`
+	Adjustment   int64     `gorm:"column:adjustment" json:"adjustment"`
+	Closing      int64     `gorm:"column:closing" json:"closing"`
+	MediaCost    int64     `gorm:"column:media_cost" json:"media_cost"`
+	Fee          int64     `gorm:"column:fee" json:"fee"`
+	Tax          int64     `gorm:"column:tax" json:"tax"`
+	EntryCount   int64     `gorm:"column:entry_count" json:"entry_count"`
+	CreateTime   time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (LedgerDailyBalance) TableName() string {
+	return "ledger_daily_balances"
+}
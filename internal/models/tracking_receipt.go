@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// TrackingReceipt 跟踪事件的一次投递记录，用于排查广告主收不到回传的原因
+// 每次投递尝试一行，熔断推迟和未尝试就放弃的事件也记录一行，此时status_code为0
+type TrackingReceipt struct {
+	ID         int64  `gorm:"column:id;primary_key;autoIncrement" json:"id"`
+	JobID      string `gorm:"column:job_id" json:"job_id"`
+	CampaignID string `gorm:"column:campaign_id" json:"campaign_id"`
+	EventType  string `gorm:"column:event_type" json:"event_type"`
+	ClickID    string `gorm:"column:click_id" json:"click_id,omitempty"`
+	// Attempt 第几次投递，未尝试就放弃或推迟时为已尝试的次数
+	Attempt int    `gorm:"column:attempt" json:"attempt"`
+	Method  string `gorm:"column:method" json:"method,omitempty"`
+	// URL 替换宏之后的跟踪地址
+	URL        string `gorm:"column:url" json:"url,omitempty"`
+	StatusCode int    `gorm:"column:status_code" json:"status_code"`
+	// Result 投递结果：delivered、retrying、deferred或dropped
+	Result string `gorm:"column:result" json:"result"`
+	// Reason 放弃的原因：max_age、max_retries、disabled或circuit_open
+	Reason     string    `gorm:"column:reason" json:"reason,omitempty"`
+	Error      string    `gorm:"column:error" json:"error,omitempty"`
+	DurationMs int64     `gorm:"column:duration_ms" json:"duration_ms"`
+	CreateTime time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (TrackingReceipt) TableName() string {
+	return "tracking_receipts"
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// WebhookSubscription Webhook订阅数据库模型
+type WebhookSubscription struct {
+	ID         string    `gorm:"column:id;primary_key"`
+	Name       string    `gorm:"column:name"`
+	URL        string    `gorm:"column:url"`
+	Secret     string    `gorm:"column:secret"`
+	Events     JSON      `gorm:"column:events"`
+	Enabled    bool      `gorm:"column:enabled"`
+	UpdateTime time.Time `gorm:"column:update_time"`
+	CreateTime time.Time `gorm:"column:create_time"`
+}
+
+// TableName 返回表名
+func (WebhookSubscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// WebhookDelivery Webhook投递记录数据库模型，每次尝试一条
+type WebhookDelivery struct {
+	ID             uint64    `gorm:"column:id;primary_key;autoIncrement" json:"id"`
+	SubscriptionID string    `gorm:"column:subscription_id" json:"subscription_id"`
+	EventID        string    `gorm:"column:event_id" json:"event_id"`
+	EventType      string    `gorm:"column:event_type" json:"event_type"`
+	Attempt        int       `gorm:"column:attempt" json:"attempt"`
+	StatusCode     int       `gorm:"column:status_code" json:"status_code"`
+	Success        bool      `gorm:"column:success" json:"success"`
+	Error          string    `gorm:"column:error" json:"error,omitempty"`
+	DurationMs     int64     `gorm:"column:duration_ms" json:"duration_ms"`
+	Payload        JSON      `gorm:"column:payload" json:"payload"`
+	CreateTime     time.Time `gorm:"column:create_time" json:"create_time"`
+}
+
+// TableName 返回表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
@@ -0,0 +1,8 @@
+package pixel
+
+import "errors"
+
+var (
+	// ErrInvalidPixel 表示广告主ID或人群名称无效
+	ErrInvalidPixel = errors.New("无效的广告主ID或人群名称")
+)
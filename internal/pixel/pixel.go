@@ -0,0 +1,222 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: pixel.go
+ * Project: simple-dsp
+ * Description: 再营销像素，收集广告主网站访客并加入广告主的人群
+ *
+ * 主要功能:
+ * - 1x1透明GIF像素，记录访客到广告主的人群
+ * - JS标签，在页面中加载像素并透传同意参数
+ * - 按同意信号决定是否记录访客和写入Cookie，同意信号的判断见reqctx.Consent
+ *
+ * 实现细节:
+ * - 人群存储在人群包中，ID为pixel:{advertiser}:{audience}
+ * - 访客ID优先使用uid参数，其次使用Cookie，都没有时生成新ID写入Cookie
+ * - 每次访问刷新访客的加入时间，超过成员有效期的访客被移除
+ *
+ * 注意事项:
+ * - 无论是否记录成功都返回像素，避免影响广告主页面
+ * - Cookie生成的访客ID需要与交易平台做Cookie映射后才能用于竞价定向
+ * - 未同意的访客不写入Cookie
+ */
+
+package pixel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/internal/segment"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/reqctx"
+)
+
+const (
+	// CookieName 访客ID的Cookie名称
+	CookieName = "dsp_uid"
+	// DefaultAudience 未指定人群时访客加入的人群
+	DefaultAudience = "visitors"
+	// DefaultMembershipTTL 默认成员有效期
+	DefaultMembershipTTL = 30 * 24 * time.Hour
+
+	// maxAudiences 单次访问最多加入的人群数
+	maxAudiences = 10
+	// cookieMaxAge Cookie有效期(秒)
+	cookieMaxAge = 365 * 24 * 3600
+	// defaultTimeout 写入人群的默认超时时间
+	defaultTimeout = 200 * time.Millisecond
+)
+
+// 像素处理结果标签
+const (
+	resultRecorded  = "recorded"
+	resultNoConsent = "no_consent"
+	resultInvalid   = "invalid"
+	resultError     = "error"
+)
+
+// namePattern 广告主ID和人群名称的格式
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// transparentGIF 1x1透明GIF
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// tagTemplate JS标签模板，读取script标签的data属性作为像素参数
+const tagTemplate = `(function(){var s=document.currentScript;if(!s)return;` +
+	`var p={a:"data-audience",uid:"data-uid",consent:"data-consent",gdpr:"data-gdpr",gdpr_consent:"data-gdpr-consent",us_privacy:"data-us-privacy"};` +
+	`var q="gpc="+(navigator.globalPrivacyControl?1:0)+"&r="+Date.now();` +
+	`for(var k in p){var v=s.getAttribute(p[k]);if(v)q+="&"+k+"="+encodeURIComponent(v);}` +
+	`var i=new Image(1,1);i.src=new URL(s.src).origin+"/pixel/%s?"+q;})();`
+
+// ValidName 判断广告主ID或人群名称是否有效
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Handler 再营销像素处理器
+type Handler struct {
+	store        segment.Store
+	ttl          time.Duration
+	timeout      time.Duration
+	cookieDomain string
+	logger       *logger.Logger
+	metrics      *metrics.Metrics
+}
+
+// NewHandler 创建再营销像素处理器
+func NewHandler(store segment.Store, cfg config.PixelConfig, logger *logger.Logger, metrics *metrics.Metrics) *Handler {
+	if cfg.MembershipTTL <= 0 {
+		cfg.MembershipTTL = DefaultMembershipTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Handler{
+		store:        store,
+		ttl:          cfg.MembershipTTL,
+		timeout:      cfg.Timeout,
+		cookieDomain: cfg.CookieDomain,
+		logger:       logger,
+		metrics:      metrics,
+	}
+}
+
+// ServePixel 记录访客并返回1x1透明GIF
+// 参数a为逗号分隔的人群名称，默认为visitors；uid为广告主传入的访客ID
+func (h *Handler) ServePixel(c *gin.Context) {
+	advertiserID := c.Param("advertiser")
+	audiences, ok := parseAudiences(c.Query("a"))
+	if !ValidName(advertiserID) || !ok {
+		h.metrics.Events.PixelHits.WithLabelValues(resultInvalid).Inc()
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidPixel.Error()})
+		return
+	}
+
+	// 同意状态由middleware.RequestContext写入上下文，未经过该中间件时从请求中解析
+	consent, ok := reqctx.ConsentFrom(c.Request.Context())
+	if !ok {
+		consent = reqctx.ParseConsent(c.Request)
+	}
+	if !consent.Allowed() {
+		h.metrics.Events.PixelHits.WithLabelValues(resultNoConsent).Inc()
+		writeGIF(c)
+		return
+	}
+
+	userID, err := h.visitorID(c)
+	if err != nil {
+		h.metrics.Events.PixelHits.WithLabelValues(resultError).Inc()
+		h.logger.Error("生成访客ID失败", "error", err)
+		writeGIF(c)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeout)
+	defer cancel()
+	for _, audience := range audiences {
+		if err := h.store.Add(ctx, segment.AudienceID(advertiserID, audience), userID, h.ttl); err != nil {
+			h.metrics.Events.PixelHits.WithLabelValues(resultError).Inc()
+			h.logger.Error("记录再营销访客失败",
+				"advertiser_id", advertiserID,
+				"audience", audience,
+				"error", err)
+			writeGIF(c)
+			return
+		}
+	}
+
+	h.metrics.Events.PixelHits.WithLabelValues(resultRecorded).Inc()
+	writeGIF(c)
+}
+
+// ServeTag 返回加载像素的JS标签
+func (h *Handler) ServeTag(c *gin.Context) {
+	advertiserID := c.Param("advertiser")
+	if !ValidName(advertiserID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidPixel.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/javascript; charset=utf-8", []byte(fmt.Sprintf(tagTemplate, advertiserID)))
+}
+
+// visitorID 获取访客ID，没有时生成新ID并写入Cookie
+func (h *Handler) visitorID(c *gin.Context) (string, error) {
+	if uid := c.Query("uid"); uid != "" {
+		return uid, nil
+	}
+	if uid, err := c.Cookie(CookieName); err == nil && uid != "" {
+		return uid, nil
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	uid := hex.EncodeToString(b[:])
+	// 像素在广告主页面以第三方请求加载，需要SameSite=None
+	c.SetSameSite(http.SameSiteNoneMode)
+	c.SetCookie(CookieName, uid, cookieMaxAge, "/", h.cookieDomain, true, true)
+	return uid, nil
+}
+
+// parseAudiences 解析人群名称列表，为空时返回默认人群
+func parseAudiences(value string) ([]string, bool) {
+	if value == "" {
+		return []string{DefaultAudience}, true
+	}
+
+	names := strings.Split(value, ",")
+	if len(names) > maxAudiences {
+		return nil, false
+	}
+	for _, name := range names {
+		if !ValidName(name) {
+			return nil, false
+		}
+	}
+	return names, true
+}
+
+// writeGIF 返回不缓存的透明像素
+func writeGIF(c *gin.Context) {
+	c.Header("Cache-Control", "no-store, no-cache, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Data(http.StatusOK, "image/gif", transparentGIF)
+}
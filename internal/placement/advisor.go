@@ -0,0 +1,130 @@
+package placement
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/floor"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// loadTimeout 从Redis加载汇总结果的超时时间
+const loadTimeout = 30 * time.Second
+
+// Advisor 竞价服务使用的供应路径表现，按供应路径的CTR调整出价
+type Advisor struct {
+	cfg    config.PlacementConfig
+	store  *Store
+	logger *logger.Logger
+
+	mu         sync.RWMutex
+	stats      map[Key]Stats
+	overallCTR float64
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewAdvisor 创建供应路径出价调整，未设置的参数使用默认值
+func NewAdvisor(cfg config.PlacementConfig, store *Store, logger *logger.Logger) *Advisor {
+	return &Advisor{
+		cfg:    withDefaults(cfg),
+		store:  store,
+		logger: logger,
+		stats:  make(map[Key]Stats),
+	}
+}
+
+// Start 加载一次汇总结果并启动定时重新加载，首次加载失败时不调整出价
+func (a *Advisor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancelFunc = cancel
+
+	a.reload(ctx)
+	a.wg.Add(1)
+	go a.reloadLoop(ctx)
+}
+
+// Stop 停止定时重新加载
+func (a *Advisor) Stop() {
+	if a.cancelFunc == nil {
+		return
+	}
+	a.cancelFunc()
+	a.wg.Wait()
+}
+
+// Load 从Redis加载汇总结果替换本地数据，尚未汇总时清空本地数据
+func (a *Advisor) Load(ctx context.Context) error {
+	meta, items, err := a.store.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	stats := make(map[Key]Stats, len(items))
+	var overallCTR float64
+	if meta != nil {
+		overallCTR = meta.Overall.CTR
+		for _, item := range items {
+			stats[item.Key] = item
+		}
+	}
+
+	a.mu.Lock()
+	a.stats = stats
+	a.overallCTR = overallCTR
+	a.mu.Unlock()
+	return nil
+}
+
+// Multiplier 返回供应路径的出价调整系数，没有数据或展示数不足时返回1
+// 系数为供应路径CTR/整体CTR，限制在[MinMultiplier, MaxMultiplier]内
+func (a *Advisor) Multiplier(key Key) float64 {
+	a.mu.RLock()
+	s, ok := a.stats[key]
+	overallCTR := a.overallCTR
+	a.mu.RUnlock()
+
+	if !ok || s.Impressions < a.cfg.MinImpressions || overallCTR <= 0 {
+		return 1
+	}
+	return min(max(s.CTR/overallCTR, a.cfg.MinMultiplier), a.cfg.MaxMultiplier)
+}
+
+// AdjustBid 按广告位所在供应路径的历史CTR调整出价
+func (a *Advisor) AdjustBid(exchange string, slot bidding.AdSlot, price float64) float64 {
+	return price * a.Multiplier(Key{
+		Exchange:  exchange,
+		Placement: slot.SlotID,
+		Size:      floor.FormatSize(slot.Width, slot.Height),
+	})
+}
+
+// reloadLoop 定时重新加载汇总结果
+func (a *Advisor) reloadLoop(ctx context.Context) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.reload(ctx)
+		}
+	}
+}
+
+// reload 重新加载一次，失败时保留已加载的数据
+func (a *Advisor) reload(ctx context.Context) {
+	loadCtx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+	if err := a.Load(loadCtx); err != nil && ctx.Err() == nil {
+		a.logger.Error("加载供应路径表现失败", "error", err)
+	}
+}
@@ -0,0 +1,8 @@
+package placement
+
+import "errors"
+
+var (
+	// ErrInvalidSort 表示排序字段无效
+	ErrInvalidSort = errors.New("无效的排序字段，可选impressions、bids、win_rate、ctr、cvr")
+)
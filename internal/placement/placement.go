@@ -0,0 +1,307 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: placement.go
+ * Project: simple-dsp
+ * Description: 供应路径表现，按(交易平台, 广告位, 尺寸)汇总历史胜率、CTR和CVR
+ *
+ * 主要功能:
+ * - 管理后台定时从竞价漏斗汇总最近几天各供应路径的出价、竞价成功、展示、点击和转化
+ * - 汇总结果整体写入Redis，供分析查询和竞价服务使用
+ * - 竞价服务按供应路径CTR相对整体CTR的比值调整出价
+ * - 按条件过滤和排序，辅助运营决定屏蔽哪些广告位
+ *
+ * 实现细节:
+ * - 汇总结果先写入临时哈希再改名，读取方不会看到写了一半的数据
+ * - 竞价服务定时把整个哈希加载到本地内存，竞价路径不访问Redis
+ * - 展示数不足的供应路径不调整出价，调整系数限制在配置的范围内
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - gorm.io/gorm
+ * - simple-dsp/internal/bidding
+ * - simple-dsp/internal/floor
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/lock
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 点击和转化没有携带广告位，通过漏斗按(request_id, ad_id)关联到出价时的广告位
+ * - 竞价漏斗启用之前和添加尺寸之前的出价没有尺寸，汇总时计入空尺寸
+ * - 汇总天数不应超过漏斗数据的保留天数
+ */
+
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/config"
+)
+
+const (
+	// statsKey 各供应路径的汇总结果，字段为exchange|placement|size，值为JSON
+	statsKey = "placement:stats"
+	// statsTmpKey 写入汇总结果时使用的临时哈希
+	statsTmpKey = "placement:stats:tmp"
+	// metaKey 汇总时间、起始日期和整体表现
+	metaKey = "placement:stats:meta"
+	// writeBatch 每批写入临时哈希的字段数
+	writeBatch = 500
+
+	defaultLookbackDays    = 7
+	defaultRefreshInterval = 10 * time.Minute
+	defaultMinImpressions  = 1000
+	defaultMinMultiplier   = 0.5
+	defaultMaxMultiplier   = 1.5
+)
+
+// 排序字段
+const (
+	SortImpressions = "impressions"
+	SortBids        = "bids"
+	SortWinRate     = "win_rate"
+	SortCTR         = "ctr"
+	SortCVR         = "cvr"
+)
+
+// Key 供应路径维度
+type Key struct {
+	Exchange  string `json:"exchange"`
+	Placement string `json:"placement"`
+	Size      string `json:"size"`
+}
+
+// Stats 供应路径的历史表现
+type Stats struct {
+	Key
+	Bids        int64 `json:"bids"`
+	Wins        int64 `json:"wins"`
+	Impressions int64 `json:"impressions"`
+	Clicks      int64 `json:"clicks"`
+	Conversions int64 `json:"conversions"`
+	// WinRate 竞价成功数/出价数
+	WinRate float64 `json:"win_rate"`
+	// CTR 点击数/展示数
+	CTR float64 `json:"ctr"`
+	// CVR 转化数/点击数
+	CVR float64 `json:"cvr"`
+	// CTRIndex 供应路径CTR/整体CTR，大于1表示点击率高于整体
+	CTRIndex float64 `json:"ctr_index"`
+}
+
+// Calculate 根据计数计算比率，overallCTR为0时不计算CTRIndex
+func (s *Stats) Calculate(overallCTR float64) {
+	s.WinRate, s.CTR, s.CVR, s.CTRIndex = 0, 0, 0, 0
+	if s.Bids > 0 {
+		s.WinRate = float64(s.Wins) / float64(s.Bids)
+	}
+	if s.Impressions > 0 {
+		s.CTR = float64(s.Clicks) / float64(s.Impressions)
+	}
+	if s.Clicks > 0 {
+		s.CVR = float64(s.Conversions) / float64(s.Clicks)
+	}
+	if overallCTR > 0 {
+		s.CTRIndex = s.CTR / overallCTR
+	}
+}
+
+// Meta 一次汇总的元信息
+type Meta struct {
+	// UpdateTime 汇总时间
+	UpdateTime time.Time `json:"update_time"`
+	// Since 汇总的起始日期，YYYY-MM-DD
+	Since string `json:"since"`
+	// Overall 所有供应路径合计的表现
+	Overall Stats `json:"overall"`
+}
+
+// Filter 查询条件
+type Filter struct {
+	Exchange  string
+	Placement string
+	Size      string
+	// MinImpressions 只返回展示数不少于该值的供应路径
+	MinImpressions int64
+	// Sort 排序字段，默认impressions
+	Sort string
+	// Ascending 是否升序，默认降序
+	Ascending bool
+}
+
+// match 判断供应路径是否满足查询条件
+func (f Filter) match(s Stats) bool {
+	return (f.Exchange == "" || f.Exchange == s.Exchange) &&
+		(f.Placement == "" || f.Placement == s.Placement) &&
+		(f.Size == "" || f.Size == s.Size) &&
+		s.Impressions >= f.MinImpressions
+}
+
+// sortValue 返回排序字段的值
+func sortValue(s Stats, field string) float64 {
+	switch field {
+	case SortBids:
+		return float64(s.Bids)
+	case SortWinRate:
+		return s.WinRate
+	case SortCTR:
+		return s.CTR
+	case SortCVR:
+		return s.CVR
+	default:
+		return float64(s.Impressions)
+	}
+}
+
+// Store 供应路径表现的Redis存储
+type Store struct {
+	redis *redis.Client
+}
+
+// NewStore 创建供应路径表现存储
+func NewStore(redisClient *redis.Client) *Store {
+	return &Store{redis: redisClient}
+}
+
+// Save 整体替换汇总结果，items为空时清空
+func (s *Store) Save(ctx context.Context, meta Meta, items []Stats) error {
+	metaValue, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("编码供应路径汇总信息失败: %w", err)
+	}
+
+	if len(items) == 0 {
+		_, err := s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, statsKey)
+			pipe.Set(ctx, metaKey, metaValue, 0)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("写入供应路径表现失败: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.redis.Del(ctx, statsTmpKey).Err(); err != nil {
+		return fmt.Errorf("清理供应路径临时数据失败: %w", err)
+	}
+	for start := 0; start < len(items); start += writeBatch {
+		end := min(start+writeBatch, len(items))
+		values := make([]interface{}, 0, 2*(end-start))
+		for _, item := range items[start:end] {
+			value, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("编码供应路径表现失败: %w", err)
+			}
+			values = append(values, encodeKey(item.Key), value)
+		}
+		if err := s.redis.HSet(ctx, statsTmpKey, values...).Err(); err != nil {
+			return fmt.Errorf("写入供应路径表现失败: %w", err)
+		}
+	}
+
+	_, err = s.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Rename(ctx, statsTmpKey, statsKey)
+		pipe.Set(ctx, metaKey, metaValue, 0)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("替换供应路径表现失败: %w", err)
+	}
+	return nil
+}
+
+// Load 读取全部汇总结果，尚未汇总时meta为nil
+func (s *Store) Load(ctx context.Context) (*Meta, []Stats, error) {
+	pipe := s.redis.Pipeline()
+	metaCmd := pipe.Get(ctx, metaKey)
+	statsCmd := pipe.HGetAll(ctx, statsKey)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, fmt.Errorf("读取供应路径表现失败: %w", err)
+	}
+
+	metaValue, err := metaCmd.Bytes()
+	if err == redis.Nil {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取供应路径汇总信息失败: %w", err)
+	}
+	var meta Meta
+	if err := json.Unmarshal(metaValue, &meta); err != nil {
+		return nil, nil, fmt.Errorf("解析供应路径汇总信息失败: %w", err)
+	}
+
+	fields := statsCmd.Val()
+	items := make([]Stats, 0, len(fields))
+	for _, value := range fields {
+		var item Stats
+		if err := json.Unmarshal([]byte(value), &item); err != nil {
+			continue
+		}
+		items = append(items, item)
+	}
+	return &meta, items, nil
+}
+
+// Query 按条件过滤和排序汇总结果，尚未汇总时meta为nil
+func (s *Store) Query(ctx context.Context, filter Filter) (*Meta, []Stats, error) {
+	switch filter.Sort {
+	case "", SortImpressions, SortBids, SortWinRate, SortCTR, SortCVR:
+	default:
+		return nil, nil, ErrInvalidSort
+	}
+
+	meta, items, err := s.Load(ctx)
+	if err != nil || meta == nil {
+		return meta, nil, err
+	}
+
+	result := make([]Stats, 0, len(items))
+	for _, item := range items {
+		if filter.match(item) {
+			result = append(result, item)
+		}
+	}
+	// 相同值按维度排序，保证分页结果稳定
+	sort.Slice(result, func(i, j int) bool {
+		vi, vj := sortValue(result[i], filter.Sort), sortValue(result[j], filter.Sort)
+		if vi != vj {
+			return (vi < vj) == filter.Ascending
+		}
+		return encodeKey(result[i].Key) < encodeKey(result[j].Key)
+	})
+	return meta, result, nil
+}
+
+// withDefaults 使用默认值补全未设置的参数
+func withDefaults(cfg config.PlacementConfig) config.PlacementConfig {
+	if cfg.LookbackDays <= 0 {
+		cfg.LookbackDays = defaultLookbackDays
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.MinImpressions <= 0 {
+		cfg.MinImpressions = defaultMinImpressions
+	}
+	if cfg.MinMultiplier <= 0 || cfg.MinMultiplier > 1 {
+		cfg.MinMultiplier = defaultMinMultiplier
+	}
+	if cfg.MaxMultiplier < 1 {
+		cfg.MaxMultiplier = defaultMaxMultiplier
+	}
+	return cfg
+}
+
+// encodeKey 编码供应路径维度，使用不会出现在ID中的分隔符
+func encodeKey(key Key) string {
+	return key.Exchange + "|" + key.Placement + "|" + key.Size
+}
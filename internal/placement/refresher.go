@@ -0,0 +1,167 @@
+package placement
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// refreshLockName 定时汇总的分布式锁
+	refreshLockName = "placement:refresh"
+	refreshTimeout  = 5 * time.Minute
+)
+
+// Source 供应路径表现的数据来源
+type Source interface {
+	// Aggregate 按供应路径汇总日期不早于since的数据，只需要填充计数
+	Aggregate(ctx context.Context, since string) ([]Stats, error)
+}
+
+// GormSource 从竞价漏斗汇总供应路径表现
+type GormSource struct {
+	db *gorm.DB
+}
+
+// NewGormSource 创建基于竞价漏斗的数据来源
+func NewGormSource(db *gorm.DB) *GormSource {
+	return &GormSource{db: db}
+}
+
+// Aggregate 按(交易平台, 广告位, 尺寸)汇总竞价漏斗，各阶段为到达该阶段的竞价数
+func (s *GormSource) Aggregate(ctx context.Context, since string) ([]Stats, error) {
+	var rows []Stats
+	err := s.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "placement.aggregate"))).
+		Model(&models.AuctionFunnel{}).
+		Select(`exchange, slot_id AS placement, size,
+			COUNT(bid_time) AS bids, COUNT(win_time) AS wins, COUNT(impression_time) AS impressions,
+			COUNT(click_time) AS clicks, COUNT(conversion_time) AS conversions`).
+		Where("date >= ? AND exchange <> '' AND slot_id <> ''", since).
+		Group("exchange, slot_id, size").
+		Scan(&rows).Error
+	return rows, err
+}
+
+// Refresher 定时汇总供应路径表现并写入Redis
+type Refresher struct {
+	cfg    config.PlacementConfig
+	source Source
+	store  *Store
+	locker *lock.Locker
+	logger *logger.Logger
+	// clock 计算汇总起始日期的时间来源
+	clock clock.Clock
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewRefresher 创建供应路径表现汇总，未设置的参数使用默认值
+func NewRefresher(cfg config.PlacementConfig, source Source, store *Store, logger *logger.Logger) *Refresher {
+	return &Refresher{
+		cfg:    withDefaults(cfg),
+		source: source,
+		store:  store,
+		logger: logger,
+		clock:  clock.Real(),
+	}
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时汇总
+func (r *Refresher) SetLocker(locker *lock.Locker) {
+	r.locker = locker
+}
+
+// SetClock 设置计算汇总起始日期的时间来源，为nil时使用系统时钟
+func (r *Refresher) SetClock(c clock.Clock) {
+	r.clock = clock.OrReal(c)
+}
+
+// Start 启动定时汇总，启动后立即汇总一次
+func (r *Refresher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelFunc = cancel
+
+	r.wg.Add(1)
+	go r.runLoop(ctx)
+}
+
+// Stop 停止定时汇总
+func (r *Refresher) Stop() {
+	if r.cancelFunc == nil {
+		return
+	}
+	r.cancelFunc()
+	r.wg.Wait()
+}
+
+// RunOnce 汇总最近LookbackDays天(含当天)的供应路径表现并整体替换Redis中的结果
+func (r *Refresher) RunOnce(ctx context.Context) (*Meta, error) {
+	now := r.clock.Now()
+	y, m, d := now.Local().Date()
+	since := time.Date(y, m, d, 0, 0, 0, 0, time.Local).AddDate(0, 0, -(r.cfg.LookbackDays - 1)).Format("2006-01-02")
+
+	items, err := r.source.Aggregate(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := Meta{UpdateTime: now, Since: since}
+	for _, item := range items {
+		meta.Overall.Bids += item.Bids
+		meta.Overall.Wins += item.Wins
+		meta.Overall.Impressions += item.Impressions
+		meta.Overall.Clicks += item.Clicks
+		meta.Overall.Conversions += item.Conversions
+	}
+	meta.Overall.Calculate(0)
+	for i := range items {
+		items[i].Calculate(meta.Overall.CTR)
+	}
+
+	if err := r.store.Save(ctx, meta, items); err != nil {
+		return nil, err
+	}
+	r.logger.Info("供应路径表现汇总完成", "since", since, "placements", len(items), "impressions", meta.Overall.Impressions)
+	return &meta, nil
+}
+
+// runLoop 定时汇总供应路径表现
+func (r *Refresher) runLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		r.refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh 持有锁时汇总一次，失败只记录日志
+func (r *Refresher) refresh(ctx context.Context) {
+	runCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+	err := r.locker.Do(runCtx, refreshLockName, func(ctx context.Context) error {
+		_, err := r.RunOnce(ctx)
+		return err
+	})
+	if err != nil && !errors.Is(err, lock.ErrNotAcquired) && ctx.Err() == nil {
+		r.logger.Error("汇总供应路径表现失败", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: decrypter.go
+ * Project: simple-dsp
+ * Description: 成交价解密，支持Google风格的加密AUCTION_PRICE
+ *
+ * 主要功能:
+ * - 按交易平台配置价格加解密密钥
+ * - 解密并校验成交价
+ * - 支持密钥轮换
+ *
+ * 实现细节:
+ * - 密文格式: websafe-base64(iv[16] || enc_price[8] || signature[4])
+ * - pad = HMAC-SHA1(encryption_key, iv)[:8]，price = enc_price XOR pad
+ * - signature = HMAC-SHA1(integrity_key, price || iv)[:4]
+ * - 价格单位为微分(micros)，解密后转换为CPM货币单位
+ * - 同一交易平台可配置多组密钥，按顺序尝试，第一组为当前密钥
+ *
+ * 依赖关系:
+ * - crypto/hmac
+ * - crypto/sha1
+ *
+ * 注意事项:
+ * - 未配置密钥的交易平台按明文价格处理，配置了密钥的交易平台拒绝明文价格
+ * - 交易平台必须来自可信来源(出价记录或请求上下文)，不能由回调参数指定
+ * - 密钥轮换期间需同时保留新旧密钥
+ */
+
+package pricing
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"simple-dsp/pkg/config"
+)
+
+const (
+	ivSize        = 16
+	priceSize     = 8
+	signatureSize = 4
+	cipherSize    = ivSize + priceSize + signatureSize
+
+	// microsPerUnit 每货币单位对应的微分数
+	microsPerUnit = 1e6
+)
+
+// KeyPair 价格加解密密钥对
+type KeyPair struct {
+	EncryptionKey []byte
+	IntegrityKey  []byte
+}
+
+// Decrypter 成交价解密器
+type Decrypter struct {
+	mu   sync.RWMutex
+	keys map[string][]KeyPair
+}
+
+// NewDecrypter 创建成交价解密器
+func NewDecrypter() *Decrypter {
+	return &Decrypter{
+		keys: make(map[string][]KeyPair),
+	}
+}
+
+// NewDecrypterFromConfig 根据配置创建解密器，密钥为websafe base64编码
+func NewDecrypterFromConfig(cfg map[string][]config.PriceKeyConfig) (*Decrypter, error) {
+	d := NewDecrypter()
+	for exchange, keyConfigs := range cfg {
+		keys := make([]KeyPair, 0, len(keyConfigs))
+		for i, kc := range keyConfigs {
+			encKey, err := decodeBase64(kc.EncryptionKey)
+			if err != nil || len(encKey) == 0 {
+				return nil, fmt.Errorf("交易平台%s第%d组加密密钥: %w", exchange, i, ErrInvalidKey)
+			}
+			intKey, err := decodeBase64(kc.IntegrityKey)
+			if err != nil || len(intKey) == 0 {
+				return nil, fmt.Errorf("交易平台%s第%d组校验密钥: %w", exchange, i, ErrInvalidKey)
+			}
+			keys = append(keys, KeyPair{EncryptionKey: encKey, IntegrityKey: intKey})
+		}
+		d.SetKeys(exchange, keys)
+	}
+	return d, nil
+}
+
+// SetKeys 设置交易平台的密钥列表，第一组为当前密钥，其余为轮换期间保留的旧密钥
+func (d *Decrypter) SetKeys(exchange string, keys []KeyPair) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(keys) == 0 {
+		delete(d.keys, exchange)
+		return
+	}
+	d.keys[exchange] = append([]KeyPair(nil), keys...)
+}
+
+// Decrypt 解密成交价，返回CPM货币单位的价格
+// 未配置密钥的交易平台按明文解析，配置了密钥的交易平台上报明文价格时返回ErrPlaintextPrice
+func (d *Decrypter) Decrypt(exchange, value string) (float64, error) {
+	d.mu.RLock()
+	keys := d.keys[exchange]
+	d.mu.RUnlock()
+
+	if len(keys) == 0 {
+		return parsePlainPrice(value)
+	}
+	if _, err := parsePlainPrice(value); err == nil {
+		return 0, ErrPlaintextPrice
+	}
+
+	data, err := decodeBase64(value)
+	if err != nil || len(data) != cipherSize {
+		return 0, ErrInvalidCiphertext
+	}
+
+	for _, key := range keys {
+		if micros, ok := decryptWith(key, data); ok {
+			return float64(micros) / microsPerUnit, nil
+		}
+	}
+	return 0, ErrSignatureMismatch
+}
+
+// Encrypt 使用指定密钥和初始向量加密价格，用于测试和模拟交易平台
+func Encrypt(key KeyPair, iv []byte, price float64) (string, error) {
+	if len(iv) != ivSize {
+		return "", fmt.Errorf("初始向量长度必须为%d字节", ivSize)
+	}
+	if price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return "", ErrInvalidPrice
+	}
+
+	var plain [priceSize]byte
+	binary.BigEndian.PutUint64(plain[:], uint64(math.Round(price*microsPerUnit)))
+
+	pad := hmacSum(key.EncryptionKey, iv)
+	out := make([]byte, 0, cipherSize)
+	out = append(out, iv...)
+	for i := 0; i < priceSize; i++ {
+		out = append(out, plain[i]^pad[i])
+	}
+	signature := hmacSum(key.IntegrityKey, plain[:], iv)
+	out = append(out, signature[:signatureSize]...)
+
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// decryptWith 使用一组密钥解密，签名不匹配时返回false
+func decryptWith(key KeyPair, data []byte) (uint64, bool) {
+	iv := data[:ivSize]
+	encPrice := data[ivSize : ivSize+priceSize]
+	signature := data[ivSize+priceSize:]
+
+	pad := hmacSum(key.EncryptionKey, iv)
+	var plain [priceSize]byte
+	for i := 0; i < priceSize; i++ {
+		plain[i] = encPrice[i] ^ pad[i]
+	}
+
+	expected := hmacSum(key.IntegrityKey, plain[:], iv)
+	if !hmac.Equal(expected[:signatureSize], signature) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(plain[:]), true
+}
+
+// hmacSum 计算HMAC-SHA1
+func hmacSum(key []byte, parts ...[]byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	for _, p := range parts {
+		mac.Write(p)
+	}
+	return mac.Sum(nil)
+}
+
+// decodeBase64 解码websafe或标准base64，兼容有无填充
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	if strings.ContainsAny(s, "+/") {
+		return base64.RawStdEncoding.DecodeString(s)
+	}
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+// parsePlainPrice 解析明文价格
+func parsePlainPrice(value string) (float64, error) {
+	price, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || price < 0 || math.IsNaN(price) || math.IsInf(price, 0) {
+		return 0, ErrInvalidPrice
+	}
+	return price, nil
+}
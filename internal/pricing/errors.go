@@ -0,0 +1,20 @@
+package pricing
+
+import "errors"
+
+var (
+	// ErrInvalidPrice 表示价格格式无效
+	ErrInvalidPrice = errors.New("无效的价格")
+
+	// ErrInvalidCiphertext 表示密文长度或编码无效
+	ErrInvalidCiphertext = errors.New("无效的价格密文")
+
+	// ErrPlaintextPrice 表示配置了密钥的交易平台上报了明文价格
+	ErrPlaintextPrice = errors.New("交易平台要求加密价格")
+
+	// ErrSignatureMismatch 表示完整性校验失败
+	ErrSignatureMismatch = errors.New("价格签名校验失败")
+
+	// ErrInvalidKey 表示密钥无效
+	ErrInvalidKey = errors.New("无效的价格密钥")
+)
@@ -0,0 +1,53 @@
+package profile
+
+import "time"
+
+const (
+	// priorImpressions 平滑使用的先验展示数，展示数远小于该值时预估值接近先验
+	priorImpressions = 100
+
+	// recentClickWindow 近期点击的时间窗口
+	recentClickWindow = time.Hour
+	// recentClickBoost 近期点击过同一计划或类目时的提升系数
+	recentClickBoost = 1.2
+
+	minCTR = 0.0001
+	maxCTR = 0.5
+)
+
+// CTR 根据用户特征修正基础点击率
+// 先以基础点击率为先验对类目点击率做贝叶斯平滑，再以类目结果为先验平滑计划点击率；
+// 近期点击过同一计划或类目时适当提升，结果限制在合理区间内。
+func (f Features) CTR(base float64, now time.Time) float64 {
+	ctr := smooth(f.Category, base)
+	ctr = smooth(f.Campaign, ctr)
+
+	if recent(f.Campaign.LastClick, now) || recent(f.Category.LastClick, now) {
+		ctr *= recentClickBoost
+	}
+
+	if ctr < minCTR {
+		return minCTR
+	}
+	if ctr > maxCTR {
+		return maxCTR
+	}
+	return ctr
+}
+
+// smooth 以prior为先验平滑计数的点击率
+func smooth(c Counter, prior float64) float64 {
+	if c.Impressions <= 0 {
+		return prior
+	}
+	clicks := c.Clicks
+	if clicks > c.Impressions {
+		clicks = c.Impressions
+	}
+	return (float64(clicks) + prior*priorImpressions) / float64(c.Impressions+priorImpressions)
+}
+
+// recent 判断时间是否在近期点击窗口内
+func recent(t time.Time, now time.Time) bool {
+	return !t.IsZero() && now.Sub(t) <= recentClickWindow
+}
@@ -0,0 +1,8 @@
+package profile
+
+import "errors"
+
+var (
+	// ErrProfileNotFound 表示用户没有特征或特征已过期
+	ErrProfileNotFound = errors.New("用户特征不存在")
+)
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: profile.go
+ * Project: simple-dsp
+ * Description: 用户特征存储，为CTR预估提供近期展示和点击特征
+ *
+ * 主要功能:
+ * - 按用户记录各计划、各类目的展示和点击次数
+ * - 记录最近一次展示和点击的时间
+ * - 从事件流批量更新特征
+ *
+ * 实现细节:
+ * - 每个用户一个Redis HASH，字段为{范围}:{ID}:{指标}
+ * - 每次更新刷新TTL，用户在TTL内没有新事件时特征整体过期
+ * - 竞价时每个请求只读取一次用户特征
+ *
+ * 注意事项:
+ * - 计数为TTL窗口内的累计值，不做时间衰减
+ * - 读取失败时调用方应回退到默认CTR
+ */
+
+package profile
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 特征范围
+const (
+	scopeTotal    = "t"
+	scopeCampaign = "c"
+	scopeCategory = "g"
+)
+
+// 特征指标
+const (
+	metricImpressions    = "imp"
+	metricClicks         = "clk"
+	metricLastImpression = "last_imp"
+	metricLastClick      = "last_clk"
+)
+
+// Counter 展示和点击的频次及最近时间
+type Counter struct {
+	Impressions    int64     `json:"impressions"`
+	Clicks         int64     `json:"clicks"`
+	LastImpression time.Time `json:"last_impression,omitempty"`
+	LastClick      time.Time `json:"last_click,omitempty"`
+}
+
+// Features 用户对某个计划和类目的特征
+type Features struct {
+	Total    Counter `json:"total"`
+	Campaign Counter `json:"campaign"`
+	Category Counter `json:"category"`
+}
+
+// Profile 用户特征
+type Profile struct {
+	UserID     string              `json:"user_id"`
+	Total      Counter             `json:"total"`
+	Campaigns  map[string]*Counter `json:"campaigns"`
+	Categories map[string]*Counter `json:"categories"`
+}
+
+// Features 返回用户对计划和类目的特征，Profile为nil时返回零值
+func (p *Profile) Features(campaignID, category string) Features {
+	var f Features
+	if p == nil {
+		return f
+	}
+	f.Total = p.Total
+	if c, ok := p.Campaigns[campaignID]; ok {
+		f.Campaign = *c
+	}
+	if category != "" {
+		if c, ok := p.Categories[category]; ok {
+			f.Category = *c
+		}
+	}
+	return f
+}
+
+// parseProfile 解析Redis HASH中的特征，无法识别的字段被忽略
+func parseProfile(userID string, fields map[string]string) *Profile {
+	p := &Profile{
+		UserID:     userID,
+		Campaigns:  make(map[string]*Counter),
+		Categories: make(map[string]*Counter),
+	}
+
+	for field, value := range fields {
+		scope, rest, ok := strings.Cut(field, ":")
+		if !ok {
+			continue
+		}
+		i := strings.LastIndex(rest, ":")
+		if i < 0 {
+			continue
+		}
+		id, metric := rest[:i], rest[i+1:]
+
+		var counter *Counter
+		switch scope {
+		case scopeTotal:
+			counter = &p.Total
+		case scopeCampaign:
+			counter = counterOf(p.Campaigns, id)
+		case scopeCategory:
+			counter = counterOf(p.Categories, id)
+		default:
+			continue
+		}
+
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch metric {
+		case metricImpressions:
+			counter.Impressions = n
+		case metricClicks:
+			counter.Clicks = n
+		case metricLastImpression:
+			counter.LastImpression = time.UnixMilli(n)
+		case metricLastClick:
+			counter.LastClick = time.UnixMilli(n)
+		}
+	}
+	return p
+}
+
+// counterOf 返回ID对应的计数，不存在时创建
+func counterOf(counters map[string]*Counter, id string) *Counter {
+	c, ok := counters[id]
+	if !ok {
+		c = &Counter{}
+		counters[id] = c
+	}
+	return c
+}
+
+// field 拼接HASH字段名
+func field(scope, id, metric string) string {
+	return scope + ":" + id + ":" + metric
+}
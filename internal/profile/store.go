@@ -0,0 +1,115 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// keyPrefix 用户特征键前缀，完整键为user:profile:{user_id}
+	keyPrefix = "user:profile:"
+
+	// DefaultTTL 默认特征保留时间
+	DefaultTTL = 7 * 24 * time.Hour
+)
+
+// Action 更新特征的用户行为
+type Action int
+
+const (
+	// ActionImpression 展示
+	ActionImpression Action = iota
+	// ActionClick 点击
+	ActionClick
+)
+
+// Observation 一次用户行为
+type Observation struct {
+	UserID     string
+	CampaignID string
+	Category   string
+	Action     Action
+	Time       time.Time
+}
+
+// Store 用户特征存储
+type Store interface {
+	// Profile 查询用户特征，用户没有特征时返回ErrProfileNotFound
+	Profile(ctx context.Context, userID string) (*Profile, error)
+	// Record 批量记录用户行为
+	Record(ctx context.Context, observations []Observation) error
+}
+
+// RedisStore 基于Redis HASH的用户特征存储
+type RedisStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewRedisStore 创建基于Redis的用户特征存储，ttl不大于0时使用DefaultTTL
+func NewRedisStore(redisClient *redis.Client, ttl time.Duration) *RedisStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &RedisStore{redis: redisClient, ttl: ttl}
+}
+
+// Profile 读取用户的全部特征
+func (s *RedisStore) Profile(ctx context.Context, userID string) (*Profile, error) {
+	fields, err := s.redis.HGetAll(ctx, keyPrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("查询用户特征失败: %w", err)
+	}
+	if len(fields) == 0 {
+		return nil, ErrProfileNotFound
+	}
+	return parseProfile(userID, fields), nil
+}
+
+// Record 在一个管道中累加计数、更新最近时间并刷新TTL
+func (s *RedisStore) Record(ctx context.Context, observations []Observation) error {
+	if len(observations) == 0 {
+		return nil
+	}
+
+	pipe := s.redis.Pipeline()
+	touched := make(map[string]struct{}, len(observations))
+	for _, o := range observations {
+		if o.UserID == "" {
+			continue
+		}
+		key := keyPrefix + o.UserID
+		count, last := metricImpressions, metricLastImpression
+		if o.Action == ActionClick {
+			count, last = metricClicks, metricLastClick
+		}
+		ts := strconv.FormatInt(o.Time.UnixMilli(), 10)
+
+		pipe.HIncrBy(ctx, key, field(scopeTotal, "", count), 1)
+		pipe.HSet(ctx, key, field(scopeTotal, "", last), ts)
+		if o.CampaignID != "" {
+			pipe.HIncrBy(ctx, key, field(scopeCampaign, o.CampaignID, count), 1)
+			pipe.HSet(ctx, key, field(scopeCampaign, o.CampaignID, last), ts)
+		}
+		if o.Category != "" {
+			pipe.HIncrBy(ctx, key, field(scopeCategory, o.Category, count), 1)
+			pipe.HSet(ctx, key, field(scopeCategory, o.Category, last), ts)
+		}
+		touched[key] = struct{}{}
+	}
+	if len(touched) == 0 {
+		return nil
+	}
+	for key := range touched {
+		pipe.Expire(ctx, key, s.ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("更新用户特征失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package profile
+
+import (
+	"context"
+	"time"
+
+	"simple-dsp/internal/stats"
+)
+
+// CategoryResolver 查询出价策略所属类目
+type CategoryResolver interface {
+	Category(strategyID string) string
+}
+
+// Updater 从事件流更新用户特征
+type Updater struct {
+	store      Store
+	categories CategoryResolver
+}
+
+// NewUpdater 创建用户特征更新器，categories为nil时只使用事件携带的类目
+func NewUpdater(store Store, categories CategoryResolver) *Updater {
+	return &Updater{store: store, categories: categories}
+}
+
+// ObserveBatch 记录一批事件中的展示和点击，其他事件和没有用户ID的事件被忽略
+// 类目优先取事件ExtraParams中的category，其次按广告ID查询策略类目
+func (u *Updater) ObserveBatch(ctx context.Context, events []*stats.Event) error {
+	observations := make([]Observation, 0, len(events))
+	for _, e := range events {
+		if e.UserID == "" {
+			continue
+		}
+
+		var action Action
+		switch e.EventType {
+		case stats.EventImpression:
+			action = ActionImpression
+		case stats.EventClick:
+			action = ActionClick
+		default:
+			continue
+		}
+
+		category := e.ExtraParams["category"]
+		if category == "" && u.categories != nil && e.AdID != "" {
+			category = u.categories.Category(e.AdID)
+		}
+		ts := e.Timestamp
+		if ts.IsZero() {
+			ts = time.Now()
+		}
+
+		observations = append(observations, Observation{
+			UserID:     e.UserID,
+			CampaignID: e.AdID,
+			Category:   category,
+			Action:     action,
+			Time:       ts,
+		})
+	}
+	return u.store.Record(ctx, observations)
+}
@@ -42,7 +42,14 @@ func (h *Handler) RegisterRoutes(router *gin.Engine) {
 	router.POST("/api/v1/events/impression", h.eventHandler.HandleImpression)
 	router.POST("/api/v1/events/click", h.eventHandler.HandleClick)
 	router.POST("/api/v1/events/conversion", h.eventHandler.HandleConversion)
+	router.POST("/api/v1/events/viewable", h.eventHandler.HandleViewable)
+	router.POST("/api/v1/events/video/:stage", h.eventHandler.HandleVideo)
+	router.POST("/api/v1/events/dwell", h.eventHandler.HandleDwell)
 	router.GET("/api/v1/events/stats", h.eventHandler.GetEventStats)
+	router.GET("/ad/:auction_token", h.eventHandler.HandleAdRender)
+
+	// SKAdNetwork安装回传，路径由Apple固定
+	router.POST("/.well-known/skadnetwork/report-attribution/", h.eventHandler.HandleSKAdNetworkPostback)
 
 	// 健康检查接口
 	router.GET("/health", func(c *gin.Context) {
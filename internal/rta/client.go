@@ -8,7 +8,7 @@
  * 主要功能:
  * - 调用RTA服务进行用户定向
  * - 处理RTA服务响应
- * - 实现请求重试机制
+ * - 网络错误和5xx按重试策略重试
  * - 提供性能监控
  *
  * 实现细节:
@@ -21,6 +21,7 @@
  * - net/http
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/retry
  *
  * 注意事项:
  * - 注意处理服务超时
@@ -37,11 +38,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/httpclient"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
 
 	"github.com/patrickmn/go-cache"
 )
@@ -62,6 +68,10 @@ type Client struct {
 	configMgr      *ConfigManager
 	cache          *cache.Cache
 	defaultTimeout time.Duration
+	policy         config.RTALookupConfig
+	latency        *latencyTracker
+	refreshing     sync.Map
+	retryPolicy    retry.Policy
 }
 
 // NewClient 创建新的RTA客户端
@@ -71,13 +81,35 @@ func NewClient(baseURL, appKey, appSecret string, logger *logger.Logger, metrics
 		appKey:    appKey,
 		appSecret: appSecret,
 		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout:   5 * time.Second,
+			Transport: httpclient.NewTransport(config.HTTPClientConfig{}),
 		},
 		logger:  logger,
 		metrics: metrics,
+		latency: newLatencyTracker(),
 	}
 }
 
+// SetLookupPolicy 设置对冲请求和超时降级，需在处理请求前调用
+func (c *Client) SetLookupPolicy(policy config.RTALookupConfig) {
+	c.policy = policy
+	c.cache = nil
+	if policy.StaleTTL > 0 {
+		c.cache = cache.New(policy.StaleTTL, 2*policy.StaleTTL)
+	}
+}
+
+// SetTransport 替换HTTP请求的Transport，默认使用带连接池的Transport，rt为nil时使用http.DefaultTransport，需在处理请求前调用
+func (c *Client) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
+// SetRetryPolicy 设置定向查询的重试策略，默认不重试，需在处理请求前调用
+// 只重试网络错误、429和5xx，任务配置了重试次数时使用任务的重试次数和间隔
+func (c *Client) SetRetryPolicy(policy retry.Policy) {
+	c.retryPolicy = policy
+}
+
 // SingleQuery 执行单次RTA查询
 func (c *Client) SingleQuery(ctx context.Context, req *SingleRequest) (*SingleResponse, error) {
 	// 参数验证
@@ -221,33 +253,85 @@ func (c *Client) doRequest(ctx context.Context, url string, params map[string]st
 
 // CheckTargeting 检查用户是否符合RTA定向要求
 func (c *Client) CheckTargeting(ctx context.Context, userID string) (bool, error) {
+	resp, err := c.Evaluate(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return resp.Participate, nil
+}
+
+// Evaluate 查询用户的RTA定向结果和出价信号，base_bid和bid_multiplier未返回时为0
+func (c *Client) Evaluate(ctx context.Context, userID string) (*RTAResponse, error) {
+	return c.EvaluateTask(ctx, userID, nil)
+}
+
+// EvaluateTask 按RTA任务查询用户的定向结果和出价信号，task为nil时查询默认任务
+// 按SetLookupPolicy的配置发送对冲请求，超时或失败时使用保留的结果
+func (c *Client) EvaluateTask(ctx context.Context, userID string, task *TaskConfig) (*RTAResponse, error) {
+	key := userID
+	if task != nil {
+		key = task.TaskID + ":" + userID
+	}
+	policy := c.retryPolicy
+	if task != nil && task.RetryCount > 0 {
+		policy.MaxRetries = task.RetryCount
+		policy.InitialBackoff = task.RetryInterval
+	}
+	return c.lookup(ctx, key, func(ctx context.Context) (*RTAResponse, error) {
+		return retry.DoValue(ctx, policy, func(ctx context.Context) (*RTAResponse, error) {
+			return c.check(ctx, userID, task)
+		})
+	})
+}
+
+// check 发送一次RTA定向查询，不可重试的错误使用retry.Permanent包装
+func (c *Client) check(ctx context.Context, userID string, task *TaskConfig) (*RTAResponse, error) {
 	startTime := time.Now()
 	defer func() {
-		c.metrics.RTA.CheckDuration.Observe(time.Since(startTime).Seconds())
+		elapsed := time.Since(startTime)
+		c.metrics.RTA.CheckDuration.Observe(elapsed.Seconds())
+		// 被取消的对冲请求不计入对冲延迟的统计
+		if ctx.Err() == nil {
+			c.latency.observe(elapsed)
+		}
 	}()
 
 	// 构造请求URL
-	url := fmt.Sprintf("%s/api/v1/rta/check?user_id=%s", c.baseURL, userID)
+	query := url.Values{"user_id": {userID}}
+	if task != nil {
+		query.Set("task_id", task.TaskID)
+		if task.Channel != "" {
+			query.Set("channel", task.Channel)
+		}
+		if task.AdvertisingSpaceID != "" {
+			query.Set("ad_space_id", task.AdvertisingSpaceID)
+		}
+	}
+	endpoint := c.baseURL + "/api/v1/rta/check?" + query.Encode()
 
 	// 创建请求
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
 	if err != nil {
 		c.logger.Error("创建RTA请求失败", "error", err)
-		return false, err
+		return nil, retry.Permanent(err)
 	}
 
 	// 发送请求
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		c.logger.Error("RTA请求失败", "error", err)
-		return false, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// 检查响应状态码
+	// 检查响应状态码，只有限流和服务端错误可以重试
 	if resp.StatusCode != http.StatusOK {
 		c.logger.Error("RTA服务返回错误状态码", "status_code", resp.StatusCode)
-		return false, fmt.Errorf("RTA服务返回错误状态码: %d", resp.StatusCode)
+		err := fmt.Errorf("RTA服务返回错误状态码: %d", resp.StatusCode)
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < http.StatusInternalServerError {
+			return nil, retry.Permanent(err)
+		}
+		return nil, err
 	}
 
 	// 解析响应
@@ -255,22 +339,28 @@ func (c *Client) CheckTargeting(ctx context.Context, userID string) (bool, error
 		Code    int    `json:"code"`
 		Message string `json:"message"`
 		Data    struct {
-			IsTargeted bool `json:"is_targeted"`
+			IsTargeted    bool    `json:"is_targeted"`
+			BaseBid       float64 `json:"base_bid"`
+			BidMultiplier float64 `json:"bid_multiplier"`
 		} `json:"data"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		c.logger.Error("解析RTA响应失败", "error", err)
-		return false, err
+		return nil, retry.Permanent(err)
 	}
 
 	// 检查业务状态码
 	if result.Code != 0 {
 		c.logger.Error("RTA服务返回业务错误", "code", result.Code, "message", result.Message)
-		return false, fmt.Errorf("RTA服务返回业务错误: %s", result.Message)
+		return nil, retry.Permanent(fmt.Errorf("RTA服务返回业务错误: %s", result.Message))
 	}
 
-	return result.Data.IsTargeted, nil
+	return &RTAResponse{
+		Participate:   result.Data.IsTargeted,
+		BaseBid:       result.Data.BaseBid,
+		BidMultiplier: result.Data.BidMultiplier,
+	}, nil
 }
 
 // BatchCheckTargeting 批量检查用户是否符合RTA定向要求
@@ -16,18 +16,21 @@ type TaskConfig struct {
     RetryCount        int           `json:"retry_count"`         // 重试次数
     RetryInterval     time.Duration `json:"retry_interval"`      // 重试间隔
     CacheExpiration   time.Duration `json:"cache_expiration"`    // 缓存过期时间
+    Campaigns         []string      `json:"campaigns"`           // 绑定该任务的推广计划
 }
 
 // ConfigManager RTA配置管理器
 type ConfigManager struct {
-    configs map[string]*TaskConfig  // 任务配置映射
-    mu      sync.RWMutex           // 读写锁
+    configs   map[string]*TaskConfig  // 任务配置映射
+    campaigns map[string]string       // 推广计划绑定的任务ID
+    mu        sync.RWMutex           // 读写锁
 }
 
 // NewConfigManager 创建新的配置管理器
 func NewConfigManager() *ConfigManager {
     return &ConfigManager{
-        configs: make(map[string]*TaskConfig),
+        configs:   make(map[string]*TaskConfig),
+        campaigns: make(map[string]string),
     }
 }
 
@@ -35,7 +38,11 @@ func NewConfigManager() *ConfigManager {
 func (m *ConfigManager) SetConfig(config *TaskConfig) {
     m.mu.Lock()
     defer m.mu.Unlock()
+    m.unbind(config.TaskID)
     m.configs[config.TaskID] = config
+    for _, campaignID := range config.Campaigns {
+        m.campaigns[campaignID] = config.TaskID
+    }
 }
 
 // GetConfig 获取任务配置
@@ -50,9 +57,21 @@ func (m *ConfigManager) GetConfig(taskID string) (*TaskConfig, bool) {
 func (m *ConfigManager) RemoveConfig(taskID string) {
     m.mu.Lock()
     defer m.mu.Unlock()
+    m.unbind(taskID)
     delete(m.configs, taskID)
 }
 
+// unbind 解除任务绑定的推广计划，调用方需持有写锁
+func (m *ConfigManager) unbind(taskID string) {
+    if old, exists := m.configs[taskID]; exists {
+        for _, campaignID := range old.Campaigns {
+            if m.campaigns[campaignID] == taskID {
+                delete(m.campaigns, campaignID)
+            }
+        }
+    }
+}
+
 // ListConfigs 列出所有任务配置
 func (m *ConfigManager) ListConfigs() []*TaskConfig {
     m.mu.RLock()
@@ -0,0 +1,168 @@
+package rta
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindow 计算P95使用的最近查询数
+	latencyWindow = 256
+	// minLatencySamples 样本不足时不发送对冲请求
+	minLatencySamples = 20
+)
+
+// 使用保留结果的原因
+const (
+	staleReasonPreferred = "prefer_stale"
+	staleReasonTimeout   = "timeout"
+	staleReasonError     = "error"
+)
+
+// latencyTracker 记录最近的查询耗时，用于计算对冲延迟
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples [latencyWindow]time.Duration
+	next    int
+	count   int
+	p95     time.Duration
+}
+
+// newLatencyTracker 创建查询耗时记录
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{}
+}
+
+// observe 记录一次查询耗时，每记录一定数量后重新计算P95
+func (t *latencyTracker) observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.samples[t.next] = d
+	t.next = (t.next + 1) % latencyWindow
+	if t.count < latencyWindow {
+		t.count++
+	}
+	if t.count >= minLatencySamples && (t.count < latencyWindow || t.next%16 == 0) {
+		sorted := make([]time.Duration, t.count)
+		copy(sorted, t.samples[:t.count])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		t.p95 = sorted[t.count*95/100]
+	}
+}
+
+// P95 返回最近查询耗时的P95，样本不足时返回0
+func (t *latencyTracker) P95() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.p95
+}
+
+// lookup 查询RTA，开启保留结果时超时或失败使用保留的结果
+func (c *Client) lookup(ctx context.Context, key string, call func(context.Context) (*RTAResponse, error)) (*RTAResponse, error) {
+	if c.cache != nil && c.policy.PreferStale {
+		if cached, ok := c.cache.Get(key); ok {
+			c.metrics.RTA.StaleResults.WithLabelValues(staleReasonPreferred).Inc()
+			c.refreshInBackground(key, call)
+			return cached.(*RTAResponse), nil
+		}
+	}
+
+	resp, err := c.hedged(ctx, call)
+	if err == nil {
+		if c.cache != nil {
+			c.cache.SetDefault(key, resp)
+		}
+		return resp, nil
+	}
+
+	if c.cache != nil {
+		if cached, ok := c.cache.Get(key); ok {
+			reason := staleReasonError
+			if errors.Is(err, context.DeadlineExceeded) {
+				reason = staleReasonTimeout
+			}
+			c.metrics.RTA.StaleResults.WithLabelValues(reason).Inc()
+			c.logger.Warn("RTA查询失败，使用保留的结果", "key", key, "error", err)
+			return cached.(*RTAResponse), nil
+		}
+	}
+	return nil, err
+}
+
+// hedged 首个请求超过对冲延迟仍未返回时再发送一次请求，使用先成功返回的结果
+// 请求的截止时间到达时立即返回，不等待进行中的请求
+func (c *Client) hedged(ctx context.Context, call func(context.Context) (*RTAResponse, error)) (*RTAResponse, error) {
+	delay := c.hedgeDelay()
+	if delay <= 0 {
+		return call(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		resp *RTAResponse
+		err  error
+	}
+	results := make(chan result, 2)
+	run := func() {
+		resp, err := call(ctx)
+		results <- result{resp: resp, err: err}
+	}
+	go run()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	inflight, hedged := 1, false
+	for {
+		select {
+		case <-timer.C:
+			hedged = true
+			inflight++
+			c.metrics.RTA.Hedges.Inc()
+			go run()
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				return r.resp, nil
+			}
+			// 首个请求直接失败时不再对冲，对冲请求仍在进行时等待其结果
+			if inflight == 0 || !hedged {
+				return nil, r.err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// hedgeDelay 返回对冲延迟，未开启对冲或近期样本不足时返回0
+func (c *Client) hedgeDelay() time.Duration {
+	if !c.policy.Hedge {
+		return 0
+	}
+	if c.policy.HedgeDelay > 0 {
+		return c.policy.HedgeDelay
+	}
+	return c.latency.P95()
+}
+
+// refreshInBackground 在后台刷新保留的结果，同一个key同时只有一次刷新
+func (c *Client) refreshInBackground(key string, call func(context.Context) (*RTAResponse, error)) {
+	if _, loaded := c.refreshing.LoadOrStore(key, struct{}{}); loaded {
+		return
+	}
+	go func() {
+		defer c.refreshing.Delete(key)
+		resp, err := call(context.Background())
+		if err != nil {
+			c.logger.Warn("后台刷新RTA结果失败", "key", key, "error", err)
+			return
+		}
+		c.cache.SetDefault(key, resp)
+	}()
+}
@@ -0,0 +1,76 @@
+package rta
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"simple-dsp/pkg/config"
+)
+
+// NewConfigManagerFromConfig 根据配置文件创建任务配置管理器，未配置的参数使用DefaultConfig
+func NewConfigManagerFromConfig(tasks []config.RTATaskConfig) *ConfigManager {
+	m := NewConfigManager()
+	for _, task := range tasks {
+		cfg := *DefaultConfig
+		cfg.TaskID = task.TaskID
+		cfg.Channel = task.Channel
+		cfg.AdvertisingSpaceID = task.AdvertisingSpaceID
+		cfg.Campaigns = append([]string(nil), task.Campaigns...)
+		m.SetConfig(&cfg)
+	}
+	return m
+}
+
+// Bindings 返回推广计划绑定的已启用任务，未绑定任务的推广计划不在结果中
+func (m *ConfigManager) Bindings(campaignIDs []string) map[string]*TaskConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bindings map[string]*TaskConfig
+	for _, campaignID := range campaignIDs {
+		taskID, ok := m.campaigns[campaignID]
+		if !ok {
+			continue
+		}
+		if task := m.configs[taskID]; task != nil && task.Enabled {
+			if bindings == nil {
+				bindings = make(map[string]*TaskConfig)
+			}
+			bindings[campaignID] = task
+		}
+	}
+	return bindings
+}
+
+// EvaluateTasks 并发查询各任务的定向结果，返回按任务ID索引的结果
+// 查询失败的任务不在结果中，全部失败时返回错误
+func (c *Client) EvaluateTasks(ctx context.Context, userID string, tasks []*TaskConfig) (map[string]*RTAResponse, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		errs    []error
+		results = make(map[string]*RTAResponse, len(tasks))
+	)
+	for _, task := range tasks {
+		wg.Add(1)
+		go func(task *TaskConfig) {
+			defer wg.Done()
+			resp, err := c.EvaluateTask(ctx, userID, task)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			results[task.TaskID] = resp
+		}(task)
+	}
+	wg.Wait()
+
+	if len(results) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
@@ -0,0 +1,14 @@
+package segment
+
+import "errors"
+
+var (
+	// ErrSegmentNotFound 表示人群包不存在或为空
+	ErrSegmentNotFound = errors.New("人群包不存在")
+
+	// ErrEmptySeed 表示种子人群为空
+	ErrEmptySeed = errors.New("种子人群为空")
+
+	// ErrInvalidOptions 表示扩展参数无效
+	ErrInvalidOptions = errors.New("无效的扩展参数")
+)
@@ -0,0 +1,109 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"simple-dsp/internal/stats"
+)
+
+// DefaultSuffix 扩展人群包ID的默认后缀
+const DefaultSuffix = ":lookalike"
+
+// Seed 待扩展的种子人群包
+type Seed struct {
+	ID      string
+	Options ExpandOptions
+}
+
+// Report 单个种子人群包的扩展结果
+type Report struct {
+	SeedID    string
+	TargetID  string
+	Expansion *Expansion
+	// Written 写入扩展人群包的用户数，包含种子用户
+	Written int
+	Err     error
+}
+
+// Job 相似人群扩展任务
+// 扩展人群包包含种子用户和扩展的用户，写入{种子ID}{后缀}，不修改种子人群包
+type Job struct {
+	store  Store
+	ttl    time.Duration
+	suffix string
+}
+
+// NewJob 创建扩展任务，suffix为空时使用DefaultSuffix
+func NewJob(store Store, ttl time.Duration, suffix string) *Job {
+	if suffix == "" {
+		suffix = DefaultSuffix
+	}
+	return &Job{store: store, ttl: ttl, suffix: suffix}
+}
+
+// FromEvent 将展示或点击事件转换为交互，其他事件返回false
+func FromEvent(e *stats.Event) (Interaction, bool) {
+	if e.UserID == "" || e.AdID == "" {
+		return Interaction{}, false
+	}
+	switch e.EventType {
+	case stats.EventImpression:
+		return Interaction{UserID: e.UserID, CampaignID: e.AdID}, true
+	case stats.EventClick:
+		return Interaction{UserID: e.UserID, CampaignID: e.AdID, Clicked: true}, true
+	default:
+		return Interaction{}, false
+	}
+}
+
+// Run 依次扩展种子人群包，dryRun为true时只计算不写入
+// 没有扩展出用户时不写入，保留上一次的扩展结果
+func (j *Job) Run(ctx context.Context, idx *Index, seeds []Seed, dryRun bool) []Report {
+	reports := make([]Report, 0, len(seeds))
+	for _, seed := range seeds {
+		if ctx.Err() != nil {
+			break
+		}
+		reports = append(reports, j.expand(ctx, idx, seed, dryRun))
+	}
+	return reports
+}
+
+// expand 扩展单个种子人群包
+func (j *Job) expand(ctx context.Context, idx *Index, seed Seed, dryRun bool) Report {
+	report := Report{SeedID: seed.ID, TargetID: seed.ID + j.suffix}
+
+	members, err := j.store.Members(ctx, seed.ID)
+	if errors.Is(err, ErrSegmentNotFound) {
+		report.Err = ErrEmptySeed
+		return report
+	}
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	expansion, err := idx.Expand(members, seed.Options)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	report.Expansion = expansion
+	if dryRun || len(expansion.Users) == 0 {
+		return report
+	}
+
+	users := make([]string, 0, len(members)+len(expansion.Users))
+	users = append(users, members...)
+	for _, c := range expansion.Users {
+		users = append(users, c.UserID)
+	}
+	if err := j.store.Replace(ctx, report.TargetID, users, j.ttl); err != nil {
+		report.Err = err
+		return report
+	}
+	report.Written = len(users)
+	return report
+}
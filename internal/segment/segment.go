@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: segment.go
+ * Project: simple-dsp
+ * Description: 人群包及相似人群扩展
+ *
+ * 主要功能:
+ * - 按用户与广告计划的交互构建共现索引
+ * - 根据种子人群计算计划的关联度(lift)
+ * - 按关联计划为非种子用户打分，扩展相似人群
+ *
+ * 实现细节:
+ * - lift = 种子人群中交互过该计划的比例 / 全体用户中交互过该计划的比例
+ * - 只有种子支持数和lift都达到阈值的计划参与打分，计划权重为ln(lift)
+ * - 点击按ClickWeight加权，仅展示按1计
+ * - 扩展人数为种子人数乘以扩展倍数，且不超过MaxUsers
+ *
+ * 注意事项:
+ * - 索引保存在内存中，适合离线任务按时间窗口构建
+ * - 种子人群在窗口内没有交互时无法扩展
+ */
+
+package segment
+
+import (
+	"math"
+	"sort"
+)
+
+// 默认扩展参数
+const (
+	DefaultRatio       = 3
+	DefaultMinSupport  = 5
+	DefaultMinLift     = 1.5
+	DefaultClickWeight = 3
+)
+
+// Interaction 用户与广告计划的一次交互
+type Interaction struct {
+	UserID     string
+	CampaignID string
+	Clicked    bool
+}
+
+// ExpandOptions 扩展参数
+type ExpandOptions struct {
+	// Ratio 扩展人数与种子人数的比例
+	Ratio float64
+	// MinSupport 计划参与打分所需的最少种子用户数
+	MinSupport int
+	// MinLift 计划参与打分所需的最小lift，必须大于1
+	MinLift float64
+	// MinScore 候选用户进入扩展人群的最低得分
+	MinScore float64
+	// MaxUsers 扩展人数上限，0表示不限制
+	MaxUsers int
+	// ClickWeight 点击相对于展示的权重
+	ClickWeight float64
+}
+
+// DefaultExpandOptions 返回默认扩展参数
+func DefaultExpandOptions() ExpandOptions {
+	return ExpandOptions{
+		Ratio:       DefaultRatio,
+		MinSupport:  DefaultMinSupport,
+		MinLift:     DefaultMinLift,
+		ClickWeight: DefaultClickWeight,
+	}
+}
+
+// Validate 校验扩展参数
+func (o ExpandOptions) Validate() error {
+	if o.Ratio <= 0 || o.MinSupport < 1 || o.MinLift <= 1 || o.MinScore < 0 || o.MaxUsers < 0 || o.ClickWeight < 1 {
+		return ErrInvalidOptions
+	}
+	return nil
+}
+
+// Candidate 扩展的用户及得分
+type Candidate struct {
+	UserID string  `json:"user_id"`
+	Score  float64 `json:"score"`
+}
+
+// Expansion 扩展结果
+type Expansion struct {
+	// Seeds 种子人数
+	Seeds int `json:"seeds"`
+	// ActiveSeeds 窗口内有交互的种子人数
+	ActiveSeeds int `json:"active_seeds"`
+	// Campaigns 达到阈值的关联计划数
+	Campaigns int `json:"campaigns"`
+	// Candidates 达到最低得分的候选人数
+	Candidates int `json:"candidates"`
+	// Users 扩展的用户，按得分从高到低排列，不包含种子用户
+	Users []Candidate `json:"users"`
+}
+
+// 交互标记
+const (
+	flagSeen uint8 = 1 << iota
+	flagClicked
+)
+
+// Index 用户与广告计划的共现索引
+type Index struct {
+	users map[string]map[string]uint8
+	reach map[string]int
+}
+
+// NewIndex 创建共现索引
+func NewIndex() *Index {
+	return &Index{
+		users: make(map[string]map[string]uint8),
+		reach: make(map[string]int),
+	}
+}
+
+// Add 记录一次交互，同一用户对同一计划重复交互只计一次
+func (idx *Index) Add(i Interaction) {
+	if i.UserID == "" || i.CampaignID == "" {
+		return
+	}
+
+	campaigns, ok := idx.users[i.UserID]
+	if !ok {
+		campaigns = make(map[string]uint8)
+		idx.users[i.UserID] = campaigns
+	}
+	flags, seen := campaigns[i.CampaignID]
+	if !seen {
+		idx.reach[i.CampaignID]++
+	}
+	flags |= flagSeen
+	if i.Clicked {
+		flags |= flagClicked
+	}
+	campaigns[i.CampaignID] = flags
+}
+
+// Users 索引中的用户数
+func (idx *Index) Users() int {
+	return len(idx.users)
+}
+
+// Expand 按种子人群扩展相似人群
+func (idx *Index) Expand(seeds []string, opts ExpandOptions) (*Expansion, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if len(seeds) == 0 {
+		return nil, ErrEmptySeed
+	}
+
+	seedSet := make(map[string]struct{}, len(seeds))
+	for _, id := range seeds {
+		seedSet[id] = struct{}{}
+	}
+	result := &Expansion{Seeds: len(seedSet)}
+
+	// 统计种子人群对各计划的支持数
+	support := make(map[string]int)
+	for id := range seedSet {
+		campaigns, ok := idx.users[id]
+		if !ok {
+			continue
+		}
+		result.ActiveSeeds++
+		for campaignID := range campaigns {
+			support[campaignID]++
+		}
+	}
+	if result.ActiveSeeds == 0 {
+		return result, nil
+	}
+
+	// 计算关联计划的权重
+	total := float64(len(idx.users))
+	weights := make(map[string]float64)
+	for campaignID, n := range support {
+		if n < opts.MinSupport {
+			continue
+		}
+		lift := (float64(n) / float64(result.ActiveSeeds)) / (float64(idx.reach[campaignID]) / total)
+		if lift >= opts.MinLift {
+			weights[campaignID] = math.Log(lift)
+		}
+	}
+	result.Campaigns = len(weights)
+	if len(weights) == 0 {
+		return result, nil
+	}
+
+	// 为非种子用户打分
+	var candidates []Candidate
+	for userID, campaigns := range idx.users {
+		if _, ok := seedSet[userID]; ok {
+			continue
+		}
+		score := 0.0
+		for campaignID, flags := range campaigns {
+			weight, ok := weights[campaignID]
+			if !ok {
+				continue
+			}
+			if flags&flagClicked != 0 {
+				weight *= opts.ClickWeight
+			}
+			score += weight
+		}
+		if score > 0 && score >= opts.MinScore {
+			candidates = append(candidates, Candidate{UserID: userID, Score: score})
+		}
+	}
+	result.Candidates = len(candidates)
+
+	// 得分相同时按用户ID排序，保证结果稳定
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		return candidates[i].UserID < candidates[j].UserID
+	})
+
+	limit := int(math.Ceil(opts.Ratio * float64(result.Seeds)))
+	if opts.MaxUsers > 0 && limit > opts.MaxUsers {
+		limit = opts.MaxUsers
+	}
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	result.Users = candidates
+	return result, nil
+}
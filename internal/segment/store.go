@@ -0,0 +1,130 @@
+package segment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// keyPrefix 人群包键前缀，完整键为segment:{segment_id}，成员为用户ID，分值为加入时间(毫秒)
+	keyPrefix = "segment:"
+
+	// writeBatchSize 单条ZADD命令写入的用户数
+	writeBatchSize = 1000
+)
+
+// AudienceID 广告主通过像素收集的人群对应的人群包ID
+func AudienceID(advertiserID, audience string) string {
+	return "pixel:" + advertiserID + ":" + audience
+}
+
+// Store 人群包存储
+type Store interface {
+	// Members 查询人群包的全部用户，人群包不存在时返回ErrSegmentNotFound
+	Members(ctx context.Context, segmentID string) ([]string, error)
+	// Replace 整体替换人群包的用户，ttl为0时不过期
+	Replace(ctx context.Context, segmentID string, users []string, ttl time.Duration) error
+	// Add 将用户加入人群包，同时移除加入时间早于ttl的用户；ttl为0时不过期
+	Add(ctx context.Context, segmentID, userID string, ttl time.Duration) error
+	// Contains 判断用户是否在人群包中
+	Contains(ctx context.Context, segmentID, userID string) (bool, error)
+}
+
+// RedisStore 基于Redis ZSET的人群包存储
+type RedisStore struct {
+	redis *redis.Client
+}
+
+// NewRedisStore 创建基于Redis的人群包存储
+func NewRedisStore(redisClient *redis.Client) *RedisStore {
+	return &RedisStore{redis: redisClient}
+}
+
+// Members 查询人群包的全部用户
+func (s *RedisStore) Members(ctx context.Context, segmentID string) ([]string, error) {
+	users, err := s.redis.ZRange(ctx, keyPrefix+segmentID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("查询人群包失败: %w", err)
+	}
+	if len(users) == 0 {
+		return nil, ErrSegmentNotFound
+	}
+	return users, nil
+}
+
+// Replace 写入临时键后重命名，读取方不会看到写入一半的人群包
+func (s *RedisStore) Replace(ctx context.Context, segmentID string, users []string, ttl time.Duration) error {
+	key := keyPrefix + segmentID
+	if len(users) == 0 {
+		if err := s.redis.Del(ctx, key).Err(); err != nil {
+			return fmt.Errorf("删除人群包失败: %w", err)
+		}
+		return nil
+	}
+
+	now := float64(time.Now().UnixMilli())
+	tmp := fmt.Sprintf("%s:tmp:%d", key, time.Now().UnixNano())
+	pipe := s.redis.Pipeline()
+	for start := 0; start < len(users); start += writeBatchSize {
+		end := start + writeBatchSize
+		if end > len(users) {
+			end = len(users)
+		}
+		members := make([]*redis.Z, 0, end-start)
+		for _, u := range users[start:end] {
+			members = append(members, &redis.Z{Score: now, Member: u})
+		}
+		pipe.ZAdd(ctx, tmp, members...)
+	}
+	// 写入失败时临时键自动过期
+	pipe.Expire(ctx, tmp, time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("写入人群包失败: %w", err)
+	}
+
+	tx := s.redis.TxPipeline()
+	tx.Rename(ctx, tmp, key)
+	if ttl > 0 {
+		tx.Expire(ctx, key, ttl)
+	} else {
+		tx.Persist(ctx, key)
+	}
+	if _, err := tx.Exec(ctx); err != nil {
+		return fmt.Errorf("替换人群包失败: %w", err)
+	}
+	return nil
+}
+
+// Add 更新用户的加入时间并清理过期的用户
+func (s *RedisStore) Add(ctx context.Context, segmentID, userID string, ttl time.Duration) error {
+	key := keyPrefix + segmentID
+	now := time.Now()
+
+	pipe := s.redis.TxPipeline()
+	pipe.ZAdd(ctx, key, &redis.Z{Score: float64(now.UnixMilli()), Member: userID})
+	if ttl > 0 {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+strconv.FormatInt(now.Add(-ttl).UnixMilli(), 10))
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("加入人群包失败: %w", err)
+	}
+	return nil
+}
+
+// Contains 判断用户是否在人群包中
+func (s *RedisStore) Contains(ctx context.Context, segmentID, userID string) (bool, error) {
+	err := s.redis.ZScore(ctx, keyPrefix+segmentID, userID).Err()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("查询人群包失败: %w", err)
+	}
+	return true, nil
+}
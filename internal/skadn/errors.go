@@ -0,0 +1,35 @@
+package skadn
+
+import "errors"
+
+var (
+	// ErrNotEligible 表示请求或广告不满足返回SKAdNetwork签名的条件
+	ErrNotEligible = errors.New("不满足SKAdNetwork签名条件")
+
+	// ErrUnsupportedVersion 表示不支持的SKAdNetwork版本
+	ErrUnsupportedVersion = errors.New("不支持的SKAdNetwork版本")
+
+	// ErrMissingNetworkID 表示未配置SKAdNetwork网络ID
+	ErrMissingNetworkID = errors.New("未配置SKAdNetwork网络ID")
+
+	// ErrInvalidKey 表示密钥格式无效或不是P-256密钥
+	ErrInvalidKey = errors.New("无效的SKAdNetwork密钥")
+
+	// ErrInvalidITunesItem 表示App Store ID无效
+	ErrInvalidITunesItem = errors.New("无效的App Store ID")
+
+	// ErrInvalidCampaign 表示计划ID或来源标识超出取值范围
+	ErrInvalidCampaign = errors.New("无效的SKAdNetwork计划ID或来源标识")
+
+	// ErrCampaignNotFound 表示广告未配置SKAdNetwork或回传没有匹配的广告
+	ErrCampaignNotFound = errors.New("SKAdNetwork配置不存在")
+
+	// ErrInvalidPostback 表示回传缺少必填字段
+	ErrInvalidPostback = errors.New("无效的SKAdNetwork回传")
+
+	// ErrInvalidSignature 表示回传签名校验失败
+	ErrInvalidSignature = errors.New("SKAdNetwork回传签名校验失败")
+
+	// ErrNoVerificationKey 表示未配置对应版本的Apple公钥
+	ErrNoVerificationKey = errors.New("未配置对应版本的Apple公钥")
+)
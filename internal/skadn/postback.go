@@ -0,0 +1,146 @@
+package skadn
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Postback Apple发送的SKAdNetwork安装归因回传
+type Postback struct {
+	Version     string `json:"version"`
+	AdNetworkID string `json:"ad-network-id"`
+	// CampaignID 4.0以下版本的计划ID
+	CampaignID *int `json:"campaign-id,omitempty"`
+	// SourceIdentifier 4.0版本的来源标识
+	SourceIdentifier string `json:"source-identifier,omitempty"`
+	AppID            int64  `json:"app-id"`
+	TransactionID    string `json:"transaction-id"`
+	Redownload       bool   `json:"redownload"`
+	// SourceAppID 媒体应用ID，隐私阈值不足时不返回
+	SourceAppID  *int64 `json:"source-app-id,omitempty"`
+	SourceDomain string `json:"source-domain,omitempty"`
+	FidelityType *int   `json:"fidelity-type,omitempty"`
+	// DidWin 3.0起返回，false表示本网络不是最终归因的网络
+	DidWin *bool `json:"did-win,omitempty"`
+	// ConversionValue 精细转化值，隐私阈值不足时不返回
+	ConversionValue       *int   `json:"conversion-value,omitempty"`
+	CoarseConversionValue string `json:"coarse-conversion-value,omitempty"`
+	// PostbackSequenceIndex 4.0的回传序号，0、1、2分别对应三个转化窗口
+	PostbackSequenceIndex *int   `json:"postback-sequence-index,omitempty"`
+	AttributionSignature  string `json:"attribution-signature"`
+}
+
+// Source 返回回传中的来源，4.0为source identifier，其余版本为campaign id
+func (p *Postback) Source() string {
+	if p.SourceIdentifier != "" {
+		return p.SourceIdentifier
+	}
+	if p.CampaignID != nil {
+		return strconv.Itoa(*p.CampaignID)
+	}
+	return ""
+}
+
+// Won 本网络是否赢得归因，3.0以下版本只向获胜的网络回传
+func (p *Postback) Won() bool {
+	return p.DidWin == nil || *p.DidWin
+}
+
+// Validate 校验必填字段
+func (p *Postback) Validate() error {
+	if major, _ := splitVersion(p.Version); major < 2 || major > 4 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, p.Version)
+	}
+	if p.AdNetworkID == "" || p.TransactionID == "" || p.AppID <= 0 || p.Source() == "" {
+		return ErrInvalidPostback
+	}
+	if p.AttributionSignature == "" {
+		return ErrInvalidPostback
+	}
+	return nil
+}
+
+// signedFields 按版本拼接的签名字段
+func (p *Postback) signedFields() []string {
+	fields := []string{
+		p.Version,
+		p.AdNetworkID,
+		p.Source(),
+		strconv.FormatInt(p.AppID, 10),
+		p.TransactionID,
+		strconv.FormatBool(p.Redownload),
+	}
+
+	v4 := compareVersions(p.Version, "4.0") >= 0
+	switch {
+	case p.SourceAppID != nil:
+		fields = append(fields, strconv.FormatInt(*p.SourceAppID, 10))
+	case v4 && p.SourceDomain != "":
+		fields = append(fields, p.SourceDomain)
+	}
+	if compareVersions(p.Version, "2.2") >= 0 && p.FidelityType != nil {
+		fields = append(fields, strconv.Itoa(*p.FidelityType))
+	}
+	if compareVersions(p.Version, "3.0") >= 0 && p.DidWin != nil {
+		fields = append(fields, strconv.FormatBool(*p.DidWin))
+	}
+	if v4 && p.PostbackSequenceIndex != nil {
+		fields = append(fields, strconv.Itoa(*p.PostbackSequenceIndex))
+	}
+	return fields
+}
+
+// Verifier 使用Apple公钥校验回传签名
+type Verifier struct {
+	// keys 按主版本号索引的公钥
+	keys map[int]*ecdsa.PublicKey
+}
+
+// NewVerifier 创建回传校验器，keys的键为主版本号，值为base64编码的PKIX公钥
+func NewVerifier(keys map[string]string) (*Verifier, error) {
+	v := &Verifier{keys: make(map[int]*ecdsa.PublicKey, len(keys))}
+	for version, encoded := range keys {
+		major, err := strconv.Atoi(strings.TrimSpace(version))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, version)
+		}
+		der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		parsed, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		key, ok := parsed.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		v.keys[major] = key
+	}
+	return v, nil
+}
+
+// Verify 校验回传签名，未配置对应版本公钥时返回ErrNoVerificationKey
+func (v *Verifier) Verify(p *Postback) error {
+	major, _ := splitVersion(p.Version)
+	key, ok := v.keys[major]
+	if !ok {
+		return ErrNoVerificationKey
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(p.AttributionSignature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	digest := sha256.Sum256([]byte(strings.Join(p.signedFields(), separator)))
+	if !ecdsa.VerifyASN1(key, digest[:], sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
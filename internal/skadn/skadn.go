@@ -0,0 +1,314 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: skadn.go
+ * Project: simple-dsp
+ * Description: iOS流量的SKAdNetwork归因签名
+ *
+ * 主要功能:
+ * - 解析竞价请求中的skadn对象
+ * - 与媒体协商SKAdNetwork版本
+ * - 为符合条件的广告生成签名的skadn响应
+ *
+ * 实现细节:
+ * - 签名字段按版本拼接，以U+2063分隔
+ * - 使用ECDSA P-256和SHA-256签名，签名为base64编码的DER
+ * - 2.2及以上版本通过fidelities返回StoreKit渲染的签名
+ *
+ * 注意事项:
+ * - 媒体的skadnetids中必须包含本网络ID才会返回签名
+ * - 4.0以下版本使用campaign(1-100)，4.0使用source identifier(0-9999)
+ */
+
+package skadn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// separator 签名字段分隔符(INVISIBLE SEPARATOR)
+const separator = "\u2063"
+
+// FidelityStoreKit StoreKit渲染的广告，即点击归因
+const FidelityStoreKit = 1
+
+// DefaultVersions 默认支持的版本
+var DefaultVersions = []string{"2.2", "3.0", "4.0"}
+
+// Request 竞价请求中的skadn对象
+type Request struct {
+	// Version 媒体支持的最高版本，旧版本协议使用
+	Version string `json:"version,omitempty"`
+	// Versions 媒体支持的全部版本
+	Versions   []string `json:"versions,omitempty"`
+	SourceApp  string   `json:"sourceapp"`
+	SKAdNetIDs []string `json:"skadnetids"`
+}
+
+// Response 竞价响应中的skadn对象
+type Response struct {
+	Version string `json:"version"`
+	Network string `json:"network"`
+	// Campaign 4.0以下版本的计划ID
+	Campaign string `json:"campaign,omitempty"`
+	// SourceIdentifier 4.0版本的来源标识
+	SourceIdentifier string `json:"sourceidentifier,omitempty"`
+	ITunesItem       string `json:"itunesitem"`
+	SourceApp        string `json:"sourceapp"`
+	// Nonce、Timestamp、Signature 仅2.0版本使用，其余版本见Fidelities
+	Nonce      string     `json:"nonce,omitempty"`
+	Timestamp  string     `json:"timestamp,omitempty"`
+	Signature  string     `json:"signature,omitempty"`
+	Fidelities []Fidelity `json:"fidelities,omitempty"`
+}
+
+// Fidelity 按归因类型签名的结果
+type Fidelity struct {
+	Fidelity  int    `json:"fidelity"`
+	Nonce     string `json:"nonce"`
+	Timestamp string `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// Campaign 广告的SKAdNetwork配置
+type Campaign struct {
+	// ITunesItemID 推广应用的App Store ID
+	ITunesItemID string `json:"itunes_item_id"`
+	// CampaignID 4.0以下版本的计划ID，取值1-100，为0时只参与4.0版本
+	CampaignID int `json:"campaign_id"`
+	// SourceIdentifier 4.0版本的来源标识，取值0-9999
+	SourceIdentifier int `json:"source_identifier"`
+}
+
+// Validate 校验配置
+func (c *Campaign) Validate() error {
+	if _, err := strconv.ParseUint(c.ITunesItemID, 10, 64); err != nil {
+		return ErrInvalidITunesItem
+	}
+	if c.CampaignID < 0 || c.CampaignID > 100 {
+		return ErrInvalidCampaign
+	}
+	if c.SourceIdentifier < 0 || c.SourceIdentifier > 9999 {
+		return ErrInvalidCampaign
+	}
+	return nil
+}
+
+// Signer 生成skadn响应签名
+type Signer struct {
+	networkID string
+	key       *ecdsa.PrivateKey
+	versions  []string
+}
+
+// NewSigner 创建签名器，versions为空时使用DefaultVersions
+func NewSigner(networkID string, key *ecdsa.PrivateKey, versions []string) (*Signer, error) {
+	if networkID == "" {
+		return nil, ErrMissingNetworkID
+	}
+	if key == nil || key.Curve != elliptic.P256() {
+		return nil, ErrInvalidKey
+	}
+	if len(versions) == 0 {
+		versions = DefaultVersions
+	}
+	for _, v := range versions {
+		if !isSupported(v) {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedVersion, v)
+		}
+	}
+	return &Signer{
+		networkID: strings.ToLower(networkID),
+		key:       key,
+		versions:  versions,
+	}, nil
+}
+
+// NetworkID 返回本网络ID
+func (s *Signer) NetworkID() string {
+	return s.networkID
+}
+
+// Negotiate 选择媒体、本网络和广告配置都支持的最高版本，媒体未列出本网络ID时返回ErrNotEligible
+func (s *Signer) Negotiate(req *Request, campaign *Campaign) (string, error) {
+	if req == nil || campaign == nil || req.SourceApp == "" {
+		return "", ErrNotEligible
+	}
+
+	listed := false
+	for _, id := range req.SKAdNetIDs {
+		if strings.EqualFold(id, s.networkID) {
+			listed = true
+			break
+		}
+	}
+	if !listed {
+		return "", ErrNotEligible
+	}
+
+	offered := req.Versions
+	if len(offered) == 0 && req.Version != "" {
+		offered = []string{req.Version}
+	}
+
+	best := ""
+	for _, v := range offered {
+		if !s.supports(v) {
+			continue
+		}
+		// 未配置计划ID的广告只能使用4.0
+		if campaign.CampaignID == 0 && compareVersions(v, "4.0") < 0 {
+			continue
+		}
+		if best == "" || compareVersions(v, best) > 0 {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", ErrNotEligible
+	}
+	return best, nil
+}
+
+// Sign 为广告生成签名的skadn响应
+func (s *Signer) Sign(req *Request, campaign *Campaign, now time.Time) (*Response, error) {
+	version, err := s.Negotiate(req, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &Response{
+		Version:    version,
+		Network:    s.networkID,
+		ITunesItem: campaign.ITunesItemID,
+		SourceApp:  req.SourceApp,
+	}
+	// 4.0使用source identifier代替campaign
+	source := strconv.Itoa(campaign.CampaignID)
+	if compareVersions(version, "4.0") >= 0 {
+		source = strconv.Itoa(campaign.SourceIdentifier)
+		resp.SourceIdentifier = source
+	} else {
+		resp.Campaign = source
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+
+	fields := []string{version, s.networkID, source, campaign.ITunesItemID, nonce, req.SourceApp}
+	if version == "2.0" {
+		signature, err := s.sign(append(fields, timestamp))
+		if err != nil {
+			return nil, err
+		}
+		resp.Nonce = nonce
+		resp.Timestamp = timestamp
+		resp.Signature = signature
+		return resp, nil
+	}
+
+	signature, err := s.sign(append(fields, strconv.Itoa(FidelityStoreKit), timestamp))
+	if err != nil {
+		return nil, err
+	}
+	resp.Fidelities = []Fidelity{{
+		Fidelity:  FidelityStoreKit,
+		Nonce:     nonce,
+		Timestamp: timestamp,
+		Signature: signature,
+	}}
+	return resp, nil
+}
+
+// sign 拼接字段并签名
+func (s *Signer) sign(fields []string) (string, error) {
+	digest := sha256.Sum256([]byte(strings.Join(fields, separator)))
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("签名失败: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// supports 判断本网络是否启用了该版本
+func (s *Signer) supports(version string) bool {
+	for _, v := range s.versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrivateKey 解析PEM格式的P-256私钥，支持SEC1和PKCS#8
+func ParsePrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidKey
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// supportedVersions 本系统实现的版本
+var supportedVersions = map[string]bool{"2.0": true, "2.2": true, "3.0": true, "4.0": true}
+
+// isSupported 判断版本是否已实现
+func isSupported(version string) bool {
+	return supportedVersions[version]
+}
+
+// compareVersions 比较两个major.minor格式的版本号
+func compareVersions(a, b string) int {
+	aMajor, aMinor := splitVersion(a)
+	bMajor, bMinor := splitVersion(b)
+	switch {
+	case aMajor != bMajor:
+		return aMajor - bMajor
+	default:
+		return aMinor - bMinor
+	}
+}
+
+// splitVersion 拆分版本号，无法解析的部分视为0
+func splitVersion(version string) (int, int) {
+	majorStr, minorStr, _ := strings.Cut(version, ".")
+	major, _ := strconv.Atoi(majorStr)
+	minor, _ := strconv.Atoi(minorStr)
+	return major, minor
+}
+
+// newNonce 生成小写UUID v4格式的随机数
+func newNonce() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("生成nonce失败: %w", err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,143 @@
+package skadn
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// adKeyPrefix 广告的SKAdNetwork配置键前缀，完整键为skadn:ad:{ad_id}
+	adKeyPrefix = "skadn:ad:"
+	// appKeyPrefix 按推广应用索引的配置键前缀，完整键为skadn:app:{itunes_item_id}，字段为广告ID
+	appKeyPrefix = "skadn:app:"
+)
+
+// Store 广告的SKAdNetwork配置存储
+type Store interface {
+	// Save 保存广告的配置
+	Save(ctx context.Context, adID string, campaign *Campaign) error
+	// Delete 删除广告的配置，配置不存在时不返回错误
+	Delete(ctx context.Context, adID string) error
+	// Campaign 查询广告的配置，未配置时返回ErrCampaignNotFound
+	Campaign(ctx context.Context, adID string) (*Campaign, error)
+	// MatchAd 查询回传归因的广告，没有匹配的广告时返回ErrCampaignNotFound
+	MatchAd(ctx context.Context, postback *Postback) (string, error)
+}
+
+// Matches 判断回传是否归因到该配置
+// 4.0的来源标识在隐私阈值不足时只返回低位的2或3位数字
+func (c *Campaign) Matches(p *Postback) bool {
+	if strconv.FormatInt(p.AppID, 10) != c.ITunesItemID {
+		return false
+	}
+
+	if p.SourceIdentifier == "" {
+		return p.CampaignID != nil && *p.CampaignID == c.CampaignID
+	}
+	source, err := strconv.Atoi(p.SourceIdentifier)
+	if err != nil || len(p.SourceIdentifier) > 4 {
+		return false
+	}
+	return c.SourceIdentifier%int(math.Pow10(len(p.SourceIdentifier))) == source
+}
+
+// RedisStore 基于Redis的配置存储
+type RedisStore struct {
+	redis *redis.Client
+}
+
+// NewRedisStore 创建基于Redis的配置存储
+func NewRedisStore(redisClient *redis.Client) *RedisStore {
+	return &RedisStore{redis: redisClient}
+}
+
+// Save 保存广告的配置，并更新推广应用索引
+func (s *RedisStore) Save(ctx context.Context, adID string, campaign *Campaign) error {
+	data, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+
+	// 推广应用变化时从原应用的索引中移除
+	old, err := s.Campaign(ctx, adID)
+	if err != nil && !errors.Is(err, ErrCampaignNotFound) {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	if old != nil && old.ITunesItemID != campaign.ITunesItemID {
+		pipe.HDel(ctx, appKeyPrefix+old.ITunesItemID, adID)
+	}
+	pipe.Set(ctx, adKeyPrefix+adID, data, 0)
+	pipe.HSet(ctx, appKeyPrefix+campaign.ITunesItemID, adID, data)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存SKAdNetwork配置失败: %w", err)
+	}
+	return nil
+}
+
+// Delete 删除广告的配置
+func (s *RedisStore) Delete(ctx context.Context, adID string) error {
+	old, err := s.Campaign(ctx, adID)
+	if errors.Is(err, ErrCampaignNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, adKeyPrefix+adID)
+	pipe.HDel(ctx, appKeyPrefix+old.ITunesItemID, adID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("删除SKAdNetwork配置失败: %w", err)
+	}
+	return nil
+}
+
+// Campaign 查询广告的配置
+func (s *RedisStore) Campaign(ctx context.Context, adID string) (*Campaign, error) {
+	data, err := s.redis.Get(ctx, adKeyPrefix+adID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCampaignNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询SKAdNetwork配置失败: %w", err)
+	}
+
+	var campaign Campaign
+	if err := json.Unmarshal(data, &campaign); err != nil {
+		return nil, fmt.Errorf("解析SKAdNetwork配置失败: %w", err)
+	}
+	return &campaign, nil
+}
+
+// MatchAd 在推广应用的索引中查找回传归因的广告
+// 来源标识被截断时可能匹配多个广告，返回广告ID最小的一个以保证结果稳定
+func (s *RedisStore) MatchAd(ctx context.Context, postback *Postback) (string, error) {
+	entries, err := s.redis.HGetAll(ctx, appKeyPrefix+strconv.FormatInt(postback.AppID, 10)).Result()
+	if err != nil {
+		return "", fmt.Errorf("查询SKAdNetwork配置失败: %w", err)
+	}
+
+	matched := ""
+	for adID, data := range entries {
+		var campaign Campaign
+		if err := json.Unmarshal([]byte(data), &campaign); err != nil {
+			continue
+		}
+		if campaign.Matches(postback) && (matched == "" || adID < matched) {
+			matched = adID
+		}
+	}
+	if matched == "" {
+		return "", ErrCampaignNotFound
+	}
+	return matched, nil
+}
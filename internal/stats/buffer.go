@@ -0,0 +1,350 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: buffer.go
+ * Project: simple-dsp
+ * Description: 事件写出缓冲，Kafka不可用时缓冲事件，恢复后按顺序重放
+ *
+ * 主要功能:
+ * - Kafka写入失败的事件进入有界的内存缓冲，不阻塞事件管道
+ * - 内存缓冲已满时写入本地磁盘，重启后继续重放
+ * - Kafka恢复后按写入顺序重放缓冲的事件
+ * - 缓冲已满时按丢弃策略丢弃事件，统计缓冲、落盘、重放和丢弃的事件数
+ *
+ * 实现细节:
+ * - 没有积压时直接写入Kafka；有积压时新事件排在积压之后，保证同一分区键的事件按顺序写出
+ * - 磁盘中有积压时新事件继续写入磁盘，内存中的事件总是早于磁盘中的事件
+ * - 重放按间隔进行，一次写出多批，直到积压清空或写入失败
+ * - 部分消息写入失败时只缓冲失败的消息
+ * - 停止时尽量写出积压，仍未写出的内存事件写入磁盘，未启用磁盘缓冲时丢弃
+ *
+ * 依赖关系:
+ * - github.com/segmentio/kafka-go
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 重放整批写入失败后会整批重试，事件至少写出一次，消费方按事件去重
+ * - 磁盘缓冲不逐条同步，进程崩溃时操作系统缓存中的事件可能丢失
+ * - 缓冲的事件按已收集处理，丢弃的事件只计入指标
+ * - 每个实例使用独立的磁盘缓冲目录
+ */
+
+package stats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	defaultBufferMaxEvents     = 100000
+	defaultBufferRetryInterval = time.Second
+	defaultBufferBatchSize     = 500
+	defaultBufferWriteTimeout  = 5 * time.Second
+	defaultSpillMaxBytes       = 1 << 30
+	defaultSpillSegmentBytes   = 64 << 20
+)
+
+// 缓冲丢弃策略
+const (
+	DropNewest = "drop_newest"
+	DropOldest = "drop_oldest"
+)
+
+// 事件丢弃原因
+const (
+	dropReasonFull     = "full"
+	dropReasonCorrupt  = "corrupt"
+	dropReasonShutdown = "shutdown"
+	dropReasonError    = "error"
+)
+
+// MessageWriter 写出Kafka消息，*kafka.Writer实现了该接口
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// WriteBuffer 带缓冲的Kafka写出，Kafka不可用时缓冲事件，恢复后按顺序重放
+type WriteBuffer struct {
+	config  config.EventBufferConfig
+	writer  MessageWriter
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+
+	mu    sync.Mutex
+	queue []kafka.Message
+	// popped 已从内存缓冲移出的事件数，重放期间按丢弃策略移出事件时据此确认重放的部分
+	popped uint64
+	spill  *spillLog
+
+	// replayMu 保证同一时刻只有一个重放
+	replayMu sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewWriteBuffer 创建事件写出缓冲，启用磁盘缓冲时打开目录并继续重放上次未写出的事件
+func NewWriteBuffer(cfg config.EventBufferConfig, writer MessageWriter, logger *logger.Logger, metrics *metrics.Metrics) (*WriteBuffer, error) {
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = defaultBufferMaxEvents
+	}
+	if cfg.DropPolicy == "" {
+		cfg.DropPolicy = DropNewest
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultBufferRetryInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBufferBatchSize
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = defaultBufferWriteTimeout
+	}
+	if cfg.Spill.MaxBytes <= 0 {
+		cfg.Spill.MaxBytes = defaultSpillMaxBytes
+	}
+	if cfg.Spill.SegmentBytes <= 0 {
+		cfg.Spill.SegmentBytes = defaultSpillSegmentBytes
+	}
+
+	b := &WriteBuffer{
+		config:  cfg,
+		writer:  writer,
+		logger:  logger,
+		metrics: metrics,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg.Spill.Enabled {
+		spill, err := openSpillLog(cfg.Spill.Dir, cfg.Spill.MaxBytes, cfg.Spill.SegmentBytes)
+		if err != nil {
+			return nil, err
+		}
+		b.spill = spill
+		b.metrics.Events.SpillBytes.Set(float64(spill.size))
+	}
+	return b, nil
+}
+
+// Start 启动重放
+func (b *WriteBuffer) Start() {
+	go b.run()
+}
+
+// Stop 停止重放，尽量写出积压，仍未写出的内存事件写入磁盘
+func (b *WriteBuffer) Stop() {
+	close(b.stop)
+	<-b.done
+
+	b.Replay()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.spill == nil {
+		if len(b.queue) > 0 {
+			b.metrics.Events.BufferDropped.WithLabelValues(dropReasonShutdown).Add(float64(len(b.queue)))
+			b.logger.Error("停止时Kafka仍不可用，丢弃缓冲的事件", "count", len(b.queue))
+		}
+	} else {
+		// 内存中的事件早于磁盘中的事件，写入磁盘后重启时排在最后，同一分区键的事件可能乱序
+		for _, msg := range b.queue {
+			b.spillLocked(msg, dropReasonShutdown)
+		}
+		if err := b.spill.close(); err != nil {
+			b.logger.Error("关闭磁盘缓冲失败", "error", err)
+		}
+	}
+	b.queue = nil
+	b.metrics.Events.Buffered.Set(0)
+}
+
+// WriteMessages 写出消息，有积压或写入失败时缓冲消息
+// 缓冲或按丢弃策略丢弃后返回nil，事件管道不再重试
+func (b *WriteBuffer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if !b.backlogged() {
+		err := b.writer.WriteMessages(ctx, msgs...)
+		if err == nil {
+			return nil
+		}
+		msgs = failedMessages(msgs, err)
+		b.logger.Warn("写入Kafka失败，缓冲事件", "error", err, "count", len(msgs))
+	}
+	b.enqueue(msgs)
+	return nil
+}
+
+// Pending 返回内存和磁盘中是否有待重放的事件
+func (b *WriteBuffer) Pending() bool {
+	return b.backlogged()
+}
+
+// Replay 重放积压的事件，直到积压清空或写入失败
+func (b *WriteBuffer) Replay() {
+	b.replayMu.Lock()
+	defer b.replayMu.Unlock()
+
+	for {
+		ok, err := b.replayBatch()
+		if err != nil {
+			b.logger.Debug("重放缓冲的事件失败", "error", err)
+			return
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// run 按间隔重放积压的事件
+func (b *WriteBuffer) run() {
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.config.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if b.backlogged() {
+				b.Replay()
+			}
+		}
+	}
+}
+
+// backlogged 是否有积压
+func (b *WriteBuffer) backlogged() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.queue) > 0 || (b.spill != nil && !b.spill.empty())
+}
+
+// enqueue 缓冲消息，磁盘中有积压时写入磁盘以保证顺序
+func (b *WriteBuffer) enqueue(msgs []kafka.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, msg := range msgs {
+		switch {
+		case (b.spill == nil || b.spill.empty()) && len(b.queue) < b.config.MaxEvents:
+			b.queue = append(b.queue, msg)
+		case b.spill != nil:
+			b.spillLocked(msg, dropReasonFull)
+		case b.config.DropPolicy == DropOldest:
+			b.queue = append(b.queue[1:], msg)
+			b.popped++
+			b.metrics.Events.BufferDropped.WithLabelValues(dropReasonFull).Inc()
+		default:
+			b.metrics.Events.BufferDropped.WithLabelValues(dropReasonFull).Inc()
+		}
+	}
+	b.metrics.Events.Buffered.Set(float64(len(b.queue)))
+}
+
+// spillLocked 将消息写入磁盘，磁盘已满时按reason计入丢弃，需持有b.mu
+func (b *WriteBuffer) spillLocked(msg kafka.Message, reason string) {
+	if _, err := b.spill.append(msg); err != nil {
+		if !errors.Is(err, ErrSpillFull) {
+			reason = dropReasonError
+			b.logger.Error("写入磁盘缓冲失败，丢弃事件", "error", err)
+		}
+		b.metrics.Events.BufferDropped.WithLabelValues(reason).Inc()
+		return
+	}
+	b.metrics.Events.Spilled.Inc()
+	b.metrics.Events.SpillBytes.Set(float64(b.spill.size))
+}
+
+// replayBatch 重放一批事件，先内存后磁盘；没有积压时返回false
+func (b *WriteBuffer) replayBatch() (bool, error) {
+	b.mu.Lock()
+	var (
+		batch     []kafka.Message
+		fromQueue = len(b.queue) > 0
+		popped    = b.popped
+		offset    int64
+		peekErr   error
+	)
+	switch {
+	case fromQueue:
+		n := min(len(b.queue), b.config.BatchSize)
+		batch = append(make([]kafka.Message, 0, n), b.queue[:n]...)
+	case b.spill != nil && !b.spill.empty():
+		batch, offset, peekErr = b.spill.peek(b.config.BatchSize)
+	default:
+		b.mu.Unlock()
+		return false, nil
+	}
+
+	if len(batch) == 0 {
+		defer b.mu.Unlock()
+		if peekErr == nil {
+			// 文件已读完，删除后重放下一个文件
+			err := b.spill.commit(offset)
+			b.metrics.Events.SpillBytes.Set(float64(b.spill.size))
+			return err == nil, err
+		}
+		// 文件在重放位置之后损坏，丢弃剩余部分，继续重放下一个文件
+		err := b.spill.discard()
+		b.metrics.Events.SpillBytes.Set(float64(b.spill.size))
+		b.metrics.Events.BufferDropped.WithLabelValues(dropReasonCorrupt).Inc()
+		b.logger.Error("磁盘缓冲文件损坏，丢弃剩余的事件", "error", peekErr)
+		return err == nil, err
+	}
+	b.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.WriteTimeout)
+	err := b.writer.WriteMessages(ctx, batch...)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	b.metrics.Events.Replayed.Add(float64(len(batch)))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if fromQueue {
+		// 重放期间按drop_oldest移出的事件已不在队列中
+		if n := int(popped) + len(batch) - int(b.popped); n > 0 {
+			b.queue = b.queue[n:]
+			b.popped += uint64(n)
+		}
+		if len(b.queue) == 0 {
+			b.queue = nil
+		}
+		b.metrics.Events.Buffered.Set(float64(len(b.queue)))
+		return true, nil
+	}
+	err = b.spill.commit(offset)
+	b.metrics.Events.SpillBytes.Set(float64(b.spill.size))
+	return err == nil, err
+}
+
+// failedMessages 返回写入失败的消息，部分失败时只返回失败的消息
+func failedMessages(msgs []kafka.Message, err error) []kafka.Message {
+	var writeErrs kafka.WriteErrors
+	if !errors.As(err, &writeErrs) || len(writeErrs) != len(msgs) {
+		return msgs
+	}
+	failed := make([]kafka.Message, 0, writeErrs.Count())
+	for i, werr := range writeErrs {
+		if werr != nil {
+			failed = append(failed, msgs[i])
+		}
+	}
+	return failed
+}
@@ -16,11 +16,18 @@
  * - 实现数据聚合和统计
  * - 支持实时数据查询
  * - 提供数据导出功能
+ * - 按天的实时计数器按广告所属推广计划的时区划分日期
+ * - 启用维度统计时按国家、省份、城市、设备类型和操作系统拆分按天的统计
+ * - 计费事件按配置的费率计算平台服务费和税费，与媒体成本分别计数
+ * - 事件默认以JSON写出，设置编码器后按Schema Registry注册的Protobuf版本写出
+ * - 设置写出缓冲后Kafka不可用时事件先缓冲，恢复后按顺序重放
  *
  * 依赖关系:
  * - simple-dsp/pkg/clients
+ * - simple-dsp/pkg/clock
  * - simple-dsp/pkg/metrics
  * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/timezone
  *
  * 注意事项:
  * - 注意数据收集的实时性
@@ -34,14 +41,18 @@ package stats
 import (
 	"context"
 	"encoding/json"
+	"math"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/segmentio/kafka-go"
 
+	"simple-dsp/internal/billing"
+	"simple-dsp/pkg/clock"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/timezone"
 )
 
 // EventType 事件类型
@@ -54,21 +65,92 @@ const (
 	EventClick EventType = "click"
 	// EventConversion 转化事件
 	EventConversion EventType = "conversion"
+	// EventWin 竞价成功通知事件
+	EventWin EventType = "win"
+	// EventBid 出价事件，仅在启用竞价漏斗时由流量处理器提交
+	EventBid EventType = "bid"
+	// EventViewableImpression 可见展示事件，按MRC标准由SDK或监测方判定
+	EventViewableImpression EventType = "viewable_impression"
+	// EventVideoStart 视频开始播放
+	EventVideoStart EventType = "video_start"
+	// EventVideoFirstQuartile 视频播放到25%
+	EventVideoFirstQuartile EventType = "video_first_quartile"
+	// EventVideoMidpoint 视频播放到50%
+	EventVideoMidpoint EventType = "video_midpoint"
+	// EventVideoThirdQuartile 视频播放到75%
+	EventVideoThirdQuartile EventType = "video_third_quartile"
+	// EventVideoComplete 视频播放完成
+	EventVideoComplete EventType = "video_complete"
+	// EventDwell 落地页停留时长事件，时长由DwellMs携带
+	EventDwell EventType = "dwell"
 )
 
+// VideoEvents 视频播放进度事件，按播放顺序排列
+var VideoEvents = []EventType{
+	EventVideoStart,
+	EventVideoFirstQuartile,
+	EventVideoMidpoint,
+	EventVideoThirdQuartile,
+	EventVideoComplete,
+}
+
+// EventTypes 全部事件类型，每种事件写入一个Kafka主题
+var EventTypes = []EventType{
+	EventBid,
+	EventWin,
+	EventImpression,
+	EventViewableImpression,
+	EventClick,
+	EventConversion,
+	EventVideoStart,
+	EventVideoFirstQuartile,
+	EventVideoMidpoint,
+	EventVideoThirdQuartile,
+	EventVideoComplete,
+	EventDwell,
+}
+
+// EventTopics 全部事件类型的Kafka主题
+func EventTopics() []string {
+	topics := make([]string, 0, len(EventTypes))
+	for _, eventType := range EventTypes {
+		topics = append(topics, getEventTopic(eventType))
+	}
+	return topics
+}
+
 // Event 事件数据
 type Event struct {
 	EventType   EventType         `json:"event_type"`
 	RequestID   string            `json:"request_id"`
 	UserID      string            `json:"user_id"`
 	AdID        string            `json:"ad_id"`
+	CreativeID  string            `json:"creative_id,omitempty"` // 出价时轮换选出的素材，按素材统计展示和点击
 	SlotID      string            `json:"slot_id"`
 	BidPrice    float64           `json:"bid_price"`
 	WinPrice    float64           `json:"win_price"`
+	Fee         float64           `json:"fee,omitempty"` // 平台服务费，仅计费的展示和竞价成功事件使用
+	Tax         float64           `json:"tax,omitempty"` // 税费，仅计费的展示和竞价成功事件使用
 	Timestamp   time.Time         `json:"timestamp"`
 	IP          string            `json:"ip"`
 	UserAgent   string            `json:"user_agent"`
+	DwellMs     int64             `json:"dwell_ms,omitempty"` // 停留时长(毫秒)，仅停留事件使用
 	ExtraParams map[string]string `json:"extra_params"`
+	// Dimensions 地域和设备维度，来自竞价请求或事件请求的IP和User-Agent
+	Dimensions
+}
+
+// Charged 判断事件是否计费，携带成交价的展示和竞价成功通知按成交价计为媒体成本
+func (e *Event) Charged() bool {
+	return (e.EventType == EventImpression || e.EventType == EventWin) && e.WinPrice > 0
+}
+
+// PartitionKey 事件的顺序键，优先使用用户ID，没有用户ID时使用请求ID
+func (e *Event) PartitionKey() string {
+	if e.UserID != "" {
+		return e.UserID
+	}
+	return e.RequestID
 }
 
 // Collector 数据统计收集器
@@ -77,6 +159,13 @@ type Collector struct {
 	metrics     *metrics.Metrics
 	kafkaClient *kafka.Writer
 	redisClient *redis.Client
+	hourly      *HourlyStore
+	dimensions  *DimensionStore
+	zones       *timezone.Zones
+	rates       billing.Rates
+	encoder     *EventEncoder
+	buffer      *WriteBuffer
+	clock       clock.Clock
 }
 
 // NewCollector 创建新的数据统计收集器
@@ -86,102 +175,156 @@ func NewCollector(kafkawriter *kafka.Writer, redisClient *redis.Client, logger *
 		metrics:     metrics,
 		kafkaClient: kafkawriter,
 		redisClient: redisClient,
+		hourly:      NewHourlyStore(redisClient),
+		clock:       clock.Real(),
 	}
 }
 
+// SetTimezones 设置按天统计使用的时区，为nil时使用服务器时区
+func (c *Collector) SetTimezones(zones *timezone.Zones) {
+	c.zones = zones
+}
+
+// SetDimensions 设置按地域和设备拆分的统计，为nil时不拆分
+func (c *Collector) SetDimensions(store *DimensionStore) {
+	c.dimensions = store
+}
+
+// SetClock 设置查询实时统计时当天日期的时间来源，为nil时使用系统时钟
+// 事件计入的日期和小时按事件自身的时间计算，与时间来源无关
+func (c *Collector) SetClock(clk clock.Clock) {
+	c.clock = clock.OrReal(clk)
+}
+
+// SetBillingRates 设置平台服务费率和税率，设置后计费事件写出前按成交价计算服务费和税费
+func (c *Collector) SetBillingRates(rates billing.Rates) {
+	c.rates = rates
+}
+
+// SetEncoder 设置事件编码器，设置后事件按Protobuf写出，为nil时使用JSON
+func (c *Collector) SetEncoder(encoder *EventEncoder) {
+	c.encoder = encoder
+}
+
+// SetBuffer 设置写出缓冲，设置后事件经缓冲写入Kafka，为nil时直接写入
+func (c *Collector) SetBuffer(buffer *WriteBuffer) {
+	c.buffer = buffer
+}
+
 // CollectEvent 收集事件数据
 func (c *Collector) CollectEvent(ctx context.Context, event *Event) error {
-	// 记录事件到Kafka
-	eventBytes, err := json.Marshal(event)
-	if err != nil {
-		c.logger.Error("序列化事件数据失败", "error", err)
-		return err
+	return c.CollectBatch(ctx, []*Event{event})
+}
+
+// CollectBatch 批量收集事件数据，一次写入Kafka
+// 消息以PartitionKey为键，同一用户或请求的事件写入同一分区以保证顺序
+func (c *Collector) CollectBatch(ctx context.Context, events []*Event) error {
+	if len(events) == 0 {
+		return nil
 	}
 
-	// 发送到Kafka
-	topic := getEventTopic(event.EventType)
-	if err := c.kafkaClient.WriteMessages(ctx, kafka.Message{
-		Topic: topic,
-		Value: eventBytes,
-	}); err != nil {
-		c.logger.Error("发送事件到Kafka失败", "error", err, "event_type", event.EventType)
-		return err
+	messages := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		c.applyFees(event)
+
+		// 记录事件到Kafka
+		topic := getEventTopic(event.EventType)
+		eventBytes, err := c.encode(topic, event)
+		if err != nil {
+			c.logger.Error("序列化事件数据失败", "error", err)
+			return err
+		}
+		messages = append(messages, kafka.Message{
+			Topic: topic,
+			Key:   []byte(event.PartitionKey()),
+			Value: eventBytes,
+		})
 	}
 
-	// 更新实时计数器
-	if err := c.updateRealtimeCounters(ctx, event); err != nil {
-		c.logger.Error("更新实时计数器失败", "error", err)
-		// 不返回错误，因为Kafka已经成功发送
+	// 发送到Kafka，设置了写出缓冲时Kafka不可用的事件先缓冲
+	var writer MessageWriter = c.kafkaClient
+	if c.buffer != nil {
+		writer = c.buffer
+	}
+	if err := writer.WriteMessages(ctx, messages...); err != nil {
+		c.logger.Error("发送事件到Kafka失败", "error", err, "count", len(events))
+		return err
 	}
 
-	// 更新监控指标
-	c.updateMetrics(event)
+	for _, event := range events {
+		// 更新实时计数器
+		if err := c.updateRealtimeCounters(ctx, event); err != nil {
+			c.logger.Error("更新实时计数器失败", "error", err)
+			// 不返回错误，因为Kafka已经成功发送
+		}
+
+		// 更新监控指标
+		c.updateMetrics(event)
+	}
 
 	return nil
 }
 
-// GetRealtimeStats 获取实时统计数据
-func (c *Collector) GetRealtimeStats(ctx context.Context, adID string) (*RealtimeStats, error) {
-	now := time.Now()
-	date := now.Format("2006-01-02")
-
-	// 获取展示数
-	impKey := getRealtimeKey(adID, date, EventImpression)
-	impCount := c.redisClient.Get(ctx, impKey).String()
-
-	// 获取点击数
-	clickKey := getRealtimeKey(adID, date, EventClick)
-	clickCount := c.redisClient.Get(ctx, clickKey).String()
-
-	// 获取转化数
-	convKey := getRealtimeKey(adID, date, EventConversion)
-	convCount := c.redisClient.Get(ctx, convKey).String()
-
-	// 获取消耗
-	costKey := getRealtimeCostKey(adID, date)
-	cost := c.redisClient.Get(ctx, costKey).String()
-
-	return &RealtimeStats{
-		AdID:        adID,
-		Date:        date,
-		Impressions: parseInt64(impCount),
-		Clicks:      parseInt64(clickCount),
-		Conversions: parseInt64(convCount),
-		Cost:        parseFloat64(cost),
-		CTR:         calculateCTR(parseInt64(impCount), parseInt64(clickCount)),
-		CVR:         calculateCVR(parseInt64(clickCount), parseInt64(convCount)),
-		UpdateTime:  now,
-	}, nil
+// encode 按配置的编码序列化事件，未设置编码器时使用JSON
+func (c *Collector) encode(topic string, event *Event) ([]byte, error) {
+	if c.encoder == nil {
+		return json.Marshal(event)
+	}
+	return c.encoder.Encode(topic, event)
 }
 
-// RealtimeStats 实时统计数据
-type RealtimeStats struct {
-	AdID        string    `json:"ad_id"`
-	Date        string    `json:"date"`
-	Impressions int64     `json:"impressions"`
-	Clicks      int64     `json:"clicks"`
-	Conversions int64     `json:"conversions"`
-	Cost        float64   `json:"cost"`
-	CTR         float64   `json:"ctr"`
-	CVR         float64   `json:"cvr"`
-	UpdateTime  time.Time `json:"update_time"`
+// GetRealtimeStats 获取广告时区中当天的实时统计数据
+func (c *Collector) GetRealtimeStats(ctx context.Context, adID string) (*RealtimeStats, error) {
+	return loadDailyStats(ctx, c.redisClient, adID, timezone.Date(c.clock.Now(), c.zones.Ad(adID)))
 }
 
 // updateRealtimeCounters 更新实时计数器
 func (c *Collector) updateRealtimeCounters(ctx context.Context, event *Event) error {
-	date := event.Timestamp.Format("2006-01-02")
+	// 出价事件只用于关联竞价漏斗，出价次数由HourlyStore.CountBids统计
+	if event.EventType == EventBid {
+		return nil
+	}
+
+	date := timezone.Date(event.Timestamp, c.zones.Ad(event.AdID))
 
 	// 更新事件计数
 	eventKey := getRealtimeKey(event.AdID, date, event.EventType)
 	_ = c.redisClient.IncrBy(ctx, eventKey, 1)
 
-	// 如果是展示事件，更新消耗
-	if event.EventType == EventImpression && event.WinPrice > 0 {
+	// 展示或竞价成功通知携带成交价时，更新消耗
+	if event.Charged() {
 		costKey := getRealtimeCostKey(event.AdID, date)
-		_ = c.redisClient.IncrBy(ctx, costKey, int64(event.WinPrice*100))
+		_ = c.redisClient.IncrBy(ctx, costKey, centsOf(event.WinPrice))
+		if event.Fee > 0 {
+			_ = c.redisClient.IncrBy(ctx, getRealtimeFeeKey(event.AdID, date), centsOf(event.Fee))
+		}
+		if event.Tax > 0 {
+			_ = c.redisClient.IncrBy(ctx, getRealtimeTaxKey(event.AdID, date), centsOf(event.Tax))
+		}
 	}
 
-	return nil
+	// 停留事件累加总时长，用于计算平均停留时长
+	if event.EventType == EventDwell && event.DwellMs > 0 {
+		_ = c.redisClient.IncrBy(ctx, getRealtimeDwellKey(event.AdID, date), event.DwellMs)
+	}
+
+	// 按小时统计，供自动化规则按时间窗口计算指标
+	if err := c.hourly.record(ctx, event); err != nil {
+		return err
+	}
+
+	// 按地域和设备拆分，供报表按维度查询
+	return c.dimensions.record(ctx, event, date)
+}
+
+// applyFees 按成交价计算计费事件的服务费和税费，已计算过的事件（如重试写出）不再计算
+func (c *Collector) applyFees(event *Event) {
+	if c.rates.IsZero() || !event.Charged() || event.Fee != 0 || event.Tax != 0 {
+		return
+	}
+	b := c.rates.Split(centsOf(event.WinPrice))
+	event.Fee = float64(b.Fee) / 100
+	event.Tax = float64(b.Tax) / 100
 }
 
 // updateMetrics 更新监控指标
@@ -210,6 +353,20 @@ func (c *Collector) updateMetrics(event *Event) {
 		c.metrics.Events.Clicks.WithLabelValues(labels["ad_id"], labels["slot_id"]).Inc()
 	case EventConversion:
 		c.metrics.Events.Conversions.WithLabelValues(labels["ad_id"], labels["slot_id"]).Inc()
+	case EventViewableImpression:
+		c.metrics.Events.Viewable.WithLabelValues(labels["ad_id"], labels["slot_id"]).Inc()
+	case EventVideoStart, EventVideoFirstQuartile, EventVideoMidpoint, EventVideoThirdQuartile, EventVideoComplete:
+		c.metrics.Events.Video.WithLabelValues(labels["ad_id"], string(event.EventType)).Inc()
+	case EventDwell:
+		c.metrics.Events.DwellTime.Observe(float64(event.DwellMs) / 1000)
+	case EventWin:
+		c.metrics.Events.Wins.WithLabelValues(labels["ad_id"], labels["slot_id"]).Inc()
+		if event.WinPrice > 0 {
+			c.metrics.Budget.Cost.With(prometheus.Labels{
+				"ad_id": event.AdID,
+				"type":  "win_cost",
+			}).Add(event.WinPrice * 100)
+		}
 	}
 }
 
@@ -223,29 +380,29 @@ func getRealtimeKey(adID, date string, eventType EventType) string {
 	return "stats:realtime:" + adID + ":" + date + ":" + string(eventType)
 }
 
+// getRealtimeDwellKey 获取实时停留总时长(毫秒)的Redis键
+func getRealtimeDwellKey(adID, date string) string {
+	return "stats:realtime:" + adID + ":" + date + ":dwell_ms"
+}
+
 // getRealtimeCostKey 获取实时消耗的Redis键
 func getRealtimeCostKey(adID, date string) string {
 	return "stats:realtime:" + adID + ":" + date + ":cost"
 }
 
-// parseInt64 解析字符串为int64
-func parseInt64(s string) int64 {
-	var i int64
-	err := json.Unmarshal([]byte(s), &i)
-	if err != nil {
-		return 0
-	}
-	return i
+// getRealtimeFeeKey 获取实时平台服务费(分)的Redis键
+func getRealtimeFeeKey(adID, date string) string {
+	return "stats:realtime:" + adID + ":" + date + ":fee"
 }
 
-// parseFloat64 解析字符串为float64
-func parseFloat64(s string) float64 {
-	var f float64
-	err := json.Unmarshal([]byte(s), &f)
-	if err != nil {
-		return 0
-	}
-	return f
+// getRealtimeTaxKey 获取实时税费(分)的Redis键
+func getRealtimeTaxKey(adID, date string) string {
+	return "stats:realtime:" + adID + ":" + date + ":tax"
+}
+
+// centsOf 将元转换为分，四舍五入
+func centsOf(amount float64) int64 {
+	return int64(math.Round(amount * 100))
 }
 
 // calculateCTR 计算点击率
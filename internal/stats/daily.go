@@ -0,0 +1,101 @@
+package stats
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+)
+
+// RealtimeStats 实时统计数据
+type RealtimeStats struct {
+	AdID        string  `json:"ad_id"`
+	Date        string  `json:"date"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	Conversions int64   `json:"conversions"`
+	Cost        float64 `json:"cost"` // 媒体成本
+	CTR         float64 `json:"ctr"`
+	CVR         float64 `json:"cvr"`
+
+	// 可见性
+	ViewableImpressions int64   `json:"viewable_impressions"`
+	ViewabilityRate     float64 `json:"viewability_rate"` // 可见展示/展示
+
+	// 视频播放进度
+	VideoStarts         int64   `json:"video_starts"`
+	VideoFirstQuartiles int64   `json:"video_first_quartiles"`
+	VideoMidpoints      int64   `json:"video_midpoints"`
+	VideoThirdQuartiles int64   `json:"video_third_quartiles"`
+	VideoCompletes      int64   `json:"video_completes"`
+	VideoCompletionRate float64 `json:"video_completion_rate"` // 完播/开始播放
+
+	// 落地页停留
+	DwellEvents int64   `json:"dwell_events"`
+	AvgDwellMs  float64 `json:"avg_dwell_ms"`
+
+	// 费用构成，应付金额为媒体成本、平台服务费和税费之和
+	Fee       float64 `json:"fee"`
+	Tax       float64 `json:"tax"`
+	TotalCost float64 `json:"total_cost"`
+
+	UpdateTime time.Time `json:"update_time"`
+}
+
+// loadDailyStats 从实时计数器读取广告单日统计
+func loadDailyStats(ctx context.Context, redisClient *redis.Client, adID, date string) (*RealtimeStats, error) {
+	keys := []string{
+		getRealtimeKey(adID, date, EventImpression),
+		getRealtimeKey(adID, date, EventClick),
+		getRealtimeKey(adID, date, EventConversion),
+		getRealtimeCostKey(adID, date),
+		getRealtimeKey(adID, date, EventViewableImpression),
+		getRealtimeKey(adID, date, EventDwell),
+		getRealtimeDwellKey(adID, date),
+	}
+	for _, eventType := range VideoEvents {
+		keys = append(keys, getRealtimeKey(adID, date, eventType))
+	}
+	keys = append(keys, getRealtimeFeeKey(adID, date), getRealtimeTaxKey(adID, date))
+
+	counts, err := cache.MGetInt64(ctx, redisClient, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &RealtimeStats{
+		AdID:                adID,
+		Date:                date,
+		Impressions:         counts[0],
+		Clicks:              counts[1],
+		Conversions:         counts[2],
+		Cost:                float64(counts[3]) / 100, // 计数器以分为单位累加
+		ViewableImpressions: counts[4],
+		DwellEvents:         counts[5],
+		VideoStarts:         counts[7],
+		VideoFirstQuartiles: counts[8],
+		VideoMidpoints:      counts[9],
+		VideoThirdQuartiles: counts[10],
+		VideoCompletes:      counts[11],
+		Fee:                 float64(counts[12]) / 100,
+		Tax:                 float64(counts[13]) / 100,
+		UpdateTime:          time.Now(),
+	}
+	stats.TotalCost = float64(counts[3]+counts[12]+counts[13]) / 100
+	stats.CTR = calculateCTR(stats.Impressions, stats.Clicks)
+	stats.CVR = calculateCVR(stats.Clicks, stats.Conversions)
+	stats.ViewabilityRate = Ratio(stats.ViewableImpressions, stats.Impressions)
+	stats.VideoCompletionRate = Ratio(stats.VideoCompletes, stats.VideoStarts)
+	stats.AvgDwellMs = Ratio(counts[6], stats.DwellEvents)
+	return stats, nil
+}
+
+// Ratio 计算比值，分母为0时返回0
+func Ratio(numerator, denominator int64) float64 {
+	if denominator == 0 {
+		return 0
+	}
+	return float64(numerator) / float64(denominator)
+}
@@ -0,0 +1,282 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/timezone"
+	"simple-dsp/pkg/useragent"
+)
+
+const (
+	// dimensionKeyPrefix 按维度统计的Redis键前缀，完整键为stats:dim:{ad_id}:{date}:{dimension}
+	// 哈希的字段为{维度值}|{指标}
+	dimensionKeyPrefix = "stats:dim:"
+	// defaultDimensionRetentionDays 按维度统计的默认保留天数，覆盖报表最长92天的查询范围
+	defaultDimensionRetentionDays = 92
+	// unknownDimensionValue 没有解析出维度值时的取值
+	unknownDimensionValue = "unknown"
+)
+
+// Dimension 报表维度
+type Dimension string
+
+const (
+	// DimensionCountry 国家
+	DimensionCountry Dimension = "country"
+	// DimensionProvince 省份，取值为{国家}/{省份}
+	DimensionProvince Dimension = "province"
+	// DimensionCity 城市，取值为{国家}/{省份}/{城市}
+	DimensionCity Dimension = "city"
+	// DimensionDeviceType 设备类型，如mobile、tablet、desktop、ctv
+	DimensionDeviceType Dimension = "device_type"
+	// DimensionOS 操作系统
+	DimensionOS Dimension = "os"
+)
+
+// AllDimensions 支持的报表维度
+var AllDimensions = []Dimension{
+	DimensionCountry,
+	DimensionProvince,
+	DimensionCity,
+	DimensionDeviceType,
+	DimensionOS,
+}
+
+// ParseDimension 解析报表维度，不支持时返回ErrUnknownDimension
+func ParseDimension(s string) (Dimension, error) {
+	for _, d := range AllDimensions {
+		if string(d) == s {
+			return d, nil
+		}
+	}
+	return "", ErrUnknownDimension
+}
+
+// Dimensions 事件的地域和设备维度，地域来自IP库，设备来自User-Agent
+type Dimensions struct {
+	Country    string `json:"country,omitempty"`
+	Province   string `json:"province,omitempty"`
+	City       string `json:"city,omitempty"`
+	DeviceType string `json:"device_type,omitempty"`
+	OS         string `json:"os,omitempty"`
+}
+
+// IsZero 判断是否没有任何维度
+func (d Dimensions) IsZero() bool {
+	return d == Dimensions{}
+}
+
+// Value 返回维度的取值，省份和城市带上级地域以免重名，没有取值时返回unknown
+func (d Dimensions) Value(dim Dimension) string {
+	var v string
+	switch dim {
+	case DimensionCountry:
+		v = d.Country
+	case DimensionProvince:
+		if d.Province != "" {
+			v = d.Country + "/" + d.Province
+		}
+	case DimensionCity:
+		if d.City != "" {
+			v = d.Country + "/" + d.Province + "/" + d.City
+		}
+	case DimensionDeviceType:
+		v = d.DeviceType
+	case DimensionOS:
+		v = d.OS
+	}
+	if v == "" {
+		return unknownDimensionValue
+	}
+	return v
+}
+
+// DimensionResolver 按IP和User-Agent解析事件维度
+type DimensionResolver struct {
+	geo *geo.Database
+}
+
+// NewDimensionResolver 创建维度解析器，geoDB为nil时不解析地域
+func NewDimensionResolver(geoDB *geo.Database) *DimensionResolver {
+	return &DimensionResolver{geo: geoDB}
+}
+
+// Resolve 解析IP所在的地域和User-Agent对应的设备
+func (r *DimensionResolver) Resolve(ip, userAgent string) Dimensions {
+	var d Dimensions
+	if loc, ok := r.geo.Lookup(ip); ok {
+		d.Country = loc.Country
+		d.Province = loc.Province
+		d.City = loc.City
+	}
+	if userAgent != "" {
+		device := useragent.Parse(userAgent)
+		d.DeviceType = device.Type
+		d.OS = device.OS
+	}
+	return d
+}
+
+// 按维度统计的指标
+const (
+	dimensionMetricWin        = "win"
+	dimensionMetricImpression = "impression"
+	dimensionMetricClick      = "click"
+	dimensionMetricConversion = "conversion"
+	dimensionMetricCost       = "cost" // 分
+)
+
+// DimensionStats 一个维度取值的汇总统计
+type DimensionStats struct {
+	Value       string  `json:"value"`
+	Wins        int64   `json:"wins"`
+	Impressions int64   `json:"impressions"`
+	Clicks      int64   `json:"clicks"`
+	Conversions int64   `json:"conversions"`
+	Cost        float64 `json:"cost"`
+	CTR         float64 `json:"ctr"`
+	CVR         float64 `json:"cvr"`
+}
+
+// DimensionStore 按维度统计的Redis存储，每个广告每天每个维度一个哈希
+type DimensionStore struct {
+	redis *redis.Client
+	ttl   time.Duration
+}
+
+// NewDimensionStore 创建按维度统计的存储，retentionDays不大于0时保留92天
+func NewDimensionStore(redisClient *redis.Client, retentionDays int) *DimensionStore {
+	if retentionDays <= 0 {
+		retentionDays = defaultDimensionRetentionDays
+	}
+	return &DimensionStore{
+		redis: redisClient,
+		ttl:   time.Duration(retentionDays+1) * 24 * time.Hour,
+	}
+}
+
+// record 按事件更新各维度的统计，date为广告时区中的日期；为nil时不统计
+func (s *DimensionStore) record(ctx context.Context, event *Event, date string) error {
+	if s == nil {
+		return nil
+	}
+
+	var metric string
+	switch event.EventType {
+	case EventWin:
+		metric = dimensionMetricWin
+	case EventImpression:
+		metric = dimensionMetricImpression
+	case EventClick:
+		metric = dimensionMetricClick
+	case EventConversion:
+		metric = dimensionMetricConversion
+	default:
+		return nil
+	}
+	// 与实时计数器一致，展示或竞价成功通知携带成交价时累加消耗
+	var costCents int64
+	if event.Charged() {
+		costCents = centsOf(event.WinPrice)
+	}
+
+	pipe := s.redis.Pipeline()
+	for _, dim := range AllDimensions {
+		key := dimensionKey(event.AdID, date, dim)
+		value := event.Dimensions.Value(dim)
+		pipe.HIncrBy(ctx, key, dimensionField(value, metric), 1)
+		if costCents > 0 {
+			pipe.HIncrBy(ctx, key, dimensionField(value, dimensionMetricCost), costCents)
+		}
+		pipe.Expire(ctx, key, s.ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Load 汇总广告在[startDate, endDate]内按维度拆分的统计，按展示数降序排列
+// 日期格式为2006-01-02，与实时计数器一样按广告时区划分
+func (s *DimensionStore) Load(ctx context.Context, adID string, dim Dimension, startDate, endDate string) ([]DimensionStats, error) {
+	start, err := time.Parse(timezone.DateLayout, startDate)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.Parse(timezone.DateLayout, endDate)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		keys = append(keys, dimensionKey(adID, day.Format(timezone.DateLayout), dim))
+	}
+	hashes, err := cache.HGetAll(ctx, s.redis, keys)
+	if err != nil {
+		return nil, fmt.Errorf("读取按维度统计失败: %w", err)
+	}
+
+	index := make(map[string]*DimensionStats)
+	costs := make(map[string]int64)
+	for _, hash := range hashes {
+		for field, raw := range hash {
+			sep := strings.LastIndexByte(field, '|')
+			if sep < 0 {
+				continue
+			}
+			value, metric := field[:sep], field[sep+1:]
+			n, _ := strconv.ParseInt(raw, 10, 64)
+
+			item, ok := index[value]
+			if !ok {
+				item = &DimensionStats{Value: value}
+				index[value] = item
+			}
+			switch metric {
+			case dimensionMetricWin:
+				item.Wins += n
+			case dimensionMetricImpression:
+				item.Impressions += n
+			case dimensionMetricClick:
+				item.Clicks += n
+			case dimensionMetricConversion:
+				item.Conversions += n
+			case dimensionMetricCost:
+				costs[value] += n
+			}
+		}
+	}
+
+	items := make([]DimensionStats, 0, len(index))
+	for value, item := range index {
+		item.Cost = float64(costs[value]) / 100
+		item.CTR = calculateCTR(item.Impressions, item.Clicks)
+		item.CVR = calculateCVR(item.Clicks, item.Conversions)
+		items = append(items, *item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Impressions != items[j].Impressions {
+			return items[i].Impressions > items[j].Impressions
+		}
+		return items[i].Value < items[j].Value
+	})
+	return items, nil
+}
+
+// dimensionKey 按维度统计的Redis键
+func dimensionKey(adID, date string, dim Dimension) string {
+	return dimensionKeyPrefix + adID + ":" + date + ":" + string(dim)
+}
+
+// dimensionField 按维度统计的哈希字段
+func dimensionField(value, metric string) string {
+	return value + "|" + metric
+}
@@ -0,0 +1,347 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	eventsv1 "simple-dsp/api/proto/events/v1"
+	"simple-dsp/pkg/schemaregistry"
+)
+
+// 事件写入Kafka的编码格式
+const (
+	// FormatJSON JSON编码，不经过Schema Registry
+	FormatJSON = "json"
+	// FormatProtobuf 按api/proto/events/v1/event.proto编码，带Schema Registry线格式头
+	FormatProtobuf = "protobuf"
+)
+
+// dsp.events.v1.Event的字段编号，只能新增，不能修改或复用
+const (
+	fieldEventType   protowire.Number = 1
+	fieldRequestID   protowire.Number = 2
+	fieldUserID      protowire.Number = 3
+	fieldAdID        protowire.Number = 4
+	fieldSlotID      protowire.Number = 5
+	fieldBidPrice    protowire.Number = 6
+	fieldWinPrice    protowire.Number = 7
+	fieldFee         protowire.Number = 8
+	fieldTax         protowire.Number = 9
+	fieldTimestampUs protowire.Number = 10
+	fieldIP          protowire.Number = 11
+	fieldUserAgent   protowire.Number = 12
+	fieldDwellMs     protowire.Number = 13
+	fieldExtraParams protowire.Number = 14
+	fieldCountry     protowire.Number = 15
+	fieldProvince    protowire.Number = 16
+	fieldCity        protowire.Number = 17
+	fieldDeviceType  protowire.Number = 18
+	fieldOS          protowire.Number = 19
+
+	// map字段每个条目的键和值
+	fieldMapKey   protowire.Number = 1
+	fieldMapValue protowire.Number = 2
+)
+
+// EventEncoder 按注册到Schema Registry的版本编码事件
+type EventEncoder struct {
+	ids map[string]int // 主题 -> Schema ID
+}
+
+// NewEventEncoder 为各主题检查事件Schema的兼容性并注册，返回带Schema ID的编码器
+// compatibility不为空时先设置主题的兼容性级别；与已注册版本不兼容时返回ErrIncompatibleSchema
+func NewEventEncoder(ctx context.Context, registry *schemaregistry.Client, topics []string, compatibility string) (*EventEncoder, error) {
+	schema := schemaregistry.Schema{Schema: eventsv1.EventSchema, SchemaType: schemaregistry.SchemaTypeProtobuf}
+
+	ids := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		subject := schemaregistry.Subject(topic)
+		if compatibility != "" {
+			if err := registry.SetCompatibility(ctx, subject, compatibility); err != nil {
+				return nil, fmt.Errorf("设置%s的兼容性级别失败: %w", subject, err)
+			}
+		}
+		compatible, messages, err := registry.CheckCompatibility(ctx, subject, schema)
+		if err != nil {
+			return nil, fmt.Errorf("检查%s的兼容性失败: %w", subject, err)
+		}
+		if !compatible {
+			return nil, fmt.Errorf("%w: %s %v", ErrIncompatibleSchema, subject, messages)
+		}
+		id, err := registry.Register(ctx, subject, schema)
+		if err != nil {
+			return nil, fmt.Errorf("注册%s失败: %w", subject, err)
+		}
+		ids[topic] = id
+	}
+	return &EventEncoder{ids: ids}, nil
+}
+
+// Encode 将事件编码为带线格式头的Protobuf消息，主题未注册Schema时返回ErrSchemaNotRegistered
+func (e *EventEncoder) Encode(topic string, event *Event) ([]byte, error) {
+	id, ok := e.ids[topic]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSchemaNotRegistered, topic)
+	}
+	return AppendEventProto(schemaregistry.AppendProtobufHeader(nil, id), event), nil
+}
+
+// DecodeEvent 解码Kafka消息中的事件，同时支持JSON和带线格式头的Protobuf
+// Protobuf中未知的字段忽略，新版本新增的字段不影响旧的消费方
+func DecodeEvent(data []byte) (*Event, error) {
+	var event Event
+	if !schemaregistry.IsFramed(data) {
+		if err := json.Unmarshal(data, &event); err != nil {
+			return nil, err
+		}
+		return &event, nil
+	}
+
+	_, indexes, payload, err := schemaregistry.ParseProtobufHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) != 1 || indexes[0] != 0 {
+		return nil, fmt.Errorf("%w: 消息索引%v", ErrIncompatibleSchema, indexes)
+	}
+	if err := UnmarshalEventProto(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// AppendEventProto 按dsp.events.v1.Event编码事件并追加到dst，零值字段不写出
+func AppendEventProto(dst []byte, e *Event) []byte {
+	dst = appendString(dst, fieldEventType, string(e.EventType))
+	dst = appendString(dst, fieldRequestID, e.RequestID)
+	dst = appendString(dst, fieldUserID, e.UserID)
+	dst = appendString(dst, fieldAdID, e.AdID)
+	dst = appendString(dst, fieldSlotID, e.SlotID)
+	dst = appendDouble(dst, fieldBidPrice, e.BidPrice)
+	dst = appendDouble(dst, fieldWinPrice, e.WinPrice)
+	dst = appendDouble(dst, fieldFee, e.Fee)
+	dst = appendDouble(dst, fieldTax, e.Tax)
+	if !e.Timestamp.IsZero() {
+		dst = appendInt64(dst, fieldTimestampUs, e.Timestamp.UnixMicro())
+	}
+	dst = appendString(dst, fieldIP, e.IP)
+	dst = appendString(dst, fieldUserAgent, e.UserAgent)
+	dst = appendInt64(dst, fieldDwellMs, e.DwellMs)
+
+	// 按键排序，相同的事件编码结果相同
+	keys := make([]string, 0, len(e.ExtraParams))
+	for k := range e.ExtraParams {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry []byte
+		entry = appendString(entry, fieldMapKey, k)
+		entry = appendString(entry, fieldMapValue, e.ExtraParams[k])
+		dst = protowire.AppendTag(dst, fieldExtraParams, protowire.BytesType)
+		dst = protowire.AppendBytes(dst, entry)
+	}
+
+	dst = appendString(dst, fieldCountry, e.Country)
+	dst = appendString(dst, fieldProvince, e.Province)
+	dst = appendString(dst, fieldCity, e.City)
+	dst = appendString(dst, fieldDeviceType, e.DeviceType)
+	dst = appendString(dst, fieldOS, e.OS)
+	return dst
+}
+
+// UnmarshalEventProto 按dsp.events.v1.Event解码事件
+// 未知字段跳过；已知字段的类型与Schema不一致时返回ErrIncompatibleSchema
+func UnmarshalEventProto(data []byte, e *Event) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("解析事件失败: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		want, known := eventFieldTypes[num]
+		if !known {
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return fmt.Errorf("解析事件失败: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			continue
+		}
+		if typ != want {
+			return fmt.Errorf("%w: 字段%d的类型为%d，应为%d", ErrIncompatibleSchema, num, typ, want)
+		}
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return fmt.Errorf("解析事件失败: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			if num == fieldExtraParams {
+				k, val, err := consumeMapEntry(v)
+				if err != nil {
+					return err
+				}
+				if e.ExtraParams == nil {
+					e.ExtraParams = make(map[string]string)
+				}
+				e.ExtraParams[k] = val
+				continue
+			}
+			*e.stringField(num) = string(v)
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data)
+			if n < 0 {
+				return fmt.Errorf("解析事件失败: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			*e.doubleField(num) = math.Float64frombits(v)
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return fmt.Errorf("解析事件失败: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			if num == fieldTimestampUs {
+				e.Timestamp = time.UnixMicro(int64(v))
+			} else {
+				e.DwellMs = int64(v)
+			}
+		}
+	}
+	return nil
+}
+
+// eventFieldTypes 已知字段的编码类型
+var eventFieldTypes = map[protowire.Number]protowire.Type{
+	fieldEventType:   protowire.BytesType,
+	fieldRequestID:   protowire.BytesType,
+	fieldUserID:      protowire.BytesType,
+	fieldAdID:        protowire.BytesType,
+	fieldSlotID:      protowire.BytesType,
+	fieldBidPrice:    protowire.Fixed64Type,
+	fieldWinPrice:    protowire.Fixed64Type,
+	fieldFee:         protowire.Fixed64Type,
+	fieldTax:         protowire.Fixed64Type,
+	fieldTimestampUs: protowire.VarintType,
+	fieldIP:          protowire.BytesType,
+	fieldUserAgent:   protowire.BytesType,
+	fieldDwellMs:     protowire.VarintType,
+	fieldExtraParams: protowire.BytesType,
+	fieldCountry:     protowire.BytesType,
+	fieldProvince:    protowire.BytesType,
+	fieldCity:        protowire.BytesType,
+	fieldDeviceType:  protowire.BytesType,
+	fieldOS:          protowire.BytesType,
+}
+
+// stringField 返回字符串字段的地址
+func (e *Event) stringField(num protowire.Number) *string {
+	switch num {
+	case fieldEventType:
+		return (*string)(&e.EventType)
+	case fieldRequestID:
+		return &e.RequestID
+	case fieldUserID:
+		return &e.UserID
+	case fieldAdID:
+		return &e.AdID
+	case fieldSlotID:
+		return &e.SlotID
+	case fieldIP:
+		return &e.IP
+	case fieldUserAgent:
+		return &e.UserAgent
+	case fieldCountry:
+		return &e.Country
+	case fieldProvince:
+		return &e.Province
+	case fieldCity:
+		return &e.City
+	case fieldDeviceType:
+		return &e.DeviceType
+	default:
+		return &e.OS
+	}
+}
+
+// doubleField 返回金额字段的地址
+func (e *Event) doubleField(num protowire.Number) *float64 {
+	switch num {
+	case fieldBidPrice:
+		return &e.BidPrice
+	case fieldWinPrice:
+		return &e.WinPrice
+	case fieldFee:
+		return &e.Fee
+	default:
+		return &e.Tax
+	}
+}
+
+// consumeMapEntry 解析map<string, string>的一个条目
+func consumeMapEntry(data []byte) (string, string, error) {
+	var key, value string
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", "", fmt.Errorf("解析扩展参数失败: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		if (num == fieldMapKey || num == fieldMapValue) && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return "", "", fmt.Errorf("解析扩展参数失败: %w", protowire.ParseError(n))
+			}
+			data = data[n:]
+			if num == fieldMapKey {
+				key = string(v)
+			} else {
+				value = string(v)
+			}
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return "", "", fmt.Errorf("解析扩展参数失败: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+	}
+	return key, value, nil
+}
+
+// appendString 写出非空的字符串字段
+func appendString(dst []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return dst
+	}
+	dst = protowire.AppendTag(dst, num, protowire.BytesType)
+	return protowire.AppendString(dst, v)
+}
+
+// appendDouble 写出非零的double字段
+func appendDouble(dst []byte, num protowire.Number, v float64) []byte {
+	if v == 0 {
+		return dst
+	}
+	dst = protowire.AppendTag(dst, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(dst, math.Float64bits(v))
+}
+
+// appendInt64 写出非零的int64字段
+func appendInt64(dst []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return dst
+	}
+	dst = protowire.AppendTag(dst, num, protowire.VarintType)
+	return protowire.AppendVarint(dst, uint64(v))
+}
@@ -0,0 +1,20 @@
+package stats
+
+import "errors"
+
+var (
+	// ErrUnknownDimension 表示不支持的报表维度
+	ErrUnknownDimension = errors.New("不支持的报表维度")
+
+	// ErrIncompatibleSchema 表示事件Schema与已注册的版本不兼容
+	ErrIncompatibleSchema = errors.New("事件Schema不兼容")
+
+	// ErrSchemaNotRegistered 表示主题没有注册事件Schema
+	ErrSchemaNotRegistered = errors.New("主题未注册事件Schema")
+
+	// ErrSpillFull 表示事件磁盘缓冲已达到大小上限
+	ErrSpillFull = errors.New("事件磁盘缓冲已满")
+
+	// ErrSpillCorrupt 表示事件磁盘缓冲文件损坏
+	ErrSpillCorrupt = errors.New("事件磁盘缓冲文件损坏")
+)
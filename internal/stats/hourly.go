@@ -0,0 +1,198 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/clock"
+)
+
+const (
+	// hourlyKeyPrefix 按小时统计的Redis键前缀，完整键为stats:hourly:{ad_id}:{yyyyMMddHH}
+	hourlyKeyPrefix = "stats:hourly:"
+	// creativeHourlyKeyPrefix 按素材的小时统计，完整键为stats:creative_hourly:{ad_id}:{creative_id}:{yyyyMMddHH}，只记录展示和点击
+	creativeHourlyKeyPrefix = "stats:creative_hourly:"
+	hourLayout              = "2006010215"
+	// hourlyTTL 按小时统计的保留时间，覆盖自动化规则最长7天的统计窗口
+	hourlyTTL = 8 * 24 * time.Hour
+)
+
+// 按小时统计的字段
+const (
+	hourlyFieldBid        = "bid"
+	hourlyFieldWin        = "win"
+	hourlyFieldImpression = "impression"
+	hourlyFieldClick      = "click"
+	hourlyFieldConversion = "conversion"
+	hourlyFieldCost       = "cost" // 媒体成本，分
+	hourlyFieldFee        = "fee"  // 平台服务费，分
+	hourlyFieldTax        = "tax"  // 税费，分
+)
+
+// WindowStats 广告在一段时间内的汇总统计
+type WindowStats struct {
+	AdID        string    `json:"ad_id"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Bids        int64     `json:"bids"`
+	Wins        int64     `json:"wins"`
+	Impressions int64     `json:"impressions"`
+	Clicks      int64     `json:"clicks"`
+	Conversions int64     `json:"conversions"`
+	Cost        float64   `json:"cost"` // 媒体成本
+	Fee         float64   `json:"fee"`
+	Tax         float64   `json:"tax"`
+}
+
+// HourlyStore 按小时统计的Redis存储，每个广告每小时一个哈希
+type HourlyStore struct {
+	redis *redis.Client
+	clock clock.Clock
+}
+
+// NewHourlyStore 创建按小时统计的存储
+func NewHourlyStore(redisClient *redis.Client) *HourlyStore {
+	return &HourlyStore{redis: redisClient, clock: clock.Real()}
+}
+
+// SetClock 设置出价次数归属小时的时间来源，为nil时使用系统时钟
+func (s *HourlyStore) SetClock(c clock.Clock) {
+	s.clock = clock.OrReal(c)
+}
+
+// CountBids 累加广告的出价次数，每个广告ID计一次
+func (s *HourlyStore) CountBids(ctx context.Context, adIDs []string) error {
+	if len(adIDs) == 0 {
+		return nil
+	}
+	hour := s.clock.Now().Format(hourLayout)
+	pipe := s.redis.Pipeline()
+	for _, adID := range adIDs {
+		key := hourlyKey(adID, hour)
+		pipe.HIncrBy(ctx, key, hourlyFieldBid, 1)
+		pipe.Expire(ctx, key, hourlyTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("写入出价次数失败: %w", err)
+	}
+	return nil
+}
+
+// record 按事件更新按小时统计
+func (s *HourlyStore) record(ctx context.Context, event *Event) error {
+	fields := make(map[string]int64, 2)
+	switch event.EventType {
+	case EventImpression:
+		fields[hourlyFieldImpression] = 1
+	case EventClick:
+		fields[hourlyFieldClick] = 1
+	case EventConversion:
+		fields[hourlyFieldConversion] = 1
+	case EventWin:
+		fields[hourlyFieldWin] = 1
+	default:
+		return nil
+	}
+	// 与实时计数器一致，展示或竞价成功通知携带成交价时累加消耗
+	if event.Charged() {
+		fields[hourlyFieldCost] = centsOf(event.WinPrice)
+		if event.Fee > 0 {
+			fields[hourlyFieldFee] = centsOf(event.Fee)
+		}
+		if event.Tax > 0 {
+			fields[hourlyFieldTax] = centsOf(event.Tax)
+		}
+	}
+
+	hour := event.Timestamp.Format(hourLayout)
+	key := hourlyKey(event.AdID, hour)
+	pipe := s.redis.Pipeline()
+	for field, n := range fields {
+		pipe.HIncrBy(ctx, key, field, n)
+	}
+	pipe.Expire(ctx, key, hourlyTTL)
+	// 素材疲劳检测按素材比较CTR
+	if event.CreativeID != "" && (event.EventType == EventImpression || event.EventType == EventClick) {
+		field := hourlyFieldImpression
+		if event.EventType == EventClick {
+			field = hourlyFieldClick
+		}
+		creativeKey := creativeHourlyKey(event.AdID, event.CreativeID, hour)
+		pipe.HIncrBy(ctx, creativeKey, field, 1)
+		pipe.Expire(ctx, creativeKey, hourlyTTL)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// LoadWindow 汇总广告从from所在小时到to所在小时的统计
+func (s *HourlyStore) LoadWindow(ctx context.Context, adID string, from, to time.Time) (*WindowStats, error) {
+	return s.loadWindow(ctx, adID, from, to, func(hour string) string {
+		return hourlyKey(adID, hour)
+	})
+}
+
+// LoadCreativeWindow 汇总广告的一个素材从from所在小时到to所在小时的展示和点击
+func (s *HourlyStore) LoadCreativeWindow(ctx context.Context, adID, creativeID string, from, to time.Time) (*WindowStats, error) {
+	return s.loadWindow(ctx, adID, from, to, func(hour string) string {
+		return creativeHourlyKey(adID, creativeID, hour)
+	})
+}
+
+// loadWindow 按keyOf返回的每小时的键汇总统计
+func (s *HourlyStore) loadWindow(ctx context.Context, adID string, from, to time.Time, keyOf func(hour string) string) (*WindowStats, error) {
+	result := &WindowStats{AdID: adID, From: from, To: to}
+
+	var keys []string
+	for hour := from.Truncate(time.Hour); !hour.After(to); hour = hour.Add(time.Hour) {
+		keys = append(keys, keyOf(hour.Format(hourLayout)))
+	}
+	hashes, err := cache.HGetAll(ctx, s.redis, keys)
+	if err != nil {
+		return nil, fmt.Errorf("读取按小时统计失败: %w", err)
+	}
+
+	var costCents, feeCents, taxCents int64
+	for _, hash := range hashes {
+		for field, value := range hash {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			switch field {
+			case hourlyFieldBid:
+				result.Bids += n
+			case hourlyFieldWin:
+				result.Wins += n
+			case hourlyFieldImpression:
+				result.Impressions += n
+			case hourlyFieldClick:
+				result.Clicks += n
+			case hourlyFieldConversion:
+				result.Conversions += n
+			case hourlyFieldCost:
+				costCents += n
+			case hourlyFieldFee:
+				feeCents += n
+			case hourlyFieldTax:
+				taxCents += n
+			}
+		}
+	}
+	result.Cost = float64(costCents) / 100
+	result.Fee = float64(feeCents) / 100
+	result.Tax = float64(taxCents) / 100
+	return result, nil
+}
+
+// hourlyKey 按小时统计的Redis键
+func hourlyKey(adID, hour string) string {
+	return hourlyKeyPrefix + adID + ":" + hour
+}
+
+// creativeHourlyKey 按素材的小时统计的Redis键
+func creativeHourlyKey(adID, creativeID, hour string) string {
+	return creativeHourlyKeyPrefix + adID + ":" + creativeID + ":" + hour
+}
@@ -2,6 +2,7 @@ package stats
 
 import (
 	"context"
+
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 
@@ -53,3 +54,8 @@ func (s *Service) GetHourlyStats(ctx context.Context) (interface{}, error) {
 	// TODO: 实现每小时统计
 	return nil, nil
 }
+
+// GetAdDailyStats 获取广告单日统计，数据来自实时计数器
+func (s *Service) GetAdDailyStats(ctx context.Context, adID, date string) (*RealtimeStats, error) {
+	return loadDailyStats(ctx, s.redis, adID, date)
+}
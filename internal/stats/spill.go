@@ -0,0 +1,277 @@
+package stats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	// spillSuffix 磁盘缓冲文件的后缀
+	spillSuffix = ".spill"
+	// spillHeaderSize 每条记录的头：4字节长度和4字节CRC32
+	spillHeaderSize = 8
+	// maxSpillRecord 单条记录的长度上限，超过时视为文件损坏
+	maxSpillRecord = 64 << 20
+)
+
+// spillLog 事件的本地磁盘缓冲，按顺序追加到分段文件，从最早的文件开始读取
+// 每条记录为长度、CRC32和消息(主题、键、值)，一个文件读完后删除
+// 不是并发安全的，由WriteBuffer加锁使用
+type spillLog struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+
+	// segments 待重放的文件序号，按写入顺序排列，最后一个可能正在写入
+	segments []uint64
+	// size 待重放文件的总大小
+	size int64
+
+	writer    *os.File
+	writerSeq uint64
+	writeSize int64
+
+	// readOffset 第一个文件中已重放的字节数
+	readOffset int64
+}
+
+// openSpillLog 打开磁盘缓冲目录，目录中已有的文件在重启后继续重放
+// 新事件总是写入新文件，上次进程崩溃时未写完的记录在重放时按损坏处理
+func openSpillLog(dir string, maxBytes, segmentBytes int64) (*spillLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建磁盘缓冲目录失败: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取磁盘缓冲目录失败: %w", err)
+	}
+
+	l := &spillLog{dir: dir, maxBytes: maxBytes, segmentBytes: segmentBytes}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spillSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spillSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("读取磁盘缓冲文件失败: %w", err)
+		}
+		l.segments = append(l.segments, seq)
+		l.size += info.Size()
+	}
+	sort.Slice(l.segments, func(i, j int) bool { return l.segments[i] < l.segments[j] })
+	if n := len(l.segments); n > 0 {
+		l.writerSeq = l.segments[n-1]
+	}
+	return l, nil
+}
+
+// empty 是否没有待重放的事件
+func (l *spillLog) empty() bool {
+	return len(l.segments) == 0
+}
+
+// append 追加一条消息，超过总大小上限时返回ErrSpillFull
+func (l *spillLog) append(msg kafka.Message) (int64, error) {
+	record := encodeSpillRecord(msg)
+	if l.size+int64(len(record)) > l.maxBytes {
+		return 0, ErrSpillFull
+	}
+	if l.writer == nil || l.writeSize >= l.segmentBytes {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := l.writer.Write(record); err != nil {
+		return 0, fmt.Errorf("写入磁盘缓冲失败: %w", err)
+	}
+	l.writeSize += int64(len(record))
+	l.size += int64(len(record))
+	return int64(len(record)), nil
+}
+
+// rotate 关闭当前文件，开始写入新文件
+func (l *spillLog) rotate() error {
+	if err := l.closeWriter(); err != nil {
+		return err
+	}
+	l.writerSeq++
+	f, err := os.OpenFile(l.path(l.writerSeq), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("创建磁盘缓冲文件失败: %w", err)
+	}
+	l.writer = f
+	l.writeSize = 0
+	l.segments = append(l.segments, l.writerSeq)
+	return nil
+}
+
+// closeWriter 同步并关闭正在写入的文件
+func (l *spillLog) closeWriter() error {
+	if l.writer == nil {
+		return nil
+	}
+	err := l.writer.Sync()
+	if cerr := l.writer.Close(); err == nil {
+		err = cerr
+	}
+	l.writer = nil
+	if err != nil {
+		return fmt.Errorf("关闭磁盘缓冲文件失败: %w", err)
+	}
+	return nil
+}
+
+// peek 从第一个文件读取最多n条消息，返回消息和读完后的位置，由commit确认
+// 文件在读取位置之后损坏时返回ErrSpillCorrupt，由discard丢弃文件剩余的部分
+func (l *spillLog) peek(n int) ([]kafka.Message, int64, error) {
+	if l.empty() {
+		return nil, 0, nil
+	}
+	f, err := os.Open(l.path(l.segments[0]))
+	if err != nil {
+		return nil, 0, fmt.Errorf("打开磁盘缓冲文件失败: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取磁盘缓冲文件失败: %w", err)
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, l.readOffset, info.Size()-l.readOffset))
+	offset := l.readOffset
+	messages := make([]kafka.Message, 0, n)
+	header := make([]byte, spillHeaderSize)
+	for len(messages) < n && offset < info.Size() {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return messages, offset, ErrSpillCorrupt
+		}
+		size := binary.BigEndian.Uint32(header[:4])
+		if size > maxSpillRecord {
+			return messages, offset, ErrSpillCorrupt
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return messages, offset, ErrSpillCorrupt
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			return messages, offset, ErrSpillCorrupt
+		}
+		msg, err := decodeSpillPayload(payload)
+		if err != nil {
+			return messages, offset, ErrSpillCorrupt
+		}
+		messages = append(messages, msg)
+		offset += spillHeaderSize + int64(size)
+	}
+	return messages, offset, nil
+}
+
+// commit 确认第一个文件已重放到offset，文件读完时删除
+func (l *spillLog) commit(offset int64) error {
+	if l.empty() {
+		return nil
+	}
+	l.size -= offset - l.readOffset
+	l.readOffset = offset
+
+	seq := l.segments[0]
+	info, err := os.Stat(l.path(seq))
+	if err != nil {
+		return fmt.Errorf("读取磁盘缓冲文件失败: %w", err)
+	}
+	if offset < info.Size() {
+		return nil
+	}
+	return l.remove(seq)
+}
+
+// discard 丢弃第一个文件中未重放的部分
+func (l *spillLog) discard() error {
+	if l.empty() {
+		return nil
+	}
+	seq := l.segments[0]
+	if info, err := os.Stat(l.path(seq)); err == nil {
+		l.size -= info.Size() - l.readOffset
+	}
+	return l.remove(seq)
+}
+
+// remove 删除第一个文件，正在写入时先关闭，之后的事件写入新文件
+func (l *spillLog) remove(seq uint64) error {
+	if seq == l.writerSeq && l.writer != nil {
+		if err := l.closeWriter(); err != nil {
+			return err
+		}
+	}
+	l.segments = l.segments[1:]
+	l.readOffset = 0
+	if l.empty() {
+		l.size = 0
+	}
+	if err := os.Remove(l.path(seq)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除磁盘缓冲文件失败: %w", err)
+	}
+	return nil
+}
+
+// close 同步并关闭正在写入的文件，未重放的文件保留到下次启动
+func (l *spillLog) close() error {
+	return l.closeWriter()
+}
+
+// path 文件序号对应的路径
+func (l *spillLog) path(seq uint64) string {
+	return filepath.Join(l.dir, fmt.Sprintf("%020d%s", seq, spillSuffix))
+}
+
+// encodeSpillRecord 编码一条记录：长度、CRC32和消息
+func encodeSpillRecord(msg kafka.Message) []byte {
+	payload := make([]byte, 0, len(msg.Topic)+len(msg.Key)+len(msg.Value)+3*binary.MaxVarintLen32)
+	payload = appendSpillBytes(payload, []byte(msg.Topic))
+	payload = appendSpillBytes(payload, msg.Key)
+	payload = appendSpillBytes(payload, msg.Value)
+
+	record := make([]byte, spillHeaderSize, spillHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// appendSpillBytes 追加带长度前缀的字节
+func appendSpillBytes(dst, b []byte) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// decodeSpillPayload 解码记录中的消息
+func decodeSpillPayload(payload []byte) (kafka.Message, error) {
+	var fields [3][]byte
+	for i := range fields {
+		size, n := binary.Uvarint(payload)
+		if n <= 0 || size > uint64(len(payload)-n) {
+			return kafka.Message{}, ErrSpillCorrupt
+		}
+		payload = payload[n:]
+		if size > 0 {
+			fields[i] = payload[:size:size]
+		}
+		payload = payload[size:]
+	}
+	return kafka.Message{Topic: string(fields[0]), Key: fields[1], Value: fields[2]}, nil
+}
@@ -0,0 +1,17 @@
+package supplychain
+
+import "errors"
+
+var (
+	// ErrInvalidVersion 表示供应链版本无效
+	ErrInvalidVersion = errors.New("无效的供应链版本")
+
+	// ErrNoNodes 表示供应链没有节点
+	ErrNoNodes = errors.New("供应链没有节点")
+
+	// ErrInvalidNode 表示供应链节点无效
+	ErrInvalidNode = errors.New("无效的供应链节点")
+
+	// ErrFileNotFound 表示授权文件不存在
+	ErrFileNotFound = errors.New("授权文件不存在")
+)
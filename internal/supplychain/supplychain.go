@@ -0,0 +1,154 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: supplychain.go
+ * Project: simple-dsp
+ * Description: 竞价请求的供应链(schain)验证
+ *
+ * 主要功能:
+ * - 解析和校验竞价请求中的schain对象
+ * - 按媒体的ads.txt或app-ads.txt验证供应链的第一个节点是媒体授权的卖方
+ * - 按sellers.json验证供应链的每个节点都是广告系统登记的卖方
+ * - 后台抓取并缓存授权文件，定期刷新
+ *
+ * 实现细节:
+ * - 验证只读取本地缓存，不在竞价请求中抓取文件
+ * - 缓存中没有的文件加入抓取队列，抓取完成前验证结果为unknown
+ * - 抓取失败时保留上次的内容，文件不存在时验证结果为unknown，均在下次刷新时重试
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 只有complete为1且全部节点通过验证的供应链为authorized
+ * - 未启用的验证方式不参与判断
+ * - 每个实例独立抓取和缓存，刷新按文件依次进行
+ */
+
+package supplychain
+
+import "strings"
+
+// SupportedVersion 支持的供应链版本
+const SupportedVersion = "1.0"
+
+// 供应链验证结果
+const (
+	// StatusAbsent 请求未携带供应链
+	StatusAbsent = "absent"
+	// StatusInvalid 供应链格式无效
+	StatusInvalid = "invalid"
+	// StatusIncomplete 供应链未包含到媒体的全部节点
+	StatusIncomplete = "incomplete"
+	// StatusUnknown 缓存中还没有验证所需的授权文件
+	StatusUnknown = "unknown"
+	// StatusUnauthorized 有节点未被授权
+	StatusUnauthorized = "unauthorized"
+	// StatusAuthorized 全部节点已授权
+	StatusAuthorized = "authorized"
+)
+
+// SupplyChain 竞价请求中的schain对象
+type SupplyChain struct {
+	// Complete 为1时节点包含从媒体到交易平台的全部卖方
+	Complete int    `json:"complete"`
+	Nodes    []Node `json:"nodes"`
+	Ver      string `json:"ver"`
+}
+
+// Node 供应链中的一个卖方
+type Node struct {
+	// ASI 卖方所在广告系统的域名
+	ASI string `json:"asi"`
+	// SID 卖方在广告系统中的账号ID
+	SID string `json:"sid"`
+	// HP 为1时该节点参与支付
+	HP     int    `json:"hp"`
+	RID    string `json:"rid,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Domain string `json:"domain,omitempty"`
+}
+
+// Publisher 媒体信息，用于查找媒体的授权文件
+type Publisher struct {
+	// Domain 网站域名，应用为开发者网站域名
+	Domain string `json:"domain"`
+	// App 为true时按app-ads.txt验证
+	App bool `json:"app,omitempty"`
+}
+
+// Validate 校验供应链的格式
+func (c *SupplyChain) Validate() error {
+	if c.Ver != SupportedVersion {
+		return ErrInvalidVersion
+	}
+	if len(c.Nodes) == 0 {
+		return ErrNoNodes
+	}
+	for _, node := range c.Nodes {
+		if node.ASI == "" || node.SID == "" || node.HP != 1 {
+			return ErrInvalidNode
+		}
+	}
+	return nil
+}
+
+// Verify 验证请求的供应链，返回验证结果
+func (v *Validator) Verify(chain *SupplyChain, publisher *Publisher) string {
+	if chain == nil {
+		return StatusAbsent
+	}
+	if chain.Validate() != nil {
+		return StatusInvalid
+	}
+	if chain.Complete != 1 {
+		return StatusIncomplete
+	}
+
+	unknown := false
+	if v.config.VerifyAdsTxt {
+		// 第一个节点是直接从媒体购买流量的卖方，需在媒体的授权文件中
+		first := chain.Nodes[0]
+		switch {
+		case publisher == nil || publisher.Domain == "":
+			unknown = true
+		default:
+			kind := KindAdsTxt
+			if publisher.App {
+				kind = KindAppAdsTxt
+			}
+			switch v.lookup(kind, publisher.Domain, adsTxtKey(first.ASI, first.SID)) {
+			case lookupDenied:
+				return StatusUnauthorized
+			case lookupUnknown:
+				unknown = true
+			}
+		}
+	}
+	if v.config.VerifySellers {
+		for _, node := range chain.Nodes {
+			switch v.lookup(KindSellers, node.ASI, strings.TrimSpace(node.SID)) {
+			case lookupDenied:
+				return StatusUnauthorized
+			case lookupUnknown:
+				unknown = true
+			}
+		}
+	}
+	if unknown {
+		return StatusUnknown
+	}
+	return StatusAuthorized
+}
+
+// normalizeDomain 域名转为小写并去掉空白
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimSpace(domain))
+}
+
+// adsTxtKey ads.txt中一条授权记录的键
+func adsTxtKey(adSystem, accountID string) string {
+	return normalizeDomain(adSystem) + "|" + strings.TrimSpace(accountID)
+}
@@ -0,0 +1,298 @@
+package supplychain
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// 授权文件类型
+const (
+	KindAdsTxt    = "ads.txt"
+	KindAppAdsTxt = "app-ads.txt"
+	KindSellers   = "sellers.json"
+)
+
+const (
+	defaultRefreshInterval = 24 * time.Hour
+	defaultFetchTimeout    = 10 * time.Second
+	defaultMaxDomains      = 10000
+	// maxFileBytes 授权文件的大小上限，超过的部分不读取
+	maxFileBytes = 16 << 20
+	// queueSize 待抓取文件的队列长度，队列已满时在下次验证时重新加入
+	queueSize = 1024
+)
+
+// 抓取结果
+const (
+	fetchOK       = "ok"
+	fetchNotFound = "not_found"
+	fetchError    = "error"
+)
+
+// lookupResult 在授权文件中查找卖方的结果
+type lookupResult int
+
+const (
+	lookupUnknown lookupResult = iota
+	lookupDenied
+	lookupAllowed
+)
+
+// file 授权文件，ads.txt和app-ads.txt为媒体域名，sellers.json为广告系统域名
+type file struct {
+	kind   string
+	domain string
+}
+
+// Validator 供应链验证器，缓存授权文件并在后台抓取
+type Validator struct {
+	config  config.SupplyChainConfig
+	client  *http.Client
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+
+	mu sync.RWMutex
+	// files 缓存的授权文件内容，值为nil表示还没有可用的内容
+	files map[file]map[string]bool
+	queue chan file
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewValidator 创建供应链验证器
+func NewValidator(cfg config.SupplyChainConfig, logger *logger.Logger, metrics *metrics.Metrics) *Validator {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultRefreshInterval
+	}
+	if cfg.FetchTimeout <= 0 {
+		cfg.FetchTimeout = defaultFetchTimeout
+	}
+	if cfg.MaxDomains <= 0 {
+		cfg.MaxDomains = defaultMaxDomains
+	}
+	if cfg.Scheme == "" {
+		cfg.Scheme = "https"
+	}
+	return &Validator{
+		config:  cfg,
+		client:  &http.Client{Timeout: cfg.FetchTimeout},
+		logger:  logger,
+		metrics: metrics,
+		files:   make(map[file]map[string]bool),
+		queue:   make(chan file, queueSize),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// SetTransport 替换抓取授权文件的Transport，需在Start前调用
+func (v *Validator) SetTransport(rt http.RoundTripper) {
+	v.client.Transport = rt
+}
+
+// Start 启动后台抓取
+func (v *Validator) Start() {
+	go v.run()
+}
+
+// Stop 停止后台抓取
+func (v *Validator) Stop() {
+	close(v.stop)
+	<-v.done
+}
+
+// Fetch 抓取并缓存授权文件，kind为KindAdsTxt、KindAppAdsTxt或KindSellers
+func (v *Validator) Fetch(ctx context.Context, kind, domain string) error {
+	return v.fetch(ctx, file{kind: kind, domain: normalizeDomain(domain)})
+}
+
+// run 抓取新加入的文件，并按间隔刷新已缓存的文件
+func (v *Validator) run() {
+	defer close(v.done)
+
+	ticker := time.NewTicker(v.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.stop:
+			return
+		case f := <-v.queue:
+			v.fetchWithTimeout(f)
+		case <-ticker.C:
+			v.refresh()
+		}
+	}
+}
+
+// refresh 依次重新抓取已缓存的文件，停止时中断
+func (v *Validator) refresh() {
+	v.mu.RLock()
+	files := make([]file, 0, len(v.files))
+	for f := range v.files {
+		files = append(files, f)
+	}
+	v.mu.RUnlock()
+
+	for _, f := range files {
+		select {
+		case <-v.stop:
+			return
+		default:
+		}
+		v.fetchWithTimeout(f)
+	}
+}
+
+// fetchWithTimeout 按抓取超时抓取文件，失败时只记录日志
+func (v *Validator) fetchWithTimeout(f file) {
+	ctx, cancel := context.WithTimeout(context.Background(), v.config.FetchTimeout)
+	defer cancel()
+	if err := v.fetch(ctx, f); err != nil {
+		v.logger.Debug("抓取供应链授权文件失败", "kind", f.kind, "domain", f.domain, "error", err)
+	}
+}
+
+// fetch 抓取文件并更新缓存
+// 文件不存在时清空缓存的内容，其他错误保留上次抓取的内容
+func (v *Validator) fetch(ctx context.Context, f file) error {
+	entries, err := v.download(ctx, f)
+	result := fetchOK
+	switch {
+	case errors.Is(err, ErrFileNotFound):
+		result = fetchNotFound
+	case err != nil:
+		result = fetchError
+	}
+	v.metrics.Exchange.SupplyChainFetches.WithLabelValues(f.kind, result).Inc()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.files[f]; !ok || err == nil || result == fetchNotFound {
+		v.files[f] = entries
+	}
+	return err
+}
+
+// download 下载并解析文件
+func (v *Validator) download(ctx context.Context, f file) (map[string]bool, error) {
+	url := fmt.Sprintf("%s://%s/%s", v.config.Scheme, f.domain, f.kind)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrFileNotFound
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("抓取%s返回状态码%d", url, resp.StatusCode)
+	}
+
+	body := io.LimitReader(resp.Body, maxFileBytes)
+	if f.kind == KindSellers {
+		return parseSellers(body)
+	}
+	return parseAdsTxt(body)
+}
+
+// lookup 在缓存的授权文件中查找key，文件不在缓存中时加入抓取队列
+func (v *Validator) lookup(kind, domain, key string) lookupResult {
+	f := file{kind: kind, domain: normalizeDomain(domain)}
+	v.mu.RLock()
+	entries, ok := v.files[f]
+	v.mu.RUnlock()
+
+	switch {
+	case !ok:
+		v.track(f)
+		return lookupUnknown
+	case entries == nil:
+		return lookupUnknown
+	case entries[key]:
+		return lookupAllowed
+	default:
+		return lookupDenied
+	}
+}
+
+// track 将文件加入抓取队列，缓存已满或队列已满时不加入
+func (v *Validator) track(f file) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if _, ok := v.files[f]; ok || len(v.files) >= v.config.MaxDomains {
+		return
+	}
+	select {
+	case v.queue <- f:
+		v.files[f] = nil
+	default:
+	}
+}
+
+// parseAdsTxt 解析ads.txt或app-ads.txt，返回授权的广告系统和账号
+// 每行为"广告系统域名, 账号ID, DIRECT|RESELLER[, 认证ID]"，忽略注释、变量和格式错误的行
+func parseAdsTxt(r io.Reader) (map[string]bool, error) {
+	entries := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) < 3 {
+			continue
+		}
+		adSystem, accountID := normalizeDomain(fields[0]), strings.TrimSpace(fields[1])
+		relationship := strings.ToUpper(strings.TrimSpace(fields[2]))
+		if adSystem == "" || accountID == "" || (relationship != "DIRECT" && relationship != "RESELLER") {
+			continue
+		}
+		entries[adsTxtKey(adSystem, accountID)] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取ads.txt失败: %w", err)
+	}
+	return entries, nil
+}
+
+// sellersFile sellers.json的内容
+type sellersFile struct {
+	Sellers []struct {
+		SellerID string `json:"seller_id"`
+	} `json:"sellers"`
+}
+
+// parseSellers 解析sellers.json，返回登记的卖方账号
+func parseSellers(r io.Reader) (map[string]bool, error) {
+	var data sellersFile
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return nil, fmt.Errorf("解析sellers.json失败: %w", err)
+	}
+	entries := make(map[string]bool, len(data.Sellers))
+	for _, seller := range data.Sellers {
+		if id := strings.TrimSpace(seller.SellerID); id != "" {
+			entries[id] = true
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,234 @@
+package tracking
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"simple-dsp/internal/campaign"
+)
+
+// BreakerState 熔断器状态
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // 正常投递
+	BreakerOpen     BreakerState = "open"      // 熔断中，事件推迟投递
+	BreakerHalfOpen BreakerState = "half_open" // 冷却结束，放行一次探测请求
+)
+
+// gaugeValue 熔断器状态在指标中的取值
+func (s BreakerState) gaugeValue() float64 {
+	switch s {
+	case BreakerOpen:
+		return 1
+	case BreakerHalfOpen:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// BreakerKey 熔断器的维度，每个计划的每种跟踪类型单独熔断
+type BreakerKey struct {
+	CampaignID string
+	EventType  campaign.TrackingType
+}
+
+// BreakerStatus 熔断器状态快照
+type BreakerStatus struct {
+	CampaignID  string                `json:"campaign_id"`
+	EventType   campaign.TrackingType `json:"event_type"`
+	State       BreakerState          `json:"state"`
+	Failures    int                   `json:"failures"` // 连续失败次数
+	OpenedAt    *time.Time            `json:"opened_at,omitempty"`
+	RetryAt     *time.Time            `json:"retry_at,omitempty"` // 冷却结束时间
+	LastFailure string                `json:"last_failure,omitempty"`
+}
+
+// breaker 单个熔断器
+type breaker struct {
+	state       BreakerState
+	failures    int
+	openedAt    time.Time
+	lastFailure string
+	probing     bool // 半开状态下是否已有探测请求在途
+}
+
+// Breakers 按计划和跟踪类型划分的熔断器集合
+// 连续失败达到阈值后熔断，冷却期内的事件推迟到冷却结束；冷却结束后放行一次探测，
+// 探测成功则恢复，失败则重新熔断。状态只保存在本进程内。
+type Breakers struct {
+	threshold int
+	cooldown  time.Duration
+	breakers  map[BreakerKey]*breaker
+	mu        sync.Mutex
+	// onChange 状态变化回调，用于更新指标
+	onChange func(key BreakerKey, from, to BreakerState)
+}
+
+// NewBreakers 创建熔断器集合，threshold小于等于0时不熔断
+func NewBreakers(threshold int, cooldown time.Duration) *Breakers {
+	return &Breakers{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[BreakerKey]*breaker),
+	}
+}
+
+// Allow 判断是否允许投递，不允许时返回可以再次尝试的时间
+func (b *Breakers) Allow(key BreakerKey) (bool, time.Time) {
+	if b.threshold <= 0 {
+		return true, time.Time{}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[key]
+	if !ok {
+		return true, time.Time{}
+	}
+
+	switch br.state {
+	case BreakerOpen:
+		retryAt := br.openedAt.Add(b.cooldown)
+		if time.Now().Before(retryAt) {
+			return false, retryAt
+		}
+		b.transition(key, br, BreakerHalfOpen)
+		br.probing = true
+		return true, time.Time{}
+	case BreakerHalfOpen:
+		if br.probing {
+			// 探测结果返回前其余事件稍后再试
+			return false, time.Now().Add(b.cooldown)
+		}
+		br.probing = true
+		return true, time.Time{}
+	default:
+		return true, time.Time{}
+	}
+}
+
+// Success 记录一次成功投递
+func (b *Breakers) Success(key BreakerKey) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[key]
+	if !ok {
+		return
+	}
+	// 成功后不再需要保留该熔断器
+	delete(b.breakers, key)
+	if br.state != BreakerClosed {
+		b.notify(key, br.state, BreakerClosed)
+	}
+}
+
+// Failure 记录一次失败投递，返回本次失败是否触发熔断
+func (b *Breakers) Failure(key BreakerKey, reason string) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[key]
+	if !ok {
+		br = &breaker{state: BreakerClosed}
+		b.breakers[key] = br
+	}
+	br.failures++
+	br.lastFailure = reason
+	br.probing = false
+
+	switch {
+	case br.state == BreakerHalfOpen, br.state == BreakerClosed && br.failures >= b.threshold:
+		br.openedAt = time.Now()
+		b.transition(key, br, BreakerOpen)
+		return true
+	case br.state == BreakerOpen:
+		// 熔断前已取出的事件失败，延长冷却期
+		br.openedAt = time.Now()
+	}
+	return false
+}
+
+// Release 释放半开状态下的探测名额，用于探测请求未得出结果时
+func (b *Breakers) Release(key BreakerKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if br, ok := b.breakers[key]; ok {
+		br.probing = false
+	}
+}
+
+// Reset 手动恢复熔断器，熔断器不存在时返回false
+func (b *Breakers) Reset(key BreakerKey) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	br, ok := b.breakers[key]
+	if !ok {
+		return false
+	}
+	delete(b.breakers, key)
+	if br.state != BreakerClosed {
+		b.notify(key, br.state, BreakerClosed)
+	}
+	return true
+}
+
+// List 列出有失败记录的熔断器
+func (b *Breakers) List() []BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(b.breakers))
+	for key, br := range b.breakers {
+		status := BreakerStatus{
+			CampaignID:  key.CampaignID,
+			EventType:   key.EventType,
+			State:       br.state,
+			Failures:    br.failures,
+			LastFailure: br.lastFailure,
+		}
+		if br.state != BreakerClosed {
+			openedAt := br.openedAt
+			retryAt := openedAt.Add(b.cooldown)
+			status.OpenedAt = &openedAt
+			status.RetryAt = &retryAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].CampaignID != statuses[j].CampaignID {
+			return statuses[i].CampaignID < statuses[j].CampaignID
+		}
+		return statuses[i].EventType < statuses[j].EventType
+	})
+	return statuses
+}
+
+// transition 切换状态，调用方需持有锁
+func (b *Breakers) transition(key BreakerKey, br *breaker, to BreakerState) {
+	from := br.state
+	br.state = to
+	b.notify(key, from, to)
+}
+
+// notify 通知状态变化，调用方需持有锁
+func (b *Breakers) notify(key BreakerKey, from, to BreakerState) {
+	if b.onChange != nil && from != to {
+		b.onChange(key, from, to)
+	}
+}
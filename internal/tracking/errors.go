@@ -0,0 +1,11 @@
+package tracking
+
+import "errors"
+
+var (
+	// ErrBreakerNotFound 表示熔断器不存在，即该计划的跟踪类型没有失败记录
+	ErrBreakerNotFound = errors.New("熔断器不存在")
+
+	// ErrReceiptsDisabled 表示未启用跟踪投递回执
+	ErrReceiptsDisabled = errors.New("未启用跟踪投递回执")
+)
@@ -0,0 +1,133 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// queueKey 待投递事件的有序集合，分值为下次投递时间(毫秒)
+	queueKey = "tracking:queue"
+	// jobsKey 事件内容哈希
+	jobsKey = "tracking:jobs"
+)
+
+// Job 待投递的跟踪事件
+type Job struct {
+	ID         string         `json:"id"`
+	Event      *TrackingEvent `json:"event"`
+	Attempt    int            `json:"attempt"` // 已尝试次数
+	CreateTime time.Time      `json:"create_time"`
+	LastError  string         `json:"last_error,omitempty"`
+}
+
+// Queue 跟踪事件持久化队列
+// 取出的事件在租约期内不会被再次取出，确认前进程退出时租约到期后重新投递
+type Queue interface {
+	// Enqueue 加入队列，立即可投递
+	Enqueue(ctx context.Context, job *Job) error
+	// Claim 取出最多n个已到投递时间的事件，并在lease时长内锁定
+	Claim(ctx context.Context, n int, lease time.Duration) ([]*Job, error)
+	// Retry 更新事件并在at时间重新投递
+	Retry(ctx context.Context, job *Job, at time.Time) error
+	// Ack 确认事件已处理完毕，从队列中删除
+	Ack(ctx context.Context, id string) error
+	// Depth 返回队列中的事件数
+	Depth(ctx context.Context) (int64, error)
+}
+
+// claimScript 原子地取出到期事件并将分值推迟到租约结束
+var claimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[3], id)
+end
+return ids
+`)
+
+// RedisQueue 基于Redis有序集合的队列
+type RedisQueue struct {
+	redis *redis.Client
+}
+
+// NewRedisQueue 创建基于Redis的队列
+func NewRedisQueue(redisClient *redis.Client) *RedisQueue {
+	return &RedisQueue{redis: redisClient}
+}
+
+// Enqueue 加入队列
+func (q *RedisQueue) Enqueue(ctx context.Context, job *Job) error {
+	return q.save(ctx, job, time.Now())
+}
+
+// Claim 取出到期事件
+func (q *RedisQueue) Claim(ctx context.Context, n int, lease time.Duration) ([]*Job, error) {
+	now := time.Now()
+	ids, err := claimScript.Run(ctx, q.redis, []string{queueKey},
+		now.UnixMilli(), n, now.Add(lease).UnixMilli()).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("取出跟踪事件失败: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	values, err := q.redis.HMGet(ctx, jobsKey, ids...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取跟踪事件失败: %w", err)
+	}
+
+	jobs := make([]*Job, 0, len(ids))
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			// 内容已丢失的事件无法投递，直接删除
+			q.redis.ZRem(ctx, queueKey, ids[i])
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil || job.Event == nil {
+			q.Ack(ctx, ids[i])
+			continue
+		}
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// Retry 更新事件并在at时间重新投递
+func (q *RedisQueue) Retry(ctx context.Context, job *Job, at time.Time) error {
+	return q.save(ctx, job, at)
+}
+
+// Ack 从队列中删除事件
+func (q *RedisQueue) Ack(ctx context.Context, id string) error {
+	pipe := q.redis.TxPipeline()
+	pipe.ZRem(ctx, queueKey, id)
+	pipe.HDel(ctx, jobsKey, id)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Depth 返回队列中的事件数
+func (q *RedisQueue) Depth(ctx context.Context) (int64, error) {
+	return q.redis.ZCard(ctx, queueKey).Result()
+}
+
+// save 保存事件内容并设置投递时间
+func (q *RedisQueue) save(ctx context.Context, job *Job, at time.Time) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	pipe := q.redis.TxPipeline()
+	pipe.HSet(ctx, jobsKey, job.ID, data)
+	pipe.ZAdd(ctx, queueKey, &redis.Z{Score: float64(at.UnixMilli()), Member: job.ID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,235 @@
+package tracking
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// 投递回执的结果
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRetrying  = "retrying"
+	ReceiptDeferred  = "deferred"
+	ReceiptDropped   = "dropped"
+)
+
+const (
+	defaultReceiptBuffer    = 10000
+	defaultReceiptBatch     = 500
+	defaultReceiptFlush     = 2 * time.Second
+	defaultReceiptRetention = 7
+
+	// receiptPurgeInterval 清理过期回执的间隔
+	receiptPurgeInterval = time.Hour
+	// maxReceiptURL 回执中保存的跟踪地址的最大长度
+	maxReceiptURL = 2048
+	// maxReceiptError 回执中保存的错误信息的最大长度
+	maxReceiptError = 512
+
+	defaultReceiptLimit = 100
+	maxReceiptLimit     = 1000
+)
+
+// ReceiptQuery 投递回执查询条件，时间范围为[Start, End)
+type ReceiptQuery struct {
+	CampaignID string
+	// EventType 为空时不限制跟踪类型
+	EventType string
+	// ClickID 为空时不限制点击ID
+	ClickID string
+	Start   time.Time
+	End     time.Time
+	// Limit 返回的最大条数，为0时返回100条，最多1000条
+	Limit int
+}
+
+// ReceiptStore 投递回执存储
+type ReceiptStore interface {
+	// Save 批量写入回执
+	Save(ctx context.Context, receipts []*models.TrackingReceipt) error
+	// List 按时间倒序返回符合条件的回执
+	List(ctx context.Context, q ReceiptQuery) ([]*models.TrackingReceipt, error)
+	// Purge 删除早于before的回执，返回删除的行数
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
+
+// GormReceiptStore 基于数据库的投递回执存储
+type GormReceiptStore struct {
+	db *gorm.DB
+}
+
+// NewGormReceiptStore 创建基于数据库的投递回执存储
+func NewGormReceiptStore(db *gorm.DB) *GormReceiptStore {
+	return &GormReceiptStore{db: db}
+}
+
+// Save 批量写入回执
+func (s *GormReceiptStore) Save(ctx context.Context, receipts []*models.TrackingReceipt) error {
+	if len(receipts) == 0 {
+		return nil
+	}
+	return s.db.WithContext(database.WithQueryName(ctx, "tracking_receipts.save")).Create(&receipts).Error
+}
+
+// List 按时间倒序返回回执
+func (s *GormReceiptStore) List(ctx context.Context, q ReceiptQuery) ([]*models.TrackingReceipt, error) {
+	query := s.db.WithContext(database.ReadOnly(database.WithQueryName(ctx, "tracking_receipts.list"))).
+		Where("campaign_id = ? AND create_time >= ? AND create_time < ?", q.CampaignID, q.Start, q.End)
+	if q.EventType != "" {
+		query = query.Where("event_type = ?", q.EventType)
+	}
+	if q.ClickID != "" {
+		query = query.Where("click_id = ?", q.ClickID)
+	}
+
+	var receipts []*models.TrackingReceipt
+	err := query.Order("create_time DESC, id DESC").Limit(q.Limit).Find(&receipts).Error
+	return receipts, err
+}
+
+// Purge 删除早于before的回执
+func (s *GormReceiptStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(database.WithQueryName(ctx, "tracking_receipts.purge")).
+		Where("create_time < ?", before).
+		Delete(&models.TrackingReceipt{})
+	return result.RowsAffected, result.Error
+}
+
+// SetReceiptStore 启用投递回执，需在Start前调用
+func (s *Service) SetReceiptStore(store ReceiptStore) {
+	cfg := s.config.Receipts
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultReceiptBuffer
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultReceiptBatch
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultReceiptFlush
+	}
+	if cfg.RetentionDays <= 0 {
+		cfg.RetentionDays = defaultReceiptRetention
+	}
+	s.config.Receipts = cfg
+	s.receiptStore = store
+	s.receipts = make(chan *models.TrackingReceipt, cfg.BufferSize)
+}
+
+// Receipts 查询投递回执，未启用时返回ErrReceiptsDisabled
+func (s *Service) Receipts(ctx context.Context, q ReceiptQuery) ([]*models.TrackingReceipt, error) {
+	if s.receiptStore == nil {
+		return nil, ErrReceiptsDisabled
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultReceiptLimit
+	}
+	if q.Limit > maxReceiptLimit {
+		q.Limit = maxReceiptLimit
+	}
+	return s.receiptStore.List(ctx, q)
+}
+
+// newReceipt 创建事件的回执，结果和投递信息由调用方填写
+func newReceipt(job *Job) *models.TrackingReceipt {
+	return &models.TrackingReceipt{
+		JobID:      job.ID,
+		CampaignID: job.Event.CampaignID,
+		EventType:  string(job.Event.EventType),
+		ClickID:    job.Event.ClickID,
+		Attempt:    job.Attempt,
+		CreateTime: time.Now(),
+	}
+}
+
+// record 记录回执，等待写入的回执已满时丢弃，不阻塞投递
+func (s *Service) record(receipt *models.TrackingReceipt) {
+	if s.receipts == nil {
+		return
+	}
+	receipt.URL = truncate(receipt.URL, maxReceiptURL)
+	receipt.Error = truncate(receipt.Error, maxReceiptError)
+	select {
+	case s.receipts <- receipt:
+	default:
+		s.metrics.Tracking.ReceiptsDropped.WithLabelValues("buffer_full").Inc()
+	}
+}
+
+// receiptLoop 攒够一批或等待超过FlushInterval后写入回执
+// 在worker退出后才停止，停止时写入剩余的回执
+func (s *Service) receiptLoop(ctx context.Context) {
+	defer s.receiptWG.Done()
+
+	ticker := time.NewTicker(s.config.Receipts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.TrackingReceipt, 0, s.config.Receipts.BatchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for len(s.receipts) > 0 {
+				batch = append(batch, <-s.receipts)
+			}
+			s.flushReceipts(batch)
+			return
+		case r := <-s.receipts:
+			batch = append(batch, r)
+			if len(batch) < s.config.Receipts.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		s.flushReceipts(batch)
+		batch = batch[:0]
+	}
+}
+
+// flushReceipts 写入一批回执，失败时丢弃，回执不影响投递
+func (s *Service) flushReceipts(batch []*models.TrackingReceipt) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.receiptStore.Save(ctx, batch); err != nil {
+		s.metrics.Tracking.ReceiptsDropped.WithLabelValues("write_error").Add(float64(len(batch)))
+		s.logger.Error("写入跟踪投递回执失败", "count", len(batch), "error", err)
+	}
+}
+
+// purgeReceipts 启动时和每隔receiptPurgeInterval删除超过保留天数的回执
+func (s *Service) purgeReceipts(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(receiptPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().AddDate(0, 0, -s.config.Receipts.RetentionDays)
+		if n, err := s.receiptStore.Purge(ctx, before); err != nil && ctx.Err() == nil {
+			s.logger.Error("清理过期跟踪投递回执失败", "error", err)
+		} else if n > 0 {
+			s.logger.Info("清理过期跟踪投递回执", "before", before, "rows", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// truncate 截断到最多n个字节，不截断多字节字符
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -3,22 +3,68 @@ package tracking
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 	"time"
 
 	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/macro"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/httpclient"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
+)
+
+const (
+	defaultWorkers       = 8
+	defaultBatchSize     = 100
+	defaultPollInterval  = 200 * time.Millisecond
+	defaultLeaseTimeout  = time.Minute
+	defaultMaxAge        = 24 * time.Hour
+	defaultMaxBackoff    = 10 * time.Minute
+	defaultRetryInterval = time.Second
+	defaultBreakerThresh = 5
+	defaultBreakerCool   = 30 * time.Second
+
+	// backoffJitter 重试间隔的随机抖动比例，避免同一时刻失败的大量事件同时重试
+	backoffJitter = 0.2
+)
+
+// 放弃投递的原因
+const (
+	dropReasonMaxAge     = "max_age"
+	dropReasonMaxRetries = "max_retries"
+	dropReasonDisabled   = "disabled"
+	dropReasonBreaker    = "circuit_open"
 )
 
 // Service 跟踪服务
+// Track只将事件写入持久化队列，由后台worker池投递，失败按指数退避重试
 type Service struct {
-	httpClient *http.Client
+	config     config.TrackingConfig
+	queue      Queue
 	logger     *logger.Logger
 	metrics    *metrics.Metrics
 	configMgr  *campaign.ConfigManager
+	breakers   *Breakers
+	macros     *macro.Expander
+	transport  http.RoundTripper
+	jobs       chan *Job
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+
+	// receiptStore 投递回执存储，为nil时不记录回执
+	receiptStore  ReceiptStore
+	receipts      chan *models.TrackingReceipt
+	receiptCancel context.CancelFunc
+	receiptWG     sync.WaitGroup
 }
 
 // TrackingEvent 跟踪事件
@@ -27,28 +73,103 @@ type TrackingEvent struct {
 	EventType  campaign.TrackingType `json:"event_type"`
 	Timestamp  time.Time             `json:"timestamp"`
 	DeviceID   string                `json:"device_id"`
+	ClickID    string                `json:"click_id"`
 	IP         string                `json:"ip"`
 	UserAgent  string                `json:"user_agent"`
 	ExtraData  map[string]string     `json:"extra_data"`
 }
 
 // NewService 创建新的跟踪服务
-func NewService(configMgr *campaign.ConfigManager, logger *logger.Logger, metrics *metrics.Metrics) *Service {
-	return &Service{
-		httpClient: &http.Client{},
-		logger:     logger,
-		metrics:    metrics,
-		configMgr:  configMgr,
+func NewService(cfg config.TrackingConfig, queue Queue, configMgr *campaign.ConfigManager, logger *logger.Logger, metrics *metrics.Metrics) *Service {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
 	}
+	if cfg.LeaseTimeout <= 0 {
+		cfg.LeaseTimeout = defaultLeaseTimeout
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultMaxAge
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.BreakerThreshold == 0 {
+		cfg.BreakerThreshold = defaultBreakerThresh
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = defaultBreakerCool
+	}
+
+	s := &Service{
+		config:    cfg,
+		queue:     queue,
+		logger:    logger,
+		metrics:   metrics,
+		configMgr: configMgr,
+		breakers:  NewBreakers(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		transport: httpclient.NewTransport(config.HTTPClientConfig{}),
+		jobs:      make(chan *Job, cfg.Workers),
+	}
+	s.breakers.onChange = s.onBreakerChange
+
+	expander, err := macro.NewExpander(cfg.MacroAllowlist)
+	if err != nil {
+		logger.Error("跟踪宏白名单无效，使用默认白名单", "error", err)
+		expander, _ = macro.NewExpander(nil)
+	}
+	s.macros = expander
+	return s
 }
 
-// Track 处理跟踪事件
-func (s *Service) Track(ctx context.Context, event *TrackingEvent) error {
-	startTime := time.Now()
-	defer func() {
-		s.metrics.Tracking.Duration.WithLabelValues(string(event.EventType)).Observe(time.Since(startTime).Seconds())
-	}()
+// SetTransport 替换投递请求的Transport，默认使用带连接池的Transport，需在Start前调用
+func (s *Service) SetTransport(rt http.RoundTripper) {
+	s.transport = rt
+}
+
+// Start 启动后台投递
+func (s *Service) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancelFunc = cancel
+
+	s.wg.Add(1)
+	go s.pollLoop(ctx)
+	for i := 0; i < s.config.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker(ctx)
+	}
+
+	if s.receiptStore != nil {
+		s.wg.Add(1)
+		go s.purgeReceipts(ctx)
+
+		receiptCtx, receiptCancel := context.WithCancel(context.Background())
+		s.receiptCancel = receiptCancel
+		s.receiptWG.Add(1)
+		go s.receiptLoop(receiptCtx)
+	}
+}
+
+// Stop 停止后台投递，未确认的事件在租约到期后由下次启动的服务投递
+func (s *Service) Stop() {
+	if s.cancelFunc == nil {
+		return
+	}
+	s.cancelFunc()
+	s.wg.Wait()
+	if s.receiptCancel != nil {
+		s.receiptCancel()
+		s.receiptWG.Wait()
+	}
+}
 
+// Track 处理跟踪事件，事件写入队列后立即返回
+func (s *Service) Track(ctx context.Context, event *TrackingEvent) error {
 	// 获取计划配置
 	config, exists := s.configMgr.GetConfig(event.CampaignID)
 	if !exists {
@@ -61,51 +182,270 @@ func (s *Service) Track(ctx context.Context, event *TrackingEvent) error {
 		return nil // 跟踪未启用，直接返回
 	}
 
-	// 创建HTTP请求
-	req, err := s.createTrackingRequest(ctx, trackingConfig, event)
-	if err != nil {
-		return err
+	job := &Job{
+		ID:         newJobID(),
+		Event:      event,
+		CreateTime: time.Now(),
 	}
-
-	// 设置超时
-	client := &http.Client{
-		Timeout: trackingConfig.Timeout,
+	if err := s.queue.Enqueue(ctx, job); err != nil {
+		return fmt.Errorf("跟踪事件入队失败: %w", err)
 	}
+	return nil
+}
+
+// pollLoop 定时从队列取出到期事件交给worker，worker繁忙时阻塞以限制并发
+func (s *Service) pollLoop(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
-	// 发送请求（带重试）
-	var lastErr error
-	for i := 0; i <= trackingConfig.RetryCount; i++ {
-		if i > 0 {
-			time.Sleep(trackingConfig.RetryInterval)
+		if depth, err := s.queue.Depth(ctx); err == nil {
+			s.metrics.Tracking.QueueDepth.Set(float64(depth))
 		}
 
-		resp, err := client.Do(req)
+		jobs, err := s.queue.Claim(ctx, s.config.BatchSize, s.config.LeaseTimeout)
 		if err != nil {
-			lastErr = err
-			s.logger.Error("跟踪请求失败",
-				"campaign_id", event.CampaignID,
-				"event_type", event.EventType,
-				"attempt", i+1,
-				"error", err)
+			s.logger.Error("读取跟踪队列失败", "error", err)
 			continue
 		}
-		defer resp.Body.Close()
+		for _, job := range jobs {
+			select {
+			case s.jobs <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// worker 投递跟踪事件
+func (s *Service) worker(ctx context.Context) {
+	defer s.wg.Done()
 
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-			s.metrics.Tracking.Success.WithLabelValues(string(event.EventType)).Inc()
-			return nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.jobs:
+			s.process(ctx, job)
 		}
+	}
+}
 
-		lastErr = fmt.Errorf("tracking request failed with status code: %d", resp.StatusCode)
-		s.logger.Error("跟踪请求返回错误状态码",
+// process 投递一次并根据结果确认、重试或放弃
+func (s *Service) process(ctx context.Context, job *Job) {
+	event := job.Event
+	eventType := string(event.EventType)
+
+	if time.Since(job.CreateTime) > s.config.MaxAge {
+		s.metrics.Tracking.Failure.WithLabelValues(eventType).Inc()
+		s.drop(ctx, job, dropReasonMaxAge, nil)
+		return
+	}
+
+	trackingConfig := s.trackingConfig(event)
+	if trackingConfig == nil {
+		s.drop(ctx, job, dropReasonDisabled, nil)
+		return
+	}
+
+	key := BreakerKey{CampaignID: event.CampaignID, EventType: event.EventType}
+	if allowed, retryAt := s.breakers.Allow(key); !allowed {
+		s.postpone(ctx, job, retryAt)
+		return
+	}
+
+	job.Attempt++
+	receipt := newReceipt(job)
+	err := s.deliver(ctx, trackingConfig, event, receipt)
+	if err == nil {
+		s.breakers.Success(key)
+		s.metrics.Tracking.Success.WithLabelValues(eventType).Inc()
+		receipt.Result = ReceiptDelivered
+		s.record(receipt)
+		s.ack(ctx, job)
+		return
+	}
+	if ctx.Err() != nil {
+		// 服务停止导致的失败不计入重试，租约到期后重新投递
+		s.breakers.Release(key)
+		return
+	}
+
+	job.LastError = err.Error()
+	receipt.Error = job.LastError
+	if s.breakers.Failure(key, job.LastError) {
+		s.logger.Warn("跟踪地址连续失败，熔断",
 			"campaign_id", event.CampaignID,
 			"event_type", event.EventType,
-			"attempt", i+1,
-			"status_code", resp.StatusCode)
+			"cooldown", s.config.BreakerCooldown)
+	}
+	s.logger.Error("跟踪请求失败",
+		"campaign_id", event.CampaignID,
+		"event_type", event.EventType,
+		"attempt", job.Attempt,
+		"error", err)
+
+	if job.Attempt > trackingConfig.RetryCount {
+		s.metrics.Tracking.Failure.WithLabelValues(eventType).Inc()
+		s.drop(ctx, job, dropReasonMaxRetries, receipt)
+		return
+	}
+
+	next := time.Now().Add(s.backoff(trackingConfig.RetryInterval, job.Attempt))
+	if next.Sub(job.CreateTime) > s.config.MaxAge {
+		s.metrics.Tracking.Failure.WithLabelValues(eventType).Inc()
+		s.drop(ctx, job, dropReasonMaxAge, receipt)
+		return
+	}
+
+	s.metrics.Tracking.Retries.WithLabelValues(eventType).Inc()
+	receipt.Result = ReceiptRetrying
+	s.record(receipt)
+	if err := s.queue.Retry(ctx, job, next); err != nil {
+		s.logger.Error("跟踪事件重新入队失败", "job_id", job.ID, "error", err)
+	}
+}
+
+// postpone 熔断期间推迟投递，不计入重试次数；推迟后超过最大保留时长的事件直接放弃
+func (s *Service) postpone(ctx context.Context, job *Job, retryAt time.Time) {
+	eventType := string(job.Event.EventType)
+	if retryAt.Sub(job.CreateTime) > s.config.MaxAge {
+		s.metrics.Tracking.Failure.WithLabelValues(eventType).Inc()
+		s.drop(ctx, job, dropReasonBreaker, nil)
+		return
+	}
+
+	s.metrics.Tracking.BreakerDeferred.WithLabelValues(eventType).Inc()
+	receipt := newReceipt(job)
+	receipt.Result = ReceiptDeferred
+	receipt.Error = job.LastError
+	s.record(receipt)
+	if err := s.queue.Retry(ctx, job, retryAt); err != nil {
+		s.logger.Error("跟踪事件重新入队失败", "job_id", job.ID, "error", err)
 	}
+}
+
+// Breakers 列出有失败记录的熔断器
+func (s *Service) Breakers() []BreakerStatus {
+	return s.breakers.List()
+}
 
-	s.metrics.Tracking.Failure.WithLabelValues(string(event.EventType)).Inc()
-	return lastErr
+// ResetBreaker 手动恢复熔断器，被推迟的事件在下次取出时投递
+func (s *Service) ResetBreaker(campaignID string, eventType campaign.TrackingType) error {
+	if !s.breakers.Reset(BreakerKey{CampaignID: campaignID, EventType: eventType}) {
+		return ErrBreakerNotFound
+	}
+	return nil
+}
+
+// onBreakerChange 熔断器状态变化时更新指标，恢复后删除对应的时间序列
+func (s *Service) onBreakerChange(key BreakerKey, from, to BreakerState) {
+	labels := []string{key.CampaignID, string(key.EventType)}
+	if to == BreakerClosed {
+		s.metrics.Tracking.BreakerState.DeleteLabelValues(labels...)
+		return
+	}
+	s.metrics.Tracking.BreakerState.WithLabelValues(labels...).Set(to.gaugeValue())
+	if to == BreakerOpen {
+		s.metrics.Tracking.BreakerTrips.WithLabelValues(string(key.EventType)).Inc()
+	}
+}
+
+// deliver 发送一次跟踪请求，请求地址、状态码和耗时记入receipt
+func (s *Service) deliver(ctx context.Context, trackingConfig *campaign.TrackingConfig, event *TrackingEvent, receipt *models.TrackingReceipt) error {
+	startTime := time.Now()
+	defer func() {
+		elapsed := time.Since(startTime)
+		receipt.DurationMs = elapsed.Milliseconds()
+		s.metrics.Tracking.Duration.WithLabelValues(string(event.EventType)).Observe(elapsed.Seconds())
+	}()
+
+	// 创建HTTP请求
+	req, err := s.createTrackingRequest(ctx, trackingConfig, event)
+	if err != nil {
+		return err
+	}
+	receipt.Method = req.Method
+	receipt.URL = req.URL.String()
+
+	// 设置超时
+	client := &http.Client{
+		Timeout:   trackingConfig.Timeout,
+		Transport: s.transport,
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	receipt.StatusCode = resp.StatusCode
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("tracking request failed with status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// trackingConfig 获取事件当前的跟踪配置，计划删除或跟踪停用时返回nil
+func (s *Service) trackingConfig(event *TrackingEvent) *campaign.TrackingConfig {
+	config, exists := s.configMgr.GetConfig(event.CampaignID)
+	if !exists {
+		return nil
+	}
+	trackingConfig, exists := config.TrackingConfigs[event.EventType]
+	if !exists || !trackingConfig.Enabled {
+		return nil
+	}
+	return trackingConfig
+}
+
+// backoff 计算第attempt次失败后的重试间隔，从计划配置的重试间隔开始逐次翻倍，不超过MaxBackoff并加随机抖动
+func (s *Service) backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultRetryInterval
+	}
+	return retry.Policy{
+		InitialBackoff: base,
+		MaxBackoff:     s.config.MaxBackoff,
+		Jitter:         backoffJitter,
+	}.Backoff(attempt)
+}
+
+// drop 放弃投递，receipt为最后一次投递的回执，未投递时为nil
+func (s *Service) drop(ctx context.Context, job *Job, reason string, receipt *models.TrackingReceipt) {
+	s.metrics.Tracking.Dropped.WithLabelValues(string(job.Event.EventType), reason).Inc()
+	s.logger.Warn("放弃投递跟踪事件",
+		"job_id", job.ID,
+		"campaign_id", job.Event.CampaignID,
+		"event_type", job.Event.EventType,
+		"reason", reason,
+		"last_error", job.LastError)
+	if receipt == nil {
+		receipt = newReceipt(job)
+		receipt.Error = job.LastError
+	}
+	receipt.Result = ReceiptDropped
+	receipt.Reason = reason
+	s.record(receipt)
+	s.ack(ctx, job)
+}
+
+// ack 确认事件
+func (s *Service) ack(ctx context.Context, job *Job) {
+	if err := s.queue.Ack(ctx, job.ID); err != nil {
+		s.logger.Error("确认跟踪事件失败", "job_id", job.ID, "error", err)
+	}
 }
 
 // createTrackingRequest 创建跟踪请求
@@ -137,7 +477,16 @@ func (s *Service) createTrackingRequest(ctx context.Context, config *campaign.Tr
 		method = http.MethodPost
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, config.URL, bytes.NewBuffer(body))
+	// 替换URL中的宏
+	trackingURL := s.macros.Expand(config.URL, &macro.Values{
+		ClickID:    event.ClickID,
+		DeviceID:   event.DeviceID,
+		CampaignID: event.CampaignID,
+		IP:         event.IP,
+		Time:       event.Timestamp,
+	})
+
+	req, err := http.NewRequestWithContext(ctx, method, trackingURL, bytes.NewBuffer(body))
 	if err != nil {
 		return nil, err
 	}
@@ -150,3 +499,10 @@ func (s *Service) createTrackingRequest(ctx context.Context, config *campaign.Tr
 
 	return req, nil
 }
+
+// newJobID 生成事件ID
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b))
+}
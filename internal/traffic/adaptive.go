@@ -0,0 +1,214 @@
+package traffic
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// RateLimitConfigKey 运行时固定全局限流的配置在配置中心的键
+const RateLimitConfigKey = "traffic.rate_limit"
+
+// 自适应限流评估的下游
+const (
+	// DependencyRedis Redis
+	DependencyRedis = "redis"
+	// DependencyRTA RTA服务
+	DependencyRTA = "rta"
+)
+
+// 自适应限流的默认参数
+const (
+	defaultAdaptiveInterval   = time.Second
+	defaultDecreaseFactor     = 0.7
+	defaultIncreaseStep       = 0.05
+	defaultAdaptiveMinSamples = 20
+)
+
+// RateLimitOverride 配置中心中固定全局限流的配置
+type RateLimitOverride struct {
+	// QPS 固定的QPS，为0时恢复自动调整
+	QPS float64 `json:"qps"`
+}
+
+// dependencyStats 一个评估间隔内下游的调用统计
+type dependencyStats struct {
+	threshold config.DependencyThresholdConfig
+	calls     atomic.Int64
+	errors    atomic.Int64
+	latency   atomic.Int64 // 累计耗时，纳秒
+}
+
+// AdaptiveLimiter 全局流量限流，Redis或RTA的平均延迟或错误率超过阈值时按比例降低，
+// 恢复后每个间隔按固定步长回升到配置的QPS
+type AdaptiveLimiter struct {
+	cfg     config.AdaptiveLimitConfig
+	max     float64
+	burst   int
+	limiter *rate.Limiter
+	deps    map[string]*dependencyStats
+	logger  *logger.Logger
+	metrics *metrics.Metrics
+
+	mu       sync.Mutex
+	limit    float64 // 自动调整的QPS
+	override float64 // 配置中心固定的QPS，为0时使用自动调整的QPS
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewAdaptiveLimiter 创建自适应限流，qps和burst为上限
+func NewAdaptiveLimiter(qps float64, burst int, cfg config.AdaptiveLimitConfig, log *logger.Logger, m *metrics.Metrics) *AdaptiveLimiter {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultAdaptiveInterval
+	}
+	if cfg.DecreaseFactor <= 0 {
+		cfg.DecreaseFactor = defaultDecreaseFactor
+	}
+	if cfg.IncreaseStep <= 0 {
+		cfg.IncreaseStep = defaultIncreaseStep
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = defaultAdaptiveMinSamples
+	}
+	l := &AdaptiveLimiter{
+		cfg:     cfg,
+		max:     qps,
+		burst:   burst,
+		limiter: rate.NewLimiter(rate.Limit(qps), burst),
+		deps: map[string]*dependencyStats{
+			DependencyRedis: {threshold: cfg.Redis},
+			DependencyRTA:   {threshold: cfg.RTA},
+		},
+		logger:  log,
+		metrics: m,
+		limit:   qps,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	l.metrics.Exchange.EffectiveQPS.Set(qps)
+	for name := range l.deps {
+		l.metrics.Exchange.DependencyHealthy.WithLabelValues(name).Set(1)
+	}
+	return l
+}
+
+// Start 启动定期评估
+func (l *AdaptiveLimiter) Start() {
+	go l.loop()
+}
+
+// Stop 停止评估
+func (l *AdaptiveLimiter) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+// loop 每个间隔评估一次下游健康状况
+func (l *AdaptiveLimiter) loop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.adjust()
+		}
+	}
+}
+
+// Allow 是否放行一个请求
+func (l *AdaptiveLimiter) Allow() bool {
+	return l.limiter.Allow()
+}
+
+// Observe 记录一次下游调用的耗时和结果，未知的下游忽略
+func (l *AdaptiveLimiter) Observe(dependency string, elapsed time.Duration, err error) {
+	d, ok := l.deps[dependency]
+	if !ok {
+		return
+	}
+	d.calls.Add(1)
+	d.latency.Add(int64(elapsed))
+	if err != nil {
+		d.errors.Add(1)
+	}
+}
+
+// Limit 返回当前生效的QPS
+func (l *AdaptiveLimiter) Limit() float64 {
+	return float64(l.limiter.Limit())
+}
+
+// SetOverride 固定全局限流的QPS，为0时恢复自动调整
+func (l *AdaptiveLimiter) SetOverride(qps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.override = math.Max(qps, 0)
+	l.apply()
+}
+
+// adjust 评估本间隔内各下游的调用统计并调整限流，固定QPS期间仍按下游状况调整自动值
+func (l *AdaptiveLimiter) adjust() {
+	healthy := true
+	for name, d := range l.deps {
+		calls, errs, latency := d.calls.Swap(0), d.errors.Swap(0), d.latency.Swap(0)
+		if calls < int64(l.cfg.MinSamples) {
+			continue
+		}
+		avg := time.Duration(latency / calls)
+		errorRate := float64(errs) / float64(calls)
+		ok := (d.threshold.MaxLatency <= 0 || avg <= d.threshold.MaxLatency) &&
+			(d.threshold.MaxErrorRate <= 0 || errorRate <= d.threshold.MaxErrorRate)
+		if ok {
+			l.metrics.Exchange.DependencyHealthy.WithLabelValues(name).Set(1)
+			continue
+		}
+		healthy = false
+		l.metrics.Exchange.DependencyHealthy.WithLabelValues(name).Set(0)
+		l.logger.Warn("下游异常，降低流量限流",
+			"dependency", name,
+			"avg_latency_ms", avg.Milliseconds(),
+			"error_rate", errorRate,
+			"calls", calls)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if healthy {
+		l.limit = math.Min(l.max, l.limit+l.max*l.cfg.IncreaseStep)
+	} else {
+		l.limit = math.Max(l.cfg.MinQPS, l.limit*l.cfg.DecreaseFactor)
+	}
+	l.apply()
+}
+
+// apply 按固定或自动调整的QPS更新限流，突发请求数按比例缩放，调用方持有锁
+func (l *AdaptiveLimiter) apply() {
+	qps := l.limit
+	if l.override > 0 {
+		qps = l.override
+	}
+	if qps == l.Limit() {
+		return
+	}
+	burst := l.burst
+	if l.max > 0 {
+		burst = int(math.Max(1, math.Ceil(float64(l.burst)*qps/l.max)))
+	}
+	now := time.Now()
+	l.limiter.SetLimitAt(now, rate.Limit(qps))
+	l.limiter.SetBurstAt(now, burst)
+	l.metrics.Exchange.EffectiveQPS.Set(qps)
+}
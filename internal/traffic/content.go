@@ -0,0 +1,279 @@
+package traffic
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/proto"
+
+	dspv1 "simple-dsp/api/proto/dsp/v1"
+	"simple-dsp/pkg/codec"
+)
+
+// 支持的内容类型
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/x-protobuf"
+	// contentTypeProtobufAlt 部分交易平台使用的protobuf类型名
+	contentTypeProtobufAlt = "application/protobuf"
+
+	encodingGzip = "gzip"
+)
+
+// AdResponse.ext中的字段，protobuf响应通过ext携带没有对应字段的广告信息
+const (
+	// ExtCreativeID 本次出价的素材，展示和点击事件需原样带回
+	ExtCreativeID = "creative_id"
+	// ExtAdURL 返回广告代码的地址
+	ExtAdURL = "ad_url"
+	// ExtSKAdN SKAdNetwork签名，值为与JSON响应中skadn相同的JSON
+	ExtSKAdN = "skadn"
+)
+
+const (
+	// maxDecodedBodySize 解压后请求体的最大字节数，防止压缩炸弹
+	maxDecodedBodySize = 4 << 20
+	// gzipMinSize 小于该大小的响应不压缩
+	gzipMinSize = 512
+)
+
+var (
+	// gzipWriterPool gzip压缩器池
+	gzipWriterPool = sync.Pool{
+		New: func() interface{} {
+			return gzip.NewWriter(io.Discard)
+		},
+	}
+
+	// gzipReaderPool gzip解压器池
+	gzipReaderPool sync.Pool
+)
+
+// readRequest 按Content-Encoding和Content-Type解码请求体
+func readRequest(c *gin.Context, req *Request) error {
+	body := io.Reader(c.Request.Body)
+
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding"))) {
+	case "", "identity":
+	case encodingGzip:
+		zr, err := acquireGzipReader(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		defer gzipReaderPool.Put(zr)
+		body = zr
+	default:
+		return ErrUnsupportedEncoding
+	}
+	body = io.LimitReader(body, maxDecodedBodySize)
+
+	switch requestMediaType(c) {
+	case "", contentTypeJSON:
+		return codec.NewDecoder(body).Decode(req)
+	case contentTypeProtobuf, contentTypeProtobufAlt:
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		var pb dspv1.BidRequest
+		if err := proto.Unmarshal(data, &pb); err != nil {
+			return err
+		}
+		fromProtoRequest(&pb, req)
+		return nil
+	default:
+		return ErrUnsupportedMediaType
+	}
+}
+
+// writeResponse 按Accept和Accept-Encoding协商格式并写出响应
+func writeResponse(c *gin.Context, status int, resp *Response) {
+	buf := acquireBuffer()
+	defer releaseBuffer(buf)
+
+	contentType := contentTypeJSON
+	if wantsProtobuf(c) {
+		data, err := proto.Marshal(toProtoResponse(resp))
+		if err != nil {
+			c.JSON(status, resp)
+			return
+		}
+		buf.Write(data)
+		contentType = contentTypeProtobuf
+	} else {
+		if err := codec.NewEncoder(buf).Encode(resp); err != nil {
+			c.JSON(status, resp)
+			return
+		}
+		// 与c.JSON保持一致，去掉Encoder追加的换行符
+		if n := buf.Len(); n > 0 && buf.Bytes()[n-1] == '\n' {
+			buf.Truncate(n - 1)
+		}
+		contentType += "; charset=utf-8"
+	}
+
+	c.Header("Vary", "Accept, Accept-Encoding")
+
+	if buf.Len() >= gzipMinSize && acceptsGzip(c) {
+		zbuf := acquireBuffer()
+		defer releaseBuffer(zbuf)
+
+		zw := gzipWriterPool.Get().(*gzip.Writer)
+		zw.Reset(zbuf)
+		_, err := zw.Write(buf.Bytes())
+		if err == nil {
+			err = zw.Close()
+		}
+		gzipWriterPool.Put(zw)
+
+		if err == nil {
+			c.Header("Content-Encoding", encodingGzip)
+			c.Data(status, contentType, zbuf.Bytes())
+			return
+		}
+	}
+
+	c.Data(status, contentType, buf.Bytes())
+}
+
+// acquireGzipReader 从池中获取gzip解压器
+func acquireGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if zr, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(r); err != nil {
+			gzipReaderPool.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// requestMediaType 解析请求的Content-Type，忽略参数部分
+func requestMediaType(c *gin.Context) string {
+	contentType := c.GetHeader("Content-Type")
+	if contentType == "" {
+		return ""
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return mediaType
+}
+
+// wantsProtobuf 判断是否以protobuf格式响应
+// 优先依据Accept，未指定时与请求格式保持一致
+func wantsProtobuf(c *gin.Context) bool {
+	accept := c.GetHeader("Accept")
+	if accept == "" || accept == "*/*" {
+		mediaType := requestMediaType(c)
+		return mediaType == contentTypeProtobuf || mediaType == contentTypeProtobufAlt
+	}
+	return strings.Contains(accept, contentTypeProtobuf) || strings.Contains(accept, contentTypeProtobufAlt)
+}
+
+// acceptsGzip 判断客户端是否接受gzip压缩
+func acceptsGzip(c *gin.Context) bool {
+	for _, part := range strings.Split(c.GetHeader("Accept-Encoding"), ",") {
+		coding := strings.TrimSpace(part)
+		if i := strings.IndexByte(coding, ';'); i >= 0 {
+			if strings.HasSuffix(strings.ReplaceAll(coding[i:], " ", ""), "q=0") {
+				continue
+			}
+			coding = strings.TrimSpace(coding[:i])
+		}
+		if strings.EqualFold(coding, encodingGzip) {
+			return true
+		}
+	}
+	return false
+}
+
+// fromProtoRequest 将protobuf请求转换为流量请求
+func fromProtoRequest(pb *dspv1.BidRequest, req *Request) {
+	req.RequestID = pb.GetRequestId()
+	req.UserID = pb.GetUserId()
+	req.DeviceID = pb.GetDeviceId()
+	req.IP = pb.GetIp()
+
+	// protobuf请求不携带底价货币，按系统货币处理
+	for _, slot := range pb.GetAdSlots() {
+		req.AdSlots = append(req.AdSlots, AdSlot{
+			SlotID:   slot.GetSlotId(),
+			Width:    int(slot.GetWidth()),
+			Height:   int(slot.GetHeight()),
+			MinPrice: slot.GetMinPrice(),
+			MaxPrice: slot.GetMaxPrice(),
+			Position: slot.GetPosition(),
+			AdType:   slot.GetAdType(),
+		})
+	}
+
+	if device := pb.GetDevice(); device != nil {
+		setExtraParam(req, "os", device.GetOs())
+		setExtraParam(req, "os_version", device.GetOsVersion())
+		setExtraParam(req, "brand", device.GetBrand())
+		setExtraParam(req, "model", device.GetModel())
+		setExtraParam(req, "carrier", device.GetCarrier())
+		setExtraParam(req, "connection", device.GetConnection())
+	}
+	if user := pb.GetUser(); user != nil {
+		setExtraParam(req, "geo", user.GetLocation())
+	}
+}
+
+// setExtraParam 设置非空的扩展参数
+func setExtraParam(req *Request, key, value string) {
+	if value == "" {
+		return
+	}
+	if req.ExtraParams == nil {
+		req.ExtraParams = make(map[string]string)
+	}
+	req.ExtraParams[key] = value
+}
+
+// toProtoResponse 将流量响应转换为protobuf响应
+func toProtoResponse(resp *Response) *dspv1.BidResponse {
+	pb := &dspv1.BidResponse{
+		RequestId: resp.RequestID,
+		Ads:       make([]*dspv1.AdResponse, 0, len(resp.Data)),
+	}
+	for _, ad := range resp.Data {
+		pb.Ads = append(pb.Ads, &dspv1.AdResponse{
+			SlotId:    ad.SlotID,
+			AdId:      ad.AdID,
+			BidPrice:  ad.BidPrice,
+			AdMarkup:  ad.AdMarkup,
+			WinNotice: ad.WinNotice,
+			Ext:       protoExt(&ad),
+		})
+	}
+	return pb
+}
+
+// protoExt 返回广告的扩展字段，没有需要携带的信息时返回nil
+func protoExt(ad *AdResult) map[string]string {
+	var ext map[string]string
+	set := func(key, value string) {
+		if value == "" {
+			return
+		}
+		if ext == nil {
+			ext = make(map[string]string)
+		}
+		ext[key] = value
+	}
+	set(ExtCreativeID, ad.CreativeID)
+	set(ExtAdURL, ad.AdURL)
+	if ad.SKAdN != nil {
+		if data, err := codec.Marshal(ad.SKAdN); err == nil {
+			set(ExtSKAdN, string(data))
+		}
+	}
+	return ext
+}
@@ -0,0 +1,72 @@
+package traffic
+
+import (
+	"time"
+)
+
+// 请求阶段标签，用于超时指标和慢请求日志
+const (
+	// StageParse 请求解析阶段
+	StageParse = "parse"
+	// StageRTA RTA定向阶段
+	StageRTA = "rta"
+	// StageAuction 竞价排序阶段
+	StageAuction = "auction"
+	// StageRecord 保存出价记录阶段
+	StageRecord = "record"
+)
+
+// Deadline 请求级超时预算
+type Deadline struct {
+	start    time.Time
+	deadline time.Time
+}
+
+// NewDeadline 根据交易平台的tmax创建超时预算
+// tmax为0时使用默认值，超过上限时截断，并预留网络回传时间
+func NewDeadline(start time.Time, tmax time.Duration, cfg HandlerConfig) *Deadline {
+	if tmax <= 0 {
+		tmax = cfg.DefaultTMax
+	}
+	if cfg.MaxTMax > 0 && tmax > cfg.MaxTMax {
+		tmax = cfg.MaxTMax
+	}
+
+	budget := tmax - cfg.NetworkReserve
+	if budget < 0 {
+		budget = 0
+	}
+
+	return &Deadline{
+		start:    start,
+		deadline: start.Add(budget),
+	}
+}
+
+// Time 返回内部处理的截止时间
+func (d *Deadline) Time() time.Time {
+	return d.deadline
+}
+
+// Remaining 返回剩余可用时间
+func (d *Deadline) Remaining() time.Duration {
+	remaining := time.Until(d.deadline)
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// Expired 是否已超出截止时间
+func (d *Deadline) Expired() bool {
+	return !time.Now().Before(d.deadline)
+}
+
+// StageTimeout 计算阶段超时时间，取剩余时间的指定比例与阶段上限中的较小值
+func (d *Deadline) StageTimeout(share float64, limit time.Duration) time.Duration {
+	timeout := time.Duration(float64(d.Remaining()) * share)
+	if limit > 0 && timeout > limit {
+		timeout = limit
+	}
+	return timeout
+}
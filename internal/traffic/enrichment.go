@@ -0,0 +1,181 @@
+package traffic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/profile"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/logger"
+)
+
+// DefaultEnrichmentMaxEntries 未配置上限时缓存的最大设备数
+const DefaultEnrichmentMaxEntries = 100000
+
+// 请求上下文缓存的查询结果
+const (
+	enrichmentHit  = "hit"
+	enrichmentMiss = "miss"
+)
+
+// SegmentSource 用户所属的人群包
+type SegmentSource interface {
+	// UserSegments 返回用户所属的人群包ID
+	UserSegments(ctx context.Context, userID string) ([]string, error)
+}
+
+// enrichment 按设备组装的请求上下文
+// 写入缓存后只有用户特征、人群包和频次快照会变化，其余字段只读
+type enrichment struct {
+	userID string
+	rta    *rtaDecision
+
+	// ip和userAgent为解析dimensions时的请求参数，变化时重新解析
+	ip         string
+	userAgent  string
+	dimensions stats.Dimensions
+
+	profileOnce sync.Once
+	profile     *profile.Profile
+
+	segmentsOnce sync.Once
+	segments     []string
+
+	// capped 竞价时频次已达上限的策略，有效期内不再参与竞价
+	cappedMu sync.RWMutex
+	capped   map[string]bool
+}
+
+// newEnrichment 创建用户的请求上下文
+func newEnrichment(userID string) *enrichment {
+	return &enrichment{userID: userID, capped: make(map[string]bool)}
+}
+
+// resolveDimensions 按IP和User-Agent解析地域和设备，与缓存时的请求参数相同时直接返回缓存的结果
+// 只在写入缓存前更新缓存的结果，缓存命中后参数变化时只为本次请求解析
+func (e *enrichment) resolveDimensions(resolver *stats.DimensionResolver, ip, userAgent string, cached bool) stats.Dimensions {
+	if cached && e.ip == ip && e.userAgent == userAgent {
+		return e.dimensions
+	}
+	dimensions := resolver.Resolve(ip, userAgent)
+	if !cached {
+		e.ip, e.userAgent, e.dimensions = ip, userAgent, dimensions
+	}
+	return dimensions
+}
+
+// userProfile 读取用户特征，同一上下文只读取一次
+func (e *enrichment) userProfile(ctx context.Context, engine *bidding.Engine) *profile.Profile {
+	e.profileOnce.Do(func() {
+		e.profile = engine.UserProfile(ctx, e.userID)
+	})
+	return e.profile
+}
+
+// userSegments 读取用户所属的人群包，同一上下文只读取一次，读取失败时按不属于任何人群包处理
+func (e *enrichment) userSegments(ctx context.Context, source SegmentSource, log *logger.Logger) []string {
+	e.segmentsOnce.Do(func() {
+		segments, err := source.UserSegments(ctx, e.userID)
+		if err != nil {
+			log.Warn("读取用户人群包失败", "user_id", e.userID, "error", err)
+			return
+		}
+		e.segments = segments
+	})
+	return e.segments
+}
+
+// Capped 实现bidding.FrequencySnapshot，策略的频次是否已达上限
+func (e *enrichment) Capped(strategyID string) bool {
+	e.cappedMu.RLock()
+	defer e.cappedMu.RUnlock()
+	return e.capped[strategyID]
+}
+
+// MarkCapped 实现bidding.FrequencySnapshot，记录频次已达上限的策略
+func (e *enrichment) MarkCapped(strategyID string) {
+	e.cappedMu.Lock()
+	defer e.cappedMu.Unlock()
+	e.capped[strategyID] = true
+}
+
+// EnrichmentCache 按设备ID缓存请求上下文(地域和设备、RTA定向结果、用户特征、人群包和频次快照)
+// 同一设备在有效期内的连续请求复用上下文，不再解析地域、查询RTA和读取用户特征、人群包
+// 频次快照只记录已达上限的策略，是否可以出价仍在竞价时实时检查
+type EnrichmentCache struct {
+	entries    *cache.Cache
+	maxEntries int
+}
+
+// NewEnrichmentCache 创建请求上下文缓存，maxEntries不大于0时使用DefaultEnrichmentMaxEntries
+func NewEnrichmentCache(ttl time.Duration, maxEntries int) *EnrichmentCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultEnrichmentMaxEntries
+	}
+	return &EnrichmentCache{
+		entries:    cache.New(ttl, 2*ttl),
+		maxEntries: maxEntries,
+	}
+}
+
+// Len 返回缓存的设备数，包含已过期但尚未清理的条目
+func (c *EnrichmentCache) Len() int {
+	return c.entries.ItemCount()
+}
+
+// get 查询设备的上下文，设备对应的用户变化时视为未命中
+func (c *EnrichmentCache) get(deviceID, userID string) *enrichment {
+	v, ok := c.entries.Get(deviceID)
+	if !ok {
+		return nil
+	}
+	e := v.(*enrichment)
+	if e.userID != userID {
+		return nil
+	}
+	return e
+}
+
+// set 保存设备的上下文，缓存已满时不保存新设备，等待过期条目清理
+func (c *EnrichmentCache) set(deviceID string, e *enrichment) {
+	if c.entries.ItemCount() >= c.maxEntries {
+		if _, ok := c.entries.Get(deviceID); !ok {
+			return
+		}
+	}
+	c.entries.SetDefault(deviceID, e)
+}
+
+// lookupEnrichment 获取请求的上下文，设置了缓存时优先使用同一设备缓存的上下文
+// 未命中时返回新的上下文，cached为false，由enrich组装后写入缓存
+func (h *Handler) lookupEnrichment(req *Request) (e *enrichment, cached bool) {
+	if h.enrichments == nil {
+		return newEnrichment(req.UserID), false
+	}
+	if e := h.enrichments.get(req.DeviceID, req.UserID); e != nil {
+		h.metrics.Bid.EnrichmentLookups.WithLabelValues(enrichmentHit).Inc()
+		return e, true
+	}
+	h.metrics.Bid.EnrichmentLookups.WithLabelValues(enrichmentMiss).Inc()
+	return newEnrichment(req.UserID), false
+}
+
+// enrich 为未缓存的上下文查询RTA并写入缓存，缓存的上下文直接返回
+func (h *Handler) enrich(ctx context.Context, req *Request, e *enrichment, cached bool) error {
+	if cached {
+		return nil
+	}
+	decision, err := h.evaluateRTA(ctx, req.UserID)
+	if err != nil {
+		return err
+	}
+	e.rta = decision
+	if h.enrichments != nil {
+		h.enrichments.set(req.DeviceID, e)
+	}
+	return nil
+}
@@ -33,6 +33,9 @@ var (
 	// ErrInvalidAdSlotPrice 表示广告位价格无效
 	ErrInvalidAdSlotPrice = errors.New("无效的广告位价格")
 
+	// ErrInvalidAdSlotCurrency 表示广告位底价货币无效
+	ErrInvalidAdSlotCurrency = errors.New("无效的广告位底价货币")
+
 	// ErrInvalidAdSlotPosition 表示广告位位置无效
 	ErrInvalidAdSlotPosition = errors.New("无效的广告位位置")
 
@@ -54,12 +57,21 @@ var (
 	// ErrRequestTimeout 表示请求超时
 	ErrRequestTimeout = errors.New("请求处理超时")
 
+	// ErrBidRecordUnavailable 表示出价记录保存失败，无法校验和计费该出价
+	ErrBidRecordUnavailable = errors.New("出价记录保存失败")
+
 	// ErrRateLimited 表示请求被限流
 	ErrRateLimited = errors.New("请求被限流")
 
 	// ErrInvalidRequestFormat 表示请求格式无效
 	ErrInvalidRequestFormat = errors.New("无效的请求格式")
 
+	// ErrUnsupportedMediaType 表示不支持的内容类型
+	ErrUnsupportedMediaType = errors.New("不支持的内容类型")
+
+	// ErrUnsupportedEncoding 表示不支持的内容编码
+	ErrUnsupportedEncoding = errors.New("不支持的内容编码")
+
 	// ErrInvalidResponseFormat 表示响应格式无效
 	ErrInvalidResponseFormat = errors.New("无效的响应格式")
 ) 
\ No newline at end of file
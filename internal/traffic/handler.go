@@ -10,10 +10,16 @@
  * - 调用RTA服务
  * - 执行竞价流程
  * - 返回广告响应
+ * - 启用竞价漏斗时写出出价事件
+ * - 启用维度统计时按请求的IP和User-Agent解析地域和设备，写入请求上下文并随出价记录保存
+ * - 按竞价请求的gdpr、gdpr_consent、us_privacy参数设置同意状态，不同意时竞价不使用用户特征
+ * - 启用供应链验证时验证请求的schain，结果交给竞价引擎
+ * - 启用广告地址时返回带竞价令牌的ad_url，广告代码随出价记录保存
  *
  * 实现细节:
  * - 使用gin框架处理HTTP请求
  * - 实现请求参数验证
+ * - 按请求协商JSON/protobuf格式及gzip压缩
  * - 支持请求限流控制
  * - 提供性能监控
  *
@@ -35,17 +41,39 @@ package traffic
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"simple-dsp/internal/bidding"
 	"simple-dsp/internal/event"
+	"simple-dsp/internal/exchange"
+	"simple-dsp/internal/floor"
+	"simple-dsp/internal/forecast"
 	"simple-dsp/internal/rta"
+	"simple-dsp/internal/skadn"
+	"simple-dsp/internal/stats"
+	"simple-dsp/internal/supplychain"
+	"simple-dsp/pkg/codec"
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/id"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/reqctx"
+	"simple-dsp/pkg/useragent"
+)
+
+// 交易平台请求结果标签
+const (
+	resultBid     = "bid"
+	resultNoBid   = "nobid"
+	resultTimeout = "timeout"
+	resultError   = "error"
+
+	// unknownExchangeLabel 未注册交易平台的指标标签
+	unknownExchangeLabel = "unknown"
 )
 
 // Request TrafficRequest 表示来自上游的流量请求
@@ -57,7 +85,14 @@ type Request struct {
 	UserAgent   string            `json:"user_agent"`
 	AdSlots     []AdSlot          `json:"ad_slots"`
 	Timestamp   int64             `json:"timestamp"`
+	TMax        int64             `json:"tmax"` // 交易平台要求的最大响应时间(毫秒)
 	ExtraParams map[string]string `json:"extra_params"`
+	// SKAdN iOS流量的SKAdNetwork信息，媒体支持时携带
+	SKAdN *skadn.Request `json:"skadn,omitempty"`
+	// SChain 交易平台转发的供应链
+	SChain *supplychain.SupplyChain `json:"schain,omitempty"`
+	// Publisher 媒体信息，按媒体的ads.txt或app-ads.txt验证供应链时使用
+	Publisher *supplychain.Publisher `json:"publisher,omitempty"`
 }
 
 // AdSlot 表示广告位信息
@@ -67,8 +102,10 @@ type AdSlot struct {
 	Height   int     `json:"height"`
 	MinPrice float64 `json:"min_price"`
 	MaxPrice float64 `json:"max_price"`
-	Position string  `json:"position"`
-	AdType   string  `json:"ad_type"`
+	// Currency MinPrice和MaxPrice的货币，ISO 4217代码，为空时为系统货币
+	Currency string `json:"currency,omitempty"`
+	Position string `json:"position"`
+	AdType   string `json:"ad_type"`
 }
 
 // Response TrafficResponse 表示返回给上游的响应
@@ -86,37 +123,139 @@ type AdResult struct {
 	BidPrice  float64 `json:"bid_price"`
 	AdMarkup  string  `json:"ad_markup"`
 	WinNotice string  `json:"win_notice"`
+	// SKAdN 签名的SKAdNetwork归因信息，仅对符合条件的广告返回
+	SKAdN *skadn.Response `json:"skadn,omitempty"`
+	// AdURL 返回广告代码的地址，启用广告地址时返回，供按地址加载广告的客户端使用
+	AdURL string `json:"ad_url,omitempty"`
+	// CreativeID 本次出价的素材，展示和点击事件需原样带回
+	CreativeID string `json:"creative_id,omitempty"`
+}
+
+// BidCounter 按广告统计出价次数，用于计算胜率
+type BidCounter interface {
+	CountBids(ctx context.Context, adIDs []string) error
+}
+
+// BidEventSink 写出出价事件，用于按请求关联竞价漏斗
+type BidEventSink interface {
+	Submit(event *stats.Event) error
 }
 
 // Handler 流量处理器
 type Handler struct {
+	exchanges     *exchange.Registry
 	rtaClient     *rta.Client
+	rtaTasks      *rta.ConfigManager
+	enrichments   *EnrichmentCache
+	segments      SegmentSource
+	forecasts     *forecast.Recorder
 	biddingEngine *bidding.Engine
 	eventHandler  *event.Handler
+	bidRecords    event.BidRecordStore
+	bidCounter    BidCounter
+	bidEvents     BidEventSink
+	dimensions    *stats.DimensionResolver
+	skadnSigner   *skadn.Signer
+	skadnStore    skadn.Store
+	supplyChain   *supplychain.Validator
+	adTokens      *event.AdTokenSigner
+	adBaseURL     string
+	config        HandlerConfig
 	logger        *logger.Logger
 	metrics       *metrics.Metrics
-	//limiter       *Limiter
+	limiter       *AdaptiveLimiter
 }
 
 // NewHandler 创建新的流量处理器
 func NewHandler(
+	config HandlerConfig,
+	exchanges *exchange.Registry,
 	rtaClient *rta.Client,
 	biddingEngine *bidding.Engine,
 	eventHandler *event.Handler,
 	logger *logger.Logger,
 	metrics *metrics.Metrics,
-	// limiter *Limiter,
 ) *Handler {
+	if exchanges == nil {
+		exchanges = exchange.NewRegistry()
+	}
 	return &Handler{
+		exchanges:     exchanges,
 		rtaClient:     rtaClient,
 		biddingEngine: biddingEngine,
 		eventHandler:  eventHandler,
+		config:        config.withDefaults(),
 		logger:        logger,
 		metrics:       metrics,
-		//limiter:       limiter,
 	}
 }
 
+// SetBidRecordStore 设置出价记录存储，出价成功后保存记录供事件校验
+func (h *Handler) SetBidRecordStore(store event.BidRecordStore) {
+	h.bidRecords = store
+}
+
+// SetRateLimiter 设置全局限流，为nil时只按交易平台限流
+// 设置后RTA查询的耗时和结果计入限流的下游健康评估
+func (h *Handler) SetRateLimiter(limiter *AdaptiveLimiter) {
+	h.limiter = limiter
+}
+
+// SetBidCounter 设置出价次数统计，为nil时不统计
+func (h *Handler) SetBidCounter(counter BidCounter) {
+	h.bidCounter = counter
+}
+
+// SetBidEvents 设置出价事件写出，为nil时不写出
+// 事件与展示、点击等事件一样按用户分片，写出失败只记录日志，不影响出价
+func (h *Handler) SetBidEvents(sink BidEventSink) {
+	h.bidEvents = sink
+}
+
+// SetDimensions 设置维度解析，设置后按请求的IP和User-Agent解析地域和设备，
+// 写入出价记录和出价事件，竞价成功通知和展示使用出价时的维度
+func (h *Handler) SetDimensions(resolver *stats.DimensionResolver) {
+	h.dimensions = resolver
+}
+
+// SetRTATasks 设置推广计划绑定的RTA任务，设置后只在有推广计划绑定任务时查询RTA，为nil时对所有请求查询RTA
+func (h *Handler) SetRTATasks(tasks *rta.ConfigManager) {
+	h.rtaTasks = tasks
+}
+
+// SetEnrichmentCache 设置按设备缓存的请求上下文，为nil时每个请求都查询RTA
+func (h *Handler) SetEnrichmentCache(cache *EnrichmentCache) {
+	h.enrichments = cache
+}
+
+// SetSegmentSource 设置用户人群包来源，设置后竞价请求携带用户所属的人群包，开启上下文缓存时随上下文缓存
+func (h *Handler) SetSegmentSource(source SegmentSource) {
+	h.segments = source
+}
+
+// SetForecastRecorder 设置流量分布记录，设置后记录每个允许出价的广告位请求
+func (h *Handler) SetForecastRecorder(recorder *forecast.Recorder) {
+	h.forecasts = recorder
+}
+
+// SetSKAdNetwork 设置SKAdNetwork签名，设置后对携带skadn的请求返回已配置广告的签名
+func (h *Handler) SetSKAdNetwork(signer *skadn.Signer, store skadn.Store) {
+	h.skadnSigner = signer
+	h.skadnStore = store
+}
+
+// SetSupplyChain 设置供应链验证器，为nil时不验证，请求按供应链未授权处理
+func (h *Handler) SetSupplyChain(validator *supplychain.Validator) {
+	h.supplyChain = validator
+}
+
+// SetAdServing 设置广告地址，设置后响应中返回baseURL/ad/{竞价令牌}，广告代码随出价记录保存
+// 未设置出价记录存储时不返回广告地址
+func (h *Handler) SetAdServing(signer *event.AdTokenSigner, baseURL string) {
+	h.adTokens = signer
+	h.adBaseURL = strings.TrimSuffix(baseURL, "/")
+}
+
 // GetStats 获取流量统计
 func (h *Handler) GetStats(c *gin.Context) {
 	// TODO: 实现流量统计
@@ -130,89 +269,237 @@ func (h *Handler) GetStats(c *gin.Context) {
 
 // HandlerConfig 处理器配置
 type HandlerConfig struct {
-	QPS           float64       // 每秒请求数限制
-	Burst         int           // 突发请求数限制
-	RTATimeout    time.Duration // RTA服务超时时间
-	BidTimeout    time.Duration // 竞价服务超时时间
-	MaxAdSlots    int           // 最大广告位数
-	MinAdSlotSize int           // 最小广告位尺寸
-	MaxAdSlotSize int           // 最大广告位尺寸
+	QPS            float64       // 每秒请求数限制
+	Burst          int           // 突发请求数限制
+	RTATimeout     time.Duration // RTA服务超时时间
+	BidTimeout     time.Duration // 竞价服务超时时间
+	MaxAdSlots     int           // 最大广告位数
+	MinAdSlotSize  int           // 最小广告位尺寸
+	MaxAdSlotSize  int           // 最大广告位尺寸
+	DefaultTMax    time.Duration // 请求未携带tmax时的默认超时
+	MaxTMax        time.Duration // 允许的最大tmax
+	NetworkReserve time.Duration // 为网络回传预留的时间
+	RTAShare       float64       // RTA阶段可占用剩余时间的比例
+	SlowThreshold  time.Duration // 慢请求日志阈值，为0时不记录
+	RecordTimeout  time.Duration // 保存出价记录的超时时间，受tmax截止时间限制
+}
+
+// withDefaults 填充默认配置
+func (c HandlerConfig) withDefaults() HandlerConfig {
+	if c.DefaultTMax <= 0 {
+		c.DefaultTMax = c.BidTimeout
+	}
+	if c.DefaultTMax <= 0 {
+		c.DefaultTMax = 200 * time.Millisecond
+	}
+	if c.NetworkReserve < 0 {
+		c.NetworkReserve = 0
+	}
+	if c.RTAShare <= 0 || c.RTAShare >= 1 {
+		c.RTAShare = 0.5
+	}
+	if c.RecordTimeout <= 0 {
+		c.RecordTimeout = 20 * time.Millisecond
+	}
+	if c.MaxAdSlots <= 0 {
+		c.MaxAdSlots = 10
+	}
+	return c
 }
 
 // HandleRequest 处理流量请求
+// 请求ID和交易平台由middleware.RequestContext写入上下文，未指定交易平台时使用默认配置
 func (h *Handler) HandleRequest(c *gin.Context) {
 	startTime := time.Now()
-	requestID := c.GetHeader("X-Request-ID")
+	requestID := reqctx.RequestID(c.Request.Context())
 	if requestID == "" {
-		requestID = generateRequestID()
+		requestID = id.New()
+	}
+	// 延迟指标的exemplar优先关联traceparent中的追踪ID，没有时使用请求ID
+	traceID := metrics.ParseTraceparent(c.GetHeader("traceparent"))
+	if traceID == "" {
+		traceID = requestID
 	}
+	traceCtx := metrics.WithTraceID(c.Request.Context(), traceID)
+	// 各阶段耗时，请求超过慢请求阈值时输出
+	timings := logger.NewTimings()
+	traceCtx = logger.WithTimings(traceCtx, timings)
+	// 本次请求的日志均带上请求ID
+	traceCtx = logger.ContextWithFields(traceCtx, "request_id", requestID)
+	log := h.logger.WithContext(traceCtx)
+
+	exchangeID := reqctx.Exchange(traceCtx)
 
 	// 记录请求开始
-	h.logger.Info("收到流量请求",
-		"request_id", requestID,
+	log.Info("收到流量请求",
+		"exchange", exchangeID,
 		"remote_addr", c.ClientIP(),
 		"user_agent", c.GetHeader("User-Agent"))
 
-	// 限流检查
-	//if !h.limiter.Allow() {
-	//	h.logger.Warn("请求被限流",
-	//		"request_id", requestID,
-	//		"remote_addr", c.ClientIP())
-	//	c.JSON(http.StatusTooManyRequests, gin.H{"error": "服务繁忙，请稍后重试"})
-	//	return
-	//}
+	// 加载交易平台配置并校验接入
+	profile, err := h.exchanges.Get(exchangeID)
+	if err != nil {
+		h.metrics.Exchange.Rejected.WithLabelValues(unknownExchangeLabel, "unknown_exchange").Inc()
+		log.Warn("未知的交易平台", "exchange", exchangeID)
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err := profile.Authenticate(c.Request); err != nil {
+		h.metrics.Exchange.Rejected.WithLabelValues(profile.ID, "unauthorized").Inc()
+		log.Warn("交易平台认证失败",
+			"exchange", profile.ID,
+			"remote_addr", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	traceCtx = reqctx.WithAPIKeyOwner(reqctx.WithExchange(traceCtx, profile.ID), profile.ID)
+	if !h.exchanges.Allow(profile.ID) {
+		h.metrics.Exchange.Rejected.WithLabelValues(profile.ID, "qps_exceeded").Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": exchange.ErrQPSExceeded.Error()})
+		return
+	}
 
+	// 全局限流，下游异常时自动降低
+	if h.limiter != nil && !h.limiter.Allow() {
+		h.metrics.Exchange.Rejected.WithLabelValues(profile.ID, "rate_limited").Inc()
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": ErrRateLimited.Error()})
+		return
+	}
+
+	result := resultError
 	defer func() {
 		// 记录请求处理时间
 		duration := time.Since(startTime)
-		h.metrics.HTTP.RequestDuration.Observe(duration.Seconds())
-		h.logger.Info("请求处理完成",
-			"request_id", requestID,
+		h.metrics.HTTP.RequestDuration.WithLabelValues(c.Request.Method, c.FullPath()).Observe(duration.Seconds())
+		h.metrics.Exchange.Requests.WithLabelValues(profile.ID, result).Inc()
+		metrics.ObserveWithTrace(traceCtx, h.metrics.Exchange.Duration.WithLabelValues(profile.ID), duration.Seconds())
+		h.metrics.ObserveBidSLO(duration)
+		log.Info("请求处理完成",
 			"duration_ms", duration.Milliseconds())
+		if h.config.SlowThreshold > 0 && duration > h.config.SlowThreshold {
+			log.Warn("慢竞价请求",
+				"exchange", profile.ID,
+				"result", result,
+				"duration_ms", duration.Milliseconds(),
+				"threshold_ms", h.config.SlowThreshold.Milliseconds(),
+				"stages_ms", timings.Milliseconds())
+		}
 	}()
 
 	// 解析请求
-	var req Request
-	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Error("解析请求失败",
-			"request_id", requestID,
+	req := acquireRequest()
+	defer releaseRequest(req)
+	parseStart := time.Now()
+	err = readRequest(c, req)
+	timings.Since(StageParse, parseStart)
+	if err != nil {
+		log.Error("解析请求失败",
+			"content_type", c.GetHeader("Content-Type"),
+			"content_encoding", c.GetHeader("Content-Encoding"),
 			"error", err)
+		if errors.Is(err, ErrUnsupportedMediaType) || errors.Is(err, ErrUnsupportedEncoding) {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求格式"})
 		return
 	}
 
 	// 设置请求ID
 	req.RequestID = requestID
+	// 竞价请求由交易平台服务器发出，请求头不代表用户，同意状态只取请求中的参数
+	consent, _ := reqctx.ConsentFromParams(req.ExtraParams)
+	traceCtx = reqctx.WithConsent(traceCtx, consent)
+
+	// 同一设备短时间内的连续请求复用缓存的上下文
+	enriched, cached := h.lookupEnrichment(req)
+
+	// 按用户的IP和User-Agent解析地域和设备，写入上下文并随出价记录保存
+	var dimensions stats.Dimensions
+	if h.dimensions != nil {
+		dimensions = enriched.resolveDimensions(h.dimensions, req.IP, req.UserAgent, cached)
+		traceCtx = reqctx.WithGeo(traceCtx, geo.Location{Country: dimensions.Country, Province: dimensions.Province, City: dimensions.City})
+		traceCtx = reqctx.WithDevice(traceCtx, useragent.Device{Type: dimensions.DeviceType, OS: dimensions.OS})
+	}
 
 	// 参数验证
-	if err := h.validateRequest(&req); err != nil {
-		h.logger.Error("请求参数验证失败",
-			"request_id", requestID,
+	if err := h.validateRequest(req); err != nil {
+		log.Error("请求参数验证失败",
 			"error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 创建上下文
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 200*time.Millisecond)
+	// 过滤交易平台不允许的广告类型
+	filterAdSlots(req, profile)
+	if len(req.AdSlots) == 0 {
+		result = resultNoBid
+		h.sendNoBid(c, requestID, "没有允许的广告类型")
+		return
+	}
+
+	// 验证供应链，要求已授权供应链的推广计划只参与验证通过的请求
+	schainStatus := ""
+	if h.supplyChain != nil {
+		schainStatus = h.supplyChain.Verify(req.SChain, req.Publisher)
+		h.metrics.Exchange.SupplyChain.WithLabelValues(profile.ID, schainStatus).Inc()
+	}
+
+	// 记录流量分布，供投放预估使用
+	if h.forecasts != nil {
+		for _, slot := range req.AdSlots {
+			h.forecasts.Observe(forecast.Sample{
+				Exchange: profile.ID,
+				AdType:   slot.AdType,
+				Width:    slot.Width,
+				Height:   slot.Height,
+				Floor:    slot.MinPrice,
+				OS:       req.ExtraParams["os"],
+				Network:  req.ExtraParams["connection"],
+				Location: req.ExtraParams["geo"],
+			})
+		}
+	}
+
+	// 请求未携带tmax时使用交易平台的默认值
+	if req.TMax <= 0 && profile.DefaultTMax > 0 {
+		req.TMax = profile.DefaultTMax.Milliseconds()
+	}
+
+	// 根据tmax创建请求级超时预算
+	deadline := NewDeadline(startTime, time.Duration(req.TMax)*time.Millisecond, h.config)
+	ctx, cancel := context.WithDeadline(traceCtx, deadline.Time())
 	defer cancel()
 
-	// RTA定向判断
-	isTargeted, err := h.rtaClient.CheckTargeting(ctx, req.UserID)
+	// RTA定向判断，同一设备短时间内的连续请求复用缓存的上下文
+	rtaCtx, rtaCancel := context.WithTimeout(ctx, deadline.StageTimeout(h.config.RTAShare, h.config.RTATimeout))
+	rtaStart := time.Now()
+	err = h.enrich(rtaCtx, req, enriched, cached)
+	timings.Since(StageRTA, rtaStart)
+	rtaCancel()
 	if err != nil {
-		h.logger.Error("RTA定向检查失败",
-			"request_id", requestID,
+		if errors.Is(rtaCtx.Err(), context.DeadlineExceeded) {
+			h.metrics.Bid.StageTimeouts.WithLabelValues(StageRTA).Inc()
+			log.Warn("RTA定向检查超时",
+				"user_id", req.UserID,
+				"remaining_ms", deadline.Remaining().Milliseconds())
+			result = resultTimeout
+			h.sendNoBid(c, requestID, ErrRequestTimeout.Error())
+			return
+		}
+		log.Error("RTA定向检查失败",
 			"user_id", req.UserID,
 			"error", err)
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务暂时不可用"})
 		return
 	}
 
-	if !isTargeted {
-		h.logger.Info("用户不符合RTA定向",
-			"request_id", requestID,
+	decision := enriched.rta
+	if !decision.targeted {
+		result = resultNoBid
+		log.Info("用户不符合RTA定向",
 			"user_id", req.UserID)
-		c.JSON(http.StatusOK, Response{
+		writeResponse(c, http.StatusOK, &Response{
 			RequestID: requestID,
 			Code:      0,
 			Message:   "用户不符合定向要求",
@@ -225,36 +512,57 @@ func (h *Handler) HandleRequest(c *gin.Context) {
 	bidReq := bidding.BidRequest{
 		RequestID: requestID,
 		UserID:    req.UserID,
+		Exchange:  profile.ID,
 		AdSlots:   convertToBidSlots(req.AdSlots),
+		// RTA返回的出价信号交给竞价引擎，是否使用由推广计划配置决定
+		RTA:                   decision.signal,
+		RTACampaigns:          decision.campaigns,
+		SupplyChainAuthorized: schainStatus == supplychain.StatusAuthorized,
+	}
+	// 开启上下文缓存时用户特征和频次快照随上下文缓存，竞价引擎不再读取用户特征，跳过频次已达上限的策略
+	if h.enrichments != nil {
+		bidReq.Profile = enriched.userProfile(ctx, h.biddingEngine)
+		bidReq.ProfileLoaded = true
+		bidReq.Frequency = enriched
+	}
+	if h.segments != nil {
+		bidReq.Segments = enriched.userSegments(ctx, h.segments, h.logger)
 	}
 
-	// 执行竞价
-	bidResp, err := h.biddingEngine.ProcessBid(ctx, bidReq)
+	// 执行竞价，每个广告位独立出价
+	auctionStart := time.Now()
+	bidResps, err := h.biddingEngine.ProcessBids(ctx, bidReq)
+	timings.Since(StageAuction, auctionStart)
 	if err != nil {
 		switch {
+		case errors.Is(err, bidding.ErrBidTimeout):
+			// 竞价阶段的超时由竞价引擎按阶段计数
+			log.Warn("竞价处理超时",
+				"user_id", req.UserID)
+			result = resultTimeout
+			h.sendNoBid(c, requestID, ErrRequestTimeout.Error())
 		case errors.Is(err, bidding.ErrNoAvailableAds):
-			h.logger.Info("没有可用的广告",
-				"request_id", requestID,
+			result = resultNoBid
+			log.Info("没有可用的广告",
 				"user_id", req.UserID)
-			c.JSON(http.StatusOK, Response{
+			writeResponse(c, http.StatusOK, &Response{
 				RequestID: requestID,
 				Code:      0,
 				Message:   "没有可用的广告",
 				Data:      []AdResult{},
 			})
 		case errors.Is(err, bidding.ErrBudgetExceeded):
-			h.logger.Warn("预算已超限",
-				"request_id", requestID,
+			result = resultNoBid
+			log.Warn("预算已超限",
 				"user_id", req.UserID)
-			c.JSON(http.StatusOK, Response{
+			writeResponse(c, http.StatusOK, &Response{
 				RequestID: requestID,
 				Code:      0,
 				Message:   "预算已超限",
 				Data:      []AdResult{},
 			})
 		default:
-			h.logger.Error("竞价处理失败",
-				"request_id", requestID,
+			log.Error("竞价处理失败",
 				"user_id", req.UserID,
 				"error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "竞价处理失败"})
@@ -267,17 +575,147 @@ func (h *Handler) HandleRequest(c *gin.Context) {
 		RequestID: requestID,
 		Code:      0,
 		Message:   "success",
-		Data:      convertToAdResults(bidResp),
+		Data:      convertToAdResults(bidResps, profile),
+	}
+	result = resultBid
+
+	// iOS流量附加SKAdNetwork签名
+	if req.SKAdN != nil && h.skadnSigner != nil {
+		h.attachSKAdN(ctx, req, resp.Data)
+	}
+
+	// 保存出价记录，先于响应写入以免展示早于记录到达
+	// 保存有单独的时间预算且不超过tmax截止时间，保存失败的广告位不出价，否则其展示和竞价成功通知无法校验和计费
+	if h.bidRecords != nil {
+		recordCtx, recordCancel := context.WithTimeout(ctx, h.config.RecordTimeout)
+		recordStart := time.Now()
+		saved := make([]*bidding.BidResponse, 0, len(bidResps))
+		data := make([]AdResult, 0, len(resp.Data))
+		for i, bidResp := range bidResps {
+			record := &event.BidRecord{
+				RequestID:  requestID,
+				AdID:       bidResp.AdID,
+				CreativeID: bidResp.CreativeID,
+				SlotID:     bidResp.SlotID,
+				Exchange:   profile.ID,
+				BidPrice:   bidResp.BidPrice,
+				BidTime:    time.Now(),
+				Dimensions: dimensions,
+			}
+			if h.adTokens != nil {
+				record.AdMarkup = resp.Data[i].AdMarkup
+				resp.Data[i].AdURL = h.adBaseURL + "/ad/" + h.adTokens.Sign(requestID, bidResp.AdID)
+			}
+			if err := h.bidRecords.Save(recordCtx, record); err != nil {
+				log.Error("保存出价记录失败，放弃该广告位的出价", "slot_id", bidResp.SlotID, "error", err)
+				continue
+			}
+			saved = append(saved, bidResp)
+			data = append(data, resp.Data[i])
+		}
+		timings.Since(StageRecord, recordStart)
+		if errors.Is(recordCtx.Err(), context.DeadlineExceeded) {
+			h.metrics.Bid.StageTimeouts.WithLabelValues(StageRecord).Inc()
+		}
+		recordCancel()
+
+		bidResps, resp.Data = saved, data
+		if len(bidResps) == 0 {
+			result = resultNoBid
+			h.sendNoBid(c, requestID, ErrBidRecordUnavailable.Error())
+			return
+		}
+	}
+
+	// 统计出价次数，受tmax截止时间限制，超时未返回的出价交易平台不再接受，不计入出价次数
+	if h.bidCounter != nil {
+		adIDs := make([]string, 0, len(bidResps))
+		for _, bidResp := range bidResps {
+			adIDs = append(adIDs, bidResp.AdID)
+		}
+		if err := h.bidCounter.CountBids(ctx, adIDs); err != nil {
+			log.Error("统计出价次数失败", "error", err)
+		}
+	}
+
+	if h.bidEvents != nil {
+		// 出价事件携带广告位尺寸，竞价漏斗按(交易平台, 广告位, 尺寸)汇总供应路径的表现
+		sizes := make(map[string]string, len(req.AdSlots))
+		for _, slot := range req.AdSlots {
+			sizes[slot.SlotID] = floor.FormatSize(slot.Width, slot.Height)
+		}
+		for _, bidResp := range bidResps {
+			bidEvent := &stats.Event{
+				EventType:   stats.EventBid,
+				RequestID:   requestID,
+				UserID:      req.UserID,
+				AdID:        bidResp.AdID,
+				SlotID:      bidResp.SlotID,
+				BidPrice:    bidResp.BidPrice,
+				Timestamp:   time.Now(),
+				ExtraParams: map[string]string{"exchange": profile.ID, "size": sizes[bidResp.SlotID]},
+				Dimensions:  dimensions,
+			}
+			if err := h.bidEvents.Submit(bidEvent); err != nil {
+				log.Warn("写出出价事件失败", "slot_id", bidResp.SlotID, "error", err)
+			}
+		}
 	}
 
 	// 记录竞价结果
-	h.logger.Info("竞价成功",
-		"request_id", requestID,
-		"user_id", req.UserID,
-		"ad_id", bidResp.AdID,
-		"bid_price", bidResp.BidPrice)
+	for _, bidResp := range bidResps {
+		log.Info("竞价成功",
+			"exchange", profile.ID,
+			"user_id", req.UserID,
+			"slot_id", bidResp.SlotID,
+			"ad_id", bidResp.AdID,
+			"bid_price", bidResp.BidPrice)
+	}
+
+	writeResponse(c, http.StatusOK, &resp)
+}
+
+// attachSKAdN 为配置了SKAdNetwork的广告附加签名，失败时仍正常出价，只是不参与SKAdNetwork归因
+func (h *Handler) attachSKAdN(ctx context.Context, req *Request, results []AdResult) {
+	log := h.logger.WithContext(ctx)
+	for i := range results {
+		campaign, err := h.skadnStore.Campaign(ctx, results[i].AdID)
+		if errors.Is(err, skadn.ErrCampaignNotFound) {
+			h.metrics.Bid.SKAdNetwork.WithLabelValues("ineligible").Inc()
+			continue
+		}
+		if err != nil {
+			h.metrics.Bid.SKAdNetwork.WithLabelValues("error").Inc()
+			log.Error("查询SKAdNetwork配置失败",
+				"ad_id", results[i].AdID,
+				"error", err)
+			continue
+		}
 
-	c.JSON(http.StatusOK, resp)
+		signed, err := h.skadnSigner.Sign(req.SKAdN, campaign, time.Now())
+		switch {
+		case errors.Is(err, skadn.ErrNotEligible):
+			h.metrics.Bid.SKAdNetwork.WithLabelValues("ineligible").Inc()
+		case err != nil:
+			h.metrics.Bid.SKAdNetwork.WithLabelValues("error").Inc()
+			log.Error("生成SKAdNetwork签名失败",
+				"ad_id", results[i].AdID,
+				"error", err)
+		default:
+			h.metrics.Bid.SKAdNetwork.WithLabelValues("signed").Inc()
+			results[i].SKAdN = signed
+		}
+	}
+}
+
+// sendNoBid 返回不出价响应
+func (h *Handler) sendNoBid(c *gin.Context, requestID, message string) {
+	writeResponse(c, http.StatusOK, &Response{
+		RequestID: requestID,
+		Code:      0,
+		Message:   message,
+		Data:      []AdResult{},
+	})
 }
 
 // validateRequest 验证请求参数
@@ -297,13 +735,13 @@ func (h *Handler) validateRequest(req *Request) error {
 	if len(req.AdSlots) == 0 {
 		return ErrNoAdSlots
 	}
-	if len(req.AdSlots) > 10 { // 限制最大广告位数
+	if len(req.AdSlots) > h.config.MaxAdSlots {
 		return ErrTooManyAdSlots
 	}
 
 	// 验证每个广告位
-	for _, slot := range req.AdSlots {
-		if err := h.validateAdSlot(&slot); err != nil {
+	for i := range req.AdSlots {
+		if err := h.validateAdSlot(&req.AdSlots[i]); err != nil {
 			return err
 		}
 	}
@@ -322,6 +760,9 @@ func (h *Handler) validateAdSlot(slot *AdSlot) error {
 	if slot.MinPrice < 0 || slot.MaxPrice < 0 || slot.MinPrice > slot.MaxPrice {
 		return ErrInvalidAdSlotPrice
 	}
+	if slot.Currency != "" && !validCurrency(slot.Currency) {
+		return ErrInvalidAdSlotCurrency
+	}
 	if slot.Position == "" {
 		return ErrInvalidAdSlotPosition
 	}
@@ -335,27 +776,12 @@ func (h *Handler) validateAdSlot(slot *AdSlot) error {
 func (h *Handler) sendResponse(w http.ResponseWriter, resp *Response) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Request-ID", resp.RequestID)
-	err := json.NewEncoder(w).Encode(resp)
+	err := codec.NewEncoder(w).Encode(resp)
 	if err != nil {
 		return
 	}
 }
 
-// generateRequestID 生成请求ID
-func generateRequestID() string {
-	return time.Now().Format("20060102150405.000") + "-" + randomString(8)
-}
-
-// randomString 生成随机字符串
-func randomString(n int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[time.Now().UnixNano()%int64(len(letters))]
-	}
-	return string(b)
-}
-
 // convertToBidSlots 将流量请求的广告位转换为竞价请求的广告位
 func convertToBidSlots(slots []AdSlot) []bidding.AdSlot {
 	result := make([]bidding.AdSlot, len(slots))
@@ -366,6 +792,7 @@ func convertToBidSlots(slots []AdSlot) []bidding.AdSlot {
 			Height:   slot.Height,
 			MinPrice: slot.MinPrice,
 			MaxPrice: slot.MaxPrice,
+			Currency: slot.Currency,
 			Position: slot.Position,
 			AdType:   slot.AdType,
 		}
@@ -373,18 +800,123 @@ func convertToBidSlots(slots []AdSlot) []bidding.AdSlot {
 	return result
 }
 
-// convertToAdResults 将竞价响应转换为流量响应
-func convertToAdResults(resp *bidding.BidResponse) []AdResult {
-	if resp == nil {
-		return []AdResult{}
+// validCurrency 是否为三个字母的货币代码
+func validCurrency(currency string) bool {
+	if len(currency) != 3 {
+		return false
+	}
+	for _, c := range currency {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// convertToAdResults 将竞价响应转换为流量响应，并按交易平台的宏格式替换宏
+func convertToAdResults(resps []*bidding.BidResponse, profile *exchange.Profile) []AdResult {
+	results := make([]AdResult, 0, len(resps))
+	for _, resp := range resps {
+		results = append(results, AdResult{
+			SlotID:     resp.SlotID,
+			AdID:       resp.AdID,
+			BidPrice:   resp.BidPrice,
+			AdMarkup:   profile.ExpandMacros(resp.AdMarkup),
+			WinNotice:  profile.ExpandMacros(resp.WinNotice),
+			CreativeID: resp.CreativeID,
+		})
+	}
+	return results
+}
+
+// filterAdSlots 移除交易平台不允许的广告类型的广告位
+func filterAdSlots(req *Request, profile *exchange.Profile) {
+	slots := req.AdSlots[:0]
+	for _, slot := range req.AdSlots {
+		if profile.AllowsAdType(slot.AdType) {
+			slots = append(slots, slot)
+		}
+	}
+	req.AdSlots = slots
+}
+
+// rtaDecision RTA查询结果
+type rtaDecision struct {
+	targeted  bool                         // 是否还有可投放的推广计划
+	signal    *bidding.RTASignal           // 未绑定任务时RTA返回的出价信号
+	campaigns map[string]bidding.RTAResult // 绑定任务的推广计划的查询结果
+}
+
+// evaluateRTA 查询RTA定向结果
+// 未设置任务绑定时对所有请求查询RTA；设置后只查询启用策略的推广计划绑定的任务，没有绑定时不查询
+func (h *Handler) evaluateRTA(ctx context.Context, userID string) (*rtaDecision, error) {
+	if h.rtaTasks == nil {
+		start := time.Now()
+		resp, err := h.rtaClient.Evaluate(ctx, userID)
+		h.observeRTA(start, err)
+		if err != nil {
+			return nil, err
+		}
+		return &rtaDecision{targeted: resp.Participate, signal: rtaSignal(resp)}, nil
+	}
+
+	campaigns, err := h.biddingEngine.ActiveCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bindings := h.rtaTasks.Bindings(campaigns)
+	if len(bindings) == 0 {
+		return &rtaDecision{targeted: true}, nil
+	}
+
+	// 多个推广计划绑定同一任务时只查询一次
+	seen := make(map[string]bool, len(bindings))
+	tasks := make([]*rta.TaskConfig, 0, len(bindings))
+	for _, task := range bindings {
+		if !seen[task.TaskID] {
+			seen[task.TaskID] = true
+			tasks = append(tasks, task)
+		}
+	}
+	start := time.Now()
+	results, err := h.rtaClient.EvaluateTasks(ctx, userID, tasks)
+	h.observeRTA(start, err)
+	if err != nil {
+		return nil, err
+	}
+
+	// 有未绑定任务的推广计划时请求仍可参与竞价
+	decision := &rtaDecision{
+		targeted:  len(bindings) < len(campaigns),
+		campaigns: make(map[string]bidding.RTAResult, len(bindings)),
+	}
+	for campaignID, task := range bindings {
+		// 查询失败的任务按未定向处理
+		resp := results[task.TaskID]
+		result := bidding.RTAResult{Targeted: resp != nil && resp.Participate}
+		if result.Targeted {
+			result.Signal = rtaSignal(resp)
+			decision.targeted = true
+		}
+		decision.campaigns[campaignID] = result
+	}
+	return decision, nil
+}
+
+// observeRTA 将RTA查询的耗时和结果计入全局限流的下游健康评估
+func (h *Handler) observeRTA(start time.Time, err error) {
+	if h.limiter != nil {
+		h.limiter.Observe(DependencyRTA, time.Since(start), err)
+	}
+}
+
+// rtaSignal 提取RTA返回的出价信号，未返回时为nil
+func rtaSignal(resp *rta.RTAResponse) *bidding.RTASignal {
+	if resp.BaseBid <= 0 && resp.BidMultiplier <= 0 {
+		return nil
 	}
-	return []AdResult{
-		{
-			SlotID:    resp.SlotID,
-			AdID:      resp.AdID,
-			BidPrice:  resp.BidPrice,
-			AdMarkup:  resp.AdMarkup,
-			WinNotice: resp.WinNotice,
-		},
+	return &bidding.RTASignal{
+		BaseBid:       resp.BaseBid,
+		BidMultiplier: resp.BidMultiplier,
 	}
 }
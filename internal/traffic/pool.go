@@ -0,0 +1,62 @@
+package traffic
+
+import (
+	"bytes"
+	"sync"
+)
+
+// maxPooledBufferSize 超过该大小的缓冲区不放回池中，避免长期占用内存
+const maxPooledBufferSize = 64 << 10
+
+var (
+	// requestPool 流量请求对象池
+	requestPool = sync.Pool{
+		New: func() interface{} {
+			return &Request{
+				AdSlots: make([]AdSlot, 0, 4),
+			}
+		},
+	}
+
+	// bufferPool 响应编码缓冲区池
+	bufferPool = sync.Pool{
+		New: func() interface{} {
+			return bytes.NewBuffer(make([]byte, 0, 1024))
+		},
+	}
+)
+
+// acquireRequest 从池中获取请求对象
+func acquireRequest() *Request {
+	return requestPool.Get().(*Request)
+}
+
+// releaseRequest 重置请求对象并放回池中
+// 保留广告位切片和扩展参数的容量以便复用
+func releaseRequest(req *Request) {
+	adSlots := req.AdSlots[:0]
+	extraParams := req.ExtraParams
+	for k := range extraParams {
+		delete(extraParams, k)
+	}
+
+	*req = Request{
+		AdSlots:     adSlots,
+		ExtraParams: extraParams,
+	}
+	requestPool.Put(req)
+}
+
+// acquireBuffer 从池中获取缓冲区
+func acquireBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// releaseBuffer 归还缓冲区
+func releaseBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
@@ -0,0 +1,155 @@
+package trash
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	defaultPurgeInterval = time.Hour
+	purgeTimeout         = 5 * time.Minute
+
+	// purgeLockName 清理任务的分布式锁
+	purgeLockName = "trash:purge"
+)
+
+// Purger 回收站清理任务
+type Purger struct {
+	stores     map[string]Store
+	retention  time.Duration
+	interval   time.Duration
+	logger     *logger.Logger
+	locker     *lock.Locker
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewPurger 创建回收站清理任务
+func NewPurger(cfg config.TrashConfig, stores map[string]Store, logger *logger.Logger) *Purger {
+	if cfg.PurgeInterval <= 0 {
+		cfg.PurgeInterval = defaultPurgeInterval
+	}
+	return &Purger{
+		stores:    stores,
+		retention: time.Duration(cfg.RetentionDays) * 24 * time.Hour,
+		interval:  cfg.PurgeInterval,
+		logger:    logger,
+	}
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时清理
+func (p *Purger) SetLocker(locker *lock.Locker) {
+	p.locker = locker
+}
+
+// Store 获取指定资源类型的回收站
+func (p *Purger) Store(resource string) (Store, error) {
+	store, ok := p.stores[resource]
+	if !ok {
+		return nil, ErrUnknownResource
+	}
+	return store, nil
+}
+
+// Retention 返回保留期，为0表示不自动清理
+func (p *Purger) Retention() time.Duration {
+	return p.retention
+}
+
+// ListDeleted 列出已删除的资源并填充预计清理时间
+func (p *Purger) ListDeleted(ctx context.Context, resource string) ([]Item, error) {
+	store, err := p.Store(resource)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := store.ListDeleted(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if p.retention > 0 {
+		for i := range items {
+			purgeTime := items[i].DeleteTime.Add(p.retention)
+			items[i].PurgeTime = &purgeTime
+		}
+	}
+	return items, nil
+}
+
+// Start 启动后台清理，保留期为0时不启动
+func (p *Purger) Start() {
+	if p.retention <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancelFunc = cancel
+
+	p.wg.Add(1)
+	go p.purgeLoop(ctx)
+}
+
+// Stop 停止后台清理
+func (p *Purger) Stop() {
+	if p.cancelFunc == nil {
+		return
+	}
+	p.cancelFunc()
+	p.wg.Wait()
+}
+
+// PurgeExpired 彻底删除超过保留期的资源，返回各类资源的删除数量
+func (p *Purger) PurgeExpired(ctx context.Context) map[string]int {
+	before := time.Now().Add(-p.retention)
+
+	resources := make([]string, 0, len(p.stores))
+	for resource := range p.stores {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	purged := make(map[string]int, len(resources))
+	for _, resource := range resources {
+		n, err := p.stores[resource].Purge(ctx, before)
+		if err != nil {
+			p.logger.Error("清理回收站失败", "resource", resource, "error", err)
+		}
+		if n > 0 {
+			p.logger.Info("清理回收站", "resource", resource, "count", n)
+		}
+		purged[resource] = n
+	}
+	return purged
+}
+
+// purgeLoop 定时清理过期资源
+func (p *Purger) purgeLoop(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purgeCtx, cancel := context.WithTimeout(ctx, purgeTimeout)
+			err := p.locker.Do(purgeCtx, purgeLockName, func(ctx context.Context) error {
+				p.PurgeExpired(ctx)
+				return nil
+			})
+			if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+				p.logger.Error("回收站清理任务加锁失败", "error", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: trash.go
+ * Project: simple-dsp
+ * Description: 回收站，统一管理已软删除的广告、素材和广告计划
+ *
+ * 主要功能:
+ * - 定义各类资源回收站的统一接口
+ * - 列出已删除的资源并计算预计清理时间
+ * - 恢复已删除的资源
+ * - 后台任务按保留期彻底删除过期资源
+ *
+ * 实现细节:
+ * - 删除操作只标记删除时间，数据和存储文件在清理时才真正删除
+ * - 恢复后的资源处于暂停/停用状态，需要人工确认后重新启用
+ * - 各类资源分别清理，单类失败不影响其他资源
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 保留天数为0时不启动自动清理，只能手动清理
+ * - 清理不可逆，恢复只在保留期内有效
+ */
+
+package trash
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// 回收站资源类型
+const (
+	ResourceAds       = "ads"
+	ResourceCreatives = "creatives"
+	ResourceCampaigns = "campaigns"
+)
+
+var (
+	// ErrNotFound 表示资源不在回收站中
+	ErrNotFound = errors.New("资源不在回收站中")
+	// ErrUnknownResource 表示不支持的资源类型
+	ErrUnknownResource = errors.New("不支持的资源类型")
+)
+
+// Item 回收站中的资源
+type Item struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	DeleteTime time.Time `json:"delete_time"`
+	// PurgeTime 预计彻底删除的时间，未开启自动清理时为空
+	PurgeTime *time.Time `json:"purge_time,omitempty"`
+}
+
+// Store 一类资源的回收站
+type Store interface {
+	// ListDeleted 列出已删除的资源
+	ListDeleted(ctx context.Context) ([]Item, error)
+	// Restore 恢复已删除的资源，资源不在回收站中时返回ErrNotFound
+	Restore(ctx context.Context, id string) error
+	// Purge 彻底删除在before之前删除的资源，返回删除数量
+	Purge(ctx context.Context, before time.Time) (int, error)
+}
+
+// ItemField 读取回收站资源字段，用于列表排序和过滤
+func ItemField(item Item, field string) interface{} {
+	switch field {
+	case "id":
+		return item.ID
+	case "name":
+		return item.Name
+	case "delete_time":
+		return item.DeleteTime
+	}
+	return nil
+}
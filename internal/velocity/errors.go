@@ -0,0 +1,10 @@
+package velocity
+
+import "errors"
+
+var (
+	// ErrNotPaused 表示策略没有被消耗速度保护暂停
+	ErrNotPaused = errors.New("策略没有被消耗速度保护暂停")
+	// ErrInvalidStrategyID 表示无效的出价策略ID
+	ErrInvalidStrategyID = errors.New("无效的出价策略ID")
+)
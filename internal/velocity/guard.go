@@ -0,0 +1,488 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: guard.go
+ * Project: simple-dsp
+ * Description: 消耗速度保护，出价策略花费过快时自动暂停，防止出价配置错误、匀速失效或作弊流量耗尽预算
+ *
+ * 主要功能:
+ * - 定时读取出价策略日预算在当前周期的花费，计算每分钟的花费
+ * - 每分钟花费超过按日预算匀速消耗的倍数时暂停出价策略
+ * - 暂停时记录日志、审计日志和指标，并通过Webhook发送异常通知
+ * - 列出被暂停的策略，人工确认后恢复
+ *
+ * 实现细节:
+ * - 每次检查的花费样本保存在Redis中，按相邻两次样本的差值计算消耗速度，主实例切换后继续使用已有样本
+ * - 匀速消耗为日预算除以续期周期的分钟数
+ * - 样本不在同一续期周期时只记录样本，不计算消耗速度
+ * - 暂停和恢复后发布策略变更通知，竞价节点立即刷新策略缓存
+ * - 恢复后在宽限期内不再检查该策略，并丢弃恢复前的样本
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/internal/audit
+ * - simple-dsp/internal/bidding
+ * - simple-dsp/internal/budget
+ * - simple-dsp/internal/webhook
+ * - simple-dsp/pkg/clock
+ * - simple-dsp/pkg/lock
+ *
+ * 注意事项:
+ * - 被暂停的策略只能通过Resume恢复，直接修改策略状态不会清除暂停记录
+ * - 分时投放的策略在投放时段内的消耗速度高于全天匀速，应按投放时段调大倍数
+ * - 多实例部署时只应在选主的主实例上运行，多个实例交替检查时相邻样本的间隔过短，消耗速度失真
+ */
+
+package velocity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/internal/audit"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/budget"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	defaultInterval    = time.Minute
+	defaultMultiplier  = 5
+	defaultMinSpend    = 1
+	defaultResumeGrace = 30 * time.Minute
+	checkTimeout       = 30 * time.Second
+
+	// checkLockName 定时检查的分布式锁
+	checkLockName = "velocity:check"
+
+	// samplesKey 各策略最近一次花费样本的哈希
+	samplesKey = "velocity:samples"
+	// samplesTTL 样本的保留时间，停止检查后自动清理
+	samplesTTL = 24 * time.Hour
+	// pausedKey 被暂停策略的哈希，值为Trip
+	pausedKey = "velocity:paused"
+	// graceKeyPrefix 人工恢复后的宽限期标记
+	graceKeyPrefix = "velocity:grace:"
+
+	// operator 审计日志中自动暂停的操作人
+	operator = "velocity_guard"
+	// 审计日志和策略变更通知中的动作
+	actionPause  = "velocity_pause"
+	actionResume = "velocity_resume"
+)
+
+// 检查结果标签
+const (
+	resultOK     = "ok"
+	resultPaused = "paused"
+	resultGrace  = "grace"
+	resultFailed = "failed"
+)
+
+// SpendSource 出价策略日预算在当前周期的花费
+type SpendSource interface {
+	DailySpends(ctx context.Context) ([]budget.DailySpend, error)
+}
+
+// Trip 一次因消耗速度异常的自动暂停
+type Trip struct {
+	StrategyID string `json:"strategy_id"`
+	CampaignID string `json:"campaign_id,omitempty"`
+	// SpendPerMinute 触发时每分钟的花费
+	SpendPerMinute float64 `json:"spend_per_minute"`
+	// ExpectedPerMinute 按日预算匀速消耗时每分钟的花费
+	ExpectedPerMinute float64 `json:"expected_per_minute"`
+	// Multiplier 触发暂停的倍数
+	Multiplier float64 `json:"multiplier"`
+	// DailyBudget、Spent 触发时的日预算和当前周期的花费
+	DailyBudget float64   `json:"daily_budget"`
+	Spent       float64   `json:"spent"`
+	PausedAt    time.Time `json:"paused_at"`
+}
+
+// sample 一次检查时策略的花费
+type sample struct {
+	// PeriodStart 续期周期的开始时间(Unix秒)
+	PeriodStart int64   `json:"p"`
+	Spent       float64 `json:"s"`
+	// At 采样时间(Unix毫秒)
+	At int64 `json:"t"`
+}
+
+// Guard 消耗速度保护
+type Guard struct {
+	cfg        config.VelocityConfig
+	spends     SpendSource
+	strategies bidding.Repository
+	redis      *redis.Client
+	recorder   *audit.Recorder
+	notifier   webhook.Notifier
+	locker     *lock.Locker
+	logger     *logger.Logger
+	metrics    *metrics.Metrics
+	// clock 采样和暂停时间的时间来源
+	clock clock.Clock
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewGuard 创建消耗速度保护，未设置的参数使用默认值
+// spends为nil时只用于查询和恢复被暂停的策略，不检查消耗速度
+func NewGuard(cfg config.VelocityConfig, spends SpendSource, strategies bidding.Repository, redisClient *redis.Client, logger *logger.Logger, metrics *metrics.Metrics) *Guard {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultInterval
+	}
+	if cfg.Multiplier <= 0 {
+		cfg.Multiplier = defaultMultiplier
+	}
+	if cfg.MinSpend <= 0 {
+		cfg.MinSpend = defaultMinSpend
+	}
+	if cfg.ResumeGrace <= 0 {
+		cfg.ResumeGrace = defaultResumeGrace
+	}
+	return &Guard{
+		cfg:        cfg,
+		spends:     spends,
+		strategies: strategies,
+		redis:      redisClient,
+		logger:     logger,
+		metrics:    metrics,
+		clock:      clock.Real(),
+	}
+}
+
+// SetAuditRecorder 设置审计日志，设置后暂停和恢复策略时写入审计记录
+func (g *Guard) SetAuditRecorder(recorder *audit.Recorder) {
+	g.recorder = recorder
+}
+
+// SetNotifier 设置事件通知，设置后暂停策略时发送异常通知
+func (g *Guard) SetNotifier(notifier webhook.Notifier) {
+	g.notifier = notifier
+}
+
+// SetLocker 设置分布式锁，设置后多个实例中只有持有锁的实例执行定时检查
+func (g *Guard) SetLocker(locker *lock.Locker) {
+	g.locker = locker
+}
+
+// SetClock 设置采样和暂停时间的时间来源，为nil时使用系统时钟
+func (g *Guard) SetClock(c clock.Clock) {
+	g.clock = clock.OrReal(c)
+}
+
+// Start 启动定时检查
+func (g *Guard) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	g.cancelFunc = cancel
+
+	g.wg.Add(1)
+	go g.runLoop(ctx)
+}
+
+// Stop 停止定时检查
+func (g *Guard) Stop() {
+	if g.cancelFunc == nil {
+		return
+	}
+	g.cancelFunc()
+	g.wg.Wait()
+}
+
+// RunOnce 检查所有出价策略的消耗速度，返回本次暂停的策略
+func (g *Guard) RunOnce(ctx context.Context) ([]Trip, error) {
+	if g.spends == nil {
+		return nil, nil
+	}
+	spends, err := g.spends.DailySpends(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("读取预算花费失败: %w", err)
+	}
+	previous, err := g.loadSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := g.clock.Now()
+	samples := make(map[string]interface{}, len(spends))
+	var trips []Trip
+	for _, spend := range spends {
+		current := sample{PeriodStart: spend.StartTime.Unix(), Spent: spend.Spent, At: now.UnixMilli()}
+		data, _ := json.Marshal(current)
+		samples[spend.BudgetID] = data
+		last := previous[spend.BudgetID]
+		delete(previous, spend.BudgetID)
+
+		rate, expected, exceeded := g.exceeded(spend, current, last)
+		if !exceeded {
+			g.metrics.Budget.VelocityChecks.WithLabelValues(resultOK).Inc()
+			continue
+		}
+		trip, result := g.trip(ctx, spend, rate, expected, now)
+		g.metrics.Budget.VelocityChecks.WithLabelValues(result).Inc()
+		if trip != nil {
+			trips = append(trips, *trip)
+		}
+	}
+
+	if err := g.saveSamples(ctx, samples, previous); err != nil {
+		return trips, err
+	}
+	return trips, nil
+}
+
+// exceeded 按上一次样本计算每分钟的花费，判断是否超过匀速消耗的倍数
+// 没有上一次样本、不在同一周期或花费增量低于MinSpend时不判断
+func (g *Guard) exceeded(spend budget.DailySpend, current sample, previous *sample) (rate, expected float64, exceeded bool) {
+	if previous == nil || previous.PeriodStart != current.PeriodStart || spend.Amount <= 0 {
+		return 0, 0, false
+	}
+	minutes := float64(current.At-previous.At) / float64(time.Minute/time.Millisecond)
+	period := spend.EndTime.Sub(spend.StartTime).Minutes()
+	delta := current.Spent - previous.Spent
+	if minutes <= 0 || period <= 0 || delta < g.cfg.MinSpend {
+		return 0, 0, false
+	}
+
+	rate = delta / minutes
+	expected = spend.Amount / period
+	return rate, expected, rate > expected*g.cfg.Multiplier
+}
+
+// trip 暂停消耗速度异常的策略，返回暂停记录和检查结果标签，宽限期内或策略已不在投放中时不暂停
+func (g *Guard) trip(ctx context.Context, spend budget.DailySpend, rate, expected float64, now time.Time) (*Trip, string) {
+	log := g.logger.With("strategy_id", spend.BudgetID)
+	inGrace, err := g.redis.Exists(ctx, graceKeyPrefix+spend.BudgetID).Result()
+	if err != nil {
+		log.Error("读取恢复宽限期失败", "error", err)
+		return nil, resultFailed
+	}
+	if inGrace > 0 {
+		return nil, resultGrace
+	}
+
+	id, err := strconv.ParseInt(spend.BudgetID, 10, 64)
+	if err != nil {
+		log.Error("无效的出价策略ID", "error", err)
+		return nil, resultFailed
+	}
+	strategy, err := g.strategies.GetBidStrategy(ctx, id)
+	if err != nil {
+		log.Error("查询出价策略失败", "error", err)
+		return nil, resultFailed
+	}
+	// 已被暂停或归档的策略在缓存刷新前仍可能有花费
+	if strategy == nil || strategy.Status != bidding.StrategyStatusEnabled {
+		return nil, resultOK
+	}
+	if err := g.strategies.UpdateBidStrategyStatus(ctx, id, bidding.StrategyStatusDisabled); err != nil {
+		log.Error("暂停消耗速度异常的出价策略失败", "error", err)
+		return nil, resultFailed
+	}
+
+	trip := &Trip{
+		StrategyID:        spend.BudgetID,
+		CampaignID:        strategy.CampaignID,
+		SpendPerMinute:    rate,
+		ExpectedPerMinute: expected,
+		Multiplier:        g.cfg.Multiplier,
+		DailyBudget:       spend.Amount,
+		Spent:             spend.Spent,
+		PausedAt:          now,
+	}
+	log.Error("出价策略消耗速度异常，已自动暂停",
+		"campaign_id", trip.CampaignID,
+		"spend_per_minute", rate,
+		"expected_per_minute", expected,
+		"multiplier", g.cfg.Multiplier,
+		"spent", spend.Spent,
+		"daily_budget", spend.Amount)
+
+	// 策略已暂停，以下步骤失败只记录日志
+	data, _ := json.Marshal(trip)
+	if err := g.redis.HSet(ctx, pausedKey, spend.BudgetID, data).Err(); err != nil {
+		log.Error("保存暂停记录失败", "error", err)
+	}
+	if err := bidding.PublishStrategyChange(ctx, g.redis, spend.BudgetID, actionPause); err != nil {
+		log.Warn("发布策略变更通知失败", "error", err)
+	}
+	g.audit(ctx, operator, actionPause, spend.BudgetID,
+		map[string]interface{}{"status": bidding.StrategyStatusEnabled},
+		map[string]interface{}{"status": bidding.StrategyStatusDisabled, "trip": trip})
+	if g.notifier != nil {
+		g.notifier.Notify(ctx, webhook.EventAnomalyDetected, map[string]interface{}{
+			"type":                "spend_velocity",
+			"action":              "paused",
+			"strategy_id":         trip.StrategyID,
+			"campaign_id":         trip.CampaignID,
+			"spend_per_minute":    trip.SpendPerMinute,
+			"expected_per_minute": trip.ExpectedPerMinute,
+			"multiplier":          trip.Multiplier,
+			"spent":               trip.Spent,
+			"daily_budget":        trip.DailyBudget,
+		})
+	}
+	return trip, resultPaused
+}
+
+// Paused 列出被自动暂停且尚未恢复的策略，按暂停时间倒序
+func (g *Guard) Paused(ctx context.Context) ([]Trip, error) {
+	values, err := g.redis.HGetAll(ctx, pausedKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取暂停记录失败: %w", err)
+	}
+	trips := make([]Trip, 0, len(values))
+	for id, value := range values {
+		var trip Trip
+		if err := json.Unmarshal([]byte(value), &trip); err != nil {
+			g.logger.Warn("解析暂停记录失败", "strategy_id", id, "error", err)
+			continue
+		}
+		trips = append(trips, trip)
+	}
+	sort.Slice(trips, func(i, j int) bool { return trips[i].PausedAt.After(trips[j].PausedAt) })
+	return trips, nil
+}
+
+// Resume 恢复被自动暂停的策略，恢复后在宽限期内不再检查
+// 策略没有被自动暂停时返回ErrNotPaused；策略已被删除或归档时只清除暂停记录
+func (g *Guard) Resume(ctx context.Context, strategyID, by string) (*Trip, error) {
+	value, err := g.redis.HGet(ctx, pausedKey, strategyID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotPaused
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取暂停记录失败: %w", err)
+	}
+	var trip Trip
+	if err := json.Unmarshal([]byte(value), &trip); err != nil {
+		return nil, fmt.Errorf("解析暂停记录失败: %w", err)
+	}
+
+	id, err := strconv.ParseInt(strategyID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidStrategyID, strategyID)
+	}
+	strategy, err := g.strategies.GetBidStrategy(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 先设置宽限期，避免恢复后立即被再次暂停
+	pipe := g.redis.TxPipeline()
+	pipe.Set(ctx, graceKeyPrefix+strategyID, by, g.cfg.ResumeGrace)
+	pipe.HDel(ctx, samplesKey, strategyID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("设置恢复宽限期失败: %w", err)
+	}
+	if strategy != nil && strategy.Status == bidding.StrategyStatusDisabled {
+		if err := g.strategies.UpdateBidStrategyStatus(ctx, id, bidding.StrategyStatusEnabled); err != nil {
+			return nil, err
+		}
+		if err := bidding.PublishStrategyChange(ctx, g.redis, strategyID, actionResume); err != nil {
+			g.logger.Warn("发布策略变更通知失败", "strategy_id", strategyID, "error", err)
+		}
+		g.audit(ctx, by, actionResume, strategyID,
+			map[string]interface{}{"status": bidding.StrategyStatusDisabled},
+			map[string]interface{}{"status": bidding.StrategyStatusEnabled})
+	}
+	if err := g.redis.HDel(ctx, pausedKey, strategyID).Err(); err != nil {
+		return nil, fmt.Errorf("清除暂停记录失败: %w", err)
+	}
+	return &trip, nil
+}
+
+// audit 写入审计日志，失败只记录日志
+func (g *Guard) audit(ctx context.Context, by, action, strategyID string, before, after interface{}) {
+	if g.recorder == nil {
+		return
+	}
+	err := g.recorder.Record(ctx, audit.Entry{
+		Operator:     by,
+		Action:       action,
+		ResourceType: audit.ResourceStrategy,
+		ResourceID:   strategyID,
+		Before:       before,
+		After:        after,
+	})
+	if err != nil {
+		g.logger.Error("写入审计日志失败", "strategy_id", strategyID, "action", action, "error", err)
+	}
+}
+
+// loadSamples 读取各策略最近一次的花费样本
+func (g *Guard) loadSamples(ctx context.Context) (map[string]*sample, error) {
+	values, err := g.redis.HGetAll(ctx, samplesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取花费样本失败: %w", err)
+	}
+	samples := make(map[string]*sample, len(values))
+	for id, value := range values {
+		var s sample
+		if err := json.Unmarshal([]byte(value), &s); err != nil {
+			continue
+		}
+		samples[id] = &s
+	}
+	return samples, nil
+}
+
+// saveSamples 保存本次的花费样本，删除已不在预算中的策略的样本
+func (g *Guard) saveSamples(ctx context.Context, samples map[string]interface{}, stale map[string]*sample) error {
+	pipe := g.redis.TxPipeline()
+	if len(samples) > 0 {
+		pipe.HSet(ctx, samplesKey, samples)
+	}
+	if len(stale) > 0 {
+		fields := make([]string, 0, len(stale))
+		for id := range stale {
+			fields = append(fields, id)
+		}
+		pipe.HDel(ctx, samplesKey, fields...)
+	}
+	pipe.Expire(ctx, samplesKey, samplesTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("保存花费样本失败: %w", err)
+	}
+	return nil
+}
+
+// runLoop 定时检查消耗速度
+func (g *Guard) runLoop(ctx context.Context) {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			err := g.locker.Do(runCtx, checkLockName, func(ctx context.Context) error {
+				_, err := g.RunOnce(ctx)
+				return err
+			})
+			if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+				g.logger.Error("检查消耗速度失败", "error", err)
+			}
+			cancel()
+		}
+	}
+}
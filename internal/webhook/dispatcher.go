@@ -0,0 +1,232 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/retry"
+)
+
+const (
+	defaultWorkers      = 4
+	defaultQueueSize    = 1000
+	defaultTimeout      = 5 * time.Second
+	defaultRetryBackoff = time.Second
+
+	// maxErrorBody 记录失败响应体的最大字节数
+	maxErrorBody = 512
+	// recordTimeout 写入投递记录的超时时间，不受投递上下文取消的影响
+	recordTimeout = 3 * time.Second
+)
+
+// Dispatcher 事件投递器，实现Notifier接口
+type Dispatcher struct {
+	config     config.WebhookConfig
+	store      Store
+	client     *http.Client
+	logger     *logger.Logger
+	queue      chan *Event
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewDispatcher 创建事件投递器
+func NewDispatcher(cfg config.WebhookConfig, store Store, logger *logger.Logger) *Dispatcher {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	return &Dispatcher{
+		config: cfg,
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		logger: logger,
+		queue:  make(chan *Event, cfg.QueueSize),
+	}
+}
+
+// Start 启动投递worker
+func (d *Dispatcher) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancelFunc = cancel
+
+	for i := 0; i < d.config.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker(ctx)
+	}
+}
+
+// Stop 停止投递，正在重试的投递会被中断
+func (d *Dispatcher) Stop() {
+	if d.cancelFunc == nil {
+		return
+	}
+	d.cancelFunc()
+	d.wg.Wait()
+
+	if n := len(d.queue); n > 0 {
+		d.logger.Warn("停止时仍有未投递的Webhook事件", "count", n)
+	}
+}
+
+// Notify 发布事件，队列已满时丢弃事件
+func (d *Dispatcher) Notify(ctx context.Context, eventType EventType, data interface{}) {
+	event := NewEvent(eventType, data)
+	select {
+	case d.queue <- event:
+	default:
+		d.logger.Error("Webhook事件队列已满，丢弃事件", "event_id", event.ID, "event_type", eventType)
+	}
+}
+
+// Deliver 将事件投递到指定订阅，失败时按配置重试，返回最后一次尝试的记录
+func (d *Dispatcher) Deliver(ctx context.Context, sub *Subscription, event *Event) (*models.WebhookDelivery, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("序列化Webhook事件失败: %w", err)
+	}
+
+	var delivery *models.WebhookDelivery
+	attempt := 0
+	policy := retry.Policy{MaxRetries: d.config.MaxRetries, InitialBackoff: d.config.RetryBackoff}
+	err = retry.Do(ctx, policy, func(ctx context.Context) error {
+		attempt++
+		var retryable bool
+		delivery, retryable = d.attempt(ctx, sub, event, body, attempt)
+
+		recordCtx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+		if err := d.store.RecordDelivery(recordCtx, delivery); err != nil {
+			d.logger.Error("写入Webhook投递记录失败", "subscription_id", sub.ID, "event_id", event.ID, "error", err)
+		}
+		cancel()
+
+		if delivery.Success {
+			return nil
+		}
+		err := fmt.Errorf("%w: %s", ErrDeliveryFailed, delivery.Error)
+		if !retryable {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+	return delivery, err
+}
+
+// worker 从队列中取出事件并投递
+func (d *Dispatcher) worker(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-d.queue:
+			d.dispatch(ctx, event)
+		}
+	}
+}
+
+// dispatch 将事件投递给所有订阅了该事件的订阅
+func (d *Dispatcher) dispatch(ctx context.Context, event *Event) {
+	subs, err := d.store.ListEnabled(ctx)
+	if err != nil {
+		d.logger.Error("加载Webhook订阅失败", "event_id", event.ID, "error", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if !sub.Subscribes(event.Type) {
+			continue
+		}
+		if _, err := d.Deliver(ctx, sub, event); err != nil {
+			d.logger.Warn("Webhook投递失败", "subscription_id", sub.ID, "event_id", event.ID,
+				"event_type", event.Type, "error", err)
+		}
+	}
+}
+
+// attempt 执行一次投递，返回投递记录和失败时是否可重试
+func (d *Dispatcher) attempt(ctx context.Context, sub *Subscription, event *Event, body []byte, attempt int) (*models.WebhookDelivery, bool) {
+	delivery := &models.WebhookDelivery{
+		SubscriptionID: sub.ID,
+		EventID:        event.ID,
+		EventType:      string(event.Type),
+		Attempt:        attempt,
+		Payload:        body,
+		CreateTime:     time.Now(),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, false
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "simple-dsp-webhook/1.0")
+	req.Header.Set(HeaderEvent, string(event.Type))
+	req.Header.Set(HeaderDelivery, event.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, timestamp, body))
+
+	start := time.Now()
+	resp, err := d.client.Do(req)
+	delivery.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery, true
+	}
+	defer resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		delivery.Success = true
+		io.Copy(io.Discard, resp.Body)
+		return delivery, false
+	}
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	delivery.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, respBody)
+	return delivery, isRetryableStatus(resp.StatusCode)
+}
+
+// isRetryableStatus 判断响应状态码是否可重试
+func isRetryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+}
+
+// NewEvent 创建事件
+func NewEvent(eventType EventType, data interface{}) *Event {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &Event{
+		ID:   fmt.Sprintf("evt-%d-%s", time.Now().Unix(), hex.EncodeToString(b)),
+		Type: eventType,
+		Time: time.Now(),
+		Data: data,
+	}
+}
@@ -0,0 +1,20 @@
+package webhook
+
+import "errors"
+
+var (
+	// ErrNameRequired 表示订阅名称为空
+	ErrNameRequired = errors.New("订阅名称不能为空")
+
+	// ErrInvalidURL 表示回调地址无效
+	ErrInvalidURL = errors.New("回调地址必须是有效的http或https地址")
+
+	// ErrNoEvents 表示未指定订阅事件
+	ErrNoEvents = errors.New("至少需要订阅一个事件类型")
+
+	// ErrUnknownEvent 表示不支持的事件类型
+	ErrUnknownEvent = errors.New("不支持的事件类型")
+
+	// ErrDeliveryFailed 表示投递最终失败
+	ErrDeliveryFailed = errors.New("Webhook投递失败")
+)
@@ -0,0 +1,50 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// 请求头
+const (
+	HeaderEvent     = "X-DSP-Event"
+	HeaderDelivery  = "X-DSP-Delivery"
+	HeaderTimestamp = "X-DSP-Timestamp"
+	HeaderSignature = "X-DSP-Signature"
+)
+
+// signaturePrefix 签名值前缀，标明签名算法
+const signaturePrefix = "sha256="
+
+// Sign 计算请求签名，签名内容为"{timestamp}.{body}"
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify 校验请求签名，tolerance大于0时拒绝时间戳偏差超过该值的请求以防重放
+func Verify(secret string, timestamp int64, body []byte, signature string, tolerance time.Duration) bool {
+	if tolerance > 0 {
+		skew := time.Since(time.Unix(timestamp, 0))
+		if skew > tolerance || skew < -tolerance {
+			return false
+		}
+	}
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// NewSecret 生成签名密钥
+func NewSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,55 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/database"
+)
+
+// Store 投递所需的订阅查询和投递记录存储
+type Store interface {
+	// ListEnabled 列出已启用的订阅
+	ListEnabled(ctx context.Context) ([]*Subscription, error)
+	// RecordDelivery 写入投递记录
+	RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+}
+
+// GormStore 基于数据库的存储
+type GormStore struct {
+	db *gorm.DB
+}
+
+// NewGormStore 创建基于数据库的存储
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+// ListEnabled 列出已启用的订阅
+func (s *GormStore) ListEnabled(ctx context.Context) ([]*Subscription, error) {
+	var records []models.WebhookSubscription
+	if err := s.db.WithContext(database.WithQueryName(ctx, "webhook.list_enabled")).Where("enabled = ?", true).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询Webhook订阅失败: %w", err)
+	}
+
+	subs := make([]*Subscription, 0, len(records))
+	for i := range records {
+		sub, err := FromModel(&records[i])
+		if err != nil {
+			return nil, fmt.Errorf("解析Webhook订阅%s失败: %w", records[i].ID, err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+// RecordDelivery 写入投递记录
+func (s *GormStore) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if err := s.db.WithContext(database.WithQueryName(ctx, "webhook.record_delivery")).Create(delivery).Error; err != nil {
+		return fmt.Errorf("写入Webhook投递记录失败: %w", err)
+	}
+	return nil
+}
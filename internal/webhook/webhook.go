@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: webhook.go
+ * Project: simple-dsp
+ * Description: 系统通知Webhook，将预算、计划、素材等系统事件推送给管理员登记的地址
+ *
+ * 主要功能:
+ * - 管理Webhook订阅，按事件类型订阅
+ * - 异步投递事件，失败按指数退避重试
+ * - 使用HMAC-SHA256对请求签名，接收方可校验来源和防重放
+ * - 记录每次投递尝试，供管理后台查询
+ *
+ * 实现细节:
+ * - 业务模块通过Notifier接口发布事件，发布不阻塞调用方
+ * - 事件进入有界队列，由固定数量的worker投递，队列满时丢弃并记录日志
+ * - 签名内容为"{timestamp}.{body}"，通过X-DSP-Signature请求头传递
+ * - 网络错误、408、429和5xx响应会重试，其他4xx视为永久失败
+ *
+ * 依赖关系:
+ * - gorm.io/gorm
+ * - simple-dsp/internal/models
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 投递至少一次，接收方应按X-DSP-Delivery去重
+ * - 服务停止时队列中未投递的事件会丢失
+ */
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"simple-dsp/internal/models"
+)
+
+// EventType 事件类型
+type EventType string
+
+const (
+	// EventBudgetExhausted 预算耗尽
+	EventBudgetExhausted EventType = "budget.exhausted"
+	// EventCampaignPaused 广告计划被暂停
+	EventCampaignPaused EventType = "campaign.paused"
+	// EventCreativeRejected 素材审核被拒绝
+	EventCreativeRejected EventType = "creative.rejected"
+	// EventAnomalyDetected 检测到异常，如消耗速度异常
+	EventAnomalyDetected EventType = "anomaly.detected"
+	// EventCreativeFatigued 素材CTR持续下降，已降低素材的轮换权重或暂停该素材
+	EventCreativeFatigued EventType = "creative.fatigued"
+	// EventPing 测试事件，只在手动测试订阅时发送
+	EventPing EventType = "ping"
+)
+
+// EventTypes 可订阅的事件类型
+var EventTypes = []EventType{
+	EventBudgetExhausted,
+	EventCampaignPaused,
+	EventCreativeRejected,
+	EventAnomalyDetected,
+	EventCreativeFatigued,
+}
+
+// Event 系统事件，作为请求体发送
+type Event struct {
+	ID   string      `json:"id"`
+	Type EventType   `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Notifier 事件发布接口，由业务模块持有
+type Notifier interface {
+	Notify(ctx context.Context, eventType EventType, data interface{})
+}
+
+// Subscription Webhook订阅
+type Subscription struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Secret 签名密钥，只在创建时返回
+	Secret     string      `json:"secret,omitempty"`
+	Events     []EventType `json:"events"`
+	Enabled    bool        `json:"enabled"`
+	CreateTime time.Time   `json:"create_time"`
+	UpdateTime time.Time   `json:"update_time"`
+}
+
+// Subscribes 判断是否订阅了指定事件
+func (s *Subscription) Subscribes(eventType EventType) bool {
+	for _, t := range s.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 校验订阅
+func (s *Subscription) Validate() error {
+	if s.Name == "" {
+		return ErrNameRequired
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+
+	if len(s.Events) == 0 {
+		return ErrNoEvents
+	}
+	for _, t := range s.Events {
+		if !isKnownEvent(t) {
+			return fmt.Errorf("%w: %s", ErrUnknownEvent, t)
+		}
+	}
+	return nil
+}
+
+// ToModel 转换为数据库模型
+func (s *Subscription) ToModel() (*models.WebhookSubscription, error) {
+	events, err := json.Marshal(s.Events)
+	if err != nil {
+		return nil, err
+	}
+	return &models.WebhookSubscription{
+		ID:         s.ID,
+		Name:       s.Name,
+		URL:        s.URL,
+		Secret:     s.Secret,
+		Events:     events,
+		Enabled:    s.Enabled,
+		UpdateTime: s.UpdateTime,
+		CreateTime: s.CreateTime,
+	}, nil
+}
+
+// FromModel 从数据库模型转换
+func FromModel(m *models.WebhookSubscription) (*Subscription, error) {
+	s := &Subscription{
+		ID:         m.ID,
+		Name:       m.Name,
+		URL:        m.URL,
+		Secret:     m.Secret,
+		Enabled:    m.Enabled,
+		UpdateTime: m.UpdateTime,
+		CreateTime: m.CreateTime,
+	}
+	if !m.Events.IsNull() {
+		if err := json.Unmarshal(m.Events, &s.Events); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// isKnownEvent 判断是否为可订阅的事件类型
+func isKnownEvent(eventType EventType) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,4 @@
+ALTER TABLE bid_strategies
+    DROP INDEX idx_priority,
+    DROP COLUMN weight,
+    DROP COLUMN priority;
@@ -0,0 +1,4 @@
+ALTER TABLE bid_strategies
+    ADD COLUMN priority TINYINT NOT NULL DEFAULT 0 COMMENT '优先级：0-公开竞价，1-优先交易，2-保量投放' AFTER is_price_locked,
+    ADD COLUMN weight DECIMAL(6,3) NOT NULL DEFAULT 1.000 COMMENT '投放权重，同优先级内与eCPM相乘' AFTER priority,
+    ADD INDEX idx_priority (priority);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    operator VARCHAR(64) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    resource_type VARCHAR(32) NOT NULL,
+    resource_id VARCHAR(64) NOT NULL,
+    batch_id VARCHAR(64),
+    before_data JSONB,
+    after_data JSONB,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_audit_logs_resource ON audit_logs(resource_type, resource_id);
+CREATE INDEX idx_audit_logs_batch ON audit_logs(batch_id);
+CREATE INDEX idx_audit_logs_time ON audit_logs(create_time);
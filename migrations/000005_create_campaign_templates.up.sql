@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS campaign_templates (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    advertiser_id VARCHAR(64) NOT NULL DEFAULT '',
+    budget DECIMAL(20,4) NOT NULL,
+    bid_strategy VARCHAR(32) NOT NULL,
+    targeting JSONB,
+    tracking_configs JSONB,
+    update_time TIMESTAMP NOT NULL,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_campaign_templates_name ON campaign_templates(advertiser_id, name);
+CREATE INDEX idx_campaign_templates_advertiser ON campaign_templates(advertiser_id);
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    events JSONB NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    update_time TIMESTAMP NOT NULL,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    subscription_id VARCHAR(64) NOT NULL,
+    event_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    success BOOLEAN NOT NULL,
+    error TEXT,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    payload JSONB,
+    create_time TIMESTAMP NOT NULL,
+
+    CONSTRAINT fk_webhook_deliveries_subscription FOREIGN KEY (subscription_id)
+        REFERENCES webhook_subscriptions (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, create_time);
+CREATE INDEX idx_webhook_deliveries_event ON webhook_deliveries(event_id);
@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategies
+    ADD COLUMN category VARCHAR(64) NOT NULL DEFAULT '' COMMENT '投放类目，用于按类目统计用户特征' AFTER weight;
@@ -0,0 +1,3 @@
+ALTER TABLE bid_strategies
+    DROP INDEX idx_campaign_id,
+    DROP COLUMN campaign_id;
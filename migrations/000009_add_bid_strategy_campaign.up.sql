@@ -0,0 +1,3 @@
+ALTER TABLE bid_strategies
+    ADD COLUMN campaign_id VARCHAR(64) NOT NULL DEFAULT '' COMMENT '所属推广计划，竞价时按计划限制QPS' AFTER category,
+    ADD INDEX idx_campaign_id (campaign_id);
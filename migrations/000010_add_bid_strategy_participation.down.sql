@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategies
+    DROP COLUMN participation_rate;
@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategies
+    ADD COLUMN participation_rate DECIMAL(5,4) NOT NULL DEFAULT 1 COMMENT '参与竞价的请求比例，按请求ID哈希抽样' AFTER campaign_id;
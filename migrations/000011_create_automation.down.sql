@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS automation_actions;
+DROP TABLE IF EXISTS automation_rules;
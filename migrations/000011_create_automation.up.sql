@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS automation_rules (
+    id VARCHAR(64) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    strategy_ids JSONB NOT NULL,
+    conditions JSONB NOT NULL,
+    action JSONB NOT NULL,
+    window_hours INT NOT NULL,
+    min_impressions BIGINT NOT NULL DEFAULT 0,
+    cooldown_minutes INT NOT NULL DEFAULT 0,
+    dry_run BOOLEAN NOT NULL DEFAULT TRUE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    update_time TIMESTAMP NOT NULL,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS automation_actions (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id VARCHAR(64) NOT NULL,
+    strategy_id VARCHAR(64) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    reason TEXT,
+    metrics JSONB,
+    before_price DECIMAL(10,4) NOT NULL DEFAULT 0,
+    after_price DECIMAL(10,4) NOT NULL DEFAULT 0,
+    create_time TIMESTAMP NOT NULL,
+
+    CONSTRAINT fk_automation_actions_rule FOREIGN KEY (rule_id)
+        REFERENCES automation_rules (id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_automation_actions_rule ON automation_actions(rule_id, create_time);
+CREATE INDEX idx_automation_actions_strategy ON automation_actions(strategy_id, create_time);
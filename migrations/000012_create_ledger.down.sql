@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS ledger_daily_balances;
+DROP TRIGGER IF EXISTS trg_ledger_entries_append_only ON ledger_entries;
+DROP FUNCTION IF EXISTS ledger_entries_append_only();
+DROP TABLE IF EXISTS ledger_entries;
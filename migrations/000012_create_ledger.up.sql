@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    advertiser_id VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL,
+    amount BIGINT NOT NULL,
+    idempotency_key VARCHAR(255) NOT NULL,
+    campaign_id VARCHAR(64),
+    ad_id VARCHAR(64),
+    reference VARCHAR(255),
+    description TEXT,
+    operator VARCHAR(64),
+    occur_time TIMESTAMP NOT NULL,
+    create_time TIMESTAMP NOT NULL,
+
+    CONSTRAINT uk_ledger_entries_idempotency UNIQUE (idempotency_key)
+);
+
+CREATE INDEX idx_ledger_entries_advertiser ON ledger_entries(advertiser_id, create_time);
+CREATE INDEX idx_ledger_entries_time ON ledger_entries(create_time);
+
+-- 流水只追加，更正通过adjustment流水完成
+CREATE OR REPLACE FUNCTION ledger_entries_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger_entries is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_ledger_entries_append_only
+    BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_entries_append_only();
+
+CREATE TABLE IF NOT EXISTS ledger_daily_balances (
+    advertiser_id VARCHAR(64) NOT NULL,
+    date DATE NOT NULL,
+    opening BIGINT NOT NULL DEFAULT 0,
+    spend BIGINT NOT NULL DEFAULT 0,
+    refund BIGINT NOT NULL DEFAULT 0,
+    adjustment BIGINT NOT NULL DEFAULT 0,
+    closing BIGINT NOT NULL DEFAULT 0,
+    entry_count BIGINT NOT NULL DEFAULT 0,
+    create_time TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (advertiser_id, date)
+);
+
+CREATE INDEX idx_ledger_daily_balances_date ON ledger_daily_balances(date);
@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategies
+    ADD COLUMN dayparting CHAR(168) NOT NULL DEFAULT '' COMMENT '分时投放，按推广计划时区的星期和小时，为空时全天投放' AFTER participation_rate;
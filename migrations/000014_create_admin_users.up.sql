@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS admin_users (
+    id VARCHAR(64) PRIMARY KEY,
+    username VARCHAR(64) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    totp_secret VARCHAR(64) NOT NULL DEFAULT '',
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    last_login_time TIMESTAMP,
+    update_time TIMESTAMP NOT NULL,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_admin_users_username ON admin_users(username);
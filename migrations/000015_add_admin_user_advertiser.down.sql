@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_admin_users_advertiser_id;
+
+ALTER TABLE admin_users
+    DROP COLUMN advertiser_id;
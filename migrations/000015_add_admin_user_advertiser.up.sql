@@ -0,0 +1,4 @@
+ALTER TABLE admin_users
+    ADD COLUMN advertiser_id VARCHAR(64) NOT NULL DEFAULT '';
+
+CREATE INDEX idx_admin_users_advertiser_id ON admin_users(advertiser_id);
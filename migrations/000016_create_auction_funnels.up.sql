@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS auction_funnels (
+    request_id VARCHAR(64) NOT NULL,
+    ad_id VARCHAR(64) NOT NULL,
+    date DATE NOT NULL,
+    slot_id VARCHAR(64) NOT NULL DEFAULT '',
+    exchange VARCHAR(64) NOT NULL DEFAULT '',
+    bid_price DECIMAL(10,4),
+    win_price DECIMAL(10,4),
+    bid_time TIMESTAMP,
+    win_time TIMESTAMP,
+    impression_time TIMESTAMP,
+    click_time TIMESTAMP,
+    conversion_time TIMESTAMP,
+    update_time TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (request_id, ad_id)
+);
+
+CREATE INDEX idx_auction_funnels_date ON auction_funnels(date, ad_id);
@@ -0,0 +1,9 @@
+ALTER TABLE ledger_daily_balances
+    DROP COLUMN tax,
+    DROP COLUMN fee,
+    DROP COLUMN media_cost;
+
+ALTER TABLE ledger_entries
+    DROP COLUMN tax,
+    DROP COLUMN fee,
+    DROP COLUMN media_cost;
@@ -0,0 +1,16 @@
+ALTER TABLE ledger_entries
+    ADD COLUMN media_cost BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN fee BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE ledger_daily_balances
+    ADD COLUMN media_cost BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN fee BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN tax BIGINT NOT NULL DEFAULT 0;
+
+-- 此前的消耗流水只有媒体成本，回填时临时停用只追加的触发器
+ALTER TABLE ledger_entries DISABLE TRIGGER trg_ledger_entries_append_only;
+UPDATE ledger_entries SET media_cost = amount WHERE type = 'spend';
+ALTER TABLE ledger_entries ENABLE TRIGGER trg_ledger_entries_append_only;
+
+UPDATE ledger_daily_balances SET media_cost = spend;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS budget_snapshots (
+    budget_id VARCHAR(64) NOT NULL,
+    period_start TIMESTAMP NOT NULL,
+    spent BIGINT NOT NULL DEFAULT 0,
+    fee BIGINT NOT NULL DEFAULT 0,
+    tax BIGINT NOT NULL DEFAULT 0,
+    update_time TIMESTAMP NOT NULL,
+
+    PRIMARY KEY (budget_id, period_start)
+);
+
+CREATE INDEX idx_budget_snapshots_update_time ON budget_snapshots(update_time);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS tracking_receipts (
+    id BIGSERIAL PRIMARY KEY,
+    job_id VARCHAR(64) NOT NULL,
+    campaign_id VARCHAR(64) NOT NULL,
+    event_type VARCHAR(32) NOT NULL,
+    click_id VARCHAR(128) NOT NULL DEFAULT '',
+    attempt INT NOT NULL DEFAULT 0,
+    method VARCHAR(16) NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    status_code INT NOT NULL DEFAULT 0,
+    result VARCHAR(16) NOT NULL,
+    reason VARCHAR(32) NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    create_time TIMESTAMP NOT NULL
+);
+
+CREATE INDEX idx_tracking_receipts_campaign_time ON tracking_receipts(campaign_id, create_time);
+CREATE INDEX idx_tracking_receipts_create_time ON tracking_receipts(create_time);
@@ -0,0 +1,2 @@
+ALTER TABLE auction_funnels
+    DROP COLUMN size;
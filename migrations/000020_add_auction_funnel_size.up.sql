@@ -0,0 +1,2 @@
+ALTER TABLE auction_funnels
+    ADD COLUMN size VARCHAR(16) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategy_creatives
+    DROP COLUMN weight;
@@ -0,0 +1,2 @@
+ALTER TABLE bid_strategy_creatives
+    ADD COLUMN weight DECIMAL(6,3) NOT NULL DEFAULT 1.000;
@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: cache.go
+ * Project: simple-dsp
+ * Description: Redis批量读取工具，将循环中的逐个读取合并为MGET或管道
+ *
+ * 主要功能:
+ * - 批量读取字符串值，按键顺序返回
+ * - 批量读取计数器和JSON值并解码
+ * - 通过管道批量读取哈希
+ *
+ * 实现细节:
+ * - 每DefaultBatchSize个键一次往返，避免单条命令过大阻塞Redis
+ * - 单机客户端使用MGET，集群客户端使用GET管道，由客户端按节点拆分，避免跨槽位错误
+ * - 不存在的键和非字符串类型的键按不存在处理，与逐个GET时跳过错误的行为一致
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ *
+ * 注意事项:
+ * - 结果与键一一对应，调用方按下标取值
+ */
+
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultBatchSize 每次往返读取的最大键数
+const DefaultBatchSize = 500
+
+// MGet 批量读取字符串值，结果按键顺序排列，不存在或非字符串类型的键为nil
+func MGet(ctx context.Context, rdb redis.Cmdable, keys []string) ([][]byte, error) {
+	values := make([][]byte, 0, len(keys))
+	for start := 0; start < len(keys); start += DefaultBatchSize {
+		batch := keys[start:min(start+DefaultBatchSize, len(keys))]
+		var err error
+		if _, ok := rdb.(*redis.ClusterClient); ok {
+			values, err = pipelinedGet(ctx, rdb, batch, values)
+		} else {
+			values, err = mget(ctx, rdb, batch, values)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("批量读取失败: %w", err)
+		}
+	}
+	return values, nil
+}
+
+// mget 使用一条MGET读取一批键
+func mget(ctx context.Context, rdb redis.Cmdable, keys []string, values [][]byte) ([][]byte, error) {
+	result, err := rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range result {
+		if str, ok := v.(string); ok {
+			values = append(values, []byte(str))
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values, nil
+}
+
+// pipelinedGet 使用GET管道读取一批键，单个键的错误（不存在、类型不符）按不存在处理
+func pipelinedGet(ctx context.Context, rdb redis.Cmdable, keys []string, values [][]byte) ([][]byte, error) {
+	pipe := rdb.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !isKeyError(err) {
+		return nil, err
+	}
+	for _, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err != nil {
+			data = nil
+		}
+		values = append(values, data)
+	}
+	return values, nil
+}
+
+// MGetInt64 批量读取计数器，不存在或无法解析的键为0
+func MGetInt64(ctx context.Context, rdb redis.Cmdable, keys []string) ([]int64, error) {
+	values, err := MGet(ctx, rdb, keys)
+	if err != nil {
+		return nil, err
+	}
+	counts := make([]int64, len(values))
+	for i, data := range values {
+		if data != nil {
+			counts[i], _ = strconv.ParseInt(string(data), 10, 64)
+		}
+	}
+	return counts, nil
+}
+
+// MGetJSON 批量读取JSON值并解码，跳过不存在的键，结果保持键的相对顺序
+// 解码失败的键交给onError后跳过，onError为nil时直接跳过
+func MGetJSON[T any](ctx context.Context, rdb redis.Cmdable, keys []string, onError func(key string, err error)) ([]T, error) {
+	values, err := MGet(ctx, rdb, keys)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]T, 0, len(values))
+	for i, data := range values {
+		if data == nil {
+			continue
+		}
+		var item T
+		if err := json.Unmarshal(data, &item); err != nil {
+			if onError != nil {
+				onError(keys[i], err)
+			}
+			continue
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// HGetAll 通过管道批量读取哈希，结果按键顺序排列，不存在的键为空map
+func HGetAll(ctx context.Context, rdb redis.Cmdable, keys []string) ([]map[string]string, error) {
+	hashes := make([]map[string]string, 0, len(keys))
+	for start := 0; start < len(keys); start += DefaultBatchSize {
+		batch := keys[start:min(start+DefaultBatchSize, len(keys))]
+		pipe := rdb.Pipeline()
+		cmds := make([]*redis.StringStringMapCmd, len(batch))
+		for i, key := range batch {
+			cmds[i] = pipe.HGetAll(ctx, key)
+		}
+		if _, err := pipe.Exec(ctx); err != nil && !isKeyError(err) {
+			return nil, fmt.Errorf("批量读取哈希失败: %w", err)
+		}
+		for _, cmd := range cmds {
+			hash := cmd.Val()
+			if hash == nil {
+				hash = map[string]string{}
+			}
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes, nil
+}
+
+// isKeyError 判断管道返回的错误是否只是单个键不存在或类型不符
+func isKeyError(err error) bool {
+	var redisErr redis.Error
+	return errors.Is(err, redis.Nil) || (errors.As(err, &redisErr) && strings.HasPrefix(redisErr.Error(), "WRONGTYPE"))
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: tiered.go
+ * Project: simple-dsp
+ * Description: 本地内存加Redis的两级缓存，用于竞价路径上的热点配置读取
+ *
+ * 主要功能:
+ * - 先读本地缓存，未命中时读Redis，再未命中时调用加载函数从数据源加载
+ * - 同一实例内同一个键的并发未命中只加载一次，避免缓存击穿
+ * - 失效时删除本地和Redis中的条目，并通过发布订阅通知其他实例删除本地条目
+ *
+ * 实现细节:
+ * - 本地缓存按条目数限制大小，超过时淘汰最久未使用的条目，条目按LocalTTL过期
+ * - Redis中的条目以JSON保存在cache:{name}:{key}，按RemoteTTL过期；RemoteTTL为0时不使用Redis层
+ * - 失效通知频道为cache:{name}:invalidate，消息内容为键
+ * - 失效时正在进行的加载结果不写入本地缓存，之后的读取重新加载
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 返回的值与缓存共享，调用方不能修改其中的切片和map
+ * - 失效通知在订阅断开期间会丢失，此时其他实例最长在LocalTTL后读到新值
+ * - 数据源本身在Redis中时RemoteTTL应为0，只使用本地缓存和失效通知
+ */
+
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// DefaultTieredSize 本地缓存默认最多保存的条目数
+	DefaultTieredSize = 10000
+	// DefaultLocalTTL 本地条目默认的有效期
+	DefaultLocalTTL = time.Minute
+)
+
+// LoadFunc 两级缓存都未命中时从数据源加载键的值
+type LoadFunc[V any] func(ctx context.Context, key string) (V, error)
+
+// TieredOptions 两级缓存配置
+type TieredOptions struct {
+	// Name 缓存名称，用于Redis键和失效通知频道，不同用途的缓存不能重名
+	Name string
+	// Size 本地最多保存的条目数，默认DefaultTieredSize
+	Size int
+	// LocalTTL 本地条目的有效期，默认DefaultLocalTTL
+	LocalTTL time.Duration
+	// RemoteTTL Redis条目的有效期，为0时不使用Redis层
+	RemoteTTL time.Duration
+}
+
+// RemoteKey 两级缓存在Redis中保存键的位置，供数据源变更方直接删除
+func RemoteKey(name, key string) string {
+	return "cache:" + name + ":" + key
+}
+
+// invalidateChannel 失效通知频道
+func invalidateChannel(name string) string {
+	return "cache:" + name + ":invalidate"
+}
+
+// entry 本地缓存条目
+type entry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+// call 进行中的加载，同一个键的并发读取等待同一次加载
+type call[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Tiered 两级缓存
+type Tiered[V any] struct {
+	name      string
+	size      int
+	localTTL  time.Duration
+	remoteTTL time.Duration
+	redis     redis.UniversalClient
+	load      LoadFunc[V]
+	logger    *logger.Logger
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+	calls   map[string]*call[V]
+	// version 每次失效时递增，加载期间发生过失效的结果不写入本地缓存
+	version uint64
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewTiered 创建两级缓存，rdb为nil时只使用本地缓存
+func NewTiered[V any](opts TieredOptions, rdb redis.UniversalClient, load LoadFunc[V], logger *logger.Logger) *Tiered[V] {
+	if opts.Size <= 0 {
+		opts.Size = DefaultTieredSize
+	}
+	if opts.LocalTTL <= 0 {
+		opts.LocalTTL = DefaultLocalTTL
+	}
+	return &Tiered[V]{
+		name:      opts.Name,
+		size:      opts.Size,
+		localTTL:  opts.LocalTTL,
+		remoteTTL: opts.RemoteTTL,
+		redis:     rdb,
+		load:      load,
+		logger:    logger,
+		entries:   make(map[string]*list.Element),
+		order:     list.New(),
+		calls:     make(map[string]*call[V]),
+	}
+}
+
+// Start 订阅失效通知，收到通知后删除本地条目
+func (t *Tiered[V]) Start() {
+	if t.redis == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.cancelFunc = cancel
+
+	pubsub := t.redis.Subscribe(ctx, invalidateChannel(t.name))
+	// 等待订阅生效，Start返回后发布的失效通知不会丢失
+	receiveCtx, receiveCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer receiveCancel()
+	if _, err := pubsub.Receive(receiveCtx); err != nil {
+		t.logger.Warn("订阅缓存失效通知失败，稍后自动重试", "cache", t.name, "error", err)
+	}
+
+	t.wg.Add(1)
+	go t.watch(ctx, pubsub)
+}
+
+// Stop 停止订阅失效通知
+func (t *Tiered[V]) Stop() {
+	if t.cancelFunc == nil {
+		return
+	}
+	t.cancelFunc()
+	t.wg.Wait()
+}
+
+// watch 处理失效通知
+func (t *Tiered[V]) watch(ctx context.Context, pubsub *redis.PubSub) {
+	defer t.wg.Done()
+	defer pubsub.Close()
+
+	ch := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			t.Forget(msg.Payload)
+		}
+	}
+}
+
+// Get 读取键的值，依次查找本地缓存、Redis和数据源
+func (t *Tiered[V]) Get(ctx context.Context, key string) (V, error) {
+	t.mu.Lock()
+	if value, ok := t.getLocal(key); ok {
+		t.mu.Unlock()
+		return value, nil
+	}
+	if c, ok := t.calls[key]; ok {
+		t.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.value, c.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+	c := &call[V]{done: make(chan struct{})}
+	t.calls[key] = c
+	version := t.version
+	t.mu.Unlock()
+
+	c.value, c.err = t.fetch(ctx, key)
+
+	t.mu.Lock()
+	if t.calls[key] == c {
+		delete(t.calls, key)
+	}
+	if c.err == nil && t.version == version {
+		t.setLocal(key, c.value)
+	}
+	t.mu.Unlock()
+	close(c.done)
+
+	return c.value, c.err
+}
+
+// Invalidate 删除键在本地和Redis中的条目，并通知其他实例删除本地条目
+func (t *Tiered[V]) Invalidate(ctx context.Context, keys ...string) error {
+	t.Forget(keys...)
+	if t.redis == nil || len(keys) == 0 {
+		return nil
+	}
+
+	pipe := t.redis.Pipeline()
+	if t.remoteTTL > 0 {
+		remoteKeys := make([]string, len(keys))
+		for i, key := range keys {
+			remoteKeys[i] = RemoteKey(t.name, key)
+		}
+		pipe.Del(ctx, remoteKeys...)
+	}
+	channel := invalidateChannel(t.name)
+	for _, key := range keys {
+		pipe.Publish(ctx, channel, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("缓存%s失效失败: %w", t.name, err)
+	}
+	return nil
+}
+
+// Forget 只删除键在本实例的本地条目
+func (t *Tiered[V]) Forget(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.version++
+	for _, key := range keys {
+		if elem, ok := t.entries[key]; ok {
+			t.order.Remove(elem)
+			delete(t.entries, key)
+		}
+		delete(t.calls, key)
+	}
+}
+
+// fetch 本地未命中时读取Redis，Redis未命中或不可用时从数据源加载并回写Redis
+func (t *Tiered[V]) fetch(ctx context.Context, key string) (V, error) {
+	remote := t.redis != nil && t.remoteTTL > 0
+	if remote {
+		data, err := t.redis.Get(ctx, RemoteKey(t.name, key)).Bytes()
+		switch {
+		case err == nil:
+			var value V
+			if err := json.Unmarshal(data, &value); err == nil {
+				return value, nil
+			}
+			t.logger.Warn("解析Redis缓存失败，从数据源加载", "cache", t.name, "key", key, "error", err)
+		case !errors.Is(err, redis.Nil):
+			t.logger.Warn("读取Redis缓存失败，从数据源加载", "cache", t.name, "key", key, "error", err)
+		}
+	}
+
+	value, err := t.load(ctx, key)
+	if err != nil {
+		return value, err
+	}
+
+	if remote {
+		data, err := json.Marshal(value)
+		if err != nil {
+			t.logger.Warn("序列化缓存值失败", "cache", t.name, "key", key, "error", err)
+		} else if err := t.redis.Set(ctx, RemoteKey(t.name, key), data, t.remoteTTL).Err(); err != nil {
+			t.logger.Warn("写入Redis缓存失败", "cache", t.name, "key", key, "error", err)
+		}
+	}
+	return value, nil
+}
+
+// getLocal 读取未过期的本地条目并标记为最近使用，调用方持有锁
+func (t *Tiered[V]) getLocal(key string) (V, bool) {
+	elem, ok := t.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	e := elem.Value.(*entry[V])
+	if time.Now().After(e.expires) {
+		t.order.Remove(elem)
+		delete(t.entries, key)
+		var zero V
+		return zero, false
+	}
+	t.order.MoveToFront(elem)
+	return e.value, true
+}
+
+// setLocal 写入本地条目，超过大小时淘汰最久未使用的条目，调用方持有锁
+func (t *Tiered[V]) setLocal(key string, value V) {
+	expires := time.Now().Add(t.localTTL)
+	if elem, ok := t.entries[key]; ok {
+		e := elem.Value.(*entry[V])
+		e.value, e.expires = value, expires
+		t.order.MoveToFront(elem)
+		return
+	}
+	t.entries[key] = t.order.PushFront(&entry[V]{key: key, value: value, expires: expires})
+	for t.order.Len() > t.size {
+		oldest := t.order.Back()
+		t.order.Remove(oldest)
+		delete(t.entries, oldest.Value.(*entry[V]).key)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: chaos.go
+ * Project: simple-dsp
+ * Description: 故障注入，按比例为Redis、Kafka、RTA和数据库调用注入延迟和错误
+ *
+ * 主要功能:
+ * - 按配置的比例为依赖调用注入延迟，验证超时预算
+ * - 按配置的比例使依赖调用返回错误，验证熔断和降级
+ * - 按依赖和故障类型统计注入次数
+ *
+ * 实现细节:
+ * - Redis通过命令钩子注入，单条命令和管道各判断一次
+ * - Kafka通过写出的Transport注入，只影响事件写出，不影响消费
+ * - RTA通过HTTP Transport注入，对冲请求各自判断
+ * - 数据库通过gorm回调在语句执行前注入，注入的错误使语句不再执行
+ * - 延迟期间调用的context到期时提前返回context的错误，与真实的慢调用一致
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - github.com/segmentio/kafka-go
+ * - gorm.io/gorm
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 只能在server.mode为debug或test的非生产环境启用，配置校验拒绝生产环境启用
+ * - 注入的错误包装ErrInjected，可用errors.Is区分注入的故障和真实故障
+ * - Injector为nil时不注入，可直接传给各依赖的包装
+ */
+
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+// 注入故障的依赖
+const (
+	DependencyRedis    = "redis"
+	DependencyKafka    = "kafka"
+	DependencyRTA      = "rta"
+	DependencyPostgres = "postgres"
+)
+
+// 注入的故障类型
+const (
+	FaultLatency = "latency"
+	FaultError   = "error"
+)
+
+// Injector 按比例为一类依赖的调用注入延迟和错误，为nil时不注入
+type Injector struct {
+	dependency string
+	cfg        config.FaultConfig
+	metrics    *metrics.Metrics
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewInjector 创建依赖的故障注入器，延迟和错误比例都为0时返回nil
+func NewInjector(dependency string, cfg config.FaultConfig, m *metrics.Metrics) *Injector {
+	if cfg.LatencyRate <= 0 && cfg.ErrorRate <= 0 {
+		return nil
+	}
+	return &Injector{
+		dependency: dependency,
+		cfg:        cfg,
+		metrics:    m,
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Inject 按比例注入延迟和错误，返回注入的错误
+// 延迟期间ctx到期时返回ctx的错误
+func (i *Injector) Inject(ctx context.Context) error {
+	if i == nil {
+		return nil
+	}
+	if i.hit(i.cfg.LatencyRate) {
+		i.record(FaultLatency)
+		timer := time.NewTimer(i.cfg.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if i.hit(i.cfg.ErrorRate) {
+		i.record(FaultError)
+		return fmt.Errorf("%w: %s", ErrInjected, i.dependency)
+	}
+	return nil
+}
+
+// hit 按比例判断是否注入
+func (i *Injector) hit(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	if rate >= 1 {
+		return true
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rand.Float64() < rate
+}
+
+// record 统计注入次数
+func (i *Injector) record(fault string) {
+	if i.metrics != nil {
+		i.metrics.Chaos.Injected.WithLabelValues(i.dependency, fault).Inc()
+	}
+}
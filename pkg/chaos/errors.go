@@ -0,0 +1,8 @@
+package chaos
+
+import "errors"
+
+var (
+	// ErrInjected 表示故障注入返回的错误
+	ErrInjected = errors.New("注入的故障")
+)
@@ -0,0 +1,37 @@
+package chaos
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisHook 在Redis命令和管道执行前注入故障，注入错误时命令不发送
+type RedisHook struct {
+	injector *Injector
+}
+
+// NewRedisHook 创建Redis故障注入钩子
+func NewRedisHook(injector *Injector) *RedisHook {
+	return &RedisHook{injector: injector}
+}
+
+// BeforeProcess 命令执行前注入故障
+func (h *RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, h.injector.Inject(ctx)
+}
+
+// AfterProcess 不做处理
+func (h *RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+// BeforeProcessPipeline 管道执行前注入故障，整个管道按一次调用计算
+func (h *RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, h.injector.Inject(ctx)
+}
+
+// AfterProcessPipeline 不做处理
+func (h *RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
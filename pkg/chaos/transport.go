@@ -0,0 +1,102 @@
+package chaos
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/segmentio/kafka-go"
+	"gorm.io/gorm"
+)
+
+// KafkaTransport 在Kafka请求发送前注入故障的Transport，用于kafka.Writer
+type KafkaTransport struct {
+	injector *Injector
+	next     kafka.RoundTripper
+}
+
+// NewKafkaTransport 创建Kafka故障注入Transport，next为nil时使用kafka.DefaultTransport
+func NewKafkaTransport(injector *Injector, next kafka.RoundTripper) *KafkaTransport {
+	if next == nil {
+		next = kafka.DefaultTransport
+	}
+	return &KafkaTransport{injector: injector, next: next}
+}
+
+// RoundTrip 注入故障后发送请求
+func (t *KafkaTransport) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	if err := t.injector.Inject(ctx); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(ctx, addr, req)
+}
+
+// HTTPTransport 在HTTP请求发送前注入故障的Transport，用于RTA客户端
+type HTTPTransport struct {
+	injector *Injector
+	next     http.RoundTripper
+}
+
+// NewHTTPTransport 创建HTTP故障注入Transport，next为nil时使用http.DefaultTransport
+func NewHTTPTransport(injector *Injector, next http.RoundTripper) *HTTPTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &HTTPTransport{injector: injector, next: next}
+}
+
+// RoundTrip 注入故障后发送请求
+func (t *HTTPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.injector.Inject(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// gormPluginName 数据库故障注入插件的名称
+const gormPluginName = "chaos"
+
+// GormPlugin 在数据库语句执行前注入故障的gorm插件
+// 须在database.Open之后注册，延迟计入语句超时
+type GormPlugin struct {
+	injector *Injector
+}
+
+// NewGormPlugin 创建数据库故障注入插件
+func NewGormPlugin(injector *Injector) *GormPlugin {
+	return &GormPlugin{injector: injector}
+}
+
+// Name 插件名称
+func (p *GormPlugin) Name() string {
+	return gormPluginName
+}
+
+// Initialize 在各类语句执行前注册故障注入
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(gormPluginName+":create", p.inject),
+		cb.Query().Before("gorm:query").Register(gormPluginName+":query", p.inject),
+		cb.Update().Before("gorm:update").Register(gormPluginName+":update", p.inject),
+		cb.Delete().Before("gorm:delete").Register(gormPluginName+":delete", p.inject),
+		cb.Row().Before("gorm:row").Register(gormPluginName+":row", p.inject),
+		cb.Raw().Before("gorm:raw").Register(gormPluginName+":raw", p.inject),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inject 注入故障，注入的错误使gorm不再执行语句
+func (p *GormPlugin) inject(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := p.injector.Inject(ctx); err != nil {
+		_ = db.AddError(err)
+	}
+}
@@ -0,0 +1,60 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+type observeStartKey struct{}
+
+// ObserveHook 将每个Redis命令和管道的耗时和结果交给回调，用于评估Redis的健康状况
+// 键不存在(redis.Nil)不计为错误，管道按整体计一次调用
+type ObserveHook struct {
+	observe func(elapsed time.Duration, err error)
+}
+
+// NewObserveHook 创建Redis调用观测钩子
+func NewObserveHook(observe func(elapsed time.Duration, err error)) *ObserveHook {
+	return &ObserveHook{observe: observe}
+}
+
+// BeforeProcess 记录命令开始时间
+func (h *ObserveHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, observeStartKey{}, time.Now()), nil
+}
+
+// AfterProcess 回调命令的耗时和错误
+func (h *ObserveHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.done(ctx, []redis.Cmder{cmd})
+	return nil
+}
+
+// BeforeProcessPipeline 记录管道开始时间
+func (h *ObserveHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, observeStartKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline 回调管道的耗时和第一个错误
+func (h *ObserveHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.done(ctx, cmds)
+	return nil
+}
+
+// done 回调耗时和命令中第一个不是redis.Nil的错误
+func (h *ObserveHook) done(ctx context.Context, cmds []redis.Cmder) {
+	start, ok := ctx.Value(observeStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && !errors.Is(cmdErr, redis.Nil) {
+			err = cmdErr
+			break
+		}
+	}
+	h.observe(time.Since(start), err)
+}
@@ -13,7 +13,7 @@
  *
  * 实现细节:
  * - 使用go-redis库实现底层连接
- * - 通过适配器模式封装原生客户端
+ * - 直接返回原生客户端，各模块按需定义所用操作的接口
  * - 支持自动识别单机/集群模式
  * - 实现标准的Redis操作接口
  *
@@ -27,6 +27,7 @@
  * - 集群模式下不支持DB选择
  * - 所有操作都需要传入context
  * - 注意处理连接池资源释放
+ * - 配置slow_threshold时通过钩子记录慢命令和慢管道
  */
 
 package clients
@@ -55,6 +56,9 @@ func InitRedis(cfg *config.Config, log *logger.Logger) (*redis.Client, error) {
 		ReadTimeout:  cfg.Redis.ReadTimeout,
 		WriteTimeout: cfg.Redis.WriteTimeout,
 	})
+	if cfg.Redis.SlowThreshold > 0 {
+		rdb.AddHook(NewSlowLogHook(cfg.Redis.SlowThreshold, log))
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
@@ -91,6 +95,10 @@ func NewRedisClient(cfg config.RedisConfig, log *logger.Logger) (redis.Universal
 		})
 	}
 
+	if cfg.SlowThreshold > 0 {
+		baseClient.AddHook(NewSlowLogHook(cfg.SlowThreshold, log))
+	}
+
 	// 连接测试
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -108,3 +116,30 @@ func NewRedisClient(cfg config.RedisConfig, log *logger.Logger) (redis.Universal
 
 	return baseClient, nil
 }
+
+// InitLockNodes 初始化分布式锁使用的Redis节点，未配置lock.addresses时使用主Redis客户端
+// 节点之间相互独立，个别节点不可用时只记录日志，多数节点可用即可加锁
+func InitLockNodes(cfg *config.Config, main redis.Cmdable, log *logger.Logger) []redis.Cmdable {
+	if len(cfg.Lock.Addresses) == 0 {
+		return []redis.Cmdable{main}
+	}
+
+	nodes := make([]redis.Cmdable, 0, len(cfg.Lock.Addresses))
+	for _, addr := range cfg.Lock.Addresses {
+		rdb := redis.NewClient(&redis.Options{
+			Addr:         addr,
+			Password:     cfg.Redis.Password,
+			DialTimeout:  cfg.Redis.DialTimeout,
+			ReadTimeout:  cfg.Redis.ReadTimeout,
+			WriteTimeout: cfg.Redis.WriteTimeout,
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Warn("分布式锁Redis节点连接失败", "addr", addr, "error", err)
+		}
+		cancel()
+		nodes = append(nodes, rdb)
+	}
+	return nodes
+}
@@ -0,0 +1,89 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/logger"
+)
+
+// maxSlowPipelineCommands 慢管道日志中最多列出的命令数
+const maxSlowPipelineCommands = 10
+
+type slowLogStartKey struct{}
+
+// SlowLogHook Redis慢命令日志钩子，命令或管道耗时超过阈值时记录警告日志
+type SlowLogHook struct {
+	threshold time.Duration
+	logger    *logger.Logger
+}
+
+// NewSlowLogHook 创建Redis慢命令日志钩子
+func NewSlowLogHook(threshold time.Duration, log *logger.Logger) *SlowLogHook {
+	return &SlowLogHook{threshold: threshold, logger: log}
+}
+
+// BeforeProcess 记录命令开始时间
+func (h *SlowLogHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+// AfterProcess 命令耗时超过阈值时记录日志
+// 只记录命令名和键，不记录值
+func (h *SlowLogHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if elapsed, ok := h.elapsed(ctx); ok {
+		h.logger.Warn("慢Redis命令",
+			"command", cmd.Name(),
+			"key", commandKey(cmd),
+			"duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", h.threshold.Milliseconds(),
+			"error", cmd.Err())
+	}
+	return nil
+}
+
+// BeforeProcessPipeline 记录管道开始时间
+func (h *SlowLogHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, slowLogStartKey{}, time.Now()), nil
+}
+
+// AfterProcessPipeline 管道耗时超过阈值时记录日志
+func (h *SlowLogHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if elapsed, ok := h.elapsed(ctx); ok {
+		names := make([]string, 0, maxSlowPipelineCommands)
+		for i, cmd := range cmds {
+			if i == maxSlowPipelineCommands {
+				break
+			}
+			names = append(names, cmd.Name())
+		}
+		h.logger.Warn("慢Redis管道",
+			"commands", names,
+			"count", len(cmds),
+			"duration_ms", elapsed.Milliseconds(),
+			"threshold_ms", h.threshold.Milliseconds())
+	}
+	return nil
+}
+
+// elapsed 返回超过阈值的耗时
+func (h *SlowLogHook) elapsed(ctx context.Context) (time.Duration, bool) {
+	start, ok := ctx.Value(slowLogStartKey{}).(time.Time)
+	if !ok {
+		return 0, false
+	}
+	elapsed := time.Since(start)
+	return elapsed, elapsed > h.threshold
+}
+
+// commandKey 返回命令的第一个键，没有参数时返回空串
+func commandKey(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return ""
+	}
+	return fmt.Sprint(args[1])
+}
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: clock.go
+ * Project: simple-dsp
+ * Description: 时间来源抽象，按日期、小时或时间窗口计数的模块通过Clock获取当前时间
+ *
+ * 主要功能:
+ * - 系统时钟，生产环境使用
+ * - 可控的假时钟，测试中设置和推进时间，覆盖跨零点、续期和窗口滑动等场景
+ *
+ * 实现细节:
+ * - 预算、频次和统计模块默认使用系统时钟，通过SetClock或WithClock替换
+ * - 假时钟的时间只在调用Set或Advance时变化
+ *
+ * 依赖关系:
+ * - time
+ *
+ * 注意事项:
+ * - 只用于决定业务日期、周期和窗口的时间，耗时指标仍按实际时间统计
+ * - Redis键的过期时间由Redis按实际时间计算，不受假时钟影响
+ * - Fake可并发使用
+ */
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock 时间来源
+type Clock interface {
+	// Now 返回当前时间
+	Now() time.Time
+}
+
+// realClock 系统时钟
+type realClock struct{}
+
+// Now 返回系统当前时间
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real 返回系统时钟
+func Real() Clock {
+	return realClock{}
+}
+
+// OrReal c为nil时返回系统时钟，用于SetClock等接受nil的设置方法
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+	return c
+}
+
+// Fake 可控的时钟，时间只在调用Set或Advance时变化
+type Fake struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+// NewFake 创建从now开始的假时钟
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now 返回假时钟的当前时间
+func (f *Fake) Now() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.now
+}
+
+// Set 将时间设置为now
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
+
+// Advance 将时间推进d，返回推进后的时间
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	return f.now
+}
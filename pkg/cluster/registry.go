@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: registry.go
+ * Project: simple-dsp
+ * Description: 实例注册表，通过Redis心跳记录存活的服务实例，并按存活实例分配后台任务分片
+ *
+ * 主要功能:
+ * - 实例启动后定时写入心跳，退出时注销
+ * - 列出各服务存活的实例，供管理后台展示
+ * - 将后台任务按键划分到固定数量的分片，每个分片由一个存活实例负责
+ *
+ * 实现细节:
+ * - 实例信息保存在instance:{service}:{id}，TTL为三倍心跳间隔，实例异常退出后自动过期
+ * - instances有序集合记录{service}:{id}和最近一次心跳时间，列出实例时清理过期成员
+ * - 分片使用rendezvous哈希分配给实例，实例增减时只有相关分片迁移
+ * - 同一服务的成员列表在每次心跳时刷新并缓存在本地，判断分片归属不访问Redis
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/pkg/cache
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 成员变化在一个心跳间隔内生效，期间同一分片可能由新旧两个实例各处理一次，任务需幂等
+ * - 读取成员失败时保留上一次的成员列表；从未读取成功时本实例负责所有分片
+ */
+
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// DefaultHeartbeatInterval 默认心跳间隔
+	DefaultHeartbeatInterval = 5 * time.Second
+	// DefaultShardCount 默认分片数
+	DefaultShardCount = 64
+
+	// indexKey 所有实例的有序集合，分数为最近一次心跳的毫秒时间戳
+	indexKey = "instances"
+)
+
+// Instance 实例信息
+type Instance struct {
+	ID        string    `json:"id"`
+	Service   string    `json:"service"`
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	StartTime time.Time `json:"start_time"`
+	Heartbeat time.Time `json:"heartbeat"`
+	// Shards 本实例负责的后台任务分片
+	Shards []int `json:"shards"`
+}
+
+// instanceKey 实例信息的键
+func instanceKey(service, id string) string {
+	return "instance:" + service + ":" + id
+}
+
+// Registry 实例注册表
+type Registry struct {
+	redis      redis.Cmdable
+	logger     *logger.Logger
+	interval   time.Duration
+	ttl        time.Duration
+	shardCount int
+
+	self Instance
+
+	mu      sync.RWMutex
+	members []string
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewRegistry 创建实例注册表，service为服务名，实例ID未配置时使用主机名和进程号
+func NewRegistry(cfg config.ClusterConfig, rdb redis.Cmdable, service string, logger *logger.Logger) *Registry {
+	if cfg.HeartbeatInterval <= 0 {
+		cfg.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if cfg.ShardCount <= 0 {
+		cfg.ShardCount = DefaultShardCount
+	}
+
+	host, _ := os.Hostname()
+	id := cfg.InstanceID
+	if id == "" {
+		id = host + "-" + strconv.Itoa(os.Getpid())
+	}
+	return &Registry{
+		redis:      rdb,
+		logger:     logger,
+		interval:   cfg.HeartbeatInterval,
+		ttl:        3 * cfg.HeartbeatInterval,
+		shardCount: cfg.ShardCount,
+		self: Instance{
+			ID:        id,
+			Service:   service,
+			Host:      host,
+			PID:       os.Getpid(),
+			StartTime: time.Now(),
+		},
+	}
+}
+
+// ID 本实例的ID
+func (r *Registry) ID() string {
+	return r.self.ID
+}
+
+// ShardCount 分片数
+func (r *Registry) ShardCount() int {
+	return r.shardCount
+}
+
+// Start 注册本实例并启动心跳
+func (r *Registry) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancelFunc = cancel
+
+	r.heartbeat(ctx)
+	r.wg.Add(1)
+	go r.heartbeatLoop(ctx)
+}
+
+// Stop 停止心跳并注销本实例，其他实例在下一次心跳时接管本实例的分片
+func (r *Registry) Stop() {
+	if r.cancelFunc == nil {
+		return
+	}
+	r.cancelFunc()
+	r.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pipe := r.redis.Pipeline()
+	pipe.Del(ctx, instanceKey(r.self.Service, r.self.ID))
+	pipe.ZRem(ctx, indexKey, r.self.Service+":"+r.self.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Error("注销实例失败", "id", r.self.ID, "error", err)
+	}
+}
+
+// heartbeatLoop 定时写入心跳
+func (r *Registry) heartbeatLoop(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.heartbeat(ctx)
+		}
+	}
+}
+
+// heartbeat 刷新同一服务的成员列表并写入本实例的心跳
+func (r *Registry) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+
+	instances, err := r.Instances(ctx, r.self.Service)
+	if err != nil {
+		r.logger.Warn("读取存活实例失败", "service", r.self.Service, "error", err)
+	} else {
+		members := make([]string, 0, len(instances)+1)
+		for _, instance := range instances {
+			members = append(members, instance.ID)
+		}
+		r.setMembers(members)
+	}
+
+	now := time.Now()
+	self := r.self
+	self.Heartbeat = now
+	self.Shards = r.Shards()
+	data, err := json.Marshal(self)
+	if err != nil {
+		r.logger.Error("序列化实例信息失败", "error", err)
+		return
+	}
+
+	pipe := r.redis.Pipeline()
+	pipe.Set(ctx, instanceKey(self.Service, self.ID), data, r.ttl)
+	pipe.ZAdd(ctx, indexKey, &redis.Z{Score: float64(now.UnixMilli()), Member: self.Service + ":" + self.ID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Error("写入实例心跳失败", "id", self.ID, "error", err)
+	}
+}
+
+// setMembers 更新同一服务的成员列表，本实例总是在列表中
+func (r *Registry) setMembers(members []string) {
+	found := false
+	for _, id := range members {
+		if id == r.self.ID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		members = append(members, r.self.ID)
+	}
+	sort.Strings(members)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.members = members
+}
+
+// Instances 列出服务存活的实例，按ID排序；service为空时列出所有服务的实例
+func (r *Registry) Instances(ctx context.Context, service string) ([]Instance, error) {
+	now := time.Now()
+	expired := strconv.FormatInt(now.Add(-r.ttl).UnixMilli(), 10)
+	if err := r.redis.ZRemRangeByScore(ctx, indexKey, "-inf", "("+expired).Err(); err != nil {
+		return nil, fmt.Errorf("清理过期实例失败: %w", err)
+	}
+	members, err := r.redis.ZRange(ctx, indexKey, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取实例列表失败: %w", err)
+	}
+
+	keys := make([]string, 0, len(members))
+	for _, member := range members {
+		if service != "" && !strings.HasPrefix(member, service+":") {
+			continue
+		}
+		keys = append(keys, "instance:"+member)
+	}
+	instances, err := cache.MGetJSON[Instance](ctx, r.redis, keys, func(key string, err error) {
+		r.logger.Warn("跳过无效的实例信息", "key", key, "error", err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		if instances[i].Service != instances[j].Service {
+			return instances[i].Service < instances[j].Service
+		}
+		return instances[i].ID < instances[j].ID
+	})
+	return instances, nil
+}
+
+// ShardOf 返回键所在的分片
+func (r *Registry) ShardOf(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(r.shardCount))
+}
+
+// Owns 本实例是否负责键所在的分片
+func (r *Registry) Owns(key string) bool {
+	return r.owner(r.ShardOf(key), r.currentMembers()) == r.self.ID
+}
+
+// Shards 本实例负责的分片
+func (r *Registry) Shards() []int {
+	members := r.currentMembers()
+	shards := make([]int, 0, r.shardCount/len(members)+1)
+	for shard := 0; shard < r.shardCount; shard++ {
+		if r.owner(shard, members) == r.self.ID {
+			shards = append(shards, shard)
+		}
+	}
+	return shards
+}
+
+// currentMembers 返回本地缓存的成员列表，从未读取成功时只有本实例
+func (r *Registry) currentMembers() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.members) == 0 {
+		return []string{r.self.ID}
+	}
+	return r.members
+}
+
+// owner 使用rendezvous哈希选出分片的负责实例
+func (r *Registry) owner(shard int, members []string) string {
+	var (
+		best  string
+		score uint64
+	)
+	suffix := ":" + strconv.Itoa(shard)
+	for _, id := range members {
+		h := fnv.New64a()
+		h.Write([]byte(id + suffix))
+		if s := mix64(h.Sum64()); best == "" || s > score {
+			best, score = id, s
+		}
+	}
+	return best
+}
+
+// mix64 打散FNV哈希的高位，只差一个字符的实例ID也能均匀分到分片
+func mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: json.go
+ * Project: simple-dsp
+ * Description: JSON编解码抽象，支持通过编译标签切换实现
+ *
+ * 主要功能:
+ * - 统一流量和事件接口的JSON编解码入口
+ * - 支持encoding/json、jsoniter、sonic三种实现
+ *
+ * 实现细节:
+ * - 默认使用标准库encoding/json
+ * - 编译时指定 -tags jsoniter 使用jsoniter
+ * - 编译时指定 -tags sonic 使用sonic (仅支持amd64，其他平台回退到标准库)
+ * - 编译标签与gin保持一致，同一标签同时切换gin的绑定和渲染
+ *
+ * 依赖关系:
+ * - encoding/json
+ * - github.com/json-iterator/go
+ * - github.com/bytedance/sonic
+ *
+ * 注意事项:
+ * - 替代实现均使用与标准库兼容的配置，保证线上报文一致
+ * - 修改配置后需运行 test/codec 下的一致性测试
+ */
+
+package codec
+
+import "io"
+
+// Encoder JSON编码器
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder JSON解码器
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Name 返回当前使用的JSON实现名称
+func Name() string {
+	return name
+}
+
+// Marshal 编码为JSON
+func Marshal(v interface{}) ([]byte, error) {
+	return marshal(v)
+}
+
+// Unmarshal 解码JSON
+func Unmarshal(data []byte, v interface{}) error {
+	return unmarshal(data, v)
+}
+
+// NewEncoder 创建写入w的编码器
+func NewEncoder(w io.Writer) Encoder {
+	return newEncoder(w)
+}
+
+// NewDecoder 创建读取r的解码器
+func NewDecoder(r io.Reader) Decoder {
+	return newDecoder(r)
+}
@@ -0,0 +1,27 @@
+//go:build jsoniter
+
+package codec
+
+import (
+	"io"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+const name = "jsoniter"
+
+// api 与标准库行为兼容的配置：转义HTML、map按key排序
+var api = jsoniter.ConfigCompatibleWithStandardLibrary
+
+var (
+	marshal   = api.Marshal
+	unmarshal = api.Unmarshal
+)
+
+func newEncoder(w io.Writer) Encoder {
+	return api.NewEncoder(w)
+}
+
+func newDecoder(r io.Reader) Decoder {
+	return api.NewDecoder(r)
+}
@@ -0,0 +1,27 @@
+//go:build sonic && !jsoniter && (linux || windows || darwin) && amd64
+
+package codec
+
+import (
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+const name = "sonic"
+
+// api 与标准库行为兼容的配置：转义HTML、map按key排序
+var api = sonic.ConfigStd
+
+var (
+	marshal   = api.Marshal
+	unmarshal = api.Unmarshal
+)
+
+func newEncoder(w io.Writer) Encoder {
+	return api.NewEncoder(w)
+}
+
+func newDecoder(r io.Reader) Decoder {
+	return api.NewDecoder(r)
+}
@@ -0,0 +1,23 @@
+//go:build !jsoniter && !(sonic && (linux || windows || darwin) && amd64)
+
+package codec
+
+import (
+	"encoding/json"
+	"io"
+)
+
+const name = "encoding/json"
+
+var (
+	marshal   = json.Marshal
+	unmarshal = json.Unmarshal
+)
+
+func newEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func newDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
@@ -35,6 +35,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/netip"
+	"net/url"
 	"sync"
 	"time"
 
@@ -56,6 +58,41 @@ type Config struct {
 	Log      LogConfig      `mapstructure:"log"`
 	Metrics  MetricsConfig  `mapstructure:"metrics"`
 	Postgres PostgresConfig `mapstructure:"postgres"`
+	Trash    TrashConfig    `mapstructure:"trash"`
+	Webhook  WebhookConfig  `mapstructure:"webhook"`
+	Tracking TrackingConfig `mapstructure:"tracking"`
+	// Automation 自动化优化规则配置
+	Automation AutomationConfig `mapstructure:"automation"`
+	// Ledger 计费账本配置
+	Ledger LedgerConfig `mapstructure:"ledger"`
+	// Billing 平台服务费和税费配置
+	Billing BillingConfig `mapstructure:"billing"`
+	// SKAdNetwork iOS流量的SKAdNetwork归因配置
+	SKAdNetwork SKAdNetworkConfig `mapstructure:"skadnetwork"`
+	// SupplyChain 供应链(schain)验证配置
+	SupplyChain SupplyChainConfig `mapstructure:"supply_chain"`
+	// Profile 用户特征配置
+	Profile ProfileConfig `mapstructure:"profile"`
+	// Pixel 再营销像素配置
+	Pixel PixelConfig `mapstructure:"pixel"`
+	// Identity 身份图谱配置
+	Identity IdentityConfig `mapstructure:"identity"`
+	// Lock 后台任务的分布式锁配置
+	Lock LockConfig `mapstructure:"lock"`
+	// Leader 后台任务选主配置
+	Leader LeaderConfig `mapstructure:"leader"`
+	// Cluster 实例注册和后台任务分片配置
+	Cluster ClusterConfig `mapstructure:"cluster"`
+	// Timezone 广告主和推广计划的时区
+	Timezone TimezoneConfig `mapstructure:"timezone"`
+	// Admin 管理后台接口配置
+	Admin AdminConfig `mapstructure:"admin"`
+	// Exchanges 接入的交易平台配置
+	Exchanges []ExchangeConfig `mapstructure:"exchanges"`
+	// Chaos 故障注入配置，仅用于非生产环境
+	Chaos ChaosConfig `mapstructure:"chaos"`
+	// HTTPClient RTA、跟踪和供应链抓取等出站HTTP请求的配置
+	HTTPClient HTTPClientsConfig `mapstructure:"http_client"`
 }
 
 // ServerConfig 服务器配置
@@ -65,6 +102,139 @@ type ServerConfig struct {
 	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
 	MaxHeaderBytes  int           `mapstructure:"max_header_bytes"`
 	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// Mode 运行模式，release为生产环境，debug和test为非生产环境
+	Mode string `mapstructure:"mode"`
+	// ReadHeaderTimeout 读取请求头的超时，防止缓慢发送请求头的连接长期占用，为0时使用ReadTimeout
+	// 请求头读完之后才能匹配路由，因此只能在服务器级别设置
+	ReadHeaderTimeout time.Duration `mapstructure:"read_header_timeout"`
+	// IdleTimeout keep-alive连接等待下一个请求的超时，为0时使用ReadTimeout
+	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	// DisableKeepAlives 关闭HTTP keep-alive，每个请求处理完后关闭连接
+	DisableKeepAlives bool `mapstructure:"disable_keep_alives"`
+	// TCPKeepAlive 接受的连接的TCP keep-alive探测间隔，为0时使用15秒，为负数时关闭
+	TCPKeepAlive time.Duration `mapstructure:"tcp_keep_alive"`
+	// H2C 接受未加密的HTTP/2连接，交易平台可在一个连接上并发发送多个请求
+	H2C bool `mapstructure:"h2c"`
+	// MaxConcurrentStreams H2C连接的最大并发流数，为0时使用250
+	MaxConcurrentStreams uint32 `mapstructure:"max_concurrent_streams"`
+	// Limits 按路由组限制请求体大小和读取时间
+	Limits RequestLimitsConfig `mapstructure:"limits"`
+	GRPC   GRPCConfig          `mapstructure:"grpc"`
+}
+
+// HTTPClientsConfig 出站HTTP请求配置，每个目标使用独立的连接池
+type HTTPClientsConfig struct {
+	// Default 各目标的默认配置
+	Default HTTPClientConfig `mapstructure:"default"`
+	// Destinations 按目标覆盖默认配置，键为rta、tracking或supply_chain，为0的项使用Default
+	Destinations map[string]HTTPClientConfig `mapstructure:"destinations"`
+	// DNS 出站请求的域名解析缓存
+	DNS DNSCacheConfig `mapstructure:"dns"`
+}
+
+// DNSCacheConfig 域名解析缓存配置，解析失败时在一定时间内继续使用过期的结果
+type DNSCacheConfig struct {
+	// TTL 解析结果的缓存时间，为0时不缓存
+	TTL time.Duration `mapstructure:"ttl"`
+	// StaleTTL 缓存过期后解析失败时继续使用旧结果的最长时间，为0时使用1小时
+	StaleTTL time.Duration `mapstructure:"stale_ttl"`
+	// LookupTimeout 单次解析的超时，为0时使用1秒
+	LookupTimeout time.Duration `mapstructure:"lookup_timeout"`
+	// Hosts 按域名覆盖缓存时间，如RTA等地址变化少的域名可以缓存更久
+	// 使用列表而不是以域名为键的映射，因为配置键中的点会被解析为层级
+	Hosts []DNSHostConfig `mapstructure:"hosts"`
+}
+
+// DNSHostConfig 单个域名的解析缓存时间
+type DNSHostConfig struct {
+	Host string        `mapstructure:"host"`
+	TTL  time.Duration `mapstructure:"ttl"`
+}
+
+// HTTPClientConfig 出站HTTP请求的连接池、超时和重试配置，为0的项使用默认值
+type HTTPClientConfig struct {
+	// Timeout 单次请求的总超时，包括重试，为0时不限制，调用方通常另行设置
+	Timeout time.Duration `mapstructure:"timeout"`
+	// MaxRetries 连接失败或返回502、503、504时的最大重试次数，为0时不重试
+	// 只重试GET等幂等方法或带Idempotency-Key请求头的请求，请求体须可以重新读取
+	MaxRetries int `mapstructure:"max_retries"`
+	// RetryBackoff 第一次重试前的等待时间，之后每次翻倍，默认50毫秒
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// MaxRetryBackoff 重试等待时间的上限，默认1秒
+	MaxRetryBackoff time.Duration `mapstructure:"max_retry_backoff"`
+	// MaxIdleConns 所有主机的最大空闲连接数，默认1024
+	MaxIdleConns int `mapstructure:"max_idle_conns"`
+	// MaxIdleConnsPerHost 每个主机的最大空闲连接数，默认256
+	MaxIdleConnsPerHost int `mapstructure:"max_idle_conns_per_host"`
+	// MaxConnsPerHost 每个主机的最大连接数，包括使用中的连接，为0时不限制
+	MaxConnsPerHost int `mapstructure:"max_conns_per_host"`
+	// IdleConnTimeout 空闲连接的保留时间，默认90秒
+	IdleConnTimeout time.Duration `mapstructure:"idle_conn_timeout"`
+	// DialTimeout 建立连接的超时，默认2秒
+	DialTimeout time.Duration `mapstructure:"dial_timeout"`
+	// KeepAlive 连接的TCP keep-alive探测间隔，默认30秒
+	KeepAlive time.Duration `mapstructure:"keep_alive"`
+	// TLSHandshakeTimeout TLS握手超时，默认5秒
+	TLSHandshakeTimeout time.Duration `mapstructure:"tls_handshake_timeout"`
+}
+
+// ChaosConfig 故障注入配置，按比例为依赖调用注入延迟和错误，用于验证熔断、降级和超时预算
+// 只能在server.mode为debug或test时启用
+type ChaosConfig struct {
+	Enabled  bool        `mapstructure:"enabled"`
+	Redis    FaultConfig `mapstructure:"redis"`
+	Kafka    FaultConfig `mapstructure:"kafka"`
+	RTA      FaultConfig `mapstructure:"rta"`
+	Postgres FaultConfig `mapstructure:"postgres"`
+}
+
+// FaultConfig 一类依赖的故障注入，比例都为0时不注入
+type FaultConfig struct {
+	// LatencyRate 注入延迟的调用比例，0~1
+	LatencyRate float64 `mapstructure:"latency_rate"`
+	// Latency 注入的延迟，调用的context先到期时提前返回
+	Latency time.Duration `mapstructure:"latency"`
+	// ErrorRate 返回错误的调用比例，0~1，在注入延迟之后判断
+	ErrorRate float64 `mapstructure:"error_rate"`
+}
+
+// RequestLimitsConfig 按路由组的请求限制配置，路由组未设置的项使用Default
+type RequestLimitsConfig struct {
+	// Default 所有路由组的默认限制
+	Default RequestLimitConfig `mapstructure:"default"`
+	// Bid 竞价请求接口
+	Bid RequestLimitConfig `mapstructure:"bid"`
+	// Event 事件上报接口
+	Event RequestLimitConfig `mapstructure:"event"`
+}
+
+// RequestLimitConfig 一个路由组的请求限制
+type RequestLimitConfig struct {
+	// MaxBodyBytes 请求体大小上限，为0时不限制
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+	// ReadTimeout 读取请求体的截止时间，从开始处理请求算起，为0时使用服务器的ReadTimeout
+	ReadTimeout time.Duration `mapstructure:"read_timeout"`
+}
+
+// GRPCConfig gRPC服务配置
+type GRPCConfig struct {
+	Port             int  `mapstructure:"port"`
+	EnableReflection bool `mapstructure:"enable_reflection"`
+	// 服务端keepalive参数
+	MaxConnectionIdle     time.Duration `mapstructure:"max_connection_idle"`
+	MaxConnectionAge      time.Duration `mapstructure:"max_connection_age"`
+	MaxConnectionAgeGrace time.Duration `mapstructure:"max_connection_age_grace"`
+	KeepaliveTime         time.Duration `mapstructure:"keepalive_time"`
+	KeepaliveTimeout      time.Duration `mapstructure:"keepalive_timeout"`
+	// 客户端ping策略
+	MinPingInterval     time.Duration `mapstructure:"min_ping_interval"`
+	PermitWithoutStream bool          `mapstructure:"permit_without_stream"`
+	// 流控参数
+	InitialWindowSize     int32  `mapstructure:"initial_window_size"`
+	InitialConnWindowSize int32  `mapstructure:"initial_conn_window_size"`
+	MaxConcurrentStreams  uint32 `mapstructure:"max_concurrent_streams"`
+	MaxRecvMsgSize        int    `mapstructure:"max_recv_msg_size"`
+	MaxSendMsgSize        int    `mapstructure:"max_send_msg_size"`
 }
 
 // TrafficConfig 流量接入配置
@@ -76,18 +246,157 @@ type TrafficConfig struct {
 	MaxAdSlots    int           `mapstructure:"max_ad_slots"`
 	MinAdSlotSize int           `mapstructure:"min_ad_slot_size"`
 	MaxAdSlotSize int           `mapstructure:"max_ad_slot_size"`
+	// tmax超时预算
+	DefaultTMax    time.Duration `mapstructure:"default_tmax"`
+	MaxTMax        time.Duration `mapstructure:"max_tmax"`
+	NetworkReserve time.Duration `mapstructure:"network_reserve"`
+	RTAShare       float64       `mapstructure:"rta_share"`
+	// SlowThreshold 慢竞价请求日志阈值，为0时不记录
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// RecordTimeout 保存出价记录的超时时间，受tmax截止时间限制，默认20ms
+	RecordTimeout time.Duration `mapstructure:"record_timeout"`
+	// Enrichment 按设备缓存的请求上下文
+	Enrichment EnrichmentConfig `mapstructure:"enrichment"`
+	// Concurrency 竞价请求的并发限制和过载保护
+	Concurrency ConcurrencyConfig `mapstructure:"concurrency"`
+	// Adaptive 按下游健康状况自动调整的全局限流，上限为QPS
+	Adaptive AdaptiveLimitConfig `mapstructure:"adaptive"`
+}
+
+// EnrichmentConfig 请求上下文缓存配置
+type EnrichmentConfig struct {
+	// TTL 上下文的缓存时间，为0时不缓存；频次快照中已达上限的策略在有效期内不参与竞价，不宜过长
+	TTL time.Duration `mapstructure:"ttl"`
+	// MaxEntries 缓存的最大设备数，默认100000
+	MaxEntries int `mapstructure:"max_entries"`
+}
+
+// ConcurrencyConfig 竞价请求的并发限制和过载保护配置
+type ConcurrencyConfig struct {
+	// MaxInFlight 同时处理的竞价请求数上限，为0时不限制并发
+	MaxInFlight int `mapstructure:"max_in_flight"`
+	// MaxQueue 并发已满时排队等待的请求数上限，为0时不排队
+	MaxQueue int `mapstructure:"max_queue"`
+	// QueueTimeout 排队的最长等待时间
+	QueueTimeout time.Duration `mapstructure:"queue_timeout"`
+	// CPUThreshold CPU使用率超过该值后按超出的比例拒绝请求，取值0到1，为0时不检测CPU
+	CPUThreshold float64 `mapstructure:"cpu_threshold"`
+	// CPUSampleInterval CPU使用率的采样间隔，默认1秒
+	CPUSampleInterval time.Duration `mapstructure:"cpu_sample_interval"`
+	// RetryAfter 拒绝请求时Retry-After响应头的时间，按秒向上取整，默认1秒
+	RetryAfter time.Duration `mapstructure:"retry_after"`
+}
+
+// AdaptiveLimitConfig 按下游健康状况自动调整的流量限流配置
+type AdaptiveLimitConfig struct {
+	// Enabled 是否启用全局限流，未启用时只按交易平台限流
+	Enabled bool `mapstructure:"enabled"`
+	// Interval 评估下游健康状况和调整限流的间隔，默认1秒
+	Interval time.Duration `mapstructure:"interval"`
+	// MinQPS 自动降低的下限
+	MinQPS float64 `mapstructure:"min_qps"`
+	// DecreaseFactor 下游异常时限流乘以该系数，取值0到1，默认0.7
+	DecreaseFactor float64 `mapstructure:"decrease_factor"`
+	// IncreaseStep 下游正常时每个间隔增加traffic.qps的该比例，默认0.05
+	IncreaseStep float64 `mapstructure:"increase_step"`
+	// MinSamples 一个间隔内调用次数少于该值时不评估该下游，默认20
+	MinSamples int `mapstructure:"min_samples"`
+	// Redis Redis的异常阈值
+	Redis DependencyThresholdConfig `mapstructure:"redis"`
+	// RTA RTA服务的异常阈值
+	RTA DependencyThresholdConfig `mapstructure:"rta"`
+}
+
+// DependencyThresholdConfig 下游服务的异常阈值，平均延迟或错误率超过阈值时视为异常
+type DependencyThresholdConfig struct {
+	// MaxLatency 平均延迟上限，为0时不检查
+	MaxLatency time.Duration `mapstructure:"max_latency"`
+	// MaxErrorRate 错误率上限，取值0到1，为0时不检查
+	MaxErrorRate float64 `mapstructure:"max_error_rate"`
+}
+
+// ExchangeConfig 交易平台(SSP)配置
+type ExchangeConfig struct {
+	ID   string `mapstructure:"id"`
+	Name string `mapstructure:"name"`
+	// Auth 接入认证
+	Auth ExchangeAuthConfig `mapstructure:"auth"`
+	// PriceEncoding 成交价编码方式: plain 或 encrypted
+	PriceEncoding string `mapstructure:"price_encoding"`
+	// MacroDialect 宏格式: openrtb、google 或 custom
+	MacroDialect string `mapstructure:"macro_dialect"`
+	// PriceMacro custom宏格式下的成交价宏
+	PriceMacro     string        `mapstructure:"price_macro"`
+	AllowedAdTypes []string      `mapstructure:"allowed_ad_types"`
+	DefaultTMax    time.Duration `mapstructure:"default_tmax"`
+	// QPS 与交易平台约定的QPS上限，0表示不限制
+	QPS   float64 `mapstructure:"qps"`
+	Burst int     `mapstructure:"burst"`
+	// CreativeAudit 素材送审，启用后只有该交易平台审核通过的素材才参与其竞价
+	CreativeAudit ExchangeCreativeAuditConfig `mapstructure:"creative_audit"`
+}
+
+// ExchangeCreativeAuditConfig 交易平台素材审核接口配置
+type ExchangeCreativeAuditConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// URL 交易平台素材审核接口地址
+	URL string `mapstructure:"url"`
+	// Token 调用审核接口的Bearer令牌
+	Token string `mapstructure:"token"`
+	// Mode 审核状态同步方式: poll 定时查询，webhook 由交易平台回调
+	Mode string `mapstructure:"mode"`
+	// WebhookToken 交易平台回调时携带的Bearer令牌，webhook方式必填
+	WebhookToken string `mapstructure:"webhook_token"`
+}
+
+// ExchangeAuthConfig 交易平台接入认证配置
+type ExchangeAuthConfig struct {
+	// Type 认证方式: none、token 或 basic
+	Type       string   `mapstructure:"type"`
+	Header     string   `mapstructure:"header"`
+	Token      string   `mapstructure:"token"`
+	Username   string   `mapstructure:"username"`
+	Password   string   `mapstructure:"password"`
+	AllowedIPs []string `mapstructure:"allowed_ips"`
 }
 
 // RTAConfig RTA服务配置
 type RTAConfig struct {
-	BaseURL    string        `mapstructure:"base_url"`
-	AppKey     string        `mapstructure:"app_key"`
-	AppSecret  string        `mapstructure:"app_secret"`
-	Timeout    time.Duration `mapstructure:"timeout"`
-	RetryTimes int           `mapstructure:"retry_times"`
+	BaseURL   string        `mapstructure:"base_url"`
+	AppKey    string        `mapstructure:"app_key"`
+	AppSecret string        `mapstructure:"app_secret"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	// RetryTimes 未绑定任务的定向查询遇到网络错误、429或5xx时的最大重试次数，为0时不重试
+	RetryTimes int `mapstructure:"retry_times"`
+	// RetryDelay 第一次重试前的等待时间，之后每次翻倍并加随机抖动；请求剩余时间不足时不再重试
 	RetryDelay time.Duration `mapstructure:"retry_delay"`
 	CacheTTL   time.Duration `mapstructure:"cache_ttl"`
 	BatchSize  int           `mapstructure:"batch_size"`
+	// Tasks 推广计划绑定的RTA任务，配置后只在有推广计划需要时查询RTA
+	Tasks []RTATaskConfig `mapstructure:"tasks"`
+	// Lookup 对冲请求和超时降级
+	Lookup RTALookupConfig `mapstructure:"lookup"`
+}
+
+// RTALookupConfig RTA查询的对冲请求和超时降级配置
+type RTALookupConfig struct {
+	// Hedge 首个请求超过对冲延迟仍未返回时再发送一次请求，使用先返回的结果
+	Hedge bool `mapstructure:"hedge"`
+	// HedgeDelay 对冲延迟，为0时使用近期查询耗时的P95
+	HedgeDelay time.Duration `mapstructure:"hedge_delay"`
+	// StaleTTL 查询结果的保留时间，查询超时或失败时使用保留的结果，为0时不保留
+	StaleTTL time.Duration `mapstructure:"stale_ttl"`
+	// PreferStale 有保留结果时直接使用并在后台刷新，不等待RTA返回
+	PreferStale bool `mapstructure:"prefer_stale"`
+}
+
+// RTATaskConfig RTA任务配置
+type RTATaskConfig struct {
+	TaskID             string `mapstructure:"task_id"`
+	Channel            string `mapstructure:"channel"`
+	AdvertisingSpaceID string `mapstructure:"advertising_space_id"`
+	// Campaigns 绑定该任务的推广计划，只有RTA定向通过的用户才投放这些推广计划
+	Campaigns []string `mapstructure:"campaigns"`
 }
 
 // BiddingConfig 竞价服务配置
@@ -97,6 +406,178 @@ type BiddingConfig struct {
 	MinBidPrice       float64       `mapstructure:"min_bid_price"`
 	MaxBidPrice       float64       `mapstructure:"max_bid_price"`
 	CTRModelPath      string        `mapstructure:"ctr_model_path"`
+	// CheckReserve 候选生成在截止时间前为QPS、频次和预算检查预留的时间，默认10ms
+	CheckReserve time.Duration `mapstructure:"check_reserve"`
+	// StrategyRefreshInterval 出价策略缓存刷新间隔
+	StrategyRefreshInterval time.Duration `mapstructure:"strategy_refresh_interval"`
+	// CreativeSyncInterval 素材在交易平台审核状态的同步间隔，默认1分钟
+	CreativeSyncInterval time.Duration `mapstructure:"creative_sync_interval"`
+	// Floor 底价情报
+	Floor FloorConfig `mapstructure:"floor"`
+	// FloorEnforcement 请求底价的执行方式和底价货币
+	FloorEnforcement FloorEnforcementConfig `mapstructure:"floor_enforcement"`
+	// Frequency 频次控制
+	Frequency FrequencyConfig `mapstructure:"frequency"`
+	// RTA RTA返回的基础出价和出价系数
+	RTA RTABidConfig `mapstructure:"rta"`
+	// Participation 广告主参与竞价的请求比例
+	Participation ParticipationConfig `mapstructure:"participation"`
+}
+
+// ParticipationConfig 参与率配置，策略的参与率在出价策略中设置
+type ParticipationConfig struct {
+	// Advertisers 限制参与率的广告主，未列出的广告主参与全部请求
+	Advertisers []AdvertiserParticipationConfig `mapstructure:"advertisers"`
+}
+
+// AdvertiserParticipationConfig 广告主参与率
+type AdvertiserParticipationConfig struct {
+	AdvertiserID string `mapstructure:"advertiser_id"`
+	// Rate 参与竞价的请求比例，取值(0,1]，按请求ID哈希抽样
+	Rate float64 `mapstructure:"rate"`
+	// Campaigns 广告主的推广计划，其下所有策略一起参与或不参与
+	Campaigns []string `mapstructure:"campaigns"`
+}
+
+// TimezoneConfig 时区配置，日预算续期、按天的频次、分时投放和按天统计使用策略所属推广计划的时区
+type TimezoneConfig struct {
+	// Default 未设置时区的推广计划使用的时区，IANA名称如Asia/Shanghai，为空时使用服务器时区
+	Default string `mapstructure:"default"`
+	// Advertisers 广告主的时区，其下推广计划使用广告主的时区
+	Advertisers []AdvertiserTimezoneConfig `mapstructure:"advertisers"`
+	// Campaigns 单独设置时区的推广计划，优先于广告主的时区
+	Campaigns []CampaignTimezoneConfig `mapstructure:"campaigns"`
+}
+
+// AdvertiserTimezoneConfig 广告主时区
+type AdvertiserTimezoneConfig struct {
+	AdvertiserID string `mapstructure:"advertiser_id"`
+	Timezone     string `mapstructure:"timezone"`
+	// Campaigns 广告主的推广计划
+	Campaigns []string `mapstructure:"campaigns"`
+}
+
+// CampaignTimezoneConfig 推广计划时区
+type CampaignTimezoneConfig struct {
+	CampaignID string `mapstructure:"campaign_id"`
+	Timezone   string `mapstructure:"timezone"`
+}
+
+// AdminConfig 管理后台接口配置
+type AdminConfig struct {
+	// CORS 浏览器控制台跨域访问管理接口的配置
+	CORS CORSConfig `mapstructure:"cors"`
+	// Allowlist 管理接口和运维接口的IP白名单，可通过配置中心的admin.allowlist在运行时替换
+	Allowlist IPAllowlistConfig `mapstructure:"allowlist"`
+	// Auth 管理后台的登录和接口认证
+	Auth AdminAuthConfig `mapstructure:"auth"`
+	// Dashboard 管理后台首页看板
+	Dashboard AdminDashboardConfig `mapstructure:"dashboard"`
+}
+
+// AdminDashboardConfig 管理后台看板配置，看板数据由后台定时汇总，接口只返回最近一次的汇总结果
+type AdminDashboardConfig struct {
+	// RefreshInterval 汇总间隔，为0时使用30秒
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// TopCampaigns 按当天消耗返回的广告计划数，为0时使用10
+	TopCampaigns int `mapstructure:"top_campaigns"`
+	// MinWinRate 当天出价次数达到MinBids后胜率低于该值时告警，为0时不告警
+	MinWinRate float64 `mapstructure:"min_win_rate"`
+	// MinBids 胜率告警所需的最少出价次数，为0时使用1000
+	MinBids int64 `mapstructure:"min_bids"`
+}
+
+// AdminAuthConfig 管理后台认证配置，操作人员通过用户名密码登录获得会话，程序调用使用Bearer令牌
+type AdminAuthConfig struct {
+	// Enabled 是否启用认证，启用后需要配置PostgreSQL保存用户
+	Enabled bool `mapstructure:"enabled"`
+	// APITokens 程序调用使用的Bearer令牌，持有令牌视为管理员，可用于创建第一个用户
+	APITokens []string `mapstructure:"api_tokens"`
+	// SessionIdleTimeout 会话无操作的过期时间，为0时使用30分钟
+	SessionIdleTimeout time.Duration `mapstructure:"session_idle_timeout"`
+	// SessionMaxAge 会话从登录起的最长有效期，为0时使用12小时
+	SessionMaxAge time.Duration `mapstructure:"session_max_age"`
+	// CookieSecure 会话Cookie是否只通过HTTPS发送，生产环境应为true
+	CookieSecure bool `mapstructure:"cookie_secure"`
+	// BcryptCost 密码哈希的bcrypt代价，为0时使用10
+	BcryptCost int `mapstructure:"bcrypt_cost"`
+	// MaxLoginAttempts 锁定前允许的连续登录失败次数，为0时使用5
+	MaxLoginAttempts int `mapstructure:"max_login_attempts"`
+	// LockoutDuration 登录失败次数达到上限后的锁定时间，为0时使用15分钟
+	LockoutDuration time.Duration `mapstructure:"lockout_duration"`
+	// TOTPIssuer 动态口令应用中显示的发行方名称
+	TOTPIssuer string `mapstructure:"totp_issuer"`
+}
+
+// IPAllowlistConfig IP白名单配置
+type IPAllowlistConfig struct {
+	// Enabled 是否启用，启用后CIDRs为空时拒绝所有请求
+	Enabled bool `mapstructure:"enabled" json:"enabled"`
+	// CIDRs 允许访问的网段，如10.0.0.0/8，单个IP视为/32或/128
+	CIDRs []string `mapstructure:"cidrs" json:"cidrs"`
+	// TrustedProxies 可信代理的网段，只有直连地址属于可信代理时才从X-Forwarded-For取客户端IP
+	TrustedProxies []string `mapstructure:"trusted_proxies" json:"trusted_proxies"`
+}
+
+// CORSConfig 跨域访问配置，AllowedOrigins为空时不允许任何跨域请求
+type CORSConfig struct {
+	// AllowedOrigins 允许的来源，如https://console.example.com；
+	// https://*.example.com匹配任意子域名，*匹配所有来源但不能与AllowCredentials同时使用
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+	// AllowedMethods 预检请求允许的方法，为空时允许GET、POST、PUT、DELETE
+	AllowedMethods []string `mapstructure:"allowed_methods"`
+	// AllowedHeaders 预检请求允许的请求头，为空时允许Content-Type和Authorization
+	AllowedHeaders []string `mapstructure:"allowed_headers"`
+	// ExposedHeaders 允许浏览器脚本读取的响应头
+	ExposedHeaders []string `mapstructure:"exposed_headers"`
+	// AllowCredentials 是否允许携带Cookie和认证信息
+	AllowCredentials bool `mapstructure:"allow_credentials"`
+	// MaxAge 预检结果的缓存时间，为0时使用10分钟
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+// RTABidConfig RTA出价信号配置
+type RTABidConfig struct {
+	// Campaigns 使用RTA出价信号的推广计划，未列出的推广计划按策略出价
+	Campaigns []string `mapstructure:"campaigns"`
+	// MinMultiplier 出价系数下限，默认0.5
+	MinMultiplier float64 `mapstructure:"min_multiplier"`
+	// MaxMultiplier 出价系数上限，默认2
+	MaxMultiplier float64 `mapstructure:"max_multiplier"`
+}
+
+// FrequencyConfig 频次控制配置
+type FrequencyConfig struct {
+	// Mode 计数方式，daily按自然日计数，sliding按广告配置的时间窗口滑动计数
+	Mode string `mapstructure:"mode"`
+	// QPSCacheTTL 广告和推广计划QPS配置的本地缓存时间，默认10秒
+	QPSCacheTTL time.Duration `mapstructure:"qps_cache_ttl"`
+	// ConfigCacheTTL 广告频次配置的本地缓存时间，更新配置时所有实例立即失效，默认1分钟
+	ConfigCacheTTL time.Duration `mapstructure:"config_cache_ttl"`
+	// ConfigCacheSize 本地最多缓存的广告频次配置数，默认10000
+	ConfigCacheSize int `mapstructure:"config_cache_size"`
+}
+
+// FloorConfig 底价情报配置
+type FloorConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MinSamples 按成交价限制出价所需的最少成交样本数
+	MinSamples int64 `mapstructure:"min_samples"`
+	// MaxOverbidRatio 出价相对参考价格(平均成交价与底价的较大值)的最大倍数
+	MaxOverbidRatio float64       `mapstructure:"max_overbid_ratio"`
+	FlushInterval   time.Duration `mapstructure:"flush_interval"`
+}
+
+// FloorEnforcementConfig 请求底价的执行配置，出价和预算使用系统货币
+type FloorEnforcementConfig struct {
+	// Mode 执行方式: hard 排序前过滤出价低于请求底价的候选(默认)，off 不按请求底价过滤
+	Mode string `mapstructure:"mode"`
+	// Currency 系统货币，ISO 4217代码，默认USD
+	Currency string `mapstructure:"currency"`
+	// Rates 其他货币的汇率，即1单位该货币折合的系统货币
+	Rates map[string]float64 `mapstructure:"rates"`
+	// UnknownCurrency 底价货币没有汇率时的处理: skip 不参与该广告位的竞价(默认)，system 按系统货币处理
+	UnknownCurrency string `mapstructure:"unknown_currency"`
 }
 
 // BudgetConfig 预算管理配置
@@ -105,6 +586,24 @@ type BudgetConfig struct {
 	WarningThreshold float64       `mapstructure:"warning_threshold"`
 	AutoRenewal      bool          `mapstructure:"auto_renewal"`
 	RenewalTime      string        `mapstructure:"renewal_time"`
+	// SnapshotInterval 从Redis刷新预算花费并保存快照的间隔，默认30秒
+	SnapshotInterval time.Duration `mapstructure:"snapshot_interval"`
+	// Velocity 消耗速度保护
+	Velocity VelocityConfig `mapstructure:"velocity"`
+}
+
+// VelocityConfig 消耗速度保护配置
+// 出价策略每分钟的花费超过按日预算匀速消耗的Multiplier倍时自动暂停，需人工恢复
+type VelocityConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval 检查间隔，按相邻两次检查之间的花费计算消耗速度，默认1分钟
+	Interval time.Duration `mapstructure:"interval"`
+	// Multiplier 消耗速度超过匀速消耗的倍数时暂停，默认5倍
+	Multiplier float64 `mapstructure:"multiplier"`
+	// MinSpend 两次检查之间的花费低于该值时不暂停，避免小预算偶发的高价成交被误判，默认1元
+	MinSpend float64 `mapstructure:"min_spend"`
+	// ResumeGrace 人工恢复后不再检查的时间，默认30分钟
+	ResumeGrace time.Duration `mapstructure:"resume_grace"`
 }
 
 // StatsConfig 数据统计配置
@@ -117,6 +616,120 @@ type StatsConfig struct {
 	RedisPrefix   string        `mapstructure:"redis_prefix"`
 	FlushInterval time.Duration `mapstructure:"flush_interval"`
 	RetentionDays int           `mapstructure:"retention_days"`
+	// Forecast 投放预估使用的流量分布
+	Forecast ForecastConfig `mapstructure:"forecast"`
+	// Funnel 按请求关联出价、竞价成功、展示、点击和转化的竞价漏斗
+	Funnel FunnelConfig `mapstructure:"funnel"`
+	// Placements 按(交易平台, 广告位, 尺寸)汇总的供应路径表现，数据来自竞价漏斗
+	Placements PlacementConfig `mapstructure:"placements"`
+	// Dimensions 按地域和设备拆分的统计
+	Dimensions DimensionsConfig `mapstructure:"dimensions"`
+	// Encoding 事件写入Kafka的编码
+	Encoding EventEncodingConfig `mapstructure:"encoding"`
+	// Buffer Kafka不可用时的事件缓冲
+	Buffer EventBufferConfig `mapstructure:"buffer"`
+}
+
+// EventEncodingConfig 事件编码配置
+// 消费方同时支持JSON和Protobuf，切换编码时无需先升级消费方
+type EventEncodingConfig struct {
+	// Format 编码格式，json或protobuf，默认json
+	Format string `mapstructure:"format"`
+	// SchemaRegistry Protobuf编码时注册和校验Schema的Schema Registry
+	SchemaRegistry SchemaRegistryConfig `mapstructure:"schema_registry"`
+}
+
+// EventBufferConfig 事件写出缓冲配置
+// 启用后Kafka写入失败的事件先进入内存缓冲，内存缓冲已满时写入本地磁盘，Kafka恢复后按顺序重放
+type EventBufferConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MaxEvents 内存缓冲的事件数上限，默认100000
+	MaxEvents int `mapstructure:"max_events"`
+	// DropPolicy 内存缓冲已满且未启用磁盘缓冲时的丢弃策略，默认drop_newest
+	// drop_newest丢弃新事件，drop_oldest丢弃内存中最早的事件；磁盘缓冲已满时总是丢弃新事件
+	DropPolicy string `mapstructure:"drop_policy"`
+	// RetryInterval Kafka不可用时重放的间隔，默认1秒
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	// BatchSize 每次重放写出的事件数，默认500
+	BatchSize int `mapstructure:"batch_size"`
+	// WriteTimeout 重放时单次写入Kafka的超时，默认5秒
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// Spill 内存缓冲已满时写入本地磁盘
+	Spill EventSpillConfig `mapstructure:"spill"`
+}
+
+// EventSpillConfig 事件本地磁盘缓冲配置，磁盘中的事件在重启后继续重放
+type EventSpillConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Dir 缓冲文件目录，每个实例使用独立的目录
+	Dir string `mapstructure:"dir"`
+	// MaxBytes 缓冲文件的总大小上限，超过时按丢弃策略丢弃新事件，默认1GB
+	MaxBytes int64 `mapstructure:"max_bytes"`
+	// SegmentBytes 单个缓冲文件的大小，重放完一个文件后删除，默认64MB
+	SegmentBytes int64 `mapstructure:"segment_bytes"`
+}
+
+// SchemaRegistryConfig Schema Registry配置，接口与Confluent Schema Registry兼容
+type SchemaRegistryConfig struct {
+	URL      string `mapstructure:"url"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Timeout 单次请求超时，默认5秒
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Compatibility 事件主题的兼容性级别，如BACKWARD、FULL；为空时使用Schema Registry的全局设置
+	Compatibility string `mapstructure:"compatibility"`
+}
+
+// DimensionsConfig 报表维度配置
+// 启用后竞价服务按请求的IP和User-Agent解析国家、省份、城市、设备类型和操作系统，按天拆分统计
+type DimensionsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// GeoIPPath IP库文件，每行为network,country,province,city；为空时不解析地域
+	GeoIPPath string `mapstructure:"geoip_path"`
+	// RetentionDays 按维度统计的保留天数，默认92天
+	RetentionDays int `mapstructure:"retention_days"`
+}
+
+// FunnelConfig 竞价漏斗配置
+// 启用后竞价服务为每次出价写出出价事件，管理后台消费事件按请求ID和广告ID关联后写入auction_funnels表
+type FunnelConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// GroupID 消费出价、竞价成功、展示、点击和转化事件的Kafka消费组
+	GroupID string `mapstructure:"group_id"`
+	// BatchSize 每批写入的事件数
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval 未攒满一批时的最长等待时间
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// RetentionDays 漏斗数据的保留天数，默认7天
+	RetentionDays int `mapstructure:"retention_days"`
+}
+
+// PlacementConfig 供应路径表现配置
+// 管理后台定时从竞价漏斗汇总各供应路径的胜率、CTR和CVR写入Redis，竞价服务读取后按CTR调整出价
+type PlacementConfig struct {
+	// Enabled 是否汇总供应路径表现，需要同时启用竞价漏斗
+	Enabled bool `mapstructure:"enabled"`
+	// LookbackDays 汇总最近几天的漏斗数据，默认7天，不应超过漏斗数据的保留天数
+	LookbackDays int `mapstructure:"lookback_days"`
+	// RefreshInterval 汇总和竞价服务重新加载的间隔，默认10分钟
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// AdjustBids 竞价服务是否按供应路径的CTR调整出价，关闭时只提供查询
+	AdjustBids bool `mapstructure:"adjust_bids"`
+	// MinImpressions 调整出价需要的最少展示数，默认1000
+	MinImpressions int64 `mapstructure:"min_impressions"`
+	// MinMultiplier、MaxMultiplier 出价调整系数的范围，默认0.5到1.5
+	MinMultiplier float64 `mapstructure:"min_multiplier"`
+	MaxMultiplier float64 `mapstructure:"max_multiplier"`
+}
+
+// ForecastConfig 流量分布记录配置
+type ForecastConfig struct {
+	// Enabled 是否按天记录广告位请求的流量分布
+	Enabled bool `mapstructure:"enabled"`
+	// FlushInterval 本地统计写入Redis的间隔，默认10秒
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// RetentionDays 流量分布的保留天数，默认30天
+	RetentionDays int `mapstructure:"retention_days"`
 }
 
 // EventConfig 事件处理配置
@@ -125,6 +738,37 @@ type EventConfig struct {
 	RetryDelay     time.Duration `mapstructure:"retry_delay"`
 	ProcessTimeout time.Duration `mapstructure:"process_timeout"`
 	QueueSize      int           `mapstructure:"queue_size"`
+	// Shards 事件管道分片数，同一用户或请求的事件落在同一分片中顺序处理
+	Shards int `mapstructure:"shards"`
+	// BatchSize 每批写出的最大事件数
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval 未攒满一批时的最长等待时间
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// BidRecordTTL 出价记录保留时间，超过后到达的展示和竞价成功通知被拒绝
+	BidRecordTTL time.Duration `mapstructure:"bid_record_ttl"`
+	// PriceTolerance 成交价允许高于出价的比例，超出时标记价格异常
+	PriceTolerance float64 `mapstructure:"price_tolerance"`
+	// WinDedupTTL 竞价成功通知去重键的保留时间，不能小于BidRecordTTL，默认24小时
+	WinDedupTTL time.Duration `mapstructure:"win_dedup_ttl"`
+	// PriceKeys 各交易平台的成交价解密密钥，第一组为当前密钥
+	PriceKeys map[string][]PriceKeyConfig `mapstructure:"price_keys"`
+	// AdServing 按广告地址返回广告代码
+	AdServing AdServingConfig `mapstructure:"ad_serving"`
+}
+
+// AdServingConfig 广告地址配置，竞价响应中返回/ad/{竞价令牌}，客户端按地址加载广告代码
+type AdServingConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// BaseURL 广告地址的前缀，如https://ad.example.com
+	BaseURL string `mapstructure:"base_url"`
+	// Secret 竞价令牌的签名密钥，至少32个字符；更换后已签发的广告地址失效
+	Secret string `mapstructure:"secret"`
+}
+
+// PriceKeyConfig 成交价加解密密钥，websafe base64编码
+type PriceKeyConfig struct {
+	EncryptionKey string `mapstructure:"encryption_key"`
+	IntegrityKey  string `mapstructure:"integrity_key"`
 }
 
 // RedisConfig Redis配置
@@ -138,6 +782,8 @@ type RedisConfig struct {
 	DialTimeout  time.Duration `mapstructure:"dial_timeout"`
 	ReadTimeout  time.Duration `mapstructure:"read_timeout"`
 	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// SlowThreshold 慢命令日志阈值，为0时不记录
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
 }
 
 type ClusterNode struct {
@@ -156,6 +802,33 @@ type KafkaConfig struct {
 	Version      string        `mapstructure:"version"`
 	MaxRetries   int           `mapstructure:"max_retries"`
 	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+	// Topics 启动时检查事件主题的分区数和保留时间
+	Topics KafkaTopicsConfig `mapstructure:"topics"`
+}
+
+// KafkaTopicsConfig 事件主题管理配置，需显式启用
+// 启用后竞价服务启动时创建缺少的主题、为分区数不足的主题增加分区并调整保留时间
+type KafkaTopicsConfig struct {
+	AutoCreate bool `mapstructure:"auto_create"`
+	// DryRun 只输出将要进行的变更，不修改集群
+	DryRun bool `mapstructure:"dry_run"`
+	// Partitions 主题的分区数，默认6；已有主题的分区数不会减少
+	Partitions int `mapstructure:"partitions"`
+	// ReplicationFactor 新建主题的副本数，为0时使用Broker的默认值
+	ReplicationFactor int `mapstructure:"replication_factor"`
+	// Retention 消息保留时间，为0时不设置，沿用Broker或主题已有的设置
+	Retention time.Duration `mapstructure:"retention"`
+	// Timeout 检查和变更主题的超时时间，默认30秒
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Overrides 按主题覆盖分区数和保留时间，不在事件主题中的主题同样会创建
+	Overrides []KafkaTopicConfig `mapstructure:"overrides"`
+}
+
+// KafkaTopicConfig 单个主题的分区数和保留时间，为0时使用KafkaTopicsConfig的设置
+type KafkaTopicConfig struct {
+	Name       string        `mapstructure:"name"`
+	Partitions int           `mapstructure:"partitions"`
+	Retention  time.Duration `mapstructure:"retention"`
 }
 
 // LogConfig 日志配置
@@ -166,6 +839,59 @@ type LogConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 	MaxAge     int    `mapstructure:"max_age"`
 	Compress   bool   `mapstructure:"compress"`
+	// Sampling 热点日志采样，可通过配置中心的log.sampling在运行时调整
+	Sampling LogSamplingConfig `mapstructure:"sampling"`
+	// Scrub 日志字段脱敏
+	Scrub LogScrubConfig `mapstructure:"scrub"`
+	// Sink 将JSON日志异步发送到Kafka或Fluentd/Vector
+	Sink LogSinkConfig `mapstructure:"sink"`
+}
+
+// LogSinkConfig 日志远程发送配置
+type LogSinkConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Type 发送方式，kafka或http
+	Type string `mapstructure:"type"`
+	// Brokers Kafka地址，Type为kafka时使用
+	Brokers []string `mapstructure:"brokers"`
+	// Topic Kafka主题，Type为kafka时使用
+	Topic string `mapstructure:"topic"`
+	// URL Fluentd或Vector的HTTP输入地址，Type为http时使用
+	URL string `mapstructure:"url"`
+	// BufferSize 缓冲的日志条数上限，超出时丢弃
+	BufferSize int `mapstructure:"buffer_size"`
+	// BatchSize 每批发送的日志条数
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval 不满一批时的发送间隔
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// Timeout 单次发送及Sync的超时时间
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// LogScrubConfig 日志脱敏配置
+type LogScrubConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Salt 哈希脱敏的盐，按hash脱敏时必须配置
+	Salt string `mapstructure:"salt"`
+	// Fields 字段名到脱敏方式(hash或mask)的映射，为空时使用默认字段
+	Fields map[string]string `mapstructure:"fields"`
+}
+
+// LogSamplingConfig 日志采样配置
+// 每秒内每条消息先记录First条，之后每Thereafter条记录1条，Thereafter为0时丢弃其余日志
+// Error及以上级别的日志始终记录
+type LogSamplingConfig struct {
+	Enabled    bool `mapstructure:"enabled" json:"enabled"`
+	First      int  `mapstructure:"first" json:"first"`
+	Thereafter int  `mapstructure:"thereafter" json:"thereafter"`
+	// Messages 按消息单独设置的采样规则
+	Messages map[string]LogSampleRule `mapstructure:"messages" json:"messages,omitempty"`
+}
+
+// LogSampleRule 单条消息的采样规则
+type LogSampleRule struct {
+	First      int `mapstructure:"first" json:"first"`
+	Thereafter int `mapstructure:"thereafter" json:"thereafter"`
 }
 
 // MetricsConfig 监控指标配置
@@ -175,20 +901,250 @@ type MetricsConfig struct {
 	Path        string `mapstructure:"path"`
 	PushGateway string `mapstructure:"push_gateway"`
 	HTTPEnabled bool   `mapstructure:"http_enabled"`
+	// Instance 实例名，作为指标的instance标签，为空时使用主机名
+	Instance string `mapstructure:"instance"`
+	// PushInterval 推送到PushGateway的间隔，默认15秒
+	PushInterval time.Duration `mapstructure:"push_interval"`
+	// PushJitter 推送间隔的随机抖动比例(0~0.5)，避免多个实例同时推送
+	PushJitter float64 `mapstructure:"push_jitter"`
+	// AggregatePath 预聚合指标的路径，默认/metrics/aggregate，不能与Path相同
+	AggregatePath string `mapstructure:"aggregate_path"`
+}
+
+// TrashConfig 回收站配置
+type TrashConfig struct {
+	// RetentionDays 已删除资源的保留天数，超过后由后台任务彻底删除
+	RetentionDays int           `mapstructure:"retention_days"`
+	PurgeInterval time.Duration `mapstructure:"purge_interval"`
+}
+
+// AutomationConfig 自动化优化规则配置，护栏对所有规则生效
+type AutomationConfig struct {
+	// Interval 规则的评估间隔
+	Interval time.Duration `mapstructure:"interval"`
+	// MaxChangePercent 单次调价的最大幅度(%)，规则的调整幅度不能超过该值
+	MaxChangePercent float64 `mapstructure:"max_change_percent"`
+	// MaxDailyChangePercent 出价相对当天首次自动调价前的最大偏离(%)
+	MaxDailyChangePercent float64 `mapstructure:"max_daily_change_percent"`
+	// MinBidPrice、MaxBidPrice 自动调价的出价范围，MaxBidPrice为0时不限制上限
+	MinBidPrice float64 `mapstructure:"min_bid_price"`
+	MaxBidPrice float64 `mapstructure:"max_bid_price"`
+	// DefaultCooldown 规则未设置冷却时间时，同一规则对同一策略两次操作的最小间隔
+	DefaultCooldown time.Duration `mapstructure:"default_cooldown"`
+	// Fatigue 素材疲劳检测
+	Fatigue FatigueConfig `mapstructure:"fatigue"`
+}
+
+// FatigueConfig 素材疲劳检测配置
+// 广告近期窗口的CTR相对此前基准窗口的下降比例达到阈值时降低出价策略的投放权重，下降更多时暂停策略
+type FatigueConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Interval 检测间隔，默认1小时
+	Interval time.Duration `mapstructure:"interval"`
+	// RecentWindow 近期窗口，按小时取整，默认24小时
+	RecentWindow time.Duration `mapstructure:"recent_window"`
+	// BaselineWindow 近期窗口之前的基准窗口，按小时取整，默认72小时
+	// 与RecentWindow之和不能超过按小时统计的保留时间(8天)
+	BaselineWindow time.Duration `mapstructure:"baseline_window"`
+	// MinImpressions 两个窗口的展示数都不低于该值时才检测，默认1000
+	MinImpressions int64 `mapstructure:"min_impressions"`
+	// DownweightDecay 素材CTR下降比例达到该值时降低素材的轮换权重，默认0.3
+	DownweightDecay float64 `mapstructure:"downweight_decay"`
+	// WeightFactor 每次降低权重时乘以的系数，默认0.5
+	WeightFactor float64 `mapstructure:"weight_factor"`
+	// MinWeight 降低权重的下限，达到下限后不再降低，默认0.1
+	MinWeight float64 `mapstructure:"min_weight"`
+	// PauseDecay 素材CTR下降比例达到该值时暂停该素材，为0时只降低权重
+	PauseDecay float64 `mapstructure:"pause_decay"`
+	// Cooldown 同一素材两次操作的最小间隔，等待调整后的数据进入近期窗口，默认24小时
+	Cooldown time.Duration `mapstructure:"cooldown"`
+}
+
+// LedgerConfig 计费账本配置
+type LedgerConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// GroupID 消费展示和竞价成功事件的Kafka消费组
+	GroupID string `mapstructure:"group_id"`
+	// BatchSize 每批写入的消耗流水数
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval 未攒满一批时的最长等待时间
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// CloseInterval 日终结算的检查间隔，每次结算到前一天
+	CloseInterval time.Duration `mapstructure:"close_interval"`
+	// ResolveCacheTTL 出价策略所属广告主的本地缓存时间
+	ResolveCacheTTL time.Duration `mapstructure:"resolve_cache_ttl"`
+}
+
+// BillingConfig 计费配置，消耗按媒体成本、平台服务费和税费分别记录
+// 都为0时消耗只有媒体成本，与未配置时相同
+type BillingConfig struct {
+	// PlatformMargin 平台服务费占媒体成本的比例，如0.15表示在媒体成本之上加收15%
+	PlatformMargin float64 `mapstructure:"platform_margin"`
+	// TaxRate 税率，按媒体成本与平台服务费之和计算
+	TaxRate float64 `mapstructure:"tax_rate"`
+}
+
+// LockConfig 分布式锁配置，保证清理、结算等后台任务在多个实例中只有一个执行
+type LockConfig struct {
+	// Addresses 相互独立的Redis节点，多数节点加锁成功才算持有；为空时使用redis配置的节点
+	Addresses []string `mapstructure:"addresses"`
+	// TTL 租约时长，持有期间每三分之一TTL续期一次
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// LeaderConfig 选主配置，同一选主组中只有主实例运行耗时的周期任务，主实例故障后自动切换
+type LeaderConfig struct {
+	// Election 选主组名称，运行相同任务的实例使用同一名称，为空时为default
+	Election string `mapstructure:"election"`
+	// AdminElection 管理后台的选主组名称，与竞价服务运行不同的任务，需与Election不同，为空时为admin-server
+	AdminElection string `mapstructure:"admin_election"`
+	// RetryInterval 非主实例尝试当选的间隔，主实例故障后最长在lock.ttl加该间隔内切换
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+}
+
+// ClusterConfig 实例注册配置，存活的实例按分片分担后台任务
+type ClusterConfig struct {
+	// InstanceID 实例ID，为空时使用主机名和进程号
+	InstanceID string `mapstructure:"instance_id"`
+	// HeartbeatInterval 心跳间隔，超过三倍间隔未心跳的实例视为下线
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+	// ShardCount 后台任务的分片数，同一服务的实例必须一致，应远大于实例数
+	ShardCount int `mapstructure:"shard_count"`
+}
+
+// WebhookConfig 系统通知Webhook配置
+type WebhookConfig struct {
+	Workers   int           `mapstructure:"workers"`
+	QueueSize int           `mapstructure:"queue_size"`
+	Timeout   time.Duration `mapstructure:"timeout"`
+	// MaxRetries 投递失败后的最大重试次数，重试间隔按RetryBackoff指数增长
+	MaxRetries   int           `mapstructure:"max_retries"`
+	RetryBackoff time.Duration `mapstructure:"retry_backoff"`
+}
+
+// TrackingConfig 第三方跟踪投递配置
+type TrackingConfig struct {
+	Workers      int           `mapstructure:"workers"`
+	BatchSize    int           `mapstructure:"batch_size"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// LeaseTimeout 事件被取出后的租约时间，超时未确认的事件会被重新投递
+	LeaseTimeout time.Duration `mapstructure:"lease_timeout"`
+	// MaxAge 事件的最长保留时间，超过后放弃投递
+	MaxAge     time.Duration `mapstructure:"max_age"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+	// BreakerThreshold 同一计划同一跟踪类型连续失败多少次后熔断，小于0时不熔断
+	BreakerThreshold int `mapstructure:"breaker_threshold"`
+	// BreakerCooldown 熔断持续时间，结束后放行一次探测请求
+	BreakerCooldown time.Duration `mapstructure:"breaker_cooldown"`
+	// MacroAllowlist 跟踪URL中允许替换的宏，为空时不包含IP
+	MacroAllowlist []string `mapstructure:"macro_allowlist"`
+	// Receipts 投递回执，记录每次投递的结果，供排查广告主收不到回传的原因
+	Receipts TrackingReceiptsConfig `mapstructure:"receipts"`
+}
+
+// TrackingReceiptsConfig 跟踪投递回执配置，回执写入PostgreSQL
+type TrackingReceiptsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// BufferSize 等待写入的回执上限，超过时丢弃新回执，默认10000
+	BufferSize int `mapstructure:"buffer_size"`
+	// BatchSize 每批写入的回执数，默认500
+	BatchSize int `mapstructure:"batch_size"`
+	// FlushInterval 未攒满一批时的最长等待时间，默认2秒
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+	// RetentionDays 回执的保留天数，默认7天
+	RetentionDays int `mapstructure:"retention_days"`
+}
+
+// SKAdNetworkConfig SKAdNetwork归因配置
+type SKAdNetworkConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// NetworkID 在Apple注册的广告网络ID
+	NetworkID string `mapstructure:"network_id"`
+	// PrivateKeyFile 签名使用的P-256私钥文件，PEM格式
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	// Versions 支持的版本，为空时支持2.2、3.0和4.0
+	Versions []string `mapstructure:"versions"`
+	// ApplePublicKeys 校验回传签名的Apple公钥，键为主版本号，值为base64编码的公钥
+	ApplePublicKeys map[string]string `mapstructure:"apple_public_keys"`
+}
+
+// SupplyChainConfig 供应链验证配置
+type SupplyChainConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// VerifyAdsTxt 按媒体的ads.txt或app-ads.txt验证供应链的第一个节点
+	VerifyAdsTxt bool `mapstructure:"verify_ads_txt"`
+	// VerifySellers 按sellers.json验证供应链的每个节点
+	VerifySellers bool `mapstructure:"verify_sellers"`
+	// RefreshInterval 重新抓取已缓存文件的间隔，默认24小时
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	// FetchTimeout 抓取单个文件的超时时间，默认10秒
+	FetchTimeout time.Duration `mapstructure:"fetch_timeout"`
+	// MaxDomains 缓存的最大文件数，超过时不再抓取新的域名，默认10000
+	MaxDomains int `mapstructure:"max_domains"`
+	// Scheme 抓取使用的协议: https(默认) 或 http
+	Scheme string `mapstructure:"scheme"`
+	// RequireAuthorizedCampaigns 只参与供应链已授权的请求的推广计划
+	RequireAuthorizedCampaigns []string `mapstructure:"require_authorized_campaigns"`
+}
+
+// ProfileConfig 用户特征配置
+type ProfileConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// TTL 用户没有新的展示或点击时特征的保留时间，默认7天
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// IdentityConfig 身份图谱配置，用于跨设备频次控制
+type IdentityConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Topic 设备与用户关联的Kafka主题，为空时只通过HTTP接口接收
+	Topic   string `mapstructure:"topic"`
+	GroupID string `mapstructure:"group_id"`
+	// LinkTTL 关联的保留时间，每次关联时刷新，默认90天
+	LinkTTL time.Duration `mapstructure:"link_ttl"`
+	// CacheTTL 解析结果的本地缓存时间，默认5分钟
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+// PixelConfig 再营销像素配置
+type PixelConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// MembershipTTL 访客在人群中的有效期，从最近一次访问开始计算，默认30天
+	MembershipTTL time.Duration `mapstructure:"membership_ttl"`
+	// CookieDomain 访客ID Cookie的域名，为空时使用请求域名
+	CookieDomain string `mapstructure:"cookie_domain"`
+	// Timeout 写入人群的超时时间
+	Timeout time.Duration `mapstructure:"timeout"`
 }
 
 // PostgresConfig PostgreSQL配置
 type PostgresConfig struct {
-	Host            string        `yaml:"host"`
-	Port            int           `yaml:"port"`
-	User            string        `yaml:"user"`
-	Password        string        `yaml:"password"`
-	DBName          string        `yaml:"dbname"`
-	SSLMode         string        `yaml:"sslmode"`
-	MaxOpenConns    int           `yaml:"max_open_conns"`
-	MaxIdleConns    int           `yaml:"max_idle_conns"`
-	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
-	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	Host            string        `mapstructure:"host"`
+	Port            int           `mapstructure:"port"`
+	User            string        `mapstructure:"user"`
+	Password        string        `mapstructure:"password"`
+	DBName          string        `mapstructure:"dbname"`
+	SSLMode         string        `mapstructure:"sslmode"`
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// SlowThreshold 慢SQL日志阈值，为0时不记录
+	SlowThreshold time.Duration `mapstructure:"slow_threshold"`
+	// QueryTimeout 未设置截止时间的语句的超时时间，默认5秒
+	QueryTimeout time.Duration `mapstructure:"query_timeout"`
+	// TxTimeout 未设置截止时间的事务的超时时间，默认30秒
+	TxTimeout time.Duration `mapstructure:"tx_timeout"`
+	// Replicas 只读副本，只读的查询发往健康的副本，没有健康的副本时发往主库
+	Replicas []PostgresReplicaConfig `mapstructure:"replicas"`
+	// ReplicaCheckInterval 只读副本健康检查间隔，默认5秒
+	ReplicaCheckInterval time.Duration `mapstructure:"replica_check_interval"`
+}
+
+// PostgresReplicaConfig PostgreSQL只读副本配置，用户名、密码和连接池等参数与主库相同
+type PostgresReplicaConfig struct {
+	Host string `mapstructure:"host"`
+	Port int    `mapstructure:"port"`
 }
 
 var (
@@ -218,6 +1174,31 @@ func validateConfig(cfg *Config) error {
 	if cfg.Server.Port <= 0 {
 		return fmt.Errorf("无效的服务器端口: %d", cfg.Server.Port)
 	}
+	for name, l := range map[string]RequestLimitConfig{
+		"default": cfg.Server.Limits.Default,
+		"bid":     cfg.Server.Limits.Bid,
+		"event":   cfg.Server.Limits.Event,
+	} {
+		if l.MaxBodyBytes < 0 || l.ReadTimeout < 0 {
+			return fmt.Errorf("无效的%s请求限制: max_body_bytes=%d, read_timeout=%v", name, l.MaxBodyBytes, l.ReadTimeout)
+		}
+	}
+	if d := cfg.HTTPClient.DNS; d.TTL < 0 || d.StaleTTL < 0 || d.LookupTimeout < 0 {
+		return fmt.Errorf("无效的出站请求DNS缓存配置: ttl=%v, stale_ttl=%v, lookup_timeout=%v", d.TTL, d.StaleTTL, d.LookupTimeout)
+	}
+	for _, h := range cfg.HTTPClient.DNS.Hosts {
+		if h.Host == "" || h.TTL <= 0 {
+			return fmt.Errorf("无效的域名DNS缓存时间: host=%s, ttl=%v", h.Host, h.TTL)
+		}
+	}
+	if err := validateHTTPClient("default", cfg.HTTPClient.Default); err != nil {
+		return err
+	}
+	for name, c := range cfg.HTTPClient.Destinations {
+		if err := validateHTTPClient(name, c); err != nil {
+			return err
+		}
+	}
 
 	// 验证流量配置
 	if cfg.Traffic.QPS <= 0 {
@@ -226,6 +1207,32 @@ func validateConfig(cfg *Config) error {
 	if cfg.Traffic.Burst <= 0 {
 		return fmt.Errorf("无效的突发请求限制: %d", cfg.Traffic.Burst)
 	}
+	if cfg.Traffic.RTAShare < 0 || cfg.Traffic.RTAShare >= 1 {
+		return fmt.Errorf("无效的RTA阶段时间占比: %f", cfg.Traffic.RTAShare)
+	}
+	if cfg.Traffic.MaxTMax > 0 && cfg.Traffic.DefaultTMax > cfg.Traffic.MaxTMax {
+		return fmt.Errorf("默认tmax不能大于最大tmax: %v > %v", cfg.Traffic.DefaultTMax, cfg.Traffic.MaxTMax)
+	}
+	if e := cfg.Traffic.Enrichment; e.TTL < 0 || e.MaxEntries < 0 {
+		return fmt.Errorf("无效的请求上下文缓存配置: ttl=%v, max_entries=%d", e.TTL, e.MaxEntries)
+	}
+	if c := cfg.Traffic.Concurrency; c.MaxInFlight < 0 || c.MaxQueue < 0 || c.QueueTimeout < 0 || c.CPUThreshold < 0 || c.CPUThreshold >= 1 {
+		return fmt.Errorf("无效的并发限制配置: max_in_flight=%d, max_queue=%d, queue_timeout=%v, cpu_threshold=%f",
+			c.MaxInFlight, c.MaxQueue, c.QueueTimeout, c.CPUThreshold)
+	}
+	if a := cfg.Traffic.Adaptive; a.Enabled {
+		if a.MinQPS < 0 || a.MinQPS > cfg.Traffic.QPS {
+			return fmt.Errorf("自适应限流的最小QPS必须在0到traffic.qps之间: %f", a.MinQPS)
+		}
+		if a.DecreaseFactor < 0 || a.DecreaseFactor >= 1 || a.IncreaseStep < 0 || a.IncreaseStep > 1 {
+			return fmt.Errorf("无效的自适应限流调整系数: decrease_factor=%f, increase_step=%f", a.DecreaseFactor, a.IncreaseStep)
+		}
+		for _, d := range []DependencyThresholdConfig{a.Redis, a.RTA} {
+			if d.MaxLatency < 0 || d.MaxErrorRate < 0 || d.MaxErrorRate > 1 {
+				return fmt.Errorf("无效的下游异常阈值: max_latency=%v, max_error_rate=%f", d.MaxLatency, d.MaxErrorRate)
+			}
+		}
+	}
 
 	// 验证RTA配置
 	if cfg.RTA.BaseURL == "" {
@@ -234,6 +1241,351 @@ func validateConfig(cfg *Config) error {
 	if cfg.RTA.Timeout <= 0 {
 		return fmt.Errorf("无效的RTA超时时间: %v", cfg.RTA.Timeout)
 	}
+	if cfg.RTA.RetryTimes < 0 || cfg.RTA.RetryDelay < 0 {
+		return fmt.Errorf("无效的RTA重试配置: retry_times=%d, retry_delay=%v", cfg.RTA.RetryTimes, cfg.RTA.RetryDelay)
+	}
+	if cfg.RTA.Lookup.HedgeDelay < 0 || cfg.RTA.Lookup.StaleTTL < 0 {
+		return fmt.Errorf("无效的RTA查询配置: hedge_delay=%v, stale_ttl=%v", cfg.RTA.Lookup.HedgeDelay, cfg.RTA.Lookup.StaleTTL)
+	}
+	if cfg.RTA.Lookup.PreferStale && cfg.RTA.Lookup.StaleTTL == 0 {
+		return fmt.Errorf("RTA查询开启prefer_stale时需要配置stale_ttl")
+	}
+	taskIDs := make(map[string]bool, len(cfg.RTA.Tasks))
+	boundCampaigns := make(map[string]string)
+	for _, task := range cfg.RTA.Tasks {
+		if task.TaskID == "" {
+			return fmt.Errorf("RTA任务ID不能为空")
+		}
+		if taskIDs[task.TaskID] {
+			return fmt.Errorf("RTA任务ID重复: %s", task.TaskID)
+		}
+		taskIDs[task.TaskID] = true
+		for _, campaignID := range task.Campaigns {
+			if other, ok := boundCampaigns[campaignID]; ok {
+				return fmt.Errorf("推广计划%s同时绑定了RTA任务%s和%s", campaignID, other, task.TaskID)
+			}
+			boundCampaigns[campaignID] = task.TaskID
+		}
+	}
+
+	// 验证交易平台配置
+	exchangeIDs := make(map[string]bool, len(cfg.Exchanges))
+	for _, ex := range cfg.Exchanges {
+		if ex.ID == "" {
+			return fmt.Errorf("交易平台ID不能为空")
+		}
+		if exchangeIDs[ex.ID] {
+			return fmt.Errorf("交易平台ID重复: %s", ex.ID)
+		}
+		exchangeIDs[ex.ID] = true
+		if ex.PriceEncoding == "encrypted" && len(cfg.Event.PriceKeys[ex.ID]) == 0 {
+			return fmt.Errorf("交易平台%s使用加密成交价但未配置解密密钥", ex.ID)
+		}
+		if ex.QPS < 0 {
+			return fmt.Errorf("交易平台%s的QPS无效: %f", ex.ID, ex.QPS)
+		}
+		if audit := ex.CreativeAudit; audit.Enabled {
+			if audit.URL == "" {
+				return fmt.Errorf("交易平台%s启用素材送审但未配置url", ex.ID)
+			}
+			if audit.Mode == "webhook" && audit.WebhookToken == "" {
+				return fmt.Errorf("交易平台%s使用webhook同步审核状态但未配置webhook_token", ex.ID)
+			}
+		}
+	}
+
+	// 验证竞价成功通知去重配置，去重键先于出价记录过期时重试的通知会被重复记录
+	if ttl := cfg.Event.WinDedupTTL; ttl < 0 || (ttl > 0 && ttl < cfg.Event.BidRecordTTL) {
+		return fmt.Errorf("竞价成功通知去重保留时间不能小于出价记录保留时间: %s", ttl)
+	}
+
+	// 验证广告地址配置
+	if adServing := cfg.Event.AdServing; adServing.Enabled {
+		if u, err := url.Parse(adServing.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("无效的广告地址前缀: %s", adServing.BaseURL)
+		}
+		if len(adServing.Secret) < 32 {
+			return fmt.Errorf("广告地址的令牌签名密钥至少需要32个字符")
+		}
+	}
+
+	// 验证底价情报配置
+	if cfg.Bidding.Floor.MaxOverbidRatio != 0 && cfg.Bidding.Floor.MaxOverbidRatio < 1 {
+		return fmt.Errorf("无效的最大溢价倍数: %f", cfg.Bidding.Floor.MaxOverbidRatio)
+	}
+
+	// 验证请求底价的执行配置
+	switch cfg.Bidding.FloorEnforcement.Mode {
+	case "", "hard", "off":
+	default:
+		return fmt.Errorf("无效的底价执行方式: %s", cfg.Bidding.FloorEnforcement.Mode)
+	}
+	switch cfg.Bidding.FloorEnforcement.UnknownCurrency {
+	case "", "skip", "system":
+	default:
+		return fmt.Errorf("无效的未知底价货币处理方式: %s", cfg.Bidding.FloorEnforcement.UnknownCurrency)
+	}
+	if c := cfg.Bidding.FloorEnforcement.Currency; c != "" && len(c) != 3 {
+		return fmt.Errorf("无效的系统货币: %s", c)
+	}
+	for currency, rate := range cfg.Bidding.FloorEnforcement.Rates {
+		if len(currency) != 3 || rate <= 0 {
+			return fmt.Errorf("无效的货币汇率: %s=%f", currency, rate)
+		}
+	}
+
+	// 验证RTA出价系数范围
+	if rta := cfg.Bidding.RTA; rta.MinMultiplier < 0 || rta.MaxMultiplier < 0 ||
+		(rta.MaxMultiplier > 0 && rta.MinMultiplier > rta.MaxMultiplier) {
+		return fmt.Errorf("无效的RTA出价系数范围: %f-%f", rta.MinMultiplier, rta.MaxMultiplier)
+	}
+	advertisers := make(map[string]bool, len(cfg.Bidding.Participation.Advertisers))
+	advertiserCampaigns := make(map[string]string)
+	for _, a := range cfg.Bidding.Participation.Advertisers {
+		if a.AdvertiserID == "" {
+			return fmt.Errorf("参与率配置的广告主ID不能为空")
+		}
+		if advertisers[a.AdvertiserID] {
+			return fmt.Errorf("参与率配置的广告主ID重复: %s", a.AdvertiserID)
+		}
+		advertisers[a.AdvertiserID] = true
+		if a.Rate <= 0 || a.Rate > 1 {
+			return fmt.Errorf("无效的广告主参与率: %s=%f", a.AdvertiserID, a.Rate)
+		}
+		for _, campaignID := range a.Campaigns {
+			if other, ok := advertiserCampaigns[campaignID]; ok {
+				return fmt.Errorf("推广计划%s同时属于广告主%s和%s", campaignID, other, a.AdvertiserID)
+			}
+			advertiserCampaigns[campaignID] = a.AdvertiserID
+		}
+	}
+
+	// 验证供应链配置
+	if s := cfg.SupplyChain; s.RefreshInterval < 0 || s.FetchTimeout < 0 || s.MaxDomains < 0 {
+		return fmt.Errorf("无效的供应链验证配置: refresh_interval=%v, fetch_timeout=%v, max_domains=%d", s.RefreshInterval, s.FetchTimeout, s.MaxDomains)
+	}
+	switch cfg.SupplyChain.Scheme {
+	case "", "https", "http":
+	default:
+		return fmt.Errorf("无效的供应链文件抓取协议: %s", cfg.SupplyChain.Scheme)
+	}
+	if len(cfg.SupplyChain.RequireAuthorizedCampaigns) > 0 && !cfg.SupplyChain.Enabled {
+		return fmt.Errorf("推广计划要求已授权的供应链时必须启用供应链验证")
+	}
+
+	// 验证时区配置
+	if err := validateTimezones(cfg.Timezone); err != nil {
+		return err
+	}
+
+	// 验证管理后台跨域配置
+	if c := cfg.Admin.CORS; c.MaxAge < 0 {
+		return fmt.Errorf("无效的跨域预检缓存时间: %v", c.MaxAge)
+	}
+	for _, origin := range cfg.Admin.CORS.AllowedOrigins {
+		if origin == "*" && cfg.Admin.CORS.AllowCredentials {
+			return fmt.Errorf("允许携带认证信息时跨域来源不能为*")
+		}
+		if origin == "" {
+			return fmt.Errorf("跨域来源不能为空")
+		}
+	}
+	if err := ValidateIPAllowlist(cfg.Admin.Allowlist); err != nil {
+		return err
+	}
+	if a := cfg.Admin.Auth; a.Enabled {
+		if a.SessionIdleTimeout < 0 || a.SessionMaxAge < 0 || a.LockoutDuration < 0 || a.MaxLoginAttempts < 0 {
+			return fmt.Errorf("无效的管理后台认证配置: session_idle_timeout=%v, session_max_age=%v, lockout_duration=%v, max_login_attempts=%d",
+				a.SessionIdleTimeout, a.SessionMaxAge, a.LockoutDuration, a.MaxLoginAttempts)
+		}
+		// bcrypt的代价取值为4到31
+		if a.BcryptCost != 0 && (a.BcryptCost < 4 || a.BcryptCost > 31) {
+			return fmt.Errorf("无效的bcrypt代价: %d", a.BcryptCost)
+		}
+		for _, token := range a.APITokens {
+			if len(token) < 32 {
+				return fmt.Errorf("管理后台API令牌长度不能少于32个字符")
+			}
+		}
+	}
+
+	if d := cfg.Admin.Dashboard; d.RefreshInterval < 0 || d.TopCampaigns < 0 || d.MinWinRate < 0 || d.MinWinRate > 1 || d.MinBids < 0 {
+		return fmt.Errorf("无效的管理后台看板配置: %+v", d)
+	}
+
+	// 验证流量分布配置
+	if f := cfg.Stats.Forecast; f.FlushInterval < 0 || f.RetentionDays < 0 {
+		return fmt.Errorf("无效的流量分布配置: flush_interval=%v, retention_days=%d", f.FlushInterval, f.RetentionDays)
+	}
+
+	// 验证竞价漏斗配置
+	if f := cfg.Stats.Funnel; f.BatchSize < 0 || f.FlushInterval < 0 || f.RetentionDays < 0 {
+		return fmt.Errorf("无效的竞价漏斗配置: %+v", f)
+	}
+	if cfg.Stats.Funnel.Enabled && cfg.Stats.Funnel.GroupID == "" {
+		return fmt.Errorf("启用竞价漏斗时必须设置消费组")
+	}
+
+	// 验证供应路径表现配置
+	if p := cfg.Stats.Placements; p.LookbackDays < 0 || p.RefreshInterval < 0 || p.MinImpressions < 0 ||
+		p.MinMultiplier < 0 || p.MinMultiplier > 1 || (p.MaxMultiplier != 0 && p.MaxMultiplier < 1) {
+		return fmt.Errorf("无效的供应路径表现配置: %+v", p)
+	}
+	if p := cfg.Stats.Placements; p.Enabled {
+		if !cfg.Stats.Funnel.Enabled {
+			return fmt.Errorf("汇总供应路径表现时必须启用竞价漏斗")
+		}
+		if p.LookbackDays > 0 && cfg.Stats.Funnel.RetentionDays > 0 && p.LookbackDays > cfg.Stats.Funnel.RetentionDays {
+			return fmt.Errorf("供应路径表现的汇总天数(%d)超过竞价漏斗的保留天数(%d)", p.LookbackDays, cfg.Stats.Funnel.RetentionDays)
+		}
+	}
+
+	// 验证报表维度配置
+	if cfg.Stats.Dimensions.RetentionDays < 0 {
+		return fmt.Errorf("无效的报表维度保留天数: %d", cfg.Stats.Dimensions.RetentionDays)
+	}
+
+	// 验证事件编码配置
+	switch e := cfg.Stats.Encoding; e.Format {
+	case "", "json":
+	case "protobuf":
+		if e.SchemaRegistry.URL == "" {
+			return fmt.Errorf("使用Protobuf编码事件时必须设置Schema Registry地址")
+		}
+		if e.SchemaRegistry.Timeout < 0 {
+			return fmt.Errorf("无效的Schema Registry超时: %v", e.SchemaRegistry.Timeout)
+		}
+		switch e.SchemaRegistry.Compatibility {
+		case "", "BACKWARD", "BACKWARD_TRANSITIVE", "FORWARD", "FORWARD_TRANSITIVE", "FULL", "FULL_TRANSITIVE", "NONE":
+		default:
+			return fmt.Errorf("无效的Schema兼容性级别: %s", e.SchemaRegistry.Compatibility)
+		}
+	default:
+		return fmt.Errorf("无效的事件编码格式: %s", e.Format)
+	}
+
+	// 验证预算配置
+	if v := cfg.Budget.Velocity; v.Interval < 0 || v.MinSpend < 0 || v.ResumeGrace < 0 ||
+		v.Multiplier < 0 || (v.Multiplier > 0 && v.Multiplier <= 1) {
+		return fmt.Errorf("无效的消耗速度保护配置: interval=%v, multiplier=%v, min_spend=%v, resume_grace=%v",
+			v.Interval, v.Multiplier, v.MinSpend, v.ResumeGrace)
+	}
+	if cfg.Budget.SnapshotInterval < 0 {
+		return fmt.Errorf("无效的预算快照间隔: %v", cfg.Budget.SnapshotInterval)
+	}
+
+	// 验证事件缓冲配置
+	if b := cfg.Stats.Buffer; b.Enabled {
+		switch b.DropPolicy {
+		case "", "drop_newest", "drop_oldest":
+		default:
+			return fmt.Errorf("无效的事件缓冲丢弃策略: %s", b.DropPolicy)
+		}
+		if b.MaxEvents < 0 || b.BatchSize < 0 || b.RetryInterval < 0 || b.WriteTimeout < 0 {
+			return fmt.Errorf("无效的事件缓冲配置: %+v", b)
+		}
+		if b.Spill.Enabled && b.Spill.Dir == "" {
+			return fmt.Errorf("启用事件磁盘缓冲时必须设置目录")
+		}
+		if b.Spill.MaxBytes < 0 || b.Spill.SegmentBytes < 0 {
+			return fmt.Errorf("无效的事件磁盘缓冲大小: %+v", b.Spill)
+		}
+	}
+
+	// 验证故障注入配置，生产环境不能启用
+	if cfg.Chaos.Enabled {
+		if cfg.Server.Mode != "debug" && cfg.Server.Mode != "test" {
+			return fmt.Errorf("故障注入只能在非生产环境启用，server.mode为%q", cfg.Server.Mode)
+		}
+		for name, f := range map[string]FaultConfig{
+			"redis":    cfg.Chaos.Redis,
+			"kafka":    cfg.Chaos.Kafka,
+			"rta":      cfg.Chaos.RTA,
+			"postgres": cfg.Chaos.Postgres,
+		} {
+			if f.LatencyRate < 0 || f.LatencyRate > 1 || f.ErrorRate < 0 || f.ErrorRate > 1 || f.Latency < 0 || (f.LatencyRate > 0 && f.Latency == 0) {
+				return fmt.Errorf("无效的%s故障注入配置: %+v", name, f)
+			}
+		}
+	}
+
+	// 验证回收站配置
+	if cfg.Trash.RetentionDays < 0 {
+		return fmt.Errorf("无效的回收站保留天数: %d", cfg.Trash.RetentionDays)
+	}
+
+	// 验证Webhook配置
+	if cfg.Webhook.MaxRetries < 0 {
+		return fmt.Errorf("无效的Webhook重试次数: %d", cfg.Webhook.MaxRetries)
+	}
+
+	// 验证跟踪投递回执配置
+	if r := cfg.Tracking.Receipts; r.BufferSize < 0 || r.BatchSize < 0 || r.FlushInterval < 0 || r.RetentionDays < 0 {
+		return fmt.Errorf("无效的跟踪投递回执配置: %+v", r)
+	}
+	if cfg.Tracking.Receipts.Enabled && cfg.Postgres.Host == "" {
+		return fmt.Errorf("启用跟踪投递回执时必须配置PostgreSQL")
+	}
+
+	// 验证自动化规则配置
+	if a := cfg.Automation; a.Interval < 0 || a.DefaultCooldown < 0 || a.MaxChangePercent < 0 || a.MaxChangePercent > 100 ||
+		a.MaxDailyChangePercent < 0 || a.MinBidPrice < 0 || a.MaxBidPrice < 0 || (a.MaxBidPrice > 0 && a.MaxBidPrice < a.MinBidPrice) {
+		return fmt.Errorf("无效的自动化规则配置: %+v", a)
+	}
+	// 两个窗口都从按小时统计读取，合计不能超过其8天的保留时间
+	if f := cfg.Automation.Fatigue; f.Interval < 0 || f.RecentWindow < 0 || f.BaselineWindow < 0 || f.Cooldown < 0 ||
+		f.MinImpressions < 0 || f.MinWeight < 0 || f.WeightFactor < 0 || f.WeightFactor >= 1 ||
+		f.DownweightDecay < 0 || f.DownweightDecay > 1 || f.PauseDecay < 0 || f.PauseDecay > 1 ||
+		(f.PauseDecay > 0 && f.PauseDecay < f.DownweightDecay) || f.RecentWindow+f.BaselineWindow > 8*24*time.Hour {
+		return fmt.Errorf("无效的素材疲劳检测配置: %+v", f)
+	}
+
+	// 验证计费账本配置
+	if l := cfg.Ledger; l.BatchSize < 0 || l.FlushInterval < 0 || l.CloseInterval < 0 || l.ResolveCacheTTL < 0 {
+		return fmt.Errorf("无效的计费账本配置: %+v", l)
+	}
+	if cfg.Ledger.Enabled && cfg.Ledger.GroupID == "" {
+		return fmt.Errorf("启用计费账本时必须设置消费组")
+	}
+
+	// 验证Kafka主题配置
+	if t := cfg.Kafka.Topics; t.Partitions < 0 || t.ReplicationFactor < 0 || t.Retention < 0 || t.Timeout < 0 {
+		return fmt.Errorf("无效的Kafka主题配置: partitions=%d, replication_factor=%d, retention=%v, timeout=%v",
+			t.Partitions, t.ReplicationFactor, t.Retention, t.Timeout)
+	}
+	for _, o := range cfg.Kafka.Topics.Overrides {
+		if o.Name == "" || o.Partitions < 0 || o.Retention < 0 {
+			return fmt.Errorf("无效的Kafka主题覆盖配置: name=%q, partitions=%d, retention=%v", o.Name, o.Partitions, o.Retention)
+		}
+	}
+
+	// 验证指标配置
+	if p := cfg.Metrics.AggregatePath; p != "" && p == cfg.Metrics.Path {
+		return fmt.Errorf("预聚合指标路径不能与指标路径相同: %s", p)
+	}
+
+	// 验证计费配置
+	if b := cfg.Billing; b.PlatformMargin < 0 || b.TaxRate < 0 || b.TaxRate >= 1 {
+		return fmt.Errorf("无效的计费配置: platform_margin=%v, tax_rate=%v", b.PlatformMargin, b.TaxRate)
+	}
+
+	// 验证分布式锁配置
+	if cfg.Lock.TTL < 0 || (cfg.Lock.TTL > 0 && cfg.Lock.TTL < time.Second) {
+		return fmt.Errorf("无效的分布式锁租约时长: %v", cfg.Lock.TTL)
+	}
+
+	// 验证选主配置
+	if cfg.Leader.RetryInterval < 0 {
+		return fmt.Errorf("无效的选主重试间隔: %v", cfg.Leader.RetryInterval)
+	}
+	if l := cfg.Leader; l.AdminElection != "" && l.AdminElection == l.Election {
+		return fmt.Errorf("管理后台与竞价服务不能使用相同的选主组: %s", l.Election)
+	}
+
+	// 验证实例注册配置
+	if c := cfg.Cluster; c.HeartbeatInterval < 0 || c.ShardCount < 0 {
+		return fmt.Errorf("无效的实例注册配置: %+v", c)
+	}
 
 	// 验证Redis配置
 	if len(cfg.Redis.Addresses) == 0 {
@@ -248,6 +1600,74 @@ func validateConfig(cfg *Config) error {
 	return nil
 }
 
+// ValidateIPAllowlist 校验IP白名单中的网段，配置中心下发的白名单应用前同样需要校验
+func ValidateIPAllowlist(cfg IPAllowlistConfig) error {
+	for _, cidrs := range [][]string{cfg.CIDRs, cfg.TrustedProxies} {
+		for _, cidr := range cidrs {
+			if _, err := netip.ParsePrefix(cidr); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(cidr); err != nil {
+				return fmt.Errorf("无效的IP白名单网段: %q", cidr)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTimezones 验证时区名称，推广计划不能同时属于多个广告主
+func validateTimezones(cfg TimezoneConfig) error {
+	if cfg.Default != "" {
+		if _, err := time.LoadLocation(cfg.Default); err != nil {
+			return fmt.Errorf("无效的默认时区: %s", cfg.Default)
+		}
+	}
+	advertisers := make(map[string]bool, len(cfg.Advertisers))
+	advertiserCampaigns := make(map[string]string)
+	for _, a := range cfg.Advertisers {
+		if a.AdvertiserID == "" {
+			return fmt.Errorf("时区配置的广告主ID不能为空")
+		}
+		if advertisers[a.AdvertiserID] {
+			return fmt.Errorf("时区配置的广告主ID重复: %s", a.AdvertiserID)
+		}
+		advertisers[a.AdvertiserID] = true
+		if _, err := time.LoadLocation(a.Timezone); err != nil || a.Timezone == "" {
+			return fmt.Errorf("无效的广告主时区: %s=%s", a.AdvertiserID, a.Timezone)
+		}
+		for _, campaignID := range a.Campaigns {
+			if other, ok := advertiserCampaigns[campaignID]; ok {
+				return fmt.Errorf("推广计划%s同时属于广告主%s和%s", campaignID, other, a.AdvertiserID)
+			}
+			advertiserCampaigns[campaignID] = a.AdvertiserID
+		}
+	}
+	campaigns := make(map[string]bool, len(cfg.Campaigns))
+	for _, c := range cfg.Campaigns {
+		if c.CampaignID == "" {
+			return fmt.Errorf("时区配置的推广计划ID不能为空")
+		}
+		if campaigns[c.CampaignID] {
+			return fmt.Errorf("时区配置的推广计划ID重复: %s", c.CampaignID)
+		}
+		campaigns[c.CampaignID] = true
+		if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" {
+			return fmt.Errorf("无效的推广计划时区: %s=%s", c.CampaignID, c.Timezone)
+		}
+	}
+	return nil
+}
+
+// validateHTTPClient 验证出站HTTP请求配置，所有项都不能为负数
+func validateHTTPClient(name string, c HTTPClientConfig) error {
+	if c.Timeout < 0 || c.MaxRetries < 0 || c.RetryBackoff < 0 || c.MaxRetryBackoff < 0 ||
+		c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 ||
+		c.IdleConnTimeout < 0 || c.DialTimeout < 0 || c.KeepAlive < 0 || c.TLSHandshakeTimeout < 0 {
+		return fmt.Errorf("无效的%s出站请求配置: %+v", name, c)
+	}
+	return nil
+}
+
 // GetConfig 获取全局配置
 func GetConfig() *Config {
 	return &GlobalConfig
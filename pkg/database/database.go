@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: database.go
+ * Project: simple-dsp
+ * Description: 统一的数据访问层，所有仓储通过GORM访问PostgreSQL
+ *
+ * 主要功能:
+ * - 按配置打开PostgreSQL连接并设置连接池
+ * - 为语句设置默认超时，记录慢SQL日志和语句指标
+ * - 为语句和事务创建OpenTelemetry span
+ * - 标记为只读的查询发往健康的只读副本，写入和事务使用主库
+ * - 提供带超时的事务辅助函数，序列化失败或死锁时可重新执行事务
+ *
+ * 实现细节:
+ * - 超时、慢SQL日志、指标和追踪通过GORM插件的回调实现，对所有仓储生效
+ * - 指标和span按WithQueryName设置的语句名称区分，未命名时使用表名
+ * - 调用方的上下文已有截止时间时不再设置默认超时
+ * - 事务内的语句使用事务的截止时间
+ * - 只读副本定时检查连接，查询遇到连接错误时立即标记为不可用，没有可用副本时回退到主库
+ * - 打开连接时按指数退避重试连接测试，数据库晚于服务启动时不会直接失败
+ *
+ * 依赖关系:
+ * - gorm.io/gorm
+ * - gorm.io/driver/postgres
+ * - go.opentelemetry.io/otel
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ * - simple-dsp/pkg/metrics
+ * - simple-dsp/pkg/retry
+ *
+ * 注意事项:
+ * - 仓储应通过WithContext传入请求的上下文
+ * - Rows和Row返回的结果在回调结束后才读取，不设置默认超时
+ * - 慢SQL日志和span只记录带占位符的语句和参数个数，不记录参数值
+ * - 副本有复制延迟，需要读到刚写入的数据时不要使用ReadOnly
+ */
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
+)
+
+const (
+	// DefaultQueryTimeout 未设置截止时间的语句默认的超时时间
+	DefaultQueryTimeout = 5 * time.Second
+	// DefaultTxTimeout 未设置截止时间的事务默认的超时时间
+	DefaultTxTimeout = 30 * time.Second
+
+	// pingTimeout 打开连接时单次测试连接的超时时间
+	pingTimeout = 5 * time.Second
+	// pingRetries 打开连接时测试连接失败后的重试次数
+	pingRetries = 4
+	// pingBackoff 第一次重试连接测试前的等待时间，之后每次翻倍
+	pingBackoff = time.Second
+)
+
+// Open 按配置连接PostgreSQL主库和只读副本，注册超时、慢SQL日志、语句指标和追踪
+// 主库连接失败时返回错误；副本暂时不可用时不返回错误，由健康检查恢复
+func Open(cfg config.PostgresConfig, log *logger.Logger, m *metrics.Metrics) (*gorm.DB, error) {
+	db, sqlDB, err := connect(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("连接PostgreSQL失败: %w", err)
+	}
+
+	policy := retry.Policy{
+		MaxRetries:     pingRetries,
+		InitialBackoff: pingBackoff,
+		Jitter:         0.2,
+		OnRetry: func(n int, err error, wait time.Duration) {
+			log.Warn("PostgreSQL连接测试失败，稍后重试", "retry", n, "wait", wait, "error", err)
+		},
+	}
+	err = retry.Do(context.Background(), policy, func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		defer cancel()
+		return sqlDB.PingContext(ctx)
+	})
+	if err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("PostgreSQL连接测试失败: %w", err)
+	}
+
+	if err := Instrument(db, cfg, log, m); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	replicas := make([]Replica, 0, len(cfg.Replicas))
+	for _, replicaCfg := range cfg.Replicas {
+		replicaDBCfg := cfg
+		replicaDBCfg.Host = replicaCfg.Host
+		replicaDBCfg.Port = replicaCfg.Port
+		_, replicaDB, err := connect(replicaDBCfg)
+		if err != nil {
+			for _, r := range replicas {
+				r.DB.Close()
+			}
+			sqlDB.Close()
+			return nil, fmt.Errorf("连接PostgreSQL只读副本失败: %w", err)
+		}
+		replicas = append(replicas, Replica{Name: fmt.Sprintf("%s:%d", replicaCfg.Host, replicaCfg.Port), DB: replicaDB})
+	}
+	if err := UseReplicas(db, replicas, cfg.ReplicaCheckInterval); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	log.Info("PostgreSQL连接成功", "host", cfg.Host, "port", cfg.Port, "replicas", len(replicas))
+	return db, nil
+}
+
+// Close 停止只读副本的健康检查并关闭主库和副本的连接池
+func Close(db *gorm.DB) error {
+	if p, ok := db.Config.Plugins[pluginName].(*plugin); ok && p.replicas != nil {
+		p.replicas.stop()
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// connect 按配置创建连接池，不测试连接
+func connect(cfg config.PostgresConfig) (*gorm.DB, *sql.DB, error) {
+	dsn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		cfg.Host,
+		cfg.Port,
+		cfg.User,
+		cfg.Password,
+		cfg.DBName,
+		cfg.SSLMode,
+	)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:               gormlogger.Default.LogMode(gormlogger.Silent),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	return db, sqlDB, nil
+}
+
+// Transaction 在事务中执行fn，fn返回错误或panic时回滚
+// ctx未设置截止时间时使用配置的事务超时，事务内的语句作为事务span的子span
+func Transaction(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := DefaultTxTimeout
+		if p, ok := db.Config.Plugins[pluginName].(*plugin); ok {
+			timeout = p.txTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	name := "db.transaction"
+	if queryName := QueryName(ctx); queryName != "" {
+		name = queryName + " transaction"
+	}
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(semconv.DBSystemPostgreSQL))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+	return db.WithContext(ctx).Transaction(fn)
+}
@@ -0,0 +1,10 @@
+package database
+
+import "errors"
+
+var (
+	// ErrNotInstrumented 表示db未通过Instrument注册数据访问层插件
+	ErrNotInstrumented = errors.New("数据库未注册数据访问层插件")
+	// ErrReplicasConfigured 表示已设置过只读副本
+	ErrReplicasConfigured = errors.New("已设置只读副本")
+)
@@ -0,0 +1,231 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	pluginName = "simple-dsp:database"
+	// tracerName 语句追踪的instrumentation名称
+	tracerName = "simple-dsp/pkg/database"
+
+	stateKey = "database:state"
+)
+
+// statementState 语句执行期间的状态，语句结束后恢复原来的上下文，同一会话的后续语句不受影响
+type statementState struct {
+	start  time.Time
+	parent context.Context
+	cancel context.CancelFunc
+	span   trace.Span
+	// replica 发往只读副本的查询所用的副本，pool为原来的连接池
+	replica *replica
+	pool    gorm.ConnPool
+}
+
+// plugin 语句超时、慢SQL日志、语句指标和追踪插件
+type plugin struct {
+	queryTimeout  time.Duration
+	txTimeout     time.Duration
+	slowThreshold time.Duration
+	tracer        trace.Tracer
+	logger        *logger.Logger
+	metrics       *metrics.DatabaseMetrics
+	replicas      *replicaSet
+}
+
+// Instrument 为db注册语句超时、慢SQL日志、语句指标和追踪，m为nil时不记录指标
+// 追踪使用全局的OpenTelemetry TracerProvider，未设置时不产生span
+func Instrument(db *gorm.DB, cfg config.PostgresConfig, log *logger.Logger, m *metrics.Metrics) error {
+	p := &plugin{
+		queryTimeout:  cfg.QueryTimeout,
+		txTimeout:     cfg.TxTimeout,
+		slowThreshold: cfg.SlowThreshold,
+		tracer:        otel.Tracer(tracerName),
+		logger:        log,
+	}
+	if p.queryTimeout <= 0 {
+		p.queryTimeout = DefaultQueryTimeout
+	}
+	if p.txTimeout <= 0 {
+		p.txTimeout = DefaultTxTimeout
+	}
+	if m != nil {
+		p.metrics = m.Database
+	}
+	return db.Use(p)
+}
+
+// Name 插件名称
+func (p *plugin) Name() string {
+	return pluginName
+}
+
+// Initialize 在各类语句的回调前后注册计时、超时和追踪
+// Row的结果在回调结束后才读取，不设置语句超时，也不记录行数
+func (p *plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register(pluginName+":before_create", p.before("create", true)),
+		cb.Create().After("gorm:create").Register(pluginName+":after_create", p.after("create")),
+		cb.Query().Before("gorm:query").Register(pluginName+":before_query", p.before("query", true)),
+		cb.Query().After("gorm:query").Register(pluginName+":after_query", p.after("query")),
+		cb.Update().Before("gorm:update").Register(pluginName+":before_update", p.before("update", true)),
+		cb.Update().After("gorm:update").Register(pluginName+":after_update", p.after("update")),
+		cb.Delete().Before("gorm:delete").Register(pluginName+":before_delete", p.before("delete", true)),
+		cb.Delete().After("gorm:delete").Register(pluginName+":after_delete", p.after("delete")),
+		cb.Row().Before("gorm:row").Register(pluginName+":before_row", p.before("row", false)),
+		cb.Row().After("gorm:row").Register(pluginName+":after_row", p.after("row")),
+		cb.Raw().Before("gorm:raw").Register(pluginName+":before_raw", p.before("raw", true)),
+		cb.Raw().After("gorm:raw").Register(pluginName+":after_raw", p.after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before 记录开始时间并开始span，上下文未设置截止时间时设置语句超时
+func (p *plugin) before(operation string, timeout bool) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		parent := db.Statement.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		state := &statementState{start: time.Now(), parent: parent}
+
+		ctx, span := p.tracer.Start(parent, spanName(parent, operation, db.Statement.Table),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBOperationName(operation)))
+		state.span = span
+
+		if _, ok := ctx.Deadline(); timeout && !ok {
+			ctx, state.cancel = context.WithTimeout(ctx, p.queryTimeout)
+		}
+		db.Statement.Context = ctx
+		if operation == "query" || operation == "row" {
+			p.route(db, state)
+		}
+		db.InstanceSet(stateKey, state)
+	}
+}
+
+// route 标记为只读且不在事务中的查询发往健康的只读副本，没有健康的副本时使用主库
+func (p *plugin) route(db *gorm.DB, state *statementState) {
+	if p.replicas == nil || !IsReadOnly(state.parent) {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+		return
+	}
+
+	target := "primary"
+	if r := p.replicas.pick(); r != nil {
+		state.replica = r
+		state.pool = db.Statement.ConnPool
+		db.Statement.ConnPool = r.DB
+		target = "replica"
+		state.span.SetAttributes(attribute.String("db.replica", r.Name))
+	}
+	if p.metrics != nil {
+		p.metrics.Reads.WithLabelValues(target).Inc()
+	}
+}
+
+// after 结束span并释放语句超时，记录指标和慢SQL
+func (p *plugin) after(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, _ := db.InstanceGet(stateKey)
+		state, ok := value.(*statementState)
+		if !ok {
+			return
+		}
+		db.InstanceSet(stateKey, nil)
+		ctx := db.Statement.Context
+		if state.cancel != nil {
+			state.cancel()
+		}
+		db.Statement.Context = state.parent
+		elapsed := time.Since(state.start)
+		if state.replica != nil {
+			db.Statement.ConnPool = state.pool
+			if db.Error != nil && isConnError(db.Error) {
+				p.replicas.setHealthy(state.replica, db.Error)
+			}
+		}
+
+		table := db.Statement.Table
+		name := QueryName(state.parent)
+		if name == "" {
+			name = table
+		}
+		if name == "" {
+			name = "unknown"
+		}
+		query := db.Statement.SQL.String()
+		failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+
+		if table != "" {
+			state.span.SetAttributes(semconv.DBCollectionName(table))
+		}
+		state.span.SetAttributes(semconv.DBQueryText(query), attribute.String("db.query.name", name))
+		if operation != "row" {
+			state.span.SetAttributes(attribute.Int64("db.rows_affected", db.RowsAffected))
+		}
+		if failed {
+			state.span.RecordError(db.Error)
+			state.span.SetStatus(codes.Error, db.Error.Error())
+		}
+		state.span.End()
+
+		if p.metrics != nil {
+			// 耗时以exemplar关联本次语句的追踪ID
+			if spanContext := state.span.SpanContext(); spanContext.IsValid() && metrics.TraceID(ctx) == "" {
+				ctx = metrics.WithTraceID(ctx, spanContext.TraceID().String())
+			}
+			metrics.ObserveWithTrace(ctx, p.metrics.Duration.WithLabelValues(name, operation), elapsed.Seconds())
+			if operation != "row" {
+				p.metrics.Rows.WithLabelValues(name, operation).Observe(float64(db.RowsAffected))
+			}
+			if failed {
+				p.metrics.Errors.WithLabelValues(name, operation).Inc()
+			}
+		}
+
+		if p.slowThreshold > 0 && elapsed > p.slowThreshold {
+			p.logger.Warn("慢SQL",
+				"name", name,
+				"query", query,
+				"args", len(db.Statement.Vars),
+				"table", table,
+				"duration_ms", elapsed.Milliseconds(),
+				"threshold_ms", p.slowThreshold.Milliseconds(),
+				"error", db.Error)
+		}
+	}
+}
+
+// spanName 返回语句的span名称，未命名时为操作和表名
+func spanName(ctx context.Context, operation, table string) string {
+	if name := QueryName(ctx); name != "" {
+		return name
+	}
+	if table == "" {
+		return "db." + operation
+	}
+	return "db." + operation + " " + table
+}
@@ -0,0 +1,17 @@
+package database
+
+import "context"
+
+type queryNameKey struct{}
+
+// WithQueryName 为上下文中执行的语句命名，指标和追踪按名称区分语句
+// 名称应为固定的字符串，如bidding.get_strategy，不能包含ID等变化的值
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// QueryName 返回上下文中的语句名称，未命名时返回空串
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameKey{}).(string)
+	return name
+}
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	// DefaultReplicaCheckInterval 只读副本默认的健康检查间隔
+	DefaultReplicaCheckInterval = 5 * time.Second
+
+	// replicaPingTimeout 健康检查的超时时间
+	replicaPingTimeout = 2 * time.Second
+)
+
+type readOnlyKey struct{}
+
+// ReadOnly 标记上下文中的查询为只读，配置了只读副本时发往健康的副本
+// 事务内的查询和写入始终使用主库；需要读到刚写入的数据时不要标记
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// IsReadOnly 返回上下文中的查询是否标记为只读
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(readOnlyKey{}).(bool)
+	return readOnly
+}
+
+// Replica 只读副本
+type Replica struct {
+	// Name 副本名称，用于日志和指标，一般为host:port
+	Name string
+	DB   *sql.DB
+}
+
+// replica 只读副本及其健康状态
+type replica struct {
+	Replica
+	healthy atomic.Bool
+}
+
+// replicaSet 只读副本集合，轮询选择健康的副本，定时检查副本的健康状态
+type replicaSet struct {
+	replicas []*replica
+	next     atomic.Uint32
+	interval time.Duration
+	logger   *logger.Logger
+	metrics  *metrics.DatabaseMetrics
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// UseReplicas 为已注册插件的db设置只读副本，同步检查一次健康状态后定时检查
+// interval为健康检查间隔，默认5秒；Close时停止检查并关闭副本的连接池
+func UseReplicas(db *gorm.DB, replicas []Replica, interval time.Duration) error {
+	p, ok := db.Config.Plugins[pluginName].(*plugin)
+	if !ok {
+		return ErrNotInstrumented
+	}
+	if p.replicas != nil {
+		return ErrReplicasConfigured
+	}
+	if len(replicas) == 0 {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultReplicaCheckInterval
+	}
+
+	set := &replicaSet{interval: interval, logger: p.logger, metrics: p.metrics}
+	for _, r := range replicas {
+		set.replicas = append(set.replicas, &replica{Replica: r})
+	}
+	set.start()
+	p.replicas = set
+	return nil
+}
+
+// pick 轮询返回一个健康的副本，没有健康的副本时返回nil
+func (s *replicaSet) pick() *replica {
+	n := uint32(len(s.replicas))
+	start := s.next.Add(1)
+	for i := uint32(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+// start 检查一次所有副本并启动定时检查
+func (s *replicaSet) start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.checkAll(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.checkAll(ctx)
+			}
+		}
+	}()
+}
+
+// stop 停止健康检查并关闭副本的连接池
+func (s *replicaSet) stop() {
+	s.cancel()
+	s.wg.Wait()
+	for _, r := range s.replicas {
+		r.DB.Close()
+	}
+}
+
+// checkAll 检查所有副本的连接
+func (s *replicaSet) checkAll(ctx context.Context) {
+	for _, r := range s.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, replicaPingTimeout)
+		err := r.DB.PingContext(pingCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		s.setHealthy(r, err)
+	}
+}
+
+// setHealthy 按检查或查询的结果更新副本的健康状态，状态变化时记录日志
+func (s *replicaSet) setHealthy(r *replica, err error) {
+	healthy := err == nil
+	if r.healthy.Swap(healthy) != healthy {
+		if healthy {
+			s.logger.Info("只读副本已恢复", "replica", r.Name)
+		} else {
+			s.logger.Warn("只读副本不可用，只读查询改用其他副本或主库", "replica", r.Name, "error", err)
+		}
+	}
+	if s.metrics != nil {
+		value := 0.0
+		if healthy {
+			value = 1
+		}
+		s.metrics.ReplicaHealthy.WithLabelValues(r.Name).Set(value)
+	}
+}
+
+// isConnError 返回错误是否为连接错误，SQL本身的错误不影响副本的健康状态
+func isConnError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"simple-dsp/pkg/retry"
+)
+
+// 可以重试整个事务的SQLSTATE
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// txRetryPolicy 事务因序列化失败或死锁回滚后的重试策略
+var txRetryPolicy = retry.Policy{
+	MaxRetries:     3,
+	InitialBackoff: 20 * time.Millisecond,
+	MaxBackoff:     200 * time.Millisecond,
+	Jitter:         0.5,
+}
+
+// TransactionRetry 与Transaction相同，事务因序列化失败或死锁被回滚时重新执行整个事务
+// fn可能被执行多次，除数据库写入外不能有其他副作用，如向外部切片追加结果
+func TransactionRetry(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return retry.Do(ctx, txRetryPolicy, func(ctx context.Context) error {
+		err := Transaction(ctx, db, fn)
+		if err != nil && !IsRetryableTxError(err) {
+			return retry.Permanent(err)
+		}
+		return err
+	})
+}
+
+// IsRetryableTxError 错误是否为序列化失败或死锁，此时事务已回滚，可以重新执行
+func IsRetryableTxError(err error) bool {
+	// 通过接口读取SQLSTATE，不直接依赖驱动的错误类型
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.SQLState() {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return true
+	}
+	return false
+}
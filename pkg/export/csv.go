@@ -0,0 +1,38 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+// utf8BOM Excel依赖BOM识别UTF-8编码的CSV
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// csvWriter CSV写入器
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := w.Write(utf8BOM); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+// WriteRow 写入一行
+func (c *csvWriter) WriteRow(values ...interface{}) error {
+	c.record = c.record[:0]
+	for _, v := range values {
+		text, _ := formatValue(v)
+		c.record = append(c.record, text)
+	}
+	return c.w.Write(c.record)
+}
+
+// Close 刷新缓冲区
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,8 @@
+package geo
+
+import "errors"
+
+var (
+	// ErrInvalidRecord 表示IP库中的记录格式无效
+	ErrInvalidRecord = errors.New("无效的IP库记录")
+)
@@ -0,0 +1,153 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: geo.go
+ * Project: simple-dsp
+ * Description: IP地理位置库，按IP查询国家、省份和城市
+ *
+ * 主要功能:
+ * - 从CSV文件加载IP段到地理位置的映射
+ * - 按IP查询所在的国家、省份和城市
+ *
+ * 实现细节:
+ * - 每行格式为network,country,province,city，network为CIDR，支持IPv4和IPv6
+ * - 以#开头的行和空行忽略，省份和城市可以为空
+ * - IP段按起始地址排序后二分查找，重叠的IP段以更精确(前缀更长)的为准
+ * - IPv4映射的IPv6地址按IPv4查询
+ *
+ * 依赖关系:
+ * - 无
+ *
+ * 注意事项:
+ * - Database加载后只读，可并发查询
+ * - 嵌套的IP段较多时查询需要向前扫描，常见的IP库各段互不重叠
+ * - 国家使用ISO 3166-1两位代码，省份和城市按IP库原样返回
+ */
+
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Location IP所在的地理位置
+type Location struct {
+	Country  string `json:"country"`
+	Province string `json:"province,omitempty"`
+	City     string `json:"city,omitempty"`
+}
+
+// entry 一个IP段
+type entry struct {
+	prefix   netip.Prefix
+	start    netip.Addr
+	location Location
+}
+
+// Database IP地理位置库
+type Database struct {
+	entries []entry
+}
+
+// Load 从CSV文件加载IP地理位置库
+func Load(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开IP库失败: %w", err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse 解析CSV格式的IP地理位置库，记录无效时返回ErrInvalidRecord
+func Parse(r io.Reader) (*Database, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("%w: 第%d行字段数错误", ErrInvalidRecord, line)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%w: 第%d行: %v", ErrInvalidRecord, line, err)
+		}
+		prefix = prefix.Masked()
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+
+		loc := Location{Country: strings.ToUpper(strings.TrimSpace(fields[1]))}
+		if loc.Country == "" {
+			return nil, fmt.Errorf("%w: 第%d行缺少国家", ErrInvalidRecord, line)
+		}
+		if len(fields) > 2 {
+			loc.Province = strings.TrimSpace(fields[2])
+		}
+		if len(fields) > 3 {
+			loc.City = strings.TrimSpace(fields[3])
+		}
+		entries = append(entries, entry{prefix: prefix, start: prefix.Addr(), location: loc})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取IP库失败: %w", err)
+	}
+
+	// 起始地址相同时前缀长的在后，查询时从后向前找到的第一个包含IP的段即最精确的段
+	sort.SliceStable(entries, func(i, j int) bool {
+		if c := entries[i].start.Compare(entries[j].start); c != 0 {
+			return c < 0
+		}
+		return entries[i].prefix.Bits() < entries[j].prefix.Bits()
+	})
+	return &Database{entries: entries}, nil
+}
+
+// Len 返回IP段的数量
+func (d *Database) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.entries)
+}
+
+// Lookup 查询IP所在的地理位置，IP无效或不在库中时返回false
+// 为nil的Database所有查询都返回false
+func (d *Database) Lookup(ip string) (Location, bool) {
+	if d == nil || ip == "" {
+		return Location{}, false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, false
+	}
+	addr = addr.Unmap().WithZone("")
+
+	// 起始地址不大于addr的最后一个段，向前查找包含addr的段
+	i := sort.Search(len(d.entries), func(i int) bool {
+		return d.entries[i].start.Compare(addr) > 0
+	})
+	for i--; i >= 0; i-- {
+		e := d.entries[i]
+		if e.start.BitLen() != addr.BitLen() {
+			break
+		}
+		if e.prefix.Contains(addr) {
+			return e.location, true
+		}
+	}
+	return Location{}, false
+}
@@ -0,0 +1,195 @@
+package httpclient
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	defaultDNSStaleTTL      = time.Hour
+	defaultDNSLookupTimeout = time.Second
+	// dnsRetryInterval 解析失败使用旧结果后，再次尝试解析前的间隔，避免DNS故障期间每个请求都等待解析超时
+	dnsRetryInterval = 5 * time.Second
+)
+
+// HostResolver 解析域名，*net.Resolver实现了该接口
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// resolver 缓存域名解析结果，过期后重新解析
+// 解析失败时在StaleTTL内继续使用旧结果，同一域名同时只有一个解析请求
+type resolver struct {
+	config   config.DNSCacheConfig
+	hosts    map[string]time.Duration
+	lookup   HostResolver
+	metrics  *metrics.OutboundMetrics
+	mu       sync.Mutex
+	entries  map[string]*dnsEntry
+	inflight map[string]*dnsCall
+}
+
+type dnsEntry struct {
+	addrs []string
+	// resolved 最近一次解析成功的时间，超过TTL+StaleTTL后不再使用
+	resolved time.Time
+	// expires 下次需要解析的时间
+	expires time.Time
+	// stale 最近一次解析失败，正在使用旧结果
+	stale bool
+}
+
+type dnsCall struct {
+	done  chan struct{}
+	addrs []string
+	err   error
+}
+
+func newResolver(cfg config.DNSCacheConfig, metrics *metrics.OutboundMetrics) *resolver {
+	if cfg.StaleTTL <= 0 {
+		cfg.StaleTTL = defaultDNSStaleTTL
+	}
+	if cfg.LookupTimeout <= 0 {
+		cfg.LookupTimeout = defaultDNSLookupTimeout
+	}
+	hosts := make(map[string]time.Duration, len(cfg.Hosts))
+	for _, h := range cfg.Hosts {
+		hosts[strings.ToLower(h.Host)] = h.TTL
+	}
+	return &resolver{
+		config:   cfg,
+		hosts:    hosts,
+		lookup:   net.DefaultResolver,
+		metrics:  metrics,
+		entries:  make(map[string]*dnsEntry),
+		inflight: make(map[string]*dnsCall),
+	}
+}
+
+// dialContext 返回按缓存的解析结果建立连接的DialContext，依次尝试每个地址
+func (r *resolver) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		ips, err := r.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		var firstErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, firstErr
+	}
+}
+
+// resolve 解析域名，缓存未过期时直接返回
+func (r *resolver) resolve(ctx context.Context, host string) ([]string, error) {
+	host = strings.ToLower(host)
+	now := time.Now()
+	r.mu.Lock()
+	if e, ok := r.entries[host]; ok && now.Before(e.expires) {
+		addrs, stale := e.addrs, e.stale
+		r.mu.Unlock()
+		if stale {
+			r.record("stale")
+		} else {
+			r.record("hit")
+		}
+		return addrs, nil
+	}
+	call, ok := r.inflight[host]
+	if !ok {
+		call = &dnsCall{done: make(chan struct{})}
+		r.inflight[host] = call
+		go r.refresh(host, call)
+	}
+	r.mu.Unlock()
+
+	// 解析在后台完成，请求取消时不影响其他等待同一域名的请求
+	select {
+	case <-call.done:
+		return call.addrs, call.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// refresh 解析域名并更新缓存，失败时在允许的时间内使用旧结果
+func (r *resolver) refresh(host string, call *dnsCall) {
+	defer close(call.done)
+	ctx, cancel := context.WithTimeout(context.Background(), r.config.LookupTimeout)
+	defer cancel()
+
+	start := time.Now()
+	addrs, err := r.lookup.LookupHost(ctx, host)
+	if r.metrics != nil {
+		r.metrics.DNSLookupDuration.Observe(time.Since(start).Seconds())
+	}
+	ttl := r.ttl(host)
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.inflight, host)
+	if err == nil && len(addrs) > 0 {
+		r.entries[host] = &dnsEntry{addrs: addrs, resolved: now, expires: now.Add(ttl)}
+		r.recordEntries()
+		call.addrs = addrs
+		r.record("miss")
+		return
+	}
+
+	if e, ok := r.entries[host]; ok && now.Before(e.resolved.Add(ttl+r.config.StaleTTL)) {
+		e.stale = true
+		e.expires = now.Add(min(ttl, dnsRetryInterval))
+		call.addrs = e.addrs
+		r.record("stale")
+		return
+	}
+	delete(r.entries, host)
+	r.recordEntries()
+	if err == nil {
+		err = &net.DNSError{Err: "没有解析结果", Name: host, IsNotFound: true}
+	}
+	call.err = err
+	r.record("error")
+}
+
+// ttl 域名的缓存时间，未单独配置时使用默认值
+func (r *resolver) ttl(host string) time.Duration {
+	if ttl, ok := r.hosts[host]; ok {
+		return ttl
+	}
+	return r.config.TTL
+}
+
+func (r *resolver) record(result string) {
+	if r.metrics != nil {
+		r.metrics.DNSLookups.WithLabelValues(result).Inc()
+	}
+}
+
+// recordEntries 更新缓存的域名数，调用方持有锁
+func (r *resolver) recordEntries() {
+	if r.metrics != nil {
+		r.metrics.DNSCacheEntries.Set(float64(len(r.entries)))
+	}
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: httpclient.go
+ * Project: simple-dsp
+ * Description: 出站HTTP请求的客户端工厂，按目标提供独立的连接池、超时、重试和指标
+ *
+ * 主要功能:
+ * - 按目标创建Transport和http.Client，同一目标共用连接池
+ * - 目标配置中为0的项使用默认配置，默认配置中为0的项使用内置默认值
+ * - 连接失败或返回502、503、504时按指数退避重试幂等请求
+ * - 缓存域名解析结果，解析失败时在一定时间内继续使用过期的结果，DNS暂时不可用时不影响竞价
+ * - 按目标统计每次尝试的耗时、结果和重试次数
+ *
+ * 实现细节:
+ * - http.DefaultTransport每个主机只保留2个空闲连接，高QPS下频繁新建连接
+ * - 目标之间连接池隔离，跟踪等慢目标占满连接时不影响RTA
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 重试在Transport内完成，http.Client的超时包括所有重试
+ * - RTA查询已有对冲请求，默认不重试
+ */
+
+package httpclient
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+// 出站请求的目标
+const (
+	DestinationRTA         = "rta"
+	DestinationTracking    = "tracking"
+	DestinationSupplyChain = "supply_chain"
+)
+
+const (
+	defaultMaxIdleConns        = 1024
+	defaultMaxIdleConnsPerHost = 256
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 2 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+	defaultTLSHandshakeTimeout = 5 * time.Second
+	defaultRetryBackoff        = 50 * time.Millisecond
+	defaultMaxRetryBackoff     = time.Second
+)
+
+// Factory 出站HTTP客户端工厂
+type Factory struct {
+	config     config.HTTPClientsConfig
+	metrics    *metrics.Metrics
+	resolver   *resolver
+	mu         sync.Mutex
+	transports map[string]*Transport
+}
+
+// NewFactory 创建出站HTTP客户端工厂，metrics为nil时不统计指标
+func NewFactory(cfg config.HTTPClientsConfig, metrics *metrics.Metrics) *Factory {
+	f := &Factory{
+		config:     cfg,
+		metrics:    metrics,
+		transports: make(map[string]*Transport),
+	}
+	if cfg.DNS.TTL > 0 {
+		f.resolver = newResolver(cfg.DNS, f.outbound())
+	}
+	return f
+}
+
+// SetResolver 替换域名解析，默认使用net.DefaultResolver，未启用DNS缓存时不生效，需在获取Transport前调用
+func (f *Factory) SetResolver(r HostResolver) {
+	if f.resolver != nil {
+		f.resolver.lookup = r
+	}
+}
+
+// Transport 返回目标的Transport，同一目标共用连接池
+func (f *Factory) Transport(destination string) *Transport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t, ok := f.transports[destination]; ok {
+		return t
+	}
+
+	cfg := f.Config(destination)
+	base := NewTransport(cfg)
+	if f.resolver != nil {
+		dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+		base.DialContext = f.resolver.dialContext(dialer)
+	}
+	t := &Transport{
+		destination: destination,
+		config:      cfg,
+		base:        base,
+		metrics:     f.outbound(),
+	}
+	f.transports[destination] = t
+	return t
+}
+
+// Client 返回使用目标连接池的http.Client，超时为目标配置的Timeout
+func (f *Factory) Client(destination string) *http.Client {
+	t := f.Transport(destination)
+	return &http.Client{Timeout: t.config.Timeout, Transport: t}
+}
+
+// Config 返回目标的配置，目标未设置的项使用默认配置，仍为0的项使用内置默认值
+func (f *Factory) Config(destination string) config.HTTPClientConfig {
+	cfg := f.config.Default
+	if o, ok := f.config.Destinations[destination]; ok {
+		cfg = merge(cfg, o)
+	}
+	return withDefaults(cfg)
+}
+
+// CloseIdleConnections 关闭所有目标的空闲连接
+func (f *Factory) CloseIdleConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.transports {
+		t.base.CloseIdleConnections()
+	}
+}
+
+func (f *Factory) outbound() *metrics.OutboundMetrics {
+	if f.metrics == nil {
+		return nil
+	}
+	return f.metrics.Outbound
+}
+
+// NewTransport 按连接池配置创建不经过工厂的Transport，为0的项使用内置默认值，不重试也不统计指标
+func NewTransport(cfg config.HTTPClientConfig) *http.Transport {
+	cfg = withDefaults(cfg)
+	dialer := &net.Dialer{Timeout: cfg.DialTimeout, KeepAlive: cfg.KeepAlive}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// merge 用o中不为0的项覆盖base
+func merge(base, o config.HTTPClientConfig) config.HTTPClientConfig {
+	if o.Timeout > 0 {
+		base.Timeout = o.Timeout
+	}
+	if o.MaxRetries > 0 {
+		base.MaxRetries = o.MaxRetries
+	}
+	if o.RetryBackoff > 0 {
+		base.RetryBackoff = o.RetryBackoff
+	}
+	if o.MaxRetryBackoff > 0 {
+		base.MaxRetryBackoff = o.MaxRetryBackoff
+	}
+	if o.MaxIdleConns > 0 {
+		base.MaxIdleConns = o.MaxIdleConns
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		base.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.MaxConnsPerHost > 0 {
+		base.MaxConnsPerHost = o.MaxConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		base.IdleConnTimeout = o.IdleConnTimeout
+	}
+	if o.DialTimeout > 0 {
+		base.DialTimeout = o.DialTimeout
+	}
+	if o.KeepAlive > 0 {
+		base.KeepAlive = o.KeepAlive
+	}
+	if o.TLSHandshakeTimeout > 0 {
+		base.TLSHandshakeTimeout = o.TLSHandshakeTimeout
+	}
+	return base
+}
+
+// withDefaults 为0的项使用内置默认值
+func withDefaults(cfg config.HTTPClientConfig) config.HTTPClientConfig {
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+	if cfg.MaxRetryBackoff <= 0 {
+		cfg.MaxRetryBackoff = defaultMaxRetryBackoff
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost <= 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout <= 0 {
+		cfg.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = defaultDialTimeout
+	}
+	if cfg.KeepAlive <= 0 {
+		cfg.KeepAlive = defaultKeepAlive
+	}
+	if cfg.TLSHandshakeTimeout <= 0 {
+		cfg.TLSHandshakeTimeout = defaultTLSHandshakeTimeout
+	}
+	return cfg
+}
@@ -0,0 +1,111 @@
+package httpclient
+
+import (
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+// resultError 请求未收到响应时的结果标签
+const resultError = "error"
+
+// maxDrainBytes 重试前读取并丢弃的响应体上限，超过时不复用连接
+const maxDrainBytes = 64 << 10
+
+// Transport 目标的出站Transport，统计每次尝试的耗时和结果，按退避重试失败的幂等请求
+type Transport struct {
+	destination string
+	config      config.HTTPClientConfig
+	base        *http.Transport
+	metrics     *metrics.OutboundMetrics
+}
+
+// RoundTrip 发送请求，连接失败或返回502、503、504时按配置重试
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if replayable(req) {
+		retries = t.config.MaxRetries
+	}
+	backoff := t.config.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		resp, err := t.attempt(req)
+		if attempt >= retries || !retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+			resp.Body.Close()
+		}
+
+		// 等待时间在退避时间的一半到全部之间随机，避免多个请求同时重试
+		timer := time.NewTimer(backoff/2 + rand.N(backoff/2+1))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff = min(2*backoff, t.config.MaxRetryBackoff)
+
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		if t.metrics != nil {
+			t.metrics.Retries.WithLabelValues(t.destination).Inc()
+		}
+	}
+}
+
+// CloseIdleConnections 关闭连接池中的空闲连接
+func (t *Transport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// attempt 发送一次请求并统计耗时和结果
+func (t *Transport) attempt(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if t.metrics != nil {
+		result := resultError
+		if err == nil {
+			result = strconv.Itoa(resp.StatusCode/100) + "xx"
+		}
+		t.metrics.Duration.WithLabelValues(t.destination).Observe(time.Since(start).Seconds())
+		t.metrics.Requests.WithLabelValues(t.destination, result).Inc()
+	}
+	return resp, err
+}
+
+// replayable 请求是否可以重试：方法幂等或带幂等键，且请求体可以重新读取
+func replayable(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+	default:
+		if req.Header.Get("Idempotency-Key") == "" {
+			return false
+		}
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryable 是否为可重试的失败：未收到响应，或上游暂时不可用
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
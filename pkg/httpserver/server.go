@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: server.go
+ * Project: simple-dsp
+ * Description: 按服务器配置创建HTTP服务器，面向高QPS的竞价流量调整连接参数
+ *
+ * 主要功能:
+ * - 按配置设置读写、请求头和空闲超时
+ * - 可关闭HTTP keep-alive
+ * - 可接受未加密的HTTP/2(h2c)连接，一个连接上并发处理多个请求
+ * - 按配置设置接受的连接的TCP keep-alive探测间隔
+ *
+ * 实现细节:
+ * - h2c同时支持Upgrade升级和直接发送HTTP/2连接前言
+ * - HTTP/2连接的空闲超时使用服务器的IdleTimeout
+ *
+ * 依赖关系:
+ * - golang.org/x/net/http2
+ * - simple-dsp/pkg/config
+ *
+ * 注意事项:
+ * - 优雅关闭时向HTTP/2连接发送GOAWAY，但Shutdown不等待这些连接上的请求完成
+ * - h2c只应在可信网络或前置负载均衡终止TLS时启用
+ */
+
+package httpserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"simple-dsp/pkg/config"
+)
+
+// defaultMaxConcurrentStreams h2c连接默认的最大并发流数
+const defaultMaxConcurrentStreams = 250
+
+// New 按服务器配置创建HTTP服务器，监听地址为cfg.Port
+func New(cfg config.ServerConfig, handler http.Handler) (*http.Server, error) {
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+	srv.SetKeepAlivesEnabled(!cfg.DisableKeepAlives)
+
+	if cfg.H2C {
+		streams := cfg.MaxConcurrentStreams
+		if streams == 0 {
+			streams = defaultMaxConcurrentStreams
+		}
+		h2s := &http2.Server{MaxConcurrentStreams: streams}
+		// 注册优雅关闭，关闭时向HTTP/2连接发送GOAWAY
+		if err := http2.ConfigureServer(srv, h2s); err != nil {
+			return nil, fmt.Errorf("配置HTTP/2失败: %w", err)
+		}
+		srv.Handler = h2c.NewHandler(handler, h2s)
+	}
+	return srv, nil
+}
+
+// Listen 监听addr，接受的连接按tcpKeepAlive发送keep-alive探测，为0时使用15秒，为负数时关闭
+func Listen(addr string, tcpKeepAlive time.Duration) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: tcpKeepAlive}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: id.go
+ * Project: simple-dsp
+ * Description: 全局唯一ID生成，广告、预算、素材、计划、请求等ID统一使用
+ *
+ * 主要功能:
+ * - 生成ULID：48位毫秒时间戳加80位crypto/rand随机数，按Crockford Base32编码为26个字符
+ * - 按生成时间排序，字典序与时间顺序一致
+ *
+ * 实现细节:
+ * - 同一毫秒内生成的ID在上一个ID的随机部分上加1，进程内严格递增，不会重复
+ * - 系统时钟回拨时沿用上一个ID的时间戳，仍保持递增
+ * - 随机部分来自crypto/rand，不同实例生成的ID不可预测，碰撞概率可忽略
+ *
+ * 依赖关系:
+ * - crypto/rand
+ *
+ * 注意事项:
+ * - 读取系统随机数失败时panic，此时无法安全地生成ID
+ * - ID中的时间戳会暴露创建时间，不要用作访问凭证
+ */
+
+package id
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// Length ID的长度
+const Length = 26
+
+// encoding Crockford Base32字母表，不含I、L、O、U
+const encoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// generator 保证进程内生成的ID严格递增
+type generator struct {
+	mu      sync.Mutex
+	lastMs  uint64
+	entropy [10]byte
+}
+
+var std generator
+
+// New 生成新的ID
+func New() string {
+	return std.next(time.Now())
+}
+
+// next 生成时间戳为now的ID，同一毫秒或时钟回拨时在上一个ID的基础上递增
+func (g *generator) next(now time.Time) string {
+	ms := uint64(now.UnixMilli())
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ms <= g.lastMs {
+		ms = g.lastMs
+		if !increment(&g.entropy) {
+			// 随机部分溢出，使用下一毫秒的时间戳
+			ms++
+			g.fill()
+		}
+	} else {
+		g.fill()
+	}
+	g.lastMs = ms
+
+	var b [16]byte
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+	copy(b[6:], g.entropy[:])
+	return encode(b)
+}
+
+// fill 重新读取随机部分，调用方持有锁
+func (g *generator) fill() {
+	if _, err := rand.Read(g.entropy[:]); err != nil {
+		panic("id: 读取系统随机数失败: " + err.Error())
+	}
+}
+
+// increment 随机部分加1，溢出时返回false
+func increment(entropy *[10]byte) bool {
+	for i := len(entropy) - 1; i >= 0; i-- {
+		entropy[i]++
+		if entropy[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// encode 将128位按Crockford Base32编码，最高位补2个0位凑成26个5位的字符
+func encode(b [16]byte) string {
+	var out [Length]byte
+	for i := range out {
+		v := 0
+		for bit := i*5 - 2; bit < i*5+3; bit++ {
+			v <<= 1
+			if bit >= 0 && b[bit/8]&(0x80>>(bit%8)) != 0 {
+				v |= 1
+			}
+		}
+		out[i] = encoding[v]
+	}
+	return string(out[:])
+}
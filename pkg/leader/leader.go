@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: leader.go
+ * Project: simple-dsp
+ * Description: 后台任务选主，同一选主组中只有主实例运行耗时的周期任务
+ *
+ * 主要功能:
+ * - 通过分布式锁竞选主实例，当选后启动注册的任务，卸任时停止
+ * - 主实例故障或租约失效后，其他实例在下一次重试时当选，自动切换
+ * - 通过指标暴露当前实例是否为主实例和切换次数
+ *
+ * 实现细节:
+ * - 选主使用pkg/lock的锁leader:{选主组}，主实例持有期间由锁自动续期
+ * - 租约失效时先停止任务再重新竞选，保证同一时刻最多一个实例运行任务
+ * - 主实例正常退出时释放锁，其他实例无需等待锁过期
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/lock
+ * - simple-dsp/pkg/metrics
+ *
+ * 注意事项:
+ * - 注册的任务会被多次启动和停止，Stop之后必须可以再次Start
+ * - 按任务加锁（lock.Locker.Do）适合短任务；需要常驻内存状态或持续运行的任务使用选主
+ */
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	// defaultElection 默认的选主组
+	defaultElection = "default"
+	// defaultRetryInterval 非主实例默认的竞选间隔
+	defaultRetryInterval = 5 * time.Second
+)
+
+// Worker 只在主实例上运行的任务
+type Worker interface {
+	Start()
+	Stop()
+}
+
+// Elector 选主
+type Elector struct {
+	locker   *lock.Locker
+	election string
+	retry    time.Duration
+	logger   *logger.Logger
+	metrics  *metrics.Metrics
+
+	mu      sync.Mutex
+	workers []Worker
+	leader  atomic.Bool
+
+	cancelFunc context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewElector 创建选主
+func NewElector(cfg config.LeaderConfig, locker *lock.Locker, logger *logger.Logger) *Elector {
+	if cfg.Election == "" {
+		cfg.Election = defaultElection
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	return &Elector{
+		locker:   locker,
+		election: cfg.Election,
+		retry:    cfg.RetryInterval,
+		logger:   logger,
+	}
+}
+
+// SetMetrics 设置监控指标
+func (e *Elector) SetMetrics(m *metrics.Metrics) {
+	e.metrics = m
+	e.observe(false, "")
+}
+
+// Register 注册只在主实例上运行的任务，当前已是主实例时立即启动
+func (e *Elector) Register(w Worker) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.workers = append(e.workers, w)
+	if e.leader.Load() {
+		w.Start()
+	}
+}
+
+// IsLeader 当前实例是否为主实例
+func (e *Elector) IsLeader() bool {
+	return e.leader.Load()
+}
+
+// Start 启动后台竞选
+func (e *Elector) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancelFunc = cancel
+
+	e.wg.Add(1)
+	go e.campaign(ctx)
+}
+
+// Stop 停止竞选，主实例停止任务并释放锁
+func (e *Elector) Stop() {
+	if e.cancelFunc == nil {
+		return
+	}
+	e.cancelFunc()
+	e.wg.Wait()
+}
+
+// campaign 未当选时按重试间隔竞选，当选后持续到租约失效或停止
+func (e *Elector) campaign(ctx context.Context) {
+	defer e.wg.Done()
+
+	name := "leader:" + e.election
+	for {
+		lease, err := e.locker.TryAcquire(ctx, name)
+		switch {
+		case err == nil:
+			e.lead(ctx, lease)
+		case !errors.Is(err, lock.ErrNotAcquired) && ctx.Err() == nil:
+			e.logger.Error("竞选主实例失败", "election", e.election, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retry):
+		}
+	}
+}
+
+// lead 作为主实例运行任务，直到租约失效或停止竞选
+func (e *Elector) lead(ctx context.Context, lease *lock.Lease) {
+	e.setLeader(true, lease.Token())
+
+	select {
+	case <-ctx.Done():
+	case <-lease.Context().Done():
+	}
+
+	e.setLeader(false, lease.Token())
+	if err := lease.Release(context.Background()); err != nil {
+		e.logger.Warn("释放主实例锁失败", "election", e.election, "error", err)
+	}
+}
+
+// setLeader 切换主实例状态并启动或停止任务
+func (e *Elector) setLeader(leader bool, token int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.leader.Store(leader)
+	if leader {
+		e.logger.Info("当选主实例", "election", e.election, "token", token)
+		for _, w := range e.workers {
+			w.Start()
+		}
+		e.observe(true, "elected")
+		return
+	}
+
+	// 倒序停止，与启动顺序相反
+	for i := len(e.workers) - 1; i >= 0; i-- {
+		e.workers[i].Stop()
+	}
+	e.logger.Info("卸任主实例", "election", e.election, "token", token)
+	e.observe(false, "revoked")
+}
+
+// observe 更新指标，event为空时只设置状态
+func (e *Elector) observe(leader bool, event string) {
+	if e.metrics == nil || e.metrics.Leader == nil {
+		return
+	}
+	value := 0.0
+	if leader {
+		value = 1
+	}
+	e.metrics.Leader.IsLeader.WithLabelValues(e.election).Set(value)
+	if event != "" {
+		e.metrics.Leader.Transitions.WithLabelValues(e.election, event).Inc()
+	}
+}
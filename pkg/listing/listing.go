@@ -0,0 +1,342 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: listing.go
+ * Project: simple-dsp
+ * Description: 管理后台列表接口的分页、排序和过滤
+ *
+ * 主要功能:
+ * - 解析统一的page/page_size/cursor/sort/filter查询参数
+ * - 对内存中的列表执行过滤、排序和分页
+ * - 生成游标，支持数据变化时稳定的翻页
+ *
+ * 实现细节:
+ * - sort=field升序，sort=-field降序，相同值按ID排序保证顺序稳定
+ * - filter[field]=value按字段等值过滤，切片字段按包含过滤
+ * - 游标记录上一页最后一条的排序值和ID，经base64编码后对调用方不透明
+ * - 同时传入cursor和page时以cursor为准
+ *
+ * 依赖关系:
+ * - github.com/gin-gonic/gin
+ *
+ * 注意事项:
+ * - 排序和过滤字段必须在Spec中声明，未声明的字段返回错误
+ * - 访问器必须支持"id"字段
+ */
+
+package listing
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultPageSize 默认每页条数
+	DefaultPageSize = 20
+	// MaxPageSize 每页最大条数
+	MaxPageSize = 200
+)
+
+var (
+	// ErrInvalidPage 表示无效的分页参数
+	ErrInvalidPage = errors.New("无效的分页参数")
+	// ErrInvalidSort 表示不支持的排序字段
+	ErrInvalidSort = errors.New("不支持的排序字段")
+	// ErrInvalidFilter 表示不支持的过滤字段
+	ErrInvalidFilter = errors.New("不支持的过滤字段")
+	// ErrInvalidCursor 表示无效的游标
+	ErrInvalidCursor = errors.New("无效的游标")
+)
+
+// Spec 列表接口允许的排序和过滤字段
+type Spec struct {
+	Sortable    []string // 允许排序的字段
+	Filterable  []string // 允许过滤的字段
+	DefaultSort string   // 默认排序，如"-create_time"
+}
+
+// Cursor 翻页游标
+type Cursor struct {
+	Value string `json:"v"`  // 上一页最后一条的排序值
+	ID    string `json:"id"` // 上一页最后一条的ID
+}
+
+// Query 列表查询参数
+type Query struct {
+	Page      int
+	PageSize  int
+	Cursor    *Cursor
+	SortField string
+	Desc      bool
+	Filters   map[string]string
+}
+
+// Page 分页结果
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Accessor 读取列表项的字段值
+type Accessor[T any] func(item T, field string) interface{}
+
+// ParseQuery 从请求中解析列表查询参数
+func ParseQuery(c *gin.Context, spec Spec) (Query, error) {
+	q := Query{
+		Page:     1,
+		PageSize: DefaultPageSize,
+		Filters:  make(map[string]string),
+	}
+
+	if v := c.Query("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return q, ErrInvalidPage
+		}
+		q.Page = page
+	}
+	if v := c.Query("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 {
+			return q, ErrInvalidPage
+		}
+		if size > MaxPageSize {
+			size = MaxPageSize
+		}
+		q.PageSize = size
+	}
+
+	if v := c.Query("cursor"); v != "" {
+		cursor, err := DecodeCursor(v)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = cursor
+	}
+
+	sortParam := c.DefaultQuery("sort", spec.DefaultSort)
+	if sortParam == "" {
+		sortParam = "id"
+	}
+	q.SortField = strings.TrimPrefix(sortParam, "-")
+	q.Desc = strings.HasPrefix(sortParam, "-")
+	if q.SortField != "id" && !contains(spec.Sortable, q.SortField) {
+		return q, fmt.Errorf("%w: %s", ErrInvalidSort, q.SortField)
+	}
+
+	for field, value := range c.QueryMap("filter") {
+		if !contains(spec.Filterable, field) {
+			return q, fmt.Errorf("%w: %s", ErrInvalidFilter, field)
+		}
+		q.Filters[field] = value
+	}
+
+	return q, nil
+}
+
+// Offset 返回页码分页的偏移量
+func (q Query) Offset() int {
+	return (q.Page - 1) * q.PageSize
+}
+
+// Apply 对列表执行过滤、排序和分页
+func Apply[T any](items []T, q Query, get Accessor[T]) Page[T] {
+	filtered := make([]T, 0, len(items))
+	for _, item := range items {
+		if matches(item, q.Filters, get) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		return less(get(filtered[i], q.SortField), get(filtered[i], "id"),
+			get(filtered[j], q.SortField), get(filtered[j], "id"), q.Desc)
+	})
+
+	start := 0
+	if q.Cursor != nil {
+		start = sort.Search(len(filtered), func(i int) bool {
+			return afterCursor(get(filtered[i], q.SortField), get(filtered[i], "id"), q.Cursor, q.Desc)
+		})
+	} else {
+		start = q.Offset()
+	}
+	if start > len(filtered) {
+		start = len(filtered)
+	}
+	end := start + q.PageSize
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+
+	page := Page[T]{
+		Items:    filtered[start:end],
+		Total:    int64(len(filtered)),
+		PageSize: q.PageSize,
+	}
+	if q.Cursor == nil {
+		page.Page = q.Page
+	}
+	if end < len(filtered) && end > start {
+		last := filtered[end-1]
+		page.NextCursor = EncodeCursor(Cursor{
+			Value: FormatValue(get(last, q.SortField)),
+			ID:    FormatValue(get(last, "id")),
+		})
+	}
+	return page
+}
+
+// EncodeCursor 编码游标
+func EncodeCursor(cursor Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor 解码游标
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// FormatValue 将字段值格式化为游标和过滤使用的文本
+func FormatValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case int:
+		return strconv.Itoa(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// matches 判断列表项是否满足所有过滤条件
+func matches[T any](item T, filters map[string]string, get Accessor[T]) bool {
+	for field, want := range filters {
+		switch v := get(item, field).(type) {
+		case []string:
+			if !contains(v, want) {
+				return false
+			}
+		default:
+			if FormatValue(v) != want {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// less 按排序值比较，值相同时按ID升序
+func less(a, aID, b, bID interface{}, desc bool) bool {
+	if c := compare(a, b); c != 0 {
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	}
+	return compare(aID, bID) < 0
+}
+
+// afterCursor 判断列表项是否排在游标之后
+func afterCursor(v, id interface{}, cursor *Cursor, desc bool) bool {
+	c := compare(v, parseAs(v, cursor.Value))
+	if c == 0 {
+		return compare(id, parseAs(id, cursor.ID)) > 0
+	}
+	if desc {
+		return c < 0
+	}
+	return c > 0
+}
+
+// parseAs 按字段值的类型解析游标中的文本
+func parseAs(v interface{}, s string) interface{} {
+	switch v.(type) {
+	case int:
+		n, _ := strconv.Atoi(s)
+		return n
+	case int64:
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	case float64:
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	case bool:
+		b, _ := strconv.ParseBool(s)
+		return b
+	case time.Time:
+		t, _ := time.Parse(time.RFC3339Nano, s)
+		return t
+	default:
+		return s
+	}
+}
+
+// compare 比较两个同类型的字段值
+func compare(a, b interface{}) int {
+	switch x := a.(type) {
+	case int:
+		return compareOrdered(x, b.(int))
+	case int64:
+		return compareOrdered(x, b.(int64))
+	case float64:
+		return compareOrdered(x, b.(float64))
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	case bool:
+		return compareOrdered(FormatValue(x), FormatValue(b))
+	default:
+		return strings.Compare(FormatValue(a), FormatValue(b))
+	}
+}
+
+func compareOrdered[V int | int64 | float64 | string](a, b V) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,345 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: lock.go
+ * Project: simple-dsp
+ * Description: 基于Redis的分布式锁，保证后台定时任务在多个实例中只有一个执行
+ *
+ * 主要功能:
+ * - 在多个相互独立的Redis节点上加锁，多数节点加锁成功才算持有（Redlock）
+ * - 持有期间后台续期，续期失败到租约到期时取消租约的context
+ * - 每次加锁返回单调递增的fencing token，供下游拒绝过期持有者的写入
+ *
+ * 实现细节:
+ * - 锁的值为随机串，续期和释放通过Lua脚本比较值，不会误删其他持有者的锁
+ * - token由各节点的计数器自增得到，取多数节点中的最大值并回写到这些节点，
+ *   任意两个多数派至少有一个公共节点，保证后一个持有者的token更大
+ * - 锁和计数器的键使用相同的hash tag，集群模式下位于同一槽位
+ *
+ * 依赖关系:
+ * - github.com/go-redis/redis/v8
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 只配置一个节点时退化为单节点锁，该节点故障期间所有实例都无法执行任务
+ * - 任务应使用租约的context，context取消后尽快停止写入
+ */
+
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// DefaultTTL 默认租约时长
+const DefaultTTL = 30 * time.Second
+
+var (
+	// ErrNotAcquired 锁已被其他实例持有
+	ErrNotAcquired = errors.New("锁已被其他实例持有")
+	// ErrLeaseLost 续期失败，租约已失效
+	ErrLeaseLost = errors.New("分布式锁租约已失效")
+	// ErrNoNodes 没有可用的Redis节点
+	ErrNoNodes = errors.New("分布式锁未配置Redis节点")
+)
+
+var (
+	// acquireScript 加锁成功时自增并返回计数器，失败返回0
+	acquireScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+
+	// fenceScript 将计数器提高到ARGV[1]
+	fenceScript = redis.NewScript(`
+local current = tonumber(redis.call('GET', KEYS[1]) or '0')
+if current < tonumber(ARGV[1]) then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1`)
+
+	// extendScript 锁仍属于当前持有者时续期
+	extendScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript 锁仍属于当前持有者时删除
+	releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// tokenKey context中保存fencing token的键
+type tokenKey struct{}
+
+// TokenFrom 返回context所属租约的fencing token
+func TokenFrom(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(tokenKey{}).(int64)
+	return token, ok
+}
+
+// Locker 分布式锁
+type Locker struct {
+	nodes  []redis.Cmdable
+	ttl    time.Duration
+	logger *logger.Logger
+}
+
+// NewLocker 创建分布式锁，nodes为相互独立的Redis节点
+func NewLocker(cfg config.LockConfig, nodes []redis.Cmdable, logger *logger.Logger) *Locker {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	return &Locker{
+		nodes:  nodes,
+		ttl:    cfg.TTL,
+		logger: logger,
+	}
+}
+
+// quorum 持有锁需要的节点数
+func (l *Locker) quorum() int {
+	return len(l.nodes)/2 + 1
+}
+
+// drift 时钟漂移和网络延迟的余量
+func (l *Locker) drift() time.Duration {
+	return l.ttl/100 + 2*time.Millisecond
+}
+
+// TryAcquire 尝试加锁，不等待，锁已被持有时返回ErrNotAcquired
+// 持有期间后台续期，使用完后必须调用Release
+func (l *Locker) TryAcquire(ctx context.Context, name string) (*Lease, error) {
+	if len(l.nodes) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	value, err := randomValue()
+	if err != nil {
+		return nil, err
+	}
+	key := "lock:{" + name + "}"
+	fenceKey := key + ":fence"
+	start := time.Now()
+
+	var (
+		acquired []redis.Cmdable
+		token    int64
+		failed   int
+		firstErr error
+	)
+	for _, node := range l.nodes {
+		n, err := acquireScript.Run(ctx, node, []string{key, fenceKey}, value, l.ttl.Milliseconds()).Int64()
+		if err != nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if n > 0 {
+			acquired = append(acquired, node)
+			token = max(token, n)
+		}
+	}
+
+	validity := l.ttl - time.Since(start) - l.drift()
+	if len(acquired) < l.quorum() || validity <= 0 {
+		l.release(context.WithoutCancel(ctx), key, value)
+		// 可用节点不足多数时无法判断锁是否被持有，返回节点错误
+		if len(l.nodes)-failed < l.quorum() {
+			return nil, fmt.Errorf("加锁%s失败: %w", name, firstErr)
+		}
+		return nil, ErrNotAcquired
+	}
+
+	// 回写token，使下一个多数派中至少有一个节点的计数器不小于当前token
+	if len(l.nodes) > 1 {
+		for _, node := range acquired {
+			if err := fenceScript.Run(ctx, node, []string{fenceKey}, token).Err(); err != nil {
+				l.logger.Warn("回写分布式锁token失败", "name", name, "error", err)
+			}
+		}
+	}
+
+	leaseCtx, cancel := context.WithCancelCause(context.WithValue(context.WithoutCancel(ctx), tokenKey{}, token))
+	lease := &Lease{
+		locker:   l,
+		name:     name,
+		key:      key,
+		value:    value,
+		token:    token,
+		ctx:      leaseCtx,
+		cancel:   cancel,
+		deadline: start.Add(l.ttl - l.drift()),
+		stop:     make(chan struct{}),
+	}
+	lease.wg.Add(1)
+	go lease.renewLoop()
+	return lease, nil
+}
+
+// Do 持有锁时执行fn，锁已被持有时不执行并返回ErrNotAcquired
+// fn收到的context在租约失效时取消；l为nil时直接执行fn，用于未配置分布式锁的单实例部署
+func (l *Locker) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	if l == nil {
+		return fn(ctx)
+	}
+
+	lease, err := l.TryAcquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := lease.Release(context.WithoutCancel(ctx)); err != nil {
+			l.logger.Warn("释放分布式锁失败", "name", name, "error", err)
+		}
+	}()
+
+	// 租约失效或调用方取消时都取消fn的context
+	runCtx, cancel := context.WithCancel(lease.Context())
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	err = fn(runCtx)
+	if lost := context.Cause(lease.Context()); errors.Is(lost, ErrLeaseLost) {
+		return errors.Join(err, lost)
+	}
+	return err
+}
+
+// release 在所有节点上释放锁，返回成功释放的节点数和第一个错误
+func (l *Locker) release(ctx context.Context, key, value string) (int, error) {
+	var (
+		released int
+		firstErr error
+	)
+	for _, node := range l.nodes {
+		if err := releaseScript.Run(ctx, node, []string{key}, value).Err(); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		released++
+	}
+	return released, firstErr
+}
+
+// Lease 锁的租约
+type Lease struct {
+	locker *Locker
+	name   string
+	key    string
+	value  string
+	token  int64
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// deadline 租约的有效期，只在续期协程中读写
+	deadline time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// Context 租约的context，租约失效或释放后取消，context.Cause为ErrLeaseLost时表示租约失效
+func (l *Lease) Context() context.Context {
+	return l.ctx
+}
+
+// Token 本次加锁的fencing token，后加锁的持有者token更大
+func (l *Lease) Token() int64 {
+	return l.token
+}
+
+// Release 停止续期并释放锁，可重复调用
+func (l *Lease) Release(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	l.wg.Wait()
+	l.cancel(context.Canceled)
+
+	released, err := l.locker.release(ctx, l.key, l.value)
+	if err != nil && released < l.locker.quorum() {
+		return fmt.Errorf("释放锁%s失败: %w", l.name, err)
+	}
+	return nil
+}
+
+// renewLoop 每三分之一租约时长续期一次，续期失败且租约即将到期时取消租约
+func (l *Lease) renewLoop() {
+	defer l.wg.Done()
+
+	interval := l.locker.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		ok, lost := l.extend()
+		if ok {
+			l.deadline = start.Add(l.locker.ttl - l.locker.drift())
+		}
+		if lost || (!ok && time.Until(l.deadline) <= interval) {
+			l.locker.logger.Warn("分布式锁租约失效", "name", l.name, "token", l.token)
+			l.cancel(ErrLeaseLost)
+			return
+		}
+	}
+}
+
+// extend 在所有节点上续期，ok表示多数节点续期成功，lost表示锁已确定被删除或被他人持有
+func (l *Lease) extend() (ok, lost bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.locker.ttl/3)
+	defer cancel()
+
+	var extended, missing int
+	for _, node := range l.locker.nodes {
+		n, err := extendScript.Run(ctx, node, []string{l.key}, l.value, l.locker.ttl.Milliseconds()).Int64()
+		switch {
+		case err != nil:
+			l.locker.logger.Debug("分布式锁续期失败", "name", l.name, "error", err)
+		case n == 0:
+			missing++
+		default:
+			extended++
+		}
+	}
+	quorum := l.locker.quorum()
+	return extended >= quorum, missing > len(l.locker.nodes)-quorum
+}
+
+// randomValue 生成锁的随机值
+func randomValue() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成锁的随机值失败: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
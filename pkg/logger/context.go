@@ -0,0 +1,29 @@
+package logger
+
+import "context"
+
+// fieldsKey 上下文中日志字段的键
+type fieldsKey struct{}
+
+// ContextWithFields 在上下文中附加日志字段，WithContext派生的日志记录器会带上这些字段
+// 字段按键值对交替传入，与Info等方法一致
+func ContextWithFields(ctx context.Context, keysAndValues ...interface{}) context.Context {
+	if len(keysAndValues) == 0 {
+		return ctx
+	}
+	parent := FieldsFromContext(ctx)
+	fields := make([]interface{}, 0, len(parent)+len(keysAndValues))
+	fields = append(append(fields, parent...), keysAndValues...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// FieldsFromContext 返回上下文中的日志字段
+func FieldsFromContext(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	return fields
+}
+
+// WithContext 返回带有上下文日志字段的日志记录器，上下文没有字段时返回原记录器
+func (l *Logger) WithContext(ctx context.Context) *Logger {
+	return l.With(FieldsFromContext(ctx)...)
+}
@@ -0,0 +1,14 @@
+package logger
+
+import "errors"
+
+var (
+	// ErrScrubSaltRequired 表示按哈希脱敏时没有配置盐
+	ErrScrubSaltRequired = errors.New("按哈希脱敏时必须配置salt")
+	// ErrInvalidScrubMode 表示脱敏方式无效
+	ErrInvalidScrubMode = errors.New("无效的脱敏方式")
+	// ErrInvalidSink 表示日志远程发送配置无效
+	ErrInvalidSink = errors.New("无效的日志发送配置")
+	// ErrSinkFlushTimeout 表示发送缓冲的日志超时
+	ErrSinkFlushTimeout = errors.New("日志发送超时")
+)
@@ -15,7 +15,10 @@
  * - 使用zap实现日志记录
  * - 支持JSON和文本格式
  * - 实现日志分级输出
- * - 提供日志采样功能
+ * - 提供按消息的日志采样，可在运行时调整
+ * - 按字段名对用户ID、设备ID和IP等个人信息脱敏
+ * - 可选将JSON日志异步发送到Kafka或Fluentd/Vector
+ * - 通过With和WithContext派生带固定字段的日志记录器
  *
  * 依赖关系:
  * - go.uber.org/zap
@@ -25,7 +28,7 @@
  * - 注意日志性能影响
  * - 合理设置日志级别
  * - 注意日志文件管理
- * - 确保日志安全性
+ * - 确保日志安全性，日志发往第三方存储前需要启用脱敏
  */
 
 package logger
@@ -44,13 +47,43 @@ import (
 )
 
 // Logger 是日志记录器的包装结构体
+// 内嵌的zap.Logger不跳过调用栈，可直接使用；Debug等包装方法通过sugar跳过本包的一层调用
 type Logger struct {
 	*zap.Logger
+	sugar   *zap.SugaredLogger
+	sampler *sampler
+	sink    *Sink
 }
 
-// NewLogger 创建一个新的日志记录器
+// NewLogger 创建一个新的日志记录器，默认不采样、不脱敏
 func NewLogger(zapLogger *zap.Logger) *Logger {
-	return &Logger{zapLogger}
+	return newLogger(zapLogger, config.LogSamplingConfig{}, nil)
+}
+
+// NewLoggerWithConfig 按配置为已有的zap日志记录器加上采样和脱敏，不改变其输出
+func NewLoggerWithConfig(zapLogger *zap.Logger, cfg config.LogConfig) (*Logger, error) {
+	scrubber, err := newScrubber(cfg.Scrub)
+	if err != nil {
+		return nil, err
+	}
+	return newLogger(zapLogger, cfg.Sampling, scrubber), nil
+}
+
+// newLogger 为日志记录器加上按消息采样，scrubber不为nil时先脱敏再写入
+func newLogger(zapLogger *zap.Logger, sampling config.LogSamplingConfig, scrubber *scrubber) *Logger {
+	s := newSampler(sampling)
+	zapLogger = zapLogger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		if scrubber != nil {
+			core = &scrubCore{Core: core, scrubber: scrubber}
+		}
+		return &samplingCore{Core: core, sampler: s}
+	}))
+	return &Logger{Logger: zapLogger, sugar: sugar(zapLogger), sampler: s}
+}
+
+// sugar 创建包装方法使用的SugaredLogger，调用位置指向包装方法的调用方
+func sugar(zapLogger *zap.Logger) *zap.SugaredLogger {
+	return zapLogger.WithOptions(zap.AddCallerSkip(1)).Sugar()
 }
 
 // NewLoggerFromConfig 从配置创建新的日志记录器
@@ -117,39 +150,52 @@ func NewLoggerFromConfig(cfg config.LogConfig) (*Logger, error) {
 		)
 	}
 
+	// 远程发送使用JSON格式，与文件日志一致
+	var sink *Sink
+	if cfg.Sink.Enabled {
+		if sink, err = NewSink(cfg.Sink); err != nil {
+			return nil, err
+		}
+		core = zapcore.NewTee(core, zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), sink, level))
+	}
+
 	// 创建Logger
 	zapLogger := zap.New(core,
 		zap.AddCaller(),
-		zap.AddCallerSkip(1),
 		zap.AddStacktrace(zapcore.ErrorLevel),
 	)
 
-	return &Logger{zapLogger}, nil
+	log, err := NewLoggerWithConfig(zapLogger, cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.sink = sink
+	return log, nil
 }
 
 // Debug 记录调试级别日志
 func (l *Logger) Debug(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Debugw(msg, keysAndValues...)
+	l.sugar.Debugw(msg, keysAndValues...)
 }
 
 // Info 记录信息级别日志
 func (l *Logger) Info(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Infow(msg, keysAndValues...)
+	l.sugar.Infow(msg, keysAndValues...)
 }
 
 // Warn 记录警告级别日志
 func (l *Logger) Warn(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Warnw(msg, keysAndValues...)
+	l.sugar.Warnw(msg, keysAndValues...)
 }
 
 // Error 记录错误级别日志
 func (l *Logger) Error(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Errorw(msg, keysAndValues...)
+	l.sugar.Errorw(msg, keysAndValues...)
 }
 
 // Fatal 记录致命错误级别日志并退出程序
 func (l *Logger) Fatal(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Fatalw(msg, keysAndValues...)
+	l.sugar.Fatalw(msg, keysAndValues...)
 }
 
 // Sync 同步日志缓冲区
@@ -157,7 +203,11 @@ func (l *Logger) Sync() error {
 	return l.Logger.Sync()
 }
 
-// With 返回带有额外字段的日志记录器
-func (l *Logger) With(msg string, keysAndValues ...interface{}) {
-	l.Logger.Sugar().Debugw(msg, keysAndValues...)
+// With 返回带有额外字段的日志记录器，与原记录器共享采样和远程发送
+func (l *Logger) With(keysAndValues ...interface{}) *Logger {
+	if len(keysAndValues) == 0 {
+		return l
+	}
+	zapLogger := l.Logger.Sugar().With(keysAndValues...).Desugar()
+	return &Logger{Logger: zapLogger, sugar: sugar(zapLogger), sampler: l.sampler, sink: l.sink}
 }
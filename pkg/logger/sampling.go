@@ -0,0 +1,101 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"simple-dsp/pkg/config"
+)
+
+// SamplingConfigKey 运行时日志采样配置在配置中心的键
+const SamplingConfigKey = "log.sampling"
+
+// samplingTick 采样计数周期，每个周期内按消息重新计数
+const samplingTick = time.Second
+
+// sampler 按消息采样日志，Error及以上级别始终记录
+// 同一周期内每条消息先记录First条，之后每Thereafter条记录1条，Thereafter为0时丢弃
+type sampler struct {
+	cfg     atomic.Value // config.LogSamplingConfig
+	dropped uint64
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[string]uint64
+}
+
+func newSampler(cfg config.LogSamplingConfig) *sampler {
+	s := &sampler{counts: make(map[string]uint64)}
+	s.cfg.Store(cfg)
+	return s
+}
+
+// allow 判断日志是否记录
+func (s *sampler) allow(ent zapcore.Entry) bool {
+	cfg := s.cfg.Load().(config.LogSamplingConfig)
+	if !cfg.Enabled || ent.Level >= zapcore.ErrorLevel {
+		return true
+	}
+
+	rule := config.LogSampleRule{First: cfg.First, Thereafter: cfg.Thereafter}
+	if r, ok := cfg.Messages[ent.Message]; ok {
+		rule = r
+	}
+
+	s.mu.Lock()
+	if ent.Time.Sub(s.start) >= samplingTick || ent.Time.Before(s.start) {
+		s.start = ent.Time
+		for k := range s.counts {
+			delete(s.counts, k)
+		}
+	}
+	s.counts[ent.Message]++
+	n := s.counts[ent.Message]
+	s.mu.Unlock()
+
+	if n <= uint64(rule.First) {
+		return true
+	}
+	if rule.Thereafter > 0 && (n-uint64(rule.First))%uint64(rule.Thereafter) == 0 {
+		return true
+	}
+	atomic.AddUint64(&s.dropped, 1)
+	return false
+}
+
+// samplingCore 在写入前按采样规则过滤日志
+type samplingCore struct {
+	zapcore.Core
+	sampler *sampler
+}
+
+// With 派生的Core共享同一个采样器
+func (c *samplingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplingCore{Core: c.Core.With(fields), sampler: c.sampler}
+}
+
+// Check 未被采样的日志不交给下层Core
+func (c *samplingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) || !c.sampler.allow(ent) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// SetSampling 运行时更新日志采样配置
+func (l *Logger) SetSampling(cfg config.LogSamplingConfig) {
+	l.sampler.cfg.Store(cfg)
+}
+
+// Sampling 返回当前的日志采样配置
+func (l *Logger) Sampling() config.LogSamplingConfig {
+	return l.sampler.cfg.Load().(config.LogSamplingConfig)
+}
+
+// Dropped 返回因采样丢弃的日志条数
+func (l *Logger) Dropped() uint64 {
+	return atomic.LoadUint64(&l.sampler.dropped)
+}
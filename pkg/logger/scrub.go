@@ -0,0 +1,158 @@
+package logger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+
+	"simple-dsp/pkg/config"
+)
+
+// 脱敏方式
+const (
+	// ScrubHash 以加盐HMAC-SHA256替换，同一值的哈希相同，便于在日志中关联
+	ScrubHash = "hash"
+	// ScrubMask 保留首尾部分字符，IP保留网段
+	ScrubMask = "mask"
+)
+
+// hashLength 哈希结果保留的十六进制字符数
+const hashLength = 16
+
+// DefaultScrubFields 未配置字段时默认脱敏的日志字段
+var DefaultScrubFields = map[string]string{
+	"user_id":     ScrubHash,
+	"uid":         ScrubHash,
+	"device_id":   ScrubHash,
+	"idfa":        ScrubHash,
+	"ip":          ScrubMask,
+	"client_ip":   ScrubMask,
+	"remote_addr": ScrubMask,
+}
+
+// scrubber 按字段名对日志字段脱敏
+type scrubber struct {
+	fields map[string]string
+	salt   []byte
+}
+
+// newScrubber 校验脱敏配置并创建脱敏器，未启用时返回nil
+func newScrubber(cfg config.LogScrubConfig) (*scrubber, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	fields := cfg.Fields
+	if len(fields) == 0 {
+		fields = DefaultScrubFields
+	}
+	for key, mode := range fields {
+		switch mode {
+		case ScrubHash:
+			if cfg.Salt == "" {
+				return nil, ErrScrubSaltRequired
+			}
+		case ScrubMask:
+		default:
+			return nil, fmt.Errorf("%w: %s=%s", ErrInvalidScrubMode, key, mode)
+		}
+	}
+	return &scrubber{fields: fields, salt: []byte(cfg.Salt)}, nil
+}
+
+// scrub 返回脱敏后的字段，没有需要脱敏的字段时返回原切片
+func (s *scrubber) scrub(fields []zapcore.Field) []zapcore.Field {
+	var out []zapcore.Field
+	for i, f := range fields {
+		mode, ok := s.fields[f.Key]
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = make([]zapcore.Field, len(fields))
+			copy(out, fields)
+		}
+		out[i] = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s.apply(mode, fieldString(f))}
+	}
+	if out == nil {
+		return fields
+	}
+	return out
+}
+
+// apply 按脱敏方式处理字段值，空值保持不变
+func (s *scrubber) apply(mode, value string) string {
+	if value == "" {
+		return value
+	}
+	if mode == ScrubHash {
+		mac := hmac.New(sha256.New, s.salt)
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:hashLength]
+	}
+	return mask(value)
+}
+
+// mask IPv4保留前三段，IPv6保留前48位，其他值保留首尾各2个字符
+func mask(value string) string {
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		host, port = value, ""
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if v4 := ip.To4(); v4 != nil {
+			host = v4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			host = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+		if port != "" {
+			return net.JoinHostPort(host, port)
+		}
+		return host
+	}
+
+	runes := []rune(value)
+	if len(runes) <= 6 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+// fieldString 返回字段值的字符串形式
+func fieldString(f zapcore.Field) string {
+	if f.Type == zapcore.StringType {
+		return f.String
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
+
+// scrubCore 写入前对日志字段脱敏
+type scrubCore struct {
+	zapcore.Core
+	scrubber *scrubber
+}
+
+// With 对附加字段脱敏
+func (c *scrubCore) With(fields []zapcore.Field) zapcore.Core {
+	return &scrubCore{Core: c.Core.With(c.scrubber.scrub(fields)), scrubber: c.scrubber}
+}
+
+// Check 由本Core写入，以便在Write中脱敏
+func (c *scrubCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write 对日志字段脱敏后写入
+func (c *scrubCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, c.scrubber.scrub(fields))
+}
@@ -0,0 +1,242 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"simple-dsp/pkg/config"
+)
+
+// 远程发送方式
+const (
+	// SinkKafka 发送到Kafka主题，每条日志一条消息
+	SinkKafka = "kafka"
+	// SinkHTTP 以NDJSON批量POST到Fluentd或Vector的HTTP输入
+	SinkHTTP = "http"
+)
+
+// 远程发送默认参数
+const (
+	defaultSinkBufferSize    = 10000
+	defaultSinkBatchSize     = 500
+	defaultSinkFlushInterval = time.Second
+	defaultSinkTimeout       = 5 * time.Second
+)
+
+// SinkStats 远程发送统计
+type SinkStats struct {
+	// Sent 发送成功的日志条数
+	Sent uint64
+	// Dropped 缓冲区满时丢弃的日志条数
+	Dropped uint64
+	// Failed 发送失败的日志条数
+	Failed uint64
+}
+
+// sinkSender 批量发送日志
+type sinkSender interface {
+	Send(ctx context.Context, records [][]byte) error
+}
+
+// Sink 异步发送日志到Kafka或Fluentd/Vector
+// 写入只放入有界缓冲区，不阻塞日志调用方；缓冲区满时丢弃并计数
+type Sink struct {
+	sender    sinkSender
+	records   chan []byte
+	flush     chan chan struct{}
+	batchSize int
+	interval  time.Duration
+	timeout   time.Duration
+
+	sent    uint64
+	dropped uint64
+	failed  uint64
+}
+
+// NewSink 按配置创建远程发送并启动后台发送
+func NewSink(cfg config.LogSinkConfig) (*Sink, error) {
+	var sender sinkSender
+	switch cfg.Type {
+	case SinkKafka:
+		if len(cfg.Brokers) == 0 || cfg.Topic == "" {
+			return nil, fmt.Errorf("%w: kafka需要brokers和topic", ErrInvalidSink)
+		}
+		sender = &kafkaSender{writer: &kafka.Writer{
+			Addr:     kafka.TCP(cfg.Brokers...),
+			Topic:    cfg.Topic,
+			Balancer: &kafka.LeastBytes{},
+		}}
+	case SinkHTTP:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%w: http需要url", ErrInvalidSink)
+		}
+		sender = &httpSender{url: cfg.URL, client: &http.Client{}}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSink, cfg.Type)
+	}
+	return newSink(sender, cfg), nil
+}
+
+func newSink(sender sinkSender, cfg config.LogSinkConfig) *Sink {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = defaultSinkBufferSize
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultSinkBatchSize
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultSinkFlushInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultSinkTimeout
+	}
+
+	s := &Sink{
+		sender:    sender,
+		records:   make(chan []byte, cfg.BufferSize),
+		flush:     make(chan chan struct{}),
+		batchSize: cfg.BatchSize,
+		interval:  cfg.FlushInterval,
+		timeout:   cfg.Timeout,
+	}
+	go s.run()
+	return s
+}
+
+// Write 复制一条日志放入缓冲区，缓冲区满时丢弃
+func (s *Sink) Write(p []byte) (int, error) {
+	record := make([]byte, len(p))
+	copy(record, p)
+	select {
+	case s.records <- bytes.TrimRight(record, "\n"):
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return len(p), nil
+}
+
+// Sync 发送缓冲区中的全部日志，超时返回ErrSinkFlushTimeout
+func (s *Sink) Sync() error {
+	done := make(chan struct{})
+	timer := time.NewTimer(s.timeout)
+	defer timer.Stop()
+
+	select {
+	case s.flush <- done:
+	case <-timer.C:
+		return ErrSinkFlushTimeout
+	}
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return ErrSinkFlushTimeout
+	}
+}
+
+// Stats 返回发送统计
+func (s *Sink) Stats() SinkStats {
+	return SinkStats{
+		Sent:    atomic.LoadUint64(&s.sent),
+		Dropped: atomic.LoadUint64(&s.dropped),
+		Failed:  atomic.LoadUint64(&s.failed),
+	}
+}
+
+// run 按批量大小或发送间隔发送日志
+func (s *Sink) run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	batch := make([][]byte, 0, s.batchSize)
+	for {
+		select {
+		case record := <-s.records:
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				batch = s.send(batch)
+			}
+		case <-ticker.C:
+			batch = s.send(batch)
+		case done := <-s.flush:
+			// 发送Sync之前写入的全部日志
+			for n := len(s.records); n > 0; n-- {
+				batch = append(batch, <-s.records)
+				if len(batch) >= s.batchSize {
+					batch = s.send(batch)
+				}
+			}
+			batch = s.send(batch)
+			close(done)
+		}
+	}
+}
+
+// send 发送一批日志并返回清空的批次
+func (s *Sink) send(batch [][]byte) [][]byte {
+	if len(batch) == 0 {
+		return batch
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.sender.Send(ctx, batch); err != nil {
+		atomic.AddUint64(&s.failed, uint64(len(batch)))
+	} else {
+		atomic.AddUint64(&s.sent, uint64(len(batch)))
+	}
+	return batch[:0]
+}
+
+// kafkaSender 发送到Kafka
+type kafkaSender struct {
+	writer *kafka.Writer
+}
+
+// Send 每条日志作为一条消息写入
+func (k *kafkaSender) Send(ctx context.Context, records [][]byte) error {
+	msgs := make([]kafka.Message, len(records))
+	for i, record := range records {
+		msgs[i] = kafka.Message{Value: record}
+	}
+	return k.writer.WriteMessages(ctx, msgs...)
+}
+
+// httpSender 以NDJSON发送到Fluentd或Vector的HTTP输入
+type httpSender struct {
+	url    string
+	client *http.Client
+}
+
+// Send 一批日志合并为一个请求
+func (h *httpSender) Send(ctx context.Context, records [][]byte) error {
+	body := bytes.Join(records, []byte("\n"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("日志发送失败: status=%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SinkStats 返回远程发送统计，未启用远程发送时返回ok为false
+func (l *Logger) SinkStats() (SinkStats, bool) {
+	if l.sink == nil {
+		return SinkStats{}, false
+	}
+	return l.sink.Stats(), true
+}
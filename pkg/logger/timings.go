@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Timings 记录请求各阶段的耗时，用于慢请求日志
+// 通过上下文在调用链中传递，同一阶段多次记录时累加
+type Timings struct {
+	mu      sync.Mutex
+	elapsed map[string]time.Duration
+}
+
+type timingsKey struct{}
+
+// NewTimings 创建阶段耗时记录
+func NewTimings() *Timings {
+	return &Timings{elapsed: make(map[string]time.Duration)}
+}
+
+// WithTimings 在上下文中记录阶段耗时
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// TimingsFromContext 返回上下文中的阶段耗时记录，没有时返回nil
+func TimingsFromContext(ctx context.Context) *Timings {
+	t, _ := ctx.Value(timingsKey{}).(*Timings)
+	return t
+}
+
+// Add 累加阶段耗时，t为nil时忽略
+func (t *Timings) Add(stage string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.elapsed[stage] += d
+}
+
+// Since 累加从start到现在的阶段耗时
+func (t *Timings) Since(stage string, start time.Time) {
+	t.Add(stage, time.Since(start))
+}
+
+// Milliseconds 返回各阶段耗时(毫秒)，用于结构化日志
+func (t *Timings) Milliseconds() map[string]float64 {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := make(map[string]float64, len(t.elapsed))
+	for stage, d := range t.elapsed {
+		result[stage] = float64(d.Microseconds()) / 1000
+	}
+	return result
+}
@@ -0,0 +1,19 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultAggregatePath 默认预聚合指标路径
+const defaultAggregatePath = "/metrics/aggregate"
+
+// RegisterAggregate 注册预聚合指标，与按广告统计的原始指标分开暴露
+// 预聚合指标只带service标签，由采集方按抓取目标附加instance，不推送到PushGateway
+func (m *Metrics) RegisterAggregate(collector prometheus.Collector) error {
+	return m.aggregateRegisterer.Register(collector)
+}
+
+// AggregateRegistry 返回预聚合指标的注册表
+func (m *Metrics) AggregateRegistry() *prometheus.Registry {
+	return m.aggregate
+}
@@ -0,0 +1,244 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: bootstrap.go
+ * Project: simple-dsp
+ * Description: 指标启动入口，各服务统一通过Bootstrap初始化指标
+ *
+ * 主要功能:
+ * - 创建指标并注册到服务独立的注册表
+ * - 为所有指标附加service和instance标签
+ * - 按配置启动指标HTTP服务和PushGateway推送
+ *
+ * 实现细节:
+ * - 指标注册到独立的注册表，不使用全局默认注册表
+ * - 注册表同时包含Go运行时和进程指标
+ * - PushGateway的job为服务名，分组标签为实例名，推送时去掉指标自带的instance标签
+ * - 推送间隔带随机抖动，首次推送同样等待一个带抖动的间隔
+ * - 关闭时删除PushGateway中本实例的分组，避免残留过期指标
+ * - HTTP服务支持OpenMetrics格式，以便输出延迟指标的exemplar
+ * - 预聚合指标使用另一个注册表，在单独的路径暴露，看板不必抓取按广告统计的高基数指标
+ *
+ * 注意事项:
+ * - 每个进程只调用一次Bootstrap
+ * - 未启用指标时仍返回可用的指标对象，只是不对外暴露
+ * - 退出前调用Close停止推送和HTTP服务
+ */
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+
+	"simple-dsp/pkg/config"
+)
+
+const (
+	// defaultPushInterval 默认推送到PushGateway的间隔
+	defaultPushInterval = 15 * time.Second
+	// pushTimeout 单次推送或删除的超时时间
+	pushTimeout = 5 * time.Second
+	// maxPushJitter 推送间隔的最大抖动比例
+	maxPushJitter = 0.5
+	// defaultPath 默认指标路径
+	defaultPath = "/metrics"
+)
+
+// ErrServiceRequired 表示未指定服务名
+var ErrServiceRequired = errors.New("指标服务名不能为空")
+
+// Bootstrap 初始化服务的指标
+// service为服务名，作为service标签和PushGateway的job；实例名取配置的instance，为空时使用主机名
+func Bootstrap(cfg config.MetricsConfig, service string) (*Metrics, error) {
+	if service == "" {
+		return nil, ErrServiceRequired
+	}
+
+	instance, err := instanceName(cfg.Instance)
+	if err != nil {
+		return nil, err
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	labels := prometheus.Labels{"service": service, "instance": instance}
+	registerer := prometheus.WrapRegistererWith(labels, registry)
+	m := newMetrics(registerer)
+	m.registry = registry
+	m.registerer = registerer
+	m.aggregate = prometheus.NewRegistry()
+	m.aggregateRegisterer = prometheus.WrapRegistererWith(prometheus.Labels{"service": service}, m.aggregate)
+
+	if !cfg.Enabled {
+		return m, nil
+	}
+
+	if cfg.HTTPEnabled {
+		if err := m.serve(cfg.Port, cfg.Path, cfg.AggregatePath); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PushGateway != "" {
+		pusher := push.New(cfg.PushGateway, service).
+			Grouping("instance", instance).
+			Client(&http.Client{Timeout: pushTimeout})
+		m.startPush(pusher, cfg.PushInterval, cfg.PushJitter)
+	}
+	return m, nil
+}
+
+// Registry 返回指标注册表
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Close 停止推送、删除PushGateway中本实例的分组并关闭指标HTTP服务
+func (m *Metrics) Close() error {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+	if m.server != nil {
+		return m.server.Close()
+	}
+	return nil
+}
+
+// serve 启动指标HTTP服务，原始指标和预聚合指标分别在path和aggregatePath暴露，端口被占用时返回错误
+func (m *Metrics) serve(port int, path, aggregatePath string) error {
+	if path == "" {
+		path = defaultPath
+	}
+	if aggregatePath == "" {
+		aggregatePath = defaultAggregatePath
+	}
+	if aggregatePath == path {
+		return fmt.Errorf("预聚合指标路径不能与指标路径相同: %s", path)
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("监听指标端口失败: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	mux.Handle(aggregatePath, promhttp.HandlerFor(m.aggregate, promhttp.HandlerOpts{}))
+	m.server = &http.Server{Handler: m.guard(mux)}
+
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("Metrics server error: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// SetAccessControl 限制指标HTTP服务的访问，allow返回false的请求返回403，为nil时不限制
+func (m *Metrics) SetAccessControl(allow func(*http.Request) bool) {
+	if allow == nil {
+		m.access.Store(nil)
+		return
+	}
+	m.access.Store(&allow)
+}
+
+// guard 按SetAccessControl设置的规则拒绝请求
+func (m *Metrics) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allow := m.access.Load(); allow != nil && !(*allow)(r) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// startPush 按带抖动的间隔推送注册表中的指标，停止时删除本实例的分组
+func (m *Metrics) startPush(pusher *push.Pusher, interval time.Duration, jitter float64) {
+	pusher.Gatherer(withoutLabel(m.registry, "instance"))
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+		timer := time.NewTimer(nextPush(interval, jitter))
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				if err := pusher.Push(); err != nil {
+					fmt.Printf("Push failed: %v\n", err)
+				}
+				timer.Reset(nextPush(interval, jitter))
+			case <-m.stop:
+				if err := pusher.Delete(); err != nil {
+					fmt.Printf("Delete push group failed: %v\n", err)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// nextPush 返回下一次推送的等待时间，在间隔上下浮动jitter比例
+func nextPush(interval time.Duration, jitter float64) time.Duration {
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	if jitter <= 0 {
+		return interval
+	}
+	if jitter > maxPushJitter {
+		jitter = maxPushJitter
+	}
+	return time.Duration(float64(interval) * (1 + jitter*(2*rand.Float64()-1)))
+}
+
+// withoutLabel 去掉采集结果中的指定标签
+// PushGateway不允许指标自带分组标签，instance改由分组键提供
+func withoutLabel(g prometheus.Gatherer, name string) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		families, err := g.Gather()
+		for _, mf := range families {
+			for _, metric := range mf.GetMetric() {
+				labels := metric.Label[:0]
+				for _, lp := range metric.GetLabel() {
+					if lp.GetName() != name {
+						labels = append(labels, lp)
+					}
+				}
+				metric.Label = labels
+			}
+		}
+		return families, err
+	})
+}
+
+// instanceName 返回实例名，未配置时使用主机名
+func instanceName(instance string) (string, error) {
+	if instance != "" {
+		return instance, nil
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("获取主机名失败: %w", err)
+	}
+	return host, nil
+}
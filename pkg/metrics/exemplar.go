@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 竞价延迟SLO结果标签
+const (
+	SLOResultMet    = "met"
+	SLOResultMissed = "missed"
+)
+
+// SLOBudgets 竞价请求的延迟预算，每个预算单独统计达标和超时的请求数
+var SLOBudgets = []time.Duration{50 * time.Millisecond, 100 * time.Millisecond}
+
+// traceIDLabel exemplar中追踪ID的标签名
+const traceIDLabel = "trace_id"
+
+type traceIDKey struct{}
+
+// WithTraceID 在上下文中记录追踪ID，延迟指标以exemplar形式关联该ID
+func WithTraceID(ctx context.Context, traceID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceIDKey{}, traceID)
+}
+
+// TraceID 返回上下文中的追踪ID
+func TraceID(ctx context.Context) string {
+	traceID, _ := ctx.Value(traceIDKey{}).(string)
+	return traceID
+}
+
+// ParseTraceparent 从W3C traceparent请求头中解析追踪ID，格式无效时返回空串
+func ParseTraceparent(header string) string {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return ""
+	}
+	traceID := strings.ToLower(parts[1])
+	if len(traceID) != 32 || strings.Trim(traceID, "0") == "" {
+		return ""
+	}
+	for _, r := range traceID {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'f') {
+			return ""
+		}
+	}
+	return traceID
+}
+
+// ObserveWithTrace 记录观测值，上下文带有追踪ID时附加exemplar
+// 观测器不支持exemplar或追踪ID过长时按普通观测值记录
+func ObserveWithTrace(ctx context.Context, observer prometheus.Observer, value float64) {
+	traceID := TraceID(ctx)
+	exemplarObserver, ok := observer.(prometheus.ExemplarObserver)
+	if !ok || traceID == "" || utf8.RuneCountInString(traceIDLabel)+utf8.RuneCountInString(traceID) > prometheus.ExemplarMaxRunes {
+		observer.Observe(value)
+		return
+	}
+	exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{traceIDLabel: traceID})
+}
+
+// ObserveBidSLO 按延迟预算统计竞价请求是否达标
+func (m *Metrics) ObserveBidSLO(duration time.Duration) {
+	for _, budget := range SLOBudgets {
+		result := SLOResultMet
+		if duration > budget {
+			result = SLOResultMissed
+		}
+		m.Bid.SLO.WithLabelValues(budget.String(), result).Inc()
+	}
+}
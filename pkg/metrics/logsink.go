@@ -0,0 +1,36 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"simple-dsp/pkg/logger"
+)
+
+// RegisterLogSink 注册日志远程发送的计数，未启用远程发送时不注册
+// 计数在采集时从日志记录器读取，result为sent、dropped或failed
+func (m *Metrics) RegisterLogSink(log *logger.Logger) error {
+	if _, ok := log.SinkStats(); !ok {
+		return nil
+	}
+
+	results := map[string]func(logger.SinkStats) uint64{
+		"sent":    func(s logger.SinkStats) uint64 { return s.Sent },
+		"dropped": func(s logger.SinkStats) uint64 { return s.Dropped },
+		"failed":  func(s logger.SinkStats) uint64 { return s.Failed },
+	}
+	for result, value := range results {
+		value := value
+		counter := prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name:        "dsp_log_sink_records_total",
+			Help:        "日志远程发送的日志条数",
+			ConstLabels: prometheus.Labels{"result": result},
+		}, func() float64 {
+			stats, _ := log.SinkStats()
+			return float64(value(stats))
+		})
+		if err := m.registerer.Register(counter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
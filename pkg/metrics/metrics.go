@@ -33,18 +33,11 @@
 package metrics
 
 import (
-	"errors"
-	"fmt"
 	"net/http"
-	"time"
-
-	"github.com/prometheus/client_golang/prometheus/push"
-
-	"simple-dsp/pkg/config"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // 模块化指标定义（网页4）
@@ -52,6 +45,14 @@ type (
 	HTTPMetrics struct {
 		RequestTotal    *prometheus.CounterVec
 		RequestDuration *prometheus.HistogramVec
+		// InFlight 正在处理的竞价请求数
+		InFlight prometheus.Gauge
+		// Queued 等待并发槽位的竞价请求数
+		Queued prometheus.Gauge
+		// Shed 过载保护拒绝的请求数，reason为cpu、concurrency、queue_full或queue_timeout
+		Shed *prometheus.CounterVec
+		// Rejected 请求限制拒绝的请求数，group为路由组，reason为body_too_large或read_timeout
+		Rejected *prometheus.CounterVec
 	}
 
 	GRPCMetrics struct {
@@ -67,6 +68,28 @@ type (
 		Price     *prometheus.HistogramVec
 		WinPrice  *prometheus.HistogramVec
 		Duration  prometheus.Histogram
+		// StageTimeouts 按阶段统计的超时次数
+		StageTimeouts *prometheus.CounterVec
+		// FloorAdjustments 底价情报调整出价次数
+		FloorAdjustments *prometheus.CounterVec
+		// FloorRejections 按请求底价淘汰的候选和广告位数
+		FloorRejections *prometheus.CounterVec
+		// Preemptions 高优先级策略抢占次数
+		Preemptions *prometheus.CounterVec
+		// SKAdNetwork 出价广告的SKAdNetwork签名结果
+		SKAdNetwork *prometheus.CounterVec
+		// ProfileLookups 竞价时读取用户特征的结果
+		ProfileLookups *prometheus.CounterVec
+		// EnrichmentLookups 按设备缓存的请求上下文的查询结果
+		EnrichmentLookups *prometheus.CounterVec
+		// RTAAdjustments 按RTA出价信号调整的出价次数
+		RTAAdjustments *prometheus.CounterVec
+		// Rejections 候选在排序前过滤或胜出后未通过最终检查的次数
+		Rejections *prometheus.CounterVec
+		// Throttled 策略按参与率抽样未参与竞价的次数
+		Throttled *prometheus.CounterVec
+		// SLO 按延迟预算统计的竞价请求达标情况
+		SLO *prometheus.CounterVec
 	}
 
 	FrequencyMetrics struct {
@@ -75,6 +98,12 @@ type (
 		CheckDuration  prometheus.Histogram
 		RecordTotal    prometheus.Counter
 		RecordDuration prometheus.Histogram
+		// IdentityLookups 跨设备频次控制的身份解析次数，result为linked、unlinked、cached或error
+		IdentityLookups *prometheus.CounterVec
+		// IdentityLinks 接收的身份关联数，source为kafka或api，result为ok、invalid或error
+		IdentityLinks *prometheus.CounterVec
+		// QPSLimited 因超过QPS被拒绝的竞价数，scope为ad或campaign
+		QPSLimited *prometheus.CounterVec
 	}
 
 	CreativeMetrics struct {
@@ -109,11 +138,48 @@ type (
 		Impressions *prometheus.CounterVec
 		Clicks      *prometheus.CounterVec
 		Conversions *prometheus.CounterVec
+		Wins        *prometheus.CounterVec
+		// Viewable 可见展示数
+		Viewable *prometheus.CounterVec
+		// Video 视频播放进度事件数，stage为事件类型
+		Video *prometheus.CounterVec
+		// DwellTime 落地页停留时长分布(秒)
+		DwellTime prometheus.Histogram
+		// PriceDecryptErrors 成交价解密失败次数
+		PriceDecryptErrors *prometheus.CounterVec
+		// PipelineDepth 事件管道中待写出的事件数
+		PipelineDepth prometheus.Gauge
+		// PipelineRejected 队列已满被拒绝的事件数
+		PipelineRejected  *prometheus.CounterVec
+		PipelineDropped   prometheus.Counter
+		PipelineFlushSize prometheus.Histogram
+		// BidValidation 展示和竞价成功通知的出价校验结果
+		BidValidation *prometheus.CounterVec
+		// DuplicateWins 按竞价ID去重后忽略的重复竞价成功通知数
+		DuplicateWins *prometheus.CounterVec
+		// SKAdNetworkPostbacks SKAdNetwork回传处理结果
+		SKAdNetworkPostbacks *prometheus.CounterVec
+		// PixelHits 再营销像素处理结果
+		PixelHits *prometheus.CounterVec
+		// AdRenders 按广告地址获取广告代码的处理结果
+		AdRenders *prometheus.CounterVec
+		// Buffered Kafka不可用时内存缓冲中待重放的事件数
+		Buffered prometheus.Gauge
+		// Spilled 内存缓冲已满时写入本地磁盘的事件数
+		Spilled prometheus.Counter
+		// SpillBytes 本地磁盘中待重放的事件字节数
+		SpillBytes prometheus.Gauge
+		// Replayed Kafka恢复后重放写出的事件数
+		Replayed prometheus.Counter
+		// BufferDropped 缓冲和磁盘都无法容纳而丢弃的事件数
+		BufferDropped *prometheus.CounterVec
 	}
 
 	BudgetMetrics struct {
 		Cost        *prometheus.CounterVec
 		DailyBudget *prometheus.CounterVec
+		// VelocityChecks 消耗速度保护按出价策略检查的结果
+		VelocityChecks *prometheus.CounterVec
 	}
 
 	RTAMetrics struct {
@@ -121,12 +187,86 @@ type (
 		BatchCheckDuration prometheus.Histogram
 		Requests           prometheus.Counter
 		Errors             prometheus.Counter
+		// Hedges 发送的对冲请求数
+		Hedges prometheus.Counter
+		// StaleResults 使用保留结果代替RTA查询的次数
+		StaleResults *prometheus.CounterVec
 	}
 
 	TrackingMetrics struct {
 		Duration *prometheus.HistogramVec
 		Success  *prometheus.CounterVec
 		Failure  *prometheus.CounterVec
+		// QueueDepth 持久化队列中待投递和投递中的事件数
+		QueueDepth prometheus.Gauge
+		Retries    *prometheus.CounterVec
+		// Dropped 放弃投递的事件数，按原因区分
+		Dropped *prometheus.CounterVec
+		// BreakerState 熔断器状态：1熔断，2半开，恢复后删除
+		BreakerState    *prometheus.GaugeVec
+		BreakerTrips    *prometheus.CounterVec
+		BreakerDeferred *prometheus.CounterVec
+		// ReceiptsDropped 未能保存的投递回执数，reason为buffer_full或write_error
+		ReceiptsDropped *prometheus.CounterVec
+	}
+
+	// ExchangeMetrics 按交易平台统计的流量指标
+	ExchangeMetrics struct {
+		Requests *prometheus.CounterVec
+		Duration *prometheus.HistogramVec
+		Rejected *prometheus.CounterVec
+		// EffectiveQPS 全局限流当前生效的QPS
+		EffectiveQPS prometheus.Gauge
+		// DependencyHealthy 自适应限流评估的下游是否正常：1正常，0异常
+		DependencyHealthy *prometheus.GaugeVec
+		// SupplyChain 按验证结果统计的请求供应链
+		SupplyChain *prometheus.CounterVec
+		// SupplyChainFetches 抓取ads.txt、app-ads.txt和sellers.json的结果
+		SupplyChainFetches *prometheus.CounterVec
+	}
+
+	// LeaderMetrics 后台任务选主指标
+	LeaderMetrics struct {
+		// IsLeader 当前实例是否为主：1是，0否
+		IsLeader *prometheus.GaugeVec
+		// Transitions 当选和卸任的次数
+		Transitions *prometheus.CounterVec
+	}
+
+	// DatabaseMetrics 数据库语句指标，query为语句名称，未命名时为表名
+	DatabaseMetrics struct {
+		// Duration 语句耗时分布，计数即为执行次数
+		Duration *prometheus.HistogramVec
+		// Rows 语句返回或影响的行数分布
+		Rows *prometheus.HistogramVec
+		// Errors 语句执行失败次数，记录不存在不计为失败
+		Errors *prometheus.CounterVec
+		// ReplicaHealthy 只读副本是否可用：1可用，0不可用
+		ReplicaHealthy *prometheus.GaugeVec
+		// Reads 标记为只读的查询数，target为replica或primary，primary表示没有可用的副本
+		Reads *prometheus.CounterVec
+	}
+
+	// ChaosMetrics 故障注入指标，仅在非生产环境启用故障注入时有数据
+	ChaosMetrics struct {
+		// Injected 注入的故障数，dependency为redis、kafka、rta或postgres，fault为latency或error
+		Injected *prometheus.CounterVec
+	}
+
+	// OutboundMetrics 出站HTTP请求指标，destination为rta、tracking或supply_chain
+	OutboundMetrics struct {
+		// Duration 每次尝试的耗时分布，包括重试
+		Duration *prometheus.HistogramVec
+		// Requests 按结果统计的尝试次数，result为2xx、3xx、4xx、5xx或error
+		Requests *prometheus.CounterVec
+		// Retries 重试次数
+		Retries *prometheus.CounterVec
+		// DNSLookups 域名解析次数，result为hit、miss、stale或error
+		DNSLookups *prometheus.CounterVec
+		// DNSLookupDuration 向DNS服务器解析的耗时分布，不包括命中缓存的解析
+		DNSLookupDuration prometheus.Histogram
+		// DNSCacheEntries 缓存的域名数
+		DNSCacheEntries prometheus.Gauge
 	}
 )
 
@@ -142,7 +282,22 @@ type Metrics struct {
 	Events    *EventMetrics
 	RTA       *RTAMetrics
 	Tracking  *TrackingMetrics
-	server    *http.Server
+	Exchange  *ExchangeMetrics
+	Leader    *LeaderMetrics
+	Database  *DatabaseMetrics
+	Chaos     *ChaosMetrics
+	Outbound  *OutboundMetrics
+
+	registry   *prometheus.Registry
+	registerer prometheus.Registerer
+	server     *http.Server
+	access     atomic.Pointer[func(*http.Request) bool]
+	stop       chan struct{}
+	done       chan struct{}
+
+	// aggregate 预聚合的低基数指标，供运营看板使用，与原始指标分开暴露
+	aggregate           *prometheus.Registry
+	aggregateRegisterer prometheus.Registerer
 }
 
 // NoopMetrics NoopMetrics实现
@@ -179,23 +334,20 @@ func (m *NoopMetrics) Add(float64)                                   {}
 func (m *NoopMetrics) WithLabelValues(...string) prometheus.Observer { return m }
 func (m *NoopMetrics) With(prometheus.Labels) prometheus.Observer    { return m }
 
-func NewMetrics(cfg config.MetricsConfig) (*Metrics, error) {
-	if !cfg.Enabled {
-		return &Metrics{}, nil
-	}
-
-	registry := prometheus.NewRegistry()
+// newMetrics 创建全部指标并注册到registerer
+func newMetrics(registerer prometheus.Registerer) *Metrics {
+	factory := promauto.With(registerer)
 
 	metrics := &Metrics{
 		HTTP: &HTTPMetrics{
-			RequestTotal: promauto.NewCounterVec(
+			RequestTotal: factory.NewCounterVec(
 				prometheus.CounterOpts{
 					Name: "http_requests_total",
 					Help: "HTTP请求总数",
 				},
 				[]string{"method", "path", "status"},
 			),
-			RequestDuration: promauto.NewHistogramVec(
+			RequestDuration: factory.NewHistogramVec(
 				prometheus.HistogramOpts{
 					Name:    "http_request_duration_seconds",
 					Help:    "HTTP请求延迟分布",
@@ -203,17 +355,33 @@ func NewMetrics(cfg config.MetricsConfig) (*Metrics, error) {
 				},
 				[]string{"method", "path"},
 			),
+			InFlight: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_http_in_flight_requests",
+				Help: "正在处理的竞价请求数",
+			}),
+			Queued: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_http_queued_requests",
+				Help: "等待并发槽位的竞价请求数",
+			}),
+			Shed: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_http_shed_requests_total",
+				Help: "过载保护拒绝的请求数",
+			}, []string{"reason"}),
+			Rejected: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_http_rejected_requests_total",
+				Help: "请求体过大或读取超时被拒绝的请求数",
+			}, []string{"group", "reason"}),
 		},
 
 		GRPC: &GRPCMetrics{
-			RequestTotal: promauto.NewCounterVec(
+			RequestTotal: factory.NewCounterVec(
 				prometheus.CounterOpts{
 					Name: "grpc_requests_total",
 					Help: "gRPC请求总数",
 				},
 				[]string{"method", "status"},
 			),
-			RequestDuration: promauto.NewHistogramVec(
+			RequestDuration: factory.NewHistogramVec(
 				prometheus.HistogramOpts{
 					Name:    "grpc_request_duration_seconds",
 					Help:    "gRPC请求延迟分布",
@@ -224,120 +392,183 @@ func NewMetrics(cfg config.MetricsConfig) (*Metrics, error) {
 		},
 
 		Bid: &BidMetrics{
-			Requests: promauto.NewCounter(prometheus.CounterOpts{
+			Requests: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_bid_requests_total",
 				Help: "竞价请求总数",
 			}),
-			Responses: promauto.NewCounter(prometheus.CounterOpts{
+			Responses: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_bid_responses_total",
 				Help: "竞价响应总数",
 			}),
-			Errors: promauto.NewCounter(prometheus.CounterOpts{
+			Errors: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_bid_errors_total",
 				Help: "竞价错误总数",
 			}),
-			Latency: promauto.NewHistogram(prometheus.HistogramOpts{
+			Latency: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_bid_latency_seconds",
 				Help:    "竞价延迟分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			Price: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Price: factory.NewHistogramVec(prometheus.HistogramOpts{
 				Name:    "dsp_bid_price",
 				Help:    "竞价出价分布",
 				Buckets: prometheus.LinearBuckets(0, 10, 10),
 			}, []string{"ad_type", "campaign"}),
-			WinPrice: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			WinPrice: factory.NewHistogramVec(prometheus.HistogramOpts{
 				Name:    "dsp_win_price",
 				Help:    "竞价获胜价格分布",
 				Buckets: prometheus.LinearBuckets(0, 10, 10),
 			}, []string{"ad_type", "campaign"}),
-			Duration: promauto.NewHistogram(prometheus.HistogramOpts{
+			Duration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_bid_duration_seconds",
 				Help:    "竞价处理时间分布",
 				Buckets: prometheus.DefBuckets,
 			}),
+			StageTimeouts: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_stage_timeouts_total",
+				Help: "竞价各阶段超时次数",
+			}, []string{"stage"}),
+			FloorAdjustments: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_floor_adjustments_total",
+				Help: "底价情报调整出价次数",
+			}, []string{"exchange", "action"}),
+			FloorRejections: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_floor_rejections_total",
+				Help: "按请求底价淘汰的次数，reason为below_floor(候选出价低于底价)或unknown_currency(底价货币没有汇率，广告位不参与竞价，campaign为空)",
+			}, []string{"exchange", "campaign", "reason"}),
+			Preemptions: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_preemptions_total",
+				Help: "高优先级策略抢占加权eCPM更高候选的次数",
+			}, []string{"priority"}),
+			SKAdNetwork: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_skadnetwork_total",
+				Help: "出价广告的SKAdNetwork签名结果(signed,ineligible,error)",
+			}, []string{"result"}),
+			ProfileLookups: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_profile_lookups_total",
+				Help: "竞价时读取用户特征的结果(hit,miss,error,no_consent)",
+			}, []string{"result"}),
+			EnrichmentLookups: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_enrichment_lookups_total",
+				Help: "按设备缓存的请求上下文的查询结果(hit,miss)",
+			}, []string{"result"}),
+			RTAAdjustments: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_rta_adjustments_total",
+				Help: "按RTA出价信号调整的出价次数，direction为raised、lowered或unchanged，clamped表示出价系数被截断",
+			}, []string{"direction", "clamped"}),
+			Rejections: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_candidate_rejections_total",
+				Help: "竞价候选被淘汰的次数，stage为prefilter(排序前过滤)或final(胜出后最终检查)，reason为qps、budget、frequency或schain(推广计划要求已授权的供应链)",
+			}, []string{"stage", "reason"}),
+			Throttled: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_throttled_total",
+				Help: "策略按参与率抽样未参与竞价的次数，level为strategy(策略参与率)或advertiser(广告主参与率)",
+			}, []string{"level"}),
+			SLO: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_bid_slo_requests_total",
+				Help: "按延迟预算统计的竞价请求数，result为met或missed",
+			}, []string{"budget", "result"}),
+		},
+
+		Budget: &BudgetMetrics{
+			VelocityChecks: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_budget_velocity_checks_total",
+				Help: "消耗速度保护按出价策略检查的结果(ok,paused,grace,failed)",
+			}, []string{"result"}),
 		},
 
 		Frequency: &FrequencyMetrics{
-			CheckTotal: promauto.NewCounter(prometheus.CounterOpts{
+			CheckTotal: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_frequency_check_total",
 				Help: "频次检查总数",
 			}),
-			LimitExceeded: promauto.NewCounter(prometheus.CounterOpts{
+			LimitExceeded: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_frequency_limit_exceeded_total",
 				Help: "频次超限总数",
 			}),
-			CheckDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			CheckDuration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_frequency_check_duration_seconds",
 				Help:    "频次检查耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			RecordTotal: promauto.NewCounter(prometheus.CounterOpts{
+			RecordTotal: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_frequency_record_total",
 				Help: "频次记录总数",
 			}),
-			RecordDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			RecordDuration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_frequency_record_duration_seconds",
 				Help:    "频次记录耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}),
+			IdentityLookups: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_frequency_identity_lookups_total",
+				Help: "跨设备频次控制的身份解析次数",
+			}, []string{"result"}),
+			IdentityLinks: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_frequency_identity_links_total",
+				Help: "接收的设备与用户关联数",
+			}, []string{"source", "result"}),
+			QPSLimited: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_frequency_qps_limited_total",
+				Help: "因超过QPS被拒绝的竞价数",
+			}, []string{"scope"}),
 		},
 
 		Creative: &CreativeMetrics{
-			Uploaded: promauto.NewCounter(prometheus.CounterOpts{
+			Uploaded: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_uploaded_total",
 				Help: "素材上传总数",
 			}),
-			Deleted: promauto.NewCounter(prometheus.CounterOpts{
+			Deleted: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_deleted_total",
 				Help: "素材删除总数",
 			}),
-			Size: promauto.NewHistogram(prometheus.HistogramOpts{
+			Size: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_creative_size_bytes",
 				Help:    "素材大小分布",
 				Buckets: prometheus.ExponentialBuckets(1024, 2, 10),
 			}),
-			GroupCreated: promauto.NewCounter(prometheus.CounterOpts{
+			GroupCreated: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_group_created_total",
 				Help: "素材组创建总数",
 			}),
-			GroupDeleted: promauto.NewCounter(prometheus.CounterOpts{
+			GroupDeleted: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_group_deleted_total",
 				Help: "素材组删除总数",
 			}),
-			UploadDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			UploadDuration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_creative_upload_duration_seconds",
 				Help:    "素材上传耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			AuditTotal: promauto.NewCounter(prometheus.CounterOpts{
+			AuditTotal: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_audit_total",
 				Help: "素材审核总数",
 			}),
-			AuditApproved: promauto.NewCounter(prometheus.CounterOpts{
+			AuditApproved: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_audit_approved_total",
 				Help: "素材审核通过总数",
 			}),
-			AuditRejected: promauto.NewCounter(prometheus.CounterOpts{
+			AuditRejected: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_creative_audit_rejected_total",
 				Help: "素材审核拒绝总数",
 			}),
 		},
 
 		Cache: &CacheMetrics{
-			Hits: promauto.NewCounter(prometheus.CounterOpts{
+			Hits: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_cache_hits_total",
 				Help: "缓存命中总数",
 			}),
-			Misses: promauto.NewCounter(prometheus.CounterOpts{
+			Misses: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_cache_misses_total",
 				Help: "缓存未命中总数",
 			}),
-			Errors: promauto.NewCounter(prometheus.CounterOpts{
+			Errors: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_cache_errors_total",
 				Help: "缓存错误总数",
 			}),
-			Latency: promauto.NewHistogram(prometheus.HistogramOpts{
+			Latency: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_cache_latency_seconds",
 				Help:    "缓存操作延迟分布",
 				Buckets: prometheus.DefBuckets,
@@ -345,28 +576,28 @@ func NewMetrics(cfg config.MetricsConfig) (*Metrics, error) {
 		},
 
 		Storage: &StorageMetrics{
-			UploadTotal: promauto.NewCounter(prometheus.CounterOpts{
+			UploadTotal: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_storage_upload_total",
 				Help: "存储上传总数",
 			}),
-			UploadErrors: promauto.NewCounter(prometheus.CounterOpts{
+			UploadErrors: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_storage_upload_errors_total",
 				Help: "存储上传错误总数",
 			}),
-			UploadLatency: promauto.NewHistogram(prometheus.HistogramOpts{
+			UploadLatency: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_storage_upload_latency_seconds",
 				Help:    "存储上传延迟分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			DeleteTotal: promauto.NewCounter(prometheus.CounterOpts{
+			DeleteTotal: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_storage_delete_total",
 				Help: "存储删除总数",
 			}),
-			DeleteErrors: promauto.NewCounter(prometheus.CounterOpts{
+			DeleteErrors: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_storage_delete_errors_total",
 				Help: "存储删除错误总数",
 			}),
-			DeleteLatency: promauto.NewHistogram(prometheus.HistogramOpts{
+			DeleteLatency: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_storage_delete_latency_seconds",
 				Help:    "存储删除延迟分布",
 				Buckets: prometheus.DefBuckets,
@@ -374,211 +605,297 @@ func NewMetrics(cfg config.MetricsConfig) (*Metrics, error) {
 		},
 
 		Events: &EventMetrics{
-			Impressions: promauto.NewCounterVec(
+			Impressions: factory.NewCounterVec(
 				prometheus.CounterOpts{
 					Name: "dsp_event_impression",
 					Help: "曝光数",
 				},
 				[]string{"ad_id", "slot_id"},
 			),
-			Clicks: promauto.NewCounterVec(
+			Clicks: factory.NewCounterVec(
 				prometheus.CounterOpts{
 					Name: "dsp_event_clicks",
 					Help: "点击数",
 				},
 				[]string{"ad_id", "slot_id"},
 			),
-			Conversions: promauto.NewCounterVec(
+			Conversions: factory.NewCounterVec(
 				prometheus.CounterOpts{
 					Name: "dsp_event_conversions",
 					Help: "点击数",
 				},
 				[]string{"ad_id", "slot_id"},
 			),
+			Wins: factory.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "dsp_event_wins",
+					Help: "竞价成功通知数",
+				},
+				[]string{"ad_id", "slot_id"},
+			),
+			Viewable: factory.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "dsp_event_viewable_impressions",
+					Help: "可见展示数",
+				},
+				[]string{"ad_id", "slot_id"},
+			),
+			Video: factory.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "dsp_event_video",
+					Help: "视频播放进度事件数",
+				},
+				[]string{"ad_id", "stage"},
+			),
+			DwellTime: factory.NewHistogram(prometheus.HistogramOpts{
+				Name:    "dsp_event_dwell_seconds",
+				Help:    "落地页停留时长分布",
+				Buckets: []float64{1, 3, 5, 10, 30, 60, 120, 300},
+			}),
+			PriceDecryptErrors: factory.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "dsp_event_price_decrypt_errors_total",
+					Help: "成交价解密失败次数",
+				},
+				[]string{"exchange", "reason"},
+			),
+			PipelineDepth: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_event_pipeline_depth",
+				Help: "事件管道中待写出的事件数",
+			}),
+			PipelineRejected: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_pipeline_rejected_total",
+				Help: "事件队列已满被拒绝的事件数",
+			}, []string{"event_type"}),
+			PipelineDropped: factory.NewCounter(prometheus.CounterOpts{
+				Name: "dsp_event_pipeline_dropped_total",
+				Help: "重试后仍写出失败被丢弃的事件数",
+			}),
+			PipelineFlushSize: factory.NewHistogram(prometheus.HistogramOpts{
+				Name:    "dsp_event_pipeline_flush_size",
+				Help:    "事件管道每批写出的事件数",
+				Buckets: []float64{1, 5, 10, 25, 50, 100, 250, 500},
+			}),
+			BidValidation: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_bid_validation_total",
+				Help: "事件出价校验结果(ok,unknown_bid,price_mismatch,error)",
+			}, []string{"event_type", "result"}),
+			DuplicateWins: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_duplicate_wins_total",
+				Help: "按竞价ID去重后忽略的重复竞价成功通知数",
+			}, []string{"exchange"}),
+			SKAdNetworkPostbacks: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_skadnetwork_postbacks_total",
+				Help: "SKAdNetwork回传处理结果(converted,unverified,not_won,unmatched,invalid,signature)",
+			}, []string{"version", "result"}),
+			PixelHits: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_pixel_hits_total",
+				Help: "再营销像素处理结果(recorded,no_consent,invalid,error)",
+			}, []string{"result"}),
+			AdRenders: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_ad_renders_total",
+				Help: "按广告地址获取广告代码的处理结果(served,duplicate,invalid_token,expired,not_found,error)",
+			}, []string{"result"}),
+			Buffered: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_event_buffered",
+				Help: "Kafka不可用时内存缓冲中待重放的事件数",
+			}),
+			Spilled: factory.NewCounter(prometheus.CounterOpts{
+				Name: "dsp_event_spilled_total",
+				Help: "内存缓冲已满时写入本地磁盘的事件数",
+			}),
+			SpillBytes: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_event_spill_bytes",
+				Help: "本地磁盘中待重放的事件字节数",
+			}),
+			Replayed: factory.NewCounter(prometheus.CounterOpts{
+				Name: "dsp_event_replayed_total",
+				Help: "Kafka恢复后重放写出的事件数",
+			}),
+			BufferDropped: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_event_buffer_dropped_total",
+				Help: "缓冲无法容纳或无法重放而丢弃的事件数(full,corrupt,shutdown)",
+			}, []string{"reason"}),
 		},
 
 		RTA: &RTAMetrics{
-			CheckDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			CheckDuration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_rta_check_duration_seconds",
 				Help:    "RTA检查耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			BatchCheckDuration: promauto.NewHistogram(prometheus.HistogramOpts{
+			BatchCheckDuration: factory.NewHistogram(prometheus.HistogramOpts{
 				Name:    "dsp_rta_batch_check_duration_seconds",
 				Help:    "RTA批量检查耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}),
-			Requests: promauto.NewCounter(prometheus.CounterOpts{
+			Requests: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_rta_requests_total",
 				Help: "RTA请求总数",
 			}),
-			Errors: promauto.NewCounter(prometheus.CounterOpts{
+			Errors: factory.NewCounter(prometheus.CounterOpts{
 				Name: "dsp_rta_errors_total",
 				Help: "RTA错误总数",
 			}),
+			Hedges: factory.NewCounter(prometheus.CounterOpts{
+				Name: "dsp_rta_hedged_requests_total",
+				Help: "RTA查询超过对冲延迟后发送的对冲请求数",
+			}),
+			StaleResults: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_rta_stale_results_total",
+				Help: "使用保留结果代替RTA查询的次数，reason为prefer_stale、timeout或error",
+			}, []string{"reason"}),
 		},
 
 		Tracking: &TrackingMetrics{
-			Duration: promauto.NewHistogramVec(prometheus.HistogramOpts{
+			Duration: factory.NewHistogramVec(prometheus.HistogramOpts{
 				Name:    "dsp_tracking_duration_seconds",
 				Help:    "跟踪请求耗时分布",
 				Buckets: prometheus.DefBuckets,
 			}, []string{"event_type"}),
-			Success: promauto.NewCounterVec(prometheus.CounterOpts{
+			Success: factory.NewCounterVec(prometheus.CounterOpts{
 				Name: "dsp_tracking_success_total",
 				Help: "跟踪请求成功总数",
 			}, []string{"event_type"}),
-			Failure: promauto.NewCounterVec(prometheus.CounterOpts{
+			Failure: factory.NewCounterVec(prometheus.CounterOpts{
 				Name: "dsp_tracking_failure_total",
 				Help: "跟踪请求失败总数",
 			}, []string{"event_type"}),
+			QueueDepth: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_tracking_queue_depth",
+				Help: "跟踪事件队列深度",
+			}),
+			Retries: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_tracking_retries_total",
+				Help: "跟踪请求重试总数",
+			}, []string{"event_type"}),
+			Dropped: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_tracking_dropped_total",
+				Help: "放弃投递的跟踪事件总数",
+			}, []string{"event_type", "reason"}),
+			BreakerState: factory.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "dsp_tracking_breaker_state",
+				Help: "跟踪熔断器状态(1熔断,2半开)",
+			}, []string{"campaign_id", "event_type"}),
+			BreakerTrips: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_tracking_breaker_trips_total",
+				Help: "跟踪熔断器触发熔断总数",
+			}, []string{"event_type"}),
+			BreakerDeferred: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_tracking_breaker_deferred_total",
+				Help: "熔断期间推迟投递的跟踪事件总数",
+			}, []string{"event_type"}),
+			ReceiptsDropped: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_tracking_receipts_dropped_total",
+				Help: "未能保存的跟踪投递回执数",
+			}, []string{"reason"}),
 		},
-	}
 
-	// 注册全局采集器
-	registry.MustRegister(
-		metrics.HTTP.RequestTotal,
-		metrics.HTTP.RequestDuration,
-		metrics.GRPC.RequestTotal,
-		metrics.GRPC.RequestDuration,
-		metrics.Bid.Requests,
-		metrics.Bid.Responses,
-		metrics.Bid.Errors,
-		metrics.Bid.Latency,
-		metrics.Bid.Price,
-		metrics.Bid.WinPrice,
-		metrics.Bid.Duration,
-		metrics.Frequency.CheckTotal,
-		metrics.Frequency.LimitExceeded,
-		metrics.Frequency.CheckDuration,
-		metrics.Frequency.RecordTotal,
-		metrics.Frequency.RecordDuration,
-		metrics.Creative.Uploaded,
-		metrics.Creative.Deleted,
-		metrics.Creative.Size,
-		metrics.Creative.GroupCreated,
-		metrics.Creative.GroupDeleted,
-		metrics.Creative.UploadDuration,
-		metrics.Creative.AuditTotal,
-		metrics.Creative.AuditApproved,
-		metrics.Creative.AuditRejected,
-		metrics.Cache.Hits,
-		metrics.Cache.Misses,
-		metrics.Cache.Errors,
-		metrics.Cache.Latency,
-		metrics.Storage.UploadTotal,
-		metrics.Storage.UploadErrors,
-		metrics.Storage.UploadLatency,
-		metrics.Storage.DeleteTotal,
-		metrics.Storage.DeleteErrors,
-		metrics.Storage.DeleteLatency,
-		metrics.Events.Clicks,
-		metrics.Events.Impressions,
-		metrics.Events.Conversions,
-		metrics.Budget.DailyBudget,
-		metrics.Budget.Cost,
-		metrics.RTA.CheckDuration,
-		metrics.RTA.BatchCheckDuration,
-		metrics.RTA.Requests,
-		metrics.RTA.Errors,
-		metrics.Tracking.Duration,
-		metrics.Tracking.Success,
-		metrics.Tracking.Failure,
-	)
-
-	if cfg.HTTPEnabled {
-		mux := http.NewServeMux()
-		mux.Handle(cfg.Path, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
-
-		metrics.server = &http.Server{
-			Addr:    fmt.Sprintf(":%d", cfg.Port),
-			Handler: mux,
-		}
-
-		go func() {
-			if err := metrics.server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) && err != nil {
-				fmt.Printf("Metrics server error: %v\n", err)
-			}
-		}()
-	}
-
-	return metrics, nil
-}
+		Exchange: &ExchangeMetrics{
+			Requests: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_exchange_requests_total",
+				Help: "各交易平台流量请求总数",
+			}, []string{"exchange", "result"}),
+			Duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "dsp_exchange_request_duration_seconds",
+				Help:    "各交易平台流量请求耗时分布",
+				Buckets: prometheus.DefBuckets,
+			}, []string{"exchange"}),
+			Rejected: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_exchange_rejected_total",
+				Help: "各交易平台被拒绝的请求数",
+			}, []string{"exchange", "reason"}),
+			EffectiveQPS: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_traffic_effective_qps",
+				Help: "全局限流当前生效的QPS",
+			}),
+			DependencyHealthy: factory.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "dsp_traffic_dependency_healthy",
+				Help: "自适应限流评估的下游是否正常",
+			}, []string{"dependency"}),
+			SupplyChain: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_exchange_schain_total",
+				Help: "各交易平台请求的供应链验证结果，result为absent、invalid、incomplete、unknown、unauthorized或authorized",
+			}, []string{"exchange", "result"}),
+			SupplyChainFetches: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_schain_fetches_total",
+				Help: "抓取供应链授权文件的次数，kind为ads.txt、app-ads.txt或sellers.json，result为ok、not_found或error",
+			}, []string{"kind", "result"}),
+		},
+		Leader: &LeaderMetrics{
+			IsLeader: factory.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "dsp_leader_is_leader",
+				Help: "当前实例是否为该选主组的主实例",
+			}, []string{"election"}),
+			Transitions: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_leader_transitions_total",
+				Help: "当选和卸任的次数",
+			}, []string{"election", "event"}),
+		},
 
-// Close 关闭服务
-func (m *Metrics) Close() error {
-	if m.server != nil {
-		return m.server.Close()
-	}
-	return nil
-}
+		Database: &DatabaseMetrics{
+			Duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "dsp_db_query_duration_seconds",
+				Help:    "数据库语句耗时分布，operation为create、query、update、delete、row或raw",
+				Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+			}, []string{"query", "operation"}),
+			Rows: factory.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "dsp_db_query_rows",
+				Help:    "数据库语句返回或影响的行数分布",
+				Buckets: []float64{0, 1, 5, 10, 50, 100, 500, 1000, 5000},
+			}, []string{"query", "operation"}),
+			Errors: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_db_query_errors_total",
+				Help: "数据库语句执行失败次数",
+			}, []string{"query", "operation"}),
+			ReplicaHealthy: factory.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "dsp_db_replica_healthy",
+				Help: "只读副本是否可用",
+			}, []string{"replica"}),
+			Reads: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_db_readonly_queries_total",
+				Help: "只读查询按目标统计，primary表示没有可用的只读副本时回退到主库",
+			}, []string{"target"}),
+		},
 
-// StartPushGateway 推送指标到Gateway
-func (m *Metrics) StartPushGateway(url string) {
-	pusher := push.New(url, "dsp_metrics")
-
-	collectors := []prometheus.Collector{
-		m.HTTP.RequestTotal,
-		m.HTTP.RequestDuration,
-		m.GRPC.RequestTotal,
-		m.GRPC.RequestDuration,
-		m.Bid.Requests,
-		m.Bid.Responses,
-		m.Bid.Errors,
-		m.Bid.Latency,
-		m.Bid.Price,
-		m.Bid.WinPrice,
-		m.Bid.Duration,
-		m.Frequency.CheckTotal,
-		m.Frequency.LimitExceeded,
-		m.Frequency.CheckDuration,
-		m.Frequency.RecordTotal,
-		m.Frequency.RecordDuration,
-		m.Creative.Uploaded,
-		m.Creative.Deleted,
-		m.Creative.Size,
-		m.Creative.GroupCreated,
-		m.Creative.GroupDeleted,
-		m.Creative.UploadDuration,
-		m.Creative.AuditTotal,
-		m.Creative.AuditApproved,
-		m.Creative.AuditRejected,
-		m.Cache.Hits,
-		m.Cache.Misses,
-		m.Cache.Errors,
-		m.Cache.Latency,
-		m.Storage.UploadTotal,
-		m.Storage.UploadErrors,
-		m.Storage.UploadLatency,
-		m.Storage.DeleteTotal,
-		m.Storage.DeleteErrors,
-		m.Storage.DeleteLatency,
-		m.Events.Clicks,
-		m.Events.Impressions,
-		m.Events.Conversions,
-		m.Budget.DailyBudget,
-		m.Budget.Cost,
-		m.RTA.CheckDuration,
-		m.RTA.BatchCheckDuration,
-		m.RTA.Requests,
-		m.RTA.Errors,
-		m.Tracking.Duration,
-		m.Tracking.Success,
-		m.Tracking.Failure,
-	}
+		Chaos: &ChaosMetrics{
+			Injected: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_chaos_injected_total",
+				Help: "故障注入次数，按依赖和故障类型统计",
+			}, []string{"dependency", "fault"}),
+		},
 
-	for _, c := range collectors {
-		pusher.Collector(c)
+		Outbound: &OutboundMetrics{
+			Duration: factory.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "dsp_outbound_request_duration_seconds",
+				Help:    "出站HTTP请求每次尝试的耗时分布",
+				Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+			}, []string{"destination"}),
+			Requests: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_outbound_requests_total",
+				Help: "出站HTTP请求的尝试次数，result为2xx、3xx、4xx、5xx或error",
+			}, []string{"destination", "result"}),
+			Retries: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_outbound_retries_total",
+				Help: "出站HTTP请求的重试次数",
+			}, []string{"destination"}),
+			DNSLookups: factory.NewCounterVec(prometheus.CounterOpts{
+				Name: "dsp_outbound_dns_lookups_total",
+				Help: "出站HTTP请求的域名解析次数，result为hit、miss、stale或error",
+			}, []string{"result"}),
+			DNSLookupDuration: factory.NewHistogram(prometheus.HistogramOpts{
+				Name:    "dsp_outbound_dns_lookup_duration_seconds",
+				Help:    "出站HTTP请求向DNS服务器解析的耗时分布",
+				Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+			}),
+			DNSCacheEntries: factory.NewGauge(prometheus.GaugeOpts{
+				Name: "dsp_outbound_dns_cache_entries",
+				Help: "出站HTTP请求缓存的域名数",
+			}),
+		},
 	}
 
-	go func() {
-		ticker := time.NewTicker(15 * time.Second)
-		for range ticker.C {
-			if err := pusher.Push(); err != nil {
-				fmt.Printf("Push failed: %v\n", err)
-			}
-		}
-	}()
+	return metrics
 }
 
 // RecordHTTPRequest 操作方法示例
@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/config"
+)
+
+// AllowlistConfigKey 运行时IP白名单在配置中心的键
+const AllowlistConfigKey = "admin.allowlist"
+
+// allowlistRules 解析后的白名单规则
+type allowlistRules struct {
+	enabled bool
+	allowed []netip.Prefix
+	proxies []netip.Prefix
+}
+
+// IPAllowlist 按网段限制客户端IP，规则可在运行时整体替换
+// 不使用gin的ClientIP，避免默认信任所有代理时客户端伪造X-Forwarded-For绕过白名单
+type IPAllowlist struct {
+	rules atomic.Pointer[allowlistRules]
+}
+
+// NewIPAllowlist 创建IP白名单
+func NewIPAllowlist(cfg config.IPAllowlistConfig) (*IPAllowlist, error) {
+	a := &IPAllowlist{}
+	if err := a.Update(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Update 替换白名单规则，配置无效时保留原规则并返回错误
+func (a *IPAllowlist) Update(cfg config.IPAllowlistConfig) error {
+	if err := config.ValidateIPAllowlist(cfg); err != nil {
+		return err
+	}
+	a.rules.Store(&allowlistRules{
+		enabled: cfg.Enabled,
+		allowed: parsePrefixes(cfg.CIDRs),
+		proxies: parsePrefixes(cfg.TrustedProxies),
+	})
+	return nil
+}
+
+// Allow 请求的客户端IP是否在白名单中，未启用时全部允许
+func (a *IPAllowlist) Allow(r *http.Request) bool {
+	rules := a.rules.Load()
+	if !rules.enabled {
+		return true
+	}
+	ip, ok := rules.clientIP(r)
+	return ok && containsAddr(rules.allowed, ip)
+}
+
+// Handler 返回gin中间件，不在白名单中的请求返回403
+func (a *IPAllowlist) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.Allow(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrIPNotAllowed.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// clientIP 直连地址属于可信代理时，从X-Forwarded-For由右向左取第一个不属于可信代理的地址
+func (r *allowlistRules) clientIP(req *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	ip = ip.Unmap()
+	if !containsAddr(r.proxies, ip) {
+		return ip, true
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		entry := strings.TrimSpace(forwarded[i])
+		if entry == "" {
+			continue
+		}
+		hop, err := netip.ParseAddr(entry)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		ip = hop.Unmap()
+		if !containsAddr(r.proxies, ip) {
+			return ip, true
+		}
+	}
+	// 所有地址都属于可信代理时使用最左边的地址
+	return ip, true
+}
+
+// parsePrefixes 解析已校验的网段，单个IP转换为只包含该IP的网段
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr := netip.MustParseAddr(cidr).Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes
+}
+
+// containsAddr 地址是否属于任一网段
+func containsAddr(prefixes []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
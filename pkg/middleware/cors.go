@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/config"
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization"}
+)
+
+// CORS 返回跨域访问中间件，需通过router.Use注册，才能处理没有对应路由的OPTIONS预检请求
+// 来源不在允许列表中时不返回CORS响应头，由浏览器拒绝；预检请求的来源、方法或请求头不允许时返回403
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = defaultCORSMethods
+	}
+	if len(cfg.AllowedHeaders) == 0 {
+		cfg.AllowedHeaders = defaultCORSHeaders
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = defaultCORSMaxAge
+	}
+
+	methods := make(map[string]bool, len(cfg.AllowedMethods))
+	for _, method := range cfg.AllowedMethods {
+		methods[strings.ToUpper(method)] = true
+	}
+	headers := make(map[string]bool, len(cfg.AllowedHeaders))
+	for _, header := range cfg.AllowedHeaders {
+		headers[http.CanonicalHeaderKey(header)] = true
+	}
+	allowMethods := strings.Join(cfg.AllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.AllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		// 响应随Origin变化，避免缓存把一个来源的响应返回给其他来源
+		c.Writer.Header().Add("Vary", "Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		allowed := matchOrigin(cfg.AllowedOrigins, origin)
+		if !allowed {
+			if preflight {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrCORSForbidden.Error()})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		h := c.Writer.Header()
+		if cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if containsWildcard(cfg.AllowedOrigins) && !cfg.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			if exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", exposeHeaders)
+			}
+			c.Next()
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if !methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrCORSForbidden.Error()})
+			return
+		}
+		for _, header := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			if header = strings.TrimSpace(header); header != "" && !headers[http.CanonicalHeaderKey(header)] {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrCORSForbidden.Error()})
+				return
+			}
+		}
+		h.Set("Access-Control-Allow-Methods", allowMethods)
+		h.Set("Access-Control-Allow-Headers", allowHeaders)
+		h.Set("Access-Control-Max-Age", maxAge)
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// matchOrigin 来源是否在允许列表中，*.example.com匹配example.com的任意子域名，不区分大小写
+func matchOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*", pattern == origin:
+			return true
+		case strings.Contains(pattern, "://*."):
+			// https://*.example.com匹配https://a.example.com，不匹配https://example.com
+			scheme, domain, _ := strings.Cut(pattern, "://*")
+			if rest, ok := strings.CutPrefix(origin, scheme+"://"); ok && strings.HasSuffix(rest, domain) && len(rest) > len(domain) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// containsWildcard 是否允许所有来源
+func containsWildcard(allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package middleware
+
+import "time"
+
+// processCPUTime 不支持读取进程CPU时间的平台始终返回0，CPU使用率为0，只按并发数限制
+func processCPUTime() time.Duration {
+	return 0
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package middleware
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime 返回进程累计的用户态和内核态CPU时间
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
@@ -0,0 +1,16 @@
+package middleware
+
+import "errors"
+
+var (
+	// ErrOverloaded 服务过载，请求被过载保护拒绝
+	ErrOverloaded = errors.New("服务过载，请稍后重试")
+	// ErrBodyTooLarge 请求体超过路由组的大小上限
+	ErrBodyTooLarge = errors.New("请求体过大")
+	// ErrReadTimeout 未在截止时间内读完请求体
+	ErrReadTimeout = errors.New("读取请求体超时")
+	// ErrCORSForbidden 跨域请求的来源、方法或请求头不被允许
+	ErrCORSForbidden = errors.New("跨域请求不被允许")
+	// ErrIPNotAllowed 客户端IP不在白名单中
+	ErrIPNotAllowed = errors.New("客户端IP不在白名单中")
+)
@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+const (
+	// 过载保护拒绝请求的原因
+	ShedReasonCPU          = "cpu"
+	ShedReasonConcurrency  = "concurrency"
+	ShedReasonQueueFull    = "queue_full"
+	ShedReasonQueueTimeout = "queue_timeout"
+
+	defaultCPUSampleInterval = time.Second
+	defaultRetryAfter        = time.Second
+)
+
+// CPUSampler 返回上一次调用以来的CPU使用率，取值0到1
+type CPUSampler func() float64
+
+// InFlightLimiter 限制同时处理的竞价请求数，并发已满时短暂排队，过载时返回503
+// 令牌桶限制的是请求速率，突发的慢请求仍可能堆积；按并发数限制可保护尾延迟
+type InFlightLimiter struct {
+	cfg     config.ConcurrencyConfig
+	slots   chan struct{} // 为nil时不限制并发
+	queued  atomic.Int64
+	cpu     atomic.Uint64 // 最近一次采样的CPU使用率，float64的位表示
+	sampler CPUSampler
+	metrics *metrics.Metrics
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewInFlightLimiter 创建并发限制器，MaxInFlight为0时只按CPU使用率拒绝请求
+func NewInFlightLimiter(cfg config.ConcurrencyConfig, m *metrics.Metrics) *InFlightLimiter {
+	if cfg.CPUSampleInterval <= 0 {
+		cfg.CPUSampleInterval = defaultCPUSampleInterval
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = defaultRetryAfter
+	}
+	l := &InFlightLimiter{
+		cfg:     cfg,
+		sampler: newProcessCPUSampler(),
+		metrics: m,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg.MaxInFlight > 0 {
+		l.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return l
+}
+
+// SetCPUSampler 设置CPU使用率的采样方式，默认按进程的CPU时间计算，需在Start之前调用
+func (l *InFlightLimiter) SetCPUSampler(sampler CPUSampler) {
+	l.sampler = sampler
+}
+
+// Start 启动CPU使用率采样，未设置CPU阈值时不采样
+func (l *InFlightLimiter) Start() {
+	if l.cfg.CPUThreshold <= 0 {
+		close(l.done)
+		return
+	}
+	go l.sampleLoop()
+}
+
+// Stop 停止CPU采样
+func (l *InFlightLimiter) Stop() {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+}
+
+// sampleLoop 定期采样CPU使用率
+func (l *InFlightLimiter) sampleLoop() {
+	defer close(l.done)
+	ticker := time.NewTicker(l.cfg.CPUSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.cpu.Store(math.Float64bits(l.sampler()))
+		}
+	}
+}
+
+// CPUUsage 返回最近一次采样的CPU使用率
+func (l *InFlightLimiter) CPUUsage() float64 {
+	return math.Float64frombits(l.cpu.Load())
+}
+
+// Handler 返回限制并发的中间件，被拒绝的请求返回503和Retry-After响应头
+func (l *InFlightLimiter) Handler() gin.HandlerFunc {
+	retryAfter := strconv.Itoa(int(math.Ceil(l.cfg.RetryAfter.Seconds())))
+	return func(c *gin.Context) {
+		release, reason := l.acquire(c.Request.Context())
+		if release == nil {
+			if l.metrics != nil {
+				l.metrics.HTTP.Shed.WithLabelValues(reason).Inc()
+			}
+			c.Header("Retry-After", retryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": ErrOverloaded.Error()})
+			return
+		}
+		defer release()
+		c.Next()
+	}
+}
+
+// acquire 占用一个并发槽位，成功时返回释放函数，被拒绝时返回nil和原因
+func (l *InFlightLimiter) acquire(ctx context.Context) (func(), string) {
+	overloaded := false
+	if threshold := l.cfg.CPUThreshold; threshold > 0 {
+		// 超出阈值的部分越多拒绝的比例越高，避免CPU在阈值附近时全部拒绝又全部放行
+		if usage := l.CPUUsage(); usage > threshold {
+			overloaded = true
+			if rand.Float64() < (usage-threshold)/(1-threshold) {
+				return nil, ShedReasonCPU
+			}
+		}
+	}
+	if l.slots == nil {
+		return l.admitted(), ""
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.admitted(), ""
+	default:
+	}
+	// CPU过载时排队只会增加延迟，直接拒绝
+	if l.cfg.MaxQueue <= 0 || overloaded {
+		return nil, ShedReasonConcurrency
+	}
+	if l.queued.Add(1) > int64(l.cfg.MaxQueue) {
+		l.queued.Add(-1)
+		return nil, ShedReasonQueueFull
+	}
+	l.setQueued()
+	defer func() {
+		l.queued.Add(-1)
+		l.setQueued()
+	}()
+
+	timer := time.NewTimer(l.cfg.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.admitted(), ""
+	case <-timer.C:
+		return nil, ShedReasonQueueTimeout
+	case <-ctx.Done():
+		// 请求已取消或超过截止时间，按排队超时统计
+		return nil, ShedReasonQueueTimeout
+	}
+}
+
+// admitted 记录开始处理的请求，返回只释放一次的释放函数
+func (l *InFlightLimiter) admitted() func() {
+	if l.metrics != nil {
+		l.metrics.HTTP.InFlight.Inc()
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if l.slots != nil {
+				<-l.slots
+			}
+			if l.metrics != nil {
+				l.metrics.HTTP.InFlight.Dec()
+			}
+		})
+	}
+}
+
+// setQueued 更新排队请求数指标
+func (l *InFlightLimiter) setQueued() {
+	if l.metrics != nil {
+		l.metrics.HTTP.Queued.Set(float64(l.queued.Load()))
+	}
+}
+
+// newProcessCPUSampler 按两次采样之间进程CPU时间占墙钟时间和GOMAXPROCS的比例计算使用率
+func newProcessCPUSampler() CPUSampler {
+	lastCPU, lastWall := processCPUTime(), time.Now()
+	return func() float64 {
+		cpu, wall := processCPUTime(), time.Now()
+		elapsed := wall.Sub(lastWall)
+		used := cpu - lastCPU
+		lastCPU, lastWall = cpu, wall
+		if elapsed <= 0 {
+			return 0
+		}
+		usage := float64(used) / (float64(elapsed) * float64(runtime.GOMAXPROCS(0)))
+		return math.Min(math.Max(usage, 0), 1)
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/id"
+	"simple-dsp/pkg/reqctx"
+)
+
+// maxRequestIDLength 调用方传入的请求ID的最大长度，超出或含有控制字符时生成新ID
+const maxRequestIDLength = 128
+
+// RequestContext 返回请求上下文中间件，将请求ID、交易平台和隐私同意状态写入请求的上下文
+// 请求ID取自X-Request-ID，未携带时生成新ID并在响应头中返回；交易平台优先取路径参数exchange，其次取X-Exchange-ID
+// 需通过router.Use注册，路由匹配后才能读取路径参数
+func RequestContext() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(reqctx.HeaderRequestID)
+		if !validRequestID(requestID) {
+			requestID = id.New()
+		}
+		c.Header(reqctx.HeaderRequestID, requestID)
+
+		exchange := c.Param("exchange")
+		if exchange == "" {
+			exchange = c.GetHeader(reqctx.HeaderExchange)
+		}
+
+		ctx := reqctx.WithRequestID(c.Request.Context(), requestID)
+		if exchange != "" {
+			ctx = reqctx.WithExchange(ctx, exchange)
+		}
+		ctx = reqctx.WithConsent(ctx, reqctx.ParseConsent(c.Request))
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// validRequestID 请求ID不为空、不超长且只含可见ASCII字符
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
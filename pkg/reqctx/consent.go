@@ -0,0 +1,57 @@
+package reqctx
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Consent 用户的隐私同意状态，取自IAB TCF、US Privacy和浏览器的退出信号
+type Consent struct {
+	// GDPR 请求适用GDPR
+	GDPR bool `json:"gdpr,omitempty"`
+	// TCString GDPR同意字符串
+	TCString string `json:"gdpr_consent,omitempty"`
+	// USPrivacy CCPA的us_privacy字符串，如1YNN
+	USPrivacy string `json:"us_privacy,omitempty"`
+	// OptOut 浏览器发送了GPC或DNT，或显式传入consent=0
+	OptOut bool `json:"opt_out,omitempty"`
+}
+
+// Allowed 是否可以按用户数据个性化投放
+// 以下任一情况视为不同意：
+// - 浏览器发送Sec-GPC: 1或DNT: 1，或上报gpc=1、consent=0
+// - us_privacy字符串的第3位为Y（已选择退出出售）
+// - gdpr=1但没有携带gdpr_consent
+func (c Consent) Allowed() bool {
+	if c.OptOut {
+		return false
+	}
+	if len(c.USPrivacy) >= 3 && strings.EqualFold(c.USPrivacy[2:3], "Y") {
+		return false
+	}
+	return !c.GDPR || c.TCString != ""
+}
+
+// ParseConsent 从浏览器请求的请求头和查询参数中解析同意状态
+func ParseConsent(r *http.Request) Consent {
+	q := r.URL.Query()
+	return Consent{
+		GDPR:      q.Get("gdpr") == "1",
+		TCString:  q.Get("gdpr_consent"),
+		USPrivacy: q.Get("us_privacy"),
+		OptOut: r.Header.Get("Sec-GPC") == "1" || r.Header.Get("DNT") == "1" ||
+			q.Get("gpc") == "1" || q.Get("consent") == "0",
+	}
+}
+
+// ConsentFromParams 从竞价请求的扩展参数中解析同意状态，没有任何同意参数时返回false
+// 参数名与ParseConsent的查询参数相同
+func ConsentFromParams(params map[string]string) (Consent, bool) {
+	consent := Consent{
+		GDPR:      params["gdpr"] == "1",
+		TCString:  params["gdpr_consent"],
+		USPrivacy: params["us_privacy"],
+		OptOut:    params["gpc"] == "1" || params["consent"] == "0",
+	}
+	return consent, consent != Consent{}
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: reqctx.go
+ * Project: simple-dsp
+ * Description: 请求级上下文取值，各模块通过类型化的读写函数共享请求信息
+ *
+ * 主要功能:
+ * - 请求ID、交易平台、API密钥所属方
+ * - 用户的隐私同意状态
+ * - 地理位置和设备信息
+ *
+ * 实现细节:
+ * - 每种取值使用独立的未导出键类型，不会与其他包的上下文取值冲突
+ * - 读取函数在未设置时返回零值，结构体取值额外返回是否已设置
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/geo
+ * - simple-dsp/pkg/useragent
+ *
+ * 注意事项:
+ * - 请求ID、交易平台和同意状态由middleware.RequestContext写入，处理器不再直接读取请求头
+ * - 上下文中只保存请求级的小对象，不要保存请求体等大对象
+ */
+
+package reqctx
+
+import (
+	"context"
+
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/useragent"
+)
+
+// 请求头
+const (
+	// HeaderRequestID 请求ID，未携带时生成新ID，并在响应头中返回
+	HeaderRequestID = "X-Request-ID"
+	// HeaderExchange 交易平台ID，路径中没有交易平台时使用
+	HeaderExchange = "X-Exchange-ID"
+)
+
+type (
+	requestIDKey   struct{}
+	exchangeKey    struct{}
+	apiKeyOwnerKey struct{}
+	consentKey     struct{}
+	geoKey         struct{}
+	deviceKey      struct{}
+)
+
+// WithRequestID 在上下文中记录请求ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID 返回上下文中的请求ID，未设置时返回空串
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithExchange 在上下文中记录交易平台ID
+func WithExchange(ctx context.Context, exchange string) context.Context {
+	return context.WithValue(ctx, exchangeKey{}, exchange)
+}
+
+// Exchange 返回上下文中的交易平台ID，未设置时返回空串
+func Exchange(ctx context.Context) string {
+	exchange, _ := ctx.Value(exchangeKey{}).(string)
+	return exchange
+}
+
+// WithAPIKeyOwner 在上下文中记录认证通过的API密钥所属方，如交易平台ID
+func WithAPIKeyOwner(ctx context.Context, owner string) context.Context {
+	return context.WithValue(ctx, apiKeyOwnerKey{}, owner)
+}
+
+// APIKeyOwner 返回上下文中的API密钥所属方，未认证时返回空串
+func APIKeyOwner(ctx context.Context) string {
+	owner, _ := ctx.Value(apiKeyOwnerKey{}).(string)
+	return owner
+}
+
+// WithConsent 在上下文中记录用户的隐私同意状态
+func WithConsent(ctx context.Context, consent Consent) context.Context {
+	return context.WithValue(ctx, consentKey{}, consent)
+}
+
+// ConsentFrom 返回上下文中的隐私同意状态
+func ConsentFrom(ctx context.Context) (Consent, bool) {
+	consent, ok := ctx.Value(consentKey{}).(Consent)
+	return consent, ok
+}
+
+// WithGeo 在上下文中记录用户的地理位置
+func WithGeo(ctx context.Context, location geo.Location) context.Context {
+	return context.WithValue(ctx, geoKey{}, location)
+}
+
+// Geo 返回上下文中的地理位置
+func Geo(ctx context.Context) (geo.Location, bool) {
+	location, ok := ctx.Value(geoKey{}).(geo.Location)
+	return location, ok
+}
+
+// WithDevice 在上下文中记录用户的设备信息
+func WithDevice(ctx context.Context, device useragent.Device) context.Context {
+	return context.WithValue(ctx, deviceKey{}, device)
+}
+
+// Device 返回上下文中的设备信息
+func Device(ctx context.Context) (useragent.Device, bool) {
+	device, ok := ctx.Value(deviceKey{}).(useragent.Device)
+	return device, ok
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: retry.go
+ * Project: simple-dsp
+ * Description: 统一的重试工具，按指数退避和随机抖动重试失败的调用
+ *
+ * 主要功能:
+ * - 按最大重试次数和总耗时预算重试调用
+ * - 指数退避，等待时间有上限，可加随机抖动
+ * - 上下文取消或截止时间不足以再等待一次时立即返回
+ * - 通过Permanent标记不可重试的错误
+ *
+ * 实现细节:
+ * - 第n次重试前等待InitialBackoff*Multiplier^(n-1)，不超过MaxBackoff
+ * - 抖动只缩短等待时间，实际等待在[d*(1-Jitter), d]内均匀分布，避免多个实例同时重试
+ * - 每次调用都传入调用方的上下文，单次调用的超时由调用方在fn中设置
+ *
+ * 依赖关系:
+ * - 仅依赖标准库
+ *
+ * 注意事项:
+ * - fn可能被执行多次，必须可以安全地重复执行
+ * - 超出次数或预算时返回最后一次调用的错误，被取消时返回上下文的错误
+ * - InitialBackoff为0时立即重试
+ */
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// defaultMultiplier 未设置Multiplier时每次重试等待时间的增长倍数
+const defaultMultiplier = 2
+
+// Policy 重试策略，零值只执行一次不重试
+type Policy struct {
+	// MaxRetries 首次调用失败后的最大重试次数
+	MaxRetries int
+	// InitialBackoff 第一次重试前的等待时间，为0时立即重试
+	InitialBackoff time.Duration
+	// MaxBackoff 单次等待时间的上限，为0时不限制
+	MaxBackoff time.Duration
+	// Multiplier 每次重试等待时间的增长倍数，小于1时使用2
+	Multiplier float64
+	// Jitter 随机抖动比例，取值[0, 1]，实际等待时间在[d*(1-Jitter), d]内
+	Jitter float64
+	// MaxElapsed 从首次调用开始的总耗时预算，再等待一次会超出预算时不再重试，为0时不限制
+	MaxElapsed time.Duration
+	// OnRetry 每次重试等待前调用，retry从1开始，err为上一次调用的错误
+	OnRetry func(retry int, err error, wait time.Duration)
+}
+
+// Backoff 返回第retry次重试前的等待时间，retry从1开始，包含随机抖动
+func (p Policy) Backoff(retry int) time.Duration {
+	if retry < 1 || p.InitialBackoff <= 0 {
+		return 0
+	}
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = defaultMultiplier
+	}
+
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > float64(p.MaxBackoff) {
+		delay = float64(p.MaxBackoff)
+	}
+
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 {
+		delay -= delay * jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// Do 执行fn，失败时按策略重试
+// fn返回Permanent包装的错误时不再重试并返回原始错误；ctx被取消时返回ctx.Err()
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// DoValue 与Do相同，返回fn最后一次调用的结果
+func DoValue[T any](ctx context.Context, p Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	start := time.Now()
+	for retry := 0; ; retry++ {
+		if err := ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+
+		value, err := fn(ctx)
+		if err == nil {
+			return value, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return value, permanent.err
+		}
+		if retry >= p.MaxRetries {
+			return value, err
+		}
+
+		wait := p.Backoff(retry + 1)
+		if !p.canWait(ctx, start, wait) {
+			return value, err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(retry+1, err, wait)
+		}
+		if err := sleep(ctx, wait); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+// canWait 等待wait后是否仍在总耗时预算和上下文的截止时间内
+func (p Policy) canWait(ctx context.Context, start time.Time, wait time.Duration) bool {
+	if p.MaxElapsed > 0 && time.Since(start)+wait > p.MaxElapsed {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+		return false
+	}
+	return true
+}
+
+// sleep 等待d，ctx被取消时提前返回ctx.Err()
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// permanentError 不可重试的错误
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 将err标记为不可重试，Do遇到后立即返回err；err为nil时返回nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
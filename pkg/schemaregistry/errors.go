@@ -0,0 +1,57 @@
+package schemaregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	// ErrURLRequired 表示未配置Schema Registry地址
+	ErrURLRequired = errors.New("Schema Registry地址不能为空")
+
+	// ErrInvalidFrame 表示消息不是Schema Registry线格式
+	ErrInvalidFrame = errors.New("无效的Schema Registry消息头")
+)
+
+// Schema Registry的错误码
+const (
+	errorCodeSubjectNotFound = 40401
+	errorCodeVersionNotFound = 40402
+	errorCodeSchemaNotFound  = 40403
+)
+
+// APIError Schema Registry返回的错误，错误体格式为{"error_code": 40401, "message": "..."}
+type APIError struct {
+	StatusCode int
+	Code       int    `json:"error_code"`
+	Message    string `json:"message"`
+}
+
+// Error 实现error接口
+func (e *APIError) Error() string {
+	return fmt.Sprintf("Schema Registry错误(%d/%d): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsNotFound 是否为主题、版本或Schema不存在
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case errorCodeSubjectNotFound, errorCodeVersionNotFound, errorCodeSchemaNotFound:
+		return true
+	}
+	return apiErr.StatusCode == http.StatusNotFound
+}
+
+// newAPIError 根据响应构造错误，错误体无法解析时使用原始内容
+func newAPIError(statusCode int, data []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+	if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = string(data)
+	}
+	return apiErr
+}
@@ -0,0 +1,193 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: registry.go
+ * Project: simple-dsp
+ * Description: Schema Registry客户端，管理Kafka消息的版本化Schema
+ *
+ * 主要功能:
+ * - 注册Schema并获取全局唯一的Schema ID
+ * - 按主题的兼容性级别检查新Schema是否与已注册的版本兼容
+ * - 设置主题的兼容性级别
+ * - 按Schema ID读取Schema，供消费方识别消息的版本
+ *
+ * 实现细节:
+ * - 接口与Confluent Schema Registry兼容，使用application/vnd.schemaregistry.v1+json
+ * - 消息按Confluent线格式封装：魔数0、4字节大端Schema ID，Protobuf消息再加消息索引
+ * - 按ID读取的Schema不可变，缓存在本地
+ *
+ * 依赖关系:
+ * - net/http
+ * - simple-dsp/pkg/config
+ *
+ * 注意事项:
+ * - 主题不存在时兼容性检查视为兼容，首次注册即为第一个版本
+ * - 重复注册相同的Schema返回已有的ID，不产生新版本
+ * - Client可并发使用
+ */
+
+package schemaregistry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+	contentType    = "application/vnd.schemaregistry.v1+json"
+
+	// SchemaTypeProtobuf Protobuf格式的Schema
+	SchemaTypeProtobuf = "PROTOBUF"
+)
+
+// Schema 一个版本的Schema
+type Schema struct {
+	Schema     string `json:"schema"`
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+// Client Schema Registry客户端
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	schemas map[int]Schema
+}
+
+// NewClient 创建Schema Registry客户端
+func NewClient(cfg config.SchemaRegistryConfig) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, ErrURLRequired
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.URL, "/"),
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		schemas:    make(map[int]Schema),
+	}, nil
+}
+
+// Subject 主题的值对应的Schema Registry主题，与Confluent的TopicNameStrategy一致
+func Subject(topic string) string {
+	return topic + "-value"
+}
+
+// Register 在主题下注册Schema，返回Schema ID
+func (c *Client) Register(ctx context.Context, subject string, schema Schema) (int, error) {
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/subjects/"+url.PathEscape(subject)+"/versions", schema, &resp); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.schemas[resp.ID] = schema
+	c.mu.Unlock()
+	return resp.ID, nil
+}
+
+// CheckCompatibility 检查Schema与主题最新版本的兼容性，不兼容时返回Schema Registry给出的原因
+// 主题还没有注册任何版本时视为兼容
+func (c *Client) CheckCompatibility(ctx context.Context, subject string, schema Schema) (bool, []string, error) {
+	var resp struct {
+		IsCompatible bool     `json:"is_compatible"`
+		Messages     []string `json:"messages"`
+	}
+	path := "/compatibility/subjects/" + url.PathEscape(subject) + "/versions/latest?verbose=true"
+	if err := c.do(ctx, http.MethodPost, path, schema, &resp); err != nil {
+		if IsNotFound(err) {
+			return true, nil, nil
+		}
+		return false, nil, err
+	}
+	return resp.IsCompatible, resp.Messages, nil
+}
+
+// SetCompatibility 设置主题的兼容性级别，如BACKWARD、FULL
+func (c *Client) SetCompatibility(ctx context.Context, subject, level string) error {
+	body := map[string]string{"compatibility": level}
+	return c.do(ctx, http.MethodPut, "/config/"+url.PathEscape(subject), body, nil)
+}
+
+// SchemaByID 按ID读取Schema，读取过的Schema缓存在本地
+func (c *Client) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	c.mu.RLock()
+	schema, ok := c.schemas[id]
+	c.mu.RUnlock()
+	if ok {
+		return schema, nil
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &schema); err != nil {
+		return Schema{}, err
+	}
+	c.mu.Lock()
+	c.schemas[id] = schema
+	c.mu.Unlock()
+	return schema, nil
+}
+
+// do 发送请求并解码响应，非2xx时返回*APIError
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("编码请求失败: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", contentType)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求Schema Registry失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取Schema Registry响应失败: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return newAPIError(resp.StatusCode, data)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解析Schema Registry响应失败: %w", err)
+	}
+	return nil
+}
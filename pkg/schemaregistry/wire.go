@@ -0,0 +1,51 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// magicByte 线格式的第一个字节
+const magicByte = 0
+
+// AppendProtobufHeader 追加Protobuf消息的线格式头：魔数0、4字节大端Schema ID、消息索引
+// 消息为.proto文件中的第一个消息，索引按约定简写为一个0字节
+func AppendProtobufHeader(dst []byte, id int) []byte {
+	dst = append(dst, magicByte)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(id))
+	return append(dst, 0)
+}
+
+// IsFramed 判断消息是否以线格式的魔数开头，JSON消息以'{'开头
+func IsFramed(data []byte) bool {
+	return len(data) > 0 && data[0] == magicByte
+}
+
+// ParseProtobufHeader 解析Protobuf消息的线格式头，返回Schema ID、消息索引和消息体
+func ParseProtobufHeader(data []byte) (int, []int, []byte, error) {
+	if len(data) < 5 || data[0] != magicByte {
+		return 0, nil, nil, ErrInvalidFrame
+	}
+	id := int(binary.BigEndian.Uint32(data[1:5]))
+	rest := data[5:]
+
+	// 消息索引为zigzag变长整数编码的数组，先是个数；个数为0表示[0]
+	count, n := binary.Varint(rest)
+	if n <= 0 || count < 0 || count > int64(len(rest)) {
+		return 0, nil, nil, fmt.Errorf("%w: 消息索引", ErrInvalidFrame)
+	}
+	rest = rest[n:]
+	if count == 0 {
+		return id, []int{0}, rest, nil
+	}
+	indexes := make([]int, 0, count)
+	for i := int64(0); i < count; i++ {
+		index, n := binary.Varint(rest)
+		if n <= 0 {
+			return 0, nil, nil, fmt.Errorf("%w: 消息索引", ErrInvalidFrame)
+		}
+		indexes = append(indexes, int(index))
+		rest = rest[n:]
+	}
+	return id, indexes, rest, nil
+}
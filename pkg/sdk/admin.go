@@ -0,0 +1,209 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateAd 创建广告
+func (c *Client) CreateAd(ctx context.Context, ad *Ad) (*Ad, error) {
+	var out Ad
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		url:    c.adminURL + "/api/v1/ads",
+		body:   ad,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateAd 更新广告
+func (c *Client) UpdateAd(ctx context.Context, id string, ad *Ad) (*Ad, error) {
+	if id == "" {
+		return nil, ErrMissingID
+	}
+	var out Ad
+	if err := c.do(ctx, request{
+		method:     http.MethodPut,
+		url:        c.adminURL + "/api/v1/ads/" + url.PathEscape(id),
+		body:       ad,
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetAd 获取广告信息
+func (c *Client) GetAd(ctx context.Context, id string) (*Ad, error) {
+	if id == "" {
+		return nil, ErrMissingID
+	}
+	var out Ad
+	if err := c.do(ctx, request{
+		method:     http.MethodGet,
+		url:        c.adminURL + "/api/v1/ads/" + url.PathEscape(id),
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// DeleteAd 删除广告
+func (c *Client) DeleteAd(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrMissingID
+	}
+	return c.do(ctx, request{
+		method:     http.MethodDelete,
+		url:        c.adminURL + "/api/v1/ads/" + url.PathEscape(id),
+		idempotent: true,
+	}, nil)
+}
+
+// ListAds 分页获取广告列表，opts为nil时返回第一页
+func (c *Client) ListAds(ctx context.Context, opts *ListOptions) (*Page[Ad], error) {
+	var out Page[Ad]
+	if err := c.do(ctx, request{
+		method:     http.MethodGet,
+		url:        c.adminURL + "/api/v1/ads" + opts.encode(),
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreateBudget 创建预算
+func (c *Client) CreateBudget(ctx context.Context, budget *Budget) (*Budget, error) {
+	var out Budget
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		url:    c.adminURL + "/api/v1/budgets",
+		body:   budget,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateBudget 更新预算
+func (c *Client) UpdateBudget(ctx context.Context, id string, budget *Budget) (*Budget, error) {
+	if id == "" {
+		return nil, ErrMissingID
+	}
+	var out Budget
+	if err := c.do(ctx, request{
+		method:     http.MethodPut,
+		url:        c.adminURL + "/api/v1/budgets/" + url.PathEscape(id),
+		body:       budget,
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetBudget 获取预算信息
+func (c *Client) GetBudget(ctx context.Context, id string) (*Budget, error) {
+	if id == "" {
+		return nil, ErrMissingID
+	}
+	var out Budget
+	if err := c.do(ctx, request{
+		method:     http.MethodGet,
+		url:        c.adminURL + "/api/v1/budgets/" + url.PathEscape(id),
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ListBudgets 分页获取预算列表，opts为nil时返回第一页
+func (c *Client) ListBudgets(ctx context.Context, opts *ListOptions) (*Page[Budget], error) {
+	var out Page[Budget]
+	if err := c.do(ctx, request{
+		method:     http.MethodGet,
+		url:        c.adminURL + "/api/v1/budgets" + opts.encode(),
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RenewBudget 续费预算
+func (c *Client) RenewBudget(ctx context.Context, id string) (*Budget, error) {
+	if id == "" {
+		return nil, ErrMissingID
+	}
+	var out Budget
+	if err := c.do(ctx, request{
+		method: http.MethodPost,
+		url:    c.adminURL + "/api/v1/budgets/" + url.PathEscape(id) + "/renew",
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// UpdateFrequencyConfig 更新广告的频次控制配置
+func (c *Client) UpdateFrequencyConfig(ctx context.Context, adID string, config *FrequencyConfig) error {
+	if adID == "" {
+		return ErrMissingID
+	}
+	return c.do(ctx, request{
+		method:     http.MethodPut,
+		url:        c.adminURL + "/api/v1/ads/" + url.PathEscape(adID) + "/frequency",
+		body:       config,
+		idempotent: true,
+	}, nil)
+}
+
+// GetFrequencyConfig 获取广告的频次控制配置
+func (c *Client) GetFrequencyConfig(ctx context.Context, adID string) (*FrequencyConfig, error) {
+	if adID == "" {
+		return nil, ErrMissingID
+	}
+	var out FrequencyConfig
+	if err := c.do(ctx, request{
+		method:     http.MethodGet,
+		url:        c.adminURL + "/api/v1/ads/" + url.PathEscape(adID) + "/frequency",
+		idempotent: true,
+	}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// encode 将列表查询参数编码为URL查询串
+func (o *ListOptions) encode() string {
+	if o == nil {
+		return ""
+	}
+	values := url.Values{}
+	if o.Page > 0 {
+		values.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		values.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	if o.Cursor != "" {
+		values.Set("cursor", o.Cursor)
+	}
+	if o.Sort != "" {
+		values.Set("sort", o.Sort)
+	}
+	for field, value := range o.Filters {
+		values.Set("filter["+field+"]", value)
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return "?" + values.Encode()
+}
@@ -0,0 +1,28 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+)
+
+// SubmitBid 提交竞价请求
+// 请求以request_id去重，网络错误或服务端5xx时会重试
+func (c *Client) SubmitBid(ctx context.Context, req *BidRequest) (*BidResponse, error) {
+	header := http.Header{}
+	if req.RequestID != "" {
+		header.Set("X-Request-ID", req.RequestID)
+	}
+
+	var resp BidResponse
+	err := c.do(ctx, request{
+		method:     http.MethodPost,
+		url:        c.baseURL + "/api/v1/traffic",
+		body:       req,
+		header:     header,
+		idempotent: req.RequestID != "",
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
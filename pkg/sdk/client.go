@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: client.go
+ * Project: simple-dsp
+ * Description: DSP接口的Go客户端SDK
+ *
+ * 主要功能:
+ * - 竞价请求提交
+ * - 展示/点击/转化事件回传
+ * - 管理后台广告、预算、频控配置的增删改查
+ *
+ * 实现细节:
+ * - 基于net/http，无额外依赖，可供合作方直接引用
+ * - 支持Bearer Token认证
+ * - 幂等请求在网络错误、429和5xx时按指数退避重试，支持Retry-After
+ * - 模型与服务端JSON字段保持一致
+ *
+ * 依赖关系:
+ * - net/http
+ * - encoding/json
+ *
+ * 注意事项:
+ * - 事件回传为非幂等请求，默认不重试，避免重复计数
+ * - Client可并发使用
+ */
+
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultMaxRetries   = 2
+	defaultRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff     = 5 * time.Second
+	userAgent           = "simple-dsp-go-sdk/1.0"
+)
+
+// Config 客户端配置
+type Config struct {
+	// BaseURL DSP服务地址，如 http://dsp.example.com
+	BaseURL string
+	// AdminURL 管理后台地址，为空时使用BaseURL
+	AdminURL string
+	// Token 认证令牌，以Bearer方式发送
+	Token string
+	// Timeout 单次请求超时，默认5秒
+	Timeout time.Duration
+	// MaxRetries 幂等请求的最大重试次数，默认2次，小于0表示不重试
+	MaxRetries int
+	// RetryBackoff 首次重试的等待时间，之后按指数增长
+	RetryBackoff time.Duration
+	// HTTPClient 自定义HTTP客户端
+	HTTPClient *http.Client
+}
+
+// Client DSP客户端
+type Client struct {
+	baseURL      string
+	adminURL     string
+	token        string
+	maxRetries   int
+	retryBackoff time.Duration
+	httpClient   *http.Client
+}
+
+// NewClient 创建客户端
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.BaseURL == "" {
+		return nil, ErrMissingBaseURL
+	}
+	if cfg.AdminURL == "" {
+		cfg.AdminURL = cfg.BaseURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = defaultMaxRetries
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = defaultRetryBackoff
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	return &Client{
+		baseURL:      strings.TrimRight(cfg.BaseURL, "/"),
+		adminURL:     strings.TrimRight(cfg.AdminURL, "/"),
+		token:        cfg.Token,
+		maxRetries:   cfg.MaxRetries,
+		retryBackoff: cfg.RetryBackoff,
+		httpClient:   httpClient,
+	}, nil
+}
+
+// request 单次调用参数
+type request struct {
+	method     string
+	url        string
+	body       interface{}
+	header     http.Header
+	idempotent bool
+}
+
+// do 发送请求并解码响应，幂等请求失败时重试
+func (c *Client) do(ctx context.Context, r request, out interface{}) error {
+	var payload []byte
+	if r.body != nil {
+		data, err := json.Marshal(r.body)
+		if err != nil {
+			return fmt.Errorf("编码请求失败: %w", err)
+		}
+		payload = data
+	}
+
+	attempts := 1
+	if r.idempotent {
+		attempts += c.maxRetries
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt, lastErr)); err != nil {
+				return err
+			}
+		}
+
+		lastErr = c.send(ctx, r, payload, out)
+		if lastErr == nil || !retryable(lastErr) {
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+// send 发送一次请求
+func (c *Client) send(ctx context.Context, r request, payload []byte, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, r.method, r.url, body)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	for k, v := range r.header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return &transportError{err: err}
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &transportError{err: err}
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return newAPIError(resp, data)
+	}
+
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("解码响应失败: %w", err)
+	}
+	return nil
+}
+
+// backoff 计算第attempt次重试前的等待时间
+func (c *Client) backoff(attempt int, lastErr error) time.Duration {
+	var apiErr *APIError
+	if errors.As(lastErr, &apiErr) && apiErr.RetryAfter > 0 {
+		return apiErr.RetryAfter
+	}
+
+	d := c.retryBackoff << (attempt - 1)
+	if d <= 0 || d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	// 加入抖动，避免多个客户端同时重试
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// sleep 等待指定时间，上下文取消时提前返回
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryable 判断错误是否可重试
+func retryable(err error) bool {
+	var tErr *transportError
+	if errors.As(err, &tErr) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
+
+// parseRetryAfter 解析Retry-After头（秒数）
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	d := time.Duration(seconds) * time.Second
+	if d > maxRetryBackoff {
+		d = maxRetryBackoff
+	}
+	return d
+}
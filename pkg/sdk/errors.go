@@ -0,0 +1,71 @@
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+var (
+	// ErrMissingBaseURL 表示未配置服务地址
+	ErrMissingBaseURL = errors.New("服务地址不能为空")
+
+	// ErrMissingID 表示缺少资源ID
+	ErrMissingID = errors.New("资源ID不能为空")
+)
+
+// APIError 服务端返回的错误
+type APIError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration
+}
+
+// Error 实现error接口
+func (e *APIError) Error() string {
+	return fmt.Sprintf("DSP接口错误(%d): %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound 是否为资源不存在错误
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// newAPIError 根据响应构造错误，服务端错误体格式为 {"error": "..."}
+func newAPIError(resp *http.Response, data []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    http.StatusText(resp.StatusCode),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var body struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &body); err == nil {
+		switch {
+		case body.Error != "":
+			apiErr.Message = body.Error
+		case body.Message != "":
+			apiErr.Message = body.Message
+		}
+	}
+	return apiErr
+}
+
+// transportError 网络层错误，可重试
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return "请求发送失败: " + e.err.Error()
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,30 @@
+package sdk
+
+import (
+	"context"
+	"net/http"
+)
+
+// PostImpression 回传展示事件
+func (c *Client) PostImpression(ctx context.Context, event *Event) error {
+	return c.postEvent(ctx, EventImpression, event)
+}
+
+// PostClick 回传点击事件
+func (c *Client) PostClick(ctx context.Context, event *Event) error {
+	return c.postEvent(ctx, EventClick, event)
+}
+
+// PostConversion 回传转化事件
+func (c *Client) PostConversion(ctx context.Context, event *Event) error {
+	return c.postEvent(ctx, EventConversion, event)
+}
+
+// postEvent 回传事件，事件为非幂等请求，不做重试
+func (c *Client) postEvent(ctx context.Context, eventType EventType, event *Event) error {
+	return c.do(ctx, request{
+		method: http.MethodPost,
+		url:    c.baseURL + "/api/v1/events/" + string(eventType),
+		body:   event,
+	}, nil)
+}
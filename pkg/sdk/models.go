@@ -0,0 +1,133 @@
+package sdk
+
+import (
+	"time"
+)
+
+// BidRequest 竞价请求
+type BidRequest struct {
+	RequestID   string            `json:"request_id,omitempty"`
+	UserID      string            `json:"user_id"`
+	DeviceID    string            `json:"device_id"`
+	IP          string            `json:"ip"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	AdSlots     []AdSlot          `json:"ad_slots"`
+	Timestamp   int64             `json:"timestamp,omitempty"`
+	TMax        int64             `json:"tmax,omitempty"` // 最大响应时间(毫秒)
+	ExtraParams map[string]string `json:"extra_params,omitempty"`
+}
+
+// AdSlot 广告位信息
+type AdSlot struct {
+	SlotID   string  `json:"slot_id"`
+	Width    int     `json:"width"`
+	Height   int     `json:"height"`
+	MinPrice float64 `json:"min_price"`
+	MaxPrice float64 `json:"max_price"`
+	// Currency MinPrice和MaxPrice的货币，ISO 4217代码，为空时为DSP的系统货币
+	Currency string `json:"currency,omitempty"`
+	Position string `json:"position"`
+	AdType   string `json:"ad_type"`
+}
+
+// BidResponse 竞价响应
+type BidResponse struct {
+	RequestID string     `json:"request_id"`
+	Code      int        `json:"code"`
+	Message   string     `json:"message"`
+	Data      []AdResult `json:"data"`
+}
+
+// NoBid 是否未出价
+func (r *BidResponse) NoBid() bool {
+	return len(r.Data) == 0
+}
+
+// AdResult 广告结果
+type AdResult struct {
+	SlotID    string  `json:"slot_id"`
+	AdID      string  `json:"ad_id"`
+	BidPrice  float64 `json:"bid_price"`
+	AdMarkup  string  `json:"ad_markup"`
+	WinNotice string  `json:"win_notice"`
+}
+
+// EventType 事件类型
+type EventType string
+
+const (
+	// EventImpression 展示事件
+	EventImpression EventType = "impression"
+	// EventClick 点击事件
+	EventClick EventType = "click"
+	// EventConversion 转化事件
+	EventConversion EventType = "conversion"
+)
+
+// Event 事件回传
+type Event struct {
+	RequestID   string            `json:"request_id"`
+	UserID      string            `json:"user_id"`
+	AdID        string            `json:"ad_id"`
+	SlotID      string            `json:"slot_id"`
+	BidPrice    float64           `json:"bid_price,omitempty"`
+	WinPrice    float64           `json:"win_price,omitempty"`
+	IP          string            `json:"ip,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	ExtraParams map[string]string `json:"extra_params,omitempty"`
+}
+
+// Ad 广告信息
+type Ad struct {
+	ID          string    `json:"id,omitempty"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	ImageURL    string    `json:"image_url"`
+	LandingURL  string    `json:"landing_url"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	BudgetID    string    `json:"budget_id"`
+	Status      string    `json:"status,omitempty"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+// Budget 预算信息
+type Budget struct {
+	ID          string    `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Amount      float64   `json:"amount"`
+	UsedAmount  float64   `json:"used_amount"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Status      string    `json:"status,omitempty"`
+	AutoRenewal bool      `json:"auto_renewal"`
+	CreateTime  time.Time `json:"create_time"`
+	UpdateTime  time.Time `json:"update_time"`
+}
+
+// FrequencyConfig 频次控制配置
+type FrequencyConfig struct {
+	ImpressionLimit int           `json:"impression_limit"`
+	ClickLimit      int           `json:"click_limit"`
+	TimeWindow      time.Duration `json:"time_window"`
+	QPS             float64       `json:"qps"`
+}
+
+// ListOptions 列表查询参数，零值表示使用服务端默认值
+type ListOptions struct {
+	Page     int               // 页码，从1开始
+	PageSize int               // 每页条数
+	Cursor   string            // 上一页返回的游标，优先于Page
+	Sort     string            // 排序字段，"-"前缀表示降序
+	Filters  map[string]string // 按字段等值过滤
+}
+
+// Page 分页结果
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page,omitempty"`
+	PageSize   int    `json:"page_size"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
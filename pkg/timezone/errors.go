@@ -0,0 +1,8 @@
+package timezone
+
+import "errors"
+
+var (
+	// ErrInvalidTimezone 表示时区名称无效
+	ErrInvalidTimezone = errors.New("无效的时区")
+)
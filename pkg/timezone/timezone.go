@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: timezone.go
+ * Project: simple-dsp
+ * Description: 广告主和推广计划的时区，按时区计算自然日和小时
+ *
+ * 主要功能:
+ * - 按配置解析默认、广告主和推广计划的时区
+ * - 按广告（出价策略）所属的推广计划查找时区
+ * - 按时区计算日期
+ *
+ * 实现细节:
+ * - 推广计划的时区优先于广告主的时区，都未设置时使用默认时区
+ * - 广告与推广计划的对应关系由出价策略缓存在每次刷新后同步，只增加和更新，不删除
+ * - 为nil的Zones所有查询都返回服务器时区
+ *
+ * 依赖关系:
+ * - simple-dsp/pkg/config
+ *
+ * 注意事项:
+ * - 时区变更后，日预算和按天的计数从新时区的当前自然日开始计算
+ * - 日期格式为2006-01-02，按天的Redis键使用20060102
+ */
+
+package timezone
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"simple-dsp/pkg/config"
+)
+
+// DateLayout 按天统计的日期格式
+const DateLayout = "2006-01-02"
+
+// Zones 广告主和推广计划的时区
+type Zones struct {
+	def         *time.Location
+	advertisers map[string]*time.Location // 广告主ID -> 时区
+	campaigns   map[string]*time.Location // 推广计划ID -> 时区，包含广告主下的推广计划
+
+	mu  sync.RWMutex
+	ads map[string]string // 广告ID -> 推广计划ID
+}
+
+// New 按配置创建时区，时区名称无效时返回ErrInvalidTimezone
+func New(cfg config.TimezoneConfig) (*Zones, error) {
+	z := &Zones{
+		def:         time.Local,
+		advertisers: make(map[string]*time.Location, len(cfg.Advertisers)),
+		campaigns:   make(map[string]*time.Location, len(cfg.Campaigns)),
+		ads:         make(map[string]string),
+	}
+	if cfg.Default != "" {
+		loc, err := load(cfg.Default)
+		if err != nil {
+			return nil, err
+		}
+		z.def = loc
+	}
+	for _, a := range cfg.Advertisers {
+		loc, err := load(a.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		z.advertisers[a.AdvertiserID] = loc
+		for _, campaignID := range a.Campaigns {
+			z.campaigns[campaignID] = loc
+		}
+	}
+	// 单独设置的推广计划时区覆盖广告主的时区
+	for _, c := range cfg.Campaigns {
+		loc, err := load(c.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		z.campaigns[c.CampaignID] = loc
+	}
+	return z, nil
+}
+
+// load 加载IANA时区，名称为空时返回错误而不是UTC
+func load(name string) (*time.Location, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: 时区不能为空", ErrInvalidTimezone)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTimezone, name)
+	}
+	return loc, nil
+}
+
+// Default 返回默认时区
+func (z *Zones) Default() *time.Location {
+	if z == nil {
+		return time.Local
+	}
+	return z.def
+}
+
+// Advertiser 返回广告主的时区，未设置时返回默认时区
+func (z *Zones) Advertiser(advertiserID string) *time.Location {
+	if z == nil {
+		return time.Local
+	}
+	if loc, ok := z.advertisers[advertiserID]; ok {
+		return loc
+	}
+	return z.def
+}
+
+// Campaign 返回推广计划的时区，依次使用推广计划、所属广告主和默认的时区
+func (z *Zones) Campaign(campaignID string) *time.Location {
+	if z == nil {
+		return time.Local
+	}
+	if loc, ok := z.campaigns[campaignID]; ok {
+		return loc
+	}
+	return z.def
+}
+
+// Ad 返回广告（出价策略）所属推广计划的时区，不知道所属推广计划时返回默认时区
+func (z *Zones) Ad(adID string) *time.Location {
+	if z == nil {
+		return time.Local
+	}
+	z.mu.RLock()
+	campaignID, ok := z.ads[adID]
+	z.mu.RUnlock()
+	if !ok {
+		return z.def
+	}
+	return z.Campaign(campaignID)
+}
+
+// SetAdCampaigns 更新广告所属的推广计划，ads为广告ID到推广计划ID的映射
+// 不在ads中的广告保留原来的推广计划，已暂停策略的延迟事件仍按原时区统计
+func (z *Zones) SetAdCampaigns(ads map[string]string) {
+	if z == nil {
+		return
+	}
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	for adID, campaignID := range ads {
+		z.ads[adID] = campaignID
+	}
+}
+
+// Date 返回t在loc中的日期，格式为DateLayout
+func Date(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format(DateLayout)
+}
@@ -0,0 +1,10 @@
+package topics
+
+import "errors"
+
+var (
+	// ErrBrokersRequired 未配置Kafka地址
+	ErrBrokersRequired = errors.New("未配置Kafka地址")
+	// ErrTopicState 读取主题的分区数或配置失败
+	ErrTopicState = errors.New("读取Kafka主题状态失败")
+)
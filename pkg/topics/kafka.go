@@ -0,0 +1,137 @@
+package topics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// retentionConfig 主题保留时间的配置项
+const retentionConfig = "retention.ms"
+
+// KafkaCluster 基于kafka-go管理接口的Cluster实现
+type KafkaCluster struct {
+	client *kafka.Client
+}
+
+// NewKafkaCluster 创建Kafka管理接口，请求发送到brokers中的第一个可用节点
+func NewKafkaCluster(brokers []string) (*KafkaCluster, error) {
+	if len(brokers) == 0 {
+		return nil, ErrBrokersRequired
+	}
+	return &KafkaCluster{client: &kafka.Client{Addr: kafka.TCP(brokers...)}}, nil
+}
+
+// Describe 通过元数据读取分区数，通过DescribeConfigs读取retention.ms
+func (k *KafkaCluster) Describe(ctx context.Context, names []string) (map[string]State, error) {
+	metadata, err := k.client.Metadata(ctx, &kafka.MetadataRequest{Topics: names})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTopicState, err)
+	}
+
+	states := make(map[string]State, len(names))
+	var resources []kafka.DescribeConfigRequestResource
+	for _, topic := range metadata.Topics {
+		if errors.Is(topic.Error, kafka.UnknownTopicOrPartition) {
+			continue
+		}
+		if topic.Error != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTopicState, topic.Name, topic.Error)
+		}
+		states[topic.Name] = State{Partitions: len(topic.Partitions)}
+		resources = append(resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic.Name,
+			ConfigNames:  []string{retentionConfig},
+		})
+	}
+	if len(resources) == 0 {
+		return states, nil
+	}
+
+	configs, err := k.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTopicState, err)
+	}
+	for _, resource := range configs.Resources {
+		if resource.Error != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrTopicState, resource.ResourceName, resource.Error)
+		}
+		for _, entry := range resource.ConfigEntries {
+			if entry.ConfigName != retentionConfig {
+				continue
+			}
+			ms, err := strconv.ParseInt(entry.ConfigValue, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %s=%s", ErrTopicState, resource.ResourceName, retentionConfig, entry.ConfigValue)
+			}
+			state := states[resource.ResourceName]
+			state.Retention = time.Duration(ms) * time.Millisecond
+			states[resource.ResourceName] = state
+		}
+	}
+	return states, nil
+}
+
+// Create 创建主题，副本数为0时使用Broker的默认值
+func (k *KafkaCluster) Create(ctx context.Context, spec Spec) error {
+	topic := kafka.TopicConfig{Topic: spec.Name, NumPartitions: spec.Partitions, ReplicationFactor: -1}
+	if spec.ReplicationFactor > 0 {
+		topic.ReplicationFactor = spec.ReplicationFactor
+	}
+	if spec.Retention > 0 {
+		topic.ConfigEntries = []kafka.ConfigEntry{{ConfigName: retentionConfig, ConfigValue: retentionMs(spec.Retention)}}
+	}
+	resp, err := k.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: []kafka.TopicConfig{topic}})
+	if err != nil {
+		return err
+	}
+	if err := resp.Errors[spec.Name]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return err
+	}
+	return nil
+}
+
+// AddPartitions 将主题的分区数增加到total
+func (k *KafkaCluster) AddPartitions(ctx context.Context, name string, total int) error {
+	resp, err := k.client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{
+		Topics: []kafka.TopicPartitionsConfig{{Name: name, Count: int32(total)}},
+	})
+	if err != nil {
+		return err
+	}
+	return resp.Errors[name]
+}
+
+// SetRetention 只修改retention.ms，主题的其他配置不变
+func (k *KafkaCluster) SetRetention(ctx context.Context, name string, retention time.Duration) error {
+	resp, err := k.client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{
+		Resources: []kafka.IncrementalAlterConfigsRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: name,
+			Configs: []kafka.IncrementalAlterConfigsRequestConfig{{
+				Name:            retentionConfig,
+				Value:           retentionMs(retention),
+				ConfigOperation: kafka.ConfigOperationSet,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			return resource.Error
+		}
+	}
+	return nil
+}
+
+// retentionMs 将保留时间转换为retention.ms的取值
+func retentionMs(retention time.Duration) string {
+	return strconv.FormatInt(retention.Milliseconds(), 10)
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: topics.go
+ * Project: simple-dsp
+ * Description: Kafka主题管理，启动时按配置创建和调整事件主题
+ *
+ * 主要功能:
+ * - 按配置生成各主题期望的分区数、副本数和保留时间
+ * - 比较集群中主题的实际状态，生成需要进行的变更
+ * - 创建缺少的主题、为分区数不足的主题增加分区、调整保留时间
+ * - 支持试运行，只输出变更不修改集群
+ *
+ * 实现细节:
+ * - 通过Kafka管理接口读取分区数和retention.ms，变更使用CreateTopics、CreatePartitions和IncrementalAlterConfigs
+ * - 分区数只增不减，期望的分区数少于实际时只记录，不做变更
+ * - 多个实例同时创建同一主题时，已存在的错误视为成功
+ *
+ * 依赖关系:
+ * - github.com/segmentio/kafka-go
+ * - simple-dsp/pkg/config
+ * - simple-dsp/pkg/logger
+ *
+ * 注意事项:
+ * - 需显式启用，Kafka账号需要主题的Create、Alter和DescribeConfigs权限
+ * - 增加分区会改变按键分区的映射，同一用户的事件在变更前后可能进入不同分区
+ * - 副本数只在创建时生效，已有主题的副本数不做调整
+ */
+
+package topics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+const (
+	// defaultPartitions 默认分区数
+	defaultPartitions = 6
+	// defaultTimeout 默认的检查和变更超时时间
+	defaultTimeout = 30 * time.Second
+)
+
+// Spec 主题期望的状态，Retention为0时不管理保留时间，ReplicationFactor为0时使用Broker的默认值
+type Spec struct {
+	Name              string
+	Partitions        int
+	ReplicationFactor int
+	Retention         time.Duration
+}
+
+// State 集群中主题的实际状态
+type State struct {
+	Partitions int
+	// Retention 主题的retention.ms，-1表示不过期
+	Retention time.Duration
+}
+
+// Action 变更类型
+type Action string
+
+const (
+	// ActionCreate 创建主题
+	ActionCreate Action = "create"
+	// ActionAddPartitions 增加分区
+	ActionAddPartitions Action = "add_partitions"
+	// ActionSetRetention 调整保留时间
+	ActionSetRetention Action = "set_retention"
+	// ActionSkip 无法进行的变更，如减少分区
+	ActionSkip Action = "skip"
+)
+
+// Change 一项主题变更
+type Change struct {
+	Topic  string
+	Action Action
+	Spec   Spec
+	// Current 变更前的状态，创建主题时为nil
+	Current *State
+}
+
+// String 变更的描述，用于日志
+func (c Change) String() string {
+	switch c.Action {
+	case ActionCreate:
+		return fmt.Sprintf("创建主题%s: 分区数%d, 保留时间%v", c.Topic, c.Spec.Partitions, c.Spec.Retention)
+	case ActionAddPartitions:
+		return fmt.Sprintf("主题%s的分区数从%d增加到%d", c.Topic, c.Current.Partitions, c.Spec.Partitions)
+	case ActionSetRetention:
+		return fmt.Sprintf("主题%s的保留时间从%v调整为%v", c.Topic, c.Current.Retention, c.Spec.Retention)
+	default:
+		return fmt.Sprintf("主题%s已有%d个分区，不能减少到%d", c.Topic, c.Current.Partitions, c.Spec.Partitions)
+	}
+}
+
+// Cluster 主题管理使用的Kafka管理接口
+type Cluster interface {
+	// Describe 读取主题的状态，不存在的主题不在结果中
+	Describe(ctx context.Context, names []string) (map[string]State, error)
+	// Create 创建主题，主题已存在时返回nil
+	Create(ctx context.Context, spec Spec) error
+	// AddPartitions 将主题的分区数增加到total
+	AddPartitions(ctx context.Context, name string, total int) error
+	// SetRetention 设置主题的保留时间
+	SetRetention(ctx context.Context, name string, retention time.Duration) error
+}
+
+// Specs 按配置生成names和覆盖配置中各主题期望的状态，按主题名排序
+func Specs(cfg config.KafkaTopicsConfig, names []string) []Spec {
+	partitions := cfg.Partitions
+	if partitions <= 0 {
+		partitions = defaultPartitions
+	}
+
+	specs := make(map[string]Spec, len(names)+len(cfg.Overrides))
+	for _, name := range names {
+		specs[name] = Spec{Name: name, Partitions: partitions, ReplicationFactor: cfg.ReplicationFactor, Retention: cfg.Retention}
+	}
+	for _, o := range cfg.Overrides {
+		spec := Spec{Name: o.Name, Partitions: partitions, ReplicationFactor: cfg.ReplicationFactor, Retention: cfg.Retention}
+		if o.Partitions > 0 {
+			spec.Partitions = o.Partitions
+		}
+		if o.Retention > 0 {
+			spec.Retention = o.Retention
+		}
+		specs[o.Name] = spec
+	}
+
+	result := make([]Spec, 0, len(specs))
+	for _, spec := range specs {
+		result = append(result, spec)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Plan 比较主题的期望状态和实际状态，返回需要进行的变更
+func Plan(ctx context.Context, cluster Cluster, specs []Spec) ([]Change, error) {
+	names := make([]string, 0, len(specs))
+	for _, spec := range specs {
+		names = append(names, spec.Name)
+	}
+	states, err := cluster.Describe(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, spec := range specs {
+		state, ok := states[spec.Name]
+		if !ok {
+			changes = append(changes, Change{Topic: spec.Name, Action: ActionCreate, Spec: spec})
+			continue
+		}
+		current := state
+		switch {
+		case spec.Partitions > state.Partitions:
+			changes = append(changes, Change{Topic: spec.Name, Action: ActionAddPartitions, Spec: spec, Current: &current})
+		case spec.Partitions < state.Partitions:
+			changes = append(changes, Change{Topic: spec.Name, Action: ActionSkip, Spec: spec, Current: &current})
+		}
+		if spec.Retention > 0 && spec.Retention != state.Retention {
+			changes = append(changes, Change{Topic: spec.Name, Action: ActionSetRetention, Spec: spec, Current: &current})
+		}
+	}
+	return changes, nil
+}
+
+// Ensure 按配置检查并变更主题，返回需要进行的变更
+// 未启用时不检查；试运行时只记录变更；某项变更失败时继续其余变更，返回第一个错误
+func Ensure(ctx context.Context, cfg config.KafkaTopicsConfig, cluster Cluster, names []string, log *logger.Logger) ([]Change, error) {
+	if !cfg.AutoCreate {
+		return nil, nil
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	changes, err := Plan(ctx, cluster, Specs(cfg, names))
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		log.Info("Kafka主题已是期望的状态")
+		return nil, nil
+	}
+
+	var firstErr error
+	for _, change := range changes {
+		if change.Action == ActionSkip {
+			log.Warn("跳过Kafka主题变更", "change", change.String())
+			continue
+		}
+		if cfg.DryRun {
+			log.Info("试运行，未变更Kafka主题", "change", change.String())
+			continue
+		}
+		if err := apply(ctx, cluster, change); err != nil {
+			log.Error("变更Kafka主题失败", "change", change.String(), "error", err)
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", change.Topic, err)
+			}
+			continue
+		}
+		log.Info("变更Kafka主题", "change", change.String())
+	}
+	return changes, firstErr
+}
+
+// apply 执行一项变更
+func apply(ctx context.Context, cluster Cluster, change Change) error {
+	switch change.Action {
+	case ActionCreate:
+		return cluster.Create(ctx, change.Spec)
+	case ActionAddPartitions:
+		return cluster.AddPartitions(ctx, change.Topic, change.Spec.Partitions)
+	case ActionSetRetention:
+		return cluster.SetRetention(ctx, change.Topic, change.Spec.Retention)
+	}
+	return nil
+}
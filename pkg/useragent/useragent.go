@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2024 Simple DSP
+ *
+ * File: useragent.go
+ * Project: simple-dsp
+ * Description: User-Agent解析，识别设备类型和操作系统
+ *
+ * 主要功能:
+ * - 按User-Agent识别手机、平板、桌面和联网电视
+ * - 按User-Agent识别iOS、Android、HarmonyOS、Windows、macOS等操作系统
+ *
+ * 实现细节:
+ * - 按关键字匹配，不区分大小写，规则按从具体到宽泛的顺序排列
+ * - 联网电视优先于平板和手机，平板优先于手机
+ * - 不带Mobile的Android为平板，HarmonyOS的UA通常也带Android，优先识别为HarmonyOS
+ *
+ * 依赖关系:
+ * - 无
+ *
+ * 注意事项:
+ * - 只用于报表维度，不保证与专业UA库的结果一致
+ * - iPadOS 13以后的Safari默认使用桌面UA，会识别为macOS桌面
+ */
+
+package useragent
+
+import "strings"
+
+// 设备类型
+const (
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceCTV     = "ctv"
+	DeviceUnknown = "unknown"
+)
+
+// 操作系统
+const (
+	OSIOS       = "ios"
+	OSAndroid   = "android"
+	OSHarmonyOS = "harmonyos"
+	OSWindows   = "windows"
+	OSMacOS     = "macos"
+	OSChromeOS  = "chromeos"
+	OSLinux     = "linux"
+	OSTizen     = "tizen"
+	OSWebOS     = "webos"
+	OSRoku      = "roku"
+	OSOther     = "other"
+)
+
+// Device 设备信息
+type Device struct {
+	Type string `json:"device_type"`
+	OS   string `json:"os"`
+}
+
+// rule 关键字匹配规则，任一关键字出现即匹配
+type rule struct {
+	keywords []string
+	value    string
+}
+
+var (
+	ctvKeywords = []string{"smart-tv", "smarttv", "hbbtv", "appletv", "apple tv", "googletv", "google tv",
+		"android tv", "crkey", "roku", "bravia", "netcast", "web0s", "tizen tv", "fire tv"}
+	tabletKeywords  = []string{"ipad", "tablet", "kindle", "silk/", "playbook"}
+	mobileKeywords  = []string{"iphone", "ipod", "mobile", "windows phone"}
+	desktopKeywords = []string{"windows nt", "macintosh", "x11", "cros "}
+
+	osRules = []rule{
+		{[]string{"iphone", "ipad", "ipod", "appletv", "cpu os "}, OSIOS},
+		{[]string{"harmonyos", "openharmony"}, OSHarmonyOS},
+		{[]string{"android"}, OSAndroid},
+		{[]string{"windows"}, OSWindows},
+		{[]string{"cros "}, OSChromeOS},
+		{[]string{"macintosh", "mac os x"}, OSMacOS},
+		{[]string{"tizen"}, OSTizen},
+		{[]string{"web0s", "webos"}, OSWebOS},
+		{[]string{"roku"}, OSRoku},
+		{[]string{"linux"}, OSLinux},
+	}
+)
+
+// Parse 解析User-Agent，为空时返回未知设备
+func Parse(ua string) Device {
+	if strings.TrimSpace(ua) == "" {
+		return Device{Type: DeviceUnknown, OS: OSOther}
+	}
+	ua = strings.ToLower(ua)
+
+	device := Device{Type: DeviceUnknown, OS: OSOther}
+	for _, r := range osRules {
+		if containsAny(ua, r.keywords) {
+			device.OS = r.value
+			break
+		}
+	}
+
+	switch {
+	case containsAny(ua, ctvKeywords):
+		device.Type = DeviceCTV
+	case containsAny(ua, tabletKeywords):
+		device.Type = DeviceTablet
+	case containsAny(ua, mobileKeywords):
+		device.Type = DeviceMobile
+	case device.OS == OSAndroid || device.OS == OSHarmonyOS:
+		// 不带Mobile的Android设备为平板
+		device.Type = DeviceTablet
+	case containsAny(ua, desktopKeywords) || device.OS == OSLinux:
+		device.Type = DeviceDesktop
+	}
+	return device
+}
+
+// containsAny 判断s是否包含任一关键字
+func containsAny(s string, keywords []string) bool {
+	for _, k := range keywords {
+		if strings.Contains(s, k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package admin_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"simple-dsp/internal/admin"
+	"simple-dsp/pkg/config"
+)
+
+// gather 采集指标，返回指标名到标签串再到取值的映射
+func gather(t *testing.T, collector prometheus.Collector) map[string]map[string]float64 {
+	t.Helper()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	result := make(map[string]map[string]float64)
+	for _, mf := range families {
+		series := make(map[string]float64)
+		for _, metric := range mf.GetMetric() {
+			series[labelString(metric)] = metric.GetGauge().GetValue()
+		}
+		result[mf.GetName()] = series
+	}
+	return result
+}
+
+func labelString(metric *dto.Metric) string {
+	var s string
+	for _, lp := range metric.GetLabel() {
+		s += lp.GetName() + "=" + lp.GetValue() + ","
+	}
+	return s
+}
+
+func TestDashboardCollector(t *testing.T) {
+	db := newFakeCampaigns()
+	dashboard := admin.NewDashboard(config.AdminDashboardConfig{TopCampaigns: 1}, db.Open(t), newStats(), nil, newLogger())
+	collector := admin.NewDashboardCollector(dashboard)
+
+	// 首次汇总完成前不输出指标
+	if got := gather(t, collector); len(got) != 0 {
+		t.Fatalf("汇总前不应输出指标, got %v", got)
+	}
+
+	dashboard.Refresh(context.Background())
+	got := gather(t, collector)
+	if got["dsp_dashboard_spend"][""] != 50 || got["dsp_dashboard_bids"][""] != 4000 || got["dsp_dashboard_active_campaigns"][""] != 2 {
+		t.Errorf("全局指标错误: %v", got)
+	}
+
+	// 排名第一的计划以名次和名称为标签，其余计划和已删除计划合并为other
+	spend := got["dsp_dashboard_campaign_spend"]
+	if len(spend) != 2 || spend["campaign=计划二,rank=1,"] != 30 || spend["campaign=other,rank=other,"] != 20 {
+		t.Errorf("计划消耗错误: %v", spend)
+	}
+	if clicks := got["dsp_dashboard_campaign_clicks"]; clicks["campaign=计划二,rank=1,"] != 6 || clicks["campaign=other,rank=other,"] != 14 {
+		t.Errorf("计划点击错误: %v", clicks)
+	}
+	for name := range got {
+		for labels := range got[name] {
+			if strings.Contains(labels, "=c1,") || strings.Contains(labels, "=c2,") {
+				t.Errorf("指标%s不应带广告计划ID: %s", name, labels)
+			}
+		}
+	}
+	if got["dsp_dashboard_updated_timestamp_seconds"][""] == 0 {
+		t.Error("缺少汇总时间")
+	}
+}
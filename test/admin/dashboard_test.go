@@ -0,0 +1,241 @@
+package admin_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/admin"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakedb"
+)
+
+// memoryStats 固定的窗口统计，errs中的出价策略返回错误
+type memoryStats struct {
+	windows map[string]stats.WindowStats
+	errs    map[string]bool
+}
+
+func (m memoryStats) LoadWindow(ctx context.Context, adID string, from, to time.Time) (*stats.WindowStats, error) {
+	if m.errs[adID] {
+		return nil, errors.New("连接超时")
+	}
+	w := m.windows[adID]
+	return &w, nil
+}
+
+var (
+	campaignColumns = []string{"id", "name", "status"}
+	strategyColumns = []string{"id", "campaign_id"}
+)
+
+// newFakeCampaigns 三个广告计划，策略5属于已删除的计划
+func newFakeCampaigns() *fakedb.DB {
+	db := fakedb.New()
+	db.Respond(`SELECT id, name, status FROM "campaigns"`, "", campaignColumns,
+		[]driver.Value{"c1", "计划一", "active"},
+		[]driver.Value{"c2", "计划二", "active"},
+		[]driver.Value{"c3", "计划三", "paused"},
+	)
+	db.Respond(`SELECT id, campaign_id FROM "bid_strategies"`, "", strategyColumns,
+		[]driver.Value{int64(1), "c1"},
+		[]driver.Value{int64(2), "c1"},
+		[]driver.Value{int64(3), "c2"},
+		[]driver.Value{int64(4), "c3"},
+		[]driver.Value{int64(5), "deleted"},
+	)
+	return db
+}
+
+func newStats() memoryStats {
+	return memoryStats{windows: map[string]stats.WindowStats{
+		"1": {Bids: 1000, Wins: 100, Impressions: 90, Clicks: 9, Cost: 10},
+		"2": {Bids: 500, Wins: 50, Impressions: 50, Clicks: 1, Cost: 5},
+		"3": {Bids: 2000, Wins: 300, Impressions: 300, Clicks: 6, Cost: 30},
+		"5": {Bids: 500, Wins: 50, Impressions: 60, Clicks: 4, Cost: 5},
+	}}
+}
+
+func newLogger() *logger.Logger {
+	return logger.NewLogger(zap.NewNop())
+}
+
+// unreachableRedis 返回连接已关闭端口的客户端
+func unreachableRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	rdb := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: 200 * time.Millisecond})
+	t.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+func alertCodes(summary *admin.DashboardSummary) []string {
+	var codes []string
+	for _, a := range summary.Alerts {
+		codes = append(codes, a.Code)
+	}
+	return codes
+}
+
+func TestDashboardAggregatesToday(t *testing.T) {
+	db := newFakeCampaigns()
+	dashboard := admin.NewDashboard(config.AdminDashboardConfig{TopCampaigns: 2}, db.Open(t), newStats(), nil, newLogger())
+
+	summary := dashboard.Refresh(context.Background())
+	if summary.Date != time.Now().Format("2006-01-02") {
+		t.Errorf("统计日期应为当天, got %s", summary.Date)
+	}
+	// 已删除计划的策略计入全局
+	if summary.Spend != 50 || summary.Impressions != 500 || summary.Clicks != 20 {
+		t.Errorf("全局汇总错误: spend=%v impressions=%d clicks=%d", summary.Spend, summary.Impressions, summary.Clicks)
+	}
+	if summary.Bids != 4000 || summary.Wins != 500 || summary.WinRate != 0.125 {
+		t.Errorf("胜率错误: bids=%d wins=%d win_rate=%v", summary.Bids, summary.Wins, summary.WinRate)
+	}
+	if summary.CTR != 0.04 {
+		t.Errorf("点击率应为0.04, got %v", summary.CTR)
+	}
+	if summary.ActiveCampaigns != 2 {
+		t.Errorf("投放中的计划应为2, got %d", summary.ActiveCampaigns)
+	}
+	if len(summary.Alerts) != 0 {
+		t.Errorf("不应有告警, got %+v", summary.Alerts)
+	}
+
+	// 按消耗排序，没有投放数据的计划三不参与排名，已删除的计划不出现
+	if len(summary.TopCampaigns) != 2 {
+		t.Fatalf("应返回2个计划, got %+v", summary.TopCampaigns)
+	}
+	top := summary.TopCampaigns[0]
+	if top.ID != "c2" || top.Spend != 30 || top.Impressions != 300 || top.CTR != 0.02 {
+		t.Errorf("第一名应为计划二, got %+v", top)
+	}
+	if second := summary.TopCampaigns[1]; second.ID != "c1" || second.Spend != 15 || second.Clicks != 10 || second.Name != "计划一" {
+		t.Errorf("第二名应为计划一且汇总两个策略, got %+v", second)
+	}
+
+	for _, s := range db.Statements() {
+		if !strings.HasPrefix(s.Query, "SELECT") {
+			t.Errorf("看板只应读取数据, got %s", s.Query)
+		}
+	}
+}
+
+func TestDashboardHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dashboard := admin.NewDashboard(config.AdminDashboardConfig{}, newFakeCampaigns().Open(t), newStats(), nil, newLogger())
+	router := gin.New()
+	router.GET("/api/v1/admin/dashboard", dashboard.Get)
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/dashboard", nil))
+		return w
+	}
+
+	if w := get(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("首次汇总前应返回503, got %d", w.Code)
+	}
+
+	dashboard.Refresh(context.Background())
+	w := get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("应返回200, got %d: %s", w.Code, w.Body)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	for _, field := range []string{"spend", "impressions", "clicks", "win_rate", "active_campaigns", "top_campaigns", "alerts", "updated_at"} {
+		if _, ok := body[field]; !ok {
+			t.Errorf("响应缺少%s", field)
+		}
+	}
+	if body["spend"] != 50.0 {
+		t.Errorf("消耗应为50, got %v", body["spend"])
+	}
+}
+
+func TestDashboardServesCachedSummary(t *testing.T) {
+	db := newFakeCampaigns()
+	dashboard := admin.NewDashboard(config.AdminDashboardConfig{RefreshInterval: time.Hour}, db.Open(t), newStats(), nil, newLogger())
+	dashboard.Start()
+	defer dashboard.Stop()
+
+	// 启动后立即汇总一次
+	deadline := time.Now().Add(2 * time.Second)
+	for dashboard.Summary() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("启动后应立即汇总")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 读取缓存不查询数据库
+	db.Reset()
+	for i := 0; i < 3; i++ {
+		if dashboard.Summary().Spend != 50 {
+			t.Fatalf("缓存的消耗应为50, got %v", dashboard.Summary().Spend)
+		}
+	}
+	if n := len(db.Statements()); n != 0 {
+		t.Errorf("读取缓存不应查询数据库, got %d条语句", n)
+	}
+}
+
+func TestDashboardAlerts(t *testing.T) {
+	source := newStats()
+	source.errs = map[string]bool{"4": true}
+	cfg := config.AdminDashboardConfig{MinWinRate: 0.2, MinBids: 1000}
+	dashboard := admin.NewDashboard(cfg, newFakeCampaigns().Open(t), source, unreachableRedis(t), newLogger())
+
+	summary := dashboard.Refresh(context.Background())
+	codes := strings.Join(alertCodes(summary), ",")
+	for _, want := range []string{admin.AlertRedisUnavailable, admin.AlertStatsUnavailable, admin.AlertLowWinRate} {
+		if !strings.Contains(codes, want) {
+			t.Errorf("应有告警%s, got %s", want, codes)
+		}
+	}
+	for _, a := range summary.Alerts {
+		if a.Code == admin.AlertRedisUnavailable && a.Level != admin.AlertCritical {
+			t.Errorf("Redis不可用应为严重告警, got %s", a.Level)
+		}
+	}
+	// 读取失败的策略不影响其他策略的汇总
+	if summary.Spend != 50 {
+		t.Errorf("其他策略应照常汇总, got %v", summary.Spend)
+	}
+
+	// 出价次数不足时不判断胜率
+	cfg.MinBids = 10000
+	dashboard = admin.NewDashboard(cfg, newFakeCampaigns().Open(t), newStats(), nil, newLogger())
+	if summary := dashboard.Refresh(context.Background()); len(summary.Alerts) != 0 {
+		t.Errorf("出价次数不足时不应告警, got %+v", summary.Alerts)
+	}
+}
+
+func TestDashboardWithoutDatabase(t *testing.T) {
+	dashboard := admin.NewDashboard(config.AdminDashboardConfig{}, nil, newStats(), nil, newLogger())
+	summary := dashboard.Refresh(context.Background())
+	if summary.Spend != 0 || summary.ActiveCampaigns != 0 || summary.TopCampaigns == nil || summary.Alerts == nil {
+		t.Errorf("未配置数据库时只返回空的汇总, got %+v", summary)
+	}
+}
@@ -0,0 +1,497 @@
+package auth_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/auth"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+const (
+	testPassword = "correct-horse-battery"
+	testToken    = "0123456789abcdef0123456789abcdef"
+)
+
+// memStore 内存用户存储
+type memStore struct {
+	mu    sync.Mutex
+	users map[string]models.AdminUser
+}
+
+func newMemStore() *memStore {
+	return &memStore{users: make(map[string]models.AdminUser)}
+}
+
+func (s *memStore) Get(_ context.Context, id string) (*models.AdminUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return nil, auth.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+func (s *memStore) GetByUsername(_ context.Context, username string) (*models.AdminUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.Username == username {
+			return &user, nil
+		}
+	}
+	return nil, auth.ErrUserNotFound
+}
+
+func (s *memStore) List(_ context.Context) ([]models.AdminUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users := make([]models.AdminUser, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (s *memStore) Create(_ context.Context, user *models.AdminUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.users {
+		if existing.Username == user.Username {
+			return auth.ErrUsernameTaken
+		}
+	}
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *memStore) Update(_ context.Context, user *models.AdminUser) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.ID] = *user
+	return nil
+}
+
+func (s *memStore) Delete(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[id]; !ok {
+		return auth.ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+type testEnv struct {
+	service *auth.Service
+	redis   *fakeredis.Server
+	router  *gin.Engine
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	fake := fakeredis.New(t)
+	log := logger.NewLogger(zap.NewNop())
+	service := auth.NewService(config.AdminAuthConfig{
+		Enabled:          true,
+		APITokens:        []string{testToken},
+		CookieSecure:     true,
+		BcryptCost:       4,
+		MaxLoginAttempts: 3,
+		TOTPIssuer:       "Simple DSP",
+	}, newMemStore(), fake.Client(t), log)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(service.Middleware())
+	handlers.NewAuthHandler(service, log).RegisterRoutes(router)
+	router.GET("/api/v1/admin/system/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/api/v1/config", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return &testEnv{service: service, redis: fake, router: router}
+}
+
+func (e *testEnv) createUser(t *testing.T, username, role string) *models.AdminUser {
+	t.Helper()
+	user, err := e.service.CreateUser(context.Background(), username, testPassword, role, "")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return user
+}
+
+func (e *testEnv) login(t *testing.T, username string) *auth.Session {
+	t.Helper()
+	session, err := e.service.Login(context.Background(), username, testPassword, "")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	return session
+}
+
+// do 发送请求，session非空时携带会话Cookie和CSRF令牌
+func (e *testEnv) do(method, path string, body any, session *auth.Session, withCSRF bool) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if session != nil {
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: session.Token})
+		if withCSRF {
+			req.Header.Set(auth.CSRFHeader, session.CSRFToken)
+		}
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLogin_SessionCookies(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice", auth.RoleOperator)
+
+	w := env.do(http.MethodPost, auth.LoginPath, gin.H{"username": "alice", "password": testPassword}, nil, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("登录 = %d, body = %s", w.Code, w.Body.String())
+	}
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	session, csrf := cookies[auth.SessionCookie], cookies[auth.CSRFCookie]
+	if session == nil || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("会话Cookie = %+v, 应为HttpOnly、Secure、SameSite=Strict", session)
+	}
+	if csrf == nil || csrf.HttpOnly {
+		t.Fatalf("CSRF Cookie = %+v, 页面脚本应能读取", csrf)
+	}
+
+	var resp struct {
+		CSRFToken string `json:"csrf_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.CSRFToken != csrf.Value {
+		t.Fatalf("响应中的CSRF令牌 = %q, Cookie = %q", resp.CSRFToken, csrf.Value)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"alice"`) {
+		t.Fatalf("me = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddleware_CSRF(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice", auth.RoleOperator)
+	session := env.login(t, "alice")
+
+	if w := env.do(http.MethodGet, "/api/v1/admin/system/status", nil, nil, false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("未登录 = %d, want 401", w.Code)
+	}
+	// 读请求不需要CSRF令牌
+	if w := env.do(http.MethodGet, "/api/v1/admin/system/status", nil, session, false); w.Code != http.StatusOK {
+		t.Fatalf("读请求 = %d, want 200", w.Code)
+	}
+	if w := env.do(http.MethodPost, "/api/v1/config", nil, session, false); w.Code != http.StatusForbidden {
+		t.Fatalf("缺少CSRF令牌的写请求 = %d, want 403", w.Code)
+	}
+	forged := *session
+	forged.CSRFToken = "forged"
+	if w := env.do(http.MethodPost, "/api/v1/config", nil, &forged, true); w.Code != http.StatusForbidden {
+		t.Fatalf("错误的CSRF令牌 = %d, want 403", w.Code)
+	}
+	if w := env.do(http.MethodPost, "/api/v1/config", nil, session, true); w.Code != http.StatusOK {
+		t.Fatalf("携带CSRF令牌的写请求 = %d, want 200", w.Code)
+	}
+
+	if w := env.do(http.MethodPost, "/api/v1/auth/logout", nil, session, true); w.Code != http.StatusNoContent {
+		t.Fatalf("注销 = %d, want 204", w.Code)
+	}
+	if w := env.do(http.MethodGet, "/api/v1/admin/system/status", nil, session, false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("注销后 = %d, want 401", w.Code)
+	}
+}
+
+func TestLogin_Lockout(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "alice", auth.RoleOperator)
+	ctx := context.Background()
+
+	// 用户不存在和密码错误返回相同的错误
+	if _, err := env.service.Login(ctx, "nobody", testPassword, ""); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("用户不存在 error = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := env.service.Login(ctx, "alice", "wrong-password!", ""); !errors.Is(err, auth.ErrInvalidCredentials) {
+			t.Fatalf("第%d次密码错误 error = %v", i+1, err)
+		}
+	}
+	// 达到上限后密码正确也拒绝
+	if _, err := env.service.Login(ctx, "alice", testPassword, ""); !errors.Is(err, auth.ErrTooManyAttempts) {
+		t.Fatalf("锁定后 error = %v, want ErrTooManyAttempts", err)
+	}
+	w := env.do(http.MethodPost, auth.LoginPath, gin.H{"username": "alice", "password": testPassword}, nil, false)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("锁定后登录 = %d, want 429", w.Code)
+	}
+}
+
+func TestLogin_DisabledUser(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", auth.RoleOperator)
+	session := env.login(t, "alice")
+
+	disabled := false
+	if _, err := env.service.UpdateUser(context.Background(), user.ID, auth.UserUpdate{Enabled: &disabled}); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if _, err := env.service.Login(context.Background(), "alice", testPassword, ""); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("停用后登录 error = %v", err)
+	}
+	if w := env.do(http.MethodGet, "/api/v1/auth/me", nil, session, false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("停用前的会话 = %d, want 401", w.Code)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", auth.RoleOperator)
+	ctx := context.Background()
+
+	secret, uri, err := env.service.EnrollTOTP(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() error = %v", err)
+	}
+	if !strings.HasPrefix(uri, "otpauth://totp/Simple%20DSP:alice?") || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("uri = %s", uri)
+	}
+	// 确认前登录不需要动态口令
+	env.login(t, "alice")
+
+	now, _ := auth.TOTPCode(secret, time.Now())
+	if err := env.service.ConfirmTOTP(ctx, user.ID, "abcdef"); !errors.Is(err, auth.ErrInvalidOTP) {
+		t.Fatalf("错误的口令 error = %v", err)
+	}
+	if err := env.service.ConfirmTOTP(ctx, user.ID, now); err != nil {
+		t.Fatalf("ConfirmTOTP() error = %v", err)
+	}
+	if _, _, err := env.service.EnrollTOTP(ctx, user.ID); !errors.Is(err, auth.ErrTOTPEnabled) {
+		t.Fatalf("已启用时重新生成 error = %v", err)
+	}
+
+	// 未提供口令时提示客户端输入
+	w := env.do(http.MethodPost, auth.LoginPath, gin.H{"username": "alice", "password": testPassword}, nil, false)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"otp_required":true`) {
+		t.Fatalf("未提供口令 = %d, body = %s", w.Code, w.Body.String())
+	}
+	// 确认时使用过的口令不能再次使用
+	if _, err := env.service.Login(ctx, "alice", testPassword, now); !errors.Is(err, auth.ErrInvalidOTP) {
+		t.Fatalf("重放口令 error = %v, want ErrInvalidOTP", err)
+	}
+	// 下一个步长的口令在允许的时钟偏差内
+	next, _ := auth.TOTPCode(secret, time.Now().Add(30*time.Second))
+	if _, err := env.service.Login(ctx, "alice", testPassword, next); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// 管理员停用后不再需要口令
+	if err := env.service.DisableTOTP(ctx, user.ID); err != nil {
+		t.Fatalf("DisableTOTP() error = %v", err)
+	}
+	env.login(t, "alice")
+}
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// RFC 6238附录B的SHA1测试向量，取后6位
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		got, err := auth.TOTPCode(secret, time.Unix(tt.unix, 0))
+		if err != nil || got != tt.want {
+			t.Errorf("TOTPCode(%d) = %q, %v, want %q", tt.unix, got, err, tt.want)
+		}
+	}
+}
+
+func TestAPIToken(t *testing.T) {
+	env := newTestEnv(t)
+	request := func(method, path, token string, body any) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(http.MethodGet, "/api/v1/users", "wrong-token", nil); code != http.StatusUnauthorized {
+		t.Fatalf("错误的令牌 = %d, want 401", code)
+	}
+	// API令牌视为管理员，不需要CSRF令牌，可以创建第一个用户
+	body := gin.H{"username": "root", "password": testPassword, "role": auth.RoleAdmin}
+	if code := request(http.MethodPost, "/api/v1/users", testToken, body); code != http.StatusCreated {
+		t.Fatalf("使用令牌创建用户 = %d, want 201", code)
+	}
+	if code := request(http.MethodPost, "/api/v1/users", testToken, body); code != http.StatusConflict {
+		t.Fatalf("重复的用户名 = %d, want 409", code)
+	}
+	// 只能由登录用户调用的接口
+	if code := request(http.MethodPut, "/api/v1/auth/password", testToken, gin.H{"current_password": "x", "new_password": "y"}); code != http.StatusBadRequest {
+		t.Fatalf("令牌修改密码 = %d, want 400", code)
+	}
+}
+
+func TestUserManagement_Roles(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "root", auth.RoleAdmin)
+	env.createUser(t, "alice", auth.RoleOperator)
+	admin := env.login(t, "root")
+	operator := env.login(t, "alice")
+
+	if w := env.do(http.MethodGet, "/api/v1/users", nil, operator, false); w.Code != http.StatusForbidden {
+		t.Fatalf("运营人员查询用户 = %d, want 403", w.Code)
+	}
+	w := env.do(http.MethodGet, "/api/v1/users", nil, admin, false)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "password") {
+		t.Fatalf("管理员查询用户 = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		body gin.H
+		want int
+	}{
+		{"无效的用户名", gin.H{"username": "a b", "password": testPassword, "role": auth.RoleOperator}, http.StatusBadRequest},
+		{"密码过短", gin.H{"username": "bob", "password": "short", "role": auth.RoleOperator}, http.StatusBadRequest},
+		{"无效的角色", gin.H{"username": "bob", "password": testPassword, "role": "root"}, http.StatusBadRequest},
+		{"创建成功", gin.H{"username": "bob", "password": testPassword, "role": auth.RoleOperator}, http.StatusCreated},
+	}
+	for _, tt := range tests {
+		if w := env.do(http.MethodPost, "/api/v1/users", tt.body, admin, true); w.Code != tt.want {
+			t.Errorf("%s: 创建用户 = %d, want %d, body = %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+	if w := env.do(http.MethodDelete, "/api/v1/users/missing", nil, admin, true); w.Code != http.StatusNotFound {
+		t.Fatalf("删除不存在的用户 = %d, want 404", w.Code)
+	}
+}
+
+func TestPasswordChange_RevokesSessions(t *testing.T) {
+	env := newTestEnv(t)
+	user := env.createUser(t, "alice", auth.RoleOperator)
+	first := env.login(t, "alice")
+	second := env.login(t, "alice")
+
+	const newPassword = "a-much-better-password"
+	w := env.do(http.MethodPut, "/api/v1/auth/password", gin.H{"current_password": "wrong-password!", "new_password": newPassword}, first, true)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("原密码错误 = %d, want 401", w.Code)
+	}
+	w = env.do(http.MethodPut, "/api/v1/auth/password", gin.H{"current_password": testPassword, "new_password": newPassword}, first, true)
+	if w.Code != http.StatusOK {
+		t.Fatalf("修改密码 = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 原有会话全部失效，当前设备换发新会话
+	for _, session := range []*auth.Session{first, second} {
+		if w := env.do(http.MethodGet, "/api/v1/auth/me", nil, session, false); w.Code != http.StatusUnauthorized {
+			t.Fatalf("修改密码前的会话 = %d, want 401", w.Code)
+		}
+	}
+	var renewed *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == auth.SessionCookie {
+			renewed = cookie
+		}
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req.AddCookie(renewed)
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("新会话 = %d, want 200", rec.Code)
+	}
+
+	// 角色变更同样注销会话
+	session, err := env.service.Login(context.Background(), "alice", newPassword, "")
+	if err != nil {
+		t.Fatalf("使用新密码登录 error = %v", err)
+	}
+	if env.redis.Keys("admin:session:") != 2 {
+		t.Fatalf("会话数 = %d, want 2", env.redis.Keys("admin:session:"))
+	}
+	role := auth.RoleAdmin
+	if _, err := env.service.UpdateUser(context.Background(), user.ID, auth.UserUpdate{Role: &role}); err != nil {
+		t.Fatalf("UpdateUser() error = %v", err)
+	}
+	if w := env.do(http.MethodGet, "/api/v1/auth/me", nil, session, false); w.Code != http.StatusUnauthorized {
+		t.Fatalf("角色变更前的会话 = %d, want 401", w.Code)
+	}
+	if n := env.redis.Keys("admin:session:"); n != 0 {
+		t.Fatalf("剩余会话数 = %d, want 0", n)
+	}
+}
+
+func TestAdminReset_RevokesSessions(t *testing.T) {
+	env := newTestEnv(t)
+	env.createUser(t, "root", auth.RoleAdmin)
+	user := env.createUser(t, "alice", auth.RoleOperator)
+	admin := env.login(t, "root")
+
+	// 管理员重置密码或停用动态口令后，用户的原有会话全部失效，管理员的会话不受影响
+	requests := []struct {
+		name   string
+		method string
+		path   string
+		body   gin.H
+	}{
+		{"重置密码", http.MethodPut, "/api/v1/users/" + user.ID + "/password", gin.H{"password": testPassword}},
+		{"停用动态口令", http.MethodDelete, "/api/v1/users/" + user.ID + "/totp", nil},
+	}
+	for _, r := range requests {
+		session := env.login(t, "alice")
+		if w := env.do(r.method, r.path, r.body, admin, true); w.Code != http.StatusNoContent {
+			t.Fatalf("%s = %d, body = %s", r.name, w.Code, w.Body.String())
+		}
+		if w := env.do(http.MethodGet, "/api/v1/auth/me", nil, session, false); w.Code != http.StatusUnauthorized {
+			t.Fatalf("%s前的会话 = %d, want 401", r.name, w.Code)
+		}
+		if w := env.do(http.MethodGet, "/api/v1/auth/me", nil, admin, false); w.Code != http.StatusOK {
+			t.Fatalf("%s后管理员的会话 = %d, want 200", r.name, w.Code)
+		}
+	}
+}
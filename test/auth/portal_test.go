@@ -0,0 +1,253 @@
+package auth_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/auth"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakedb"
+)
+
+// newPortalEnv 在认证测试环境上注册广告主自助接口
+func newPortalEnv(t *testing.T) (*testEnv, *fakedb.DB) {
+	t.Helper()
+	env := newTestEnv(t)
+	db := fakedb.New()
+	handlers.NewPortalHandler(db.Open(t), logger.NewLogger(zap.NewNop())).RegisterRoutes(env.router)
+	return env, db
+}
+
+func (e *testEnv) createAdvertiser(t *testing.T, username, advertiserID string) *auth.Session {
+	t.Helper()
+	if _, err := e.service.CreateUser(context.Background(), username, testPassword, auth.RoleAdvertiser, advertiserID); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	return e.login(t, username)
+}
+
+// queriesOn 返回访问指定表的语句
+func queriesOn(db *fakedb.DB, table string) []fakedb.Statement {
+	var matched []fakedb.Statement
+	for _, s := range db.Statements() {
+		if strings.Contains(s.Query, `FROM "`+table+`"`) {
+			matched = append(matched, s)
+		}
+	}
+	return matched
+}
+
+func TestCreateUser_Advertiser(t *testing.T) {
+	env := newTestEnv(t)
+	ctx := context.Background()
+
+	if _, err := env.service.CreateUser(ctx, "acme", testPassword, auth.RoleAdvertiser, ""); !errors.Is(err, auth.ErrInvalidAdvertiser) {
+		t.Fatalf("广告主用户未指定广告主 error = %v", err)
+	}
+	if _, err := env.service.CreateUser(ctx, "alice", testPassword, auth.RoleOperator, "adv-1"); !errors.Is(err, auth.ErrInvalidAdvertiser) {
+		t.Fatalf("运营人员指定广告主 error = %v", err)
+	}
+	user, err := env.service.CreateUser(ctx, "acme", testPassword, auth.RoleAdvertiser, "adv-1")
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// 改为其他角色时必须同时清空广告主
+	role := auth.RoleOperator
+	if _, err := env.service.UpdateUser(ctx, user.ID, auth.UserUpdate{Role: &role}); !errors.Is(err, auth.ErrInvalidAdvertiser) {
+		t.Fatalf("改为运营人员未清空广告主 error = %v", err)
+	}
+	empty := ""
+	updated, err := env.service.UpdateUser(ctx, user.ID, auth.UserUpdate{Role: &role, AdvertiserID: &empty})
+	if err != nil || updated.Role != auth.RoleOperator || updated.AdvertiserID != "" {
+		t.Fatalf("UpdateUser() = %+v, %v", updated, err)
+	}
+}
+
+func TestTenancy_AdvertiserConfined(t *testing.T) {
+	env, _ := newPortalEnv(t)
+	session := env.createAdvertiser(t, "acme", "adv-1")
+
+	// 自助接口和账号接口以外的接口一律拒绝
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{http.MethodGet, "/api/v1/admin/system/status", http.StatusForbidden},
+		{http.MethodPost, "/api/v1/config", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/users", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/unknown", http.StatusForbidden},
+		{http.MethodGet, "/api/v1/auth/me", http.StatusOK},
+		{http.MethodGet, "/api/v1/portal/creatives", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := env.do(tt.method, tt.path, nil, session, true); w.Code != tt.want {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, w.Code, tt.want)
+		}
+	}
+
+	w := env.do(http.MethodGet, "/api/v1/auth/me", nil, session, false)
+	if !strings.Contains(w.Body.String(), `"advertiser_id":"adv-1"`) {
+		t.Fatalf("me = %s, 应包含所属广告主", w.Body.String())
+	}
+}
+
+func TestTenancy_AdvertiserParam(t *testing.T) {
+	env, db := newPortalEnv(t)
+	advertiser := env.createAdvertiser(t, "acme", "adv-1")
+	env.createUser(t, "alice", auth.RoleOperator)
+	operator := env.login(t, "alice")
+
+	// 广告主用户不能指定其他广告主
+	if w := env.do(http.MethodGet, "/api/v1/portal/creatives?advertiser_id=adv-2", nil, advertiser, false); w.Code != http.StatusForbidden {
+		t.Fatalf("广告主指定其他广告主 = %d, want 403", w.Code)
+	}
+	if w := env.do(http.MethodGet, "/api/v1/portal/creatives?advertiser_id=adv-1", nil, advertiser, false); w.Code != http.StatusOK {
+		t.Fatalf("广告主指定所属广告主 = %d, want 200", w.Code)
+	}
+
+	// 运营人员必须指定广告主
+	if w := env.do(http.MethodGet, "/api/v1/portal/creatives", nil, operator, false); w.Code != http.StatusBadRequest {
+		t.Fatalf("运营人员未指定广告主 = %d, want 400", w.Code)
+	}
+	db.Reset()
+	if w := env.do(http.MethodGet, "/api/v1/portal/creatives?advertiser_id=adv-2", nil, operator, false); w.Code != http.StatusOK {
+		t.Fatalf("运营人员指定广告主 = %d, want 200", w.Code)
+	}
+	queries := queriesOn(db, "bid_strategy_creatives")
+	if len(queries) != 1 || !fakedb.HasArg(queries[0].Args, "adv-2") {
+		t.Fatalf("素材查询 = %+v, 应按指定的广告主过滤", queries)
+	}
+
+	// API令牌同样需要指定广告主
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/portal/creatives", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	env.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("API令牌未指定广告主 = %d, want 400", rec.Code)
+	}
+}
+
+func TestPortal_CampaignScoped(t *testing.T) {
+	env, db := newPortalEnv(t)
+	db.Respond(`SELECT * FROM "campaigns"`, "adv-1",
+		[]string{"id", "name", "advertiser_id", "status"},
+		[]driver.Value{"c1", "春季促销", "adv-1", "active"})
+	owner := env.createAdvertiser(t, "acme", "adv-1")
+	other := env.createAdvertiser(t, "globex", "adv-2")
+
+	w := env.do(http.MethodGet, "/api/v1/portal/campaigns/c1", nil, owner, false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"campaign_id":"c1"`) {
+		t.Fatalf("查询所属计划 = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	// 其他广告主的计划与不存在的计划同样返回404
+	db.Reset()
+	if w := env.do(http.MethodGet, "/api/v1/portal/campaigns/c1", nil, other, false); w.Code != http.StatusNotFound {
+		t.Fatalf("查询其他广告主的计划 = %d, want 404", w.Code)
+	}
+	if w := env.do(http.MethodGet, "/api/v1/portal/campaigns/c1/strategies", nil, other, false); w.Code != http.StatusNotFound {
+		t.Fatalf("查询其他广告主的策略 = %d, want 404", w.Code)
+	}
+	for _, s := range queriesOn(db, "campaigns") {
+		if !fakedb.HasArg(s.Args, "adv-2") {
+			t.Fatalf("计划查询 %q 的参数 %v 不包含当前广告主", s.Query, s.Args)
+		}
+	}
+	if len(queriesOn(db, "bid_strategies")) != 0 {
+		t.Fatal("计划不属于当前广告主时不应查询策略")
+	}
+}
+
+func TestPortal_ListCampaigns(t *testing.T) {
+	env, db := newPortalEnv(t)
+	session := env.createAdvertiser(t, "acme", "adv-1")
+
+	// 不能按广告主过滤，只能查询所属广告主
+	if w := env.do(http.MethodGet, "/api/v1/portal/campaigns?filter[advertiser_id]=adv-2", nil, session, false); w.Code != http.StatusBadRequest {
+		t.Fatalf("按广告主过滤 = %d, want 400", w.Code)
+	}
+
+	db.Respond(`SELECT count(*) FROM "campaigns"`, "adv-1", []string{"count"}, []driver.Value{int64(1)})
+	db.Respond(`SELECT * FROM "campaigns"`, "adv-1",
+		[]string{"id", "name", "advertiser_id", "status"},
+		[]driver.Value{"c1", "春季促销", "adv-1", "active"})
+	w := env.do(http.MethodGet, "/api/v1/portal/campaigns?filter[status]=active", nil, session, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("列出计划 = %d, body = %s", w.Code, w.Body.String())
+	}
+	var page struct {
+		Items []map[string]any `json:"items"`
+		Total int64            `json:"total"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if page.Total != 1 || len(page.Items) != 1 || page.Items[0]["campaign_id"] != "c1" {
+		t.Fatalf("计划列表 = %s", w.Body.String())
+	}
+	for _, s := range queriesOn(db, "campaigns") {
+		if !strings.Contains(s.Query, "advertiser_id =") || !fakedb.HasArg(s.Args, "adv-1") {
+			t.Fatalf("计划查询 %q 未按广告主过滤", s.Query)
+		}
+	}
+}
+
+func TestPortal_Report(t *testing.T) {
+	env, db := newPortalEnv(t)
+	session := env.createAdvertiser(t, "acme", "adv-1")
+	db.Respond(`SELECT * FROM "campaigns"`, "adv-1", []string{"id", "advertiser_id"}, []driver.Value{"c1", "adv-1"})
+	db.Respond(`SELECT strategy_id`, "adv-1",
+		[]string{"strategy_id", "creative_id", "impressions", "clicks", "spend", "date"},
+		[]driver.Value{int64(7), int64(70), int64(1000), int64(20), 12.5, "2026-10-15"},
+		[]driver.Value{int64(7), int64(71), int64(1000), int64(30), 7.5, "2026-10-14"})
+
+	// 限定的计划不属于当前广告主时不查询统计
+	other := env.createAdvertiser(t, "globex", "adv-2")
+	if w := env.do(http.MethodGet, "/api/v1/portal/reports?campaign_id=c1", nil, other, false); w.Code != http.StatusNotFound {
+		t.Fatalf("其他广告主的计划报表 = %d, want 404", w.Code)
+	}
+	if len(queriesOn(db, "bid_strategy_stats")) != 0 {
+		t.Fatal("计划不属于当前广告主时不应查询统计")
+	}
+
+	end := time.Now().Format("2006-01-02")
+	w := env.do(http.MethodGet, "/api/v1/portal/reports?campaign_id=c1&end_date="+end, nil, session, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("报表 = %d, body = %s", w.Code, w.Body.String())
+	}
+	var report struct {
+		Summary handlers.StrategyStatsSummary `json:"summary"`
+		Items   []map[string]any              `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &report)
+	if report.Summary.Impressions != 2000 || report.Summary.Clicks != 50 || report.Summary.Spend != 20 || report.Summary.CTR != 0.025 {
+		t.Fatalf("汇总 = %+v", report.Summary)
+	}
+
+	stats := queriesOn(db, "bid_strategy_stats")
+	if len(stats) != 1 {
+		t.Fatalf("统计查询 = %+v", stats)
+	}
+	// 统计只包含当前广告主在该计划下的策略
+	query := stats[0].Query
+	if !strings.Contains(query, "JOIN campaigns ON campaigns.id = bid_strategies.campaign_id") ||
+		!strings.Contains(query, "campaigns.advertiser_id =") || !strings.Contains(query, "bid_strategies.campaign_id =") ||
+		!fakedb.HasArg(stats[0].Args, "adv-1") || !fakedb.HasArg(stats[0].Args, "c1") {
+		t.Fatalf("统计查询 = %q, args = %v", query, stats[0].Args)
+	}
+
+	if w := env.do(http.MethodGet, "/api/v1/portal/reports?start_date=2026-13-01", nil, session, false); w.Code != http.StatusBadRequest {
+		t.Fatalf("无效的日期 = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,312 @@
+package automation_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/automation"
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStrategies 内存出价策略存储，只实现规则引擎用到的方法
+type memoryStrategies struct {
+	bidding.Repository
+	mu         sync.Mutex
+	strategies map[int64]*bidding.BidStrategy
+}
+
+func newMemoryStrategies(strategies ...bidding.BidStrategy) *memoryStrategies {
+	m := &memoryStrategies{strategies: make(map[int64]*bidding.BidStrategy)}
+	for i := range strategies {
+		id, _ := strconv.ParseInt(strategies[i].ID, 10, 64)
+		m.strategies[id] = &strategies[i]
+	}
+	return m
+}
+
+func (m *memoryStrategies) GetBidStrategy(ctx context.Context, id int64) (*bidding.BidStrategy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.strategies[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *memoryStrategies) UpdateBidStrategy(ctx context.Context, strategy *bidding.BidStrategy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	copied := *strategy
+	m.strategies[id] = &copied
+	return nil
+}
+
+func (m *memoryStrategies) UpdateBidStrategyStatus(ctx context.Context, id int64, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategies[id].Status = status
+	return nil
+}
+
+func (m *memoryStrategies) get(id int64) bidding.BidStrategy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.strategies[id]
+}
+
+// memoryStats 固定的窗口统计
+type memoryStats map[string]stats.WindowStats
+
+func (m memoryStats) LoadWindow(ctx context.Context, adID string, from, to time.Time) (*stats.WindowStats, error) {
+	w := m[adID]
+	return &w, nil
+}
+
+// memoryStore 内存规则和操作记录存储
+type memoryStore struct {
+	mu      sync.Mutex
+	rules   []*automation.Rule
+	actions []models.AutomationAction
+}
+
+func (s *memoryStore) ListEnabled(ctx context.Context) ([]*automation.Rule, error) {
+	var rules []*automation.Rule
+	for _, r := range s.rules {
+		if r.Enabled {
+			rules = append(rules, r)
+		}
+	}
+	return rules, nil
+}
+
+func (s *memoryStore) RecordAction(ctx context.Context, action *models.AutomationAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions = append(s.actions, *action)
+	return nil
+}
+
+func (s *memoryStore) ListActions(ctx context.Context, strategyID string, since time.Time) ([]models.AutomationAction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var actions []models.AutomationAction
+	for _, a := range s.actions {
+		if a.StrategyID == strategyID && !a.CreateTime.Before(since) {
+			actions = append(actions, a)
+		}
+	}
+	return actions, nil
+}
+
+// cpaRule 3小时内CPA高于50时出价降低10%
+func cpaRule() *automation.Rule {
+	return &automation.Rule{
+		ID:          "rule-1",
+		Name:        "CPA过高降价",
+		StrategyIDs: []string{"1"},
+		Conditions:  []automation.Condition{{Metric: automation.MetricCPA, Operator: automation.OperatorGT, Threshold: 50}},
+		Action:      automation.Action{Type: automation.ActionDecreaseBid, Percent: 10},
+		WindowHours: 3,
+		Enabled:     true,
+	}
+}
+
+// highCPA CPA为100的统计
+var highCPA = stats.WindowStats{Impressions: 10000, Clicks: 100, Conversions: 3, Cost: 300}
+
+func newEngine(store *memoryStore, strategies *memoryStrategies, windows memoryStats) *automation.Engine {
+	cfg := config.AutomationConfig{MaxChangePercent: 20, MaxDailyChangePercent: 50, MinBidPrice: 0.5}
+	return automation.NewEngine(cfg, store, strategies, windows, nil, logger.NewLogger(zap.NewNop()))
+}
+
+func TestRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*automation.Rule)
+		wantErr error
+	}{
+		{"有效规则", func(r *automation.Rule) {}, nil},
+		{"缺少名称", func(r *automation.Rule) { r.Name = "" }, automation.ErrNameRequired},
+		{"缺少策略", func(r *automation.Rule) { r.StrategyIDs = nil }, automation.ErrNoStrategies},
+		{"未知指标", func(r *automation.Rule) { r.Conditions[0].Metric = "roi" }, automation.ErrUnknownMetric},
+		{"未知比较方式", func(r *automation.Rule) { r.Conditions[0].Operator = "eq" }, automation.ErrUnknownOperator},
+		{"窗口超过7天", func(r *automation.Rule) { r.WindowHours = 169 }, automation.ErrInvalidWindow},
+		{"调价幅度超过护栏", func(r *automation.Rule) { r.Action.Percent = 30 }, automation.ErrInvalidPercent},
+		{"暂停不需要幅度", func(r *automation.Rule) { r.Action = automation.Action{Type: automation.ActionPause} }, nil},
+		{"未知操作", func(r *automation.Rule) { r.Action.Type = "delete" }, automation.ErrUnknownAction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := cpaRule()
+			tt.mutate(rule)
+			if err := rule.Validate(20); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRule_Evaluate(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition automation.Condition
+		window    stats.WindowStats
+		want      bool
+	}{
+		{"CPA高于阈值", automation.Condition{Metric: automation.MetricCPA, Operator: automation.OperatorGT, Threshold: 50}, highCPA, true},
+		{"没有转化时CPA按花费计算", automation.Condition{Metric: automation.MetricCPA, Operator: automation.OperatorGT, Threshold: 50}, stats.WindowStats{Cost: 80}, true},
+		{"胜率低于阈值", automation.Condition{Metric: automation.MetricWinRate, Operator: automation.OperatorLT, Threshold: 0.05}, stats.WindowStats{Bids: 1000, Wins: 20}, true},
+		{"没有出价时不计算胜率", automation.Condition{Metric: automation.MetricWinRate, Operator: automation.OperatorLT, Threshold: 0.05}, stats.WindowStats{}, false},
+		{"CTR不低于阈值", automation.Condition{Metric: automation.MetricCTR, Operator: automation.OperatorLT, Threshold: 0.005}, highCPA, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &automation.Rule{Conditions: []automation.Condition{tt.condition}}
+			if got, _ := rule.Evaluate(&tt.window); got != tt.want {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEngine_ApplyAndCooldown(t *testing.T) {
+	store := &memoryStore{rules: []*automation.Rule{cpaRule()}}
+	strategies := newMemoryStrategies(bidding.BidStrategy{ID: "1", Price: 2, Status: bidding.StrategyStatusEnabled})
+	engine := newEngine(store, strategies, memoryStats{"1": highCPA})
+
+	actions, err := engine.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce() error = %v", err)
+	}
+	if len(actions) != 1 || actions[0].Status != automation.StatusApplied {
+		t.Fatalf("actions = %+v, want 1 applied", actions)
+	}
+	if got := strategies.get(1).Price; got != 1.8 {
+		t.Errorf("出价 = %v, want 1.8", got)
+	}
+	if actions[0].BeforePrice != 2 || actions[0].AfterPrice != 1.8 || string(actions[0].Metrics) != `{"cpa":100}` {
+		t.Errorf("操作记录 = %+v", actions[0])
+	}
+
+	// 冷却时间内不再触发
+	actions, _ = engine.RunOnce(context.Background())
+	if len(actions) != 0 {
+		t.Errorf("冷却时间内actions = %+v, want none", actions)
+	}
+	if len(store.actions) != 1 {
+		t.Errorf("操作记录数 = %d, want 1", len(store.actions))
+	}
+}
+
+func TestEngine_DailyGuardRail(t *testing.T) {
+	rule := cpaRule()
+	rule.Action.Percent = 20
+	rule.CooldownMinutes = 1
+	// 当天首次自动调价前出价为2，已调到1.1，下限为2的50%
+	store := &memoryStore{
+		rules: []*automation.Rule{rule},
+		actions: []models.AutomationAction{{
+			RuleID: "other", StrategyID: "1", Action: automation.ActionDecreaseBid, Status: automation.StatusApplied,
+			BeforePrice: 2, AfterPrice: 1.1, CreateTime: time.Now().Add(-time.Minute),
+		}},
+	}
+	if now := time.Now(); now.Add(-time.Minute).Day() != now.Day() {
+		t.Skip("跨天时无法构造当天的操作记录")
+	}
+	strategies := newMemoryStrategies(bidding.BidStrategy{ID: "1", Price: 1.1, Status: bidding.StrategyStatusEnabled})
+	engine := newEngine(store, strategies, memoryStats{"1": highCPA})
+
+	actions, _ := engine.RunOnce(context.Background())
+	if len(actions) != 1 || actions[0].Status != automation.StatusApplied || actions[0].AfterPrice != 1 {
+		t.Fatalf("actions = %+v, want applied to 1", actions)
+	}
+
+	// 已达到当天偏离上限，不再降价
+	store.actions[len(store.actions)-1].CreateTime = time.Now().Add(-2 * time.Minute)
+	actions, _ = engine.RunOnce(context.Background())
+	if len(actions) != 1 || actions[0].Status != automation.StatusBlocked {
+		t.Fatalf("actions = %+v, want blocked", actions)
+	}
+	if got := strategies.get(1).Price; got != 1 {
+		t.Errorf("出价 = %v, want 1", got)
+	}
+}
+
+func TestEngine_DryRunAndLockedPrice(t *testing.T) {
+	dryRun := cpaRule()
+	dryRun.DryRun = true
+	locked := cpaRule()
+	locked.ID = "rule-2"
+	locked.StrategyIDs = []string{"2"}
+
+	store := &memoryStore{rules: []*automation.Rule{dryRun, locked}}
+	strategies := newMemoryStrategies(
+		bidding.BidStrategy{ID: "1", Price: 2, Status: bidding.StrategyStatusEnabled},
+		bidding.BidStrategy{ID: "2", Price: 2, Status: bidding.StrategyStatusEnabled, IsPriceLocked: true},
+	)
+	engine := newEngine(store, strategies, memoryStats{"1": highCPA, "2": highCPA})
+
+	actions, _ := engine.RunOnce(context.Background())
+	if len(actions) != 2 {
+		t.Fatalf("actions = %+v, want 2", actions)
+	}
+	if actions[0].Status != automation.StatusDryRun || actions[0].AfterPrice != 1.8 {
+		t.Errorf("试运行 = %+v, want dry_run to 1.8", actions[0])
+	}
+	if actions[1].Status != automation.StatusBlocked {
+		t.Errorf("出价锁定 = %+v, want blocked", actions[1])
+	}
+	if strategies.get(1).Price != 2 || strategies.get(2).Price != 2 {
+		t.Error("试运行和出价锁定时不应修改出价")
+	}
+}
+
+func TestEngine_Pause(t *testing.T) {
+	rule := cpaRule()
+	rule.Action = automation.Action{Type: automation.ActionPause}
+	rule.MinImpressions = 1000
+	store := &memoryStore{rules: []*automation.Rule{rule}}
+	strategies := newMemoryStrategies(
+		bidding.BidStrategy{ID: "1", Price: 2, Status: bidding.StrategyStatusEnabled, IsPriceLocked: true},
+	)
+	windows := memoryStats{"1": {Impressions: 500, Cost: 300}}
+	engine := newEngine(store, strategies, windows)
+
+	// 展示数不足时不触发
+	if actions, _ := engine.RunOnce(context.Background()); len(actions) != 0 {
+		t.Fatalf("展示数不足时actions = %+v, want none", actions)
+	}
+
+	windows["1"] = highCPA
+	// 预览不修改策略也不写入记录
+	if actions := engine.Preview(context.Background(), rule); len(actions) != 1 || actions[0].Status != automation.StatusDryRun {
+		t.Fatalf("Preview() = %+v, want dry_run", actions)
+	}
+	if len(store.actions) != 0 {
+		t.Errorf("预览后操作记录数 = %d, want 0", len(store.actions))
+	}
+
+	// 暂停不受出价锁定限制
+	actions, _ := engine.RunOnce(context.Background())
+	if len(actions) != 1 || actions[0].Status != automation.StatusApplied {
+		t.Fatalf("actions = %+v, want applied", actions)
+	}
+	if got := strategies.get(1).Status; got != bidding.StrategyStatusDisabled {
+		t.Errorf("策略状态 = %d, want disabled", got)
+	}
+}
@@ -0,0 +1,139 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// creativeRepository 带策略素材关联的存储实现
+type creativeRepository struct {
+	benchRepository
+	creatives map[string][]bidding.BidStrategyCreative
+}
+
+func (m *creativeRepository) ListCreatives(ctx context.Context, strategyID string) ([]bidding.BidStrategyCreative, error) {
+	return m.creatives[strategyID], nil
+}
+
+// memoryApprovals 按交易平台记录审核通过的素材
+type memoryApprovals struct {
+	approved map[string]map[string]bool
+}
+
+func (m *memoryApprovals) Required(exchange string) bool {
+	_, ok := m.approved[exchange]
+	return ok
+}
+
+func (m *memoryApprovals) Approved(exchange, creativeID string) bool {
+	return m.approved[exchange][creativeID]
+}
+
+func TestEngine_CreativeApprovals(t *testing.T) {
+	// 策略1出价更高，但只有策略2的素材通过了ssp-a的审核
+	repo := &creativeRepository{
+		benchRepository: benchRepository{strategies: []bidding.BidStrategy{
+			{ID: "1", Price: 5, Status: 1},
+			{ID: "2", Price: 2, Status: 1},
+			{ID: "3", Price: 8, Status: 1},
+		}},
+		creatives: map[string][]bidding.BidStrategyCreative{
+			"1": {{StrategyID: 1, CreativeID: 11, Status: 1}},
+			"2": {{StrategyID: 2, CreativeID: 21, Status: 1}},
+			// 已停用的素材关联不参与判断
+			"3": {{StrategyID: 3, CreativeID: 21, Status: 0}},
+		},
+	}
+	engine := bidding.NewEngine(
+		repo,
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{Duration: &mockHistogram{}}},
+	)
+	engine.SetCreativeApprovals(&memoryApprovals{approved: map[string]map[string]bool{
+		"ssp-a": {"21": true},
+		"ssp-b": {},
+	}})
+
+	req := bidding.BidRequest{
+		RequestID: "test-approvals",
+		UserID:    "user-1",
+		Exchange:  "ssp-a",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	}
+	resp, err := engine.ProcessBid(context.Background(), req)
+	if err != nil || resp.AdID != "2" || resp.CreativeID != "21" {
+		t.Fatalf("ProcessBid(ssp-a) = %+v, %v, want AdID 2 with creative 21", resp, err)
+	}
+
+	// 没有审核通过素材的交易平台不出价
+	req.Exchange = "ssp-b"
+	if _, err := engine.ProcessBid(context.Background(), req); !errors.Is(err, bidding.ErrNoAvailableAds) {
+		t.Fatalf("ProcessBid(ssp-b) err = %v, want ErrNoAvailableAds", err)
+	}
+
+	// 不要求审核的交易平台不限制
+	req.Exchange = "ssp-c"
+	resp, err = engine.ProcessBid(context.Background(), req)
+	if err != nil || resp.AdID != "3" || resp.CreativeID != "" {
+		t.Fatalf("ProcessBid(ssp-c) = %+v, %v, want AdID 3 without creative", resp, err)
+	}
+}
+
+func TestEngine_CreativeRotation(t *testing.T) {
+	repo := &creativeRepository{
+		benchRepository: benchRepository{strategies: []bidding.BidStrategy{{ID: "1", Price: 5, Status: 1}}},
+		creatives: map[string][]bidding.BidStrategyCreative{
+			"1": {
+				{StrategyID: 1, CreativeID: 11, Status: 1, Weight: 3},
+				// 权重为0按1处理
+				{StrategyID: 1, CreativeID: 12, Status: 1},
+				// 已暂停的素材不参与轮换
+				{StrategyID: 1, CreativeID: 13, Status: 0, Weight: 5},
+			},
+		},
+	}
+	engine := bidding.NewEngine(
+		repo,
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{Duration: &mockHistogram{}}},
+	)
+
+	counts := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		req := bidding.BidRequest{
+			RequestID: "rotation-" + strconv.Itoa(i),
+			UserID:    "user-1",
+			AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+		}
+		resp, err := engine.ProcessBid(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ProcessBid() err = %v", err)
+		}
+		counts[resp.CreativeID]++
+
+		// 同一请求选择相同的素材
+		again, _ := engine.ProcessBid(context.Background(), req)
+		if again.CreativeID != resp.CreativeID {
+			t.Fatalf("同一请求的素材不一致: %s, %s", resp.CreativeID, again.CreativeID)
+		}
+	}
+	if counts["13"] != 0 || counts["11"]+counts["12"] != 2000 {
+		t.Fatalf("只应轮换启用的素材: %v", counts)
+	}
+	// 按权重3:1分配
+	if share := float64(counts["11"]) / 2000; share < 0.7 || share > 0.8 {
+		t.Errorf("素材11的占比 = %.3f, want ~0.75", share)
+	}
+}
@@ -0,0 +1,74 @@
+package bidding_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/timezone"
+)
+
+// schedule 返回只在loc中now所在小时及下一小时投放的分时设置，避免测试跨越整点时失败
+func schedule(now time.Time, loc *time.Location) string {
+	hours := []byte(strings.Repeat("0", bidding.DaypartingHours))
+	for _, t := range []time.Time{now, now.Add(time.Hour)} {
+		local := t.In(loc)
+		hours[int(local.Weekday())*24+local.Hour()] = '1'
+	}
+	return string(hours)
+}
+
+func TestEngine_Dayparting(t *testing.T) {
+	zones, err := timezone.New(config.TimezoneConfig{
+		Default: "UTC",
+		Advertisers: []config.AdvertiserTimezoneConfig{
+			{AdvertiserID: "adv-1", Timezone: "Asia/Tokyo", Campaigns: []string{"tokyo"}},
+		},
+		Campaigns: []config.CampaignTimezoneConfig{{CampaignID: "la", Timezone: "America/Los_Angeles"}},
+	})
+	if err != nil {
+		t.Fatalf("timezone.New() error = %v", err)
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	now := time.Now()
+
+	// 东京当前时段的分时设置：东京的计划投放，洛杉矶的计划按洛杉矶时间判断，不投放
+	engine, _ := newParticipationEngine([]bidding.BidStrategy{
+		{ID: "la", Price: 8, Status: 1, CampaignID: "la", Dayparting: schedule(now, tokyo)},
+		{ID: "tokyo", Price: 5, Status: 1, CampaignID: "tokyo", Dayparting: schedule(now, tokyo)},
+		{ID: "all-day", Price: 2, Status: 1},
+	})
+	engine.SetTimezones(zones)
+
+	resp, err := engine.ProcessBid(context.Background(), participationRequest("req-1"))
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "tokyo" {
+		t.Fatalf("胜出策略 = %s, want tokyo", resp.AdID)
+	}
+
+	// 所有小时都不投放时只剩全天投放的策略
+	engine, _ = newParticipationEngine([]bidding.BidStrategy{
+		{ID: "off", Price: 8, Status: 1, Dayparting: strings.Repeat("0", bidding.DaypartingHours)},
+		{ID: "all-day", Price: 2, Status: 1},
+	})
+	resp, err = engine.ProcessBid(context.Background(), participationRequest("req-2"))
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "all-day" {
+		t.Fatalf("胜出策略 = %s, want all-day", resp.AdID)
+	}
+
+	// 策略缓存刷新后同步广告所属的推广计划，按广告查找时区
+	if loc := zones.Ad("tokyo"); loc.String() != "Asia/Tokyo" {
+		t.Fatalf("广告tokyo的时区 = %v", loc)
+	}
+	if loc := zones.Ad("all-day"); loc != time.UTC {
+		t.Fatalf("不属于推广计划的广告时区 = %v, want UTC", loc)
+	}
+}
@@ -0,0 +1,123 @@
+package bidding_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// 运行方式: go test ./test/bidding -run '^$' -bench . -benchmem
+
+// benchRepository 返回固定数量出价策略的存储实现
+type benchRepository struct {
+	mockRepository
+	strategies []bidding.BidStrategy
+}
+
+func newBenchRepository(n int) *benchRepository {
+	strategies := make([]bidding.BidStrategy, n)
+	for i := range strategies {
+		strategies[i] = bidding.BidStrategy{
+			ID:      fmt.Sprintf("strategy-%d", i),
+			BidType: "CPM",
+			Price:   1.0 + float64(i%50)/10,
+			Status:  1,
+		}
+	}
+	return &benchRepository{strategies: strategies}
+}
+
+func (m *benchRepository) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	total := int64(len(m.strategies))
+	start := (filter.Page - 1) * filter.PageSize
+	if start >= len(m.strategies) {
+		return nil, total, nil
+	}
+	end := start + filter.PageSize
+	if end > len(m.strategies) {
+		end = len(m.strategies)
+	}
+	return m.strategies[start:end], total, nil
+}
+
+func newBenchEngine(strategies int) *bidding.Engine {
+	return bidding.NewEngine(
+		newBenchRepository(strategies),
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{Duration: &mockHistogram{}}},
+	)
+}
+
+func newBenchRequest(slots int) bidding.BidRequest {
+	req := bidding.BidRequest{
+		RequestID: "bench-request",
+		UserID:    "bench-user",
+		DeviceID:  "bench-device",
+		IP:        "127.0.0.1",
+		AdSlots:   make([]bidding.AdSlot, slots),
+	}
+	for i := range req.AdSlots {
+		req.AdSlots[i] = bidding.AdSlot{
+			SlotID:   fmt.Sprintf("slot-%d", i),
+			Width:    300,
+			Height:   250,
+			MinPrice: 0.5,
+			MaxPrice: 10.0,
+			Position: "banner",
+			AdType:   "display",
+			BidType:  "CPM",
+		}
+	}
+	return req
+}
+
+func BenchmarkEngine_ProcessBid(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("strategies=%d", n), func(b *testing.B) {
+			engine := newBenchEngine(n)
+			req := newBenchRequest(1)
+			ctx := context.Background()
+
+			// 预热策略缓存
+			if _, err := engine.ProcessBid(ctx, req); err != nil {
+				b.Fatalf("ProcessBid() error = %v", err)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.ProcessBid(ctx, req); err != nil {
+					b.Fatalf("ProcessBid() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEngine_ProcessBidParallel(b *testing.B) {
+	engine := newBenchEngine(100)
+	req := newBenchRequest(3)
+	ctx := context.Background()
+
+	if _, err := engine.ProcessBid(ctx, req); err != nil {
+		b.Fatalf("ProcessBid() error = %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := engine.ProcessBid(ctx, req); err != nil {
+				b.Fatalf("ProcessBid() error = %v", err)
+			}
+		}
+	})
+}
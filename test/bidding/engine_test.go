@@ -2,13 +2,16 @@ package bidding_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"simple-dsp/internal/bidding"
 	"simple-dsp/pkg/logger"
 	"simple-dsp/pkg/metrics"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	io_prometheus_client "github.com/prometheus/client_model/go"
 
 	"go.uber.org/zap"
@@ -40,6 +43,9 @@ func (m *mockRepository) AddCreative(ctx context.Context, strategyID int64, crea
 func (m *mockRepository) RemoveCreative(ctx context.Context, strategyID int64, creativeID int64) error {
 	return nil
 }
+func (m *mockRepository) UpdateCreative(ctx context.Context, strategyID int64, creativeID int64, status int, weight float64) error {
+	return nil
+}
 func (m *mockRepository) ListCreatives(ctx context.Context, strategyID string) ([]bidding.BidStrategyCreative, error) {
 	return nil, nil
 }
@@ -57,12 +63,8 @@ func (m *mockBudgetManager) CheckAndDeduct(ctx context.Context, budgetID string,
 // mockFreqCtrl 实现 bidding.FrequencyController
 type mockFreqCtrl struct{}
 
-func (m *mockFreqCtrl) CheckImpression(ctx context.Context, userID, adID string) (bool, error) {
-	return true, nil
-}
-
-func (m *mockFreqCtrl) RecordImpression(ctx context.Context, userID, adID string) error {
-	return nil
+func (m *mockFreqCtrl) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	return 1, true, nil
 }
 
 // mockHistogram 实现 prometheus.Histogram、prometheus.Metric、prometheus.Collector
@@ -138,3 +140,98 @@ func TestEngine_ProcessBid(t *testing.T) {
 		})
 	}
 }
+
+func TestEngine_ProcessBidTimeout(t *testing.T) {
+	stageTimeouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_stage_timeouts_total",
+	}, []string{"stage"})
+	engine := bidding.NewEngine(
+		&mockRepository{},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration:      &mockHistogram{},
+			StageTimeouts: stageTimeouts,
+		}},
+	)
+
+	// 已超过截止时间的上下文
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Millisecond)
+	defer cancel()
+
+	_, err := engine.ProcessBid(ctx, bidding.BidRequest{
+		RequestID: "test-timeout",
+		UserID:    "user-timeout",
+		AdSlots: []bidding.AdSlot{
+			{SlotID: "slot-1", MinPrice: 1.0, MaxPrice: 10.0},
+			{SlotID: "slot-2", MinPrice: 1.0, MaxPrice: 10.0},
+		},
+	})
+	if !errors.Is(err, bidding.ErrBidTimeout) {
+		t.Errorf("ProcessBid() error = %v, want %v", err, bidding.ErrBidTimeout)
+	}
+	// 每个请求只计一次超时，不按广告位重复计数
+	if got := testutil.CollectAndCount(stageTimeouts); got != 1 {
+		t.Errorf("超时阶段数 = %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(stageTimeouts.WithLabelValues("auction")); got != 1 {
+		t.Errorf("auction超时次数 = %v, want 1", got)
+	}
+}
+
+// slowBudgets 检查部分策略的余额时阻塞，模拟候选生成变慢
+type slowBudgets struct {
+	mockBudgetManager
+	slow  map[string]bool
+	delay time.Duration
+}
+
+func (m *slowBudgets) HasBudget(budgetID string, amount float64) bool {
+	if m.slow[budgetID] {
+		time.Sleep(m.delay)
+	}
+	return true
+}
+
+func TestEngine_ProcessBidSlowStrategy(t *testing.T) {
+	stageTimeouts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_stage_timeouts_total",
+	}, []string{"stage"})
+	budgets := &slowBudgets{slow: map[string]bool{"slow-1": true, "slow-2": true, "slow-3": true}, delay: 150 * time.Millisecond}
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: []bidding.BidStrategy{
+			{ID: "fast", Price: 2, Status: 1},
+			{ID: "slow-1", Price: 1, Status: 1},
+			{ID: "slow-2", Price: 1, Status: 1},
+			{ID: "slow-3", Price: 1, Status: 1},
+		}},
+		budgets,
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration:      &mockHistogram{},
+			StageTimeouts: stageTimeouts,
+		}},
+	)
+	engine.SetCheckReserve(200 * time.Millisecond)
+
+	// 候选生成在截止前200ms结束，已就绪的候选仍有时间完成最终检查
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+
+	resp, err := engine.ProcessBid(ctx, bidding.BidRequest{
+		RequestID: "test-slow",
+		UserID:    "user-slow",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v, want 快速策略出价", err)
+	}
+	if resp.AdID != "fast" {
+		t.Errorf("AdID = %s, want fast", resp.AdID)
+	}
+	if got := testutil.ToFloat64(stageTimeouts.WithLabelValues("targeting")); got != 1 {
+		t.Errorf("targeting超时次数 = %v, want 1", got)
+	}
+}
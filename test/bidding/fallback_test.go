@@ -0,0 +1,230 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryBudgets 按策略记录余额的预算管理，实现bidding.BudgetChecker
+type memoryBudgets struct {
+	remaining map[string]float64
+	deducted  []string
+}
+
+func (m *memoryBudgets) HasBudget(budgetID string, amount float64) bool {
+	return m.remaining[budgetID] >= amount
+}
+
+func (m *memoryBudgets) CheckAndDeduct(ctx context.Context, budgetID string, amount float64) (bool, error) {
+	if m.remaining[budgetID] < amount {
+		return false, errors.New("预算不足")
+	}
+	m.remaining[budgetID] -= amount
+	m.deducted = append(m.deducted, budgetID)
+	return true, nil
+}
+
+// memoryFrequency 按策略决定频次是否超限
+type memoryFrequency struct {
+	exceeded map[string]bool
+	acquired []string
+}
+
+func (m *memoryFrequency) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	if m.exceeded[adID] {
+		return 0, false, nil
+	}
+	m.acquired = append(m.acquired, adID)
+	return 1, true, nil
+}
+
+func newFallbackEngine(strategies []bidding.BidStrategy, budgets bidding.BudgetManager, freq bidding.FrequencyController) (*bidding.Engine, *prometheus.CounterVec) {
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_candidate_rejections_total",
+	}, []string{"stage", "reason"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: strategies},
+		budgets,
+		freq,
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration: &mockHistogram{},
+			Preemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_preemptions_total",
+			}, []string{"priority"}),
+			Rejections: rejections,
+		}},
+	)
+	return engine, rejections
+}
+
+var fallbackRequest = bidding.BidRequest{
+	RequestID: "test-fallback",
+	UserID:    "user-1",
+	AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+}
+
+// fallbackStrategies 出价依次递减的策略，不考虑检查时1胜出
+var fallbackStrategies = []bidding.BidStrategy{
+	{ID: "1", Price: 5, Status: 1},
+	{ID: "2", Price: 4, Status: 1},
+	{ID: "3", Price: 3, Status: 1},
+	{ID: "4", Price: 2, Status: 1},
+}
+
+func TestEngine_BudgetPrefilter(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 1, "2": 100, "3": 100, "4": 100}}
+	engine, rejections := newFallbackEngine(fallbackStrategies, budgets, &mockFreqCtrl{})
+
+	resp, err := engine.ProcessBid(context.Background(), fallbackRequest)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "2" {
+		t.Errorf("AdID = %s, want 2", resp.AdID)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("prefilter", "budget")); got != 1 {
+		t.Errorf("排序前过滤次数 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("final", "budget")); got != 0 {
+		t.Errorf("最终检查淘汰次数 = %v, want 0", got)
+	}
+}
+
+func TestEngine_WinnerFallback(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+	freq := &memoryFrequency{exceeded: map[string]bool{"1": true}}
+	engine, rejections := newFallbackEngine(fallbackStrategies, budgets, freq)
+
+	// 胜出候选频次超限时回退到下一个候选
+	resp, err := engine.ProcessBid(context.Background(), fallbackRequest)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "2" {
+		t.Errorf("AdID = %s, want 2", resp.AdID)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("final", "frequency")); got != 1 {
+		t.Errorf("频次淘汰次数 = %v, want 1", got)
+	}
+	// 频次超限的候选在扣减预算前被淘汰，消耗不变
+	if len(budgets.deducted) != 1 || budgets.deducted[0] != "2" {
+		t.Errorf("deducted = %v, want [2]", budgets.deducted)
+	}
+	if budgets.remaining["1"] != 100 {
+		t.Errorf("频次超限的策略余额 = %v, want 100", budgets.remaining["1"])
+	}
+}
+
+func TestEngine_BudgetRejectionAfterFrequency(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+	freq := &memoryFrequency{}
+	// 排序前的余额检查通过，扣减时预算不足
+	engine, rejections := newFallbackEngine(fallbackStrategies, &racingBudgets{memoryBudgets: budgets, drained: "1"}, freq)
+
+	resp, err := engine.ProcessBid(context.Background(), fallbackRequest)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "2" {
+		t.Errorf("AdID = %s, want 2", resp.AdID)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("final", "budget")); got != 1 {
+		t.Errorf("预算淘汰次数 = %v, want 1", got)
+	}
+	// 先占用曝光再扣减预算
+	if len(freq.acquired) != 2 || freq.acquired[0] != "1" {
+		t.Errorf("acquired = %v, want [1 2]", freq.acquired)
+	}
+}
+
+// racingBudgets 排序前的余额检查总是通过，drained策略扣减时预算不足，模拟并发请求耗尽预算
+// err非空时drained策略扣减返回该错误，模拟预算服务异常或超时
+type racingBudgets struct {
+	*memoryBudgets
+	drained string
+	err     error
+}
+
+func (m *racingBudgets) HasBudget(budgetID string, amount float64) bool {
+	return true
+}
+
+func (m *racingBudgets) CheckAndDeduct(ctx context.Context, budgetID string, amount float64) (bool, error) {
+	if budgetID == m.drained {
+		return false, m.err
+	}
+	return m.memoryBudgets.CheckAndDeduct(ctx, budgetID, amount)
+}
+
+func TestEngine_WinnerFallbackLimit(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+	freq := &memoryFrequency{exceeded: map[string]bool{"1": true, "2": true, "3": true}}
+	engine, rejections := newFallbackEngine(fallbackStrategies, budgets, freq)
+
+	// 最多尝试3个候选，第4个候选不再参与
+	_, err := engine.ProcessBid(context.Background(), fallbackRequest)
+	if !errors.Is(err, bidding.ErrNoAvailableAds) {
+		t.Fatalf("err = %v, want ErrNoAvailableAds", err)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("final", "frequency")); got != 3 {
+		t.Errorf("频次淘汰次数 = %v, want 3", got)
+	}
+}
+
+// releasingFrequency 记录归还的曝光，归还在后台进行
+type releasingFrequency struct {
+	memoryFrequency
+	released chan string
+}
+
+func (m *releasingFrequency) ReleaseImpression(ctx context.Context, userID, adID string) error {
+	m.released <- adID
+	return nil
+}
+
+func TestEngine_BudgetRejectionReleasesImpression(t *testing.T) {
+	cases := map[string]error{
+		"预算不足": nil,
+		"扣减超时": context.DeadlineExceeded,
+	}
+	for name, deductErr := range cases {
+		t.Run(name, func(t *testing.T) {
+			budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+			freq := &releasingFrequency{released: make(chan string, 4)}
+			engine, _ := newFallbackEngine(fallbackStrategies, &racingBudgets{memoryBudgets: budgets, drained: "1", err: deductErr}, freq)
+
+			resp, err := engine.ProcessBid(context.Background(), fallbackRequest)
+			if err != nil {
+				t.Fatalf("ProcessBid() error = %v", err)
+			}
+			if resp.AdID != "2" {
+				t.Errorf("AdID = %s, want 2", resp.AdID)
+			}
+			// 未能扣减预算的候选归还占用的曝光，胜出的候选不归还
+			select {
+			case adID := <-freq.released:
+				if adID != "1" {
+					t.Errorf("归还的曝光 = %s, want 1", adID)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("预算扣减失败后未归还曝光")
+			}
+			select {
+			case adID := <-freq.released:
+				t.Errorf("多余的归还 %s", adID)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
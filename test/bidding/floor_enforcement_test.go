@@ -0,0 +1,145 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// floorStrategies 属于不同推广计划、出价依次递减的策略
+var floorStrategies = []bidding.BidStrategy{
+	{ID: "1", CampaignID: "c1", Price: 5, Status: 1},
+	{ID: "2", CampaignID: "c2", Price: 4, Status: 1},
+	{ID: "3", CampaignID: "c2", Price: 3, Status: 1},
+}
+
+func newFloorEngine(policy *bidding.FloorPolicy) (*bidding.Engine, *prometheus.CounterVec) {
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_floor_rejections_total",
+	}, []string{"exchange", "campaign", "reason"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: floorStrategies},
+		&memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100}},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration: &mockHistogram{},
+			Preemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_preemptions_total",
+			}, []string{"priority"}),
+			Rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_candidate_rejections_total",
+			}, []string{"stage", "reason"}),
+			FloorRejections: rejections,
+		}},
+	)
+	if policy != nil {
+		engine.SetFloorPolicy(policy)
+	}
+	return engine, rejections
+}
+
+func floorRequest(slots ...bidding.AdSlot) bidding.BidRequest {
+	return bidding.BidRequest{RequestID: "test-floor", UserID: "user-1", Exchange: "adx", AdSlots: slots}
+}
+
+func TestEngine_FloorEnforcement(t *testing.T) {
+	engine, rejections := newFloorEngine(nil)
+
+	// 底价高于策略1以外所有出价，低于底价的候选在排序前过滤
+	resps, err := engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MinPrice: 4.5, MaxPrice: 10},
+		bidding.AdSlot{SlotID: "slot-2", MinPrice: 4.5, MaxPrice: 10},
+	))
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+	if len(resps) != 1 || resps[0].SlotID != "slot-1" || resps[0].AdID != "1" {
+		t.Fatalf("resps = %+v, want slot-1/1", resps)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("adx", "c2", "below_floor")); got != 4 {
+		t.Errorf("c2底价淘汰次数 = %v, want 4", got)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("adx", "c1", "below_floor")); got != 0 {
+		t.Errorf("c1底价淘汰次数 = %v, want 0", got)
+	}
+}
+
+func TestEngine_FloorEnforcementOff(t *testing.T) {
+	engine, rejections := newFloorEngine(bidding.NewFloorPolicy(bidding.FloorModeOff, "", ""))
+
+	resps, err := engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MinPrice: 8, MaxPrice: 10},
+	))
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+	if len(resps) != 1 || resps[0].AdID != "1" {
+		t.Fatalf("resps = %+v, want 1", resps)
+	}
+	if got := testutil.CollectAndCount(rejections); got != 0 {
+		t.Errorf("底价淘汰指标数 = %d, want 0", got)
+	}
+}
+
+func TestEngine_FloorCurrency(t *testing.T) {
+	policy := bidding.NewFloorPolicy(bidding.FloorModeHard, "USD", bidding.FloorUnknownSkip)
+	policy.SetRate("cny", 0.1)
+	engine, rejections := newFloorEngine(policy)
+
+	// 45元底价折合4.5美元，只有策略1达到底价
+	resps, err := engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MinPrice: 45, MaxPrice: 100, Currency: "CNY"},
+	))
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+	if len(resps) != 1 || resps[0].AdID != "1" {
+		t.Fatalf("resps = %+v, want 1", resps)
+	}
+
+	// 最高价同样换算，30元折合3美元
+	resps, err = engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MaxPrice: 30, Currency: "cny"},
+	))
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+	if len(resps) != 1 || resps[0].AdID != "3" {
+		t.Fatalf("resps = %+v, want 3", resps)
+	}
+
+	// 没有汇率的货币不参与该广告位的竞价
+	_, err = engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MinPrice: 1, MaxPrice: 100, Currency: "JPY"},
+	))
+	if !errors.Is(err, bidding.ErrNoAvailableAds) {
+		t.Fatalf("err = %v, want ErrNoAvailableAds", err)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("adx", "", "unknown_currency")); got != 1 {
+		t.Errorf("未知货币淘汰次数 = %v, want 1", got)
+	}
+}
+
+func TestEngine_FloorUnknownCurrencySystem(t *testing.T) {
+	engine, _ := newFloorEngine(bidding.NewFloorPolicy(bidding.FloorModeHard, "USD", bidding.FloorUnknownSystem))
+
+	// 没有汇率的货币按系统货币处理
+	resps, err := engine.ProcessBids(context.Background(), floorRequest(
+		bidding.AdSlot{SlotID: "slot-1", MinPrice: 3.5, MaxPrice: 4.5, Currency: "JPY"},
+	))
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+	if len(resps) != 1 || resps[0].AdID != "2" {
+		t.Fatalf("resps = %+v, want 2", resps)
+	}
+}
@@ -0,0 +1,130 @@
+package bidding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/floor"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func newFloorTracker(minSamples int64) *floor.Tracker {
+	return floor.NewTracker(
+		config.FloorConfig{Enabled: true, MinSamples: minSamples, MaxOverbidRatio: 2},
+		nil,
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			FloorAdjustments: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_floor_adjustments_total",
+			}, []string{"exchange", "action"}),
+		}},
+	)
+}
+
+func TestTracker_AdjustBid(t *testing.T) {
+	slot := bidding.AdSlot{SlotID: "slot-1", Width: 300, Height: 250}
+
+	tests := []struct {
+		name      string
+		prepare   func(tracker *floor.Tracker)
+		slot      bidding.AdSlot
+		price     float64
+		wantPrice float64
+		wantOK    bool
+	}{
+		{
+			name:      "无统计数据时不调整",
+			slot:      slot,
+			price:     5,
+			wantPrice: 5,
+			wantOK:    true,
+		},
+		{
+			name:   "低于声明底价不出价",
+			slot:   bidding.AdSlot{SlotID: "slot-1", Width: 300, Height: 250, MinPrice: 6},
+			price:  5,
+			wantOK: false,
+		},
+		{
+			name: "未声明底价时参考历史平均底价",
+			prepare: func(tracker *floor.Tracker) {
+				tracker.ObserveRequest("adx", bidding.AdSlot{SlotID: "slot-1", Width: 300, Height: 250, MinPrice: 4})
+				tracker.ObserveRequest("adx", bidding.AdSlot{SlotID: "slot-1", Width: 300, Height: 250, MinPrice: 8})
+			},
+			slot:   slot,
+			price:  5,
+			wantOK: false,
+		},
+		{
+			name: "成交样本充足时限制过高出价",
+			prepare: func(tracker *floor.Tracker) {
+				tracker.ObserveWin("adx", "slot-1", "300x250", 1)
+				tracker.ObserveWin("adx", "slot-1", "300x250", 3)
+			},
+			slot:      slot,
+			price:     10,
+			wantPrice: 4,
+			wantOK:    true,
+		},
+		{
+			name: "成交样本不足时不限制",
+			prepare: func(tracker *floor.Tracker) {
+				tracker.ObserveWin("adx", "slot-1", "300x250", 2)
+			},
+			slot:      slot,
+			price:     10,
+			wantPrice: 10,
+			wantOK:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newFloorTracker(2)
+			if tt.prepare != nil {
+				tt.prepare(tracker)
+			}
+			price, ok := tracker.AdjustBid("adx", tt.slot, tt.price)
+			if ok != tt.wantOK {
+				t.Fatalf("AdjustBid() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && price != tt.wantPrice {
+				t.Errorf("AdjustBid() price = %v, want %v", price, tt.wantPrice)
+			}
+		})
+	}
+}
+
+func TestTracker_Query(t *testing.T) {
+	tracker := newFloorTracker(1)
+	slot := bidding.AdSlot{SlotID: "slot-1", Width: 300, Height: 250, MinPrice: 2}
+	for i := 0; i < 4; i++ {
+		tracker.ObserveRequest("adx", slot)
+	}
+	tracker.ObserveBid("adx", slot, 3)
+	tracker.ObserveBid("adx", slot, 5)
+	tracker.ObserveWin("adx", "slot-1", "300x250", 2.5)
+	tracker.ObserveRequest("other", bidding.AdSlot{SlotID: "slot-2", Width: 320, Height: 50})
+
+	stats, err := tracker.Query(context.Background(), floor.Filter{Exchange: "adx"})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("Query() 返回 %d 条，期望 1 条", len(stats))
+	}
+
+	got := stats[0]
+	if got.Requests != 4 || got.Bids != 2 || got.Wins != 1 {
+		t.Errorf("计数错误: %+v", got)
+	}
+	if got.AvgFloor != 2 || got.AvgBidPrice != 4 || got.AvgWinPrice != 2.5 || got.WinRate != 0.5 {
+		t.Errorf("统计值错误: %+v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"simple-dsp/internal/bidding"
+)
+
+func TestEngine_ProcessBids(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+	engine, _ := newFallbackEngine(fallbackStrategies, budgets, &mockFreqCtrl{})
+
+	req := bidding.BidRequest{
+		RequestID: "test-multi-slot",
+		UserID:    "user-1",
+		AdSlots: []bidding.AdSlot{
+			{SlotID: "slot-1", MaxPrice: 10},
+			{SlotID: "slot-2", MaxPrice: 1}, // 所有策略出价都超过最高价
+			{SlotID: "slot-3", MaxPrice: 10},
+			{SlotID: "slot-4", MaxPrice: 3.5},
+		},
+	}
+	resps, err := engine.ProcessBids(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProcessBids() error = %v", err)
+	}
+
+	// 每个广告位独立出价，已胜出的策略不再参与其他广告位
+	want := map[string]string{"slot-1": "1", "slot-3": "2", "slot-4": "3"}
+	if len(resps) != len(want) {
+		t.Fatalf("len(resps) = %d, want %d", len(resps), len(want))
+	}
+	for _, resp := range resps {
+		if want[resp.SlotID] != resp.AdID {
+			t.Errorf("%s AdID = %s, want %s", resp.SlotID, resp.AdID, want[resp.SlotID])
+		}
+	}
+	if len(budgets.deducted) != 3 {
+		t.Errorf("deducted = %v, want 3 deductions", budgets.deducted)
+	}
+}
+
+func TestEngine_ProcessBidSingleSlot(t *testing.T) {
+	budgets := &memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100, "4": 100}}
+	engine, _ := newFallbackEngine(fallbackStrategies, budgets, &mockFreqCtrl{})
+
+	// ProcessBid只返回第一个出价的广告位，不为其他广告位扣减预算
+	resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+		RequestID: "test-single-slot",
+		UserID:    "user-1",
+		AdSlots: []bidding.AdSlot{
+			{SlotID: "slot-1", MaxPrice: 10},
+			{SlotID: "slot-2", MaxPrice: 10},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.SlotID != "slot-1" || resp.AdID != "1" {
+		t.Errorf("ProcessBid() = %s/%s, want slot-1/1", resp.SlotID, resp.AdID)
+	}
+	if len(budgets.deducted) != 1 {
+		t.Errorf("deducted = %v, want 1 deduction", budgets.deducted)
+	}
+}
+
+func TestEngine_ProcessBidsNoWinner(t *testing.T) {
+	engine, _ := newFallbackEngine(fallbackStrategies, &mockBudgetManager{}, &mockFreqCtrl{})
+
+	_, err := engine.ProcessBids(context.Background(), bidding.BidRequest{
+		RequestID: "test-no-winner",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 1}},
+	})
+	if !errors.Is(err, bidding.ErrNoAvailableAds) {
+		t.Fatalf("err = %v, want ErrNoAvailableAds", err)
+	}
+}
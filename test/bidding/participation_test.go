@@ -0,0 +1,119 @@
+package bidding_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func newParticipationEngine(strategies []bidding.BidStrategy) (*bidding.Engine, *prometheus.CounterVec) {
+	throttled := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_throttled_total",
+	}, []string{"level"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: strategies},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration:  &mockHistogram{},
+			Throttled: throttled,
+		}},
+	)
+	return engine, throttled
+}
+
+func participationRequest(requestID string) bidding.BidRequest {
+	return bidding.BidRequest{
+		RequestID: requestID,
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	}
+}
+
+func TestEngine_StrategyParticipation(t *testing.T) {
+	engine, throttled := newParticipationEngine([]bidding.BidStrategy{
+		{ID: "1", Price: 5, Status: 1, Participation: 0.3},
+		{ID: "2", Price: 2, Status: 1},
+	})
+
+	const requests = 10000
+	won := 0
+	for i := 0; i < requests; i++ {
+		req := participationRequest(fmt.Sprintf("req-%d", i))
+		resp, err := engine.ProcessBid(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ProcessBid() error = %v", err)
+		}
+		if resp.AdID == "1" {
+			won++
+		}
+
+		// 同一请求的抽样结果不变
+		again, err := engine.ProcessBid(context.Background(), req)
+		if err != nil {
+			t.Fatalf("ProcessBid() error = %v", err)
+		}
+		if again.AdID != resp.AdID {
+			t.Fatalf("请求%s两次竞价结果不同: %s, %s", req.RequestID, resp.AdID, again.AdID)
+		}
+	}
+
+	if rate := float64(won) / requests; rate < 0.28 || rate > 0.32 {
+		t.Errorf("策略1参与率 = %v, want 0.3±0.02", rate)
+	}
+	if got := testutil.ToFloat64(throttled.WithLabelValues("strategy")); got != float64(2*(requests-won)) {
+		t.Errorf("策略抽样未参与次数 = %v, want %v", got, 2*(requests-won))
+	}
+}
+
+func TestEngine_AdvertiserParticipation(t *testing.T) {
+	engine, throttled := newParticipationEngine([]bidding.BidStrategy{
+		{ID: "1", CampaignID: "c1", Price: 5, Status: 1},
+		{ID: "2", CampaignID: "c2", Price: 4, Status: 1},
+		{ID: "3", CampaignID: "c3", Price: 2, Status: 1},
+	})
+	policy := bidding.NewParticipationPolicy()
+	policy.SetAdvertiser("adv-1", 0.5, []string{"c1", "c2"})
+	engine.SetParticipationPolicy(policy)
+
+	const requests = 2000
+	won := 0
+	for i := 0; i < requests; i++ {
+		resp, err := engine.ProcessBids(context.Background(), bidding.BidRequest{
+			RequestID: fmt.Sprintf("req-%d", i),
+			UserID:    "user-1",
+			AdSlots: []bidding.AdSlot{
+				{SlotID: "slot-1", MaxPrice: 10},
+				{SlotID: "slot-2", MaxPrice: 10},
+			},
+		})
+		if err != nil {
+			t.Fatalf("ProcessBids() error = %v", err)
+		}
+
+		// 广告主的策略一起参与或不参与，未限制的广告主总是参与
+		switch {
+		case len(resp) == 2 && resp[0].AdID == "1" && resp[1].AdID == "2":
+			won++
+		case len(resp) == 1 && resp[0].AdID == "3":
+		default:
+			t.Fatalf("请求req-%d的出价不符合广告主参与率: %v", i, resp)
+		}
+	}
+
+	if rate := float64(won) / requests; rate < 0.45 || rate > 0.55 {
+		t.Errorf("广告主参与率 = %v, want 0.5±0.05", rate)
+	}
+	if got := testutil.ToFloat64(throttled.WithLabelValues("advertiser")); got != float64(2*(requests-won)) {
+		t.Errorf("广告主抽样未参与次数 = %v, want %v", got, 2*(requests-won))
+	}
+}
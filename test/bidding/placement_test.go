@@ -0,0 +1,108 @@
+package bidding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// fixedPlacementAdvisor 按固定系数调整出价，记录调整的广告位
+type fixedPlacementAdvisor struct {
+	multiplier float64
+	slots      []string
+}
+
+func (a *fixedPlacementAdvisor) AdjustBid(exchange string, slot bidding.AdSlot, price float64) float64 {
+	a.slots = append(a.slots, exchange+"/"+slot.SlotID)
+	return price * a.multiplier
+}
+
+func newPlacementEngine(strategy bidding.BidStrategy, advisor bidding.PlacementAdvisor) (*bidding.Engine, *prometheus.CounterVec) {
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_floor_rejections_total",
+	}, []string{"exchange", "campaign", "reason"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: []bidding.BidStrategy{strategy}},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration:        &mockHistogram{},
+			FloorRejections: rejections,
+		}},
+	)
+	engine.SetPlacementAdvisor(advisor)
+	return engine, rejections
+}
+
+func TestEngine_PlacementAdvisor(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  bidding.BidStrategy
+		wantPrice float64
+		wantCalls int
+	}{
+		{
+			name:      "按供应路径调整出价",
+			strategy:  bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			wantPrice: 2.5,
+			wantCalls: 1,
+		},
+		{
+			name:      "锁价策略不调整",
+			strategy:  bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1, IsPriceLocked: true},
+			wantPrice: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advisor := &fixedPlacementAdvisor{multiplier: 1.25}
+			engine, _ := newPlacementEngine(tt.strategy, advisor)
+
+			resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+				RequestID: "test-placement",
+				UserID:    "user-1",
+				Exchange:  "adx",
+				AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", Width: 300, Height: 250, MaxPrice: 10}},
+			})
+			if err != nil {
+				t.Fatalf("ProcessBid() error = %v", err)
+			}
+			if resp.BidPrice != tt.wantPrice {
+				t.Errorf("ProcessBid() BidPrice = %v, want %v", resp.BidPrice, tt.wantPrice)
+			}
+			if len(advisor.slots) != tt.wantCalls {
+				t.Fatalf("调整次数 = %d, want %d", len(advisor.slots), tt.wantCalls)
+			}
+			if tt.wantCalls > 0 && advisor.slots[0] != "adx/slot-1" {
+				t.Errorf("调整的广告位 = %s", advisor.slots[0])
+			}
+		})
+	}
+}
+
+func TestEngine_PlacementAdvisorPriceRange(t *testing.T) {
+	// 调整后的出价低于请求底价时不参与竞价
+	engine, rejections := newPlacementEngine(bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1}, &fixedPlacementAdvisor{multiplier: 0.5})
+
+	_, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+		RequestID: "test-placement-range",
+		UserID:    "user-1",
+		Exchange:  "adx",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MinPrice: 1.5, MaxPrice: 10}},
+	})
+	if err != bidding.ErrNoAvailableAds {
+		t.Errorf("ProcessBid() error = %v, want %v", err, bidding.ErrNoAvailableAds)
+	}
+	if got := testutil.CollectAndCount(rejections); got != 1 {
+		t.Errorf("应按请求底价淘汰调整后的出价, got %d", got)
+	}
+}
@@ -0,0 +1,90 @@
+package bidding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func TestEngine_PriorityTiers(t *testing.T) {
+	tests := []struct {
+		name           string
+		strategies     []bidding.BidStrategy
+		wantAdID       string
+		wantPreemption float64
+	}{
+		{
+			name: "同优先级按eCPM排序",
+			strategies: []bidding.BidStrategy{
+				{ID: "1", Price: 2, Status: 1},
+				{ID: "2", Price: 3, Status: 1},
+			},
+			wantAdID: "2",
+		},
+		{
+			name: "保量投放抢占公开竞价",
+			strategies: []bidding.BidStrategy{
+				{ID: "1", Price: 5, Status: 1},
+				{ID: "2", Price: 2, Status: 1, Priority: bidding.PriorityGuaranteed},
+			},
+			wantAdID:       "2",
+			wantPreemption: 1,
+		},
+		{
+			name: "同优先级按权重加权",
+			strategies: []bidding.BidStrategy{
+				{ID: "1", Price: 3, Status: 1},
+				{ID: "2", Price: 2, Status: 1, Weight: 2},
+			},
+			wantAdID: "2",
+		},
+		{
+			name: "加权eCPM相同时ID较小的胜出",
+			strategies: []bidding.BidStrategy{
+				{ID: "10", Price: 2, Status: 1},
+				{ID: "9", Price: 2, Status: 1},
+			},
+			wantAdID: "9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			preemptions := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_preemptions_total",
+			}, []string{"priority"})
+			engine := bidding.NewEngine(
+				&benchRepository{strategies: tt.strategies},
+				&mockBudgetManager{},
+				&mockFreqCtrl{},
+				logger.NewLogger(zap.NewNop()),
+				&metrics.Metrics{Bid: &metrics.BidMetrics{
+					Duration:    &mockHistogram{},
+					Preemptions: preemptions,
+				}},
+			)
+
+			resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+				RequestID: "test-priority",
+				UserID:    "user-1",
+				AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+			})
+			if err != nil {
+				t.Fatalf("ProcessBid() error = %v", err)
+			}
+			if resp.AdID != tt.wantAdID {
+				t.Errorf("ProcessBid() AdID = %s, want %s", resp.AdID, tt.wantAdID)
+			}
+			if got := testutil.ToFloat64(preemptions.WithLabelValues("2")); got != tt.wantPreemption {
+				t.Errorf("抢占次数 = %v, want %v", got, tt.wantPreemption)
+			}
+		})
+	}
+}
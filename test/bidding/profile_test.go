@@ -0,0 +1,173 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/profile"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/reqctx"
+)
+
+// memoryProfiles 内存用户特征
+type memoryProfiles struct {
+	profiles map[string]*profile.Profile
+	err      error
+	calls    int
+}
+
+func (m *memoryProfiles) Profile(ctx context.Context, userID string) (*profile.Profile, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	p, ok := m.profiles[userID]
+	if !ok {
+		return nil, profile.ErrProfileNotFound
+	}
+	return p, nil
+}
+
+func newProfileEngine(strategies []bidding.BidStrategy, profiles bidding.UserProfiles) (*bidding.Engine, *prometheus.CounterVec) {
+	lookups := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_profile_lookups_total",
+	}, []string{"result"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: strategies},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration: &mockHistogram{},
+			Preemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_preemptions_total",
+			}, []string{"priority"}),
+			ProfileLookups: lookups,
+			Rejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_candidate_rejections_total",
+			}, []string{"stage", "reason"}),
+		}},
+	)
+	engine.SetUserProfiles(profiles)
+	return engine, lookups
+}
+
+func TestEngine_ProfileAdjustsCTR(t *testing.T) {
+	// 两个策略出价相同，默认CTR下ID较小的1胜出
+	strategies := []bidding.BidStrategy{
+		{ID: "1", Price: 2, Status: 1, Category: "game"},
+		{ID: "2", Price: 2, Status: 1, Category: "shopping"},
+	}
+	profiles := &memoryProfiles{profiles: map[string]*profile.Profile{
+		"user-1": {
+			UserID: "user-1",
+			Categories: map[string]*profile.Counter{
+				"game":     {Impressions: 200},
+				"shopping": {Impressions: 50, Clicks: 10, LastClick: time.Now()},
+			},
+		},
+	}}
+	engine, lookups := newProfileEngine(strategies, profiles)
+
+	req := bidding.BidRequest{
+		RequestID: "test-profile",
+		UserID:    "user-1",
+		AdSlots: []bidding.AdSlot{
+			{SlotID: "slot-1", MaxPrice: 10},
+			{SlotID: "slot-2", MaxPrice: 10},
+		},
+	}
+	resp, err := engine.ProcessBid(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "2" {
+		t.Fatalf("AdID = %s, want 2", resp.AdID)
+	}
+	if profiles.calls != 1 {
+		t.Fatalf("calls = %d, 每个请求应只读取一次用户特征", profiles.calls)
+	}
+	if n := testutil.ToFloat64(lookups.WithLabelValues("hit")); n != 1 {
+		t.Fatalf("hit = %v, want 1", n)
+	}
+
+	// 没有特征的用户使用默认CTR
+	req.UserID = "user-2"
+	resp, err = engine.ProcessBid(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "1" {
+		t.Fatalf("AdID = %s, want 1", resp.AdID)
+	}
+	if n := testutil.ToFloat64(lookups.WithLabelValues("miss")); n != 1 {
+		t.Fatalf("miss = %v, want 1", n)
+	}
+}
+
+func TestEngine_ProfileErrorFallsBack(t *testing.T) {
+	strategies := []bidding.BidStrategy{{ID: "1", Price: 2, Status: 1}}
+	engine, lookups := newProfileEngine(strategies, &memoryProfiles{err: errors.New("redis down")})
+
+	resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+		RequestID: "test-profile-error",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	})
+	if err != nil {
+		t.Fatalf("读取特征失败不应影响竞价: %v", err)
+	}
+	if resp.AdID != "1" {
+		t.Fatalf("AdID = %s, want 1", resp.AdID)
+	}
+	if n := testutil.ToFloat64(lookups.WithLabelValues("error")); n != 1 {
+		t.Fatalf("error = %v, want 1", n)
+	}
+}
+
+func TestEngine_ProfileSkippedWithoutConsent(t *testing.T) {
+	strategies := []bidding.BidStrategy{
+		{ID: "1", Price: 2, Status: 1, Category: "game"},
+		{ID: "2", Price: 2, Status: 1, Category: "shopping"},
+	}
+	userProfile := &profile.Profile{
+		UserID: "user-1",
+		Categories: map[string]*profile.Counter{
+			"shopping": {Impressions: 50, Clicks: 10, LastClick: time.Now()},
+		},
+	}
+	profiles := &memoryProfiles{profiles: map[string]*profile.Profile{"user-1": userProfile}}
+	engine, lookups := newProfileEngine(strategies, profiles)
+
+	// 用户选择退出出售，不读取用户特征，按默认CTR由ID较小的1胜出
+	ctx := reqctx.WithConsent(context.Background(), reqctx.Consent{USPrivacy: "1YYN"})
+	req := bidding.BidRequest{
+		RequestID: "test-profile-consent",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	}
+	resp, err := engine.ProcessBid(ctx, req)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "1" || profiles.calls != 0 {
+		t.Fatalf("AdID = %s, calls = %d, want 1, 0", resp.AdID, profiles.calls)
+	}
+
+	// 调用方已读取的特征同样不使用
+	req.Profile, req.ProfileLoaded = userProfile, true
+	if resp, err = engine.ProcessBid(ctx, req); err != nil || resp.AdID != "1" {
+		t.Fatalf("ProcessBid() = %v, %v, want AdID 1", resp, err)
+	}
+	if n := testutil.ToFloat64(lookups.WithLabelValues("no_consent")); n != 2 {
+		t.Fatalf("no_consent = %v, want 2", n)
+	}
+}
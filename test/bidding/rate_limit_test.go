@@ -0,0 +1,58 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"simple-dsp/internal/bidding"
+)
+
+// memoryLimiter 按广告计数的QPS限制，allowed为每个广告允许的竞价次数
+type memoryLimiter struct {
+	allowed map[string]int
+	calls   []string
+	err     error
+}
+
+func (m *memoryLimiter) Allow(ctx context.Context, adID, campaignID string) (bool, error) {
+	m.calls = append(m.calls, adID+"/"+campaignID)
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.allowed[adID] <= 0 {
+		return false, nil
+	}
+	m.allowed[adID]--
+	return true, nil
+}
+
+func TestEngine_RateLimit(t *testing.T) {
+	strategies := []bidding.BidStrategy{{ID: "1", Price: 2, Status: 1, CampaignID: "c1"}}
+	engine, _ := newProfileEngine(strategies, nil)
+	limiter := &memoryLimiter{allowed: map[string]int{"1": 1}}
+	engine.SetRateLimiter(limiter)
+
+	req := bidding.BidRequest{
+		RequestID: "test-rate-limit",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	}
+	if _, err := engine.ProcessBid(context.Background(), req); err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	// 超过QPS后不再出价
+	if _, err := engine.ProcessBid(context.Background(), req); !errors.Is(err, bidding.ErrNoAvailableAds) {
+		t.Fatalf("err = %v, want ErrNoAvailableAds", err)
+	}
+	if len(limiter.calls) != 2 || limiter.calls[0] != "1/c1" {
+		t.Fatalf("calls = %v", limiter.calls)
+	}
+
+	// 限流服务异常时不限制
+	limiter.err = errors.New("redis down")
+	resp, err := engine.ProcessBid(context.Background(), req)
+	if err != nil || resp.AdID != "1" {
+		t.Fatalf("ProcessBid() = %+v, %v", resp, err)
+	}
+}
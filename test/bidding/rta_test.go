@@ -0,0 +1,221 @@
+package bidding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func TestEngine_RTABidSignal(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategy   bidding.BidStrategy
+		signal     *bidding.RTASignal
+		wantPrice  float64
+		wantLabels []string // 为nil时不应记录调整
+	}{
+		{
+			name:      "没有RTA信号按策略出价",
+			strategy:  bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			wantPrice: 2,
+		},
+		{
+			name:      "未开启的推广计划忽略RTA信号",
+			strategy:  bidding.BidStrategy{ID: "1", CampaignID: "c2", Price: 2, Status: 1},
+			signal:    &bidding.RTASignal{BidMultiplier: 1.5},
+			wantPrice: 2,
+		},
+		{
+			name:      "锁价策略忽略RTA信号",
+			strategy:  bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1, IsPriceLocked: true},
+			signal:    &bidding.RTASignal{BidMultiplier: 1.5},
+			wantPrice: 2,
+		},
+		{
+			name:       "按出价系数提高出价",
+			strategy:   bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			signal:     &bidding.RTASignal{BidMultiplier: 1.5},
+			wantPrice:  3,
+			wantLabels: []string{"raised", "false"},
+		},
+		{
+			name:       "基础出价替换策略出价",
+			strategy:   bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			signal:     &bidding.RTASignal{BaseBid: 1, BidMultiplier: 1.2},
+			wantPrice:  1.2,
+			wantLabels: []string{"lowered", "false"},
+		},
+		{
+			name:       "出价系数超过上限被截断",
+			strategy:   bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			signal:     &bidding.RTASignal{BidMultiplier: 10},
+			wantPrice:  4,
+			wantLabels: []string{"raised", "true"},
+		},
+		{
+			name:       "出价系数低于下限被截断",
+			strategy:   bidding.BidStrategy{ID: "1", CampaignID: "c1", Price: 2, Status: 1},
+			signal:     &bidding.RTASignal{BidMultiplier: 0.1},
+			wantPrice:  1,
+			wantLabels: []string{"lowered", "true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adjustments := prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_rta_adjustments_total",
+			}, []string{"direction", "clamped"})
+			engine := bidding.NewEngine(
+				&benchRepository{strategies: []bidding.BidStrategy{tt.strategy}},
+				&mockBudgetManager{},
+				&mockFreqCtrl{},
+				logger.NewLogger(zap.NewNop()),
+				&metrics.Metrics{Bid: &metrics.BidMetrics{
+					Duration:       &mockHistogram{},
+					RTAAdjustments: adjustments,
+				}},
+			)
+			engine.SetRTABidPolicy(bidding.NewRTABidPolicy([]string{"c1"}, 0.5, 2))
+
+			resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+				RequestID: "test-rta",
+				UserID:    "user-1",
+				AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+				RTA:       tt.signal,
+			})
+			if err != nil {
+				t.Fatalf("ProcessBid() error = %v", err)
+			}
+			if resp.BidPrice != tt.wantPrice {
+				t.Errorf("ProcessBid() BidPrice = %v, want %v", resp.BidPrice, tt.wantPrice)
+			}
+
+			total := testutil.CollectAndCount(adjustments)
+			if tt.wantLabels == nil {
+				if total != 0 {
+					t.Errorf("不应记录RTA调整, got %d", total)
+				}
+				return
+			}
+			if got := testutil.ToFloat64(adjustments.WithLabelValues(tt.wantLabels...)); got != 1 {
+				t.Errorf("RTA调整次数%v = %v, want 1", tt.wantLabels, got)
+			}
+		})
+	}
+}
+
+func TestEngine_RTABidSignalPriceRange(t *testing.T) {
+	// 调整后的出价超过广告位最高价时不参与竞价
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: []bidding.BidStrategy{{ID: "1", CampaignID: "c1", Price: 6, Status: 1}}},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{Duration: &mockHistogram{}}},
+	)
+	engine.SetRTABidPolicy(bidding.NewRTABidPolicy([]string{"c1"}, 0, 0))
+
+	_, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+		RequestID: "test-rta-range",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+		RTA:       &bidding.RTASignal{BidMultiplier: 2},
+	})
+	if err != bidding.ErrNoAvailableAds {
+		t.Errorf("ProcessBid() error = %v, want %v", err, bidding.ErrNoAvailableAds)
+	}
+}
+
+func TestEngine_RTACampaigns(t *testing.T) {
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: []bidding.BidStrategy{
+			{ID: "1", CampaignID: "c1", Price: 5, Status: 1},
+			{ID: "2", CampaignID: "c2", Price: 3, Status: 1},
+			{ID: "3", CampaignID: "c2", Price: 1, Status: 1},
+			{ID: "4", Price: 2, Status: 1},
+		}},
+		&mockBudgetManager{},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration: &mockHistogram{},
+			RTAAdjustments: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_rta_adjustments_total",
+			}, []string{"direction", "clamped"}),
+		}},
+	)
+	engine.SetRTABidPolicy(bidding.NewRTABidPolicy([]string{"c2"}, 0, 0))
+
+	campaigns, err := engine.ActiveCampaigns(context.Background())
+	if err != nil {
+		t.Fatalf("ActiveCampaigns() error = %v", err)
+	}
+	if len(campaigns) != 2 || campaigns[0] != "c1" || campaigns[1] != "c2" {
+		t.Errorf("ActiveCampaigns() = %v, want [c1 c2]", campaigns)
+	}
+
+	tests := []struct {
+		name      string
+		campaigns map[string]bidding.RTAResult
+		wantAdID  string
+		wantPrice float64
+	}{
+		{
+			name:      "未绑定任务的推广计划不受限制",
+			wantAdID:  "1",
+			wantPrice: 5,
+		},
+		{
+			name: "未定向的推广计划不参与竞价",
+			campaigns: map[string]bidding.RTAResult{
+				"c1": {Targeted: false},
+				"c2": {Targeted: true},
+			},
+			wantAdID:  "2",
+			wantPrice: 3,
+		},
+		{
+			name: "使用任务返回的出价信号",
+			campaigns: map[string]bidding.RTAResult{
+				"c1": {Targeted: false},
+				"c2": {Targeted: true, Signal: &bidding.RTASignal{BidMultiplier: 2}},
+			},
+			wantAdID:  "2",
+			wantPrice: 6,
+		},
+		{
+			name: "只剩未绑定任务的推广计划",
+			campaigns: map[string]bidding.RTAResult{
+				"c1": {Targeted: false},
+				"c2": {Targeted: false},
+			},
+			wantAdID:  "4",
+			wantPrice: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := engine.ProcessBid(context.Background(), bidding.BidRequest{
+				RequestID:    "test-rta-campaigns",
+				UserID:       "user-1",
+				AdSlots:      []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+				RTACampaigns: tt.campaigns,
+			})
+			if err != nil {
+				t.Fatalf("ProcessBid() error = %v", err)
+			}
+			if resp.AdID != tt.wantAdID || resp.BidPrice != tt.wantPrice {
+				t.Errorf("ProcessBid() = %s@%v, want %s@%v", resp.AdID, resp.BidPrice, tt.wantAdID, tt.wantPrice)
+			}
+		})
+	}
+}
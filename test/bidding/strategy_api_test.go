@@ -0,0 +1,334 @@
+package bidding_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStrategies 内存出价策略存储，记录最近一次列表查询的过滤条件
+type memoryStrategies struct {
+	mu         sync.Mutex
+	nextID     int64
+	strategies map[int64]*bidding.BidStrategy
+	creatives  map[int64][]int64
+	stats      []bidding.BidStrategyStats
+	filter     bidding.BidStrategyFilter
+}
+
+func newMemoryStrategies() *memoryStrategies {
+	return &memoryStrategies{
+		strategies: make(map[int64]*bidding.BidStrategy),
+		creatives:  make(map[int64][]int64),
+	}
+}
+
+func (m *memoryStrategies) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filter = filter
+	var out []bidding.BidStrategy
+	for _, s := range m.strategies {
+		out = append(out, *s)
+	}
+	return out, int64(len(out)), nil
+}
+
+func (m *memoryStrategies) GetBidStrategy(ctx context.Context, id int64) (*bidding.BidStrategy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.strategies[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *memoryStrategies) CreateBidStrategy(ctx context.Context, strategy *bidding.BidStrategy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	strategy.ID = strconv.FormatInt(m.nextID, 10)
+	copied := *strategy
+	m.strategies[m.nextID] = &copied
+	return nil
+}
+
+func (m *memoryStrategies) UpdateBidStrategy(ctx context.Context, strategy *bidding.BidStrategy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, _ := strconv.ParseInt(strategy.ID, 10, 64)
+	copied := *strategy
+	m.strategies[id] = &copied
+	return nil
+}
+
+func (m *memoryStrategies) DeleteBidStrategy(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.strategies, id)
+	delete(m.creatives, id)
+	return nil
+}
+
+func (m *memoryStrategies) UpdateBidStrategyStatus(ctx context.Context, id int64, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategies[id].Status = status
+	return nil
+}
+
+func (m *memoryStrategies) AddCreative(ctx context.Context, strategyID int64, creativeID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creatives[strategyID] = append(m.creatives[strategyID], creativeID)
+	return nil
+}
+
+func (m *memoryStrategies) RemoveCreative(ctx context.Context, strategyID int64, creativeID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := m.creatives[strategyID][:0]
+	for _, id := range m.creatives[strategyID] {
+		if id != creativeID {
+			ids = append(ids, id)
+		}
+	}
+	m.creatives[strategyID] = ids
+	return nil
+}
+
+func (m *memoryStrategies) UpdateCreative(ctx context.Context, strategyID int64, creativeID int64, status int, weight float64) error {
+	return nil
+}
+
+func (m *memoryStrategies) ListCreatives(ctx context.Context, strategyID string) ([]bidding.BidStrategyCreative, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id, _ := strconv.ParseInt(strategyID, 10, 64)
+	var out []bidding.BidStrategyCreative
+	for _, creativeID := range m.creatives[id] {
+		out = append(out, bidding.BidStrategyCreative{StrategyID: id, CreativeID: creativeID, Status: 1})
+	}
+	return out, nil
+}
+
+func (m *memoryStrategies) GetStrategyStats(ctx context.Context, strategyID int64, startDate, endDate string) ([]bidding.BidStrategyStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats, nil
+}
+
+func newStrategyRouter(repo bidding.Repository) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := config.BiddingConfig{MinBidPrice: 0.1, MaxBidPrice: 100}
+	h := handlers.NewStrategyHandler(repo, nil, cfg, logger.NewLogger(zap.NewNop()))
+	router := gin.New()
+	h.RegisterRoutes(router)
+	return router
+}
+
+func serve(router *gin.Engine, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func createStrategy(t *testing.T, router *gin.Engine, body string) bidding.BidStrategy {
+	t.Helper()
+	w := serve(router, http.MethodPost, "/api/v1/strategies", body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("创建策略 status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var strategy bidding.BidStrategy
+	if err := json.Unmarshal(w.Body.Bytes(), &strategy); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return strategy
+}
+
+func TestStrategyAPI_CreateValidation(t *testing.T) {
+	router := newStrategyRouter(newMemoryStrategies())
+
+	cases := []struct {
+		name string
+		body string
+	}{
+		{"缺少名称", `{"bid_type":"CPM","price":5}`},
+		{"未知计费类型", `{"name":"s","bid_type":"CPA","price":5}`},
+		{"出价低于下限", `{"name":"s","bid_type":"CPM","price":0.05}`},
+		{"出价高于上限", `{"name":"s","bid_type":"CPM","price":101}`},
+		{"参与比例越界", `{"name":"s","bid_type":"CPM","price":5,"participation_rate":1.5}`},
+		{"分时投放长度错误", `{"name":"s","bid_type":"CPM","price":5,"dayparting":"0101"}`},
+		{"分时投放字符错误", `{"name":"s","bid_type":"CPM","price":5,"dayparting":"` + strings.Repeat("2", bidding.DaypartingHours) + `"}`},
+	}
+	for _, tc := range cases {
+		if w := serve(router, http.MethodPost, "/api/v1/strategies", tc.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", tc.name, w.Code)
+		}
+	}
+
+	strategy := createStrategy(t, router, `{"name":"s","bid_type":"CPM","price":5}`)
+	if strategy.Status != bidding.StrategyStatusEnabled {
+		t.Fatalf("新策略状态 = %d, want 启用", strategy.Status)
+	}
+}
+
+func TestStrategyAPI_Update(t *testing.T) {
+	repo := newMemoryStrategies()
+	router := newStrategyRouter(repo)
+	strategy := createStrategy(t, router, `{"name":"s","bid_type":"CPM","price":5,"is_price_locked":true}`)
+	path := "/api/v1/strategies/" + strategy.ID
+
+	if w := serve(router, http.MethodPut, path, `{"name":"s","bid_type":"CPM","price":6,"is_price_locked":true}`); w.Code != http.StatusConflict {
+		t.Fatalf("修改锁定的出价 status = %d, want 409", w.Code)
+	}
+	if w := serve(router, http.MethodPut, path, `{"name":"s2","bid_type":"CPM","price":6}`); w.Code != http.StatusOK {
+		t.Fatalf("解锁并修改出价 status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if got := repo.strategies[1]; got.Price != 6 || got.Name != "s2" || got.Status != bidding.StrategyStatusEnabled {
+		t.Fatalf("修改后的策略 = %+v", got)
+	}
+
+	if w := serve(router, http.MethodPut, "/api/v1/strategies/99", `{"name":"s","bid_type":"CPM","price":5}`); w.Code != http.StatusNotFound {
+		t.Fatalf("修改不存在的策略 status = %d, want 404", w.Code)
+	}
+}
+
+func TestStrategyAPI_Status(t *testing.T) {
+	router := newStrategyRouter(newMemoryStrategies())
+	strategy := createStrategy(t, router, `{"name":"s","bid_type":"CPC","price":1}`)
+	path := "/api/v1/strategies/" + strategy.ID
+
+	steps := []struct {
+		action string
+		want   int
+	}{
+		{"resume", http.StatusConflict},
+		{"pause", http.StatusOK},
+		{"stop", http.StatusBadRequest},
+		{"resume", http.StatusOK},
+		{"archive", http.StatusOK},
+		{"resume", http.StatusConflict},
+	}
+	for _, step := range steps {
+		if w := serve(router, http.MethodPost, path+"/status", `{"action":"`+step.action+`"}`); w.Code != step.want {
+			t.Fatalf("%s: status = %d, want %d", step.action, w.Code, step.want)
+		}
+	}
+
+	// 归档的策略不能修改
+	if w := serve(router, http.MethodPut, path, `{"name":"s","bid_type":"CPC","price":1}`); w.Code != http.StatusConflict {
+		t.Fatalf("修改归档策略 status = %d, want 409", w.Code)
+	}
+}
+
+func TestStrategyAPI_Creatives(t *testing.T) {
+	router := newStrategyRouter(newMemoryStrategies())
+	strategy := createStrategy(t, router, `{"name":"s","bid_type":"CPM","price":5}`)
+	path := "/api/v1/strategies/" + strategy.ID + "/creatives"
+
+	if w := serve(router, http.MethodPost, path, `{"creative_id":7}`); w.Code != http.StatusCreated {
+		t.Fatalf("关联素材 status = %d", w.Code)
+	}
+	if w := serve(router, http.MethodPost, path, `{"creative_id":7}`); w.Code != http.StatusConflict {
+		t.Fatalf("重复关联 status = %d, want 409", w.Code)
+	}
+
+	w := serve(router, http.MethodGet, path, "")
+	var resp struct {
+		Items []bidding.BidStrategyCreative `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Items) != 1 || resp.Items[0].CreativeID != 7 {
+		t.Fatalf("素材列表 = %s", w.Body.String())
+	}
+
+	if w := serve(router, http.MethodDelete, path+"/7", ""); w.Code != http.StatusOK {
+		t.Fatalf("移除素材 status = %d", w.Code)
+	}
+	if w := serve(router, http.MethodGet, path, ""); !strings.Contains(w.Body.String(), `"items":[]`) {
+		t.Fatalf("移除后素材列表 = %s", w.Body.String())
+	}
+}
+
+func TestStrategyAPI_Stats(t *testing.T) {
+	repo := newMemoryStrategies()
+	router := newStrategyRouter(repo)
+	strategy := createStrategy(t, router, `{"name":"s","bid_type":"CPM","price":5}`)
+	repo.stats = []bidding.BidStrategyStats{
+		{StrategyID: 1, CreativeID: 7, Impressions: 300, Clicks: 3, Spend: 1.5, Date: "2024-06-01"},
+		{StrategyID: 1, CreativeID: 8, Impressions: 100, Clicks: 5, Spend: 0.5, Date: "2024-06-02"},
+	}
+	path := "/api/v1/strategies/" + strategy.ID + "/stats"
+
+	w := serve(router, http.MethodGet, path+"?start_date=2024-06-01&end_date=2024-06-07", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("统计 status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Summary handlers.StrategyStatsSummary `json:"summary"`
+		Items   []bidding.BidStrategyStats    `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Summary.Impressions != 400 || resp.Summary.Clicks != 8 || resp.Summary.Spend != 2 || resp.Summary.CTR != 0.02 {
+		t.Fatalf("汇总 = %+v", resp.Summary)
+	}
+	if len(resp.Items) != 2 {
+		t.Fatalf("明细条数 = %d, want 2", len(resp.Items))
+	}
+
+	for _, query := range []string{"?start_date=2024-06-07&end_date=2024-06-01", "?start_date=20240601", "?start_date=2024-01-01&end_date=2024-06-01"} {
+		if w := serve(router, http.MethodGet, path+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestStrategyAPI_ListFilters(t *testing.T) {
+	repo := newMemoryStrategies()
+	router := newStrategyRouter(repo)
+	createStrategy(t, router, `{"name":"s","bid_type":"CPM","price":5}`)
+
+	w := serve(router, http.MethodGet, "/api/v1/strategies?page=2&page_size=10&bid_type=CPM&status=1&campaign_id=c1&min_price=1.5&max_price=8", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("列表 status = %d, body = %s", w.Code, w.Body.String())
+	}
+	f := repo.filter
+	if f.Page != 2 || f.PageSize != 10 || f.BidType != "CPM" || f.CampaignID != "c1" {
+		t.Fatalf("过滤条件 = %+v", f)
+	}
+	if f.Status == nil || *f.Status != 1 || f.MinPrice == nil || *f.MinPrice != 1.5 || f.MaxPrice == nil || *f.MaxPrice != 8 {
+		t.Fatalf("过滤条件 = %+v", f)
+	}
+
+	for _, query := range []string{"?page=0", "?page_size=1000", "?status=x", "?min_price=x"} {
+		if w := serve(router, http.MethodGet, "/api/v1/strategies"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
+
+func TestStrategyAPI_RepositoryUnavailable(t *testing.T) {
+	router := newStrategyRouter(nil)
+	if w := serve(router, http.MethodGet, "/api/v1/strategies", ""); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("未配置存储 status = %d, want 503", w.Code)
+	}
+}
@@ -0,0 +1,178 @@
+package bidding_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+
+	"go.uber.org/zap"
+)
+
+// countingRepository 统计策略加载次数
+type countingRepository struct {
+	mockRepository
+	calls int
+}
+
+func (m *countingRepository) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	m.calls++
+	return []bidding.BidStrategy{
+		{ID: "strategy-1", BidType: "CPM", Price: 2.0, Status: 1},
+		{ID: "strategy-2", BidType: "CPM", Price: 3.0, Status: 0},
+	}, 2, nil
+}
+
+func TestStrategyCache_ActiveStrategies(t *testing.T) {
+	repo := &countingRepository{}
+	cache := bidding.NewStrategyCache(repo, nil, time.Minute, logger.NewLogger(zap.NewNop()))
+
+	for i := 0; i < 10; i++ {
+		strategies, err := cache.ActiveStrategies(context.Background())
+		if err != nil {
+			t.Fatalf("ActiveStrategies() error = %v", err)
+		}
+		if len(strategies) != 1 || strategies[0].ID != "strategy-1" {
+			t.Fatalf("ActiveStrategies() = %v, want only active strategy-1", strategies)
+		}
+	}
+
+	if repo.calls != 1 {
+		t.Errorf("ListBidStrategies called %d times, want 1", repo.calls)
+	}
+}
+
+// flakyRepository 可切换加载失败，统计策略加载次数，可被后台刷新并发调用
+type flakyRepository struct {
+	mockRepository
+	mu    sync.Mutex
+	fail  bool
+	price float64
+	calls int
+}
+
+func (m *flakyRepository) set(fail bool, price float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fail, m.price = fail, price
+}
+
+func (m *flakyRepository) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls
+}
+
+func (m *flakyRepository) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if m.fail {
+		return nil, 0, errors.New("数据库不可用")
+	}
+	return []bidding.BidStrategy{{ID: "strategy-1", BidType: "CPM", Price: m.price, Status: 1}}, 1, nil
+}
+
+// waitFor 等待条件满足，超时则失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStrategyCache_StaleWhileRefresh(t *testing.T) {
+	const interval = 100 * time.Millisecond
+	repo := &flakyRepository{price: 2}
+	cache := bidding.NewStrategyCache(repo, nil, interval, logger.NewLogger(zap.NewNop()))
+
+	if _, err := cache.ActiveStrategies(context.Background()); err != nil {
+		t.Fatalf("ActiveStrategies() error = %v", err)
+	}
+
+	// 过期后刷新失败：立即返回旧数据，后台只刷新一次
+	repo.set(true, 3)
+	time.Sleep(interval + 20*time.Millisecond)
+	for i := 0; i < 10; i++ {
+		strategies, err := cache.ActiveStrategies(context.Background())
+		if err != nil || len(strategies) != 1 || strategies[0].Price != 2 {
+			t.Fatalf("过期时应返回旧数据: %v, %v", strategies, err)
+		}
+	}
+	waitFor(t, "后台刷新", func() bool { return repo.count() == 2 })
+
+	// 退避期间不再访问存储
+	for i := 0; i < 10; i++ {
+		cache.ActiveStrategies(context.Background())
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := repo.count(); got != 2 {
+		t.Fatalf("退避期间加载次数 = %d, want 2", got)
+	}
+
+	// 退避结束后恢复，后台刷新成功后返回新数据
+	repo.set(false, 3)
+	time.Sleep(interval)
+	cache.ActiveStrategies(context.Background())
+	waitFor(t, "刷新成功", func() bool {
+		strategies, _ := cache.ActiveStrategies(context.Background())
+		return len(strategies) == 1 && strategies[0].Price == 3
+	})
+}
+
+func TestStrategyCache_NoRepository(t *testing.T) {
+	cache := bidding.NewStrategyCache(nil, nil, time.Minute, logger.NewLogger(zap.NewNop()))
+
+	if _, err := cache.ActiveStrategies(context.Background()); err != bidding.ErrRepositoryUnavailable {
+		t.Errorf("ActiveStrategies() error = %v, want %v", err, bidding.ErrRepositoryUnavailable)
+	}
+}
+
+// recordingBudgets 记录最近一次同步的策略日预算
+type recordingBudgets struct {
+	mockBudgetManager
+	synced map[string]float64
+	calls  int
+}
+
+func (m *recordingBudgets) SyncDailyBudgets(budgets map[string]float64) {
+	m.synced = budgets
+	m.calls++
+}
+
+func TestStrategyCache_SyncDailyBudgets(t *testing.T) {
+	repo := &countingRepository{}
+	cache := bidding.NewStrategyCache(repo, nil, time.Minute, logger.NewLogger(zap.NewNop()))
+	if err := cache.Refresh(context.Background()); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+
+	// 替换缓存时立即同步已加载的策略
+	budgets := &recordingBudgets{}
+	engine := bidding.NewEngine(repo, budgets, &mockFreqCtrl{}, logger.NewLogger(zap.NewNop()), nil)
+	engine.SetStrategyCache(cache)
+	if budgets.calls != 1 {
+		t.Fatalf("SyncDailyBudgets called %d times, want 1", budgets.calls)
+	}
+	if _, ok := budgets.synced["strategy-1"]; !ok || len(budgets.synced) != 1 {
+		t.Fatalf("synced = %v, want only active strategy-1", budgets.synced)
+	}
+
+	// 引擎自带的缓存刷新后同步
+	budgets = &recordingBudgets{}
+	engine = bidding.NewEngine(repo, budgets, &mockFreqCtrl{}, logger.NewLogger(zap.NewNop()), nil)
+	if _, err := engine.ActiveCampaigns(context.Background()); err != nil {
+		t.Fatalf("ActiveCampaigns() error = %v", err)
+	}
+	if budgets.calls != 1 || len(budgets.synced) != 1 {
+		t.Fatalf("刷新后 SyncDailyBudgets calls = %d, synced = %v", budgets.calls, budgets.synced)
+	}
+}
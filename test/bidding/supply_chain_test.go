@@ -0,0 +1,60 @@
+package bidding_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func TestEngine_SupplyChainPolicy(t *testing.T) {
+	rejections := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_bid_candidate_rejections_total",
+	}, []string{"stage", "reason"})
+	engine := bidding.NewEngine(
+		&benchRepository{strategies: floorStrategies},
+		&memoryBudgets{remaining: map[string]float64{"1": 100, "2": 100, "3": 100}},
+		&mockFreqCtrl{},
+		logger.NewLogger(zap.NewNop()),
+		&metrics.Metrics{Bid: &metrics.BidMetrics{
+			Duration: &mockHistogram{},
+			Preemptions: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "test_bid_preemptions_total",
+			}, []string{"priority"}),
+			Rejections: rejections,
+		}},
+	)
+	// 推广计划c1要求已授权的供应链
+	engine.SetSupplyChainPolicy(bidding.NewSupplyChainPolicy([]string{"c1"}))
+
+	req := bidding.BidRequest{
+		RequestID: "test-schain",
+		UserID:    "user-1",
+		AdSlots:   []bidding.AdSlot{{SlotID: "slot-1", MaxPrice: 10}},
+	}
+	resp, err := engine.ProcessBid(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "2" {
+		t.Errorf("供应链未授权时AdID = %s, want 2", resp.AdID)
+	}
+	if got := testutil.ToFloat64(rejections.WithLabelValues("prefilter", "schain")); got != 1 {
+		t.Errorf("供应链淘汰次数 = %v, want 1", got)
+	}
+
+	req.SupplyChainAuthorized = true
+	resp, err = engine.ProcessBid(context.Background(), req)
+	if err != nil {
+		t.Fatalf("ProcessBid() error = %v", err)
+	}
+	if resp.AdID != "1" {
+		t.Errorf("供应链已授权时AdID = %s, want 1", resp.AdID)
+	}
+}
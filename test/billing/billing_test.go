@@ -0,0 +1,59 @@
+package billing_test
+
+import (
+	"testing"
+
+	"simple-dsp/internal/billing"
+	"simple-dsp/pkg/config"
+)
+
+// TestSplit 测试按媒体成本计算服务费和税费
+func TestSplit(t *testing.T) {
+	rates := billing.NewRates(config.BillingConfig{PlatformMargin: 0.2, TaxRate: 0.06})
+	if rates.IsZero() {
+		t.Fatal("设置了费率时IsZero应为false")
+	}
+
+	tests := []struct {
+		name      string
+		mediaCost int64
+		want      billing.Breakdown
+	}{
+		{"整数", 1000, billing.Breakdown{MediaCost: 1000, Fee: 200, Tax: 72}},
+		// 服务费0.2分舍去，税费按媒体成本加服务费计算，0.06分舍去
+		{"舍入", 1, billing.Breakdown{MediaCost: 1, Fee: 0, Tax: 0}},
+		// 服务费5.8分进为6分，税费(29+6)*0.06=2.1分舍为2分
+		{"成交价", 29, billing.Breakdown{MediaCost: 29, Fee: 6, Tax: 2}},
+		{"零", 0, billing.Breakdown{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rates.Split(tt.mediaCost); got != tt.want {
+				t.Errorf("Split(%d) = %+v, 期望 %+v", tt.mediaCost, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSplit_ZeroRates 测试未设置费率时只有媒体成本
+func TestSplit_ZeroRates(t *testing.T) {
+	var rates billing.Rates
+	if !rates.IsZero() {
+		t.Fatal("零值费率的IsZero应为true")
+	}
+	if got := rates.Split(1234); got.Fee != 0 || got.Tax != 0 || got.Total() != 1234 {
+		t.Errorf("Split(1234) = %+v", got)
+	}
+}
+
+// TestBreakdown 测试费用构成的合计与累加
+func TestBreakdown(t *testing.T) {
+	total := billing.Breakdown{MediaCost: 100, Fee: 20, Tax: 7}
+	total.Add(billing.Breakdown{MediaCost: 50, Fee: 10, Tax: 4})
+	if total != (billing.Breakdown{MediaCost: 150, Fee: 30, Tax: 11}) {
+		t.Errorf("累加结果 = %+v", total)
+	}
+	if total.Total() != 191 {
+		t.Errorf("Total() = %d, 期望 191", total.Total())
+	}
+}
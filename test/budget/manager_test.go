@@ -0,0 +1,393 @@
+package budget_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/billing"
+	"simple-dsp/internal/budget"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/timezone"
+	"simple-dsp/test/fakeredis"
+)
+
+func newManager(t *testing.T, f *fakeredis.Server) *budget.Manager {
+	t.Helper()
+	return budget.NewManager(f.Client(t), logger.NewLogger(zap.NewNop()), nil)
+}
+
+// getInt 读取Redis中的计数
+func getInt(f *fakeredis.Server, key string) (int64, bool) {
+	value, ok := f.Get(key)
+	if !ok {
+		return 0, false
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n, true
+}
+
+func spentKey(b *budget.Budget) string {
+	return "budget:spent:" + b.ID + ":" + b.StartTime.Format("20060102")
+}
+
+func TestSyncDailyBudgets_Enforce(t *testing.T) {
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	ctx := context.Background()
+
+	m.SyncDailyBudgets(map[string]float64{"s1": 10, "s2": 0})
+	if _, err := m.GetBudget("s2"); !errors.Is(err, budget.ErrBudgetNotFound) {
+		t.Fatalf("日预算为0的策略不应创建预算, err = %v", err)
+	}
+	b, err := m.GetBudget("s1")
+	if err != nil {
+		t.Fatalf("GetBudget失败: %v", err)
+	}
+	if b.Type != budget.DailyBudget || b.Amount != 10 || b.EndTime.Sub(b.StartTime) != 24*time.Hour {
+		t.Fatalf("策略日预算 = %+v", b)
+	}
+
+	for i := 0; i < 2; i++ {
+		if ok, err := m.CheckAndDeduct(ctx, "s1", 4); !ok || err != nil {
+			t.Fatalf("第%d次扣减 = %v, %v", i+1, ok, err)
+		}
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 4); ok || !errors.Is(err, budget.ErrBudgetExceeded) {
+		t.Fatalf("超出日预算的扣减 = %v, %v", ok, err)
+	}
+	if m.HasBudget("s1", 4) || !m.HasBudget("s1", 2) {
+		t.Fatal("HasBudget应按剩余日预算判断")
+	}
+
+	key := spentKey(b)
+	if spent, _ := getInt(f, key); spent != 800 {
+		t.Fatalf("Redis中的花费 = %d分, want 800", spent)
+	}
+	if ttl := f.TTL(key); ttl != 48*time.Hour {
+		t.Fatalf("花费键的过期时间 = %v", ttl)
+	}
+
+	// 日预算调整后保留已花费的金额
+	m.SyncDailyBudgets(map[string]float64{"s1": 12})
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 4); !ok || err != nil {
+		t.Fatalf("提高日预算后扣减 = %v, %v", ok, err)
+	}
+
+	// 策略停用或日预算清零后删除预算
+	m.SyncDailyBudgets(map[string]float64{})
+	if _, err := m.GetBudget("s1"); !errors.Is(err, budget.ErrBudgetNotFound) {
+		t.Fatalf("策略停用后应删除预算, err = %v", err)
+	}
+}
+
+func TestSyncDailyBudgets_Timezone(t *testing.T) {
+	zones, err := timezone.New(config.TimezoneConfig{
+		Default: "UTC",
+		Campaigns: []config.CampaignTimezoneConfig{
+			{CampaignID: "la", Timezone: "America/Los_Angeles"},
+			{CampaignID: "tokyo", Timezone: "Asia/Tokyo"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("timezone.New() error = %v", err)
+	}
+	zones.SetAdCampaigns(map[string]string{"s1": "la"})
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	m.SetTimezones(zones)
+	ctx := context.Background()
+
+	// 日预算周期从推广计划时区的零点开始，花费按该时区的日期记录
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, err := m.GetBudget("s1")
+	if err != nil {
+		t.Fatalf("GetBudget失败: %v", err)
+	}
+	if loc := b.StartTime.Location(); loc.String() != "America/Los_Angeles" {
+		t.Fatalf("日预算周期的时区 = %v", loc)
+	}
+	if b.StartTime.Hour() != 0 || b.StartTime.Minute() != 0 || b.StartTime.Format("20060102") != time.Now().In(b.StartTime.Location()).Format("20060102") {
+		t.Fatalf("日预算周期应从洛杉矶当天零点开始: %v", b.StartTime)
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 4); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	if spent, _ := getInt(f, spentKey(b)); spent != 400 {
+		t.Fatalf("%s的花费 = %d分, want 400", spentKey(b), spent)
+	}
+
+	// 推广计划的时区变更后从新时区的当前周期计算，日期不同时花费清零，日期相同时沿用
+	previous := spentKey(b)
+	zones.SetAdCampaigns(map[string]string{"s1": "tokyo"})
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, _ = m.GetBudget("s1")
+	if loc := b.StartTime.Location(); loc.String() != "Asia/Tokyo" || b.StartTime.Hour() != 0 {
+		t.Fatalf("时区变更后的日预算周期 = %v", b.StartTime)
+	}
+	want := 0.0
+	if spentKey(b) == previous {
+		want = 4
+	}
+	if b.Spent != want {
+		t.Fatalf("时区变更后的花费 = %v, want %v", b.Spent, want)
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 10-want); !ok || err != nil {
+		t.Fatalf("时区变更后扣减剩余日预算 = %v, %v", ok, err)
+	}
+}
+
+func TestSyncDailyBudgets_KeepsManualBudget(t *testing.T) {
+	m := newManager(t, fakeredis.New(t))
+	manual := &budget.Budget{
+		ID:        "s1",
+		Type:      budget.TotalBudget,
+		Amount:    1000,
+		StartTime: time.Now().Add(-time.Hour),
+		EndTime:   time.Now().Add(time.Hour),
+		Status:    "active",
+	}
+	if err := m.AddBudget(manual); err != nil {
+		t.Fatalf("AddBudget失败: %v", err)
+	}
+
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	m.SyncDailyBudgets(map[string]float64{})
+	b, err := m.GetBudget("s1")
+	if err != nil || b.Type != budget.TotalBudget || b.Amount != 1000 {
+		t.Fatalf("手动添加的预算被修改: %+v, %v", b, err)
+	}
+}
+
+func TestSyncDailyBudgets_SharedAcrossInstances(t *testing.T) {
+	f := fakeredis.New(t)
+	a, b := newManager(t, f), newManager(t, f)
+	ctx := context.Background()
+	a.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b.SyncDailyBudgets(map[string]float64{"s1": 10})
+
+	if ok, err := a.CheckAndDeduct(ctx, "s1", 6); !ok || err != nil {
+		t.Fatalf("实例a扣减 = %v, %v", ok, err)
+	}
+	// 实例b本地未记录花费，Redis中的累计花费超出日预算时撤销扣除
+	if ok, err := b.CheckAndDeduct(ctx, "s1", 6); ok || !errors.Is(err, budget.ErrBudgetExceeded) {
+		t.Fatalf("实例b超出日预算的扣减 = %v, %v", ok, err)
+	}
+	budgetB, _ := b.GetBudget("s1")
+	if spent, _ := getInt(f, spentKey(budgetB)); spent != 600 {
+		t.Fatalf("撤销后Redis中的花费 = %d分, want 600", spent)
+	}
+	if ok, err := b.CheckAndDeduct(ctx, "s1", 4); !ok || err != nil {
+		t.Fatalf("实例b扣减剩余日预算 = %v, %v", ok, err)
+	}
+}
+
+func TestSyncDailyBudgets_Renewal(t *testing.T) {
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	ctx := context.Background()
+
+	if err := m.SetRenewalTime("25:00:00"); !errors.Is(err, budget.ErrInvalidBudgetTime) {
+		t.Fatalf("无效的续期时间 err = %v", err)
+	}
+	if err := m.SetRenewalTime("06:30:00"); err != nil {
+		t.Fatalf("SetRenewalTime失败: %v", err)
+	}
+
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, _ := m.GetBudget("s1")
+	now := time.Now()
+	if h, min, s := b.StartTime.Clock(); h != 6 || min != 30 || s != 0 {
+		t.Fatalf("周期开始时间 = %v", b.StartTime)
+	}
+	if now.Before(b.StartTime) || !now.Before(b.EndTime) {
+		t.Fatalf("当前时间不在周期[%v, %v)内", b.StartTime, b.EndTime)
+	}
+
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 10); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	if m.HasBudget("s1", 1) {
+		t.Fatal("日预算已用尽")
+	}
+
+	// 模拟上一个周期已结束，到续期时间后重新计算花费
+	current := spentKey(b)
+	b.StartTime = b.StartTime.AddDate(0, 0, -1)
+	b.EndTime = b.EndTime.AddDate(0, 0, -1)
+	previous := spentKey(b)
+	f.Set(previous, "1000")
+	f.Del(current)
+	if !m.HasBudget("s1", 1) {
+		t.Fatal("到续期时间后应有预算")
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 3); !ok || err != nil {
+		t.Fatalf("续期后扣减 = %v, %v", ok, err)
+	}
+	if b.Spent != 3 || !now.Before(b.EndTime) {
+		t.Fatalf("续期后的预算 = %+v", b)
+	}
+	if spent, _ := getInt(f, spentKey(b)); spent != 300 {
+		t.Fatalf("新周期的花费 = %d分, want 300", spent)
+	}
+	if spent, _ := getInt(f, previous); spent != 1000 {
+		t.Fatalf("上一个周期的花费 = %d分, want 1000", spent)
+	}
+}
+
+func TestSyncDailyBudgets_MidnightRollover(t *testing.T) {
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 10, 16, 23, 59, 30, 0, time.Local))
+	m.SetClock(fake)
+
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, _ := m.GetBudget("s1")
+	if !b.StartTime.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)) {
+		t.Fatalf("周期开始时间 = %v", b.StartTime)
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 10); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	if m.HasBudget("s1", 1) {
+		t.Fatal("零点前日预算已用尽")
+	}
+	previous := spentKey(b)
+
+	// 零点后进入新的周期，上一个周期的花费保留在原来的键中
+	fake.Advance(time.Minute)
+	if !m.HasBudget("s1", 1) {
+		t.Fatal("零点后应有预算")
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 3); !ok || err != nil {
+		t.Fatalf("零点后扣减 = %v, %v", ok, err)
+	}
+	if !b.StartTime.Equal(time.Date(2026, 10, 17, 0, 0, 0, 0, time.Local)) || b.Spent != 3 {
+		t.Fatalf("续期后的预算 = %+v", b)
+	}
+	if spent, _ := getInt(f, spentKey(b)); spent != 300 {
+		t.Fatalf("新周期的花费 = %d分, want 300", spent)
+	}
+	if spent, _ := getInt(f, previous); spent != 1000 {
+		t.Fatalf("上一个周期的花费 = %d分, want 1000", spent)
+	}
+
+	status, _ := m.GetBudgetStatus("s1")
+	if !status.IsActive || status.IsExpired || status.Remaining != 7 {
+		t.Fatalf("续期后的状态 = %+v", status)
+	}
+}
+
+func TestCheckAndDeduct_BillingRates(t *testing.T) {
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	m.SetBillingRates(billing.Rates{Margin: 0.2, TaxRate: 0.06})
+	ctx := context.Background()
+
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, _ := m.GetBudget("s1")
+
+	// 媒体成本4元，服务费0.8元，税费0.288元，按总额5.09元扣减
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 4); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	key := spentKey(b)
+	if spent, _ := getInt(f, key); spent != 509 {
+		t.Fatalf("Redis中的花费 = %d分, want 509", spent)
+	}
+	if fee, _ := getInt(f, key+":fee"); fee != 80 {
+		t.Fatalf("Redis中的服务费 = %d分, want 80", fee)
+	}
+	if tax, _ := getInt(f, key+":tax"); tax != 29 {
+		t.Fatalf("Redis中的税费 = %d分, want 29", tax)
+	}
+	if ttl := f.TTL(key + ":fee"); ttl != 48*time.Hour {
+		t.Fatalf("服务费键的过期时间 = %v", ttl)
+	}
+
+	// 媒体成本未超出日预算，但含服务费和税费的总额超出
+	if m.HasBudget("s1", 4) {
+		t.Fatal("HasBudget应按含服务费和税费的总额判断")
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 4); ok || !errors.Is(err, budget.ErrBudgetExceeded) {
+		t.Fatalf("超出日预算的扣减 = %v, %v", ok, err)
+	}
+
+	status, err := m.GetBudgetStatus("s1")
+	if err != nil {
+		t.Fatalf("GetBudgetStatus失败: %v", err)
+	}
+	if status.Spent != 5.09 || status.Fee != 0.8 || status.Tax != 0.29 || math.Abs(status.MediaCost-4) > 1e-9 {
+		t.Fatalf("预算状态 = %+v", status)
+	}
+}
+
+// blockingNotifier 通知阻塞到release关闭，记录通知的事件
+type blockingNotifier struct {
+	release chan struct{}
+	events  chan webhook.EventType
+}
+
+func (n *blockingNotifier) Notify(ctx context.Context, eventType webhook.EventType, data interface{}) {
+	n.events <- eventType
+	<-n.release
+}
+
+// within 在d内未完成fn时失败，fn在后台运行，不会卡住测试
+func within(t *testing.T, d time.Duration, name string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("%s超过%s未完成", name, d)
+	}
+}
+
+func TestCheckAndDeduct_NoLockAcrossIO(t *testing.T) {
+	f := fakeredis.New(t)
+	m := newManager(t, f)
+	notifier := &blockingNotifier{release: make(chan struct{}), events: make(chan webhook.EventType, 1)}
+	t.Cleanup(func() { close(notifier.release) })
+	m.SetNotifier(notifier)
+	ctx := context.Background()
+	m.SyncDailyBudgets(map[string]float64{"s1": 10, "s2": 10})
+
+	// Redis变慢时，一个预算的扣减不阻塞其他预算的检查
+	f.SetLatency(200 * time.Millisecond)
+	go m.CheckAndDeduct(ctx, "s1", 10)
+	time.Sleep(50 * time.Millisecond)
+	within(t, 100*time.Millisecond, "Redis扣减期间检查预算", func() {
+		if !m.HasBudget("s2", 1) {
+			t.Error("s2应有余额")
+		}
+	})
+
+	// 预算用尽的通知在锁外发送，通知阻塞时预算仍可读取
+	select {
+	case event := <-notifier.events:
+		if event != webhook.EventBudgetExhausted {
+			t.Fatalf("通知事件 = %s, want %s", event, webhook.EventBudgetExhausted)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("预算用尽时未通知")
+	}
+	within(t, 100*time.Millisecond, "通知期间读取预算", func() {
+		if status, err := m.GetBudgetStatus("s1"); err != nil || status.Spent != 10 {
+			t.Errorf("通知期间的预算状态 = %+v, %v", status, err)
+		}
+	})
+}
@@ -0,0 +1,224 @@
+package budget_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/budget"
+	"simple-dsp/internal/models"
+	"simple-dsp/test/fakeredis"
+)
+
+var _ budget.SnapshotStore = (*memorySnapshots)(nil)
+
+// memorySnapshots 内存中的花费快照存储
+type memorySnapshots struct {
+	mu        sync.Mutex
+	snapshots map[string]models.BudgetSnapshot
+}
+
+func newMemorySnapshots() *memorySnapshots {
+	return &memorySnapshots{snapshots: make(map[string]models.BudgetSnapshot)}
+}
+
+func (s *memorySnapshots) Save(ctx context.Context, snapshots []models.BudgetSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, snapshot := range snapshots {
+		s.snapshots[snapshot.BudgetID+"|"+snapshot.PeriodStart.String()] = snapshot
+	}
+	return nil
+}
+
+func (s *memorySnapshots) Load(ctx context.Context, budgetIDs []string, since time.Time) ([]models.BudgetSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make(map[string]bool, len(budgetIDs))
+	for _, id := range budgetIDs {
+		ids[id] = true
+	}
+	var found []models.BudgetSnapshot
+	for _, snapshot := range s.snapshots {
+		if ids[snapshot.BudgetID] && !snapshot.PeriodStart.Before(since) {
+			found = append(found, snapshot)
+		}
+	}
+	return found, nil
+}
+
+func (s *memorySnapshots) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, snapshot := range s.snapshots {
+		if snapshot.UpdateTime.Before(before) {
+			delete(s.snapshots, key)
+		}
+	}
+	return nil
+}
+
+func (s *memorySnapshots) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.snapshots)
+}
+
+func TestHydrate_FromRedis(t *testing.T) {
+	f := fakeredis.New(t)
+	ctx := context.Background()
+
+	before := newManager(t, f)
+	before.SyncDailyBudgets(map[string]float64{"s1": 10})
+	if ok, err := before.CheckAndDeduct(ctx, "s1", 6); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+
+	// 重启后的实例同步日预算时花费为0，恢复后与Redis一致
+	restarted := newManager(t, f)
+	restarted.SyncDailyBudgets(map[string]float64{"s1": 10})
+	if err := restarted.Start(ctx, time.Hour); err != nil {
+		t.Fatalf("Start失败: %v", err)
+	}
+	defer restarted.Stop()
+
+	status, err := restarted.GetBudgetStatus("s1")
+	if err != nil {
+		t.Fatalf("GetBudgetStatus失败: %v", err)
+	}
+	if status.Spent != 6 || status.Remaining != 4 {
+		t.Errorf("恢复后的状态 = spent %v, remaining %v, want 6, 4", status.Spent, status.Remaining)
+	}
+	if restarted.HasBudget("s1", 5) {
+		t.Error("恢复后应按已花费的金额过滤")
+	}
+}
+
+func TestHydrate_KeepsNewerSpend(t *testing.T) {
+	f := fakeredis.New(t)
+	ctx := context.Background()
+	m := newManager(t, f)
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 3); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+
+	// 其他实例的扣减在刷新后可见
+	b, _ := m.GetBudget("s1")
+	f.Set(spentKey(b), "500")
+	if err := m.Hydrate(ctx); err != nil {
+		t.Fatalf("Hydrate失败: %v", err)
+	}
+	if b.Spent != 5 {
+		t.Errorf("刷新后的花费 = %v, want 5", b.Spent)
+	}
+
+	// Redis中的花费丢失且没有快照时保留内存中的花费
+	f.Del(spentKey(b))
+	if err := m.Hydrate(ctx); err != nil {
+		t.Fatalf("Hydrate失败: %v", err)
+	}
+	if b.Spent != 5 {
+		t.Errorf("没有花费键时不应清零, got %v", b.Spent)
+	}
+}
+
+func TestHydrate_RestoreFromSnapshot(t *testing.T) {
+	f := fakeredis.New(t)
+	ctx := context.Background()
+	store := newMemorySnapshots()
+
+	before := newManager(t, f)
+	before.SetSnapshotStore(store)
+	before.SyncDailyBudgets(map[string]float64{"s1": 10, "s2": 10})
+	if ok, err := before.CheckAndDeduct(ctx, "s1", 7); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	if err := before.Snapshot(ctx); err != nil {
+		t.Fatalf("Snapshot失败: %v", err)
+	}
+	if store.len() != 1 {
+		t.Fatalf("只应保存有花费的预算, got %d", store.len())
+	}
+
+	// Redis中的花费丢失后，从快照恢复内存和Redis中的花费
+	b, _ := before.GetBudget("s1")
+	key := spentKey(b)
+	f.Del(key)
+
+	restarted := newManager(t, f)
+	restarted.SetSnapshotStore(store)
+	restarted.SyncDailyBudgets(map[string]float64{"s1": 10, "s2": 10})
+	if err := restarted.Hydrate(ctx); err != nil {
+		t.Fatalf("Hydrate失败: %v", err)
+	}
+	status, _ := restarted.GetBudgetStatus("s1")
+	if status.Spent != 7 {
+		t.Errorf("从快照恢复的花费 = %v, want 7", status.Spent)
+	}
+	if spent, ok := getInt(f, key); !ok || spent != 700 {
+		t.Errorf("Redis中恢复的花费 = %d, %v", spent, ok)
+	}
+	if ttl := f.TTL(key); ttl != 48*time.Hour {
+		t.Errorf("恢复的花费键的过期时间 = %v", ttl)
+	}
+
+	// 恢复不覆盖已存在的花费
+	f.Set(key, "900")
+	if err := restarted.Hydrate(ctx); err != nil {
+		t.Fatalf("Hydrate失败: %v", err)
+	}
+	if spent, _ := getInt(f, key); spent != 900 {
+		t.Errorf("花费键存在时不应从快照恢复, got %d", spent)
+	}
+}
+
+func TestHydrate_IgnoresOtherPeriod(t *testing.T) {
+	f := fakeredis.New(t)
+	ctx := context.Background()
+	store := newMemorySnapshots()
+
+	m := newManager(t, f)
+	m.SetSnapshotStore(store)
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	b, _ := m.GetBudget("s1")
+	store.Save(ctx, []models.BudgetSnapshot{{
+		BudgetID:    "s1",
+		PeriodStart: b.StartTime.AddDate(0, 0, -1),
+		Spent:       800,
+		UpdateTime:  time.Now(),
+	}})
+
+	if err := m.Hydrate(ctx); err != nil {
+		t.Fatalf("Hydrate失败: %v", err)
+	}
+	if b.Spent != 0 {
+		t.Errorf("上一周期的快照不应恢复, got %v", b.Spent)
+	}
+	if _, ok := getInt(f, spentKey(b)); ok {
+		t.Error("上一周期的快照不应写入Redis")
+	}
+}
+
+func TestStop_SavesSnapshot(t *testing.T) {
+	f := fakeredis.New(t)
+	ctx := context.Background()
+	store := newMemorySnapshots()
+
+	m := newManager(t, f)
+	m.SetSnapshotStore(store)
+	m.SyncDailyBudgets(map[string]float64{"s1": 10})
+	if err := m.Start(ctx, time.Hour); err != nil {
+		t.Fatalf("Start失败: %v", err)
+	}
+	if ok, err := m.CheckAndDeduct(ctx, "s1", 2); !ok || err != nil {
+		t.Fatalf("扣减 = %v, %v", ok, err)
+	}
+	m.Stop()
+
+	snapshots, _ := store.Load(ctx, []string{"s1"}, time.Time{})
+	if len(snapshots) != 1 || snapshots[0].Spent != 200 {
+		t.Errorf("停止时应保存快照, got %+v", snapshots)
+	}
+}
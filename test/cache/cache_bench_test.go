@@ -0,0 +1,97 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/test/fakeredis"
+)
+
+const (
+	benchKeys    = 200
+	benchLatency = 50 * time.Microsecond
+)
+
+func benchFixture(b *testing.B) *fakeredis.Server {
+	f := fakeredis.New(b)
+	f.SetLatency(benchLatency)
+	for i := 0; i < benchKeys; i++ {
+		f.Set(fmt.Sprintf("creative:%d", i), fmt.Sprintf(`{"id":"%d"}`, i))
+		f.HSet(fmt.Sprintf("stats:hourly:%d", i), map[string]string{"impression": "10", "click": "1"})
+	}
+	return f
+}
+
+func benchKeyList(prefix string) []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return keys
+}
+
+// BenchmarkSequentialGet 迁移前的写法，每个键一次GET
+func BenchmarkSequentialGet(b *testing.B) {
+	rdb, roundTrips := countingClient(b, benchFixture(b))
+	keys := benchKeyList("creative:")
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if _, err := rdb.Get(ctx, key).Bytes(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(roundTrips))/float64(b.N), "roundtrips/op")
+}
+
+func BenchmarkMGet(b *testing.B) {
+	rdb, roundTrips := countingClient(b, benchFixture(b))
+	keys := benchKeyList("creative:")
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.MGet(ctx, rdb, keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(roundTrips))/float64(b.N), "roundtrips/op")
+}
+
+// BenchmarkSequentialHGetAll 迁移前的写法，每个键一次HGETALL
+func BenchmarkSequentialHGetAll(b *testing.B) {
+	rdb, roundTrips := countingClient(b, benchFixture(b))
+	keys := benchKeyList("stats:hourly:")
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, key := range keys {
+			if err := rdb.HGetAll(ctx, key).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(roundTrips))/float64(b.N), "roundtrips/op")
+}
+
+func BenchmarkHGetAll(b *testing.B) {
+	rdb, roundTrips := countingClient(b, benchFixture(b))
+	keys := benchKeyList("stats:hourly:")
+	ctx := context.Background()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.HGetAll(ctx, rdb, keys); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(atomic.LoadInt64(roundTrips))/float64(b.N), "roundtrips/op")
+}
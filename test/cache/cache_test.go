@@ -0,0 +1,142 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/test/fakeredis"
+)
+
+// countingClient 创建只有一个连接的客户端，返回的计数器记录往返次数
+func countingClient(tb testing.TB, f *fakeredis.Server) (*redis.Client, *int64) {
+	rdb := redis.NewClient(&redis.Options{Addr: f.Addr(), PoolSize: 1})
+	tb.Cleanup(func() { rdb.Close() })
+	hook := &roundTripHook{}
+	rdb.AddHook(hook)
+	return rdb, &hook.count
+}
+
+// roundTripHook 统计命令和管道的往返次数
+type roundTripHook struct {
+	count int64
+}
+
+func (h *roundTripHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	atomic.AddInt64(&h.count, 1)
+	return ctx, nil
+}
+
+func (h *roundTripHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (h *roundTripHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	atomic.AddInt64(&h.count, 1)
+	return ctx, nil
+}
+
+func (h *roundTripHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+func TestMGet_OrderAndMissing(t *testing.T) {
+	f := fakeredis.New(t)
+	f.Set("a", "1")
+	f.Set("c", "3")
+	f.HSet("h", map[string]string{"x": "1"})
+	rdb, _ := countingClient(t, f)
+
+	values, err := cache.MGet(context.Background(), rdb, []string{"a", "missing", "h", "c"})
+	if err != nil {
+		t.Fatalf("MGet失败: %v", err)
+	}
+	want := [][]byte{[]byte("1"), nil, nil, []byte("3")}
+	if !reflect.DeepEqual(values, want) {
+		t.Fatalf("MGet = %q, want %q", values, want)
+	}
+}
+
+func TestMGet_Batches(t *testing.T) {
+	f := fakeredis.New(t)
+	keys := make([]string, 2*cache.DefaultBatchSize+1)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+		f.Set(keys[i], fmt.Sprint(i))
+	}
+	rdb, roundTrips := countingClient(t, f)
+
+	counts, err := cache.MGetInt64(context.Background(), rdb, keys)
+	if err != nil {
+		t.Fatalf("MGetInt64失败: %v", err)
+	}
+	for i, n := range counts {
+		if n != int64(i) {
+			t.Fatalf("counts[%d] = %d, want %d", i, n, i)
+		}
+	}
+	if got := atomic.LoadInt64(roundTrips); got != 3 {
+		t.Fatalf("往返次数 = %d, want 3", got)
+	}
+}
+
+func TestMGetJSON(t *testing.T) {
+	type item struct {
+		ID string `json:"id"`
+	}
+	f := fakeredis.New(t)
+	f.Set("item:1", `{"id":"1"}`)
+	f.Set("item:2", `not json`)
+	f.Set("item:3", `{"id":"3"}`)
+	rdb, _ := countingClient(t, f)
+
+	var invalid []string
+	items, err := cache.MGetJSON[*item](context.Background(), rdb, []string{"item:1", "item:2", "item:missing", "item:3"},
+		func(key string, err error) { invalid = append(invalid, key) })
+	if err != nil {
+		t.Fatalf("MGetJSON失败: %v", err)
+	}
+	if len(items) != 2 || items[0].ID != "1" || items[1].ID != "3" {
+		t.Fatalf("items = %+v", items)
+	}
+	if !reflect.DeepEqual(invalid, []string{"item:2"}) {
+		t.Fatalf("解码失败的键 = %v, want [item:2]", invalid)
+	}
+}
+
+func TestHGetAll(t *testing.T) {
+	f := fakeredis.New(t)
+	f.HSet("h1", map[string]string{"bid": "3", "win": "1"})
+	f.Set("s", "1")
+	rdb, roundTrips := countingClient(t, f)
+
+	hashes, err := cache.HGetAll(context.Background(), rdb, []string{"h1", "missing", "s"})
+	if err != nil {
+		t.Fatalf("HGetAll失败: %v", err)
+	}
+	want := []map[string]string{{"bid": "3", "win": "1"}, {}, {}}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Fatalf("HGetAll = %v, want %v", hashes, want)
+	}
+	if got := atomic.LoadInt64(roundTrips); got != 1 {
+		t.Fatalf("往返次数 = %d, want 1", got)
+	}
+}
+
+func TestMGet_Empty(t *testing.T) {
+	f := fakeredis.New(t)
+	rdb, roundTrips := countingClient(t, f)
+
+	values, err := cache.MGet(context.Background(), rdb, nil)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("MGet(nil) = %v, %v", values, err)
+	}
+	if got := atomic.LoadInt64(roundTrips); got != 0 {
+		t.Fatalf("没有键时不应访问Redis, 往返次数 = %d", got)
+	}
+}
@@ -0,0 +1,225 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"simple-dsp/pkg/cache"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+// source 模拟数据源，记录加载次数
+type source struct {
+	mu      sync.Mutex
+	values  map[string]string
+	loads   int64
+	delay   time.Duration
+	release chan struct{}
+}
+
+func newSource() *source {
+	return &source{values: make(map[string]string)}
+}
+
+func (s *source) set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = value
+}
+
+func (s *source) load(ctx context.Context, key string) (string, error) {
+	atomic.AddInt64(&s.loads, 1)
+	if s.release != nil {
+		<-s.release
+	}
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.values[key]
+	if !ok {
+		return "", fmt.Errorf("键不存在: %s", key)
+	}
+	return value, nil
+}
+
+func (s *source) loadCount() int64 {
+	return atomic.LoadInt64(&s.loads)
+}
+
+func newTiered(opts cache.TieredOptions, rdb redis.UniversalClient, src *source) *cache.Tiered[string] {
+	return cache.NewTiered[string](opts, rdb, src.load, logger.NewLogger(zap.NewNop()))
+}
+
+func mustGet(t *testing.T, c *cache.Tiered[string], key, want string) {
+	t.Helper()
+	got, err := c.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Get(%s)失败: %v", key, err)
+	}
+	if got != want {
+		t.Fatalf("Get(%s) = %q, want %q", key, got, want)
+	}
+}
+
+func TestTiered_Singleflight(t *testing.T) {
+	src := newSource()
+	src.set("k", "v1")
+	src.delay = 20 * time.Millisecond
+	c := newTiered(cache.TieredOptions{Name: "test"}, nil, src)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.Get(context.Background(), "k"); err != nil || got != "v1" {
+				t.Errorf("Get = %q, %v", got, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := src.loadCount(); n != 1 {
+		t.Fatalf("并发未命中加载次数 = %d, want 1", n)
+	}
+
+	mustGet(t, c, "k", "v1")
+	if n := src.loadCount(); n != 1 {
+		t.Fatalf("本地命中不应加载, 加载次数 = %d", n)
+	}
+}
+
+func TestTiered_LoadError(t *testing.T) {
+	src := newSource()
+	c := newTiered(cache.TieredOptions{Name: "test"}, nil, src)
+
+	if _, err := c.Get(context.Background(), "missing"); err == nil {
+		t.Fatal("加载失败时应返回错误")
+	}
+	// 加载失败的结果不缓存
+	src.set("missing", "v")
+	mustGet(t, c, "missing", "v")
+}
+
+func TestTiered_LRUAndTTL(t *testing.T) {
+	src := newSource()
+	for _, key := range []string{"a", "b", "c"} {
+		src.set(key, key)
+	}
+	c := newTiered(cache.TieredOptions{Name: "test", Size: 2, LocalTTL: 50 * time.Millisecond}, nil, src)
+
+	mustGet(t, c, "a", "a")
+	mustGet(t, c, "b", "b")
+	mustGet(t, c, "a", "a")
+	// 超过大小时淘汰最久未使用的b
+	mustGet(t, c, "c", "c")
+	mustGet(t, c, "a", "a")
+	if n := src.loadCount(); n != 3 {
+		t.Fatalf("加载次数 = %d, want 3", n)
+	}
+	mustGet(t, c, "b", "b")
+	if n := src.loadCount(); n != 4 {
+		t.Fatalf("被淘汰的键应重新加载, 加载次数 = %d", n)
+	}
+
+	// 过期后重新加载
+	time.Sleep(60 * time.Millisecond)
+	src.set("a", "a2")
+	mustGet(t, c, "a", "a2")
+}
+
+func TestTiered_RemoteTier(t *testing.T) {
+	f := fakeredis.New(t)
+	rdb, _ := countingClient(t, f)
+	src := newSource()
+	src.set("k", "v1")
+	opts := cache.TieredOptions{Name: "test", RemoteTTL: time.Minute}
+	a, b := newTiered(opts, rdb, src), newTiered(opts, rdb, src)
+
+	mustGet(t, a, "k", "v1")
+	if value, ok := f.Get(cache.RemoteKey("test", "k")); !ok || value != `"v1"` {
+		t.Fatalf("Redis中的值 = %q, %v", value, ok)
+	}
+	// 其他实例从Redis读取，不访问数据源
+	mustGet(t, b, "k", "v1")
+	if n := src.loadCount(); n != 1 {
+		t.Fatalf("加载次数 = %d, want 1", n)
+	}
+
+	// Redis中的值无效时从数据源加载
+	f.Set(cache.RemoteKey("test", "bad"), "not json")
+	src.set("bad", "v")
+	mustGet(t, b, "bad", "v")
+}
+
+func TestTiered_Invalidate(t *testing.T) {
+	f := fakeredis.New(t)
+	rdb, _ := countingClient(t, f)
+	src := newSource()
+	src.set("k", "v1")
+	opts := cache.TieredOptions{Name: "test", RemoteTTL: time.Minute}
+	a, b := newTiered(opts, rdb, src), newTiered(opts, rdb, src)
+	a.Start()
+	defer a.Stop()
+	b.Start()
+	defer b.Stop()
+
+	mustGet(t, a, "k", "v1")
+	mustGet(t, b, "k", "v1")
+
+	src.set("k", "v2")
+	if err := a.Invalidate(context.Background(), "k"); err != nil {
+		t.Fatalf("Invalidate失败: %v", err)
+	}
+	if _, ok := f.Get(cache.RemoteKey("test", "k")); ok {
+		t.Fatal("失效后应删除Redis中的值")
+	}
+	mustGet(t, a, "k", "v2")
+
+	// 其他实例收到失效通知后重新读取
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, err := b.Get(context.Background(), "k")
+		if err == nil && got == "v2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("其他实例未收到失效通知, Get = %q, %v", got, err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestTiered_ForgetDuringLoad(t *testing.T) {
+	src := newSource()
+	src.set("k", "v1")
+	src.release = make(chan struct{})
+	c := newTiered(cache.TieredOptions{Name: "test"}, nil, src)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Get(context.Background(), "k")
+	}()
+	for src.loadCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 加载期间失效，旧的加载结果不写入本地缓存
+	c.Forget("k")
+	src.set("k", "v2")
+	close(src.release)
+	<-done
+
+	mustGet(t, c, "k", "v2")
+	if n := src.loadCount(); n != 2 {
+		t.Fatalf("加载次数 = %d, want 2", n)
+	}
+}
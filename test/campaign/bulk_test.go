@@ -0,0 +1,74 @@
+package campaign_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"simple-dsp/internal/campaign"
+)
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		current string
+		want    string
+		wantErr error
+	}{
+		{name: "暂停投放中的计划", action: campaign.ActionPause, current: campaign.StatusActive, want: campaign.StatusPaused},
+		{name: "恢复已暂停的计划", action: campaign.ActionResume, current: campaign.StatusPaused, want: campaign.StatusActive},
+		{name: "启用草稿计划", action: campaign.ActionResume, current: campaign.StatusDraft, want: campaign.StatusActive},
+		{name: "归档已暂停的计划", action: campaign.ActionArchive, current: campaign.StatusPaused, want: campaign.StatusArchived},
+		{name: "重复暂停", action: campaign.ActionPause, current: campaign.StatusPaused, wantErr: campaign.ErrInvalidTransition},
+		{name: "暂停草稿计划", action: campaign.ActionPause, current: campaign.StatusDraft, wantErr: campaign.ErrInvalidTransition},
+		{name: "恢复投放中的计划", action: campaign.ActionResume, current: campaign.StatusActive, wantErr: campaign.ErrInvalidTransition},
+		{name: "操作已归档的计划", action: campaign.ActionResume, current: campaign.StatusArchived, wantErr: campaign.ErrInvalidTransition},
+		{name: "未知操作", action: "delete", current: campaign.StatusActive, wantErr: campaign.ErrInvalidAction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := campaign.NextStatus(tt.action, tt.current)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NextStatus() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NextStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyBudgetChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		current float64
+		value   float64
+		want    float64
+		wantErr error
+	}{
+		{name: "直接设置", mode: campaign.BudgetModeSet, current: 100, value: 250, want: 250},
+		{name: "增加", mode: campaign.BudgetModeIncrease, current: 100, value: 20.5, want: 120.5},
+		{name: "减少", mode: campaign.BudgetModeDecrease, current: 100, value: 30, want: 70},
+		{name: "按比例缩放并保留两位小数", mode: campaign.BudgetModeScale, current: 33.33, value: 1.1, want: 36.66},
+		{name: "减少后为负", mode: campaign.BudgetModeDecrease, current: 10, value: 20, wantErr: campaign.ErrInvalidBudgetValue},
+		{name: "缩放比例为0", mode: campaign.BudgetModeScale, current: 10, value: 0, wantErr: campaign.ErrInvalidBudgetValue},
+		{name: "负数调整值", mode: campaign.BudgetModeIncrease, current: 10, value: -1, wantErr: campaign.ErrInvalidBudgetValue},
+		{name: "NaN", mode: campaign.BudgetModeSet, current: 10, value: math.NaN(), wantErr: campaign.ErrInvalidBudgetValue},
+		{name: "未知方式", mode: "double", current: 10, value: 2, wantErr: campaign.ErrInvalidBudgetMode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := campaign.ApplyBudgetChange(tt.mode, tt.current, tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ApplyBudgetChange() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ApplyBudgetChange() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package campaign_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+// waitFor 等待条件成立，超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// newAdmin 创建设置了发布者的管理后台配置管理器
+func newAdmin(f *fakeredis.Server, t *testing.T) *campaign.ConfigManager {
+	admin := campaign.NewConfigManager()
+	admin.SetNotifier(campaign.NewPublisher(f.Client(t), logger.NewLogger(zap.NewNop())))
+	return admin
+}
+
+// startBidder 创建竞价实例的配置管理器并启动订阅
+func startBidder(f *fakeredis.Server, t *testing.T) *campaign.ConfigManager {
+	bidder := campaign.NewConfigManager()
+	sub := campaign.NewSubscriber(f.Client(t), bidder, time.Hour, logger.NewLogger(zap.NewNop()))
+	sub.Start()
+	t.Cleanup(sub.Stop)
+	return bidder
+}
+
+func budgetOf(m *campaign.ConfigManager, campaignID string) float64 {
+	config, ok := m.GetConfig(campaignID)
+	if !ok {
+		return -1
+	}
+	return config.Budget
+}
+
+func TestDistribution_PropagatesChanges(t *testing.T) {
+	f := fakeredis.New(t)
+	admin := newAdmin(f, t)
+	bidder := startBidder(f, t)
+
+	config := newTestConfig()
+	if err := admin.SetConfig(config); err != nil {
+		t.Fatalf("SetConfig失败: %v", err)
+	}
+	waitFor(t, "新增配置同步到竞价实例", func() bool { return budgetOf(bidder, "c1") == 1000 })
+
+	updated := newTestConfig()
+	updated.Budget = 2000
+	if err := admin.SetConfig(updated); err != nil {
+		t.Fatalf("SetConfig失败: %v", err)
+	}
+	waitFor(t, "修改配置同步到竞价实例", func() bool { return budgetOf(bidder, "c1") == 2000 })
+	got, _ := bidder.GetConfig("c1")
+	if got.TrackingConfigs[campaign.TrackingTypeClick].URL != "https://track.example.com/click" {
+		t.Fatalf("同步的配置不完整: %+v", got)
+	}
+
+	admin.RemoveConfig("c1")
+	waitFor(t, "删除配置同步到竞价实例", func() bool { return budgetOf(bidder, "c1") == -1 })
+	if n := f.HLen("campaign:configs"); n != 0 {
+		t.Fatalf("删除后全量哈希字段数 = %d, want 0", n)
+	}
+}
+
+func TestSubscriber_InitialResync(t *testing.T) {
+	f := fakeredis.New(t)
+	admin := newAdmin(f, t)
+	if err := admin.SetConfig(newTestConfig()); err != nil {
+		t.Fatalf("SetConfig失败: %v", err)
+	}
+
+	// 启动前发布的配置在启动时全量同步
+	bidder := startBidder(f, t)
+	if budgetOf(bidder, "c1") != 1000 {
+		t.Fatal("启动后应已同步全量配置")
+	}
+}
+
+func TestSubscriber_ResyncAfterReconnect(t *testing.T) {
+	f := fakeredis.New(t)
+	bidder := startBidder(f, t)
+
+	// 订阅断开期间的修改没有通知，重连后全量同步
+	f.DropSubscribers()
+	config := newTestConfig()
+	config.UpdateTime = time.Now()
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	f.HSet("campaign:configs", map[string]string{"c1": string(data)})
+
+	waitFor(t, "重连后全量同步", func() bool { return budgetOf(bidder, "c1") == 1000 })
+}
+
+func TestConfigManager_Replace(t *testing.T) {
+	m := campaign.NewConfigManager()
+	newer := newTestConfig()
+	if err := m.SetConfig(newer); err != nil {
+		t.Fatalf("SetConfig失败: %v", err)
+	}
+	other := newTestConfig()
+	other.CampaignID = "c2"
+	if err := m.SetConfig(other); err != nil {
+		t.Fatalf("SetConfig失败: %v", err)
+	}
+
+	// 全量数据中的c1旧于本地时保留本地，不在全量数据中的c2被移除
+	older := newTestConfig()
+	older.Budget = 1
+	older.UpdateTime = newer.UpdateTime.Add(-time.Minute)
+	added := newTestConfig()
+	added.CampaignID = "c3"
+	m.Replace([]*campaign.Config{older, added})
+
+	if got := budgetOf(m, "c1"); got != 1000 {
+		t.Fatalf("c1的预算 = %v, want 1000", got)
+	}
+	if _, ok := m.GetConfig("c2"); ok {
+		t.Fatal("不在全量数据中的配置应被移除")
+	}
+	if _, ok := m.GetConfig("c3"); !ok {
+		t.Fatal("全量数据中新增的配置应被加入")
+	}
+}
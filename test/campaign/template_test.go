@@ -0,0 +1,119 @@
+package campaign_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/campaign"
+)
+
+func newTestConfig() *campaign.Config {
+	return &campaign.Config{
+		CampaignID:   "c1",
+		Name:         "春季促销",
+		AdvertiserID: "adv1",
+		Status:       campaign.StatusActive,
+		StartTime:    time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:      time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC),
+		Budget:       1000,
+		BidStrategy:  "cpc",
+		Targeting: &campaign.TargetingConfig{
+			Locations:   []string{"beijing"},
+			CustomRules: map[string]string{"app": "news"},
+		},
+		TrackingConfigs: map[campaign.TrackingType]*campaign.TrackingConfig{
+			campaign.TrackingTypeClick: {
+				URL:     "https://track.example.com/click",
+				Headers: map[string]string{"X-Token": "t"},
+				Enabled: true,
+			},
+		},
+	}
+}
+
+func TestTargeting_Audiences(t *testing.T) {
+	config := newTestConfig()
+	config.Targeting.Audiences = []string{"visitors", "cart"}
+
+	got := config.Targeting.AudienceSegments(config.AdvertiserID)
+	if len(got) != 2 || got[0] != "pixel:adv1:visitors" || got[1] != "pixel:adv1:cart" {
+		t.Fatalf("AudienceSegments() = %v", got)
+	}
+
+	manager := campaign.NewConfigManager()
+	if err := manager.SetConfig(config); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+	config.Targeting.Audiences = []string{"bad name"}
+	if err := manager.SetConfig(config); err == nil {
+		t.Fatal("无效的人群名称应被拒绝")
+	}
+}
+
+func TestConfig_Clone(t *testing.T) {
+	source := newTestConfig()
+
+	clone := source.Clone("c2", "")
+	if clone.CampaignID != "c2" || clone.Status != campaign.StatusDraft {
+		t.Fatalf("Clone() id/status = %s/%s, want c2/%s", clone.CampaignID, clone.Status, campaign.StatusDraft)
+	}
+	if clone.Name != "春季促销 (副本)" {
+		t.Errorf("Clone() name = %q", clone.Name)
+	}
+	if clone.Budget != source.Budget || clone.BidStrategy != source.BidStrategy || !clone.StartTime.Equal(source.StartTime) {
+		t.Errorf("Clone() 未复制预算、出价策略或投放时间")
+	}
+
+	// 修改副本不影响原计划
+	clone.Targeting.Locations[0] = "shanghai"
+	clone.Targeting.CustomRules["app"] = "game"
+	clone.TrackingConfigs[campaign.TrackingTypeClick].URL = "https://other.example.com"
+	clone.TrackingConfigs[campaign.TrackingTypeClick].Headers["X-Token"] = "x"
+
+	if source.Targeting.Locations[0] != "beijing" || source.Targeting.CustomRules["app"] != "news" {
+		t.Errorf("修改副本定向影响了原计划: %+v", source.Targeting)
+	}
+	click := source.TrackingConfigs[campaign.TrackingTypeClick]
+	if click.URL != "https://track.example.com/click" || click.Headers["X-Token"] != "t" {
+		t.Errorf("修改副本跟踪配置影响了原计划: %+v", click)
+	}
+}
+
+func TestTemplate_RoundTrip(t *testing.T) {
+	source := newTestConfig()
+
+	if _, err := source.ToTemplate("t1", ""); !errors.Is(err, campaign.ErrTemplateNameRequired) {
+		t.Fatalf("ToTemplate() error = %v, want %v", err, campaign.ErrTemplateNameRequired)
+	}
+
+	template, err := source.ToTemplate("t1", "促销模板")
+	if err != nil {
+		t.Fatalf("ToTemplate() error = %v", err)
+	}
+	if err := campaign.ValidateTemplate(template); err != nil {
+		t.Fatalf("ValidateTemplate() error = %v", err)
+	}
+
+	start := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	config := template.NewConfig("c3", "夏季促销", "", start, end)
+	if config.AdvertiserID != "adv1" {
+		t.Errorf("NewConfig() advertiser = %q, want adv1", config.AdvertiserID)
+	}
+	if config.Status != campaign.StatusDraft || !config.StartTime.Equal(start) || !config.EndTime.Equal(end) {
+		t.Errorf("NewConfig() status/time = %s %v-%v", config.Status, config.StartTime, config.EndTime)
+	}
+	if config.Targeting.Locations[0] != "beijing" || config.TrackingConfigs[campaign.TrackingTypeClick] == nil {
+		t.Errorf("NewConfig() 未复制定向或跟踪配置")
+	}
+	if err := campaign.ValidateConfig(config); err != nil {
+		t.Errorf("ValidateConfig() error = %v", err)
+	}
+
+	other := template.NewConfig("c4", "代理投放", "adv2", start, end)
+	if other.AdvertiserID != "adv2" {
+		t.Errorf("NewConfig() advertiser = %q, want adv2", other.AdvertiserID)
+	}
+}
@@ -0,0 +1,166 @@
+package chaos_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/segmentio/kafka-go"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"simple-dsp/pkg/chaos"
+	"simple-dsp/pkg/config"
+)
+
+// alwaysError 每次调用都注入错误
+var alwaysError = config.FaultConfig{ErrorRate: 1}
+
+func TestNewInjector_Disabled(t *testing.T) {
+	inj := chaos.NewInjector(chaos.DependencyRedis, config.FaultConfig{Latency: time.Second}, nil)
+	if inj != nil {
+		t.Fatal("比例都为0时不应创建注入器")
+	}
+	if err := inj.Inject(context.Background()); err != nil {
+		t.Errorf("nil注入器不应注入故障, got %v", err)
+	}
+}
+
+func TestInjector_Error(t *testing.T) {
+	inj := chaos.NewInjector(chaos.DependencyKafka, alwaysError, nil)
+	err := inj.Inject(context.Background())
+	if !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("应返回注入的错误, got %v", err)
+	}
+}
+
+func TestInjector_Latency(t *testing.T) {
+	inj := chaos.NewInjector(chaos.DependencyRTA, config.FaultConfig{LatencyRate: 1, Latency: 20 * time.Millisecond}, nil)
+	start := time.Now()
+	if err := inj.Inject(context.Background()); err != nil {
+		t.Fatalf("只注入延迟时不应返回错误, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("应注入20ms延迟, got %v", elapsed)
+	}
+}
+
+func TestInjector_LatencyContextDone(t *testing.T) {
+	inj := chaos.NewInjector(chaos.DependencyRTA, config.FaultConfig{LatencyRate: 1, Latency: time.Minute}, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := inj.Inject(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("延迟期间超时应返回context的错误, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("超时后应提前返回, got %v", elapsed)
+	}
+}
+
+func TestRedisHook(t *testing.T) {
+	// 注入错误时命令不发送，地址不可达也不影响结果
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1"})
+	defer client.Close()
+	client.AddHook(chaos.NewRedisHook(chaos.NewInjector(chaos.DependencyRedis, alwaysError, nil)))
+
+	ctx := context.Background()
+	if err := client.Get(ctx, "key").Err(); !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("命令应返回注入的错误, got %v", err)
+	}
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, "counter")
+		return nil
+	})
+	if !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("管道应返回注入的错误, got %v", err)
+	}
+}
+
+// fakeKafkaTransport 记录请求的Kafka Transport
+type fakeKafkaTransport struct {
+	calls int
+}
+
+func (f *fakeKafkaTransport) RoundTrip(ctx context.Context, addr net.Addr, req kafka.Request) (kafka.Response, error) {
+	f.calls++
+	return nil, nil
+}
+
+func TestKafkaTransport(t *testing.T) {
+	next := &fakeKafkaTransport{}
+	transport := chaos.NewKafkaTransport(chaos.NewInjector(chaos.DependencyKafka, alwaysError, nil), next)
+	if _, err := transport.RoundTrip(context.Background(), nil, nil); !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("应返回注入的错误, got %v", err)
+	}
+	if next.calls != 0 {
+		t.Errorf("注入错误时不应发送请求, got %d次", next.calls)
+	}
+
+	transport = chaos.NewKafkaTransport(nil, next)
+	if _, err := transport.RoundTrip(context.Background(), nil, nil); err != nil {
+		t.Fatalf("未注入时应正常发送, got %v", err)
+	}
+	if next.calls != 1 {
+		t.Errorf("未注入时应发送请求, got %d次", next.calls)
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: chaos.NewHTTPTransport(chaos.NewInjector(chaos.DependencyRTA, alwaysError, nil), nil)}
+	if _, err := client.Get(server.URL); !errors.Is(err, chaos.ErrInjected) {
+		t.Fatalf("应返回注入的错误, got %v", err)
+	}
+	if calls != 0 {
+		t.Errorf("注入错误时不应发送请求, got %d次", calls)
+	}
+
+	client = &http.Client{Transport: chaos.NewHTTPTransport(nil, nil)}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("未注入时应正常发送, got %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("未注入时应发送请求, got %d次", calls)
+	}
+}
+
+func TestGormPlugin(t *testing.T) {
+	// 注入错误时语句不执行，不连接数据库
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=127.0.0.1 port=1 user=dsp dbname=dsp sslmode=disable"}), &gorm.Config{
+		Logger:               gormlogger.Default.LogMode(gormlogger.Silent),
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.Use(chaos.NewGormPlugin(chaos.NewInjector(chaos.DependencyPostgres, alwaysError, nil))); err != nil {
+		t.Fatalf("注册插件失败: %v", err)
+	}
+
+	var rows []map[string]interface{}
+	if err := db.Table("campaigns").Find(&rows).Error; !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("查询应返回注入的错误, got %v", err)
+	}
+	if err := db.Exec("UPDATE campaigns SET status = 1").Error; !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("原生语句应返回注入的错误, got %v", err)
+	}
+	if err := db.Table("campaigns").Create(map[string]interface{}{"name": "x"}).Error; !errors.Is(err, chaos.ErrInjected) {
+		t.Errorf("写入应返回注入的错误, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package clock_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/clock"
+)
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := clock.Real().Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Errorf("系统时钟应返回当前时间, got %v", now)
+	}
+	if _, ok := clock.OrReal(nil).(*clock.Fake); ok {
+		t.Error("nil应替换为系统时钟")
+	}
+	fake := clock.NewFake(before)
+	if clock.OrReal(fake) != clock.Clock(fake) {
+		t.Error("非nil的时钟应原样返回")
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 10, 16, 23, 59, 59, 0, time.UTC)
+	fake := clock.NewFake(start)
+	if !fake.Now().Equal(start) || !fake.Now().Equal(start) {
+		t.Fatalf("未推进时时间不变, got %v", fake.Now())
+	}
+
+	if got := fake.Advance(time.Second); !got.Equal(start.Add(time.Second)) || got.Day() != 17 {
+		t.Errorf("推进后应跨过零点, got %v", got)
+	}
+	later := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	fake.Set(later)
+	if !fake.Now().Equal(later) {
+		t.Errorf("设置后时间应为%v, got %v", later, fake.Now())
+	}
+
+	// 并发推进，结果与顺序无关
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fake.Advance(time.Millisecond)
+			fake.Now()
+		}()
+	}
+	wg.Wait()
+	if got := fake.Now(); !got.Equal(later.Add(100 * time.Millisecond)) {
+		t.Errorf("并发推进后时间错误, got %v", got)
+	}
+}
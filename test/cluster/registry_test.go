@@ -0,0 +1,159 @@
+package cluster_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/pkg/cluster"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+const testHeartbeat = 20 * time.Millisecond
+
+func newRegistry(t *testing.T, f *fakeredis.Server, service, id string) *cluster.Registry {
+	t.Helper()
+	r := cluster.NewRegistry(config.ClusterConfig{
+		InstanceID:        id,
+		HeartbeatInterval: testHeartbeat,
+		ShardCount:        32,
+	}, f.Client(t), service, logger.NewLogger(zap.NewNop()))
+	r.Start()
+	t.Cleanup(r.Stop)
+	return r
+}
+
+// register 直接写入一个实例，模拟异常退出的实例
+func register(f *fakeredis.Server, member, data string, heartbeat time.Time) {
+	f.Set("instance:"+member, data)
+	f.ZAdd("instances", member, float64(heartbeat.UnixMilli()))
+}
+
+// waitFor 等待条件成立，超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func instanceIDs(t *testing.T, r *cluster.Registry, service string) []string {
+	t.Helper()
+	instances, err := r.Instances(context.Background(), service)
+	if err != nil {
+		t.Fatalf("列出实例失败: %v", err)
+	}
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = instance.Service + "/" + instance.ID
+	}
+	return ids
+}
+
+func TestRegistry_Instances(t *testing.T) {
+	f := fakeredis.New(t)
+	b := newRegistry(t, f, "dsp-server", "b")
+	a := newRegistry(t, f, "dsp-server", "a")
+	newRegistry(t, f, "admin-server", "x")
+
+	if got := fmt.Sprint(instanceIDs(t, a, "dsp-server")); got != "[dsp-server/a dsp-server/b]" {
+		t.Fatalf("dsp-server实例 = %s", got)
+	}
+	if got := fmt.Sprint(instanceIDs(t, b, "")); got != "[admin-server/x dsp-server/a dsp-server/b]" {
+		t.Fatalf("所有实例 = %s", got)
+	}
+
+	// 超过三倍心跳间隔未心跳的实例不再列出，并从索引中清理
+	register(f, "dsp-server:crashed", `{"id":"crashed","service":"dsp-server"}`, time.Now().Add(-time.Minute))
+	if got := fmt.Sprint(instanceIDs(t, a, "dsp-server")); got != "[dsp-server/a dsp-server/b]" {
+		t.Fatalf("过期实例不应列出: %s", got)
+	}
+	if _, ok := f.ZScore("instances", "dsp-server:crashed"); ok {
+		t.Fatal("过期实例应从索引中清理")
+	}
+
+	// 注销后不再列出
+	b.Stop()
+	if got := fmt.Sprint(instanceIDs(t, a, "dsp-server")); got != "[dsp-server/a]" {
+		t.Fatalf("注销后的实例 = %s", got)
+	}
+}
+
+func TestRegistry_Shards(t *testing.T) {
+	f := fakeredis.New(t)
+	a := newRegistry(t, f, "dsp-server", "a")
+	b := newRegistry(t, f, "dsp-server", "b")
+	c := newRegistry(t, f, "dsp-server", "c")
+	registries := []*cluster.Registry{a, b, c}
+
+	// 成员列表在下一次心跳时刷新，刷新后各实例的分片互不重叠且覆盖所有分片
+	covered := func() bool {
+		owners := make(map[int]int)
+		for _, r := range registries {
+			for _, shard := range r.Shards() {
+				owners[shard]++
+			}
+		}
+		for shard := 0; shard < a.ShardCount(); shard++ {
+			if owners[shard] != 1 {
+				return false
+			}
+		}
+		return true
+	}
+	waitFor(t, "分片分配完成", covered)
+	for _, r := range registries {
+		if len(r.Shards()) == 0 {
+			t.Fatalf("实例%s没有分配到分片", r.ID())
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("adx:creative-%d", i)
+		owners := 0
+		for _, r := range registries {
+			if r.Owns(key) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("键%s的负责实例数 = %d", key, owners)
+		}
+	}
+
+	// c下线后只迁移c的分片，a和b原有的分片不变
+	before := map[string][]int{"a": a.Shards(), "b": b.Shards()}
+	c.Stop()
+	registries = registries[:2]
+	waitFor(t, "c的分片迁移", covered)
+	for _, r := range registries {
+		owned := make(map[int]bool)
+		for _, shard := range r.Shards() {
+			owned[shard] = true
+		}
+		for _, shard := range before[r.ID()] {
+			if !owned[shard] {
+				t.Fatalf("实例%s的分片%d不应迁移", r.ID(), shard)
+			}
+		}
+	}
+}
+
+func TestRegistry_OwnsAllWhenAlone(t *testing.T) {
+	r := cluster.NewRegistry(config.ClusterConfig{InstanceID: "solo", ShardCount: 8}, nil, "dsp-server", logger.NewLogger(zap.NewNop()))
+	if got := len(r.Shards()); got != 8 {
+		t.Fatalf("未读取到成员时应负责所有分片, got %d", got)
+	}
+	if !r.Owns("anything") {
+		t.Fatal("未读取到成员时应负责所有键")
+	}
+}
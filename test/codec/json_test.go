@@ -0,0 +1,160 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/internal/traffic"
+	"simple-dsp/pkg/codec"
+)
+
+// 一致性测试：确保当前JSON实现与encoding/json的线上报文完全一致
+// 运行方式:
+//   go test ./test/codec
+//   go test -tags jsoniter ./test/codec
+//   go test -tags sonic ./test/codec
+
+func conformanceValues() []struct {
+	name  string
+	value interface{}
+} {
+	return []struct {
+		name  string
+		value interface{}
+	}{
+		{
+			name: "流量请求",
+			value: traffic.Request{
+				RequestID: "req-1",
+				UserID:    "user-1",
+				DeviceID:  "device-1",
+				IP:        "127.0.0.1",
+				UserAgent: "Mozilla/5.0 (Linux; Android 13)",
+				AdSlots: []traffic.AdSlot{
+					{SlotID: "slot-1", Width: 320, Height: 50, MinPrice: 0.5, MaxPrice: 12.75, Position: "banner", AdType: "display"},
+				},
+				Timestamp:   1700000000000,
+				TMax:        120,
+				ExtraParams: map[string]string{"os": "android", "geo": "CN-11", "app": "demo"},
+			},
+		},
+		{
+			name: "流量响应",
+			value: traffic.Response{
+				RequestID: "req-1",
+				Message:   "success",
+				Data: []traffic.AdResult{
+					{SlotID: "slot-1", AdID: "ad-1", BidPrice: 1.2345678, AdMarkup: `<a href="https://example.com/?a=1&b=2">点击</a>`, WinNotice: "https://win.example.com/?price=${AUCTION_PRICE}"},
+				},
+			},
+		},
+		{
+			name:  "空数据响应",
+			value: traffic.Response{RequestID: "req-2", Message: "没有可用的广告", Data: []traffic.AdResult{}},
+		},
+		{
+			name:  "nil切片和nil映射",
+			value: traffic.Request{RequestID: "req-3"},
+		},
+		{
+			name: "事件",
+			value: stats.Event{
+				EventType: stats.EventClick,
+				RequestID: "req-4",
+				AdID:      "ad-4",
+				BidPrice:  0.1,
+				WinPrice:  1e-7,
+				Timestamp: time.Date(2024, 5, 1, 8, 30, 0, 123456789, time.FixedZone("CST", 8*3600)),
+			},
+		},
+		{
+			name:  "特殊字符",
+			value: map[string]interface{}{"html": "<script>&</script>", "unicode": "  中文", "control": "\t\n"},
+		},
+		{
+			name:  "浮点边界",
+			value: []float64{0, -0.5, 1e21, 1e-7, 123456789.123456789, 0.000001},
+		},
+	}
+}
+
+func TestMarshalConformance(t *testing.T) {
+	t.Logf("当前JSON实现: %s", codec.Name())
+
+	for _, tt := range conformanceValues() {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			got, err := codec.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("codec.Marshal() error = %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("codec.Marshal() = %s, want %s", got, want)
+			}
+
+			// 编码器输出与标准库一致（包括结尾换行）
+			var wantBuf, gotBuf bytes.Buffer
+			if err := json.NewEncoder(&wantBuf).Encode(tt.value); err != nil {
+				t.Fatalf("json.Encoder.Encode() error = %v", err)
+			}
+			if err := codec.NewEncoder(&gotBuf).Encode(tt.value); err != nil {
+				t.Fatalf("codec.Encoder.Encode() error = %v", err)
+			}
+			if !bytes.Equal(gotBuf.Bytes(), wantBuf.Bytes()) {
+				t.Errorf("codec.Encoder.Encode() = %s, want %s", gotBuf.Bytes(), wantBuf.Bytes())
+			}
+		})
+	}
+}
+
+func TestUnmarshalConformance(t *testing.T) {
+	for _, tt := range conformanceValues() {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+
+			want := reflect.New(reflect.TypeOf(tt.value))
+			got := reflect.New(reflect.TypeOf(tt.value))
+			if err := json.Unmarshal(data, want.Interface()); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if err := codec.NewDecoder(bytes.NewReader(data)).Decode(got.Interface()); err != nil {
+				t.Fatalf("codec.Decoder.Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+				t.Errorf("codec.Decoder.Decode() = %+v, want %+v", got.Elem(), want.Elem())
+			}
+		})
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "空请求体", data: ""},
+		{name: "截断的JSON", data: `{"request_id":"req-1"`},
+		{name: "类型不匹配", data: `{"ad_slots":"slot-1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want, got traffic.Request
+			wantErr := json.NewDecoder(bytes.NewReader([]byte(tt.data))).Decode(&want)
+			gotErr := codec.NewDecoder(bytes.NewReader([]byte(tt.data))).Decode(&got)
+			if (gotErr != nil) != (wantErr != nil) {
+				t.Errorf("codec.Decoder.Decode() error = %v, want %v", gotErr, wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package creative_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/creative/approval"
+	"simple-dsp/internal/creative/types"
+	"simple-dsp/internal/exchange"
+	"simple-dsp/pkg/logger"
+)
+
+var (
+	_ approval.Store          = (*redis.Client)(nil)
+	_ approval.Store          = (*redis.ClusterClient)(nil)
+	_ approval.CreativeSource = (*memoryStorage)(nil)
+)
+
+// fakeConnector 内存实现的交易平台审核接口
+type fakeConnector struct {
+	mu        sync.Mutex
+	prefix    string
+	submitErr error
+	statuses  map[string]approval.Status
+	reasons   map[string]string
+	queried   int
+}
+
+func newFakeConnector(prefix string) *fakeConnector {
+	return &fakeConnector{prefix: prefix, statuses: map[string]approval.Status{}, reasons: map[string]string{}}
+}
+
+func (f *fakeConnector) Submit(ctx context.Context, creative *types.Creative) (string, approval.Status, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.submitErr != nil {
+		return "", "", f.submitErr
+	}
+	externalID := f.prefix + creative.ID
+	f.statuses[externalID] = approval.StatusPending
+	return externalID, approval.StatusPending, nil
+}
+
+func (f *fakeConnector) Status(ctx context.Context, externalID string) (approval.Status, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queried++
+	return f.statuses[externalID], f.reasons[externalID], nil
+}
+
+func (f *fakeConnector) set(externalID string, status approval.Status, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses[externalID] = status
+	f.reasons[externalID] = reason
+}
+
+// newApprovalSyncer 创建ssp-poll(定时查询)和ssp-hook(回调)两个需要审核的交易平台
+func newApprovalSyncer(t *testing.T, store *memoryStore) (*approval.Syncer, *exchange.Registry, map[string]*fakeConnector) {
+	t.Helper()
+	registry := exchange.NewRegistry()
+	profiles := []exchange.Profile{
+		{ID: "ssp-poll", CreativeAudit: exchange.CreativeAudit{Enabled: true, URL: "http://audit.poll"}},
+		{ID: "ssp-hook", CreativeAudit: exchange.CreativeAudit{
+			Enabled: true, URL: "http://audit.hook", Mode: exchange.CreativeAuditWebhook, WebhookToken: "hook-secret",
+		}},
+		{ID: "ssp-open"},
+	}
+	for _, p := range profiles {
+		if err := registry.Register(p); err != nil {
+			t.Fatalf("Register(%s) error = %v", p.ID, err)
+		}
+	}
+
+	syncer := approval.NewSyncer(registry, store, 0, logger.NewLogger(zap.NewNop()))
+	connectors := map[string]*fakeConnector{
+		"ssp-poll": newFakeConnector("poll-"),
+		"ssp-hook": newFakeConnector("hook-"),
+	}
+	for id, c := range connectors {
+		syncer.SetConnector(id, c)
+	}
+	syncer.SetCreativeSource(&memoryStorage{creatives: map[string]*types.Creative{
+		"c1": {ID: "c1", Title: "素材1"},
+		"c2": {ID: "c2", Title: "素材2"},
+	}})
+	return syncer, registry, connectors
+}
+
+func TestApprovalSubmitAndPoll(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	syncer, _, connectors := newApprovalSyncer(t, store)
+
+	if !syncer.Required("ssp-poll") || syncer.Required("ssp-open") {
+		t.Fatal("Required() 应只对启用素材送审的交易平台返回true")
+	}
+	if !syncer.Approved("ssp-open", "c1") {
+		t.Error("不要求审核的交易平台应视为审核通过")
+	}
+
+	states, err := syncer.Submit(ctx, "c1")
+	if err != nil || len(states) != 2 {
+		t.Fatalf("Submit() = %v, %v, want 2 states", states, err)
+	}
+	if syncer.Approved("ssp-poll", "c1") {
+		t.Error("审核中的素材不应参与竞价")
+	}
+
+	connectors["ssp-poll"].set("poll-c1", approval.StatusApproved, "")
+	connectors["ssp-hook"].set("hook-c1", approval.StatusApproved, "")
+	syncer.Poll(ctx)
+	if !syncer.Approved("ssp-poll", "c1") {
+		t.Error("定时查询到审核通过后应参与竞价")
+	}
+	// 回调模式的交易平台不定时查询
+	if connectors["ssp-hook"].queried != 0 || syncer.Approved("ssp-hook", "c1") {
+		t.Error("回调模式的交易平台不应定时查询")
+	}
+	if store.sets["creative:exchange:pending:ssp-poll"]["c1"] || !store.sets["creative:exchange:approved:ssp-poll"]["c1"] {
+		t.Errorf("审核中/审核通过集合未更新: %v", store.sets)
+	}
+
+	// 审核通过后被交易平台拒绝
+	if _, err := syncer.Apply(ctx, "ssp-poll", "poll-c1", approval.StatusRejected, "落地页无法访问"); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if syncer.Approved("ssp-poll", "c1") {
+		t.Error("被拒绝的素材不应参与竞价")
+	}
+	states, err = syncer.States(ctx, "c1")
+	if err != nil || len(states) != 2 {
+		t.Fatalf("States() = %v, %v", states, err)
+	}
+	if states[1].Exchange != "ssp-poll" || states[1].Status != approval.StatusRejected || states[1].Reason != "落地页无法访问" {
+		t.Errorf("States()[1] = %+v", states[1])
+	}
+}
+
+func TestApprovalSubmitPartialFailure(t *testing.T) {
+	syncer, _, connectors := newApprovalSyncer(t, newMemoryStore())
+	connectors["ssp-hook"].submitErr = errors.New("审核接口不可用")
+
+	states, err := syncer.Submit(context.Background(), "c2")
+	if err == nil || !strings.Contains(err.Error(), "ssp-hook") {
+		t.Fatalf("Submit() err = %v, want ssp-hook error", err)
+	}
+	if len(states) != 1 || states[0].Exchange != "ssp-poll" {
+		t.Errorf("Submit() states = %+v, want ssp-poll only", states)
+	}
+
+	empty := approval.NewSyncer(exchange.NewRegistry(), newMemoryStore(), 0, logger.NewLogger(zap.NewNop()))
+	if _, err := empty.Submit(context.Background(), "c2"); !errors.Is(err, approval.ErrNoCreativeSource) {
+		t.Errorf("Submit() without source err = %v, want ErrNoCreativeSource", err)
+	}
+}
+
+func TestApprovalRefresh(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	syncer, _, _ := newApprovalSyncer(t, store)
+	if _, err := syncer.Submit(ctx, "c1"); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if _, err := syncer.Apply(ctx, "ssp-hook", "hook-c1", approval.StatusApproved, ""); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// 其他实例通过Refresh加载审核结果
+	other, _, _ := newApprovalSyncer(t, store)
+	if other.Approved("ssp-hook", "c1") {
+		t.Fatal("Refresh前不应加载审核结果")
+	}
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if !other.Approved("ssp-hook", "c1") || other.Approved("ssp-poll", "c1") {
+		t.Error("Refresh后审核状态不正确")
+	}
+}
+
+func TestApprovalCallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	syncer, registry, _ := newApprovalSyncer(t, newMemoryStore())
+	if _, err := syncer.Submit(ctx, "c1"); err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+
+	r := gin.New()
+	approval.NewHandler(syncer, registry, logger.NewLogger(zap.NewNop())).RegisterRoutes(r)
+
+	callback := func(exchangeID, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/exchanges/"+exchangeID+"/creative-audits/callback", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name     string
+		exchange string
+		token    string
+		body     string
+		want     int
+	}{
+		{"未启用回调", "ssp-poll", "hook-secret", `{"external_id":"poll-c1","status":"approved"}`, http.StatusNotFound},
+		{"token错误", "ssp-hook", "wrong", `{"external_id":"hook-c1","status":"approved"}`, http.StatusUnauthorized},
+		{"未知素材", "ssp-hook", "hook-secret", `{"external_id":"hook-x","status":"approved"}`, http.StatusNotFound},
+		{"无效状态", "ssp-hook", "hook-secret", `{"external_id":"hook-c1","status":"unknown"}`, http.StatusBadRequest},
+		{"审核通过", "ssp-hook", "hook-secret", `{"external_id":"hook-c1","status":"APPROVED"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := callback(tt.exchange, tt.token, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body = %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+	if !syncer.Approved("ssp-hook", "c1") {
+		t.Error("回调审核通过后应参与竞价")
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/creatives/c1/exchange-audits", nil))
+	var resp struct {
+		States []approval.State `json:"states"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.States) != 2 {
+		t.Fatalf("GET exchange-audits = %d %s", w.Code, w.Body.String())
+	}
+	if resp.States[0].Exchange != "ssp-hook" || resp.States[0].Status != approval.StatusApproved {
+		t.Errorf("states[0] = %+v", resp.States[0])
+	}
+}
+
+func TestApprovalHTTPConnector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer audit-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/creatives":
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body["id"] != "c1" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"id":"ext-1","status":"pending"}`))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/creatives/ext-1":
+			w.Write([]byte(`{"id":"ext-1","status":"rejected","reason":"含有违规内容"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	connector := approval.NewHTTPConnector(exchange.CreativeAudit{URL: srv.URL + "/v1/", Token: "audit-token"})
+	externalID, status, err := connector.Submit(ctx, &types.Creative{ID: "c1"})
+	if err != nil || externalID != "ext-1" || status != approval.StatusPending {
+		t.Fatalf("Submit() = %q, %q, %v", externalID, status, err)
+	}
+	status, reason, err := connector.Status(ctx, "ext-1")
+	if err != nil || status != approval.StatusRejected || reason != "含有违规内容" {
+		t.Fatalf("Status() = %q, %q, %v", status, reason, err)
+	}
+	if _, _, err := connector.Status(ctx, "ext-2"); err == nil {
+		t.Error("Status() 未知素材应返回错误")
+	}
+
+	unauthorized := approval.NewHTTPConnector(exchange.CreativeAudit{URL: srv.URL + "/v1"})
+	if _, _, err := unauthorized.Submit(ctx, &types.Creative{ID: "c1"}); err == nil {
+		t.Error("Submit() 未携带token应返回错误")
+	}
+}
@@ -0,0 +1,548 @@
+package creative_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/creative"
+	"simple-dsp/internal/creative/storage"
+	"simple-dsp/internal/creative/types"
+	"simple-dsp/pkg/logger"
+)
+
+var (
+	_ creative.AuditStore = (*redis.Client)(nil)
+	_ creative.AuditStore = (*redis.ClusterClient)(nil)
+)
+
+// memoryStore 内存实现的审核存储，脚本按领取脚本的语义模拟
+type memoryStore struct {
+	mu      sync.Mutex
+	strings map[string]string
+	lists   map[string][]string
+	zsets   map[string]map[string]float64
+	hashes  map[string]map[string]string
+	sets    map[string]map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		strings: map[string]string{},
+		lists:   map[string][]string{},
+		zsets:   map[string]map[string]float64{},
+		hashes:  map[string]map[string]string{},
+		sets:    map[string]map[string]bool{},
+	}
+}
+
+func (s *memoryStore) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var now, timeout float64
+	fmt.Sscan(fmt.Sprint(args[0]), &now)
+	fmt.Sscan(fmt.Sprint(args[1]), &timeout)
+
+	var best string
+	bestScore := now
+	for member, score := range s.zsets[keys[0]] {
+		if score <= now && (best == "" || score < bestScore || (score == bestScore && member < best)) {
+			best, bestScore = member, score
+		}
+	}
+	if best == "" {
+		return redis.NewCmdResult(nil, redis.Nil)
+	}
+	s.zsets[keys[0]][best] = now + timeout
+	return redis.NewCmdResult(best, nil)
+}
+
+func (s *memoryStore) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script"))
+}
+
+func (s *memoryStore) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return redis.NewBoolSliceResult(make([]bool, len(hashes)), nil)
+}
+
+func (s *memoryStore) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringResult("", nil)
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) *redis.StringCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.strings[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(value, nil)
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.strings[key] = string(value.([]byte))
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (s *memoryStore) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, v := range values {
+		s.lists[key] = append([]string{string(v.([]byte))}, s.lists[key]...)
+	}
+	return redis.NewIntResult(int64(len(s.lists[key])), nil)
+}
+
+func (s *memoryStore) LTrim(ctx context.Context, key string, start, stop int64) *redis.StatusCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if int64(len(s.lists[key])) > stop+1 {
+		s.lists[key] = s.lists[key][start : stop+1]
+	}
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (s *memoryStore) LRange(ctx context.Context, key string, start, stop int64) *redis.StringSliceCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return redis.NewStringSliceResult(append([]string(nil), s.lists[key]...), nil)
+}
+
+func (s *memoryStore) ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zsets[key] == nil {
+		s.zsets[key] = map[string]float64{}
+	}
+	for _, m := range members {
+		s.zsets[key][fmt.Sprint(m.Member)] = m.Score
+	}
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func (s *memoryStore) ZAddXX(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range members {
+		if _, ok := s.zsets[key][fmt.Sprint(m.Member)]; ok {
+			s.zsets[key][fmt.Sprint(m.Member)] = m.Score
+		}
+	}
+	return redis.NewIntResult(0, nil)
+}
+
+func (s *memoryStore) ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range members {
+		delete(s.zsets[key], fmt.Sprint(m))
+	}
+	return redis.NewIntResult(int64(len(members)), nil)
+}
+
+func (s *memoryStore) sorted(key string) []redis.Z {
+	var zs []redis.Z
+	for member, score := range s.zsets[key] {
+		zs = append(zs, redis.Z{Score: score, Member: member})
+	}
+	sort.Slice(zs, func(i, j int) bool {
+		if zs[i].Score != zs[j].Score {
+			return zs[i].Score < zs[j].Score
+		}
+		return zs[i].Member.(string) < zs[j].Member.(string)
+	})
+	return zs
+}
+
+func (s *memoryStore) ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	zs := s.sorted(key)
+	if start >= int64(len(zs)) {
+		return redis.NewZSliceCmdResult(nil, nil)
+	}
+	if stop >= int64(len(zs)) {
+		stop = int64(len(zs)) - 1
+	}
+	return redis.NewZSliceCmdResult(zs[start:stop+1], nil)
+}
+
+func (s *memoryStore) ZCard(ctx context.Context, key string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return redis.NewIntResult(int64(len(s.zsets[key])), nil)
+}
+
+func (s *memoryStore) ZCount(ctx context.Context, key, min, max string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var floor float64
+	fmt.Sscan(strings.TrimPrefix(min, "("), &floor)
+	var n int64
+	for _, score := range s.zsets[key] {
+		if score > floor {
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (s *memoryStore) HGet(ctx context.Context, key, field string) *redis.StringCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.hashes[key][field]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(v, nil)
+}
+
+func (s *memoryStore) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[string]string{}
+	for k, v := range s.hashes[key] {
+		out[k] = v
+	}
+	return redis.NewStringStringMapResult(out, nil)
+}
+
+func (s *memoryStore) HSet(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hashes[key] == nil {
+		s.hashes[key] = map[string]string{}
+	}
+	var n int64
+	for i := 0; i+1 < len(values); i += 2 {
+		field := fmt.Sprint(values[i])
+		if _, ok := s.hashes[key][field]; !ok {
+			n++
+		}
+		if b, ok := values[i+1].([]byte); ok {
+			s.hashes[key][field] = string(b)
+		} else {
+			s.hashes[key][field] = fmt.Sprint(values[i+1])
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (s *memoryStore) SAdd(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sets[key] == nil {
+		s.sets[key] = map[string]bool{}
+	}
+	var n int64
+	for _, m := range members {
+		if !s.sets[key][fmt.Sprint(m)] {
+			s.sets[key][fmt.Sprint(m)] = true
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (s *memoryStore) SRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for _, m := range members {
+		if s.sets[key][fmt.Sprint(m)] {
+			delete(s.sets[key], fmt.Sprint(m))
+			n++
+		}
+	}
+	return redis.NewIntResult(n, nil)
+}
+
+func (s *memoryStore) SMembers(ctx context.Context, key string) *redis.StringSliceCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []string{}
+	for m := range s.sets[key] {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return redis.NewStringSliceResult(out, nil)
+}
+
+// memoryStorage 内存素材存储，只实现素材信息的读写
+type memoryStorage struct {
+	storage.Storage
+	mu        sync.Mutex
+	creatives map[string]*types.Creative
+}
+
+func (m *memoryStorage) GetCreative(ctx context.Context, creativeID string) (*types.Creative, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c, ok := m.creatives[creativeID]
+	if !ok {
+		return nil, errors.New("素材不存在")
+	}
+	copied := *c
+	return &copied, nil
+}
+
+func (m *memoryStorage) SaveCreative(ctx context.Context, c *types.Creative) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.creatives[c.ID] = c
+	return nil
+}
+
+func (m *memoryStorage) Save(ctx context.Context, path string, file *multipart.FileHeader) error {
+	return nil
+}
+
+func (m *memoryStorage) status(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.creatives[id].Status
+}
+
+func newAuditService(t *testing.T, ids ...string) (*creative.AuditService, *memoryStore, *memoryStorage) {
+	t.Helper()
+	store := newMemoryStore()
+	files := &memoryStorage{creatives: map[string]*types.Creative{}}
+	svc := creative.NewAuditService(store, logger.NewLogger(zap.NewNop()), files)
+	for _, id := range ids {
+		files.creatives[id] = &types.Creative{ID: id, Status: "pending"}
+		if err := svc.SubmitForAudit(context.Background(), id); err != nil {
+			t.Fatalf("SubmitForAudit(%s) error = %v", id, err)
+		}
+		// 保证提交时间不同，队列按提交顺序领取
+		time.Sleep(2 * time.Millisecond)
+	}
+	return svc, store, files
+}
+
+func TestAuditClaimQueue(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newAuditService(t, "c1", "c2")
+
+	first, err := svc.ClaimNext(ctx, "alice")
+	if err != nil || first.CreativeID != "c1" || first.Reviewer != "alice" || first.ClaimTime == nil {
+		t.Fatalf("ClaimNext() = %+v, %v", first, err)
+	}
+	if first.DueTime.Sub(first.CreateTime) != creative.DefaultReviewSLA {
+		t.Fatalf("DueTime = %v, CreateTime = %v", first.DueTime, first.CreateTime)
+	}
+	second, err := svc.ClaimNext(ctx, "bob")
+	if err != nil || second.CreativeID != "c2" {
+		t.Fatalf("ClaimNext() = %+v, %v", second, err)
+	}
+	if _, err := svc.ClaimNext(ctx, "carol"); !errors.Is(err, creative.ErrQueueEmpty) {
+		t.Fatalf("err = %v, want ErrQueueEmpty", err)
+	}
+	if _, err := svc.ClaimNext(ctx, ""); !errors.Is(err, creative.ErrReviewerRequired) {
+		t.Fatalf("err = %v, want ErrReviewerRequired", err)
+	}
+
+	stats, err := svc.QueueStats(ctx)
+	if err != nil || stats.Pending != 2 || stats.Claimed != 2 {
+		t.Fatalf("QueueStats() = %+v, %v", stats, err)
+	}
+
+	// 其他审核员不能审核已领取且未超时的素材
+	if err := svc.ReviewCreative(ctx, "c1", creative.AuditStatusApproved, "bob", nil, ""); !errors.Is(err, creative.ErrClaimedByOther) {
+		t.Fatalf("err = %v, want ErrClaimedByOther", err)
+	}
+}
+
+func TestAuditClaimTimeout(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newAuditService(t, "c1")
+	svc.SetTimeouts(0, 20*time.Millisecond)
+
+	if _, err := svc.ClaimNext(ctx, "alice"); err != nil {
+		t.Fatalf("ClaimNext() error = %v", err)
+	}
+	if _, err := svc.ClaimNext(ctx, "bob"); !errors.Is(err, creative.ErrQueueEmpty) {
+		t.Fatalf("err = %v, want ErrQueueEmpty", err)
+	}
+
+	// 领取超时后重新排队，其他审核员可以领取并审核
+	time.Sleep(30 * time.Millisecond)
+	record, err := svc.ClaimNext(ctx, "bob")
+	if err != nil || record.Reviewer != "bob" {
+		t.Fatalf("ClaimNext() = %+v, %v", record, err)
+	}
+	if err := svc.ReviewCreative(ctx, "c1", creative.AuditStatusApproved, "bob", nil, ""); err != nil {
+		t.Fatalf("ReviewCreative() error = %v", err)
+	}
+}
+
+func TestAuditReviewReasons(t *testing.T) {
+	ctx := context.Background()
+	svc, _, files := newAuditService(t, "c1")
+
+	cases := []struct {
+		reasons  []string
+		comments string
+		want     error
+	}{
+		{nil, "", creative.ErrReasonRequired},
+		{[]string{"ugly"}, "", creative.ErrInvalidReason},
+		{[]string{creative.ReasonOther}, "", creative.ErrCommentsRequired},
+	}
+	for _, tc := range cases {
+		err := svc.ReviewCreative(ctx, "c1", creative.AuditStatusRejected, "alice", tc.reasons, tc.comments)
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("ReviewCreative(%v) err = %v, want %v", tc.reasons, err, tc.want)
+		}
+	}
+	if err := svc.ReviewCreative(ctx, "c1", "deleted", "alice", nil, ""); !errors.Is(err, creative.ErrInvalidAuditStatus) {
+		t.Fatalf("err = %v, want ErrInvalidAuditStatus", err)
+	}
+
+	reasons := []string{creative.ReasonMisleading, creative.ReasonLandingPage}
+	if err := svc.ReviewCreative(ctx, "c1", creative.AuditStatusRejected, "alice", reasons, "落地页404"); err != nil {
+		t.Fatalf("ReviewCreative() error = %v", err)
+	}
+	record, _ := svc.GetLatestAuditRecord(ctx, "c1")
+	if record.Status != creative.AuditStatusRejected || len(record.ReasonCodes) != 2 {
+		t.Fatalf("record = %+v", record)
+	}
+	if files.status("c1") != "rejected" {
+		t.Fatalf("status = %s, want rejected", files.status("c1"))
+	}
+
+	// 已审核的素材离开队列，不能重复审核
+	if stats, _ := svc.QueueStats(ctx); stats.Pending != 0 {
+		t.Fatalf("Pending = %d, want 0", stats.Pending)
+	}
+	if err := svc.ReviewCreative(ctx, "c1", creative.AuditStatusApproved, "alice", nil, ""); !errors.Is(err, creative.ErrAuditNotPending) {
+		t.Fatalf("err = %v, want ErrAuditNotPending", err)
+	}
+	history, _ := svc.GetAuditHistory(ctx, "c1")
+	if len(history) != 2 {
+		t.Fatalf("history = %d, want 2", len(history))
+	}
+}
+
+func TestAuditAssignAndBulkReview(t *testing.T) {
+	ctx := context.Background()
+	svc, _, files := newAuditService(t, "c1", "c2", "c3")
+
+	if _, err := svc.Assign(ctx, "c3", "alice"); err != nil {
+		t.Fatalf("Assign() error = %v", err)
+	}
+	// 已分配的素材不会被其他审核员领取
+	for _, want := range []string{"c1", "c2"} {
+		record, err := svc.ClaimNext(ctx, "bob")
+		if err != nil || record.CreativeID != want {
+			t.Fatalf("ClaimNext() = %+v, %v, want %s", record, err, want)
+		}
+	}
+
+	items, err := svc.ListQueue(ctx, 0, 10)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("ListQueue() = %d, %v", len(items), err)
+	}
+	for _, item := range items {
+		if !item.Claimed || item.Overdue {
+			t.Fatalf("item = %+v", item)
+		}
+	}
+
+	// 批量审核时单个素材失败不影响其他素材
+	results, err := svc.BulkReview(ctx, []string{"c1", "c2", "c3", "missing"}, creative.AuditStatusApproved, "bob", nil, "")
+	if err != nil {
+		t.Fatalf("BulkReview() error = %v", err)
+	}
+	errs := map[string]string{}
+	for _, r := range results {
+		errs[r.CreativeID] = r.Error
+	}
+	if errs["c1"] != "" || errs["c2"] != "" {
+		t.Fatalf("results = %+v", results)
+	}
+	if errs["c3"] != creative.ErrClaimedByOther.Error() || errs["missing"] != creative.ErrAuditNotFound.Error() {
+		t.Fatalf("results = %+v", results)
+	}
+	if files.status("c1") != "active" || files.status("c3") != "pending" {
+		t.Fatalf("status = %s, %s", files.status("c1"), files.status("c3"))
+	}
+
+	// 拒绝原因对整批校验
+	if _, err := svc.BulkReview(ctx, []string{"c3"}, creative.AuditStatusRejected, "alice", nil, ""); !errors.Is(err, creative.ErrReasonRequired) {
+		t.Fatalf("err = %v, want ErrReasonRequired", err)
+	}
+}
+
+func TestAuditOverdue(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	files := &memoryStorage{creatives: map[string]*types.Creative{"c1": {ID: "c1"}}}
+	svc := creative.NewAuditService(store, logger.NewLogger(zap.NewNop()), files)
+	svc.SetTimeouts(time.Millisecond, 0)
+	if err := svc.SubmitForAudit(ctx, "c1"); err != nil {
+		t.Fatalf("SubmitForAudit() error = %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	items, err := svc.ListQueue(ctx, 0, 10)
+	if err != nil || len(items) != 1 || !items[0].Overdue || items[0].Claimed {
+		t.Fatalf("ListQueue() = %+v, %v", items, err)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _, _ := newAuditService(t, "c1", "c2")
+	r := gin.New()
+	creative.NewAuditHandler(svc, logger.NewLogger(zap.NewNop())).RegisterRoutes(r)
+
+	do := func(method, path, body string) (int, string) {
+		var reader io.Reader
+		if body != "" {
+			reader = strings.NewReader(body)
+		}
+		req := httptest.NewRequest(method, path, reader)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	if code, body := do(http.MethodPost, "/api/v1/creatives/audit/queue/claim", `{"reviewer":"alice"}`); code != http.StatusOK || !strings.Contains(body, `"creative_id":"c1"`) {
+		t.Fatalf("claim = %d %s", code, body)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/creatives/audit/c1/review", `{"status":"rejected","reviewer":"alice"}`); code != http.StatusBadRequest {
+		t.Fatalf("review without reason = %d, want 400", code)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/creatives/audit/c1/review", `{"status":"approved","reviewer":"bob"}`); code != http.StatusConflict {
+		t.Fatalf("review by other = %d, want 409", code)
+	}
+	if code, body := do(http.MethodPost, "/api/v1/creatives/audit/bulk-review",
+		`{"creative_ids":["c2"],"status":"rejected","reviewer":"bob","reason_codes":["low_quality"]}`); code != http.StatusOK || !strings.Contains(body, `"succeeded":1`) {
+		t.Fatalf("bulk review = %d %s", code, body)
+	}
+	if code, body := do(http.MethodGet, "/api/v1/creatives/audit/queue", ""); code != http.StatusOK || !strings.Contains(body, `"pending":1`) {
+		t.Fatalf("queue = %d %s", code, body)
+	}
+	if code, _ := do(http.MethodPost, "/api/v1/creatives/audit/queue/claim", `{"reviewer":"carol"}`); code != http.StatusNotFound {
+		t.Fatalf("claim empty = %d, want 404", code)
+	}
+	if code, body := do(http.MethodGet, "/api/v1/creatives/audit/reasons", ""); code != http.StatusOK || !strings.Contains(body, creative.ReasonSpecMismatch) {
+		t.Fatalf("reasons = %d %s", code, body)
+	}
+}
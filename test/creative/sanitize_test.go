@@ -0,0 +1,181 @@
+package creative_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/creative"
+	"simple-dsp/pkg/logger"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	s := creative.NewSanitizer([]string{"adcdn.example.com"})
+
+	tests := []struct {
+		name        string
+		content     string
+		want        string
+		wantRemoved []string
+	}{
+		{
+			name:    "保留白名单标签和属性",
+			content: `<div class="ad" data-id="1"><a href="https://shop.example.com/?a=1&amp;b=2" target="_blank"><img src="https://img.example.com/1.png" alt="广告"></a></div>`,
+			want:    `<div class="ad" data-id="1"><a href="https://shop.example.com/?a=1&amp;b=2" target="_blank"><img src="https://img.example.com/1.png" alt="广告"></a></div>`,
+		},
+		{
+			name:        "移除事件属性和javascript链接",
+			content:     `<img src="x.png" onerror="alert(1)"><a href=" JaVa&#x09;script:alert(1)">点击</a>`,
+			want:        `<img src="x.png"><a>点击</a>`,
+			wantRemoved: []string{"attr:img.onerror", "attr:a.href"},
+		},
+		{
+			name:        "移除危险标签及其内容",
+			content:     `<p>前</p><iframe src="https://evil.example"><p>内</p></iframe><object><embed src="a.swf"></object><meta http-equiv="refresh" content="0;url=https://evil.example"><p>后</p>`,
+			want:        `<p>前</p><p>后</p>`,
+			wantRemoved: []string{"tag:iframe", "tag:object", "tag:meta"},
+		},
+		{
+			name:        "移除未知标签但保留文本",
+			content:     `<marquee>滚动<b>文字</b></marquee><!-- [if IE]><script src="https://evil.example/a.js"></script><![endif] -->`,
+			want:        `滚动<b>文字</b>`,
+			wantRemoved: []string{"tag:marquee"},
+		},
+		{
+			name:        "外部脚本只允许白名单域名",
+			content:     `<script src="https://static.adcdn.example.com/ad.js"></script><script src="//evil.example/x.js">var a = 1;</script><script src="/local.js"></script>`,
+			want:        `<script src="https://static.adcdn.example.com/ad.js"></script>`,
+			wantRemoved: []string{"script:evil.example", "script:"},
+		},
+		{
+			name:    "内联脚本保留原文",
+			content: `<script>if (a < b && c > 0) { render("<div>"); }</script>`,
+			want:    `<script>if (a < b && c > 0) { render("<div>"); }</script>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := s.Sanitize(tt.content)
+			if result.Content != tt.want {
+				t.Errorf("Content = %s, want %s", result.Content, tt.want)
+			}
+			if !reflect.DeepEqual(result.Removed, tt.wantRemoved) {
+				t.Errorf("Removed = %v, want %v", result.Removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestSanitizeScan(t *testing.T) {
+	ctx := context.Background()
+	s := creative.NewSanitizer(nil)
+
+	var scanned []string
+	s.SetScanner(creative.ScannerFunc(func(ctx context.Context, content string, urls []string) (*creative.ScanVerdict, error) {
+		scanned = urls
+		for _, u := range urls {
+			if strings.Contains(u, "malware.example") {
+				return &creative.ScanVerdict{Malicious: true, Reason: "恶意网址"}, nil
+			}
+		}
+		return &creative.ScanVerdict{}, nil
+	}))
+
+	result, err := s.Check(ctx, `<a href="https://shop.example.com"><img src="https://img.example.com/1.png"></a><a href="https://shop.example.com">再次</a>`)
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	want := []string{"https://shop.example.com", "https://img.example.com/1.png"}
+	if !reflect.DeepEqual(scanned, want) || !reflect.DeepEqual(result.URLs, want) {
+		t.Errorf("scanned URLs = %v, want %v", scanned, want)
+	}
+
+	if _, err := s.Check(ctx, `<a href="https://malware.example/x">点击</a>`); !errors.Is(err, creative.ErrUnsafeCreative) {
+		t.Errorf("Check() err = %v, want ErrUnsafeCreative", err)
+	}
+
+	// 扫描服务异常时素材不能生效
+	s.SetScanner(creative.ScannerFunc(func(ctx context.Context, content string, urls []string) (*creative.ScanVerdict, error) {
+		return nil, errors.New("扫描服务超时")
+	}))
+	if _, err := s.Check(ctx, `<p>广告</p>`); err == nil || errors.Is(err, creative.ErrUnsafeCreative) {
+		t.Errorf("Check() err = %v, want scan error", err)
+	}
+}
+
+func TestAuditSanitizeOnApprove(t *testing.T) {
+	ctx := context.Background()
+	svc, _, files := newAuditService(t, "html-1", "html-2", "img-1")
+	files.creatives["html-1"].Type = "html"
+	files.creatives["html-1"].Content = `<div onclick="steal()">广告<script src="https://evil.example/x.js"></script></div>`
+	files.creatives["html-2"].Type = "js"
+	files.creatives["html-2"].Content = `<script src="https://malware.example/ad.js"></script>`
+	files.creatives["img-1"].Type = "image"
+	files.creatives["img-1"].Content = `<script src="https://malware.example/ad.js"></script>`
+
+	sanitizer := creative.NewSanitizer([]string{"malware.example"})
+	sanitizer.SetScanner(creative.ScannerFunc(func(ctx context.Context, content string, urls []string) (*creative.ScanVerdict, error) {
+		if strings.Contains(content, "malware.example") {
+			return &creative.ScanVerdict{Malicious: true, Reason: "恶意脚本"}, nil
+		}
+		return &creative.ScanVerdict{}, nil
+	}))
+	svc.SetSanitizer(sanitizer)
+
+	if err := svc.ReviewCreative(ctx, "html-1", creative.AuditStatusApproved, "alice", nil, ""); err != nil {
+		t.Fatalf("ReviewCreative(html-1) error = %v", err)
+	}
+	c, _ := files.GetCreative(ctx, "html-1")
+	if c.Status != "active" || c.Content != `<div>广告</div>` {
+		t.Errorf("html-1 = %q %q, want active with sanitized content", c.Status, c.Content)
+	}
+
+	// 未通过扫描的素材不能通过审核，仍留在待审核状态
+	if err := svc.ReviewCreative(ctx, "html-2", creative.AuditStatusApproved, "alice", nil, ""); !errors.Is(err, creative.ErrUnsafeCreative) {
+		t.Fatalf("ReviewCreative(html-2) err = %v, want ErrUnsafeCreative", err)
+	}
+	if files.status("html-2") != "pending" {
+		t.Errorf("html-2 status = %s, want pending", files.status("html-2"))
+	}
+	record, err := svc.GetLatestAuditRecord(ctx, "html-2")
+	if err != nil || record.Status != creative.AuditStatusPending {
+		t.Errorf("html-2 audit = %+v, %v, want pending", record, err)
+	}
+	// 拒绝不需要扫描
+	if err := svc.ReviewCreative(ctx, "html-2", creative.AuditStatusRejected, "alice", []string{creative.ReasonProhibited}, ""); err != nil {
+		t.Errorf("ReviewCreative(html-2 rejected) error = %v", err)
+	}
+
+	// 非HTML素材不处理
+	if err := svc.ReviewCreative(ctx, "img-1", creative.AuditStatusApproved, "alice", nil, ""); err != nil {
+		t.Errorf("ReviewCreative(img-1) error = %v", err)
+	}
+}
+
+func TestAuditHandlerUnsafeCreative(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc, _, files := newAuditService(t, "html-1")
+	files.creatives["html-1"].Type = "html"
+	sanitizer := creative.NewSanitizer(nil)
+	sanitizer.SetScanner(creative.ScannerFunc(func(ctx context.Context, content string, urls []string) (*creative.ScanVerdict, error) {
+		return &creative.ScanVerdict{Malicious: true, Reason: "恶意脚本"}, nil
+	}))
+	svc.SetSanitizer(sanitizer)
+
+	r := gin.New()
+	creative.NewAuditHandler(svc, logger.NewLogger(zap.NewNop())).RegisterRoutes(r)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/creatives/audit/html-1/review", strings.NewReader(`{"status":"approved","reviewer":"alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422, body = %s", w.Code, w.Body.String())
+	}
+}
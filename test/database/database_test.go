@@ -0,0 +1,271 @@
+package database_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	io_prometheus_client "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/test/fakedb"
+)
+
+func newObservedLogger() (*logger.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.WarnLevel)
+	return logger.NewLogger(zap.New(core)), logs
+}
+
+func newMetrics() *metrics.Metrics {
+	return &metrics.Metrics{
+		Database: &metrics.DatabaseMetrics{
+			Duration:       prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, []string{"query", "operation"}),
+			Rows:           prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "rows"}, []string{"query", "operation"}),
+			Errors:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "errors"}, []string{"query", "operation"}),
+			ReplicaHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "replica_healthy"}, []string{"replica"}),
+			Reads:          prometheus.NewCounterVec(prometheus.CounterOpts{Name: "reads"}, []string{"target"}),
+		},
+	}
+}
+
+// instrument 打开模拟数据库并注册插件
+func instrument(t *testing.T, f *fakedb.DB, cfg config.PostgresConfig, log *logger.Logger, m *metrics.Metrics) *gorm.DB {
+	t.Helper()
+	if log == nil {
+		log = logger.NewLogger(zap.NewNop())
+	}
+	db := f.Open(t)
+	if err := database.Instrument(db, cfg, log, m); err != nil {
+		t.Fatalf("Instrument失败: %v", err)
+	}
+	return db
+}
+
+func TestSlowQueryLog(t *testing.T) {
+	log, logs := newObservedLogger()
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{SlowThreshold: 5 * time.Millisecond}, log, nil)
+
+	query := "UPDATE bid_strategies SET daily_budget = ? WHERE id = ?"
+	if err := db.Exec(query, 100, "s1").Error; err != nil {
+		t.Fatalf("Exec失败: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Fatalf("未超过阈值时不应记录: %v", logs.All())
+	}
+
+	f.SetDelay(10 * time.Millisecond)
+	db.Exec(query, 100, "s1")
+	entries := logs.TakeAll()
+	if len(entries) != 1 || entries[0].Message != "慢SQL" {
+		t.Fatalf("entries = %v", entries)
+	}
+	fields := entries[0].ContextMap()
+	if fields["query"] != "UPDATE bid_strategies SET daily_budget = $1 WHERE id = $2" || fields["args"] != int64(2) {
+		t.Fatalf("fields = %v", fields)
+	}
+	for _, v := range fields {
+		if v == "s1" {
+			t.Fatal("慢SQL日志不应包含参数值")
+		}
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{QueryTimeout: 20 * time.Millisecond}, nil, nil)
+	f.SetDelay(200 * time.Millisecond)
+
+	start := time.Now()
+	err := db.Exec("DELETE FROM bid_strategies WHERE id = ?", 1).Error
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("超过默认超时的语句 err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("语句未按默认超时结束, 耗时 %v", elapsed)
+	}
+
+	// 调用方已设置截止时间时不使用默认超时
+	f.SetDelay(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := db.WithContext(ctx).Exec("DELETE FROM bid_strategies WHERE id = ?", 1).Error; err != nil {
+		t.Fatalf("调用方截止时间内的语句 err = %v", err)
+	}
+}
+
+func TestQueryTimeout_ReusedStatement(t *testing.T) {
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{QueryTimeout: time.Second}, nil, nil)
+	f.Respond(`SELECT count(*)`, "", []string{"count"}, []driver.Value{int64(1)})
+
+	// 同一语句先计数再查询，计数后恢复原来的上下文，查询不会使用已取消的超时
+	query := db.Model(&models.BidStrategy{}).Where("status = ?", 1)
+	var total int64
+	if err := query.Count(&total).Error; err != nil || total != 1 {
+		t.Fatalf("Count = %d, %v", total, err)
+	}
+	var records []models.BidStrategy
+	if err := query.Find(&records).Error; err != nil {
+		t.Fatalf("计数后查询失败: %v", err)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	f := fakedb.New()
+	m := newMetrics()
+	db := instrument(t, f, config.PostgresConfig{}, nil, m)
+	repo := bidding.NewGormRepository(db)
+	ctx := context.Background()
+
+	f.Respond(`SELECT * FROM "bid_strategies"`, "", []string{"id"}, []driver.Value{int64(1)})
+	if strategy, err := repo.GetBidStrategy(ctx, 1); err != nil || strategy == nil {
+		t.Fatalf("GetBidStrategy = %+v, %v", strategy, err)
+	}
+	// 未命名的语句按表名统计，记录不存在不计为失败
+	var creative bidding.BidStrategyCreative
+	if err := db.Take(&creative).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Take err = %v", err)
+	}
+	f.FailOn("DELETE")
+	if err := repo.DeleteBidStrategy(ctx, 1); err == nil {
+		t.Fatal("删除应返回模拟的错误")
+	}
+
+	if got := testutil.CollectAndCount(m.Database.Duration); got != 3 {
+		t.Fatalf("耗时分布的序列数 = %d, want 3", got)
+	}
+	if count, sum := histogram(t, m.Database.Rows, "bidding.get_strategy", "query"); count != 1 || sum != 1 {
+		t.Fatalf("读取策略的行数分布 count = %d, sum = %v", count, sum)
+	}
+	if count, _ := histogram(t, m.Database.Duration, "bid_strategy_creatives", "query"); count != 1 {
+		t.Fatalf("未命名语句的执行次数 = %d, want 1", count)
+	}
+	if got := testutil.CollectAndCount(m.Database.Errors); got != 1 {
+		t.Fatalf("失败语句的序列数 = %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Database.Errors.WithLabelValues("bidding.delete_strategy", "delete")); got != 1 {
+		t.Fatalf("删除策略失败次数 = %v, want 1", got)
+	}
+}
+
+// histogram 返回直方图的计数和总和
+func histogram(t *testing.T, vec *prometheus.HistogramVec, labels ...string) (uint64, float64) {
+	t.Helper()
+	var metric io_prometheus_client.Metric
+	if err := vec.WithLabelValues(labels...).(prometheus.Histogram).Write(&metric); err != nil {
+		t.Fatalf("读取直方图失败: %v", err)
+	}
+	return metric.GetHistogram().GetSampleCount(), metric.GetHistogram().GetSampleSum()
+}
+
+func TestTransaction(t *testing.T) {
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{TxTimeout: time.Minute}, nil, nil)
+
+	err := database.Transaction(context.Background(), db, func(tx *gorm.DB) error {
+		deadline, ok := tx.Statement.Context.Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			t.Errorf("事务的截止时间 = %v, %v", deadline, ok)
+		}
+		return tx.Exec("UPDATE bid_strategies SET status = 1").Error
+	})
+	if err != nil {
+		t.Fatalf("Transaction失败: %v", err)
+	}
+	want := []string{"BEGIN", "UPDATE bid_strategies SET status = 1", "COMMIT"}
+	if got := f.Queries(); !equal(got, want) {
+		t.Fatalf("语句 = %q, want %q", got, want)
+	}
+
+	// fn返回错误时回滚
+	f = fakedb.New()
+	db = instrument(t, f, config.PostgresConfig{}, nil, nil)
+	errRollback := errors.New("回滚")
+	err = database.Transaction(context.Background(), db, func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE bid_strategies SET status = 1").Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction err = %v", err)
+	}
+	want = []string{"BEGIN", "UPDATE bid_strategies SET status = 1", "ROLLBACK"}
+	if got := f.Queries(); !equal(got, want) {
+		t.Fatalf("语句 = %q, want %q", got, want)
+	}
+}
+
+// sqlStateError 带SQLSTATE的驱动错误
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "SQLSTATE " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func TestTransactionRetry(t *testing.T) {
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{}, nil, nil)
+
+	// 死锁回滚后重新执行整个事务
+	var calls int
+	err := database.TransactionRetry(context.Background(), db, func(tx *gorm.DB) error {
+		calls++
+		if err := tx.Exec("UPDATE bid_strategies SET status = 1").Error; err != nil {
+			return err
+		}
+		if calls == 1 {
+			return fmt.Errorf("更新失败: %w", sqlStateError("40P01"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("TransactionRetry失败: %v", err)
+	}
+	want := []string{
+		"BEGIN", "UPDATE bid_strategies SET status = 1", "ROLLBACK",
+		"BEGIN", "UPDATE bid_strategies SET status = 1", "COMMIT",
+	}
+	if got := f.Queries(); !equal(got, want) {
+		t.Fatalf("语句 = %q, want %q", got, want)
+	}
+
+	// 其他错误不重试
+	calls = 0
+	err = database.TransactionRetry(context.Background(), db, func(tx *gorm.DB) error {
+		calls++
+		return sqlStateError("23505")
+	})
+	if !errors.Is(err, sqlStateError("23505")) || calls != 1 {
+		t.Fatalf("TransactionRetry err = %v, calls = %d", err, calls)
+	}
+
+	if !database.IsRetryableTxError(sqlStateError("40001")) || database.IsRetryableTxError(errors.New("其他错误")) {
+		t.Fatal("IsRetryableTxError判断错误")
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
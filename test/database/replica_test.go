@@ -0,0 +1,176 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/models"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/test/fakedb"
+)
+
+// withReplica 打开注册了插件的主库并设置一个只读副本
+func withReplica(t *testing.T, primary, replica *fakedb.DB, interval time.Duration, m *metrics.Metrics) *gorm.DB {
+	t.Helper()
+	db := instrument(t, primary, config.PostgresConfig{}, nil, m)
+	if err := database.UseReplicas(db, []database.Replica{{Name: "replica-1", DB: sql.OpenDB(replica)}}, interval); err != nil {
+		t.Fatalf("UseReplicas失败: %v", err)
+	}
+	t.Cleanup(func() { database.Close(db) })
+	return db
+}
+
+// selects 返回执行过的SELECT语句数
+func selects(f *fakedb.DB) int {
+	n := 0
+	for _, statement := range f.Queries() {
+		if strings.HasPrefix(statement, "SELECT") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReplica_ReadOnlyRouting(t *testing.T) {
+	primary, replica := fakedb.New(), fakedb.New()
+	m := newMetrics()
+	db := withReplica(t, primary, replica, time.Hour, m)
+	repo := bidding.NewGormRepository(db)
+	ctx := context.Background()
+
+	// 策略列表从副本读取，计数和查询都发往副本
+	replica.Respond(`SELECT count(*)`, "", []string{"count"}, []driver.Value{int64(1)})
+	replica.Respond(`SELECT * FROM "bid_strategies"`, "", []string{"id"}, []driver.Value{int64(1)})
+	if strategies, total, err := repo.ListBidStrategies(ctx, bidding.BidStrategyFilter{}); err != nil || total != 1 || len(strategies) != 1 {
+		t.Fatalf("ListBidStrategies = %+v, %d, %v", strategies, total, err)
+	}
+	if got := selects(replica); got != 2 {
+		t.Fatalf("副本执行的查询数 = %d, want 2", got)
+	}
+	if got := primary.Queries(); len(got) != 0 {
+		t.Fatalf("只读查询不应发往主库: %q", got)
+	}
+
+	// 未标记只读的查询和写入使用主库
+	if _, err := repo.GetBidStrategy(ctx, 1); err != nil {
+		t.Fatalf("GetBidStrategy失败: %v", err)
+	}
+	if err := repo.DeleteBidStrategy(ctx, 1); err != nil {
+		t.Fatalf("DeleteBidStrategy失败: %v", err)
+	}
+	// 删除在GORM默认的事务中执行，倒数第二条为DELETE
+	if got := primary.Queries(); selects(primary) != 1 || !strings.HasPrefix(got[len(got)-2], "DELETE") {
+		t.Fatalf("主库执行的语句 = %q", got)
+	}
+
+	// 事务内的只读查询使用主库
+	err := database.Transaction(database.ReadOnly(ctx), db, func(tx *gorm.DB) error {
+		var records []models.BidStrategy
+		return tx.Find(&records).Error
+	})
+	if err != nil {
+		t.Fatalf("Transaction失败: %v", err)
+	}
+	if got := selects(replica); got != 2 {
+		t.Fatalf("事务内的查询不应发往副本, 副本执行的查询数 = %d", got)
+	}
+	if got := testutil.ToFloat64(m.Database.Reads.WithLabelValues("replica")); got != 2 {
+		t.Fatalf("发往副本的只读查询数 = %v, want 2", got)
+	}
+}
+
+func TestReplica_Fallback(t *testing.T) {
+	primary, replica := fakedb.New(), fakedb.New()
+	replica.SetDown(true)
+	m := newMetrics()
+	db := withReplica(t, primary, replica, 10*time.Millisecond, m)
+	ctx := database.ReadOnly(context.Background())
+	var records []models.BidStrategy
+
+	// 副本不可用时只读查询回退到主库
+	if err := db.WithContext(ctx).Find(&records).Error; err != nil {
+		t.Fatalf("回退到主库的查询失败: %v", err)
+	}
+	if selects(primary) != 1 || selects(replica) != 0 {
+		t.Fatalf("副本不可用时应查询主库, 主库 %q, 副本 %q", primary.Queries(), replica.Queries())
+	}
+	if got := testutil.ToFloat64(m.Database.Reads.WithLabelValues("primary")); got != 1 {
+		t.Fatalf("回退到主库的只读查询数 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Database.ReplicaHealthy.WithLabelValues("replica-1")); got != 0 {
+		t.Fatalf("副本健康状态 = %v, want 0", got)
+	}
+
+	// 健康检查发现副本恢复后重新使用副本
+	replica.SetDown(false)
+	deadline := time.Now().Add(time.Second)
+	for testutil.ToFloat64(m.Database.ReplicaHealthy.WithLabelValues("replica-1")) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("副本恢复后健康检查未标记为可用")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := db.WithContext(ctx).Find(&records).Error; err != nil {
+		t.Fatalf("副本恢复后查询失败: %v", err)
+	}
+	if got := selects(replica); got != 1 {
+		t.Fatalf("副本恢复后副本执行的查询数 = %d, want 1", got)
+	}
+}
+
+func TestReplica_ConnErrorMarksUnhealthy(t *testing.T) {
+	primary, replica := fakedb.New(), fakedb.New()
+	db := withReplica(t, primary, replica, time.Hour, nil)
+	ctx := database.ReadOnly(context.Background())
+	var records []models.BidStrategy
+
+	// 查询遇到连接错误时立即标记副本不可用，不等待下一次健康检查
+	replica.SetDown(true)
+	if err := db.WithContext(ctx).Find(&records).Error; !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("副本断开时的查询 err = %v", err)
+	}
+	if err := db.WithContext(ctx).Find(&records).Error; err != nil {
+		t.Fatalf("副本不可用后的查询失败: %v", err)
+	}
+	if got := selects(primary); got != 1 {
+		t.Fatalf("副本不可用后主库执行的查询数 = %d, want 1", got)
+	}
+
+	// SQL本身的错误不影响副本的健康状态
+	replica.SetDown(false)
+	replica.FailOn("bid_strategies")
+	db = withReplica(t, fakedb.New(), replica, time.Hour, nil)
+	for i := 0; i < 2; i++ {
+		if err := db.WithContext(ctx).Find(&records).Error; err == nil {
+			t.Fatal("副本的查询应返回模拟的错误")
+		}
+	}
+	if got := selects(replica); got != 2 {
+		t.Fatalf("SQL错误后仍应查询副本, 副本执行的查询数 = %d, want 2", got)
+	}
+}
+
+func TestUseReplicas_Errors(t *testing.T) {
+	replica := fakedb.New()
+	replicas := []database.Replica{{Name: "replica-1", DB: sql.OpenDB(replica)}}
+
+	if err := database.UseReplicas(fakedb.New().Open(t), replicas, time.Hour); !errors.Is(err, database.ErrNotInstrumented) {
+		t.Fatalf("未注册插件时 err = %v", err)
+	}
+
+	db := withReplica(t, fakedb.New(), replica, time.Hour, nil)
+	if err := database.UseReplicas(db, replicas, time.Hour); !errors.Is(err, database.ErrReplicasConfigured) {
+		t.Fatalf("重复设置副本时 err = %v", err)
+	}
+}
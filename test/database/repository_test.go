@@ -0,0 +1,121 @@
+package database_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/config"
+	"simple-dsp/test/fakedb"
+)
+
+func newRepository(t *testing.T, f *fakedb.DB) bidding.Repository {
+	t.Helper()
+	return bidding.NewGormRepository(instrument(t, f, config.PostgresConfig{}, nil, nil))
+}
+
+// lastUpdate 返回最后一条UPDATE语句
+func lastUpdate(t *testing.T, f *fakedb.DB) string {
+	t.Helper()
+	statements := f.Queries()
+	for i := len(statements) - 1; i >= 0; i-- {
+		if strings.HasPrefix(statements[i], "UPDATE") {
+			return statements[i]
+		}
+	}
+	t.Fatalf("没有UPDATE语句: %q", statements)
+	return ""
+}
+
+func TestGormRepository_CreateAndGet(t *testing.T) {
+	f := fakedb.New()
+	repo := newRepository(t, f)
+	ctx := context.Background()
+
+	f.Respond(`INSERT INTO "bid_strategies"`, "", []string{"id"}, []driver.Value{int64(42)})
+	strategy := &bidding.BidStrategy{Name: "s", BidType: bidding.BidTypeCPM, Price: 2.5, Participation: 0.5}
+	if err := repo.CreateBidStrategy(ctx, strategy); err != nil {
+		t.Fatalf("CreateBidStrategy失败: %v", err)
+	}
+	if strategy.ID != "42" || strategy.CreateTime.IsZero() {
+		t.Fatalf("创建后的策略 = %+v", strategy)
+	}
+
+	// 不存在时返回nil
+	got, err := repo.GetBidStrategy(ctx, 7)
+	if err != nil || got != nil {
+		t.Fatalf("GetBidStrategy = %+v, %v", got, err)
+	}
+
+	now := time.Now()
+	f.Respond(`SELECT * FROM "bid_strategies"`, "",
+		[]string{"id", "name", "bid_type", "price", "status", "participation_rate", "created_at"},
+		[]driver.Value{int64(42), "s", bidding.BidTypeCPM, 2.5, int64(1), 0.5, now})
+	got, err = repo.GetBidStrategy(ctx, 42)
+	if err != nil || got == nil {
+		t.Fatalf("GetBidStrategy = %+v, %v", got, err)
+	}
+	if got.ID != "42" || got.Price != 2.5 || got.Participation != 0.5 || !got.CreateTime.Equal(now) {
+		t.Fatalf("读取的策略 = %+v", got)
+	}
+}
+
+func TestGormRepository_UpdateLockedPrice(t *testing.T) {
+	f := fakedb.New()
+	repo := newRepository(t, f)
+	ctx := context.Background()
+	strategy := &bidding.BidStrategy{ID: "42", Name: "s", Price: 3}
+
+	f.Respond(`SELECT "id","is_price_locked"`, "", []string{"id", "is_price_locked"}, []driver.Value{int64(42), true})
+	if err := repo.UpdateBidStrategy(ctx, strategy); err != nil {
+		t.Fatalf("UpdateBidStrategy失败: %v", err)
+	}
+	statements := f.Queries()
+	if statements[0] != "BEGIN" || !strings.Contains(statements[1], "FOR UPDATE") || statements[len(statements)-1] != "COMMIT" {
+		t.Fatalf("应在事务中锁定策略后更新: %q", statements)
+	}
+	if update := lastUpdate(t, f); strings.Contains(update, `"price"=`) {
+		t.Fatalf("价格已锁定时不应更新价格: %s", update)
+	}
+
+	f.Respond(`SELECT "id","is_price_locked"`, "", []string{"id", "is_price_locked"}, []driver.Value{int64(42), false})
+	if err := repo.UpdateBidStrategy(ctx, strategy); err != nil {
+		t.Fatalf("UpdateBidStrategy失败: %v", err)
+	}
+	if update := lastUpdate(t, f); !strings.Contains(update, `"price"=`) {
+		t.Fatalf("价格未锁定时应更新价格: %s", update)
+	}
+
+	if err := repo.UpdateBidStrategy(ctx, &bidding.BidStrategy{ID: "abc"}); !errors.Is(err, bidding.ErrInvalidStrategy) {
+		t.Fatalf("无效ID err = %v", err)
+	}
+}
+
+func TestGormRepository_List(t *testing.T) {
+	f := fakedb.New()
+	repo := newRepository(t, f)
+	f.Respond(`SELECT count(*)`, "", []string{"count"}, []driver.Value{int64(3)})
+	f.Respond(`SELECT * FROM "bid_strategies"`, "", []string{"id", "name"},
+		[]driver.Value{int64(3), "c"}, []driver.Value{int64(2), "b"})
+
+	status := bidding.StrategyStatusEnabled
+	minPrice := 1.0
+	strategies, total, err := repo.ListBidStrategies(context.Background(), bidding.BidStrategyFilter{
+		Status:   &status,
+		MinPrice: &minPrice,
+		Page:     1,
+		PageSize: 2,
+	})
+	if err != nil || total != 3 || len(strategies) != 2 || strategies[0].ID != "3" {
+		t.Fatalf("ListBidStrategies = %+v, %d, %v", strategies, total, err)
+	}
+	statements := f.Queries()
+	query := statements[len(statements)-1]
+	if !strings.Contains(query, "status = $1 AND price >= $2") || !strings.Contains(query, "ORDER BY id DESC LIMIT 2") {
+		t.Fatalf("查询语句 = %s", query)
+	}
+}
@@ -0,0 +1,103 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/database"
+	"simple-dsp/test/fakedb"
+)
+
+// newRecorder 设置记录span的全局TracerProvider
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+	return recorder
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing_Statement(t *testing.T) {
+	recorder := newRecorder(t)
+	f := fakedb.New()
+	repo := bidding.NewGormRepository(instrument(t, f, config.PostgresConfig{}, nil, nil))
+
+	if _, err := repo.GetBidStrategy(context.Background(), 42); err != nil {
+		t.Fatalf("GetBidStrategy失败: %v", err)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Name() != "bidding.get_strategy" {
+		t.Fatalf("spans = %v", spans)
+	}
+	attrs := attributes(spans[0])
+	if attrs["db.system"].AsString() != "postgresql" || attrs["db.operation.name"].AsString() != "query" ||
+		attrs["db.collection.name"].AsString() != "bid_strategies" {
+		t.Fatalf("attributes = %v", attrs)
+	}
+	if text := attrs["db.query.text"].AsString(); text != `SELECT * FROM "bid_strategies" WHERE id = $1 LIMIT 1` {
+		t.Fatalf("语句 = %s", text)
+	}
+	if spans[0].Status().Code == codes.Error {
+		t.Fatal("记录不存在不应标记为错误")
+	}
+
+	// 失败的语句记录错误
+	f.FailOn("DELETE")
+	if err := repo.DeleteBidStrategy(context.Background(), 42); err == nil {
+		t.Fatal("删除应返回模拟的错误")
+	}
+	spans = recorder.Ended()
+	last := spans[len(spans)-1]
+	if last.Name() != "bidding.delete_strategy" || last.Status().Code != codes.Error || len(last.Events()) == 0 {
+		t.Fatalf("失败语句的span = %s, %v", last.Name(), last.Status())
+	}
+}
+
+func TestTracing_Transaction(t *testing.T) {
+	recorder := newRecorder(t)
+	f := fakedb.New()
+	db := instrument(t, f, config.PostgresConfig{}, nil, nil)
+
+	ctx := database.WithQueryName(context.Background(), "ledger.save_balances")
+	errRollback := errors.New("回滚")
+	err := database.Transaction(ctx, db, func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM ledger_daily_balances").Error; err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("Transaction err = %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("spans = %v", spans)
+	}
+	statement, transaction := spans[0], spans[1]
+	if transaction.Name() != "ledger.save_balances transaction" || transaction.Status().Code != codes.Error {
+		t.Fatalf("事务span = %s, %v", transaction.Name(), transaction.Status())
+	}
+	if statement.Name() != "ledger.save_balances" || statement.Parent().SpanID() != transaction.SpanContext().SpanID() {
+		t.Fatal("事务内的语句应为事务span的子span")
+	}
+}
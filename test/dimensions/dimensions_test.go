@@ -0,0 +1,196 @@
+package dimensions_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+func TestDimensionValue(t *testing.T) {
+	d := stats.Dimensions{Country: "CN", Province: "广东", City: "深圳", DeviceType: "mobile", OS: "android"}
+	want := map[stats.Dimension]string{
+		stats.DimensionCountry:    "CN",
+		stats.DimensionProvince:   "CN/广东",
+		stats.DimensionCity:       "CN/广东/深圳",
+		stats.DimensionDeviceType: "mobile",
+		stats.DimensionOS:         "android",
+	}
+	for _, dim := range stats.AllDimensions {
+		if got := d.Value(dim); got != want[dim] {
+			t.Errorf("Value(%s) = %q, want %q", dim, got, want[dim])
+		}
+	}
+
+	var empty stats.Dimensions
+	for _, dim := range stats.AllDimensions {
+		if got := empty.Value(dim); got != "unknown" {
+			t.Errorf("没有维度时Value(%s)应为unknown, got %q", dim, got)
+		}
+	}
+	if (stats.Dimensions{Country: "CN"}).Value(stats.DimensionProvince) != "unknown" {
+		t.Error("没有省份时应为unknown")
+	}
+}
+
+func TestParseDimension(t *testing.T) {
+	if dim, err := stats.ParseDimension("device_type"); err != nil || dim != stats.DimensionDeviceType {
+		t.Errorf("ParseDimension = %v, %v", dim, err)
+	}
+	if _, err := stats.ParseDimension("slot_id"); !errors.Is(err, stats.ErrUnknownDimension) {
+		t.Errorf("err = %v, want ErrUnknownDimension", err)
+	}
+}
+
+func TestDimensionResolver(t *testing.T) {
+	db, err := geo.Parse(strings.NewReader(geoCSV))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	resolver := stats.NewDimensionResolver(db)
+
+	got := resolver.Resolve("203.0.113.9", "Mozilla/5.0 (Windows NT 10.0; Win64; x64)")
+	want := stats.Dimensions{Country: "CN", Province: "广东", City: "深圳", DeviceType: "desktop", OS: "windows"}
+	if got != want {
+		t.Errorf("Resolve = %+v, want %+v", got, want)
+	}
+	if got := resolver.Resolve("", ""); !got.IsZero() {
+		t.Errorf("没有IP和UA时不应有维度, got %+v", got)
+	}
+
+	// 未配置IP库时只解析设备
+	got = stats.NewDimensionResolver(nil).Resolve("203.0.113.9", "Roku/DVP-12.0")
+	if got.Country != "" || got.DeviceType != "ctv" {
+		t.Errorf("Resolve = %+v", got)
+	}
+}
+
+func TestEventDimensionsJSON(t *testing.T) {
+	event := stats.Event{EventType: stats.EventImpression, AdID: "1",
+		Dimensions: stats.Dimensions{Country: "CN", DeviceType: "mobile"}}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	body := string(data)
+	if !strings.Contains(body, `"country":"CN"`) || !strings.Contains(body, `"device_type":"mobile"`) || strings.Contains(body, `"city"`) {
+		t.Errorf("维度应展开在事件中且省略空值: %s", body)
+	}
+
+	var decoded stats.Event
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Dimensions != event.Dimensions {
+		t.Errorf("反序列化维度错误: %+v, %v", decoded.Dimensions, err)
+	}
+}
+
+func TestDimensionStoreLoad(t *testing.T) {
+	fake := fakeredis.New(t)
+	fake.HSet("stats:dim:1:2026-10-15:country", map[string]string{
+		"CN|impression": "100", "CN|click": "4", "CN|cost": "250", "CN|win": "110",
+		"US|impression": "20", "US|click": "1", "US|conversion": "1",
+	})
+	fake.HSet("stats:dim:1:2026-10-16:country", map[string]string{
+		"CN|impression": "50", "CN|click": "2", "CN|conversion": "1",
+		"unknown|impression": "200",
+	})
+	// 范围外的日期和其他维度不计入
+	fake.HSet("stats:dim:1:2026-10-17:country", map[string]string{"CN|impression": "999"})
+	fake.HSet("stats:dim:1:2026-10-16:os", map[string]string{"ios|impression": "999"})
+
+	store := stats.NewDimensionStore(fake.Client(t), 0)
+	items, err := store.Load(context.Background(), "1", stats.DimensionCountry, "2026-10-15", "2026-10-16")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("应有3个取值, got %+v", items)
+	}
+	// 按展示数降序
+	if items[0].Value != "unknown" || items[1].Value != "CN" || items[2].Value != "US" {
+		t.Fatalf("排序错误: %+v", items)
+	}
+	cn := items[1]
+	if cn.Impressions != 150 || cn.Clicks != 6 || cn.Wins != 110 || cn.Conversions != 1 || cn.Cost != 2.5 {
+		t.Errorf("CN汇总错误: %+v", cn)
+	}
+	if cn.CTR != 0.04 {
+		t.Errorf("CTR应为0.04, got %v", cn.CTR)
+	}
+	if us := items[2]; us.CVR != 1 {
+		t.Errorf("CVR应为1, got %v", us.CVR)
+	}
+}
+
+// memoryLoader 固定的按维度统计
+type memoryLoader struct {
+	items []stats.DimensionStats
+	dim   stats.Dimension
+	adID  string
+}
+
+func (m *memoryLoader) Load(ctx context.Context, adID string, dim stats.Dimension, startDate, endDate string) ([]stats.DimensionStats, error) {
+	m.adID, m.dim = adID, dim
+	return m.items, nil
+}
+
+func TestBreakdownHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	loader := &memoryLoader{items: []stats.DimensionStats{
+		{Value: "mobile", Impressions: 80, Clicks: 4, Cost: 8},
+		{Value: "desktop", Impressions: 20, Clicks: 1, Conversions: 1, Cost: 2},
+	}}
+	router := gin.New()
+	handlers.NewBreakdownHandler(loader, logger.NewLogger(zap.NewNop())).RegisterRoutes(router)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/breakdown?"+query, nil))
+		return w
+	}
+
+	w := get("ad_id=1&dimension=device_type&start_date=2026-10-10&end_date=2026-10-16")
+	if w.Code != http.StatusOK {
+		t.Fatalf("应返回200, got %d: %s", w.Code, w.Body)
+	}
+	if loader.adID != "1" || loader.dim != stats.DimensionDeviceType {
+		t.Errorf("查询条件错误: ad_id=%s dimension=%s", loader.adID, loader.dim)
+	}
+	var body struct {
+		Dimension string                 `json:"dimension"`
+		Summary   stats.DimensionStats   `json:"summary"`
+		Items     []stats.DimensionStats `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(body.Items) != 2 || body.Summary.Impressions != 100 || body.Summary.Cost != 10 || body.Summary.CTR != 0.05 || body.Summary.CVR != 0.2 {
+		t.Errorf("合计错误: %+v", body.Summary)
+	}
+
+	// 默认按国家拆分
+	if w := get("ad_id=1"); w.Code != http.StatusOK || loader.dim != stats.DimensionCountry {
+		t.Errorf("默认维度应为country, got %d %s", w.Code, loader.dim)
+	}
+
+	for _, query := range []string{
+		"dimension=country",
+		"ad_id=1&dimension=slot_id",
+		"ad_id=1&start_date=2026-10-17&end_date=2026-10-16",
+	} {
+		if w := get(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s应返回400, got %d", query, w.Code)
+		}
+	}
+}
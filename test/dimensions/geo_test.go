@@ -0,0 +1,89 @@
+package dimensions_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"simple-dsp/pkg/geo"
+)
+
+const geoCSV = `# network,country,province,city
+1.0.0.0/8,AU
+203.0.113.0/24,CN,广东,深圳
+203.0.113.128/25,CN,广东,广州
+203.0.114.0/24,cn,北京
+2001:db8::/32,JP,東京都,
+`
+
+func TestGeoLookup(t *testing.T) {
+	db, err := geo.Parse(strings.NewReader(geoCSV))
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if db.Len() != 5 {
+		t.Fatalf("应有5个IP段, got %d", db.Len())
+	}
+
+	tests := []struct {
+		ip   string
+		want geo.Location
+		ok   bool
+	}{
+		{"203.0.113.9", geo.Location{Country: "CN", Province: "广东", City: "深圳"}, true},
+		// 嵌套的IP段以更精确的为准
+		{"203.0.113.200", geo.Location{Country: "CN", Province: "广东", City: "广州"}, true},
+		{"203.0.114.1", geo.Location{Country: "CN", Province: "北京"}, true},
+		{"1.2.3.4", geo.Location{Country: "AU"}, true},
+		{"::ffff:203.0.113.9", geo.Location{Country: "CN", Province: "广东", City: "深圳"}, true},
+		{"2001:db8::1", geo.Location{Country: "JP", Province: "東京都"}, true},
+		{"203.0.115.1", geo.Location{}, false},
+		{"2001:db9::1", geo.Location{}, false},
+		{"not-an-ip", geo.Location{}, false},
+		{"", geo.Location{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(tt.ip)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%q) = %+v, %v, want %+v, %v", tt.ip, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestGeoParseInvalid(t *testing.T) {
+	for _, data := range []string{
+		"203.0.113.0/24\n",
+		"203.0.113.0,CN\n",
+		"203.0.113.0/24,,广东\n",
+		"203.0.113.0/24,CN,广东,深圳,南山\n",
+	} {
+		if _, err := geo.Parse(strings.NewReader(data)); !errors.Is(err, geo.ErrInvalidRecord) {
+			t.Errorf("Parse(%q) err = %v, want ErrInvalidRecord", data, err)
+		}
+	}
+}
+
+func TestGeoLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geoip.csv")
+	if err := os.WriteFile(path, []byte(geoCSV), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	db, err := geo.Load(path)
+	if err != nil {
+		t.Fatalf("加载失败: %v", err)
+	}
+	if loc, ok := db.Lookup("203.0.113.9"); !ok || loc.City != "深圳" {
+		t.Errorf("Lookup = %+v, %v", loc, ok)
+	}
+
+	if _, err := geo.Load(filepath.Join(t.TempDir(), "missing.csv")); err == nil {
+		t.Error("文件不存在时应返回错误")
+	}
+
+	var empty *geo.Database
+	if _, ok := empty.Lookup("203.0.113.9"); ok || empty.Len() != 0 {
+		t.Error("为nil的IP库不应查到结果")
+	}
+}
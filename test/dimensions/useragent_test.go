@@ -0,0 +1,45 @@
+package dimensions_test
+
+import (
+	"testing"
+
+	"simple-dsp/pkg/useragent"
+)
+
+func TestUserAgentParse(t *testing.T) {
+	tests := []struct {
+		name string
+		ua   string
+		want useragent.Device
+	}{
+		{"iPhone", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148",
+			useragent.Device{Type: useragent.DeviceMobile, OS: useragent.OSIOS}},
+		{"iPad", "Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148",
+			useragent.Device{Type: useragent.DeviceTablet, OS: useragent.OSIOS}},
+		{"Android手机", "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36",
+			useragent.Device{Type: useragent.DeviceMobile, OS: useragent.OSAndroid}},
+		{"Android平板", "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 Chrome/120.0 Safari/537.36",
+			useragent.Device{Type: useragent.DeviceTablet, OS: useragent.OSAndroid}},
+		{"HarmonyOS", "Mozilla/5.0 (Linux; Android 12; HarmonyOS; NOH-AN00) AppleWebKit/537.36 Mobile Safari/537.36",
+			useragent.Device{Type: useragent.DeviceMobile, OS: useragent.OSHarmonyOS}},
+		{"Windows", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36",
+			useragent.Device{Type: useragent.DeviceDesktop, OS: useragent.OSWindows}},
+		{"macOS", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 Version/17.0 Safari/605.1.15",
+			useragent.Device{Type: useragent.DeviceDesktop, OS: useragent.OSMacOS}},
+		{"Linux", "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0",
+			useragent.Device{Type: useragent.DeviceDesktop, OS: useragent.OSLinux}},
+		{"Android TV", "Mozilla/5.0 (Linux; Android 9; BRAVIA 4K GB) AppleWebKit/537.36 Chrome/120.0 Safari/537.36",
+			useragent.Device{Type: useragent.DeviceCTV, OS: useragent.OSAndroid}},
+		{"Tizen电视", "Mozilla/5.0 (SMART-TV; LINUX; Tizen 6.0) AppleWebKit/537.36 SamsungBrowser/4.0 TV Safari/537.36",
+			useragent.Device{Type: useragent.DeviceCTV, OS: useragent.OSTizen}},
+		{"Roku", "Roku/DVP-12.0 (12.0.0.4182-88)",
+			useragent.Device{Type: useragent.DeviceCTV, OS: useragent.OSRoku}},
+		{"空", "", useragent.Device{Type: useragent.DeviceUnknown, OS: useragent.OSOther}},
+		{"未知", "curl/8.0", useragent.Device{Type: useragent.DeviceUnknown, OS: useragent.OSOther}},
+	}
+	for _, tt := range tests {
+		if got := useragent.Parse(tt.ua); got != tt.want {
+			t.Errorf("%s: Parse = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/pricing"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryBidRecords 内存出价记录
+type memoryBidRecords struct {
+	mu      sync.Mutex
+	records map[string]*event.BidRecord
+	err     error
+}
+
+func (s *memoryBidRecords) Save(ctx context.Context, record *event.BidRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[record.RequestID+":"+record.AdID] = record
+	return nil
+}
+
+func (s *memoryBidRecords) Get(ctx context.Context, requestID, adID string) (*event.BidRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	record, ok := s.records[requestID+":"+adID]
+	if !ok {
+		return nil, event.ErrBidRecordNotFound
+	}
+	return record, nil
+}
+
+// bidTestEnv 带出价校验的事件接口
+type bidTestEnv struct {
+	router  *gin.Engine
+	records *memoryBidRecords
+	sink    *memorySink
+	handler *event.Handler
+	metrics *metrics.Metrics
+}
+
+func newBidTestEnv(t *testing.T) *bidTestEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	m := newMetrics()
+	sink := &memorySink{}
+	p := newPipeline(config.EventConfig{Shards: 1, BatchSize: 1, FlushInterval: time.Millisecond}, sink, m)
+	p.Start()
+	t.Cleanup(p.Stop)
+
+	records := &memoryBidRecords{records: map[string]*event.BidRecord{}}
+	records.Save(context.Background(), &event.BidRecord{RequestID: "r1", AdID: "a1", Exchange: "adx", BidPrice: 2.0})
+
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(p)
+	h.SetBidRecords(records, 0.01)
+
+	router := gin.New()
+	router.POST("/impression", h.HandleImpression)
+	router.GET("/win", h.HandleWin)
+	return &bidTestEnv{router: router, records: records, sink: sink, handler: h, metrics: m}
+}
+
+func (e *bidTestEnv) do(req *http.Request) int {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func impression(body string) *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/impression", strings.NewReader(body))
+}
+
+func TestImpressionRequiresBidRecord(t *testing.T) {
+	env := newBidTestEnv(t)
+
+	if code := env.do(impression(`{"request_id":"r1","ad_id":"a1"}`)); code != http.StatusOK {
+		t.Fatalf("有出价记录的展示 code = %d, want 200", code)
+	}
+	if code := env.do(impression(`{"request_id":"r2","ad_id":"a1"}`)); code != http.StatusBadRequest {
+		t.Fatalf("没有出价记录的展示 code = %d, want 400", code)
+	}
+	if code := env.do(impression(`{"request_id":"r1","ad_id":"other"}`)); code != http.StatusBadRequest {
+		t.Fatalf("广告不匹配的展示 code = %d, want 400", code)
+	}
+	if code := env.do(impression(`{"ad_id":"a1"}`)); code != http.StatusBadRequest {
+		t.Fatalf("缺少请求ID的展示 code = %d, want 400", code)
+	}
+}
+
+func TestImpressionCreativeFromBidRecord(t *testing.T) {
+	env := newBidTestEnv(t)
+	env.records.Save(context.Background(), &event.BidRecord{RequestID: "r3", AdID: "a1", CreativeID: "11", BidPrice: 2.0})
+
+	// 素材以出价记录为准，客户端带回的值被忽略
+	if code := env.do(impression(`{"request_id":"r3","ad_id":"a1","creative_id":"99"}`)); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	if got := env.sink.events()[0].CreativeID; got != "11" {
+		t.Fatalf("CreativeID = %q, want 11", got)
+	}
+}
+
+func TestWinPriceMismatchFlagged(t *testing.T) {
+	env := newBidTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/win?request_id=r1&ad_id=a1&price=3.5", nil)
+	if code := env.do(req); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	got := env.sink.events()[0]
+	if got.ExtraParams["price_mismatch"] != "1" || got.ExtraParams["bid_price"] != "2" {
+		t.Fatalf("ExtraParams = %v, want price_mismatch标记", got.ExtraParams)
+	}
+}
+
+func TestWinWithinToleranceNotFlagged(t *testing.T) {
+	env := newBidTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/win?request_id=r1&ad_id=a1&price=2.01", nil)
+	if code := env.do(req); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	if _, flagged := env.sink.events()[0].ExtraParams["price_mismatch"]; flagged {
+		t.Fatal("容差内的成交价不应标记")
+	}
+}
+
+func TestWinExchangeFromBidRecord(t *testing.T) {
+	key := pricing.KeyPair{EncryptionKey: []byte("encryption-key"), IntegrityKey: []byte("integrity-key")}
+	decrypter := pricing.NewDecrypter()
+	decrypter.SetKeys("adx", []pricing.KeyPair{key})
+
+	env := newBidTestEnv(t)
+	h := event.NewHandler(nil, decrypter, logger.NewLogger(zap.NewNop()), env.metrics)
+	p := newPipeline(config.EventConfig{Shards: 1, BatchSize: 1, FlushInterval: time.Millisecond}, env.sink, env.metrics)
+	p.Start()
+	t.Cleanup(p.Stop)
+	h.SetPipeline(p)
+	h.SetBidRecords(env.records, 0.01)
+	env.router = gin.New()
+	env.router.GET("/win", h.HandleWin)
+
+	// exchange参数不能把配置了密钥的交易平台换成明文交易平台
+	if code := env.do(win("exchange=plain&request_id=r1&ad_id=a1&price=1.5")); code != http.StatusBadRequest {
+		t.Fatalf("明文成交价 code = %d, want 400", code)
+	}
+	if got := testutil.ToFloat64(env.metrics.Events.PriceDecryptErrors.WithLabelValues("adx", "plaintext")); got != 1 {
+		t.Fatalf("明文成交价指标 = %v, want 1", got)
+	}
+
+	price, err := pricing.Encrypt(key, make([]byte, 16), 1.5)
+	if err != nil {
+		t.Fatalf("加密价格失败: %v", err)
+	}
+	if code := env.do(win("exchange=plain&request_id=r1&ad_id=a1&price=" + price)); code != http.StatusOK {
+		t.Fatalf("加密成交价 code = %d, want 200", code)
+	}
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	if got := env.sink.events()[0]; got.WinPrice != 1.5 || got.ExtraParams["exchange"] != "adx" {
+		t.Fatalf("event = %+v, want 出价记录的交易平台adx", got)
+	}
+}
+
+func TestBidRecordStoreErrorFailsOpen(t *testing.T) {
+	env := newBidTestEnv(t)
+	env.records.err = errors.New("redis down")
+
+	if code := env.do(impression(`{"request_id":"r9","ad_id":"a1"}`)); code != http.StatusOK {
+		t.Fatalf("存储不可用时应放行, code = %d", code)
+	}
+}
+
+func TestBidValidationMetrics(t *testing.T) {
+	m := newMetrics()
+	records := &memoryBidRecords{records: map[string]*event.BidRecord{}}
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(newPipeline(config.EventConfig{}, &memorySink{}, m))
+	h.SetBidRecords(records, 0)
+
+	router := gin.New()
+	router.POST("/impression", h.HandleImpression)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, impression(`{"request_id":"r1","ad_id":"a1"}`))
+
+	if got := testutil.ToFloat64(m.Events.BidValidation.WithLabelValues("impression", "unknown_bid")); got != 1 {
+		t.Fatalf("unknown_bid = %v, want 1", got)
+	}
+}
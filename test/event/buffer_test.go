@@ -0,0 +1,266 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// fakeKafka 可模拟不可用的Kafka，记录写出的消息
+type fakeKafka struct {
+	mu      sync.Mutex
+	down    bool
+	partial bool // 为true时每批只写出第一条消息
+	written []string
+}
+
+func (k *fakeKafka) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.down {
+		return errors.New("kafka unavailable")
+	}
+	if k.partial {
+		errs := make(kafka.WriteErrors, len(msgs))
+		for i := 1; i < len(msgs); i++ {
+			errs[i] = errors.New("leader not available")
+		}
+		k.written = append(k.written, string(msgs[0].Value))
+		return errs
+	}
+	for _, msg := range msgs {
+		k.written = append(k.written, string(msg.Value))
+	}
+	return nil
+}
+
+func (k *fakeKafka) setDown(down bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.down = down
+}
+
+func (k *fakeKafka) values() []string {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return append([]string(nil), k.written...)
+}
+
+func newWriteBuffer(t *testing.T, cfg config.EventBufferConfig, k *fakeKafka, m *metrics.Metrics) *stats.WriteBuffer {
+	t.Helper()
+	b, err := stats.NewWriteBuffer(cfg, k, logger.NewLogger(zap.NewNop()), m)
+	if err != nil {
+		t.Fatalf("创建写出缓冲失败: %v", err)
+	}
+	return b
+}
+
+// write 逐条写出消息
+func write(t *testing.T, b *stats.WriteBuffer, values ...string) {
+	t.Helper()
+	for _, v := range values {
+		if err := b.WriteMessages(context.Background(), kafka.Message{Topic: "dsp.events.click", Key: []byte("u1"), Value: []byte(v)}); err != nil {
+			t.Fatalf("写出消息失败: %v", err)
+		}
+	}
+}
+
+func TestWriteBuffer_ReplayInOrder(t *testing.T) {
+	k := &fakeKafka{}
+	m := newMetrics()
+	b := newWriteBuffer(t, config.EventBufferConfig{}, k, m)
+
+	write(t, b, "1")
+	k.setDown(true)
+	write(t, b, "2", "3")
+	if !b.Pending() {
+		t.Fatal("Kafka不可用时应缓冲事件")
+	}
+	if got := testutil.ToFloat64(m.Events.Buffered); got != 2 {
+		t.Errorf("缓冲的事件数 = %v, want 2", got)
+	}
+
+	// Kafka恢复后，新事件排在积压之后，不先于积压写出
+	k.setDown(false)
+	write(t, b, "4")
+	if got := k.values(); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Fatalf("有积压时新事件不应直接写出, got %v", got)
+	}
+
+	b.Replay()
+	if got := k.values(); !reflect.DeepEqual(got, []string{"1", "2", "3", "4"}) {
+		t.Errorf("重放顺序 = %v", got)
+	}
+	if b.Pending() {
+		t.Error("重放后不应有积压")
+	}
+	if got := testutil.ToFloat64(m.Events.Replayed); got != 3 {
+		t.Errorf("重放的事件数 = %v, want 3", got)
+	}
+	write(t, b, "5")
+	if got := k.values(); len(got) != 5 {
+		t.Errorf("没有积压时应直接写出, got %v", got)
+	}
+}
+
+func TestWriteBuffer_DropPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{stats.DropNewest, []string{"1", "2"}},
+		{stats.DropOldest, []string{"2", "3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			k := &fakeKafka{down: true}
+			m := newMetrics()
+			b := newWriteBuffer(t, config.EventBufferConfig{MaxEvents: 2, DropPolicy: tt.policy}, k, m)
+
+			write(t, b, "1", "2", "3")
+			if got := testutil.ToFloat64(m.Events.BufferDropped.WithLabelValues("full")); got != 1 {
+				t.Errorf("丢弃的事件数 = %v, want 1", got)
+			}
+			k.setDown(false)
+			b.Replay()
+			if got := k.values(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("重放的事件 = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteBuffer_PartialFailure(t *testing.T) {
+	k := &fakeKafka{partial: true}
+	b := newWriteBuffer(t, config.EventBufferConfig{}, k, newMetrics())
+
+	err := b.WriteMessages(context.Background(),
+		kafka.Message{Value: []byte("1")},
+		kafka.Message{Value: []byte("2")},
+	)
+	if err != nil {
+		t.Fatalf("部分失败时应缓冲失败的消息, got %v", err)
+	}
+	k.partial = false
+	b.Replay()
+	if got := k.values(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("只应重放失败的消息, got %v", got)
+	}
+}
+
+func TestWriteBuffer_Spill(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.EventBufferConfig{
+		MaxEvents: 1,
+		Spill:     config.EventSpillConfig{Enabled: true, Dir: dir, SegmentBytes: 64},
+	}
+	k := &fakeKafka{down: true}
+	m := newMetrics()
+	b := newWriteBuffer(t, cfg, k, m)
+	b.Start()
+
+	write(t, b, "1", "2", "3", "4")
+	if got := testutil.ToFloat64(m.Events.Spilled); got != 3 {
+		t.Errorf("写入磁盘的事件数 = %v, want 3", got)
+	}
+	if testutil.ToFloat64(m.Events.SpillBytes) == 0 {
+		t.Error("应统计磁盘中的字节数")
+	}
+
+	// 停止时Kafka仍不可用，内存中的事件写入磁盘，重启后继续重放
+	b.Stop()
+	if got := testutil.ToFloat64(m.Events.Spilled); got != 4 {
+		t.Errorf("停止时内存中的事件应写入磁盘, got %v", got)
+	}
+
+	k.setDown(false)
+	restarted := newWriteBuffer(t, cfg, k, newMetrics())
+	if !restarted.Pending() {
+		t.Fatal("重启后应继续重放磁盘中的事件")
+	}
+	restarted.Replay()
+	if got := k.values(); !reflect.DeepEqual(got, []string{"2", "3", "4", "1"}) {
+		t.Errorf("重放的事件 = %v", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("重放完成后应删除缓冲文件, got %d个", len(entries))
+	}
+}
+
+func TestWriteBuffer_SpillFull(t *testing.T) {
+	cfg := config.EventBufferConfig{
+		MaxEvents:  1,
+		DropPolicy: stats.DropOldest,
+		Spill:      config.EventSpillConfig{Enabled: true, Dir: t.TempDir(), MaxBytes: 40},
+	}
+	k := &fakeKafka{down: true}
+	m := newMetrics()
+	b := newWriteBuffer(t, cfg, k, m)
+
+	// 每条记录为8字节头和22字节消息，磁盘只能容纳一条
+	write(t, b, "1", "2", "3")
+	if got := testutil.ToFloat64(m.Events.BufferDropped.WithLabelValues("full")); got != 1 {
+		t.Errorf("磁盘已满时应丢弃新事件, got %v", got)
+	}
+	k.setDown(false)
+	b.Replay()
+	if got := k.values(); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("重放的事件 = %v", got)
+	}
+}
+
+func TestWriteBuffer_CorruptSpill(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.EventBufferConfig{
+		MaxEvents: 1,
+		Spill:     config.EventSpillConfig{Enabled: true, Dir: dir},
+	}
+	k := &fakeKafka{down: true}
+	b := newWriteBuffer(t, cfg, k, newMetrics())
+	b.Start()
+	write(t, b, "1", "2", "3")
+	b.Stop()
+
+	// 模拟进程崩溃时未写完的记录
+	files, err := filepath.Glob(filepath.Join(dir, "*.spill"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("缓冲文件 = %v, %v", files, err)
+	}
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1})
+	f.Close()
+
+	k.setDown(false)
+	m := newMetrics()
+	restarted := newWriteBuffer(t, cfg, k, m)
+	restarted.Replay()
+	if got := k.values(); !reflect.DeepEqual(got, []string{"2", "3", "1"}) {
+		t.Errorf("损坏之前的事件应正常重放, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.Events.BufferDropped.WithLabelValues("corrupt")); got != 1 {
+		t.Errorf("应统计损坏的文件, got %v", got)
+	}
+	if restarted.Pending() {
+		t.Error("丢弃损坏的部分后不应有积压")
+	}
+}
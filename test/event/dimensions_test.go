@@ -0,0 +1,83 @@
+package event_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/geo"
+)
+
+const iphoneUA = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+
+func newDimensionTestEnv(t *testing.T) *bidTestEnv {
+	t.Helper()
+	db, err := geo.Parse(strings.NewReader("203.0.113.0/24,CN,广东,深圳\n"))
+	if err != nil {
+		t.Fatalf("解析IP库失败: %v", err)
+	}
+	env := newBidTestEnv(t)
+	env.handler.SetDimensions(stats.NewDimensionResolver(db))
+	return env
+}
+
+func TestWinUsesBidRecordDimensions(t *testing.T) {
+	env := newDimensionTestEnv(t)
+	env.records.Save(context.Background(), &event.BidRecord{
+		RequestID:  "r2",
+		AdID:       "a1",
+		BidPrice:   2.0,
+		Dimensions: stats.Dimensions{Country: "CN", Province: "北京", City: "北京", DeviceType: "tablet", OS: "ios"},
+	})
+
+	// 竞价成功通知来自交易平台服务器，不按请求的IP和UA解析
+	req := httptest.NewRequest(http.MethodGet, "/win?request_id=r2&ad_id=a1&price=1.5", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("User-Agent", iphoneUA)
+	if code := env.do(req); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	got := env.sink.events()[0].Dimensions
+	if got.Province != "北京" || got.DeviceType != "tablet" {
+		t.Fatalf("应使用出价记录中的维度, got %+v", got)
+	}
+}
+
+func TestWinWithoutRecordDimensionsNotResolved(t *testing.T) {
+	env := newDimensionTestEnv(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/win?request_id=r1&ad_id=a1&price=1.5", nil)
+	req.RemoteAddr = "203.0.113.9:1234"
+	if code := env.do(req); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	if got := env.sink.events()[0].Dimensions; !got.IsZero() {
+		t.Fatalf("不应按交易平台的IP解析地域, got %+v", got)
+	}
+}
+
+func TestImpressionResolvesRequestDimensions(t *testing.T) {
+	env := newDimensionTestEnv(t)
+
+	req := impression(`{"request_id":"r1","ad_id":"a1"}`)
+	req.RemoteAddr = "203.0.113.9:1234"
+	req.Header.Set("User-Agent", iphoneUA)
+	if code := env.do(req); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	got := env.sink.events()[0].Dimensions
+	want := stats.Dimensions{Country: "CN", Province: "广东", City: "深圳", DeviceType: "mobile", OS: "ios"}
+	if got != want {
+		t.Fatalf("维度 = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package event_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+func newEngagementRouter(t *testing.T) (*gin.Engine, *memorySink) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	m := newMetrics()
+	sink := &memorySink{}
+	p := newPipeline(config.EventConfig{Shards: 1, BatchSize: 1, FlushInterval: time.Millisecond}, sink, m)
+	p.Start()
+	t.Cleanup(p.Stop)
+
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(p)
+
+	router := gin.New()
+	router.POST("/viewable", h.HandleViewable)
+	router.POST("/video/:stage", h.HandleVideo)
+	router.POST("/dwell", h.HandleDwell)
+	return router, sink
+}
+
+func post(router *gin.Engine, path, body string) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w.Code
+}
+
+func TestEngagementEvents(t *testing.T) {
+	router, sink := newEngagementRouter(t)
+
+	requests := []struct {
+		path string
+		want stats.EventType
+	}{
+		{"/viewable", stats.EventViewableImpression},
+		{"/video/start", stats.EventVideoStart},
+		{"/video/first_quartile", stats.EventVideoFirstQuartile},
+		{"/video/midpoint", stats.EventVideoMidpoint},
+		{"/video/third_quartile", stats.EventVideoThirdQuartile},
+		{"/video/complete", stats.EventVideoComplete},
+	}
+	for _, r := range requests {
+		if code := post(router, r.path, `{"user_id":"u1","ad_id":"a1","win_price":9.9}`); code != http.StatusOK {
+			t.Fatalf("%s code = %d, want 200", r.path, code)
+		}
+	}
+	if code := post(router, "/dwell", `{"user_id":"u1","ad_id":"a1","dwell_ms":4200}`); code != http.StatusOK {
+		t.Fatalf("dwell code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(sink.events()) == len(requests)+1 })
+	events := sink.events()
+	for i, r := range requests {
+		if events[i].EventType != r.want {
+			t.Errorf("事件%d类型 = %s, want %s", i, events[i].EventType, r.want)
+		}
+		if events[i].WinPrice != 0 {
+			t.Errorf("互动事件不应携带成交价: %v", events[i].WinPrice)
+		}
+	}
+	if dwell := events[len(events)-1]; dwell.EventType != stats.EventDwell || dwell.DwellMs != 4200 {
+		t.Fatalf("停留事件 = %+v", dwell)
+	}
+}
+
+func TestEngagementValidation(t *testing.T) {
+	router, _ := newEngagementRouter(t)
+
+	cases := []struct {
+		path, body string
+	}{
+		{"/video/halfway", `{"ad_id":"a1"}`},
+		{"/viewable", `{"user_id":"u1"}`},
+		{"/dwell", `{"ad_id":"a1"}`},
+		{"/dwell", `{"ad_id":"a1","dwell_ms":-5}`},
+		{"/dwell", `{"ad_id":"a1","dwell_ms":999999999999}`},
+	}
+	for _, tc := range cases {
+		if code := post(router, tc.path, tc.body); code != http.StatusBadRequest {
+			t.Errorf("%s %s code = %d, want 400", tc.path, tc.body, code)
+		}
+	}
+}
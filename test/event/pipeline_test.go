@@ -0,0 +1,284 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memorySink 记录写出的批次
+type memorySink struct {
+	mu      sync.Mutex
+	batches [][]*stats.Event
+	fail    int           // 前fail次写出返回错误
+	block   chan struct{} // 非nil时写出阻塞到关闭
+}
+
+func (s *memorySink) CollectBatch(ctx context.Context, events []*stats.Event) error {
+	if s.block != nil {
+		<-s.block
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("kafka unavailable")
+	}
+	s.batches = append(s.batches, append([]*stats.Event(nil), events...))
+	return nil
+}
+
+func (s *memorySink) events() []*stats.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var all []*stats.Event
+	for _, batch := range s.batches {
+		all = append(all, batch...)
+	}
+	return all
+}
+
+func newMetrics() *metrics.Metrics {
+	return &metrics.Metrics{
+		Events: &metrics.EventMetrics{
+			Impressions:          prometheus.NewCounterVec(prometheus.CounterOpts{Name: "impressions"}, []string{"ad_id", "slot_id"}),
+			PipelineDepth:        prometheus.NewGauge(prometheus.GaugeOpts{Name: "depth"}),
+			PipelineRejected:     prometheus.NewCounterVec(prometheus.CounterOpts{Name: "rejected"}, []string{"event_type"}),
+			PipelineDropped:      prometheus.NewCounter(prometheus.CounterOpts{Name: "dropped"}),
+			PipelineFlushSize:    prometheus.NewHistogram(prometheus.HistogramOpts{Name: "flush_size"}),
+			BidValidation:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "bid_validation"}, []string{"event_type", "result"}),
+			DuplicateWins:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "duplicate_wins"}, []string{"exchange"}),
+			PriceDecryptErrors:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "price_decrypt_errors"}, []string{"exchange", "reason"}),
+			SKAdNetworkPostbacks: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "skadn_postbacks"}, []string{"version", "result"}),
+			AdRenders:            prometheus.NewCounterVec(prometheus.CounterOpts{Name: "ad_renders"}, []string{"result"}),
+			Buffered:             prometheus.NewGauge(prometheus.GaugeOpts{Name: "buffered"}),
+			Spilled:              prometheus.NewCounter(prometheus.CounterOpts{Name: "spilled"}),
+			SpillBytes:           prometheus.NewGauge(prometheus.GaugeOpts{Name: "spill_bytes"}),
+			Replayed:             prometheus.NewCounter(prometheus.CounterOpts{Name: "replayed"}),
+			BufferDropped:        prometheus.NewCounterVec(prometheus.CounterOpts{Name: "buffer_dropped"}, []string{"reason"}),
+		},
+	}
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newPipeline(cfg config.EventConfig, sink event.Sink, m *metrics.Metrics) *event.Pipeline {
+	return event.NewPipeline(cfg, sink, logger.NewLogger(zap.NewNop()), m)
+}
+
+func TestPipelinePreservesPerUserOrder(t *testing.T) {
+	sink := &memorySink{}
+	p := newPipeline(config.EventConfig{
+		Shards:        4,
+		QueueSize:     4000,
+		BatchSize:     7,
+		FlushInterval: 5 * time.Millisecond,
+	}, sink, newMetrics())
+	p.Start()
+
+	const users, perUser = 10, 50
+	for i := 0; i < perUser; i++ {
+		for u := 0; u < users; u++ {
+			err := p.Submit(&stats.Event{
+				EventType: stats.EventImpression,
+				UserID:    fmt.Sprintf("u%d", u),
+				RequestID: fmt.Sprintf("%d", i),
+			})
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+		}
+	}
+	p.Stop()
+
+	events := sink.events()
+	if len(events) != users*perUser {
+		t.Fatalf("写出%d个事件, want %d", len(events), users*perUser)
+	}
+
+	next := map[string]int{}
+	for _, e := range events {
+		if want := fmt.Sprintf("%d", next[e.UserID]); e.RequestID != want {
+			t.Fatalf("用户%s的事件乱序: got %s, want %s", e.UserID, e.RequestID, want)
+		}
+		next[e.UserID]++
+	}
+}
+
+func TestPipelineBatchesBySize(t *testing.T) {
+	sink := &memorySink{}
+	p := newPipeline(config.EventConfig{
+		Shards:        1,
+		QueueSize:     100,
+		BatchSize:     5,
+		FlushInterval: time.Hour,
+	}, sink, newMetrics())
+	p.Start()
+
+	for i := 0; i < 12; i++ {
+		p.Submit(&stats.Event{EventType: stats.EventClick, UserID: "u1"})
+	}
+	p.Stop()
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sizes := make([]int, 0, len(sink.batches))
+	for _, batch := range sink.batches {
+		sizes = append(sizes, len(batch))
+	}
+	// 攒满两批，停止时写出剩余事件
+	if fmt.Sprint(sizes) != "[5 5 2]" {
+		t.Fatalf("批次大小 = %v, want [5 5 2]", sizes)
+	}
+}
+
+func TestPipelineRetriesFailedFlush(t *testing.T) {
+	sink := &memorySink{fail: 2}
+	m := newMetrics()
+	p := newPipeline(config.EventConfig{
+		Shards:        1,
+		BatchSize:     1,
+		MaxRetries:    2,
+		RetryDelay:    time.Millisecond,
+		FlushInterval: time.Hour,
+	}, sink, m)
+	p.Start()
+	p.Submit(&stats.Event{EventType: stats.EventClick, UserID: "u1"})
+	p.Stop()
+
+	if len(sink.events()) != 1 {
+		t.Fatal("重试后应写出成功")
+	}
+	if got := testutil.ToFloat64(m.Events.PipelineDropped); got != 0 {
+		t.Fatalf("dropped = %v, want 0", got)
+	}
+}
+
+// memoryObserver 记录观察到的批次
+type memoryObserver struct {
+	memorySink
+}
+
+func (o *memoryObserver) ObserveBatch(ctx context.Context, events []*stats.Event) error {
+	return o.CollectBatch(ctx, events)
+}
+
+func TestPipelineObservesWrittenBatches(t *testing.T) {
+	sink := &memorySink{fail: 1}
+	observer := &memoryObserver{}
+	p := newPipeline(config.EventConfig{
+		Shards:        1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}, sink, newMetrics())
+	p.SetObserver(observer)
+	p.Start()
+	p.Submit(&stats.Event{EventType: stats.EventClick, UserID: "u1", RequestID: "dropped"})
+	p.Submit(&stats.Event{EventType: stats.EventClick, UserID: "u1", RequestID: "written"})
+	p.Stop()
+
+	// 写出失败被丢弃的批次不通知观察者
+	events := observer.events()
+	if len(events) != 1 || events[0].RequestID != "written" {
+		t.Fatalf("observed = %+v, want only written", events)
+	}
+}
+
+func TestPipelineRejectsWhenFull(t *testing.T) {
+	sink := &memorySink{block: make(chan struct{})}
+	m := newMetrics()
+	p := newPipeline(config.EventConfig{
+		Shards:        1,
+		QueueSize:     2,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}, sink, m)
+	p.Start()
+
+	var rejected int
+	for i := 0; i < 10; i++ {
+		if err := p.Submit(&stats.Event{EventType: stats.EventClick, UserID: "u1"}); errors.Is(err, event.ErrQueueFull) {
+			rejected++
+		}
+	}
+	close(sink.block)
+	p.Stop()
+
+	// worker阻塞在第一批，队列最多再容纳2个事件
+	if rejected < 7 {
+		t.Fatalf("rejected = %d, want >= 7", rejected)
+	}
+	if got := testutil.ToFloat64(m.Events.PipelineRejected.WithLabelValues("click")); int(got) != rejected {
+		t.Fatalf("rejected metric = %v, want %d", got, rejected)
+	}
+	if err := p.Submit(&stats.Event{UserID: "u1"}); !errors.Is(err, event.ErrPipelineClosed) {
+		t.Fatalf("停止后提交 err = %v, want ErrPipelineClosed", err)
+	}
+}
+
+func TestHandlerBackpressure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sink := &memorySink{block: make(chan struct{})}
+	m := newMetrics()
+	p := newPipeline(config.EventConfig{
+		Shards:        1,
+		QueueSize:     1,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+	}, sink, m)
+	p.Start()
+	defer p.Stop()
+	defer close(sink.block)
+
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(p)
+	router := gin.New()
+	router.POST("/impression", h.HandleImpression)
+
+	var codes []int
+	for i := 0; i < 5; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/impression", strings.NewReader(`{"user_id":"u1","ad_id":"a1"}`))
+		router.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusServiceUnavailable && w.Header().Get("Retry-After") == "" {
+			t.Fatal("503响应应包含Retry-After")
+		}
+	}
+
+	if codes[0] != http.StatusOK {
+		t.Fatalf("首个事件应被接收, codes = %v", codes)
+	}
+	if codes[len(codes)-1] != http.StatusServiceUnavailable {
+		t.Fatalf("队列满后应返回503, codes = %v", codes)
+	}
+}
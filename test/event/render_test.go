@@ -0,0 +1,137 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/internal/event"
+)
+
+const adTokenSecret = "0123456789abcdef0123456789abcdef"
+
+// newRenderTestEnv 启用广告地址的事件接口，r1/a1的出价记录保存了广告代码
+func newRenderTestEnv(t *testing.T) (*bidTestEnv, *event.AdTokenSigner, *memoryWinDeduper) {
+	t.Helper()
+	env := newBidTestEnv(t)
+	env.records.Save(context.Background(), &event.BidRecord{
+		RequestID: "r1",
+		AdID:      "a1",
+		SlotID:    "s1",
+		Exchange:  "adx",
+		BidPrice:  2.0,
+		AdMarkup:  `<a href="https://example.com"><img src="https://cdn.example.com/a1.png"></a>`,
+	})
+	signer := event.NewAdTokenSigner(adTokenSecret, time.Minute)
+	deduper := &memoryWinDeduper{claimed: map[string]bool{}}
+	env.handler.SetAdServing(signer, deduper)
+	env.router.GET("/ad/:auction_token", env.handler.HandleAdRender)
+	return env, signer, deduper
+}
+
+func render(token string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/ad/"+token, nil)
+}
+
+func TestAdTokenSigner(t *testing.T) {
+	signer := event.NewAdTokenSigner(adTokenSecret, time.Minute)
+	token, err := signer.Parse(signer.Sign("r1", "a1"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if token.RequestID != "r1" || token.AdID != "a1" {
+		t.Fatalf("Parse() = %+v, want r1/a1", token)
+	}
+
+	// 其他密钥签发的令牌和篡改的令牌被拒绝
+	other := event.NewAdTokenSigner(strings.Repeat("x", 32), time.Minute).Sign("r1", "a1")
+	tampered := "e30" + signer.Sign("r1", "a1")[3:]
+	for _, raw := range []string{"", "abc", other, tampered} {
+		if _, err := signer.Parse(raw); !errors.Is(err, event.ErrInvalidAdToken) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalidAdToken", raw, err)
+		}
+	}
+
+	expired := event.NewAdTokenSigner(adTokenSecret, time.Nanosecond).Sign("r1", "a1")
+	time.Sleep(time.Second)
+	if _, err := signer.Parse(expired); !errors.Is(err, event.ErrAdTokenExpired) {
+		t.Errorf("Parse(过期令牌) error = %v, want ErrAdTokenExpired", err)
+	}
+}
+
+func TestAdRenderServesMarkupAndRecordsImpressionOnce(t *testing.T) {
+	env, signer, _ := newRenderTestEnv(t)
+	token := signer.Sign("r1", "a1")
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, render(token))
+		if w.Code != http.StatusOK {
+			t.Fatalf("第%d次获取 code = %d, want 200", i+1, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "a1.png") {
+			t.Fatalf("body = %s, want 广告代码", w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("Content-Type = %s, want text/html", ct)
+		}
+		if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "no-store") {
+			t.Errorf("Cache-Control = %s, want no-store", cc)
+		}
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) >= 1 })
+	time.Sleep(20 * time.Millisecond)
+	events := env.sink.events()
+	if len(events) != 1 {
+		t.Fatalf("记录的展示事件 = %d, want 1", len(events))
+	}
+	if e := events[0]; e.EventType != "impression" || e.SlotID != "s1" || e.ExtraParams["exchange"] != "adx" {
+		t.Errorf("展示事件 = %+v", e)
+	}
+	if got := testutil.ToFloat64(env.metrics.Events.AdRenders.WithLabelValues("duplicate")); got != 1 {
+		t.Errorf("重复获取指标 = %v, want 1", got)
+	}
+}
+
+func TestAdRenderRejections(t *testing.T) {
+	env, signer, _ := newRenderTestEnv(t)
+	env.records.Save(context.Background(), &event.BidRecord{RequestID: "r2", AdID: "a2", BidPrice: 1.0})
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{name: "令牌无效", token: "invalid", want: http.StatusBadRequest},
+		{name: "令牌过期", token: event.NewAdTokenSigner(adTokenSecret, time.Nanosecond).Sign("r1", "a1"), want: http.StatusGone},
+		{name: "出价记录不存在", token: signer.Sign("r9", "a9"), want: http.StatusNotFound},
+		{name: "没有保存广告代码", token: signer.Sign("r2", "a2"), want: http.StatusNotFound},
+	}
+	time.Sleep(time.Second)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := env.do(render(tt.token)); code != tt.want {
+				t.Errorf("code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+	if n := len(env.sink.events()); n != 0 {
+		t.Errorf("拒绝的请求不应记录展示, events = %d", n)
+	}
+}
+
+func TestAdRenderDisabled(t *testing.T) {
+	env := newBidTestEnv(t)
+	env.router.GET("/ad/:auction_token", env.handler.HandleAdRender)
+	token := event.NewAdTokenSigner(adTokenSecret, time.Minute).Sign("r1", "a1")
+	if code := env.do(render(token)); code != http.StatusNotFound {
+		t.Fatalf("未启用广告地址 code = %d, want 404", code)
+	}
+}
@@ -0,0 +1,202 @@
+package event_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/skadn"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memorySKAdNStore 内存SKAdNetwork配置
+type memorySKAdNStore struct {
+	campaigns map[string]*skadn.Campaign
+}
+
+func (s *memorySKAdNStore) Save(ctx context.Context, adID string, campaign *skadn.Campaign) error {
+	s.campaigns[adID] = campaign
+	return nil
+}
+
+func (s *memorySKAdNStore) Delete(ctx context.Context, adID string) error {
+	delete(s.campaigns, adID)
+	return nil
+}
+
+func (s *memorySKAdNStore) Campaign(ctx context.Context, adID string) (*skadn.Campaign, error) {
+	campaign, ok := s.campaigns[adID]
+	if !ok {
+		return nil, skadn.ErrCampaignNotFound
+	}
+	return campaign, nil
+}
+
+func (s *memorySKAdNStore) MatchAd(ctx context.Context, postback *skadn.Postback) (string, error) {
+	for adID, campaign := range s.campaigns {
+		if campaign.Matches(postback) {
+			return adID, nil
+		}
+	}
+	return "", skadn.ErrCampaignNotFound
+}
+
+// postbackEnv SKAdNetwork回传接口
+type postbackEnv struct {
+	router  *gin.Engine
+	sink    *memorySink
+	metrics *metrics.Metrics
+}
+
+func newPostbackEnv(t *testing.T, verifier *skadn.Verifier) *postbackEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	m := newMetrics()
+	sink := &memorySink{}
+	p := newPipeline(config.EventConfig{Shards: 1, BatchSize: 1, FlushInterval: time.Millisecond}, sink, m)
+	p.Start()
+	t.Cleanup(p.Stop)
+
+	store := &memorySKAdNStore{campaigns: map[string]*skadn.Campaign{
+		"a1": {ITunesItemID: "1234567891", CampaignID: 42, SourceIdentifier: 5342},
+	}}
+
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(p)
+	h.SetSKAdNetwork("example123.skadnetwork", verifier, store)
+
+	router := gin.New()
+	router.POST("/postback", h.HandleSKAdNetworkPostback)
+	return &postbackEnv{router: router, sink: sink, metrics: m}
+}
+
+func (e *postbackEnv) post(body string) int {
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/postback", strings.NewReader(body)))
+	return w.Code
+}
+
+// postbackBody 生成4.0回传，replace用于替换字段
+func postbackBody(replace ...string) string {
+	body := `{"version":"4.0","ad-network-id":"example123.skadnetwork","source-identifier":"342",` +
+		`"app-id":1234567891,"transaction-id":"t1","redownload":false,"source-app-id":880047117,` +
+		`"fidelity-type":1,"did-win":true,"coarse-conversion-value":"high","postback-sequence-index":1,` +
+		`"attribution-signature":"MEUCIQ=="}`
+	return strings.NewReplacer(replace...).Replace(body)
+}
+
+func TestPostbackRecordedAsConversion(t *testing.T) {
+	env := newPostbackEnv(t, nil)
+
+	if code := env.post(postbackBody()); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	got := env.sink.events()[0]
+	if got.EventType != stats.EventConversion || got.AdID != "a1" || got.RequestID != "t1" {
+		t.Fatalf("event = %+v, want a1的转化", got)
+	}
+	want := map[string]string{
+		"source":             "skadnetwork",
+		"skan_version":       "4.0",
+		"skan_source":        "342",
+		"skan_source_app_id": "880047117",
+		"skan_coarse_value":  "high",
+		"skan_sequence":      "1",
+		"skan_verified":      "false",
+	}
+	for k, v := range want {
+		if got.ExtraParams[k] != v {
+			t.Errorf("ExtraParams[%s] = %q, want %q", k, got.ExtraParams[k], v)
+		}
+	}
+	if n := testutil.ToFloat64(env.metrics.Events.SKAdNetworkPostbacks.WithLabelValues("4.0", "unverified")); n != 1 {
+		t.Fatalf("unverified = %v, want 1", n)
+	}
+}
+
+func TestPostbackNotWonIgnored(t *testing.T) {
+	env := newPostbackEnv(t, nil)
+
+	if code := env.post(postbackBody(`"did-win":true`, `"did-win":false`)); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+	if n := testutil.ToFloat64(env.metrics.Events.SKAdNetworkPostbacks.WithLabelValues("4.0", "not_won")); n != 1 {
+		t.Fatalf("not_won = %v, want 1", n)
+	}
+	if len(env.sink.events()) != 0 {
+		t.Fatal("未获胜的回传不应记录为转化")
+	}
+}
+
+func TestPostbackUnmatchedStillRecorded(t *testing.T) {
+	env := newPostbackEnv(t, nil)
+
+	if code := env.post(postbackBody(`"source-identifier":"342"`, `"source-identifier":"999"`)); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+	waitFor(t, func() bool { return len(env.sink.events()) == 1 })
+	if got := env.sink.events()[0]; got.AdID != "" {
+		t.Fatalf("AdID = %q, want empty", got.AdID)
+	}
+}
+
+func TestPostbackRejected(t *testing.T) {
+	env := newPostbackEnv(t, nil)
+
+	cases := map[string]string{
+		"其他网络":   postbackBody(`"ad-network-id":"example123`, `"ad-network-id":"other`),
+		"缺少交易ID": postbackBody(`"transaction-id":"t1"`, `"transaction-id":""`),
+		"不支持的版本": postbackBody(`"version":"4.0"`, `"version":"1.0"`),
+		"格式错误":   `{`,
+	}
+	for name, body := range cases {
+		if code := env.post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", name, code)
+		}
+	}
+}
+
+func TestPostbackInvalidSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	verifier, err := skadn.NewVerifier(map[string]string{"4": base64.StdEncoding.EncodeToString(der)})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	env := newPostbackEnv(t, verifier)
+
+	if code := env.post(postbackBody()); code != http.StatusBadRequest {
+		t.Fatalf("code = %d, want 400", code)
+	}
+	if n := testutil.ToFloat64(env.metrics.Events.SKAdNetworkPostbacks.WithLabelValues("4.0", "signature")); n != 1 {
+		t.Fatalf("signature = %v, want 1", n)
+	}
+
+	// 未配置公钥的版本按未校验处理
+	legacy := postbackBody(`"version":"4.0"`, `"version":"3.0"`, `"source-identifier":"342"`, `"campaign-id":42`)
+	if code := env.post(legacy); code != http.StatusOK {
+		t.Fatalf("3.0 code = %d, want 200", code)
+	}
+}
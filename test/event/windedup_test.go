@@ -0,0 +1,134 @@
+package event_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryWinDeduper 内存竞价成功通知去重存储
+type memoryWinDeduper struct {
+	mu      sync.Mutex
+	claimed map[string]bool
+	err     error
+}
+
+func (d *memoryWinDeduper) Claim(ctx context.Context, auctionID, adID string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return false, d.err
+	}
+	key := auctionID + ":" + adID
+	if d.claimed[key] {
+		return false, nil
+	}
+	d.claimed[key] = true
+	return true, nil
+}
+
+func (d *memoryWinDeduper) Release(ctx context.Context, auctionID, adID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.claimed, auctionID+":"+adID)
+	return nil
+}
+
+func win(query string) *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/win?"+query, nil)
+}
+
+func TestDuplicateWinRecordedOnce(t *testing.T) {
+	env := newBidTestEnv(t)
+	deduper := &memoryWinDeduper{claimed: map[string]bool{}}
+	env.handler.SetWinDeduper(deduper)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		env.router.ServeHTTP(w, win("request_id=r1&ad_id=a1&price=1.5"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("第%d次通知 code = %d, want 200", i+1, w.Code)
+		}
+		if i > 0 && !strings.Contains(w.Body.String(), "duplicate") {
+			t.Fatalf("重复通知应返回duplicate, body = %s", w.Body.String())
+		}
+	}
+
+	waitFor(t, func() bool { return len(env.sink.events()) >= 1 })
+	time.Sleep(20 * time.Millisecond)
+	if n := len(env.sink.events()); n != 1 {
+		t.Fatalf("记录的竞价成功事件 = %d, want 1", n)
+	}
+	if got := testutil.ToFloat64(env.metrics.Events.DuplicateWins.WithLabelValues("adx")); got != 2 {
+		t.Fatalf("重复通知指标 = %v, want 2", got)
+	}
+}
+
+func TestWinDedupByAuctionID(t *testing.T) {
+	env := newBidTestEnv(t)
+	deduper := &memoryWinDeduper{claimed: map[string]bool{}}
+	env.handler.SetWinDeduper(deduper)
+
+	if code := env.do(win("request_id=r1&ad_id=a1&price=1.5&auction_id=auc-1")); code != http.StatusOK {
+		t.Fatalf("code = %d, want 200", code)
+	}
+	if !deduper.claimed["auc-1:a1"] {
+		t.Fatalf("应按auction_id去重, claimed = %v", deduper.claimed)
+	}
+}
+
+func TestWinDedupReleasedWhenNotRecorded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m := newMetrics()
+	p := newPipeline(config.EventConfig{Shards: 1}, &memorySink{}, m)
+	p.Start()
+	p.Stop()
+
+	records := &memoryBidRecords{records: map[string]*event.BidRecord{}}
+	records.Save(context.Background(), &event.BidRecord{RequestID: "r1", AdID: "a1", BidPrice: 2.0})
+	deduper := &memoryWinDeduper{claimed: map[string]bool{}}
+
+	h := event.NewHandler(nil, nil, logger.NewLogger(zap.NewNop()), m)
+	h.SetPipeline(p)
+	h.SetBidRecords(records, 0)
+	h.SetWinDeduper(deduper)
+	router := gin.New()
+	router.GET("/win", h.HandleWin)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, win("request_id=r1&ad_id=a1&price=1.5"))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("管道已停止 code = %d, want 503", w.Code)
+	}
+	if len(deduper.claimed) != 0 {
+		t.Fatalf("未记录的通知应释放去重键, claimed = %v", deduper.claimed)
+	}
+}
+
+func TestWinDedupStoreErrorAsksRetry(t *testing.T) {
+	env := newBidTestEnv(t)
+	env.handler.SetWinDeduper(&memoryWinDeduper{claimed: map[string]bool{}, err: errors.New("redis down")})
+
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, win("request_id=r1&ad_id=a1&price=1.5"))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("去重存储不可用时应返回503并要求重试, code = %d", w.Code)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := len(env.sink.events()); n != 0 {
+		t.Fatalf("去重失败时不应记录事件, events = %d", n)
+	}
+}
@@ -0,0 +1,157 @@
+package exchange_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"simple-dsp/internal/exchange"
+	"simple-dsp/pkg/config"
+)
+
+func newTestRegistry(t *testing.T) *exchange.Registry {
+	t.Helper()
+	registry, err := exchange.NewRegistryFromConfig([]config.ExchangeConfig{
+		{
+			ID:             "token-ssp",
+			Auth:           config.ExchangeAuthConfig{Type: "token", Header: "X-Auth-Token", Token: "secret"},
+			AllowedAdTypes: []string{"banner"},
+			QPS:            1,
+			Burst:          1,
+		},
+		{
+			ID:           "basic-ssp",
+			Auth:         config.ExchangeAuthConfig{Type: "basic", Username: "ssp", Password: "pass", AllowedIPs: []string{"10.0.0.0/8"}},
+			MacroDialect: "google",
+		},
+	})
+	if err != nil {
+		t.Fatalf("创建注册表失败: %v", err)
+	}
+	return registry
+}
+
+func TestRegistry_Get(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := []struct {
+		name    string
+		id      string
+		wantID  string
+		wantErr error
+	}{
+		{name: "未指定时使用默认配置", id: "", wantID: exchange.DefaultExchange},
+		{name: "已注册交易平台", id: "token-ssp", wantID: "token-ssp"},
+		{name: "未注册交易平台", id: "missing", wantErr: exchange.ErrUnknownExchange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := registry.Get(tt.id)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+			}
+			if err == nil && profile.ID != tt.wantID {
+				t.Errorf("期望交易平台 %s，实际 %s", tt.wantID, profile.ID)
+			}
+		})
+	}
+}
+
+func TestProfile_Authenticate(t *testing.T) {
+	registry := newTestRegistry(t)
+	tokenProfile, _ := registry.Get("token-ssp")
+	basicProfile, _ := registry.Get("basic-ssp")
+
+	tests := []struct {
+		name       string
+		profile    *exchange.Profile
+		header     map[string]string
+		basicAuth  []string
+		remoteAddr string
+		wantErr    error
+	}{
+		{
+			name:    "token正确",
+			profile: tokenProfile,
+			header:  map[string]string{"X-Auth-Token": "secret"},
+		},
+		{
+			name:    "token错误",
+			profile: tokenProfile,
+			header:  map[string]string{"X-Auth-Token": "wrong"},
+			wantErr: exchange.ErrUnauthorized,
+		},
+		{
+			name:       "basic认证且IP在白名单内",
+			profile:    basicProfile,
+			basicAuth:  []string{"ssp", "pass"},
+			remoteAddr: "10.1.2.3:5000",
+		},
+		{
+			name:       "basic认证但IP不在白名单内",
+			profile:    basicProfile,
+			basicAuth:  []string{"ssp", "pass"},
+			remoteAddr: "192.168.1.1:5000",
+			wantErr:    exchange.ErrUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/traffic/"+tt.profile.ID, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			if tt.basicAuth != nil {
+				req.SetBasicAuth(tt.basicAuth[0], tt.basicAuth[1])
+			}
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if err := tt.profile.Authenticate(req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("期望错误 %v，实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProfile_Behavior(t *testing.T) {
+	registry := newTestRegistry(t)
+	tokenProfile, _ := registry.Get("token-ssp")
+	basicProfile, _ := registry.Get("basic-ssp")
+
+	if !tokenProfile.AllowsAdType("Banner") || tokenProfile.AllowsAdType("video") {
+		t.Error("广告类型白名单判断错误")
+	}
+	if !basicProfile.AllowsAdType("video") {
+		t.Error("未配置白名单时应允许所有广告类型")
+	}
+
+	notice := "https://dsp.example.com/win?price=" + exchange.PriceMacro
+	if got := tokenProfile.ExpandMacros(notice); got != notice {
+		t.Errorf("openrtb宏格式不应改写，实际 %s", got)
+	}
+	if got, want := basicProfile.ExpandMacros(notice), "https://dsp.example.com/win?price=%%WINNING_PRICE%%"; got != want {
+		t.Errorf("期望 %s，实际 %s", want, got)
+	}
+
+	if !registry.Allow("token-ssp") {
+		t.Fatal("首个请求应放行")
+	}
+	if registry.Allow("token-ssp") {
+		t.Error("超出约定QPS的请求应被拒绝")
+	}
+	if !registry.Allow("basic-ssp") {
+		t.Error("未约定QPS的交易平台不应限流")
+	}
+}
+
+func TestNewRegistryFromConfig_Invalid(t *testing.T) {
+	_, err := exchange.NewRegistryFromConfig([]config.ExchangeConfig{
+		{ID: "bad", MacroDialect: "custom"},
+	})
+	if !errors.Is(err, exchange.ErrInvalidProfile) {
+		t.Fatalf("期望配置错误，实际 %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/export"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatCSV, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	w.WriteRow("ID", "名称", "预算", "创建时间")
+	w.WriteRow("c1", `含"引号",逗号`, 12.5, created)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data := buf.Bytes()
+	if !bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) {
+		t.Fatalf("CSV缺少UTF-8 BOM")
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(data[3:])).ReadAll()
+	if err != nil {
+		t.Fatalf("解析CSV失败: %v", err)
+	}
+	want := []string{"c1", `含"引号",逗号`, "12.5", "2026-01-02T03:04:05Z"}
+	if len(records) != 2 || strings.Join(records[1], "|") != strings.Join(want, "|") {
+		t.Errorf("records = %q, want second row %q", records, want)
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatXLSX, &buf)
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	w.WriteRow("ID", "备注", "展示")
+	w.WriteRow("a<1>&b", "  首尾空格  ", int64(42))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("XLSX不是有效的zip文件: %v", err)
+	}
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("打开%s失败: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/worksheets/sheet1.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("缺少%s", name)
+		}
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{"a&lt;1&gt;&amp;b", `xml:space="preserve">  首尾空格  </t>`, "<c><v>42</v></c>", "</sheetData></worksheet>"} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("工作表缺少 %q", want)
+		}
+	}
+}
+
+func TestNewResponseWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if _, err := export.NewResponseWriter(rec, "ads", "pdf"); !errors.Is(err, export.ErrUnsupportedFormat) {
+		t.Fatalf("NewResponseWriter() error = %v, want %v", err, export.ErrUnsupportedFormat)
+	}
+	if len(rec.Header()) != 0 {
+		t.Errorf("格式无效时不应写入响应头: %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	w, err := export.NewResponseWriter(rec, "ads", export.FormatXLSX)
+	if err != nil {
+		t.Fatalf("NewResponseWriter() error = %v", err)
+	}
+	w.Close()
+
+	if ct := rec.Header().Get("Content-Type"); ct != export.ContentType(export.FormatXLSX) {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	disposition := rec.Header().Get("Content-Disposition")
+	if !strings.HasPrefix(disposition, `attachment; filename="ads_`) || !strings.HasSuffix(disposition, `.xlsx"`) {
+		t.Errorf("Content-Disposition = %q", disposition)
+	}
+}
@@ -0,0 +1,281 @@
+package fakedb
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// result 模拟的查询结果，arg非空时只在语句参数包含arg时返回
+type result struct {
+	prefix  string
+	arg     string
+	columns []string
+	rows    [][]driver.Value
+}
+
+// Statement 执行过的语句和参数
+type Statement struct {
+	Query string
+	Args  []driver.Value
+}
+
+// DB 记录执行的语句和参数的database/sql驱动，不连接真实的PostgreSQL
+type DB struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	fail    string
+	down    bool
+	results []result
+	log     []Statement
+}
+
+// New 创建模拟数据库
+func New() *DB {
+	return &DB{}
+}
+
+// Open 通过GORM打开模拟数据库，测试结束时关闭
+func (f *DB) Open(t *testing.T) *gorm.DB {
+	t.Helper()
+	sqlDB := sql.OpenDB(f)
+	t.Cleanup(func() { sqlDB.Close() })
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开模拟数据库失败: %v", err)
+	}
+	return db
+}
+
+// SetDelay 设置每条语句的耗时
+func (f *DB) SetDelay(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.delay = d
+}
+
+// FailOn 包含substr的语句返回错误
+func (f *DB) FailOn(substr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = substr
+}
+
+// SetDown 设置数据库是否不可用，不可用时连接和语句返回driver.ErrBadConn
+func (f *DB) SetDown(down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down = down
+}
+
+func (f *DB) isDown() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.down
+}
+
+// Respond 以prefix开头且参数包含arg的查询返回指定结果，arg为空时不检查参数
+// 相同的prefix和arg再次设置时替换之前的结果
+func (f *DB) Respond(prefix, arg string, columns []string, rows ...[]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := result{prefix: prefix, arg: arg, columns: columns, rows: rows}
+	for i := range f.results {
+		if f.results[i].prefix == prefix && f.results[i].arg == arg {
+			f.results[i] = r
+			return
+		}
+	}
+	f.results = append(f.results, r)
+}
+
+// Statements 返回已执行的语句，事务语句记为BEGIN、COMMIT和ROLLBACK
+func (f *DB) Statements() []Statement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Statement(nil), f.log...)
+}
+
+// Queries 返回已执行的语句文本
+func (f *DB) Queries() []string {
+	statements := f.Statements()
+	queries := make([]string, len(statements))
+	for i, s := range statements {
+		queries[i] = s.Query
+	}
+	return queries
+}
+
+// Reset 清空已执行的语句
+func (f *DB) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = nil
+}
+
+// HasArg 判断语句参数中是否有值为want的字符串
+func HasArg(values []driver.Value, want string) bool {
+	for _, v := range values {
+		if s, ok := v.(string); ok && s == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *DB) record(query string, values []driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.log = append(f.log, Statement{Query: query, Args: values})
+}
+
+// execute 记录语句并按耗时执行，上下文结束时返回上下文的错误
+func (f *DB) execute(ctx context.Context, query string, args []driver.NamedValue) (result, error) {
+	if f.isDown() {
+		return result{}, driver.ErrBadConn
+	}
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.record(query, values)
+
+	f.mu.Lock()
+	delay, fail := f.delay, f.fail
+	var res result
+	for _, r := range f.results {
+		if strings.HasPrefix(query, r.prefix) && (r.arg == "" || HasArg(values, r.arg)) {
+			res = r
+			break
+		}
+	}
+	f.mu.Unlock()
+
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return result{}, ctx.Err()
+		}
+	}
+	if fail != "" && strings.Contains(query, fail) {
+		return result{}, errors.New("模拟的数据库错误")
+	}
+	return res, nil
+}
+
+// Connect 实现driver.Connector
+func (f *DB) Connect(context.Context) (driver.Conn, error) {
+	if f.isDown() {
+		return nil, driver.ErrBadConn
+	}
+	return &conn{db: f}, nil
+}
+
+// Driver 实现driver.Connector
+func (f *DB) Driver() driver.Driver {
+	return dbDriver{db: f}
+}
+
+// dbDriver 实现driver.Driver，DB.Open已用于打开GORM连接
+type dbDriver struct {
+	db *DB
+}
+
+func (d dbDriver) Open(string) (driver.Conn, error) {
+	return &conn{db: d.db}, nil
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("不支持预处理语句")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+// Ping 实现driver.Pinger，数据库不可用时返回driver.ErrBadConn
+func (c *conn) Ping(context.Context) error {
+	if c.db.isDown() {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return &tx{db: c.db}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if _, err := c.db.execute(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.db.execute(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{result: res}, nil
+}
+
+type tx struct {
+	db *DB
+}
+
+func (t *tx) Commit() error {
+	t.db.record("COMMIT", nil)
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.db.record("ROLLBACK", nil)
+	return nil
+}
+
+type rows struct {
+	result
+	next int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,121 @@
+package fakelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Node 在内存中模拟一个Redis节点，只实现分布式锁使用的脚本
+type Node struct {
+	redis.Cmdable
+
+	mu      sync.Mutex
+	values  map[string]string
+	expires map[string]time.Time
+	down    atomic.Bool
+}
+
+// NewNode 创建模拟节点
+func NewNode() *Node {
+	return &Node{values: make(map[string]string), expires: make(map[string]time.Time)}
+}
+
+// NewNodes 创建n个模拟节点，同时返回供锁使用的redis.Cmdable
+func NewNodes(n int) ([]*Node, []redis.Cmdable) {
+	fakes := make([]*Node, n)
+	nodes := make([]redis.Cmdable, n)
+	for i := range fakes {
+		fakes[i] = NewNode()
+		nodes[i] = fakes[i]
+	}
+	return fakes, nodes
+}
+
+// EvalSha 总是返回NOSCRIPT，使客户端改用Eval发送脚本原文
+func (n *Node) EvalSha(ctx context.Context, sha string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script"))
+}
+
+// Eval 按脚本内容模拟加锁、回写token、续期和释放
+func (n *Node) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	if n.down.Load() {
+		return redis.NewCmdResult(nil, errors.New("connection refused"))
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if deadline, ok := n.expires[keys[0]]; ok && time.Now().After(deadline) {
+		delete(n.values, keys[0])
+		delete(n.expires, keys[0])
+	}
+
+	value := fmt.Sprint(args[0])
+	switch {
+	case strings.Contains(script, "'NX', 'PX'"):
+		if _, ok := n.values[keys[0]]; ok {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		n.values[keys[0]] = value
+		n.expires[keys[0]] = time.Now().Add(millis(args[1]))
+		var fence int64
+		fmt.Sscan(n.values[keys[1]], &fence)
+		fence++
+		n.values[keys[1]] = fmt.Sprint(fence)
+		return redis.NewCmdResult(fence, nil)
+	case strings.Contains(script, "tonumber"):
+		var current, token int64
+		fmt.Sscan(n.values[keys[0]], &current)
+		fmt.Sscan(value, &token)
+		if current < token {
+			n.values[keys[0]] = value
+		}
+		return redis.NewCmdResult(int64(1), nil)
+	case strings.Contains(script, "PEXPIRE"):
+		if n.values[keys[0]] != value {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		n.expires[keys[0]] = time.Now().Add(millis(args[1]))
+		return redis.NewCmdResult(int64(1), nil)
+	case strings.Contains(script, "DEL"):
+		if n.values[keys[0]] != value {
+			return redis.NewCmdResult(int64(0), nil)
+		}
+		delete(n.values, keys[0])
+		delete(n.expires, keys[0])
+		return redis.NewCmdResult(int64(1), nil)
+	}
+	return redis.NewCmdResult(nil, fmt.Errorf("unknown script"))
+}
+
+// Steal 模拟锁过期后被其他实例持有
+func (n *Node) Steal(key string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.values[key] = "other"
+}
+
+// SetDown 设置节点是否不可用，不可用时脚本返回连接错误
+func (n *Node) SetDown(down bool) {
+	n.down.Store(down)
+}
+
+// Held 键是否被持有
+func (n *Node) Held(key string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	_, ok := n.values[key]
+	return ok
+}
+
+func millis(v interface{}) time.Duration {
+	var ms int64
+	fmt.Sscan(fmt.Sprint(v), &ms)
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,714 @@
+package fakeredis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// subscriber 订阅连接
+type subscriber struct {
+	conn net.Conn
+	w    *bufio.Writer
+}
+
+// Server 最小RESP服务，支持测试用到的字符串、哈希、集合、有序集合、过期、事务和发布订阅命令
+// 过期按真实时间计算，TTL返回最近一次设置的过期时长
+type Server struct {
+	mu          sync.Mutex
+	strings     map[string]string
+	hashes      map[string]map[string]string
+	sets        map[string]map[string]bool
+	zsets       map[string]map[string]float64
+	deadlines   map[string]time.Time
+	ttls        map[string]time.Duration
+	subscribers map[string][]subscriber
+	published   int
+	latency     time.Duration
+	ln          net.Listener
+}
+
+// New 在本地随机端口启动服务，测试结束时关闭
+func New(tb testing.TB) *Server {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("监听失败: %v", err)
+	}
+	f := &Server{
+		strings:     make(map[string]string),
+		hashes:      make(map[string]map[string]string),
+		sets:        make(map[string]map[string]bool),
+		zsets:       make(map[string]map[string]float64),
+		deadlines:   make(map[string]time.Time),
+		ttls:        make(map[string]time.Duration),
+		subscribers: make(map[string][]subscriber),
+		ln:          ln,
+	}
+	go f.accept()
+	tb.Cleanup(func() { ln.Close() })
+	return f
+}
+
+// Addr 服务的监听地址
+func (f *Server) Addr() string {
+	return f.ln.Addr().String()
+}
+
+// Client 创建连接到服务的客户端，测试结束时关闭
+func (f *Server) Client(tb testing.TB) *redis.Client {
+	rdb := redis.NewClient(&redis.Options{Addr: f.Addr()})
+	tb.Cleanup(func() { rdb.Close() })
+	return rdb
+}
+
+// SetLatency 设置每次往返的网络延迟
+func (f *Server) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// Get 读取字符串
+func (f *Server) Get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireKeys()
+	value, ok := f.strings[key]
+	return value, ok
+}
+
+// Set 直接写入字符串，清除过期时间
+func (f *Server) Set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(key)
+	f.strings[key] = value
+}
+
+// Del 直接删除键
+func (f *Server) Del(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(key)
+}
+
+// Exists 键是否存在且未过期
+func (f *Server) Exists(key string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireKeys()
+	return f.typeOf(key) != ""
+}
+
+// TTL 最近一次为键设置的过期时长，没有设置时返回0
+func (f *Server) TTL(key string) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ttls[key]
+}
+
+// Keys 未过期且以prefix开头的键的数量
+func (f *Server) Keys(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireKeys()
+	n := 0
+	for key := range f.keySet() {
+		if strings.HasPrefix(key, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// HSet 直接写入哈希字段，模拟不经过被测代码的修改
+func (f *Server) HSet(key string, fields map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	hash := f.hashes[key]
+	if hash == nil {
+		hash = make(map[string]string)
+		f.hashes[key] = hash
+	}
+	for field, value := range fields {
+		hash[field] = value
+	}
+}
+
+// HLen 哈希的字段数
+func (f *Server) HLen(key string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.hashes[key])
+}
+
+// ZAdd 直接写入有序集合成员
+func (f *Server) ZAdd(key, member string, score float64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.zsets[key] == nil {
+		f.zsets[key] = make(map[string]float64)
+	}
+	f.zsets[key][member] = score
+}
+
+// ZScore 有序集合成员的分数
+func (f *Server) ZScore(key, member string) (float64, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	score, ok := f.zsets[key][member]
+	return score, ok
+}
+
+// PublishCount PUBLISH命令的次数
+func (f *Server) PublishCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.published
+}
+
+// DropSubscribers 断开所有订阅连接，模拟网络中断
+func (f *Server) DropSubscribers() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for channel, subs := range f.subscribers {
+		for _, sub := range subs {
+			sub.conn.Close()
+		}
+		delete(f.subscribers, channel)
+	}
+}
+
+func (f *Server) accept() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		go f.serve(conn)
+	}
+}
+
+func (f *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	// queued 事务中排队的命令，为nil时不在事务中
+	var queued [][]string
+	for {
+		// 读完客户端一次写入的全部命令后才回复，模拟一次往返
+		if r.Buffered() == 0 {
+			// 订阅连接的写缓冲区也会被发布消息的连接使用，刷新时持有锁
+			f.mu.Lock()
+			err := w.Flush()
+			latency := f.latency
+			f.mu.Unlock()
+			if err != nil {
+				return
+			}
+			if latency > 0 {
+				if _, err := r.Peek(1); err != nil {
+					return
+				}
+				time.Sleep(latency)
+			}
+		}
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch name := strings.ToLower(args[0]); {
+		case name == "multi":
+			queued = [][]string{}
+			w.WriteString("+OK\r\n")
+		case name == "exec":
+			fmt.Fprintf(w, "*%d\r\n", len(queued))
+			for _, cmd := range queued {
+				f.reply(conn, w, cmd)
+			}
+			queued = nil
+		case queued != nil:
+			queued = append(queued, args)
+			w.WriteString("+QUEUED\r\n")
+		default:
+			f.reply(conn, w, args)
+		}
+	}
+}
+
+// expireKeys 删除已过期的键
+func (f *Server) expireKeys() {
+	now := time.Now()
+	for key, deadline := range f.deadlines {
+		if now.After(deadline) {
+			f.remove(key)
+		}
+	}
+}
+
+// remove 删除任意类型的键及其过期时间
+func (f *Server) remove(key string) {
+	delete(f.strings, key)
+	delete(f.hashes, key)
+	delete(f.sets, key)
+	delete(f.zsets, key)
+	delete(f.deadlines, key)
+	delete(f.ttls, key)
+}
+
+// expire 设置键的过期时长
+func (f *Server) expire(key string, ttl time.Duration) {
+	f.deadlines[key] = time.Now().Add(ttl)
+	f.ttls[key] = ttl
+}
+
+// typeOf 键的类型，不存在时返回空字符串
+func (f *Server) typeOf(key string) string {
+	if _, ok := f.strings[key]; ok {
+		return "string"
+	}
+	if _, ok := f.hashes[key]; ok {
+		return "hash"
+	}
+	if _, ok := f.sets[key]; ok {
+		return "set"
+	}
+	if _, ok := f.zsets[key]; ok {
+		return "zset"
+	}
+	return ""
+}
+
+// keySet 所有的键
+func (f *Server) keySet() map[string]bool {
+	keys := make(map[string]bool)
+	for key := range f.strings {
+		keys[key] = true
+	}
+	for key := range f.hashes {
+		keys[key] = true
+	}
+	for key := range f.sets {
+		keys[key] = true
+	}
+	for key := range f.zsets {
+		keys[key] = true
+	}
+	return keys
+}
+
+// checkType 键存在且不是kind类型时回复WRONGTYPE
+func (f *Server) checkType(w *bufio.Writer, key, kind string) bool {
+	if t := f.typeOf(key); t != "" && t != kind {
+		w.WriteString("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+		return false
+	}
+	return true
+}
+
+func (f *Server) reply(conn net.Conn, w *bufio.Writer, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expireKeys()
+	var key string
+	if len(args) > 1 {
+		key = args[1]
+	}
+	switch name := strings.ToLower(args[0]); name {
+	case "ping":
+		w.WriteString("+PONG\r\n")
+	case "get":
+		if !f.checkType(w, key, "string") {
+			return
+		}
+		value, ok := f.strings[key]
+		writeBulk(w, value, ok)
+	case "set":
+		// 支持 EX/PX 和 NX
+		var ttl time.Duration
+		nx := false
+		for i := 3; i < len(args); i++ {
+			switch strings.ToLower(args[i]) {
+			case "nx":
+				nx = true
+			case "ex", "px":
+				n, _ := strconv.ParseInt(args[i+1], 10, 64)
+				unit := time.Second
+				if strings.ToLower(args[i]) == "px" {
+					unit = time.Millisecond
+				}
+				ttl = time.Duration(n) * unit
+				i++
+			}
+		}
+		if nx && f.typeOf(key) != "" {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		f.remove(key)
+		f.strings[key] = args[2]
+		if ttl > 0 {
+			f.expire(key, ttl)
+		}
+		w.WriteString("+OK\r\n")
+	case "setnx":
+		if f.typeOf(key) != "" {
+			w.WriteString(":0\r\n")
+			return
+		}
+		f.strings[key] = args[2]
+		w.WriteString(":1\r\n")
+	case "incr", "incrby", "decrby":
+		if !f.checkType(w, key, "string") {
+			return
+		}
+		delta := int64(1)
+		if name != "incr" {
+			var err error
+			if delta, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+				w.WriteString("-ERR value is not an integer or out of range\r\n")
+				return
+			}
+		}
+		if name == "decrby" {
+			delta = -delta
+		}
+		n, err := strconv.ParseInt(f.stringOr(key, "0"), 10, 64)
+		if err != nil {
+			w.WriteString("-ERR value is not an integer or out of range\r\n")
+			return
+		}
+		n += delta
+		f.strings[key] = strconv.FormatInt(n, 10)
+		fmt.Fprintf(w, ":%d\r\n", n)
+	case "expire", "pexpire":
+		if f.typeOf(key) == "" {
+			w.WriteString(":0\r\n")
+			return
+		}
+		n, _ := strconv.ParseInt(args[2], 10, 64)
+		unit := time.Second
+		if name == "pexpire" {
+			unit = time.Millisecond
+		}
+		f.expire(key, time.Duration(n)*unit)
+		w.WriteString(":1\r\n")
+	case "del", "exists":
+		count := 0
+		for _, k := range args[1:] {
+			if f.typeOf(k) != "" {
+				count++
+				if name == "del" {
+					f.remove(k)
+				}
+			}
+		}
+		fmt.Fprintf(w, ":%d\r\n", count)
+	case "mget":
+		fmt.Fprintf(w, "*%d\r\n", len(args)-1)
+		for _, k := range args[1:] {
+			value, ok := f.strings[k]
+			writeBulk(w, value, ok)
+		}
+	case "rename":
+		if f.typeOf(key) == "" {
+			w.WriteString("-ERR no such key\r\n")
+			return
+		}
+		f.rename(key, args[2])
+		w.WriteString("+OK\r\n")
+	case "hset":
+		if !f.checkType(w, key, "hash") {
+			return
+		}
+		hash := f.hashes[key]
+		if hash == nil {
+			hash = make(map[string]string)
+			f.hashes[key] = hash
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "hget":
+		if !f.checkType(w, key, "hash") {
+			return
+		}
+		value, ok := f.hashes[key][args[2]]
+		writeBulk(w, value, ok)
+	case "hdel":
+		if !f.checkType(w, key, "hash") {
+			return
+		}
+		deleted := 0
+		for _, field := range args[2:] {
+			if _, ok := f.hashes[key][field]; ok {
+				deleted++
+				delete(f.hashes[key], field)
+			}
+		}
+		if f.hashes[key] != nil && len(f.hashes[key]) == 0 {
+			f.remove(key)
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case "hgetall":
+		if !f.checkType(w, key, "hash") {
+			return
+		}
+		hash := f.hashes[key]
+		fmt.Fprintf(w, "*%d\r\n", len(hash)*2)
+		for field, value := range hash {
+			writeBulk(w, field, true)
+			writeBulk(w, value, true)
+		}
+	case "sadd":
+		if !f.checkType(w, key, "set") {
+			return
+		}
+		set := f.sets[key]
+		if set == nil {
+			set = make(map[string]bool)
+			f.sets[key] = set
+		}
+		added := 0
+		for _, member := range args[2:] {
+			if !set[member] {
+				added++
+			}
+			set[member] = true
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "srem":
+		if !f.checkType(w, key, "set") {
+			return
+		}
+		removed := 0
+		for _, member := range args[2:] {
+			if f.sets[key][member] {
+				removed++
+				delete(f.sets[key], member)
+			}
+		}
+		if f.sets[key] != nil && len(f.sets[key]) == 0 {
+			f.remove(key)
+		}
+		fmt.Fprintf(w, ":%d\r\n", removed)
+	case "smembers":
+		if !f.checkType(w, key, "set") {
+			return
+		}
+		set := f.sets[key]
+		fmt.Fprintf(w, "*%d\r\n", len(set))
+		for member := range set {
+			writeBulk(w, member, true)
+		}
+	case "zadd":
+		if !f.checkType(w, key, "zset") {
+			return
+		}
+		zset := f.zsets[key]
+		if zset == nil {
+			zset = make(map[string]float64)
+			f.zsets[key] = zset
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(args[i], 64)
+			if _, ok := zset[args[i+1]]; !ok {
+				added++
+			}
+			zset[args[i+1]] = score
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "zrem", "zremrangebyscore":
+		if !f.checkType(w, key, "zset") {
+			return
+		}
+		removed := 0
+		for member, score := range f.zsets[key] {
+			var match bool
+			if name == "zrem" {
+				match = contains(args[2:], member)
+			} else {
+				match = inRange(score, args[2], args[3])
+			}
+			if match {
+				delete(f.zsets[key], member)
+				removed++
+			}
+		}
+		if f.zsets[key] != nil && len(f.zsets[key]) == 0 {
+			f.remove(key)
+		}
+		fmt.Fprintf(w, ":%d\r\n", removed)
+	case "zrange":
+		if !f.checkType(w, key, "zset") {
+			return
+		}
+		zset := f.zsets[key]
+		members := make([]string, 0, len(zset))
+		for member := range zset {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if zset[members[i]] != zset[members[j]] {
+				return zset[members[i]] < zset[members[j]]
+			}
+			return members[i] < members[j]
+		})
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if start < 0 {
+			start = max(len(members)+start, 0)
+		}
+		if stop < 0 {
+			stop += len(members)
+		}
+		stop = min(stop, len(members)-1)
+		if start > stop {
+			w.WriteString("*0\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", stop-start+1)
+		for _, member := range members[start : stop+1] {
+			writeBulk(w, member, true)
+		}
+	case "subscribe":
+		for i, channel := range args[1:] {
+			f.subscribers[channel] = append(f.subscribers[channel], subscriber{conn: conn, w: w})
+			fmt.Fprintf(w, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, i+1)
+		}
+	case "publish":
+		f.published++
+		channel, message := args[1], args[2]
+		for _, sub := range f.subscribers[channel] {
+			fmt.Fprintf(sub.w, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(message), message)
+			sub.w.Flush()
+		}
+		fmt.Fprintf(w, ":%d\r\n", len(f.subscribers[channel]))
+	default:
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// stringOr 读取字符串，不存在时返回fallback
+func (f *Server) stringOr(key, fallback string) string {
+	if value, ok := f.strings[key]; ok {
+		return value
+	}
+	return fallback
+}
+
+// rename 把键及其过期时间移动到新的键名，覆盖新键名上已有的值
+func (f *Server) rename(from, to string) {
+	strValue, isString := f.strings[from]
+	hash, sets, zset := f.hashes[from], f.sets[from], f.zsets[from]
+	deadline, hasDeadline := f.deadlines[from]
+	ttl := f.ttls[from]
+	f.remove(from)
+	f.remove(to)
+	switch {
+	case isString:
+		f.strings[to] = strValue
+	case hash != nil:
+		f.hashes[to] = hash
+	case sets != nil:
+		f.sets[to] = sets
+	case zset != nil:
+		f.zsets[to] = zset
+	}
+	if hasDeadline {
+		f.deadlines[to] = deadline
+		f.ttls[to] = ttl
+	}
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// inRange 分数是否在ZREMRANGEBYSCORE的范围内，支持-inf、+inf和(开区间
+func inRange(score float64, minArg, maxArg string) bool {
+	lo, loOpen := parseBound(minArg)
+	hi, hiOpen := parseBound(maxArg)
+	if score < lo || (loOpen && score == lo) {
+		return false
+	}
+	return score < hi || (!hiOpen && score == hi)
+}
+
+func parseBound(arg string) (float64, bool) {
+	open := strings.HasPrefix(arg, "(")
+	arg = strings.TrimPrefix(arg, "(")
+	switch arg {
+	case "-inf":
+		return math.Inf(-1), open
+	case "+inf", "inf":
+		return math.Inf(1), open
+	}
+	value, _ := strconv.ParseFloat(arg, 64)
+	return value, open
+}
+
+func writeBulk(w *bufio.Writer, value string, ok bool) {
+	if !ok {
+		w.WriteString("$-1\r\n")
+		return
+	}
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+}
+
+// readCommand 读取一条RESP数组格式的命令
+func readCommand(r *bufio.Reader) ([]string, error) {
+	n, err := readLength(r, '*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLength(r, '$')
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("空命令")
+	}
+	return args, nil
+}
+
+func readLength(r *bufio.Reader, prefix byte) (int, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	if len(line) < 3 || line[0] != prefix {
+		return 0, fmt.Errorf("无效的RESP行: %q", line)
+	}
+	return strconv.Atoi(line[1 : len(line)-2])
+}
@@ -0,0 +1,309 @@
+package fatigue_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/creative/fatigue"
+	"simple-dsp/internal/stats"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+// memoryStrategies 内存出价策略存储，只实现素材疲劳检测用到的方法
+type memoryStrategies struct {
+	bidding.Repository
+	mu         sync.Mutex
+	strategies map[int64]*bidding.BidStrategy
+	creatives  map[string][]bidding.BidStrategyCreative
+}
+
+func newMemoryStrategies(strategies ...bidding.BidStrategy) *memoryStrategies {
+	m := &memoryStrategies{
+		strategies: make(map[int64]*bidding.BidStrategy),
+		creatives:  make(map[string][]bidding.BidStrategyCreative),
+	}
+	for i := range strategies {
+		id, _ := strconv.ParseInt(strategies[i].ID, 10, 64)
+		m.strategies[id] = &strategies[i]
+	}
+	return m
+}
+
+func (m *memoryStrategies) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []bidding.BidStrategy
+	for _, s := range m.strategies {
+		if filter.Status == nil || s.Status == *filter.Status {
+			result = append(result, *s)
+		}
+	}
+	return result, int64(len(result)), nil
+}
+
+func (m *memoryStrategies) ListCreatives(ctx context.Context, strategyID string) ([]bidding.BidStrategyCreative, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]bidding.BidStrategyCreative(nil), m.creatives[strategyID]...), nil
+}
+
+func (m *memoryStrategies) UpdateCreative(ctx context.Context, strategyID int64, creativeID int64, status int, weight float64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	links := m.creatives[strconv.FormatInt(strategyID, 10)]
+	for i := range links {
+		if links[i].CreativeID == creativeID {
+			links[i].Status, links[i].Weight = status, weight
+		}
+	}
+	return nil
+}
+
+func (m *memoryStrategies) creative(strategyID string, creativeID int64) bidding.BidStrategyCreative {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, link := range m.creatives[strategyID] {
+		if link.CreativeID == creativeID {
+			return link
+		}
+	}
+	return bidding.BidStrategyCreative{}
+}
+
+func (m *memoryStrategies) get(id int64) bidding.BidStrategy {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.strategies[id]
+}
+
+// windowStats 按窗口结束时间区分近期窗口和基准窗口的素材统计，键为{ad_id}:{creative_id}
+type windowStats struct {
+	now      time.Time
+	recent   map[string]stats.WindowStats
+	baseline map[string]stats.WindowStats
+
+	mu    sync.Mutex
+	calls [][2]time.Time
+}
+
+func (s *windowStats) LoadCreativeWindow(ctx context.Context, adID, creativeID string, from, to time.Time) (*stats.WindowStats, error) {
+	s.mu.Lock()
+	s.calls = append(s.calls, [2]time.Time{from, to})
+	s.mu.Unlock()
+	w := s.baseline[adID+":"+creativeID]
+	if to.Equal(s.now) {
+		w = s.recent[adID+":"+creativeID]
+	}
+	return &w, nil
+}
+
+// recordingNotifier 记录发送的通知
+type recordingNotifier struct {
+	mu   sync.Mutex
+	data []map[string]interface{}
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, eventType webhook.EventType, data interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if eventType == webhook.EventCreativeFatigued {
+		n.data = append(n.data, data.(map[string]interface{}))
+	}
+}
+
+type fixture struct {
+	detector   *fatigue.Detector
+	strategies *memoryStrategies
+	stats      *windowStats
+	notifier   *recordingNotifier
+	redis      *fakeredis.Server
+}
+
+func newFixture(t *testing.T, strategies ...bidding.BidStrategy) *fixture {
+	t.Helper()
+	now := time.Date(2024, 6, 10, 12, 30, 0, 0, time.UTC)
+	f := &fixture{
+		strategies: newMemoryStrategies(strategies...),
+		stats: &windowStats{
+			now:      now,
+			recent:   make(map[string]stats.WindowStats),
+			baseline: make(map[string]stats.WindowStats),
+		},
+		notifier: &recordingNotifier{},
+		redis:    fakeredis.New(t),
+	}
+	cfg := config.FatigueConfig{
+		RecentWindow:    24 * time.Hour,
+		BaselineWindow:  72 * time.Hour,
+		MinImpressions:  1000,
+		DownweightDecay: 0.3,
+		WeightFactor:    0.5,
+		MinWeight:       0.2,
+		PauseDecay:      0.6,
+		Cooldown:        12 * time.Hour,
+	}
+	f.detector = fatigue.NewDetector(cfg, f.strategies, f.stats, f.redis.Client(t), logger.NewLogger(zap.NewNop()))
+	f.detector.SetNotifier(f.notifier)
+	f.detector.SetClock(clock.NewFake(now))
+	return f
+}
+
+// ctr 设置素材基准窗口和近期窗口的展示和点击
+func (f *fixture) ctr(adID string, creativeID int64, baselineImps, baselineClicks, recentImps, recentClicks int64) {
+	key := adID + ":" + strconv.FormatInt(creativeID, 10)
+	f.stats.baseline[key] = stats.WindowStats{AdID: adID, Impressions: baselineImps, Clicks: baselineClicks}
+	f.stats.recent[key] = stats.WindowStats{AdID: adID, Impressions: recentImps, Clicks: recentClicks}
+}
+
+func (f *fixture) run(t *testing.T) []fatigue.Action {
+	t.Helper()
+	actions, err := f.detector.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("检测素材疲劳失败: %v", err)
+	}
+	return actions
+}
+
+func enabled(id string) bidding.BidStrategy {
+	return bidding.BidStrategy{ID: id, CampaignID: "c" + id, Status: bidding.StrategyStatusEnabled, Weight: 1}
+}
+
+func link(strategyID, creativeID int64, status int, weight float64) bidding.BidStrategyCreative {
+	return bidding.BidStrategyCreative{StrategyID: strategyID, CreativeID: creativeID, Status: status, Weight: weight}
+}
+
+func TestDetector_DownweightsFatiguedCreative(t *testing.T) {
+	f := newFixture(t, enabled("1"))
+	f.strategies.creatives["1"] = []bidding.BidStrategyCreative{
+		link(1, 11, bidding.StrategyStatusEnabled, 0),
+		link(1, 12, bidding.StrategyStatusEnabled, 1),
+		link(1, 13, bidding.StrategyStatusDisabled, 1),
+	}
+	// 素材11的CTR从2%降到1.2%，下降40%；素材12没有下降
+	f.ctr("1", 11, 10000, 200, 5000, 60)
+	f.ctr("1", 12, 10000, 200, 5000, 100)
+	// 已暂停的素材不检测
+	f.ctr("1", 13, 10000, 200, 5000, 10)
+
+	actions := f.run(t)
+	if len(actions) != 1 {
+		t.Fatalf("应只降低素材11的权重: %+v", actions)
+	}
+	action := actions[0]
+	if action.Action != fatigue.ActionDownweight || action.CreativeID != 11 || action.BeforeWeight != 1 || action.AfterWeight != 0.5 {
+		t.Errorf("操作不正确: %+v", action)
+	}
+	if action.Decay < 0.399 || action.Decay > 0.401 {
+		t.Errorf("下降比例 = %v, 期望0.4", action.Decay)
+	}
+	if got := f.strategies.creative("1", 11); got.Weight != 0.5 || got.Status != bidding.StrategyStatusEnabled {
+		t.Errorf("素材11应仍在轮换且权重为0.5: %+v", got)
+	}
+	if got := f.strategies.creative("1", 12); got.Weight != 1 || got.Status != bidding.StrategyStatusEnabled {
+		t.Errorf("素材12不应调整: %+v", got)
+	}
+	if got := f.strategies.get(1); got.Weight != 1 || got.Status != bidding.StrategyStatusEnabled {
+		t.Errorf("出价策略不应调整: %+v", got)
+	}
+	value, ok := f.redis.Get("fatigue:cooldown:1:11")
+	if ttl := f.redis.TTL("fatigue:cooldown:1:11"); !ok || value != fatigue.ActionDownweight || ttl != 12*time.Hour {
+		t.Errorf("应设置冷却标记: %q, %v, %v", value, ttl, ok)
+	}
+	if f.redis.PublishCount() != 1 {
+		t.Errorf("应发布一次策略变更通知, got %d", f.redis.PublishCount())
+	}
+	if len(f.notifier.data) != 1 {
+		t.Fatalf("应发送一次素材疲劳通知: %v", f.notifier.data)
+	}
+	if id, _ := f.notifier.data[0]["creative_id"].(int64); id != 11 {
+		t.Errorf("通知应包含疲劳的素材: %v", f.notifier.data[0]["creative_id"])
+	}
+
+	// 近期窗口包含当前小时，基准窗口紧接在近期窗口之前
+	now := f.stats.now
+	recent, baseline := f.stats.calls[0], f.stats.calls[1]
+	if !recent[0].Equal(now.Add(-23*time.Hour)) || !recent[1].Equal(now) {
+		t.Errorf("近期窗口 = %v", recent)
+	}
+	if !baseline[1].Equal(now.Add(-24*time.Hour)) || !baseline[0].Equal(now.Add(-95*time.Hour)) {
+		t.Errorf("基准窗口 = %v", baseline)
+	}
+
+	// 冷却时间内不再操作
+	if actions := f.run(t); len(actions) != 0 {
+		t.Errorf("冷却时间内不应再次操作: %+v", actions)
+	}
+
+	// 冷却结束后继续降低，不低于下限
+	f.redis.Del("fatigue:cooldown:1:11")
+	f.strategies.UpdateCreative(context.Background(), 1, 11, bidding.StrategyStatusEnabled, 0.3)
+	if actions := f.run(t); len(actions) != 1 || actions[0].AfterWeight != 0.2 {
+		t.Errorf("权重应降到下限0.2: %+v", actions)
+	}
+	f.redis.Del("fatigue:cooldown:1:11")
+	if actions := f.run(t); len(actions) != 0 {
+		t.Errorf("权重已达下限且未达到暂停阈值，不应操作: %+v", actions)
+	}
+}
+
+func TestDetector_PausesSevereDecay(t *testing.T) {
+	f := newFixture(t, enabled("2"))
+	f.strategies.creatives["2"] = []bidding.BidStrategyCreative{
+		link(2, 21, bidding.StrategyStatusEnabled, 2),
+		link(2, 22, bidding.StrategyStatusEnabled, 1),
+	}
+	// 素材21的CTR从2%降到0.5%，下降75%
+	f.ctr("2", 21, 10000, 200, 4000, 20)
+
+	actions := f.run(t)
+	if len(actions) != 1 || actions[0].Action != fatigue.ActionPause || actions[0].CreativeID != 21 {
+		t.Fatalf("应暂停素材21: %+v", actions)
+	}
+	if got := f.strategies.creative("2", 21); got.Status != bidding.StrategyStatusDisabled || got.Weight != 2 {
+		t.Errorf("素材应被暂停且权重不变: %+v", got)
+	}
+	if got := f.strategies.creative("2", 22); got.Status != bidding.StrategyStatusEnabled {
+		t.Errorf("其他素材应继续轮换: %+v", got)
+	}
+	if got := f.strategies.get(2); got.Status != bidding.StrategyStatusEnabled {
+		t.Errorf("出价策略应继续投放: %+v", got)
+	}
+
+	// 已暂停的素材不再检测
+	f.redis.Del("fatigue:cooldown:2:21")
+	if actions := f.run(t); len(actions) != 0 {
+		t.Errorf("已暂停的素材不应再次操作: %+v", actions)
+	}
+}
+
+func TestDetector_SkipsHealthyOrSmallSamples(t *testing.T) {
+	f := newFixture(t, enabled("3"))
+	f.strategies.creatives["3"] = []bidding.BidStrategyCreative{
+		link(3, 31, bidding.StrategyStatusEnabled, 1),
+		link(3, 32, bidding.StrategyStatusEnabled, 1),
+		link(3, 33, bidding.StrategyStatusEnabled, 1),
+	}
+	// CTR下降20%，未达到阈值
+	f.ctr("3", 31, 10000, 200, 5000, 80)
+	// 近期展示数不足
+	f.ctr("3", 32, 10000, 200, 500, 1)
+	// 基准窗口没有点击
+	f.ctr("3", 33, 10000, 0, 5000, 0)
+
+	if actions := f.run(t); len(actions) != 0 {
+		t.Errorf("不应操作: %+v", actions)
+	}
+	if f.redis.PublishCount() != 0 || len(f.notifier.data) != 0 {
+		t.Errorf("没有操作时不应通知")
+	}
+}
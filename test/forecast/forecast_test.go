@@ -0,0 +1,261 @@
+package forecast_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/floor"
+	"simple-dsp/internal/forecast"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStore 内存流量分布存储
+type memoryStore struct {
+	mu   sync.Mutex
+	days map[string]map[forecast.Key]int64
+	err  error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{days: make(map[string]map[forecast.Key]int64)}
+}
+
+func (s *memoryStore) Add(ctx context.Context, date string, counts map[forecast.Key]int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	day, ok := s.days[date]
+	if !ok {
+		day = make(map[forecast.Key]int64)
+		s.days[date] = day
+	}
+	for k, n := range counts {
+		day[k] += n
+	}
+	return nil
+}
+
+func (s *memoryStore) Load(ctx context.Context, date string) (map[forecast.Key]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.days[date], nil
+}
+
+// observe 记录n个广告位请求
+func observe(r *forecast.Recorder, s forecast.Sample, at time.Time, n int) {
+	for i := 0; i < n; i++ {
+		r.ObserveAt(s, at)
+	}
+}
+
+// newForecaster 最近两天有ex1的流量，ex1的320x50有60次成交，平均成交价1
+func newForecaster(t *testing.T) (*forecast.Forecaster, *memoryStore) {
+	store := newMemoryStore()
+	recorder := forecast.NewRecorder(store, time.Minute, logger.NewLogger(zap.NewNop()))
+	yesterday := time.Now().AddDate(0, 0, -1)
+	twoDaysAgo := time.Now().AddDate(0, 0, -2)
+
+	ios := forecast.Sample{Exchange: "ex1", AdType: "banner", Width: 320, Height: 50, Floor: 0.2, OS: "iOS", Network: "wifi", Location: "CN-11"}
+	observe(recorder, ios, yesterday, 1000)
+	observe(recorder, ios, twoDaysAgo, 1000)
+	highFloor := ios
+	highFloor.Floor = 3
+	observe(recorder, highFloor, yesterday, 1000)
+	android := ios
+	android.OS = "android"
+	observe(recorder, android, yesterday, 400)
+	unknownPath := ios
+	unknownPath.Exchange = "ex2"
+	observe(recorder, unknownPath, yesterday, 200)
+	// 今天的数据不参与预估
+	observe(recorder, ios, time.Now(), 5000)
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	tracker := floor.NewTracker(config.FloorConfig{}, nil, logger.NewLogger(zap.NewNop()), nil)
+	slot := bidding.AdSlot{SlotID: "slot-1", Width: 320, Height: 50}
+	for i := 0; i < 100; i++ {
+		tracker.ObserveBid("ex1", slot, 1.5)
+	}
+	for i := 0; i < 60; i++ {
+		tracker.ObserveWin("ex1", "slot-1", "320x50", 1)
+	}
+	return forecast.NewForecaster(store, tracker, 50), store
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-6
+}
+
+func TestForecaster_Forecast(t *testing.T) {
+	forecaster, _ := newForecaster(t)
+
+	tests := []struct {
+		name            string
+		req             forecast.Request
+		wantMatched     float64
+		wantAvailable   float64
+		wantImpressions float64
+		wantSpend       float64
+		wantLimited     bool
+		wantLowConf     bool
+	}{
+		{
+			// 两天共3000次请求，出价不低于所有底价档，胜率0.6，成交价1
+			name:            "出价高于平均成交价",
+			req:             forecast.Request{Exchanges: []string{"ex1"}, Targeting: forecast.Targeting{OSTypes: []string{"iOS"}}, BidPrice: 2},
+			wantMatched:     1500,
+			wantAvailable:   1500,
+			wantImpressions: 900,
+			wantSpend:       900,
+		},
+		{
+			// 底价3的请求不可参与，胜率按出价与成交价的比例降低
+			name:            "出价低于平均成交价",
+			req:             forecast.Request{Exchanges: []string{"ex1"}, Targeting: forecast.Targeting{OSTypes: []string{"ios"}}, BidPrice: 0.5},
+			wantMatched:     1500,
+			wantAvailable:   1000,
+			wantImpressions: 300,
+			wantSpend:       150,
+		},
+		{
+			name:            "日预算限制花费",
+			req:             forecast.Request{Exchanges: []string{"ex1"}, Targeting: forecast.Targeting{OSTypes: []string{"ios"}}, BidPrice: 2, DailyBudget: 90},
+			wantMatched:     1500,
+			wantAvailable:   1500,
+			wantImpressions: 90,
+			wantSpend:       90,
+			wantLimited:     true,
+		},
+		{
+			// ex2没有足够的成交样本，使用汇总的胜率
+			name:            "成交样本不足的供应路径",
+			req:             forecast.Request{Exchanges: []string{"ex2"}, BidPrice: 2},
+			wantMatched:     100,
+			wantAvailable:   100,
+			wantImpressions: 60,
+			wantSpend:       60,
+			wantLowConf:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := forecaster.Forecast(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("Forecast() error = %v", err)
+			}
+			if result.Days != 2 {
+				t.Errorf("Days = %d, want 2", result.Days)
+			}
+			if !approx(result.MatchedRequests, tt.wantMatched) || !approx(result.AvailableImpressions, tt.wantAvailable) {
+				t.Errorf("请求数 = %v/%v, want %v/%v", result.MatchedRequests, result.AvailableImpressions, tt.wantMatched, tt.wantAvailable)
+			}
+			if !approx(result.Impressions, tt.wantImpressions) || !approx(result.Spend, tt.wantSpend) {
+				t.Errorf("展示/花费 = %v/%v, want %v/%v", result.Impressions, result.Spend, tt.wantImpressions, tt.wantSpend)
+			}
+			if result.BudgetLimited != tt.wantLimited || result.LowConfidence != tt.wantLowConf {
+				t.Errorf("BudgetLimited/LowConfidence = %v/%v, want %v/%v", result.BudgetLimited, result.LowConfidence, tt.wantLimited, tt.wantLowConf)
+			}
+		})
+	}
+}
+
+func TestForecaster_IgnoredTargeting(t *testing.T) {
+	forecaster, _ := newForecaster(t)
+
+	result, err := forecaster.Forecast(context.Background(), forecast.Request{
+		BidPrice:  2,
+		Targeting: forecast.Targeting{Ages: []string{"18-24"}, Interests: []string{"games"}},
+	})
+	if err != nil {
+		t.Fatalf("Forecast() error = %v", err)
+	}
+	if len(result.IgnoredTargeting) != 2 || result.IgnoredTargeting[0] != "ages" || result.IgnoredTargeting[1] != "interests" {
+		t.Errorf("IgnoredTargeting = %v, want [ages interests]", result.IgnoredTargeting)
+	}
+	// 年龄和兴趣不缩小预估范围
+	if !approx(result.MatchedRequests, 1800) {
+		t.Errorf("MatchedRequests = %v, want 1800", result.MatchedRequests)
+	}
+}
+
+func TestRecorder_FlushRetry(t *testing.T) {
+	store := newMemoryStore()
+	store.err = errors.New("写入失败")
+	recorder := forecast.NewRecorder(store, time.Minute, logger.NewLogger(zap.NewNop()))
+	yesterday := time.Now().AddDate(0, 0, -1)
+	observe(recorder, forecast.Sample{Exchange: "ex1", Width: 320, Height: 50}, yesterday, 3)
+
+	if err := recorder.Flush(context.Background()); err == nil {
+		t.Fatal("存储失败时Flush()应返回错误")
+	}
+
+	// 失败的增量保留到下次写入
+	store.err = nil
+	observe(recorder, forecast.Sample{Exchange: "ex1", Width: 320, Height: 50}, yesterday, 2)
+	if err := recorder.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	counts, _ := store.Load(context.Background(), yesterday.Format("2006-01-02"))
+	if got := counts[forecast.Key{Exchange: "ex1", Size: "320x50"}]; got != 5 {
+		t.Errorf("请求数 = %d, want 5", got)
+	}
+}
+
+func TestHandler_Forecast(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	forecaster, _ := newForecaster(t)
+	empty := forecast.NewForecaster(newMemoryStore(), floor.NewTracker(config.FloorConfig{}, nil, logger.NewLogger(zap.NewNop()), nil), 0)
+
+	tests := []struct {
+		name       string
+		forecaster *forecast.Forecaster
+		body       string
+		wantStatus int
+	}{
+		{"正常预估", forecaster, `{"exchanges":["ex1"],"bid_price":2}`, http.StatusOK},
+		{"出价无效", forecaster, `{"bid_price":0}`, http.StatusBadRequest},
+		{"统计天数无效", forecaster, `{"bid_price":1,"days":31}`, http.StatusBadRequest},
+		{"请求格式错误", forecaster, `{`, http.StatusBadRequest},
+		{"没有流量数据", empty, `{"bid_price":1}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/api/v1/admin/forecast", forecast.NewHandler(tt.forecaster, logger.NewLogger(zap.NewNop())).Forecast)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/admin/forecast", bytes.NewBufferString(tt.body)))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("状态码 = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				var result forecast.Result
+				if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+					t.Fatalf("解析响应失败: %v", err)
+				}
+				if result.Impressions <= 0 {
+					t.Errorf("Impressions = %v, want > 0", result.Impressions)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,542 @@
+package frequency_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/frequency"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/timezone"
+)
+
+// 两种实现均可用作竞价引擎的频次控制
+var (
+	_ bidding.FrequencyController = frequency.Controller(nil)
+	_ frequency.Controller        = (*frequency.DailyController)(nil)
+	_ frequency.Controller        = (*frequency.DistributedController)(nil)
+	_ frequency.Store             = (*redis.Client)(nil)
+	_ frequency.Store             = (*redis.ClusterClient)(nil)
+)
+
+// memoryStore 内存实现的计数和哈希操作，不支持管道
+// 脚本按是否使用有序集合模拟按天计数和滑动窗口计数两个脚本，按是否读取哈希模拟令牌桶脚本
+// 包含ZPOPMAX或DECR的脚本模拟两种模式下归还曝光的脚本
+type memoryStore struct {
+	mu      sync.Mutex
+	evals   int
+	counts  map[string]int64
+	buckets map[string][2]float64
+	hashes  map[string]map[string]string
+	zsets   map[string][]int64
+	expires map[string]time.Duration
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		counts:  map[string]int64{},
+		buckets: map[string][2]float64{},
+		hashes:  map[string]map[string]string{},
+		zsets:   map[string][]int64{},
+		expires: map[string]time.Duration{},
+	}
+}
+
+func (s *memoryStore) Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.evals++
+	if strings.Contains(script, "HMGET") {
+		return s.takeTokens(keys, args)
+	}
+	key := keys[0]
+	if strings.Contains(script, "ZPOPMAX") {
+		if n := len(s.zsets[key]); n > 0 {
+			s.zsets[key] = s.zsets[key][:n-1]
+		}
+		return redis.NewCmdResult(int64(len(s.zsets[key])), nil)
+	}
+	if strings.Contains(script, "DECR") {
+		if s.counts[key] > 0 {
+			s.counts[key]--
+		}
+		return redis.NewCmdResult(s.counts[key], nil)
+	}
+	if strings.Contains(script, "ZADD") {
+		now, start, limit := toInt(args[0]), toInt(args[1]), toInt(args[2])
+		var kept []int64
+		for _, score := range s.zsets[key] {
+			if score > start {
+				kept = append(kept, score)
+			}
+		}
+		if int64(len(kept)) >= limit {
+			s.zsets[key] = kept
+			return redis.NewCmdResult([]interface{}{int64(0), int64(0)}, nil)
+		}
+		s.zsets[key] = append(kept, now)
+		s.expires[key] = time.Duration(toInt(args[3])) * time.Millisecond
+		return redis.NewCmdResult([]interface{}{int64(1), limit - int64(len(kept)) - 1}, nil)
+	}
+
+	limit := toInt(args[0])
+	if s.counts[key] >= limit {
+		return redis.NewCmdResult([]interface{}{int64(0), int64(0)}, nil)
+	}
+	s.counts[key]++
+	if s.counts[key] == 1 {
+		s.expires[key] = time.Duration(toInt(args[1])) * time.Second
+	}
+	return redis.NewCmdResult([]interface{}{int64(1), limit - s.counts[key]}, nil)
+}
+
+// takeTokens 模拟令牌桶脚本，state为{令牌数, 毫秒时间戳}
+func (s *memoryStore) takeTokens(keys []string, args []interface{}) *redis.Cmd {
+	now := float64(toInt(args[0]))
+	tokens := make([]float64, len(keys))
+	for i, key := range keys {
+		rate, _ := strconv.ParseFloat(fmt.Sprint(args[i+1]), 64)
+		burst := math.Max(rate, 1)
+		state, ok := s.buckets[key]
+		if !ok {
+			state = [2]float64{burst, now}
+		}
+		tokens[i] = math.Min(burst, state[0]+math.Max(now-state[1], 0)*rate/1000)
+		if tokens[i] < 1 {
+			return redis.NewCmdResult(int64(i+1), nil)
+		}
+	}
+	for i, key := range keys {
+		s.buckets[key] = [2]float64{tokens[i] - 1, now}
+	}
+	return redis.NewCmdResult(int64(0), nil)
+}
+
+func (s *memoryStore) EvalSha(ctx context.Context, sha1 string, keys []string, args ...interface{}) *redis.Cmd {
+	return redis.NewCmdResult(nil, errors.New("NOSCRIPT No matching script"))
+}
+
+func (s *memoryStore) ScriptExists(ctx context.Context, hashes ...string) *redis.BoolSliceCmd {
+	return redis.NewBoolSliceResult(make([]bool, len(hashes)), nil)
+}
+
+func (s *memoryStore) ScriptLoad(ctx context.Context, script string) *redis.StringCmd {
+	return redis.NewStringResult("", nil)
+}
+
+func toInt(v interface{}) int64 {
+	n, _ := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	return n
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) *redis.StringCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.counts[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+	return redis.NewStringResult(fmt.Sprint(n), nil)
+}
+
+func (s *memoryStore) Incr(ctx context.Context, key string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[key]++
+	return redis.NewIntResult(s.counts[key], nil)
+}
+
+func (s *memoryStore) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expires[key] = expiration
+	return redis.NewBoolResult(true, nil)
+}
+
+func (s *memoryStore) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.counts, key)
+		delete(s.hashes, key)
+	}
+	return redis.NewIntResult(int64(len(keys)), nil)
+}
+
+func (s *memoryStore) HMSet(ctx context.Context, key string, values ...interface{}) *redis.BoolCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := map[string]string{}
+	for k, v := range values[0].(map[string]string) {
+		hash[k] = v
+	}
+	s.hashes[key] = hash
+	return redis.NewBoolResult(true, nil)
+}
+
+func (s *memoryStore) HGetAll(ctx context.Context, key string) *redis.StringStringMapCmd {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return redis.NewStringStringMapResult(s.hashes[key], nil)
+}
+
+func (s *memoryStore) ZCount(ctx context.Context, key, min, max string) *redis.IntCmd {
+	return redis.NewIntResult(0, nil)
+}
+
+func (s *memoryStore) Pipeline() redis.Pipeliner {
+	return nil
+}
+
+func newMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestNew(t *testing.T) {
+	log := logger.NewLogger(zap.NewNop())
+	m := newMetrics(t)
+	store := newMemoryStore()
+
+	cases := map[string]interface{}{
+		"":                    &frequency.DailyController{},
+		frequency.ModeDaily:   &frequency.DailyController{},
+		frequency.ModeSliding: &frequency.DistributedController{},
+	}
+	for mode, want := range cases {
+		ctrl, err := frequency.New(config.FrequencyConfig{Mode: mode}, store, log, m)
+		if err != nil {
+			t.Fatalf("New(%q) error = %v", mode, err)
+		}
+		if fmt.Sprintf("%T", ctrl) != fmt.Sprintf("%T", want) {
+			t.Fatalf("New(%q) = %T, want %T", mode, ctrl, want)
+		}
+	}
+
+	if _, err := frequency.New(config.FrequencyConfig{Mode: "hourly"}, store, log, m); !errors.Is(err, frequency.ErrInvalidMode) {
+		t.Fatalf("err = %v, want ErrInvalidMode", err)
+	}
+}
+
+func TestDailyController(t *testing.T) {
+	ctx := context.Background()
+	m := newMetrics(t)
+	store := newMemoryStore()
+	ctrl := frequency.NewDailyController(store, logger.NewLogger(zap.NewNop()), m)
+
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 2,
+		ClickLimit:      1,
+		TimeWindow:      time.Hour,
+		QPS:             10,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		ok, err := ctrl.CheckImpression(ctx, "u1", "ad1")
+		if err != nil || !ok {
+			t.Fatalf("CheckImpression() #%d = %v, %v", i, ok, err)
+		}
+		if err := ctrl.RecordImpression(ctx, "u1", "ad1"); err != nil {
+			t.Fatalf("RecordImpression() error = %v", err)
+		}
+	}
+	if ok, _ := ctrl.CheckImpression(ctx, "u1", "ad1"); ok {
+		t.Fatal("曝光达到上限后应拒绝")
+	}
+	// 其他用户和点击分别计数
+	if ok, _ := ctrl.CheckImpression(ctx, "u2", "ad1"); !ok {
+		t.Fatal("其他用户不受影响")
+	}
+	if ok, _ := ctrl.CheckClick(ctx, "u1", "ad1"); !ok {
+		t.Fatal("点击单独计数")
+	}
+	if got := testutil.ToFloat64(m.Frequency.LimitExceeded); got != 1 {
+		t.Fatalf("LimitExceeded = %v, want 1", got)
+	}
+
+	// 未配置的广告使用默认配置
+	cfg, err := ctrl.GetConfig(ctx, "ad2")
+	if err != nil || cfg.ImpressionLimit != 10 || cfg.ClickLimit != 3 {
+		t.Fatalf("GetConfig() = %+v, %v", cfg, err)
+	}
+	if err := ctrl.UpdateConfig(ctx, "ad2", &frequency.Config{}); err == nil {
+		t.Fatal("无效配置应返回错误")
+	}
+}
+
+func TestDailyController_Timezone(t *testing.T) {
+	ctx := context.Background()
+	zones, err := timezone.New(config.TimezoneConfig{
+		Default:   "America/Los_Angeles",
+		Campaigns: []config.CampaignTimezoneConfig{{CampaignID: "c1", Timezone: "Asia/Tokyo"}},
+	})
+	if err != nil {
+		t.Fatalf("timezone.New() error = %v", err)
+	}
+	zones.SetAdCampaigns(map[string]string{"ad1": "c1"})
+	store := newMemoryStore()
+	ctrl := frequency.WithTimezones(frequency.NewDailyController(store, logger.NewLogger(zap.NewNop()), newMetrics(t)), zones)
+
+	// 自然日按广告所属推广计划的时区计算，不属于推广计划的广告使用默认时区
+	if err := ctrl.RecordImpression(ctx, "u1", "ad1"); err != nil {
+		t.Fatalf("RecordImpression() error = %v", err)
+	}
+	if err := ctrl.RecordClick(ctx, "u1", "ad2"); err != nil {
+		t.Fatalf("RecordClick() error = %v", err)
+	}
+	now := time.Now()
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	for _, key := range []string{
+		"freq:imp:u1:ad1:" + now.In(tokyo).Format("20060102"),
+		"freq:click:u1:ad2:" + now.In(la).Format("20060102"),
+	} {
+		if store.counts[key] != 1 {
+			t.Fatalf("%s = %d, want 1, counts = %v", key, store.counts[key], store.counts)
+		}
+	}
+}
+
+func TestAcquireImpression(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(zap.NewNop())
+
+	for _, mode := range []string{frequency.ModeDaily, frequency.ModeSliding} {
+		m := newMetrics(t)
+		store := newMemoryStore()
+		ctrl, err := frequency.New(config.FrequencyConfig{Mode: mode}, store, log, m)
+		if err != nil {
+			t.Fatalf("New(%q) error = %v", mode, err)
+		}
+		if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+			ImpressionLimit: 5,
+			ClickLimit:      1,
+			TimeWindow:      time.Hour,
+			QPS:             10,
+		}); err != nil {
+			t.Fatalf("UpdateConfig() error = %v", err)
+		}
+
+		// 返回计数后的剩余次数
+		remaining, ok, err := ctrl.AcquireImpression(ctx, "u1", "ad1")
+		if err != nil || !ok || remaining != 4 {
+			t.Fatalf("%s: AcquireImpression() = %d, %v, %v", mode, remaining, ok, err)
+		}
+
+		// 并发请求通过的次数不超过上限
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		passed := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok, err := ctrl.AcquireImpression(ctx, "u1", "ad1"); err == nil && ok {
+					mu.Lock()
+					passed++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if passed != 4 {
+			t.Fatalf("%s: passed = %d, want 4", mode, passed)
+		}
+		if remaining, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok || remaining != 0 {
+			t.Fatalf("%s: 达到上限后 = %d, %v", mode, remaining, ok)
+		}
+		if got := testutil.ToFloat64(m.Frequency.LimitExceeded); got != 17 {
+			t.Fatalf("%s: LimitExceeded = %v, want 17", mode, got)
+		}
+	}
+}
+
+func TestReleaseImpression(t *testing.T) {
+	ctx := context.Background()
+	log := logger.NewLogger(zap.NewNop())
+
+	for _, mode := range []string{frequency.ModeDaily, frequency.ModeSliding} {
+		ctrl, err := frequency.New(config.FrequencyConfig{Mode: mode}, newMemoryStore(), log, newMetrics(t))
+		if err != nil {
+			t.Fatalf("New(%q) error = %v", mode, err)
+		}
+		if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+			ImpressionLimit: 1,
+			ClickLimit:      1,
+			TimeWindow:      time.Hour,
+		}); err != nil {
+			t.Fatalf("UpdateConfig() error = %v", err)
+		}
+
+		if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+			t.Fatalf("%s: 首次曝光应通过", mode)
+		}
+		// 归还后可再次占用，没有占用时归还不会使计数为负
+		for i := 0; i < 2; i++ {
+			if err := ctrl.ReleaseImpression(ctx, "u1", "ad1"); err != nil {
+				t.Fatalf("%s: ReleaseImpression() error = %v", mode, err)
+			}
+		}
+		if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+			t.Fatalf("%s: 归还后应通过", mode)
+		}
+		if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok {
+			t.Fatalf("%s: 归还不应超过占用的次数", mode)
+		}
+	}
+}
+
+func TestSlidingWindowExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	ctrl := frequency.NewDistributedController(store, logger.NewLogger(zap.NewNop()), newMetrics(t))
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 1,
+		ClickLimit:      1,
+		TimeWindow:      50 * time.Millisecond,
+		QPS:             10,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+		t.Fatal("首次曝光应通过")
+	}
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok {
+		t.Fatal("窗口内超过上限应拒绝")
+	}
+	// 窗口滑过后重新计数，计数键按窗口设置过期时间
+	time.Sleep(60 * time.Millisecond)
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+		t.Fatal("窗口滑过后应通过")
+	}
+	if got := store.expires["freq:win:imp:u1:ad1"]; got != 50*time.Millisecond {
+		t.Fatalf("expire = %v, want 50ms", got)
+	}
+}
+
+func TestDailyController_MidnightRollover(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	fake := clock.NewFake(time.Date(2026, 10, 16, 23, 59, 59, 0, time.Local))
+	ctrl := frequency.WithClock(frequency.NewDailyController(store, logger.NewLogger(zap.NewNop()), newMetrics(t)), fake)
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 1,
+		ClickLimit:      1,
+		TimeWindow:      time.Hour,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+		t.Fatal("当天首次曝光应通过")
+	}
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok {
+		t.Fatal("当天超过上限应拒绝")
+	}
+
+	// 零点后按新的日期计数
+	fake.Advance(time.Second)
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok {
+		t.Fatal("零点后应重新计数")
+	}
+	for _, key := range []string{"freq:imp:u1:ad1:20261016", "freq:imp:u1:ad1:20261017"} {
+		if store.counts[key] != 1 {
+			t.Fatalf("%s = %d, want 1, counts = %v", key, store.counts[key], store.counts)
+		}
+	}
+}
+
+func TestSlidingWindow_Clock(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local))
+	ctrl := frequency.WithClock(frequency.NewDistributedController(newMemoryStore(), logger.NewLogger(zap.NewNop()), newMetrics(t)), fake)
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 2,
+		ClickLimit:      1,
+		TimeWindow:      time.Hour,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+
+	ctrl.AcquireImpression(ctx, "u1", "ad1")
+	fake.Advance(30 * time.Minute)
+	ctrl.AcquireImpression(ctx, "u1", "ad1")
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok {
+		t.Fatal("窗口内超过上限应拒绝")
+	}
+
+	// 第一次曝光滑出窗口后空出一次
+	fake.Advance(31 * time.Minute)
+	if remaining, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); !ok || remaining != 0 {
+		t.Fatalf("第一次曝光滑出窗口后 = %d, %v", remaining, ok)
+	}
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "u1", "ad1"); ok {
+		t.Fatal("第二次曝光仍在窗口内，应拒绝")
+	}
+}
+
+// mapResolver 按固定映射解析跨设备的用户ID
+type mapResolver map[string]string
+
+func (r mapResolver) Resolve(ctx context.Context, id string) string {
+	if userID, ok := r[id]; ok {
+		return userID
+	}
+	return id
+}
+
+func TestWithIdentity(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	inner := frequency.NewDistributedController(store, logger.NewLogger(zap.NewNop()), newMetrics(t))
+	ctrl := frequency.WithIdentity(inner, mapResolver{"idfa-1": "user-1", "gaid-1": "user-1"})
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 2,
+		ClickLimit:      1,
+		TimeWindow:      time.Hour,
+		QPS:             10,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+
+	// 同一用户的两台设备共用频次
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "idfa-1", "ad1"); !ok {
+		t.Fatal("idfa-1首次曝光应通过")
+	}
+	if remaining, ok, _ := ctrl.AcquireImpression(ctx, "gaid-1", "ad1"); !ok || remaining != 0 {
+		t.Fatalf("gaid-1 = %d, %v", remaining, ok)
+	}
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "idfa-1", "ad1"); ok {
+		t.Fatal("同一用户跨设备超过上限应拒绝")
+	}
+	if _, ok := store.zsets["freq:win:imp:user-1:ad1"]; !ok {
+		t.Fatal("应按用户ID计数")
+	}
+
+	// 没有关联的设备单独计数
+	if _, ok, _ := ctrl.AcquireImpression(ctx, "idfa-2", "ad1"); !ok {
+		t.Fatal("未关联的设备应单独计数")
+	}
+}
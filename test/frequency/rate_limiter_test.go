@@ -0,0 +1,138 @@
+package frequency_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/frequency"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/logger"
+)
+
+var _ bidding.RateLimiter = (*frequency.RateLimiter)(nil)
+
+func TestRateLimiterAd(t *testing.T) {
+	ctx := context.Background()
+	m := newMetrics(t)
+	store := newMemoryStore()
+	log := logger.NewLogger(zap.NewNop())
+	ctrl := frequency.NewDailyController(store, log, m)
+	limiter := frequency.NewRateLimiter(store, time.Minute, log, m)
+
+	// 未配置QPS的广告不限制，也不访问令牌桶
+	for i := 0; i < 100; i++ {
+		if ok, err := limiter.Allow(ctx, "ad0", ""); err != nil || !ok {
+			t.Fatalf("Allow() = %v, %v", ok, err)
+		}
+	}
+	if store.evals != 0 {
+		t.Fatalf("evals = %d, want 0", store.evals)
+	}
+
+	if err := ctrl.UpdateConfig(ctx, "ad1", &frequency.Config{
+		ImpressionLimit: 5,
+		ClickLimit:      1,
+		TimeWindow:      time.Hour,
+		QPS:             2,
+	}); err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if ok, err := limiter.Allow(ctx, "ad1", ""); err != nil || !ok {
+			t.Fatalf("Allow() #%d = %v, %v", i, ok, err)
+		}
+	}
+	if ok, _ := limiter.Allow(ctx, "ad1", ""); ok {
+		t.Fatal("超过QPS后应拒绝")
+	}
+	if got := testutil.ToFloat64(m.Frequency.QPSLimited.WithLabelValues(frequency.ScopeAd)); got != 1 {
+		t.Fatalf("QPSLimited{ad} = %v, want 1", got)
+	}
+
+	// 令牌按QPS恢复
+	time.Sleep(600 * time.Millisecond)
+	if ok, err := limiter.Allow(ctx, "ad1", ""); err != nil || !ok {
+		t.Fatalf("恢复令牌后Allow() = %v, %v", ok, err)
+	}
+
+	if _, err := limiter.Allow(ctx, "", ""); !errors.Is(err, frequency.ErrInvalidAdID) {
+		t.Fatalf("err = %v, want ErrInvalidAdID", err)
+	}
+}
+
+func TestRateLimiterCampaign(t *testing.T) {
+	ctx := context.Background()
+	m := newMetrics(t)
+	store := newMemoryStore()
+	limiter := frequency.NewRateLimiter(store, time.Minute, logger.NewLogger(zap.NewNop()), m)
+
+	if err := limiter.SetCampaignQPS(ctx, "c1", -1); !errors.Is(err, frequency.ErrInvalidConfig) {
+		t.Fatalf("err = %v, want ErrInvalidConfig", err)
+	}
+	if err := limiter.SetCampaignQPS(ctx, "c1", 3); err != nil {
+		t.Fatalf("SetCampaignQPS() error = %v", err)
+	}
+	if qps, err := limiter.CampaignQPS(ctx, "c1"); err != nil || qps != 3 {
+		t.Fatalf("CampaignQPS() = %v, %v", qps, err)
+	}
+
+	// 同一计划下的广告共用计划的QPS
+	for _, ad := range []string{"ad1", "ad2", "ad1"} {
+		if ok, err := limiter.Allow(ctx, ad, "c1"); err != nil || !ok {
+			t.Fatalf("Allow(%s) = %v, %v", ad, ok, err)
+		}
+	}
+	if ok, _ := limiter.Allow(ctx, "ad3", "c1"); ok {
+		t.Fatal("计划超过QPS后应拒绝")
+	}
+	// 其他计划不受影响
+	if ok, _ := limiter.Allow(ctx, "ad3", "c2"); !ok {
+		t.Fatal("其他计划不受影响")
+	}
+	if got := testutil.ToFloat64(m.Frequency.QPSLimited.WithLabelValues(frequency.ScopeCampaign)); got != 1 {
+		t.Fatalf("QPSLimited{campaign} = %v, want 1", got)
+	}
+
+	// 设置为0后不再限制
+	if err := limiter.SetCampaignQPS(ctx, "c1", 0); err != nil {
+		t.Fatalf("SetCampaignQPS() error = %v", err)
+	}
+	if ok, _ := limiter.Allow(ctx, "ad3", "c1"); !ok {
+		t.Fatal("QPS为0时不应限制")
+	}
+}
+
+func TestRateLimiter_Clock(t *testing.T) {
+	ctx := context.Background()
+	m := newMetrics(t)
+	store := newMemoryStore()
+	log := logger.NewLogger(zap.NewNop())
+	fake := clock.NewFake(time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local))
+	limiter := frequency.NewRateLimiter(store, time.Minute, log, m)
+	limiter.SetClock(fake)
+	if err := limiter.SetCampaignQPS(ctx, "c1", 1); err != nil {
+		t.Fatalf("SetCampaignQPS() error = %v", err)
+	}
+
+	if ok, _ := limiter.Allow(ctx, "ad1", "c1"); !ok {
+		t.Fatal("首个请求应通过")
+	}
+	// 时间不变时令牌不恢复
+	if ok, _ := limiter.Allow(ctx, "ad1", "c1"); ok {
+		t.Fatal("令牌用尽后应拒绝")
+	}
+	fake.Advance(999 * time.Millisecond)
+	if ok, _ := limiter.Allow(ctx, "ad1", "c1"); ok {
+		t.Fatal("不足1秒时令牌未恢复")
+	}
+	fake.Advance(time.Millisecond)
+	if ok, _ := limiter.Allow(ctx, "ad1", "c1"); !ok {
+		t.Fatal("1秒后应恢复一个令牌")
+	}
+}
@@ -0,0 +1,276 @@
+package funnel_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/funnel"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakedb"
+)
+
+var base = time.Date(2026, 10, 16, 12, 0, 0, 0, time.Local)
+
+func event(eventType stats.EventType, requestID, adID string, offset time.Duration) *stats.Event {
+	return &stats.Event{
+		EventType: eventType,
+		RequestID: requestID,
+		AdID:      adID,
+		SlotID:    "slot-1",
+		Timestamp: base.Add(offset),
+	}
+}
+
+func TestTopics(t *testing.T) {
+	want := "dsp.events.bid,dsp.events.win,dsp.events.impression,dsp.events.click,dsp.events.conversion"
+	if got := strings.Join(funnel.Topics(), ","); got != want {
+		t.Errorf("主题应为%s, got %s", want, got)
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	bid := event(stats.EventBid, "r1", "1", 0)
+	bid.BidPrice = 2.5
+	bid.ExtraParams = map[string]string{"exchange": "adx", "size": "300x250"}
+	row := funnel.FromEvent(bid)
+	if row == nil || row.BidTime == nil || !row.BidTime.Equal(base) || *row.BidPrice != 2.5 || row.Exchange != "adx" || row.Size != "300x250" {
+		t.Fatalf("出价事件转换错误: %+v", row)
+	}
+	if row.WinTime != nil || row.ImpressionTime != nil || row.WinPrice != nil {
+		t.Errorf("出价事件不应设置其他阶段: %+v", row)
+	}
+	if !row.Date.Equal(time.Date(2026, 10, 16, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("日期应为事件所在的日期, got %v", row.Date)
+	}
+
+	imp := event(stats.EventImpression, "r1", "1", time.Second)
+	imp.WinPrice = 1.2
+	if row := funnel.FromEvent(imp); row.ImpressionTime == nil || row.WinPrice == nil || *row.WinPrice != 1.2 {
+		t.Errorf("展示携带的成交价应记录: %+v", row)
+	}
+
+	for _, e := range []*stats.Event{
+		event(stats.EventDwell, "r1", "1", 0),
+		event(stats.EventVideoStart, "r1", "1", 0),
+		event(stats.EventClick, "", "1", 0),
+		event(stats.EventClick, "r1", "", 0),
+	} {
+		if row := funnel.FromEvent(e); row != nil {
+			t.Errorf("事件%+v不属于漏斗, got %+v", e, row)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	bid := event(stats.EventBid, "r1", "1", 0)
+	bid.BidPrice = 3
+	win := event(stats.EventWin, "r1", "1", time.Second)
+	win.WinPrice = 2
+	imp := event(stats.EventImpression, "r1", "1", 2*time.Second)
+	imp.WinPrice = 2.1
+	click := event(stats.EventClick, "r1", "1", 10*time.Second)
+	dupClick := event(stats.EventClick, "r1", "1", 20*time.Second)
+
+	// 乱序到达，另一个广告和另一个请求分开关联
+	rows := funnel.Join([]*stats.Event{
+		click, imp, event(stats.EventBid, "r1", "2", 0), win, bid, dupClick,
+		event(stats.EventClick, "r2", "1", 0),
+	})
+	if len(rows) != 3 {
+		t.Fatalf("应关联为3行, got %d", len(rows))
+	}
+
+	row := rows[0]
+	if row.RequestID != "r1" || row.AdID != "1" {
+		t.Fatalf("行应按首次出现的顺序排列, got %s/%s", row.RequestID, row.AdID)
+	}
+	if !row.BidTime.Equal(base) || !row.WinTime.Equal(base.Add(time.Second)) || !row.ImpressionTime.Equal(base.Add(2*time.Second)) {
+		t.Errorf("各阶段时间错误: %+v", row)
+	}
+	if !row.ClickTime.Equal(base.Add(10 * time.Second)) {
+		t.Errorf("重复的点击应保留最早的时间, got %v", row.ClickTime)
+	}
+	if row.ConversionTime != nil {
+		t.Errorf("未到达的阶段应为nil")
+	}
+	if *row.BidPrice != 3 || *row.WinPrice != 2.1 {
+		t.Errorf("价格应保留先到的值: bid=%v win=%v", *row.BidPrice, *row.WinPrice)
+	}
+}
+
+func TestMergeIdempotent(t *testing.T) {
+	events := []*stats.Event{
+		event(stats.EventBid, "r1", "1", 0),
+		event(stats.EventWin, "r1", "1", time.Second),
+		event(stats.EventImpression, "r1", "1", 2*time.Second),
+	}
+	once := funnel.Join(events)[0]
+
+	// 重复消费同一批事件，结果不变
+	again := funnel.Join(append(events, events...))[0]
+	merged := *once
+	funnel.Merge(&merged, again)
+	if !merged.BidTime.Equal(*once.BidTime) || !merged.WinTime.Equal(*once.WinTime) || !merged.ImpressionTime.Equal(*once.ImpressionTime) {
+		t.Errorf("重复合并结果应不变: %+v", merged)
+	}
+
+	// 较早的日期优先，跨零点的点击仍归入出价的日期
+	late := funnel.FromEvent(event(stats.EventClick, "r1", "1", 13*time.Hour))
+	funnel.Merge(late, once)
+	if !late.Date.Equal(once.Date) || late.BidTime == nil {
+		t.Errorf("合并后日期应取较早的日期: %+v", late)
+	}
+}
+
+func TestReportCalculate(t *testing.T) {
+	var total funnel.Report
+	total.Add(funnel.Report{Bids: 100, Wins: 20, Impressions: 18, Clicks: 3, Conversions: 1, ImpressionsWithoutWin: 2})
+	total.Add(funnel.Report{Bids: 100, Wins: 20, Impressions: 22, Clicks: 1})
+	total.Calculate()
+	if total.WinRate != 0.2 || total.CTR != 0.1 || total.CVR != 0.25 || total.ImpressionsWithoutWin != 2 {
+		t.Errorf("合计错误: %+v", total)
+	}
+
+	var empty funnel.Report
+	empty.Calculate()
+	if empty.WinRate != 0 || empty.CTR != 0 || empty.CVR != 0 {
+		t.Errorf("没有数据时比率应为0: %+v", empty)
+	}
+}
+
+func TestGormStoreUpsert(t *testing.T) {
+	db := fakedb.New()
+	store := funnel.NewGormStore(db.Open(t))
+
+	rows := funnel.Join([]*stats.Event{
+		event(stats.EventBid, "r1", "1", 0),
+		event(stats.EventWin, "r1", "1", time.Second),
+	})
+	if err := store.Upsert(context.Background(), rows); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+
+	var upsert string
+	for _, s := range db.Statements() {
+		if strings.HasPrefix(s.Query, `INSERT INTO "auction_funnels"`) {
+			upsert = s.Query
+		}
+	}
+	if upsert == "" {
+		t.Fatal("应写入auction_funnels")
+	}
+	for _, want := range []string{
+		`ON CONFLICT ("request_id","ad_id") DO UPDATE`,
+		`"bid_time"=LEAST(auction_funnels.bid_time, EXCLUDED.bid_time)`,
+		`"win_price"=COALESCE(auction_funnels.win_price, EXCLUDED.win_price)`,
+		`"date"=LEAST(auction_funnels.date, EXCLUDED.date)`,
+	} {
+		if !strings.Contains(upsert, want) {
+			t.Errorf("写入语句缺少%s: %s", want, upsert)
+		}
+	}
+
+	db.Reset()
+	if err := store.Upsert(context.Background(), nil); err != nil || len(db.Statements()) != 0 {
+		t.Errorf("没有数据时不应执行语句")
+	}
+}
+
+func TestGormStoreReportAndPurge(t *testing.T) {
+	db := fakedb.New()
+	columns := []string{"date", "ad_id", "auctions", "bids", "wins", "impressions", "clicks", "conversions",
+		"wins_without_bid", "wins_without_impression", "impressions_without_win", "clicks_without_impression"}
+	db.Respond("SELECT TO_CHAR", "", columns,
+		[]driver.Value{"2026-10-16", "1", int64(110), int64(100), int64(10), int64(9), int64(3), int64(1), int64(0), int64(2), int64(1), int64(0)},
+	)
+	store := funnel.NewGormStore(db.Open(t))
+
+	reports, err := store.Report(context.Background(), "2026-10-10", "2026-10-16", "1")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Bids != 100 || reports[0].WinsWithoutImpression != 2 || reports[0].WinRate != 0.1 {
+		t.Fatalf("报表错误: %+v", reports)
+	}
+	s := db.Statements()[0]
+	if !fakedb.HasArg(s.Args, "2026-10-10") || !fakedb.HasArg(s.Args, "2026-10-16") || !fakedb.HasArg(s.Args, "1") {
+		t.Errorf("查询应带日期范围和广告条件: %v", s.Args)
+	}
+
+	db.Reset()
+	if _, err := store.Purge(context.Background(), time.Date(2026, 10, 9, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	// 删除在默认事务中执行，第一条语句为BEGIN
+	s = db.Statements()[1]
+	if !strings.HasPrefix(s.Query, `DELETE FROM "auction_funnels" WHERE date <`) || !fakedb.HasArg(s.Args, "2026-10-09") {
+		t.Errorf("清理语句错误: %s %v", s.Query, s.Args)
+	}
+}
+
+// memoryStore 固定报表的漏斗存储
+type memoryStore struct {
+	reports []funnel.Report
+	adID    string
+}
+
+func (m *memoryStore) Upsert(ctx context.Context, rows []*models.AuctionFunnel) error {
+	return nil
+}
+
+func (m *memoryStore) Report(ctx context.Context, startDate, endDate, adID string) ([]funnel.Report, error) {
+	m.adID = adID
+	return m.reports, nil
+}
+
+func (m *memoryStore) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestFunnelHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memoryStore{reports: []funnel.Report{
+		{Date: "2026-10-16", AdID: "1", Bids: 100, Wins: 10, Impressions: 10, Clicks: 1, WinsWithoutBid: 1},
+		{Date: "2026-10-15", AdID: "1", Bids: 100, Wins: 30, Impressions: 30, Clicks: 3},
+	}}
+	router := gin.New()
+	handlers.NewFunnelHandler(store, logger.NewLogger(zap.NewNop())).RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/funnel?start_date=2026-10-15&end_date=2026-10-16&ad_id=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("应返回200, got %d: %s", w.Code, w.Body)
+	}
+	if store.adID != "1" {
+		t.Errorf("应按广告查询, got %q", store.adID)
+	}
+
+	var body struct {
+		Summary funnel.Report   `json:"summary"`
+		Items   []funnel.Report `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(body.Items) != 2 || body.Summary.Bids != 200 || body.Summary.WinRate != 0.2 || body.Summary.WinsWithoutBid != 1 {
+		t.Errorf("合计错误: %+v", body.Summary)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/funnel?start_date=2026-10-17&end_date=2026-10-16", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("无效的日期范围应返回400, got %d", w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package http_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-dsp/api/gateway"
+	pb "simple-dsp/api/proto/dsp/v1"
+	"simple-dsp/pkg/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeBidService 按请求ID返回预设结果
+type fakeBidService struct {
+	pb.UnimplementedBidServiceServer
+}
+
+func (s *fakeBidService) ProcessBid(ctx context.Context, req *pb.BidRequest) (*pb.BidResponse, error) {
+	switch req.GetRequestId() {
+	case "no-ads":
+		return nil, status.Error(codes.NotFound, "没有可用的广告")
+	case "invalid":
+		return nil, status.Error(codes.InvalidArgument, "无效的竞价请求")
+	}
+	return &pb.BidResponse{
+		RequestId: req.GetRequestId(),
+		Ads:       []*pb.AdResponse{{SlotId: "slot-1", AdId: "ad-1", BidPrice: 2.5}},
+	}, nil
+}
+
+func TestGateway_ProcessBid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var methods []string
+	recorder := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		methods = append(methods, info.FullMethod)
+		return handler(ctx, req)
+	}
+
+	router := gin.New()
+	gateway.NewGateway(&fakeBidService{}, logger.NewLogger(zap.NewNop()), recorder).Register(router)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "正常竞价请求",
+			body:       `{"request_id":"req-1","user_id":"user-1","ad_slots":[{"slot_id":"slot-1","width":300,"height":250}]}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "驼峰字段名",
+			body:       `{"requestId":"req-2","userId":"user-1"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "无广告返回",
+			body:       `{"request_id":"no-ads"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "参数校验失败",
+			body:       `{"request_id":"invalid"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "无效的JSON",
+			body:       `{"request_id":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/v1/bid", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+			if _, ok := resp["request_id"]; !ok {
+				t.Errorf("响应应使用proto字段名, got %s", w.Body.String())
+			}
+		})
+	}
+
+	// 经由拦截器的请求使用与gRPC一致的方法名
+	for _, m := range methods {
+		if m != "/dsp.v1.BidService/ProcessBid" {
+			t.Errorf("FullMethod = %s, want /dsp.v1.BidService/ProcessBid", m)
+		}
+	}
+	if len(methods) != 4 {
+		t.Errorf("拦截器调用次数 = %d, want 4", len(methods))
+	}
+}
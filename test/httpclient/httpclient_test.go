@@ -0,0 +1,309 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/httpclient"
+	"simple-dsp/pkg/metrics"
+)
+
+func newMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	return m
+}
+
+// flakyServer 前failures次请求返回503，之后返回200，响应体为收到的请求体
+func flakyServer(t *testing.T, failures int32) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+func retryConfig(retries int) config.HTTPClientsConfig {
+	return config.HTTPClientsConfig{
+		Destinations: map[string]config.HTTPClientConfig{
+			httpclient.DestinationSupplyChain: {MaxRetries: retries, RetryBackoff: time.Millisecond},
+		},
+	}
+}
+
+func TestFactory_Config(t *testing.T) {
+	f := httpclient.NewFactory(config.HTTPClientsConfig{
+		Default: config.HTTPClientConfig{Timeout: time.Second, MaxIdleConnsPerHost: 64},
+		Destinations: map[string]config.HTTPClientConfig{
+			httpclient.DestinationRTA: {MaxConnsPerHost: 512, MaxIdleConnsPerHost: 128},
+		},
+	}, nil)
+
+	rta := f.Config(httpclient.DestinationRTA)
+	if rta.MaxConnsPerHost != 512 || rta.MaxIdleConnsPerHost != 128 {
+		t.Errorf("rta连接池 = %d/%d, want 512/128", rta.MaxConnsPerHost, rta.MaxIdleConnsPerHost)
+	}
+	// 目标未设置的项使用默认配置
+	if rta.Timeout != time.Second {
+		t.Errorf("rta超时 = %v, want 1s", rta.Timeout)
+	}
+	tracking := f.Config(httpclient.DestinationTracking)
+	if tracking.MaxIdleConnsPerHost != 64 || tracking.MaxConnsPerHost != 0 {
+		t.Errorf("tracking连接池 = %d/%d, want 64/0", tracking.MaxIdleConnsPerHost, tracking.MaxConnsPerHost)
+	}
+	// 默认配置也未设置的项使用内置默认值
+	if tracking.IdleConnTimeout != 90*time.Second || tracking.MaxIdleConns != 1024 {
+		t.Errorf("内置默认值 = %v/%d, want 90s/1024", tracking.IdleConnTimeout, tracking.MaxIdleConns)
+	}
+
+	if f.Transport(httpclient.DestinationRTA) != f.Transport(httpclient.DestinationRTA) {
+		t.Error("同一目标应共用Transport")
+	}
+	if f.Transport(httpclient.DestinationRTA) == f.Transport(httpclient.DestinationTracking) {
+		t.Error("不同目标的连接池应隔离")
+	}
+	if got := f.Client(httpclient.DestinationRTA).Timeout; got != time.Second {
+		t.Errorf("Client().Timeout = %v, want 1s", got)
+	}
+}
+
+func TestTransport_Retry(t *testing.T) {
+	server, hits := flakyServer(t, 2)
+	m := newMetrics(t)
+	client := httpclient.NewFactory(retryConfig(2), m).Client(httpclient.DestinationSupplyChain)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want 200", resp.StatusCode)
+	}
+	if got := hits.Load(); got != 3 {
+		t.Errorf("请求次数 = %d, want 3", got)
+	}
+	if got := testutil.ToFloat64(m.Outbound.Retries.WithLabelValues(httpclient.DestinationSupplyChain)); got != 2 {
+		t.Errorf("重试次数 = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.Outbound.Requests.WithLabelValues(httpclient.DestinationSupplyChain, "5xx")); got != 2 {
+		t.Errorf("5xx次数 = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.Outbound.Requests.WithLabelValues(httpclient.DestinationSupplyChain, "2xx")); got != 1 {
+		t.Errorf("2xx次数 = %v, want 1", got)
+	}
+}
+
+func TestTransport_RetryLimit(t *testing.T) {
+	server, hits := flakyServer(t, 5)
+	client := httpclient.NewFactory(retryConfig(1), nil).Client(httpclient.DestinationSupplyChain)
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	// 重试用完后返回最后一次的响应
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want 503", resp.StatusCode)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("请求次数 = %d, want 2", got)
+	}
+}
+
+func TestTransport_NonIdempotent(t *testing.T) {
+	tests := []struct {
+		name           string
+		idempotencyKey string
+		wantHits       int32
+		wantStatus     int
+	}{
+		{name: "POST不重试", wantHits: 1, wantStatus: http.StatusServiceUnavailable},
+		{name: "带幂等键的POST重试并重新发送请求体", idempotencyKey: "k1", wantHits: 2, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, hits := flakyServer(t, 1)
+			client := httpclient.NewFactory(retryConfig(2), nil).Client(httpclient.DestinationSupplyChain)
+
+			req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+			if tt.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", tt.idempotencyKey)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("StatusCode = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := hits.Load(); got != tt.wantHits {
+				t.Errorf("请求次数 = %d, want %d", got, tt.wantHits)
+			}
+			if resp.StatusCode == http.StatusOK && string(body) != "payload" {
+				t.Errorf("重试的请求体 = %q, want payload", body)
+			}
+		})
+	}
+}
+
+func TestFactory_DNSCache(t *testing.T) {
+	server, _ := flakyServer(t, 0)
+	m := newMetrics(t)
+	f := httpclient.NewFactory(config.HTTPClientsConfig{DNS: config.DNSCacheConfig{TTL: time.Minute}}, m)
+	client := f.Client(httpclient.DestinationTracking)
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+		// 关闭空闲连接，下一次请求重新建立连接
+		f.CloseIdleConnections()
+	}
+	if got := testutil.ToFloat64(m.Outbound.DNSLookups.WithLabelValues("miss")); got != 1 {
+		t.Errorf("未命中次数 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Outbound.DNSLookups.WithLabelValues("hit")); got != 1 {
+		t.Errorf("命中次数 = %v, want 1", got)
+	}
+}
+
+// fakeResolver 将所有域名解析到127.0.0.1，fail为true时解析失败
+type fakeResolver struct {
+	fail    atomic.Bool
+	lookups atomic.Int32
+}
+
+func (r *fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lookups.Add(1)
+	if r.fail.Load() {
+		return nil, errors.New("dns unavailable")
+	}
+	return []string{"127.0.0.1"}, nil
+}
+
+func TestFactory_DNSStaleIfError(t *testing.T) {
+	server, _ := flakyServer(t, 0)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	tests := []struct {
+		name     string
+		dns      config.DNSCacheConfig
+		wantErr  bool
+		wantStat string
+	}{
+		{
+			name:     "解析失败时使用过期的结果",
+			dns:      config.DNSCacheConfig{TTL: 10 * time.Millisecond, StaleTTL: time.Minute},
+			wantStat: "stale",
+		},
+		{
+			name:     "超过StaleTTL后不再使用旧结果",
+			dns:      config.DNSCacheConfig{TTL: 10 * time.Millisecond, StaleTTL: time.Millisecond},
+			wantErr:  true,
+			wantStat: "error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMetrics(t)
+			f := httpclient.NewFactory(config.HTTPClientsConfig{DNS: tt.dns}, m)
+			dns := &fakeResolver{}
+			f.SetResolver(dns)
+			client := f.Client(httpclient.DestinationRTA)
+
+			resp, err := client.Get("http://rta.test" + port)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			f.CloseIdleConnections()
+
+			dns.fail.Store(true)
+			time.Sleep(20 * time.Millisecond)
+			resp, err = client.Get("http://rta.test" + port)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DNS故障时Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+			if got := testutil.ToFloat64(m.Outbound.DNSLookups.WithLabelValues(tt.wantStat)); got != 1 {
+				t.Errorf("%s次数 = %v, want 1", tt.wantStat, got)
+			}
+		})
+	}
+}
+
+func TestFactory_DNSHostTTL(t *testing.T) {
+	server, _ := flakyServer(t, 0)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	m := newMetrics(t)
+	f := httpclient.NewFactory(config.HTTPClientsConfig{DNS: config.DNSCacheConfig{
+		TTL:   time.Millisecond,
+		Hosts: []config.DNSHostConfig{{Host: "RTA.test", TTL: time.Minute}},
+	}}, m)
+	dns := &fakeResolver{}
+	f.SetResolver(dns)
+	client := f.Client(httpclient.DestinationRTA)
+
+	// rta.test单独配置了较长的缓存时间，track.test使用默认的1毫秒
+	for i := 0; i < 2; i++ {
+		for _, host := range []string{"rta.test", "track.test"} {
+			resp, err := client.Get("http://" + host + port)
+			if err != nil {
+				t.Fatalf("Get(%s) error = %v", host, err)
+			}
+			resp.Body.Close()
+		}
+		f.CloseIdleConnections()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := dns.lookups.Load(); got != 3 {
+		t.Errorf("解析次数 = %d, want 3", got)
+	}
+	if got := testutil.ToFloat64(m.Outbound.DNSCacheEntries); got != 2 {
+		t.Errorf("缓存的域名数 = %v, want 2", got)
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	tr := httpclient.NewTransport(config.HTTPClientConfig{MaxConnsPerHost: 64, IdleConnTimeout: 30 * time.Second})
+	if tr.MaxConnsPerHost != 64 {
+		t.Errorf("MaxConnsPerHost = %d, want 64", tr.MaxConnsPerHost)
+	}
+	if tr.IdleConnTimeout != 30*time.Second {
+		t.Errorf("IdleConnTimeout = %v, want 30s", tr.IdleConnTimeout)
+	}
+	// 未配置的项使用默认值，每个主机的空闲连接数远大于http.DefaultTransport的2个
+	if tr.MaxIdleConnsPerHost != 256 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 256", tr.MaxIdleConnsPerHost)
+	}
+	if tr.MaxIdleConns != 1024 {
+		t.Errorf("MaxIdleConns = %d, want 1024", tr.MaxIdleConns)
+	}
+}
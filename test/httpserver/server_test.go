@@ -0,0 +1,93 @@
+package httpserver_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/httpclient"
+	"simple-dsp/pkg/httpserver"
+)
+
+// serve 按配置启动服务器，返回监听地址
+func serve(t *testing.T, cfg config.ServerConfig) string {
+	t.Helper()
+	srv, err := httpserver.New(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	ln, err := httpserver.Listen("127.0.0.1:0", cfg.TCPKeepAlive)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return ln.Addr().String()
+}
+
+func TestServer_H2C(t *testing.T) {
+	addr := serve(t, config.ServerConfig{H2C: true, IdleTimeout: time.Minute})
+
+	// 不经过TLS直接发送HTTP/2连接前言
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("ProtoMajor = %d, want 2", resp.ProtoMajor)
+	}
+}
+
+func TestServer_HTTP1WithH2C(t *testing.T) {
+	addr := serve(t, config.ServerConfig{H2C: true})
+
+	// 启用h2c时仍接受HTTP/1.1请求
+	resp, err := http.Get("http://" + addr)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 1 {
+		t.Errorf("ProtoMajor = %d, want 1", resp.ProtoMajor)
+	}
+}
+
+func TestServer_DisableKeepAlives(t *testing.T) {
+	tests := []struct {
+		name              string
+		disableKeepAlives bool
+	}{
+		{name: "保持连接"},
+		{name: "关闭keep-alive", disableKeepAlives: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serve(t, config.ServerConfig{DisableKeepAlives: tt.disableKeepAlives})
+			client := &http.Client{Transport: httpclient.NewTransport(config.HTTPClientConfig{})}
+			resp, err := client.Get("http://" + addr)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.Close != tt.disableKeepAlives {
+				t.Errorf("resp.Close = %v, want %v", resp.Close, tt.disableKeepAlives)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package id_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/id"
+)
+
+const alphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func TestNew_Format(t *testing.T) {
+	got := id.New()
+	if len(got) != id.Length {
+		t.Fatalf("len(%q) = %d, want %d", got, len(got), id.Length)
+	}
+	for _, c := range got {
+		if !strings.ContainsRune(alphabet, c) {
+			t.Fatalf("%q 包含Crockford Base32以外的字符 %q", got, c)
+		}
+	}
+	// 128位编码为26个字符，第一个字符最多使用3位
+	if got[0] > '7' {
+		t.Fatalf("%q 的第一个字符超出范围", got)
+	}
+}
+
+func TestNew_Monotonic(t *testing.T) {
+	// 同一毫秒内大量生成，后生成的ID字典序更大
+	ids := make([]string, 10000)
+	for i := range ids {
+		ids[i] = id.New()
+	}
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("ids[%d] = %q 不大于 ids[%d] = %q", i, ids[i], i-1, ids[i-1])
+		}
+	}
+}
+
+func TestNew_TimeOrdered(t *testing.T) {
+	first := id.New()
+	time.Sleep(2 * time.Millisecond)
+	second := id.New()
+	// 前10个字符为毫秒时间戳
+	if second[:10] <= first[:10] {
+		t.Fatalf("时间戳部分未递增: %q, %q", first, second)
+	}
+}
+
+func TestNew_NoCollisions(t *testing.T) {
+	const workers, perWorker = 16, 5000
+	var wg sync.WaitGroup
+	results := make([][]string, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			ids := make([]string, perWorker)
+			for i := range ids {
+				ids[i] = id.New()
+			}
+			results[w] = ids
+		}(w)
+	}
+	wg.Wait()
+
+	seen := make(map[string]struct{}, workers*perWorker)
+	for _, ids := range results {
+		for _, v := range ids {
+			if _, ok := seen[v]; ok {
+				t.Fatalf("并发生成的ID重复: %q", v)
+			}
+			seen[v] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package identity_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/identity"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryGraph 内存身份图谱
+type memoryGraph struct {
+	mu      sync.Mutex
+	links   map[string]string
+	lookups int
+	err     error
+}
+
+func newMemoryGraph() *memoryGraph {
+	return &memoryGraph{links: map[string]string{}}
+}
+
+func (g *memoryGraph) Link(ctx context.Context, links []identity.Link) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.err != nil {
+		return g.err
+	}
+	for _, link := range links {
+		g.links[link.DeviceID] = link.UserID
+	}
+	return nil
+}
+
+func (g *memoryGraph) Unlink(ctx context.Context, deviceID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.links, deviceID)
+	return nil
+}
+
+func (g *memoryGraph) Lookup(ctx context.Context, deviceID string) (string, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lookups++
+	if g.err != nil {
+		return "", false, g.err
+	}
+	userID, ok := g.links[deviceID]
+	return userID, ok, nil
+}
+
+func newMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	graph := newMemoryGraph()
+	graph.links["idfa-1"] = "user-1"
+	m := newMetrics(t)
+	resolver := identity.NewResolver(graph, 0, logger.NewLogger(zap.NewNop()), m)
+
+	if got := resolver.Resolve(ctx, "idfa-1"); got != "user-1" {
+		t.Fatalf("Resolve(idfa-1) = %s, want user-1", got)
+	}
+	// 没有关联时使用原ID
+	if got := resolver.Resolve(ctx, "idfa-2"); got != "idfa-2" {
+		t.Fatalf("Resolve(idfa-2) = %s, want idfa-2", got)
+	}
+
+	// 关联和未关联的结果都缓存
+	resolver.Resolve(ctx, "idfa-1")
+	resolver.Resolve(ctx, "idfa-2")
+	if graph.lookups != 2 {
+		t.Fatalf("lookups = %d, want 2", graph.lookups)
+	}
+	if got := testutil.ToFloat64(m.Frequency.IdentityLookups.WithLabelValues("cached")); got != 2 {
+		t.Fatalf("cached = %v, want 2", got)
+	}
+
+	// 查询失败时使用原ID且不缓存
+	graph.err = errors.New("redis down")
+	if got := resolver.Resolve(ctx, "idfa-3"); got != "idfa-3" {
+		t.Fatalf("Resolve(idfa-3) = %s", got)
+	}
+	graph.err = nil
+	graph.links["idfa-3"] = "user-3"
+	if got := resolver.Resolve(ctx, "idfa-3"); got != "user-3" {
+		t.Fatalf("Resolve(idfa-3) = %s, want user-3", got)
+	}
+}
+
+func newRouter(t *testing.T, graph *memoryGraph, resolver *identity.Resolver, m *metrics.Metrics) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	log := logger.NewLogger(zap.NewNop())
+	ingester := identity.NewIngester(graph, resolver, log, m)
+	handler := identity.NewHandler(ingester, graph, resolver, log)
+
+	router := gin.New()
+	router.POST("/api/v1/identity/links", handler.AddLinks)
+	router.DELETE("/api/v1/identity/links/:device_id", handler.DeleteLink)
+	return router
+}
+
+func TestHandlerLinks(t *testing.T) {
+	ctx := context.Background()
+	graph := newMemoryGraph()
+	m := newMetrics(t)
+	resolver := identity.NewResolver(graph, 0, logger.NewLogger(zap.NewNop()), m)
+	router := newRouter(t, graph, resolver, m)
+
+	// 关联前解析结果已缓存为原ID
+	if got := resolver.Resolve(ctx, "idfa-1"); got != "idfa-1" {
+		t.Fatalf("Resolve() = %s", got)
+	}
+
+	body := `{"links":[{"device_id":"idfa-1","user_id":"user-1"},{"device_id":"gaid-1","user_id":"user-1"},{"device_id":"","user_id":"user-2"}]}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/identity/links", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Saved   int `json:"saved"`
+		Skipped int `json:"skipped"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Saved != 2 || resp.Skipped != 1 {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if got := testutil.ToFloat64(m.Frequency.IdentityLinks.WithLabelValues("api", "invalid")); got != 1 {
+		t.Fatalf("invalid = %v, want 1", got)
+	}
+
+	// 本实例上新的关联立即生效
+	if got := resolver.Resolve(ctx, "idfa-1"); got != "user-1" {
+		t.Fatalf("Resolve() = %s, want user-1", got)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/identity/links/idfa-1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	if got := resolver.Resolve(ctx, "idfa-1"); got != "idfa-1" {
+		t.Fatalf("删除关联后 Resolve() = %s", got)
+	}
+}
+
+func TestHandlerRejectsInvalidRequests(t *testing.T) {
+	graph := newMemoryGraph()
+	m := newMetrics(t)
+	router := newRouter(t, graph, nil, m)
+
+	links := make([]string, identity.MaxLinksPerRequest+1)
+	for i := range links {
+		links[i] = fmt.Sprintf(`{"device_id":"d%d","user_id":"u"}`, i)
+	}
+	cases := map[string]int{
+		`not json`: http.StatusBadRequest,
+		`{"links":[` + strings.Join(links, ",") + `]}`: http.StatusBadRequest,
+	}
+	for body, want := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/identity/links", strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("status = %d, want %d", w.Code, want)
+		}
+	}
+
+	graph.err = errors.New("redis down")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/identity/links",
+		strings.NewReader(`{"links":[{"device_id":"d1","user_id":"u1"}]}`)))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if got := testutil.ToFloat64(m.Frequency.IdentityLinks.WithLabelValues("api", "error")); got != 1 {
+		t.Fatalf("error = %v, want 1", got)
+	}
+}
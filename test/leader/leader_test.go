@@ -0,0 +1,162 @@
+package leader_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/leader"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/test/fakelock"
+)
+
+const (
+	testTTL   = 150 * time.Millisecond
+	testRetry = 10 * time.Millisecond
+)
+
+// recordingWorker 记录启动和停止次数
+type recordingWorker struct {
+	mu      sync.Mutex
+	running bool
+	starts  int
+	stops   int
+}
+
+func (w *recordingWorker) Start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = true
+	w.starts++
+}
+
+func (w *recordingWorker) Stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running = false
+	w.stops++
+}
+
+func (w *recordingWorker) state() (running bool, starts, stops int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.running, w.starts, w.stops
+}
+
+func newMetrics() *metrics.Metrics {
+	return &metrics.Metrics{
+		Leader: &metrics.LeaderMetrics{
+			IsLeader:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "is_leader"}, []string{"election"}),
+			Transitions: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "transitions"}, []string{"election", "event"}),
+		},
+	}
+}
+
+func newElector(nodes []redis.Cmdable, m *metrics.Metrics) (*leader.Elector, *recordingWorker) {
+	log := logger.NewLogger(zap.NewNop())
+	locker := lock.NewLocker(config.LockConfig{TTL: testTTL}, nodes, log)
+	e := leader.NewElector(config.LeaderConfig{Election: "jobs", RetryInterval: testRetry}, locker, log)
+	e.SetMetrics(m)
+	w := &recordingWorker{}
+	e.Register(w)
+	return e, w
+}
+
+// waitFor 等待条件成立，超时后失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElector_SingleLeaderAndFailover(t *testing.T) {
+	nodes := []redis.Cmdable{fakelock.NewNode()}
+	ma, mb := newMetrics(), newMetrics()
+	a, wa := newElector(nodes, ma)
+	b, wb := newElector(nodes, mb)
+
+	a.Start()
+	waitFor(t, "a当选", a.IsLeader)
+	b.Start()
+	defer b.Stop()
+
+	// b持续竞选也不会当选
+	time.Sleep(2 * testTTL)
+	if b.IsLeader() {
+		t.Fatal("同一时刻只能有一个主实例")
+	}
+	if running, _, _ := wa.state(); !running {
+		t.Fatal("主实例应运行任务")
+	}
+	if running, starts, _ := wb.state(); running || starts != 0 {
+		t.Fatal("非主实例不应运行任务")
+	}
+	if got := testutil.ToFloat64(ma.Leader.IsLeader.WithLabelValues("jobs")); got != 1 {
+		t.Fatalf("主实例的is_leader = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(mb.Leader.IsLeader.WithLabelValues("jobs")); got != 0 {
+		t.Fatalf("非主实例的is_leader = %v, want 0", got)
+	}
+
+	// 主实例退出后释放锁，b无需等待锁过期即可当选
+	a.Stop()
+	if running, _, stops := wa.state(); running || stops != 1 {
+		t.Fatal("卸任后应停止任务")
+	}
+	waitFor(t, "b当选", b.IsLeader)
+	if running, _, _ := wb.state(); !running {
+		t.Fatal("新的主实例应运行任务")
+	}
+	if got := testutil.ToFloat64(ma.Leader.Transitions.WithLabelValues("jobs", "revoked")); got != 1 {
+		t.Fatalf("卸任次数 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(mb.Leader.Transitions.WithLabelValues("jobs", "elected")); got != 1 {
+		t.Fatalf("当选次数 = %v, want 1", got)
+	}
+}
+
+func TestElector_StepDownOnLeaseLost(t *testing.T) {
+	node := fakelock.NewNode()
+	m := newMetrics()
+	e, w := newElector([]redis.Cmdable{node}, m)
+
+	e.Start()
+	defer e.Stop()
+	waitFor(t, "当选", e.IsLeader)
+
+	// 锁被其他实例持有后卸任并停止任务
+	node.Steal("lock:{leader:jobs}")
+	waitFor(t, "卸任", func() bool { return !e.IsLeader() })
+	if running, starts, stops := w.state(); running || starts != 1 || stops != 1 {
+		t.Fatalf("running=%v starts=%d stops=%d", running, starts, stops)
+	}
+	if got := testutil.ToFloat64(m.Leader.IsLeader.WithLabelValues("jobs")); got != 0 {
+		t.Fatalf("卸任后is_leader = %v, want 0", got)
+	}
+}
+
+func TestElector_RegisterWhileLeader(t *testing.T) {
+	e, _ := newElector([]redis.Cmdable{fakelock.NewNode()}, newMetrics())
+	e.Start()
+	defer e.Stop()
+	waitFor(t, "当选", e.IsLeader)
+
+	late := &recordingWorker{}
+	e.Register(late)
+	if running, _, _ := late.state(); !running {
+		t.Fatal("已是主实例时注册的任务应立即启动")
+	}
+}
@@ -0,0 +1,423 @@
+package ledger_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/ledger"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStore 内存账本存储，按幂等键去重
+type memoryStore struct {
+	mu       sync.Mutex
+	nextID   uint64
+	entries  []models.LedgerEntry
+	balances map[string]map[string]models.LedgerDailyBalance // 日期 -> 广告主 -> 余额
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{balances: make(map[string]map[string]models.LedgerDailyBalance)}
+}
+
+func (m *memoryStore) Append(ctx context.Context, entries []*models.LedgerEntry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for _, entry := range entries {
+		if m.find(entry.IdempotencyKey) != nil {
+			continue
+		}
+		m.nextID++
+		entry.ID = m.nextID
+		m.entries = append(m.entries, *entry)
+		n++
+	}
+	return n, nil
+}
+
+func (m *memoryStore) find(key string) *models.LedgerEntry {
+	for i := range m.entries {
+		if m.entries[i].IdempotencyKey == key {
+			copied := m.entries[i]
+			return &copied
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) FindByKey(ctx context.Context, key string) (*models.LedgerEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.find(key), nil
+}
+
+func (m *memoryStore) SumEntries(ctx context.Context, from, to time.Time) ([]ledger.Totals, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sums := make(map[[2]string]*ledger.Totals)
+	for _, e := range m.entries {
+		if e.CreateTime.Before(from) || !e.CreateTime.Before(to) {
+			continue
+		}
+		key := [2]string{e.AdvertiserID, e.Type}
+		if sums[key] == nil {
+			sums[key] = &ledger.Totals{AdvertiserID: e.AdvertiserID, Type: e.Type}
+		}
+		sums[key].Amount += e.Amount
+		sums[key].MediaCost += e.MediaCost
+		sums[key].Fee += e.Fee
+		sums[key].Tax += e.Tax
+		sums[key].Count++
+	}
+	totals := make([]ledger.Totals, 0, len(sums))
+	for _, t := range sums {
+		totals = append(totals, *t)
+	}
+	return totals, nil
+}
+
+func (m *memoryStore) FirstEntryTime(ctx context.Context) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var first time.Time
+	for _, e := range m.entries {
+		if first.IsZero() || e.CreateTime.Before(first) {
+			first = e.CreateTime
+		}
+	}
+	return first, nil
+}
+
+func (m *memoryStore) LastClosedDate(ctx context.Context) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last time.Time
+	for date := range m.balances {
+		d, _ := time.ParseInLocation(ledger.DateLayout, date, time.Local)
+		if d.After(last) {
+			last = d
+		}
+	}
+	return last, nil
+}
+
+func (m *memoryStore) Balances(ctx context.Context, date time.Time) ([]models.LedgerDailyBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var balances []models.LedgerDailyBalance
+	for _, b := range m.balances[date.Format(ledger.DateLayout)] {
+		balances = append(balances, b)
+	}
+	return balances, nil
+}
+
+func (m *memoryStore) SaveBalances(ctx context.Context, date time.Time, balances []models.LedgerDailyBalance) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	day := make(map[string]models.LedgerDailyBalance, len(balances))
+	for _, b := range balances {
+		day[b.AdvertiserID] = b
+	}
+	m.balances[date.Format(ledger.DateLayout)] = day
+	return nil
+}
+
+func (m *memoryStore) ListBalances(ctx context.Context, advertiserID string, from, to time.Time) ([]models.LedgerDailyBalance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var balances []models.LedgerDailyBalance
+	for _, day := range m.balances {
+		if b, ok := day[advertiserID]; ok && !b.Date.Before(from) && !b.Date.After(to) {
+			balances = append(balances, b)
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].Date.Before(balances[j].Date) })
+	return balances, nil
+}
+
+func (m *memoryStore) LatestBalance(ctx context.Context, advertiserID string, before time.Time) (*models.LedgerDailyBalance, error) {
+	balances, err := m.ListBalances(ctx, advertiserID, time.Time{}, before.Add(-time.Nanosecond))
+	if err != nil || len(balances) == 0 {
+		return nil, err
+	}
+	return &balances[len(balances)-1], nil
+}
+
+// clock 可调整的时钟
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func day(d int, hour int) time.Time {
+	return time.Date(2026, 10, d, hour, 0, 0, 0, time.Local)
+}
+
+func newLedger(store ledger.Store, now *clock) *ledger.Ledger {
+	l := ledger.New(config.LedgerConfig{}, store, logger.NewLogger(zap.NewNop()))
+	l.SetClock(now.Now)
+	return l
+}
+
+func entry(advertiserID, typ string, amount int64, key string) *models.LedgerEntry {
+	return &models.LedgerEntry{AdvertiserID: advertiserID, Type: typ, Amount: amount, IdempotencyKey: key}
+}
+
+// split 设置流水的费用构成
+func split(e *models.LedgerEntry, mediaCost, fee, tax int64) *models.LedgerEntry {
+	e.MediaCost, e.Fee, e.Tax = mediaCost, fee, tax
+	return e
+}
+
+// TestValidate 测试流水类型与金额方向的校验
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry *models.LedgerEntry
+		want  error
+	}{
+		{"消耗", entry("adv", ledger.TypeSpend, 100, "k"), nil},
+		{"负数消耗", entry("adv", ledger.TypeSpend, -100, "k"), ledger.ErrInvalidAmount},
+		{"退款", entry("adv", ledger.TypeRefund, -100, "k"), nil},
+		{"正数退款", entry("adv", ledger.TypeRefund, 100, "k"), ledger.ErrInvalidAmount},
+		{"负数调整", entry("adv", ledger.TypeAdjustment, -5, "k"), nil},
+		{"零调整", entry("adv", ledger.TypeAdjustment, 0, "k"), ledger.ErrInvalidAmount},
+		{"未知类型", entry("adv", "bonus", 100, "k"), ledger.ErrUnknownType},
+		{"缺少广告主", entry("", ledger.TypeSpend, 100, "k"), ledger.ErrAdvertiserRequired},
+		{"缺少幂等键", entry("adv", ledger.TypeSpend, 100, ""), ledger.ErrKeyRequired},
+		{"费用构成相符", split(entry("adv", ledger.TypeSpend, 118, "k"), 100, 10, 8), nil},
+		{"费用构成不符", split(entry("adv", ledger.TypeSpend, 100, "k"), 100, 10, 8), ledger.ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ledger.Validate(tt.entry)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Validate() = %v, 期望 %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// TestLedger_RecordIdempotent 测试相同幂等键重复提交时返回已有流水，内容不同时报冲突
+func TestLedger_RecordIdempotent(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	l := newLedger(store, &clock{now: day(16, 10)})
+
+	first, created, err := l.Record(ctx, entry("adv-1", ledger.TypeRefund, -500, "refund-1"))
+	if err != nil || !created {
+		t.Fatalf("首次记录: created=%v, err=%v", created, err)
+	}
+
+	again, created, err := l.Record(ctx, entry("adv-1", ledger.TypeRefund, -500, "refund-1"))
+	if err != nil {
+		t.Fatalf("重复记录失败: %v", err)
+	}
+	if created || again.ID != first.ID {
+		t.Errorf("重复记录应返回已有流水: created=%v, id=%d, 期望id=%d", created, again.ID, first.ID)
+	}
+
+	if _, _, err := l.Record(ctx, entry("adv-1", ledger.TypeRefund, -600, "refund-1")); !errors.Is(err, ledger.ErrIdempotencyConflict) {
+		t.Errorf("金额不同时期望ErrIdempotencyConflict, 实际 %v", err)
+	}
+	if len(store.entries) != 1 {
+		t.Errorf("流水数 = %d, 期望 1", len(store.entries))
+	}
+}
+
+// TestSpendEntry 测试计费事件转换为消耗流水
+func TestSpendEntry(t *testing.T) {
+	event := &stats.Event{EventType: stats.EventImpression, RequestID: "req-1", AdID: "42", WinPrice: 0.29, Timestamp: day(16, 9)}
+	e := ledger.SpendEntry(event, "cmp-1", "adv-1")
+	if e == nil {
+		t.Fatal("带成交价的展示应生成消耗流水")
+	}
+	if e.Amount != 29 || e.Type != ledger.TypeSpend || e.AdvertiserID != "adv-1" || e.CampaignID != "cmp-1" {
+		t.Errorf("消耗流水 = %+v", e)
+	}
+	if e.IdempotencyKey != ledger.SpendKey("req-1", "42") || !e.OccurTime.Equal(event.Timestamp) {
+		t.Errorf("幂等键或发生时间错误: %+v", e)
+	}
+
+	// 同一请求的竞价成功通知使用相同的幂等键，只计费一次
+	win := *event
+	win.EventType = stats.EventWin
+	if ledger.SpendEntry(&win, "cmp-1", "adv-1").IdempotencyKey != e.IdempotencyKey {
+		t.Error("展示和竞价成功通知应使用相同的幂等键")
+	}
+
+	if e := ledger.SpendEntry(event, "", ""); e.AdvertiserID != ledger.UnattributedAdvertiser {
+		t.Errorf("无法确定广告主时记入 %q, 实际 %q", ledger.UnattributedAdvertiser, e.AdvertiserID)
+	}
+
+	// 事件携带服务费和税费时，金额为费用构成之和
+	charged := *event
+	charged.Fee = 0.03
+	charged.Tax = 0.02
+	if e := ledger.SpendEntry(&charged, "cmp-1", "adv-1"); e.MediaCost != 29 || e.Fee != 3 || e.Tax != 2 || e.Amount != 34 {
+		t.Errorf("费用构成错误: %+v", e)
+	}
+	if e.MediaCost != 29 || e.Fee != 0 || e.Tax != 0 {
+		t.Errorf("没有服务费和税费时媒体成本为成交价: %+v", e)
+	}
+
+	click := *event
+	click.EventType = stats.EventClick
+	noPrice := *event
+	noPrice.WinPrice = 0
+	for _, ev := range []*stats.Event{&click, &noPrice} {
+		if ledger.SpendEntry(ev, "cmp-1", "adv-1") != nil {
+			t.Errorf("%s事件(成交价%v)不应计费", ev.EventType, ev.WinPrice)
+		}
+	}
+}
+
+// TestLedger_RecordBatch 测试批量写入时跳过重复和无效的流水
+func TestLedger_RecordBatch(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	l := newLedger(store, &clock{now: day(16, 10)})
+
+	n, err := l.RecordBatch(ctx, []*models.LedgerEntry{
+		entry("adv-1", ledger.TypeSpend, 100, "spend:req-1:42"),
+		entry("adv-1", ledger.TypeSpend, 100, "spend:req-1:42"),
+		entry("adv-1", ledger.TypeSpend, 0, "spend:req-2:42"),
+		entry("adv-1", ledger.TypeSpend, 50, "spend:req-3:42"),
+	})
+	if err != nil {
+		t.Fatalf("批量写入失败: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("写入条数 = %d, 期望 2", n)
+	}
+}
+
+// TestLedger_CloseThrough 测试按日期顺序结算，期初取前一天的期末
+func TestLedger_CloseThrough(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	now := &clock{}
+	l := newLedger(store, now)
+
+	now.Set(day(14, 9))
+	l.RecordBatch(ctx, []*models.LedgerEntry{
+		entry("adv-1", ledger.TypeSpend, 1000, "s1"),
+		entry("adv-2", ledger.TypeSpend, 300, "s2"),
+	})
+	now.Set(day(15, 23))
+	l.RecordBatch(ctx, []*models.LedgerEntry{
+		entry("adv-1", ledger.TypeSpend, 500, "s3"),
+		entry("adv-1", ledger.TypeRefund, -200, "r1"),
+		entry("adv-1", ledger.TypeAdjustment, -50, "a1"),
+	})
+
+	now.Set(day(16, 1))
+	if _, err := l.CloseThrough(ctx, day(16, 0)); !errors.Is(err, ledger.ErrDayNotOver) {
+		t.Errorf("结算当天期望ErrDayNotOver, 实际 %v", err)
+	}
+
+	closed, err := l.CloseThrough(ctx, day(15, 0))
+	if err != nil {
+		t.Fatalf("结算失败: %v", err)
+	}
+	if closed != 2 {
+		t.Errorf("结算天数 = %d, 期望 2", closed)
+	}
+
+	balances, _ := store.Balances(ctx, day(15, 0))
+	got := make(map[string]models.LedgerDailyBalance)
+	for _, b := range balances {
+		got[b.AdvertiserID] = b
+	}
+	adv1 := got["adv-1"]
+	if adv1.Opening != 1000 || adv1.Spend != 500 || adv1.Refund != -200 || adv1.Adjustment != -50 || adv1.Closing != 1250 || adv1.EntryCount != 3 {
+		t.Errorf("adv-1余额 = %+v", adv1)
+	}
+	// 当天没有流水的广告主同样结转余额
+	if adv2 := got["adv-2"]; adv2.Opening != 300 || adv2.Closing != 300 || adv2.EntryCount != 0 {
+		t.Errorf("adv-2余额 = %+v", adv2)
+	}
+
+	// 已结算的日期不重复结算，迟到的事件记入到达当天
+	if closed, err := l.CloseThrough(ctx, day(15, 0)); err != nil || closed != 0 {
+		t.Errorf("重复结算: closed=%d, err=%v", closed, err)
+	}
+	l.RecordBatch(ctx, []*models.LedgerEntry{entry("adv-2", ledger.TypeSpend, 70, "late")})
+	now.Set(day(17, 1))
+	if _, err := l.CloseThrough(ctx, day(16, 0)); err != nil {
+		t.Fatalf("结算失败: %v", err)
+	}
+	balances, _ = store.ListBalances(ctx, "adv-2", day(15, 0), day(16, 0))
+	if len(balances) != 2 || balances[0].Closing != 300 || balances[1].Spend != 70 || balances[1].Closing != 370 {
+		t.Errorf("adv-2余额 = %+v", balances)
+	}
+}
+
+// TestLedger_Invoice 测试按结算结果生成账单
+func TestLedger_Invoice(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	now := &clock{now: day(14, 9)}
+	l := newLedger(store, now)
+
+	l.RecordBatch(ctx, []*models.LedgerEntry{entry("adv-1", ledger.TypeSpend, 1000, "s1")})
+	now.Set(day(15, 9))
+	l.RecordBatch(ctx, []*models.LedgerEntry{
+		split(entry("adv-1", ledger.TypeSpend, 400, "s2"), 340, 40, 20),
+		entry("adv-1", ledger.TypeRefund, -100, "r1"),
+	})
+	now.Set(day(16, 9))
+	l.RecordBatch(ctx, []*models.LedgerEntry{split(entry("adv-1", ledger.TypeSpend, 900, "s3"), 800, 60, 40)})
+
+	if _, err := l.Invoice(ctx, "adv-1", day(14, 0), day(15, 0)); !errors.Is(err, ledger.ErrPeriodNotClosed) {
+		t.Errorf("未结算时期望ErrPeriodNotClosed, 实际 %v", err)
+	}
+
+	now.Set(day(18, 9))
+	if _, err := l.CloseThrough(ctx, day(17, 0)); err != nil {
+		t.Fatalf("结算失败: %v", err)
+	}
+
+	invoice, err := l.Invoice(ctx, "adv-1", day(15, 0), day(16, 0))
+	if err != nil {
+		t.Fatalf("生成账单失败: %v", err)
+	}
+	if invoice.Opening != 1000 || invoice.Spend != 1300 || invoice.Refund != -100 || invoice.Closing != 2200 || len(invoice.Days) != 2 {
+		t.Errorf("账单 = %+v", invoice)
+	}
+	if invoice.MediaCost != 1140 || invoice.Fee != 100 || invoice.Tax != 60 || invoice.Days[0].Fee != 40 {
+		t.Errorf("账单费用构成 = %+v", invoice)
+	}
+
+	if _, err := l.Invoice(ctx, "adv-1", day(16, 0), day(15, 0)); !errors.Is(err, ledger.ErrInvalidPeriod) {
+		t.Errorf("区间颠倒时期望ErrInvalidPeriod, 实际 %v", err)
+	}
+
+	// 区间内没有结算记录的广告主，期初期末为区间前的余额
+	empty, err := l.Invoice(ctx, "adv-2", day(15, 0), day(16, 0))
+	if err != nil || empty.Opening != 0 || empty.Closing != 0 || len(empty.Days) != 0 {
+		t.Errorf("空账单 = %+v, err=%v", empty, err)
+	}
+}
@@ -0,0 +1,171 @@
+package listing_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/listing"
+)
+
+type item struct {
+	ID     string
+	Name   string
+	Amount float64
+	Tags   []string
+}
+
+func itemField(it *item, field string) interface{} {
+	switch field {
+	case "id":
+		return it.ID
+	case "name":
+		return it.Name
+	case "amount":
+		return it.Amount
+	case "tags":
+		return it.Tags
+	}
+	return nil
+}
+
+var spec = listing.Spec{
+	Sortable:    []string{"name", "amount"},
+	Filterable:  []string{"name", "tags"},
+	DefaultSort: "-amount",
+}
+
+func newContext(rawQuery string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/?"+rawQuery, nil)
+	return c
+}
+
+func ids(items []*item) []string {
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		out = append(out, it.ID)
+	}
+	return out
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testItems() []*item {
+	return []*item{
+		{ID: "a", Name: "x", Amount: 10, Tags: []string{"red"}},
+		{ID: "b", Name: "y", Amount: 30},
+		{ID: "c", Name: "z", Amount: 20, Tags: []string{"red", "blue"}},
+		{ID: "d", Name: "x", Amount: 20},
+		{ID: "e", Name: "y", Amount: 5},
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	q, err := listing.ParseQuery(newContext(""), spec)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if q.Page != 1 || q.PageSize != listing.DefaultPageSize || q.SortField != "amount" || !q.Desc {
+		t.Errorf("默认参数不正确: %+v", q)
+	}
+
+	q, err = listing.ParseQuery(newContext("page=3&page_size=1000&sort=name&filter[tags]=red"), spec)
+	if err != nil {
+		t.Fatalf("ParseQuery() error = %v", err)
+	}
+	if q.Page != 3 || q.PageSize != listing.MaxPageSize || q.SortField != "name" || q.Desc || q.Filters["tags"] != "red" {
+		t.Errorf("解析参数不正确: %+v", q)
+	}
+
+	tests := []struct {
+		query string
+		want  error
+	}{
+		{"page=0", listing.ErrInvalidPage},
+		{"page_size=abc", listing.ErrInvalidPage},
+		{"sort=-secret", listing.ErrInvalidSort},
+		{"filter[amount]=1", listing.ErrInvalidFilter},
+		{"cursor=%25%25", listing.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		if _, err := listing.ParseQuery(newContext(tt.query), spec); !errors.Is(err, tt.want) {
+			t.Errorf("ParseQuery(%q) error = %v, want %v", tt.query, err, tt.want)
+		}
+	}
+}
+
+func TestApply_SortAndPage(t *testing.T) {
+	q := listing.Query{Page: 1, PageSize: 2, SortField: "amount", Desc: true}
+
+	page := listing.Apply(testItems(), q, itemField)
+	if page.Total != 5 || page.Page != 1 || !equal(ids(page.Items), []string{"b", "c"}) {
+		t.Fatalf("第一页 = %v, total %d", ids(page.Items), page.Total)
+	}
+
+	// 相同金额按ID升序
+	q.Page = 2
+	page = listing.Apply(testItems(), q, itemField)
+	if !equal(ids(page.Items), []string{"d", "a"}) {
+		t.Errorf("第二页 = %v", ids(page.Items))
+	}
+
+	q.Page = 10
+	page = listing.Apply(testItems(), q, itemField)
+	if len(page.Items) != 0 || page.NextCursor != "" {
+		t.Errorf("越界页应为空: %v", ids(page.Items))
+	}
+}
+
+func TestApply_Filter(t *testing.T) {
+	q := listing.Query{Page: 1, PageSize: 10, SortField: "id", Filters: map[string]string{"tags": "red"}}
+	page := listing.Apply(testItems(), q, itemField)
+	if page.Total != 2 || !equal(ids(page.Items), []string{"a", "c"}) {
+		t.Errorf("按标签过滤 = %v", ids(page.Items))
+	}
+
+	q.Filters = map[string]string{"name": "y"}
+	page = listing.Apply(testItems(), q, itemField)
+	if !equal(ids(page.Items), []string{"b", "e"}) {
+		t.Errorf("按名称过滤 = %v", ids(page.Items))
+	}
+}
+
+func TestApply_Cursor(t *testing.T) {
+	items := testItems()
+	q := listing.Query{Page: 1, PageSize: 2, SortField: "amount", Desc: true}
+
+	var seen []string
+	for i := 0; i < 5; i++ {
+		page := listing.Apply(items, q, itemField)
+		seen = append(seen, ids(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err := listing.DecodeCursor(page.NextCursor)
+		if err != nil {
+			t.Fatalf("DecodeCursor() error = %v", err)
+		}
+		q.Cursor = cursor
+
+		// 翻页过程中插入排在前面的数据不影响后续页
+		items = append(items, &item{ID: "z", Amount: 100})
+	}
+
+	if !equal(seen, []string{"b", "c", "d", "a", "e"}) {
+		t.Errorf("游标翻页结果 = %v", seen)
+	}
+}
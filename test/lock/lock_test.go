@@ -0,0 +1,208 @@
+package lock_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/lock"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakelock"
+)
+
+func newLocker(nodes []redis.Cmdable, ttl time.Duration) *lock.Locker {
+	return lock.NewLocker(config.LockConfig{TTL: ttl}, nodes, logger.NewLogger(zap.NewNop()))
+}
+
+func TestTryAcquire_Exclusive(t *testing.T) {
+	_, nodes := fakelock.NewNodes(3)
+	a, b := newLocker(nodes, time.Second), newLocker(nodes, time.Second)
+	ctx := context.Background()
+
+	lease, err := a.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+	if _, err := b.TryAcquire(ctx, "job"); !errors.Is(err, lock.ErrNotAcquired) {
+		t.Fatalf("锁被持有时应返回ErrNotAcquired, got %v", err)
+	}
+	if other, err := b.TryAcquire(ctx, "other-job"); err != nil {
+		t.Fatalf("不同名称的锁互不影响: %v", err)
+	} else {
+		other.Release(ctx)
+	}
+
+	if err := lease.Release(ctx); err != nil {
+		t.Fatalf("释放锁失败: %v", err)
+	}
+	if lease.Context().Err() == nil {
+		t.Fatal("释放后租约的context应取消")
+	}
+	next, err := b.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("释放后应能重新加锁: %v", err)
+	}
+	defer next.Release(ctx)
+	if next.Token() <= lease.Token() {
+		t.Fatalf("后加锁的token应更大: %d <= %d", next.Token(), lease.Token())
+	}
+}
+
+func TestTryAcquire_Quorum(t *testing.T) {
+	fakes, nodes := fakelock.NewNodes(3)
+	locker := newLocker(nodes, time.Second)
+	ctx := context.Background()
+
+	fakes[0].SetDown(true)
+	lease, err := locker.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("多数节点可用时应能加锁: %v", err)
+	}
+	lease.Release(ctx)
+
+	fakes[1].SetDown(true)
+	_, err = locker.TryAcquire(ctx, "job")
+	if err == nil || errors.Is(err, lock.ErrNotAcquired) {
+		t.Fatalf("多数节点不可用时应返回节点错误, got %v", err)
+	}
+}
+
+func TestTryAcquire_MinorityHeld(t *testing.T) {
+	fakes, nodes := fakelock.NewNodes(3)
+	ctx := context.Background()
+
+	// 其他实例只在一个节点上持有锁，多数派仍可加锁
+	fakes[0].Steal("lock:{job}")
+	lease, err := newLocker(nodes, time.Second).TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("少数节点被持有时应能加锁: %v", err)
+	}
+	lease.Release(ctx)
+
+	// 两个节点被持有时加锁失败，且已加锁的节点被释放
+	fakes[1].Steal("lock:{job}")
+	if _, err := newLocker(nodes, time.Second).TryAcquire(ctx, "job"); !errors.Is(err, lock.ErrNotAcquired) {
+		t.Fatalf("多数节点被持有时应返回ErrNotAcquired, got %v", err)
+	}
+	if fakes[2].Held("lock:{job}") {
+		t.Fatal("加锁失败时应释放已加锁的节点")
+	}
+}
+
+func TestToken_MonotonicAcrossQuorums(t *testing.T) {
+	fakes, nodes := fakelock.NewNodes(3)
+	locker := newLocker(nodes, time.Second)
+	ctx := context.Background()
+
+	// 每次有一个节点不可用，多数派轮换
+	var last int64
+	for i := 0; i < 9; i++ {
+		for j, f := range fakes {
+			f.SetDown(j == i%3)
+		}
+		lease, err := locker.TryAcquire(ctx, "job")
+		if err != nil {
+			t.Fatalf("第%d次加锁失败: %v", i, err)
+		}
+		if lease.Token() <= last {
+			t.Fatalf("第%d次加锁的token未递增: %d <= %d", i, lease.Token(), last)
+		}
+		last = lease.Token()
+		lease.Release(ctx)
+	}
+}
+
+func TestLease_Renewal(t *testing.T) {
+	_, nodes := fakelock.NewNodes(3)
+	ttl := 150 * time.Millisecond
+	ctx := context.Background()
+
+	lease, err := newLocker(nodes, ttl).TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("加锁失败: %v", err)
+	}
+	defer lease.Release(ctx)
+
+	time.Sleep(3 * ttl)
+	if err := lease.Context().Err(); err != nil {
+		t.Fatalf("续期期间租约不应失效: %v", err)
+	}
+	if _, err := newLocker(nodes, ttl).TryAcquire(ctx, "job"); !errors.Is(err, lock.ErrNotAcquired) {
+		t.Fatalf("超过TTL后锁仍应被持有, got %v", err)
+	}
+}
+
+func TestLease_Lost(t *testing.T) {
+	fakes, nodes := fakelock.NewNodes(3)
+	ttl := 150 * time.Millisecond
+	locker := newLocker(nodes, ttl)
+
+	err := locker.Do(context.Background(), "job", func(ctx context.Context) error {
+		fakes[0].Steal("lock:{job}")
+		fakes[1].Steal("lock:{job}")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * ttl):
+			return errors.New("租约失效后context未取消")
+		}
+	})
+	if !errors.Is(err, lock.ErrLeaseLost) {
+		t.Fatalf("租约失效时应返回ErrLeaseLost, got %v", err)
+	}
+}
+
+func TestDo(t *testing.T) {
+	_, nodes := fakelock.NewNodes(1)
+	locker := newLocker(nodes, time.Second)
+	ctx := context.Background()
+
+	var running, maxRunning, runs int64
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := locker.Do(ctx, "job", func(ctx context.Context) error {
+				if _, ok := lock.TokenFrom(ctx); !ok {
+					t.Error("context中应有token")
+				}
+				n := atomic.AddInt64(&running, 1)
+				for {
+					m := atomic.LoadInt64(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt64(&maxRunning, m, n) {
+						break
+					}
+				}
+				atomic.AddInt64(&runs, 1)
+				time.Sleep(20 * time.Millisecond)
+				atomic.AddInt64(&running, -1)
+				return nil
+			})
+			if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+				t.Errorf("执行失败: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maxRunning != 1 || runs == 0 {
+		t.Fatalf("同时执行数 = %d, 执行次数 = %d", maxRunning, runs)
+	}
+
+	// 未配置分布式锁时直接执行
+	var nilLocker *lock.Locker
+	called := false
+	if err := nilLocker.Do(ctx, "job", func(ctx context.Context) error {
+		called = true
+		return nil
+	}); err != nil || !called {
+		t.Fatalf("nil Locker应直接执行, called=%v err=%v", called, err)
+	}
+}
@@ -0,0 +1,73 @@
+package logger_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"simple-dsp/pkg/logger"
+)
+
+func TestWith(t *testing.T) {
+	log, logs := newObservedLogger()
+
+	derived := log.With("request_id", "req-1", "exchange", "adx")
+	derived.Info("收到流量请求", "user_id", "u1")
+	log.Info("竞价成功")
+
+	entries := logs.All()
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["exchange"] != "adx" || fields["user_id"] != "u1" {
+		t.Fatalf("fields = %v", fields)
+	}
+	// 原记录器不受影响
+	if _, ok := entries[1].ContextMap()["request_id"]; ok {
+		t.Fatalf("原记录器不应带有派生字段: %v", entries[1].ContextMap())
+	}
+	if log.With() != log {
+		t.Fatal("没有字段时应返回原记录器")
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	log, logs := newObservedLogger()
+
+	ctx := logger.ContextWithFields(context.Background(), "request_id", "req-1")
+	ctx = logger.ContextWithFields(ctx, "trace_id", "t1")
+	log.WithContext(ctx).Warn("竞价处理超时")
+
+	fields := logs.All()[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["trace_id"] != "t1" {
+		t.Fatalf("fields = %v", fields)
+	}
+	if got := logger.FieldsFromContext(ctx); len(got) != 4 {
+		t.Fatalf("FieldsFromContext() = %v", got)
+	}
+	if log.WithContext(context.Background()) != log {
+		t.Fatal("上下文没有字段时应返回原记录器")
+	}
+}
+
+func TestCaller(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	log := logger.NewLogger(zap.New(core, zap.AddCaller()))
+
+	// 包装方法、派生记录器和内嵌的zap.Logger均指向调用方
+	log.Info("包装方法")
+	log.With("k", "v").Error("派生记录器")
+	log.WithContext(logger.ContextWithFields(context.Background(), "k", "v")).Debug("上下文记录器")
+	log.Logger.Info("内嵌记录器")
+	log.Logger.With(zap.String("k", "v")).Info("内嵌派生记录器")
+
+	for _, e := range logs.All() {
+		if !e.Caller.Defined || filepath.Base(e.Caller.File) != "context_test.go" {
+			t.Fatalf("%s: caller = %s", e.Message, e.Caller.String())
+		}
+	}
+	if logs.Len() != 5 {
+		t.Fatalf("logged = %d, want 5", logs.Len())
+	}
+}
@@ -0,0 +1,122 @@
+package logger_test
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+func newObservedLogger() (*logger.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.DebugLevel)
+	return logger.NewLogger(zap.New(core)), logs
+}
+
+func count(logs *observer.ObservedLogs, msg string) int {
+	return logs.FilterMessage(msg).Len()
+}
+
+func TestSamplingDisabledByDefault(t *testing.T) {
+	log, logs := newObservedLogger()
+	for i := 0; i < 50; i++ {
+		log.Info("收到流量请求", "i", i)
+	}
+	if n := count(logs, "收到流量请求"); n != 50 {
+		t.Fatalf("logged = %d, want 50", n)
+	}
+	if log.Dropped() != 0 {
+		t.Fatalf("dropped = %d, want 0", log.Dropped())
+	}
+}
+
+func TestSamplingFirstThereafter(t *testing.T) {
+	log, logs := newObservedLogger()
+	log.SetSampling(config.LogSamplingConfig{Enabled: true, First: 5, Thereafter: 10})
+
+	for i := 0; i < 100; i++ {
+		log.Info("请求处理完成")
+	}
+	// 前5条，之后第15、25...95条
+	if n := count(logs, "请求处理完成"); n != 5+9 {
+		t.Fatalf("logged = %d, want 14", n)
+	}
+	if log.Dropped() != 86 {
+		t.Fatalf("dropped = %d, want 86", log.Dropped())
+	}
+}
+
+func TestSamplingPerMessage(t *testing.T) {
+	log, logs := newObservedLogger()
+	log.SetSampling(config.LogSamplingConfig{
+		Enabled: true,
+		First:   100,
+		Messages: map[string]config.LogSampleRule{
+			"收到流量请求":     {Thereafter: 20},
+			"用户不符合RTA定向": {First: 1},
+		},
+	})
+
+	for i := 0; i < 100; i++ {
+		log.Info("收到流量请求")
+		log.Info("用户不符合RTA定向")
+		log.Info("竞价成功")
+	}
+	// 1 in 20
+	if n := count(logs, "收到流量请求"); n != 5 {
+		t.Fatalf("收到流量请求 = %d, want 5", n)
+	}
+	// Thereafter为0时只记录First条
+	if n := count(logs, "用户不符合RTA定向"); n != 1 {
+		t.Fatalf("用户不符合RTA定向 = %d, want 1", n)
+	}
+	// 其他消息使用默认规则
+	if n := count(logs, "竞价成功"); n != 100 {
+		t.Fatalf("竞价成功 = %d, want 100", n)
+	}
+}
+
+func TestSamplingAlwaysLogsErrors(t *testing.T) {
+	log, logs := newObservedLogger()
+	log.SetSampling(config.LogSamplingConfig{Enabled: true})
+
+	for i := 0; i < 10; i++ {
+		log.Info("竞价处理失败")
+		log.Error("竞价处理失败")
+	}
+	entries := logs.FilterMessage("竞价处理失败").All()
+	if len(entries) != 10 {
+		t.Fatalf("logged = %d, want 10", len(entries))
+	}
+	for _, e := range entries {
+		if e.Level != zap.ErrorLevel {
+			t.Fatalf("level = %v, want error", e.Level)
+		}
+	}
+}
+
+func TestSamplingRuntimeUpdate(t *testing.T) {
+	log, logs := newObservedLogger()
+	log.SetSampling(config.LogSamplingConfig{Enabled: true, First: 1})
+	log.Info("收到流量请求")
+
+	// 派生的Logger共享同一采样器
+	derived := log.Logger.With(zap.String("module", "traffic"))
+	derived.Info("收到流量请求")
+	if n := count(logs, "收到流量请求"); n != 1 {
+		t.Fatalf("logged = %d, want 1", n)
+	}
+
+	// 关闭采样后恢复全部记录
+	log.SetSampling(config.LogSamplingConfig{})
+	log.Info("收到流量请求")
+	derived.Info("收到流量请求")
+	if n := count(logs, "收到流量请求"); n != 3 {
+		t.Fatalf("logged = %d, want 3", n)
+	}
+	if got := log.Sampling(); got.Enabled {
+		t.Fatalf("Sampling() = %+v", got)
+	}
+}
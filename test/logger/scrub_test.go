@@ -0,0 +1,110 @@
+package logger_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+func newScrubbedLogger(t *testing.T, scrub config.LogScrubConfig) (*logger.Logger, *observer.ObservedLogs) {
+	t.Helper()
+	core, logs := observer.New(zap.DebugLevel)
+	log, err := logger.NewLoggerWithConfig(zap.New(core), config.LogConfig{Scrub: scrub})
+	if err != nil {
+		t.Fatalf("NewLoggerWithConfig() error = %v", err)
+	}
+	return log, logs
+}
+
+func TestScrubDefaultFields(t *testing.T) {
+	log, logs := newScrubbedLogger(t, config.LogScrubConfig{Enabled: true, Salt: "s1"})
+
+	log.Info("收到流量请求",
+		"request_id", "req-1",
+		"user_id", "user-12345",
+		"device_id", "6D92078A-8246-4BA4-AE5B-76104861E7DC",
+		"remote_addr", "203.0.113.77",
+		"ip", "2001:db8:85a3::8a2e:370:7334")
+	log.Info("收到流量请求", "user_id", "user-12345")
+
+	entries := logs.All()
+	first, second := entries[0].ContextMap(), entries[1].ContextMap()
+	if first["request_id"] != "req-1" {
+		t.Fatalf("非敏感字段不应脱敏: %v", first)
+	}
+	userHash, _ := first["user_id"].(string)
+	if len(userHash) != 16 || strings.Contains(userHash, "12345") {
+		t.Fatalf("user_id = %q", userHash)
+	}
+	// 同一值的哈希相同，便于关联同一用户的日志
+	if second["user_id"] != userHash {
+		t.Fatalf("user_id = %v, want %s", second["user_id"], userHash)
+	}
+	if first["device_id"] == "6D92078A-8246-4BA4-AE5B-76104861E7DC" {
+		t.Fatal("device_id未脱敏")
+	}
+	if first["remote_addr"] != "203.0.113.0" {
+		t.Fatalf("remote_addr = %v", first["remote_addr"])
+	}
+	if first["ip"] != "2001:db8:85a3::" {
+		t.Fatalf("ip = %v", first["ip"])
+	}
+
+	// 不同的盐得到不同的哈希
+	other, otherLogs := newScrubbedLogger(t, config.LogScrubConfig{Enabled: true, Salt: "s2"})
+	other.Info("收到流量请求", "user_id", "user-12345")
+	if otherLogs.All()[0].ContextMap()["user_id"] == userHash {
+		t.Fatal("不同的盐不应得到相同的哈希")
+	}
+}
+
+func TestScrubConfiguredFields(t *testing.T) {
+	log, logs := newScrubbedLogger(t, config.LogScrubConfig{
+		Enabled: true,
+		Fields:  map[string]string{"user_id": logger.ScrubMask, "client_ip": logger.ScrubMask},
+	})
+
+	// With附加的字段同样脱敏，非字符串值按字符串处理
+	derived := log.Logger.With(zap.String("client_ip", "198.51.100.9:8443"))
+	derived.Info("事件上报", zap.Int64("user_id", 1234567890), zap.String("device_id", "d1"))
+
+	fields := logs.All()[0].ContextMap()
+	if fields["client_ip"] != "198.51.100.0:8443" {
+		t.Fatalf("client_ip = %v", fields["client_ip"])
+	}
+	if fields["user_id"] != "12******90" {
+		t.Fatalf("user_id = %v", fields["user_id"])
+	}
+	// 未配置的字段不脱敏
+	if fields["device_id"] != "d1" {
+		t.Fatalf("device_id = %v", fields["device_id"])
+	}
+}
+
+func TestScrubInvalidConfig(t *testing.T) {
+	core, _ := observer.New(zap.DebugLevel)
+
+	_, err := logger.NewLoggerWithConfig(zap.New(core), config.LogConfig{Scrub: config.LogScrubConfig{Enabled: true}})
+	if !errors.Is(err, logger.ErrScrubSaltRequired) {
+		t.Fatalf("err = %v, want ErrScrubSaltRequired", err)
+	}
+
+	_, err = logger.NewLoggerWithConfig(zap.New(core), config.LogConfig{Scrub: config.LogScrubConfig{
+		Enabled: true,
+		Fields:  map[string]string{"ip": "drop"},
+	}})
+	if !errors.Is(err, logger.ErrInvalidScrubMode) {
+		t.Fatalf("err = %v, want ErrInvalidScrubMode", err)
+	}
+
+	// 未启用时不校验
+	if _, err := logger.NewLoggerWithConfig(zap.New(core), config.LogConfig{}); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+}
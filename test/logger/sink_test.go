@@ -0,0 +1,171 @@
+package logger_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// ndjsonReceiver 模拟Fluentd/Vector的HTTP输入，记录收到的日志
+type ndjsonReceiver struct {
+	mu      sync.Mutex
+	records []map[string]interface{}
+	batches int
+}
+
+func (r *ndjsonReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Content-Type") != "application/x-ndjson" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches++
+	scanner := bufio.NewScanner(req.Body)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.records = append(r.records, record)
+	}
+}
+
+func newSinkLogger(t *testing.T, sink *logger.Sink) *zap.Logger {
+	t.Helper()
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	return zap.New(zapcore.NewCore(encoder, sink, zap.DebugLevel))
+}
+
+func TestSinkHTTP(t *testing.T) {
+	receiver := &ndjsonReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	sink, err := logger.NewSink(config.LogSinkConfig{
+		Type:          logger.SinkHTTP,
+		URL:           server.URL,
+		BatchSize:     4,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	log := newSinkLogger(t, sink)
+	for i := 0; i < 10; i++ {
+		log.Info("竞价成功", zap.Int("i", i))
+	}
+	if err := log.Sync(); err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.records) != 10 {
+		t.Fatalf("records = %d, want 10", len(receiver.records))
+	}
+	// 每批4条，Sync发送剩余的2条
+	if receiver.batches != 3 {
+		t.Fatalf("batches = %d, want 3", receiver.batches)
+	}
+	if receiver.records[9]["msg"] != "竞价成功" || receiver.records[9]["i"] != float64(9) {
+		t.Fatalf("record = %v", receiver.records[9])
+	}
+	if stats := sink.Stats(); stats.Sent != 10 || stats.Dropped != 0 || stats.Failed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestSinkDropsWhenBufferFull(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	sink, err := logger.NewSink(config.LogSinkConfig{
+		Type:          logger.SinkHTTP,
+		URL:           server.URL,
+		BufferSize:    5,
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Timeout:       200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewSink() error = %v", err)
+	}
+	log := newSinkLogger(t, sink)
+
+	// 写入不因发送阻塞而阻塞
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		log.Info("收到流量请求")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("写入耗时 %v，不应阻塞", elapsed)
+	}
+	if stats := sink.Stats(); stats.Dropped < 90 {
+		t.Fatalf("dropped = %d, want >= 90", stats.Dropped)
+	}
+
+	// 服务端不响应时发送超时计为失败
+	deadline := time.Now().Add(2 * time.Second)
+	for sink.Stats().Failed == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sink.Stats().Failed == 0 {
+		t.Fatal("发送超时应计为失败")
+	}
+}
+
+func TestSinkInvalidConfig(t *testing.T) {
+	cases := []config.LogSinkConfig{
+		{Type: "syslog"},
+		{Type: logger.SinkKafka, Topic: "dsp-logs"},
+		{Type: logger.SinkHTTP},
+	}
+	for _, cfg := range cases {
+		if _, err := logger.NewSink(cfg); !errors.Is(err, logger.ErrInvalidSink) {
+			t.Fatalf("NewSink(%+v) error = %v, want ErrInvalidSink", cfg, err)
+		}
+	}
+}
+
+func TestLoggerSinkStats(t *testing.T) {
+	server := httptest.NewServer(&ndjsonReceiver{})
+	defer server.Close()
+
+	log, err := logger.NewLoggerFromConfig(config.LogConfig{
+		Level: "info",
+		Sink:  config.LogSinkConfig{Enabled: true, Type: logger.SinkHTTP, URL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewLoggerFromConfig() error = %v", err)
+	}
+	log.Info("竞价成功")
+	log.Debug("低于日志级别")
+	log.Sync()
+
+	stats, ok := log.SinkStats()
+	if !ok || stats.Sent != 1 {
+		t.Fatalf("SinkStats() = %+v, %v", stats, ok)
+	}
+
+	// 未启用远程发送
+	if _, ok := logger.NewLogger(zap.NewNop()).SinkStats(); ok {
+		t.Fatal("未启用远程发送时ok应为false")
+	}
+}
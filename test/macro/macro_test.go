@@ -0,0 +1,87 @@
+package macro_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/macro"
+)
+
+func testValues() *macro.Values {
+	return &macro.Values{
+		ClickID:    "clk 1&x=2",
+		DeviceID:   "IMEI123",
+		CampaignID: "c1",
+		IP:         "10.0.0.1",
+		Time:       time.UnixMilli(1700000000123),
+	}
+}
+
+func TestExpand(t *testing.T) {
+	expander, err := macro.NewExpander([]string{"CLICK_ID", "DEVICE_ID_MD5", "CAMPAIGN_ID", "TS", "IP"})
+	if err != nil {
+		t.Fatalf("NewExpander: %v", err)
+	}
+
+	got := expander.Expand("https://t.example.com/c?cid={CAMPAIGN_ID}&click={CLICK_ID}&did={DEVICE_ID_MD5}&ts={TS}&ip={IP}", testValues())
+
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatalf("替换结果不是合法URL: %v", err)
+	}
+	q := u.Query()
+	sum := md5.Sum([]byte("IMEI123"))
+	want := map[string]string{
+		"cid":   "c1",
+		"click": "clk 1&x=2",
+		"did":   hex.EncodeToString(sum[:]),
+		"ts":    strconv.FormatInt(1700000000123, 10),
+		"ip":    "10.0.0.1",
+	}
+	for k, v := range want {
+		if q.Get(k) != v {
+			t.Errorf("%s = %q, want %q", k, q.Get(k), v)
+		}
+	}
+	if q.Has("x") {
+		t.Error("宏的值未编码，注入了额外参数")
+	}
+}
+
+func TestDefaultAllowlistExcludesIP(t *testing.T) {
+	expander, err := macro.NewExpander(nil)
+	if err != nil {
+		t.Fatalf("NewExpander: %v", err)
+	}
+
+	got := expander.Expand("https://t.example.com/c?cid={CAMPAIGN_ID}&ip={IP}", testValues())
+	if want := "https://t.example.com/c?cid=c1&ip="; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestUnknownTokensPreserved(t *testing.T) {
+	expander, _ := macro.NewExpander(nil)
+
+	raw := "https://t.example.com/{path}/c?x={OTHER}"
+	if got := expander.Expand(raw, testValues()); got != raw {
+		t.Fatalf("got %q, want %q", got, raw)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := macro.Validate("https://t.example.com/c?click={CLICK_ID}&ts={TS}"); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if err := macro.Validate("https://t.example.com/c?click={CLICKID}"); !errors.Is(err, macro.ErrUnknownMacro) {
+		t.Fatalf("err = %v, want ErrUnknownMacro", err)
+	}
+	if _, err := macro.NewExpander([]string{"CLICK_ID", "EMAIL"}); !errors.Is(err, macro.ErrUnknownMacro) {
+		t.Fatalf("err = %v, want ErrUnknownMacro", err)
+	}
+}
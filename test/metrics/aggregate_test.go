@@ -0,0 +1,81 @@
+package metrics_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+// get 读取指标路径的响应
+func get(t *testing.T, port int, path string) string {
+	t.Helper()
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", port, path))
+	if err != nil {
+		t.Fatalf("GET %s error = %v", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", path, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestRegisterAggregate(t *testing.T) {
+	port := freePort(t)
+	cfg := config.MetricsConfig{Enabled: true, HTTPEnabled: true, Port: port, Instance: "i1"}
+	m, err := metrics.Bootstrap(cfg, "admin-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+	m.Bid.Requests.Inc()
+
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "dsp_dashboard_spend", Help: "当天的消耗"})
+	gauge.Set(12.5)
+	if err := m.RegisterAggregate(gauge); err != nil {
+		t.Fatalf("RegisterAggregate() error = %v", err)
+	}
+	if err := m.RegisterAggregate(gauge); err == nil {
+		t.Fatal("重复注册应返回错误")
+	}
+
+	// 预聚合指标只带service标签，不包含原始指标和运行时指标
+	aggregate := get(t, port, "/metrics/aggregate")
+	if want := `dsp_dashboard_spend{service="admin-server"} 12.5`; !strings.Contains(aggregate, want) {
+		t.Fatalf("预聚合指标缺少 %s:\n%s", want, aggregate)
+	}
+	if strings.Contains(aggregate, "dsp_bid_requests_total") || strings.Contains(aggregate, "go_goroutines") {
+		t.Fatalf("预聚合指标不应包含原始指标:\n%s", aggregate)
+	}
+
+	// 原始指标路径不包含预聚合指标
+	if raw := get(t, port, "/metrics"); strings.Contains(raw, "dsp_dashboard_spend") {
+		t.Fatal("原始指标不应包含预聚合指标")
+	}
+}
+
+func TestAggregatePath(t *testing.T) {
+	port := freePort(t)
+	cfg := config.MetricsConfig{Enabled: true, HTTPEnabled: true, Port: port, Path: "/raw", AggregatePath: "/grafana", Instance: "i1"}
+	m, err := metrics.Bootstrap(cfg, "admin-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+	get(t, port, "/grafana")
+
+	// 与原始指标路径相同时返回错误
+	cfg.Port = freePort(t)
+	cfg.AggregatePath = "/raw"
+	if _, err := metrics.Bootstrap(cfg, "admin-server"); err == nil {
+		t.Fatal("预聚合指标路径与指标路径相同时应返回错误")
+	}
+}
@@ -0,0 +1,212 @@
+package metrics_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+// freePort 返回一个空闲端口
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestBootstrapDisabled(t *testing.T) {
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+
+	// 未启用时仍可记录指标，不会空指针
+	m.Bid.Requests.Inc()
+	m.RecordHTTPRequest("GET", "/", "200", 0.01)
+
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	found := false
+	for _, mf := range families {
+		if mf.GetName() != "dsp_bid_requests_total" {
+			continue
+		}
+		found = true
+		labels := map[string]string{}
+		for _, lp := range mf.GetMetric()[0].GetLabel() {
+			labels[lp.GetName()] = lp.GetValue()
+		}
+		if labels["service"] != "dsp-server" || labels["instance"] != "i1" {
+			t.Fatalf("labels = %v", labels)
+		}
+	}
+	if !found {
+		t.Fatal("缺少dsp_bid_requests_total")
+	}
+}
+
+func TestBootstrapTwice(t *testing.T) {
+	// 每次使用独立注册表，同一进程内多次初始化不会重复注册
+	for _, service := range []string{"dsp-server", "admin-server"} {
+		m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, service)
+		if err != nil {
+			t.Fatalf("Bootstrap(%s) error = %v", service, err)
+		}
+		m.Close()
+	}
+
+	if _, err := metrics.Bootstrap(config.MetricsConfig{}, ""); !errors.Is(err, metrics.ErrServiceRequired) {
+		t.Fatalf("err = %v, want ErrServiceRequired", err)
+	}
+}
+
+func TestBootstrapServesHTTP(t *testing.T) {
+	port := freePort(t)
+	cfg := config.MetricsConfig{Enabled: true, HTTPEnabled: true, Port: port, Path: "/metrics", Instance: "i1"}
+
+	m, err := metrics.Bootstrap(cfg, "admin-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+	m.Bid.Requests.Inc()
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	want := `dsp_bid_requests_total{instance="i1",service="admin-server"} 1`
+	if !strings.Contains(string(body), want) {
+		t.Fatalf("响应缺少 %s", want)
+	}
+	if !strings.Contains(string(body), "go_goroutines") {
+		t.Fatal("响应缺少Go运行时指标")
+	}
+
+	// 端口被占用时返回错误
+	if _, err := metrics.Bootstrap(cfg, "dsp-server"); err == nil {
+		t.Fatal("端口被占用时应返回错误")
+	}
+}
+
+func TestBootstrapAccessControl(t *testing.T) {
+	port := freePort(t)
+	m, err := metrics.Bootstrap(config.MetricsConfig{Enabled: true, HTTPEnabled: true, Port: port, Instance: "i1"}, "admin-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+
+	status := func() int {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", port))
+		if err != nil {
+			t.Fatalf("GET /metrics error = %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	m.SetAccessControl(func(*http.Request) bool { return false })
+	if code := status(); code != http.StatusForbidden {
+		t.Fatalf("拒绝访问时 = %d, want 403", code)
+	}
+	// 取消限制后恢复访问
+	m.SetAccessControl(nil)
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("取消限制后 = %d, want 200", code)
+	}
+}
+
+// pushGateway 记录收到的推送请求
+type pushGateway struct {
+	mu       sync.Mutex
+	requests []string
+	bodies   []string
+}
+
+func (g *pushGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	g.mu.Lock()
+	g.requests = append(g.requests, r.Method+" "+r.URL.Path)
+	g.bodies = append(g.bodies, string(body))
+	g.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *pushGateway) snapshot() ([]string, []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string(nil), g.requests...), append([]string(nil), g.bodies...)
+}
+
+func TestBootstrapPushGateway(t *testing.T) {
+	gateway := &pushGateway{}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+
+	cfg := config.MetricsConfig{
+		Enabled:      true,
+		PushGateway:  server.URL,
+		PushInterval: 10 * time.Millisecond,
+		PushJitter:   0.5,
+		Instance:     "i1",
+	}
+	m, err := metrics.Bootstrap(cfg, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	m.Bid.Requests.Inc()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if requests, _ := gateway.snapshot(); len(requests) >= 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("未收到推送")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// 按job和instance分组推送，instance由分组键提供而不是指标标签
+	requests, bodies := gateway.snapshot()
+	const group = "/metrics/job/dsp-server/instance/i1"
+	for i, req := range requests[:len(requests)-1] {
+		if req != http.MethodPut+" "+group {
+			t.Fatalf("request[%d] = %s, want PUT %s", i, req, group)
+		}
+	}
+	if !strings.Contains(bodies[0], "dsp_bid_requests_total") {
+		t.Fatal("推送内容缺少dsp_bid_requests_total")
+	}
+
+	// 关闭时删除本实例的分组，之后不再推送
+	if last := requests[len(requests)-1]; last != http.MethodDelete+" "+group {
+		t.Fatalf("last request = %s, want DELETE %s", last, group)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if after, _ := gateway.snapshot(); len(after) != len(requests) {
+		t.Fatalf("关闭后仍在推送: %v", after[len(requests):])
+	}
+}
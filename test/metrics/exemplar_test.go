@@ -0,0 +1,91 @@
+package metrics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	cases := map[string]string{
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01": "",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": "",
+		"00-4bf92f3577b34da6a3ce929d0e0e47zz-00f067aa0ba902b7-01": "",
+		"00-4bf92f35-01": "",
+		"":               "",
+	}
+	for header, want := range cases {
+		if got := metrics.ParseTraceparent(header); got != want {
+			t.Errorf("ParseTraceparent(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestObserveWithTrace(t *testing.T) {
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+
+	ctx := metrics.WithTraceID(context.Background(), "req-1")
+	metrics.ObserveWithTrace(ctx, m.Bid.Duration, 0.02)
+	// 没有追踪ID或追踪ID过长时只记录观测值
+	metrics.ObserveWithTrace(context.Background(), m.Bid.Duration, 0.02)
+	metrics.ObserveWithTrace(metrics.WithTraceID(context.Background(), strings.Repeat("x", 200)), m.Bid.Duration, 0.02)
+
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	var exemplars []string
+	for _, mf := range families {
+		if mf.GetName() != "dsp_bid_duration_seconds" {
+			continue
+		}
+		h := mf.GetMetric()[0].GetHistogram()
+		if h.GetSampleCount() != 3 {
+			t.Fatalf("count = %d, want 3", h.GetSampleCount())
+		}
+		for _, b := range h.GetBucket() {
+			if e := b.GetExemplar(); e != nil {
+				for _, lp := range e.GetLabel() {
+					exemplars = append(exemplars, lp.GetName()+"="+lp.GetValue())
+				}
+			}
+		}
+	}
+	if len(exemplars) != 1 || exemplars[0] != "trace_id=req-1" {
+		t.Fatalf("exemplars = %v, want [trace_id=req-1]", exemplars)
+	}
+}
+
+func TestObserveBidSLO(t *testing.T) {
+	m := &metrics.Metrics{Bid: &metrics.BidMetrics{
+		SLO: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "slo"}, []string{"budget", "result"}),
+	}}
+
+	m.ObserveBidSLO(30 * time.Millisecond)
+	m.ObserveBidSLO(80 * time.Millisecond)
+	m.ObserveBidSLO(150 * time.Millisecond)
+
+	want := map[[2]string]float64{
+		{"50ms", metrics.SLOResultMet}:     1,
+		{"50ms", metrics.SLOResultMissed}:  2,
+		{"100ms", metrics.SLOResultMet}:    2,
+		{"100ms", metrics.SLOResultMissed}: 1,
+	}
+	for labels, n := range want {
+		if got := testutil.ToFloat64(m.Bid.SLO.WithLabelValues(labels[0], labels[1])); got != n {
+			t.Errorf("%v = %v, want %v", labels, got, n)
+		}
+	}
+}
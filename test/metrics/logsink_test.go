@@ -0,0 +1,64 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func TestRegisterLogSink(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	log, err := logger.NewLoggerFromConfig(config.LogConfig{
+		Level: "info",
+		Sink:  config.LogSinkConfig{Enabled: true, Type: logger.SinkHTTP, URL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewLoggerFromConfig() error = %v", err)
+	}
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	defer m.Close()
+	if err := m.RegisterLogSink(log); err != nil {
+		t.Fatalf("RegisterLogSink() error = %v", err)
+	}
+
+	log.Info("竞价成功")
+	log.Info("竞价成功")
+	log.Sync()
+
+	families, err := m.Registry().Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	values := map[string]float64{}
+	for _, mf := range families {
+		if mf.GetName() != "dsp_log_sink_records_total" {
+			continue
+		}
+		for _, metric := range mf.GetMetric() {
+			for _, lp := range metric.GetLabel() {
+				if lp.GetName() == "result" {
+					values[lp.GetValue()] = metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	if values["sent"] != 2 || values["dropped"] != 0 || values["failed"] != 0 || len(values) != 3 {
+		t.Fatalf("dsp_log_sink_records_total = %v", values)
+	}
+
+	// 未启用远程发送时不注册
+	if err := m.RegisterLogSink(logger.NewLogger(zap.NewNop())); err != nil {
+		t.Fatalf("RegisterLogSink() error = %v", err)
+	}
+}
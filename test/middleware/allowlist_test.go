@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/middleware"
+)
+
+// fromAddr 构造来自指定直连地址的请求，forwarded非空时设置X-Forwarded-For
+func fromAddr(remote, forwarded string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/system/status", nil)
+	req.RemoteAddr = remote
+	if forwarded != "" {
+		req.Header.Set("X-Forwarded-For", forwarded)
+	}
+	return req
+}
+
+func newAllowlist(t *testing.T, cfg config.IPAllowlistConfig) *middleware.IPAllowlist {
+	t.Helper()
+	allowlist, err := middleware.NewIPAllowlist(cfg)
+	if err != nil {
+		t.Fatalf("NewIPAllowlist() error = %v", err)
+	}
+	return allowlist
+}
+
+func TestIPAllowlist_CIDRs(t *testing.T) {
+	allowlist := newAllowlist(t, config.IPAllowlistConfig{
+		Enabled: true,
+		CIDRs:   []string{"10.0.0.0/8", "192.168.1.5", "2001:db8::/32"},
+	})
+
+	tests := []struct {
+		remote string
+		want   bool
+	}{
+		{"10.1.2.3:5000", true},
+		{"[::ffff:10.1.2.3]:5000", true}, // IPv4映射的IPv6地址按IPv4匹配
+		{"192.168.1.5:80", true},
+		{"192.168.1.6:80", false},
+		{"[2001:db8::1]:443", true},
+		{"[2001:db9::1]:443", false},
+		{"8.8.8.8:53", false},
+		{"bad-addr", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.Allow(fromAddr(tt.remote, "")); got != tt.want {
+			t.Errorf("Allow(%s) = %v, want %v", tt.remote, got, tt.want)
+		}
+	}
+}
+
+func TestIPAllowlist_Disabled(t *testing.T) {
+	// 未启用时全部允许；启用且网段为空时全部拒绝
+	if !newAllowlist(t, config.IPAllowlistConfig{CIDRs: []string{"10.0.0.0/8"}}).Allow(fromAddr("8.8.8.8:53", "")) {
+		t.Fatal("未启用时应允许所有请求")
+	}
+	if newAllowlist(t, config.IPAllowlistConfig{Enabled: true}).Allow(fromAddr("127.0.0.1:80", "")) {
+		t.Fatal("启用且网段为空时应拒绝所有请求")
+	}
+}
+
+func TestIPAllowlist_Forwarded(t *testing.T) {
+	allowlist := newAllowlist(t, config.IPAllowlistConfig{
+		Enabled:        true,
+		CIDRs:          []string{"10.0.0.0/8"},
+		TrustedProxies: []string{"172.16.0.0/12"},
+	})
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      bool
+	}{
+		// 直连地址不是可信代理时忽略X-Forwarded-For，防止伪造
+		{"不可信的直连地址伪造来源", "8.8.8.8:1000", "10.0.0.1", false},
+		{"经过可信代理的内网客户端", "172.16.0.1:1000", "10.0.0.1", true},
+		// 由右向左取第一个不可信的地址，客户端自行添加的左侧地址无效
+		{"客户端在左侧伪造内网地址", "172.16.0.1:1000", "10.0.0.1, 8.8.8.8", false},
+		{"经过多层可信代理", "172.16.0.1:1000", "10.0.0.1, 172.16.0.2", true},
+		{"无法解析的转发地址", "172.16.0.1:1000", "unknown", false},
+		{"可信代理自身的请求", "172.16.0.1:1000", "", false},
+	}
+	for _, tt := range tests {
+		if got := allowlist.Allow(fromAddr(tt.remote, tt.forwarded)); got != tt.want {
+			t.Errorf("%s: Allow() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIPAllowlist_Update(t *testing.T) {
+	allowlist := newAllowlist(t, config.IPAllowlistConfig{Enabled: true, CIDRs: []string{"10.0.0.0/8"}})
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(allowlist.Handler())
+	router.GET("/api/v1/admin/system/status", func(c *gin.Context) { c.Status(http.StatusOK) })
+	serve := func(remote string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, fromAddr(remote, ""))
+		return w.Code
+	}
+
+	if code := serve("192.168.0.1:80"); code != http.StatusForbidden {
+		t.Fatalf("不在白名单中 = %d, want 403", code)
+	}
+
+	// 运行时替换规则后立即生效
+	if err := allowlist.Update(config.IPAllowlistConfig{Enabled: true, CIDRs: []string{"192.168.0.0/16"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if serve("192.168.0.1:80") != http.StatusOK || serve("10.0.0.1:80") != http.StatusForbidden {
+		t.Fatal("替换后的规则未生效")
+	}
+
+	// 无效的规则不生效，保留原规则
+	if err := allowlist.Update(config.IPAllowlistConfig{Enabled: true, CIDRs: []string{"10.0.0.0/40"}}); err == nil {
+		t.Fatal("无效的网段应返回错误")
+	}
+	if code := serve("192.168.0.1:80"); code != http.StatusOK {
+		t.Fatalf("无效的规则不应替换原规则, 请求 = %d", code)
+	}
+}
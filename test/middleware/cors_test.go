@@ -0,0 +1,130 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/middleware"
+)
+
+// newCORSRouter 返回注册了跨域中间件和一个管理接口的路由
+func newCORSRouter(cfg config.CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.CORS(cfg))
+	router.GET("/api/v1/admin/system/status", func(c *gin.Context) {
+		c.Header("X-Request-ID", "r1")
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+	return router
+}
+
+func corsRequest(router *gin.Engine, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/v1/admin/system/status", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORS_Defaults(t *testing.T) {
+	// 未配置允许的来源时不返回CORS响应头，预检请求被拒绝
+	router := newCORSRouter(config.CORSConfig{})
+
+	w := corsRequest(router, http.MethodGet, "https://console.example.com", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("未允许的来源 = %d, Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Vary") != "Origin" {
+		t.Fatalf("Vary = %q, want Origin", w.Header().Get("Vary"))
+	}
+	w = corsRequest(router, http.MethodOptions, "https://console.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("未允许来源的预检请求 = %d, want 403", w.Code)
+	}
+
+	// 同源请求不受影响
+	if w := corsRequest(router, http.MethodGet, "", nil); w.Code != http.StatusOK {
+		t.Fatalf("同源请求 = %d, want 200", w.Code)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	router := newCORSRouter(config.CORSConfig{
+		AllowedOrigins:   []string{"https://console.example.com", "https://*.dsp.example.com"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Tenant"},
+		ExposedHeaders:   []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+
+	// 预检请求不需要对应的OPTIONS路由
+	w := corsRequest(router, http.MethodOptions, "https://console.example.com", map[string]string{
+		"Access-Control-Request-Method":  "DELETE",
+		"Access-Control-Request-Headers": "authorization, x-tenant",
+	})
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("预检请求 = %d, want 204", w.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://console.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST, PUT, DELETE",
+		"Access-Control-Allow-Headers":     "Content-Type, Authorization, X-Tenant",
+		"Access-Control-Max-Age":           "3600",
+	}
+	for k, v := range want {
+		if got := w.Header().Get(k); got != v {
+			t.Fatalf("%s = %q, want %q", k, got, v)
+		}
+	}
+
+	// 方法或请求头不允许时拒绝
+	w = corsRequest(router, http.MethodOptions, "https://console.example.com", map[string]string{"Access-Control-Request-Method": "PATCH"})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("不允许的方法 = %d, want 403", w.Code)
+	}
+	w = corsRequest(router, http.MethodOptions, "https://console.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "X-Debug",
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("不允许的请求头 = %d, want 403", w.Code)
+	}
+
+	// 实际请求返回来源和可读取的响应头
+	w = corsRequest(router, http.MethodGet, "https://eu.dsp.example.com", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "https://eu.dsp.example.com" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Fatalf("子域名的请求 = %d, headers %v", w.Code, w.Header())
+	}
+
+	// 子域名通配不匹配主域名和其他协议
+	for _, origin := range []string{"https://dsp.example.com", "http://eu.dsp.example.com", "https://evildsp.example.com"} {
+		if w := corsRequest(router, http.MethodGet, origin, nil); w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("%s 不应被允许", origin)
+		}
+	}
+}
+
+func TestCORS_Wildcard(t *testing.T) {
+	// 允许所有来源且不携带认证信息时返回*
+	router := newCORSRouter(config.CORSConfig{AllowedOrigins: []string{"*"}})
+	w := corsRequest(router, http.MethodGet, "https://any.example.org", nil)
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Fatalf("Allow-Origin = %q, want *", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Fatalf("Allow-Credentials = %q, want empty", got)
+	}
+}
@@ -0,0 +1,216 @@
+package middleware_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/middleware"
+)
+
+func newMetrics(t *testing.T) *metrics.Metrics {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+// blockingServer 请求在release关闭前不返回
+type blockingServer struct {
+	router  *gin.Engine
+	release chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBlockingServer(limiter *middleware.InFlightLimiter) *blockingServer {
+	gin.SetMode(gin.TestMode)
+	s := &blockingServer{router: gin.New(), release: make(chan struct{})}
+	s.router.POST("/bid", limiter.Handler(), func(c *gin.Context) {
+		<-s.release
+		c.Status(http.StatusNoContent)
+	})
+	return s
+}
+
+func (s *blockingServer) do() *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/bid", nil))
+	return w
+}
+
+// start 在后台发送请求，结果写入返回的channel
+func (s *blockingServer) start() <-chan int {
+	result := make(chan int, 1)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		result <- s.do().Code
+	}()
+	return result
+}
+
+// waitGauge 等待指标达到期望值
+func waitGauge(t *testing.T, name string, get func() float64, want float64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for get() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %v, want %v", name, get(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestInFlightLimiter_Concurrency(t *testing.T) {
+	m := newMetrics(t)
+	limiter := middleware.NewInFlightLimiter(config.ConcurrencyConfig{MaxInFlight: 2, RetryAfter: 1500 * time.Millisecond}, m)
+	s := newBlockingServer(limiter)
+
+	first, second := s.start(), s.start()
+	waitGauge(t, "InFlight", func() float64 { return testutil.ToFloat64(m.HTTP.InFlight) }, 2)
+
+	// 并发已满且不排队时立即拒绝，Retry-After按秒向上取整
+	w := s.do()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("并发已满时 = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if got := testutil.ToFloat64(m.HTTP.Shed.WithLabelValues(middleware.ShedReasonConcurrency)); got != 1 {
+		t.Fatalf("Shed{concurrency} = %v, want 1", got)
+	}
+
+	close(s.release)
+	if <-first != http.StatusNoContent || <-second != http.StatusNoContent {
+		t.Fatal("已占用槽位的请求应正常处理")
+	}
+	s.wg.Wait()
+	if got := testutil.ToFloat64(m.HTTP.InFlight); got != 0 {
+		t.Fatalf("请求结束后InFlight = %v, want 0", got)
+	}
+	if w := s.do(); w.Code != http.StatusNoContent {
+		t.Fatalf("槽位释放后的请求 = %d", w.Code)
+	}
+}
+
+func TestInFlightLimiter_Queue(t *testing.T) {
+	m := newMetrics(t)
+	limiter := middleware.NewInFlightLimiter(config.ConcurrencyConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 5 * time.Second}, m)
+	s := newBlockingServer(limiter)
+
+	first := s.start()
+	waitGauge(t, "InFlight", func() float64 { return testutil.ToFloat64(m.HTTP.InFlight) }, 1)
+	queued := s.start()
+	waitGauge(t, "Queued", func() float64 { return testutil.ToFloat64(m.HTTP.Queued) }, 1)
+
+	// 队列已满时拒绝
+	if w := s.do(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("队列已满时 = %d, want 503", w.Code)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Shed.WithLabelValues(middleware.ShedReasonQueueFull)); got != 1 {
+		t.Fatalf("Shed{queue_full} = %v, want 1", got)
+	}
+
+	// 槽位释放后排队的请求继续处理
+	close(s.release)
+	if <-first != http.StatusNoContent || <-queued != http.StatusNoContent {
+		t.Fatal("排队的请求应在槽位释放后处理")
+	}
+	if got := testutil.ToFloat64(m.HTTP.Queued); got != 0 {
+		t.Fatalf("Queued = %v, want 0", got)
+	}
+}
+
+func TestInFlightLimiter_QueueTimeout(t *testing.T) {
+	m := newMetrics(t)
+	limiter := middleware.NewInFlightLimiter(config.ConcurrencyConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 20 * time.Millisecond}, m)
+	s := newBlockingServer(limiter)
+	defer close(s.release)
+
+	s.start()
+	waitGauge(t, "InFlight", func() float64 { return testutil.ToFloat64(m.HTTP.InFlight) }, 1)
+
+	start := time.Now()
+	if w := s.do(); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("排队超时 = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Fatalf("排队时间 = %v, 应等待到超时", elapsed)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Shed.WithLabelValues(middleware.ShedReasonQueueTimeout)); got != 1 {
+		t.Fatalf("Shed{queue_timeout} = %v, want 1", got)
+	}
+}
+
+func TestInFlightLimiter_CPU(t *testing.T) {
+	m := newMetrics(t)
+	limiter := middleware.NewInFlightLimiter(config.ConcurrencyConfig{
+		MaxInFlight:       1,
+		MaxQueue:          1,
+		QueueTimeout:      5 * time.Second,
+		CPUThreshold:      0.5,
+		CPUSampleInterval: time.Millisecond,
+	}, m)
+	var usage atomic.Uint64
+	setUsage := func(v float64) { usage.Store(math.Float64bits(v)) }
+	limiter.SetCPUSampler(func() float64 { return math.Float64frombits(usage.Load()) })
+	limiter.Start()
+	defer limiter.Stop()
+	s := newBlockingServer(limiter)
+	defer close(s.release)
+
+	// CPU使用率达到100%时超出阈值的比例为1，全部拒绝
+	setUsage(1)
+	waitGauge(t, "CPUUsage", limiter.CPUUsage, 1)
+	if w := s.do(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("CPU过载时 = %d, want 503", w.Code)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Shed.WithLabelValues(middleware.ShedReasonCPU)); got != 1 {
+		t.Fatalf("Shed{cpu} = %v, want 1", got)
+	}
+
+	// CPU低于阈值时正常处理
+	setUsage(0.2)
+	waitGauge(t, "CPUUsage", limiter.CPUUsage, 0.2)
+	s.start()
+	waitGauge(t, "InFlight", func() float64 { return testutil.ToFloat64(m.HTTP.InFlight) }, 1)
+
+	// 超过阈值但未被按比例拒绝的请求在并发已满时不排队
+	setUsage(0.5 + 1e-9)
+	waitGauge(t, "CPUUsage", limiter.CPUUsage, 0.5+1e-9)
+	if w := s.do(); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("CPU过载且并发已满时 = %d, want 503", w.Code)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Shed.WithLabelValues(middleware.ShedReasonConcurrency)); got != 1 {
+		t.Fatalf("Shed{concurrency} = %v, want 1", got)
+	}
+}
+
+func TestInFlightLimiter_Unlimited(t *testing.T) {
+	// 未设置并发上限和CPU阈值时不拒绝请求
+	limiter := middleware.NewInFlightLimiter(config.ConcurrencyConfig{}, nil)
+	limiter.Start()
+	defer limiter.Stop()
+	s := newBlockingServer(limiter)
+
+	results := make([]<-chan int, 10)
+	for i := range results {
+		results[i] = s.start()
+	}
+	close(s.release)
+	for _, result := range results {
+		if code := <-result; code != http.StatusNoContent {
+			t.Fatalf("未限制并发时 = %d", code)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package middleware_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/middleware"
+)
+
+var testLimits = config.RequestLimitsConfig{
+	Default: config.RequestLimitConfig{MaxBodyBytes: 32, ReadTimeout: time.Second},
+	Bid:     config.RequestLimitConfig{MaxBodyBytes: 8, ReadTimeout: 50 * time.Millisecond},
+}
+
+// newEchoRouter 返回按路由组限制请求的路由，处理函数返回读到的请求体，Content-Length放在响应头中
+func newEchoRouter(group string, m *metrics.Metrics) (*gin.Engine, *int) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	calls := new(int)
+	router.Any("/echo", middleware.RequestLimits(group, testLimits, m), func(c *gin.Context) {
+		*calls++
+		data, _ := io.ReadAll(c.Request.Body)
+		c.Header("X-Content-Length", strconv.FormatInt(c.Request.ContentLength, 10))
+		c.String(http.StatusOK, string(data))
+	})
+	return router, calls
+}
+
+// chunked 构造未声明长度的请求体，按分块传输处理
+func chunked(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/echo", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	return req
+}
+
+func TestRequestLimits_BodySize(t *testing.T) {
+	m := newMetrics(t)
+	router, calls := newEchoRouter(middleware.RouteGroupBid, m)
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// 声明的长度超过上限时不调用处理函数
+	w := serve(httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader("123456789")))
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Connection") != "close" {
+		t.Fatalf("Content-Length超过上限 = %d, Connection %q", w.Code, w.Header().Get("Connection"))
+	}
+
+	// 分块传输的请求体读到上限后拒绝
+	if w := serve(chunked("123456789")); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("分块传输超过上限 = %d, want 413", w.Code)
+	}
+	if *calls != 0 {
+		t.Fatalf("被拒绝的请求调用了处理函数 %d 次", *calls)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Rejected.WithLabelValues(middleware.RouteGroupBid, middleware.RejectReasonBodyTooLarge)); got != 2 {
+		t.Fatalf("Rejected{bid,body_too_large} = %v, want 2", got)
+	}
+
+	// 未超过上限的分块请求体完整交给处理函数，并补上长度
+	w = serve(chunked("12345678"))
+	if w.Code != http.StatusOK || w.Body.String() != "12345678" || w.Header().Get("X-Content-Length") != "8" {
+		t.Fatalf("分块传输未超过上限 = %d %q, Content-Length %q", w.Code, w.Body.String(), w.Header().Get("X-Content-Length"))
+	}
+
+	// 没有请求体的请求不受影响
+	if w := serve(httptest.NewRequest(http.MethodGet, "/echo", nil)); w.Code != http.StatusOK {
+		t.Fatalf("GET请求 = %d, want 200", w.Code)
+	}
+}
+
+func TestRequestLimits_GroupDefault(t *testing.T) {
+	// 事件路由组未单独配置，使用默认上限
+	router, _ := newEchoRouter(middleware.RouteGroupEvent, newMetrics(t))
+	body := strings.Repeat("x", 32)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body)))
+	if w.Code != http.StatusOK || w.Body.String() != body {
+		t.Fatalf("默认上限以内 = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/echo", strings.NewReader(body+"x")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("超过默认上限 = %d, want 413", w.Code)
+	}
+}
+
+func TestRequestLimits_ReadTimeout(t *testing.T) {
+	m := newMetrics(t)
+	router, calls := newEchoRouter(middleware.RouteGroupBid, m)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// 只发送部分请求体，模拟缓慢发送的客户端
+	start := time.Now()
+	fmt.Fprint(conn, "POST /echo HTTP/1.1\r\nHost: dsp\r\nContent-Length: 8\r\n\r\n1234")
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("ReadResponse() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("读取请求体超时 = %d, want 408", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("超时响应耗时 %v, want 约50ms", elapsed)
+	}
+	if *calls != 0 {
+		t.Fatalf("超时的请求调用了处理函数 %d 次", *calls)
+	}
+	if got := testutil.ToFloat64(m.HTTP.Rejected.WithLabelValues(middleware.RouteGroupBid, middleware.RejectReasonReadTimeout)); got != 1 {
+		t.Fatalf("Rejected{bid,read_timeout} = %v, want 1", got)
+	}
+}
@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"simple-dsp/pkg/middleware"
+	"simple-dsp/pkg/reqctx"
+)
+
+// newRequestContextRouter 返回注册了请求上下文中间件的路由，接口返回上下文中的取值
+func newRequestContextRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.RequestContext())
+	handler := func(c *gin.Context) {
+		ctx := c.Request.Context()
+		consent, _ := reqctx.ConsentFrom(ctx)
+		c.JSON(http.StatusOK, gin.H{
+			"request_id": reqctx.RequestID(ctx),
+			"exchange":   reqctx.Exchange(ctx),
+			"consent":    consent.Allowed(),
+		})
+	}
+	router.POST("/api/v1/traffic", handler)
+	router.POST("/api/v1/traffic/:exchange", handler)
+	return router
+}
+
+func TestRequestContext(t *testing.T) {
+	router := newRequestContextRouter()
+	tests := []struct {
+		name      string
+		path      string
+		headers   map[string]string
+		requestID string
+		body      string
+	}{
+		{
+			name:      "使用请求头中的请求ID和交易平台",
+			path:      "/api/v1/traffic",
+			headers:   map[string]string{"X-Request-ID": "r1", "X-Exchange-ID": "adx"},
+			requestID: "r1",
+			body:      `"exchange":"adx"`,
+		},
+		{
+			name:    "路径中的交易平台优先",
+			path:    "/api/v1/traffic/ssp",
+			headers: map[string]string{"X-Exchange-ID": "adx"},
+			body:    `"exchange":"ssp"`,
+		},
+		{
+			name:    "含有控制字符的请求ID被替换",
+			path:    "/api/v1/traffic",
+			headers: map[string]string{"X-Request-ID": "r1\tinjected"},
+			body:    `"consent":true`,
+		},
+		{
+			name:    "浏览器退出信号写入同意状态",
+			path:    "/api/v1/traffic",
+			headers: map[string]string{"Sec-GPC": "1"},
+			body:    `"consent":false`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get("X-Request-ID")
+			if tt.requestID != "" && requestID != tt.requestID {
+				t.Errorf("X-Request-ID = %s, want %s", requestID, tt.requestID)
+			}
+			if requestID == "" || strings.ContainsAny(requestID, "\t ") {
+				t.Errorf("X-Request-ID = %q, 应生成新的请求ID", requestID)
+			}
+			if !strings.Contains(w.Body.String(), `"request_id":"`+requestID+`"`) {
+				t.Errorf("上下文中的请求ID与响应头不一致, body = %s", w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %s, want 包含%s", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package pixel_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/pixel"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryStore 内存人群包，记录加入的用户和有效期
+type memoryStore struct {
+	mu      sync.Mutex
+	members map[string][]string
+	ttl     time.Duration
+	err     error
+}
+
+func (s *memoryStore) Members(ctx context.Context, segmentID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.members[segmentID], nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, segmentID string, users []string, ttl time.Duration) error {
+	return nil
+}
+
+func (s *memoryStore) Add(ctx context.Context, segmentID, userID string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.members[segmentID] = append(s.members[segmentID], userID)
+	s.ttl = ttl
+	return nil
+}
+
+func (s *memoryStore) Contains(ctx context.Context, segmentID, userID string) (bool, error) {
+	return false, nil
+}
+
+type pixelEnv struct {
+	router  *gin.Engine
+	store   *memoryStore
+	metrics *metrics.Metrics
+}
+
+func newPixelEnv(t *testing.T) *pixelEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	m := &metrics.Metrics{Events: &metrics.EventMetrics{
+		PixelHits: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "pixel_hits"}, []string{"result"}),
+	}}
+	store := &memoryStore{members: map[string][]string{}}
+	h := pixel.NewHandler(store, config.PixelConfig{}, logger.NewLogger(zap.NewNop()), m)
+
+	router := gin.New()
+	router.GET("/pixel/:advertiser", h.ServePixel)
+	router.GET("/pixel/:advertiser/tag.js", h.ServeTag)
+	return &pixelEnv{router: router, store: store, metrics: m}
+}
+
+func (e *pixelEnv) get(target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+func (e *pixelEnv) hits(result string) float64 {
+	return testutil.ToFloat64(e.metrics.Events.PixelHits.WithLabelValues(result))
+}
+
+func TestPixelRecordsVisitor(t *testing.T) {
+	env := newPixelEnv(t)
+
+	w := env.get("/pixel/adv1?uid=u1&a=visitors,cart", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" || w.Body.Len() == 0 {
+		t.Fatalf("code = %d, content-type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	for _, id := range []string{"pixel:adv1:visitors", "pixel:adv1:cart"} {
+		if got := env.store.members[id]; len(got) != 1 || got[0] != "u1" {
+			t.Errorf("%s = %v, want [u1]", id, got)
+		}
+	}
+	if env.store.ttl != pixel.DefaultMembershipTTL {
+		t.Errorf("ttl = %v, want %v", env.store.ttl, pixel.DefaultMembershipTTL)
+	}
+	if n := env.hits("recorded"); n != 1 {
+		t.Fatalf("recorded = %v, want 1", n)
+	}
+}
+
+func TestPixelCookie(t *testing.T) {
+	env := newPixelEnv(t)
+
+	// 没有访客ID时生成并写入Cookie，默认加入visitors
+	w := env.get("/pixel/adv1", nil)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != pixel.CookieName || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteNoneMode {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	uid := cookies[0].Value
+	if got := env.store.members["pixel:adv1:visitors"]; len(got) != 1 || got[0] != uid {
+		t.Fatalf("visitors = %v, want [%s]", got, uid)
+	}
+
+	// 再次访问沿用Cookie中的访客ID
+	w = env.get("/pixel/adv1", http.Header{"Cookie": {pixel.CookieName + "=" + uid}})
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("已有Cookie时不应重新写入")
+	}
+	if got := env.store.members["pixel:adv1:visitors"]; len(got) != 2 || got[1] != uid {
+		t.Fatalf("visitors = %v", got)
+	}
+}
+
+func TestPixelWithoutConsent(t *testing.T) {
+	env := newPixelEnv(t)
+
+	cases := []struct {
+		target string
+		header http.Header
+	}{
+		{"/pixel/adv1?uid=u1", http.Header{"Sec-Gpc": {"1"}}},
+		{"/pixel/adv1?uid=u1", http.Header{"Dnt": {"1"}}},
+		{"/pixel/adv1?uid=u1&gpc=1", nil},
+		{"/pixel/adv1?uid=u1&consent=0", nil},
+		{"/pixel/adv1?uid=u1&us_privacy=1YYN", nil},
+		{"/pixel/adv1?uid=u1&gdpr=1", nil},
+	}
+	for _, tc := range cases {
+		w := env.get(tc.target, tc.header)
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+			t.Errorf("%s: 未同意时也应返回像素, code = %d", tc.target, w.Code)
+		}
+		if len(w.Result().Cookies()) != 0 {
+			t.Errorf("%s: 未同意时不应写入Cookie", tc.target)
+		}
+	}
+	if len(env.store.members) != 0 {
+		t.Fatalf("未同意的访客不应被记录: %v", env.store.members)
+	}
+	if n := env.hits("no_consent"); n != float64(len(cases)) {
+		t.Fatalf("no_consent = %v, want %d", n, len(cases))
+	}
+
+	// 携带同意字符串时记录
+	env.get("/pixel/adv1?uid=u1&gdpr=1&gdpr_consent=CPXxRfAPXxRfAAfKABENB", nil)
+	env.get("/pixel/adv1?uid=u2&us_privacy=1YNN", nil)
+	if got := env.store.members["pixel:adv1:visitors"]; len(got) != 2 {
+		t.Fatalf("visitors = %v, want [u1 u2]", got)
+	}
+}
+
+func TestPixelInvalid(t *testing.T) {
+	env := newPixelEnv(t)
+
+	for _, target := range []string{
+		"/pixel/adv%201?uid=u1",
+		"/pixel/adv1?uid=u1&a=bad%20name",
+		"/pixel/adv1?uid=u1&a=a,b,c,d,e,f,g,h,i,j,k",
+	} {
+		if w := env.get(target, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: code = %d, want 400", target, w.Code)
+		}
+	}
+	if n := env.hits("invalid"); n != 3 {
+		t.Fatalf("invalid = %v, want 3", n)
+	}
+}
+
+func TestPixelStoreErrorStillServesGIF(t *testing.T) {
+	env := newPixelEnv(t)
+	env.store.err = errors.New("redis down")
+
+	if w := env.get("/pixel/adv1?uid=u1", nil); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "image/gif" {
+		t.Fatalf("code = %d, want 200 gif", w.Code)
+	}
+	if n := env.hits("error"); n != 1 {
+		t.Fatalf("error = %v, want 1", n)
+	}
+}
+
+func TestTag(t *testing.T) {
+	env := newPixelEnv(t)
+
+	w := env.get("/pixel/adv1/tag.js", nil)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/javascript") {
+		t.Fatalf("code = %d, content-type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{`"/pixel/adv1?"`, "data-audience", "data-gdpr-consent", "globalPrivacyControl"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("标签缺少 %s: %s", want, body)
+		}
+	}
+
+	if w := env.get("/pixel/adv%22/tag.js", nil); w.Code != http.StatusBadRequest {
+		t.Fatalf("code = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,229 @@
+package placement_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/placement"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/test/fakeredis"
+)
+
+// staticSource 返回固定的汇总结果，记录起始日期
+type staticSource struct {
+	rows  []placement.Stats
+	since string
+}
+
+func (s *staticSource) Aggregate(ctx context.Context, since string) ([]placement.Stats, error) {
+	s.since = since
+	rows := make([]placement.Stats, len(s.rows))
+	copy(rows, s.rows)
+	return rows, nil
+}
+
+func row(exchange, slotID, size string, bids, wins, imps, clicks, conversions int64) placement.Stats {
+	return placement.Stats{
+		Key:         placement.Key{Exchange: exchange, Placement: slotID, Size: size},
+		Bids:        bids,
+		Wins:        wins,
+		Impressions: imps,
+		Clicks:      clicks,
+		Conversions: conversions,
+	}
+}
+
+var testConfig = config.PlacementConfig{
+	LookbackDays:   7,
+	MinImpressions: 1000,
+	MinMultiplier:  0.5,
+	MaxMultiplier:  1.5,
+}
+
+type fixture struct {
+	source    *staticSource
+	store     *placement.Store
+	refresher *placement.Refresher
+	redis     *fakeredis.Server
+	now       time.Time
+}
+
+// newFixture 整体CTR为1%：adx/a的CTR为2%，adx/b为0.2%，ssp/c为1%但展示数不足
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	f := &fixture{
+		source: &staticSource{rows: []placement.Stats{
+			row("adx", "a", "300x250", 20000, 4000, 4000, 80, 8),
+			row("adx", "b", "320x50", 10000, 5000, 5000, 10, 0),
+			row("ssp", "c", "300x250", 2000, 1000, 1000, 10, 5),
+		}},
+		redis: fakeredis.New(t),
+		now:   time.Date(2024, 6, 10, 12, 0, 0, 0, time.Local),
+	}
+	f.store = placement.NewStore(f.redis.Client(t))
+	f.refresher = placement.NewRefresher(testConfig, f.source, f.store, logger.NewLogger(zap.NewNop()))
+	f.refresher.SetClock(clock.NewFake(f.now))
+	if _, err := f.refresher.RunOnce(context.Background()); err != nil {
+		t.Fatalf("汇总供应路径表现失败: %v", err)
+	}
+	return f
+}
+
+func approx(got, want float64) bool {
+	return got > want-1e-9 && got < want+1e-9
+}
+
+func TestRefresher_RunOnce(t *testing.T) {
+	f := newFixture(t)
+
+	if f.source.since != "2024-06-04" {
+		t.Errorf("起始日期 = %s, 期望包含当天的最近7天", f.source.since)
+	}
+
+	meta, items, err := f.store.Load(context.Background())
+	if err != nil || meta == nil {
+		t.Fatalf("读取汇总结果失败: %v, %v", meta, err)
+	}
+	if len(items) != 3 {
+		t.Fatalf("应有3个供应路径: %+v", items)
+	}
+	overall := meta.Overall
+	if overall.Impressions != 10000 || overall.Clicks != 100 || !approx(overall.CTR, 0.01) || !approx(overall.WinRate, 10000.0/32000) {
+		t.Errorf("整体表现不正确: %+v", overall)
+	}
+	if meta.Since != "2024-06-04" || !meta.UpdateTime.Equal(f.now) {
+		t.Errorf("汇总信息不正确: %+v", meta)
+	}
+	if f.redis.Exists("placement:stats:tmp") {
+		t.Errorf("临时哈希应被改名")
+	}
+
+	// 没有数据时清空上一次的结果
+	f.source.rows = nil
+	if _, err := f.refresher.RunOnce(context.Background()); err != nil {
+		t.Fatalf("汇总供应路径表现失败: %v", err)
+	}
+	meta, items, err = f.store.Load(context.Background())
+	if err != nil || meta == nil || len(items) != 0 || meta.Overall.Impressions != 0 {
+		t.Errorf("应清空汇总结果: %+v, %+v, %v", meta, items, err)
+	}
+}
+
+func TestStore_Query(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	_, items, err := f.store.Query(ctx, placement.Filter{Sort: placement.SortCTR})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(items) != 3 || items[0].Placement != "a" || items[2].Placement != "b" {
+		t.Fatalf("应按CTR倒序: %+v", items)
+	}
+	if !approx(items[0].CTRIndex, 2) || !approx(items[0].CVR, 0.1) || !approx(items[0].WinRate, 0.2) {
+		t.Errorf("比率不正确: %+v", items[0])
+	}
+
+	_, items, _ = f.store.Query(ctx, placement.Filter{Exchange: "adx", Sort: placement.SortWinRate, Ascending: true})
+	if len(items) != 2 || items[0].Placement != "a" {
+		t.Errorf("应只返回adx并按胜率升序: %+v", items)
+	}
+
+	_, items, _ = f.store.Query(ctx, placement.Filter{Size: "300x250", MinImpressions: 2000})
+	if len(items) != 1 || items[0].Placement != "a" {
+		t.Errorf("应按尺寸和展示数过滤: %+v", items)
+	}
+
+	if _, _, err := f.store.Query(ctx, placement.Filter{Sort: "spend"}); err != placement.ErrInvalidSort {
+		t.Errorf("无效的排序字段应返回ErrInvalidSort, got %v", err)
+	}
+}
+
+func TestStore_QueryBeforeRefresh(t *testing.T) {
+	store := placement.NewStore(fakeredis.New(t).Client(t))
+	meta, items, err := store.Query(context.Background(), placement.Filter{})
+	if err != nil || meta != nil || len(items) != 0 {
+		t.Errorf("尚未汇总时应返回空结果: %+v, %+v, %v", meta, items, err)
+	}
+}
+
+func TestAdvisor_AdjustBid(t *testing.T) {
+	f := newFixture(t)
+	advisor := placement.NewAdvisor(testConfig, f.store, logger.NewLogger(zap.NewNop()))
+	if err := advisor.Load(context.Background()); err != nil {
+		t.Fatalf("加载供应路径表现失败: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		exchange string
+		slot     bidding.AdSlot
+		want     float64
+	}{
+		{"CTR高于整体时提高出价，不超过上限", "adx", bidding.AdSlot{SlotID: "a", Width: 300, Height: 250}, 1.5},
+		{"CTR低于整体时降低出价，不低于下限", "adx", bidding.AdSlot{SlotID: "b", Width: 320, Height: 50}, 0.5},
+		{"展示数不足不调整", "ssp", bidding.AdSlot{SlotID: "c", Width: 300, Height: 250}, 1},
+		{"尺寸不同不调整", "adx", bidding.AdSlot{SlotID: "a", Width: 728, Height: 90}, 1},
+		{"没有数据不调整", "other", bidding.AdSlot{SlotID: "a", Width: 300, Height: 250}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := advisor.AdjustBid(tt.exchange, tt.slot, 2); !approx(got, 2*tt.want) {
+				t.Errorf("AdjustBid() = %v, want %v", got, 2*tt.want)
+			}
+		})
+	}
+
+	// 系数范围内按CTR比值调整
+	wide := testConfig
+	wide.MaxMultiplier = 3
+	advisor = placement.NewAdvisor(wide, f.store, logger.NewLogger(zap.NewNop()))
+	advisor.Load(context.Background())
+	if got := advisor.Multiplier(placement.Key{Exchange: "adx", Placement: "a", Size: "300x250"}); !approx(got, 2) {
+		t.Errorf("Multiplier() = %v, want 2", got)
+	}
+}
+
+func TestPlacementHandler_GetPlacements(t *testing.T) {
+	f := newFixture(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	handlers.NewPlacementHandler(f.store, logger.NewLogger(zap.NewNop())).RegisterRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/placements?sort=ctr&order=asc&limit=1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Total   int               `json:"total"`
+		Since   string            `json:"since"`
+		Overall placement.Stats   `json:"overall"`
+		Items   []placement.Stats `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if resp.Total != 3 || len(resp.Items) != 1 || resp.Items[0].Placement != "b" || resp.Since != "2024-06-04" {
+		t.Errorf("响应不正确: %+v", resp)
+	}
+
+	for _, query := range []string{"sort=spend", "order=up", "size=big", "limit=0", "min_impressions=-1"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats/placements?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", query, w.Code)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package pricing_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"simple-dsp/internal/pricing"
+	"simple-dsp/pkg/config"
+)
+
+var (
+	testIV = []byte{0x38, 0x6e, 0x3a, 0xc0, 0x00, 0x0c, 0x0a, 0x08, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+
+	currentKey = pricing.KeyPair{
+		EncryptionKey: []byte("current-encryption-key-32-bytes!"),
+		IntegrityKey:  []byte("current-integrity-key-32-bytes!!"),
+	}
+	previousKey = pricing.KeyPair{
+		EncryptionKey: []byte("previous-encryption-key-32-byte!"),
+		IntegrityKey:  []byte("previous-integrity-key-32-bytes!"),
+	}
+)
+
+func mustEncrypt(t *testing.T, key pricing.KeyPair, price float64) string {
+	t.Helper()
+	value, err := pricing.Encrypt(key, testIV, price)
+	if err != nil {
+		t.Fatalf("加密价格失败: %v", err)
+	}
+	return value
+}
+
+func TestDecrypter_Decrypt(t *testing.T) {
+	d := pricing.NewDecrypter()
+	d.SetKeys("adx", []pricing.KeyPair{currentKey, previousKey})
+
+	tampered := []byte(mustEncrypt(t, currentKey, 1.5))
+	tampered[20] ^= 0x01
+
+	tests := []struct {
+		name     string
+		exchange string
+		value    string
+		want     float64
+		wantErr  error
+	}{
+		{
+			name:     "当前密钥解密",
+			exchange: "adx",
+			value:    mustEncrypt(t, currentKey, 1.5),
+			want:     1.5,
+		},
+		{
+			name:     "轮换期间旧密钥解密",
+			exchange: "adx",
+			value:    mustEncrypt(t, previousKey, 0.000123),
+			want:     0.000123,
+		},
+		{
+			name:     "未知密钥",
+			exchange: "adx",
+			value: mustEncrypt(t, pricing.KeyPair{
+				EncryptionKey: []byte("unknown"),
+				IntegrityKey:  []byte("unknown"),
+			}, 1.5),
+			wantErr: pricing.ErrSignatureMismatch,
+		},
+		{
+			name:     "密文被篡改",
+			exchange: "adx",
+			value:    string(tampered),
+			wantErr:  pricing.ErrSignatureMismatch,
+		},
+		{
+			name:     "密文长度错误",
+			exchange: "adx",
+			value:    "YWJj",
+			wantErr:  pricing.ErrInvalidCiphertext,
+		},
+		{
+			name:     "配置了密钥时拒绝明文价格",
+			exchange: "adx",
+			value:    "2.35",
+			wantErr:  pricing.ErrPlaintextPrice,
+		},
+		{
+			name:     "未配置密钥按明文处理",
+			exchange: "plain",
+			value:    "2.35",
+			want:     2.35,
+		},
+		{
+			name:     "明文价格无效",
+			exchange: "plain",
+			value:    "${AUCTION_PRICE}",
+			wantErr:  pricing.ErrInvalidPrice,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := d.Decrypt(tt.exchange, tt.value)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v，实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解密失败: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("期望价格 %v，实际 %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDecrypter_KeyRotation(t *testing.T) {
+	d := pricing.NewDecrypter()
+	d.SetKeys("adx", []pricing.KeyPair{previousKey})
+
+	value := mustEncrypt(t, currentKey, 3)
+	if _, err := d.Decrypt("adx", value); !errors.Is(err, pricing.ErrSignatureMismatch) {
+		t.Fatalf("新密钥生效前期望签名错误，实际 %v", err)
+	}
+
+	d.SetKeys("adx", []pricing.KeyPair{currentKey, previousKey})
+	if got, err := d.Decrypt("adx", value); err != nil || got != 3 {
+		t.Fatalf("新密钥生效后解密结果 %v, %v", got, err)
+	}
+
+	d.SetKeys("adx", []pricing.KeyPair{currentKey})
+	if _, err := d.Decrypt("adx", mustEncrypt(t, previousKey, 3)); !errors.Is(err, pricing.ErrSignatureMismatch) {
+		t.Fatalf("旧密钥下线后期望签名错误，实际 %v", err)
+	}
+}
+
+func TestNewDecrypterFromConfig(t *testing.T) {
+	d, err := pricing.NewDecrypterFromConfig(map[string][]config.PriceKeyConfig{
+		"adx": {{
+			EncryptionKey: base64.URLEncoding.EncodeToString(currentKey.EncryptionKey),
+			IntegrityKey:  base64.URLEncoding.EncodeToString(currentKey.IntegrityKey),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("创建解密器失败: %v", err)
+	}
+	if got, err := d.Decrypt("adx", mustEncrypt(t, currentKey, 0.8)); err != nil || got != 0.8 {
+		t.Fatalf("解密结果 %v, %v", got, err)
+	}
+
+	_, err = pricing.NewDecrypterFromConfig(map[string][]config.PriceKeyConfig{
+		"adx": {{EncryptionKey: "!!!", IntegrityKey: "abc"}},
+	})
+	if !errors.Is(err, pricing.ErrInvalidKey) {
+		t.Fatalf("期望密钥错误，实际 %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package profile_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/profile"
+	"simple-dsp/internal/stats"
+)
+
+const baseCTR = 0.01
+
+func TestCTRWithoutHistory(t *testing.T) {
+	var p *profile.Profile
+	if got := p.Features("1", "game").CTR(baseCTR, time.Now()); got != baseCTR {
+		t.Fatalf("CTR = %v, want %v", got, baseCTR)
+	}
+}
+
+func TestCTRSmoothing(t *testing.T) {
+	now := time.Now()
+
+	// 展示多而没有点击时低于默认值，点击率高时高于默认值
+	ignored := profile.Features{Campaign: profile.Counter{Impressions: 100}}
+	clicked := profile.Features{Campaign: profile.Counter{Impressions: 100, Clicks: 5}}
+	if got := ignored.CTR(baseCTR, now); got >= baseCTR {
+		t.Fatalf("无点击 CTR = %v, want < %v", got, baseCTR)
+	}
+	if got := clicked.CTR(baseCTR, now); got <= baseCTR {
+		t.Fatalf("有点击 CTR = %v, want > %v", got, baseCTR)
+	}
+
+	// 少量展示时接近默认值
+	sparse := profile.Features{Campaign: profile.Counter{Impressions: 1, Clicks: 1}}
+	if got := sparse.CTR(baseCTR, now); got > 2*baseCTR {
+		t.Fatalf("少量展示 CTR = %v, 不应大幅偏离默认值", got)
+	}
+
+	// 类目特征作为计划特征的先验
+	category := profile.Features{Category: profile.Counter{Impressions: 100, Clicks: 5}}
+	if got := category.CTR(baseCTR, now); got <= baseCTR {
+		t.Fatalf("类目有点击 CTR = %v, want > %v", got, baseCTR)
+	}
+}
+
+func TestCTRRecentClick(t *testing.T) {
+	now := time.Now()
+	counter := profile.Counter{Impressions: 100, Clicks: 5}
+
+	old := counter
+	old.LastClick = now.Add(-2 * time.Hour)
+	recent := counter
+	recent.LastClick = now.Add(-time.Minute)
+
+	oldCTR := profile.Features{Campaign: old}.CTR(baseCTR, now)
+	recentCTR := profile.Features{Campaign: recent}.CTR(baseCTR, now)
+	if recentCTR <= oldCTR {
+		t.Fatalf("近期点击 CTR = %v, want > %v", recentCTR, oldCTR)
+	}
+}
+
+func TestCTRClamped(t *testing.T) {
+	f := profile.Features{Campaign: profile.Counter{Impressions: 1000, Clicks: 5000, LastClick: time.Now()}}
+	if got := f.CTR(baseCTR, time.Now()); got > 0.5 {
+		t.Fatalf("CTR = %v, want <= 0.5", got)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	p := &profile.Profile{
+		Total:      profile.Counter{Impressions: 3},
+		Campaigns:  map[string]*profile.Counter{"1": {Impressions: 2, Clicks: 1}},
+		Categories: map[string]*profile.Counter{"game": {Impressions: 1}},
+	}
+
+	f := p.Features("1", "game")
+	if f.Total.Impressions != 3 || f.Campaign.Clicks != 1 || f.Category.Impressions != 1 {
+		t.Fatalf("Features = %+v", f)
+	}
+	if f := p.Features("2", ""); f.Campaign.Impressions != 0 || f.Category.Impressions != 0 {
+		t.Fatalf("未知计划 Features = %+v", f)
+	}
+}
+
+// memoryStore 记录写入的用户行为
+type memoryStore struct {
+	observations []profile.Observation
+}
+
+func (s *memoryStore) Profile(ctx context.Context, userID string) (*profile.Profile, error) {
+	return nil, profile.ErrProfileNotFound
+}
+
+func (s *memoryStore) Record(ctx context.Context, observations []profile.Observation) error {
+	s.observations = append(s.observations, observations...)
+	return nil
+}
+
+// staticCategories 固定的策略类目
+type staticCategories map[string]string
+
+func (c staticCategories) Category(strategyID string) string {
+	return c[strategyID]
+}
+
+func TestUpdaterObserveBatch(t *testing.T) {
+	store := &memoryStore{}
+	updater := profile.NewUpdater(store, staticCategories{"1": "game"})
+	ts := time.UnixMilli(1700000000000)
+
+	err := updater.ObserveBatch(context.Background(), []*stats.Event{
+		{EventType: stats.EventImpression, UserID: "u1", AdID: "1", Timestamp: ts},
+		{EventType: stats.EventClick, UserID: "u1", AdID: "2", Timestamp: ts,
+			ExtraParams: map[string]string{"category": "shopping"}},
+		{EventType: stats.EventConversion, UserID: "u1", AdID: "1", Timestamp: ts},
+		{EventType: stats.EventImpression, AdID: "1", Timestamp: ts},
+	})
+	if err != nil {
+		t.Fatalf("ObserveBatch: %v", err)
+	}
+
+	want := []profile.Observation{
+		{UserID: "u1", CampaignID: "1", Category: "game", Action: profile.ActionImpression, Time: ts},
+		{UserID: "u1", CampaignID: "2", Category: "shopping", Action: profile.ActionClick, Time: ts},
+	}
+	if len(store.observations) != len(want) {
+		t.Fatalf("observations = %+v, want %+v", store.observations, want)
+	}
+	for i := range want {
+		if store.observations[i] != want[i] {
+			t.Errorf("observations[%d] = %+v, want %+v", i, store.observations[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package reqctx_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"simple-dsp/pkg/geo"
+	"simple-dsp/pkg/reqctx"
+	"simple-dsp/pkg/useragent"
+)
+
+func TestAccessors(t *testing.T) {
+	ctx := context.Background()
+	if reqctx.RequestID(ctx) != "" || reqctx.Exchange(ctx) != "" || reqctx.APIKeyOwner(ctx) != "" {
+		t.Fatal("未设置时应返回空串")
+	}
+	if _, ok := reqctx.ConsentFrom(ctx); ok {
+		t.Fatal("未设置同意状态时ok应为false")
+	}
+
+	ctx = reqctx.WithRequestID(ctx, "r1")
+	ctx = reqctx.WithExchange(ctx, "adx")
+	ctx = reqctx.WithAPIKeyOwner(ctx, "adx")
+	ctx = reqctx.WithGeo(ctx, geo.Location{Country: "CN", City: "深圳"})
+	ctx = reqctx.WithDevice(ctx, useragent.Device{Type: useragent.DeviceMobile, OS: useragent.OSAndroid})
+	if reqctx.RequestID(ctx) != "r1" || reqctx.Exchange(ctx) != "adx" || reqctx.APIKeyOwner(ctx) != "adx" {
+		t.Errorf("RequestID/Exchange/APIKeyOwner = %s/%s/%s", reqctx.RequestID(ctx), reqctx.Exchange(ctx), reqctx.APIKeyOwner(ctx))
+	}
+	if loc, ok := reqctx.Geo(ctx); !ok || loc.City != "深圳" {
+		t.Errorf("Geo() = %+v, %v", loc, ok)
+	}
+	if device, ok := reqctx.Device(ctx); !ok || device.OS != useragent.OSAndroid {
+		t.Errorf("Device() = %+v, %v", device, ok)
+	}
+}
+
+func TestParseConsent(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		header string
+		want   bool
+	}{
+		{name: "没有同意参数", want: true},
+		{name: "GPC请求头", header: "Sec-GPC", want: false},
+		{name: "DNT请求头", header: "DNT", want: false},
+		{name: "gpc参数", query: "gpc=1", want: false},
+		{name: "consent=0", query: "consent=0", want: false},
+		{name: "已选择退出出售", query: "us_privacy=1YYN", want: false},
+		{name: "未退出出售", query: "us_privacy=1YNN", want: true},
+		{name: "适用GDPR但没有同意字符串", query: "gdpr=1", want: false},
+		{name: "适用GDPR且有同意字符串", query: "gdpr=1&gdpr_consent=CO123", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/pixel/a1?"+tt.query, nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, "1")
+			}
+			if got := reqctx.ParseConsent(r).Allowed(); got != tt.want {
+				t.Errorf("Allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsentFromParams(t *testing.T) {
+	if _, ok := reqctx.ConsentFromParams(map[string]string{"os": "ios"}); ok {
+		t.Error("没有同意参数时ok应为false")
+	}
+	consent, ok := reqctx.ConsentFromParams(map[string]string{"gdpr": "1"})
+	if !ok || consent.Allowed() {
+		t.Errorf("ConsentFromParams(gdpr=1) = %+v, %v, want 不同意", consent, ok)
+	}
+}
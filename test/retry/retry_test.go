@@ -0,0 +1,157 @@
+package retry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"simple-dsp/pkg/retry"
+)
+
+var errTemporary = errors.New("暂时失败")
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := retry.Policy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	assert.Equal(t, time.Duration(0), p.Backoff(0))
+	assert.Equal(t, 10*time.Millisecond, p.Backoff(1))
+	assert.Equal(t, 20*time.Millisecond, p.Backoff(2))
+	assert.Equal(t, 40*time.Millisecond, p.Backoff(3))
+	// 超过上限后保持上限
+	assert.Equal(t, 50*time.Millisecond, p.Backoff(4))
+	assert.Equal(t, 50*time.Millisecond, p.Backoff(100))
+
+	p.Multiplier = 3
+	assert.Equal(t, 30*time.Millisecond, p.Backoff(2))
+
+	// 未设置初始等待时间时立即重试
+	assert.Equal(t, time.Duration(0), retry.Policy{}.Backoff(3))
+}
+
+func TestPolicy_BackoffJitter(t *testing.T) {
+	p := retry.Policy{InitialBackoff: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		d := p.Backoff(2)
+		assert.GreaterOrEqual(t, d, 100*time.Millisecond)
+		assert.LessOrEqual(t, d, 200*time.Millisecond)
+	}
+}
+
+func TestDo_RetriesUntilSuccess(t *testing.T) {
+	var calls int
+	var retries []int
+	p := retry.Policy{
+		MaxRetries:     3,
+		InitialBackoff: time.Millisecond,
+		OnRetry: func(n int, err error, wait time.Duration) {
+			assert.ErrorIs(t, err, errTemporary)
+			retries = append(retries, n)
+		},
+	}
+	err := retry.Do(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return errTemporary
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []int{1, 2}, retries)
+}
+
+func TestDo_ReturnsLastErrorAfterMaxRetries(t *testing.T) {
+	var calls int
+	err := retry.Do(context.Background(), retry.Policy{MaxRetries: 2}, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 3, calls)
+
+	// 零值策略只执行一次
+	calls = 0
+	err = retry.Do(context.Background(), retry.Policy{}, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDo_Permanent(t *testing.T) {
+	var calls int
+	err := retry.Do(context.Background(), retry.Policy{MaxRetries: 5}, func(ctx context.Context) error {
+		calls++
+		return retry.Permanent(errTemporary)
+	})
+	// 返回原始错误，不再重试
+	assert.Equal(t, errTemporary, err)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, retry.Permanent(nil))
+}
+
+func TestDo_MaxElapsed(t *testing.T) {
+	var calls int
+	p := retry.Policy{MaxRetries: 100, InitialBackoff: 20 * time.Millisecond, Multiplier: 1, MaxElapsed: 50 * time.Millisecond}
+	start := time.Now()
+	err := retry.Do(context.Background(), p, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 3, calls)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestDo_StopsBeforeDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+
+	// 剩余时间不足以再等待一次时返回最后一次的错误，而不是等到截止时间
+	var calls int
+	start := time.Now()
+	err := retry.Do(ctx, retry.Policy{MaxRetries: 3, InitialBackoff: time.Second}, func(ctx context.Context) error {
+		calls++
+		return errTemporary
+	})
+	assert.ErrorIs(t, err, errTemporary)
+	assert.Equal(t, 1, calls)
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestDo_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	err := retry.Do(ctx, retry.Policy{MaxRetries: 3, InitialBackoff: time.Second}, func(ctx context.Context) error {
+		calls++
+		cancel()
+		return errTemporary
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, calls)
+
+	// 已取消的上下文不执行fn
+	calls = 0
+	err = retry.Do(ctx, retry.Policy{}, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, calls)
+}
+
+func TestDoValue(t *testing.T) {
+	var calls int
+	got, err := retry.DoValue(context.Background(), retry.Policy{MaxRetries: 1}, func(ctx context.Context) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errTemporary
+		}
+		return "ok", nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", got)
+}
@@ -2,12 +2,18 @@ package rta_test
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"simple-dsp/internal/rta"
 	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/pkg/retry"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 )
@@ -160,3 +166,121 @@ func TestClient_BatchQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestClient_Evaluate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/rta/check", r.URL.Path)
+		switch r.URL.Query().Get("user_id") {
+		case "user-bid":
+			w.Write([]byte(`{"code":0,"data":{"is_targeted":true,"base_bid":1.5,"bid_multiplier":1.2}}`))
+		case "user-plain":
+			w.Write([]byte(`{"code":0,"data":{"is_targeted":true}}`))
+		default:
+			w.Write([]byte(`{"code":1001,"message":"用户不存在"}`))
+		}
+	}))
+	defer server.Close()
+
+	m := &metrics.Metrics{RTA: &metrics.RTAMetrics{CheckDuration: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_rta_check_duration_seconds"})}}
+	client := rta.NewClient(server.URL, "test_app_key", "test_app_secret", logger.NewLogger(zap.NewNop()), m)
+
+	resp, err := client.Evaluate(context.Background(), "user-bid")
+	assert.NoError(t, err)
+	assert.Equal(t, &rta.RTAResponse{Participate: true, BaseBid: 1.5, BidMultiplier: 1.2}, resp)
+
+	// 未返回出价信号时为0，按策略出价
+	resp, err = client.Evaluate(context.Background(), "user-plain")
+	assert.NoError(t, err)
+	assert.Equal(t, &rta.RTAResponse{Participate: true}, resp)
+
+	targeted, err := client.CheckTargeting(context.Background(), "user-plain")
+	assert.NoError(t, err)
+	assert.True(t, targeted)
+
+	_, err = client.Evaluate(context.Background(), "user-unknown")
+	assert.Error(t, err)
+}
+
+func TestClient_EvaluateTasks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		assert.Equal(t, "user-1", query.Get("user_id"))
+		switch query.Get("task_id") {
+		case "task-a":
+			assert.Equal(t, "ch-a", query.Get("channel"))
+			assert.Equal(t, "space-a", query.Get("ad_space_id"))
+			w.Write([]byte(`{"code":0,"data":{"is_targeted":true,"bid_multiplier":1.5}}`))
+		case "task-b":
+			w.Write([]byte(`{"code":0,"data":{"is_targeted":false}}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	m := &metrics.Metrics{RTA: &metrics.RTAMetrics{CheckDuration: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_rta_check_duration_seconds"})}}
+	client := rta.NewClient(server.URL, "test_app_key", "test_app_secret", logger.NewLogger(zap.NewNop()), m)
+
+	taskA := &rta.TaskConfig{TaskID: "task-a", Channel: "ch-a", AdvertisingSpaceID: "space-a"}
+	taskB := &rta.TaskConfig{TaskID: "task-b"}
+	taskC := &rta.TaskConfig{TaskID: "task-c"}
+
+	// 查询失败的任务不在结果中
+	results, err := client.EvaluateTasks(context.Background(), "user-1", []*rta.TaskConfig{taskA, taskB, taskC})
+	assert.NoError(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, &rta.RTAResponse{Participate: true, BidMultiplier: 1.5}, results["task-a"])
+	assert.False(t, results["task-b"].Participate)
+
+	// 全部失败时返回错误
+	_, err = client.EvaluateTasks(context.Background(), "user-1", []*rta.TaskConfig{taskC})
+	assert.Error(t, err)
+}
+
+func TestClient_RetryPolicy(t *testing.T) {
+	var calls atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch r.URL.Query().Get("user_id") {
+		case "user-flaky":
+			// 前两次返回5xx，之后成功
+			if n <= 2 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write([]byte(`{"code":0,"data":{"is_targeted":true}}`))
+		case "user-bad":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.Write([]byte(`{"code":1001,"message":"用户不存在"}`))
+		}
+	}))
+	defer server.Close()
+
+	m := &metrics.Metrics{RTA: &metrics.RTAMetrics{CheckDuration: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_rta_check_duration_seconds"})}}
+	client := rta.NewClient(server.URL, "test_app_key", "test_app_secret", logger.NewLogger(zap.NewNop()), m)
+	client.SetRetryPolicy(retry.Policy{MaxRetries: 3, InitialBackoff: time.Millisecond})
+
+	resp, err := client.Evaluate(context.Background(), "user-flaky")
+	assert.NoError(t, err)
+	assert.True(t, resp.Participate)
+	assert.Equal(t, int64(3), calls.Load())
+
+	// 4xx和业务错误不重试
+	calls.Store(0)
+	_, err = client.Evaluate(context.Background(), "user-bad")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), calls.Load())
+
+	calls.Store(0)
+	_, err = client.Evaluate(context.Background(), "user-unknown")
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), calls.Load())
+
+	// 任务配置了重试次数时使用任务的配置
+	calls.Store(0)
+	task := &rta.TaskConfig{TaskID: "task-a", RetryCount: 1, RetryInterval: time.Millisecond}
+	_, err = client.EvaluateTask(context.Background(), "user-flaky", task)
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), calls.Load())
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"simple-dsp/internal/rta"
+	"simple-dsp/pkg/config"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -103,3 +104,35 @@ func TestConfigManager(t *testing.T) {
 		<-done
 	})
 }
+
+func TestConfigManager_Bindings(t *testing.T) {
+	mgr := rta.NewConfigManagerFromConfig([]config.RTATaskConfig{
+		{TaskID: "task-a", Channel: "ch-a", AdvertisingSpaceID: "space-a", Campaigns: []string{"c1", "c2"}},
+		{TaskID: "task-b", Channel: "ch-b", Campaigns: []string{"c3"}},
+	})
+
+	task, exists := mgr.GetConfig("task-a")
+	assert.True(t, exists)
+	assert.True(t, task.Enabled)
+	assert.Equal(t, rta.DefaultConfig.CacheExpiration, task.CacheExpiration)
+
+	bindings := mgr.Bindings([]string{"c1", "c3", "c9"})
+	assert.Len(t, bindings, 2)
+	assert.Equal(t, "task-a", bindings["c1"].TaskID)
+	assert.Equal(t, "task-b", bindings["c3"].TaskID)
+
+	// 没有绑定的推广计划不查询RTA
+	assert.Nil(t, mgr.Bindings([]string{"c9"}))
+
+	// 重新设置任务时解除旧的绑定
+	mgr.SetConfig(&rta.TaskConfig{TaskID: "task-a", Enabled: true, Campaigns: []string{"c2"}})
+	bindings = mgr.Bindings([]string{"c1", "c2"})
+	assert.Len(t, bindings, 1)
+	assert.Equal(t, "task-a", bindings["c2"].TaskID)
+
+	// 停用或移除的任务不再生效
+	mgr.SetConfig(&rta.TaskConfig{TaskID: "task-b", Campaigns: []string{"c3"}})
+	assert.Nil(t, mgr.Bindings([]string{"c3"}))
+	mgr.RemoveConfig("task-a")
+	assert.Nil(t, mgr.Bindings([]string{"c2"}))
+}
@@ -0,0 +1,138 @@
+package rta_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/rta"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// slowServer 按请求序号决定延迟和返回的出价系数
+type slowServer struct {
+	*httptest.Server
+	calls atomic.Int64
+	delay func(n int64) time.Duration
+}
+
+func newSlowServer(t *testing.T, delay func(n int64) time.Duration) *slowServer {
+	s := &slowServer{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.calls.Add(1)
+		select {
+		case <-time.After(s.delay(n)):
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprintf(w, `{"code":0,"data":{"is_targeted":true,"bid_multiplier":%d}}`, n)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newLookupClient(baseURL string, policy config.RTALookupConfig) (*rta.Client, *metrics.RTAMetrics) {
+	m := &metrics.RTAMetrics{
+		CheckDuration: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test_rta_check_duration_seconds"}),
+		Hedges:        prometheus.NewCounter(prometheus.CounterOpts{Name: "test_rta_hedged_requests_total"}),
+		StaleResults:  prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_rta_stale_results_total"}, []string{"reason"}),
+	}
+	client := rta.NewClient(baseURL, "test_app_key", "test_app_secret", logger.NewLogger(zap.NewNop()), &metrics.Metrics{RTA: m})
+	client.SetLookupPolicy(policy)
+	return client, m
+}
+
+func TestClient_HedgedLookup(t *testing.T) {
+	// 首个请求很慢，对冲请求立即返回
+	server := newSlowServer(t, func(n int64) time.Duration {
+		if n == 1 {
+			return time.Second
+		}
+		return 0
+	})
+	client, m := newLookupClient(server.URL, config.RTALookupConfig{Hedge: true, HedgeDelay: 20 * time.Millisecond})
+
+	start := time.Now()
+	resp, err := client.Evaluate(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, 2.0, resp.BidMultiplier)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.Hedges))
+}
+
+func TestClient_HedgeDisabledWithoutSamples(t *testing.T) {
+	// 未配置对冲延迟且没有足够的耗时样本时不发送对冲请求
+	server := newSlowServer(t, func(int64) time.Duration { return 30 * time.Millisecond })
+	client, m := newLookupClient(server.URL, config.RTALookupConfig{Hedge: true})
+
+	_, err := client.Evaluate(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), server.calls.Load())
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.Hedges))
+}
+
+func TestClient_StaleOnTimeout(t *testing.T) {
+	// 首个请求正常返回，之后的请求超过截止时间
+	server := newSlowServer(t, func(n int64) time.Duration {
+		if n == 1 {
+			return 0
+		}
+		return time.Second
+	})
+	client, m := newLookupClient(server.URL, config.RTALookupConfig{StaleTTL: time.Minute})
+
+	resp, err := client.Evaluate(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, resp.BidMultiplier)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	resp, err = client.Evaluate(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, resp.BidMultiplier)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.StaleResults.WithLabelValues("timeout")))
+
+	// 没有保留结果的用户返回超时错误
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel2()
+	_, err = client.Evaluate(ctx2, "user-2")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_PreferStale(t *testing.T) {
+	server := newSlowServer(t, func(n int64) time.Duration {
+		if n == 1 {
+			return 0
+		}
+		return 200 * time.Millisecond
+	})
+	client, m := newLookupClient(server.URL, config.RTALookupConfig{StaleTTL: time.Minute, PreferStale: true})
+
+	resp, err := client.Evaluate(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, resp.BidMultiplier)
+
+	// 有保留结果时直接返回，并在后台刷新
+	start := time.Now()
+	resp, err = client.Evaluate(context.Background(), "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, resp.BidMultiplier)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.StaleResults.WithLabelValues("prefer_stale")))
+
+	assert.Eventually(t, func() bool {
+		resp, err := client.Evaluate(context.Background(), "user-1")
+		return err == nil && resp.BidMultiplier > 1
+	}, 2*time.Second, 20*time.Millisecond)
+}
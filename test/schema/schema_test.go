@@ -0,0 +1,340 @@
+package schema_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	eventsv1 "simple-dsp/api/proto/events/v1"
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/schemaregistry"
+)
+
+func sampleEvent() *stats.Event {
+	return &stats.Event{
+		EventType:   stats.EventImpression,
+		RequestID:   "r1",
+		UserID:      "u1",
+		AdID:        "1",
+		SlotID:      "slot-1",
+		BidPrice:    2.5,
+		WinPrice:    1.2,
+		Fee:         0.12,
+		Tax:         0.08,
+		Timestamp:   time.UnixMicro(1792137600123456),
+		IP:          "1.2.3.4",
+		UserAgent:   "Mozilla/5.0",
+		DwellMs:     3500,
+		ExtraParams: map[string]string{"exchange": "adx", "deal_id": "d1"},
+		Dimensions:  stats.Dimensions{Country: "CN", Province: "广东", City: "深圳", DeviceType: "mobile", OS: "ios"},
+	}
+}
+
+func TestEventProtoRoundTrip(t *testing.T) {
+	event := sampleEvent()
+	var decoded stats.Event
+	if err := stats.UnmarshalEventProto(stats.AppendEventProto(nil, event), &decoded); err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, event) {
+		t.Errorf("解码结果应与原事件一致:\n got %+v\nwant %+v", decoded, *event)
+	}
+
+	// 扩展参数按键排序，相同的事件编码结果相同
+	if a, b := stats.AppendEventProto(nil, event), stats.AppendEventProto(nil, sampleEvent()); string(a) != string(b) {
+		t.Errorf("相同的事件编码结果应相同")
+	}
+
+	// 零值字段不写出，解码后仍为零值
+	var empty stats.Event
+	if err := stats.UnmarshalEventProto(stats.AppendEventProto(nil, &stats.Event{EventType: stats.EventClick}), &empty); err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if !empty.Timestamp.IsZero() || empty.ExtraParams != nil || empty.EventType != stats.EventClick {
+		t.Errorf("零值字段解码错误: %+v", empty)
+	}
+}
+
+func TestUnmarshalEventProtoCompatibility(t *testing.T) {
+	// 新版本新增的字段，旧的消费方跳过
+	data := stats.AppendEventProto(nil, sampleEvent())
+	data = protowire.AppendTag(data, 100, protowire.BytesType)
+	data = protowire.AppendString(data, "新字段")
+	data = protowire.AppendTag(data, 101, protowire.VarintType)
+	data = protowire.AppendVarint(data, 7)
+	var event stats.Event
+	if err := stats.UnmarshalEventProto(data, &event); err != nil {
+		t.Fatalf("未知字段应跳过: %v", err)
+	}
+	if event.AdID != "1" || event.WinPrice != 1.2 {
+		t.Errorf("已知字段解码错误: %+v", event)
+	}
+
+	// 已知字段改变类型属于不兼容的变更
+	bad := protowire.AppendTag(nil, 7, protowire.BytesType)
+	bad = protowire.AppendString(bad, "1.2")
+	if err := stats.UnmarshalEventProto(bad, &event); !errors.Is(err, stats.ErrIncompatibleSchema) {
+		t.Errorf("字段类型变化应返回ErrIncompatibleSchema, got %v", err)
+	}
+
+	if err := stats.UnmarshalEventProto([]byte{0x0a, 0x05, 'a'}, &event); err == nil {
+		t.Error("截断的消息应返回错误")
+	}
+}
+
+func TestProtobufHeader(t *testing.T) {
+	data := append(schemaregistry.AppendProtobufHeader(nil, 42), "payload"...)
+	if !schemaregistry.IsFramed(data) {
+		t.Fatal("应识别为线格式")
+	}
+	id, indexes, payload, err := schemaregistry.ParseProtobufHeader(data)
+	if err != nil || id != 42 || !reflect.DeepEqual(indexes, []int{0}) || string(payload) != "payload" {
+		t.Fatalf("解析错误: id=%d indexes=%v payload=%q err=%v", id, indexes, payload, err)
+	}
+
+	// 完整编码的消息索引[1, 2]
+	full := []byte{0, 0, 0, 0, 7, 4, 2, 4, 'x'}
+	if id, indexes, payload, err := schemaregistry.ParseProtobufHeader(full); err != nil || id != 7 || !reflect.DeepEqual(indexes, []int{1, 2}) || string(payload) != "x" {
+		t.Errorf("解析消息索引错误: id=%d indexes=%v payload=%q err=%v", id, indexes, payload, err)
+	}
+
+	for _, data := range [][]byte{nil, []byte("{}"), {0, 0, 0}, {0, 0, 0, 0, 1, 20}} {
+		if _, _, _, err := schemaregistry.ParseProtobufHeader(data); !errors.Is(err, schemaregistry.ErrInvalidFrame) {
+			t.Errorf("%v应返回ErrInvalidFrame, got %v", data, err)
+		}
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	event := sampleEvent()
+
+	// 切换编码前写出的JSON消息
+	data, _ := json.Marshal(event)
+	decoded, err := stats.DecodeEvent(data)
+	if err != nil || decoded.AdID != "1" || decoded.Country != "CN" || decoded.ExtraParams["exchange"] != "adx" {
+		t.Fatalf("JSON事件解码错误: %+v %v", decoded, err)
+	}
+
+	framed := stats.AppendEventProto(schemaregistry.AppendProtobufHeader(nil, 3), event)
+	decoded, err = stats.DecodeEvent(framed)
+	if err != nil || !reflect.DeepEqual(decoded, event) {
+		t.Fatalf("Protobuf事件解码错误: %+v %v", decoded, err)
+	}
+
+	// 不是事件消息的索引
+	other := append([]byte{0, 0, 0, 0, 3, 2, 2}, stats.AppendEventProto(nil, event)...)
+	if _, err := stats.DecodeEvent(other); !errors.Is(err, stats.ErrIncompatibleSchema) {
+		t.Errorf("其他消息应返回ErrIncompatibleSchema, got %v", err)
+	}
+	if _, err := stats.DecodeEvent([]byte("not json")); err == nil {
+		t.Error("无效的消息应返回错误")
+	}
+}
+
+// fakeRegistry 内存中的Schema Registry，兼容性由incompatible控制
+type fakeRegistry struct {
+	mu            sync.Mutex
+	subjects      map[string][]string // 主题 -> 各版本的Schema
+	ids           map[string]int      // Schema -> ID
+	compatibility map[string]string
+	incompatible  bool
+	requests      []string
+	auth          string
+}
+
+func newFakeRegistry() *fakeRegistry {
+	return &fakeRegistry{
+		subjects:      make(map[string][]string),
+		ids:           make(map[string]int),
+		compatibility: make(map[string]string),
+	}
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if user, pass, ok := r.BasicAuth(); ok {
+		f.auth = user + ":" + pass
+	}
+
+	var body struct {
+		Schema        string `json:"schema"`
+		SchemaType    string `json:"schemaType"`
+		Compatibility string `json:"compatibility"`
+	}
+	if r.Body != nil {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+
+	path := r.URL.Path
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(path, "/config/"):
+		f.compatibility[strings.TrimPrefix(path, "/config/")] = body.Compatibility
+		_ = json.NewEncoder(w).Encode(map[string]string{"compatibility": body.Compatibility})
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/compatibility/subjects/"):
+		subject := strings.TrimSuffix(strings.TrimPrefix(path, "/compatibility/subjects/"), "/versions/latest")
+		if len(f.subjects[subject]) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40401, "message": "Subject not found."})
+			return
+		}
+		resp := map[string]interface{}{"is_compatible": !f.incompatible}
+		if f.incompatible {
+			resp["messages"] = []string{"FIELD_TYPE_CHANGED"}
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	case r.Method == http.MethodPost && strings.HasPrefix(path, "/subjects/"):
+		if body.SchemaType != schemaregistry.SchemaTypeProtobuf {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 42201, "message": "Invalid schema"})
+			return
+		}
+		subject := strings.TrimSuffix(strings.TrimPrefix(path, "/subjects/"), "/versions")
+		id, ok := f.ids[body.Schema]
+		if !ok {
+			id = len(f.ids) + 1
+			f.ids[body.Schema] = id
+		}
+		versions := f.subjects[subject]
+		if len(versions) == 0 || versions[len(versions)-1] != body.Schema {
+			f.subjects[subject] = append(versions, body.Schema)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]int{"id": id})
+	case r.Method == http.MethodGet && strings.HasPrefix(path, "/schemas/ids/"):
+		for schema, id := range f.ids {
+			if path == "/schemas/ids/"+strconv.Itoa(id) {
+				_ = json.NewEncoder(w).Encode(map[string]string{"schema": schema, "schemaType": schemaregistry.SchemaTypeProtobuf})
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"error_code": 40403, "message": "Schema not found"})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeRegistry) count(prefix string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+func newClient(t *testing.T, registry *fakeRegistry) *schemaregistry.Client {
+	server := httptest.NewServer(registry)
+	t.Cleanup(server.Close)
+	client, err := schemaregistry.NewClient(config.SchemaRegistryConfig{URL: server.URL + "/", Username: "dsp", Password: "secret"})
+	if err != nil {
+		t.Fatalf("创建客户端失败: %v", err)
+	}
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	if _, err := schemaregistry.NewClient(config.SchemaRegistryConfig{}); !errors.Is(err, schemaregistry.ErrURLRequired) {
+		t.Errorf("未配置地址应返回ErrURLRequired, got %v", err)
+	}
+	if got := schemaregistry.Subject("dsp.events.click"); got != "dsp.events.click-value" {
+		t.Errorf("主题应为{topic}-value, got %s", got)
+	}
+}
+
+func TestEventEncoder(t *testing.T) {
+	registry := newFakeRegistry()
+	client := newClient(t, registry)
+	ctx := context.Background()
+	topics := []string{"dsp.events.impression", "dsp.events.click"}
+
+	encoder, err := stats.NewEventEncoder(ctx, client, topics, "BACKWARD")
+	if err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+	if registry.compatibility["dsp.events.click-value"] != "BACKWARD" || registry.auth != "dsp:secret" {
+		t.Errorf("应设置兼容性级别并带认证: %v %q", registry.compatibility, registry.auth)
+	}
+	if len(registry.subjects["dsp.events.impression-value"]) != 1 || registry.subjects["dsp.events.impression-value"][0] != eventsv1.EventSchema {
+		t.Fatalf("应注册event.proto: %v", registry.subjects)
+	}
+
+	data, err := encoder.Encode("dsp.events.impression", sampleEvent())
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+	id, _, _, err := schemaregistry.ParseProtobufHeader(data)
+	if err != nil || id != 1 {
+		t.Errorf("消息头应带Schema ID 1, got %d %v", id, err)
+	}
+	if event, err := stats.DecodeEvent(data); err != nil || !reflect.DeepEqual(event, sampleEvent()) {
+		t.Errorf("解码结果应与原事件一致: %+v %v", event, err)
+	}
+	if _, err := encoder.Encode("dsp.events.dwell", sampleEvent()); !errors.Is(err, stats.ErrSchemaNotRegistered) {
+		t.Errorf("未注册的主题应返回ErrSchemaNotRegistered, got %v", err)
+	}
+
+	// 重启后重复注册相同的Schema不产生新版本
+	if _, err := stats.NewEventEncoder(ctx, client, topics, ""); err != nil {
+		t.Fatalf("重复注册失败: %v", err)
+	}
+	if len(registry.subjects["dsp.events.click-value"]) != 1 || registry.count("PUT") != 2 {
+		t.Errorf("重复注册不应产生新版本，兼容性为空时不设置: %v", registry.requests)
+	}
+
+	// 与已注册的版本不兼容时拒绝注册
+	registry.incompatible = true
+	before := registry.count("POST /subjects/")
+	if _, err := stats.NewEventEncoder(ctx, client, topics, ""); !errors.Is(err, stats.ErrIncompatibleSchema) || !strings.Contains(err.Error(), "FIELD_TYPE_CHANGED") {
+		t.Errorf("不兼容时应返回ErrIncompatibleSchema并带原因, got %v", err)
+	}
+	if registry.count("POST /subjects/") != before {
+		t.Error("不兼容时不应注册")
+	}
+}
+
+func TestSchemaByID(t *testing.T) {
+	registry := newFakeRegistry()
+	client := newClient(t, registry)
+	ctx := context.Background()
+
+	schema := schemaregistry.Schema{Schema: eventsv1.EventSchema, SchemaType: schemaregistry.SchemaTypeProtobuf}
+	// 由另一个客户端注册，本客户端没有缓存
+	if _, err := stats.NewEventEncoder(ctx, newClient(t, registry), []string{"dsp.events.win"}, ""); err != nil {
+		t.Fatalf("注册失败: %v", err)
+	}
+
+	got, err := client.SchemaByID(ctx, 1)
+	if err != nil || got != schema {
+		t.Fatalf("读取Schema错误: %+v %v", got, err)
+	}
+	if _, err := client.SchemaByID(ctx, 1); err != nil || registry.count("GET /schemas/ids/1") != 1 {
+		t.Errorf("读取过的Schema应使用缓存: %v", registry.requests)
+	}
+
+	_, err = client.SchemaByID(ctx, 99)
+	var apiErr *schemaregistry.APIError
+	if !schemaregistry.IsNotFound(err) || !errors.As(err, &apiErr) || apiErr.Code != 40403 {
+		t.Errorf("不存在的Schema应返回40403, got %v", err)
+	}
+
+	if _, err := client.Register(ctx, "dsp.events.win-value", schemaregistry.Schema{Schema: "x"}); schemaregistry.IsNotFound(err) || err == nil {
+		t.Errorf("无效的Schema应返回错误, got %v", err)
+	}
+}
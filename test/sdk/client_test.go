@@ -0,0 +1,144 @@
+package sdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/sdk"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test-token"
+
+func newTestClient(t *testing.T, ms *MockServer, token string) *sdk.Client {
+	client, err := sdk.NewClient(sdk.Config{
+		BaseURL:      ms.URL(),
+		Token:        token,
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := sdk.NewClient(sdk.Config{})
+	assert.ErrorIs(t, err, sdk.ErrMissingBaseURL)
+}
+
+func TestClient_SubmitBid(t *testing.T) {
+	ms := NewMockServer(testToken)
+	defer ms.Close()
+	client := newTestClient(t, ms, testToken)
+
+	tests := []struct {
+		name      string
+		minPrice  float64
+		wantNoBid bool
+	}{
+		{name: "出价", minPrice: 1.0, wantNoBid: false},
+		{name: "不出价", minPrice: 8.0, wantNoBid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.SubmitBid(context.Background(), &sdk.BidRequest{
+				RequestID: "req-1",
+				UserID:    "user-1",
+				DeviceID:  "device-1",
+				IP:        "127.0.0.1",
+				AdSlots:   []sdk.AdSlot{{SlotID: "slot-1", Width: 320, Height: 50, MinPrice: tt.minPrice, MaxPrice: 10}},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "req-1", resp.RequestID)
+			assert.Equal(t, tt.wantNoBid, resp.NoBid())
+		})
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	ms := NewMockServer(testToken)
+	defer ms.Close()
+	client := newTestClient(t, ms, testToken)
+
+	// 幂等请求在503后重试成功
+	ms.FailNext(2)
+	_, err := client.ListAds(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, ms.Requests())
+
+	// 超过重试次数后返回错误
+	ms.FailNext(5)
+	_, err = client.ListAds(context.Background(), nil)
+	var apiErr *sdk.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+
+	// 事件回传不重试
+	ms.FailNext(1)
+	before := ms.Requests()
+	err = client.PostClick(context.Background(), &sdk.Event{RequestID: "req-1", AdID: "ad-1"})
+	assert.Error(t, err)
+	assert.Equal(t, before+1, ms.Requests())
+}
+
+func TestClient_Auth(t *testing.T) {
+	ms := NewMockServer(testToken)
+	defer ms.Close()
+	client := newTestClient(t, ms, "wrong-token")
+
+	_, err := client.ListAds(context.Background(), nil)
+	var apiErr *sdk.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "未授权访问", apiErr.Message)
+}
+
+func TestClient_Events(t *testing.T) {
+	ms := NewMockServer(testToken)
+	defer ms.Close()
+	client := newTestClient(t, ms, testToken)
+
+	ctx := context.Background()
+	event := &sdk.Event{RequestID: "req-1", UserID: "user-1", AdID: "ad-1", SlotID: "slot-1"}
+	require.NoError(t, client.PostImpression(ctx, event))
+	require.NoError(t, client.PostClick(ctx, event))
+	require.NoError(t, client.PostConversion(ctx, event))
+	assert.Len(t, ms.Events(), 3)
+}
+
+func TestClient_AdCRUD(t *testing.T) {
+	ms := NewMockServer(testToken)
+	defer ms.Close()
+	client := newTestClient(t, ms, testToken)
+	ctx := context.Background()
+
+	created, err := client.CreateAd(ctx, &sdk.Ad{Title: "测试广告", Width: 320, Height: 50})
+	require.NoError(t, err)
+	require.NotEmpty(t, created.ID)
+	assert.Equal(t, "active", created.Status)
+
+	updated, err := client.UpdateAd(ctx, created.ID, &sdk.Ad{Title: "新标题", Width: 320, Height: 50})
+	require.NoError(t, err)
+	assert.Equal(t, "新标题", updated.Title)
+
+	got, err := client.GetAd(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "新标题", got.Title)
+
+	require.NoError(t, client.DeleteAd(ctx, created.ID))
+	got, err = client.GetAd(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "deleted", got.Status)
+
+	_, err = client.GetAd(ctx, "not-exist")
+	assert.True(t, sdk.IsNotFound(err))
+
+	_, err = client.GetAd(ctx, "")
+	assert.ErrorIs(t, err, sdk.ErrMissingID)
+}
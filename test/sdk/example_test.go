@@ -0,0 +1,76 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"simple-dsp/pkg/sdk"
+)
+
+// ExampleClient_SubmitBid 提交竞价请求并回传展示事件
+func ExampleClient_SubmitBid() {
+	ms := NewMockServer("example-token")
+	defer ms.Close()
+
+	client, err := sdk.NewClient(sdk.Config{
+		BaseURL: ms.URL(),
+		Token:   "example-token",
+		Timeout: time.Second,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	resp, err := client.SubmitBid(ctx, &sdk.BidRequest{
+		RequestID: "req-123",
+		UserID:    "user-123",
+		DeviceID:  "device-123",
+		IP:        "10.0.0.1",
+		AdSlots:   []sdk.AdSlot{{SlotID: "banner-1", Width: 320, Height: 50, MinPrice: 1.0, MaxPrice: 5.0}},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.NoBid() {
+		fmt.Println("no bid")
+		return
+	}
+
+	ad := resp.Data[0]
+	fmt.Printf("slot=%s ad=%s price=%.2f\n", ad.SlotID, ad.AdID, ad.BidPrice)
+
+	if err := client.PostImpression(ctx, &sdk.Event{RequestID: resp.RequestID, AdID: ad.AdID, SlotID: ad.SlotID}); err != nil {
+		log.Fatal(err)
+	}
+	// Output: slot=banner-1 ad=ad-1 price=1.10
+}
+
+// ExampleClient_CreateAd 通过管理接口创建广告
+func ExampleClient_CreateAd() {
+	ms := NewMockServer("example-token")
+	defer ms.Close()
+
+	client, err := sdk.NewClient(sdk.Config{
+		BaseURL:  ms.URL(),
+		AdminURL: ms.URL(),
+		Token:    "example-token",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ad, err := client.CreateAd(context.Background(), &sdk.Ad{
+		Title:      "夏季促销",
+		LandingURL: "https://example.com/summer",
+		Width:      320,
+		Height:     50,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(ad.Status)
+	// Output: active
+}
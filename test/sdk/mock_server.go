@@ -0,0 +1,190 @@
+package sdk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"simple-dsp/pkg/sdk"
+)
+
+// MockServer 模拟DSP服务和管理后台
+type MockServer struct {
+	server *httptest.Server
+	token  string
+
+	mu      sync.Mutex
+	ads     map[string]*sdk.Ad
+	events  []sdk.Event
+	nextID  int
+	failN   int32 // 接下来需要返回503的请求数
+	counter int32 // 请求计数
+}
+
+// NewMockServer 创建新的模拟服务器
+func NewMockServer(token string) *MockServer {
+	ms := &MockServer{
+		token: token,
+		ads:   make(map[string]*sdk.Ad),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/traffic", ms.handleTraffic)
+	mux.HandleFunc("/api/v1/events/", ms.handleEvent)
+	mux.HandleFunc("/api/v1/ads", ms.handleAds)
+	mux.HandleFunc("/api/v1/ads/", ms.handleAd)
+
+	ms.server = httptest.NewServer(ms.middleware(mux))
+	return ms
+}
+
+// URL 返回模拟服务器的URL
+func (ms *MockServer) URL() string {
+	return ms.server.URL
+}
+
+// Close 关闭模拟服务器
+func (ms *MockServer) Close() {
+	ms.server.Close()
+}
+
+// FailNext 使接下来的n个请求返回503
+func (ms *MockServer) FailNext(n int) {
+	atomic.StoreInt32(&ms.failN, int32(n))
+}
+
+// Requests 返回收到的请求数
+func (ms *MockServer) Requests() int {
+	return int(atomic.LoadInt32(&ms.counter))
+}
+
+// Events 返回收到的事件
+func (ms *MockServer) Events() []sdk.Event {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return append([]sdk.Event(nil), ms.events...)
+}
+
+// middleware 认证和故障注入
+func (ms *MockServer) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ms.counter, 1)
+
+		if r.Header.Get("Authorization") != "Bearer "+ms.token {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "未授权访问"})
+			return
+		}
+		if atomic.AddInt32(&ms.failN, -1) >= 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "服务暂时不可用"})
+			return
+		}
+		atomic.StoreInt32(&ms.failN, 0)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleTraffic 处理竞价请求，底价不超过5时出价
+func (ms *MockServer) handleTraffic(w http.ResponseWriter, r *http.Request) {
+	var req sdk.BidRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的请求格式"})
+		return
+	}
+
+	resp := sdk.BidResponse{
+		RequestID: r.Header.Get("X-Request-ID"),
+		Message:   "success",
+		Data:      []sdk.AdResult{},
+	}
+	for _, slot := range req.AdSlots {
+		if slot.MinPrice <= 5 {
+			resp.Data = append(resp.Data, sdk.AdResult{SlotID: slot.SlotID, AdID: "ad-1", BidPrice: slot.MinPrice + 0.1})
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleEvent 处理事件回传
+func (ms *MockServer) handleEvent(w http.ResponseWriter, r *http.Request) {
+	var event sdk.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的请求格式"})
+		return
+	}
+	ms.mu.Lock()
+	ms.events = append(ms.events, event)
+	ms.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleAds 处理广告创建和列表
+func (ms *MockServer) handleAds(w http.ResponseWriter, r *http.Request) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPost:
+		var ad sdk.Ad
+		if err := json.NewDecoder(r.Body).Decode(&ad); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的请求参数"})
+			return
+		}
+		ms.nextID++
+		ad.ID = "ad-" + strconv.Itoa(ms.nextID)
+		ad.Status = "active"
+		ms.ads[ad.ID] = &ad
+		writeJSON(w, http.StatusOK, ad)
+	case http.MethodGet:
+		ads := make([]sdk.Ad, 0, len(ms.ads))
+		for _, ad := range ms.ads {
+			ads = append(ads, *ad)
+		}
+		writeJSON(w, http.StatusOK, sdk.Page[sdk.Ad]{Items: ads, Total: int64(len(ads)), Page: 1, PageSize: len(ads)})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAd 处理单个广告的查询、更新和删除
+func (ms *MockServer) handleAd(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/ads/")
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ad, ok := ms.ads[id]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "广告不存在"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, ad)
+	case http.MethodPut:
+		var update sdk.Ad
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "无效的请求参数"})
+			return
+		}
+		update.ID = id
+		update.Status = ad.Status
+		ms.ads[id] = &update
+		writeJSON(w, http.StatusOK, update)
+	case http.MethodDelete:
+		ad.Status = "deleted"
+		writeJSON(w, http.StatusOK, map[string]string{"message": "广告已删除"})
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,236 @@
+package segment_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/segment"
+	"simple-dsp/internal/stats"
+)
+
+// newIndex 10个种子用户和90个其他用户都看过计划B；
+// 种子用户和o01-o05看过计划A，其中o01点击了A
+func newIndex() (*segment.Index, []string) {
+	idx := segment.NewIndex()
+	var seeds []string
+	for i := 1; i <= 10; i++ {
+		id := fmt.Sprintf("s%02d", i)
+		seeds = append(seeds, id)
+		idx.Add(segment.Interaction{UserID: id, CampaignID: "A", Clicked: i <= 3})
+		idx.Add(segment.Interaction{UserID: id, CampaignID: "B"})
+	}
+	for i := 1; i <= 90; i++ {
+		id := fmt.Sprintf("o%02d", i)
+		idx.Add(segment.Interaction{UserID: id, CampaignID: "B"})
+		if i <= 5 {
+			idx.Add(segment.Interaction{UserID: id, CampaignID: "A", Clicked: i == 1})
+		}
+	}
+	return idx, seeds
+}
+
+func TestExpand(t *testing.T) {
+	idx, seeds := newIndex()
+	opts := segment.DefaultExpandOptions()
+	opts.Ratio = 0.3
+
+	got, err := idx.Expand(seeds, opts)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	// 计划B所有人都看过，lift为1，不参与打分
+	if got.Seeds != 10 || got.ActiveSeeds != 10 || got.Campaigns != 1 || got.Candidates != 5 {
+		t.Fatalf("expansion = %+v", got)
+	}
+
+	// 点击的用户排在最前，得分相同时按用户ID排序
+	want := []string{"o01", "o02", "o03"}
+	if len(got.Users) != len(want) {
+		t.Fatalf("users = %+v, want %v", got.Users, want)
+	}
+	for i, id := range want {
+		if got.Users[i].UserID != id {
+			t.Fatalf("users[%d] = %s, want %s", i, got.Users[i].UserID, id)
+		}
+	}
+	if got.Users[0].Score <= got.Users[1].Score {
+		t.Fatalf("点击用户得分 %v 应高于仅展示用户 %v", got.Users[0].Score, got.Users[1].Score)
+	}
+}
+
+func TestExpandThresholds(t *testing.T) {
+	idx, seeds := newIndex()
+
+	opts := segment.DefaultExpandOptions()
+	opts.MaxUsers = 2
+	got, err := idx.Expand(seeds, opts)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(got.Users) != 2 {
+		t.Fatalf("MaxUsers=2 扩展%d人", len(got.Users))
+	}
+
+	opts = segment.DefaultExpandOptions()
+	opts.MinSupport = 11
+	got, err = idx.Expand(seeds, opts)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if got.Campaigns != 0 || len(got.Users) != 0 {
+		t.Fatalf("种子支持数不足时不应扩展: %+v", got)
+	}
+
+	// 最低得分过滤掉仅展示的用户
+	opts = segment.DefaultExpandOptions()
+	opts.MinScore = 3
+	got, err = idx.Expand(seeds, opts)
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(got.Users) != 1 || got.Users[0].UserID != "o01" {
+		t.Fatalf("users = %+v, want o01", got.Users)
+	}
+}
+
+func TestExpandInvalid(t *testing.T) {
+	idx, seeds := newIndex()
+
+	if _, err := idx.Expand(nil, segment.DefaultExpandOptions()); !errors.Is(err, segment.ErrEmptySeed) {
+		t.Fatalf("err = %v, want ErrEmptySeed", err)
+	}
+	for name, mutate := range map[string]func(*segment.ExpandOptions){
+		"倍数为0":     func(o *segment.ExpandOptions) { o.Ratio = 0 },
+		"lift不大于1": func(o *segment.ExpandOptions) { o.MinLift = 1 },
+		"支持数为0":    func(o *segment.ExpandOptions) { o.MinSupport = 0 },
+		"点击权重小于1":  func(o *segment.ExpandOptions) { o.ClickWeight = 0.5 },
+	} {
+		opts := segment.DefaultExpandOptions()
+		mutate(&opts)
+		if _, err := idx.Expand(seeds, opts); !errors.Is(err, segment.ErrInvalidOptions) {
+			t.Errorf("%s: err = %v, want ErrInvalidOptions", name, err)
+		}
+	}
+
+	// 种子用户在窗口内没有交互
+	got, err := idx.Expand([]string{"unknown"}, segment.DefaultExpandOptions())
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if got.ActiveSeeds != 0 || len(got.Users) != 0 {
+		t.Fatalf("expansion = %+v", got)
+	}
+}
+
+// memoryStore 内存人群包
+type memoryStore struct {
+	segments map[string][]string
+	ttls     map[string]time.Duration
+}
+
+func (s *memoryStore) Members(ctx context.Context, segmentID string) ([]string, error) {
+	users, ok := s.segments[segmentID]
+	if !ok {
+		return nil, segment.ErrSegmentNotFound
+	}
+	return users, nil
+}
+
+func (s *memoryStore) Replace(ctx context.Context, segmentID string, users []string, ttl time.Duration) error {
+	s.segments[segmentID] = users
+	s.ttls[segmentID] = ttl
+	return nil
+}
+
+func (s *memoryStore) Add(ctx context.Context, segmentID, userID string, ttl time.Duration) error {
+	s.segments[segmentID] = append(s.segments[segmentID], userID)
+	return nil
+}
+
+func (s *memoryStore) Contains(ctx context.Context, segmentID, userID string) (bool, error) {
+	for _, u := range s.segments[segmentID] {
+		if u == userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func TestJobRun(t *testing.T) {
+	idx, seeds := newIndex()
+	store := &memoryStore{
+		segments: map[string][]string{"gamers": seeds, "inactive": {"unknown"}},
+		ttls:     map[string]time.Duration{},
+	}
+	job := segment.NewJob(store, time.Hour, "")
+
+	opts := segment.DefaultExpandOptions()
+	opts.Ratio = 0.2
+	reports := job.Run(context.Background(), idx, []segment.Seed{
+		{ID: "gamers", Options: opts},
+		{ID: "inactive", Options: opts},
+		{ID: "missing", Options: opts},
+	}, false)
+	if len(reports) != 3 {
+		t.Fatalf("reports = %d, want 3", len(reports))
+	}
+
+	// 扩展人群包包含种子用户和扩展的用户
+	if r := reports[0]; r.Err != nil || r.TargetID != "gamers:lookalike" || r.Written != 12 {
+		t.Fatalf("gamers report = %+v", r)
+	}
+	if got := store.segments["gamers:lookalike"]; len(got) != 12 || got[10] != "o01" || got[11] != "o02" {
+		t.Fatalf("gamers:lookalike = %v", got)
+	}
+	if store.ttls["gamers:lookalike"] != time.Hour {
+		t.Fatalf("ttl = %v, want 1h", store.ttls["gamers:lookalike"])
+	}
+
+	// 没有扩展出用户时不写入
+	if r := reports[1]; r.Err != nil || r.Written != 0 {
+		t.Fatalf("inactive report = %+v", r)
+	}
+	if _, ok := store.segments["inactive:lookalike"]; ok {
+		t.Fatal("没有扩展出用户时不应写入")
+	}
+
+	if r := reports[2]; !errors.Is(r.Err, segment.ErrEmptySeed) {
+		t.Fatalf("missing err = %v, want ErrEmptySeed", r.Err)
+	}
+}
+
+func TestJobDryRun(t *testing.T) {
+	idx, seeds := newIndex()
+	store := &memoryStore{segments: map[string][]string{"gamers": seeds}, ttls: map[string]time.Duration{}}
+
+	reports := segment.NewJob(store, 0, ":lal").Run(context.Background(), idx,
+		[]segment.Seed{{ID: "gamers", Options: segment.DefaultExpandOptions()}}, true)
+	if r := reports[0]; r.Err != nil || r.TargetID != "gamers:lal" || len(r.Expansion.Users) == 0 || r.Written != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	if len(store.segments) != 1 {
+		t.Fatal("dry-run不应写入人群包")
+	}
+}
+
+func TestFromEvent(t *testing.T) {
+	cases := []struct {
+		event stats.Event
+		want  segment.Interaction
+		ok    bool
+	}{
+		{stats.Event{EventType: stats.EventImpression, UserID: "u1", AdID: "1"}, segment.Interaction{UserID: "u1", CampaignID: "1"}, true},
+		{stats.Event{EventType: stats.EventClick, UserID: "u1", AdID: "1"}, segment.Interaction{UserID: "u1", CampaignID: "1", Clicked: true}, true},
+		{stats.Event{EventType: stats.EventConversion, UserID: "u1", AdID: "1"}, segment.Interaction{}, false},
+		{stats.Event{EventType: stats.EventClick, AdID: "1"}, segment.Interaction{}, false},
+	}
+	for _, tc := range cases {
+		got, ok := segment.FromEvent(&tc.event)
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("FromEvent(%s) = %+v, %v; want %+v, %v", tc.event.EventType, got, ok, tc.want, tc.ok)
+		}
+	}
+}
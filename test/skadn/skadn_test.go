@@ -0,0 +1,291 @@
+package skadn_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-dsp/internal/skadn"
+)
+
+const networkID = "example123.skadnetwork"
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	return key
+}
+
+func newSigner(t *testing.T, key *ecdsa.PrivateKey, versions []string) *skadn.Signer {
+	t.Helper()
+	signer, err := skadn.NewSigner(networkID, key, versions)
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	return signer
+}
+
+// verify 按U+2063拼接字段并校验签名
+func verify(t *testing.T, key *ecdsa.PublicKey, signature string, fields ...string) bool {
+	t.Helper()
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatalf("签名不是base64: %v", err)
+	}
+	digest := sha256.Sum256([]byte(strings.Join(fields, "\u2063")))
+	return ecdsa.VerifyASN1(key, digest[:], sig)
+}
+
+func testRequest() *skadn.Request {
+	return &skadn.Request{
+		Versions:   []string{"2.0", "2.2", "3.0", "4.0"},
+		SourceApp:  "880047117",
+		SKAdNetIDs: []string{"other.skadnetwork", "EXAMPLE123.skadnetwork"},
+	}
+}
+
+func testCampaign() *skadn.Campaign {
+	return &skadn.Campaign{ITunesItemID: "1234567891", CampaignID: 42, SourceIdentifier: 5342}
+}
+
+func TestSignV4(t *testing.T) {
+	key := newKey(t)
+	now := time.UnixMilli(1700000000123)
+
+	resp, err := newSigner(t, key, nil).Sign(testRequest(), testCampaign(), now)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if resp.Version != "4.0" || resp.SourceIdentifier != "5342" || resp.Campaign != "" {
+		t.Fatalf("resp = %+v, want 4.0 with sourceidentifier", resp)
+	}
+	if len(resp.Fidelities) != 1 || resp.Signature != "" {
+		t.Fatalf("4.0应通过fidelities返回签名: %+v", resp)
+	}
+
+	f := resp.Fidelities[0]
+	if f.Fidelity != skadn.FidelityStoreKit || f.Timestamp != "1700000000123" || len(f.Nonce) != 36 {
+		t.Fatalf("fidelity = %+v", f)
+	}
+	if !verify(t, &key.PublicKey, f.Signature, "4.0", networkID, "5342", "1234567891", f.Nonce, "880047117", "1", f.Timestamp) {
+		t.Fatal("签名校验失败")
+	}
+}
+
+func TestSignLegacyVersions(t *testing.T) {
+	key := newKey(t)
+
+	resp, err := newSigner(t, key, []string{"2.0", "3.0"}).Sign(testRequest(), testCampaign(), time.Now())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if resp.Version != "3.0" || resp.Campaign != "42" || resp.SourceIdentifier != "" {
+		t.Fatalf("resp = %+v, want 3.0 with campaign", resp)
+	}
+	f := resp.Fidelities[0]
+	if !verify(t, &key.PublicKey, f.Signature, "3.0", networkID, "42", "1234567891", f.Nonce, "880047117", "1", f.Timestamp) {
+		t.Fatal("3.0签名校验失败")
+	}
+
+	req := testRequest()
+	req.Versions = nil
+	req.Version = "2.0"
+	resp, err = newSigner(t, key, []string{"2.0", "3.0"}).Sign(req, testCampaign(), time.Now())
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if len(resp.Fidelities) != 0 || resp.Signature == "" {
+		t.Fatalf("2.0应在顶层返回签名: %+v", resp)
+	}
+	if !verify(t, &key.PublicKey, resp.Signature, "2.0", networkID, "42", "1234567891", resp.Nonce, "880047117", resp.Timestamp) {
+		t.Fatal("2.0签名校验失败")
+	}
+}
+
+func TestSignNotEligible(t *testing.T) {
+	signer := newSigner(t, newKey(t), nil)
+
+	unlisted := testRequest()
+	unlisted.SKAdNetIDs = []string{"other.skadnetwork"}
+	if _, err := signer.Sign(unlisted, testCampaign(), time.Now()); !errors.Is(err, skadn.ErrNotEligible) {
+		t.Fatalf("未列出本网络 err = %v, want ErrNotEligible", err)
+	}
+
+	old := testRequest()
+	old.Versions = []string{"1.0"}
+	if _, err := signer.Sign(old, testCampaign(), time.Now()); !errors.Is(err, skadn.ErrNotEligible) {
+		t.Fatalf("没有共同版本 err = %v, want ErrNotEligible", err)
+	}
+
+	// 未配置计划ID的广告只参与4.0
+	v4Only := &skadn.Campaign{ITunesItemID: "1234567891", SourceIdentifier: 7}
+	legacy := testRequest()
+	legacy.Versions = []string{"2.2", "3.0"}
+	if _, err := signer.Sign(legacy, v4Only, time.Now()); !errors.Is(err, skadn.ErrNotEligible) {
+		t.Fatalf("err = %v, want ErrNotEligible", err)
+	}
+	if _, err := signer.Sign(testRequest(), nil, time.Now()); !errors.Is(err, skadn.ErrNotEligible) {
+		t.Fatalf("广告未配置 err = %v, want ErrNotEligible", err)
+	}
+}
+
+func TestNewSignerRejectsUnsupported(t *testing.T) {
+	if _, err := skadn.NewSigner(networkID, newKey(t), []string{"5.0"}); !errors.Is(err, skadn.ErrUnsupportedVersion) {
+		t.Fatalf("err = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err := skadn.NewSigner("", newKey(t), nil); !errors.Is(err, skadn.ErrMissingNetworkID) {
+		t.Fatalf("err = %v, want ErrMissingNetworkID", err)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key := newKey(t)
+
+	sec1, _ := x509.MarshalECPrivateKey(key)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	for name, block := range map[string]*pem.Block{
+		"sec1":  {Type: "EC PRIVATE KEY", Bytes: sec1},
+		"pkcs8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := skadn.ParsePrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !parsed.Equal(key) {
+			t.Fatalf("%s: 解析结果与原私钥不同", name)
+		}
+	}
+
+	if _, err := skadn.ParsePrivateKey([]byte("not a key")); !errors.Is(err, skadn.ErrInvalidKey) {
+		t.Fatalf("err = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestCampaignValidate(t *testing.T) {
+	cases := []struct {
+		campaign skadn.Campaign
+		want     error
+	}{
+		{skadn.Campaign{ITunesItemID: "1234567891", CampaignID: 1, SourceIdentifier: 9999}, nil},
+		{skadn.Campaign{ITunesItemID: "1234567891"}, nil},
+		{skadn.Campaign{ITunesItemID: "com.example.app", CampaignID: 1}, skadn.ErrInvalidITunesItem},
+		{skadn.Campaign{ITunesItemID: "1234567891", CampaignID: 101}, skadn.ErrInvalidCampaign},
+		{skadn.Campaign{ITunesItemID: "1234567891", SourceIdentifier: 10000}, skadn.ErrInvalidCampaign},
+	}
+	for _, tc := range cases {
+		if err := tc.campaign.Validate(); !errors.Is(err, tc.want) {
+			t.Errorf("Validate(%+v) = %v, want %v", tc.campaign, err, tc.want)
+		}
+	}
+}
+
+// applePostback 4.0回传，签名字段与Apple文档顺序一致
+const applePostback = `{
+	"version": "4.0",
+	"ad-network-id": "example123.skadnetwork",
+	"source-identifier": "5342",
+	"app-id": 1234567891,
+	"transaction-id": "6aafb7a5-0170-41b5-bbe4-fe71dedf1e31",
+	"redownload": false,
+	"source-app-id": 880047117,
+	"fidelity-type": 1,
+	"did-win": true,
+	"conversion-value": 63,
+	"postback-sequence-index": 0
+}`
+
+// signPostback 使用测试密钥为回传签名
+func signPostback(t *testing.T, key *ecdsa.PrivateKey, p *skadn.Postback) {
+	t.Helper()
+	fields := []string{"4.0", p.AdNetworkID, p.SourceIdentifier, "1234567891", p.TransactionID, "false", "880047117", "1", "true", "0"}
+	digest := sha256.Sum256([]byte(strings.Join(fields, "\u2063")))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("SignASN1: %v", err)
+	}
+	p.AttributionSignature = base64.StdEncoding.EncodeToString(sig)
+}
+
+func newVerifier(t *testing.T, key *ecdsa.PrivateKey) *skadn.Verifier {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey: %v", err)
+	}
+	verifier, err := skadn.NewVerifier(map[string]string{"4": base64.StdEncoding.EncodeToString(der)})
+	if err != nil {
+		t.Fatalf("NewVerifier: %v", err)
+	}
+	return verifier
+}
+
+func TestVerifyPostback(t *testing.T) {
+	apple := newKey(t)
+	verifier := newVerifier(t, apple)
+
+	var p skadn.Postback
+	if err := json.Unmarshal([]byte(applePostback), &p); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	signPostback(t, apple, &p)
+
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if err := verifier.Verify(&p); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// 篡改未签名的转化值不影响校验，篡改签名字段则失败
+	value := 1
+	p.ConversionValue = &value
+	if err := verifier.Verify(&p); err != nil {
+		t.Fatalf("转化值不在签名范围内: %v", err)
+	}
+	p.SourceIdentifier = "5343"
+	if err := verifier.Verify(&p); !errors.Is(err, skadn.ErrInvalidSignature) {
+		t.Fatalf("err = %v, want ErrInvalidSignature", err)
+	}
+
+	p.Version = "3.0"
+	if err := verifier.Verify(&p); !errors.Is(err, skadn.ErrNoVerificationKey) {
+		t.Fatalf("err = %v, want ErrNoVerificationKey", err)
+	}
+}
+
+func TestCampaignMatchesPostback(t *testing.T) {
+	campaign := testCampaign()
+	campaignID := 42
+	otherID := 43
+
+	cases := []struct {
+		name     string
+		postback skadn.Postback
+		want     bool
+	}{
+		{"完整来源标识", skadn.Postback{AppID: 1234567891, SourceIdentifier: "5342"}, true},
+		{"截断为3位", skadn.Postback{AppID: 1234567891, SourceIdentifier: "342"}, true},
+		{"截断为2位", skadn.Postback{AppID: 1234567891, SourceIdentifier: "42"}, true},
+		{"来源不同", skadn.Postback{AppID: 1234567891, SourceIdentifier: "5343"}, false},
+		{"应用不同", skadn.Postback{AppID: 1, SourceIdentifier: "5342"}, false},
+		{"旧版本计划ID", skadn.Postback{AppID: 1234567891, CampaignID: &campaignID}, true},
+		{"旧版本计划ID不同", skadn.Postback{AppID: 1234567891, CampaignID: &otherID}, false},
+	}
+	for _, tc := range cases {
+		if got := campaign.Matches(&tc.postback); got != tc.want {
+			t.Errorf("%s: Matches = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package slowlog_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"simple-dsp/pkg/clients"
+	"simple-dsp/pkg/logger"
+)
+
+func newObservedLogger() (*logger.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.WarnLevel)
+	return logger.NewLogger(zap.New(core)), logs
+}
+
+func TestTimings(t *testing.T) {
+	timings := logger.NewTimings()
+	ctx := logger.WithTimings(context.Background(), timings)
+
+	logger.TimingsFromContext(ctx).Add("parse", 2*time.Millisecond)
+	logger.TimingsFromContext(ctx).Add("budget", 1500*time.Microsecond)
+	logger.TimingsFromContext(ctx).Add("budget", 500*time.Microsecond)
+
+	got := timings.Milliseconds()
+	if got["parse"] != 2 || got["budget"] != 2 || len(got) != 2 {
+		t.Fatalf("Milliseconds() = %v", got)
+	}
+
+	// 上下文没有阶段耗时时忽略记录
+	none := logger.TimingsFromContext(context.Background())
+	none.Add("parse", time.Millisecond)
+	if none.Milliseconds() != nil {
+		t.Fatal("nil Timings应返回nil")
+	}
+}
+
+func TestRedisSlowLogHook(t *testing.T) {
+	log, logs := newObservedLogger()
+	hook := clients.NewSlowLogHook(5*time.Millisecond, log)
+
+	// 未超过阈值不记录
+	fast := redis.NewStringCmd(context.Background(), "get", "user:profile:u1")
+	ctx, _ := hook.BeforeProcess(context.Background(), fast)
+	hook.AfterProcess(ctx, fast)
+	if logs.Len() != 0 {
+		t.Fatalf("未超过阈值时不应记录: %v", logs.All())
+	}
+
+	slow := redis.NewStatusCmd(context.Background(), "set", "user:profile:u1", "secret")
+	ctx, _ = hook.BeforeProcess(context.Background(), slow)
+	time.Sleep(10 * time.Millisecond)
+	hook.AfterProcess(ctx, slow)
+
+	entries := logs.TakeAll()
+	if len(entries) != 1 || entries[0].Message != "慢Redis命令" {
+		t.Fatalf("entries = %v", entries)
+	}
+	fields := entries[0].ContextMap()
+	if fields["command"] != "set" || fields["key"] != "user:profile:u1" {
+		t.Fatalf("fields = %v", fields)
+	}
+	for _, v := range fields {
+		if v == "secret" {
+			t.Fatal("慢命令日志不应包含值")
+		}
+	}
+
+	cmds := []redis.Cmder{
+		redis.NewIntCmd(context.Background(), "hincrby", "k", "f", 1),
+		redis.NewBoolCmd(context.Background(), "expire", "k", 60),
+	}
+	ctx, _ = hook.BeforeProcessPipeline(context.Background(), cmds)
+	time.Sleep(10 * time.Millisecond)
+	hook.AfterProcessPipeline(ctx, cmds)
+	entries = logs.TakeAll()
+	if len(entries) != 1 || entries[0].Message != "慢Redis管道" || entries[0].ContextMap()["count"] != int64(2) {
+		t.Fatalf("entries = %v", entries)
+	}
+}
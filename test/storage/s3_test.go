@@ -0,0 +1,269 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"simple-dsp/internal/creative/storage"
+)
+
+// fakeS3 内存实现的S3服务，支持对象读写、列举、分段上传和分段复制
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	nextID  int
+	ops     map[string]int
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{bucket: "creatives", objects: map[string][]byte{}, uploads: map[string]map[int][]byte{}, ops: map[string]int{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) op(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ops[name]
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		s3Fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	bucket, key, _ := strings.Cut(path, "/")
+	if bucket != f.bucket {
+		s3Fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.ops["list"]++
+		f.list(w, q)
+	case r.Method == http.MethodGet:
+		f.ops["get"]++
+		data, ok := f.objects[key]
+		if !ok {
+			s3Fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		parts, ok := f.uploads[q.Get("uploadId")]
+		if !ok {
+			s3Fail(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		data := body
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			f.ops["copy"]++
+			src, _ := url.PathUnescape(strings.TrimPrefix(source, "/"+f.bucket+"/"))
+			if data, ok = f.objects[src]; !ok {
+				s3Fail(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			parts[n] = data
+			fmt.Fprintf(w, `<CopyPartResult><ETag>"etag-%d"</ETag></CopyPartResult>`, n)
+			return
+		}
+		f.ops["part"]++
+		parts[n] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPut:
+		f.ops["put"]++
+		f.objects[key] = body
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = map[int][]byte{}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, id)
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		f.complete(w, key, q.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		f.ops["abort"]++
+		delete(f.uploads, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		f.ops["delete"]++
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3Fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// list 按字典序列举对象，每页最多2个以覆盖翻页
+func (f *fakeS3) list(w http.ResponseWriter, q url.Values) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, q.Get("prefix")) && key > q.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	truncated := len(keys) > 2
+	if truncated {
+		keys = keys[:2]
+	}
+	fmt.Fprint(w, `<ListBucketResult>`)
+	for _, key := range keys {
+		fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, key)
+	}
+	if truncated {
+		fmt.Fprintf(w, `<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>`, keys[len(keys)-1])
+	}
+	fmt.Fprint(w, `</ListBucketResult>`)
+}
+
+// complete 按请求中的分段顺序合并，除最后一段外每段不能小于5MB
+func (f *fakeS3) complete(w http.ResponseWriter, key, uploadID string, body []byte) {
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		s3Fail(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var req struct {
+		Parts []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		s3Fail(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var merged bytes.Buffer
+	for i, p := range req.Parts {
+		data := parts[p.PartNumber]
+		if i < len(req.Parts)-1 && len(data) < 5<<20 {
+			// 与S3一致，合并时的错误以200返回
+			fmt.Fprint(w, `<Error><Code>EntityTooSmall</Code><Message>part too small</Message></Error>`)
+			return
+		}
+		merged.Write(data)
+	}
+	f.objects[key] = merged.Bytes()
+	delete(f.uploads, uploadID)
+	fmt.Fprintf(w, `<CompleteMultipartUploadResult><Key>%s</Key></CompleteMultipartUploadResult>`, key)
+}
+
+func s3Fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+func newS3Storage(t *testing.T, endpoint string) *storage.S3Storage {
+	t.Helper()
+	s, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint: endpoint, Region: "us-east-1", Bucket: "creatives", AccessKey: "AK", SecretKey: "SK",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage() error = %v", err)
+	}
+	return s
+}
+
+func TestS3Storage(t *testing.T) {
+	runConformance(t, func(t *testing.T) storage.Storage {
+		_, srv := newFakeS3(t)
+		return newS3Storage(t, srv.URL)
+	})
+}
+
+func TestS3StorageMultipart(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	s := newS3Storage(t, srv.URL)
+
+	// 超过分段大小的流使用分段上传
+	large := bytes.Repeat([]byte("0123456789"), (8<<20)/10+1000)
+	if err := s.SaveStream(ctx, "uploads/u1/chunk_0", bytes.NewReader(large)); err != nil {
+		t.Fatalf("SaveStream(large) error = %v", err)
+	}
+	if fake.op("part") != 2 || !bytes.Equal(fake.objects["uploads/u1/chunk_0"], large) {
+		t.Fatalf("parts = %d, size = %d, want 2 parts", fake.op("part"), len(fake.objects["uploads/u1/chunk_0"]))
+	}
+
+	// 分片不小于5MB时在服务端复制合并
+	chunk := bytes.Repeat([]byte("a"), 5<<20)
+	mustSave(t, s, "uploads/u2/chunk_0", string(chunk))
+	mustSave(t, s, "uploads/u2/chunk_1", "tail")
+	chunks := []*storage.ChunkInfo{
+		{ChunkIndex: 0, ChunkSize: 5 << 20, ChunkPath: "uploads/u2/chunk_0"},
+		{ChunkIndex: 1, ChunkSize: 5 << 20, ChunkPath: "uploads/u2/chunk_1"},
+	}
+	gets := fake.op("get")
+	if err := s.MergeFiles(ctx, "creatives/video.mp4", chunks); err != nil {
+		t.Fatalf("MergeFiles() error = %v", err)
+	}
+	if fake.op("copy") != 2 || fake.op("get") != gets {
+		t.Errorf("copy = %d, get = %d, want 2 copies without download", fake.op("copy"), fake.op("get")-gets)
+	}
+	if want := append(chunk, "tail"...); !bytes.Equal(fake.objects["creatives/video.mp4"], want) {
+		t.Errorf("merged size = %d, want %d", len(fake.objects["creatives/video.mp4"]), len(want))
+	}
+
+	// 分片大小登记错误导致合并失败时取消分段上传
+	mustSave(t, s, "uploads/u3/chunk_0", "small")
+	bad := []*storage.ChunkInfo{
+		{ChunkIndex: 0, ChunkSize: 5 << 20, ChunkPath: "uploads/u3/chunk_0"},
+		{ChunkIndex: 1, ChunkSize: 5 << 20, ChunkPath: "uploads/u2/chunk_1"},
+	}
+	if err := s.MergeFiles(ctx, "creatives/bad.mp4", bad); err == nil || !strings.Contains(err.Error(), "EntityTooSmall") {
+		t.Errorf("MergeFiles(bad) err = %v, want EntityTooSmall", err)
+	}
+	if fake.op("abort") != 1 || len(fake.uploads) != 0 {
+		t.Errorf("abort = %d, uploads = %d, want aborted", fake.op("abort"), len(fake.uploads))
+	}
+}
+
+func TestS3StorageURL(t *testing.T) {
+	ctx := context.Background()
+	s := newS3Storage(t, "https://s3.us-east-1.amazonaws.com/")
+	if got, _ := s.GetURL(ctx, "creatives/a b+c.png"); got != "https://s3.us-east-1.amazonaws.com/creatives/creatives/a%20b%2Bc.png" {
+		t.Errorf("GetURL() = %q", got)
+	}
+
+	cdn, err := storage.NewS3Storage(storage.S3Config{
+		Endpoint: "https://s3.us-east-1.amazonaws.com", Region: "us-east-1", Bucket: "creatives", BaseURL: "https://cdn.example.com/",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage() error = %v", err)
+	}
+	if got, _ := cdn.GetURL(ctx, "creatives/a.png"); got != "https://cdn.example.com/creatives/a.png" {
+		t.Errorf("GetURL() = %q", got)
+	}
+
+	if _, err := storage.NewS3Storage(storage.S3Config{Endpoint: "https://s3", Region: "us-east-1", Bucket: "b", PartSize: 1 << 20}); err == nil {
+		t.Error("NewS3Storage() 分段小于5MB时应返回错误")
+	}
+}
@@ -0,0 +1,223 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"simple-dsp/internal/creative/storage"
+	"simple-dsp/internal/creative/types"
+)
+
+var (
+	_ storage.Storage = (*storage.LocalStorage)(nil)
+	_ storage.Storage = (*storage.S3Storage)(nil)
+)
+
+// runConformance 各存储实现共用的接口一致性测试
+func runConformance(t *testing.T, newStorage func(t *testing.T) storage.Storage) {
+	ctx := context.Background()
+
+	t.Run("SaveStream和Open", func(t *testing.T) {
+		s := newStorage(t)
+		if err := s.SaveStream(ctx, "creatives/a.txt", strings.NewReader("hello")); err != nil {
+			t.Fatalf("SaveStream() error = %v", err)
+		}
+		if got := read(t, s, "creatives/a.txt"); got != "hello" {
+			t.Errorf("Open() = %q, want hello", got)
+		}
+		// 覆盖已有文件
+		if err := s.SaveStream(ctx, "/creatives//a.txt", strings.NewReader("world")); err != nil {
+			t.Fatalf("SaveStream() error = %v", err)
+		}
+		if got := read(t, s, "creatives/a.txt"); got != "world" {
+			t.Errorf("Open() = %q, want world", got)
+		}
+		if _, err := s.Open(ctx, "creatives/missing.txt"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Open(missing) err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("写入失败不覆盖已有文件", func(t *testing.T) {
+		s := newStorage(t)
+		mustSave(t, s, "a.txt", "old")
+		broken := io.MultiReader(strings.NewReader("new"), errReader{})
+		if err := s.SaveStream(ctx, "a.txt", broken); err == nil {
+			t.Fatal("SaveStream() 读取失败时应返回错误")
+		}
+		if got := read(t, s, "a.txt"); got != "old" {
+			t.Errorf("Open() = %q, want old", got)
+		}
+	})
+
+	t.Run("无效路径", func(t *testing.T) {
+		s := newStorage(t)
+		for _, p := range []string{"", "/", "../a.txt", "a/../../b.txt", `a\b.txt`} {
+			if err := s.SaveStream(ctx, p, strings.NewReader("x")); !errors.Is(err, storage.ErrInvalidPath) {
+				t.Errorf("SaveStream(%q) err = %v, want ErrInvalidPath", p, err)
+			}
+		}
+	})
+
+	t.Run("MergeFiles", func(t *testing.T) {
+		s := newStorage(t)
+		chunks := []*storage.ChunkInfo{
+			{ChunkIndex: 0, ChunkSize: 4, ChunkPath: "uploads/u1/chunk_0"},
+			{ChunkIndex: 1, ChunkSize: 4, ChunkPath: "uploads/u1/chunk_1"},
+			{ChunkIndex: 2, ChunkSize: 4, ChunkPath: "uploads/u1/chunk_2"},
+		}
+		for i, data := range []string{"aaaa", "bbbb", "cc"} {
+			mustSave(t, s, chunks[i].ChunkPath, data)
+		}
+		if err := s.MergeFiles(ctx, "creatives/merged.bin", chunks); err != nil {
+			t.Fatalf("MergeFiles() error = %v", err)
+		}
+		if got := read(t, s, "creatives/merged.bin"); got != "aaaabbbbcc" {
+			t.Errorf("merged = %q, want aaaabbbbcc", got)
+		}
+		// 分片保持不变
+		if got := read(t, s, "uploads/u1/chunk_1"); got != "bbbb" {
+			t.Errorf("chunk_1 = %q, want bbbb", got)
+		}
+
+		missing := append(chunks, &storage.ChunkInfo{ChunkIndex: 3, ChunkSize: 4, ChunkPath: "uploads/u1/chunk_3"})
+		if err := s.MergeFiles(ctx, "creatives/broken.bin", missing); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("MergeFiles(missing chunk) err = %v, want ErrNotFound", err)
+		}
+		if _, err := s.Open(ctx, "creatives/broken.bin"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("合并失败时不应生成目标文件, err = %v", err)
+		}
+	})
+
+	t.Run("DeleteDir和Delete", func(t *testing.T) {
+		s := newStorage(t)
+		for _, p := range []string{"uploads/u1/chunk_0", "uploads/u1/chunk_1", "uploads/u1/sub/chunk_2", "uploads/u10/chunk_0", "uploads/other.txt"} {
+			mustSave(t, s, p, p)
+		}
+		if err := s.DeleteDir(ctx, "uploads/u1"); err != nil {
+			t.Fatalf("DeleteDir() error = %v", err)
+		}
+		for _, p := range []string{"uploads/u1/chunk_0", "uploads/u1/sub/chunk_2"} {
+			if _, err := s.Open(ctx, p); !errors.Is(err, storage.ErrNotFound) {
+				t.Errorf("Open(%s) err = %v, want ErrNotFound", p, err)
+			}
+		}
+		// 前缀相同的其他目录不受影响
+		if got := read(t, s, "uploads/u10/chunk_0"); got != "uploads/u10/chunk_0" {
+			t.Errorf("uploads/u10/chunk_0 = %q", got)
+		}
+		if err := s.DeleteDir(ctx, "uploads/missing"); err != nil {
+			t.Errorf("DeleteDir(missing) error = %v", err)
+		}
+
+		if err := s.Delete(ctx, "uploads/other.txt"); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+		if _, err := s.Open(ctx, "uploads/other.txt"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Open(deleted) err = %v, want ErrNotFound", err)
+		}
+		if err := s.Delete(ctx, "uploads/other.txt"); err != nil {
+			t.Errorf("Delete(missing) error = %v", err)
+		}
+	})
+
+	t.Run("Save上传文件", func(t *testing.T) {
+		s := newStorage(t)
+		if err := s.Save(ctx, "creatives/upload.html", fileHeader(t, "upload.html", "<p>广告</p>")); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+		if got := read(t, s, "creatives/upload.html"); got != "<p>广告</p>" {
+			t.Errorf("Open() = %q", got)
+		}
+	})
+
+	t.Run("素材信息", func(t *testing.T) {
+		s := newStorage(t)
+		c := &types.Creative{ID: "c1", Title: "素材", Type: "html", Content: "<p>广告</p>", Status: "pending"}
+		if err := s.SaveCreative(ctx, c); err != nil {
+			t.Fatalf("SaveCreative() error = %v", err)
+		}
+		got, err := s.GetCreative(ctx, "c1")
+		if err != nil || got.Title != c.Title || got.Content != c.Content || got.Status != c.Status {
+			t.Errorf("GetCreative() = %+v, %v", got, err)
+		}
+		if _, err := s.GetCreative(ctx, "missing"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("GetCreative(missing) err = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("GetURL", func(t *testing.T) {
+		s := newStorage(t)
+		got, err := s.GetURL(ctx, "creatives/20260101/a b.png")
+		if err != nil || !strings.HasPrefix(got, "http") || !strings.Contains(got, "creatives/20260101/a") {
+			t.Errorf("GetURL() = %q, %v", got, err)
+		}
+	})
+}
+
+func TestLocalStorage(t *testing.T) {
+	runConformance(t, func(t *testing.T) storage.Storage {
+		s, err := storage.NewLocalStorage(t.TempDir(), "https://cdn.example.com/")
+		if err != nil {
+			t.Fatalf("NewLocalStorage() error = %v", err)
+		}
+		return s
+	})
+
+	s, _ := storage.NewLocalStorage(t.TempDir(), "https://cdn.example.com/")
+	if got, _ := s.GetURL(context.Background(), "/creatives/a.png"); got != "https://cdn.example.com/creatives/a.png" {
+		t.Errorf("GetURL() = %q", got)
+	}
+}
+
+// errReader 读取时总是失败
+type errReader struct{}
+
+func (errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("连接中断")
+}
+
+func mustSave(t *testing.T, s storage.Storage, path, data string) {
+	t.Helper()
+	if err := s.SaveStream(context.Background(), path, strings.NewReader(data)); err != nil {
+		t.Fatalf("SaveStream(%s) error = %v", path, err)
+	}
+}
+
+func read(t *testing.T, s storage.Storage, path string) string {
+	t.Helper()
+	r, err := s.Open(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Open(%s) error = %v", path, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll(%s) error = %v", path, err)
+	}
+	return string(data)
+}
+
+// fileHeader 构造上传文件
+func fileHeader(t *testing.T, name, content string) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["file"][0]
+}
@@ -0,0 +1,202 @@
+package supplychain_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/supplychain"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// adsTxt 媒体的ads.txt，%s为测试服务器的域名，测试服务器同时作为广告系统提供sellers.json
+const adsTxt = `# 媒体的授权卖方
+%s, pub-1, DIRECT, abc123
+Reseller.Example, 42, reseller
+broken line
+contact=ads@example.com
+`
+
+const sellersJSON = `{"sellers": [
+	{"seller_id": "pub-1", "seller_type": "PUBLISHER"},
+	{"seller_id": "42", "seller_type": "INTERMEDIARY"}
+]}`
+
+// newFileServer 提供ads.txt和sellers.json，app-ads.txt不存在，返回服务器的域名
+func newFileServer(t *testing.T) string {
+	t.Helper()
+	var host string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ads.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, adsTxt, host)
+	})
+	mux.HandleFunc("/sellers.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sellersJSON))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	host = strings.TrimPrefix(server.URL, "http://")
+	return host
+}
+
+func newValidator(t *testing.T, cfg config.SupplyChainConfig) (*supplychain.Validator, *metrics.Metrics) {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "i1"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	cfg.Enabled = true
+	cfg.Scheme = "http"
+	return supplychain.NewValidator(cfg, logger.NewLogger(zap.NewNop()), m), m
+}
+
+func chain(nodes ...supplychain.Node) *supplychain.SupplyChain {
+	return &supplychain.SupplyChain{Complete: 1, Ver: "1.0", Nodes: nodes}
+}
+
+func TestSupplyChain_Validate(t *testing.T) {
+	node := supplychain.Node{ASI: "exchange.example", SID: "pub-1", HP: 1}
+	tests := []struct {
+		name  string
+		chain *supplychain.SupplyChain
+		want  error
+	}{
+		{name: "有效", chain: chain(node)},
+		{name: "版本错误", chain: &supplychain.SupplyChain{Ver: "2.0", Nodes: []supplychain.Node{node}}, want: supplychain.ErrInvalidVersion},
+		{name: "没有节点", chain: chain(), want: supplychain.ErrNoNodes},
+		{name: "缺少sid", chain: chain(supplychain.Node{ASI: "exchange.example", HP: 1}), want: supplychain.ErrInvalidNode},
+		{name: "hp不为1", chain: chain(supplychain.Node{ASI: "exchange.example", SID: "pub-1"}), want: supplychain.ErrInvalidNode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.chain.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_Verify(t *testing.T) {
+	host := newFileServer(t)
+	v, _ := newValidator(t, config.SupplyChainConfig{VerifyAdsTxt: true, VerifySellers: true})
+	ctx := context.Background()
+	if err := v.Fetch(ctx, supplychain.KindAdsTxt, host); err != nil {
+		t.Fatalf("Fetch(ads.txt) error = %v", err)
+	}
+	if err := v.Fetch(ctx, supplychain.KindSellers, host); err != nil {
+		t.Fatalf("Fetch(sellers.json) error = %v", err)
+	}
+
+	site := &supplychain.Publisher{Domain: host}
+	tests := []struct {
+		name      string
+		chain     *supplychain.SupplyChain
+		publisher *supplychain.Publisher
+		want      string
+	}{
+		{name: "未携带供应链", want: supplychain.StatusAbsent},
+		{name: "格式无效", chain: chain(), publisher: site, want: supplychain.StatusInvalid},
+		{
+			name:      "不完整",
+			chain:     &supplychain.SupplyChain{Ver: "1.0", Nodes: []supplychain.Node{{ASI: host, SID: "pub-1", HP: 1}}},
+			publisher: site,
+			want:      supplychain.StatusIncomplete,
+		},
+		{
+			name:      "全部节点已授权",
+			chain:     chain(supplychain.Node{ASI: host, SID: "pub-1", HP: 1}, supplychain.Node{ASI: host, SID: "42", HP: 1}),
+			publisher: site,
+			want:      supplychain.StatusAuthorized,
+		},
+		{
+			name:      "第一个节点不在ads.txt中",
+			chain:     chain(supplychain.Node{ASI: host, SID: "42", HP: 1}),
+			publisher: site,
+			want:      supplychain.StatusUnauthorized,
+		},
+		{
+			name:      "节点不在sellers.json中",
+			chain:     chain(supplychain.Node{ASI: host, SID: "pub-1", HP: 1}, supplychain.Node{ASI: host, SID: "99", HP: 1}),
+			publisher: site,
+			want:      supplychain.StatusUnauthorized,
+		},
+		{
+			name:  "没有媒体信息时无法验证ads.txt",
+			chain: chain(supplychain.Node{ASI: host, SID: "pub-1", HP: 1}),
+			want:  supplychain.StatusUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := v.Verify(tt.chain, tt.publisher); got != tt.want {
+				t.Errorf("Verify() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidator_SellersOnly(t *testing.T) {
+	host := newFileServer(t)
+	v, _ := newValidator(t, config.SupplyChainConfig{VerifySellers: true})
+	if err := v.Fetch(context.Background(), supplychain.KindSellers, host); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	// 未启用ads.txt验证时不需要媒体信息
+	if got := v.Verify(chain(supplychain.Node{ASI: strings.ToUpper(host), SID: "42", HP: 1}), nil); got != supplychain.StatusAuthorized {
+		t.Errorf("Verify() = %s, want authorized", got)
+	}
+}
+
+func TestValidator_BackgroundFetch(t *testing.T) {
+	host := newFileServer(t)
+	v, m := newValidator(t, config.SupplyChainConfig{VerifyAdsTxt: true, VerifySellers: true})
+	v.Start()
+	defer v.Stop()
+
+	// 缓存中没有的文件加入抓取队列，抓取完成前结果为unknown
+	c := chain(supplychain.Node{ASI: host, SID: "pub-1", HP: 1})
+	publisher := &supplychain.Publisher{Domain: host}
+	if got := v.Verify(c, publisher); got != supplychain.StatusUnknown {
+		t.Fatalf("Verify() = %s, want unknown", got)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for v.Verify(c, publisher) != supplychain.StatusAuthorized {
+		if time.Now().After(deadline) {
+			t.Fatalf("抓取后Verify() = %s, want authorized", v.Verify(c, publisher))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := testutil.ToFloat64(m.Exchange.SupplyChainFetches.WithLabelValues(supplychain.KindAdsTxt, "ok")); got != 1 {
+		t.Errorf("ads.txt抓取次数 = %v, want 1", got)
+	}
+}
+
+func TestValidator_AppAdsTxtNotFound(t *testing.T) {
+	host := newFileServer(t)
+	v, m := newValidator(t, config.SupplyChainConfig{VerifyAdsTxt: true})
+
+	// 应用按app-ads.txt验证，文件不存在时结果为unknown
+	err := v.Fetch(context.Background(), supplychain.KindAppAdsTxt, host)
+	if !errors.Is(err, supplychain.ErrFileNotFound) {
+		t.Fatalf("Fetch() error = %v, want ErrFileNotFound", err)
+	}
+	got := v.Verify(chain(supplychain.Node{ASI: host, SID: "pub-1", HP: 1}), &supplychain.Publisher{Domain: host, App: true})
+	if got != supplychain.StatusUnknown {
+		t.Errorf("Verify() = %s, want unknown", got)
+	}
+	if got := testutil.ToFloat64(m.Exchange.SupplyChainFetches.WithLabelValues(supplychain.KindAppAdsTxt, "not_found")); got != 1 {
+		t.Errorf("app-ads.txt未找到次数 = %v, want 1", got)
+	}
+}
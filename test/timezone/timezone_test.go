@@ -0,0 +1,106 @@
+package timezone_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/timezone"
+)
+
+func TestNew_Priority(t *testing.T) {
+	zones, err := timezone.New(config.TimezoneConfig{
+		Default: "UTC",
+		Advertisers: []config.AdvertiserTimezoneConfig{
+			{AdvertiserID: "adv-1", Timezone: "Asia/Tokyo", Campaigns: []string{"c1", "c2"}},
+		},
+		Campaigns: []config.CampaignTimezoneConfig{{CampaignID: "c2", Timezone: "America/Los_Angeles"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		loc  *time.Location
+		want string
+	}{
+		{"默认时区", zones.Default(), "UTC"},
+		{"广告主时区", zones.Advertiser("adv-1"), "Asia/Tokyo"},
+		{"未设置的广告主", zones.Advertiser("adv-2"), "UTC"},
+		{"使用广告主时区的推广计划", zones.Campaign("c1"), "Asia/Tokyo"},
+		{"单独设置的推广计划优先", zones.Campaign("c2"), "America/Los_Angeles"},
+		{"未设置的推广计划", zones.Campaign("c3"), "UTC"},
+	}
+	for _, tt := range tests {
+		if got := tt.loc.String(); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNew_Invalid(t *testing.T) {
+	for _, cfg := range []config.TimezoneConfig{
+		{Default: "Mars/Olympus"},
+		{Advertisers: []config.AdvertiserTimezoneConfig{{AdvertiserID: "adv-1"}}},
+		{Campaigns: []config.CampaignTimezoneConfig{{CampaignID: "c1", Timezone: "UTC+8"}}},
+	} {
+		if _, err := timezone.New(cfg); !errors.Is(err, timezone.ErrInvalidTimezone) {
+			t.Errorf("New(%+v) err = %v, want ErrInvalidTimezone", cfg, err)
+		}
+	}
+
+	// 未设置默认时区时使用服务器时区
+	zones, err := timezone.New(config.TimezoneConfig{})
+	if err != nil || zones.Default() != time.Local {
+		t.Fatalf("New() = %v, %v, want time.Local", zones.Default(), err)
+	}
+}
+
+func TestZones_Ad(t *testing.T) {
+	zones, err := timezone.New(config.TimezoneConfig{
+		Default:   "UTC",
+		Campaigns: []config.CampaignTimezoneConfig{{CampaignID: "c1", Timezone: "Asia/Tokyo"}},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if got := zones.Ad("ad1").String(); got != "UTC" {
+		t.Fatalf("未同步推广计划的广告时区 = %s, want UTC", got)
+	}
+	zones.SetAdCampaigns(map[string]string{"ad1": "c1", "ad2": ""})
+	if got := zones.Ad("ad1").String(); got != "Asia/Tokyo" {
+		t.Fatalf("广告ad1的时区 = %s, want Asia/Tokyo", got)
+	}
+
+	// 后续同步不包含的广告保留原来的推广计划
+	zones.SetAdCampaigns(map[string]string{"ad2": "c1"})
+	if zones.Ad("ad1").String() != "Asia/Tokyo" || zones.Ad("ad2").String() != "Asia/Tokyo" {
+		t.Fatalf("合并后的时区 = %s, %s", zones.Ad("ad1"), zones.Ad("ad2"))
+	}
+}
+
+func TestZones_Nil(t *testing.T) {
+	var zones *timezone.Zones
+	zones.SetAdCampaigns(map[string]string{"ad1": "c1"})
+	for _, loc := range []*time.Location{zones.Default(), zones.Advertiser("adv-1"), zones.Campaign("c1"), zones.Ad("ad1")} {
+		if loc != time.Local {
+			t.Fatalf("nil Zones的时区 = %v, want time.Local", loc)
+		}
+	}
+}
+
+func TestDate(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	la, _ := time.LoadLocation("America/Los_Angeles")
+	at := time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC)
+
+	if got := timezone.Date(at, tokyo); got != "2024-03-11" {
+		t.Errorf("东京的日期 = %s, want 2024-03-11", got)
+	}
+	if got := timezone.Date(at, la); got != "2024-03-10" {
+		t.Errorf("洛杉矶的日期 = %s, want 2024-03-10", got)
+	}
+}
@@ -0,0 +1,204 @@
+package topics_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/stats"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/topics"
+)
+
+// fakeCluster 内存中的Kafka集群，记录变更调用
+type fakeCluster struct {
+	states  map[string]topics.State
+	calls   []string
+	failing map[string]bool
+}
+
+func newFakeCluster(states map[string]topics.State) *fakeCluster {
+	return &fakeCluster{states: states, failing: map[string]bool{}}
+}
+
+func (f *fakeCluster) Describe(ctx context.Context, names []string) (map[string]topics.State, error) {
+	result := make(map[string]topics.State)
+	for _, name := range names {
+		if state, ok := f.states[name]; ok {
+			result[name] = state
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeCluster) Create(ctx context.Context, spec topics.Spec) error {
+	f.calls = append(f.calls, "create:"+spec.Name)
+	if f.failing[spec.Name] {
+		return errors.New("权限不足")
+	}
+	f.states[spec.Name] = topics.State{Partitions: spec.Partitions, Retention: spec.Retention}
+	return nil
+}
+
+func (f *fakeCluster) AddPartitions(ctx context.Context, name string, total int) error {
+	f.calls = append(f.calls, "add_partitions:"+name)
+	state := f.states[name]
+	state.Partitions = total
+	f.states[name] = state
+	return nil
+}
+
+func (f *fakeCluster) SetRetention(ctx context.Context, name string, retention time.Duration) error {
+	f.calls = append(f.calls, "set_retention:"+name)
+	state := f.states[name]
+	state.Retention = retention
+	f.states[name] = state
+	return nil
+}
+
+func newLogger() *logger.Logger {
+	return logger.NewLogger(zap.NewNop())
+}
+
+func TestEventTopics(t *testing.T) {
+	names := stats.EventTopics()
+	if len(names) != len(stats.EventTypes) {
+		t.Fatalf("主题数 = %d, 期望 %d", len(names), len(stats.EventTypes))
+	}
+	for _, want := range []string{"dsp.events.bid", "dsp.events.impression", "dsp.events.video_complete", "dsp.events.dwell"} {
+		found := false
+		for _, name := range names {
+			found = found || name == want
+		}
+		if !found {
+			t.Errorf("缺少主题%s", want)
+		}
+	}
+}
+
+func TestSpecs(t *testing.T) {
+	cfg := config.KafkaTopicsConfig{
+		ReplicationFactor: 3,
+		Retention:         168 * time.Hour,
+		Overrides: []config.KafkaTopicConfig{
+			{Name: "dsp.events.bid", Partitions: 24, Retention: 24 * time.Hour},
+			{Name: "dsp.identity", Partitions: 3},
+		},
+	}
+	specs := topics.Specs(cfg, []string{"dsp.events.click", "dsp.events.bid"})
+	if len(specs) != 3 {
+		t.Fatalf("主题数 = %d, 期望 3: %+v", len(specs), specs)
+	}
+	byName := make(map[string]topics.Spec)
+	for _, spec := range specs {
+		byName[spec.Name] = spec
+	}
+	// 未设置分区数时默认6
+	if s := byName["dsp.events.click"]; s.Partitions != 6 || s.ReplicationFactor != 3 || s.Retention != 168*time.Hour {
+		t.Errorf("默认配置 = %+v", s)
+	}
+	if s := byName["dsp.events.bid"]; s.Partitions != 24 || s.Retention != 24*time.Hour {
+		t.Errorf("覆盖配置 = %+v", s)
+	}
+	// 覆盖配置中的主题同样创建，未覆盖的保留时间使用默认值
+	if s := byName["dsp.identity"]; s.Partitions != 3 || s.Retention != 168*time.Hour {
+		t.Errorf("额外主题 = %+v", s)
+	}
+	if specs[0].Name != "dsp.events.bid" || specs[2].Name != "dsp.identity" {
+		t.Errorf("应按主题名排序: %+v", specs)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	cluster := newFakeCluster(map[string]topics.State{
+		"few":    {Partitions: 3, Retention: 168 * time.Hour},
+		"many":   {Partitions: 12, Retention: time.Hour},
+		"ok":     {Partitions: 6, Retention: 168 * time.Hour},
+		"noretn": {Partitions: 6, Retention: time.Hour},
+	})
+	specs := []topics.Spec{
+		{Name: "few", Partitions: 6, Retention: 168 * time.Hour},
+		{Name: "many", Partitions: 6, Retention: 168 * time.Hour},
+		{Name: "missing", Partitions: 6},
+		{Name: "noretn", Partitions: 6},
+		{Name: "ok", Partitions: 6, Retention: 168 * time.Hour},
+	}
+	changes, err := topics.Plan(context.Background(), cluster, specs)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, string(c.Action)+":"+c.Topic)
+	}
+	// 分区数只增不减；未设置保留时间时不调整
+	want := "add_partitions:few,skip:many,set_retention:many,create:missing"
+	if strings.Join(got, ",") != want {
+		t.Errorf("变更 = %v, 期望 %s", got, want)
+	}
+	if !strings.Contains(changes[1].String(), "不能减少") {
+		t.Errorf("减少分区的描述 = %s", changes[1])
+	}
+	if len(cluster.calls) != 0 {
+		t.Errorf("Plan不应修改集群: %v", cluster.calls)
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	ctx := context.Background()
+	names := []string{"dsp.events.click", "dsp.events.impression"}
+	cfg := config.KafkaTopicsConfig{AutoCreate: true, Partitions: 6, Retention: 24 * time.Hour}
+
+	// 未启用时不检查
+	cluster := newFakeCluster(map[string]topics.State{})
+	disabled := cfg
+	disabled.AutoCreate = false
+	if changes, err := topics.Ensure(ctx, disabled, cluster, names, newLogger()); err != nil || changes != nil || len(cluster.calls) != 0 {
+		t.Fatalf("未启用时 changes=%v, err=%v, calls=%v", changes, err, cluster.calls)
+	}
+
+	// 试运行只返回变更
+	dryRun := cfg
+	dryRun.DryRun = true
+	changes, err := topics.Ensure(ctx, dryRun, cluster, names, newLogger())
+	if err != nil || len(changes) != 2 || len(cluster.calls) != 0 {
+		t.Fatalf("试运行 changes=%v, err=%v, calls=%v", changes, err, cluster.calls)
+	}
+
+	// 变更后再次检查没有需要进行的变更
+	cluster.states["dsp.events.impression"] = topics.State{Partitions: 2, Retention: 24 * time.Hour}
+	if _, err := topics.Ensure(ctx, cfg, cluster, names, newLogger()); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+	if strings.Join(cluster.calls, ",") != "create:dsp.events.click,add_partitions:dsp.events.impression" {
+		t.Errorf("变更调用 = %v", cluster.calls)
+	}
+	if changes, err := topics.Ensure(ctx, cfg, cluster, names, newLogger()); err != nil || len(changes) != 0 {
+		t.Errorf("再次检查 changes=%v, err=%v", changes, err)
+	}
+}
+
+func TestEnsureContinuesAfterFailure(t *testing.T) {
+	cluster := newFakeCluster(map[string]topics.State{})
+	cluster.failing["a"] = true
+	cfg := config.KafkaTopicsConfig{AutoCreate: true}
+
+	_, err := topics.Ensure(context.Background(), cfg, cluster, []string{"a", "b"}, newLogger())
+	if err == nil || !strings.Contains(err.Error(), "a") {
+		t.Fatalf("创建失败时应返回错误, got %v", err)
+	}
+	if _, ok := cluster.states["b"]; !ok {
+		t.Error("一项变更失败后应继续其余变更")
+	}
+}
+
+func TestNewKafkaCluster(t *testing.T) {
+	if _, err := topics.NewKafkaCluster(nil); !errors.Is(err, topics.ErrBrokersRequired) {
+		t.Errorf("未配置地址时期望ErrBrokersRequired, got %v", err)
+	}
+}
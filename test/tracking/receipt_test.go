@@ -0,0 +1,192 @@
+package tracking_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/tracking"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryReceipts 内存回执存储，记录最近一次查询条件
+type memoryReceipts struct {
+	mu       sync.Mutex
+	receipts []*models.TrackingReceipt
+	query    tracking.ReceiptQuery
+}
+
+func (m *memoryReceipts) Save(ctx context.Context, receipts []*models.TrackingReceipt) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.receipts = append(m.receipts, receipts...)
+	return nil
+}
+
+func (m *memoryReceipts) List(ctx context.Context, q tracking.ReceiptQuery) ([]*models.TrackingReceipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.query = q
+	var out []*models.TrackingReceipt
+	for _, r := range m.receipts {
+		if r.CampaignID == q.CampaignID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryReceipts) Purge(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *memoryReceipts) all() []*models.TrackingReceipt {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*models.TrackingReceipt(nil), m.receipts...)
+}
+
+func TestReceiptsRecordAttempts(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	store := &memoryReceipts{}
+	svc := newService(t, server.URL+"/postback", 2, queue, newMetrics())
+	svc.SetReceiptStore(store)
+	svc.Start()
+
+	event := clickEvent()
+	event.ClickID = "click-1"
+	if err := svc.Track(context.Background(), event); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	waitFor(t, queueEmpty(queue))
+	// 停止时写入剩余的回执
+	svc.Stop()
+
+	receipts := store.all()
+	if len(receipts) != 2 {
+		t.Fatalf("回执数 = %d, want 2", len(receipts))
+	}
+	first, second := receipts[0], receipts[1]
+	if first.Result != tracking.ReceiptRetrying || first.StatusCode != 500 || first.Attempt != 1 || first.Error == "" {
+		t.Errorf("第一次投递的回执 = %+v", first)
+	}
+	if second.Result != tracking.ReceiptDelivered || second.StatusCode != 200 || second.Attempt != 2 {
+		t.Errorf("第二次投递的回执 = %+v", second)
+	}
+	if first.JobID == "" || first.JobID != second.JobID || second.ClickID != "click-1" {
+		t.Errorf("同一事件的回执应有相同的job_id和click_id: %+v %+v", first, second)
+	}
+	if !strings.HasSuffix(second.URL, "/postback") || second.Method != http.MethodPost {
+		t.Errorf("回执应记录请求地址和方法: %s %s", second.Method, second.URL)
+	}
+}
+
+func TestReceiptsRecordDrop(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	store := &memoryReceipts{}
+	svc := newService(t, server.URL, 0, queue, newMetrics())
+	svc.SetReceiptStore(store)
+	svc.Start()
+
+	if err := svc.Track(context.Background(), clickEvent()); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	waitFor(t, queueEmpty(queue))
+	svc.Stop()
+
+	receipts := store.all()
+	if len(receipts) != 1 {
+		t.Fatalf("回执数 = %d, want 1", len(receipts))
+	}
+	if r := receipts[0]; r.Result != tracking.ReceiptDropped || r.Reason != "max_retries" || r.StatusCode != 404 {
+		t.Errorf("放弃投递的回执 = %+v", r)
+	}
+}
+
+func TestReceiptsDisabled(t *testing.T) {
+	svc := newService(t, "http://127.0.0.1:0", 0, newMemoryQueue(), newMetrics())
+	_, err := svc.Receipts(context.Background(), tracking.ReceiptQuery{CampaignID: "c1"})
+	if !errors.Is(err, tracking.ErrReceiptsDisabled) {
+		t.Fatalf("未启用回执时 err = %v, want ErrReceiptsDisabled", err)
+	}
+}
+
+func TestListReceiptsHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &memoryReceipts{receipts: []*models.TrackingReceipt{
+		{JobID: "j1", CampaignID: "c1", EventType: "click", Result: tracking.ReceiptDelivered, StatusCode: 200},
+		{JobID: "j2", CampaignID: "c2", EventType: "click", Result: tracking.ReceiptDropped},
+	}}
+	svc := newService(t, "http://127.0.0.1:0", 0, newMemoryQueue(), newMetrics())
+	svc.SetReceiptStore(store)
+
+	router := gin.New()
+	handlers.NewTrackingHandler(svc, logger.NewLogger(zap.NewNop())).RegisterRoutes(router)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "缺少campaign_id", query: "", want: http.StatusBadRequest},
+		{name: "时间格式错误", query: "campaign_id=c1&start=yesterday", want: http.StatusBadRequest},
+		{name: "超过7天", query: "campaign_id=c1&start=2026-10-01T00:00:00Z&end=2026-10-16T00:00:00Z", want: http.StatusBadRequest},
+		{name: "开始晚于结束", query: "campaign_id=c1&start=2026-10-16T00:00:00Z&end=2026-10-15T00:00:00Z", want: http.StatusBadRequest},
+		{name: "查询成功", query: "campaign_id=c1&event_type=click&start=2026-10-15T00:00:00Z&end=2026-10-16T00:00:00Z&limit=5000", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tracking/receipts?"+tt.query, nil))
+			if w.Code != tt.want {
+				t.Fatalf("状态码 = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	// 最后一次查询成功
+	q := store.query
+	if q.CampaignID != "c1" || q.EventType != "click" || q.Limit != 1000 {
+		t.Errorf("查询条件 = %+v, limit应限制为1000", q)
+	}
+	if want := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC); !q.Start.Equal(want) {
+		t.Errorf("开始时间 = %v, want %v", q.Start, want)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/tracking/receipts?campaign_id=c1", nil))
+	var body struct {
+		Items []models.TrackingReceipt `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if len(body.Items) != 1 || body.Items[0].JobID != "j1" {
+		t.Errorf("回执 = %+v, want j1", body.Items)
+	}
+}
@@ -0,0 +1,415 @@
+package tracking_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/campaign"
+	"simple-dsp/internal/tracking"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryQueue 内存队列
+type memoryQueue struct {
+	mu   sync.Mutex
+	jobs map[string]*tracking.Job
+	due  map[string]time.Time
+}
+
+func newMemoryQueue() *memoryQueue {
+	return &memoryQueue{jobs: map[string]*tracking.Job{}, due: map[string]time.Time{}}
+}
+
+func (q *memoryQueue) Enqueue(ctx context.Context, job *tracking.Job) error {
+	return q.Retry(ctx, job, time.Now())
+}
+
+func (q *memoryQueue) Claim(ctx context.Context, n int, lease time.Duration) ([]*tracking.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	ids := make([]string, 0, len(q.due))
+	for id, at := range q.due {
+		if !at.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return q.due[ids[i]].Before(q.due[ids[j]]) })
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+
+	jobs := make([]*tracking.Job, 0, len(ids))
+	for _, id := range ids {
+		q.due[id] = now.Add(lease)
+		job := *q.jobs[id]
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+func (q *memoryQueue) Retry(ctx context.Context, job *tracking.Job, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	copied := *job
+	q.jobs[job.ID] = &copied
+	q.due[job.ID] = at
+	return nil
+}
+
+func (q *memoryQueue) Ack(ctx context.Context, id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.jobs, id)
+	delete(q.due, id)
+	return nil
+}
+
+func (q *memoryQueue) Depth(ctx context.Context) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.due)), nil
+}
+
+func newMetrics() *metrics.Metrics {
+	return &metrics.Metrics{
+		Tracking: &metrics.TrackingMetrics{
+			Duration:        prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration"}, []string{"event_type"}),
+			Success:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "success"}, []string{"event_type"}),
+			Failure:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "failure"}, []string{"event_type"}),
+			QueueDepth:      prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_depth"}),
+			Retries:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "retries"}, []string{"event_type"}),
+			Dropped:         prometheus.NewCounterVec(prometheus.CounterOpts{Name: "dropped"}, []string{"event_type", "reason"}),
+			BreakerState:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "breaker_state"}, []string{"campaign_id", "event_type"}),
+			BreakerTrips:    prometheus.NewCounterVec(prometheus.CounterOpts{Name: "breaker_trips"}, []string{"event_type"}),
+			BreakerDeferred: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "breaker_deferred"}, []string{"event_type"}),
+			ReceiptsDropped: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "receipts_dropped"}, []string{"reason"}),
+		},
+	}
+}
+
+func newService(t *testing.T, url string, retryCount int, queue tracking.Queue, m *metrics.Metrics) *tracking.Service {
+	t.Helper()
+	return newServiceWithConfig(t, url, retryCount, queue, m, config.TrackingConfig{
+		Workers:      2,
+		PollInterval: 5 * time.Millisecond,
+		MaxAge:       time.Hour,
+		MaxBackoff:   10 * time.Millisecond,
+	})
+}
+
+func newServiceWithConfig(t *testing.T, url string, retryCount int, queue tracking.Queue, m *metrics.Metrics, cfg config.TrackingConfig) *tracking.Service {
+	t.Helper()
+
+	configMgr := campaign.NewConfigManager()
+	err := configMgr.SetConfig(&campaign.Config{
+		CampaignID:   "c1",
+		AdvertiserID: "a1",
+		TrackingConfigs: map[campaign.TrackingType]*campaign.TrackingConfig{
+			campaign.TrackingTypeClick: {
+				URL:           url,
+				Timeout:       time.Second,
+				RetryCount:    retryCount,
+				RetryInterval: time.Millisecond,
+				Enabled:       true,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetConfig: %v", err)
+	}
+
+	return tracking.NewService(cfg, queue, configMgr, logger.NewLogger(zap.NewNop()), m)
+}
+
+func clickEvent() *tracking.TrackingEvent {
+	return &tracking.TrackingEvent{
+		CampaignID: "c1",
+		EventType:  campaign.TrackingTypeClick,
+		Timestamp:  time.Now(),
+		DeviceID:   "d1",
+	}
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func queueEmpty(q *memoryQueue) func() bool {
+	return func() bool {
+		depth, _ := q.Depth(context.Background())
+		return depth == 0
+	}
+}
+
+func TestTrackDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	queue := newMemoryQueue()
+	svc := newService(t, server.URL, 0, queue, newMetrics())
+
+	start := time.Now()
+	if err := svc.Track(context.Background(), clickEvent()); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("Track 阻塞了 %v", elapsed)
+	}
+	if depth, _ := queue.Depth(context.Background()); depth != 1 {
+		t.Fatalf("队列深度 = %d, want 1", depth)
+	}
+}
+
+func TestTrackUnknownCampaign(t *testing.T) {
+	queue := newMemoryQueue()
+	svc := newService(t, "http://127.0.0.1:0", 0, queue, newMetrics())
+
+	event := clickEvent()
+	event.CampaignID = "missing"
+	if err := svc.Track(context.Background(), event); err == nil {
+		t.Fatal("未知计划应返回错误")
+	}
+	if depth, _ := queue.Depth(context.Background()); depth != 0 {
+		t.Fatalf("未知计划的事件不应入队, depth = %d", depth)
+	}
+}
+
+func TestRetryThenSucceed(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	m := newMetrics()
+	svc := newService(t, server.URL, 3, queue, m)
+	svc.Start()
+	defer svc.Stop()
+
+	if err := svc.Track(context.Background(), clickEvent()); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	waitFor(t, queueEmpty(queue))
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+	if got := testutil.ToFloat64(m.Tracking.Success.WithLabelValues("click")); got != 1 {
+		t.Fatalf("success = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Tracking.Retries.WithLabelValues("click")); got != 2 {
+		t.Fatalf("retries = %v, want 2", got)
+	}
+}
+
+func TestDropAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	m := newMetrics()
+	svc := newService(t, server.URL, 2, queue, m)
+	svc.Start()
+	defer svc.Stop()
+
+	if err := svc.Track(context.Background(), clickEvent()); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+	waitFor(t, queueEmpty(queue))
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("calls = %d, want 3", got)
+	}
+	if got := testutil.ToFloat64(m.Tracking.Dropped.WithLabelValues("click", "max_retries")); got != 1 {
+		t.Fatalf("dropped = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.Tracking.Failure.WithLabelValues("click")); got != 1 {
+		t.Fatalf("failure = %v, want 1", got)
+	}
+}
+
+func TestDiscardExpiredJob(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	m := newMetrics()
+	svc := newService(t, server.URL, 3, queue, m)
+
+	// 模拟重启前遗留在队列中的过期事件
+	queue.Enqueue(context.Background(), &tracking.Job{
+		ID:         "stale",
+		Event:      clickEvent(),
+		CreateTime: time.Now().Add(-2 * time.Hour),
+	})
+
+	svc.Start()
+	defer svc.Stop()
+	waitFor(t, queueEmpty(queue))
+
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Fatalf("过期事件不应投递, calls = %d", got)
+	}
+	if got := testutil.ToFloat64(m.Tracking.Dropped.WithLabelValues("click", "max_age")); got != 1 {
+		t.Fatalf("dropped = %v, want 1", got)
+	}
+}
+
+func TestBreakerOpensAndDefers(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	m := newMetrics()
+	svc := newServiceWithConfig(t, server.URL, 10, queue, m, config.TrackingConfig{
+		Workers:          1,
+		PollInterval:     5 * time.Millisecond,
+		MaxAge:           24 * time.Hour,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	svc.Start()
+	defer svc.Stop()
+
+	for i := 0; i < 3; i++ {
+		if err := svc.Track(context.Background(), clickEvent()); err != nil {
+			t.Fatalf("Track: %v", err)
+		}
+	}
+	waitFor(t, func() bool {
+		return testutil.ToFloat64(m.Tracking.BreakerDeferred.WithLabelValues("click")) >= 3
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("熔断后不应继续请求, calls = %d, want 2", got)
+	}
+	if depth, _ := queue.Depth(context.Background()); depth != 3 {
+		t.Fatalf("熔断期间事件应保留在队列中, depth = %d", depth)
+	}
+	if got := testutil.ToFloat64(m.Tracking.BreakerState.WithLabelValues("c1", "click")); got != 1 {
+		t.Fatalf("breaker state = %v, want 1", got)
+	}
+
+	breakers := svc.Breakers()
+	if len(breakers) != 1 || breakers[0].State != tracking.BreakerOpen || breakers[0].Failures != 2 {
+		t.Fatalf("breakers = %+v", breakers)
+	}
+
+	if err := svc.ResetBreaker("c1", campaign.TrackingTypeClick); err != nil {
+		t.Fatalf("ResetBreaker: %v", err)
+	}
+	if len(svc.Breakers()) != 0 {
+		t.Fatal("恢复后不应再有熔断器")
+	}
+	if err := svc.ResetBreaker("c1", campaign.TrackingTypeClick); !errors.Is(err, tracking.ErrBreakerNotFound) {
+		t.Fatalf("err = %v, want ErrBreakerNotFound", err)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	breakers := tracking.NewBreakers(1, 20*time.Millisecond)
+	key := tracking.BreakerKey{CampaignID: "c1", EventType: campaign.TrackingTypeClick}
+
+	if !breakers.Failure(key, "timeout") {
+		t.Fatal("达到阈值应熔断")
+	}
+	if allowed, retryAt := breakers.Allow(key); allowed || retryAt.IsZero() {
+		t.Fatal("熔断期间不应放行")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if allowed, _ := breakers.Allow(key); !allowed {
+		t.Fatal("冷却结束应放行探测请求")
+	}
+	if allowed, _ := breakers.Allow(key); allowed {
+		t.Fatal("探测结果返回前只放行一次")
+	}
+
+	// 探测失败重新熔断
+	if !breakers.Failure(key, "timeout") {
+		t.Fatal("探测失败应重新熔断")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if allowed, _ := breakers.Allow(key); !allowed {
+		t.Fatal("冷却结束应放行探测请求")
+	}
+	breakers.Success(key)
+	if allowed, _ := breakers.Allow(key); !allowed {
+		t.Fatal("探测成功后应恢复")
+	}
+	if len(breakers.List()) != 0 {
+		t.Fatal("恢复后不应保留熔断器")
+	}
+}
+
+func TestTrackingURLMacros(t *testing.T) {
+	queries := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.RawQuery
+	}))
+	defer server.Close()
+
+	queue := newMemoryQueue()
+	svc := newService(t, server.URL+"/t?cid={CAMPAIGN_ID}&click={CLICK_ID}&ip={IP}", 0, queue, newMetrics())
+	svc.Start()
+	defer svc.Stop()
+
+	event := clickEvent()
+	event.ClickID = "a b"
+	event.IP = "10.0.0.1"
+	if err := svc.Track(context.Background(), event); err != nil {
+		t.Fatalf("Track: %v", err)
+	}
+
+	select {
+	case got := <-queries:
+		// 默认白名单不包含IP
+		if want := "cid=c1&click=a+b&ip="; got != want {
+			t.Fatalf("query = %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到跟踪请求")
+	}
+}
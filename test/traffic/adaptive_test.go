@@ -0,0 +1,232 @@
+package traffic_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/exchange"
+	"simple-dsp/internal/traffic"
+	"simple-dsp/pkg/clients"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+func newAdaptiveLimiter(t *testing.T, cfg config.AdaptiveLimitConfig) (*traffic.AdaptiveLimiter, *metrics.Metrics) {
+	t.Helper()
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "test"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+	limiter := traffic.NewAdaptiveLimiter(100, 10, cfg, logger.NewLogger(zap.NewNop()), m)
+	limiter.Start()
+	t.Cleanup(limiter.Stop)
+	return limiter, m
+}
+
+// feed 在后台持续记录下游调用，直到返回的函数被调用
+func feed(limiter *traffic.AdaptiveLimiter, dependency string, elapsed time.Duration, err error) func() {
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i := 0; i < 10; i++ {
+				limiter.Observe(dependency, elapsed, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// waitLimit 等待限流满足条件，返回满足条件时的QPS
+func waitLimit(t *testing.T, limiter *traffic.AdaptiveLimiter, desc string, cond func(float64) bool) float64 {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if limit := limiter.Limit(); cond(limit) {
+			return limit
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: 当前QPS = %v", desc, limiter.Limit())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdaptiveLimiter_Latency(t *testing.T) {
+	limiter, m := newAdaptiveLimiter(t, config.AdaptiveLimitConfig{
+		Interval:       20 * time.Millisecond,
+		MinQPS:         20,
+		DecreaseFactor: 0.5,
+		IncreaseStep:   0.25,
+		MinSamples:     5,
+		Redis:          config.DependencyThresholdConfig{MaxLatency: 10 * time.Millisecond},
+	})
+	if limiter.Limit() != 100 || testutil.ToFloat64(m.Exchange.EffectiveQPS) != 100 {
+		t.Fatalf("初始QPS = %v", limiter.Limit())
+	}
+
+	// Redis平均延迟超过阈值时按系数降低，不低于下限
+	stop := feed(limiter, traffic.DependencyRedis, 50*time.Millisecond, nil)
+	waitLimit(t, limiter, "Redis延迟超过阈值后应降低", func(qps float64) bool { return qps < 100 })
+	if got := testutil.ToFloat64(m.Exchange.DependencyHealthy.WithLabelValues(traffic.DependencyRedis)); got != 0 {
+		t.Fatalf("Redis健康状态 = %v, want 0", got)
+	}
+	waitLimit(t, limiter, "应降低到下限", func(qps float64) bool { return qps == 20 })
+	stop()
+
+	// 恢复后每个间隔按步长回升，不会一次恢复到上限
+	first := waitLimit(t, limiter, "恢复后应回升", func(qps float64) bool { return qps > 20 })
+	if first > 45 {
+		t.Fatalf("恢复后第一次回升到 %v, want <= 45", first)
+	}
+	waitLimit(t, limiter, "应回升到上限", func(qps float64) bool { return qps == 100 })
+	if got := testutil.ToFloat64(m.Exchange.EffectiveQPS); got != 100 {
+		t.Fatalf("EffectiveQPS = %v, want 100", got)
+	}
+}
+
+func TestAdaptiveLimiter_ErrorRate(t *testing.T) {
+	limiter, m := newAdaptiveLimiter(t, config.AdaptiveLimitConfig{
+		Interval:   20 * time.Millisecond,
+		MinSamples: 5,
+		RTA:        config.DependencyThresholdConfig{MaxErrorRate: 0.5},
+	})
+
+	// 延迟未设置阈值时只按错误率判断
+	stop := feed(limiter, traffic.DependencyRTA, time.Second, nil)
+	time.Sleep(60 * time.Millisecond)
+	stop()
+	if limiter.Limit() != 100 {
+		t.Fatalf("未设置延迟阈值时QPS = %v, want 100", limiter.Limit())
+	}
+
+	stop = feed(limiter, traffic.DependencyRTA, time.Millisecond, errors.New("rta unavailable"))
+	defer stop()
+	waitLimit(t, limiter, "RTA错误率超过阈值后应降低", func(qps float64) bool { return qps < 100 })
+	if got := testutil.ToFloat64(m.Exchange.DependencyHealthy.WithLabelValues(traffic.DependencyRTA)); got != 0 {
+		t.Fatalf("RTA健康状态 = %v, want 0", got)
+	}
+}
+
+func TestAdaptiveLimiter_MinSamples(t *testing.T) {
+	limiter, _ := newAdaptiveLimiter(t, config.AdaptiveLimitConfig{
+		Interval:   5 * time.Millisecond,
+		MinSamples: 1000,
+		Redis:      config.DependencyThresholdConfig{MaxErrorRate: 0.1},
+	})
+
+	// 调用次数不足时不评估
+	for i := 0; i < 10; i++ {
+		limiter.Observe(traffic.DependencyRedis, time.Millisecond, errors.New("timeout"))
+	}
+	time.Sleep(30 * time.Millisecond)
+	if limiter.Limit() != 100 {
+		t.Fatalf("调用次数不足时QPS = %v, want 100", limiter.Limit())
+	}
+}
+
+func TestAdaptiveLimiter_Override(t *testing.T) {
+	limiter, m := newAdaptiveLimiter(t, config.AdaptiveLimitConfig{Interval: time.Hour})
+
+	limiter.SetOverride(7)
+	if limiter.Limit() != 7 || testutil.ToFloat64(m.Exchange.EffectiveQPS) != 7 {
+		t.Fatalf("固定后的QPS = %v, gauge %v", limiter.Limit(), testutil.ToFloat64(m.Exchange.EffectiveQPS))
+	}
+	// 固定的QPS可以超过配置的上限
+	limiter.SetOverride(500)
+	if limiter.Limit() != 500 {
+		t.Fatalf("固定后的QPS = %v, want 500", limiter.Limit())
+	}
+	limiter.SetOverride(0)
+	if limiter.Limit() != 100 || testutil.ToFloat64(m.Exchange.EffectiveQPS) != 100 {
+		t.Fatalf("恢复自动调整后的QPS = %v", limiter.Limit())
+	}
+}
+
+func TestHandler_RateLimiter(t *testing.T) {
+	f := newEnrichmentFixture(t, nil)
+	limiter := traffic.NewAdaptiveLimiter(100, 10, config.AdaptiveLimitConfig{}, logger.NewLogger(zap.NewNop()), f.metrics)
+	limiter.SetOverride(0.001)
+	f.handler.SetRateLimiter(limiter)
+
+	post := func() int {
+		body, _ := json.Marshal(traffic.Request{
+			UserID:   "u1",
+			DeviceID: "d1",
+			IP:       "127.0.0.1",
+			AdSlots: []traffic.AdSlot{{
+				SlotID: "slot-1", Width: 320, Height: 50, MaxPrice: 10, Position: "top", AdType: "banner",
+			}},
+		})
+		w := httptest.NewRecorder()
+		f.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/traffic", bytes.NewReader(body)))
+		return w.Code
+	}
+
+	// 固定为极低QPS时突发请求数缩放为1，第二个请求被限流
+	if code := post(); code != http.StatusOK {
+		t.Fatalf("第一个请求 = %d, want 200", code)
+	}
+	if code := post(); code != http.StatusTooManyRequests {
+		t.Fatalf("超过全局限流的请求 = %d, want 429", code)
+	}
+	if got := testutil.ToFloat64(f.metrics.Exchange.Rejected.WithLabelValues(exchange.DefaultExchange, "rate_limited")); got != 1 {
+		t.Fatalf("Rejected{rate_limited} = %v, want 1", got)
+	}
+}
+
+func TestObserveHook(t *testing.T) {
+	type call struct {
+		elapsed time.Duration
+		err     error
+	}
+	var calls []call
+	hook := clients.NewObserveHook(func(elapsed time.Duration, err error) {
+		calls = append(calls, call{elapsed, err})
+	})
+
+	// 键不存在不计为错误
+	get := redis.NewStringCmd(context.Background(), "get", "k")
+	get.SetErr(redis.Nil)
+	ctx, _ := hook.BeforeProcess(context.Background(), get)
+	time.Sleep(2 * time.Millisecond)
+	hook.AfterProcess(ctx, get)
+
+	// 管道按整体计一次，返回第一个错误
+	failed := redis.NewIntCmd(context.Background(), "incr", "k")
+	failed.SetErr(errors.New("LOADING"))
+	cmds := []redis.Cmder{redis.NewStatusCmd(context.Background(), "set", "k", "v"), failed}
+	ctx, _ = hook.BeforeProcessPipeline(context.Background(), cmds)
+	hook.AfterProcessPipeline(ctx, cmds)
+
+	if len(calls) != 2 {
+		t.Fatalf("calls = %+v, want 2", calls)
+	}
+	if calls[0].err != nil || calls[0].elapsed < 2*time.Millisecond {
+		t.Fatalf("命令的观测结果 = %+v", calls[0])
+	}
+	if calls[1].err == nil || calls[1].err.Error() != "LOADING" {
+		t.Fatalf("管道的观测结果 = %+v", calls[1])
+	}
+}
@@ -0,0 +1,42 @@
+package traffic_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// deadlineCounter 记录统计出价次数时上下文的剩余时间
+type deadlineCounter struct {
+	adIDs     []string
+	remaining time.Duration
+	ok        bool
+}
+
+func (c *deadlineCounter) CountBids(ctx context.Context, adIDs []string) error {
+	c.adIDs = adIDs
+	var deadline time.Time
+	deadline, c.ok = ctx.Deadline()
+	c.remaining = time.Until(deadline)
+	return nil
+}
+
+func TestHandler_BidCounterUsesTMax(t *testing.T) {
+	f := newEnrichmentFixture(t, nil)
+	counter := &deadlineCounter{}
+	f.handler.SetBidCounter(counter)
+
+	if n := f.bid(t, "device-1", "user-1"); n != 1 {
+		t.Fatalf("出价数 = %d, want 1", n)
+	}
+	if len(counter.adIDs) != 1 || counter.adIDs[0] != "1" {
+		t.Fatalf("统计的广告 = %v, want [1]", counter.adIDs)
+	}
+	// 统计出价次数受tmax截止时间限制，Redis变慢时不会拖住响应
+	if !counter.ok {
+		t.Fatal("统计出价次数的上下文没有截止时间")
+	}
+	if counter.remaining <= 0 || counter.remaining > time.Second {
+		t.Fatalf("剩余时间 = %s, want 不超过1秒的tmax", counter.remaining)
+	}
+}
@@ -0,0 +1,57 @@
+package traffic_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/traffic"
+)
+
+// slowBidRecords 保存时阻塞到上下文结束，模拟Redis变慢
+type slowBidRecords struct {
+	saves  atomic.Int64
+	budget atomic.Int64
+}
+
+func (s *slowBidRecords) Save(ctx context.Context, record *event.BidRecord) error {
+	s.saves.Add(1)
+	if deadline, ok := ctx.Deadline(); ok {
+		s.budget.Store(int64(time.Until(deadline)))
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (s *slowBidRecords) Get(ctx context.Context, requestID, adID string) (*event.BidRecord, error) {
+	return nil, event.ErrBidRecordNotFound
+}
+
+func TestHandler_BidRecordSaveFailureNoBid(t *testing.T) {
+	f := newEnrichmentFixture(t, nil)
+	records := &slowBidRecords{}
+	f.handler.SetBidRecordStore(records)
+
+	start := time.Now()
+	// 出价记录保存失败时该出价的展示和竞价成功通知无法校验，不出价
+	if n := f.bid(t, "device-1", "user-1"); n != 0 {
+		t.Fatalf("出价数 = %d, want 0", n)
+	}
+	if records.saves.Load() != 1 {
+		t.Fatalf("保存次数 = %d, want 1", records.saves.Load())
+	}
+	// 保存使用单独的时间预算，默认20ms，远小于1秒的tmax
+	if budget := time.Duration(records.budget.Load()); budget <= 0 || budget > 20*time.Millisecond {
+		t.Fatalf("保存的时间预算 = %s, want (0, 20ms]", budget)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("响应耗时 = %s, 保存出价记录不应拖到tmax", elapsed)
+	}
+	if got := testutil.ToFloat64(f.metrics.Bid.StageTimeouts.WithLabelValues(traffic.StageRecord)); got != 1 {
+		t.Fatalf("保存出价记录的超时次数 = %v, want 1", got)
+	}
+}
@@ -0,0 +1,144 @@
+package traffic_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	dspv1 "simple-dsp/api/proto/dsp/v1"
+	"simple-dsp/internal/event"
+	"simple-dsp/internal/skadn"
+	"simple-dsp/internal/traffic"
+)
+
+// memoryBidRecords 内存出价记录
+type memoryBidRecords struct{}
+
+func (memoryBidRecords) Save(ctx context.Context, record *event.BidRecord) error {
+	return nil
+}
+
+func (memoryBidRecords) Get(ctx context.Context, requestID, adID string) (*event.BidRecord, error) {
+	return nil, event.ErrBidRecordNotFound
+}
+
+// singleCampaign 所有广告使用同一个SKAdNetwork配置
+type singleCampaign struct {
+	skadn.Store
+	campaign *skadn.Campaign
+}
+
+func (s singleCampaign) Campaign(ctx context.Context, adID string) (*skadn.Campaign, error) {
+	return s.campaign, nil
+}
+
+func TestHandler_ProtobufResponseExt(t *testing.T) {
+	f := newEnrichmentFixture(t, nil)
+	f.handler.SetBidRecordStore(memoryBidRecords{})
+	f.handler.SetAdServing(event.NewAdTokenSigner("0123456789abcdef0123456789abcdef", time.Minute), "https://ads.example.com")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	signer, err := skadn.NewSigner("example123.skadnetwork", key, []string{"4.0"})
+	if err != nil {
+		t.Fatalf("NewSigner: %v", err)
+	}
+	f.handler.SetSKAdNetwork(signer, singleCampaign{campaign: &skadn.Campaign{ITunesItemID: "1234567891", SourceIdentifier: 5342}})
+
+	body, _ := json.Marshal(traffic.Request{
+		UserID:   "user-1",
+		DeviceID: "device-1",
+		IP:       "127.0.0.1",
+		AdSlots: []traffic.AdSlot{{
+			SlotID: "slot-1", Width: 320, Height: 50, MaxPrice: 10, Position: "top", AdType: "banner",
+		}},
+		SKAdN: &skadn.Request{Versions: []string{"4.0"}, SourceApp: "880047117", SKAdNetIDs: []string{"example123.skadnetwork"}},
+	})
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/traffic", bytes.NewReader(body))
+	r.Header.Set("Accept", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var resp dspv1.BidResponse
+	if err := proto.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析protobuf响应失败: %v", err)
+	}
+	if len(resp.Ads) != 1 {
+		t.Fatalf("广告数 = %d, want 1", len(resp.Ads))
+	}
+	ext := resp.Ads[0].Ext
+	// protobuf没有对应字段的广告信息通过ext携带，与JSON响应一致
+	if got := ext[traffic.ExtCreativeID]; got != "101" {
+		t.Errorf("ext[%s] = %q, want 101", traffic.ExtCreativeID, got)
+	}
+	if got := ext[traffic.ExtAdURL]; !strings.HasPrefix(got, "https://ads.example.com/ad/") {
+		t.Errorf("ext[%s] = %q, want 广告地址", traffic.ExtAdURL, got)
+	}
+	var signed skadn.Response
+	if err := json.Unmarshal([]byte(ext[traffic.ExtSKAdN]), &signed); err != nil {
+		t.Fatalf("ext[%s] = %q, 解析失败: %v", traffic.ExtSKAdN, ext[traffic.ExtSKAdN], err)
+	}
+	if signed.Version != "4.0" || signed.ITunesItem != "1234567891" || signed.SourceIdentifier != "5342" || len(signed.Fidelities) == 0 {
+		t.Errorf("skadn = %+v, want 4.0签名", signed)
+	}
+}
+
+func TestHandler_MaxAdSlots(t *testing.T) {
+	f := newHandlerFixture(t, traffic.HandlerConfig{RTATimeout: time.Second, DefaultTMax: time.Second, MaxAdSlots: 2}, nil, allowAll{})
+
+	slots := func(n int) []*dspv1.AdSlot {
+		var out []*dspv1.AdSlot
+		for i := 0; i < n; i++ {
+			out = append(out, &dspv1.AdSlot{SlotId: fmt.Sprintf("slot-%d", i), Width: 320, Height: 50, MaxPrice: 10, Position: "top", AdType: "banner"})
+		}
+		return out
+	}
+	encodings := map[string]func(n int) []byte{
+		"application/json": func(n int) []byte {
+			req := traffic.Request{UserID: "user-1", DeviceID: "device-1", IP: "127.0.0.1"}
+			for _, slot := range slots(n) {
+				req.AdSlots = append(req.AdSlots, traffic.AdSlot{
+					SlotID: slot.SlotId, Width: int(slot.Width), Height: int(slot.Height), MaxPrice: slot.MaxPrice, Position: slot.Position, AdType: slot.AdType,
+				})
+			}
+			body, _ := json.Marshal(req)
+			return body
+		},
+		"application/x-protobuf": func(n int) []byte {
+			body, _ := proto.Marshal(&dspv1.BidRequest{UserId: "user-1", DeviceId: "device-1", Ip: "127.0.0.1", AdSlots: slots(n)})
+			return body
+		},
+	}
+
+	// JSON和protobuf请求按同一个配置限制广告位数
+	for contentType, encode := range encodings {
+		for _, tt := range []struct {
+			slots int
+			want  int
+		}{{2, http.StatusOK}, {3, http.StatusBadRequest}} {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/traffic", bytes.NewReader(encode(tt.slots)))
+			r.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			f.router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("%s %d个广告位: 状态码 = %d, want %d, body = %s", contentType, tt.slots, w.Code, tt.want, w.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package traffic_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/profile"
+	"simple-dsp/internal/rta"
+	"simple-dsp/internal/traffic"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+)
+
+// memoryRepository 返回固定出价策略的存储实现，只实现竞价用到的方法
+type memoryRepository struct {
+	bidding.Repository
+	strategies []bidding.BidStrategy
+	creatives  map[string][]bidding.BidStrategyCreative
+}
+
+func (m *memoryRepository) ListBidStrategies(ctx context.Context, filter bidding.BidStrategyFilter) ([]bidding.BidStrategy, int64, error) {
+	if filter.Page > 1 {
+		return nil, int64(len(m.strategies)), nil
+	}
+	return m.strategies, int64(len(m.strategies)), nil
+}
+
+func (m *memoryRepository) ListCreatives(ctx context.Context, strategyID string) ([]bidding.BidStrategyCreative, error) {
+	return m.creatives[strategyID], nil
+}
+
+type allowAll struct{}
+
+func (allowAll) CheckAndDeduct(ctx context.Context, budgetID string, amount float64) (bool, error) {
+	return true, nil
+}
+
+func (allowAll) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	return 1, true, nil
+}
+
+// countingProfiles 记录读取次数的用户特征
+type countingProfiles struct {
+	calls atomic.Int64
+}
+
+func (p *countingProfiles) Profile(ctx context.Context, userID string) (*profile.Profile, error) {
+	p.calls.Add(1)
+	return nil, profile.ErrProfileNotFound
+}
+
+type enrichmentFixture struct {
+	router   *gin.Engine
+	handler  *traffic.Handler
+	rtaCalls *atomic.Int64
+	profiles *countingProfiles
+	metrics  *metrics.Metrics
+}
+
+func newEnrichmentFixture(t *testing.T, cache *traffic.EnrichmentCache) *enrichmentFixture {
+	return newEnrichmentFixtureWith(t, cache, allowAll{})
+}
+
+// newEnrichmentFixtureWith 使用指定的频次控制创建流量处理器
+func newEnrichmentFixtureWith(t *testing.T, cache *traffic.EnrichmentCache, freq bidding.FrequencyController) *enrichmentFixture {
+	return newHandlerFixture(t, traffic.HandlerConfig{RTATimeout: time.Second, DefaultTMax: time.Second}, cache, freq)
+}
+
+// newHandlerFixture 使用指定的处理器配置创建流量处理器
+func newHandlerFixture(t *testing.T, cfg traffic.HandlerConfig, cache *traffic.EnrichmentCache, freq bidding.FrequencyController) *enrichmentFixture {
+	gin.SetMode(gin.TestMode)
+
+	var rtaCalls atomic.Int64
+	rtaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rtaCalls.Add(1)
+		w.Write([]byte(`{"code":0,"data":{"is_targeted":true}}`))
+	}))
+	t.Cleanup(rtaServer.Close)
+
+	m, err := metrics.Bootstrap(config.MetricsConfig{Instance: "test"}, "dsp-server")
+	if err != nil {
+		t.Fatalf("Bootstrap() error = %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	log := logger.NewLogger(zap.NewNop())
+	engine := bidding.NewEngine(
+		&memoryRepository{
+			strategies: []bidding.BidStrategy{{ID: "1", Price: 2, Status: 1}},
+			creatives:  map[string][]bidding.BidStrategyCreative{"1": {{ID: 1, StrategyID: 1, CreativeID: 101, Status: 1, Weight: 1}}},
+		},
+		allowAll{},
+		freq,
+		log,
+		m,
+	)
+	profiles := &countingProfiles{}
+	engine.SetUserProfiles(profiles)
+
+	handler := traffic.NewHandler(
+		cfg,
+		nil,
+		rta.NewClient(rtaServer.URL, "test_app_key", "test_app_secret", log, m),
+		engine,
+		nil,
+		log,
+		m,
+	)
+	handler.SetEnrichmentCache(cache)
+
+	router := gin.New()
+	router.POST("/api/v1/traffic", handler.HandleRequest)
+	return &enrichmentFixture{router: router, handler: handler, rtaCalls: &rtaCalls, profiles: profiles, metrics: m}
+}
+
+// bid 发送流量请求，返回出价的广告数
+func (f *enrichmentFixture) bid(t *testing.T, deviceID, userID string) int {
+	body, _ := json.Marshal(traffic.Request{
+		UserID:   userID,
+		DeviceID: deviceID,
+		IP:       "127.0.0.1",
+		AdSlots: []traffic.AdSlot{{
+			SlotID: "slot-1", Width: 320, Height: 50, MaxPrice: 10, Position: "top", AdType: "banner",
+		}},
+	})
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/traffic", bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("状态码 = %d, body = %s", w.Code, w.Body.String())
+	}
+	var resp traffic.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return len(resp.Data)
+}
+
+func TestHandler_EnrichmentCache(t *testing.T) {
+	f := newEnrichmentFixture(t, traffic.NewEnrichmentCache(time.Minute, 0))
+
+	// 同一设备的连续请求只查询一次RTA和用户特征
+	for i := 0; i < 3; i++ {
+		if n := f.bid(t, "device-1", "user-1"); n != 1 {
+			t.Fatalf("第%d次请求出价数 = %d, want 1", i+1, n)
+		}
+	}
+	if got := f.rtaCalls.Load(); got != 1 {
+		t.Errorf("RTA查询次数 = %d, want 1", got)
+	}
+	if got := f.profiles.calls.Load(); got != 1 {
+		t.Errorf("用户特征读取次数 = %d, want 1", got)
+	}
+
+	// 设备对应的用户变化或换了设备时重新组装
+	f.bid(t, "device-1", "user-2")
+	f.bid(t, "device-2", "user-1")
+	if got := f.rtaCalls.Load(); got != 3 {
+		t.Errorf("RTA查询次数 = %d, want 3", got)
+	}
+
+	lookups := f.metrics.Bid.EnrichmentLookups
+	if hit, miss := testutil.ToFloat64(lookups.WithLabelValues("hit")), testutil.ToFloat64(lookups.WithLabelValues("miss")); hit != 2 || miss != 3 {
+		t.Errorf("缓存命中/未命中 = %v/%v, want 2/3", hit, miss)
+	}
+}
+
+// countingSegments 记录读取次数的用户人群包
+type countingSegments struct {
+	calls atomic.Int64
+}
+
+func (s *countingSegments) UserSegments(ctx context.Context, userID string) ([]string, error) {
+	s.calls.Add(1)
+	return []string{"pixel:1:buyers"}, nil
+}
+
+// cappedFrequency 所有策略的频次都已达上限，记录占用曝光的次数
+type cappedFrequency struct {
+	calls atomic.Int64
+}
+
+func (f *cappedFrequency) AcquireImpression(ctx context.Context, userID, adID string) (int64, bool, error) {
+	f.calls.Add(1)
+	return 0, false, nil
+}
+
+func TestHandler_EnrichmentCacheSegments(t *testing.T) {
+	f := newEnrichmentFixture(t, traffic.NewEnrichmentCache(time.Minute, 0))
+	segments := &countingSegments{}
+	f.handler.SetSegmentSource(segments)
+
+	for i := 0; i < 3; i++ {
+		f.bid(t, "device-1", "user-1")
+	}
+	if got := segments.calls.Load(); got != 1 {
+		t.Errorf("人群包读取次数 = %d, want 1", got)
+	}
+}
+
+func TestHandler_EnrichmentCacheFrequency(t *testing.T) {
+	freq := &cappedFrequency{}
+	f := newEnrichmentFixtureWith(t, traffic.NewEnrichmentCache(time.Minute, 0), freq)
+
+	// 频次已达上限的策略记入快照，同一设备的后续请求不再检查
+	for i := 0; i < 3; i++ {
+		if n := f.bid(t, "device-1", "user-1"); n != 0 {
+			t.Fatalf("第%d次请求出价数 = %d, want 0", i+1, n)
+		}
+	}
+	if got := freq.calls.Load(); got != 1 {
+		t.Errorf("占用曝光次数 = %d, want 1", got)
+	}
+	if got := testutil.ToFloat64(f.metrics.Bid.Rejections.WithLabelValues("prefilter", "frequency")); got != 2 {
+		t.Errorf("按频次快照跳过次数 = %v, want 2", got)
+	}
+
+	// 其他设备没有快照，仍实时检查
+	f.bid(t, "device-2", "user-1")
+	if got := freq.calls.Load(); got != 2 {
+		t.Errorf("占用曝光次数 = %d, want 2", got)
+	}
+}
+
+func TestHandler_EnrichmentCacheExpiry(t *testing.T) {
+	f := newEnrichmentFixture(t, traffic.NewEnrichmentCache(50*time.Millisecond, 0))
+
+	f.bid(t, "device-1", "user-1")
+	time.Sleep(100 * time.Millisecond)
+	f.bid(t, "device-1", "user-1")
+	if got := f.rtaCalls.Load(); got != 2 {
+		t.Errorf("过期后RTA查询次数 = %d, want 2", got)
+	}
+}
+
+func TestHandler_EnrichmentCacheMaxEntries(t *testing.T) {
+	cache := traffic.NewEnrichmentCache(time.Minute, 2)
+	f := newEnrichmentFixture(t, cache)
+
+	// 缓存已满时新设备不写入缓存，已缓存的设备仍然命中
+	f.bid(t, "device-1", "user-1")
+	f.bid(t, "device-2", "user-1")
+	f.bid(t, "device-3", "user-1")
+	f.bid(t, "device-3", "user-1")
+	f.bid(t, "device-1", "user-1")
+	if got := cache.Len(); got != 2 {
+		t.Errorf("缓存设备数 = %d, want 2", got)
+	}
+	if got := f.rtaCalls.Load(); got != 4 {
+		t.Errorf("RTA查询次数 = %d, want 4", got)
+	}
+}
+
+func TestHandler_WithoutEnrichmentCache(t *testing.T) {
+	f := newEnrichmentFixture(t, nil)
+
+	f.bid(t, "device-1", "user-1")
+	f.bid(t, "device-1", "user-1")
+	if got := f.rtaCalls.Load(); got != 2 {
+		t.Errorf("RTA查询次数 = %d, want 2", got)
+	}
+	if got := f.profiles.calls.Load(); got != 2 {
+		t.Errorf("用户特征读取次数 = %d, want 2", got)
+	}
+}
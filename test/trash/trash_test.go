@@ -0,0 +1,178 @@
+package trash_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/handlers"
+	"simple-dsp/internal/trash"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStore 内存回收站
+type memoryStore struct {
+	deleted  map[string]time.Time
+	restored []string
+}
+
+func newMemoryStore(deleted map[string]time.Time) *memoryStore {
+	return &memoryStore{deleted: deleted}
+}
+
+func (s *memoryStore) ListDeleted(ctx context.Context) ([]trash.Item, error) {
+	items := make([]trash.Item, 0, len(s.deleted))
+	for id, t := range s.deleted {
+		items = append(items, trash.Item{ID: id, Name: "name-" + id, DeleteTime: t})
+	}
+	return items, nil
+}
+
+func (s *memoryStore) Restore(ctx context.Context, id string) error {
+	if _, ok := s.deleted[id]; !ok {
+		return trash.ErrNotFound
+	}
+	delete(s.deleted, id)
+	s.restored = append(s.restored, id)
+	return nil
+}
+
+func (s *memoryStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	n := 0
+	for id, t := range s.deleted {
+		if t.Before(before) {
+			delete(s.deleted, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func newPurger(retentionDays int, stores map[string]trash.Store) *trash.Purger {
+	return trash.NewPurger(config.TrashConfig{RetentionDays: retentionDays}, stores, logger.NewLogger(zap.NewNop()))
+}
+
+func TestPurger_PurgeExpired(t *testing.T) {
+	now := time.Now()
+	ads := newMemoryStore(map[string]time.Time{
+		"old":    now.AddDate(0, 0, -40),
+		"recent": now.AddDate(0, 0, -3),
+	})
+	campaigns := newMemoryStore(map[string]time.Time{
+		"c1": now.AddDate(0, 0, -31),
+	})
+
+	purger := newPurger(30, map[string]trash.Store{
+		trash.ResourceAds:       ads,
+		trash.ResourceCampaigns: campaigns,
+	})
+	purged := purger.PurgeExpired(context.Background())
+
+	if purged[trash.ResourceAds] != 1 || purged[trash.ResourceCampaigns] != 1 {
+		t.Fatalf("PurgeExpired() = %v", purged)
+	}
+	if _, ok := ads.deleted["recent"]; !ok {
+		t.Error("保留期内的资源不应被清理")
+	}
+}
+
+func TestPurger_ListDeleted(t *testing.T) {
+	deleteTime := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	store := newMemoryStore(map[string]time.Time{"a1": deleteTime})
+
+	purger := newPurger(7, map[string]trash.Store{trash.ResourceAds: store})
+	items, err := purger.ListDeleted(context.Background(), trash.ResourceAds)
+	if err != nil {
+		t.Fatalf("ListDeleted() error = %v", err)
+	}
+	if len(items) != 1 || items[0].PurgeTime == nil || !items[0].PurgeTime.Equal(deleteTime.AddDate(0, 0, 7)) {
+		t.Errorf("ListDeleted() = %+v", items)
+	}
+
+	// 未开启自动清理时不返回预计清理时间
+	purger = newPurger(0, map[string]trash.Store{trash.ResourceAds: store})
+	items, _ = purger.ListDeleted(context.Background(), trash.ResourceAds)
+	if items[0].PurgeTime != nil {
+		t.Errorf("PurgeTime = %v, want nil", items[0].PurgeTime)
+	}
+
+	if _, err := purger.ListDeleted(context.Background(), "budgets"); err != trash.ErrUnknownResource {
+		t.Errorf("ListDeleted(budgets) error = %v, want %v", err, trash.ErrUnknownResource)
+	}
+}
+
+func TestTrashHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Now()
+	store := newMemoryStore(map[string]time.Time{
+		"a1": now.AddDate(0, 0, -10),
+		"a2": now.AddDate(0, 0, -1),
+		"a3": now.AddDate(0, 0, -5),
+	})
+	purger := newPurger(30, map[string]trash.Store{trash.ResourceAds: store})
+
+	r := gin.New()
+	handlers.NewTrashHandler(purger, logger.NewLogger(zap.NewNop())).RegisterRoutes(r)
+	do := func(method, url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(method, url, nil))
+		return rec
+	}
+
+	// 默认按删除时间倒序
+	rec := do(http.MethodGet, "/api/v1/trash/ads")
+	var page struct {
+		Items []trash.Item `json:"items"`
+		Total int64        `json:"total"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	var ids []string
+	for _, item := range page.Items {
+		ids = append(ids, item.ID)
+	}
+	if page.Total != 3 || len(ids) != 3 || ids[0] != "a2" || ids[2] != "a1" {
+		t.Errorf("回收站列表 = %v", ids)
+	}
+
+	if rec := do(http.MethodGet, "/api/v1/trash/budgets"); rec.Code != http.StatusNotFound {
+		t.Errorf("未知资源状态码 = %d", rec.Code)
+	}
+
+	// 恢复
+	if rec := do(http.MethodPost, "/api/v1/trash/ads/a3/restore"); rec.Code != http.StatusOK {
+		t.Fatalf("恢复状态码 = %d, body = %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPost, "/api/v1/trash/ads/a3/restore"); rec.Code != http.StatusNotFound {
+		t.Errorf("重复恢复状态码 = %d", rec.Code)
+	}
+
+	// 默认按保留期清理，未过期的不清理
+	rec = do(http.MethodDelete, "/api/v1/trash/ads")
+	if rec.Code != http.StatusOK || len(store.deleted) != 2 {
+		t.Errorf("按保留期清理后剩余 %d 条, body = %s", len(store.deleted), rec.Body)
+	}
+
+	rec = do(http.MethodDelete, "/api/v1/trash/ads?older_than_days=7")
+	remaining := make([]string, 0, len(store.deleted))
+	for id := range store.deleted {
+		remaining = append(remaining, id)
+	}
+	sort.Strings(remaining)
+	if rec.Code != http.StatusOK || len(remaining) != 1 || remaining[0] != "a2" {
+		t.Errorf("清理7天前删除的资源后剩余 %v", remaining)
+	}
+
+	if rec := do(http.MethodDelete, "/api/v1/trash/ads?older_than_days=-1"); rec.Code != http.StatusBadRequest {
+		t.Errorf("非法天数状态码 = %d", rec.Code)
+	}
+}
@@ -0,0 +1,264 @@
+package velocity_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/bidding"
+	"simple-dsp/internal/budget"
+	"simple-dsp/internal/velocity"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/clock"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+	"simple-dsp/pkg/metrics"
+	"simple-dsp/test/fakeredis"
+)
+
+// fakeSpends 可修改的预算花费
+type fakeSpends struct {
+	mu     sync.Mutex
+	spends []budget.DailySpend
+}
+
+func (f *fakeSpends) DailySpends(ctx context.Context) ([]budget.DailySpend, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]budget.DailySpend(nil), f.spends...), nil
+}
+
+func (f *fakeSpends) set(spends ...budget.DailySpend) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spends = spends
+}
+
+// memoryStrategies 内存出价策略存储，只实现消耗速度保护用到的方法
+type memoryStrategies struct {
+	bidding.Repository
+	mu         sync.Mutex
+	strategies map[int64]*bidding.BidStrategy
+}
+
+func newMemoryStrategies(strategies ...bidding.BidStrategy) *memoryStrategies {
+	m := &memoryStrategies{strategies: make(map[int64]*bidding.BidStrategy)}
+	for i := range strategies {
+		id, _ := strconv.ParseInt(strategies[i].ID, 10, 64)
+		m.strategies[id] = &strategies[i]
+	}
+	return m
+}
+
+func (m *memoryStrategies) GetBidStrategy(ctx context.Context, id int64) (*bidding.BidStrategy, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.strategies[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (m *memoryStrategies) UpdateBidStrategyStatus(ctx context.Context, id int64, status int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategies[id].Status = status
+	return nil
+}
+
+func (m *memoryStrategies) status(id int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.strategies[id].Status
+}
+
+// recordingNotifier 记录发送的通知
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []webhook.EventType
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, eventType webhook.EventType, data interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.events = append(n.events, eventType)
+}
+
+type fixture struct {
+	guard      *velocity.Guard
+	spends     *fakeSpends
+	strategies *memoryStrategies
+	notifier   *recordingNotifier
+	redis      *fakeredis.Server
+	clock      *clock.Fake
+	checks     *prometheus.CounterVec
+	start      time.Time
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	f := &fixture{
+		spends: &fakeSpends{},
+		strategies: newMemoryStrategies(bidding.BidStrategy{
+			ID:         "101",
+			CampaignID: "c1",
+			Status:     bidding.StrategyStatusEnabled,
+		}),
+		notifier: &recordingNotifier{},
+		redis:    fakeredis.New(t),
+		clock:    clock.NewFake(start.Add(10 * time.Hour)),
+		checks:   prometheus.NewCounterVec(prometheus.CounterOpts{Name: "velocity_checks"}, []string{"result"}),
+		start:    start,
+	}
+	m := &metrics.Metrics{Budget: &metrics.BudgetMetrics{VelocityChecks: f.checks}}
+	// 日预算1440，匀速消耗每分钟1，5倍即每分钟5
+	cfg := config.VelocityConfig{Multiplier: 5, MinSpend: 1, ResumeGrace: 30 * time.Minute}
+	f.guard = velocity.NewGuard(cfg, f.spends, f.strategies, f.redis.Client(t), logger.NewLogger(zap.NewNop()), m)
+	f.guard.SetNotifier(f.notifier)
+	f.guard.SetClock(f.clock)
+	return f
+}
+
+// spend 当天周期内已花费spent
+func (f *fixture) spend(spent float64) budget.DailySpend {
+	return budget.DailySpend{
+		BudgetID:  "101",
+		Amount:    1440,
+		Spent:     spent,
+		StartTime: f.start,
+		EndTime:   f.start.Add(24 * time.Hour),
+	}
+}
+
+// check 设置花费后执行一次检查
+func (f *fixture) check(t *testing.T, spend budget.DailySpend) []velocity.Trip {
+	t.Helper()
+	f.spends.set(spend)
+	trips, err := f.guard.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("检查消耗速度失败: %v", err)
+	}
+	return trips
+}
+
+func TestGuard_PausesOnSpike(t *testing.T) {
+	f := newFixture(t)
+
+	if trips := f.check(t, f.spend(600)); len(trips) != 0 {
+		t.Fatalf("第一次检查没有上一次样本，不应暂停: %+v", trips)
+	}
+	f.clock.Advance(time.Minute)
+	if trips := f.check(t, f.spend(603)); len(trips) != 0 {
+		t.Fatalf("每分钟3未超过5倍匀速，不应暂停: %+v", trips)
+	}
+	f.clock.Advance(time.Minute)
+	trips := f.check(t, f.spend(613))
+	if len(trips) != 1 {
+		t.Fatalf("每分钟10超过5倍匀速，应暂停: %+v", trips)
+	}
+	trip := trips[0]
+	if trip.StrategyID != "101" || trip.CampaignID != "c1" || trip.SpendPerMinute != 10 || trip.ExpectedPerMinute != 1 {
+		t.Errorf("暂停记录不正确: %+v", trip)
+	}
+	if got := f.strategies.status(101); got != bidding.StrategyStatusDisabled {
+		t.Errorf("策略状态 = %d, 期望暂停", got)
+	}
+	if len(f.notifier.events) != 1 || f.notifier.events[0] != webhook.EventAnomalyDetected {
+		t.Errorf("应发送一次异常通知: %v", f.notifier.events)
+	}
+	if got := testutil.ToFloat64(f.checks.WithLabelValues("paused")); got != 1 {
+		t.Errorf("paused计数 = %v, 期望1", got)
+	}
+
+	paused, err := f.guard.Paused(context.Background())
+	if err != nil {
+		t.Fatalf("查询暂停记录失败: %v", err)
+	}
+	if len(paused) != 1 || paused[0].StrategyID != "101" || !paused[0].PausedAt.Equal(f.clock.Now()) {
+		t.Errorf("暂停记录不正确: %+v", paused)
+	}
+
+	// 策略已暂停，缓存刷新前的花费不再重复暂停
+	f.clock.Advance(time.Minute)
+	if trips := f.check(t, f.spend(630)); len(trips) != 0 {
+		t.Errorf("已暂停的策略不应再次暂停: %+v", trips)
+	}
+}
+
+func TestGuard_IgnoresSmallSpendAndNewPeriod(t *testing.T) {
+	f := newFixture(t)
+
+	// 只过了6秒，每分钟10但增量低于MinSpend
+	f.check(t, f.spend(100))
+	f.clock.Advance(6 * time.Second)
+	if trips := f.check(t, f.spend(100.9)); len(trips) != 0 {
+		t.Errorf("花费增量低于MinSpend不应暂停: %+v", trips)
+	}
+
+	// 续期后花费从0开始，不与上一周期的样本比较
+	f.clock.Advance(time.Minute)
+	next := f.spend(50)
+	next.StartTime, next.EndTime = f.start.Add(24*time.Hour), f.start.Add(48*time.Hour)
+	if trips := f.check(t, next); len(trips) != 0 {
+		t.Errorf("新周期的第一次样本不应暂停: %+v", trips)
+	}
+	if got := f.strategies.status(101); got != bidding.StrategyStatusEnabled {
+		t.Errorf("策略状态 = %d, 期望投放中", got)
+	}
+}
+
+func TestGuard_ResumeStartsGrace(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+
+	if _, err := f.guard.Resume(ctx, "101", "ops"); !errors.Is(err, velocity.ErrNotPaused) {
+		t.Fatalf("未暂停时恢复应返回ErrNotPaused, got %v", err)
+	}
+
+	f.check(t, f.spend(100))
+	f.clock.Advance(time.Minute)
+	if trips := f.check(t, f.spend(120)); len(trips) != 1 {
+		t.Fatalf("应暂停: %+v", trips)
+	}
+
+	trip, err := f.guard.Resume(ctx, "101", "ops")
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if trip.StrategyID != "101" {
+		t.Errorf("返回的暂停记录不正确: %+v", trip)
+	}
+	if got := f.strategies.status(101); got != bidding.StrategyStatusEnabled {
+		t.Errorf("策略状态 = %d, 期望投放中", got)
+	}
+	if by, ok := f.redis.Get("velocity:grace:101"); !ok || by != "ops" {
+		t.Errorf("应设置宽限期并记录操作人: %q, %v", by, ok)
+	}
+	if paused, _ := f.guard.Paused(ctx); len(paused) != 0 {
+		t.Errorf("恢复后应清除暂停记录: %+v", paused)
+	}
+
+	// 恢复前的样本被丢弃，宽限期内即使花费过快也不暂停
+	f.check(t, f.spend(140))
+	f.clock.Advance(time.Minute)
+	if trips := f.check(t, f.spend(160)); len(trips) != 0 {
+		t.Errorf("宽限期内不应暂停: %+v", trips)
+	}
+	if got := testutil.ToFloat64(f.checks.WithLabelValues("grace")); got != 1 {
+		t.Errorf("grace计数 = %v, 期望1", got)
+	}
+
+	if _, err := f.guard.Resume(ctx, "101", "ops"); !errors.Is(err, velocity.ErrNotPaused) {
+		t.Errorf("重复恢复应返回ErrNotPaused, got %v", err)
+	}
+}
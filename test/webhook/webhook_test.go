@@ -0,0 +1,204 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"simple-dsp/internal/models"
+	"simple-dsp/internal/webhook"
+	"simple-dsp/pkg/config"
+	"simple-dsp/pkg/logger"
+)
+
+// memoryStore 内存订阅和投递记录
+type memoryStore struct {
+	mu         sync.Mutex
+	subs       []*webhook.Subscription
+	deliveries []models.WebhookDelivery
+}
+
+func (s *memoryStore) ListEnabled(ctx context.Context) ([]*webhook.Subscription, error) {
+	var enabled []*webhook.Subscription
+	for _, sub := range s.subs {
+		if sub.Enabled {
+			enabled = append(enabled, sub)
+		}
+	}
+	return enabled, nil
+}
+
+func (s *memoryStore) RecordDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, *delivery)
+	return nil
+}
+
+func (s *memoryStore) records() []models.WebhookDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]models.WebhookDelivery(nil), s.deliveries...)
+}
+
+func newDispatcher(store webhook.Store) *webhook.Dispatcher {
+	return webhook.NewDispatcher(config.WebhookConfig{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}, store, logger.NewLogger(zap.NewNop()))
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"evt-1"}`)
+	now := time.Now().Unix()
+	sig := webhook.Sign("secret", now, body)
+
+	if !webhook.Verify("secret", now, body, sig, time.Minute) {
+		t.Error("有效签名校验失败")
+	}
+	if webhook.Verify("other", now, body, sig, time.Minute) {
+		t.Error("错误密钥不应通过校验")
+	}
+	if webhook.Verify("secret", now, []byte(`{"id":"evt-2"}`), sig, time.Minute) {
+		t.Error("篡改的请求体不应通过校验")
+	}
+
+	old := now - 600
+	if webhook.Verify("secret", old, body, webhook.Sign("secret", old, body), time.Minute) {
+		t.Error("超出时间容差的请求不应通过校验")
+	}
+}
+
+func TestSubscription_Validate(t *testing.T) {
+	valid := webhook.Subscription{
+		Name:   "ops",
+		URL:    "https://example.com/hook",
+		Events: []webhook.EventType{webhook.EventBudgetExhausted},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*webhook.Subscription)
+		want   error
+	}{
+		{"名称为空", func(s *webhook.Subscription) { s.Name = "" }, webhook.ErrNameRequired},
+		{"非http地址", func(s *webhook.Subscription) { s.URL = "ftp://example.com" }, webhook.ErrInvalidURL},
+		{"无事件", func(s *webhook.Subscription) { s.Events = nil }, webhook.ErrNoEvents},
+		{"未知事件", func(s *webhook.Subscription) { s.Events = []webhook.EventType{"budget.created"} }, webhook.ErrUnknownEvent},
+		{"不可订阅测试事件", func(s *webhook.Subscription) { s.Events = []webhook.EventType{webhook.EventPing} }, webhook.ErrUnknownEvent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := valid
+			tt.mutate(&sub)
+			if err := sub.Validate(); !errors.Is(err, tt.want) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DeliverRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		if !webhook.Verify("s3cret", ts, body, r.Header.Get(webhook.HeaderSignature), time.Minute) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{}
+	sub := &webhook.Subscription{ID: "wh-1", URL: srv.URL, Secret: "s3cret"}
+	event := webhook.NewEvent(webhook.EventBudgetExhausted, map[string]string{"budget_id": "b1"})
+
+	delivery, err := newDispatcher(store).Deliver(context.Background(), sub, event)
+	if err != nil {
+		t.Fatalf("Deliver() error = %v", err)
+	}
+	if !delivery.Success || delivery.Attempt != 3 || delivery.StatusCode != http.StatusNoContent {
+		t.Errorf("最后一次投递 = %+v", delivery)
+	}
+
+	records := store.records()
+	if len(records) != 3 || records[0].Success || records[0].StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("投递记录 = %+v", records)
+	}
+	var payload webhook.Event
+	if err := json.Unmarshal(records[0].Payload, &payload); err != nil || payload.ID != event.ID {
+		t.Errorf("投递记录的请求体 = %s", records[0].Payload)
+	}
+}
+
+func TestDispatcher_DeliverPermanentFailure(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "bad payload", http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{}
+	sub := &webhook.Subscription{ID: "wh-1", URL: srv.URL, Secret: "s"}
+	_, err := newDispatcher(store).Deliver(context.Background(), sub, webhook.NewEvent(webhook.EventPing, nil))
+	if !errors.Is(err, webhook.ErrDeliveryFailed) {
+		t.Fatalf("Deliver() error = %v, want %v", err, webhook.ErrDeliveryFailed)
+	}
+	if calls != 1 || len(store.records()) != 1 {
+		t.Errorf("4xx响应不应重试，请求次数 = %d", calls)
+	}
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	received := make(chan string, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.URL.Path + " " + r.Header.Get(webhook.HeaderEvent)
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{subs: []*webhook.Subscription{
+		{ID: "budget", URL: srv.URL + "/budget", Secret: "s", Enabled: true, Events: []webhook.EventType{webhook.EventBudgetExhausted}},
+		{ID: "creative", URL: srv.URL + "/creative", Secret: "s", Enabled: true, Events: []webhook.EventType{webhook.EventCreativeRejected}},
+		{ID: "disabled", URL: srv.URL + "/disabled", Secret: "s", Enabled: false, Events: []webhook.EventType{webhook.EventBudgetExhausted}},
+	}}
+	d := newDispatcher(store)
+	d.Start()
+	defer d.Stop()
+
+	d.Notify(context.Background(), webhook.EventBudgetExhausted, map[string]string{"budget_id": "b1"})
+
+	select {
+	case got := <-received:
+		if got != "/budget budget.exhausted" {
+			t.Errorf("收到的请求 = %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到Webhook请求")
+	}
+
+	select {
+	case got := <-received:
+		t.Errorf("未订阅或已停用的订阅收到了请求: %q", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}